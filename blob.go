@@ -0,0 +1,251 @@
+package gollem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// BlobStore stores content addressed by its SHA-256 hash. Implementations must be safe for
+// concurrent use.
+type BlobStore interface {
+	// Put stores data with its hash. Storing the same hash again must succeed.
+	Put(ctx context.Context, hash string, data []byte) error
+
+	// Get returns the data of hash, or an error wrapping ErrBlobNotFound if it is not stored.
+	Get(ctx context.Context, hash string) ([]byte, error)
+}
+
+// DefaultBlobThreshold is the default minimum size in bytes of message content stored in a
+// BlobStore by BlobHistoryRepository.
+const DefaultBlobThreshold = 4096
+
+// messageContentTypeBlobRef is the type of message content replaced by a blob reference. It is
+// only used in histories saved by BlobHistoryRepository and is never sent to providers.
+const messageContentTypeBlobRef MessageContentType = "blob_ref"
+
+// blobRef is the data of a blob reference content.
+type blobRef struct {
+	Hash string             `json:"hash"`
+	Type MessageContentType `json:"type"`
+	Size int                `json:"size"`
+}
+
+// BlobHistoryRepository is a HistoryRepository that stores large message contents, such as long
+// texts, files and tool results, once in a BlobStore and saves references to them by hash in the
+// underlying repository. Contents repeated across turns and sessions are stored once. Load expands
+// the references, so sessions and providers always receive the full contents.
+type BlobHistoryRepository struct {
+	repo      HistoryRepository
+	store     BlobStore
+	threshold int
+}
+
+// BlobOption is an option of NewBlobHistoryRepository.
+type BlobOption func(*BlobHistoryRepository)
+
+// WithBlobThreshold sets the minimum size in bytes of message content to store in the BlobStore.
+// Default is DefaultBlobThreshold.
+func WithBlobThreshold(size int) BlobOption {
+	return func(r *BlobHistoryRepository) {
+		r.threshold = size
+	}
+}
+
+// NewBlobHistoryRepository creates a BlobHistoryRepository that saves histories to repo and large
+// contents to store.
+func NewBlobHistoryRepository(repo HistoryRepository, store BlobStore, options ...BlobOption) *BlobHistoryRepository {
+	r := &BlobHistoryRepository{
+		repo:      repo,
+		store:     store,
+		threshold: DefaultBlobThreshold,
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	return r
+}
+
+var _ HistoryRepository = (*BlobHistoryRepository)(nil)
+
+// Save stores contents larger than the threshold in the BlobStore and saves the history with
+// references to them. history is not modified.
+func (r *BlobHistoryRepository) Save(ctx context.Context, sessionID string, history *History) error {
+	if history == nil {
+		return r.repo.Save(ctx, sessionID, history)
+	}
+
+	saved := history.Clone()
+	for i := range saved.Messages {
+		for j := range saved.Messages[i].Contents {
+			content := &saved.Messages[i].Contents[j]
+			if len(content.Data) < r.threshold {
+				continue
+			}
+
+			sum := sha256.Sum256(content.Data)
+			ref := blobRef{
+				Hash: hex.EncodeToString(sum[:]),
+				Type: content.Type,
+				Size: len(content.Data),
+			}
+			if err := r.store.Put(ctx, ref.Hash, content.Data); err != nil {
+				return goerr.Wrap(err, "failed to put blob", goerr.V("hash", ref.Hash))
+			}
+
+			data, err := json.Marshal(ref)
+			if err != nil {
+				return goerr.Wrap(err, "failed to marshal blob reference")
+			}
+			content.Type = messageContentTypeBlobRef
+			content.Data = data
+		}
+	}
+
+	return r.repo.Save(ctx, sessionID, saved)
+}
+
+// Load loads the history from the underlying repository and expands blob references.
+func (r *BlobHistoryRepository) Load(ctx context.Context, sessionID string) (*History, error) {
+	history, err := r.repo.Load(ctx, sessionID)
+	if err != nil || history == nil {
+		return history, err
+	}
+
+	for i := range history.Messages {
+		for j := range history.Messages[i].Contents {
+			content := &history.Messages[i].Contents[j]
+			if content.Type != messageContentTypeBlobRef {
+				continue
+			}
+
+			var ref blobRef
+			if err := json.Unmarshal(content.Data, &ref); err != nil {
+				return nil, goerr.Wrap(ErrInvalidHistoryData, "invalid blob reference", goerr.V("error", err))
+			}
+			data, err := r.store.Get(ctx, ref.Hash)
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to get blob", goerr.V("hash", ref.Hash), goerr.V("session_id", sessionID))
+			}
+			content.Type = ref.Type
+			content.Data = data
+		}
+	}
+
+	return history, nil
+}
+
+// MemoryBlobStore is a BlobStore in memory, for tests and single-process applications.
+type MemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryBlobStore creates an empty MemoryBlobStore.
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+// Put stores data with its hash.
+func (s *MemoryBlobStore) Put(_ context.Context, hash string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blobs[hash]; !ok {
+		s.blobs[hash] = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+// Get returns the data of hash.
+func (s *MemoryBlobStore) Get(_ context.Context, hash string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.blobs[hash]
+	if !ok {
+		return nil, goerr.Wrap(ErrBlobNotFound, "blob is not stored", goerr.V("hash", hash))
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Len returns the number of stored blobs.
+func (s *MemoryBlobStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.blobs)
+}
+
+// FileBlobStore is a BlobStore that writes each blob to {dir}/{hash}.
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore creates a FileBlobStore in dir. The directory is created on the first Put.
+func NewFileBlobStore(dir string) *FileBlobStore {
+	return &FileBlobStore{dir: dir}
+}
+
+// Put writes data to {dir}/{hash} unless it already exists.
+func (s *FileBlobStore) Put(_ context.Context, hash string, data []byte) error {
+	if err := validateBlobHash(hash); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return goerr.Wrap(err, "failed to create blob directory", goerr.V("dir", s.dir))
+	}
+	// Write to a temporary file and rename it so that readers never see a partial blob
+	tmp, err := os.CreateTemp(s.dir, hash+".tmp-*")
+	if err != nil {
+		return goerr.Wrap(err, "failed to create blob file", goerr.V("dir", s.dir))
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return goerr.Wrap(err, "failed to write blob file", goerr.V("path", tmp.Name()))
+	}
+	if err := tmp.Close(); err != nil {
+		return goerr.Wrap(err, "failed to close blob file", goerr.V("path", tmp.Name()))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return goerr.Wrap(err, "failed to rename blob file", goerr.V("path", path))
+	}
+	return nil
+}
+
+// Get reads data from {dir}/{hash}.
+func (s *FileBlobStore) Get(_ context.Context, hash string) ([]byte, error) {
+	if err := validateBlobHash(hash); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.dir, hash)
+	data, err := os.ReadFile(path) // #nosec G304 -- hash is validated as hex
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, goerr.Wrap(ErrBlobNotFound, "blob is not stored", goerr.V("hash", hash))
+	}
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to read blob file", goerr.V("path", path))
+	}
+	return data, nil
+}
+
+// validateBlobHash rejects hashes that are not hex-encoded SHA-256, to prevent path traversal.
+func validateBlobHash(hash string) error {
+	if len(hash) != sha256.Size*2 {
+		return goerr.New("invalid blob hash", goerr.V("hash", hash))
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return goerr.New("invalid blob hash", goerr.V("hash", hash))
+	}
+	return nil
+}
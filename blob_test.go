@@ -0,0 +1,99 @@
+package gollem_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestBlobHistoryRepository(t *testing.T) {
+	ctx := context.Background()
+	document := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 200)
+
+	history, err := gollem.NewHistoryBuilder().
+		User(document).
+		Assistant("It is a pangram.").
+		ToolCall("read_file", map[string]any{"path": "a.txt"}, map[string]any{"content": document}).
+		Build()
+	gt.NoError(t, err)
+
+	// the underlying repository keeps serialized histories like a database
+	saved := map[string][]byte{}
+	repo := &mockHistoryRepository{
+		saveFn: func(ctx context.Context, sessionID string, history *gollem.History) error {
+			data, err := json.Marshal(history)
+			saved[sessionID] = data
+			return err
+		},
+		loadFn: func(ctx context.Context, sessionID string) (*gollem.History, error) {
+			data, ok := saved[sessionID]
+			if !ok {
+				return nil, nil
+			}
+			var h gollem.History
+			if err := json.Unmarshal(data, &h); err != nil {
+				return nil, err
+			}
+			return &h, nil
+		},
+	}
+	store := gollem.NewMemoryBlobStore()
+	blobRepo := gollem.NewBlobHistoryRepository(repo, store, gollem.WithBlobThreshold(1024))
+
+	t.Run("large contents are stored once by hash", func(t *testing.T) {
+		gt.NoError(t, blobRepo.Save(ctx, "s1", history))
+		gt.NoError(t, blobRepo.Save(ctx, "s2", history))
+
+		gt.True(t, len(saved["s1"]) < len(document))
+		gt.False(t, strings.Contains(string(saved["s1"]), "quick brown fox"))
+		gt.True(t, strings.Contains(string(saved["s1"]), "It is a pangram."))
+		// the user text and the tool result are different contents
+		gt.Equal(t, 2, store.Len())
+
+		// the given history is not modified
+		text, err := history.Messages[0].Contents[0].GetTextContent()
+		gt.NoError(t, err)
+		gt.Equal(t, document, text.Text)
+	})
+
+	t.Run("load expands references", func(t *testing.T) {
+		loaded, err := blobRepo.Load(ctx, "s1")
+		gt.NoError(t, err)
+		gt.Equal(t, history, loaded)
+	})
+
+	t.Run("missing session", func(t *testing.T) {
+		loaded, err := blobRepo.Load(ctx, "unknown")
+		gt.NoError(t, err)
+		gt.Nil(t, loaded)
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		otherRepo := gollem.NewBlobHistoryRepository(repo, gollem.NewMemoryBlobStore())
+		_, err := otherRepo.Load(ctx, "s1")
+		gt.Error(t, err).Is(gollem.ErrBlobNotFound)
+	})
+}
+
+func TestFileBlobStore(t *testing.T) {
+	ctx := context.Background()
+	store := gollem.NewFileBlobStore(t.TempDir())
+	hash := strings.Repeat("ab", 32)
+
+	_, err := store.Get(ctx, hash)
+	gt.Error(t, err).Is(gollem.ErrBlobNotFound)
+
+	gt.NoError(t, store.Put(ctx, hash, []byte("hello")))
+	gt.NoError(t, store.Put(ctx, hash, []byte("hello")))
+	data, err := store.Get(ctx, hash)
+	gt.NoError(t, err)
+	gt.Equal(t, []byte("hello"), data)
+
+	gt.Error(t, store.Put(ctx, "../escape", []byte("x")))
+	_, err = store.Get(ctx, "../escape")
+	gt.Error(t, err)
+}
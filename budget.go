@@ -0,0 +1,335 @@
+package gollem
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// Pricing is the price of a model in USD per one million tokens.
+type Pricing struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// Cost returns the cost in USD of the given tokens.
+func (p Pricing) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.InputPerMillion + float64(outputTokens)*p.OutputPerMillion) / 1_000_000
+}
+
+// DefaultPricing is the pricing table used by budgets, keyed by model name prefix. The prices
+// are list prices at the time of writing and may be outdated; override them with
+// WithModelPricing.
+var DefaultPricing = map[string]Pricing{
+	"claude-opus-4-5":       {InputPerMillion: 5, OutputPerMillion: 25},
+	"claude-opus-4":         {InputPerMillion: 15, OutputPerMillion: 75},
+	"claude-sonnet-4":       {InputPerMillion: 3, OutputPerMillion: 15},
+	"claude-haiku-4-5":      {InputPerMillion: 1, OutputPerMillion: 5},
+	"claude-3-5-haiku":      {InputPerMillion: 0.8, OutputPerMillion: 4},
+	"gpt-5-mini":            {InputPerMillion: 0.25, OutputPerMillion: 2},
+	"gpt-5":                 {InputPerMillion: 1.25, OutputPerMillion: 10},
+	"gpt-4.1-mini":          {InputPerMillion: 0.4, OutputPerMillion: 1.6},
+	"gpt-4.1":               {InputPerMillion: 2, OutputPerMillion: 8},
+	"gpt-4o-mini":           {InputPerMillion: 0.15, OutputPerMillion: 0.6},
+	"gpt-4o":                {InputPerMillion: 2.5, OutputPerMillion: 10},
+	"gemini-2.5-pro":        {InputPerMillion: 1.25, OutputPerMillion: 10},
+	"gemini-2.5-flash":      {InputPerMillion: 0.3, OutputPerMillion: 2.5},
+	"gemini-2.5-flash-lite": {InputPerMillion: 0.1, OutputPerMillion: 0.4},
+	"gemini-2.0-flash":      {InputPerMillion: 0.1, OutputPerMillion: 0.4},
+}
+
+// bedrockRegionPrefixes are the prefixes of Bedrock cross-region inference profiles.
+var bedrockRegionPrefixes = []string{"us.", "us-gov.", "eu.", "apac.", "jp.", "au.", "ca.", "global."}
+
+// normalizeModel returns the model name of a model ID of Bedrock or Vertex AI, e.g.
+// "claude-sonnet-4-5-20250929-v1:0" for "us.anthropic.claude-sonnet-4-5-20250929-v1:0",
+// "claude-sonnet-4-5" for "claude-sonnet-4-5@20250929", and "gemini-2.5-pro" for
+// "publishers/google/models/gemini-2.5-pro".
+func normalizeModel(model string) string {
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	model, _, _ = strings.Cut(model, "@")
+	for _, prefix := range bedrockRegionPrefixes {
+		if rest, ok := strings.CutPrefix(model, prefix); ok {
+			model = rest
+			break
+		}
+	}
+	if rest, ok := strings.CutPrefix(model, "anthropic."); ok {
+		model = rest
+	}
+	return model
+}
+
+// lookupPricing returns the pricing of the longest prefix of model in pricing. Model IDs of
+// Bedrock and Vertex AI are normalized if model itself does not match.
+func lookupPricing(pricing map[string]Pricing, model string) (Pricing, bool) {
+	if p, ok := lookupPricingPrefix(pricing, model); ok {
+		return p, true
+	}
+	return lookupPricingPrefix(pricing, normalizeModel(model))
+}
+
+func lookupPricingPrefix(pricing map[string]Pricing, model string) (Pricing, bool) {
+	var found Pricing
+	longest := -1
+	for prefix, p := range pricing {
+		if prefix != "" && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			found, longest = p, len(prefix)
+		}
+	}
+	return found, longest >= 0
+}
+
+// unpricedModels returns the models in usage without pricing in ascending order. It's empty if
+// pricing has the fallback of the empty key "".
+func unpricedModels(usage *Usage, pricing map[string]Pricing) []string {
+	if _, ok := pricing[""]; ok || usage == nil {
+		return nil
+	}
+	var models []string
+	for model := range usage.Models {
+		if _, ok := lookupPricing(pricing, model); !ok {
+			models = append(models, model)
+		}
+	}
+	slices.Sort(models)
+	return models
+}
+
+// EstimateCost returns the cost in USD of usage. The pricing of each model in usage.Models is
+// looked up by the longest matching model name prefix in pricing, also with the model name of
+// Bedrock and Vertex AI model IDs such as "us.anthropic.claude-sonnet-4-5-20250929-v1:0".
+// Tokens of unknown models are charged by the pricing of the empty key "" if present, or not
+// charged.
+func EstimateCost(usage *Usage, pricing map[string]Pricing) float64 {
+	if usage == nil {
+		return 0
+	}
+
+	var cost float64
+	restInput, restOutput := usage.InputTokens, usage.OutputTokens
+	for model, u := range usage.Models {
+		p, ok := lookupPricing(pricing, model)
+		if !ok {
+			continue
+		}
+		cost += p.Cost(u.InputTokens, u.OutputTokens)
+		restInput -= u.InputTokens
+		restOutput -= u.OutputTokens
+	}
+	if fallback, ok := pricing[""]; ok {
+		cost += fallback.Cost(restInput, restOutput)
+	}
+	return cost
+}
+
+// BudgetExceededEvent is passed to BudgetExceededHook.
+type BudgetExceededEvent struct {
+	Usage     *Usage
+	CostUSD   float64
+	MaxUSD    float64 // zero if no cost limit
+	MaxTokens int     // zero if no token limit
+
+	// UnpricedModels is the models without pricing. A cost budget is exceeded when a model
+	// without pricing is called, because its cost is unknown.
+	UnpricedModels []string
+}
+
+// BudgetExceededHook is called when a budget is exceeded. Returning an error aborts the
+// execution with the error. Returning nil lets the execution continue, and the hook is not
+// called again for the budget.
+type BudgetExceededHook func(ctx context.Context, event *BudgetExceededEvent) error
+
+// BudgetOption is an option of a budget.
+type BudgetOption func(*Budget)
+
+// WithModelPricing sets the pricing of models whose name starts with model, overriding
+// DefaultPricing. The pricing of the empty model "" is used for calls of unknown models, which
+// otherwise exceed a cost budget.
+func WithModelPricing(model string, pricing Pricing) BudgetOption {
+	return func(b *Budget) {
+		b.pricing[model] = pricing
+	}
+}
+
+// WithBudgetExceededHook sets the hook called when the budget is exceeded instead of aborting
+// the execution with ErrBudgetExceeded.
+func WithBudgetExceededHook(hook BudgetExceededHook) BudgetOption {
+	return func(b *Budget) {
+		b.hook = hook
+	}
+}
+
+// Budget limits the cost and tokens of LLM calls recorded in a UsageTracker. It's checked before
+// each LLM call, so the last call may exceed the limit. A cost budget fails closed: once a model
+// without pricing is called, the budget is exceeded since the cost can not be estimated.
+type Budget struct {
+	tracker   *UsageTracker
+	maxUSD    float64
+	maxTokens int
+	pricing   map[string]Pricing
+	hook      BudgetExceededHook
+
+	mu       sync.Mutex
+	notified bool
+}
+
+// NewBudget creates a Budget of the usage in tracker. Zero maxUSD or maxTokens means no limit
+// of cost or tokens respectively.
+func NewBudget(tracker *UsageTracker, maxUSD float64, maxTokens int, opts ...BudgetOption) *Budget {
+	b := &Budget{
+		tracker:   tracker,
+		maxUSD:    maxUSD,
+		maxTokens: maxTokens,
+		pricing:   maps.Clone(DefaultPricing),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Check returns an error wrapping ErrBudgetExceeded if the budget is exceeded, or calls the
+// BudgetExceededHook if set.
+func (b *Budget) Check(ctx context.Context) error {
+	usage, cost, unpriced, exceeded := b.status()
+	if !exceeded {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.notified {
+		return nil
+	}
+
+	event := &BudgetExceededEvent{
+		Usage:          usage,
+		CostUSD:        cost,
+		MaxUSD:         b.maxUSD,
+		MaxTokens:      b.maxTokens,
+		UnpricedModels: unpriced,
+	}
+	if b.hook == nil && len(unpriced) > 0 {
+		return goerr.Wrap(ErrBudgetExceeded, "cost of models without pricing is unknown",
+			goerr.V("models", unpriced),
+			goerr.V("cost_usd", cost),
+			goerr.V("max_usd", b.maxUSD))
+	}
+	if b.hook == nil {
+		return goerr.Wrap(ErrBudgetExceeded, "budget exceeded",
+			goerr.V("cost_usd", cost),
+			goerr.V("max_usd", b.maxUSD),
+			goerr.V("tokens", usage.InputTokens+usage.OutputTokens),
+			goerr.V("max_tokens", b.maxTokens))
+	}
+	if err := b.hook(ctx, event); err != nil {
+		return goerr.Wrap(err, "budget exceeded hook failed", goerr.T(errTagBudgetHook))
+	}
+	b.notified = true
+	return nil
+}
+
+// status returns the current usage, its cost and the models without pricing, and whether the
+// budget is exceeded.
+func (b *Budget) status() (*Usage, float64, []string, bool) {
+	usage := b.tracker.Usage()
+	cost := EstimateCost(usage, b.pricing)
+	var unpriced []string
+	if b.maxUSD > 0 {
+		unpriced = unpricedModels(usage, b.pricing)
+	}
+	exceeded := (b.maxUSD > 0 && (cost >= b.maxUSD || len(unpriced) > 0)) ||
+		(b.maxTokens > 0 && usage.InputTokens+usage.OutputTokens >= b.maxTokens)
+	return usage, cost, unpriced, exceeded
+}
+
+// exceeded reports whether the budget is exceeded and stops the execution, i.e. the hook has
+// not let it continue.
+func (b *Budget) exceeded() bool {
+	if _, _, _, exceeded := b.status(); !exceeded {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.notified
+}
+
+type budgetScopeCtxKey struct{}
+
+type budgetScope struct {
+	budget *Budget
+	parent *budgetScope
+}
+
+// ContextWithBudget returns a context that makes CheckBudget check budget in addition to the
+// budgets already attached to ctx.
+func ContextWithBudget(ctx context.Context, budget *Budget) context.Context {
+	parent, _ := ctx.Value(budgetScopeCtxKey{}).(*budgetScope)
+	return context.WithValue(ctx, budgetScopeCtxKey{}, &budgetScope{budget: budget, parent: parent})
+}
+
+// CheckBudget checks all budgets attached to ctx, including those of parent agents of a
+// subagent. Strategies and middlewares calling LLM by their own sessions should call it before
+// each call.
+func CheckBudget(ctx context.Context) error {
+	scope, _ := ctx.Value(budgetScopeCtxKey{}).(*budgetScope)
+	for ; scope != nil; scope = scope.parent {
+		if err := scope.budget.Check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// budgetConfig is the budget configured by WithBudget and WithTokenBudget. A Budget is created
+// from it for each Execute.
+type budgetConfig struct {
+	maxUSD    float64
+	maxTokens int
+	options   []BudgetOption
+}
+
+// clone returns a copy of c, or an empty config if c is nil. Options are copied on write so
+// that a cloned agent config does not share the budget with the original.
+func (c *budgetConfig) clone() *budgetConfig {
+	if c == nil {
+		return &budgetConfig{}
+	}
+	return &budgetConfig{
+		maxUSD:    c.maxUSD,
+		maxTokens: c.maxTokens,
+		options:   slices.Clone(c.options),
+	}
+}
+
+// WithBudget limits the estimated cost in USD of each Execute, including LLM calls of the
+// strategy, middlewares and subagents. When the cost reaches maxUSD, the next LLM call is not
+// sent and Execute fails with ErrBudgetExceeded, unless WithBudgetExceededHook is given. The
+// cost is estimated by the model of each response with DefaultPricing and WithModelPricing, and
+// a call of a model without pricing exceeds the budget.
+func WithBudget(maxUSD float64, opts ...BudgetOption) Option {
+	return func(s *gollemConfig) {
+		budget := s.budget.clone()
+		budget.maxUSD = maxUSD
+		budget.options = append(budget.options, opts...)
+		s.budget = budget
+	}
+}
+
+// WithTokenBudget limits the total input and output tokens of each Execute in the same way as
+// WithBudget.
+func WithTokenBudget(maxTokens int, opts ...BudgetOption) Option {
+	return func(s *gollemConfig) {
+		budget := s.budget.clone()
+		budget.maxTokens = maxTokens
+		budget.options = append(budget.options, opts...)
+		s.budget = budget
+	}
+}
@@ -0,0 +1,182 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestEstimateCost(t *testing.T) {
+	pricing := map[string]gollem.Pricing{
+		"model-a":      {InputPerMillion: 1, OutputPerMillion: 10},
+		"model-a-mini": {InputPerMillion: 0.1, OutputPerMillion: 1},
+	}
+	usage := &gollem.Usage{
+		InputTokens:  3_000_000,
+		OutputTokens: 300_000,
+		Models: map[string]gollem.Usage{
+			"model-a-2026":      {InputTokens: 1_000_000, OutputTokens: 100_000},
+			"model-a-mini-2026": {InputTokens: 1_000_000, OutputTokens: 100_000},
+			"unknown":           {InputTokens: 500_000, OutputTokens: 50_000},
+		},
+	}
+
+	t.Run("longest prefix is used", func(t *testing.T) {
+		gt.Equal(t, 2+0.2, gollem.EstimateCost(usage, pricing))
+	})
+
+	t.Run("fallback pricing charges unknown tokens", func(t *testing.T) {
+		pricing[""] = gollem.Pricing{InputPerMillion: 2, OutputPerMillion: 20}
+		// 1M input and 100K output tokens are not attributed to known models
+		gt.Equal(t, 2+0.2+4, gollem.EstimateCost(usage, pricing))
+	})
+
+	t.Run("bedrock and vertex model IDs", func(t *testing.T) {
+		usage := &gollem.Usage{
+			InputTokens:  3_000_000,
+			OutputTokens: 3_000_000,
+			Models: map[string]gollem.Usage{
+				"us.anthropic.claude-sonnet-4-5-20250929-v1:0": {InputTokens: 1_000_000, OutputTokens: 1_000_000},
+				"claude-sonnet-4-5@20250929":                   {InputTokens: 1_000_000, OutputTokens: 1_000_000},
+				"publishers/google/models/gemini-2.5-pro":      {InputTokens: 1_000_000, OutputTokens: 1_000_000},
+			},
+		}
+		gt.Equal(t, 18+18+11.25, gollem.EstimateCost(usage, gollem.DefaultPricing))
+	})
+
+	t.Run("nil usage", func(t *testing.T) {
+		gt.Equal(t, 0.0, gollem.EstimateCost(nil, pricing))
+	})
+}
+
+// newBudgetTestClient returns a client that always calls a tool, so that only a budget stops
+// the agent loop. calls counts Generate calls.
+func newBudgetTestClient(calls *int) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					*calls++
+					return &gollem.Response{
+						FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "noop", Arguments: map[string]any{}}},
+						InputToken:    1000,
+						OutputToken:   100,
+						Model:         "test-model-1",
+					}, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func TestWithBudget(t *testing.T) {
+	noop := &mockTool{
+		spec: gollem.ToolSpec{Name: "noop"},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{}, nil
+		},
+	}
+
+	t.Run("token budget aborts execution", func(t *testing.T) {
+		calls := 0
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop), gollem.WithTokenBudget(3000))
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		// 1100 tokens per call, so the 4th call would be sent after 3300 tokens
+		gt.Equal(t, 3, calls)
+	})
+
+	t.Run("cost budget uses model pricing", func(t *testing.T) {
+		calls := 0
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop),
+			// 1000 * 100 / 1M + 100 * 1000 / 1M = 0.2 USD per call
+			gollem.WithBudget(0.5, gollem.WithModelPricing("test-model", gollem.Pricing{InputPerMillion: 100, OutputPerMillion: 1000})),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		gt.Equal(t, 3, calls)
+	})
+
+	t.Run("hook lets execution continue", func(t *testing.T) {
+		calls := 0
+		var events []*gollem.BudgetExceededEvent
+		hook := func(ctx context.Context, event *gollem.BudgetExceededEvent) error {
+			events = append(events, event)
+			return nil
+		}
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop),
+			gollem.WithTokenBudget(2000, gollem.WithBudgetExceededHook(hook)),
+			gollem.WithLoopLimit(5),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrLoopLimitExceeded)
+		gt.Equal(t, 5, calls)
+
+		// the hook is called only once per Execute
+		gt.A(t, events).Length(1)
+		gt.Equal(t, 2200, events[0].Usage.InputTokens+events[0].Usage.OutputTokens)
+		gt.Equal(t, 2000, events[0].MaxTokens)
+	})
+
+	t.Run("hook error aborts execution", func(t *testing.T) {
+		calls := 0
+		hookErr := errors.New("stop")
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop),
+			gollem.WithTokenBudget(1000, gollem.WithBudgetExceededHook(func(ctx context.Context, event *gollem.BudgetExceededEvent) error {
+				return hookErr
+			})),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(hookErr)
+		gt.Equal(t, 1, calls)
+	})
+
+	t.Run("model without pricing exceeds cost budget", func(t *testing.T) {
+		calls := 0
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop), gollem.WithBudget(100))
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		gt.Equal(t, 1, calls)
+	})
+
+	t.Run("hook is called for model without pricing", func(t *testing.T) {
+		calls := 0
+		var events []*gollem.BudgetExceededEvent
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop),
+			gollem.WithBudget(100, gollem.WithBudgetExceededHook(func(ctx context.Context, event *gollem.BudgetExceededEvent) error {
+				events = append(events, event)
+				return nil
+			})),
+			gollem.WithLoopLimit(3),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrLoopLimitExceeded)
+		gt.Equal(t, 3, calls)
+		gt.A(t, events).Length(1)
+		gt.Equal(t, []string{"test-model-1"}, events[0].UnpricedModels)
+	})
+
+	t.Run("fallback pricing charges model without pricing", func(t *testing.T) {
+		calls := 0
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop),
+			gollem.WithBudget(0.5, gollem.WithModelPricing("", gollem.Pricing{InputPerMillion: 100, OutputPerMillion: 1000})),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		gt.Equal(t, 3, calls)
+	})
+
+	t.Run("budget is per Execute", func(t *testing.T) {
+		calls := 0
+		agent := gollem.New(newBudgetTestClient(&calls), gollem.WithTools(noop), gollem.WithTokenBudget(1000))
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		_, err = agent.Execute(t.Context(), gollem.Text("again"))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		gt.Equal(t, 2, calls)
+	})
+}
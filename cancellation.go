@@ -0,0 +1,193 @@
+package gollem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// CancellationReason is the reason why Execute stopped before completion.
+type CancellationReason string
+
+const (
+	// CancellationReasonCanceled means that a context was canceled.
+	CancellationReasonCanceled CancellationReason = "canceled"
+
+	// CancellationReasonDeadlineExceeded means that a deadline of a context was exceeded.
+	CancellationReasonDeadlineExceeded CancellationReason = "deadline_exceeded"
+
+	// CancellationReasonBudgetExceeded means that a budget by WithBudget, WithTokenBudget or
+	// ContextWithBudget was exceeded.
+	CancellationReasonBudgetExceeded CancellationReason = "budget_exceeded"
+
+	// CancellationReasonLoopLimit means that the loop limit by WithLoopLimit was reached.
+	CancellationReasonLoopLimit CancellationReason = "loop_limit"
+
+	// CancellationReasonHookRejected means that a ConversationStartHook returned an error.
+	CancellationReasonHookRejected CancellationReason = "hook_rejected"
+)
+
+// CancellationInitiator is who stopped Execute.
+type CancellationInitiator string
+
+const (
+	// CancellationInitiatorCaller is the caller of Execute, by canceling ctx or by its deadline.
+	CancellationInitiatorCaller CancellationInitiator = "caller"
+
+	// CancellationInitiatorAgent is the agent itself, by its loop limit, its own budget, or
+	// timeouts inside the execution such as of the LLM client.
+	CancellationInitiatorAgent CancellationInitiator = "agent"
+
+	// CancellationInitiatorParent is a budget not owned by the agent, e.g. of the parent agent
+	// of a subagent or of a strategy.
+	CancellationInitiatorParent CancellationInitiator = "parent"
+
+	// CancellationInitiatorHook is a hook returning an error, such as ConversationStartHook and
+	// BudgetExceededHook.
+	CancellationInitiatorHook CancellationInitiator = "hook"
+)
+
+// ExecutePhase is a phase of Execute.
+type ExecutePhase string
+
+const (
+	// ExecutePhaseInit is the setup of flags, the strategy, tools, hooks and the session.
+	ExecutePhaseInit ExecutePhase = "init"
+
+	// ExecutePhaseStrategy is the handling of each iteration by the strategy.
+	ExecutePhaseStrategy ExecutePhase = "strategy"
+
+	// ExecutePhaseLLMCall is an LLM call of the agent loop, including the budget check before it.
+	ExecutePhaseLLMCall ExecutePhase = "llm_call"
+
+	// ExecutePhaseToolCall is the execution of tools called by the LLM.
+	ExecutePhaseToolCall ExecutePhase = "tool_call"
+
+	// ExecutePhaseFinalize is the completion of the response returned by the strategy, such as
+	// the reasoning summary.
+	ExecutePhaseFinalize ExecutePhase = "finalize"
+)
+
+// CancellationInfo describes why, by whom and when Execute was stopped before completion. It is
+// attached to the error returned by Execute, which CancellationFromError extracts, and passed
+// to ConversationEndHook.
+type CancellationInfo struct {
+	Reason    CancellationReason
+	Initiator CancellationInitiator
+
+	// Phase is the phase of Execute in which it was stopped, and Iteration is the iteration of
+	// the agent loop from 0.
+	Phase     ExecutePhase
+	Iteration int
+
+	// Cause is the cause of the cancellation given by context.WithCancelCause or
+	// context.WithTimeoutCause, if any.
+	Cause error
+
+	// At is the time when Execute was stopped.
+	At time.Time
+}
+
+func (x *CancellationInfo) String() string {
+	s := fmt.Sprintf("%s by %s at %s (iteration %d)", x.Reason, x.Initiator, x.Phase, x.Iteration)
+	if x.Cause != nil {
+		s += ": " + x.Cause.Error()
+	}
+	return s
+}
+
+// CancellationError is the error returned by Execute when it was stopped before completion.
+// Its message and chain are those of Err, so errors.Is with ErrBudgetExceeded or
+// context.Canceled works as before.
+type CancellationError struct {
+	Info *CancellationInfo
+	Err  error
+}
+
+func (e *CancellationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CancellationError) Unwrap() error {
+	return e.Err
+}
+
+// CancellationFromError returns CancellationInfo attached to err, or nil if err is not caused
+// by a cancellation.
+func CancellationFromError(err error) *CancellationInfo {
+	var cancelErr *CancellationError
+	if errors.As(err, &cancelErr) {
+		return cancelErr.Info
+	}
+	return nil
+}
+
+var (
+	// errTagBudgetHook tags errors returned by BudgetExceededHook
+	errTagBudgetHook = goerr.NewTag("budget_hook")
+
+	// errTagStartHook tags errors returned by ConversationStartHook
+	errTagStartHook = goerr.NewTag("conversation_start_hook")
+)
+
+// newCancellationInfo classifies err returned by Execute with ctx of the Execute. budget is
+// the budget owned by the Execute, if any. It returns nil if err is not a cancellation.
+func newCancellationInfo(ctx context.Context, err error, budget *Budget, phase ExecutePhase, iteration int) *CancellationInfo {
+	if err == nil {
+		return nil
+	}
+
+	info := &CancellationInfo{
+		Phase:     phase,
+		Iteration: iteration,
+		At:        Now(ctx),
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		info.Reason = contextCancellationReason(ctx.Err())
+		info.Initiator = CancellationInitiatorCaller
+		if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+			info.Cause = cause
+		}
+
+	case goerr.HasTag(err, errTagStartHook):
+		info.Reason = CancellationReasonHookRejected
+		info.Initiator = CancellationInitiatorHook
+
+	case goerr.HasTag(err, errTagBudgetHook):
+		info.Reason = CancellationReasonBudgetExceeded
+		info.Initiator = CancellationInitiatorHook
+
+	case errors.Is(err, ErrBudgetExceeded):
+		info.Reason = CancellationReasonBudgetExceeded
+		info.Initiator = CancellationInitiatorParent
+		if budget != nil && budget.exceeded() {
+			info.Initiator = CancellationInitiatorAgent
+		}
+
+	case errors.Is(err, ErrLoopLimitExceeded):
+		info.Reason = CancellationReasonLoopLimit
+		info.Initiator = CancellationInitiatorAgent
+
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// ctx of the Execute is alive, so a context inside the execution was canceled
+		info.Reason = contextCancellationReason(err)
+		info.Initiator = CancellationInitiatorAgent
+
+	default:
+		return nil
+	}
+
+	return info
+}
+
+func contextCancellationReason(err error) CancellationReason {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CancellationReasonDeadlineExceeded
+	}
+	return CancellationReasonCanceled
+}
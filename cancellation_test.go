@@ -0,0 +1,138 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestCancellation(t *testing.T) {
+	noop := &mockTool{
+		spec: gollem.ToolSpec{Name: "noop"},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{}, nil
+		},
+	}
+
+	// execute runs agent and checks that end hooks receive the cancellation attached to the
+	// returned error
+	execute := func(t *testing.T, ctx context.Context, client gollem.LLMClient, opts ...gollem.Option) (error, *gollem.CancellationInfo) {
+		t.Helper()
+		var ended *gollem.ConversationEndEvent
+		opts = append(opts, gollem.WithTools(noop), gollem.WithConversationEndHook(func(ctx context.Context, event *gollem.ConversationEndEvent) {
+			ended = event
+		}))
+		_, err := gollem.New(client, opts...).Execute(ctx, gollem.Text("hello"))
+		gt.Error(t, err)
+		gt.NotNil(t, ended)
+		info := gollem.CancellationFromError(err)
+		gt.Equal(t, info, ended.Cancellation)
+		return err, info
+	}
+
+	t.Run("caller cancels ctx", func(t *testing.T) {
+		ctx, cancel := context.WithCancelCause(t.Context())
+		defer cancel(nil)
+		stop := errors.New("user pressed stop")
+
+		calls := 0
+		client := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						calls++
+						if calls == 2 {
+							cancel(stop)
+							return nil, ctx.Err()
+						}
+						return &gollem.Response{
+							FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "noop", Arguments: map[string]any{}}},
+						}, nil
+					},
+				}, nil
+			},
+		}
+
+		err, info := execute(t, ctx, client)
+		gt.Error(t, err).Is(context.Canceled)
+		gt.NotNil(t, info)
+		gt.Equal(t, gollem.CancellationReasonCanceled, info.Reason)
+		gt.Equal(t, gollem.CancellationInitiatorCaller, info.Initiator)
+		gt.Equal(t, gollem.ExecutePhaseLLMCall, info.Phase)
+		gt.Equal(t, 1, info.Iteration)
+		gt.Equal(t, stop, info.Cause)
+		gt.False(t, info.At.IsZero())
+	})
+
+	t.Run("loop limit", func(t *testing.T) {
+		calls := 0
+		err, info := execute(t, t.Context(), newBudgetTestClient(&calls), gollem.WithLoopLimit(3))
+		gt.Error(t, err).Is(gollem.ErrLoopLimitExceeded)
+		gt.Equal(t, gollem.CancellationReasonLoopLimit, info.Reason)
+		gt.Equal(t, gollem.CancellationInitiatorAgent, info.Initiator)
+		gt.Equal(t, gollem.ExecutePhaseStrategy, info.Phase)
+		gt.Equal(t, 3, info.Iteration)
+	})
+
+	t.Run("own budget", func(t *testing.T) {
+		calls := 0
+		err, info := execute(t, t.Context(), newBudgetTestClient(&calls), gollem.WithTokenBudget(2000))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		gt.Equal(t, gollem.CancellationReasonBudgetExceeded, info.Reason)
+		gt.Equal(t, gollem.CancellationInitiatorAgent, info.Initiator)
+		gt.Equal(t, gollem.ExecutePhaseLLMCall, info.Phase)
+		gt.Equal(t, 2, info.Iteration)
+	})
+
+	t.Run("parent budget", func(t *testing.T) {
+		tracker := &gollem.UsageTracker{}
+		ctx := gollem.ContextWithUsageTracker(t.Context(), tracker)
+		ctx = gollem.ContextWithBudget(ctx, gollem.NewBudget(tracker, 0, 1000))
+
+		calls := 0
+		err, info := execute(t, ctx, newBudgetTestClient(&calls), gollem.WithTokenBudget(100_000))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		gt.Equal(t, gollem.CancellationInitiatorParent, info.Initiator)
+		gt.Equal(t, 1, info.Iteration)
+	})
+
+	t.Run("budget hook", func(t *testing.T) {
+		calls := 0
+		hook := gollem.WithBudgetExceededHook(func(ctx context.Context, event *gollem.BudgetExceededEvent) error {
+			return errors.New("stop")
+		})
+		_, info := execute(t, t.Context(), newBudgetTestClient(&calls), gollem.WithTokenBudget(1000, hook))
+		gt.Equal(t, gollem.CancellationReasonBudgetExceeded, info.Reason)
+		gt.Equal(t, gollem.CancellationInitiatorHook, info.Initiator)
+	})
+
+	t.Run("start hook", func(t *testing.T) {
+		calls := 0
+		_, info := execute(t, t.Context(), newBudgetTestClient(&calls),
+			gollem.WithConversationStartHook(func(ctx context.Context, event *gollem.ConversationStartEvent) error {
+				return errors.New("rejected")
+			}))
+		gt.Equal(t, gollem.CancellationReasonHookRejected, info.Reason)
+		gt.Equal(t, gollem.CancellationInitiatorHook, info.Initiator)
+		gt.Equal(t, gollem.ExecutePhaseInit, info.Phase)
+		gt.Equal(t, 0, calls)
+	})
+
+	t.Run("other errors are not cancellations", func(t *testing.T) {
+		client := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						return nil, errors.New("server error")
+					},
+				}, nil
+			},
+		}
+		_, info := execute(t, t.Context(), client)
+		gt.Nil(t, info)
+	})
+}
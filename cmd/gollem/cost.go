@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// defaultTopSpans is the default number of the most expensive spans in a cost report.
+const defaultTopSpans = 10
+
+// spanCost is the token usage and cost in USD of a span. Self fields are of the LLM call of the
+// span, and total fields include the descendant spans.
+type spanCost struct {
+	SpanID string         `json:"span_id"`
+	Name   string         `json:"name"`
+	Kind   trace.SpanKind `json:"kind"`
+	Model  string         `json:"model,omitempty"`
+
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+
+	TotalInputTokens  int     `json:"total_input_tokens"`
+	TotalOutputTokens int     `json:"total_output_tokens"`
+	TotalCostUSD      float64 `json:"total_cost_usd"`
+}
+
+// traceCost is the cost report of a trace.
+type traceCost struct {
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+
+	// UnpricedModels are models of LLM calls without pricing. Their tokens are counted but not
+	// charged.
+	UnpricedModels []string `json:"unpriced_models,omitempty"`
+
+	// Spans are costs of all spans by span ID.
+	Spans map[string]*spanCost `json:"spans"`
+
+	// TopSpans are LLM call spans in descending order of cost.
+	TopSpans []*spanCost `json:"top_spans"`
+}
+
+// computeTraceCost computes token usage and cost of each span of t with pricing keyed by model
+// name prefix, like gollem.DefaultPricing. LLM calls without a model are charged by the model of
+// the trace. At most topN LLM call spans are listed in TopSpans.
+func computeTraceCost(t *trace.Trace, pricing map[string]gollem.Pricing, topN int) *traceCost {
+	report := &traceCost{Spans: map[string]*spanCost{}}
+	unpriced := map[string]struct{}{}
+
+	var walk func(span *trace.Span) *spanCost
+	walk = func(span *trace.Span) *spanCost {
+		sc := &spanCost{SpanID: span.SpanID, Name: span.Name, Kind: span.Kind}
+		if span.Kind == trace.SpanKindLLMCall && span.LLMCall != nil {
+			sc.Model = span.LLMCall.Model
+			if sc.Model == "" {
+				sc.Model = t.Metadata.Model
+			}
+			sc.InputTokens = span.LLMCall.InputTokens
+			sc.OutputTokens = span.LLMCall.OutputTokens
+
+			if p, ok := lookupPricing(pricing, sc.Model); ok {
+				sc.CostUSD = p.Cost(sc.InputTokens, sc.OutputTokens)
+			} else if sc.InputTokens+sc.OutputTokens > 0 {
+				unpriced[sc.Model] = struct{}{}
+			}
+		}
+
+		sc.TotalInputTokens, sc.TotalOutputTokens, sc.TotalCostUSD = sc.InputTokens, sc.OutputTokens, sc.CostUSD
+		for _, child := range span.Children {
+			cc := walk(child)
+			sc.TotalInputTokens += cc.TotalInputTokens
+			sc.TotalOutputTokens += cc.TotalOutputTokens
+			sc.TotalCostUSD += cc.TotalCostUSD
+		}
+		report.Spans[span.SpanID] = sc
+		return sc
+	}
+
+	if t.RootSpan != nil {
+		root := walk(t.RootSpan)
+		report.InputTokens, report.OutputTokens, report.CostUSD = root.TotalInputTokens, root.TotalOutputTokens, root.TotalCostUSD
+	}
+
+	for _, sc := range report.Spans {
+		if sc.Kind == trace.SpanKindLLMCall {
+			report.TopSpans = append(report.TopSpans, sc)
+		}
+	}
+	slices.SortFunc(report.TopSpans, func(a, b *spanCost) int {
+		switch {
+		case a.CostUSD != b.CostUSD:
+			if a.CostUSD > b.CostUSD {
+				return -1
+			}
+			return 1
+		case a.InputTokens+a.OutputTokens != b.InputTokens+b.OutputTokens:
+			return (b.InputTokens + b.OutputTokens) - (a.InputTokens + a.OutputTokens)
+		}
+		return strings.Compare(a.SpanID, b.SpanID)
+	})
+	if len(report.TopSpans) > topN {
+		report.TopSpans = report.TopSpans[:max(topN, 0)]
+	}
+	if report.TopSpans == nil {
+		report.TopSpans = []*spanCost{}
+	}
+
+	report.UnpricedModels = slices.Sorted(maps.Keys(unpriced))
+	return report
+}
+
+// lookupPricing returns the pricing of the longest prefix of model in pricing, or of the empty
+// key "" for unknown models, like budgets of gollem.
+func lookupPricing(pricing map[string]gollem.Pricing, model string) (gollem.Pricing, bool) {
+	var found gollem.Pricing
+	longest := -1
+	for prefix, p := range pricing {
+		if prefix != "" && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			found, longest = p, len(prefix)
+		}
+	}
+	if longest < 0 {
+		found, ok := pricing[""]
+		return found, ok
+	}
+	return found, true
+}
+
+// loadPricing returns gollem.DefaultPricing overridden by the pricing in the JSON file at path,
+// e.g. {"my-model": {"InputPerMillion": 1, "OutputPerMillion": 4}}.
+func loadPricing(path string) (map[string]gollem.Pricing, error) {
+	pricing := maps.Clone(gollem.DefaultPricing)
+	if path == "" {
+		return pricing, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to read pricing file", goerr.Value("path", path))
+	}
+	var overrides map[string]gollem.Pricing
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, goerr.Wrap(err, "failed to parse pricing file", goerr.Value("path", path))
+	}
+	maps.Copy(pricing, overrides)
+	return pricing, nil
+}
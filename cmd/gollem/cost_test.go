@@ -0,0 +1,145 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	main "github.com/m-mizutani/gollem/cmd/gollem"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func TestComputeTraceCost(t *testing.T) {
+	llmCall := func(id, model string, input, output int) *trace.Span {
+		return &trace.Span{
+			SpanID:  id,
+			Kind:    trace.SpanKindLLMCall,
+			Name:    "llm:" + id,
+			LLMCall: &trace.LLMCallData{Model: model, InputTokens: input, OutputTokens: output},
+		}
+	}
+	tr := &trace.Trace{
+		Metadata: trace.TraceMetadata{Model: "big-model"},
+		RootSpan: &trace.Span{
+			SpanID: "root",
+			Kind:   trace.SpanKindAgentExecute,
+			Children: []*trace.Span{
+				llmCall("plan", "", 10_000, 1_000),
+				{
+					SpanID: "sub",
+					Kind:   trace.SpanKindSubAgent,
+					Children: []*trace.Span{
+						llmCall("sub-1", "small-model", 100_000, 10_000),
+						{SpanID: "tool", Kind: trace.SpanKindToolExec},
+					},
+				},
+				llmCall("unknown", "mystery-model", 500, 50),
+			},
+		},
+	}
+	pricing := map[string]gollem.Pricing{
+		"big":   {InputPerMillion: 10, OutputPerMillion: 40},
+		"small": {InputPerMillion: 1, OutputPerMillion: 4},
+	}
+
+	report := main.ComputeTraceCost(tr, pricing, 2)
+
+	// plan: 0.1 + 0.04, sub-1: 0.1 + 0.04
+	gt.Equal(t, report.InputTokens, 110_500)
+	gt.Equal(t, report.OutputTokens, 11_050)
+	gt.True(t, report.CostUSD > 0.2799 && report.CostUSD < 0.2801)
+	gt.Equal(t, report.UnpricedModels, []string{"mystery-model"})
+
+	plan := report.Spans["plan"]
+	gt.Equal(t, plan.Model, "big-model")
+	gt.True(t, plan.CostUSD > 0.1399 && plan.CostUSD < 0.1401)
+
+	sub := report.Spans["sub"]
+	gt.Equal(t, sub.InputTokens, 0)
+	gt.Equal(t, sub.TotalInputTokens, 100_000)
+	gt.True(t, sub.TotalCostUSD > 0.1399 && sub.TotalCostUSD < 0.1401)
+	gt.Equal(t, report.Spans["tool"].TotalCostUSD, 0.0)
+
+	// sub-1 and plan cost the same, so the one of more tokens comes first
+	gt.A(t, report.TopSpans).Length(2)
+	gt.Equal(t, report.TopSpans[0].SpanID, "sub-1")
+	gt.Equal(t, report.TopSpans[1].SpanID, "plan")
+}
+
+func TestLoadPricing(t *testing.T) {
+	t.Run("default pricing", func(t *testing.T) {
+		pricing, err := main.LoadPricing("")
+		gt.NoError(t, err)
+		gt.Equal(t, pricing["gpt-4o"], gollem.DefaultPricing["gpt-4o"])
+	})
+
+	t.Run("overridden by file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pricing.json")
+		gt.NoError(t, os.WriteFile(path, []byte(`{"gpt-4o": {"InputPerMillion": 1, "OutputPerMillion": 2}, "my-model": {"InputPerMillion": 3}}`), 0600))
+
+		pricing, err := main.LoadPricing(path)
+		gt.NoError(t, err)
+		gt.Equal(t, pricing["gpt-4o"], gollem.Pricing{InputPerMillion: 1, OutputPerMillion: 2})
+		gt.Equal(t, pricing["my-model"], gollem.Pricing{InputPerMillion: 3})
+		gt.Equal(t, pricing["gpt-5"], gollem.DefaultPricing["gpt-5"])
+		// the default pricing is not modified
+		gt.Equal(t, gollem.DefaultPricing["gpt-4o"].InputPerMillion, 2.5)
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pricing.json")
+		gt.NoError(t, os.WriteFile(path, []byte(`not json`), 0600))
+		_, err := main.LoadPricing(path)
+		gt.Error(t, err)
+	})
+}
+
+func TestHandleGetCost(t *testing.T) {
+	src := main.NewLocalSource("testdata")
+	s := main.NewServer(
+		main.WithTestSource(src),
+		main.WithPricing(map[string]gollem.Pricing{"gpt-4": {InputPerMillion: 30, OutputPerMillion: 60}}),
+		main.WithTopSpans(5),
+	)
+
+	t.Run("cost of trace", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/costs/trace-001", nil)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		gt.Equal(t, http.StatusOK, rec.Code)
+
+		var resp main.TraceCost
+		gt.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		gt.Equal(t, resp.InputTokens, 150)
+		gt.Equal(t, resp.OutputTokens, 75)
+		// 150 * 30 / 1M + 75 * 60 / 1M
+		gt.True(t, resp.CostUSD > 0.00899 && resp.CostUSD < 0.00901)
+		gt.A(t, resp.TopSpans).Length(1)
+		gt.Equal(t, resp.TopSpans[0].SpanID, "span-002")
+		gt.Equal(t, resp.Spans["span-001"].TotalInputTokens, 150)
+	})
+
+	t.Run("unpriced model", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/costs/trace-002", nil)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		gt.Equal(t, http.StatusOK, rec.Code)
+
+		var resp main.TraceCost
+		gt.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		gt.Equal(t, resp.CostUSD, 0.0)
+		gt.Equal(t, resp.UnpricedModels, []string{"claude-3-sonnet"})
+	})
+
+	t.Run("trace not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/costs/nonexistent", nil)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		gt.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -86,3 +86,31 @@ var ParseGSURI = parseGSURI
 
 // CleanRelativePath is exported for testing.
 var CleanRelativePath = cleanRelativePath
+
+// PrintSnapshot is exported for testing.
+var PrintSnapshot = printSnapshot
+
+// ParsePlan is exported for testing.
+var ParsePlan = parsePlan
+
+// ParseHistory and PrintTokenBreakdown are exported for testing.
+var (
+	ParseHistory        = parseHistory
+	PrintTokenBreakdown = printTokenBreakdown
+)
+
+// Cost report types and functions are exported for testing.
+type (
+	TraceCost = traceCost
+	SpanCost  = spanCost
+)
+
+var (
+	ComputeTraceCost = computeTraceCost
+	LoadPricing      = loadPricing
+	WithPricing      = withPricing
+	WithTopSpans     = withTopSpans
+)
+
+// LatestPlanSnapshots is exported for testing.
+var LatestPlanSnapshots = latestPlanSnapshots
@@ -11133,6 +11133,9 @@ async function listAllEntries(path = "") {
 async function getTrace(tracePath) {
   return fetchJSON(`/traces/${encodeTracePath(tracePath)}`);
 }
+async function getTraceCost(tracePath) {
+  return fetchJSON(`/costs/${encodeTracePath(tracePath)}`);
+}
 function useEntries(path) {
   return useQuery({
     queryKey: ["entries", path],
@@ -11223,6 +11226,12 @@ function formatDuration(ns) {
   const remainingSeconds = seconds % 60;
   return `${minutes}m ${remainingSeconds.toFixed(0)}s`;
 }
+function formatCost(usd) {
+  if (usd === 0) return "$0";
+  if (usd < 0.01) return `$${usd.toFixed(4)}`;
+  if (usd < 1) return `$${usd.toFixed(3)}`;
+  return `$${usd.toFixed(2)}`;
+}
 function formatBytes(bytes) {
   if (bytes < 1024) {
     return `${bytes} B`;
@@ -11488,6 +11497,13 @@ function useTrace(traceID) {
     enabled: !!traceID
   });
 }
+function useTraceCost(traceID) {
+  return useQuery({
+    queryKey: ["trace_cost", traceID],
+    queryFn: () => getTraceCost(traceID),
+    enabled: !!traceID
+  });
+}
 function collectTokens(span) {
   let input = 0;
   let output = 0;
@@ -11502,7 +11518,7 @@ function collectTokens(span) {
   }
   return { input, output };
 }
-function TraceHeader({ trace, backHref = "/" }) {
+function TraceHeader({ trace, cost, backHref = "/" }) {
   var _a2, _b2;
   const duration = computeDurationNs(trace.started_at, trace.ended_at);
   const status = ((_a2 = trace.root_span) == null ? void 0 : _a2.status) || "ok";
@@ -11594,6 +11610,23 @@ function TraceHeader({ trace, backHref = "/" }) {
           " ",
           "out)"
         ] })
+      ] }),
+      cost && /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { children: [
+        /* @__PURE__ */ jsxRuntimeExports.jsx("span", { className: "text-gray-500", children: "Cost:" }),
+        " ",
+        /* @__PURE__ */ jsxRuntimeExports.jsx("span", { className: "font-medium", children: formatCost(cost.cost_usd) }),
+        cost.unpriced_models && cost.unpriced_models.length > 0 && /* @__PURE__ */ jsxRuntimeExports.jsxs(
+          "span",
+          {
+            className: "ml-1 text-xs text-amber-600",
+            title: `No pricing for: ${cost.unpriced_models.join(", ")}`,
+            children: [
+              "(excluding ",
+              cost.unpriced_models.join(", "),
+              ")"
+            ]
+          }
+        )
       ] })
     ] }),
     trace.metadata.labels && Object.keys(trace.metadata.labels).length > 0 && /* @__PURE__ */ jsxRuntimeExports.jsx("div", { className: "flex gap-2", children: Object.entries(trace.metadata.labels).map(([key, val]) => /* @__PURE__ */ jsxRuntimeExports.jsxs(
@@ -11652,9 +11685,11 @@ function SpanNode({
   selectedSpan,
   onSelectSpan,
   defaultExpanded,
-  tokenInfo
+  tokenInfo,
+  cost
 }) {
   const [expanded, setExpanded] = reactExports.useState(defaultExpanded);
+  const spanCost = cost == null ? void 0 : cost.spans[span.span_id];
   const hasChildren = span.children && span.children.length > 0;
   const isSelected = (selectedSpan == null ? void 0 : selectedSpan.span_id) === span.span_id;
   const handleClick = reactExports.useCallback(() => {
@@ -11696,6 +11731,7 @@ function SpanNode({
             formatTokens(tokenInfo.totalTokens),
             " tok"
           ] }),
+          spanCost && spanCost.total_cost_usd > 0 && /* @__PURE__ */ jsxRuntimeExports.jsx("span", { className: "text-xs text-emerald-600 flex-shrink-0 font-mono", children: formatCost(spanCost.total_cost_usd) }),
           span.status === "error" && /* @__PURE__ */ jsxRuntimeExports.jsx("span", { className: "w-2 h-2 rounded-full bg-red-500 flex-shrink-0" })
         ]
       }
@@ -11710,7 +11746,8 @@ function SpanNode({
           selectedSpan,
           onSelectSpan,
           defaultExpanded: depth < 1,
-          tokenInfo: childTokenInfo
+          tokenInfo: childTokenInfo,
+          cost
         },
         child.span_id
       );
@@ -11719,6 +11756,7 @@ function SpanNode({
 }
 function SpanTree({
   rootSpan,
+  cost,
   selectedSpan,
   onSelectSpan
 }) {
@@ -11737,7 +11775,8 @@ function SpanTree({
       selectedSpan,
       onSelectSpan,
       defaultExpanded: true,
-      tokenInfo: rootTokenInfo
+      tokenInfo: rootTokenInfo,
+      cost
     }
   ) });
 }
@@ -22555,10 +22594,68 @@ function LLMCallList({ trace }) {
     }) })
   ] });
 }
+function CostReport({ cost }) {
+  if (!cost) {
+    return /* @__PURE__ */ jsxRuntimeExports.jsx("div", { className: "bg-white border border-gray-200 rounded-lg p-8 text-center text-gray-500 text-sm", children: "Loading cost..." });
+  }
+  return /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { className: "space-y-4", children: [
+    /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { className: "bg-white border border-gray-200 rounded-lg p-4 space-y-2", children: [
+      /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { className: "flex gap-6 text-sm", children: [
+        /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { children: [
+          /* @__PURE__ */ jsxRuntimeExports.jsx("span", { className: "text-gray-500", children: "Total Cost:" }),
+          " ",
+          /* @__PURE__ */ jsxRuntimeExports.jsx("span", { className: "font-medium", children: formatCost(cost.cost_usd) })
+        ] }),
+        /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { children: [
+          /* @__PURE__ */ jsxRuntimeExports.jsx("span", { className: "text-gray-500", children: "Total Tokens:" }),
+          " ",
+          /* @__PURE__ */ jsxRuntimeExports.jsxs("span", { className: "font-medium", children: [
+            cost.input_tokens + cost.output_tokens,
+            " (",
+            cost.input_tokens,
+            " in /",
+            " ",
+            cost.output_tokens,
+            " out)"
+          ] })
+        ] })
+      ] }),
+      cost.unpriced_models && cost.unpriced_models.length > 0 && /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { className: "text-xs text-amber-600", children: [
+        "No pricing for ",
+        cost.unpriced_models.join(", "),
+        "; their tokens are not charged. Set the pricing with the --pricing option of the view command."
+      ] })
+    ] }),
+    /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { className: "bg-white border border-gray-200 rounded-lg", children: [
+      /* @__PURE__ */ jsxRuntimeExports.jsx("div", { className: "px-4 py-3 border-b border-gray-100 text-sm font-medium", children: "Most Expensive LLM Calls" }),
+      cost.top_spans.length === 0 ? /* @__PURE__ */ jsxRuntimeExports.jsx("div", { className: "p-8 text-center text-gray-500 text-sm", children: "No LLM calls in this trace" }) : /* @__PURE__ */ jsxRuntimeExports.jsxs("table", { className: "w-full text-sm", children: [
+        /* @__PURE__ */ jsxRuntimeExports.jsx("thead", { children: /* @__PURE__ */ jsxRuntimeExports.jsxs("tr", { className: "text-left text-xs text-gray-500", children: [
+              /* @__PURE__ */ jsxRuntimeExports.jsx("th", { className: "px-4 py-2 font-medium", children: "#" }),
+              /* @__PURE__ */ jsxRuntimeExports.jsx("th", { className: "px-4 py-2 font-medium", children: "Span" }),
+              /* @__PURE__ */ jsxRuntimeExports.jsx("th", { className: "px-4 py-2 font-medium", children: "Model" }),
+              /* @__PURE__ */ jsxRuntimeExports.jsx("th", { className: "px-4 py-2 font-medium text-right", children: "Input" }),
+              /* @__PURE__ */ jsxRuntimeExports.jsx("th", { className: "px-4 py-2 font-medium text-right", children: "Output" }),
+              /* @__PURE__ */ jsxRuntimeExports.jsx("th", { className: "px-4 py-2 font-medium text-right", children: "Cost" }),
+              /* @__PURE__ */ jsxRuntimeExports.jsx("th", { className: "px-4 py-2 font-medium text-right", children: "Share" })
+        ] }) }),
+        /* @__PURE__ */ jsxRuntimeExports.jsx("tbody", { children: cost.top_spans.map((span, i) => /* @__PURE__ */ jsxRuntimeExports.jsxs("tr", { className: "border-t border-gray-100", children: [
+          /* @__PURE__ */ jsxRuntimeExports.jsx("td", { className: "px-4 py-2 text-xs text-gray-400 font-mono", children: i + 1 }),
+          /* @__PURE__ */ jsxRuntimeExports.jsx("td", { className: "px-4 py-2 truncate max-w-xs", title: span.span_id, children: span.name }),
+          /* @__PURE__ */ jsxRuntimeExports.jsx("td", { className: "px-4 py-2 text-xs text-gray-500", children: span.model || "-" }),
+          /* @__PURE__ */ jsxRuntimeExports.jsx("td", { className: "px-4 py-2 text-right font-mono", children: span.input_tokens }),
+          /* @__PURE__ */ jsxRuntimeExports.jsx("td", { className: "px-4 py-2 text-right font-mono", children: span.output_tokens }),
+          /* @__PURE__ */ jsxRuntimeExports.jsx("td", { className: "px-4 py-2 text-right font-mono", children: formatCost(span.cost_usd) }),
+          /* @__PURE__ */ jsxRuntimeExports.jsx("td", { className: "px-4 py-2 text-right text-xs text-gray-500", children: cost.cost_usd > 0 ? `${(span.cost_usd / cost.cost_usd * 100).toFixed(1)}%` : "-" })
+        ] }, span.span_id)) })
+      ] })
+    ] })
+  ] });
+}
 function TraceDetailPage() {
   const params = useParams();
   const tracePath = params["*"] || "";
   const { data: trace, isLoading, error } = useTrace(tracePath);
+  const { data: cost } = useTraceCost(tracePath);
   const [activeTab, setActiveTab] = reactExports.useState("overview");
   const [selectedSpan, setSelectedSpan] = reactExports.useState(null);
   if (isLoading) {
@@ -22584,10 +22681,11 @@ function TraceDetailPage() {
   const tabs = [
     { key: "overview", label: "Overview" },
     { key: "timeline", label: "Timeline" },
-    { key: "llm_calls", label: "LLM Calls" }
+    { key: "llm_calls", label: "LLM Calls" },
+    { key: "cost", label: "Cost" }
   ];
   return /* @__PURE__ */ jsxRuntimeExports.jsxs("div", { className: "max-w-7xl mx-auto space-y-4", children: [
-    /* @__PURE__ */ jsxRuntimeExports.jsx(TraceHeader, { trace, backHref }),
+    /* @__PURE__ */ jsxRuntimeExports.jsx(TraceHeader, { trace, cost, backHref }),
     /* @__PURE__ */ jsxRuntimeExports.jsx("div", { className: "border-b border-gray-200", children: /* @__PURE__ */ jsxRuntimeExports.jsx("nav", { className: "flex gap-6", children: tabs.map((tab2) => /* @__PURE__ */ jsxRuntimeExports.jsx(
       "button",
       {
@@ -22602,6 +22700,7 @@ function TraceDetailPage() {
         SpanTree,
         {
           rootSpan: trace.root_span,
+          cost,
           selectedSpan,
           onSelectSpan: setSelectedSpan
         }
@@ -22609,7 +22708,8 @@ function TraceDetailPage() {
       /* @__PURE__ */ jsxRuntimeExports.jsx("div", { className: "w-3/5 overflow-auto border border-gray-200 rounded-lg", children: /* @__PURE__ */ jsxRuntimeExports.jsx(SpanDetail, { span: selectedSpan }) })
     ] }),
     activeTab === "timeline" && /* @__PURE__ */ jsxRuntimeExports.jsx(Timeline, { trace }),
-    activeTab === "llm_calls" && /* @__PURE__ */ jsxRuntimeExports.jsx(LLMCallList, { trace })
+    activeTab === "llm_calls" && /* @__PURE__ */ jsxRuntimeExports.jsx(LLMCallList, { trace }),
+    activeTab === "cost" && /* @__PURE__ */ jsxRuntimeExports.jsx(CostReport, { cost })
   ] });
 }
 function LicensePage() {
@@ -1,4 +1,4 @@
-import type { Entry, ListEntriesResponse, Trace } from "./types";
+import type { Entry, ListEntriesResponse, Trace, TraceCost } from "./types";
 
 const BASE_URL = "/api";
 
@@ -54,6 +54,10 @@ export async function getTrace(tracePath: string): Promise<Trace> {
   return fetchJSON<Trace>(`/traces/${encodeTracePath(tracePath)}`);
 }
 
+export async function getTraceCost(tracePath: string): Promise<TraceCost> {
+  return fetchJSON<TraceCost>(`/costs/${encodeTracePath(tracePath)}`);
+}
+
 export async function healthCheck(): Promise<{ status: string }> {
   return fetchJSON<{ status: string }>("/health");
 }
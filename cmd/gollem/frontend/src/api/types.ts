@@ -104,6 +104,29 @@ export interface EventData {
   data: unknown;
 }
 
+// Cost report of a trace, computed by the server from the model pricing
+export interface SpanCost {
+  span_id: string;
+  name: string;
+  kind: SpanKind;
+  model?: string;
+  input_tokens: number;
+  output_tokens: number;
+  cost_usd: number;
+  total_input_tokens: number;
+  total_output_tokens: number;
+  total_cost_usd: number;
+}
+
+export interface TraceCost {
+  input_tokens: number;
+  output_tokens: number;
+  cost_usd: number;
+  unpriced_models?: string[];
+  spans: Record<string, SpanCost>;
+  top_spans: SpanCost[];
+}
+
 // API response types
 export type EntryKind = "file" | "dir";
 
@@ -0,0 +1,99 @@
+import type { TraceCost } from "../api/types";
+import { formatCost } from "../utils/format";
+
+interface CostReportProps {
+  cost?: TraceCost;
+}
+
+export default function CostReport({ cost }: CostReportProps) {
+  if (!cost) {
+    return (
+      <div className="bg-white border border-gray-200 rounded-lg p-8 text-center text-gray-500 text-sm">
+        Loading cost...
+      </div>
+    );
+  }
+
+  return (
+    <div className="space-y-4">
+      {/* Summary */}
+      <div className="bg-white border border-gray-200 rounded-lg p-4 space-y-2">
+        <div className="flex gap-6 text-sm">
+          <div>
+            <span className="text-gray-500">Total Cost:</span>{" "}
+            <span className="font-medium">{formatCost(cost.cost_usd)}</span>
+          </div>
+          <div>
+            <span className="text-gray-500">Total Tokens:</span>{" "}
+            <span className="font-medium">
+              {cost.input_tokens + cost.output_tokens} ({cost.input_tokens} in /{" "}
+              {cost.output_tokens} out)
+            </span>
+          </div>
+        </div>
+        {cost.unpriced_models && cost.unpriced_models.length > 0 && (
+          <div className="text-xs text-amber-600">
+            No pricing for {cost.unpriced_models.join(", ")}; their tokens are
+            not charged. Set the pricing with the --pricing option of the view
+            command.
+          </div>
+        )}
+      </div>
+
+      {/* Most expensive LLM calls */}
+      <div className="bg-white border border-gray-200 rounded-lg">
+        <div className="px-4 py-3 border-b border-gray-100 text-sm font-medium">
+          Most Expensive LLM Calls
+        </div>
+        {cost.top_spans.length === 0 ? (
+          <div className="p-8 text-center text-gray-500 text-sm">
+            No LLM calls in this trace
+          </div>
+        ) : (
+          <table className="w-full text-sm">
+            <thead>
+              <tr className="text-left text-xs text-gray-500">
+                <th className="px-4 py-2 font-medium">#</th>
+                <th className="px-4 py-2 font-medium">Span</th>
+                <th className="px-4 py-2 font-medium">Model</th>
+                <th className="px-4 py-2 font-medium text-right">Input</th>
+                <th className="px-4 py-2 font-medium text-right">Output</th>
+                <th className="px-4 py-2 font-medium text-right">Cost</th>
+                <th className="px-4 py-2 font-medium text-right">Share</th>
+              </tr>
+            </thead>
+            <tbody>
+              {cost.top_spans.map((span, i) => (
+                <tr key={span.span_id} className="border-t border-gray-100">
+                  <td className="px-4 py-2 text-xs text-gray-400 font-mono">
+                    {i + 1}
+                  </td>
+                  <td className="px-4 py-2 truncate max-w-xs" title={span.span_id}>
+                    {span.name}
+                  </td>
+                  <td className="px-4 py-2 text-xs text-gray-500">
+                    {span.model || "-"}
+                  </td>
+                  <td className="px-4 py-2 text-right font-mono">
+                    {span.input_tokens}
+                  </td>
+                  <td className="px-4 py-2 text-right font-mono">
+                    {span.output_tokens}
+                  </td>
+                  <td className="px-4 py-2 text-right font-mono">
+                    {formatCost(span.cost_usd)}
+                  </td>
+                  <td className="px-4 py-2 text-right text-xs text-gray-500">
+                    {cost.cost_usd > 0
+                      ? `${((span.cost_usd / cost.cost_usd) * 100).toFixed(1)}%`
+                      : "-"}
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        )}
+      </div>
+    </div>
+  );
+}
@@ -1,9 +1,10 @@
 import { useState, useCallback, useMemo } from "react";
-import type { Span, SpanKind } from "../api/types";
-import { formatDuration } from "../utils/format";
+import type { Span, SpanKind, TraceCost } from "../api/types";
+import { formatDuration, formatCost } from "../utils/format";
 
 interface SpanTreeProps {
   rootSpan: Span | null;
+  cost?: TraceCost;
   selectedSpan: Span | null;
   onSelectSpan: (span: Span) => void;
 }
@@ -65,6 +66,7 @@ interface SpanNodeProps {
   onSelectSpan: (span: Span) => void;
   defaultExpanded: boolean;
   tokenInfo?: SpanTokenInfo;
+  cost?: TraceCost;
 }
 
 function SpanNode({
@@ -74,8 +76,10 @@ function SpanNode({
   onSelectSpan,
   defaultExpanded,
   tokenInfo,
+  cost,
 }: SpanNodeProps) {
   const [expanded, setExpanded] = useState(defaultExpanded);
+  const spanCost = cost?.spans[span.span_id];
   const hasChildren = span.children && span.children.length > 0;
   const isSelected = selectedSpan?.span_id === span.span_id;
 
@@ -133,6 +137,12 @@ function SpanNode({
           </span>
         )}
 
+        {spanCost && spanCost.total_cost_usd > 0 && (
+          <span className="text-xs text-emerald-600 flex-shrink-0 font-mono">
+            {formatCost(spanCost.total_cost_usd)}
+          </span>
+        )}
+
         {span.status === "error" && (
           <span className="w-2 h-2 rounded-full bg-red-500 flex-shrink-0" />
         )}
@@ -151,6 +161,7 @@ function SpanNode({
               onSelectSpan={onSelectSpan}
               defaultExpanded={depth < 1}
               tokenInfo={childTokenInfo}
+              cost={cost}
             />
           );
         })}
@@ -160,6 +171,7 @@ function SpanNode({
 
 export default function SpanTree({
   rootSpan,
+  cost,
   selectedSpan,
   onSelectSpan,
 }: SpanTreeProps) {
@@ -183,6 +195,7 @@ export default function SpanTree({
         onSelectSpan={onSelectSpan}
         defaultExpanded={true}
         tokenInfo={rootTokenInfo}
+        cost={cost}
       />
     </div>
   );
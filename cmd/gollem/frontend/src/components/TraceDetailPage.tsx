@@ -1,20 +1,22 @@
 import { useState } from "react";
 import { useParams, Link } from "react-router-dom";
-import { useTrace } from "../hooks/useTrace";
+import { useTrace, useTraceCost } from "../hooks/useTrace";
 import type { Span } from "../api/types";
 import TraceHeader from "./TraceHeader";
 import SpanTree from "./SpanTree";
 import SpanDetail from "./SpanDetail";
 import Timeline from "./Timeline";
 import LLMCallList from "./LLMCallList";
+import CostReport from "./CostReport";
 
-type Tab = "overview" | "timeline" | "llm_calls";
+type Tab = "overview" | "timeline" | "llm_calls" | "cost";
 
 export default function TraceDetailPage() {
   // The "/traces/*" route stores the splat under params["*"], preserving slashes.
   const params = useParams();
   const tracePath = params["*"] || "";
   const { data: trace, isLoading, error } = useTrace(tracePath);
+  const { data: cost } = useTraceCost(tracePath);
   const [activeTab, setActiveTab] = useState<Tab>("overview");
   const [selectedSpan, setSelectedSpan] = useState<Span | null>(null);
 
@@ -61,11 +63,12 @@ export default function TraceDetailPage() {
     { key: "overview", label: "Overview" },
     { key: "timeline", label: "Timeline" },
     { key: "llm_calls", label: "LLM Calls" },
+    { key: "cost", label: "Cost" },
   ];
 
   return (
     <div className="max-w-7xl mx-auto space-y-4">
-      <TraceHeader trace={trace} backHref={backHref} />
+      <TraceHeader trace={trace} cost={cost} backHref={backHref} />
 
       <div className="border-b border-gray-200">
         <nav className="flex gap-6">
@@ -90,6 +93,7 @@ export default function TraceDetailPage() {
           <div className="w-2/5 overflow-auto border border-gray-200 rounded-lg">
             <SpanTree
               rootSpan={trace.root_span}
+              cost={cost}
               selectedSpan={selectedSpan}
               onSelectSpan={setSelectedSpan}
             />
@@ -103,6 +107,8 @@ export default function TraceDetailPage() {
       {activeTab === "timeline" && <Timeline trace={trace} />}
 
       {activeTab === "llm_calls" && <LLMCallList trace={trace} />}
+
+      {activeTab === "cost" && <CostReport cost={cost} />}
     </div>
   );
 }
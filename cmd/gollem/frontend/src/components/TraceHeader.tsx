@@ -1,9 +1,10 @@
 import { Link } from "react-router-dom";
-import type { Trace, Span } from "../api/types";
-import { formatDuration, computeDurationNs } from "../utils/format";
+import type { Trace, Span, TraceCost } from "../api/types";
+import { formatDuration, computeDurationNs, formatCost } from "../utils/format";
 
 interface TraceHeaderProps {
   trace: Trace;
+  cost?: TraceCost;
   backHref?: string;
 }
 
@@ -22,7 +23,7 @@ function collectTokens(span: Span): { input: number; output: number } {
   return { input, output };
 }
 
-export default function TraceHeader({ trace, backHref = "/" }: TraceHeaderProps) {
+export default function TraceHeader({ trace, cost, backHref = "/" }: TraceHeaderProps) {
   const duration = computeDurationNs(trace.started_at, trace.ended_at);
   const status = trace.root_span?.status || "ok";
   const errorMsg = trace.root_span?.error;
@@ -107,6 +108,20 @@ export default function TraceHeader({ trace, backHref = "/" }: TraceHeaderProps)
             out)
           </span>
         </div>
+        {cost && (
+          <div>
+            <span className="text-gray-500">Cost:</span>{" "}
+            <span className="font-medium">{formatCost(cost.cost_usd)}</span>
+            {cost.unpriced_models && cost.unpriced_models.length > 0 && (
+              <span
+                className="ml-1 text-xs text-amber-600"
+                title={`No pricing for: ${cost.unpriced_models.join(", ")}`}
+              >
+                (excluding {cost.unpriced_models.join(", ")})
+              </span>
+            )}
+          </div>
+        )}
       </div>
 
       {trace.metadata.labels && Object.keys(trace.metadata.labels).length > 0 && (
@@ -1,5 +1,5 @@
 import { useQuery } from "@tanstack/react-query";
-import { getTrace } from "../api/client";
+import { getTrace, getTraceCost } from "../api/client";
 
 export function useTrace(traceID: string) {
   return useQuery({
@@ -8,3 +8,11 @@ export function useTrace(traceID: string) {
     enabled: !!traceID,
   });
 }
+
+export function useTraceCost(traceID: string) {
+  return useQuery({
+    queryKey: ["trace_cost", traceID],
+    queryFn: () => getTraceCost(traceID),
+    enabled: !!traceID,
+  });
+}
@@ -15,6 +15,14 @@ export function formatDuration(ns: number): string {
   return `${minutes}m ${remainingSeconds.toFixed(0)}s`;
 }
 
+// Format a cost in USD, with more digits for small costs
+export function formatCost(usd: number): string {
+  if (usd === 0) return "$0";
+  if (usd < 0.01) return `$${usd.toFixed(4)}`;
+  if (usd < 1) return `$${usd.toFixed(3)}`;
+  return `$${usd.toFixed(2)}`;
+}
+
 // Format bytes to human-readable size
 export function formatBytes(bytes: number): string {
   if (bytes < 1024) {
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+
+	"github.com/m-mizutani/gollem/trace"
 )
 
 type apiError struct {
@@ -83,26 +85,43 @@ func (s *server) handleListTraces(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleGetTrace(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.getTrace(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *server) handleGetCost(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.getTrace(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, computeTraceCost(t, s.pricing, s.topSpans))
+}
+
+// getTrace returns the trace of the path in the request, or writes an error response and returns
+// false.
+func (s *server) getTrace(w http.ResponseWriter, r *http.Request) (*trace.Trace, bool) {
 	// The "{path...}" wildcard path value preserves slashes in the matched portion.
 	tracePath := r.PathValue("path")
 	tracePath = strings.TrimPrefix(tracePath, "/")
 	if tracePath == "" {
 		writeError(w, http.StatusBadRequest, "trace path is required")
-		return
+		return nil, false
 	}
 
 	cleaned, err := cleanRelativePath(tracePath)
 	if err != nil || cleaned == "" {
 		writeError(w, http.StatusBadRequest, "invalid trace path")
-		return
+		return nil, false
 	}
 
 	t, err := s.source.Get(r.Context(), cleaned)
 	if err != nil {
 		slog.Error("failed to get trace", slog.Any("error", err), slog.String("path", cleaned))
 		writeError(w, http.StatusNotFound, "trace not found")
-		return
+		return nil, false
 	}
-
-	writeJSON(w, http.StatusOK, t)
+	return t, true
 }
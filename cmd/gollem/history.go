@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/urfave/cli/v3"
+)
+
+// barWidth is the width of the bar representing 100% of tokens
+const barWidth = 40
+
+func historyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "Tools for saved conversation histories",
+		Commands: []*cli.Command{
+			historyTokensCommand(),
+		},
+	}
+}
+
+func historyTokensCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "tokens",
+		Usage:     "Show estimated tokens per message, role and tool",
+		ArgsUsage: "<history.json | snapshot.json>",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			path := cmd.Args().First()
+			if path == "" {
+				return fmt.Errorf("history file is required")
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return goerr.Wrap(err, "failed to read history file", goerr.Value("path", path))
+			}
+
+			history, err := parseHistory(data)
+			if err != nil {
+				return err
+			}
+
+			return printTokenBreakdown(cmd.Root().Writer, history.TokenBreakdown(nil))
+		},
+	}
+}
+
+// parseHistory decodes a history from JSON of gollem.History, or from the history of a snapshot.
+func parseHistory(data []byte) (*gollem.History, error) {
+	var snapshot struct {
+		History json.RawMessage `json:"history"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, goerr.Wrap(err, "failed to parse history file")
+	}
+	if len(snapshot.History) > 0 {
+		data = snapshot.History
+	}
+
+	var history gollem.History
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, goerr.Wrap(err, "failed to parse history")
+	}
+	return &history, nil
+}
+
+// printTokenBreakdown writes b as tables with bars proportional to the share of tokens.
+func printTokenBreakdown(w io.Writer, b *gollem.HistoryTokenBreakdown) error {
+	p := &textPrinter{w: w}
+
+	p.printf("Total: %d tokens (estimated), %d messages\n", b.Total, len(b.Messages))
+
+	roles := make(map[string]int, len(b.ByRole))
+	for role, tokens := range b.ByRole {
+		roles[string(role)] = tokens
+	}
+	p.section("By role")
+	printTokenRows(p, roles, b.Total)
+
+	if len(b.ByTool) > 0 {
+		p.section("By tool")
+		printTokenRows(p, b.ByTool, b.Total)
+	}
+
+	p.section("Messages")
+	for _, msg := range b.Messages {
+		label := fmt.Sprintf("#%d %s", msg.Index+1, msg.Role)
+		if len(msg.Tools) > 0 {
+			label += " (" + strings.Join(msg.Tools, ", ") + ")"
+		}
+		p.printf("  %s\n", tokenRow(label, msg.Tokens, b.Total))
+	}
+
+	return p.err
+}
+
+// printTokenRows prints rows of tokens by name in descending order of tokens.
+func printTokenRows(p *textPrinter, tokens map[string]int, total int) {
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if tokens[names[i]] != tokens[names[j]] {
+			return tokens[names[i]] > tokens[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		p.printf("  %s\n", tokenRow(name, tokens[name], total))
+	}
+}
+
+func tokenRow(label string, tokens, total int) string {
+	var share float64
+	if total > 0 {
+		share = float64(tokens) / float64(total)
+	}
+	bar := strings.Repeat("█", int(share*barWidth+0.5))
+	return fmt.Sprintf("%-32s %8d %6.1f%%  %s", label, tokens, share*100, bar)
+}
@@ -0,0 +1,38 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	main "github.com/m-mizutani/gollem/cmd/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestHistoryTokens(t *testing.T) {
+	t.Run("history in snapshot", func(t *testing.T) {
+		data := gt.R1(os.ReadFile("testdata/exec-001.snapshot.json")).NoError(t)
+		history := gt.R1(main.ParseHistory(data)).NoError(t)
+		gt.A(t, history.Messages).Length(3)
+
+		var buf bytes.Buffer
+		gt.NoError(t, main.PrintTokenBreakdown(&buf, history.TokenBreakdown(nil)))
+		out := buf.String()
+		gt.True(t, strings.Contains(out, "3 messages"))
+		gt.True(t, strings.Contains(out, "== By tool =="))
+		gt.True(t, strings.Contains(out, "#2 assistant (search)"))
+	})
+
+	t.Run("history JSON", func(t *testing.T) {
+		history := gt.R1(main.ParseHistory([]byte(`{"type":"claude","version":3,"messages":[{"role":"user","contents":[{"type":"text","data":{"text":"hello"}}]}]}`))).NoError(t)
+		gt.Equal(t, gollem.LLMTypeClaude, history.LLType)
+		gt.A(t, history.Messages).Length(1)
+	})
+
+	t.Run("unsupported history version", func(t *testing.T) {
+		_, err := main.ParseHistory([]byte(`{"type":"claude","version":1,"messages":[]}`))
+		gt.Error(t, err)
+	})
+}
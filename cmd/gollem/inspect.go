@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/urfave/cli/v3"
+)
+
+// snapshotData is the JSON representation of gollem.Snapshot. It is decoded independently of
+// the gollem module so that snapshots of any gollem version can be inspected.
+type snapshotData struct {
+	ID        string `json:"id"`
+	ExecID    string `json:"exec_id"`
+	CreatedAt string `json:"created_at"`
+	Error     string `json:"error"`
+
+	Versions struct {
+		Go        string `json:"go"`
+		Gollem    string `json:"gollem"`
+		LLMClient string `json:"llm_client"`
+	} `json:"versions"`
+
+	Config struct {
+		SystemPrompt string          `json:"system_prompt"`
+		LoopLimit    int             `json:"loop_limit"`
+		ResponseMode string          `json:"response_mode"`
+		ContentType  string          `json:"content_type"`
+		Strategy     string          `json:"strategy"`
+		ToolNames    []string        `json:"tool_names"`
+		Flags        map[string]bool `json:"flags"`
+	} `json:"config"`
+
+	Inputs     []string `json:"inputs"`
+	LastInputs []string `json:"last_inputs"`
+
+	History *struct {
+		Messages []struct {
+			Role     string `json:"role"`
+			Contents []struct {
+				Type string          `json:"type"`
+				Data json.RawMessage `json:"data"`
+			} `json:"contents"`
+		} `json:"messages"`
+	} `json:"history"`
+
+	StrategyState json.RawMessage `json:"strategy_state"`
+
+	ToolCalls []struct {
+		Name   string         `json:"name"`
+		Args   map[string]any `json:"args"`
+		Result map[string]any `json:"result"`
+		Error  string         `json:"error"`
+	} `json:"tool_calls"`
+}
+
+func inspectCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "inspect",
+		Usage:     "Pretty-print an execution snapshot",
+		ArgsUsage: "<snapshot.json>",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "max-length",
+				Value: 500,
+				Usage: "Truncate long texts to this length (0 for no limit)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			path := cmd.Args().First()
+			if path == "" {
+				return fmt.Errorf("snapshot file is required")
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return goerr.Wrap(err, "failed to read snapshot file", goerr.Value("path", path))
+			}
+
+			return printSnapshot(cmd.Root().Writer, data, cmd.Int("max-length"))
+		},
+	}
+}
+
+// printSnapshot writes a human-readable form of the snapshot JSON data to w. Texts longer
+// than maxLength are truncated unless maxLength is 0.
+func printSnapshot(w io.Writer, data []byte, maxLength int) error {
+	var s snapshotData
+	if err := json.Unmarshal(data, &s); err != nil {
+		return goerr.Wrap(err, "failed to parse snapshot")
+	}
+
+	p := &textPrinter{w: w, maxLength: maxLength}
+
+	p.section("Snapshot")
+	p.field("ID", s.ID)
+	p.field("Exec ID", s.ExecID)
+	p.field("Created at", s.CreatedAt)
+	p.field("Error", s.Error)
+
+	p.section("Versions")
+	p.field("Go", s.Versions.Go)
+	p.field("gollem", s.Versions.Gollem)
+	p.field("LLM client", s.Versions.LLMClient)
+
+	p.section("Config")
+	p.field("Strategy", s.Config.Strategy)
+	p.field("Loop limit", fmt.Sprint(s.Config.LoopLimit))
+	p.field("Response mode", s.Config.ResponseMode)
+	p.field("Content type", s.Config.ContentType)
+	p.field("Tools", strings.Join(s.Config.ToolNames, ", "))
+	if len(s.Config.Flags) > 0 {
+		names := make([]string, 0, len(s.Config.Flags))
+		for name := range s.Config.Flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		flags := make([]string, len(names))
+		for i, name := range names {
+			flags[i] = fmt.Sprintf("%s=%t", name, s.Config.Flags[name])
+		}
+		p.field("Flags", strings.Join(flags, ", "))
+	}
+	p.field("System prompt", s.Config.SystemPrompt)
+
+	p.list("Inputs", s.Inputs)
+	p.list("Last LLM inputs", s.LastInputs)
+
+	if len(s.StrategyState) > 0 && string(s.StrategyState) != "null" {
+		p.section("Strategy state")
+		var state any
+		if err := json.Unmarshal(s.StrategyState, &state); err != nil {
+			return goerr.Wrap(err, "failed to parse strategy state")
+		}
+		indented, _ := json.MarshalIndent(state, "  ", "  ")
+		p.printf("  %s\n", indented)
+	}
+
+	if len(s.ToolCalls) > 0 {
+		p.section(fmt.Sprintf("Tool calls (%d)", len(s.ToolCalls)))
+		for i, call := range s.ToolCalls {
+			p.printf("  %d. %s(%s)\n", i+1, call.Name, p.truncate(compactJSON(call.Args)))
+			if call.Error != "" {
+				p.printf("     error: %s\n", p.truncate(call.Error))
+			} else {
+				p.printf("     result: %s\n", p.truncate(compactJSON(call.Result)))
+			}
+		}
+	}
+
+	if s.History != nil {
+		p.section(fmt.Sprintf("History (%d messages)", len(s.History.Messages)))
+		for i, msg := range s.History.Messages {
+			p.printf("  #%d [%s]\n", i+1, msg.Role)
+			for _, content := range msg.Contents {
+				p.printf("     %s: %s\n", content.Type, p.truncate(describeContent(content.Type, content.Data)))
+			}
+		}
+	}
+
+	return p.err
+}
+
+// describeContent returns a one-line description of a history message content.
+func describeContent(contentType string, data json.RawMessage) string {
+	var v struct {
+		Text       string         `json:"text"`
+		Name       string         `json:"name"`
+		Arguments  map[string]any `json:"arguments"`
+		ToolCallID string         `json:"tool_call_id"`
+		Response   map[string]any `json:"response"`
+		IsError    bool           `json:"is_error"`
+		MediaType  string         `json:"media_type"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+
+	switch contentType {
+	case "text", "thinking":
+		return strings.ReplaceAll(v.Text, "\n", `\n`)
+	case "tool_call":
+		return fmt.Sprintf("%s(%s)", v.Name, compactJSON(v.Arguments))
+	case "tool_response":
+		if v.IsError {
+			return fmt.Sprintf("%s error %s", v.Name, compactJSON(v.Response))
+		}
+		return fmt.Sprintf("%s %s", v.Name, compactJSON(v.Response))
+	case "image":
+		return fmt.Sprintf("(%s, %d bytes of JSON)", v.MediaType, len(data))
+	default:
+		return fmt.Sprintf("(%d bytes of JSON)", len(data))
+	}
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+type textPrinter struct {
+	w         io.Writer
+	maxLength int
+	err       error
+}
+
+func (p *textPrinter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *textPrinter) section(title string) {
+	p.printf("\n== %s ==\n", title)
+}
+
+// field prints a labeled value. Empty values are omitted.
+func (p *textPrinter) field(label, value string) {
+	if value == "" {
+		return
+	}
+	p.printf("  %-14s %s\n", label+":", p.truncate(value))
+}
+
+func (p *textPrinter) list(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	p.section(title)
+	for i, item := range items {
+		p.printf("  %d. %s\n", i+1, p.truncate(item))
+	}
+}
+
+func (p *textPrinter) truncate(s string) string {
+	if p.maxLength <= 0 || len(s) <= p.maxLength {
+		return s
+	}
+	return s[:p.maxLength] + "...(truncated)"
+}
@@ -0,0 +1,50 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	main "github.com/m-mizutani/gollem/cmd/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPrintSnapshot(t *testing.T) {
+	data := gt.R1(os.ReadFile("testdata/exec-001.snapshot.json")).NoError(t)
+
+	t.Run("all sections are printed", func(t *testing.T) {
+		var buf bytes.Buffer
+		gt.NoError(t, main.PrintSnapshot(&buf, data, 0))
+		out := buf.String()
+
+		for _, want := range []string{
+			"Error:         failed to call tool: connection refused",
+			"LLM client:    *openai.Client",
+			"Tools:         search, lookup",
+			"Flags:         beta=true",
+			"== Last LLM inputs ==",
+			`"Goal": "Find the source of the alert"`,
+			"== Tool calls (1) ==",
+			`1. search({"query":"10.0.0.1"})`,
+			"error: connection refused",
+			"== History (3 messages) ==",
+			"text: Investigate the alert",
+			`tool_call: search({"query":"10.0.0.1"})`,
+			`tool_response: search error {"error":"connection refused"}`,
+		} {
+			gt.True(t, strings.Contains(out, want))
+		}
+	})
+
+	t.Run("long texts are truncated", func(t *testing.T) {
+		var buf bytes.Buffer
+		gt.NoError(t, main.PrintSnapshot(&buf, data, 10))
+		gt.True(t, strings.Contains(buf.String(), "You are a ...(truncated)"))
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		gt.Error(t, main.PrintSnapshot(&buf, []byte("{"), 0))
+	})
+}
@@ -15,6 +15,9 @@ func main() {
 		Usage: "gollem CLI tools",
 		Commands: []*cli.Command{
 			viewCommand(),
+			inspectCommand(),
+			planCommand(),
+			historyCommand(),
 		},
 	}
 
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/urfave/cli/v3"
+)
+
+func planCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "plan",
+		Usage: "Tools for saved plans of the plan-and-execute strategy",
+		Commands: []*cli.Command{
+			planGraphCommand(),
+			planDiffCommand(),
+		},
+	}
+}
+
+func planGraphCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "graph",
+		Usage:     "Render a saved plan as a Mermaid or Graphviz DOT graph",
+		ArgsUsage: "<plan.json | snapshot.json>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   string(planexec.GraphFormatMermaid),
+				Usage:   "Output format (mermaid, dot)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			path := cmd.Args().First()
+			if path == "" {
+				return fmt.Errorf("plan file is required")
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return goerr.Wrap(err, "failed to read plan file", goerr.Value("path", path))
+			}
+
+			plan, err := parsePlan(data)
+			if err != nil {
+				return err
+			}
+
+			graph, err := plan.ExportGraph(planexec.GraphFormat(cmd.String("format")))
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprint(cmd.Root().Writer, graph)
+			return err
+		},
+	}
+}
+
+func planDiffCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "diff",
+		Usage: "Show what changed in a plan between two saved plans or snapshots",
+		Description: "Compares <before> and <after>. With a directory of snapshots, e.g. saved by " +
+			"WithSnapshot during a long execution, compares the two latest snapshots with a plan " +
+			"to show what changed since the last checkpoint.",
+		ArgsUsage: "<before.json> <after.json> | <snapshot-dir>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "text",
+				Usage:   "Output format (text, json)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			var before, after string
+			switch cmd.Args().Len() {
+			case 1:
+				var err error
+				before, after, err = latestPlanSnapshots(cmd.Args().First())
+				if err != nil {
+					return err
+				}
+			case 2:
+				before, after = cmd.Args().Get(0), cmd.Args().Get(1)
+			default:
+				return fmt.Errorf("two plan files or a snapshot directory is required")
+			}
+
+			beforePlan, err := readPlan(before)
+			if err != nil {
+				return err
+			}
+			afterPlan, err := readPlan(after)
+			if err != nil {
+				return err
+			}
+			diff := planexec.DiffPlans(beforePlan, afterPlan)
+
+			w := cmd.Root().Writer
+			switch cmd.String("format") {
+			case "text":
+				_, err = fmt.Fprintf(w, "--- %s\n+++ %s\n%s", before, after, diff)
+				return err
+			case "json":
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				return enc.Encode(diff)
+			default:
+				return goerr.New("unsupported format", goerr.Value("format", cmd.String("format")))
+			}
+		},
+	}
+}
+
+func readPlan(path string) (*planexec.Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to read plan file", goerr.Value("path", path))
+	}
+	plan, err := parsePlan(data)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to load plan", goerr.Value("path", path))
+	}
+	return plan, nil
+}
+
+// latestPlanSnapshots returns paths of the two latest snapshots with a plan in dir by
+// modification time, the older first.
+func latestPlanSnapshots(dir string) (string, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", goerr.Wrap(err, "failed to read snapshot directory", goerr.Value("dir", dir))
+	}
+
+	type snapshotFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []snapshotFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), trace.SnapshotFileSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", "", goerr.Wrap(err, "failed to get snapshot file info", goerr.Value("name", entry.Name()))
+		}
+		files = append(files, snapshotFile{path: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b snapshotFile) int {
+		if c := b.modTime.Compare(a.modTime); c != 0 {
+			return c
+		}
+		return strings.Compare(b.path, a.path)
+	})
+
+	var found []string
+	for _, file := range files {
+		if _, err := readPlan(file.path); err != nil {
+			continue
+		}
+		if found = append(found, file.path); len(found) == 2 {
+			return found[1], found[0], nil
+		}
+	}
+	return "", "", goerr.New("two snapshots with a plan are required", goerr.Value("dir", dir), goerr.Value("found", len(found)))
+}
+
+// parsePlan decodes a plan from JSON of planexec.Plan, or from the strategy state of a snapshot
+// taken during plan-and-execute.
+func parsePlan(data []byte) (*planexec.Plan, error) {
+	var snapshot struct {
+		StrategyState json.RawMessage `json:"strategy_state"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, goerr.Wrap(err, "failed to parse plan file")
+	}
+	if len(snapshot.StrategyState) > 0 {
+		data = snapshot.StrategyState
+	}
+
+	var plan planexec.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, goerr.Wrap(err, "failed to parse plan")
+	}
+	if plan.Goal == "" && plan.UserQuestion == "" && len(plan.Tasks) == 0 {
+		return nil, goerr.New("no plan found in file")
+	}
+
+	return &plan, nil
+}
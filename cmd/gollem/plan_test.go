@@ -0,0 +1,59 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/m-mizutani/gollem/cmd/gollem"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestParsePlan(t *testing.T) {
+	t.Run("plan JSON", func(t *testing.T) {
+		plan := gt.R1(main.ParsePlan([]byte(`{"Goal":"g","Tasks":[{"ID":"t1","Description":"d","State":"skipped","SkipReason":"r"}]}`))).NoError(t)
+		gt.Equal(t, "g", plan.Goal)
+		gt.A(t, plan.Tasks).Length(1).At(0, func(t testing.TB, v planexec.Task) {
+			gt.Equal(t, planexec.TaskStateSkipped, v.State)
+			gt.Equal(t, "r", v.SkipReason)
+		})
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		data := gt.R1(os.ReadFile("testdata/exec-001.snapshot.json")).NoError(t)
+		plan := gt.R1(main.ParsePlan(data)).NoError(t)
+		gt.Equal(t, "Find the source of the alert", plan.Goal)
+		gt.A(t, plan.Tasks).Length(1)
+	})
+
+	t.Run("no plan", func(t *testing.T) {
+		_, err := main.ParsePlan([]byte(`{"id":"x"}`))
+		gt.Error(t, err)
+	})
+}
+
+func TestLatestPlanSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name, data string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		gt.NoError(t, os.WriteFile(path, []byte(data), 0600))
+		gt.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	write("a.snapshot.json", `{"strategy_state":{"Goal":"g","Tasks":[{"ID":"1"}]}}`, now.Add(-3*time.Minute))
+	write("b.snapshot.json", `{"strategy_state":{"Goal":"g","Tasks":[{"ID":"1"},{"ID":"2"}]}}`, now.Add(-2*time.Minute))
+	write("c.snapshot.json", `{"id":"no plan"}`, now.Add(-time.Minute))
+	write("trace.json", `{"Goal":"not a snapshot"}`, now)
+
+	before, after, err := main.LatestPlanSnapshots(dir)
+	gt.NoError(t, err)
+	gt.Equal(t, filepath.Join(dir, "a.snapshot.json"), before)
+	gt.Equal(t, filepath.Join(dir, "b.snapshot.json"), after)
+
+	t.Run("less than two snapshots", func(t *testing.T) {
+		_, _, err := main.LatestPlanSnapshots(t.TempDir())
+		gt.Error(t, err)
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/cmd/gollem/frontend"
 )
 
@@ -29,6 +30,18 @@ func withSource(src traceSource) serverOption {
 	}
 }
 
+func withPricing(pricing map[string]gollem.Pricing) serverOption {
+	return func(s *server) {
+		s.pricing = pricing
+	}
+}
+
+func withTopSpans(n int) serverOption {
+	return func(s *server) {
+		s.topSpans = n
+	}
+}
+
 func withNoBrowser() serverOption {
 	return func(s *server) {
 		s.noBrowser = true
@@ -38,14 +51,18 @@ func withNoBrowser() serverOption {
 type server struct {
 	addr      string
 	source    traceSource
+	pricing   map[string]gollem.Pricing
+	topSpans  int
 	noBrowser bool
 	mux       *http.ServeMux
 }
 
 func newServer(opts ...serverOption) *server {
 	s := &server{
-		addr: ":18900",
-		mux:  http.NewServeMux(),
+		addr:     ":18900",
+		pricing:  gollem.DefaultPricing,
+		topSpans: defaultTopSpans,
+		mux:      http.NewServeMux(),
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -59,6 +76,7 @@ func (s *server) setupRoutes() {
 	s.mux.HandleFunc("GET /api/health", s.handleHealth)
 	s.mux.HandleFunc("GET /api/traces", s.handleListTraces)
 	s.mux.HandleFunc("GET /api/traces/{path...}", s.handleGetTrace)
+	s.mux.HandleFunc("GET /api/costs/{path...}", s.handleGetCost)
 
 	// Static files (SPA fallback)
 	s.mux.Handle("/", s.spaHandler())
@@ -17,6 +17,10 @@ const (
 	entryKindDir  entryKind = "dir"
 )
 
+// snapshotFileSuffix is the suffix of snapshot files written by trace.FileRepository. They are
+// not traces, so sources skip them; use the inspect command to read them.
+const snapshotFileSuffix = ".snapshot.json"
+
 // entrySummary represents a single entry (file or directory) in a listing.
 // For files, Name is the trace ID (without ".json" suffix) and Size/UpdatedAt are populated.
 // For directories, Name is the directory name and Size/UpdatedAt are zero.
@@ -85,7 +85,7 @@ func (s *csSource) List(ctx context.Context, req listRequest) (*listResponse, er
 			continue
 		}
 
-		if !strings.HasSuffix(attr.Name, ".json") {
+		if !strings.HasSuffix(attr.Name, ".json") || strings.HasSuffix(attr.Name, snapshotFileSuffix) {
 			continue
 		}
 		// The object's name relative to queryPrefix; should be a single path segment.
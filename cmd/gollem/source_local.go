@@ -68,7 +68,7 @@ func (s *localSource) List(ctx context.Context, req listRequest) (*listResponse,
 			})
 			continue
 		}
-		if !strings.HasSuffix(e.Name(), ".json") {
+		if !strings.HasSuffix(e.Name(), ".json") || strings.HasSuffix(e.Name(), snapshotFileSuffix) {
 			continue
 		}
 		info, err := e.Info()
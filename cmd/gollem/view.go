@@ -29,6 +29,17 @@ func viewCommand() *cli.Command {
 				Sources: cli.EnvVars("GOLLEM_VIEW_GS"),
 				Usage:   "Google Cloud Storage URI (e.g. gs://bucket/prefix/)",
 			},
+			&cli.StringFlag{
+				Name:    "pricing",
+				Sources: cli.EnvVars("GOLLEM_VIEW_PRICING"),
+				Usage:   "JSON file of model pricing in USD per million tokens, overriding the built-in pricing (e.g. {\"my-model\": {\"InputPerMillion\": 1, \"OutputPerMillion\": 4}})",
+			},
+			&cli.IntFlag{
+				Name:    "top",
+				Value:   defaultTopSpans,
+				Sources: cli.EnvVars("GOLLEM_VIEW_TOP"),
+				Usage:   "Number of the most expensive LLM calls listed in the cost report",
+			},
 			&cli.BoolFlag{
 				Name:    "no-browser",
 				Sources: cli.EnvVars("GOLLEM_VIEW_NO_BROWSER"),
@@ -60,9 +71,16 @@ func viewCommand() *cli.Command {
 				}
 			}
 
+			pricing, err := loadPricing(cmd.String("pricing"))
+			if err != nil {
+				return err
+			}
+
 			opts := []serverOption{
 				withAddr(cmd.String("addr")),
 				withSource(src),
+				withPricing(pricing),
+				withTopSpans(cmd.Int("top")),
 			}
 			if cmd.Bool("no-browser") {
 				opts = append(opts, withNoBrowser())
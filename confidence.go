@@ -0,0 +1,243 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// Confidence is the estimated confidence of the final answer, computed by WithConfidenceSignal.
+// Downstream systems can route answers with a low Score to humans.
+type Confidence struct {
+	// Score is the weighted average of the successful signal scores, in [0, 1].
+	Score float64 `json:"score"`
+
+	// Signals contains the score of each signal by name. Failed signals are not included.
+	Signals map[string]float64 `json:"signals"`
+}
+
+// ConfidenceInput is the data passed to a ConfidenceSignal.
+type ConfidenceInput struct {
+	// Inputs is the input of the Execute call.
+	Inputs []Input
+
+	// Response is the final response. Response.Reasoning is set if WithReasoningSummary is enabled.
+	Response *ExecuteResponse
+
+	// LLMResponses contains the LLM responses generated during the execution in order.
+	LLMResponses []*Response
+
+	// SessionOptions is the options of the agent's session, such as the system prompt, tools
+	// and middlewares, with the history before the execution. Signals sampling answers create
+	// sessions with them to answer in the same context.
+	SessionOptions []SessionOption
+}
+
+// ConfidenceSignal computes a confidence score in [0, 1] from an execution.
+type ConfidenceSignal func(ctx context.Context, input *ConfidenceInput) (float64, error)
+
+type confidenceSignal struct {
+	name   string
+	weight float64
+	signal ConfidenceSignal
+}
+
+// WithConfidenceSignal adds a signal used to compute ExecuteResponse.Confidence. The final
+// score is the weighted average of all signals that succeed; weight must be positive. A failed
+// signal is logged and ignored, and Confidence is nil if all signals fail.
+func WithConfidenceSignal(name string, weight float64, signal ConfidenceSignal) Option {
+	return func(s *gollemConfig) {
+		s.confidenceSignals = append(s.confidenceSignals, confidenceSignal{
+			name:   name,
+			weight: weight,
+			signal: signal,
+		})
+	}
+}
+
+// ReasoningConfidence is a signal that uses the self-reported confidence of the reasoning
+// summary. It requires WithReasoningSummary.
+func ReasoningConfidence() ConfidenceSignal {
+	return func(ctx context.Context, input *ConfidenceInput) (float64, error) {
+		if input.Response.Reasoning == nil {
+			return 0, goerr.New("reasoning summary is not available")
+		}
+		return input.Response.Reasoning.Confidence, nil
+	}
+}
+
+// LogprobConfidence is a signal that uses the log probabilities of the output tokens of the
+// final LLM response. The score is the geometric mean of the token probabilities. It requires a
+// provider reporting Response.Logprobs, e.g. openai.WithLogprobs, and ResponseModeBlocking.
+func LogprobConfidence() ConfidenceSignal {
+	return func(ctx context.Context, input *ConfidenceInput) (float64, error) {
+		for i := len(input.LLMResponses) - 1; i >= 0; i-- {
+			resp := input.LLMResponses[i]
+			if len(resp.Texts) == 0 {
+				continue
+			}
+			if len(resp.Logprobs) == 0 {
+				return 0, goerr.New("log probabilities are not available")
+			}
+			var sum float64
+			for _, logprob := range resp.Logprobs {
+				sum += logprob
+			}
+			return math.Exp(sum / float64(len(resp.Logprobs))), nil
+		}
+		return 0, goerr.New("no LLM response with texts")
+	}
+}
+
+const verifierPrompt = `Rate how likely the answer below is correct and fully addresses the request.
+
+## Request
+%s
+
+## Answer
+%s`
+
+type verifierResult struct {
+	Score  float64 `json:"score" description:"Probability that the answer is correct and complete" min:"0" max:"1"`
+	Reason string  `json:"reason" description:"Short explanation of the score"`
+}
+
+// VerifierConfidence is a signal that asks client to verify the answer and rate it.
+func VerifierConfidence(client LLMClient) ConfidenceSignal {
+	return func(ctx context.Context, input *ConfidenceInput) (float64, error) {
+		prompt := fmt.Sprintf(verifierPrompt, inputsToString(input.Inputs), input.Response.String())
+		resp, err := Query[verifierResult](ctx, client, prompt)
+		if err != nil {
+			return 0, goerr.Wrap(err, "failed to verify answer")
+		}
+		return resp.Data.Score, nil
+	}
+}
+
+const consistencyPrompt = `Below are a reference answer and %d candidate answers to the same request.
+Count how many candidates reach the same conclusion as the reference answer. Ignore wording differences.
+
+## Request
+%s
+
+## Reference answer
+%s
+
+## Candidates
+%s`
+
+type consistencyResult struct {
+	Agreements int `json:"agreements" description:"Number of candidates that agree with the reference answer" min:"0"`
+}
+
+// SelfConsistencyConfidence is a signal that samples n independent answers to the input from
+// client and returns the fraction of them that agree with the final answer. Samples are
+// generated in sessions of ConfidenceInput.SessionOptions without calling tools. Agreement is
+// judged by client as well.
+func SelfConsistencyConfidence(client LLMClient, n int) ConfidenceSignal {
+	return func(ctx context.Context, input *ConfidenceInput) (float64, error) {
+		if n < 1 {
+			return 0, goerr.New("number of samples must be positive", goerr.V("n", n))
+		}
+
+		samples := make([]string, n)
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ssn, err := client.NewSession(ctx, input.SessionOptions...)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				resp, err := ssn.Generate(ctx, input.Inputs, WithToolChoice(ToolChoiceNone()))
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				RecordUsage(ctx, resp)
+				samples[i] = strings.Join(resp.Texts, "\n")
+			}()
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return 0, goerr.Wrap(err, "failed to sample answer")
+			}
+		}
+
+		var candidates strings.Builder
+		for i, sample := range samples {
+			fmt.Fprintf(&candidates, "### Candidate %d\n%s\n\n", i+1, sample)
+		}
+		prompt := fmt.Sprintf(consistencyPrompt, n, inputsToString(input.Inputs), input.Response.String(), candidates.String())
+
+		resp, err := Query[consistencyResult](ctx, client, prompt)
+		if err != nil {
+			return 0, goerr.Wrap(err, "failed to judge answer agreement")
+		}
+		return float64(min(resp.Data.Agreements, n)) / float64(n), nil
+	}
+}
+
+// confidenceSessionOptions returns the session options for ConfidenceInput, with the history
+// of the session before the execution, the first start messages.
+func (g *Agent) confidenceSessionOptions(cfg *gollemConfig, toolList []Tool, start int) []SessionOption {
+	options := cfg.sessionOptions(toolList)
+	if start <= 0 {
+		return options
+	}
+	history, err := g.currentSession.History()
+	if err != nil || history == nil || start > len(history.Messages) {
+		return options
+	}
+	history = history.Clone()
+	history.Messages = history.Messages[:start]
+	return append(options, WithSessionHistory(history))
+}
+
+func inputsToString(inputs []Input) string {
+	texts := make([]string, 0, len(inputs))
+	for _, in := range inputs {
+		texts = append(texts, in.String())
+	}
+	return strings.Join(texts, "\n")
+}
+
+// computeConfidence runs all signals and combines their scores. It returns nil if no signal succeeds.
+func computeConfidence(ctx context.Context, cfg *gollemConfig, input *ConfidenceInput) *Confidence {
+	var total, weights float64
+	signals := make(map[string]float64, len(cfg.confidenceSignals))
+	ctx = ContextWithUsagePhase(ctx, UsagePhaseEvaluate)
+
+	for _, s := range cfg.confidenceSignals {
+		if s.weight <= 0 {
+			cfg.logger.Warn("confidence signal with non-positive weight is ignored", "name", s.name, "weight", s.weight)
+			continue
+		}
+		score, err := s.signal(ctx, input)
+		if err != nil {
+			cfg.logger.Warn("confidence signal failed", "name", s.name, "error", err)
+			continue
+		}
+		score = min(max(score, 0), 1)
+		signals[s.name] = score
+		total += score * s.weight
+		weights += s.weight
+	}
+
+	if weights == 0 {
+		return nil
+	}
+	return &Confidence{
+		Score:   total / weights,
+		Signals: signals,
+	}
+}
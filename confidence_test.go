@@ -0,0 +1,213 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// newTextClient returns a client whose sessions answer with text, or with jsonText when
+// the session is created for a JSON query.
+func newTextClient(text, jsonText string) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					if cfg.ContentType() == gollem.ContentTypeJSON {
+						return &gollem.Response{Texts: []string{jsonText}}, nil
+					}
+					return &gollem.Response{Texts: []string{text}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+				AppendHistoryFunc: func(*gollem.History) error { return nil },
+			}, nil
+		},
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	t.Run("weighted average of signals", func(t *testing.T) {
+		var received *gollem.ConfidenceInput
+		agent := gollem.New(newTextClient("42", ""),
+			gollem.WithConfidenceSignal("high", 3, func(ctx context.Context, input *gollem.ConfidenceInput) (float64, error) {
+				received = input
+				return 1.0, nil
+			}),
+			gollem.WithConfidenceSignal("low", 1, func(ctx context.Context, input *gollem.ConfidenceInput) (float64, error) {
+				return 0.2, nil
+			}),
+			gollem.WithConfidenceSignal("broken", 10, func(ctx context.Context, input *gollem.ConfidenceInput) (float64, error) {
+				return 0, errors.New("unavailable")
+			}),
+		)
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("question"))
+		gt.NoError(t, err)
+		gt.NotNil(t, resp.Confidence)
+		gt.Equal(t, 0.8, resp.Confidence.Score)
+		gt.Equal(t, map[string]float64{"high": 1.0, "low": 0.2}, resp.Confidence.Signals)
+
+		gt.A(t, received.Inputs).Length(1)
+		gt.Equal(t, "42", received.Response.String())
+		gt.A(t, received.LLMResponses).Length(1)
+	})
+
+	t.Run("nil when all signals fail", func(t *testing.T) {
+		agent := gollem.New(newTextClient("42", ""),
+			gollem.WithConfidenceSignal("broken", 1, func(ctx context.Context, input *gollem.ConfidenceInput) (float64, error) {
+				return 0, errors.New("unavailable")
+			}),
+		)
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("question"))
+		gt.NoError(t, err)
+		gt.Nil(t, resp.Confidence)
+	})
+
+	t.Run("reasoning confidence requires summary", func(t *testing.T) {
+		signal := gollem.ReasoningConfidence()
+		_, err := signal(t.Context(), &gollem.ConfidenceInput{Response: gollem.NewExecuteResponse("a")})
+		gt.Error(t, err)
+
+		resp := gollem.NewExecuteResponse("a")
+		resp.Reasoning = &gollem.ReasoningSummary{Confidence: 0.7}
+		score, err := signal(t.Context(), &gollem.ConfidenceInput{Response: resp})
+		gt.NoError(t, err)
+		gt.Equal(t, 0.7, score)
+	})
+}
+
+func TestVerifierConfidence(t *testing.T) {
+	signal := gollem.VerifierConfidence(newTextClient("", `{"score":0.9,"reason":"correct"}`))
+	score, err := signal(t.Context(), &gollem.ConfidenceInput{
+		Inputs:   []gollem.Input{gollem.Text("1+1?")},
+		Response: gollem.NewExecuteResponse("2"),
+	})
+	gt.NoError(t, err)
+	gt.Equal(t, 0.9, score)
+}
+
+func TestSelfConsistencyConfidence(t *testing.T) {
+	client := newTextClient("2", `{"agreements":3}`)
+	input := &gollem.ConfidenceInput{
+		Inputs:   []gollem.Input{gollem.Text("1+1?")},
+		Response: gollem.NewExecuteResponse("2"),
+	}
+
+	score, err := gollem.SelfConsistencyConfidence(client, 4)(t.Context(), input)
+	gt.NoError(t, err)
+	gt.Equal(t, 0.75, score)
+	// 4 samples and 1 judge
+	gt.A(t, client.NewSessionCalls()).Length(5)
+
+	t.Run("samples in the agent's session", func(t *testing.T) {
+		var mu sync.Mutex
+		var samples []gollem.SessionConfig
+		var toolChoices []*gollem.ToolChoice
+		history := &gollem.History{}
+		var sessions atomic.Int32
+		client := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				cfg := gollem.NewSessionConfig(options...)
+				// The first session is of the agent
+				isSample := sessions.Add(1) > 1 && cfg.ContentType() != gollem.ContentTypeJSON
+				if isSample {
+					mu.Lock()
+					samples = append(samples, cfg)
+					mu.Unlock()
+				}
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						if cfg.ContentType() == gollem.ContentTypeJSON {
+							return &gollem.Response{Texts: []string{`{"agreements":2}`}}, nil
+						}
+						if isSample {
+							mu.Lock()
+							genCfg := gollem.NewGenerateConfig(opts...)
+							toolChoices = append(toolChoices, genCfg.ToolChoice())
+							mu.Unlock()
+							return &gollem.Response{Texts: []string{"2"}}, nil
+						}
+						history.Messages = append(history.Messages,
+							gollem.Message{Role: gollem.RoleUser},
+							gollem.Message{Role: gollem.RoleAssistant},
+						)
+						return &gollem.Response{Texts: []string{"2"}}, nil
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return history, nil
+					},
+					AppendHistoryFunc: func(*gollem.History) error { return nil },
+				}, nil
+			},
+		}
+
+		agent := gollem.New(client,
+			gollem.WithSystemPrompt("You are a calculator."),
+			gollem.WithConfidenceSignal("consistency", 1, gollem.SelfConsistencyConfidence(client, 2)),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("1+1?"))
+		gt.NoError(t, err)
+		gt.A(t, samples).Length(2)
+		// No history before the first execution
+		for _, cfg := range samples {
+			gt.Nil(t, cfg.History())
+		}
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("2+0?"))
+		gt.NoError(t, err)
+		gt.Equal(t, 1.0, resp.Confidence.Score)
+		gt.A(t, samples).Length(4)
+		for _, cfg := range samples {
+			gt.Equal(t, "You are a calculator.", cfg.SystemPrompt())
+		}
+		for _, cfg := range samples[2:] {
+			gt.A(t, cfg.History().Messages).Length(2)
+		}
+		for _, choice := range toolChoices {
+			gt.Equal(t, gollem.ToolChoiceNone(), *choice)
+		}
+	})
+
+	t.Run("sampling failure", func(t *testing.T) {
+		var calls atomic.Int32
+		failing := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				calls.Add(1)
+				return nil, errors.New("unavailable")
+			},
+		}
+		_, err := gollem.SelfConsistencyConfidence(failing, 2)(t.Context(), input)
+		gt.Error(t, err)
+		gt.Equal(t, int32(2), calls.Load())
+	})
+}
+
+func TestLogprobConfidence(t *testing.T) {
+	signal := gollem.LogprobConfidence()
+
+	score, err := signal(t.Context(), &gollem.ConfidenceInput{
+		LLMResponses: []*gollem.Response{
+			{Texts: []string{"thinking"}, Logprobs: []float64{-5}},
+			{FunctionCalls: []*gollem.FunctionCall{{Name: "search"}}},
+			{Texts: []string{"answer"}, Logprobs: []float64{0, math.Log(0.25)}},
+		},
+	})
+	gt.NoError(t, err)
+	gt.V(t, score).Equal(0.5)
+
+	_, err = signal(t.Context(), &gollem.ConfidenceInput{
+		LLMResponses: []*gollem.Response{{Texts: []string{"answer"}}},
+	})
+	gt.Error(t, err)
+}
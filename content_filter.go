@@ -0,0 +1,66 @@
+package gollem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// contentFilterNotice is added to the inputs when the response is blocked by a content filter
+const contentFilterNotice = `Your previous response to this request was blocked by the content safety filter of the provider. Respond to the request again in a way that complies with the content policy. If part of the request cannot be answered safely, answer the rest and briefly state what you cannot help with.`
+
+// ContentFilteredError is returned when a response is blocked by the content filter of the
+// provider and recovery by NewContentFilterRecoveryMiddleware fails. It wraps the last error,
+// which wraps ErrProhibitedContent.
+type ContentFilteredError struct {
+	// Attempts is the number of LLM calls including the first one
+	Attempts int
+	Err      error
+}
+
+func (e *ContentFilteredError) Error() string {
+	return fmt.Sprintf("response blocked by content filter after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ContentFilteredError) Unwrap() error {
+	return e.Err
+}
+
+// NewContentFilterRecoveryMiddleware creates a middleware that recovers from responses blocked
+// by the content filter of the provider (ErrProhibitedContent). It tells the model that the
+// response was blocked and asks for a compliant rephrase, up to maxRetries times. If all attempts
+// are blocked, it returns *ContentFilteredError. The notice is kept in the history with the
+// inputs when recovery succeeds.
+func NewContentFilterRecoveryMiddleware(maxRetries int) ContentBlockMiddleware {
+	return func(next ContentBlockHandler) ContentBlockHandler {
+		return func(ctx context.Context, req *ContentRequest) (*ContentResponse, error) {
+			// Keep the history before the call: some providers add the inputs to the session
+			// history even if the call fails, and the history of the request replaces it
+			history := req.History
+			if history == nil {
+				history = &History{Version: HistoryVersion}
+			}
+			inputs := req.Inputs
+
+			resp, err := next(ctx, req)
+			attempts := 1
+			for ; err != nil && errors.Is(err, ErrProhibitedContent) && attempts <= maxRetries; attempts++ {
+				req.History = history
+				req.Inputs = append(inputs[:len(inputs):len(inputs)], Text(contentFilterNotice))
+				resp, err = next(ctx, req)
+			}
+
+			if err != nil && errors.Is(err, ErrProhibitedContent) {
+				return nil, &ContentFilteredError{Attempts: attempts, Err: err}
+			}
+			return resp, err
+		}
+	}
+}
+
+// WithContentFilterRecovery makes the agent recover from responses blocked by the content filter
+// of the provider by asking the model for a compliant rephrase, up to maxRetries times. Execute
+// returns *ContentFilteredError if recovery fails. It applies to ResponseModeBlocking.
+func WithContentFilterRecovery(maxRetries int) Option {
+	return WithContentBlockMiddleware(NewContentFilterRecoveryMiddleware(maxRetries))
+}
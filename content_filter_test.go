@@ -0,0 +1,75 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestContentFilterRecovery(t *testing.T) {
+	history, err := gollem.NewHistoryBuilder().User("Hi").Assistant("Hello").Build()
+	gt.NoError(t, err)
+
+	run := func(blocked int) ([]*gollem.ContentRequest, *gollem.ContentResponse, error) {
+		var requests []*gollem.ContentRequest
+		handler := gollem.NewContentFilterRecoveryMiddleware(2)(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			requests = append(requests, &gollem.ContentRequest{Inputs: req.Inputs, History: req.History})
+			// a provider that adds inputs to the history before the call
+			req.History = nil
+			if len(requests) <= blocked {
+				return nil, goerr.Wrap(gollem.ErrProhibitedContent, "blocked")
+			}
+			return &gollem.ContentResponse{Texts: []string{"safe answer"}}, nil
+		})
+		resp, err := handler(context.Background(), &gollem.ContentRequest{
+			Inputs:  []gollem.Input{gollem.Text("question")},
+			History: history,
+		})
+		return requests, resp, err
+	}
+
+	t.Run("not blocked", func(t *testing.T) {
+		requests, resp, err := run(0)
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"safe answer"}, resp.Texts)
+		gt.A(t, requests).Length(1)
+	})
+
+	t.Run("recovered by rephrase", func(t *testing.T) {
+		requests, resp, err := run(1)
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"safe answer"}, resp.Texts)
+		gt.A(t, requests).Length(2)
+
+		// the retry has the original inputs, the notice and the original history
+		gt.A(t, requests[1].Inputs).Length(2)
+		gt.Equal(t, gollem.Input(gollem.Text("question")), requests[1].Inputs[0])
+		gt.Equal(t, history, requests[1].History)
+		// the inputs of the first call are not modified
+		gt.A(t, requests[0].Inputs).Length(1)
+	})
+
+	t.Run("recovery fails", func(t *testing.T) {
+		requests, _, err := run(3)
+		gt.A(t, requests).Length(3)
+
+		var filtered *gollem.ContentFilteredError
+		gt.True(t, errors.As(err, &filtered))
+		gt.Equal(t, 3, filtered.Attempts)
+		gt.True(t, errors.Is(err, gollem.ErrProhibitedContent))
+	})
+
+	t.Run("other errors are returned as is", func(t *testing.T) {
+		handler := gollem.NewContentFilterRecoveryMiddleware(2)(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			return nil, errors.New("network error")
+		})
+		_, err := handler(context.Background(), &gollem.ContentRequest{Inputs: []gollem.Input{gollem.Text("question")}})
+		gt.Error(t, err)
+		var filtered *gollem.ContentFilteredError
+		gt.False(t, errors.As(err, &filtered))
+	})
+}
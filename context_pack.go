@@ -0,0 +1,275 @@
+package gollem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// contextPackSummaryPrompt instructs the LLM to summarize a reference document within a budget
+const contextPackSummaryPrompt = `You condense reference documents of a domain for the system prompt of an AI agent.
+
+Keep definitions of terms, names, identifiers, numbers, rules and constraints exactly. Drop examples, background and repetition first. Output only the condensed document in the same language and format, without any preface.`
+
+// ContextDocument is a named reference document of a ContextPack, e.g. a glossary or a runbook.
+type ContextDocument struct {
+	// Name is the title of the document in the prompt
+	Name string
+
+	// Content is the text of the document
+	Content string
+
+	// MaxTokens is the token budget of the document. A longer document is summarized to fit
+	// it. 0 means no limit other than the budget of the pack.
+	MaxTokens int
+}
+
+// ContextPack is a set of reference documents of a domain added to the system prompt of agents,
+// so that planning, execution, reflection and subagents share the same domain knowledge.
+// Documents over their token budget are summarized by the LLM once and the summaries are cached
+// in the pack. A ContextPack is safe for concurrent use.
+type ContextPack struct {
+	name       string
+	documents  []ContextDocument
+	maxTokens  int
+	summarizer LLMClient
+	counter    TokenCounter
+
+	mu        sync.Mutex
+	summaries map[string]string
+}
+
+// ContextPackOption is an option of NewContextPack.
+type ContextPackOption func(*ContextPack)
+
+// WithContextPackMaxTokens sets the token budget of all documents of the pack. When the documents
+// exceed it, each document is given a share of the budget in proportion to its size, and the
+// documents over their share are summarized.
+func WithContextPackMaxTokens(n int) ContextPackOption {
+	return func(p *ContextPack) {
+		p.maxTokens = n
+	}
+}
+
+// WithContextPackSummarizer sets the client summarizing documents over budget. The default is
+// the LLM client of the agent.
+func WithContextPackSummarizer(client LLMClient) ContextPackOption {
+	return func(p *ContextPack) {
+		p.summarizer = client
+	}
+}
+
+// WithContextPackTokenCounter sets the TokenCounter of budgets. The default is EstimateTokens.
+func WithContextPackTokenCounter(counter TokenCounter) ContextPackOption {
+	return func(p *ContextPack) {
+		p.counter = counter
+	}
+}
+
+// NewContextPack creates a ContextPack of the documents, identified by name in the prompt and
+// among the packs of an agent.
+func NewContextPack(name string, documents []ContextDocument, options ...ContextPackOption) *ContextPack {
+	p := &ContextPack{
+		name:      name,
+		documents: slices.Clone(documents),
+		counter:   EstimateTokens,
+		summaries: make(map[string]string),
+	}
+	for _, opt := range options {
+		opt(p)
+	}
+	return p
+}
+
+// Name returns the name of the pack.
+func (p *ContextPack) Name() string {
+	return p.name
+}
+
+// LoadContextDocuments loads the files of fsys matching the patterns of fs.Glob as documents
+// named by their file names without extension. Markdown (.md, .markdown) and text (.txt) files
+// are added as is, and YAML (.yaml, .yml) files in a code block.
+func LoadContextDocuments(fsys fs.FS, patterns ...string) ([]ContextDocument, error) {
+	var documents []ContextDocument
+	for _, pattern := range patterns {
+		paths, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, goerr.Wrap(err, "invalid pattern of context documents", goerr.V("pattern", pattern))
+		}
+
+		for _, p := range paths {
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to read context document", goerr.V("path", p))
+			}
+
+			ext := strings.ToLower(path.Ext(p))
+			content := strings.TrimSpace(string(data))
+			switch ext {
+			case ".md", ".markdown", ".txt":
+			case ".yaml", ".yml":
+				content = "```yaml\n" + content + "\n```"
+			default:
+				return nil, goerr.New("unsupported format of context document",
+					goerr.V("path", p), goerr.V("extension", ext))
+			}
+
+			documents = append(documents, ContextDocument{
+				Name:    strings.TrimSuffix(path.Base(p), path.Ext(p)),
+				Content: content,
+			})
+		}
+	}
+	return documents, nil
+}
+
+// Prompt returns the pack as a section of a system prompt, summarizing documents over budget by
+// client unless WithContextPackSummarizer is set. It's called by agents with WithContextPack, and
+// can be used to give the pack to LLM calls outside of agents, e.g. planexec.GeneratePlan.
+func (p *ContextPack) Prompt(ctx context.Context, client LLMClient) (string, error) {
+	if p.summarizer != nil {
+		client = p.summarizer
+	}
+
+	// Tokens and budgets of each document, 0 for no limit
+	tokens := make([]int, len(p.documents))
+	budgets := make([]int, len(p.documents))
+	total := 0
+	for i, doc := range p.documents {
+		tokens[i] = p.counter(doc.Content)
+		budgets[i] = doc.MaxTokens
+		if budgets[i] > 0 {
+			total += min(tokens[i], budgets[i])
+		} else {
+			total += tokens[i]
+		}
+	}
+	if p.maxTokens > 0 && total > p.maxTokens {
+		for i := range p.documents {
+			size := tokens[i]
+			if budgets[i] > 0 {
+				size = min(size, budgets[i])
+			}
+			budgets[i] = max(p.maxTokens*size/total, 1)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Context: %s\n\nReference knowledge of the domain. Use its terms and rules consistently.", p.name)
+	for i, doc := range p.documents {
+		content, err := p.fit(ctx, client, doc, tokens[i], budgets[i])
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n## %s\n\n%s", doc.Name, strings.TrimSpace(content))
+	}
+	return b.String(), nil
+}
+
+// fit returns the content of doc within budget, summarizing it by client if it's over.
+func (p *ContextPack) fit(ctx context.Context, client LLMClient, doc ContextDocument, tokens, budget int) (string, error) {
+	if budget <= 0 || tokens <= budget {
+		return doc.Content, nil
+	}
+
+	sum := sha256.Sum256([]byte(doc.Name + "\x00" + doc.Content))
+	key := fmt.Sprintf("%s:%d", hex.EncodeToString(sum[:]), budget)
+	p.mu.Lock()
+	summary, ok := p.summaries[key]
+	p.mu.Unlock()
+	if ok {
+		return summary, nil
+	}
+
+	if client == nil {
+		return "", goerr.New("summarizer is required for context document over budget",
+			goerr.V("pack", p.name), goerr.V("document", doc.Name))
+	}
+
+	session, err := client.NewSession(ctx, WithSessionSystemPrompt(contextPackSummaryPrompt))
+	if err != nil {
+		return "", goerr.Wrap(err, "failed to create session to summarize context document")
+	}
+	if err := CheckBudget(ctx); err != nil {
+		return "", err
+	}
+	input := fmt.Sprintf("Condense the document %q within about %d tokens.\n\n%s", doc.Name, budget, doc.Content)
+	resp, err := session.Generate(ctx, []Input{Text(input)})
+	if err != nil {
+		return "", goerr.Wrap(err, "failed to summarize context document",
+			goerr.V("pack", p.name), goerr.V("document", doc.Name))
+	}
+	RecordUsage(ContextWithUsagePhase(ctx, UsagePhaseSummarize), resp)
+
+	summary = truncateTokens(strings.Join(resp.Texts, ""), budget, p.counter)
+
+	p.mu.Lock()
+	p.summaries[key] = summary
+	p.mu.Unlock()
+	return summary, nil
+}
+
+// truncateTokens returns the longest prefix of text within budget tokens by counter.
+func truncateTokens(text string, budget int, counter TokenCounter) string {
+	if counter(text) <= budget {
+		return text
+	}
+	runes := []rune(text)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if counter(string(runes[:mid])) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return string(runes[:lo])
+}
+
+type contextPacksCtxKey struct{}
+
+// WithContextPack adds the packs to the system prompt of each Execute. Agents executed with the
+// ctx of Execute, e.g. subagents, inherit the packs, unless they have a pack of the same name.
+func WithContextPack(packs ...*ContextPack) Option {
+	return func(s *gollemConfig) {
+		s.contextPacks = append(s.contextPacks, packs...)
+	}
+}
+
+// resolveContextPacks returns the packs of the config and the ones inherited from ctx whose
+// names are not in the config.
+func resolveContextPacks(ctx context.Context, packs []*ContextPack) []*ContextPack {
+	resolved := slices.Clone(packs)
+	inherited, _ := ctx.Value(contextPacksCtxKey{}).([]*ContextPack)
+	for _, pack := range inherited {
+		if !slices.ContainsFunc(resolved, func(p *ContextPack) bool { return p.name == pack.name }) {
+			resolved = append(resolved, pack)
+		}
+	}
+	return resolved
+}
+
+// contextPacksPrompt returns the prompt of the packs and ctx for agents executed in it.
+func contextPacksPrompt(ctx context.Context, packs []*ContextPack, client LLMClient) (context.Context, string, error) {
+	var prompt string
+	for _, pack := range packs {
+		section, err := pack.Prompt(ctx, client)
+		if err != nil {
+			return ctx, "", err
+		}
+		prompt = joinPrompts(prompt, section)
+	}
+	return context.WithValue(ctx, contextPacksCtxKey{}, packs), prompt, nil
+}
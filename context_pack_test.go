@@ -0,0 +1,150 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// newPromptRecordingClient returns a client recording the system prompts of its sessions. The
+// session calls the tool of toolName once if it's not empty, then answers "done".
+func newPromptRecordingClient(systemPrompts *[]string, toolName string) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			*systemPrompts = append(*systemPrompts, cfg.SystemPrompt())
+			called := false
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					if toolName != "" && !called {
+						called = true
+						return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+							{ID: "call_1", Name: toolName, Arguments: map[string]any{"query": "check"}},
+						}}, nil
+					}
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) { return &gollem.History{}, nil },
+			}, nil
+		},
+	}
+}
+
+func TestContextPackPrompt(t *testing.T) {
+	t.Run("documents within budget are added as is", func(t *testing.T) {
+		pack := gollem.NewContextPack("billing", []gollem.ContextDocument{
+			{Name: "glossary", Content: "MRR: monthly recurring revenue"},
+			{Name: "empty", Content: " "},
+		})
+		prompt, err := pack.Prompt(t.Context(), nil)
+		gt.NoError(t, err)
+		gt.Equal(t, "# Context: billing\n\nReference knowledge of the domain. Use its terms and rules consistently.\n\n## glossary\n\nMRR: monthly recurring revenue", prompt)
+	})
+
+	t.Run("documents over budget are summarized once", func(t *testing.T) {
+		var inputs []string
+		summarizer := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+						inputs = append(inputs, string(input[0].(gollem.Text)))
+						return &gollem.Response{Texts: []string{"condensed " + strings.Repeat("x", 100)}}, nil
+					},
+				}, nil
+			},
+		}
+		pack := gollem.NewContextPack("ops", []gollem.ContextDocument{
+			{Name: "runbook", Content: strings.Repeat("step ", 40)}, // 50 tokens
+			{Name: "short", Content: "keep"},
+			{Name: "limited", Content: strings.Repeat("rule ", 40), MaxTokens: 100},
+		},
+			gollem.WithContextPackMaxTokens(20),
+			gollem.WithContextPackTokenCounter(gollem.EstimateTokens),
+		)
+
+		prompt, err := pack.Prompt(t.Context(), summarizer)
+		gt.NoError(t, err)
+		gt.A(t, inputs).Length(2)
+		gt.True(t, strings.HasPrefix(inputs[0], `Condense the document "runbook" within about 9 tokens.`))
+		gt.True(t, strings.Contains(prompt, "## short\n\nkeep"))
+		// The summary is truncated to the budget
+		gt.True(t, strings.Contains(prompt, "## runbook\n\ncondensed "+strings.Repeat("x", 26)+"\n"))
+
+		_, err = pack.Prompt(t.Context(), summarizer)
+		gt.NoError(t, err)
+		gt.A(t, inputs).Length(2)
+	})
+
+	t.Run("summarizer is required for documents over budget", func(t *testing.T) {
+		pack := gollem.NewContextPack("ops", []gollem.ContextDocument{
+			{Name: "runbook", Content: strings.Repeat("step ", 40), MaxTokens: 10},
+		})
+		_, err := pack.Prompt(t.Context(), nil)
+		gt.Error(t, err)
+	})
+}
+
+func TestLoadContextDocuments(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ctx/glossary.yaml": {Data: []byte("MRR: monthly recurring revenue\n")},
+		"ctx/policy.md":     {Data: []byte("# Refunds\n\nWithin 30 days.\n")},
+		"ctx/image.png":     {Data: []byte{0x89}},
+	}
+
+	docs, err := gollem.LoadContextDocuments(fsys, "ctx/*.yaml", "ctx/*.md")
+	gt.NoError(t, err)
+	gt.Equal(t, []gollem.ContextDocument{
+		{Name: "glossary", Content: "```yaml\nMRR: monthly recurring revenue\n```"},
+		{Name: "policy", Content: "# Refunds\n\nWithin 30 days."},
+	}, docs)
+
+	_, err = gollem.LoadContextDocuments(fsys, "ctx/*")
+	gt.Error(t, err)
+}
+
+func TestWithContextPack(t *testing.T) {
+	glossary := gollem.NewContextPack("glossary", []gollem.ContextDocument{{Name: "terms", Content: "MRR: monthly recurring revenue"}})
+	childOnly := gollem.NewContextPack("child", []gollem.ContextDocument{{Name: "notes", Content: "child notes"}})
+	override := gollem.NewContextPack("glossary", []gollem.ContextDocument{{Name: "terms", Content: "ARR: annual recurring revenue"}})
+
+	var parentPrompts, childPrompts []string
+	child := gollem.NewSubAgent("analyst", "Analyze revenue", func() (*gollem.Agent, error) {
+		return gollem.New(newPromptRecordingClient(&childPrompts, ""), gollem.WithContextPack(childOnly)), nil
+	})
+	agent := gollem.New(newPromptRecordingClient(&parentPrompts, "analyst"),
+		gollem.WithSystemPrompt("You are a finance assistant."),
+		gollem.WithContextPack(glossary),
+		gollem.WithSubAgents(child),
+	)
+
+	_, err := agent.Execute(t.Context(), gollem.Text("Explain MRR"))
+	gt.NoError(t, err)
+	gt.A(t, parentPrompts).Length(1)
+	gt.True(t, strings.HasPrefix(parentPrompts[0], "You are a finance assistant.\n\n# Context: glossary\n\n"))
+	gt.True(t, strings.HasSuffix(parentPrompts[0], "## terms\n\nMRR: monthly recurring revenue"))
+
+	// The subagent inherits the pack of the parent
+	gt.A(t, childPrompts).Length(1)
+	gt.True(t, strings.Contains(childPrompts[0], "# Context: child"))
+	gt.True(t, strings.Contains(childPrompts[0], "MRR: monthly recurring revenue"))
+
+	t.Run("pack of the same name is not inherited", func(t *testing.T) {
+		childPrompts = nil
+		child := gollem.NewSubAgent("analyst", "Analyze revenue", func() (*gollem.Agent, error) {
+			return gollem.New(newPromptRecordingClient(&childPrompts, ""), gollem.WithContextPack(override)), nil
+		})
+		agent := gollem.New(newPromptRecordingClient(&parentPrompts, "analyst"),
+			gollem.WithContextPack(glossary),
+			gollem.WithSubAgents(child),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("Explain ARR"))
+		gt.NoError(t, err)
+		gt.True(t, strings.Contains(childPrompts[0], "ARR: annual recurring revenue"))
+		gt.False(t, strings.Contains(childPrompts[0], "MRR"))
+	})
+}
@@ -0,0 +1,284 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// ContextOverflowAction is what WithContextWindowGuard does with a request exceeding the
+// context window.
+type ContextOverflowAction string
+
+const (
+	// ContextOverflowFailFast fails the LLM call with ErrContextWindowExceeded without sending
+	// the request. It's the default.
+	ContextOverflowFailFast ContextOverflowAction = "fail_fast"
+
+	// ContextOverflowTruncateOldest drops the oldest turns of the history until the request
+	// fits. A turn starts at a user message, and the turn of the request is never dropped, so
+	// that tool calls keep their results.
+	ContextOverflowTruncateOldest ContextOverflowAction = "truncate_oldest"
+
+	// ContextOverflowAutoCompact compacts the history by ContextWindowPolicy.Compactor until the
+	// request fits.
+	ContextOverflowAutoCompact ContextOverflowAction = "auto_compact"
+)
+
+const defaultMaxCompactions = 3
+
+// HistoryCompactor returns history compacted to reduce its tokens, e.g. by summarizing old
+// messages. maxTokens is the tokens that the whole request should fit in. See
+// compacter.NewHistoryCompactor for a compactor summarizing by an LLM.
+type HistoryCompactor func(ctx context.Context, history *History, maxTokens int) (*History, error)
+
+// RequestTokenCounter returns the input tokens of req.
+type RequestTokenCounter func(ctx context.Context, req *ContentRequest) (int, error)
+
+// ContextWindowPolicy is how WithContextWindowGuard keeps requests within the context window of
+// the model.
+type ContextWindowPolicy struct {
+	// MaxTokens is the context window of the model in tokens. It's required.
+	MaxTokens int
+
+	// ReserveTokens is the tokens kept for the output. A request must fit in MaxTokens minus
+	// ReserveTokens.
+	ReserveTokens int
+
+	// Action is what to do with a request exceeding the context window. Default is
+	// ContextOverflowFailFast.
+	Action ContextOverflowAction
+
+	// Compactor compacts the history for ContextOverflowAutoCompact. It's required for the
+	// action.
+	Compactor HistoryCompactor
+
+	// MaxCompactions is the maximum number of compactions for a request by
+	// ContextOverflowAutoCompact. Default is 3.
+	MaxCompactions int
+
+	// CountTokens counts the tokens of a request. Default is CountRequestTokens by the
+	// Tokenizer of WithTokenizer, or EstimateTokens if not set. Use SessionTokenCounter for the
+	// count of the provider.
+	CountTokens RequestTokenCounter
+}
+
+// ContextWindowExceededError is the error of a request exceeding the context window of
+// WithContextWindowGuard. It matches ErrContextWindowExceeded by errors.Is, and is tagged with
+// ErrTagTokenExceeded, so that the compacter middleware handles it as a token limit error.
+type ContextWindowExceededError struct {
+	// Tokens is the tokens of the request after the action
+	Tokens int
+	// Limit is MaxTokens minus ReserveTokens of the policy
+	Limit int
+	// Messages is the number of messages of the history after the action
+	Messages int
+	Action   ContextOverflowAction
+}
+
+// Error implements error.
+func (e *ContextWindowExceededError) Error() string {
+	return fmt.Sprintf("context window exceeded: %d tokens exceed the limit of %d tokens (%d messages, action: %s)",
+		e.Tokens, e.Limit, e.Messages, e.Action)
+}
+
+// Is makes errors.Is match ErrContextWindowExceeded.
+func (e *ContextWindowExceededError) Is(target error) bool {
+	return target == ErrContextWindowExceeded
+}
+
+// ContextWindowEvent describes a request exceeding the context window. It's added to the trace
+// as a "context_window" event.
+type ContextWindowEvent struct {
+	Action ContextOverflowAction `json:"action"`
+	Limit  int                   `json:"limit"`
+	// Tokens and TokensAfter are the tokens of the request before and after the action
+	Tokens      int `json:"tokens"`
+	TokensAfter int `json:"tokens_after"`
+	// DroppedMessages is the number of messages dropped by ContextOverflowTruncateOldest
+	DroppedMessages int `json:"dropped_messages,omitempty"`
+	// Compactions is the number of compactions by ContextOverflowAutoCompact
+	Compactions int  `json:"compactions,omitempty"`
+	Fitted      bool `json:"fitted"`
+}
+
+// WithContextWindowGuard checks the tokens of each LLM request of the agent before sending it,
+// and truncates or compacts the history, or fails with ErrContextWindowExceeded, if the request
+// exceeds the context window of policy. It runs next to the provider, after other middlewares.
+func WithContextWindowGuard(policy *ContextWindowPolicy) Option {
+	return func(s *gollemConfig) {
+		s.contextWindow = policy
+	}
+}
+
+// SessionTokenCounter returns a RequestTokenCounter counting tokens by CountToken of a session
+// of client with the system prompt and the history of the request. Tools are not counted. It
+// may call the API of the provider, e.g. for Claude and Gemini.
+func SessionTokenCounter(client LLMClient) RequestTokenCounter {
+	return func(ctx context.Context, req *ContentRequest) (int, error) {
+		session, err := client.NewSession(ctx,
+			WithSessionSystemPrompt(req.SystemPrompt),
+			WithSessionHistory(req.History),
+		)
+		if err != nil {
+			return 0, goerr.Wrap(err, "failed to create session to count tokens")
+		}
+		tokens, err := session.CountToken(ctx, req.Inputs...)
+		if err != nil {
+			return 0, goerr.Wrap(err, "failed to count tokens")
+		}
+		return tokens, nil
+	}
+}
+
+// validate returns ErrInvalidParameter if the policy is not usable.
+func (p *ContextWindowPolicy) validate() error {
+	if p.MaxTokens <= 0 || p.ReserveTokens < 0 || p.ReserveTokens >= p.MaxTokens {
+		return goerr.Wrap(ErrInvalidParameter, "invalid tokens of context window policy",
+			goerr.V("max_tokens", p.MaxTokens), goerr.V("reserve_tokens", p.ReserveTokens))
+	}
+	switch p.Action {
+	case "", ContextOverflowFailFast, ContextOverflowTruncateOldest:
+	case ContextOverflowAutoCompact:
+		if p.Compactor == nil {
+			return goerr.Wrap(ErrInvalidParameter, "context window policy of auto compaction requires Compactor")
+		}
+	default:
+		return goerr.Wrap(ErrInvalidParameter, "unknown action of context window policy", goerr.V("action", p.Action))
+	}
+	return nil
+}
+
+// action returns the action of the policy with the default.
+func (p *ContextWindowPolicy) action() ContextOverflowAction {
+	if p.Action == "" {
+		return ContextOverflowFailFast
+	}
+	return p.Action
+}
+
+// count returns the tokens of req.
+func (p *ContextWindowPolicy) count(ctx context.Context, req *ContentRequest) (int, error) {
+	if p.CountTokens == nil {
+		return CountRequestTokens(TokenizerFromContext(ctx), req), nil
+	}
+	return p.CountTokens(ctx, req)
+}
+
+// guard makes req fit in the context window by the action of the policy.
+func (p *ContextWindowPolicy) guard(ctx context.Context, req *ContentRequest) error {
+	limit := p.MaxTokens - p.ReserveTokens
+	tokens, err := p.count(ctx, req)
+	if err != nil {
+		return err
+	}
+	if tokens <= limit {
+		return nil
+	}
+
+	event := &ContextWindowEvent{Action: p.action(), Limit: limit, Tokens: tokens}
+	switch event.Action {
+	case ContextOverflowTruncateOldest:
+		for tokens > limit {
+			truncated, dropped := dropOldestTurn(req.History)
+			if dropped == 0 {
+				break
+			}
+			req.History = truncated
+			event.DroppedMessages += dropped
+			if tokens, err = p.count(ctx, req); err != nil {
+				return err
+			}
+		}
+
+	case ContextOverflowAutoCompact:
+		maxCompactions := p.MaxCompactions
+		if maxCompactions <= 0 {
+			maxCompactions = defaultMaxCompactions
+		}
+		for tokens > limit && event.Compactions < maxCompactions && req.History != nil && len(req.History.Messages) > 0 {
+			compacted, err := p.Compactor(ctx, req.History, limit)
+			if err != nil {
+				return goerr.Wrap(err, "failed to compact history for context window")
+			}
+			event.Compactions++
+			req.History = compacted
+			if tokens, err = p.count(ctx, req); err != nil {
+				return err
+			}
+		}
+	}
+
+	event.TokensAfter = tokens
+	event.Fitted = tokens <= limit
+	if h := trace.HandlerFrom(ctx); h != nil {
+		h.AddEvent(ctx, "context_window", event)
+	}
+	if event.Fitted {
+		return nil
+	}
+
+	var messages int
+	if req.History != nil {
+		messages = len(req.History.Messages)
+	}
+	return goerr.Wrap(&ContextWindowExceededError{
+		Tokens:   tokens,
+		Limit:    limit,
+		Messages: messages,
+		Action:   event.Action,
+	}, "request exceeds the context window", goerr.T(ErrTagTokenExceeded))
+}
+
+// dropOldestTurn returns history without its first turn, and the number of dropped messages.
+// It drops nothing if the history has only one turn.
+func dropOldestTurn(history *History) (*History, int) {
+	if history == nil {
+		return history, 0
+	}
+	for i := 1; i < len(history.Messages); i++ {
+		if isTurnStart(history.Messages[i]) {
+			return &History{
+				LLType:   history.LLType,
+				Version:  history.Version,
+				Messages: history.Messages[i:],
+			}, i
+		}
+	}
+	return history, 0
+}
+
+// isTurnStart returns true if msg is a user message other than tool results.
+func isTurnStart(msg Message) bool {
+	if msg.Role != RoleUser {
+		return false
+	}
+	for _, content := range msg.Contents {
+		if content.Type == MessageContentTypeToolResponse {
+			return false
+		}
+	}
+	return true
+}
+
+// blockMiddleware guards requests of Generate.
+func (p *ContextWindowPolicy) blockMiddleware(next ContentBlockHandler) ContentBlockHandler {
+	return func(ctx context.Context, req *ContentRequest) (*ContentResponse, error) {
+		if err := p.guard(ctx, req); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// streamMiddleware guards requests of Stream.
+func (p *ContextWindowPolicy) streamMiddleware(next ContentStreamHandler) ContentStreamHandler {
+	return func(ctx context.Context, req *ContentRequest) (<-chan *ContentResponse, error) {
+		if err := p.guard(ctx, req); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,231 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// windowClient is a client whose sessions run the content middlewares, adopt the history of
+// the request like the providers, and keep the history of their calls.
+type windowClient struct {
+	// sent is the history of each request sent to the provider
+	sent []*gollem.History
+}
+
+func (c *windowClient) client(t *testing.T) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			history := &gollem.History{Version: gollem.HistoryVersion}
+			if h := cfg.History(); h != nil {
+				history = h.Clone()
+			}
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					handler := cfg.ContentBlockChain(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+						c.sent = append(c.sent, req.History.Clone())
+						return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+					})
+					req := &gollem.ContentRequest{Inputs: input, History: history.Clone(), SystemPrompt: cfg.SystemPrompt()}
+					resp, err := handler(ctx, req)
+					if err != nil {
+						return nil, err
+					}
+					history = req.History
+					history.Messages = append(history.Messages,
+						textMessage(t, gollem.RoleUser, input[0].String()),
+						textMessage(t, gollem.RoleAssistant, "ok"),
+					)
+					return &gollem.Response{Texts: resp.Texts}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) { return history.Clone(), nil },
+			}, nil
+		},
+	}
+}
+
+// longHistory returns a history of turns, each of which has about 100 tokens.
+func longHistory(t *testing.T, turns int) *gollem.History {
+	b := gollem.NewHistoryBuilder()
+	for range turns {
+		b.User(strings.Repeat("word ", 60)).Assistant(strings.Repeat("word ", 20))
+	}
+	history, err := b.Build()
+	gt.NoError(t, err)
+	return history
+}
+
+func TestContextWindowGuard(t *testing.T) {
+	t.Run("request within the window is sent as it is", func(t *testing.T) {
+		c := &windowClient{}
+		agent := gollem.New(c.client(t),
+			gollem.WithHistory(longHistory(t, 2)),
+			gollem.WithContextWindowGuard(&gollem.ContextWindowPolicy{MaxTokens: 1000}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, c.sent).Length(1)
+		gt.A(t, c.sent[0].Messages).Length(4)
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		c := &windowClient{}
+		agent := gollem.New(c.client(t),
+			gollem.WithHistory(longHistory(t, 3)),
+			gollem.WithContextWindowGuard(&gollem.ContextWindowPolicy{MaxTokens: 300, ReserveTokens: 100}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrContextWindowExceeded)
+		gt.True(t, goerr.HasTag(err, gollem.ErrTagTokenExceeded))
+		gt.A(t, c.sent).Length(0)
+
+		var exceeded *gollem.ContextWindowExceededError
+		gt.True(t, errors.As(err, &exceeded))
+		gt.Equal(t, 200, exceeded.Limit)
+		gt.Equal(t, 6, exceeded.Messages)
+		gt.Equal(t, gollem.ContextOverflowFailFast, exceeded.Action)
+		gt.N(t, exceeded.Tokens).Greater(200)
+	})
+
+	t.Run("truncate oldest turns", func(t *testing.T) {
+		c := &windowClient{}
+		agent := gollem.New(c.client(t),
+			gollem.WithHistory(longHistory(t, 5)),
+			gollem.WithContextWindowGuard(&gollem.ContextWindowPolicy{
+				MaxTokens: 250,
+				Action:    gollem.ContextOverflowTruncateOldest,
+			}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, c.sent).Length(1)
+		gt.A(t, c.sent[0].Messages).Length(4)
+		gt.Equal(t, gollem.RoleUser, c.sent[0].Messages[0].Role)
+
+		// The truncated history is kept by the session
+		history, err := agent.Session().History()
+		gt.NoError(t, err)
+		gt.A(t, history.Messages).Length(6)
+	})
+
+	t.Run("truncation keeps the turn of the request", func(t *testing.T) {
+		c := &windowClient{}
+		agent := gollem.New(c.client(t),
+			gollem.WithContextWindowGuard(&gollem.ContextWindowPolicy{
+				MaxTokens: 50,
+				Action:    gollem.ContextOverflowTruncateOldest,
+			}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text(strings.Repeat("word ", 100)))
+		gt.Error(t, err).Is(gollem.ErrContextWindowExceeded)
+		gt.A(t, c.sent).Length(0)
+	})
+
+	t.Run("auto compact", func(t *testing.T) {
+		c := &windowClient{}
+		var compactions int
+		compactor := func(ctx context.Context, history *gollem.History, maxTokens int) (*gollem.History, error) {
+			compactions++
+			gt.Equal(t, 250, maxTokens)
+			// Each compaction drops two turns
+			compacted := history.Clone()
+			compacted.Messages = compacted.Messages[4:]
+			return compacted, nil
+		}
+		agent := gollem.New(c.client(t),
+			gollem.WithHistory(longHistory(t, 6)),
+			gollem.WithContextWindowGuard(&gollem.ContextWindowPolicy{
+				MaxTokens: 250,
+				Action:    gollem.ContextOverflowAutoCompact,
+				Compactor: compactor,
+			}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.Equal(t, 2, compactions)
+		gt.A(t, c.sent).Length(1)
+		gt.A(t, c.sent[0].Messages).Length(4)
+	})
+
+	t.Run("auto compact gives up after max compactions", func(t *testing.T) {
+		c := &windowClient{}
+		var compactions int
+		agent := gollem.New(c.client(t),
+			gollem.WithHistory(longHistory(t, 6)),
+			gollem.WithContextWindowGuard(&gollem.ContextWindowPolicy{
+				MaxTokens:      250,
+				Action:         gollem.ContextOverflowAutoCompact,
+				MaxCompactions: 2,
+				Compactor: func(ctx context.Context, history *gollem.History, maxTokens int) (*gollem.History, error) {
+					compactions++
+					return history, nil
+				},
+			}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrContextWindowExceeded)
+		gt.Equal(t, 2, compactions)
+	})
+
+	t.Run("token counter", func(t *testing.T) {
+		c := &windowClient{}
+		var counted []*gollem.ContentRequest
+		agent := gollem.New(c.client(t),
+			gollem.WithContextWindowGuard(&gollem.ContextWindowPolicy{
+				MaxTokens: 1000,
+				CountTokens: func(ctx context.Context, req *gollem.ContentRequest) (int, error) {
+					counted = append(counted, req)
+					return 2000, nil
+				},
+			}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(gollem.ErrContextWindowExceeded)
+		gt.A(t, counted).Length(1)
+		gt.Equal(t, "hello", counted[0].Inputs[0].String())
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		c := &windowClient{}
+		for _, policy := range []*gollem.ContextWindowPolicy{
+			{},
+			{MaxTokens: 100, ReserveTokens: 100},
+			{MaxTokens: 100, Action: gollem.ContextOverflowAutoCompact},
+			{MaxTokens: 100, Action: "unknown"},
+		} {
+			agent := gollem.New(c.client(t), gollem.WithContextWindowGuard(policy))
+			_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+			gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+		}
+	})
+}
+
+func TestSessionTokenCounter(t *testing.T) {
+	history := longHistory(t, 1)
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				CountTokenFunc: func(ctx context.Context, input ...gollem.Input) (int, error) {
+					return len(cfg.SystemPrompt()) + len(cfg.History().Messages)*100 + len(input), nil
+				},
+			}, nil
+		},
+	}
+
+	counter := gollem.SessionTokenCounter(client)
+	tokens, err := counter(t.Context(), &gollem.ContentRequest{
+		SystemPrompt: "system",
+		History:      history,
+		Inputs:       []gollem.Input{gollem.Text("a"), gollem.Text("b")},
+	})
+	gt.NoError(t, err)
+	gt.Equal(t, 6+200+2, tokens)
+}
@@ -0,0 +1,88 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ConversationConfig is a read-only snapshot of the agent configuration used for an Execute call.
+// It is passed to ConversationStartHook for audit logging and analytics.
+type ConversationConfig struct {
+	SystemPrompt string
+	LoopLimit    int
+	ResponseMode ResponseMode
+	ContentType  ContentType
+	Strategy     string
+	ToolNames    []string
+	Flags        Flags
+}
+
+// ConversationStartEvent is passed to ConversationStartHook when Execute begins.
+type ConversationStartEvent struct {
+	ExecID    string
+	Inputs    []Input
+	Config    ConversationConfig
+	StartedAt time.Time
+}
+
+// ConversationEndEvent is passed to ConversationEndHook when Execute finishes,
+// regardless of whether it succeeded or failed.
+type ConversationEndEvent struct {
+	ExecID      string
+	Response    *ExecuteResponse
+	InputToken  int
+	OutputToken int
+	Duration    time.Duration
+	Error       error
+
+	// Cancellation describes why Execute was stopped if Error is caused by a cancellation such
+	// as of ctx, a budget or the loop limit. It's nil otherwise.
+	Cancellation *CancellationInfo
+}
+
+// ConversationStartHook is called at the beginning of each Execute call.
+// If the hook returns an error, Execute is aborted and the error is returned.
+type ConversationStartHook func(ctx context.Context, event *ConversationStartEvent) error
+
+// ConversationEndHook is called at the end of each Execute call.
+type ConversationEndHook func(ctx context.Context, event *ConversationEndEvent)
+
+// WithConversationStartHook adds a hook that is called at the beginning of each Execute call.
+// Multiple hooks are called in the order they are added.
+func WithConversationStartHook(hook ConversationStartHook) Option {
+	return func(s *gollemConfig) {
+		s.conversationStartHooks = append(s.conversationStartHooks, hook)
+	}
+}
+
+// WithConversationEndHook adds a hook that is called at the end of each Execute call.
+// Multiple hooks are called in the order they are added.
+func WithConversationEndHook(hook ConversationEndHook) Option {
+	return func(s *gollemConfig) {
+		s.conversationEndHooks = append(s.conversationEndHooks, hook)
+	}
+}
+
+// conversationConfig builds a ConversationConfig snapshot from the agent configuration.
+func (c *gollemConfig) conversationConfig(tools []Tool) ConversationConfig {
+	toolNames := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		toolNames = append(toolNames, tool.Spec().Name)
+	}
+
+	var strategy string
+	if c.strategy != nil {
+		strategy = fmt.Sprintf("%T", c.strategy)
+	}
+
+	return ConversationConfig{
+		SystemPrompt: c.systemPrompt,
+		LoopLimit:    c.loopLimit,
+		ResponseMode: c.responseMode,
+		ContentType:  c.contentType,
+		Strategy:     strategy,
+		ToolNames:    toolNames,
+		Flags:        c.flags,
+	}
+}
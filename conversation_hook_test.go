@@ -0,0 +1,102 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestConversationHooks(t *testing.T) {
+	newClient := func(genErr error) *mock.LLMClientMock {
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						if genErr != nil {
+							return nil, genErr
+						}
+						return &gollem.Response{
+							Texts:       []string{"done"},
+							InputToken:  10,
+							OutputToken: 5,
+						}, nil
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return &gollem.History{}, nil
+					},
+					AppendHistoryFunc: func(*gollem.History) error { return nil },
+				}, nil
+			},
+		}
+	}
+
+	t.Run("start and end hooks receive execution data", func(t *testing.T) {
+		var startEvent *gollem.ConversationStartEvent
+		var endEvent *gollem.ConversationEndEvent
+
+		agent := gollem.New(newClient(nil),
+			gollem.WithSystemPrompt("be helpful"),
+			gollem.WithTools(&RandomNumberTool{}),
+			gollem.WithConversationStartHook(func(ctx context.Context, event *gollem.ConversationStartEvent) error {
+				startEvent = event
+				return nil
+			}),
+			gollem.WithConversationEndHook(func(ctx context.Context, event *gollem.ConversationEndEvent) {
+				endEvent = event
+			}),
+		)
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.NotNil(t, resp)
+
+		gt.NotNil(t, startEvent)
+		gt.A(t, startEvent.Inputs).Length(1)
+		gt.Equal(t, "be helpful", startEvent.Config.SystemPrompt)
+		gt.Equal(t, []string{"random_number"}, startEvent.Config.ToolNames)
+		gt.Equal(t, gollem.DefaultLoopLimit, startEvent.Config.LoopLimit)
+
+		gt.NotNil(t, endEvent)
+		gt.Equal(t, startEvent.ExecID, endEvent.ExecID)
+		gt.Equal(t, resp, endEvent.Response)
+		gt.Equal(t, 10, endEvent.InputToken)
+		gt.Equal(t, 5, endEvent.OutputToken)
+		gt.NoError(t, endEvent.Error)
+	})
+
+	t.Run("end hook receives error", func(t *testing.T) {
+		genErr := errors.New("llm failure")
+		var endEvent *gollem.ConversationEndEvent
+
+		agent := gollem.New(newClient(genErr),
+			gollem.WithConversationEndHook(func(ctx context.Context, event *gollem.ConversationEndEvent) {
+				endEvent = event
+			}),
+		)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err)
+		gt.NotNil(t, endEvent)
+		gt.True(t, errors.Is(endEvent.Error, genErr))
+		gt.Nil(t, endEvent.Response)
+	})
+
+	t.Run("start hook error aborts execution", func(t *testing.T) {
+		hookErr := errors.New("denied")
+		client := newClient(nil)
+
+		agent := gollem.New(client,
+			gollem.WithConversationStartHook(func(ctx context.Context, event *gollem.ConversationStartEvent) error {
+				return hookErr
+			}),
+		)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.True(t, errors.Is(err, hookErr))
+		gt.A(t, client.NewSessionCalls()).Length(0)
+	})
+}
@@ -0,0 +1,290 @@
+package gollem
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// DeferredTool is a tool executed by an external system, e.g. a ticket resolved by a human or
+// a long-running job. When the LLM calls it, the agent starts the work by Run, pauses, and
+// continues by Agent.Resume after the external system posts the result with
+// Agent.CompleteToolCall.
+type DeferredTool interface {
+	// Spec returns the specification of the tool.
+	Spec() ToolSpec
+
+	// Run starts the work and returns the handle identifying it, e.g. the ID of a ticket or a
+	// job. The handle must be unique among pending calls of the agent. An error is passed to the
+	// LLM as a result of the call, like Tool.Run, and the agent does not pause for it.
+	Run(ctx context.Context, args map[string]any) (handle string, err error)
+}
+
+// WithDeferredTools adds tools executed by external systems. See DeferredTool.
+func WithDeferredTools(tools ...DeferredTool) Option {
+	return func(s *gollemConfig) {
+		for _, tool := range tools {
+			s.tools = append(s.tools, &deferredToolAdapter{tool: tool})
+		}
+	}
+}
+
+// deferredToolAdapter runs a DeferredTool as a Tool through the middleware and trace of tools.
+// A started call is reported by an error wrapping ErrToolCallDeferred.
+type deferredToolAdapter struct {
+	tool DeferredTool
+}
+
+func (x *deferredToolAdapter) Spec() ToolSpec {
+	return x.tool.Spec()
+}
+
+func (x *deferredToolAdapter) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	handle, err := x.tool.Run(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if handle == "" {
+		return nil, goerr.New("deferred tool returned an empty handle")
+	}
+	return nil, &deferredCallError{handle: handle}
+}
+
+// deferredCallError is the result of a started call of a DeferredTool.
+type deferredCallError struct {
+	handle string
+}
+
+func (x *deferredCallError) Error() string {
+	return ErrToolCallDeferred.Error() + ": " + x.handle
+}
+
+func (x *deferredCallError) Unwrap() error {
+	return ErrToolCallDeferred
+}
+
+// PausedExecutionVersion is the version of the JSON format of PausedExecution.
+const PausedExecutionVersion = 1
+
+// PausedExecution is the state of an Execute paused for calls of DeferredTool. It's
+// JSON-serializable to resume the execution in another process with Agent.RestorePaused.
+type PausedExecution struct {
+	Version int `json:"version"`
+
+	// History is the session history with the LLM response calling the tools
+	History *History `json:"history"`
+
+	// Calls are all tool calls of the response in order, including calls of other tools that
+	// have already finished.
+	Calls []*PausedToolCall `json:"calls"`
+}
+
+// PausedToolCall is a tool call of a PausedExecution.
+type PausedToolCall struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+
+	// Handle is the handle returned by DeferredTool.Run, empty for calls of other tools
+	Handle string `json:"handle,omitempty"`
+
+	// Done is true if the call has finished with Result or Error
+	Done   bool           `json:"done"`
+	Result map[string]any `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Pending returns the calls waiting for the external systems.
+func (x *PausedExecution) Pending() []*PausedToolCall {
+	var pending []*PausedToolCall
+	for _, call := range x.Calls {
+		if !call.Done {
+			pending = append(pending, call)
+		}
+	}
+	return pending
+}
+
+// pausedState holds the paused execution of an agent. Results are posted from other goroutines,
+// e.g. webhook handlers, while the agent is idle.
+type pausedState struct {
+	mu     sync.Mutex
+	paused *PausedExecution
+}
+
+// newPausedExecution returns the paused execution if some of the results of calls are deferred,
+// or nil otherwise.
+func newPausedExecution(calls []*FunctionCall, results []Input, history *History) *PausedExecution {
+	paused := &PausedExecution{Version: PausedExecutionVersion, History: history}
+	deferred := false
+
+	for i, call := range calls {
+		pc := &PausedToolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments, Done: true}
+		if i < len(results) {
+			if resp, ok := results[i].(FunctionResponse); ok {
+				var dc *deferredCallError
+				switch {
+				case errors.As(resp.Error, &dc):
+					pc.Handle, pc.Done = dc.handle, false
+					deferred = true
+				case resp.Error != nil:
+					pc.Error = resp.Error.Error()
+				default:
+					pc.Result = resp.Data
+				}
+			}
+		}
+		paused.Calls = append(paused.Calls, pc)
+	}
+
+	if !deferred {
+		return nil
+	}
+	return paused
+}
+
+// pauseIfDeferred pauses the agent if some of the results of calls are deferred, and returns
+// ErrExecutionPaused then.
+func (g *Agent) pauseIfDeferred(calls []*FunctionCall, results []Input) error {
+	hasDeferred := false
+	for _, result := range results {
+		if resp, ok := result.(FunctionResponse); ok && errors.Is(resp.Error, ErrToolCallDeferred) {
+			hasDeferred = true
+			break
+		}
+	}
+	if !hasDeferred {
+		return nil
+	}
+
+	history, err := g.currentSession.History()
+	if err != nil {
+		return goerr.Wrap(err, "failed to get session history for pause")
+	}
+	paused := newPausedExecution(calls, results, history)
+
+	g.pausedState.mu.Lock()
+	defer g.pausedState.mu.Unlock()
+	g.pausedState.paused = paused
+	return goerr.Wrap(ErrExecutionPaused, "waiting for deferred tool calls", goerr.V("pending", len(paused.Pending())))
+}
+
+// Paused returns a copy of the state of the paused execution, or nil if the agent is not
+// paused. Save it to resume the execution in another process with RestorePaused.
+func (g *Agent) Paused() *PausedExecution {
+	g.pausedState.mu.Lock()
+	defer g.pausedState.mu.Unlock()
+
+	if g.pausedState.paused == nil {
+		return nil
+	}
+	paused := *g.pausedState.paused
+	paused.Calls = make([]*PausedToolCall, len(g.pausedState.paused.Calls))
+	for i, call := range g.pausedState.paused.Calls {
+		c := *call
+		paused.Calls[i] = &c
+	}
+	return &paused
+}
+
+// RestorePaused restores a paused execution saved from Paused, e.g. in a new process. The
+// session is created with the history of the paused execution by Resume, so the agent must not
+// have a session nor WithHistory. With WithHistoryRepository, the history in the repository is
+// used instead.
+func (g *Agent) RestorePaused(paused *PausedExecution) error {
+	if paused == nil || paused.History == nil {
+		return goerr.New("paused execution with history is required")
+	}
+	if paused.Version != PausedExecutionVersion {
+		return goerr.New("unsupported version of paused execution", goerr.V("version", paused.Version))
+	}
+	if g.currentSession != nil {
+		return goerr.New("agent already has a session")
+	}
+	if g.history != nil {
+		return goerr.New("paused execution cannot be restored with WithHistory")
+	}
+
+	if g.historyRepo == nil {
+		g.history = paused.History
+	}
+	g.pausedState.mu.Lock()
+	defer g.pausedState.mu.Unlock()
+	g.pausedState.paused = paused
+	return nil
+}
+
+// CompleteToolCall posts the result of a pending call of DeferredTool identified by handle. It
+// can be called from any goroutine, e.g. a webhook handler. Returns ErrToolCallNotFound if no
+// call is pending with handle.
+func (g *Agent) CompleteToolCall(handle string, result map[string]any) error {
+	return g.finishToolCall(handle, result, nil)
+}
+
+// FailToolCall posts the failure of a pending call of DeferredTool identified by handle. The
+// error is passed to the LLM as the result of the call.
+func (g *Agent) FailToolCall(handle string, cause error) error {
+	if cause == nil {
+		return goerr.New("cause is required")
+	}
+	return g.finishToolCall(handle, nil, cause)
+}
+
+func (g *Agent) finishToolCall(handle string, result map[string]any, cause error) error {
+	g.pausedState.mu.Lock()
+	defer g.pausedState.mu.Unlock()
+
+	if g.pausedState.paused != nil {
+		for _, call := range g.pausedState.paused.Calls {
+			if call.Handle != handle || call.Done {
+				continue
+			}
+			call.Done = true
+			if cause != nil {
+				call.Error = cause.Error()
+			} else {
+				sanitized, err := copyToolResult(result)
+				if err != nil {
+					return goerr.Wrap(err, "invalid tool result", goerr.V("handle", handle))
+				}
+				call.Result = sanitized
+			}
+			return nil
+		}
+	}
+
+	return goerr.Wrap(ErrToolCallNotFound, "no pending tool call", goerr.V("handle", handle))
+}
+
+// Resume continues the paused execution with the results of the tool calls, and returns the
+// result like Execute. It returns ErrExecutionPaused if some calls are still pending. Resume
+// sends the results to the LLM as the input of a new Execute, so it works with strategies
+// passing the input to the LLM as is, such as the default strategy.
+func (g *Agent) Resume(ctx context.Context) (*ExecuteResponse, error) {
+	g.pausedState.mu.Lock()
+	paused := g.pausedState.paused
+	if paused == nil {
+		g.pausedState.mu.Unlock()
+		return nil, goerr.New("agent is not paused")
+	}
+	if pending := paused.Pending(); len(pending) > 0 {
+		g.pausedState.mu.Unlock()
+		return nil, goerr.Wrap(ErrExecutionPaused, "tool calls are still pending", goerr.V("pending", len(pending)))
+	}
+	g.pausedState.paused = nil
+	g.pausedState.mu.Unlock()
+
+	inputs := make([]Input, len(paused.Calls))
+	for i, call := range paused.Calls {
+		resp := FunctionResponse{ID: call.ID, Name: call.Name, Data: call.Result, Encoding: g.toolResultEncoding}
+		if call.Error != "" {
+			resp.Data = nil
+			resp.Error = errors.New(call.Error)
+		}
+		inputs[i] = resp
+	}
+
+	return g.Execute(ctx, inputs...)
+}
@@ -0,0 +1,185 @@
+package gollem_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+type ticketTool struct {
+	filed []map[string]any
+}
+
+func (t *ticketTool) Spec() gollem.ToolSpec {
+	return gollem.ToolSpec{
+		Name:        "request_approval",
+		Description: "File a ticket to request approval by a human",
+		Parameters: map[string]*gollem.Parameter{
+			"action": {Type: gollem.TypeString, Description: "action to approve"},
+		},
+	}
+}
+
+func (t *ticketTool) Run(ctx context.Context, args map[string]any) (string, error) {
+	if args["action"] == "invalid" {
+		return "", errors.New("ticket system rejected the request")
+	}
+	t.filed = append(t.filed, args)
+	return "TICKET-1", nil
+}
+
+// newDeferredClient returns a client requesting approval and looking up a domain in the first
+// response, and answering with the received results after that. The session is created with
+// the history in the session options.
+func newDeferredClient(received *[]gollem.Input, histories *[]*gollem.History, action string) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			history := cfg.History()
+			*histories = append(*histories, history)
+			if history == nil {
+				history = &gollem.History{Version: gollem.HistoryVersion}
+			}
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					if _, ok := input[0].(gollem.FunctionResponse); ok {
+						*received = input
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+					return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+						{ID: "call_1", Name: "request_approval", Arguments: map[string]any{"action": action}},
+						{ID: "call_2", Name: "lookup", Arguments: map[string]any{"domain": "example.com"}},
+					}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return history, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func TestDeferredTool(t *testing.T) {
+	lookup := &mockTool{
+		spec: gollem.ToolSpec{Name: "lookup", Description: "look up a domain", Parameters: map[string]*gollem.Parameter{
+			"domain": {Type: gollem.TypeString, Description: "domain"},
+		}},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{"ip": "192.0.2.1"}, nil
+		},
+	}
+
+	t.Run("pause and resume", func(t *testing.T) {
+		var received []gollem.Input
+		var histories []*gollem.History
+		tickets := &ticketTool{}
+		var middlewareErrs []error
+		agent := gollem.New(newDeferredClient(&received, &histories, "deploy"),
+			gollem.WithTools(lookup),
+			gollem.WithDeferredTools(tickets),
+			gollem.WithToolMiddleware(func(next gollem.ToolHandler) gollem.ToolHandler {
+				return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+					resp, err := next(ctx, req)
+					if err == nil && resp.Error != nil {
+						middlewareErrs = append(middlewareErrs, resp.Error)
+					}
+					return resp, err
+				}
+			}),
+		)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("deploy it"))
+		gt.Error(t, err).Is(gollem.ErrExecutionPaused)
+		gt.A(t, tickets.filed).Length(1)
+		gt.A(t, middlewareErrs).Length(1).At(0, func(t testing.TB, v error) {
+			gt.True(t, errors.Is(v, gollem.ErrToolCallDeferred))
+		})
+
+		paused := agent.Paused()
+		gt.NotNil(t, paused)
+		gt.A(t, paused.Calls).Length(2)
+		gt.A(t, paused.Pending()).Length(1).At(0, func(t testing.TB, v *gollem.PausedToolCall) {
+			gt.Equal(t, "TICKET-1", v.Handle)
+			gt.Equal(t, "call_1", v.ID)
+		})
+		gt.True(t, paused.Calls[1].Done)
+		gt.Equal(t, any("192.0.2.1"), paused.Calls[1].Result["ip"])
+
+		// The agent stays paused until the results are posted
+		_, err = agent.Execute(t.Context(), gollem.Text("another"))
+		gt.Error(t, err).Is(gollem.ErrExecutionPaused)
+		_, err = agent.Resume(t.Context())
+		gt.Error(t, err).Is(gollem.ErrExecutionPaused)
+		gt.Error(t, agent.CompleteToolCall("TICKET-2", map[string]any{})).Is(gollem.ErrToolCallNotFound)
+
+		gt.NoError(t, agent.CompleteToolCall("TICKET-1", map[string]any{"approved": true}))
+		gt.Error(t, agent.CompleteToolCall("TICKET-1", map[string]any{})).Is(gollem.ErrToolCallNotFound)
+
+		resp, err := agent.Resume(t.Context())
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Length(1).Has("done")
+		gt.Nil(t, agent.Paused())
+
+		gt.A(t, received).Length(2)
+		approval := received[0].(gollem.FunctionResponse)
+		gt.Equal(t, "call_1", approval.ID)
+		gt.Equal(t, any(true), approval.Data["approved"])
+		result := received[1].(gollem.FunctionResponse)
+		gt.Equal(t, "call_2", result.ID)
+		gt.Equal(t, any("192.0.2.1"), result.Data["ip"])
+	})
+
+	t.Run("restore in another agent", func(t *testing.T) {
+		var received []gollem.Input
+		var histories []*gollem.History
+		agent := gollem.New(newDeferredClient(&received, &histories, "deploy"),
+			gollem.WithTools(lookup), gollem.WithDeferredTools(&ticketTool{}))
+		_, err := agent.Execute(t.Context(), gollem.Text("deploy it"))
+		gt.Error(t, err).Is(gollem.ErrExecutionPaused)
+
+		data, err := json.Marshal(agent.Paused())
+		gt.NoError(t, err)
+		var paused gollem.PausedExecution
+		gt.NoError(t, json.Unmarshal(data, &paused))
+
+		restored := gollem.New(newDeferredClient(&received, &histories, "deploy"),
+			gollem.WithTools(lookup), gollem.WithDeferredTools(&ticketTool{}))
+		gt.NoError(t, restored.RestorePaused(&paused))
+		gt.NoError(t, restored.FailToolCall("TICKET-1", errors.New("rejected by reviewer")))
+
+		resp, err := restored.Resume(t.Context())
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Has("done")
+
+		// The session of the restored agent starts with the paused history
+		gt.A(t, histories).Length(2)
+		gt.NotNil(t, histories[1])
+		approval := received[0].(gollem.FunctionResponse)
+		gt.Error(t, approval.Error)
+		gt.Equal(t, "rejected by reviewer", approval.Error.Error())
+	})
+
+	t.Run("error of Run does not pause", func(t *testing.T) {
+		var received []gollem.Input
+		var histories []*gollem.History
+		agent := gollem.New(newDeferredClient(&received, &histories, "invalid"),
+			gollem.WithTools(lookup), gollem.WithDeferredTools(&ticketTool{}))
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("deploy it"))
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Has("done")
+		gt.Nil(t, agent.Paused())
+		gt.Error(t, received[0].(gollem.FunctionResponse).Error)
+	})
+
+	t.Run("restore requires no session", func(t *testing.T) {
+		agent := gollem.New(&mock.LLMClientMock{})
+		gt.Error(t, agent.RestorePaused(nil))
+		gt.Error(t, agent.RestorePaused(&gollem.PausedExecution{Version: 99, History: &gollem.History{}}))
+	})
+}
@@ -0,0 +1,197 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AgentDescription is a read-only snapshot of the effective configuration of an agent returned
+// by Agent.Describe, e.g. for debugging or for pages showing what the agent can do. Secrets are
+// omitted: defaults of sensitive parameters are replaced by RedactedValue, the system prompt is
+// redacted by WithPromptTraceRedactor, and credentials of clients and repositories are not
+// included.
+type AgentDescription struct {
+	// Model is the default model of the client, or empty if the client does not tell it
+	Model        string       `json:"model,omitempty"`
+	SystemPrompt string       `json:"system_prompt,omitempty"`
+	Strategy     string       `json:"strategy,omitempty"`
+	LoopLimit    int          `json:"loop_limit"`
+	ResponseMode ResponseMode `json:"response_mode"`
+	ContentType  ContentType  `json:"content_type,omitempty"`
+	Flags        Flags        `json:"flags,omitempty"`
+
+	// Tools are the specs of the tools of the agent, including tools of ToolSets, skills,
+	// subagents and flags, in order of name. Tools of the strategy are not included.
+	Tools  []ToolSpec `json:"tools"`
+	Skills []string   `json:"skills,omitempty"`
+
+	ToolTimeout        time.Duration      `json:"tool_timeout,omitempty"`
+	ParallelToolCalls  int                `json:"parallel_tool_calls,omitempty"`
+	ToolResultEncoding ToolResultEncoding `json:"tool_result_encoding,omitempty"`
+	Guardrails         []string           `json:"guardrails,omitempty"`
+	ToolPolicies       int                `json:"tool_policies,omitempty"`
+
+	Budget *BudgetDescription `json:"budget,omitempty"`
+	Retry  *RetryDescription  `json:"retry,omitempty"`
+
+	// HistoryRepository is true if the history is saved by WithHistoryRepository
+	HistoryRepository bool `json:"history_repository"`
+
+	// Middlewares are the names of the middleware functions, such as
+	// "compacter.NewContentBlockMiddleware" for history compaction
+	Middlewares MiddlewareDescription `json:"middlewares"`
+}
+
+// BudgetDescription is the budget of each Execute set by WithBudget.
+type BudgetDescription struct {
+	MaxUSD    float64 `json:"max_usd,omitempty"`
+	MaxTokens int     `json:"max_tokens,omitempty"`
+}
+
+// RetryDescription is the retry policy of LLM calls set by WithRetryPolicy.
+type RetryDescription struct {
+	MaxAttempts int           `json:"max_attempts"`
+	BaseDelay   time.Duration `json:"base_delay"`
+	MaxDelay    time.Duration `json:"max_delay,omitempty"`
+	Jitter      float64       `json:"jitter,omitempty"`
+}
+
+// MiddlewareDescription is the names of the middlewares of an agent in order of registration.
+type MiddlewareDescription struct {
+	ContentBlock  []string `json:"content_block,omitempty"`
+	ContentStream []string `json:"content_stream,omitempty"`
+	Tool          []string `json:"tool,omitempty"`
+}
+
+// Describe returns the effective configuration of the agent as Execute with ctx would use it,
+// with flags of ctx and tools of ToolSets and skills resolved. It does not call the LLM and
+// does not modify the agent.
+func (g *Agent) Describe(ctx context.Context) (*AgentDescription, error) {
+	cfg := g.Clone()
+	flags, err := cfg.applyFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.skills) > 0 {
+		if err := cfg.applySkills(); err != nil {
+			return nil, err
+		}
+	}
+	_, tools, err := setupTools(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &AgentDescription{
+		SystemPrompt:       cfg.systemPrompt,
+		LoopLimit:          cfg.loopLimit,
+		ResponseMode:       cfg.responseMode,
+		ContentType:        cfg.contentType,
+		Flags:              flags,
+		Tools:              make([]ToolSpec, 0, len(tools)),
+		ToolTimeout:        cfg.toolTimeout,
+		ParallelToolCalls:  cfg.parallelToolCalls,
+		ToolResultEncoding: cfg.toolResultEncoding,
+		ToolPolicies:       len(cfg.toolPolicies),
+		HistoryRepository:  cfg.historyRepo != nil,
+		Middlewares: MiddlewareDescription{
+			ContentBlock:  funcNames(cfg.contentBlockMiddlewares),
+			ContentStream: funcNames(cfg.contentStreamMiddlewares),
+			Tool:          funcNames(cfg.toolMiddlewares),
+		},
+	}
+	if m, ok := g.llm.(interface{ Model() string }); ok {
+		desc.Model = m.Model()
+	}
+	if cfg.promptTraceRedactor != nil {
+		desc.SystemPrompt = cfg.promptTraceRedactor(desc.SystemPrompt)
+	}
+	if cfg.strategy != nil {
+		desc.Strategy = fmt.Sprintf("%T", cfg.strategy)
+	}
+
+	for _, tool := range tools {
+		spec := tool.Spec()
+		spec.Parameters = describeParams(spec.Parameters, false)
+		desc.Tools = append(desc.Tools, spec)
+	}
+	sort.Slice(desc.Tools, func(i, j int) bool { return desc.Tools[i].Name < desc.Tools[j].Name })
+
+	for _, skill := range cfg.skills {
+		desc.Skills = append(desc.Skills, skill.Name)
+	}
+	for _, guardrail := range cfg.guardrails {
+		desc.Guardrails = append(desc.Guardrails, guardrail.Name)
+	}
+	if cfg.budget != nil {
+		desc.Budget = &BudgetDescription{MaxUSD: cfg.budget.maxUSD, MaxTokens: cfg.budget.maxTokens}
+	}
+	if cfg.retryPolicy != nil {
+		desc.Retry = &RetryDescription{
+			MaxAttempts: cfg.retryPolicy.MaxAttempts,
+			BaseDelay:   cfg.retryPolicy.BaseDelay,
+			MaxDelay:    cfg.retryPolicy.MaxDelay,
+			Jitter:      cfg.retryPolicy.Jitter,
+		}
+	}
+	return desc, nil
+}
+
+// describeParams returns a copy of params with defaults of sensitive parameters, including
+// properties and items of them, redacted.
+func describeParams(params map[string]*Parameter, sensitive bool) map[string]*Parameter {
+	if params == nil {
+		return nil
+	}
+	result := make(map[string]*Parameter, len(params))
+	for name, param := range params {
+		result[name] = describeParam(param, sensitive)
+	}
+	return result
+}
+
+func describeParam(p *Parameter, sensitive bool) *Parameter {
+	if p == nil {
+		return nil
+	}
+	sensitive = sensitive || p.Sensitive
+	c := *p
+	if sensitive && c.Default != nil {
+		c.Default = RedactedValue
+	}
+	c.Properties = describeParams(p.Properties, sensitive)
+	c.Items = describeParam(p.Items, sensitive)
+	return &c
+}
+
+// funcNames returns the names of functions without the import path and suffixes of closures,
+// e.g. "compacter.NewContentBlockMiddleware".
+func funcNames[T any](funcs []T) []string {
+	var names []string
+	for _, f := range funcs {
+		v := reflect.ValueOf(f)
+		if v.Kind() != reflect.Func || v.IsNil() {
+			continue
+		}
+		name := "unknown"
+		if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+			name = fn.Name()
+		}
+		name = name[strings.LastIndex(name, "/")+1:]
+		name = strings.TrimSuffix(name, "-fm")
+		for {
+			i := strings.LastIndex(name, ".func")
+			if i < 0 || strings.Trim(name[i+len(".func"):], "0123456789.") != "" {
+				break
+			}
+			name = name[:i]
+		}
+		names = append(names, name)
+	}
+	return names
+}
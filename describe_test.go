@@ -0,0 +1,97 @@
+package gollem_test
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// modelClient is a client telling its model
+type modelClient struct {
+	mock.LLMClientMock
+}
+
+func (c *modelClient) Model() string {
+	return "test-model"
+}
+
+func auditToolMiddleware(next gollem.ToolHandler) gollem.ToolHandler {
+	return next
+}
+
+func TestAgentDescribe(t *testing.T) {
+	client := &modelClient{}
+	newTool := func(name string) gollem.Tool {
+		return &mockTool{spec: gollem.ToolSpec{
+			Name:        name,
+			Description: "Test tool",
+			Parameters: map[string]*gollem.Parameter{
+				"token": {Type: gollem.TypeString, Sensitive: true, Default: "sk-default"},
+				"query": {Type: gollem.TypeString, Default: "all"},
+			},
+		}}
+	}
+	toolSet := &mockToolSet{specs: []gollem.ToolSpec{{Name: "mcp_search", Description: "Search"}}}
+
+	agent := gollem.New(client,
+		gollem.WithSystemPrompt("Use the key sk-secret-123 for the API"),
+		gollem.WithPromptTraceRedactor(gollem.RedactPatterns(regexp.MustCompile(`sk-[a-z0-9-]+`))),
+		gollem.WithTools(newTool("write_file"), newTool("read_file")),
+		gollem.WithToolSets(toolSet),
+		gollem.WithFlaggedTools("beta", newTool("beta_tool")),
+		gollem.WithContentBlockMiddleware(compacter.NewContentBlockMiddleware(client)),
+		gollem.WithToolMiddleware(auditToolMiddleware),
+		gollem.WithGuardrails(gollem.NewPIIGuardrail(gollem.GuardrailRedact)),
+		gollem.WithBudget(1.5),
+		gollem.WithTokenBudget(10000),
+		gollem.WithLoopLimit(8),
+	)
+
+	desc, err := agent.Describe(t.Context())
+	gt.NoError(t, err)
+
+	gt.Equal(t, "test-model", desc.Model)
+	gt.Equal(t, "Use the key [REDACTED] for the API", desc.SystemPrompt)
+	gt.Equal(t, 8, desc.LoopLimit)
+	gt.Equal(t, []string{"pii"}, desc.Guardrails)
+	gt.Equal(t, &gollem.BudgetDescription{MaxUSD: 1.5, MaxTokens: 10000}, desc.Budget)
+	gt.Equal(t, []string{"compacter.NewContentBlockMiddleware"}, desc.Middlewares.ContentBlock)
+	gt.Equal(t, []string{"gollem_test.auditToolMiddleware"}, desc.Middlewares.Tool)
+
+	names := make([]string, len(desc.Tools))
+	for i, spec := range desc.Tools {
+		names[i] = spec.Name
+	}
+	gt.Equal(t, []string{"mcp_search", "read_file", "write_file"}, names)
+	gt.Equal[any](t, gollem.RedactedValue, desc.Tools[1].Parameters["token"].Default)
+	gt.Equal[any](t, "all", desc.Tools[1].Parameters["query"].Default)
+
+	raw, err := json.Marshal(desc)
+	gt.NoError(t, err)
+	gt.S(t, string(raw)).NotContains("sk-")
+
+	t.Run("flags of context", func(t *testing.T) {
+		desc, err := agent.Describe(gollem.ContextWithFlags(t.Context(), gollem.Flags{"beta": true}))
+		gt.NoError(t, err)
+		gt.A(t, desc.Tools).Length(4)
+		gt.True(t, desc.Flags["beta"])
+	})
+
+	t.Run("agent is not modified", func(t *testing.T) {
+		var generated bool
+		client.NewSessionFunc = func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			generated = true
+			return nil, nil
+		}
+		_, err := agent.Describe(t.Context())
+		gt.NoError(t, err)
+		gt.False(t, generated)
+		gt.Nil(t, agent.Session())
+	})
+}
@@ -31,6 +31,13 @@ var (
 	// ErrHistoryVersionMismatch is returned when the history version is invalid or unsupported.
 	ErrHistoryVersionMismatch = errors.New("history version mismatch")
 
+	// ErrExecuteResponseVersionMismatch is returned when the version of a serialized
+	// ExecuteResponse is unsupported.
+	ErrExecuteResponseVersionMismatch = errors.New("execute response version mismatch")
+
+	// ErrBlobNotFound is returned when a blob is not stored in a BlobStore.
+	ErrBlobNotFound = errors.New("blob not found")
+
 	// ErrExitConversation is returned when a tool signals that the conversation should be exited.
 	// This error is treated as a successful completion of the conversation loop.
 	ErrExitConversation = errors.New("exit conversation")
@@ -55,13 +62,69 @@ var (
 	// ErrProhibitedContent is returned when the content violates policy
 	ErrProhibitedContent = errors.New("prohibited content")
 
+	// ErrResponseSchemaViolation is returned when a JSON response still violates the response
+	// schema after repairs, e.g. by GenerateStruct.
+	ErrResponseSchemaViolation = errors.New("response schema violation")
+
 	// ErrToolArgsValidation is returned when the tool arguments from LLM fail validation.
 	// This is distinct from ErrInvalidParameter which is for spec definition validation.
 	ErrToolArgsValidation = errors.New("tool arguments validation failed")
 
+	// ErrBudgetExceeded is returned when the cost or tokens of an execution exceed the budget.
+	ErrBudgetExceeded = errors.New("budget exceeded")
+
+	// ErrToolTimeout is returned when a tool execution exceeds ToolSpec.Timeout.
+	ErrToolTimeout = errors.New("tool execution timed out")
+
 	// ErrSubAgentFactory is returned when the subagent factory fails to create an agent.
 	ErrSubAgentFactory = errors.New("subagent factory failed")
 
+	// ErrInvalidSkill is returned when skills of WithSkills are invalid, e.g. a skill requires a
+	// tool that the agent does not have.
+	ErrInvalidSkill = errors.New("invalid skill")
+
+	// ErrToolCallDeferred is the error of a call of DeferredTool seen by tool middleware. The
+	// call is not failed; its result is posted later by Agent.CompleteToolCall.
+	ErrToolCallDeferred = errors.New("tool call deferred")
+
+	// ErrExecutionPaused is returned by Execute and Resume when the execution is paused for
+	// calls of DeferredTool. See Agent.Paused.
+	ErrExecutionPaused = errors.New("execution paused")
+
+	// ErrToolCallNotFound is returned by Agent.CompleteToolCall when no call is pending with the
+	// handle.
+	ErrToolCallNotFound = errors.New("tool call not found")
+
+	// ErrGuardrailBlocked is wrapped by GuardrailError when a guardrail blocks a message.
+	ErrGuardrailBlocked = errors.New("blocked by guardrail")
+
+	// ErrToolDenied is the error of a tool call denied by a ToolPolicy, returned to the LLM as
+	// the result of the call.
+	ErrToolDenied = errors.New("tool call denied")
+
+	// ErrUnsupportedInput is returned by providers when an input is not supported by the
+	// provider or the model, e.g. a GIF image for Gemini. See WithModalityFallback.
+	ErrUnsupportedInput = errors.New("unsupported input")
+
+	// ErrToolNotFound is the error of a tool call for a tool that the agent does not have,
+	// returned to the LLM as the result of the call.
+	ErrToolNotFound = errors.New("tool not found")
+
+	// ErrStreamClosed is the cause of the canceled context of a Stream closed by the consumer.
+	ErrStreamClosed = errors.New("stream closed")
+
+	// ErrInvalidProfile is returned when an AgentProfile or its archive is invalid, e.g. a tool
+	// of the profile is not bound.
+	ErrInvalidProfile = errors.New("invalid agent profile")
+
+	// ErrContextWindowExceeded is returned when a request does not fit in the context window of
+	// WithContextWindowGuard. The error is a *ContextWindowExceededError with details.
+	ErrContextWindowExceeded = errors.New("context window exceeded")
+
 	// ErrTagTokenExceeded is a tag for errors caused by token limit exceeded
 	ErrTagTokenExceeded = goerr.NewTag("token_exceeded")
+
+	// ErrTagTransient is a tag for errors of LLM API calls that may succeed on retry, e.g.
+	// rate limits, overload and server errors. See IsTransientError.
+	ErrTagTransient = goerr.NewTag("transient")
 )
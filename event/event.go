@@ -0,0 +1,150 @@
+// Package event defines a stable, versioned JSON representation of gollem hook payloads
+// (conversation lifecycle, tool calls, plan changes and compaction) so that they can be
+// shipped to external systems such as Kafka or webhooks.
+//
+// Every event is wrapped in an Envelope that carries the schema version and event type.
+// Consumers should dispatch on Envelope.Type and decode Envelope.Data into the
+// corresponding payload type with Envelope.Decode.
+//
+// Compatibility policy: within the same SchemaVersion, fields are only ever added.
+// Renaming or removing a field, or changing its type, bumps SchemaVersion.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/internal/schema"
+)
+
+// SchemaVersion is the current version of the event schema.
+const SchemaVersion = 1
+
+// ErrUnsupportedVersion is returned when an envelope has a schema version that this package cannot decode.
+var ErrUnsupportedVersion = errors.New("unsupported event schema version")
+
+// ErrUnknownType is returned when the event type is not defined in this package.
+var ErrUnknownType = errors.New("unknown event type")
+
+// Type identifies the kind of payload carried by an Envelope.
+type Type string
+
+const (
+	TypeConversationStart Type = "conversation.start"
+	TypeConversationEnd   Type = "conversation.end"
+	TypeToolCall          Type = "tool.call"
+	TypePlanCreated       Type = "plan.created"
+	TypePlanUpdated       Type = "plan.updated"
+	TypeTaskDone          Type = "plan.task_done"
+	TypeCompaction        Type = "compaction"
+)
+
+// payloadTypes maps each event type to its payload type. It is used to validate the
+// type in New and to generate the JSON Schema in Schema.
+var payloadTypes = map[Type]any{
+	TypeConversationStart: ConversationStartData{},
+	TypeConversationEnd:   ConversationEndData{},
+	TypeToolCall:          ToolCallData{},
+	TypePlanCreated:       PlanData{},
+	TypePlanUpdated:       PlanData{},
+	TypeTaskDone:          TaskDoneData{},
+	TypeCompaction:        CompactionData{},
+}
+
+// Envelope is the versioned wrapper of an event payload.
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	ID            string          `json:"id"`
+	Type          Type            `json:"type"`
+	Time          time.Time       `json:"time"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// New creates a new Envelope with the given type and payload. The ID and time of the envelope
+// are taken by gollem.NewID and gollem.Now, so that they are deterministic with
+// gollem.ContextWithIDGenerator and gollem.ContextWithClock.
+func New(ctx context.Context, t Type, data any) (*Envelope, error) {
+	if _, ok := payloadTypes[t]; !ok {
+		return nil, goerr.Wrap(ErrUnknownType, "failed to create event", goerr.V("type", t))
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal event data", goerr.V("type", t))
+	}
+
+	return &Envelope{
+		SchemaVersion: SchemaVersion,
+		ID:            gollem.NewID(ctx),
+		Type:          t,
+		Time:          gollem.Now(ctx),
+		Data:          raw,
+	}, nil
+}
+
+// Marshal creates a new Envelope with the given type and payload and encodes it as JSON.
+func Marshal(ctx context.Context, t Type, data any) ([]byte, error) {
+	env, err := New(ctx, t, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// Unmarshal decodes an Envelope from JSON and validates its schema version.
+func Unmarshal(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal event envelope")
+	}
+	if env.SchemaVersion < 1 || env.SchemaVersion > SchemaVersion {
+		return nil, goerr.Wrap(ErrUnsupportedVersion, "failed to unmarshal event envelope",
+			goerr.V("got", env.SchemaVersion),
+			goerr.V("want", SchemaVersion),
+		)
+	}
+	return &env, nil
+}
+
+// Decode decodes the payload of the envelope into v.
+func (e *Envelope) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return goerr.Wrap(err, "failed to decode event data", goerr.V("type", e.Type))
+	}
+	return nil
+}
+
+// Types returns all event types defined in the current schema version.
+func Types() []Type {
+	return []Type{
+		TypeConversationStart,
+		TypeConversationEnd,
+		TypeToolCall,
+		TypePlanCreated,
+		TypePlanUpdated,
+		TypeTaskDone,
+		TypeCompaction,
+	}
+}
+
+// Schema returns the JSON Schema of the payload for the given event type.
+func Schema(t Type) (map[string]any, error) {
+	payload, ok := payloadTypes[t]
+	if !ok {
+		return nil, goerr.Wrap(ErrUnknownType, "failed to get event schema", goerr.V("type", t))
+	}
+
+	param, err := gollem.ToSchema(payload)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to generate event schema", goerr.V("type", t))
+	}
+	s := schema.ConvertParameterToJSONSchema(param)
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = string(t)
+	s["$id"] = "https://github.com/m-mizutani/gollem/event/v1/" + string(t)
+	return s, nil
+}
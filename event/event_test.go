@@ -0,0 +1,79 @@
+package event_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/event"
+	"github.com/m-mizutani/gt"
+)
+
+func TestEnvelope(t *testing.T) {
+	t.Run("marshal and unmarshal round trip", func(t *testing.T) {
+		data, err := event.Marshal(t.Context(), event.TypeToolCall, &event.ToolCallData{
+			CallID:   "call_1",
+			ToolName: "search",
+			Args:     map[string]any{"q": "gollem"},
+		})
+		gt.NoError(t, err)
+
+		env, err := event.Unmarshal(data)
+		gt.NoError(t, err)
+		gt.Equal(t, event.SchemaVersion, env.SchemaVersion)
+		gt.Equal(t, event.TypeToolCall, env.Type)
+		gt.NotEqual(t, "", env.ID)
+
+		var payload event.ToolCallData
+		gt.NoError(t, env.Decode(&payload))
+		gt.Equal(t, "search", payload.ToolName)
+		gt.Equal(t, "gollem", payload.Args["q"])
+	})
+
+	t.Run("ID and time are taken from the context", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		ctx := gollem.ContextWithIDGenerator(t.Context(), gollem.NewSequentialIDGenerator("event-"))
+		ctx = gollem.ContextWithClock(ctx, func() time.Time { return now })
+
+		env, err := event.New(ctx, event.TypeToolCall, &event.ToolCallData{CallID: "call_1"})
+		gt.NoError(t, err)
+		gt.Equal(t, "event-1", env.ID)
+		gt.Equal(t, now, env.Time)
+	})
+
+	t.Run("unknown type is rejected", func(t *testing.T) {
+		_, err := event.New(t.Context(), event.Type("unknown"), struct{}{})
+		gt.True(t, errors.Is(err, event.ErrUnknownType))
+	})
+
+	t.Run("newer schema version is rejected", func(t *testing.T) {
+		raw, err := json.Marshal(map[string]any{
+			"schema_version": event.SchemaVersion + 1,
+			"type":           event.TypeToolCall,
+			"data":           map[string]any{},
+		})
+		gt.NoError(t, err)
+
+		_, err = event.Unmarshal(raw)
+		gt.True(t, errors.Is(err, event.ErrUnsupportedVersion))
+	})
+}
+
+func TestSchema(t *testing.T) {
+	t.Run("all types have schema", func(t *testing.T) {
+		for _, typ := range event.Types() {
+			s, err := event.Schema(typ)
+			gt.NoError(t, err)
+			gt.Equal(t, "object", s["type"].(string))
+			gt.Equal(t, string(typ), s["title"].(string))
+		}
+	})
+
+	t.Run("required fields are listed", func(t *testing.T) {
+		s, err := event.Schema(event.TypeToolCall)
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"tool_name"}, s["required"].([]string))
+	})
+}
@@ -0,0 +1,245 @@
+package event
+
+import (
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+)
+
+// ConversationConfigData is the JSON representation of gollem.ConversationConfig.
+type ConversationConfigData struct {
+	SystemPrompt string          `json:"system_prompt,omitempty"`
+	LoopLimit    int             `json:"loop_limit"`
+	ResponseMode string          `json:"response_mode"`
+	ContentType  string          `json:"content_type,omitempty"`
+	Strategy     string          `json:"strategy,omitempty"`
+	ToolNames    []string        `json:"tool_names"`
+	Flags        map[string]bool `json:"flags,omitempty"`
+}
+
+// ConversationStartData is the payload of TypeConversationStart.
+type ConversationStartData struct {
+	ExecID string                 `json:"exec_id" required:"true"`
+	Inputs []string               `json:"inputs"`
+	Config ConversationConfigData `json:"config"`
+}
+
+// ConversationEndData is the payload of TypeConversationEnd.
+type ConversationEndData struct {
+	ExecID      string   `json:"exec_id" required:"true"`
+	Texts       []string `json:"texts,omitempty"`
+	InputToken  int      `json:"input_token"`
+	OutputToken int      `json:"output_token"`
+	DurationMS  int64    `json:"duration_ms"`
+	Error       string   `json:"error,omitempty"`
+
+	Cancellation *CancellationData `json:"cancellation,omitempty"`
+}
+
+// CancellationData is the JSON representation of gollem.CancellationInfo.
+type CancellationData struct {
+	Reason    string `json:"reason" enum:"canceled,deadline_exceeded,budget_exceeded,loop_limit,hook_rejected"`
+	Initiator string `json:"initiator" enum:"caller,agent,parent,hook"`
+	Phase     string `json:"phase" enum:"init,strategy,llm_call,tool_call,finalize"`
+	Iteration int    `json:"iteration"`
+	Cause     string `json:"cause,omitempty"`
+}
+
+// ToolCallData is the payload of TypeToolCall.
+type ToolCallData struct {
+	CallID     string         `json:"call_id"`
+	ToolName   string         `json:"tool_name" required:"true"`
+	Args       map[string]any `json:"args,omitempty"`
+	Result     map[string]any `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	DurationMS int64          `json:"duration_ms"`
+}
+
+// TaskData is the JSON representation of planexec.Task.
+type TaskData struct {
+	ID          string `json:"id" required:"true"`
+	Description string `json:"description"`
+	State       string `json:"state" enum:"pending,in_progress,completed,skipped"`
+	Result      string `json:"result,omitempty"`
+}
+
+// PlanData is the payload of TypePlanCreated and TypePlanUpdated.
+type PlanData struct {
+	UserQuestion string     `json:"user_question,omitempty"`
+	UserIntent   string     `json:"user_intent,omitempty"`
+	Goal         string     `json:"goal,omitempty"`
+	Tasks        []TaskData `json:"tasks"`
+}
+
+// TaskDoneData is the payload of TypeTaskDone.
+type TaskDoneData struct {
+	Goal string   `json:"goal,omitempty"`
+	Task TaskData `json:"task"`
+}
+
+// CompactionData is the payload of TypeCompaction.
+type CompactionData struct {
+	OriginalDataSize  int    `json:"original_data_size"`
+	CompactedDataSize int    `json:"compacted_data_size"`
+	InputTokens       int    `json:"input_tokens"`
+	OutputTokens      int    `json:"output_tokens"`
+	Summary           string `json:"summary"`
+	Attempt           int    `json:"attempt"`
+
+	Decision *CompactionDecisionData `json:"decision,omitempty"`
+}
+
+// CompactionDecisionData is the JSON representation of compacter.CompactionDecision.
+type CompactionDecisionData struct {
+	Trigger           string  `json:"trigger" enum:"token_limit,rolling"`
+	Emergency         bool    `json:"emergency"`
+	Reason            string  `json:"reason"`
+	Messages          int     `json:"messages"`
+	Tokens            int     `json:"tokens"`
+	Turns             int     `json:"turns,omitempty"`
+	TurnThreshold     int     `json:"turn_threshold,omitempty"`
+	CompactRatio      float64 `json:"compact_ratio,omitempty"`
+	LimitError        string  `json:"limit_error,omitempty"`
+	CompactedMessages int     `json:"compacted_messages"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// NewConversationStartData converts gollem.ConversationStartEvent to its JSON payload.
+func NewConversationStartData(ev *gollem.ConversationStartEvent) *ConversationStartData {
+	inputs := make([]string, len(ev.Inputs))
+	for i, in := range ev.Inputs {
+		inputs[i] = in.String()
+	}
+
+	toolNames := ev.Config.ToolNames
+	if toolNames == nil {
+		toolNames = []string{}
+	}
+
+	return &ConversationStartData{
+		ExecID: ev.ExecID,
+		Inputs: inputs,
+		Config: ConversationConfigData{
+			SystemPrompt: ev.Config.SystemPrompt,
+			LoopLimit:    ev.Config.LoopLimit,
+			ResponseMode: string(ev.Config.ResponseMode),
+			ContentType:  string(ev.Config.ContentType),
+			Strategy:     ev.Config.Strategy,
+			ToolNames:    toolNames,
+			Flags:        ev.Config.Flags,
+		},
+	}
+}
+
+// NewConversationEndData converts gollem.ConversationEndEvent to its JSON payload.
+func NewConversationEndData(ev *gollem.ConversationEndEvent) *ConversationEndData {
+	data := &ConversationEndData{
+		ExecID:      ev.ExecID,
+		InputToken:  ev.InputToken,
+		OutputToken: ev.OutputToken,
+		DurationMS:  ev.Duration.Milliseconds(),
+		Error:       errorString(ev.Error),
+	}
+	if ev.Response != nil {
+		data.Texts = ev.Response.Texts
+	}
+	if c := ev.Cancellation; c != nil {
+		data.Cancellation = &CancellationData{
+			Reason:    string(c.Reason),
+			Initiator: string(c.Initiator),
+			Phase:     string(c.Phase),
+			Iteration: c.Iteration,
+			Cause:     errorString(c.Cause),
+		}
+	}
+	return data
+}
+
+// NewToolCallData converts a tool execution request/response pair observed by a
+// gollem.ToolMiddleware to its JSON payload. resp may be nil if the handler failed.
+func NewToolCallData(req *gollem.ToolExecRequest, resp *gollem.ToolExecResponse, err error) *ToolCallData {
+	data := &ToolCallData{}
+	if req != nil && req.Tool != nil {
+		data.CallID = req.Tool.ID
+		data.ToolName = req.Tool.Name
+		data.Args = req.Tool.Arguments
+		if req.ToolSpec != nil {
+			data.Args = req.ToolSpec.RedactArgs(req.Tool.Arguments)
+		}
+	}
+	if resp != nil {
+		data.Result = resp.Result
+		data.DurationMS = resp.Duration
+		if err == nil {
+			err = resp.Error
+		}
+	}
+	data.Error = errorString(err)
+	return data
+}
+
+// NewTaskData converts planexec.Task to its JSON payload.
+func NewTaskData(task *planexec.Task) TaskData {
+	return TaskData{
+		ID:          task.ID,
+		Description: task.Description,
+		State:       string(task.State),
+		Result:      task.Result,
+	}
+}
+
+// NewPlanData converts planexec.Plan to its JSON payload.
+func NewPlanData(plan *planexec.Plan) *PlanData {
+	tasks := make([]TaskData, len(plan.Tasks))
+	for i := range plan.Tasks {
+		tasks[i] = NewTaskData(&plan.Tasks[i])
+	}
+	return &PlanData{
+		UserQuestion: plan.UserQuestion,
+		UserIntent:   plan.UserIntent,
+		Goal:         plan.Goal,
+		Tasks:        tasks,
+	}
+}
+
+// NewTaskDoneData converts a finished planexec.Task to its JSON payload.
+func NewTaskDoneData(plan *planexec.Plan, task *planexec.Task) *TaskDoneData {
+	data := &TaskDoneData{Task: NewTaskData(task)}
+	if plan != nil {
+		data.Goal = plan.Goal
+	}
+	return data
+}
+
+// NewCompactionData converts compacter.CompactionEvent to its JSON payload.
+func NewCompactionData(ev *compacter.CompactionEvent) *CompactionData {
+	data := &CompactionData{
+		OriginalDataSize:  ev.OriginalDataSize,
+		CompactedDataSize: ev.CompactedDataSize,
+		InputTokens:       ev.InputTokens,
+		OutputTokens:      ev.OutputTokens,
+		Summary:           ev.Summary,
+		Attempt:           ev.Attempt,
+	}
+	if d := ev.Decision; d != nil {
+		data.Decision = &CompactionDecisionData{
+			Trigger:           string(d.Trigger),
+			Emergency:         d.Emergency,
+			Reason:            d.Reason,
+			Messages:          d.Messages,
+			Tokens:            d.Tokens,
+			Turns:             d.Turns,
+			TurnThreshold:     d.TurnThreshold,
+			CompactRatio:      d.CompactRatio,
+			LimitError:        d.LimitError,
+			CompactedMessages: d.CompactedMessages,
+		}
+	}
+	return data
+}
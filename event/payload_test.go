@@ -0,0 +1,135 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/event"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestConversationData(t *testing.T) {
+	start := event.NewConversationStartData(&gollem.ConversationStartEvent{
+		ExecID: "exec-1",
+		Inputs: []gollem.Input{gollem.Text("hello")},
+		Config: gollem.ConversationConfig{
+			LoopLimit:    8,
+			ResponseMode: gollem.ResponseModeBlocking,
+		},
+	})
+	gt.Equal(t, "exec-1", start.ExecID)
+	gt.Equal(t, []string{"hello"}, start.Inputs)
+	gt.Equal(t, "blocking", start.Config.ResponseMode)
+	gt.Equal(t, []string{}, start.Config.ToolNames)
+
+	end := event.NewConversationEndData(&gollem.ConversationEndEvent{
+		ExecID:   "exec-1",
+		Response: gollem.NewExecuteResponse("answer"),
+		Duration: 1500 * time.Millisecond,
+		Error:    errors.New("boom"),
+	})
+	gt.Equal(t, []string{"answer"}, end.Texts)
+	gt.Equal(t, int64(1500), end.DurationMS)
+	gt.Equal(t, "boom", end.Error)
+	gt.Nil(t, end.Cancellation)
+
+	canceled := event.NewConversationEndData(&gollem.ConversationEndEvent{
+		ExecID: "exec-2",
+		Error:  context.Canceled,
+		Cancellation: &gollem.CancellationInfo{
+			Reason:    gollem.CancellationReasonCanceled,
+			Initiator: gollem.CancellationInitiatorCaller,
+			Phase:     gollem.ExecutePhaseToolCall,
+			Iteration: 2,
+			Cause:     errors.New("user pressed stop"),
+		},
+	})
+	gt.Equal(t, &event.CancellationData{
+		Reason:    "canceled",
+		Initiator: "caller",
+		Phase:     "tool_call",
+		Iteration: 2,
+		Cause:     "user pressed stop",
+	}, canceled.Cancellation)
+}
+
+func TestToolCallData(t *testing.T) {
+	req := &gollem.ToolExecRequest{
+		Tool: &gollem.FunctionCall{ID: "c1", Name: "search", Arguments: map[string]any{"q": "x"}},
+	}
+
+	t.Run("tool error is taken from response", func(t *testing.T) {
+		data := event.NewToolCallData(req, &gollem.ToolExecResponse{
+			Error:    errors.New("not found"),
+			Duration: 12,
+		}, nil)
+		gt.Equal(t, "c1", data.CallID)
+		gt.Equal(t, "not found", data.Error)
+		gt.Equal(t, int64(12), data.DurationMS)
+	})
+
+	t.Run("handler error without response", func(t *testing.T) {
+		data := event.NewToolCallData(req, nil, errors.New("handler failed"))
+		gt.Equal(t, "handler failed", data.Error)
+	})
+
+	t.Run("sensitive arguments are masked", func(t *testing.T) {
+		data := event.NewToolCallData(&gollem.ToolExecRequest{
+			Tool: &gollem.FunctionCall{ID: "c2", Name: "login", Arguments: map[string]any{"user": "alice", "password": "hunter2"}},
+			ToolSpec: &gollem.ToolSpec{Name: "login", Parameters: map[string]*gollem.Parameter{
+				"user":     {Type: gollem.TypeString},
+				"password": {Type: gollem.TypeString, Sensitive: true},
+			}},
+		}, &gollem.ToolExecResponse{}, nil)
+		gt.Equal(t, map[string]any{"user": "alice", "password": gollem.RedactedValue}, data.Args)
+	})
+}
+
+func TestPlanData(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "find answer",
+		Tasks: []planexec.Task{
+			{ID: "t1", Description: "search", State: planexec.TaskStateCompleted, Result: "found"},
+			{ID: "t2", Description: "verify", State: planexec.TaskStatePending},
+		},
+	}
+
+	data := event.NewPlanData(plan)
+	gt.Equal(t, "find answer", data.Goal)
+	gt.A(t, data.Tasks).Length(2)
+	gt.Equal(t, "completed", data.Tasks[0].State)
+
+	done := event.NewTaskDoneData(plan, &plan.Tasks[0])
+	gt.Equal(t, "t1", done.Task.ID)
+	gt.Equal(t, "found", done.Task.Result)
+}
+
+func TestCompactionData(t *testing.T) {
+	data := event.NewCompactionData(&compacter.CompactionEvent{
+		OriginalDataSize:  100,
+		CompactedDataSize: 30,
+		Attempt:           1,
+	})
+	gt.Equal(t, 100, data.OriginalDataSize)
+	gt.Equal(t, 30, data.CompactedDataSize)
+	gt.Equal(t, 1, data.Attempt)
+	gt.Nil(t, data.Decision)
+
+	data = event.NewCompactionData(&compacter.CompactionEvent{
+		Decision: &compacter.CompactionDecision{
+			Trigger:   compacter.TriggerTokenLimit,
+			Emergency: true,
+			Compacted: true,
+			Reason:    "token limit exceeded",
+			Tokens:    1200,
+		},
+	})
+	gt.Equal(t, "token_limit", data.Decision.Trigger)
+	gt.True(t, data.Decision.Emergency)
+	gt.Equal(t, 1200, data.Decision.Tokens)
+}
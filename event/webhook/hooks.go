@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/event"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+)
+
+// WithEventWebhook returns an agent option that forwards conversation and tool call events
+// to url. Use New and Publisher.AgentOption instead if plan or compaction events should be
+// forwarded too, because those hooks are configured on the strategy and the middleware, or if
+// the delivery worker should be stopped by Close.
+func WithEventWebhook(url string, opts ...Option) gollem.Option {
+	return New(url, opts...).AgentOption()
+}
+
+// AgentOption returns an agent option that publishes conversation start/end and tool call
+// events. Queued events are flushed when the conversation ends, waiting up to the timeout of
+// WithFlushTimeout.
+func (p *Publisher) AgentOption() gollem.Option {
+	return gollem.WithOptions(
+		gollem.WithConversationStartHook(p.onConversationStart),
+		gollem.WithConversationEndHook(p.onConversationEnd),
+		gollem.WithToolMiddleware(p.toolMiddleware),
+	)
+}
+
+// CompactionHook returns a hook for compacter.WithCompactionHook that publishes compaction events.
+func (p *Publisher) CompactionHook() compacter.CompactionHook {
+	return func(ctx context.Context, ev *compacter.CompactionEvent) {
+		p.publish(ctx, event.TypeCompaction, event.NewCompactionData(ev))
+	}
+}
+
+// OnPlanCreated implements planexec.PlanExecuteHooks.
+func (p *Publisher) OnPlanCreated(ctx context.Context, plan *planexec.Plan) error {
+	p.publish(ctx, event.TypePlanCreated, event.NewPlanData(plan))
+	return nil
+}
+
+// OnPlanUpdated implements planexec.PlanExecuteHooks.
+func (p *Publisher) OnPlanUpdated(ctx context.Context, plan *planexec.Plan) error {
+	p.publish(ctx, event.TypePlanUpdated, event.NewPlanData(plan))
+	return nil
+}
+
+// OnTaskDone implements planexec.PlanExecuteHooks.
+func (p *Publisher) OnTaskDone(ctx context.Context, plan *planexec.Plan, task *planexec.Task) error {
+	p.publish(ctx, event.TypeTaskDone, event.NewTaskDoneData(plan, task))
+	return nil
+}
+
+var _ planexec.PlanExecuteHooks = (*Publisher)(nil)
+
+func (p *Publisher) onConversationStart(ctx context.Context, ev *gollem.ConversationStartEvent) error {
+	p.publish(ctx, event.TypeConversationStart, event.NewConversationStartData(ev))
+	return nil
+}
+
+func (p *Publisher) onConversationEnd(ctx context.Context, ev *gollem.ConversationEndEvent) {
+	// Deliver the remaining events even if the execution was canceled.
+	ctx = context.WithoutCancel(ctx)
+	p.publish(ctx, event.TypeConversationEnd, event.NewConversationEndData(ev))
+	if p.flushTimeout <= 0 {
+		return
+	}
+
+	// Execute must not wait for a slow endpoint; Close drains what is left.
+	ctx, cancel := context.WithTimeout(ctx, p.flushTimeout)
+	defer cancel()
+	if err := p.Flush(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			p.logger.Debug("webhook events are still being delivered", "timeout", p.flushTimeout)
+			return
+		}
+		p.logger.Warn("failed to flush webhook events", "error", err)
+	}
+}
+
+func (p *Publisher) toolMiddleware(next gollem.ToolHandler) gollem.ToolHandler {
+	return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+		resp, err := next(ctx, req)
+		p.publish(ctx, event.TypeToolCall, event.NewToolCallData(req, resp, err))
+		return resp, err
+	}
+}
+
+// publish queues an event from a hook. Dropped events must not break the agent, so they are
+// only logged.
+func (p *Publisher) publish(ctx context.Context, t event.Type, data any) {
+	if err := p.Publish(ctx, t, data); err != nil {
+		p.logger.Warn("failed to publish webhook event", "type", t, "error", err)
+	}
+}
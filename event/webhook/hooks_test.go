@@ -0,0 +1,137 @@
+package webhook_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/event"
+	"github.com/m-mizutani/gollem/event/webhook"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestWithEventWebhook(t *testing.T) {
+	r, srv := newReceiver(t)
+
+	calls := 0
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					if calls == 1 {
+						return &gollem.Response{
+							FunctionCalls: []*gollem.FunctionCall{
+								{ID: "call_1", Name: "echo", Arguments: map[string]any{"msg": "hi"}},
+							},
+						}, nil
+					}
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+				AppendHistoryFunc: func(*gollem.History) error { return nil },
+			}, nil
+		},
+	}
+
+	tool := &mock.ToolMock{
+		SpecFunc: func() gollem.ToolSpec {
+			return gollem.ToolSpec{Name: "echo", Description: "echo"}
+		},
+		RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return args, nil
+		},
+	}
+
+	agent := gollem.New(client,
+		gollem.WithTools(tool),
+		webhook.WithEventWebhook(srv.URL),
+	)
+	_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+
+	// All events fit in one batch and are flushed at the end of the conversation.
+	gt.A(t, r.batches).Length(1)
+	events := r.batches[0].Events
+	gt.A(t, events).Length(3)
+	gt.Equal(t, event.TypeConversationStart, events[0].Type)
+	gt.Equal(t, event.TypeToolCall, events[1].Type)
+	gt.Equal(t, event.TypeConversationEnd, events[2].Type)
+
+	var toolCall event.ToolCallData
+	gt.NoError(t, events[1].Decode(&toolCall))
+	gt.Equal(t, "echo", toolCall.ToolName)
+	gt.Equal(t, "call_1", toolCall.CallID)
+	gt.Equal(t, "hi", toolCall.Result["msg"].(string))
+}
+
+func TestPublisherPlanHooks(t *testing.T) {
+	r, srv := newReceiver(t)
+	p := webhook.New(srv.URL)
+
+	plan := &planexec.Plan{
+		Goal: "goal",
+		Tasks: []planexec.Task{
+			{ID: "t1", Description: "first", State: planexec.TaskStateCompleted, Result: "ok"},
+		},
+	}
+	gt.NoError(t, p.OnPlanCreated(t.Context(), plan))
+	gt.NoError(t, p.OnTaskDone(t.Context(), plan, &plan.Tasks[0]))
+	gt.NoError(t, p.Flush(t.Context()))
+
+	gt.A(t, r.batches).Length(1)
+	gt.A(t, r.batches[0].Events).Length(2)
+
+	var done event.TaskDoneData
+	gt.NoError(t, r.batches[0].Events[1].Decode(&done))
+	gt.Equal(t, "t1", done.Task.ID)
+	gt.Equal(t, "goal", done.Goal)
+}
+
+func TestWithEventWebhookDoesNotWaitForSlowEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		received <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+				AppendHistoryFunc: func(*gollem.History) error { return nil },
+			}, nil
+		},
+	}
+
+	p := webhook.New(srv.URL, webhook.WithFlushTimeout(10*time.Millisecond))
+	agent := gollem.New(client, p.AgentOption())
+
+	start := time.Now()
+	_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.True(t, time.Since(start) < time.Second)
+
+	// The events are still delivered, and Close waits for them.
+	close(release)
+	gt.NoError(t, p.Close(t.Context()))
+	select {
+	case <-received:
+	default:
+		t.Fatal("events are not delivered")
+	}
+}
@@ -0,0 +1,408 @@
+// Package webhook forwards gollem events to an HTTP endpoint so that non-Go systems can
+// observe agent activity. Events are encoded with the versioned schema of the event
+// package, batched, signed with HMAC-SHA256 and retried on transient failures. Delivery runs in
+// a background worker, so a slow or down endpoint does not slow down the agent.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/event"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of the request body in the form "sha256=<hex>".
+	SignatureHeader = "X-Gollem-Signature"
+
+	// EventCountHeader carries the number of events in the request body.
+	EventCountHeader = "X-Gollem-Event-Count"
+
+	// DefaultBatchSize is the default number of events sent in one request.
+	DefaultBatchSize = 10
+
+	// DefaultMaxRetries is the default number of retries for a failed delivery.
+	DefaultMaxRetries = 3
+
+	// DefaultRetryInterval is the default initial interval between retries. It doubles on each retry.
+	DefaultRetryInterval = time.Second
+
+	// DefaultQueueSize is the default number of events queued for delivery.
+	DefaultQueueSize = 1000
+
+	// DefaultFlushTimeout is the default time the conversation end hook waits for delivery.
+	DefaultFlushTimeout = time.Second
+)
+
+var (
+	// ErrDeliveryFailed is returned when events could not be delivered to the webhook endpoint.
+	ErrDeliveryFailed = errors.New("webhook delivery failed")
+
+	// ErrQueueFull is returned when an event is dropped because the delivery queue is full.
+	ErrQueueFull = errors.New("webhook queue is full")
+
+	// ErrClosed is returned when an event is published after Close.
+	ErrClosed = errors.New("webhook publisher is closed")
+)
+
+// Batch is the request body sent to the webhook endpoint.
+type Batch struct {
+	Events []*event.Envelope `json:"events"`
+}
+
+// Publisher queues events and sends them to a webhook endpoint from a background worker. Call
+// Close when the publisher is no longer used to deliver the remaining events and stop the worker.
+type Publisher struct {
+	url           string
+	secret        []byte
+	client        *http.Client
+	types         map[event.Type]struct{}
+	headers       map[string]string
+	batchSize     int
+	maxRetries    int
+	retryInterval time.Duration
+	queueSize     int
+	flushTimeout  time.Duration
+	logger        *slog.Logger
+
+	// closeMu guards sending to queue against closing it
+	closeMu sync.RWMutex
+	closed  bool
+	queue   chan item
+	dropped atomic.Int64
+
+	// ctx cancels deliveries of the worker
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// buffer and failed are owned by the worker
+	buffer []*event.Envelope
+	failed error
+}
+
+// item is an event to deliver, or a flush request if flush is set.
+type item struct {
+	env   *event.Envelope
+	flush chan error
+}
+
+// Option is the type for the options of Publisher.
+type Option func(*Publisher)
+
+// WithSecret sets the secret used to sign request bodies. If not set, requests are not signed.
+func WithSecret(secret string) Option {
+	return func(p *Publisher) {
+		p.secret = []byte(secret)
+	}
+}
+
+// WithEvents restricts the forwarded events to the given types. Default is all types.
+func WithEvents(types ...event.Type) Option {
+	return func(p *Publisher) {
+		p.types = make(map[event.Type]struct{}, len(types))
+		for _, t := range types {
+			p.types[t] = struct{}{}
+		}
+	}
+}
+
+// WithBatchSize sets the number of events sent in one request. Default is DefaultBatchSize.
+// Buffered events are also sent when the conversation ends (see WithFlushTimeout) or Flush or
+// Close is called.
+func WithBatchSize(size int) Option {
+	return func(p *Publisher) {
+		p.batchSize = size
+	}
+}
+
+// WithMaxRetries sets the maximum number of retries for a failed delivery. Default is DefaultMaxRetries.
+func WithMaxRetries(maxRetries int) Option {
+	return func(p *Publisher) {
+		p.maxRetries = maxRetries
+	}
+}
+
+// WithRetryInterval sets the initial interval between retries. Default is DefaultRetryInterval.
+func WithRetryInterval(interval time.Duration) Option {
+	return func(p *Publisher) {
+		p.retryInterval = interval
+	}
+}
+
+// WithQueueSize sets the number of events queued for delivery. Events published while the queue
+// is full are dropped and counted by Dropped. Default is DefaultQueueSize.
+func WithQueueSize(size int) Option {
+	return func(p *Publisher) {
+		p.queueSize = size
+	}
+}
+
+// WithFlushTimeout sets how long the conversation end hook waits for the queued events to be
+// delivered. The hook runs before Execute returns, so a slow or down endpoint delays Execute by
+// at most timeout; events not delivered by then are still sent in the background, and Close
+// waits for all of them. If timeout is 0 or less, the hook does not flush, and buffered events
+// are sent when a batch fills or Flush or Close is called. Default is DefaultFlushTimeout.
+func WithFlushTimeout(timeout time.Duration) Option {
+	return func(p *Publisher) {
+		p.flushTimeout = timeout
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Publisher) {
+		p.client = client
+	}
+}
+
+// WithHeader adds a header to every request, e.g. for authentication.
+func WithHeader(key, value string) Option {
+	return func(p *Publisher) {
+		p.headers[key] = value
+	}
+}
+
+// WithLogger sets the logger used to report delivery failures from hooks. Default is discard logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Publisher) {
+		p.logger = logger
+	}
+}
+
+// New creates a new Publisher that sends events to url, and starts its delivery worker.
+func New(url string, opts ...Option) *Publisher {
+	p := &Publisher{
+		url:           url,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		headers:       make(map[string]string),
+		batchSize:     DefaultBatchSize,
+		maxRetries:    DefaultMaxRetries,
+		retryInterval: DefaultRetryInterval,
+		queueSize:     DefaultQueueSize,
+		flushTimeout:  DefaultFlushTimeout,
+		logger:        slog.New(slog.DiscardHandler),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.batchSize < 1 {
+		p.batchSize = 1
+	}
+	if p.queueSize < 1 {
+		p.queueSize = 1
+	}
+
+	p.queue = make(chan item, p.queueSize)
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	go p.run()
+	return p
+}
+
+// Publish queues an event for delivery without waiting for it. Events whose type is not
+// selected by WithEvents are ignored. If the queue is full, the event is dropped and ErrQueueFull
+// is returned. Delivery failures are logged and returned by Flush.
+func (p *Publisher) Publish(ctx context.Context, t event.Type, data any) error {
+	if p.types != nil {
+		if _, ok := p.types[t]; !ok {
+			return nil
+		}
+	}
+
+	env, err := event.New(ctx, t, data)
+	if err != nil {
+		return err
+	}
+
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+	if p.closed {
+		return goerr.Wrap(ErrClosed, "failed to publish webhook event", goerr.V("type", t))
+	}
+
+	select {
+	case p.queue <- item{env: env}:
+		return nil
+	default:
+		dropped := p.dropped.Add(1)
+		return goerr.Wrap(ErrQueueFull, "webhook event is dropped", goerr.V("type", t), goerr.V("dropped", dropped))
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full.
+func (p *Publisher) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Flush waits until the events published before it are delivered, and sends the buffered ones.
+// It returns ErrDeliveryFailed if any delivery failed since the previous Flush.
+func (p *Publisher) Flush(ctx context.Context) error {
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+	if p.closed {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	select {
+	case p.queue <- item{flush: done}:
+	case <-ctx.Done():
+		return goerr.Wrap(ctx.Err(), "webhook flush canceled", goerr.V("url", p.url))
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return goerr.Wrap(ctx.Err(), "webhook flush canceled", goerr.V("url", p.url))
+	}
+}
+
+// Close delivers the queued events and stops the worker. If ctx is done first, the remaining
+// deliveries are abandoned. It returns ErrDeliveryFailed if any delivery failed since the
+// previous Flush.
+func (p *Publisher) Close(ctx context.Context) error {
+	p.closeMu.Lock()
+	if p.closed {
+		p.closeMu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.queue)
+	p.closeMu.Unlock()
+
+	defer p.cancel()
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		p.cancel()
+		<-p.done
+		return goerr.Wrap(ctx.Err(), "webhook close canceled", goerr.V("url", p.url))
+	}
+	return p.failed
+}
+
+// run is the delivery worker. It batches queued events and sends them with retries.
+func (p *Publisher) run() {
+	defer close(p.done)
+	for it := range p.queue {
+		if it.flush != nil {
+			p.deliver()
+			it.flush <- p.failed
+			p.failed = nil
+			continue
+		}
+
+		p.buffer = append(p.buffer, it.env)
+		if len(p.buffer) >= p.batchSize {
+			p.deliver()
+		}
+	}
+	p.deliver()
+}
+
+// deliver sends the buffered events, and keeps the failure for Flush.
+func (p *Publisher) deliver() {
+	if len(p.buffer) == 0 {
+		return
+	}
+	batch := p.buffer
+	p.buffer = nil
+	if err := p.send(p.ctx, batch); err != nil {
+		p.logger.Warn("failed to deliver webhook events", "events", len(batch), "error", err)
+		p.failed = err
+	}
+}
+
+func (p *Publisher) send(ctx context.Context, events []*event.Envelope) error {
+	body, err := json.Marshal(Batch{Events: events})
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal webhook batch")
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= p.maxRetries; attempt++ {
+		if attempt > 0 {
+			wait := p.retryInterval << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return goerr.Wrap(ctx.Err(), "webhook delivery canceled", goerr.V("url", p.url))
+			case <-time.After(wait):
+			}
+		}
+
+		retryable, err := p.post(ctx, body, len(events))
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+
+	return goerr.Wrap(ErrDeliveryFailed, "failed to deliver events",
+		goerr.V("url", p.url),
+		goerr.V("cause", lastErr.Error()),
+		goerr.V("events", len(events)),
+	)
+}
+
+// post sends body once. It returns whether the failure is worth retrying.
+func (p *Publisher) post(ctx context.Context, body []byte, count int) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return false, goerr.Wrap(err, "failed to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventCountHeader, strconv.Itoa(count))
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	if len(p.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(p.secret, body))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, goerr.Wrap(err, "failed to send webhook request")
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, goerr.New("unexpected webhook response status", goerr.V("status", resp.StatusCode))
+}
+
+// Sign returns the signature of body in the form "sha256=<hex>".
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body. Receivers can use it to
+// authenticate requests with the value of SignatureHeader.
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
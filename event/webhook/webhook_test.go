@@ -0,0 +1,188 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem/event"
+	"github.com/m-mizutani/gollem/event/webhook"
+	"github.com/m-mizutani/gt"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	batches  []webhook.Batch
+	bodies   [][]byte
+	headers  []http.Header
+	statuses []int
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		gt.NoError(t, err)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status = r.statuses[0]
+			r.statuses = r.statuses[1:]
+		}
+		if status == http.StatusOK {
+			var batch webhook.Batch
+			gt.NoError(t, json.Unmarshal(body, &batch))
+			r.batches = append(r.batches, batch)
+			r.bodies = append(r.bodies, body)
+			r.headers = append(r.headers, req.Header.Clone())
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func TestPublisherBatching(t *testing.T) {
+	r, srv := newReceiver(t)
+	p := webhook.New(srv.URL, webhook.WithBatchSize(2))
+	data := &event.CompactionData{Summary: "s"}
+
+	gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, data))
+	gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, data))
+	gt.NoError(t, p.Flush(t.Context()))
+	gt.A(t, r.batches).Length(1)
+	gt.A(t, r.batches[0].Events).Length(2)
+	gt.Equal(t, "2", r.headers[0].Get(webhook.EventCountHeader))
+
+	gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, data))
+	gt.NoError(t, p.Flush(t.Context()))
+	gt.A(t, r.batches).Length(2)
+	gt.A(t, r.batches[1].Events).Length(1)
+
+	// Nothing is sent when the buffer is empty.
+	gt.NoError(t, p.Flush(t.Context()))
+	gt.A(t, r.batches).Length(2)
+}
+
+func TestPublisherSignature(t *testing.T) {
+	r, srv := newReceiver(t)
+	p := webhook.New(srv.URL,
+		webhook.WithBatchSize(1),
+		webhook.WithSecret("s3cret"),
+		webhook.WithHeader("Authorization", "Bearer token"),
+	)
+
+	gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, &event.CompactionData{}))
+	gt.NoError(t, p.Flush(t.Context()))
+	gt.A(t, r.bodies).Length(1)
+
+	sig := r.headers[0].Get(webhook.SignatureHeader)
+	gt.True(t, webhook.Verify([]byte("s3cret"), r.bodies[0], sig))
+	gt.False(t, webhook.Verify([]byte("other"), r.bodies[0], sig))
+	gt.Equal(t, "Bearer token", r.headers[0].Get("Authorization"))
+}
+
+func TestPublisherEventFilter(t *testing.T) {
+	r, srv := newReceiver(t)
+	p := webhook.New(srv.URL, webhook.WithEvents(event.TypeToolCall))
+
+	gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, &event.CompactionData{}))
+	gt.NoError(t, p.Publish(t.Context(), event.TypeToolCall, &event.ToolCallData{ToolName: "x"}))
+	gt.NoError(t, p.Flush(t.Context()))
+
+	gt.A(t, r.batches).Length(1)
+	gt.A(t, r.batches[0].Events).Length(1)
+	gt.Equal(t, event.TypeToolCall, r.batches[0].Events[0].Type)
+}
+
+func TestPublisherRetry(t *testing.T) {
+	t.Run("retries on server error", func(t *testing.T) {
+		r, srv := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+		p := webhook.New(srv.URL,
+			webhook.WithBatchSize(1),
+			webhook.WithRetryInterval(time.Millisecond),
+		)
+
+		gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, &event.CompactionData{}))
+		gt.NoError(t, p.Flush(t.Context()))
+		gt.A(t, r.batches).Length(1)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		_, srv := newReceiver(t, 500, 500, 500)
+		p := webhook.New(srv.URL,
+			webhook.WithBatchSize(1),
+			webhook.WithMaxRetries(2),
+			webhook.WithRetryInterval(time.Millisecond),
+		)
+
+		gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, &event.CompactionData{}))
+		err := p.Flush(t.Context())
+		gt.True(t, errors.Is(err, webhook.ErrDeliveryFailed))
+
+		// The failure is reported once
+		gt.NoError(t, p.Flush(t.Context()))
+	})
+
+	t.Run("does not retry on client error", func(t *testing.T) {
+		r, srv := newReceiver(t, http.StatusBadRequest)
+		p := webhook.New(srv.URL,
+			webhook.WithBatchSize(1),
+			webhook.WithRetryInterval(time.Millisecond),
+		)
+
+		gt.NoError(t, p.Publish(t.Context(), event.TypeCompaction, &event.CompactionData{}))
+		err := p.Flush(t.Context())
+		gt.True(t, errors.Is(err, webhook.ErrDeliveryFailed))
+		gt.A(t, r.statuses).Length(0)
+		gt.A(t, r.batches).Length(0)
+	})
+}
+
+func TestPublisherSlowEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var received int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		var batch webhook.Batch
+		gt.NoError(t, json.NewDecoder(req.Body).Decode(&batch))
+		mu.Lock()
+		received += len(batch.Events)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	p := webhook.New(srv.URL, webhook.WithBatchSize(1), webhook.WithQueueSize(2))
+
+	// Publishing does not wait for the blocked endpoint, and drops events beyond the queue
+	start := time.Now()
+	var dropped int
+	for range 10 {
+		if err := p.Publish(t.Context(), event.TypeCompaction, &event.CompactionData{}); err != nil {
+			gt.True(t, errors.Is(err, webhook.ErrQueueFull))
+			dropped++
+		}
+	}
+	gt.True(t, time.Since(start) < time.Second)
+	gt.N(t, dropped).Greater(0)
+	gt.Equal(t, int64(dropped), p.Dropped())
+
+	// Close delivers the queued events
+	close(release)
+	gt.NoError(t, p.Close(t.Context()))
+	mu.Lock()
+	defer mu.Unlock()
+	gt.Equal(t, 10-dropped, received)
+
+	err := p.Publish(t.Context(), event.TypeCompaction, &event.CompactionData{})
+	gt.True(t, errors.Is(err, webhook.ErrClosed))
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/openai"
 	"github.com/m-mizutani/gollem/mcp"
+	"github.com/m-mizutani/gollem/tui"
 )
 
 type MyTool struct{}
@@ -60,7 +61,7 @@ func main() {
 	mcpRemote, err := mcp.NewStreamableHTTP(ctx, "http://localhost:8080",
 		mcp.WithStreamableHTTPClientInfo("gollem-remote-client", "1.0.0"))
 	if err != nil {
-		fmt.Printf("⚠️  Could not connect to HTTP MCP server: %v\n", err)
+		fmt.Printf("Could not connect to HTTP MCP server: %v\n", err)
 		mcpRemote = nil
 	}
 	if mcpRemote != nil {
@@ -74,7 +75,7 @@ func main() {
 	mcpSSE, err := mcp.NewSSE(ctx, "http://localhost:8081",
 		mcp.WithSSEClientInfo("gollem-sse-client", "1.0.0"))
 	if err != nil {
-		fmt.Printf("⚠️  Could not connect to SSE MCP server: %v\n", err)
+		fmt.Printf("Could not connect to SSE MCP server: %v\n", err)
 		mcpSSE = nil
 	}
 	if mcpSSE != nil {
@@ -93,6 +94,9 @@ func main() {
 		toolSets = append(toolSets, mcpSSE)
 	}
 
+	// Render LLM output and tool activity in the terminal
+	ui := tui.New()
+
 	agent := gollem.New(client,
 		// Not only MCP servers,
 		gollem.WithToolSets(toolSets...),
@@ -100,10 +104,11 @@ func main() {
 		gollem.WithTools(&MyTool{}),
 		// System prompt for better context
 		gollem.WithSystemPrompt("You are a helpful assistant with access to various tools."),
+		ui.AgentOptions(),
 	)
 
-	fmt.Println("🚀 Gollem Agent started! Type 'quit' to exit.")
-	fmt.Println("💡 The agent automatically manages conversation history.")
+	fmt.Println("Gollem Agent started! Type 'quit' to exit.")
+	fmt.Println("The agent automatically manages conversation history.")
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
@@ -114,26 +119,24 @@ func main() {
 
 		input := scanner.Text()
 		if input == "quit" || input == "exit" {
-			fmt.Println("👋 Goodbye!")
+			fmt.Println("Goodbye!")
 			break
 		}
 
 		// Execute with automatic session management
 		// No need to manually handle history - it's managed automatically!
-		result, err := agent.Execute(ctx, gollem.Text(input))
+		err := ui.Run(ctx, func(ctx context.Context) error {
+			_, err := agent.Execute(ctx, gollem.Text(input))
+			return err
+		})
 		if err != nil {
-			fmt.Printf("❌ Error: %v\n", err)
+			fmt.Printf("Error: %v\n", err)
 			continue
 		}
 
-		// Display conclusion if available
-		if result != nil && !result.IsEmpty() {
-			fmt.Printf("💭 Conclusion: %s\n", result.String())
-		}
-
 		// Optional: Show conversation statistics
 		if history, err := agent.Session().History(); err == nil && history != nil {
-			fmt.Printf("📊 (Conversation has %d messages)\n", history.ToCount())
+			fmt.Printf("(Conversation has %d messages)\n", history.ToCount())
 		}
 	}
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/gemini"
+	"github.com/m-mizutani/gollem/tui"
 )
 
 // WeatherTool is a simple tool that returns weather information
@@ -66,17 +67,21 @@ func main() {
 		panic(err)
 	}
 
+	// Render streamed LLM output and tool activity in the terminal
+	ui := tui.New()
+
 	// Create agent with streaming response and tools
 	agent := gollem.New(client,
 		gollem.WithResponseMode(gollem.ResponseModeStreaming),
 		gollem.WithTools(&WeatherTool{}),
 		gollem.WithSystemPrompt("You are a helpful weather assistant. Use the weather tool to provide accurate weather information."),
+		ui.AgentOptions(),
 	)
 
-	fmt.Println("🌤️  Weather Chat Assistant")
-	fmt.Println("💡 Ask me about the weather in any city!")
-	fmt.Println("🔄 Conversation history is automatically managed")
-	fmt.Println("📝 Type 'quit' to exit")
+	fmt.Println("Weather Chat Assistant")
+	fmt.Println("Ask me about the weather in any city!")
+	fmt.Println("Conversation history is automatically managed")
+	fmt.Println("Type 'quit' to exit")
 	fmt.Println("")
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -88,7 +93,7 @@ func main() {
 
 		input := scanner.Text()
 		if input == "quit" || input == "exit" {
-			fmt.Print("\n👋 Goodbye!")
+			fmt.Println("Goodbye!")
 			break
 		}
 
@@ -96,25 +101,20 @@ func main() {
 			continue
 		}
 
-		fmt.Printf("🤖 ")
-
 		// Execute with automatic session management
 		// No need to manually handle history - it's managed automatically!
-		result, err := agent.Execute(ctx, gollem.Text(input))
+		err := ui.Run(ctx, func(ctx context.Context) error {
+			_, err := agent.Execute(ctx, gollem.Text(input))
+			return err
+		})
 		if err != nil {
-			fmt.Printf("\n❌ Error: %v\n", err)
+			fmt.Printf("Error: %v\n", err)
 			continue
 		}
 
-		// Display conclusion if available
-		if result != nil && !result.IsEmpty() {
-			fmt.Printf("\n💭 %s", result.String())
-		}
-
 		// Optional: Show conversation statistics
 		if history, err := agent.Session().History(); err == nil && history != nil {
-			fmt.Printf("\n📊 (Total messages: %d)\n", history.ToCount())
+			fmt.Printf("(Total messages: %d)\n", history.ToCount())
 		}
-		fmt.Println()
 	}
 }
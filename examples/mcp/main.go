@@ -9,6 +9,7 @@ import (
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/openai"
 	"github.com/m-mizutani/gollem/mcp"
+	"github.com/m-mizutani/gollem/tui"
 )
 
 func main() {
@@ -25,7 +26,7 @@ func main() {
 	httpClient, err := mcp.NewStreamableHTTP(ctx, "http://localhost:8080",
 		mcp.WithStreamableHTTPClientInfo("gollem-mcp-http-client", "1.0.0"))
 	if err != nil {
-		fmt.Printf("⚠️  Could not connect to HTTP MCP server: %v\n", err)
+		fmt.Printf("Could not connect to HTTP MCP server: %v\n", err)
 		httpClient = nil
 	}
 	if httpClient != nil {
@@ -37,7 +38,7 @@ func main() {
 	sseClient, err := mcp.NewSSE(ctx, "http://localhost:8081",
 		mcp.WithSSEClientInfo("gollem-mcp-sse-client", "1.0.0"))
 	if err != nil {
-		fmt.Printf("⚠️  Could not connect to SSE MCP server: %v\n", err)
+		fmt.Printf("Could not connect to SSE MCP server: %v\n", err)
 		sseClient = nil
 	}
 	if sseClient != nil {
@@ -63,27 +64,27 @@ func main() {
 	}
 	toolSets = append(toolSets, stdioClient)
 
+	// Render LLM output and tool activity in the terminal
+	ui := tui.New()
+
 	agent := gollem.New(client,
 		gollem.WithToolSets(toolSets...),
 		gollem.WithSystemPrompt("You are a helpful assistant with access to various MCP tools for file operations and other tasks."),
+		ui.AgentOptions(),
 	)
 
-	fmt.Println("🔧 MCP Integration Example")
-	fmt.Println("💡 This agent has access to MCP tools from multiple servers")
+	fmt.Println("MCP Integration Example")
+	fmt.Println("This agent has access to MCP tools from multiple servers")
 
 	// Execute task with MCP tools
 	task := "Hello, I want to use MCP tools. Please show me what tools are available and help me with file operations."
-	fmt.Printf("📝 Task: %s\n\n", task)
+	fmt.Printf("Task: %s\n\n", task)
 
-	result, err := agent.Execute(ctx, gollem.Text(task))
+	err = ui.Run(ctx, func(ctx context.Context) error {
+		_, err := agent.Execute(ctx, gollem.Text(task))
+		return err
+	})
 	if err != nil {
-		log.Fatalf("❌ Error executing task: %v", err)
-	}
-
-	// Display conclusion if available
-	if result != nil && !result.IsEmpty() {
-		fmt.Printf("💭 Task completion: %s\n", result.String())
+		log.Fatalf("Error executing task: %v", err)
 	}
-
-	fmt.Println("\n✅ MCP integration example completed!")
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/openai"
 	"github.com/m-mizutani/gollem/mcp"
+	"github.com/m-mizutani/gollem/tui"
 )
 
 func main() {
@@ -30,36 +31,33 @@ func main() {
 	}
 	defer mcpLocal.Close()
 
+	// Render LLM output and tool activity in the terminal
+	ui := tui.New()
+
 	// Create gollem agent with MCP tools
 	agent := gollem.New(client,
 		gollem.WithToolSets(mcpLocal),
 		gollem.WithSystemPrompt("You are a helpful assistant with access to MCP tools."),
-		gollem.WithContentBlockMiddleware(func(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
-			return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
-				resp, err := next(ctx, req)
-				if err == nil && len(resp.Texts) > 0 {
-					for _, text := range resp.Texts {
-						fmt.Printf("🤖 %s\n", text)
-					}
-				}
-				return resp, err
-			}
-		}),
+		ui.AgentOptions(),
 	)
 
-	fmt.Println("🚀 Simple Gollem Agent with MCP Tools")
-	fmt.Println("💡 Enter your message below:")
-	fmt.Print("> ")
+	fmt.Println("Simple Gollem Agent with MCP Tools")
 
 	scanner := bufio.NewScanner(os.Stdin)
-	if scanner.Scan() {
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			break
+		}
 		input := scanner.Text()
 
-		// Execute with automatic session management
-		if err := agent.Execute(ctx, input); err != nil {
-			fmt.Printf("❌ Error: %v\n", err)
-		} else {
-			fmt.Println("✅ Task completed!")
+		// Execute with automatic session management. An error ends only this input.
+		err := ui.Run(ctx, func(ctx context.Context) error {
+			_, err := agent.Execute(ctx, gollem.Text(input))
+			return err
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 		}
 	}
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/gemini"
+	"github.com/m-mizutani/gollem/tui"
 )
 
 func main() {
@@ -26,38 +27,26 @@ func main() {
 		&MultiplyTool{},
 	}
 
+	// Render LLM output and tool activity in the terminal
+	ui := tui.New()
+
 	// Create agent with tools
 	agent := gollem.New(client,
 		gollem.WithTools(tools...),
 		gollem.WithSystemPrompt("You are a helpful calculator assistant. Use the available tools to perform mathematical operations."),
-		gollem.WithContentBlockMiddleware(func(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
-			return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
-				resp, err := next(ctx, req)
-				if err == nil && len(resp.Texts) > 0 {
-					for _, text := range resp.Texts {
-						log.Printf("🤖 %s", text)
-					}
-				}
-				return resp, err
-			}
-		}),
-		gollem.WithToolMiddleware(func(next gollem.ToolHandler) gollem.ToolHandler {
-			return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
-				log.Printf("⚡ Using tool: %s", req.Tool.Name)
-				return next(ctx, req)
-			}
-		}),
+		ui.AgentOptions(),
 	)
 
 	query := "Add 5 and 3, then multiply the result by 2"
-	log.Printf("📝 Query: %s", query)
 
 	// Execute with automatic session management
-	if err := agent.Execute(ctx, query); err != nil {
+	err = ui.Run(ctx, func(ctx context.Context) error {
+		_, err := agent.Execute(ctx, gollem.Text(query))
+		return err
+	})
+	if err != nil {
 		log.Fatal(err)
 	}
-
-	log.Printf("✅ Calculation completed!")
 }
 
 // AddTool is a tool that adds two numbers
@@ -67,7 +56,6 @@ func (t *AddTool) Run(ctx context.Context, args map[string]any) (map[string]any,
 	a := args["a"].(float64)
 	b := args["b"].(float64)
 	result := a + b
-	log.Printf("🔢 Add: %.2f + %.2f = %.2f", a, b, result)
 	return map[string]any{"result": result}, nil
 }
 
@@ -97,7 +85,6 @@ func (t *MultiplyTool) Run(ctx context.Context, args map[string]any) (map[string
 	a := args["a"].(float64)
 	b := args["b"].(float64)
 	result := a * b
-	log.Printf("🔢 Multiply: %.2f × %.2f = %.2f", a, b, result)
 	return map[string]any{"result": result}, nil
 }
 
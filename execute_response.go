@@ -1,6 +1,14 @@
 package gollem
 
-import "strings"
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// ExecuteResponseVersion is the version of the JSON format of ExecuteResponse.
+const ExecuteResponseVersion = 1
 
 // ExecuteResponse represents the final response from Execute method
 type ExecuteResponse struct {
@@ -17,6 +25,150 @@ type ExecuteResponse struct {
 	// these inputs need to be added to session history before the response texts.
 	// This prevents user input from being lost when strategies return direct responses.
 	UserInputs []Input
+
+	// Reasoning is a short rationale of the answer. It is set only when the agent is
+	// configured with WithReasoningSummary.
+	Reasoning *ReasoningSummary
+
+	// Confidence is the estimated confidence of the answer. It is set only when the agent is
+	// configured with WithConfidenceSignal.
+	Confidence *Confidence
+
+	// ExecID is the ID of the Execute call that produced the response.
+	ExecID string
+
+	// Transcript contains the messages added to the session history by the Execute call,
+	// including tool calls and their results. If the history was compacted during the call,
+	// it contains the whole compacted history. It is nil if the session history is not
+	// available.
+	Transcript *History
+
+	// Usage is the token usage of the Execute call, including LLM calls of the strategy,
+	// middlewares and subagents, with the breakdown by phase.
+	Usage *Usage
+}
+
+// executeResponseJSON is the JSON format of ExecuteResponse. UserInputs are stored as a user
+// message because Input is an interface.
+type executeResponseJSON struct {
+	Version    int               `json:"version"`
+	ExecID     string            `json:"exec_id,omitempty"`
+	Texts      []string          `json:"texts"`
+	Thoughts   []string          `json:"thoughts,omitempty"`
+	UserInputs *Message          `json:"user_inputs,omitempty"`
+	Reasoning  *ReasoningSummary `json:"reasoning,omitempty"`
+	Confidence *Confidence       `json:"confidence,omitempty"`
+	Transcript *History          `json:"transcript,omitempty"`
+	Usage      *Usage            `json:"usage,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler so that a response can be persisted and reloaded, e.g.
+// to re-render past runs. FunctionResponse in UserInputs is not serialized.
+func (r ExecuteResponse) MarshalJSON() ([]byte, error) {
+	v := executeResponseJSON{
+		Version:    ExecuteResponseVersion,
+		ExecID:     r.ExecID,
+		Texts:      r.Texts,
+		Thoughts:   r.Thoughts,
+		Reasoning:  r.Reasoning,
+		Confidence: r.Confidence,
+		Transcript: r.Transcript,
+		Usage:      r.Usage,
+	}
+
+	userHistory, err := convertInputsToHistory(r.UserInputs)
+	if err != nil {
+		return nil, err
+	}
+	if userHistory != nil {
+		v.UserInputs = &userHistory.Messages[0]
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler with version validation.
+// Returns ErrExecuteResponseVersionMismatch if the serialized version does not match
+// ExecuteResponseVersion.
+func (r *ExecuteResponse) UnmarshalJSON(data []byte) error {
+	var v executeResponseJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if v.Version != ExecuteResponseVersion {
+		return goerr.Wrap(ErrExecuteResponseVersionMismatch, "unsupported execute response version",
+			goerr.V("got", v.Version),
+			goerr.V("want", ExecuteResponseVersion),
+		)
+	}
+
+	var userInputs []Input
+	if v.UserInputs != nil {
+		inputs, err := messageToInputs(v.UserInputs)
+		if err != nil {
+			return err
+		}
+		userInputs = inputs
+	}
+
+	*r = ExecuteResponse{
+		Texts:      v.Texts,
+		Thoughts:   v.Thoughts,
+		UserInputs: userInputs,
+		Reasoning:  v.Reasoning,
+		Confidence: v.Confidence,
+		ExecID:     v.ExecID,
+		Transcript: v.Transcript,
+		Usage:      v.Usage,
+	}
+	return nil
+}
+
+// messageToInputs converts a user message created by convertInputsToHistory back to inputs.
+func messageToInputs(msg *Message) ([]Input, error) {
+	var inputs []Input
+	for i := range msg.Contents {
+		content := &msg.Contents[i]
+		switch content.Type {
+		case MessageContentTypeText:
+			text, err := content.GetTextContent()
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, Text(text.Text))
+
+		case MessageContentTypeImage:
+			img, err := content.GetImageContent()
+			if err != nil {
+				return nil, err
+			}
+			if len(img.Data) == 0 && img.URL != "" {
+				inputs = append(inputs, ImageURL{url: img.URL, mimeType: ImageMimeType(img.MediaType)})
+				continue
+			}
+			inputs = append(inputs, Image{data: img.Data, mimeType: ImageMimeType(img.MediaType)})
+
+		case MessageContentTypePDF:
+			pdf, err := content.GetPDFContent()
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, PDF{data: pdf.Data})
+
+		case MessageContentTypeFile:
+			file, err := content.GetFileContent()
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, File{data: file.Data, mimeType: file.MediaType, name: file.Name})
+
+		default:
+			return nil, goerr.Wrap(ErrInvalidHistoryData, "unsupported content type of user input",
+				goerr.V("type", content.Type))
+		}
+	}
+	return inputs, nil
 }
 
 // NewExecuteResponse creates a new ExecuteResponse with given texts
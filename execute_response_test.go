@@ -1,9 +1,13 @@
 package gollem_test
 
 import (
+	"context"
+	"encoding/json"
+	"os"
 	"testing"
 
 	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
 	"github.com/m-mizutani/gt"
 )
 
@@ -90,3 +94,175 @@ func TestExecuteResponseIsEmpty(t *testing.T) {
 		gt.Equal(t, "  ", resp.String()) // Should be spaces, but IsEmpty should return true
 	})
 }
+
+func TestExecuteResponseJSON(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		imageData, err := os.ReadFile("testdata/test_image.png")
+		gt.NoError(t, err)
+		img, err := gollem.NewImage(imageData)
+		gt.NoError(t, err)
+
+		transcript, err := gollem.NewHistoryBuilder().
+			User("What is in the image?").
+			Assistant("A test pattern.").
+			Build()
+		gt.NoError(t, err)
+
+		resp := &gollem.ExecuteResponse{
+			Texts:      []string{"A test pattern."},
+			Thoughts:   []string{"look at the image"},
+			UserInputs: []gollem.Input{gollem.Text("What is in the image?"), img},
+			Confidence: &gollem.Confidence{Score: 0.8, Signals: map[string]float64{"self": 0.8}},
+			ExecID:     "exec-1",
+			Transcript: transcript,
+			Usage:      &gollem.Usage{InputTokens: 100, OutputTokens: 20},
+		}
+
+		data, err := json.Marshal(resp)
+		gt.NoError(t, err)
+
+		var loaded gollem.ExecuteResponse
+		gt.NoError(t, json.Unmarshal(data, &loaded))
+		gt.Equal(t, resp.Texts, loaded.Texts)
+		gt.Equal(t, resp.Thoughts, loaded.Thoughts)
+		gt.Equal(t, resp.Confidence, loaded.Confidence)
+		gt.Equal(t, "exec-1", loaded.ExecID)
+		gt.Equal(t, resp.Usage, loaded.Usage)
+		gt.Equal(t, resp.Transcript, loaded.Transcript)
+
+		gt.A(t, loaded.UserInputs).Length(2)
+		gt.Equal(t, gollem.Input(gollem.Text("What is in the image?")), loaded.UserInputs[0])
+		loadedImg, ok := loaded.UserInputs[1].(gollem.Image)
+		gt.True(t, ok)
+		gt.Equal(t, img.MimeType(), loadedImg.MimeType())
+		gt.Equal(t, img.Data(), loadedImg.Data())
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		var resp gollem.ExecuteResponse
+		err := json.Unmarshal([]byte(`{"version":999,"texts":["hello"]}`), &resp)
+		gt.Error(t, err).Is(gollem.ErrExecuteResponseVersionMismatch)
+	})
+}
+
+func TestExecuteResponseTranscriptAndUsage(t *testing.T) {
+	prior, err := gollem.NewHistoryBuilder().User("Hi").Assistant("Hello").Build()
+	gt.NoError(t, err)
+	messages := prior.Messages
+
+	textMessage := func(role gollem.MessageRole, text string) gollem.Message {
+		content, err := gollem.NewTextContent(text)
+		gt.NoError(t, err)
+		return gollem.Message{Role: role, Contents: []gollem.MessageContent{content}}
+	}
+
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					messages = append(messages,
+						textMessage(gollem.RoleUser, "What is 2+2?"),
+						textMessage(gollem.RoleAssistant, "4"),
+					)
+					return &gollem.Response{Texts: []string{"4"}, InputToken: 30, OutputToken: 5}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{Version: gollem.HistoryVersion, Messages: messages}, nil
+				},
+				AppendHistoryFunc: func(h *gollem.History) error {
+					messages = append(messages, h.Messages...)
+					return nil
+				},
+			}, nil
+		},
+	}
+
+	agent := gollem.New(client, gollem.WithIDGenerator(gollem.NewSequentialIDGenerator("exec-")))
+	resp, err := agent.Execute(context.Background(), gollem.Text("What is 2+2?"))
+	gt.NoError(t, err)
+
+	gt.Equal(t, "exec-1", resp.ExecID)
+	gt.Equal(t, &gollem.Usage{
+		InputTokens:  30,
+		OutputTokens: 5,
+		Phases: map[string]gollem.Usage{
+			gollem.UsagePhaseExecute: {InputTokens: 30, OutputTokens: 5},
+		},
+	}, resp.Usage)
+
+	// the transcript does not include the history before the Execute
+	gt.NotNil(t, resp.Transcript)
+	gt.True(t, len(resp.Transcript.Messages) >= 2)
+	first, err := resp.Transcript.Messages[0].Contents[0].GetTextContent()
+	gt.NoError(t, err)
+	gt.Equal(t, "What is 2+2?", first.Text)
+}
+
+func TestExecuteResponseTranscriptCompacted(t *testing.T) {
+	textMessage := func(role gollem.MessageRole, text string) gollem.Message {
+		content, err := gollem.NewTextContent(text)
+		gt.NoError(t, err)
+		return gollem.Message{Role: role, Contents: []gollem.MessageContent{content}}
+	}
+
+	prior, err := gollem.NewHistoryBuilder().
+		User("Hi").Assistant("Hello").
+		User("How are you?").Assistant("Fine").
+		Build()
+	gt.NoError(t, err)
+	messages := prior.Messages
+
+	var calls int
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					if calls == 1 {
+						// compacted into a summary, and the history grows beyond the start again
+						messages = []gollem.Message{
+							textMessage(gollem.RoleUser, "Summary of the conversation"),
+							textMessage(gollem.RoleAssistant, "OK"),
+							textMessage(gollem.RoleUser, "Check it"),
+							textMessage(gollem.RoleAssistant, "calling check"),
+						}
+						return &gollem.Response{
+							FunctionCalls: []*gollem.FunctionCall{{ID: "call-1", Name: "check", Arguments: map[string]any{}}},
+						}, nil
+					}
+					messages = append(messages,
+						textMessage(gollem.RoleUser, "check result"),
+						textMessage(gollem.RoleAssistant, "Done"),
+					)
+					return &gollem.Response{Texts: []string{"Done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{Version: gollem.HistoryVersion, Messages: messages}, nil
+				},
+				AppendHistoryFunc: func(h *gollem.History) error {
+					messages = append(messages, h.Messages...)
+					return nil
+				},
+			}, nil
+		},
+	}
+
+	tool := &mockTool{
+		spec: gollem.ToolSpec{Name: "check", Description: "check"},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{"ok": true}, nil
+		},
+	}
+
+	agent := gollem.New(client, gollem.WithTools(tool), gollem.WithHistory(prior))
+	resp, err := agent.Execute(context.Background(), gollem.Text("Check it"))
+	gt.NoError(t, err)
+	gt.Equal(t, 2, calls)
+
+	// the whole compacted history is returned though it is longer than before the Execute
+	gt.NotNil(t, resp.Transcript)
+	gt.Equal(t, len(messages), len(resp.Transcript.Messages))
+	first, err := resp.Transcript.Messages[0].Contents[0].GetTextContent()
+	gt.NoError(t, err)
+	gt.Equal(t, "Summary of the conversation", first.Text)
+}
@@ -0,0 +1,281 @@
+// Package experiment provides an A/B experiment runner for gollem agents. An Experiment
+// splits executions between variants (different prompts, tools, flags or LLM clients),
+// records outcomes and scores, and summarizes the comparison against the baseline variant
+// with Welch's t-test.
+package experiment
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+var (
+	// ErrNoVariant is returned when an experiment has no variant.
+	ErrNoVariant = errors.New("experiment has no variant")
+
+	// ErrInvalidWeight is returned when a variant has a negative weight or all weights are zero.
+	ErrInvalidWeight = errors.New("invalid variant weight")
+
+	// ErrRunNotFound is returned by RecordScore when the run ID is unknown.
+	ErrRunNotFound = errors.New("experiment run not found")
+)
+
+// Variant is one configuration under test.
+type Variant struct {
+	// Name identifies the variant in outcomes and reports. It must be unique in the experiment.
+	Name string
+
+	// Weight is the relative share of traffic. Zero means the default weight 1.
+	Weight float64
+
+	// Client overrides the LLM client of the experiment, e.g. to compare models.
+	Client gollem.LLMClient
+
+	// Options are appended to the base options of the experiment.
+	Options []gollem.Option
+
+	// Flags are set as per-request feature flags of the execution.
+	Flags map[string]bool
+}
+
+// Scorer scores the response of a run. Higher is better. It is not called when the
+// execution fails.
+type Scorer func(ctx context.Context, input []gollem.Input, resp *gollem.ExecuteResponse) (float64, error)
+
+// Outcome is the recorded result of a run.
+type Outcome struct {
+	RunID       string
+	Variant     string
+	Key         string
+	Score       float64
+	Scored      bool
+	Duration    time.Duration
+	InputToken  int
+	OutputToken int
+	Error       error
+}
+
+// Result is returned by Experiment.Run.
+type Result struct {
+	RunID    string
+	Variant  string
+	Response *gollem.ExecuteResponse
+	Score    float64
+	Scored   bool
+}
+
+// Experiment splits executions between variants and records the outcomes.
+type Experiment struct {
+	name     string
+	client   gollem.LLMClient
+	variants []Variant
+	total    float64
+	options  []gollem.Option
+	scorer   Scorer
+
+	mu       sync.Mutex
+	outcomes []*Outcome
+	index    map[string]*Outcome
+}
+
+// Option is the type for the options of Experiment.
+type Option func(*Experiment)
+
+// WithAgentOptions sets the base agent options shared by all variants.
+func WithAgentOptions(options ...gollem.Option) Option {
+	return func(e *Experiment) {
+		e.options = append(e.options, options...)
+	}
+}
+
+// WithScorer sets the scorer called after each successful run. Without a scorer, scores can
+// be recorded later with RecordScore, e.g. from user feedback.
+func WithScorer(scorer Scorer) Option {
+	return func(e *Experiment) {
+		e.scorer = scorer
+	}
+}
+
+// New creates a new Experiment. The first variant is the baseline of the report.
+func New(name string, client gollem.LLMClient, variants []Variant, opts ...Option) (*Experiment, error) {
+	if len(variants) == 0 {
+		return nil, goerr.Wrap(ErrNoVariant, "failed to create experiment", goerr.V("name", name))
+	}
+
+	e := &Experiment{
+		name:   name,
+		client: client,
+		index:  make(map[string]*Outcome),
+	}
+	seen := make(map[string]struct{}, len(variants))
+	for _, v := range variants {
+		if _, ok := seen[v.Name]; ok {
+			return nil, goerr.New("duplicated variant name", goerr.V("name", name), goerr.V("variant", v.Name))
+		}
+		seen[v.Name] = struct{}{}
+
+		if v.Weight < 0 {
+			return nil, goerr.Wrap(ErrInvalidWeight, "negative weight", goerr.V("variant", v.Name), goerr.V("weight", v.Weight))
+		}
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+		if v.Client == nil && client == nil {
+			return nil, goerr.New("no LLM client for variant", goerr.V("variant", v.Name))
+		}
+		e.total += v.Weight
+		e.variants = append(e.variants, v)
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e, nil
+}
+
+// Name returns the name of the experiment.
+func (e *Experiment) Name() string {
+	return e.name
+}
+
+// Assign returns the variant for the assignment key. The same key is always assigned to the
+// same variant, so that a user or session sees a consistent configuration. An empty key is
+// assigned randomly.
+func (e *Experiment) Assign(key string) *Variant {
+	var point float64
+	if key == "" {
+		point = rand.Float64() // #nosec G404 -- traffic split does not need a secure RNG
+	} else {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(e.name))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(key))
+		point = float64(h.Sum64()>>11) / float64(uint64(1)<<53)
+	}
+
+	point *= e.total
+	for i := range e.variants {
+		point -= e.variants[i].Weight
+		if point < 0 {
+			return &e.variants[i]
+		}
+	}
+	return &e.variants[len(e.variants)-1]
+}
+
+// Run executes the input with the variant assigned to key and records the outcome. A new
+// agent is created for each run, so runs do not share session history.
+func (e *Experiment) Run(ctx context.Context, key string, input ...gollem.Input) (*Result, error) {
+	variant := e.Assign(key)
+	return e.run(ctx, variant, key, input)
+}
+
+// RunVariant executes the input with the named variant and records the outcome.
+func (e *Experiment) RunVariant(ctx context.Context, name string, input ...gollem.Input) (*Result, error) {
+	for i := range e.variants {
+		if e.variants[i].Name == name {
+			return e.run(ctx, &e.variants[i], "", input)
+		}
+	}
+	return nil, goerr.New("variant not found", goerr.V("experiment", e.name), goerr.V("variant", name))
+}
+
+func (e *Experiment) run(ctx context.Context, variant *Variant, key string, input []gollem.Input) (*Result, error) {
+	outcome := &Outcome{
+		RunID:   gollem.NewID(ctx),
+		Variant: variant.Name,
+		Key:     key,
+	}
+
+	client := variant.Client
+	if client == nil {
+		client = e.client
+	}
+
+	options := make([]gollem.Option, 0, len(e.options)+len(variant.Options)+1)
+	options = append(options, e.options...)
+	options = append(options, variant.Options...)
+	options = append(options, gollem.WithConversationEndHook(func(ctx context.Context, ev *gollem.ConversationEndEvent) {
+		outcome.InputToken = ev.InputToken
+		outcome.OutputToken = ev.OutputToken
+	}))
+
+	if len(variant.Flags) > 0 {
+		ctx = gollem.ContextWithFlags(ctx, variant.Flags)
+	}
+
+	startedAt := gollem.Now(ctx)
+	resp, err := gollem.New(client, options...).Execute(ctx, input...)
+	outcome.Duration = gollem.Now(ctx).Sub(startedAt)
+
+	result := &Result{
+		RunID:    outcome.RunID,
+		Variant:  variant.Name,
+		Response: resp,
+	}
+
+	if err != nil {
+		outcome.Error = err
+		e.record(outcome)
+		return result, goerr.Wrap(err, "experiment run failed",
+			goerr.V("experiment", e.name),
+			goerr.V("variant", variant.Name),
+		)
+	}
+
+	if e.scorer != nil {
+		score, err := e.scorer(ctx, input, resp)
+		if err != nil {
+			e.record(outcome)
+			return result, goerr.Wrap(err, "failed to score experiment run",
+				goerr.V("experiment", e.name),
+				goerr.V("variant", variant.Name),
+			)
+		}
+		outcome.Score, outcome.Scored = score, true
+		result.Score, result.Scored = score, true
+	}
+
+	e.record(outcome)
+	return result, nil
+}
+
+func (e *Experiment) record(outcome *Outcome) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.outcomes = append(e.outcomes, outcome)
+	e.index[outcome.RunID] = outcome
+}
+
+// RecordScore sets the score of a run after the fact, e.g. from user feedback. It overwrites
+// the score given by the Scorer.
+func (e *Experiment) RecordScore(runID string, score float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	outcome, ok := e.index[runID]
+	if !ok {
+		return goerr.Wrap(ErrRunNotFound, "failed to record score", goerr.V("run_id", runID))
+	}
+	outcome.Score, outcome.Scored = score, true
+	return nil
+}
+
+// Outcomes returns a copy of the recorded outcomes in the order they were recorded.
+func (e *Experiment) Outcomes() []Outcome {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	outcomes := make([]Outcome, len(e.outcomes))
+	for i, o := range e.outcomes {
+		outcomes[i] = *o
+	}
+	return outcomes
+}
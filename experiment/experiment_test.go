@@ -0,0 +1,129 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/experiment"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// newClient returns a client that answers with the system prompt and the flags of the execution.
+func newClient(genErr error) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			flags := gollem.FlagsFromContext(ctx)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					if genErr != nil {
+						return nil, genErr
+					}
+					return &gollem.Response{
+						Texts:       []string{fmt.Sprintf("%s|%v", cfg.SystemPrompt(), flags.Enabled("beta"))},
+						InputToken:  10,
+						OutputToken: 3,
+					}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+				AppendHistoryFunc: func(*gollem.History) error { return nil },
+			}, nil
+		},
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	client := newClient(nil)
+
+	_, err := experiment.New("exp", client, nil)
+	gt.True(t, errors.Is(err, experiment.ErrNoVariant))
+
+	_, err = experiment.New("exp", client, []experiment.Variant{{Name: "a", Weight: -1}})
+	gt.True(t, errors.Is(err, experiment.ErrInvalidWeight))
+
+	_, err = experiment.New("exp", client, []experiment.Variant{{Name: "a"}, {Name: "a"}})
+	gt.Error(t, err)
+
+	_, err = experiment.New("exp", nil, []experiment.Variant{{Name: "a"}})
+	gt.Error(t, err)
+}
+
+func TestAssign(t *testing.T) {
+	exp, err := experiment.New("exp", newClient(nil), []experiment.Variant{
+		{Name: "control", Weight: 3},
+		{Name: "treatment", Weight: 1},
+	})
+	gt.NoError(t, err)
+
+	counts := map[string]int{}
+	for i := range 4000 {
+		key := fmt.Sprintf("user-%d", i)
+		v := exp.Assign(key)
+		gt.Equal(t, v.Name, exp.Assign(key).Name)
+		counts[v.Name]++
+	}
+
+	// Traffic is split roughly 3:1.
+	gt.N(t, counts["control"]).Greater(2800).Less(3200)
+	gt.N(t, counts["treatment"]).Greater(800).Less(1200)
+}
+
+func TestRun(t *testing.T) {
+	exp, err := experiment.New("exp", newClient(nil), []experiment.Variant{
+		{Name: "control"},
+		{
+			Name:    "treatment",
+			Options: []gollem.Option{gollem.WithSystemPrompt("v2")},
+			Flags:   map[string]bool{"beta": true},
+		},
+	},
+		experiment.WithAgentOptions(gollem.WithSystemPrompt("v1")),
+		experiment.WithScorer(func(ctx context.Context, input []gollem.Input, resp *gollem.ExecuteResponse) (float64, error) {
+			return float64(len(resp.String())), nil
+		}),
+	)
+	gt.NoError(t, err)
+
+	control, err := exp.RunVariant(t.Context(), "control", gollem.Text("hi"))
+	gt.NoError(t, err)
+	gt.Equal(t, "v1|false", control.Response.String())
+	gt.True(t, control.Scored)
+	gt.Equal(t, 8.0, control.Score)
+
+	treatment, err := exp.RunVariant(t.Context(), "treatment", gollem.Text("hi"))
+	gt.NoError(t, err)
+	gt.Equal(t, "v2|true", treatment.Response.String())
+
+	_, err = exp.RunVariant(t.Context(), "unknown", gollem.Text("hi"))
+	gt.Error(t, err)
+
+	outcomes := exp.Outcomes()
+	gt.A(t, outcomes).Length(2)
+	gt.Equal(t, "control", outcomes[0].Variant)
+	gt.Equal(t, 10, outcomes[0].InputToken)
+	gt.Equal(t, 3, outcomes[0].OutputToken)
+
+	gt.NoError(t, exp.RecordScore(treatment.RunID, 42))
+	gt.Equal(t, 42.0, exp.Outcomes()[1].Score)
+	gt.True(t, errors.Is(exp.RecordScore("unknown", 1), experiment.ErrRunNotFound))
+}
+
+func TestRunError(t *testing.T) {
+	genErr := errors.New("llm failure")
+	exp, err := experiment.New("exp", newClient(genErr), []experiment.Variant{{Name: "control"}})
+	gt.NoError(t, err)
+
+	_, err = exp.Run(t.Context(), "user", gollem.Text("hi"))
+	gt.True(t, errors.Is(err, genErr))
+
+	outcomes := exp.Outcomes()
+	gt.A(t, outcomes).Length(1)
+	gt.True(t, errors.Is(outcomes[0].Error, genErr))
+	gt.False(t, outcomes[0].Scored)
+}
@@ -0,0 +1,276 @@
+package experiment
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// SignificanceLevel is the p-value threshold below which a comparison is reported as significant.
+const SignificanceLevel = 0.05
+
+// Report is the statistical summary of an experiment.
+type Report struct {
+	Experiment string
+	Baseline   string
+	Variants   []VariantSummary
+}
+
+// VariantSummary summarizes the outcomes of a variant.
+type VariantSummary struct {
+	Name            string
+	Runs            int
+	Errors          int
+	ErrorRate       float64
+	Scored          int
+	MeanScore       float64
+	StdDevScore     float64
+	MeanDuration    time.Duration
+	MeanInputToken  float64
+	MeanOutputToken float64
+
+	// Comparison is the comparison of scores against the baseline. It is nil for the
+	// baseline and for variants with less than two scored runs.
+	Comparison *Comparison
+}
+
+// Comparison is the result of Welch's t-test of a variant's scores against the baseline.
+type Comparison struct {
+	// Diff is the mean score of the variant minus the mean score of the baseline.
+	Diff float64
+	// CILow and CIHigh are the bounds of the 95% confidence interval of Diff.
+	CILow  float64
+	CIHigh float64
+	TStat  float64
+	DF     float64
+	// PValue is the two-sided p-value of the null hypothesis that the means are equal.
+	PValue      float64
+	Significant bool
+}
+
+// Report summarizes the recorded outcomes.
+func (e *Experiment) Report() *Report {
+	outcomes := e.Outcomes()
+
+	report := &Report{
+		Experiment: e.name,
+		Baseline:   e.variants[0].Name,
+	}
+
+	scores := make([][]float64, len(e.variants))
+	for i, v := range e.variants {
+		summary := VariantSummary{Name: v.Name}
+		var duration time.Duration
+		var inputToken, outputToken int
+
+		for _, o := range outcomes {
+			if o.Variant != v.Name {
+				continue
+			}
+			summary.Runs++
+			duration += o.Duration
+			inputToken += o.InputToken
+			outputToken += o.OutputToken
+			if o.Error != nil {
+				summary.Errors++
+			}
+			if o.Scored {
+				scores[i] = append(scores[i], o.Score)
+			}
+		}
+
+		if summary.Runs > 0 {
+			n := float64(summary.Runs)
+			summary.ErrorRate = float64(summary.Errors) / n
+			summary.MeanDuration = duration / time.Duration(summary.Runs)
+			summary.MeanInputToken = float64(inputToken) / n
+			summary.MeanOutputToken = float64(outputToken) / n
+		}
+		summary.Scored = len(scores[i])
+		summary.MeanScore, summary.StdDevScore = meanStdDev(scores[i])
+
+		if i > 0 {
+			summary.Comparison = welchTTest(scores[0], scores[i])
+		}
+		report.Variants = append(report.Variants, summary)
+	}
+
+	return report
+}
+
+// String formats the report as a plain text table.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "experiment: %s (baseline: %s)\n", r.Experiment, r.Baseline)
+	fmt.Fprintf(&b, "%-16s %6s %7s %6s %10s %10s %12s %10s %10s\n",
+		"variant", "runs", "errors", "scored", "mean", "stddev", "latency", "diff", "p-value")
+	for _, v := range r.Variants {
+		diff, p := "-", "-"
+		if c := v.Comparison; c != nil {
+			diff = fmt.Sprintf("%+.4f", c.Diff)
+			p = fmt.Sprintf("%.4f", c.PValue)
+			if c.Significant {
+				p += "*"
+			}
+		}
+		fmt.Fprintf(&b, "%-16s %6d %7d %6d %10.4f %10.4f %12s %10s %10s\n",
+			v.Name, v.Runs, v.Errors, v.Scored, v.MeanScore, v.StdDevScore,
+			v.MeanDuration.Round(time.Millisecond), diff, p)
+	}
+	return b.String()
+}
+
+// meanStdDev returns the mean and the sample standard deviation.
+func meanStdDev(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+
+	var ss float64
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(xs)-1))
+}
+
+// welchTTest compares the means of b against a. It returns nil if either sample has less
+// than two values.
+func welchTTest(a, b []float64) *Comparison {
+	if len(a) < 2 || len(b) < 2 {
+		return nil
+	}
+
+	meanA, sdA := meanStdDev(a)
+	meanB, sdB := meanStdDev(b)
+	va := sdA * sdA / float64(len(a))
+	vb := sdB * sdB / float64(len(b))
+	se := math.Sqrt(va + vb)
+	diff := meanB - meanA
+
+	c := &Comparison{Diff: diff, CILow: diff, CIHigh: diff, PValue: 1}
+	if se == 0 {
+		// Both samples are constant: the difference is exact.
+		if diff != 0 {
+			c.PValue = 0
+			c.Significant = true
+			c.TStat = math.Copysign(math.Inf(1), diff)
+		}
+		return c
+	}
+
+	c.TStat = diff / se
+	c.DF = (va + vb) * (va + vb) /
+		(va*va/float64(len(a)-1) + vb*vb/float64(len(b)-1))
+	c.PValue = studentTTwoSided(c.TStat, c.DF)
+	c.Significant = c.PValue < SignificanceLevel
+
+	margin := studentTQuantile(1-SignificanceLevel/2, c.DF) * se
+	c.CILow, c.CIHigh = diff-margin, diff+margin
+	return c
+}
+
+// studentTTwoSided returns P(|T| >= |t|) for Student's t-distribution with df degrees of freedom.
+func studentTTwoSided(t, df float64) float64 {
+	return regIncBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// studentTQuantile returns the p-quantile (p > 0.5) of Student's t-distribution by bisection.
+func studentTQuantile(p, df float64) float64 {
+	target := 2 * (1 - p)
+	lo, hi := 0.0, 1.0
+	for studentTTwoSided(hi, df) > target {
+		hi *= 2
+	}
+	for range 100 {
+		mid := (lo + hi) / 2
+		if studentTTwoSided(mid, df) > target {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b).
+func regIncBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+
+	// Use the symmetry relation where the continued fraction converges quickly.
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete beta function
+// with the modified Lentz's method.
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIter = 200
+		eps     = 1e-14
+		tiny    = 1e-300
+	)
+
+	qab, qap, qam := a+b, a+1, a-1
+	c, d := 1.0, 1-qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIter; m++ {
+		fm := float64(m)
+		m2 := 2 * fm
+
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,82 @@
+package experiment_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/experiment"
+	"github.com/m-mizutani/gt"
+)
+
+func newScoredExperiment(t *testing.T, scores map[string][]float64) *experiment.Experiment {
+	exp, err := experiment.New("exp", newClient(nil), []experiment.Variant{
+		{Name: "control"},
+		{Name: "treatment"},
+	})
+	gt.NoError(t, err)
+
+	for _, name := range []string{"control", "treatment"} {
+		for _, score := range scores[name] {
+			result, err := exp.RunVariant(t.Context(), name, gollem.Text("hi"))
+			gt.NoError(t, err)
+			gt.NoError(t, exp.RecordScore(result.RunID, score))
+		}
+	}
+	return exp
+}
+
+func TestReport(t *testing.T) {
+	exp := newScoredExperiment(t, map[string][]float64{
+		"control":   {1, 2, 3, 4, 5},
+		"treatment": {3, 4, 5, 6, 7},
+	})
+
+	report := exp.Report()
+	gt.Equal(t, "control", report.Baseline)
+	gt.A(t, report.Variants).Length(2)
+
+	control := report.Variants[0]
+	gt.Equal(t, 5, control.Runs)
+	gt.Equal(t, 5, control.Scored)
+	gt.Equal(t, 3.0, control.MeanScore)
+	gt.True(t, math.Abs(control.StdDevScore-math.Sqrt(2.5)) < 1e-9)
+	gt.Equal(t, 10.0, control.MeanInputToken)
+	gt.Nil(t, control.Comparison)
+
+	// Welch's t-test: diff=2, se=1, t=2, df=8, p≈0.0805, t(0.975, 8)≈2.306
+	c := report.Variants[1].Comparison
+	gt.NotNil(t, c)
+	gt.Equal(t, 2.0, c.Diff)
+	gt.True(t, math.Abs(c.TStat-2) < 1e-9)
+	gt.True(t, math.Abs(c.DF-8) < 1e-9)
+	gt.True(t, math.Abs(c.PValue-0.0805) < 1e-3)
+	gt.False(t, c.Significant)
+	gt.True(t, math.Abs(c.CIHigh-(2+2.306)) < 1e-3)
+	gt.True(t, math.Abs(c.CILow-(2-2.306)) < 1e-3)
+
+	gt.True(t, strings.Contains(report.String(), "treatment"))
+}
+
+func TestReportSignificant(t *testing.T) {
+	exp := newScoredExperiment(t, map[string][]float64{
+		"control":   {0.1, 0.2, 0.15, 0.1, 0.2, 0.12},
+		"treatment": {0.9, 0.8, 0.85, 0.95, 0.9, 0.88},
+	})
+
+	c := exp.Report().Variants[1].Comparison
+	gt.NotNil(t, c)
+	gt.True(t, c.Significant)
+	gt.True(t, c.PValue < 0.001)
+	gt.True(t, c.CILow > 0)
+}
+
+func TestReportInsufficientData(t *testing.T) {
+	exp := newScoredExperiment(t, map[string][]float64{
+		"control":   {1},
+		"treatment": {2, 3},
+	})
+
+	gt.Nil(t, exp.Report().Variants[1].Comparison)
+}
@@ -18,3 +18,10 @@ func init() {
 }
 
 func DebugLogger() *slog.Logger { return debugLogger }
+
+// ToolLimiterWaiting returns the number of calls waiting for x.
+func ToolLimiterWaiting(x *ToolLimiter) int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.waiting.Len()
+}
@@ -0,0 +1,259 @@
+package gollem
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// DefaultMaxExamples is the default maximum number of examples selected by Examples.Select.
+const DefaultMaxExamples = 3
+
+// Example is a labeled few-shot example of an input and the expected output.
+type Example struct {
+	// ID identifies the example to replace or remove it. It's generated by NewID if empty.
+	ID     string
+	Input  string
+	Output string
+	// Labels categorize the example, e.g. a task type, to select examples of the labels.
+	Labels []string
+}
+
+// Examples stores few-shot examples and selects the ones fitting a request best by embedding
+// similarity of their inputs within a token budget. Examples can be added and removed while
+// agents use them. It's safe for concurrent use.
+type Examples struct {
+	embedder    LLMClient
+	dimension   int
+	maxExamples int
+	maxTokens   int
+
+	mu      sync.RWMutex
+	entries []*exampleEntry
+}
+
+type exampleEntry struct {
+	example Example
+	vector  []float64
+}
+
+// ExamplesOption is an option of NewExamples.
+type ExamplesOption func(*Examples)
+
+// WithExamplesDimension sets the dimension of embeddings. Default is 0, the default of the
+// embedding model.
+func WithExamplesDimension(dimension int) ExamplesOption {
+	return func(x *Examples) {
+		x.dimension = dimension
+	}
+}
+
+// WithExamplesMaxCount sets the maximum number of examples selected for a request. Default is
+// DefaultMaxExamples.
+func WithExamplesMaxCount(n int) ExamplesOption {
+	return func(x *Examples) {
+		x.maxExamples = n
+	}
+}
+
+// WithExamplesTokenBudget sets the maximum estimated tokens of selected examples. Examples are
+// selected in order of similarity, skipping ones exceeding the rest of the budget. Default is 0,
+// no limit.
+func WithExamplesTokenBudget(tokens int) ExamplesOption {
+	return func(x *Examples) {
+		x.maxTokens = tokens
+	}
+}
+
+// NewExamples creates an empty Examples. embedder generates embeddings of inputs of examples and
+// requests by GenerateEmbedding.
+func NewExamples(embedder LLMClient, opts ...ExamplesOption) *Examples {
+	x := &Examples{
+		embedder:    embedder,
+		maxExamples: DefaultMaxExamples,
+	}
+	for _, opt := range opts {
+		opt(x)
+	}
+	return x
+}
+
+// Add embeds the inputs of examples and stores them. An example with the ID of a stored example
+// replaces it.
+func (x *Examples) Add(ctx context.Context, examples ...Example) error {
+	if len(examples) == 0 {
+		return nil
+	}
+
+	inputs := make([]string, len(examples))
+	for i, example := range examples {
+		inputs[i] = example.Input
+	}
+	vectors, err := x.embedder.GenerateEmbedding(ctx, x.dimension, inputs)
+	if err != nil {
+		return goerr.Wrap(err, "failed to generate embeddings of examples")
+	}
+	if len(vectors) != len(examples) {
+		return goerr.New("number of embeddings does not match number of examples",
+			goerr.V("examples", len(examples)),
+			goerr.V("embeddings", len(vectors)))
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i, example := range examples {
+		if example.ID == "" {
+			example.ID = NewID(ctx)
+		}
+		example.Labels = slices.Clone(example.Labels)
+		entry := &exampleEntry{example: example, vector: vectors[i]}
+
+		idx := slices.IndexFunc(x.entries, func(e *exampleEntry) bool { return e.example.ID == example.ID })
+		if idx >= 0 {
+			x.entries[idx] = entry
+		} else {
+			x.entries = append(x.entries, entry)
+		}
+	}
+	return nil
+}
+
+// Remove removes the examples of ids. It returns the number of removed examples.
+func (x *Examples) Remove(ids ...string) int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	before := len(x.entries)
+	x.entries = slices.DeleteFunc(x.entries, func(e *exampleEntry) bool {
+		return slices.Contains(ids, e.example.ID)
+	})
+	return before - len(x.entries)
+}
+
+// List returns the stored examples in order of addition.
+func (x *Examples) List() []Example {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	examples := make([]Example, len(x.entries))
+	for i, e := range x.entries {
+		examples[i] = e.example
+	}
+	return examples
+}
+
+// Select returns the examples fitting query best, in order of embedding similarity of their
+// inputs to query. If labels are given, only examples having all of them are selected. At most
+// the max count of examples are selected within the token budget.
+func (x *Examples) Select(ctx context.Context, query string, labels ...string) ([]Example, error) {
+	x.mu.RLock()
+	candidates := make([]*exampleEntry, 0, len(x.entries))
+	for _, e := range x.entries {
+		if hasAllLabels(e.example.Labels, labels) {
+			candidates = append(candidates, e)
+		}
+	}
+	x.mu.RUnlock()
+
+	if len(candidates) == 0 || x.maxExamples <= 0 {
+		return nil, nil
+	}
+
+	vectors, err := x.embedder.GenerateEmbedding(ctx, x.dimension, []string{query})
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to generate embedding of query")
+	}
+	if len(vectors) != 1 {
+		return nil, goerr.New("number of embeddings does not match the query", goerr.V("embeddings", len(vectors)))
+	}
+
+	type scored struct {
+		entry *exampleEntry
+		score float64
+	}
+	ranked := make([]scored, len(candidates))
+	for i, e := range candidates {
+		ranked[i] = scored{entry: e, score: CosineSimilarity(vectors[0], e.vector)}
+	}
+	slices.SortStableFunc(ranked, func(a, b scored) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+
+	var selected []Example
+	remaining := x.maxTokens
+	for _, r := range ranked {
+		if len(selected) >= x.maxExamples {
+			break
+		}
+		if x.maxTokens > 0 {
+			tokens := EstimateTokens(r.entry.example.Input) + EstimateTokens(r.entry.example.Output)
+			if tokens > remaining {
+				continue
+			}
+			remaining -= tokens
+		}
+		selected = append(selected, r.entry.example)
+	}
+	return selected, nil
+}
+
+func hasAllLabels(have, want []string) bool {
+	for _, label := range want {
+		if !slices.Contains(have, label) {
+			return false
+		}
+	}
+	return true
+}
+
+type examplesConfig struct {
+	examples *Examples
+	labels   []string
+}
+
+// WithExamples injects few-shot examples into the prompt of each Execute. The examples are
+// selected by Examples.Select with the text inputs of the Execute and labels, and appended to the
+// system prompt in an "Examples" section. As the system prompt of a session is fixed at its
+// creation, the section is put before the inputs of later Executes of the agent instead. Execute
+// fails if the selection fails.
+func WithExamples(examples *Examples, labels ...string) Option {
+	return func(s *gollemConfig) {
+		s.examples = &examplesConfig{examples: examples, labels: labels}
+	}
+}
+
+// examplesPrompt returns the section of the examples selected for input, or an empty string if
+// no example is selected.
+func (c *gollemConfig) examplesPrompt(ctx context.Context, input []Input) (string, error) {
+	var texts []string
+	for _, in := range input {
+		if text, ok := in.(Text); ok {
+			texts = append(texts, string(text))
+		}
+	}
+	if len(texts) == 0 {
+		return "", nil
+	}
+
+	examples, err := c.examples.examples.Select(ctx, strings.Join(texts, "\n"), c.examples.labels...)
+	if err != nil {
+		return "", goerr.Wrap(err, "failed to select examples")
+	}
+	if len(examples) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("# Examples\n\nThe following are examples of requests and expected responses. Follow their approach and format.")
+	for _, example := range examples {
+		b.WriteString("\n\nInput: " + example.Input + "\nOutput: " + example.Output)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,148 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// keywordEmbedder embeds a text into a vector of the counts of keywords in it.
+func keywordEmbedder(keywords ...string) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		GenerateEmbeddingFunc: func(ctx context.Context, dimension int, input []string) ([][]float64, error) {
+			vectors := make([][]float64, len(input))
+			for i, text := range input {
+				vectors[i] = make([]float64, len(keywords))
+				for j, keyword := range keywords {
+					vectors[i][j] = float64(strings.Count(text, keyword))
+				}
+			}
+			return vectors, nil
+		},
+	}
+}
+
+func exampleIDs(examples []gollem.Example) []string {
+	ids := make([]string, len(examples))
+	for i, example := range examples {
+		ids[i] = example.ID
+	}
+	return ids
+}
+
+func TestExamples(t *testing.T) {
+	embedder := keywordEmbedder("domain", "ip", "hash")
+	dataset := []gollem.Example{
+		{ID: "domain", Input: "Is the domain evil.example malicious?", Output: "The domain is newly registered.", Labels: []string{"triage"}},
+		{ID: "ip", Input: "Is the ip 192.0.2.1 malicious?", Output: "The ip is a known scanner.", Labels: []string{"triage"}},
+		{ID: "hash", Input: "Is the hash abc malicious?", Output: "The hash is a known malware.", Labels: []string{"malware"}},
+		{ID: "domain-ip", Input: "Which ip does the domain resolve to?", Output: "It resolves to 192.0.2.1.", Labels: []string{"triage", "dns"}},
+	}
+
+	t.Run("select by similarity", func(t *testing.T) {
+		examples := gollem.NewExamples(embedder, gollem.WithExamplesMaxCount(2))
+		gt.NoError(t, examples.Add(t.Context(), dataset...))
+
+		selected, err := examples.Select(t.Context(), "check the domain")
+		gt.NoError(t, err)
+		gt.Equal(t, exampleIDs(selected), []string{"domain", "domain-ip"})
+	})
+
+	t.Run("select by labels", func(t *testing.T) {
+		examples := gollem.NewExamples(embedder)
+		gt.NoError(t, examples.Add(t.Context(), dataset...))
+
+		selected, err := examples.Select(t.Context(), "check the ip", "triage")
+		gt.NoError(t, err)
+		gt.Equal(t, exampleIDs(selected), []string{"ip", "domain-ip", "domain"})
+
+		selected, err = examples.Select(t.Context(), "check the ip", "triage", "dns")
+		gt.NoError(t, err)
+		gt.Equal(t, exampleIDs(selected), []string{"domain-ip"})
+
+		selected, err = examples.Select(t.Context(), "check the ip", "unknown")
+		gt.NoError(t, err)
+		gt.A(t, selected).Length(0)
+	})
+
+	t.Run("select within token budget", func(t *testing.T) {
+		long := gollem.Example{ID: "long", Input: "domain " + strings.Repeat("detail ", 200), Output: "long answer"}
+		examples := gollem.NewExamples(embedder, gollem.WithExamplesTokenBudget(30))
+		gt.NoError(t, examples.Add(t.Context(), long, dataset[0], dataset[1]))
+
+		// the long example is the most similar, but skipped for the budget
+		selected, err := examples.Select(t.Context(), "domain")
+		gt.NoError(t, err)
+		gt.A(t, selected).Has(dataset[0])
+		for _, example := range selected {
+			gt.True(t, example.ID != "long")
+		}
+	})
+
+	t.Run("add, replace and remove at runtime", func(t *testing.T) {
+		examples := gollem.NewExamples(embedder)
+		gt.NoError(t, examples.Add(t.Context(), dataset[0], dataset[1]))
+		gt.NoError(t, examples.Add(t.Context(), gollem.Example{Input: "Is the hash def malicious?", Output: "unknown"}))
+
+		replaced := dataset[0]
+		replaced.Output = "The domain is a parked domain."
+		gt.NoError(t, examples.Add(t.Context(), replaced))
+
+		list := examples.List()
+		gt.A(t, list).Length(3)
+		gt.Equal(t, list[0].Output, "The domain is a parked domain.")
+		gt.True(t, list[2].ID != "")
+
+		gt.Equal(t, examples.Remove("ip", "missing"), 1)
+		gt.Equal(t, exampleIDs(examples.List()), []string{"domain", list[2].ID})
+	})
+}
+
+func TestWithExamples(t *testing.T) {
+	var sessionCfg gollem.SessionConfig
+	var inputs [][]gollem.Input
+	client := keywordEmbedder("domain", "ip", "hash")
+	client.NewSessionFunc = func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+		sessionCfg = gollem.NewSessionConfig(options...)
+		return &mock.SessionMock{
+			GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+				inputs = append(inputs, input)
+				return &gollem.Response{Texts: []string{"done"}}, nil
+			},
+			HistoryFunc: func() (*gollem.History, error) {
+				return &gollem.History{}, nil
+			},
+		}, nil
+	}
+
+	examples := gollem.NewExamples(client, gollem.WithExamplesMaxCount(1))
+	gt.NoError(t, examples.Add(t.Context(),
+		gollem.Example{ID: "domain", Input: "Is the domain evil.example malicious?", Output: "The domain is newly registered."},
+		gollem.Example{ID: "hash", Input: "Is the hash abc malicious?", Output: "The hash is a known malware."},
+	))
+
+	agent := gollem.New(client,
+		gollem.WithSystemPrompt("You are a security analyst."),
+		gollem.WithExamples(examples),
+	)
+
+	// examples of the first Execute are in the system prompt
+	_, err := agent.Execute(t.Context(), gollem.Text("check the domain bad.example"))
+	gt.NoError(t, err)
+	prompt := sessionCfg.SystemPrompt()
+	gt.True(t, strings.HasPrefix(prompt, "You are a security analyst.\n\n# Examples"))
+	gt.True(t, strings.Contains(prompt, "Input: Is the domain evil.example malicious?\nOutput: The domain is newly registered."))
+	gt.False(t, strings.Contains(prompt, "hash"))
+	gt.Equal(t, inputs[0], []gollem.Input{gollem.Text("check the domain bad.example")})
+
+	// examples of later Executes are put before the inputs
+	_, err = agent.Execute(t.Context(), gollem.Text("check the hash xyz"))
+	gt.NoError(t, err)
+	gt.A(t, inputs[1]).Length(2)
+	gt.True(t, strings.Contains(string(inputs[1][0].(gollem.Text)), "Input: Is the hash abc malicious?"))
+	gt.Equal(t, inputs[1][1], gollem.Input(gollem.Text("check the hash xyz")))
+}
@@ -0,0 +1,148 @@
+package gollem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// FileExtractor extracts text of a file for a model that can not read the file, e.g. with a
+// library parsing PDFs or office documents. Return an error wrapping ErrUnsupportedInput for
+// files that it can not extract; they are sent as they are, and the request fails with the
+// error of the provider if any file is left.
+type FileExtractor func(ctx context.Context, file File) (string, error)
+
+// ExtractFileText is the default FileExtractor. It returns the data of text files as it is.
+func ExtractFileText(ctx context.Context, file File) (string, error) {
+	if !file.IsText() {
+		return "", goerr.Wrap(ErrUnsupportedInput, "text of the file can not be extracted", goerr.V("mime_type", file.MimeType()))
+	}
+	if !utf8.Valid(file.Data()) {
+		return "", goerr.New("text file is not UTF-8", goerr.V("name", file.Name()))
+	}
+	return string(file.Data()), nil
+}
+
+// FileFallbackEvent is recorded to the trace when a file is converted to text.
+type FileFallbackEvent struct {
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mime_type"`
+}
+
+// WithFileFallbackExtractor sets the extractor of text of files rejected by the provider with
+// ErrUnsupportedInput, e.g. any file for OpenAI, or office documents for Claude. Then the
+// files of the request are replaced with their text and the request is sent again; the text is
+// kept in the history instead of the files. ExtractFileText, extracting text files, is used by
+// default. A nil extractor disables the fallback. Extractors for binary documents can fall back
+// to ExtractFileText for text files.
+func WithFileFallbackExtractor(extractor FileExtractor) Option {
+	return func(s *gollemConfig) {
+		s.fileExtractor = extractor
+		s.fileExtractorSet = true
+	}
+}
+
+// fileFallback converts files to text through content middlewares.
+type fileFallback struct {
+	extractor FileExtractor
+}
+
+// newFileFallback returns the fallback of the config, or nil if it's disabled.
+func newFileFallback(cfg *gollemConfig) *fileFallback {
+	if !cfg.fileExtractorSet {
+		return &fileFallback{extractor: ExtractFileText}
+	}
+	if cfg.fileExtractor == nil {
+		return nil
+	}
+	return &fileFallback{extractor: cfg.fileExtractor}
+}
+
+// convert replaces files of req with their text. Files that the extractor does not support are
+// kept. It returns false if no file is converted.
+func (f *fileFallback) convert(ctx context.Context, req *ContentRequest) (bool, error) {
+	var inputs []Input
+	converted := false
+	for i, input := range req.Inputs {
+		file, ok := input.(File)
+		if !ok {
+			if inputs != nil {
+				inputs = append(inputs, input)
+			}
+			continue
+		}
+
+		text, err := f.extractor(ctx, file)
+		if errors.Is(err, ErrUnsupportedInput) {
+			if inputs != nil {
+				inputs = append(inputs, input)
+			}
+			continue
+		}
+		if err != nil {
+			return false, goerr.Wrap(err, "failed to extract text of file", goerr.V("name", file.Name()), goerr.V("mime_type", file.MimeType()))
+		}
+
+		if inputs == nil {
+			// req.Inputs may be shared with the caller, so it's not modified
+			inputs = slices.Clone(req.Inputs[:i])
+		}
+		inputs = append(inputs, Text(fileText(file.Name(), file.MimeType(), text)))
+		converted = true
+
+		if h := trace.HandlerFrom(ctx); h != nil {
+			h.AddEvent(ctx, "file_fallback", &FileFallbackEvent{Name: file.Name(), MimeType: file.MimeType()})
+		}
+	}
+	if converted {
+		req.Inputs = inputs
+	}
+	return converted, nil
+}
+
+// fileText is the text sent in place of a file.
+func fileText(name, mimeType, text string) string {
+	if name == "" {
+		return fmt.Sprintf("[File (%s)]\n%s", mimeType, text)
+	}
+	return fmt.Sprintf("[File: %s (%s)]\n%s", name, mimeType, text)
+}
+
+func (f *fileFallback) blockMiddleware(next ContentBlockHandler) ContentBlockHandler {
+	return func(ctx context.Context, req *ContentRequest) (*ContentResponse, error) {
+		resp, err := next(ctx, req)
+		if !errors.Is(err, ErrUnsupportedInput) {
+			return resp, err
+		}
+		converted, convErr := f.convert(ctx, req)
+		if convErr != nil {
+			return nil, convErr
+		}
+		if !converted {
+			return resp, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (f *fileFallback) streamMiddleware(next ContentStreamHandler) ContentStreamHandler {
+	return func(ctx context.Context, req *ContentRequest) (<-chan *ContentResponse, error) {
+		ch, err := next(ctx, req)
+		if !errors.Is(err, ErrUnsupportedInput) {
+			return ch, err
+		}
+		converted, convErr := f.convert(ctx, req)
+		if convErr != nil {
+			return nil, convErr
+		}
+		if !converted {
+			return ch, err
+		}
+		return next(ctx, req)
+	}
+}
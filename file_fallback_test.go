@@ -0,0 +1,90 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestFileFallback(t *testing.T) {
+	csv, err := gollem.NewFile([]byte("a,b\n1,2\n"), "text/csv", gollem.WithFileName("data.csv"))
+	gt.NoError(t, err)
+	docx, err := gollem.NewFile([]byte{0x50, 0x4b, 0x03, 0x04}, "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	gt.NoError(t, err)
+
+	// newClient returns a client generating like a provider that can not read any file
+	newClient := func(sent *[][]gollem.Input) gollem.LLMClient {
+		return newMiddlewareClient(func(inputs []gollem.Input) (*gollem.Response, error) {
+			*sent = append(*sent, inputs)
+			for _, input := range inputs {
+				if _, ok := input.(gollem.File); ok {
+					return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "file is not supported")
+				}
+			}
+			return &gollem.Response{Texts: []string{"ok"}}, nil
+		})
+	}
+
+	t.Run("text file is converted by default", func(t *testing.T) {
+		var sent [][]gollem.Input
+		agent := gollem.New(newClient(&sent))
+		_, err := agent.Execute(t.Context(), gollem.Text("Sum b"), csv)
+		gt.NoError(t, err)
+
+		gt.A(t, sent).Length(2)
+		gt.Equal[gollem.Input](t, gollem.Text("Sum b"), sent[1][0])
+		gt.Equal[gollem.Input](t, gollem.Text("[File: data.csv (text/csv)]\na,b\n1,2\n"), sent[1][1])
+		// inputs of the first request are not modified
+		gt.Equal[gollem.Input](t, csv, sent[0][1])
+	})
+
+	t.Run("unsupported file is kept", func(t *testing.T) {
+		var sent [][]gollem.Input
+		agent := gollem.New(newClient(&sent))
+		_, err := agent.Execute(t.Context(), docx)
+		gt.Error(t, err).Is(gollem.ErrUnsupportedInput)
+		gt.A(t, sent).Length(1)
+	})
+
+	t.Run("custom extractor", func(t *testing.T) {
+		var sent [][]gollem.Input
+		var extracted []string
+		agent := gollem.New(newClient(&sent), gollem.WithFileFallbackExtractor(func(ctx context.Context, file gollem.File) (string, error) {
+			extracted = append(extracted, file.MimeType())
+			if strings.HasPrefix(file.MimeType(), "application/vnd.openxmlformats") {
+				return "document text", nil
+			}
+			return gollem.ExtractFileText(ctx, file)
+		}))
+		_, err := agent.Execute(t.Context(), docx, csv)
+		gt.NoError(t, err)
+
+		gt.A(t, sent).Length(2)
+		gt.A(t, extracted).Length(2)
+		gt.Equal[gollem.Input](t, gollem.Text("[File (application/vnd.openxmlformats-officedocument.wordprocessingml.document)]\ndocument text"), sent[1][0])
+		gt.Equal[gollem.Input](t, gollem.Text("[File: data.csv (text/csv)]\na,b\n1,2\n"), sent[1][1])
+	})
+
+	t.Run("extractor error", func(t *testing.T) {
+		var sent [][]gollem.Input
+		agent := gollem.New(newClient(&sent), gollem.WithFileFallbackExtractor(func(ctx context.Context, file gollem.File) (string, error) {
+			return "", goerr.New("broken document")
+		}))
+		_, err := agent.Execute(t.Context(), csv)
+		gt.Error(t, err)
+		gt.S(t, err.Error()).Contains("broken document")
+		gt.A(t, sent).Length(1)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var sent [][]gollem.Input
+		agent := gollem.New(newClient(&sent), gollem.WithFileFallbackExtractor(nil))
+		_, err := agent.Execute(t.Context(), csv)
+		gt.Error(t, err).Is(gollem.ErrUnsupportedInput)
+		gt.A(t, sent).Length(1)
+	})
+}
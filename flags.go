@@ -0,0 +1,130 @@
+package gollem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// Flags is a set of feature flags for an execution. A flag that is not set is disabled.
+type Flags map[string]bool
+
+// Enabled returns true if the flag is enabled.
+func (f Flags) Enabled(name string) bool {
+	return f[name]
+}
+
+// Match evaluates a flag condition. A condition is a flag name, or a flag name
+// prefixed with "!" that matches when the flag is disabled.
+func (f Flags) Match(cond string) bool {
+	if name, ok := strings.CutPrefix(cond, "!"); ok {
+		return !f.Enabled(name)
+	}
+	return f.Enabled(cond)
+}
+
+type flagsCtxKey struct{}
+
+// ContextWithFlags returns a context carrying per-request feature flags. When the context is
+// passed to Agent.Execute, the flags override the ones set by WithFlags for the same name. If
+// the flags change the flagged tools or the system prompt of the current session, the session
+// is rebuilt with its history.
+func ContextWithFlags(ctx context.Context, flags map[string]bool) context.Context {
+	merged := Flags{}
+	maps.Copy(merged, FlagsFromContext(ctx))
+	maps.Copy(merged, flags)
+	return context.WithValue(ctx, flagsCtxKey{}, merged)
+}
+
+// FlagsFromContext returns the feature flags in the context. Within Agent.Execute (e.g. in
+// Tool.Run), it returns the effective flags of the execution. It never returns nil.
+func FlagsFromContext(ctx context.Context) Flags {
+	if flags, ok := ctx.Value(flagsCtxKey{}).(Flags); ok {
+		return flags
+	}
+	return Flags{}
+}
+
+// FlagsEvent is recorded in the trace when an execution has feature flags.
+type FlagsEvent struct {
+	Flags map[string]bool `json:"flags"`
+}
+
+type flaggedTools struct {
+	cond  string
+	tools []Tool
+}
+
+// WithFlags sets the default feature flags of the agent. Flags can be overridden per
+// request with ContextWithFlags.
+func WithFlags(flags map[string]bool) Option {
+	return func(s *gollemConfig) {
+		if s.flags == nil {
+			s.flags = Flags{}
+		}
+		maps.Copy(s.flags, flags)
+	}
+}
+
+// WithFlaggedTools adds tools that are exposed to the LLM only when the flag condition
+// matches. See Flags.Match for the condition syntax.
+func WithFlaggedTools(cond string, tools ...Tool) Option {
+	return func(s *gollemConfig) {
+		s.flaggedTools = append(s.flaggedTools, flaggedTools{cond: cond, tools: tools})
+	}
+}
+
+// WithSystemPromptTemplate sets the system prompt as a Go text/template string. It is rendered
+// at the beginning of each Execute with the effective flags, e.g.
+// {{if .Flags.concise}}Answer briefly.{{end}}. It takes precedence over WithSystemPrompt.
+func WithSystemPromptTemplate(tmpl string) Option {
+	return func(s *gollemConfig) {
+		s.systemPromptTemplate = tmpl
+	}
+}
+
+// promptTemplateData is the data passed to the system prompt template.
+type promptTemplateData struct {
+	Flags Flags
+}
+
+// applyFlags resolves the effective flags of an execution and applies them to the config:
+// flagged tools are added and the system prompt template is rendered. It also sets
+// flagState, which changes when the flags change the tools or the system prompt. It must be
+// called on a cloned config.
+func (c *gollemConfig) applyFlags(ctx context.Context) (Flags, error) {
+	flags := Flags{}
+	maps.Copy(flags, c.flags)
+	maps.Copy(flags, FlagsFromContext(ctx))
+
+	var state strings.Builder
+	for i, ft := range c.flaggedTools {
+		if flags.Match(ft.cond) {
+			c.tools = append(slices.Clip(c.tools), ft.tools...)
+			fmt.Fprintf(&state, "%d,", i)
+		}
+	}
+
+	if c.systemPromptTemplate != "" {
+		tmpl, err := template.New("system_prompt").Option("missingkey=zero").Parse(c.systemPromptTemplate)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to parse system prompt template")
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, promptTemplateData{Flags: flags}); err != nil {
+			return nil, goerr.Wrap(err, "failed to render system prompt template")
+		}
+		c.systemPrompt = buf.String()
+		state.WriteString("\x00" + c.systemPrompt)
+	}
+
+	c.flags = flags
+	c.flagState = state.String()
+	return flags, nil
+}
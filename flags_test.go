@@ -0,0 +1,165 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func TestFlagsMatch(t *testing.T) {
+	flags := gollem.Flags{"beta": true, "legacy": false}
+
+	gt.True(t, flags.Match("beta"))
+	gt.False(t, flags.Match("legacy"))
+	gt.False(t, flags.Match("unknown"))
+	gt.False(t, flags.Match("!beta"))
+	gt.True(t, flags.Match("!legacy"))
+	gt.True(t, flags.Match("!unknown"))
+}
+
+func TestContextWithFlags(t *testing.T) {
+	gt.Equal(t, gollem.Flags{}, gollem.FlagsFromContext(t.Context()))
+
+	ctx := gollem.ContextWithFlags(t.Context(), map[string]bool{"a": true, "b": true})
+	ctx = gollem.ContextWithFlags(ctx, map[string]bool{"b": false})
+	gt.Equal(t, gollem.Flags{"a": true, "b": false}, gollem.FlagsFromContext(ctx))
+}
+
+func TestAgentFlags(t *testing.T) {
+	var sessionCfg gollem.SessionConfig
+	var toolFlags gollem.Flags
+
+	calls := 0
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			sessionCfg = gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					if calls == 1 {
+						return &gollem.Response{
+							FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "search_v2"}},
+						}, nil
+					}
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+				AppendHistoryFunc: func(*gollem.History) error { return nil },
+			}, nil
+		},
+	}
+
+	newTool := func(name string) *mock.ToolMock {
+		return &mock.ToolMock{
+			SpecFunc: func() gollem.ToolSpec {
+				return gollem.ToolSpec{Name: name, Description: name}
+			},
+			RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				toolFlags = gollem.FlagsFromContext(ctx)
+				return map[string]any{}, nil
+			},
+		}
+	}
+
+	rec := trace.New()
+	agent := gollem.New(client,
+		gollem.WithFlags(map[string]bool{"search_v2": false, "concise": true}),
+		gollem.WithFlaggedTools("search_v2", newTool("search_v2")),
+		gollem.WithFlaggedTools("!search_v2", newTool("search_v1")),
+		gollem.WithSystemPromptTemplate("You are helpful.{{if .Flags.concise}} Answer briefly.{{end}}"),
+		gollem.WithTrace(rec),
+	)
+
+	ctx := gollem.ContextWithFlags(t.Context(), map[string]bool{"search_v2": true})
+	_, err := agent.Execute(ctx, gollem.Text("hello"))
+	gt.NoError(t, err)
+
+	gt.Equal(t, "You are helpful. Answer briefly.", sessionCfg.SystemPrompt())
+	gt.A(t, sessionCfg.Tools()).Length(1)
+	gt.Equal(t, "search_v2", sessionCfg.Tools()[0].Spec().Name)
+	gt.Equal(t, gollem.Flags{"search_v2": true, "concise": true}, toolFlags)
+
+	var flagsEvent *gollem.FlagsEvent
+	for _, span := range rec.Trace().RootSpan.Children {
+		if span.Event != nil && span.Event.Kind == "flags" {
+			flagsEvent = span.Event.Data.(*gollem.FlagsEvent)
+		}
+	}
+	gt.NotNil(t, flagsEvent)
+	gt.Equal(t, map[string]bool{"search_v2": true, "concise": true}, flagsEvent.Flags)
+}
+
+func TestAgentFlagsInvalidTemplate(t *testing.T) {
+	client := &mock.LLMClientMock{}
+	agent := gollem.New(client, gollem.WithSystemPromptTemplate("{{if}}"))
+
+	_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.Error(t, err)
+	gt.A(t, client.NewSessionCalls()).Length(0)
+}
+
+func TestAgentFlagsChangeBetweenExecutes(t *testing.T) {
+	var sessionCfgs []gollem.SessionConfig
+	var historyLens []int
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			sessionCfgs = append(sessionCfgs, cfg)
+			history := &gollem.History{}
+			if cfg.History() != nil {
+				history = cfg.History()
+			}
+			historyLens = append(historyLens, len(history.Messages))
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					history.Messages = append(history.Messages, gollem.Message{Role: gollem.RoleUser})
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return history, nil
+				},
+				AppendHistoryFunc: func(*gollem.History) error { return nil },
+			}, nil
+		},
+	}
+
+	newTool := func(name string) *mock.ToolMock {
+		return &mock.ToolMock{
+			SpecFunc: func() gollem.ToolSpec {
+				return gollem.ToolSpec{Name: name, Description: name}
+			},
+		}
+	}
+
+	agent := gollem.New(client,
+		gollem.WithFlaggedTools("beta", newTool("search_v2")),
+		gollem.WithSystemPromptTemplate("You are helpful.{{if .Flags.concise}} Answer briefly.{{end}}"),
+	)
+
+	_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.A(t, sessionCfgs).Length(1)
+	gt.Equal(t, "You are helpful.", sessionCfgs[0].SystemPrompt())
+	gt.A(t, sessionCfgs[0].Tools()).Length(0)
+
+	// The same flags keep the session
+	_, err = agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.A(t, sessionCfgs).Length(1)
+
+	// Changed flags rebuild the session with the history
+	ctx := gollem.ContextWithFlags(t.Context(), map[string]bool{"beta": true, "concise": true})
+	_, err = agent.Execute(ctx, gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.A(t, sessionCfgs).Length(2)
+	gt.Equal(t, "You are helpful. Answer briefly.", sessionCfgs[1].SystemPrompt())
+	gt.A(t, sessionCfgs[1].Tools()).Length(1)
+	gt.Equal(t, "search_v2", sessionCfgs[1].Tools()[0].Spec().Name)
+	gt.Equal(t, []int{0, 2}, historyLens)
+}
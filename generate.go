@@ -1,5 +1,7 @@
 package gollem
 
+import "context"
+
 // GenerateOption configures a single Generate/Stream call.
 // Options override session-level defaults for that call only.
 //
@@ -18,6 +20,8 @@ type generateConfig struct {
 	temperature    *float64
 	topP           *float64
 	maxTokens      *int
+	stopSequences  []string
+	toolChoice     *ToolChoice
 }
 
 // NewGenerateConfig creates a generateConfig from the given options.
@@ -50,6 +54,11 @@ func (c *generateConfig) MaxTokens() *int {
 	return c.maxTokens
 }
 
+// StopSequences returns the per-call stop sequences override, or nil if not set.
+func (c *generateConfig) StopSequences() []string {
+	return c.stopSequences
+}
+
 // WithGenerateResponseSchema sets the response schema for a single Generate/Stream call.
 func WithGenerateResponseSchema(schema *Parameter) GenerateOption {
 	return func(cfg *generateConfig) {
@@ -77,3 +86,32 @@ func WithMaxTokens(n int) GenerateOption {
 		cfg.maxTokens = &n
 	}
 }
+
+// WithStopSequences sets the sequences stopping the generation for a single Generate/Stream call.
+// The sequences replace those of the session, and are not included in the response.
+func WithStopSequences(sequences ...string) GenerateOption {
+	return func(cfg *generateConfig) {
+		cfg.stopSequences = sequences
+	}
+}
+
+type generateOptionsCtxKey struct{}
+
+// ContextWithGenerateOptions returns a context that sets generation parameters of
+// Agent.Execute, e.g. gollem.WithTemperature(0.2) for a deterministic turn. The options apply
+// to every LLM call of the agent loop in the execution, overriding the session defaults, and
+// options set by the strategy take precedence over them. Tools and sub-agents run by the
+// execution do not inherit them.
+func ContextWithGenerateOptions(ctx context.Context, opts ...GenerateOption) context.Context {
+	return context.WithValue(ctx, generateOptionsCtxKey{}, opts)
+}
+
+// generateOptionsFromContext returns the options set by ContextWithGenerateOptions and a
+// context without them.
+func generateOptionsFromContext(ctx context.Context) ([]GenerateOption, context.Context) {
+	opts, ok := ctx.Value(generateOptionsCtxKey{}).([]GenerateOption)
+	if !ok || len(opts) == 0 {
+		return nil, ctx
+	}
+	return opts, context.WithValue(ctx, generateOptionsCtxKey{}, []GenerateOption(nil))
+}
@@ -0,0 +1,150 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// DefaultResponseRepairAttempts is the default number of repairs of GenerateWithSchema and
+// GenerateStruct.
+const DefaultResponseRepairAttempts = defaultMaxRetry
+
+type responseRepairCtxKey struct{}
+
+// ContextWithResponseRepair returns a context setting the maximum number of times
+// GenerateWithSchema and GenerateStruct ask the LLM to repair a response violating the schema.
+// 0 disables repair. The default is DefaultResponseRepairAttempts.
+func ContextWithResponseRepair(ctx context.Context, attempts int) context.Context {
+	return context.WithValue(ctx, responseRepairCtxKey{}, max(attempts, 0))
+}
+
+func responseRepairFrom(ctx context.Context) int {
+	if attempts, ok := ctx.Value(responseRepairCtxKey{}).(int); ok {
+		return attempts
+	}
+	return DefaultResponseRepairAttempts
+}
+
+// GenerateWithSchema calls session.Generate with the response schema and validates the JSON
+// response against it on the client side, because providers don't always follow the schema of
+// WithSessionResponseSchema. A violating response is repaired by feeding the validation error
+// back to the LLM in the same session, up to the attempts of ContextWithResponseRepair. It
+// returns the valid response, whose tokens include all attempts, or an error wrapping
+// ErrResponseSchemaViolation. A response with function calls is returned without validation.
+func GenerateWithSchema(ctx context.Context, session Session, schema *Parameter, input ...Input) (*Response, error) {
+	if session == nil {
+		return nil, goerr.New("session must not be nil")
+	}
+	if schema == nil {
+		return nil, goerr.New("schema must not be nil")
+	}
+
+	return generateRepaired(ctx, session, schema, input, responseRepairFrom(ctx), nil,
+		WithGenerateResponseSchema(schema))
+}
+
+// GenerateStruct generates a response of the JSON schema of T in session and unmarshals it into
+// T, repairing responses violating the schema like GenerateWithSchema. Unlike SessionQuery, it
+// takes any inputs, e.g. images or tool responses.
+//
+// Example:
+//
+//	type Verdict struct {
+//	    Malicious bool   `json:"malicious"`
+//	    Reason    string `json:"reason"`
+//	}
+//	verdict, err := gollem.GenerateStruct[Verdict](ctx, session, gollem.Text("Judge the log"))
+func GenerateStruct[T any](ctx context.Context, session Session, input ...Input) (*T, error) {
+	if session == nil {
+		return nil, goerr.New("session must not be nil")
+	}
+	schema, err := ToSchema(*new(T))
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to generate schema from type parameter")
+	}
+
+	var result T
+	decode := func(text string) error {
+		// Fields of a violating response must not remain in the result
+		result = *new(T)
+		return json.Unmarshal([]byte(text), &result)
+	}
+	if _, err := generateRepaired(ctx, session, schema, input, responseRepairFrom(ctx), decode,
+		WithGenerateResponseSchema(schema)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// generateRepaired is the repair loop of GenerateWithSchema, GenerateStruct, Query and
+// SessionQuery. It validates the JSON text of each response against schema, decodes it by decode
+// if not nil, and feeds the error back up to maxRepair times. It returns the valid response with
+// the tokens of all attempts.
+func generateRepaired(ctx context.Context, session Session, schema *Parameter, input []Input, maxRepair int, decode func(text string) error, genOpts ...GenerateOption) (*Response, error) {
+	var totalInputToken, totalOutputToken int
+
+	for attempt := range maxRepair + 1 {
+		resp, err := session.Generate(ctx, input, genOpts...)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to generate content",
+				goerr.V("attempt", attempt+1),
+			)
+		}
+
+		RecordUsage(ctx, resp)
+		totalInputToken += resp.InputToken
+		totalOutputToken += resp.OutputToken
+		resp.InputToken, resp.OutputToken = totalInputToken, totalOutputToken
+
+		if len(resp.Texts) == 0 {
+			if len(resp.FunctionCalls) > 0 && decode == nil {
+				return resp, nil
+			}
+			return nil, goerr.New("no text in response",
+				goerr.V("attempt", attempt+1),
+			)
+		}
+
+		jsonText := strings.Join(resp.Texts, "")
+		violation := validateResponseJSON(schema, jsonText)
+		if violation == nil && decode != nil {
+			violation = decode(jsonText)
+		}
+		if violation == nil {
+			return resp, nil
+		}
+
+		if attempt < maxRepair {
+			input = []Input{
+				Text(fmt.Sprintf(
+					"Your previous response was not valid JSON matching the schema. Error: %s\nYour response was: %s\nPlease respond with valid JSON matching the schema.",
+					violation.Error(), jsonText,
+				)),
+			}
+			continue
+		}
+		return nil, goerr.Wrap(violation, "response failed schema validation after repairs",
+			goerr.V("attempts", maxRepair+1),
+			goerr.V("response", jsonText),
+		).Wrap(ErrResponseSchemaViolation)
+	}
+
+	// unreachable, but satisfy the compiler
+	return nil, goerr.New("unexpected: repair loop completed without result")
+}
+
+// validateResponseJSON returns an error if text is not JSON or does not match schema.
+func validateResponseJSON(schema *Parameter, text string) error {
+	var raw any
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return goerr.Wrap(err, "response is not valid JSON")
+	}
+	if err := schema.ValidateValue("root", raw); err != nil {
+		return err
+	}
+	return nil
+}
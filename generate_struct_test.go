@@ -0,0 +1,111 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+type testVerdict struct {
+	Severity string `json:"severity" enum:"low,high" required:"true"`
+	Reason   string `json:"reason"`
+}
+
+// newSequenceSession returns a session answering texts in order, recording the inputs of calls.
+func newSequenceSession(inputs *[][]gollem.Input, texts ...string) *mock.SessionMock {
+	return &mock.SessionMock{
+		GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+			*inputs = append(*inputs, input)
+			text := texts[min(len(*inputs), len(texts))-1]
+			return &gollem.Response{Texts: []string{text}, InputToken: 10, OutputToken: 2}, nil
+		},
+	}
+}
+
+func TestGenerateStruct(t *testing.T) {
+	t.Run("response violating the schema is repaired", func(t *testing.T) {
+		var inputs [][]gollem.Input
+		session := newSequenceSession(&inputs,
+			`{"severity":"critical","reason":"bad enum"}`,
+			`{"severity":"high"}`,
+		)
+
+		verdict, err := gollem.GenerateStruct[testVerdict](t.Context(), session, gollem.Text("judge"), gollem.Text("log"))
+		gt.NoError(t, err)
+		gt.Equal(t, testVerdict{Severity: "high"}, *verdict)
+		gt.A(t, inputs).Length(2)
+		gt.Equal(t, []gollem.Input{gollem.Text("judge"), gollem.Text("log")}, inputs[0])
+		gt.True(t, strings.Contains(inputs[1][0].String(), `{"severity":"critical","reason":"bad enum"}`))
+
+		// The schema of T is given per call
+		cfg := gollem.NewGenerateConfig(session.GenerateCalls()[0].Opts...)
+		gt.NotNil(t, cfg.ResponseSchema())
+	})
+
+	t.Run("fails after repairs of the context", func(t *testing.T) {
+		var inputs [][]gollem.Input
+		session := newSequenceSession(&inputs, `{"reason":"missing severity"}`)
+
+		ctx := gollem.ContextWithResponseRepair(t.Context(), 1)
+		_, err := gollem.GenerateStruct[testVerdict](ctx, session, gollem.Text("judge"))
+		gt.Error(t, err).Is(gollem.ErrResponseSchemaViolation)
+		gt.A(t, inputs).Length(2)
+
+		inputs = nil
+		_, err = gollem.GenerateStruct[testVerdict](gollem.ContextWithResponseRepair(t.Context(), 0), session, gollem.Text("judge"))
+		gt.Error(t, err).Is(gollem.ErrResponseSchemaViolation)
+		gt.A(t, inputs).Length(1)
+	})
+
+	t.Run("invalid JSON is repaired", func(t *testing.T) {
+		var inputs [][]gollem.Input
+		session := newSequenceSession(&inputs, "```json\n{}", `{"severity":"low","reason":"ok"}`)
+
+		verdict, err := gollem.GenerateStruct[testVerdict](t.Context(), session, gollem.Text("judge"))
+		gt.NoError(t, err)
+		gt.Equal(t, "low", verdict.Severity)
+		gt.Equal(t, "ok", verdict.Reason)
+	})
+
+	t.Run("nil session", func(t *testing.T) {
+		_, err := gollem.GenerateStruct[testVerdict](t.Context(), nil, gollem.Text("judge"))
+		gt.Error(t, err)
+	})
+}
+
+func TestGenerateWithSchema(t *testing.T) {
+	schema, err := gollem.ToSchema(testVerdict{})
+	gt.NoError(t, err)
+
+	t.Run("tokens of all attempts are counted", func(t *testing.T) {
+		var inputs [][]gollem.Input
+		session := newSequenceSession(&inputs, `{"severity":"medium"}`, `{"severity":"low"}`)
+
+		resp, err := gollem.GenerateWithSchema(t.Context(), session, schema, gollem.Text("judge"))
+		gt.NoError(t, err)
+		gt.Equal(t, []string{`{"severity":"low"}`}, resp.Texts)
+		gt.Equal(t, 20, resp.InputToken)
+		gt.Equal(t, 4, resp.OutputToken)
+	})
+
+	t.Run("function calls are returned without validation", func(t *testing.T) {
+		session := &mock.SessionMock{
+			GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+				return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "lookup"}}}, nil
+			},
+		}
+		resp, err := gollem.GenerateWithSchema(t.Context(), session, schema, gollem.Text("judge"))
+		gt.NoError(t, err)
+		gt.A(t, resp.FunctionCalls).Length(1)
+	})
+
+	t.Run("schema is required", func(t *testing.T) {
+		var inputs [][]gollem.Input
+		_, err := gollem.GenerateWithSchema(t.Context(), newSequenceSession(&inputs, "{}"), nil, gollem.Text("judge"))
+		gt.Error(t, err)
+	})
+}
@@ -339,3 +339,62 @@ func TestAgentExecuteUsesGenerateWithSliceInput(t *testing.T) {
 	gt.Value(t, len(receivedInputs[0])).Equal(1)
 	gt.Value(t, string(receivedInputs[0][0].(gollem.Text))).Equal("hello agent")
 }
+
+func TestGenerateConfigWithStopSequences(t *testing.T) {
+	cfg := gollem.NewGenerateConfig(gollem.WithStopSequences("END", "STOP"))
+	gt.Equal(t, []string{"END", "STOP"}, cfg.StopSequences())
+
+	empty := gollem.NewGenerateConfig()
+	gt.Nil(t, empty.StopSequences())
+}
+
+func TestSessionGenerateOptions(t *testing.T) {
+	cfg := gollem.NewSessionConfig(
+		gollem.WithSessionTemperature(0.7),
+		gollem.WithSessionTopP(0.9),
+		gollem.WithSessionMaxTokens(200),
+		gollem.WithSessionStopSequences("END"),
+	)
+	gt.A(t, cfg.GenerateOptions()).Length(4)
+
+	// Per-call options are appended after the session defaults and win.
+	genCfg := gollem.NewGenerateConfig(append(cfg.GenerateOptions(), gollem.WithTemperature(0.1))...)
+	gt.Value(t, *genCfg.Temperature()).Equal(0.1)
+	gt.Value(t, *genCfg.TopP()).Equal(0.9)
+	gt.Value(t, *genCfg.MaxTokens()).Equal(200)
+	gt.Equal(t, []string{"END"}, genCfg.StopSequences())
+}
+
+func TestExecuteGenerateOptions(t *testing.T) {
+	var receivedOpts [][]gollem.GenerateOption
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					receivedOpts = append(receivedOpts, opts)
+					return &gollem.Response{Texts: []string{"ok"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	agent := gollem.New(client)
+	ctx := gollem.ContextWithGenerateOptions(t.Context(), gollem.WithTemperature(0.2), gollem.WithStopSequences("END"))
+	_, err := agent.Execute(ctx, gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.A(t, receivedOpts).Length(1)
+
+	cfg := gollem.NewGenerateConfig(receivedOpts[0]...)
+	gt.Value(t, *cfg.Temperature()).Equal(0.2)
+	gt.Equal(t, []string{"END"}, cfg.StopSequences())
+
+	// The overrides apply only to the Execute call that received them.
+	_, err = agent.Execute(t.Context(), gollem.Text("hello again"))
+	gt.NoError(t, err)
+	gt.A(t, receivedOpts).Length(2)
+	next := gollem.NewGenerateConfig(receivedOpts[1]...)
+	gt.Nil(t, next.Temperature())
+}
@@ -1,12 +1,15 @@
 package gollem
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"log/slog"
+	"maps"
+	"slices"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem/trace"
 )
@@ -38,6 +41,27 @@ type Agent struct {
 	// This field should only be accessed through session management methods
 	// WARNING: Direct access is not thread-safe
 	currentSession Session
+
+	// lastExec holds the state of the latest Execute for Snapshot
+	lastExec *execRecord
+
+	// usage accumulates the token usage of all Execute calls
+	usage *UsageTracker
+
+	// sessionID identifies the agent in usage reports if WithHistoryRepository is not set
+	sessionID string
+
+	// historyFlusher saves the history to the repository of WithHistoryRepository
+	historyFlusher *historyFlusher
+
+	// pausedState holds the execution paused for calls of DeferredTool
+	pausedState *pausedState
+
+	// defaultToolGrants holds the tools granted for the session unless WithToolGrants is set
+	defaultToolGrants *ToolGrants
+
+	// sessionFlagState is the flagState of the config the current session is created with
+	sessionFlagState string
 }
 
 // Session returns the current session for the agent.
@@ -47,6 +71,12 @@ func (x *Agent) Session() Session {
 	return x.currentSession
 }
 
+// Usage returns the token usage accumulated over all Execute calls of the agent, including LLM
+// calls of the strategy, middlewares and subagents, with the breakdown by phase.
+func (x *Agent) Usage() *Usage {
+	return x.usage.Usage()
+}
+
 const (
 	DefaultLoopLimit = 128
 )
@@ -80,10 +110,117 @@ type gollemConfig struct {
 	// disableArgsValidation disables automatic argument validation before tool execution
 	disableArgsValidation bool
 
+	// disableArgsNormalization disables canonicalization of tool arguments by ToolSpec types
+	disableArgsNormalization bool
+
+	// Skills merging prompt guidance and tools
+	skills []*Skill
+
+	// Few-shot examples selected for each Execute
+	examples *examplesConfig
+
+	// Providers of guidance added to the system prompt of each Execute
+	promptProviders []PromptProvider
+
+	// Reference documents of the domain added to the system prompt
+	contextPacks []*ContextPack
+
+	// Redaction of prompts recorded as PromptEvent
+	promptTraceRedactor TextRedactor
+
+	// Checks of inputs, tool results and outputs
+	guardrails     []*Guardrail
+	guardrailHooks []GuardrailHook
+
+	// Permissions of tool calls
+	toolPolicies    []ToolPolicy
+	toolConfirmHook ToolConfirmHook
+	toolGrants      *ToolGrants
+
+	// Decides whether a failed tool call aborts the execution
+	toolErrorPolicy ToolErrorPolicy
+
+	// Conversion of inputs that the model can not read
+	modalityFallback *modalityFallback
+	fileExtractor    FileExtractor
+	fileExtractorSet bool
+
+	// Default timeout of tools without ToolSpec.Timeout
+	toolTimeout time.Duration
+
+	// Max number of tool calls of one response executed concurrently
+	parallelToolCalls int
+
+	// toolArgAutoRepair asks the LLM to repair tool arguments failing validation
+	toolArgAutoRepair bool
+
+	// Tools accepting validate-only calls
+	toolDryRun *toolDryRunConfig
+
+	// unhealthyToolSets is how tools of unhealthy ToolSets are declared
+	unhealthyToolSets UnhealthyToolSetAction
+
+	// retryPolicy retries LLM calls failed by transient errors
+	retryPolicy *RetryPolicy
+
+	// usageReporter is called with the usage of each LLM call
+	usageReporter *usageReporterConfig
+
 	// historyRepo and historySessionID enable automatic history persistence.
-	// When set, the agent loads history on first Execute and saves after each LLM round-trip.
-	historyRepo      HistoryRepository
-	historySessionID string
+	// When set, the agent loads history on first Execute and saves it by historyFlushPolicy.
+	historyRepo        HistoryRepository
+	historySessionID   string
+	historyFlushPolicy HistoryFlushPolicy
+	// historySignalRedelivery delivers the signal of HistoryFlushOnSignal again after saving
+	historySignalRedelivery bool
+
+	// Lifecycle hooks called at the boundaries of each Execute
+	conversationStartHooks []ConversationStartHook
+	conversationEndHooks   []ConversationEndHook
+
+	// Feature flags and flag-dependent configuration
+	flags                Flags
+	flaggedTools         []flaggedTools
+	systemPromptTemplate string
+	// flagState identifies the flagged tools and the rendered system prompt of an Execute
+	flagState string
+
+	// Optional final pass generating ExecuteResponse.Reasoning
+	reasoningSummary *reasoningSummaryConfig
+
+	// Signals computing ExecuteResponse.Confidence
+	confidenceSignals []confidenceSignal
+
+	// Sampling of each LLM call choosing one of the responses
+	selfConsistency *selfConsistencyConfig
+
+	// Pre-flight check of the tokens of each LLM call
+	contextWindow *ContextWindowPolicy
+
+	// Tool transcript recording and snapshot on error
+	snapshot *snapshotConfig
+
+	// Memoization of tool results
+	toolCache *toolCacheConfig
+
+	// Concurrency and priority of tool executions
+	toolLimiter *ToolLimiter
+
+	// Representation of tool results sent to the LLM
+	toolResultEncoding ToolResultEncoding
+
+	// Formatting conventions of output
+	locale *Locale
+
+	// Cost and token limits of each Execute
+	budget *budgetConfig
+
+	// Sources of IDs and time, set to ctx of Execute for deterministic runs
+	idGenerator IDGenerator
+	clock       Clock
+
+	// Token counting before LLM calls, set to ctx of Execute
+	tokenizer Tokenizer
 }
 
 func (c *gollemConfig) Clone() *gollemConfig {
@@ -108,20 +245,136 @@ func (c *gollemConfig) Clone() *gollemConfig {
 		toolMiddlewares:          c.toolMiddlewares[:],
 		traceHandler:             c.traceHandler,
 
-		disableArgsValidation: c.disableArgsValidation,
+		disableArgsValidation:    c.disableArgsValidation,
+		disableArgsNormalization: c.disableArgsNormalization,
+		toolTimeout:              c.toolTimeout,
+		skills:                   c.skills[:],
+		examples:                 c.examples,
+		promptProviders:          c.promptProviders[:],
+		contextPacks:             c.contextPacks[:],
+		promptTraceRedactor:      c.promptTraceRedactor,
+		guardrails:               c.guardrails[:],
+		guardrailHooks:           c.guardrailHooks[:],
+		toolPolicies:             c.toolPolicies[:],
+		toolConfirmHook:          c.toolConfirmHook,
+		toolGrants:               c.toolGrants,
+		toolErrorPolicy:          c.toolErrorPolicy,
+		modalityFallback:         c.modalityFallback,
+		fileExtractor:            c.fileExtractor,
+		fileExtractorSet:         c.fileExtractorSet,
+		parallelToolCalls:        c.parallelToolCalls,
+		toolArgAutoRepair:        c.toolArgAutoRepair,
+		toolDryRun:               c.toolDryRun,
+		unhealthyToolSets:        c.unhealthyToolSets,
+		retryPolicy:              c.retryPolicy,
+		usageReporter:            c.usageReporter,
+
+		historyRepo:             c.historyRepo,
+		historySessionID:        c.historySessionID,
+		historyFlushPolicy:      c.historyFlushPolicy,
+		historySignalRedelivery: c.historySignalRedelivery,
+
+		conversationStartHooks: c.conversationStartHooks[:],
+		conversationEndHooks:   c.conversationEndHooks[:],
+
+		flags:                maps.Clone(c.flags),
+		flaggedTools:         c.flaggedTools[:],
+		systemPromptTemplate: c.systemPromptTemplate,
+
+		reasoningSummary:  c.reasoningSummary,
+		confidenceSignals: c.confidenceSignals[:],
+		selfConsistency:   c.selfConsistency,
+		contextWindow:     c.contextWindow,
+
+		snapshot:    c.snapshot,
+		toolCache:   c.toolCache,
+		toolLimiter: c.toolLimiter,
+		budget:      c.budget,
+
+		toolResultEncoding: c.toolResultEncoding,
+		locale:             c.locale,
+
+		idGenerator: c.idGenerator,
+		clock:       c.clock,
+		tokenizer:   c.tokenizer,
+	}
+}
+
+// sessionOptions returns the options of sessions of the agent, except the history.
+func (c *gollemConfig) sessionOptions(toolList []Tool) []SessionOption {
+	sessionOptions := []SessionOption{
+		WithSessionSystemPrompt(c.systemPrompt),
+	}
+
+	// Add ContentType if specified
+	if c.contentType != "" {
+		sessionOptions = append(sessionOptions, WithSessionContentType(c.contentType))
+	}
+
+	// Add ResponseSchema if specified
+	if c.responseSchema != nil {
+		sessionOptions = append(sessionOptions, WithSessionResponseSchema(c.responseSchema))
+	}
+
+	if len(toolList) > 0 {
+		sessionOptions = append(sessionOptions, WithSessionTools(toolList...))
+	}
+
+	// Add middleware from agent configuration
+	for _, mw := range c.contentBlockMiddlewares {
+		sessionOptions = append(sessionOptions, WithSessionContentBlockMiddleware(mw))
+	}
+	for _, mw := range c.contentStreamMiddlewares {
+		sessionOptions = append(sessionOptions, WithSessionContentStreamMiddleware(mw))
+	}
+	// Inputs are converted next to the provider to retry inputs rejected by it
+	if c.modalityFallback != nil {
+		sessionOptions = append(sessionOptions,
+			WithSessionContentBlockMiddleware(c.modalityFallback.blockMiddleware),
+			WithSessionContentStreamMiddleware(c.modalityFallback.streamMiddleware),
+		)
+	}
+	if fallback := newFileFallback(c); fallback != nil {
+		sessionOptions = append(sessionOptions,
+			WithSessionContentBlockMiddleware(fallback.blockMiddleware),
+			WithSessionContentStreamMiddleware(fallback.streamMiddleware),
+		)
+	}
+	// Tokens are checked last to count the request sent to the provider
+	if c.contextWindow != nil {
+		sessionOptions = append(sessionOptions,
+			WithSessionContentBlockMiddleware(c.contextWindow.blockMiddleware),
+			WithSessionContentStreamMiddleware(c.contextWindow.streamMiddleware),
+		)
+	}
+	return sessionOptions
+}
 
-		historyRepo:      c.historyRepo,
-		historySessionID: c.historySessionID,
+// usageSessionID returns the session ID of usage reports.
+func (g *Agent) usageSessionID(ctx context.Context, cfg *gollemConfig) string {
+	if cfg.historySessionID != "" {
+		return cfg.historySessionID
 	}
+	if g.sessionID == "" {
+		g.sessionID = NewID(ctx)
+	}
+	return g.sessionID
 }
 
 // New creates a new gollem agent.
 func New(llmClient LLMClient, options ...Option) *Agent {
 	s := &Agent{
-		llm: llmClient,
+		llm:            llmClient,
+		usage:          &UsageTracker{},
+		historyFlusher: &historyFlusher{},
+		pausedState:    &pausedState{},
+
+		defaultToolGrants: NewToolGrants(),
 		gollemConfig: gollemConfig{
-			loopLimit:    DefaultLoopLimit,
-			systemPrompt: "",
+			loopLimit:               DefaultLoopLimit,
+			systemPrompt:            "",
+			historyFlushPolicy:      DefaultHistoryFlushPolicy,
+			historySignalRedelivery: true,
 
 			responseMode: ResponseModeBlocking,
 			logger:       slog.New(slog.DiscardHandler),
@@ -148,6 +401,16 @@ func New(llmClient LLMClient, options ...Option) *Agent {
 // Option is the type for the options of the gollem agent.
 type Option func(*gollemConfig)
 
+// WithOptions bundles multiple options into a single Option. It allows packages outside of
+// gollem to provide one option that configures several hooks or middlewares at once.
+func WithOptions(options ...Option) Option {
+	return func(s *gollemConfig) {
+		for _, opt := range options {
+			opt(s)
+		}
+	}
+}
+
 // WithLoopLimit sets the maximum number of loops for the gollem session iteration (ask LLM and execute tools is one loop).
 func WithLoopLimit(loopLimit int) Option {
 	return func(s *gollemConfig) {
@@ -267,7 +530,7 @@ func WithTrace(handler trace.Handler) Option {
 
 // WithHistoryRepository sets a HistoryRepository for automatic history persistence.
 // When set, the agent automatically loads history on session creation and saves
-// history after each LLM round-trip.
+// history after each LLM round-trip, or as set by WithHistoryFlushPolicy.
 // The sessionID uniquely identifies the conversation session in the repository.
 func WithHistoryRepository(repo HistoryRepository, sessionID string) Option {
 	return func(s *gollemConfig) {
@@ -285,17 +548,61 @@ func WithDisableArgsValidation() Option {
 	}
 }
 
+// WithDisableArgsNormalization disables automatic normalization of tool arguments.
+// By default, the agent canonicalizes arguments from LLM according to the tool's parameter
+// specifications (see ToolSpec.NormalizeArgs) before middlewares and Tool.Run see them.
+func WithDisableArgsNormalization() Option {
+	return func(s *gollemConfig) {
+		s.disableArgsNormalization = true
+	}
+}
+
+// WithToolTimeout sets the default timeout of one execution of tools whose ToolSpec.Timeout is
+// zero, including tools of ToolSets such as MCP servers and subagents. A slow tool is canceled
+// and fails with ErrToolTimeout as a tool error returned to the LLM, so the LLM can retry or
+// take another way. Set ToolSpec.Timeout of a tool taking longer, e.g. a subagent.
+func WithToolTimeout(timeout time.Duration) Option {
+	return func(s *gollemConfig) {
+		s.toolTimeout = timeout
+	}
+}
+
+// WithIDGenerator sets the IDGenerator of Execute. It is also set to the context given to
+// strategies and tools, so that IDs from NewID, e.g. execution, plan task and snapshot IDs, are
+// deterministic in tests and replays. An IDGenerator set by ContextWithIDGenerator takes
+// precedence.
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(s *gollemConfig) {
+		s.idGenerator = gen
+	}
+}
+
+// WithClock sets the Clock of Execute in the same way as WithIDGenerator, for timestamps from Now.
+func WithClock(clock Clock) Option {
+	return func(s *gollemConfig) {
+		s.clock = clock
+	}
+}
+
 func setupTools(ctx context.Context, cfg *gollemConfig) (map[string]Tool, []Tool, error) {
 	allTools := cfg.tools[:]
 
-	toolMap, err := buildToolMap(ctx, allTools, cfg.toolSets)
+	toolMap, err := buildToolMap(ctx, allTools, cfg.toolSets, cfg.unhealthyToolSets)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Tools are declared in the order of names so that requests are the same for the same tools,
+	// e.g. for prompt caching and recorded cassettes
 	toolList := make([]Tool, 0, len(toolMap))
 	toolNames := make([]string, 0, len(toolMap))
-	for _, tool := range toolMap {
+	for _, name := range slices.Sorted(maps.Keys(toolMap)) {
+		tool := toolMap[name]
+		// Calls are dispatched by toolMap, so only the tools declared to the LLM are wrapped
+		tool, err := cfg.toolDryRun.wrap(tool)
+		if err != nil {
+			return nil, nil, err
+		}
 		toolList = append(toolList, tool)
 		toolNames = append(toolNames, tool.Spec().Name)
 	}
@@ -308,9 +615,36 @@ func setupTools(ctx context.Context, cfg *gollemConfig) (map[string]Tool, []Tool
 // allowing for continuous conversation without manual history management.
 // Returns (*ExecuteResponse, error) where ExecuteResponse contains the final conclusion.
 // Use this method instead of Prompt for better agent-like behavior.
-func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse, err error) {
+func (g *Agent) Execute(ctx context.Context, input ...Input) (result *ExecuteResponse, err error) {
+	// The branch of ExecuteFrom applies only to this agent, not to subagents
+	branch, ctx := branchFromContext(ctx)
 	cfg := g.Clone()
-	logger := cfg.logger.With("gollem.exec_id", uuid.New().String())
+	ctx = cfg.contextWithDeterminism(ctx)
+	execID := NewID(ctx)
+
+	// Usage of this Execute is also rolled up into the agent and outer trackers, e.g. of the
+	// parent agent of a subagent
+	execUsage := &UsageTracker{}
+	ctx = ContextWithUsageTracker(ctx, g.usage)
+	ctx = ContextWithUsageTracker(ctx, execUsage)
+	var budget *Budget
+	if cfg.budget != nil {
+		budget = NewBudget(execUsage, cfg.budget.maxUSD, cfg.budget.maxTokens, cfg.budget.options...)
+		ctx = ContextWithBudget(ctx, budget)
+	}
+	if cfg.retryPolicy != nil {
+		ctx = ContextWithRetryPolicy(ctx, cfg.retryPolicy)
+	}
+	if cfg.promptTraceRedactor != nil {
+		ctx = ContextWithPromptTraceRedactor(ctx, cfg.promptTraceRedactor)
+	}
+	// Labels set by the strategy during this Execute do not leak to the caller
+	ctx = ContextWithUsageLabels(ctx, nil)
+	if cfg.usageReporter != nil {
+		ctx = contextWithUsageReporter(ctx, cfg.usageReporter, g.usageSessionID(ctx, cfg), execID)
+	}
+	startedAt := Now(ctx)
+	logger := cfg.logger.With("gollem.exec_id", execID)
 	cfg.logger = logger
 
 	logger.Debug("[start] gollem execution",
@@ -332,6 +666,145 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 		}()
 	}
 
+	// Phase and iteration where the execution is, to tell where it was stopped. The
+	// cancellation is resolved once and shared by the returned error and end hooks.
+	phase, iteration := ExecutePhaseInit, 0
+	var cancellation *CancellationInfo
+	var cancellationResolved bool
+	resolveCancellation := func() *CancellationInfo {
+		if !cancellationResolved {
+			cancellationResolved = true
+			cancellation = newCancellationInfo(ctx, err, budget, phase, iteration)
+		}
+		return cancellation
+	}
+	defer func() {
+		if info := resolveCancellation(); info != nil {
+			logger.Debug("gollem execution canceled", "cancellation", info.String())
+			if th != nil {
+				th.AddEvent(ctx, "cancellation", info)
+			}
+			err = &CancellationError{Info: info, Err: err}
+		}
+	}()
+
+	// The session has tool calls without results until the paused execution is resumed
+	if g.Paused() != nil {
+		return nil, goerr.Wrap(ErrExecutionPaused, "resume the paused execution before Execute")
+	}
+	if cfg.selfConsistency.enabled() && cfg.responseMode == ResponseModeStreaming {
+		return nil, goerr.Wrap(ErrInvalidParameter, "WithSelfConsistency cannot be used with ResponseModeStreaming")
+	}
+	if cfg.contextWindow != nil {
+		if err := cfg.contextWindow.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if branch != nil {
+		// The session is replaced by the branch, leaving the original history as it is
+		g.currentSession = nil
+		cfg.history = nil
+		if len(branch.Messages) > 0 {
+			cfg.history = branch
+		}
+	}
+
+	record := &execRecord{
+		execID: execID,
+		inputs: input,
+		config: cfg.conversationConfig(cfg.tools),
+	}
+	g.lastExec = record
+	defer func() {
+		record.err = err
+		if err != nil && cfg.snapshot != nil && cfg.snapshot.repo != nil {
+			g.saveErrorSnapshot(ctx, cfg)
+		}
+	}()
+
+	if cfg.historyRepo != nil && cfg.historyFlushPolicy&HistoryFlushOnSignal != 0 {
+		defer g.flushHistoryOnSignal(ctx, cfg)()
+	}
+	if cfg.historyRepo != nil && cfg.historyFlushPolicy&HistoryFlushOnExecute != 0 {
+		defer func() {
+			if g.currentSession == nil {
+				return
+			}
+			// The history is saved even if Execute is canceled
+			if flushErr := g.flushSessionHistory(context.WithoutCancel(ctx), cfg); flushErr != nil {
+				if err == nil {
+					err = flushErr
+				} else {
+					logger.Warn("failed to save history at the end of execution", "error", flushErr)
+				}
+			}
+		}()
+	}
+
+	// Resolve feature flags before tools and the system prompt are fixed
+	flags, err := cfg.applyFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, flagsCtxKey{}, flags)
+	if th != nil && len(flags) > 0 {
+		th.AddEvent(ctx, "flags", &FlagsEvent{Flags: flags})
+	}
+
+	// Skills, context packs, few-shot examples and prompt providers add their tools and
+	// guidance before the system prompt is fixed
+	if len(cfg.skills) > 0 {
+		if err := cfg.applySkills(); err != nil {
+			return nil, err
+		}
+	}
+	if packs := resolveContextPacks(ctx, cfg.contextPacks); len(packs) > 0 {
+		var packsPrompt string
+		ctx, packsPrompt, err = contextPacksPrompt(ctx, packs, g.llm)
+		if err != nil {
+			return nil, err
+		}
+		cfg.systemPrompt = joinPrompts(cfg.systemPrompt, packsPrompt)
+	}
+	var requestPrompt string
+	if cfg.examples != nil {
+		requestPrompt, err = cfg.examplesPrompt(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, provider := range cfg.promptProviders {
+		prompt, err := provider(ctx, input)
+		if err != nil {
+			return nil, goerr.Wrap(err, "prompt provider failed")
+		}
+		requestPrompt = joinPrompts(requestPrompt, prompt)
+	}
+	cfg.systemPrompt = joinPrompts(cfg.systemPrompt, requestPrompt)
+
+	// Formatting conventions of the locale apply to the agent and helpers calling LLMs
+	if cfg.locale != nil {
+		cfg.systemPrompt = appendLocalePrompt(cfg.systemPrompt, cfg.locale)
+		ctx = ContextWithLocale(ctx, *cfg.locale)
+	}
+
+	// Guardrails check the inputs before the strategy, e.g. a planner, sees them
+	guardrails := resolveGuardrails(ctx, cfg)
+	if guardrails != nil {
+		ctx = context.WithValue(ctx, guardrailsCtxKey{}, guardrails)
+		if input, err = guardrails.checkInputs(ctx, input); err != nil {
+			return nil, err
+		}
+		record.inputs = input
+		cfg.toolMiddlewares = append([]ToolMiddleware{guardrails.toolMiddleware}, cfg.toolMiddlewares...)
+	}
+
+	// Tool policies authorize calls before any other tool middleware
+	if policy := resolveToolPolicy(ctx, cfg, g.defaultToolGrants); policy != nil {
+		ctx = context.WithValue(ctx, toolPolicyCtxKey{}, policy)
+		cfg.toolMiddlewares = append([]ToolMiddleware{policy.middleware}, cfg.toolMiddlewares...)
+	}
+
 	// Initialize strategy
 	if err := cfg.strategy.Init(ctx, input); err != nil {
 		return nil, goerr.Wrap(err, "failed to initialize strategy")
@@ -357,34 +830,99 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 		toolList = append(toolList, tool)
 		toolMap[tool.Spec().Name] = tool
 	}
+	if err := checkSkillTools(cfg.skills, toolMap); err != nil {
+		return nil, err
+	}
 
-	// If no current session exists, create a new one
-	if g.currentSession == nil {
-		// WithHistory and WithHistoryRepository cannot be used together
-		if cfg.history != nil && cfg.historyRepo != nil {
-			return nil, goerr.New("WithHistory and WithHistoryRepository cannot be used together")
-		}
+	record.config = cfg.conversationConfig(toolList)
+
+	// Arguments of sensitive parameters are masked in logs, traces and errors
+	redactor := newArgsRedactor(toolMap)
+	if h := trace.HandlerFrom(ctx); h != nil && redactor != nil {
+		ctx = trace.WithHandler(ctx, &redactTraceHandler{Handler: h, redactor: redactor})
+	}
 
-		sessionOptions := []SessionOption{
-			WithSessionSystemPrompt(cfg.systemPrompt),
+	// Repair runs inside user middlewares so that they see the arguments from the LLM
+	if cfg.toolArgAutoRepair && !cfg.disableArgsValidation {
+		repairer := &toolArgRepairer{client: g.llm, logger: logger, normalize: !cfg.disableArgsNormalization}
+		cfg.toolMiddlewares = append(slices.Clip(cfg.toolMiddlewares), repairer.middleware)
+	}
+
+	// Record tool calls as evidence for the reasoning summary and for snapshots
+	var observer *toolObserver
+	if cfg.reasoningSummary != nil || cfg.snapshot != nil {
+		observer = &toolObserver{}
+		cfg.toolMiddlewares = append(slices.Clip(cfg.toolMiddlewares), observer.middleware)
+		record.observer = observer
+	}
+
+	// LLM responses of the execution, kept only for confidence signals
+	var llmResponses []*Response
+
+	if len(cfg.conversationEndHooks) > 0 {
+		defer func() {
+			usage := execUsage.Usage()
+			event := &ConversationEndEvent{
+				ExecID:       execID,
+				Response:     result,
+				InputToken:   usage.InputTokens,
+				OutputToken:  usage.OutputTokens,
+				Duration:     Now(ctx).Sub(startedAt),
+				Error:        err,
+				Cancellation: resolveCancellation(),
+			}
+			for _, hook := range cfg.conversationEndHooks {
+				hook(ctx, event)
+			}
+		}()
+	}
+
+	if len(cfg.conversationStartHooks) > 0 {
+		event := &ConversationStartEvent{
+			ExecID:    execID,
+			Inputs:    input,
+			Config:    cfg.conversationConfig(toolList),
+			StartedAt: startedAt,
 		}
+		for _, hook := range cfg.conversationStartHooks {
+			if err := hook(ctx, event); err != nil {
+				return nil, goerr.Wrap(err, "conversation start hook failed", goerr.T(errTagStartHook))
+			}
+		}
+	}
 
-		// Add ContentType if specified
-		if cfg.contentType != "" {
-			sessionOptions = append(sessionOptions, WithSessionContentType(cfg.contentType))
+	// Flagged tools and the system prompt are fixed at the creation of a session, so the session
+	// is rebuilt with its history when flags of this Execute change them
+	var flagHistory *History
+	if g.currentSession != nil && cfg.flagState != g.sessionFlagState {
+		if flagHistory, err = g.currentSession.History(); err != nil {
+			return nil, goerr.Wrap(err, "failed to get history to apply flags")
 		}
+		if flagHistory == nil {
+			flagHistory = &History{}
+		}
+		g.currentSession = nil
+	}
 
-		// Add ResponseSchema if specified
-		if cfg.responseSchema != nil {
-			sessionOptions = append(sessionOptions, WithSessionResponseSchema(cfg.responseSchema))
+	// If no current session exists, create a new one
+	if g.currentSession == nil {
+		// WithHistory and WithHistoryRepository cannot be used together
+		if cfg.history != nil && cfg.historyRepo != nil && branch == nil {
+			return nil, goerr.New("WithHistory and WithHistoryRepository cannot be used together")
 		}
 
-		if cfg.history != nil {
+		sessionOptions := cfg.sessionOptions(toolList)
+		switch {
+		case flagHistory != nil:
+			if len(flagHistory.Messages) > 0 {
+				sessionOptions = append(sessionOptions, WithSessionHistory(flagHistory))
+			}
+		case cfg.history != nil:
 			sessionOptions = append(sessionOptions, WithSessionHistory(cfg.history))
 		}
 
 		// Load history from repository if configured
-		if cfg.historyRepo != nil {
+		if cfg.historyRepo != nil && branch == nil && flagHistory == nil {
 			repoHistory, err := cfg.historyRepo.Load(ctx, cfg.historySessionID)
 			if err != nil {
 				return nil, goerr.Wrap(err, "failed to load history from repository",
@@ -394,17 +932,6 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 				sessionOptions = append(sessionOptions, WithSessionHistory(repoHistory))
 			}
 		}
-		if len(toolList) > 0 {
-			sessionOptions = append(sessionOptions, WithSessionTools(toolList...))
-		}
-
-		// Add middleware from agent configuration
-		for _, mw := range cfg.contentBlockMiddlewares {
-			sessionOptions = append(sessionOptions, WithSessionContentBlockMiddleware(mw))
-		}
-		for _, mw := range cfg.contentStreamMiddlewares {
-			sessionOptions = append(sessionOptions, WithSessionContentStreamMiddleware(mw))
-		}
 
 		ssn, err := g.llm.NewSession(ctx, sessionOptions...)
 		if err != nil {
@@ -414,13 +941,29 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 			return nil, goerr.New("LLMClient.NewSession returned nil session")
 		}
 		g.currentSession = ssn
+		g.sessionFlagState = cfg.flagState
+	} else if requestPrompt != "" {
+		// The system prompt of the existing session does not have the prompt of this Execute
+		input = append([]Input{Text(requestPrompt)}, input...)
+	}
+
+	// Messages after this are the transcript of the Execute
+	transcript := newExecuteTranscript(g.currentSession)
+	if transcript.err != nil {
+		logger.Warn("failed to get session history for transcript", "error", transcript.err)
 	}
 
 	strategy := g.strategy
 
+	// Tool choice set for this Execute applies only to the first LLM call
+	toolChoice, ctx := toolChoiceFromContext(ctx)
+	// Generation parameters set for this Execute apply to all LLM calls of the loop
+	execGenOpts, ctx := generateOptionsFromContext(ctx)
+
 	var lastResponse *Response
 	nextInput := input
 	for i := 0; i < cfg.loopLimit; i++ {
+		phase, iteration = ExecutePhaseStrategy, i
 		state := &StrategyState{
 			Session:      g.currentSession,
 			InitInput:    input,
@@ -430,6 +973,7 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 			Tools:        toolList,
 			SystemPrompt: cfg.systemPrompt,
 			History:      cfg.history.Clone(),
+			Usage:        execUsage,
 		}
 		strategyInputs, executeResponse, err := strategy.Handle(ctx, state)
 		if err != nil {
@@ -440,6 +984,8 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 
 		// ExecuteResponse priority processing
 		if executeResponse != nil {
+			phase = ExecutePhaseFinalize
+
 			// Input also specified? Log warning
 			if len(strategyInputs) > 0 {
 				logger.Warn("Strategy returned both ExecuteResponse and Input - Input will be ignored",
@@ -447,6 +993,12 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 					"texts_count", len(executeResponse.Texts))
 			}
 
+			if guardrails != nil {
+				if err := guardrails.checkOutput(ctx, executeResponse); err != nil {
+					return nil, err
+				}
+			}
+
 			// Append user inputs to session history first
 			// This is necessary when strategy returns ExecuteResponse without calling GenerateContent
 			if len(executeResponse.UserInputs) > 0 {
@@ -458,9 +1010,10 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 					if err := g.currentSession.AppendHistory(userHistory); err != nil {
 						return nil, goerr.Wrap(err, "failed to append user inputs to session history")
 					}
-					if err := saveHistoryToRepo(ctx, g.currentSession, cfg); err != nil {
+					if err := g.historyUpdated(ctx, cfg, -1); err != nil {
 						return nil, err
 					}
+					transcript.updated()
 				}
 			}
 
@@ -498,9 +1051,37 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 				if err := g.currentSession.AppendHistory(textHistory); err != nil {
 					return nil, goerr.Wrap(err, "failed to append texts to session history")
 				}
-				if err := saveHistoryToRepo(ctx, g.currentSession, cfg); err != nil {
+				if err := g.historyUpdated(ctx, cfg, -1); err != nil {
 					return nil, err
 				}
+				transcript.updated()
+			}
+
+			if cfg.reasoningSummary != nil {
+				client := cfg.reasoningSummary.client
+				if client == nil {
+					client = g.llm
+				}
+				executeResponse.Reasoning = summarizeReasoning(ctx, cfg, client, input, executeResponse, observer)
+			}
+
+			if len(cfg.confidenceSignals) > 0 && !executeResponse.IsEmpty() {
+				executeResponse.Confidence = computeConfidence(ctx, cfg, &ConfidenceInput{
+					Inputs:         input,
+					Response:       executeResponse,
+					LLMResponses:   llmResponses,
+					SessionOptions: g.confidenceSessionOptions(cfg, toolList, transcript.prefixLength()),
+				})
+			}
+
+			executeResponse.ExecID = execID
+			executeResponse.Usage = execUsage.Usage()
+			if transcript.err == nil {
+				history, err := transcript.history()
+				if err != nil {
+					logger.Warn("failed to get session history for transcript", "error", err)
+				}
+				executeResponse.Transcript = history
 			}
 
 			// Return strategy's response immediately
@@ -513,25 +1094,60 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 			return nil, nil
 		}
 
+		genOpts := state.GenerateOptions
+		if len(execGenOpts) > 0 {
+			genOpts = append(slices.Clone(execGenOpts), genOpts...)
+		}
+		if toolChoice != nil {
+			genOpts = append([]GenerateOption{WithToolChoice(*toolChoice)}, genOpts...)
+			toolChoice = nil
+		}
+
+		record.lastInputs = strategyInputs
+		phase = ExecutePhaseLLMCall
+
+		// Budgets of this and parent agents are checked before each LLM call
+		if err := CheckBudget(ctx); err != nil {
+			return nil, err
+		}
+
+		historyLength := g.historyLength(cfg)
 		switch cfg.responseMode {
 		case ResponseModeBlocking:
-			output, err := g.currentSession.Generate(ctx, strategyInputs)
-			if err != nil {
-				return nil, err
+			var output *Response
+			if cfg.selfConsistency.enabled() {
+				output, err = g.generateSelfConsistent(ctx, cfg, logger, toolList, strategyInputs, genOpts)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				output, err = g.currentSession.Generate(ctx, strategyInputs, genOpts...)
+				if err != nil {
+					return nil, err
+				}
+				RecordUsage(ctx, output)
 			}
 
-			newInput, err := handleResponse(ctx, logger, output, toolMap, cfg.toolMiddlewares, cfg.disableArgsValidation)
+			phase = ExecutePhaseToolCall
+			newInput, err := handleResponse(ctx, logger, output, toolMap, redactor, cfg)
 			if err != nil {
 				return nil, err
 			}
-			if err := saveHistoryToRepo(ctx, g.currentSession, cfg); err != nil {
+			if err := g.historyUpdated(ctx, cfg, historyLength); err != nil {
+				return nil, err
+			}
+			transcript.updated()
+			if err := g.pauseIfDeferred(output.FunctionCalls, newInput); err != nil {
 				return nil, err
 			}
 			lastResponse = output
 			nextInput = newInput
+			if len(cfg.confidenceSignals) > 0 {
+				llmResponses = append(llmResponses, output)
+			}
 
 		case ResponseModeStreaming:
-			stream, err := g.currentSession.Stream(ctx, strategyInputs)
+			stream, err := g.currentSession.Stream(ctx, strategyInputs, genOpts...)
 			if err != nil {
 				return nil, err
 			}
@@ -540,11 +1156,13 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 			// Accumulate the complete response for lastResponse
 			var streamedResponse Response
 			for output := range stream {
-				logger.Debug("recv response", "output", output)
-				newInput, err := handleResponse(ctx, logger, output, toolMap, cfg.toolMiddlewares, cfg.disableArgsValidation)
+				logger.Debug("recv response", "output", redactor.response(output))
+				phase = ExecutePhaseToolCall
+				newInput, err := handleResponse(ctx, logger, output, toolMap, redactor, cfg)
 				if err != nil {
 					return nil, err
 				}
+				phase = ExecutePhaseLLMCall
 				nextInput = append(nextInput, newInput...)
 
 				// Accumulate streaming response
@@ -552,71 +1170,244 @@ func (g *Agent) Execute(ctx context.Context, input ...Input) (_ *ExecuteResponse
 				streamedResponse.FunctionCalls = append(streamedResponse.FunctionCalls, output.FunctionCalls...)
 				streamedResponse.InputToken += output.InputToken
 				streamedResponse.OutputToken += output.OutputToken
+				if output.Model != "" {
+					streamedResponse.Model = output.Model
+				}
 				if output.Error != nil {
 					streamedResponse.Error = output.Error
 				}
 			}
-			if err := saveHistoryToRepo(ctx, g.currentSession, cfg); err != nil {
+			RecordUsage(ctx, &streamedResponse)
+			if err := g.historyUpdated(ctx, cfg, historyLength); err != nil {
+				return nil, err
+			}
+			transcript.updated()
+			if err := g.pauseIfDeferred(streamedResponse.FunctionCalls, nextInput); err != nil {
 				return nil, err
 			}
 			lastResponse = &streamedResponse
+			if len(cfg.confidenceSignals) > 0 {
+				llmResponses = append(llmResponses, &streamedResponse)
+			}
 		}
 	}
 
+	// The strategy is not called for the iteration beyond the limit
+	phase, iteration = ExecutePhaseStrategy, cfg.loopLimit
 	return nil, goerr.Wrap(ErrLoopLimitExceeded, "session stopped", goerr.V("loop_limit", cfg.loopLimit))
 }
 
-// saveHistoryToRepo saves the current session history to the configured HistoryRepository.
-// It is a no-op if no repository is configured.
-func saveHistoryToRepo(ctx context.Context, session Session, cfg *gollemConfig) error {
-	if cfg.historyRepo == nil {
-		return nil
+// sessionHistoryLength returns the number of messages in the session history.
+func sessionHistoryLength(session Session) (int, error) {
+	history, err := session.History()
+	if err != nil {
+		return 0, err
 	}
+	if history == nil {
+		return 0, nil
+	}
+	return len(history.Messages), nil
+}
+
+// executeTranscript tracks the messages added to the session history by an Execute. Compaction
+// is checked at each update of the history in the Execute, because the history may grow beyond
+// the start again after it is compacted.
+type executeTranscript struct {
+	session   Session
+	start     int
+	length    int
+	last      []byte
+	compacted bool
+	err       error
+}
+
+func newExecuteTranscript(session Session) *executeTranscript {
+	t := &executeTranscript{session: session}
 	history, err := session.History()
 	if err != nil {
-		return goerr.Wrap(err, "failed to get session history for save")
+		t.err = err
+		return t
 	}
-	if err := cfg.historyRepo.Save(ctx, cfg.historySessionID, history); err != nil {
-		return goerr.Wrap(err, "failed to save history to repository",
-			goerr.V("session_id", cfg.historySessionID))
+	t.observe(history)
+	t.start = t.length
+	return t
+}
+
+// observe records the length and the last message of the history to detect compaction later.
+func (t *executeTranscript) observe(history *History) {
+	t.length, t.last = 0, nil
+	if history != nil && len(history.Messages) > 0 {
+		t.length = len(history.Messages)
+		t.last, t.err = json.Marshal(history.Messages[t.length-1])
 	}
-	return nil
 }
 
-func handleResponse(ctx context.Context, logger *slog.Logger, output *Response, toolMap map[string]Tool, toolMiddlewares []ToolMiddleware, disableArgsValidation bool) ([]Input, error) {
+// updated is called after the session history is updated. The history is compacted if it has
+// become shorter or the message that was the last one before the update has been changed.
+func (t *executeTranscript) updated() {
+	if t.err != nil || t.compacted {
+		return
+	}
+	history, err := t.session.History()
+	if err != nil {
+		t.err = err
+		return
+	}
+	var messages []Message
+	if history != nil {
+		messages = history.Messages
+	}
+	if len(messages) < t.length {
+		t.compacted = true
+		return
+	}
+	if t.length > 0 {
+		last, err := json.Marshal(messages[t.length-1])
+		if err != nil {
+			t.err = err
+			return
+		}
+		if !bytes.Equal(last, t.last) {
+			t.compacted = true
+			return
+		}
+	}
+	t.observe(history)
+}
+
+// prefixLength returns the number of messages in the session history before the Execute, or 0
+// if they are not kept as they were.
+func (t *executeTranscript) prefixLength() int {
+	if t.err != nil || t.compacted {
+		return 0
+	}
+	return t.start
+}
+
+// history returns the messages added to the session history by the Execute. If the history has
+// been compacted in the Execute, the whole history is returned.
+func (t *executeTranscript) history() (*History, error) {
+	history, err := t.session.History()
+	if err != nil || history == nil {
+		return nil, err
+	}
+	start := t.prefixLength()
+	if start > len(history.Messages) {
+		// Compacted by an update that is not tracked
+		start = 0
+	}
+	transcript := history.Clone()
+	transcript.Messages = transcript.Messages[start:]
+	return transcript, nil
+}
+
+func handleResponse(ctx context.Context, logger *slog.Logger, output *Response, toolMap map[string]Tool, redactor argsRedactor, cfg *gollemConfig) ([]Input, error) {
 
 	newInput := make([]Input, 0)
 
-	logger.Debug("[start] handling response", "function_calls", output.FunctionCalls)
+	logger.Debug("[start] handling response", "function_calls", redactor.calls(output.FunctionCalls))
 	defer logger.Debug("[exit] handling response")
 
-	// Call the ToolRequestHook for all tool calls
-	for _, toolCall := range output.FunctionCalls {
-		logger = logger.With("call", toolCall)
+	// Calls of the same BatchTool are coalesced into one RunBatch execution
+	batches := planToolBatches(ctx, output.FunctionCalls, toolMap, cfg.toolLimiter)
+	results := make([]Input, len(output.FunctionCalls))
+	dispatched := make(map[string]bool)
+	pool := newToolCallPool(cfg.parallelToolCalls)
+
+	for i, toolCall := range output.FunctionCalls {
+		logger := logger.With("call", redactor.call(toolCall))
 
 		tool, ok := toolMap[toolCall.Name]
 		if !ok {
 			logger.Info("gollem tool not found")
-			newInput = append(newInput, FunctionResponse{
-				Name:  toolCall.Name,
-				ID:    toolCall.ID,
-				Error: goerr.New(toolCall.Name+" is not found", goerr.V("call", toolCall)),
-			})
+			resp, err := failToolCall(ctx, cfg, toolCall, toolCall, goerr.Wrap(ErrToolNotFound, toolCall.Name+" is not found"))
+			if err != nil {
+				return nil, err
+			}
+			results[i] = resp
 			continue
 		}
 
-		resp, err := executeToolCall(ctx, logger, toolCall, tool, toolMiddlewares, disableArgsValidation)
-		if err != nil {
+		if batch, ok := batches[toolCall.Name]; ok {
+			if dispatched[toolCall.Name] {
+				continue // processed as a member of the batch
+			}
+			dispatched[toolCall.Name] = true
+			if err := pool.run(func() error {
+				return executeToolBatch(ctx, logger, output.FunctionCalls, results, batch, redactor, cfg)
+			}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Each call writes its own slot of results, so results keep the order of the calls
+		if err := pool.run(func() error {
+			resp, err := executeToolCall(ctx, logger, toolCall, tool, cfg)
+			results[i] = resp
+			return err
+		}); err != nil {
 			return nil, err
 		}
-		newInput = append(newInput, resp)
+	}
+	if err := pool.wait(); err != nil {
+		return nil, err
 	}
 
+	newInput = append(newInput, results...)
 	return newInput, nil
 }
 
+// executeToolBatch processes all calls of the batch concurrently so that each call goes through its own middleware chain while the tool itself is executed once by RunBatch. Results are stored into results at the index of each call.
+func executeToolBatch(ctx context.Context, logger *slog.Logger, calls []*FunctionCall, results []Input, batch *toolBatch, redactor argsRedactor, cfg *gollemConfig) error {
+	name := batch.tool.Spec().Name
+	logger.Debug("gollem batch tool execution", "tool", name, "calls", batch.waiting)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(calls))
+	for i, call := range calls {
+		if call.Name != name {
+			continue
+		}
+		member := batch.member()
+		wg.Go(func() {
+			defer member.done()
+			resp, err := executeToolCall(ctx, logger.With("call", redactor.call(call)), call, member, cfg)
+			results[i], errs[i] = resp, err
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // executeToolCall executes a single tool call with trace span management via defer.
-func executeToolCall(ctx context.Context, logger *slog.Logger, toolCall *FunctionCall, tool Tool, toolMiddlewares []ToolMiddleware, disableArgsValidation bool) (_ FunctionResponse, retErr error) {
+func executeToolCall(ctx context.Context, logger *slog.Logger, toolCall *FunctionCall, tool Tool, cfg *gollemConfig) (_ FunctionResponse, retErr error) {
+	toolSpec := tool.Spec()
+	validateOnly := cfg.toolDryRun.takeValidateOnly(toolCall)
+
+	// Canonicalize arguments so that middlewares, validation and the tool see the same types
+	// regardless of the provider
+	if !cfg.disableArgsNormalization {
+		toolCall.Arguments = toolSpec.NormalizeArgs(toolCall.Arguments)
+	}
+
+	// The call attached to errors must not leak sensitive arguments
+	errCall := toolCall
+	if hasSensitiveParams(toolSpec.Parameters) {
+		c := *toolCall
+		c.Arguments = toolSpec.RedactArgs(toolCall.Arguments)
+		errCall = &c
+	}
+
+	if toolSpec.Timeout == 0 {
+		toolSpec.Timeout = cfg.toolTimeout
+	}
 
 	// Start tool execution trace span
 	var toolResult map[string]any
@@ -628,16 +1419,49 @@ func executeToolCall(ctx context.Context, logger *slog.Logger, toolCall *Functio
 	// Create base tool handler
 	baseHandler := func(ctx context.Context, req *ToolExecRequest) (*ToolExecResponse, error) {
 		// Validate arguments before execution
-		if !disableArgsValidation && req.ToolSpec != nil {
+		if !cfg.disableArgsValidation && req.ToolSpec != nil {
 			if err := req.ToolSpec.ValidateArgs(req.Tool.Arguments); err != nil {
+				if req.ValidateOnly {
+					recordToolDryRun(ctx, req.Tool.Name, false)
+				}
 				return &ToolExecResponse{
 					Error: err,
 				}, nil
 			}
 		}
+		if validator, ok := toolValidatorOf(tool); ok {
+			if err := validator.ValidateCall(ctx, req.Tool.Arguments); err != nil {
+				if req.ValidateOnly {
+					recordToolDryRun(ctx, req.Tool.Name, false)
+				}
+				return &ToolExecResponse{
+					Error: goerr.Wrap(err, "tool call validation failed", goerr.V("tool", req.Tool.Name)),
+				}, nil
+			}
+		}
+		if req.ValidateOnly {
+			recordToolDryRun(ctx, req.Tool.Name, true)
+			return &ToolExecResponse{Result: dryRunResult()}, nil
+		}
 
 		start := time.Now()
-		result, err := tool.Run(ctx, req.Tool.Arguments)
+		run := func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return runToolWithSpec(ctx, &toolSpec, tool.Run, args)
+		}
+		// Members of a batch consume the limiter once by the batch instead
+		if _, ok := tool.(*batchMember); !ok && cfg.toolLimiter != nil {
+			runTool := run
+			run = func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				return cfg.toolLimiter.run(ctx, req.Priority, runTool, args)
+			}
+		}
+		var result map[string]any
+		var err error
+		if cfg.toolCache != nil && toolSpec.Cacheable {
+			result, err = cfg.toolCache.run(ctx, logger, run, req.Tool.Name, req.Tool.Arguments)
+		} else {
+			result, err = run(ctx, req.Tool.Arguments)
+		}
 		duration := time.Since(start).Milliseconds()
 
 		return &ToolExecResponse{
@@ -648,55 +1472,47 @@ func executeToolCall(ctx context.Context, logger *slog.Logger, toolCall *Functio
 	}
 
 	// Build middleware chain
-	handler := buildToolChain(toolMiddlewares, baseHandler)
+	handler := buildToolChain(cfg.toolMiddlewares, baseHandler)
 
 	// Execute tool with middleware
-	toolSpec := tool.Spec()
 	req := &ToolExecRequest{
-		Tool:     toolCall,
-		ToolSpec: &toolSpec,
+		Tool:         toolCall,
+		ToolSpec:     &toolSpec,
+		Priority:     toolSpec.Priority,
+		ValidateOnly: validateOnly,
 	}
 
 	resp, err := handler(ctx, req)
 	if err != nil {
 		logger.Info("gollem tool handler error", "error", err)
-		return FunctionResponse{
-			ID:    toolCall.ID,
-			Name:  toolCall.Name,
-			Error: goerr.With(err, goerr.V("call", toolCall)),
-		}, nil
+		return failToolCall(ctx, cfg, toolCall, errCall, err)
 	}
 
 	toolResult = resp.Result
 	if resp.Error != nil {
 		retErr = resp.Error
 		logger.Info("gollem tool error", "error", resp.Error)
-		return FunctionResponse{
-			ID:    toolCall.ID,
-			Name:  toolCall.Name,
-			Error: goerr.With(resp.Error, goerr.V("call", toolCall)),
-		}, nil
+		return failToolCall(ctx, cfg, toolCall, errCall, resp.Error)
 	}
 
 	logger.Debug("gollem tool result", "tool", toolCall.Name, "result", toolResult, "duration_ms", resp.Duration)
 
 	// Sanitize result to ensure a generic JSON-compatible structure for LLM processing.
-	if toolResult != nil {
-		marshaled, err := json.Marshal(toolResult)
-		if err != nil {
-			return FunctionResponse{}, goerr.Wrap(err, "failed to marshal result", goerr.V("result", toolResult))
-		}
-		var unmarshaled map[string]any
-		if err := json.Unmarshal(marshaled, &unmarshaled); err != nil {
-			return FunctionResponse{}, goerr.Wrap(err, "failed to unmarshal result", goerr.V("marshaled", string(marshaled)))
-		}
-		toolResult = unmarshaled
+	sanitized, err := copyToolResult(toolResult)
+	if err != nil {
+		return FunctionResponse{}, err
+	}
+	toolResult = sanitized
+
+	if cfg.toolResultEncoding != "" {
+		logToolResultEncoding(ctx, logger, toolResult, cfg.toolResultEncoding)
 	}
 
 	return FunctionResponse{
-		ID:   toolCall.ID,
-		Name: toolCall.Name,
-		Data: toolResult,
+		ID:       toolCall.ID,
+		Name:     toolCall.Name,
+		Data:     toolResult,
+		Encoding: cfg.toolResultEncoding,
 	}, nil
 }
 
@@ -713,7 +1529,7 @@ func (x *toolWrapper) Run(ctx context.Context, args map[string]any) (map[string]
 	return x.run(ctx, args)
 }
 
-func buildToolMap(ctx context.Context, tools []Tool, toolSets []ToolSet) (map[string]Tool, error) {
+func buildToolMap(ctx context.Context, tools []Tool, toolSets []ToolSet, unhealthy UnhealthyToolSetAction) (map[string]Tool, error) {
 	toolMap := map[string]Tool{}
 
 	for _, tool := range tools {
@@ -724,22 +1540,37 @@ func buildToolMap(ctx context.Context, tools []Tool, toolSets []ToolSet) (map[st
 	}
 
 	for _, toolSet := range toolSets {
+		health := toolSetHealthOf(toolSet, unhealthy)
+		if health != nil && unhealthy == UnhealthyToolSetHide {
+			recordUnhealthyToolSet(ctx, unhealthy, health, nil)
+			continue
+		}
+
 		specs, err := toolSet.Specs(ctx)
 		if err != nil {
 			return nil, goerr.Wrap(err, "failed to get tool set specs")
 		}
 
+		var deprioritized []string
 		for _, spec := range specs {
 			if _, ok := toolMap[spec.Name]; ok {
 				return nil, goerr.Wrap(ErrToolNameConflict, "tool name conflict (builtin tool sets)", goerr.V("tool_name", spec.Name))
 			}
-			toolMap[spec.Name] = &toolWrapper{
+			name := spec.Name
+			if health != nil {
+				spec = deprioritizeSpec(spec)
+				deprioritized = append(deprioritized, name)
+			}
+			toolMap[name] = &toolWrapper{
 				spec: spec,
 				run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
-					return toolSet.Run(ctx, spec.Name, args)
+					return toolSet.Run(ctx, name, args)
 				},
 			}
 		}
+		if health != nil {
+			recordUnhealthyToolSet(ctx, unhealthy, health, deprioritized)
+		}
 	}
 
 	return toolMap, nil
@@ -766,17 +1597,18 @@ func convertInputsToHistory(inputs []Input) (*History, error) {
 			})
 
 		case Image:
-			imageData, err := json.Marshal(map[string]string{
-				"data":      v.Base64(),
-				"mime_type": v.MimeType(),
-			})
+			mc, err := NewImageContent(v.MimeType(), v.Data(), "", "")
 			if err != nil {
 				return nil, goerr.Wrap(err, "failed to marshal image content")
 			}
-			contents = append(contents, MessageContent{
-				Type: MessageContentTypeImage,
-				Data: imageData,
-			})
+			contents = append(contents, mc)
+
+		case ImageURL:
+			mc, err := NewImageContent(v.MimeType(), nil, v.URL(), "")
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to marshal image content")
+			}
+			contents = append(contents, mc)
 
 		case PDF:
 			mc, err := NewPDFContent(v.Data(), "")
@@ -785,6 +1617,20 @@ func convertInputsToHistory(inputs []Input) (*History, error) {
 			}
 			contents = append(contents, mc)
 
+		case File:
+			// PDF files are kept as PDFs in the same way as providers do
+			var mc MessageContent
+			var err error
+			if v.MimeType() == "application/pdf" {
+				mc, err = NewPDFContent(v.Data(), "")
+			} else {
+				mc, err = NewFileContent(v.MimeType(), v.Name(), v.Data())
+			}
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to marshal file content")
+			}
+			contents = append(contents, mc)
+
 		case FunctionResponse:
 			// FunctionResponse is not user input, skip it
 			// It should be handled separately in the normal flow
@@ -0,0 +1,455 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// GuardrailTarget is a kind of message checked by guardrails.
+type GuardrailTarget string
+
+const (
+	// GuardrailTargetInput is the text inputs of Execute.
+	GuardrailTargetInput GuardrailTarget = "input"
+
+	// GuardrailTargetToolResult is the results of tools, checked as JSON.
+	GuardrailTargetToolResult GuardrailTarget = "tool_result"
+
+	// GuardrailTargetOutput is the texts of the final response of Execute.
+	GuardrailTargetOutput GuardrailTarget = "output"
+)
+
+// GuardrailAction is what a guardrail does with a message it caught.
+type GuardrailAction string
+
+const (
+	// GuardrailBlock rejects the message. A blocked input or output fails Execute with
+	// *GuardrailError, and a blocked tool result is replaced by the error for the LLM.
+	GuardrailBlock GuardrailAction = "block"
+
+	// GuardrailRedact replaces the caught texts by RedactedValue, or the whole message if the
+	// findings have no matches.
+	GuardrailRedact GuardrailAction = "redact"
+
+	// GuardrailAnnotate keeps the message and adds a note of the findings: a text after an
+	// input or output, or "guardrail_notes" of a tool result.
+	GuardrailAnnotate GuardrailAction = "annotate"
+)
+
+// GuardrailFinding is a problem a guardrail found in a message.
+type GuardrailFinding struct {
+	// Reason describes the finding, e.g. "email address"
+	Reason string `json:"reason"`
+
+	// Matches are the texts caught in the message, replaced by GuardrailRedact. They are not
+	// serialized to keep them out of traces.
+	Matches []string `json:"-"`
+}
+
+// GuardrailCheck returns the findings in text, or nil if text is acceptable.
+type GuardrailCheck func(ctx context.Context, text string) ([]GuardrailFinding, error)
+
+// Guardrail is a check of messages of agents with its action on findings.
+type Guardrail struct {
+	// Name identifies the guardrail in events and errors, and among the guardrails inherited
+	// by subagents
+	Name string
+
+	// Action is done with a message having findings
+	Action GuardrailAction
+
+	// Targets are the messages checked. All targets are checked if empty.
+	Targets []GuardrailTarget
+
+	// Check finds problems in a message
+	Check GuardrailCheck
+}
+
+func (g *Guardrail) applies(target GuardrailTarget) bool {
+	return len(g.Targets) == 0 || slices.Contains(g.Targets, target)
+}
+
+// GuardrailEvent reports findings of a guardrail. It's passed to GuardrailHook and recorded to the
+// trace as a "guardrail" event without matches.
+type GuardrailEvent struct {
+	Guardrail string             `json:"guardrail"`
+	Target    GuardrailTarget    `json:"target"`
+	Action    GuardrailAction    `json:"action"`
+	ToolName  string             `json:"tool_name,omitempty"`
+	Findings  []GuardrailFinding `json:"findings"`
+}
+
+func (e *GuardrailEvent) reasons() string {
+	reasons := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		reasons[i] = f.Reason
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// GuardrailHook is called with the findings of each guardrail, before its action is done.
+type GuardrailHook func(ctx context.Context, event *GuardrailEvent)
+
+// GuardrailError is returned when a guardrail blocks a message. It wraps ErrGuardrailBlocked.
+type GuardrailError struct {
+	Event *GuardrailEvent
+}
+
+func (e *GuardrailError) Error() string {
+	return fmt.Sprintf("%s blocked by guardrail %q: %s", e.Event.Target, e.Event.Guardrail, e.Event.reasons())
+}
+
+func (e *GuardrailError) Unwrap() error {
+	return ErrGuardrailBlocked
+}
+
+// WithGuardrails checks the text inputs, tool results and final output of each Execute by the
+// guardrails in order. They apply to any strategy, e.g. the planner of planexec sees checked
+// inputs, and are inherited by subagents, unless they have a guardrail of the same name.
+func WithGuardrails(guardrails ...*Guardrail) Option {
+	return func(s *gollemConfig) {
+		s.guardrails = append(s.guardrails, guardrails...)
+	}
+}
+
+// WithGuardrailHook adds a hook reporting findings of guardrails, including the ones of
+// subagents.
+func WithGuardrailHook(hook GuardrailHook) Option {
+	return func(s *gollemConfig) {
+		s.guardrailHooks = append(s.guardrailHooks, hook)
+	}
+}
+
+// NewPatternGuardrail creates a guardrail finding matches of the patterns.
+func NewPatternGuardrail(name string, action GuardrailAction, patterns ...*regexp.Regexp) *Guardrail {
+	return &Guardrail{
+		Name:   name,
+		Action: action,
+		Check: patternCheck(patterns, func(pattern *regexp.Regexp) string {
+			return "matched " + pattern.String()
+		}),
+	}
+}
+
+// NewDenyListGuardrail creates a guardrail finding the terms, ignoring case.
+func NewDenyListGuardrail(name string, action GuardrailAction, terms ...string) *Guardrail {
+	patterns := make([]*regexp.Regexp, 0, len(terms))
+	for _, term := range terms {
+		if term != "" {
+			patterns = append(patterns, regexp.MustCompile("(?i)"+regexp.QuoteMeta(term)))
+		}
+	}
+	return &Guardrail{
+		Name:   name,
+		Action: action,
+		Check: patternCheck(patterns, func(*regexp.Regexp) string {
+			return "denied term"
+		}),
+	}
+}
+
+// patternCheck returns a GuardrailCheck finding matches of each pattern with its reason.
+func patternCheck(patterns []*regexp.Regexp, reason func(*regexp.Regexp) string) GuardrailCheck {
+	return func(ctx context.Context, text string) ([]GuardrailFinding, error) {
+		var findings []GuardrailFinding
+		for _, pattern := range patterns {
+			if matches := pattern.FindAllString(text, -1); len(matches) > 0 {
+				findings = append(findings, GuardrailFinding{
+					Reason:  reason(pattern),
+					Matches: matches,
+				})
+			}
+		}
+		return findings, nil
+	}
+}
+
+// PIIKind is a kind of personally identifiable information found by NewPIIGuardrail.
+type PIIKind string
+
+const (
+	// PIIEmail is email addresses
+	PIIEmail PIIKind = "email"
+	// PIIPhone is phone numbers with separators, e.g. "+1 555-123-4567"
+	PIIPhone PIIKind = "phone"
+	// PIICreditCard is credit card numbers
+	PIICreditCard PIIKind = "credit_card"
+	// PIISSN is US social security numbers
+	PIISSN PIIKind = "ssn"
+)
+
+var piiPatterns = map[PIIKind]*regexp.Regexp{
+	PIIEmail:      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	PIIPhone:      regexp.MustCompile(`(?:\+\d{1,3}[\s-]?)?(?:\(\d{2,4}\)\s?|\b\d{2,4}[\s-])\d{3,4}[\s-]\d{3,4}\b`),
+	PIICreditCard: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+	PIISSN:        regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+}
+
+// NewPIIGuardrail creates the guardrail "pii" finding personally identifiable information of the
+// kinds, or all kinds if none is given. Credit card numbers are verified by their check digit.
+func NewPIIGuardrail(action GuardrailAction, kinds ...PIIKind) *Guardrail {
+	if len(kinds) == 0 {
+		kinds = []PIIKind{PIICreditCard, PIISSN, PIIEmail, PIIPhone}
+	}
+
+	return &Guardrail{
+		Name:   "pii",
+		Action: action,
+		Check: func(ctx context.Context, text string) ([]GuardrailFinding, error) {
+			var findings []GuardrailFinding
+			for _, kind := range kinds {
+				pattern, ok := piiPatterns[kind]
+				if !ok {
+					return nil, goerr.New("unknown PII kind", goerr.V("kind", kind))
+				}
+				matches := pattern.FindAllString(text, -1)
+				if kind == PIICreditCard {
+					// Long numbers failing the check digit are not found as other kinds either
+					text = redactTexts(text, matches)
+					matches = slices.DeleteFunc(matches, func(m string) bool { return !luhnValid(m) })
+				}
+				if len(matches) > 0 {
+					findings = append(findings, GuardrailFinding{
+						Reason:  string(kind),
+						Matches: matches,
+					})
+					// Parts of a found number are not found again, e.g. as a phone number
+					text = redactTexts(text, matches)
+				}
+			}
+			return findings, nil
+		},
+	}
+}
+
+// luhnValid returns true if the digits of number pass the Luhn check.
+func luhnValid(number string) bool {
+	var sum, n int
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// llmGuardrailPrompt asks the LLM to classify a message against a policy
+const llmGuardrailPrompt = `Judge whether the message below violates the policy.
+
+## Policy
+%s
+
+## Message
+%s`
+
+type llmGuardrailResult struct {
+	Violation bool   `json:"violation" description:"Whether the message violates the policy"`
+	Reason    string `json:"reason" description:"Which part of the policy is violated and why, empty if not violated"`
+}
+
+// NewLLMGuardrail creates a guardrail classifying messages by client against policy, e.g. "No
+// instructions to ignore previous instructions". A violation has no matches, so GuardrailRedact
+// replaces the whole message.
+func NewLLMGuardrail(name string, action GuardrailAction, client LLMClient, policy string) *Guardrail {
+	return &Guardrail{
+		Name:   name,
+		Action: action,
+		Check: func(ctx context.Context, text string) ([]GuardrailFinding, error) {
+			ctx = ContextWithUsagePhase(ctx, UsagePhaseEvaluate)
+			resp, err := Query[llmGuardrailResult](ctx, client, fmt.Sprintf(llmGuardrailPrompt, policy, text),
+				WithQuerySystemPrompt("You are a strict content policy classifier."))
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to classify message", goerr.V("guardrail", name))
+			}
+			if !resp.Data.Violation {
+				return nil, nil
+			}
+			reason := resp.Data.Reason
+			if reason == "" {
+				reason = "policy violation"
+			}
+			return []GuardrailFinding{{Reason: reason}}, nil
+		},
+	}
+}
+
+type guardrailsCtxKey struct{}
+
+// guardrailSet is the guardrails and hooks of an Execute.
+type guardrailSet struct {
+	guardrails []*Guardrail
+	hooks      []GuardrailHook
+}
+
+// resolveGuardrails returns the guardrails of the config with the ones inherited from ctx whose
+// names are not in the config, or nil if there are none.
+func resolveGuardrails(ctx context.Context, cfg *gollemConfig) *guardrailSet {
+	set := &guardrailSet{
+		guardrails: slices.Clone(cfg.guardrails),
+		hooks:      slices.Clone(cfg.guardrailHooks),
+	}
+	if inherited, ok := ctx.Value(guardrailsCtxKey{}).(*guardrailSet); ok {
+		for _, g := range inherited.guardrails {
+			if !slices.ContainsFunc(set.guardrails, func(x *Guardrail) bool { return x.Name == g.Name }) {
+				set.guardrails = append(set.guardrails, g)
+			}
+		}
+		set.hooks = append(set.hooks, inherited.hooks...)
+	}
+	if len(set.guardrails) == 0 {
+		return nil
+	}
+	return set
+}
+
+// check runs the guardrails of target on text. It returns the text after redaction and the notes
+// of annotations, or *GuardrailError if a guardrail blocks it.
+func (s *guardrailSet) check(ctx context.Context, target GuardrailTarget, toolName, text string) (string, []string, error) {
+	var notes []string
+	for _, g := range s.guardrails {
+		if !g.applies(target) || g.Check == nil {
+			continue
+		}
+
+		findings, err := g.Check(ctx, text)
+		if err != nil {
+			return "", nil, goerr.Wrap(err, "guardrail check failed",
+				goerr.V("guardrail", g.Name), goerr.V("target", target))
+		}
+		if len(findings) == 0 {
+			continue
+		}
+
+		event := &GuardrailEvent{
+			Guardrail: g.Name,
+			Target:    target,
+			Action:    g.Action,
+			ToolName:  toolName,
+			Findings:  findings,
+		}
+		for _, hook := range s.hooks {
+			hook(ctx, event)
+		}
+		if h := trace.HandlerFrom(ctx); h != nil {
+			h.AddEvent(ctx, "guardrail", event)
+		}
+
+		switch g.Action {
+		case GuardrailBlock:
+			return "", nil, &GuardrailError{Event: event}
+		case GuardrailRedact:
+			text = redactFindings(text, findings)
+		case GuardrailAnnotate:
+			notes = append(notes, fmt.Sprintf("[guardrail %s] %s", g.Name, event.reasons()))
+		default:
+			return "", nil, goerr.New("unknown guardrail action",
+				goerr.V("guardrail", g.Name), goerr.V("action", g.Action))
+		}
+	}
+	return text, notes, nil
+}
+
+// checkInputs returns inputs with the texts checked and annotations added after them.
+func (s *guardrailSet) checkInputs(ctx context.Context, inputs []Input) ([]Input, error) {
+	checked := make([]Input, 0, len(inputs))
+	for _, in := range inputs {
+		text, ok := in.(Text)
+		if !ok {
+			checked = append(checked, in)
+			continue
+		}
+		result, notes, err := s.check(ctx, GuardrailTargetInput, "", string(text))
+		if err != nil {
+			return nil, err
+		}
+		checked = append(checked, Text(result))
+		for _, note := range notes {
+			checked = append(checked, Text(note))
+		}
+	}
+	return checked, nil
+}
+
+// checkOutput checks the texts of resp in place and adds annotations after them.
+func (s *guardrailSet) checkOutput(ctx context.Context, resp *ExecuteResponse) error {
+	var allNotes []string
+	for i, text := range resp.Texts {
+		result, notes, err := s.check(ctx, GuardrailTargetOutput, "", text)
+		if err != nil {
+			return err
+		}
+		resp.Texts[i] = result
+		allNotes = append(allNotes, notes...)
+	}
+	resp.Texts = append(resp.Texts, allNotes...)
+	return nil
+}
+
+// toolMiddleware checks the results of tools. A blocked result is replaced by the error.
+func (s *guardrailSet) toolMiddleware(next ToolHandler) ToolHandler {
+	return func(ctx context.Context, req *ToolExecRequest) (*ToolExecResponse, error) {
+		resp, err := next(ctx, req)
+		if err != nil || resp == nil || resp.Error != nil || resp.Result == nil {
+			return resp, err
+		}
+
+		raw, err := json.Marshal(resp.Result)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to marshal tool result for guardrails")
+		}
+		text, notes, err := s.check(ctx, GuardrailTargetToolResult, req.Tool.Name, string(raw))
+		if err != nil {
+			return &ToolExecResponse{Error: err, Duration: resp.Duration}, nil
+		}
+
+		result := resp.Result
+		if text != string(raw) {
+			// Redaction of the whole result or across JSON syntax leaves no object
+			result = nil
+			if err := json.Unmarshal([]byte(text), &result); err != nil || result == nil {
+				result = map[string]any{"result": RedactedValue}
+			}
+		}
+		if len(notes) > 0 {
+			result = maps.Clone(result)
+			result["guardrail_notes"] = notes
+		}
+		return &ToolExecResponse{Result: result, Duration: resp.Duration}, nil
+	}
+}
+
+// redactFindings returns text with the matches of findings replaced by RedactedValue, or
+// RedactedValue if a finding has no matches.
+func redactFindings(text string, findings []GuardrailFinding) string {
+	var matches []string
+	for _, f := range findings {
+		if len(f.Matches) == 0 {
+			return RedactedValue
+		}
+		for _, m := range f.Matches {
+			if m != "" {
+				matches = append(matches, m)
+			}
+		}
+	}
+	// Longer matches first not to leave parts of them
+	slices.SortFunc(matches, func(a, b string) int { return len(b) - len(a) })
+	return redactTexts(text, matches)
+}
@@ -21,15 +21,16 @@ type HistoryRepository interface {
 }
 
 // History represents a conversation history that can be used across different LLM sessions.
-// It stores messages in a format specific to each LLM type (OpenAI, Claude, or Gemini).
+// It stores messages in a format specific to each LLM type (OpenAI, Claude, Gemini, or Bedrock).
 //
 // For detailed documentation, see docs/history.md
 type LLMType string
 
 const (
-	LLMTypeOpenAI LLMType = "OpenAI"
-	LLMTypeGemini LLMType = "gemini"
-	LLMTypeClaude LLMType = "claude"
+	LLMTypeOpenAI  LLMType = "OpenAI"
+	LLMTypeGemini  LLMType = "gemini"
+	LLMTypeClaude  LLMType = "claude"
+	LLMTypeBedrock LLMType = "bedrock"
 )
 
 const (
@@ -42,22 +43,32 @@ type History struct {
 	Messages []Message `json:"messages"`
 }
 
-// UnmarshalJSON implements json.Unmarshaler with version validation.
-// Returns ErrHistoryVersionMismatch if the serialized version does not match HistoryVersion.
+// UnmarshalJSON implements json.Unmarshaler with version validation. History of an older
+// version is upgraded to HistoryVersion if it has a migration path (v2 and later).
+// Returns ErrHistoryVersionMismatch if the serialized version cannot be upgraded.
 func (x *History) UnmarshalJSON(data []byte) error {
-	type historyAlias History
-	var h historyAlias
-	if err := json.Unmarshal(data, &h); err != nil {
+	version, err := historyMigrator.Version(data)
+	if err != nil {
 		return err
 	}
-
-	if h.Version != HistoryVersion {
+	if !historyMigrator.Supports(version) {
 		return goerr.Wrap(ErrHistoryVersionMismatch, "unsupported history version",
-			goerr.Value("got", h.Version),
+			goerr.Value("got", version),
 			goerr.Value("want", HistoryVersion),
 		)
 	}
 
+	data, err = historyMigrator.Upgrade(data)
+	if err != nil {
+		return goerr.Wrap(err, "failed to migrate history", goerr.Value("version", version))
+	}
+
+	type historyAlias History
+	var h historyAlias
+	if err := json.Unmarshal(data, &h); err != nil {
+		return err
+	}
+
 	*x = History(h)
 	return nil
 }
@@ -98,6 +109,9 @@ func cloneMessage(m Message) Message {
 			dataCopy := make(json.RawMessage, len(c.Data))
 			copy(dataCopy, c.Data)
 			clone.Contents[i] = MessageContent{Type: c.Type, Data: dataCopy}
+			if c.Meta != nil {
+				clone.Contents[i].Meta = append(json.RawMessage(nil), c.Meta...)
+			}
 		}
 	}
 
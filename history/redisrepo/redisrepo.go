@@ -0,0 +1,123 @@
+// Package redisrepo provides a gollem.HistoryRepository storing histories in Redis.
+package redisrepo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultKeyPrefix is the default prefix of keys of histories.
+const DefaultKeyPrefix = "gollem:history:"
+
+// Repository is a gollem.HistoryRepository storing each history as a JSON string at the key of
+// the prefix and the session ID.
+type Repository struct {
+	client redis.Cmdable
+	prefix string
+	ttl    time.Duration
+}
+
+var (
+	_ gollem.HistoryRepository = (*Repository)(nil)
+	_ gollem.HistoryLister     = (*Repository)(nil)
+)
+
+// Option is an option of New.
+type Option func(*Repository)
+
+// WithKeyPrefix sets the prefix of keys. The default is DefaultKeyPrefix.
+func WithKeyPrefix(prefix string) Option {
+	return func(r *Repository) {
+		r.prefix = prefix
+	}
+}
+
+// WithTTL expires histories not saved for ttl. Histories do not expire by default.
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Repository) {
+		r.ttl = ttl
+	}
+}
+
+// New creates a Repository with client, e.g. *redis.Client or *redis.ClusterClient.
+func New(client redis.Cmdable, options ...Option) *Repository {
+	r := &Repository{
+		client: client,
+		prefix: DefaultKeyPrefix,
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Repository) key(sessionID string) string {
+	return r.prefix + sessionID
+}
+
+// Load implements gollem.HistoryRepository. It returns nil if no history is saved for sessionID.
+func (r *Repository) Load(ctx context.Context, sessionID string) (*gollem.History, error) {
+	data, err := r.client.Get(ctx, r.key(sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to get history from redis", goerr.V("session_id", sessionID))
+	}
+
+	var history gollem.History
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal history", goerr.V("session_id", sessionID))
+	}
+	return &history, nil
+}
+
+// Save implements gollem.HistoryRepository.
+func (r *Repository) Save(ctx context.Context, sessionID string, history *gollem.History) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal history", goerr.V("session_id", sessionID))
+	}
+	if err := r.client.Set(ctx, r.key(sessionID), data, r.ttl).Err(); err != nil {
+		return goerr.Wrap(err, "failed to set history to redis", goerr.V("session_id", sessionID))
+	}
+	return nil
+}
+
+// scanCount is the hint of the number of keys per SCAN
+const scanCount = 100
+
+// globEscaper escapes the special characters of MATCH patterns of SCAN
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// ListSessions implements gollem.HistoryLister by SCAN of the keys of the prefix. With
+// *redis.ClusterClient, only keys of the node serving the command are listed.
+func (r *Repository) ListSessions(ctx context.Context) ([]string, error) {
+	match := globEscaper.Replace(r.prefix) + "*"
+	var sessionIDs []string
+	seen := make(map[string]bool) // SCAN may return a key more than once
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, match, scanCount).Result()
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to scan history keys", goerr.V("prefix", r.prefix))
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				sessionIDs = append(sessionIDs, strings.TrimPrefix(key, r.prefix))
+			}
+		}
+		if next == 0 {
+			return sessionIDs, nil
+		}
+		cursor = next
+	}
+}
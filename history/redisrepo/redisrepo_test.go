@@ -0,0 +1,67 @@
+package redisrepo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/history/redisrepo"
+	"github.com/m-mizutani/gt"
+	"github.com/redis/go-redis/v9"
+)
+
+func newHistory(t *testing.T, texts ...string) *gollem.History {
+	b := gollem.NewHistoryBuilder()
+	for i, text := range texts {
+		if i%2 == 0 {
+			b.User(text)
+		} else {
+			b.Assistant(text)
+		}
+	}
+	history, err := b.Build()
+	gt.NoError(t, err)
+	return history
+}
+
+func TestRepository(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	repo := redisrepo.New(client, redisrepo.WithKeyPrefix("test:"), redisrepo.WithTTL(time.Hour))
+
+	t.Run("not found", func(t *testing.T) {
+		history, err := repo.Load(t.Context(), "unknown")
+		gt.NoError(t, err)
+		gt.Nil(t, history)
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		gt.NoError(t, repo.Save(t.Context(), "sess1", newHistory(t, "hello")))
+		gt.NoError(t, repo.Save(t.Context(), "sess1", newHistory(t, "hello", "hi")))
+
+		history, err := repo.Load(t.Context(), "sess1")
+		gt.NoError(t, err)
+		gt.A(t, history.Messages).Length(2)
+
+		gt.True(t, server.Exists("test:sess1"))
+		gt.Equal(t, time.Hour, server.TTL("test:sess1"))
+	})
+
+	t.Run("list sessions", func(t *testing.T) {
+		gt.NoError(t, repo.Save(t.Context(), "sess2", newHistory(t, "hello")))
+		gt.NoError(t, server.Set("other:sess3", "{}"))
+
+		sessionIDs, err := repo.ListSessions(t.Context())
+		gt.NoError(t, err)
+		gt.A(t, sessionIDs).Length(2).Has("sess1").Has("sess2")
+	})
+
+	t.Run("broken data", func(t *testing.T) {
+		gt.NoError(t, server.Set("test:broken", "{"))
+		_, err := repo.Load(t.Context(), "broken")
+		gt.Error(t, err)
+	})
+}
@@ -0,0 +1,185 @@
+// Package sqlrepo provides a gollem.HistoryRepository storing histories in a SQL database via
+// database/sql. Register the driver of the database in the application, e.g. by importing
+// github.com/lib/pq or github.com/go-sql-driver/mysql.
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// Dialect is the SQL dialect of the database.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// DefaultTable is the default name of the table of histories.
+const DefaultTable = "gollem_histories"
+
+// tableNamePattern is the table names allowed, as they are embedded in queries
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ErrInvalidTable is returned by New for a table name other than letters, digits and
+// underscores, optionally qualified by a schema name.
+var ErrInvalidTable = errors.New("invalid table name")
+
+// Repository is a gollem.HistoryRepository storing each history as JSON in a row of the table
+// keyed by session ID. Create the table with CreateTable, or by the schema of CreateTable in
+// your migrations.
+type Repository struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+}
+
+var (
+	_ gollem.HistoryRepository = (*Repository)(nil)
+	_ gollem.HistoryLister     = (*Repository)(nil)
+)
+
+// Option is an option of New.
+type Option func(*Repository)
+
+// WithTable sets the name of the table. The default is DefaultTable.
+func WithTable(table string) Option {
+	return func(r *Repository) {
+		r.table = table
+	}
+}
+
+// New creates a Repository with db of the dialect.
+func New(db *sql.DB, dialect Dialect, options ...Option) (*Repository, error) {
+	r := &Repository{
+		db:      db,
+		dialect: dialect,
+		table:   DefaultTable,
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+
+	switch dialect {
+	case DialectPostgres, DialectMySQL, DialectSQLite:
+	default:
+		return nil, goerr.New("unsupported dialect", goerr.V("dialect", dialect))
+	}
+	if !tableNamePattern.MatchString(r.table) {
+		return nil, goerr.Wrap(ErrInvalidTable, "table name must be an identifier", goerr.V("table", r.table))
+	}
+
+	return r, nil
+}
+
+// CreateTable creates the table if it does not exist.
+func (r *Repository) CreateTable(ctx context.Context) error {
+	var query string
+	switch r.dialect {
+	case DialectPostgres:
+		query = `CREATE TABLE IF NOT EXISTS %s (
+	session_id TEXT PRIMARY KEY,
+	history TEXT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`
+	case DialectMySQL:
+		query = `CREATE TABLE IF NOT EXISTS %s (
+	session_id VARCHAR(255) PRIMARY KEY,
+	history LONGTEXT NOT NULL,
+	updated_at DATETIME(6) NOT NULL
+)`
+	case DialectSQLite:
+		query = `CREATE TABLE IF NOT EXISTS %s (
+	session_id TEXT PRIMARY KEY,
+	history TEXT NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`
+	}
+
+	if _, err := r.db.ExecContext(ctx, fmt.Sprintf(query, r.table)); err != nil {
+		return goerr.Wrap(err, "failed to create history table", goerr.V("table", r.table))
+	}
+	return nil
+}
+
+// Load implements gollem.HistoryRepository. It returns nil if no history is saved for sessionID.
+func (r *Repository) Load(ctx context.Context, sessionID string) (*gollem.History, error) {
+	query := fmt.Sprintf("SELECT history FROM %s WHERE session_id = %s", r.table, r.placeholder(1))
+
+	var data string
+	err := r.db.QueryRowContext(ctx, query, sessionID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to select history", goerr.V("session_id", sessionID))
+	}
+
+	var history gollem.History
+	if err := json.Unmarshal([]byte(data), &history); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal history", goerr.V("session_id", sessionID))
+	}
+	return &history, nil
+}
+
+// Save implements gollem.HistoryRepository.
+func (r *Repository) Save(ctx context.Context, sessionID string, history *gollem.History) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal history", goerr.V("session_id", sessionID))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (session_id, history, updated_at) VALUES (%s, %s, %s) ",
+		r.table, r.placeholder(1), r.placeholder(2), r.placeholder(3))
+	if r.dialect == DialectMySQL {
+		query += "ON DUPLICATE KEY UPDATE history = VALUES(history), updated_at = VALUES(updated_at)"
+	} else {
+		query += "ON CONFLICT (session_id) DO UPDATE SET history = excluded.history, updated_at = excluded.updated_at"
+	}
+
+	if _, err := r.db.ExecContext(ctx, query, sessionID, string(data), gollem.Now(ctx).UTC()); err != nil {
+		return goerr.Wrap(err, "failed to save history", goerr.V("session_id", sessionID))
+	}
+	return nil
+}
+
+// ListSessions implements gollem.HistoryLister. Session IDs are returned in order of the last
+// update, newest first.
+func (r *Repository) ListSessions(ctx context.Context) ([]string, error) {
+	query := fmt.Sprintf("SELECT session_id FROM %s ORDER BY updated_at DESC", r.table)
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to select session IDs", goerr.V("table", r.table))
+	}
+	defer rows.Close()
+
+	var sessionIDs []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, goerr.Wrap(err, "failed to scan session ID", goerr.V("table", r.table))
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, goerr.Wrap(err, "failed to read session IDs", goerr.V("table", r.table))
+	}
+	return sessionIDs, nil
+}
+
+// placeholder returns the n-th placeholder of a query, starting from 1.
+func (r *Repository) placeholder(n int) string {
+	if r.dialect == DialectPostgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
@@ -0,0 +1,72 @@
+//go:build cgo
+
+package sqlrepo_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/history/sqlrepo"
+	"github.com/m-mizutani/gt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRepository(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "history.db"))
+	gt.NoError(t, err)
+	defer db.Close()
+
+	repo, err := sqlrepo.New(db, sqlrepo.DialectSQLite, sqlrepo.WithTable("histories"))
+	gt.NoError(t, err)
+	gt.NoError(t, repo.CreateTable(t.Context()))
+	// CreateTable is idempotent
+	gt.NoError(t, repo.CreateTable(t.Context()))
+
+	t.Run("not found", func(t *testing.T) {
+		history, err := repo.Load(t.Context(), "unknown")
+		gt.NoError(t, err)
+		gt.Nil(t, history)
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		first, err := gollem.NewHistoryBuilder().User("hello").Build()
+		gt.NoError(t, err)
+		gt.NoError(t, repo.Save(t.Context(), "sess1", first))
+
+		second, err := gollem.NewHistoryBuilder().User("hello").Assistant("hi").Build()
+		gt.NoError(t, err)
+		gt.NoError(t, repo.Save(t.Context(), "sess1", second))
+
+		history, err := repo.Load(t.Context(), "sess1")
+		gt.NoError(t, err)
+		gt.A(t, history.Messages).Length(2)
+
+		var count int
+		gt.NoError(t, db.QueryRow("SELECT COUNT(*) FROM histories").Scan(&count))
+		gt.Equal(t, 1, count)
+	})
+
+	t.Run("list sessions", func(t *testing.T) {
+		history, err := gollem.NewHistoryBuilder().User("hello").Build()
+		gt.NoError(t, err)
+		gt.NoError(t, repo.Save(t.Context(), "sess2", history))
+
+		sessionIDs, err := repo.ListSessions(t.Context())
+		gt.NoError(t, err)
+		// Newest first
+		gt.Equal(t, []string{"sess2", "sess1"}, sessionIDs)
+	})
+}
+
+func TestNew(t *testing.T) {
+	_, err := sqlrepo.New(nil, sqlrepo.DialectPostgres, sqlrepo.WithTable("histories; DROP TABLE users"))
+	gt.Error(t, err).Is(sqlrepo.ErrInvalidTable)
+
+	_, err = sqlrepo.New(nil, sqlrepo.DialectPostgres, sqlrepo.WithTable("app.histories"))
+	gt.NoError(t, err)
+
+	_, err = sqlrepo.New(nil, sqlrepo.Dialect("oracle"))
+	gt.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package gollem
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// HistoryBuilder builds a History programmatically, e.g. to inject retrieved FAQ answers or
+// previous tool results as prior turns. The built history is provider independent and can be
+// passed to WithHistory or WithSessionHistory of any LLM client.
+//
+// To be accepted by every provider, consecutive texts of the same role are merged into one
+// message, and each tool call is immediately followed by its result with a generated call ID.
+// Errors are deferred to Build.
+type HistoryBuilder struct {
+	messages []Message
+	err      error
+	newID    IDGenerator
+}
+
+// NewHistoryBuilder creates an empty HistoryBuilder.
+func NewHistoryBuilder() *HistoryBuilder {
+	return &HistoryBuilder{}
+}
+
+// IDGenerator sets the generator of tool call IDs, e.g. NewSequentialIDGenerator for golden
+// tests. IDs must be unique in the history and at most 40 characters.
+func (b *HistoryBuilder) IDGenerator(gen IDGenerator) *HistoryBuilder {
+	b.newID = gen
+	return b
+}
+
+// User adds a user text.
+func (b *HistoryBuilder) User(text string) *HistoryBuilder {
+	return b.text(RoleUser, text)
+}
+
+// Assistant adds an assistant text.
+func (b *HistoryBuilder) Assistant(text string) *HistoryBuilder {
+	return b.text(RoleAssistant, text)
+}
+
+// ToolCall adds a tool call by the assistant and its result. name must be a tool name accepted
+// by the providers, and args and result are sent as JSON objects.
+func (b *HistoryBuilder) ToolCall(name string, args, result map[string]any) *HistoryBuilder {
+	return b.toolCall(name, args, result, false)
+}
+
+// ToolError adds a tool call by the assistant that failed with errMsg.
+func (b *HistoryBuilder) ToolError(name string, args map[string]any, errMsg string) *HistoryBuilder {
+	return b.toolCall(name, args, map[string]any{"error": errMsg}, true)
+}
+
+// Build returns the built History. It fails if any message was invalid or if the history does
+// not start with a user message, which some providers require.
+func (b *HistoryBuilder) Build() (*History, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.messages) > 0 && b.messages[0].Role != RoleUser {
+		return nil, goerr.Wrap(ErrInvalidHistoryData, "history must start with a user message",
+			goerr.V("role", b.messages[0].Role))
+	}
+
+	history := &History{
+		Version:  HistoryVersion,
+		Messages: make([]Message, len(b.messages)),
+	}
+	for i, msg := range b.messages {
+		history.Messages[i] = cloneMessage(msg)
+	}
+	return history, nil
+}
+
+func (b *HistoryBuilder) text(role MessageRole, text string) *HistoryBuilder {
+	if b.err != nil {
+		return b
+	}
+	if strings.TrimSpace(text) == "" {
+		b.err = goerr.Wrap(ErrInvalidHistoryData, "text must not be empty", goerr.V("role", role))
+		return b
+	}
+
+	content, err := NewTextContent(text)
+	if err != nil {
+		b.err = goerr.Wrap(err, "failed to create text content")
+		return b
+	}
+	b.add(role, content)
+	return b
+}
+
+func (b *HistoryBuilder) toolCall(name string, args, result map[string]any, isError bool) *HistoryBuilder {
+	if b.err != nil {
+		return b
+	}
+	if name == "" {
+		b.err = goerr.Wrap(ErrInvalidHistoryData, "tool name must not be empty")
+		return b
+	}
+	if args == nil {
+		args = map[string]any{}
+	}
+	if result == nil {
+		result = map[string]any{}
+	}
+
+	// IDs must be unique and within the length limit of OpenAI (40 characters)
+	var id string
+	if b.newID != nil {
+		id = b.newID()
+	} else {
+		id = "call_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	}
+
+	call, err := NewToolCallContent(id, name, args)
+	if err != nil {
+		b.err = goerr.Wrap(err, "failed to create tool call content", goerr.V("name", name))
+		return b
+	}
+	resp, err := NewToolResponseContent(id, name, result, isError)
+	if err != nil {
+		b.err = goerr.Wrap(err, "failed to create tool response content", goerr.V("name", name))
+		return b
+	}
+
+	b.add(RoleAssistant, call)
+	b.messages = append(b.messages, Message{Role: RoleTool, Contents: []MessageContent{resp}})
+	return b
+}
+
+// add appends content to the last message if it has the same role, or as a new message.
+func (b *HistoryBuilder) add(role MessageRole, content MessageContent) {
+	if n := len(b.messages); n > 0 && b.messages[n-1].Role == role {
+		b.messages[n-1].Contents = append(b.messages[n-1].Contents, content)
+		return
+	}
+	b.messages = append(b.messages, Message{Role: role, Contents: []MessageContent{content}})
+}
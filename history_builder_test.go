@@ -0,0 +1,92 @@
+package gollem_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/claude"
+	"github.com/m-mizutani/gollem/llm/gemini"
+	"github.com/m-mizutani/gollem/llm/openai"
+	"github.com/m-mizutani/gt"
+)
+
+func TestHistoryBuilder(t *testing.T) {
+	t.Run("build history valid for all providers", func(t *testing.T) {
+		history, err := gollem.NewHistoryBuilder().
+			User("What is the refund policy?").
+			Assistant("Let me check the FAQ.").
+			ToolCall("search_faq", map[string]any{"query": "refund"}, map[string]any{"answer": "Within 30 days"}).
+			Assistant("Refunds are accepted within 30 days.").
+			User("Can I get a refund for order 123?").
+			ToolError("lookup_order", map[string]any{"id": "123"}, "order not found").
+			Build()
+		gt.NoError(t, err)
+
+		gt.Equal(t, gollem.HistoryVersion, history.Version)
+		roles := make([]gollem.MessageRole, len(history.Messages))
+		for i, msg := range history.Messages {
+			roles[i] = msg.Role
+		}
+		gt.A(t, roles).Equal([]gollem.MessageRole{
+			gollem.RoleUser,
+			gollem.RoleAssistant, // text and tool call are merged
+			gollem.RoleTool,
+			gollem.RoleAssistant,
+			gollem.RoleUser,
+			gollem.RoleAssistant,
+			gollem.RoleTool,
+		})
+
+		// tool call and result are paired by ID
+		call, err := history.Messages[1].Contents[1].GetToolCallContent()
+		gt.NoError(t, err)
+		resp, err := history.Messages[2].Contents[0].GetToolResponseContent()
+		gt.NoError(t, err)
+		gt.Equal(t, call.ID, resp.ToolCallID)
+		gt.Equal(t, "search_faq", resp.Name)
+		gt.Equal(t, "Within 30 days", resp.Response["answer"])
+		gt.True(t, len(call.ID) <= 40)
+
+		errResp, err := history.Messages[6].Contents[0].GetToolResponseContent()
+		gt.NoError(t, err)
+		gt.True(t, errResp.IsError)
+		gt.Equal(t, "order not found", errResp.Response["error"])
+
+		_, err = claude.ToMessages(history)
+		gt.NoError(t, err)
+		_, err = openai.ToMessages(history)
+		gt.NoError(t, err)
+		_, err = gemini.ToContents(history)
+		gt.NoError(t, err)
+
+		data, err := json.Marshal(history)
+		gt.NoError(t, err)
+		var restored gollem.History
+		gt.NoError(t, json.Unmarshal(data, &restored))
+		gt.Equal(t, len(history.Messages), len(restored.Messages))
+	})
+
+	t.Run("merge consecutive texts of same role", func(t *testing.T) {
+		history, err := gollem.NewHistoryBuilder().User("first").User("second").Build()
+		gt.NoError(t, err)
+		gt.A(t, history.Messages).Length(1)
+		gt.A(t, history.Messages[0].Contents).Length(2)
+	})
+
+	t.Run("history must start with user", func(t *testing.T) {
+		_, err := gollem.NewHistoryBuilder().Assistant("hello").Build()
+		gt.True(t, errors.Is(err, gollem.ErrInvalidHistoryData))
+	})
+
+	t.Run("empty text is error", func(t *testing.T) {
+		_, err := gollem.NewHistoryBuilder().User("hello").Assistant(" ").User("again").Build()
+		gt.True(t, errors.Is(err, gollem.ErrInvalidHistoryData))
+	})
+
+	t.Run("empty tool name is error", func(t *testing.T) {
+		_, err := gollem.NewHistoryBuilder().User("hello").ToolCall("", nil, nil).Build()
+		gt.True(t, errors.Is(err, gollem.ErrInvalidHistoryData))
+	})
+}
@@ -0,0 +1,482 @@
+package gollem
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// HistoryConversionKind is a kind of change made to a history by History.ConvertTo.
+type HistoryConversionKind string
+
+const (
+	// HistoryConversionDropped means the content is removed because the provider can not keep it
+	HistoryConversionDropped HistoryConversionKind = "dropped"
+	// HistoryConversionApproximated means the content is kept in another form, e.g. an image
+	// URL as a text reference
+	HistoryConversionApproximated HistoryConversionKind = "approximated"
+	// HistoryConversionUnsupported means the content is kept, but the API of the provider may
+	// reject it
+	HistoryConversionUnsupported HistoryConversionKind = "unsupported"
+)
+
+// HistoryConversionIssue is a change made to a content or a message by History.ConvertTo.
+type HistoryConversionIssue struct {
+	Kind HistoryConversionKind `json:"kind"`
+	// Message is the index of the message in the source history
+	Message int `json:"message"`
+	// Content is the type of the content, or empty if the issue is about the message itself
+	Content MessageContentType `json:"content,omitempty"`
+	Reason  string             `json:"reason"`
+}
+
+// HistoryConversionReport tells what History.ConvertTo dropped or approximated.
+type HistoryConversionReport struct {
+	From   LLMType                  `json:"from"`
+	To     LLMType                  `json:"to"`
+	Issues []HistoryConversionIssue `json:"issues,omitempty"`
+}
+
+// Lossless returns true if no content is dropped or approximated.
+func (r *HistoryConversionReport) Lossless() bool {
+	for _, issue := range r.Issues {
+		if issue.Kind != HistoryConversionUnsupported {
+			return false
+		}
+	}
+	return true
+}
+
+// ConvertTo returns a copy of the history converted for the provider of llmType, e.g. to
+// continue a conversation with another provider. Messages are kept in the unified format, but
+// contents that the provider can not keep are dropped or approximated explicitly, so the
+// converted history round-trips through the provider without further changes, and the report
+// tells what was changed. Provider-specific metadata of contents (Meta), such as signatures of
+// thinking, is dropped because it is valid only for the source provider. The history itself is
+// not modified. A history of the same type is returned as a clone. It fails with
+// ErrLLMTypeMismatch if llmType is unknown.
+func (x *History) ConvertTo(llmType LLMType) (*History, *HistoryConversionReport, error) {
+	switch llmType {
+	case LLMTypeOpenAI, LLMTypeGemini, LLMTypeClaude, LLMTypeBedrock:
+	default:
+		return nil, nil, goerr.Wrap(ErrLLMTypeMismatch, "unknown LLM type to convert history", goerr.V("type", llmType))
+	}
+
+	if x == nil {
+		return &History{LLType: llmType, Version: HistoryVersion}, &HistoryConversionReport{To: llmType}, nil
+	}
+	report := &HistoryConversionReport{From: x.LLType, To: llmType}
+	if x.LLType == llmType {
+		return x.Clone(), report, nil
+	}
+
+	c := &historyConverter{to: llmType, report: report}
+	messages := make([]sourceMessage, 0, len(x.Messages))
+	for i, msg := range x.Messages {
+		converted, err := c.convertMessage(i, cloneMessage(msg))
+		if err != nil {
+			return nil, nil, err
+		}
+		messages = append(messages, sourceMessage{Message: converted, index: i})
+	}
+
+	if llmType != LLMTypeOpenAI {
+		var err error
+		if messages, err = c.mergeSystemMessages(messages); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.fixToolCallIDs(messages); err != nil {
+		return nil, nil, err
+	}
+	if llmType == LLMTypeOpenAI {
+		var err error
+		if messages, err = splitToolResponses(messages); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	history := &History{LLType: llmType, Version: HistoryVersion}
+	for _, msg := range messages {
+		if len(msg.Contents) > 0 {
+			history.Messages = append(history.Messages, msg.Message)
+		}
+	}
+	return history, report, nil
+}
+
+// sourceMessage is a message being converted with the index of its source message.
+type sourceMessage struct {
+	Message
+	index int
+}
+
+type historyConverter struct {
+	to     LLMType
+	report *HistoryConversionReport
+}
+
+func (c *historyConverter) issue(kind HistoryConversionKind, index int, content MessageContentType, reason string) {
+	c.report.Issues = append(c.report.Issues, HistoryConversionIssue{
+		Kind:    kind,
+		Message: index,
+		Content: content,
+		Reason:  reason,
+	})
+}
+
+func (c *historyConverter) convertMessage(index int, msg Message) (Message, error) {
+	if msg.Name != "" && c.to != LLMTypeOpenAI {
+		c.issue(HistoryConversionDropped, index, "", "name of the message is not supported")
+		msg.Name = ""
+	}
+	if msg.Role == RoleTool && c.to != LLMTypeOpenAI {
+		// tool responses are sent in user messages except by OpenAI
+		msg.Role = RoleUser
+	}
+
+	contents := make([]MessageContent, 0, len(msg.Contents))
+	for _, content := range msg.Contents {
+		hasMeta := len(content.Meta) > 0
+		content.Meta = nil
+
+		converted, err := c.convertContent(index, content)
+		if err != nil {
+			return Message{}, goerr.Wrap(err, "failed to convert history content",
+				goerr.V("message", index), goerr.V("type", content.Type))
+		}
+		if converted == nil {
+			continue
+		}
+		if hasMeta {
+			c.issue(HistoryConversionDropped, index, content.Type, "provider-specific metadata such as signatures is valid only for the source provider")
+		}
+		contents = append(contents, *converted)
+	}
+	msg.Contents = contents
+	return msg, nil
+}
+
+// convertContent returns the content converted for the provider, or nil if it is dropped.
+func (c *historyConverter) convertContent(index int, content MessageContent) (*MessageContent, error) {
+	switch content.Type {
+	case MessageContentTypeText:
+		text, err := content.GetTextContent()
+		if err != nil {
+			return nil, err
+		}
+		if text.Text == "" {
+			return nil, nil
+		}
+		return &content, nil
+
+	case MessageContentTypeThinking:
+		thinking, err := content.GetThinkingContent()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case thinking.Text == "":
+			c.issue(HistoryConversionDropped, index, content.Type, "redacted thinking can be read only by the source provider")
+			return nil, nil
+		case c.to == LLMTypeClaude || c.to == LLMTypeBedrock:
+			c.issue(HistoryConversionDropped, index, content.Type, "thinking requires a signature of the provider")
+			return nil, nil
+		}
+		return &content, nil
+
+	case MessageContentTypeImage:
+		img, err := content.GetImageContent()
+		if err != nil {
+			return nil, err
+		}
+		return c.convertImage(index, img)
+
+	case MessageContentTypePDF:
+		pdf, err := content.GetPDFContent()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(pdf.Data) == 0 && pdf.URL == "":
+			c.issue(HistoryConversionDropped, index, content.Type, "PDF has neither data nor URL")
+			return nil, nil
+		case len(pdf.Data) == 0 && (c.to == LLMTypeOpenAI || c.to == LLMTypeBedrock):
+			c.issue(HistoryConversionApproximated, index, content.Type, "PDF URL is kept as a text reference")
+			return textContent(fmt.Sprintf("[PDF: %s]", pdf.URL))
+		case c.to == LLMTypeOpenAI:
+			c.issue(HistoryConversionUnsupported, index, content.Type, "OpenAI does not accept PDF input")
+		}
+		return &content, nil
+
+	case MessageContentTypeFile:
+		file, err := content.GetFileContent()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case IsTextMimeType(file.MediaType) && c.to == LLMTypeOpenAI:
+			c.issue(HistoryConversionApproximated, index, content.Type, "text file is kept as text")
+			return textContent(fileText(file.Name, file.MediaType, string(file.Data)))
+		case !IsTextMimeType(file.MediaType) && (c.to != LLMTypeBedrock || !slices.Contains(bedrockDocumentTypes, file.MediaType)):
+			c.issue(HistoryConversionUnsupported, index, content.Type, "file type may not be accepted: "+file.MediaType)
+		}
+		return &content, nil
+
+	case MessageContentTypeToolCall:
+		return &content, nil
+
+	case MessageContentTypeToolResponse:
+		resp, err := content.GetToolResponseContent()
+		if err != nil {
+			return nil, err
+		}
+		if resp.IsError && (c.to == LLMTypeGemini || c.to == LLMTypeOpenAI) {
+			c.issue(HistoryConversionApproximated, index, content.Type, "error flag of tool response is not kept; the response itself tells the error")
+			resp.IsError = false
+		}
+		if c.to == LLMTypeClaude || c.to == LLMTypeBedrock {
+			// the name is resolved from the tool call when it's converted to another provider
+			resp.Name = ""
+		}
+		converted, err := NewToolResponseContent(resp.ToolCallID, resp.Name, resp.Response, resp.IsError)
+		if err != nil {
+			return nil, err
+		}
+		return &converted, nil
+
+	default:
+		c.issue(HistoryConversionDropped, index, content.Type, "unknown content type")
+		return nil, nil
+	}
+}
+
+// bedrockDocumentTypes are the media types of binary documents accepted by Bedrock.
+var bedrockDocumentTypes = []string{
+	"application/msword",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.ms-excel",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// bedrockImageTypes are the media types of images accepted by Bedrock.
+var bedrockImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+func (c *historyConverter) convertImage(index int, img *ImageContent) (*MessageContent, error) {
+	if len(img.Data) == 0 && img.URL == "" {
+		c.issue(HistoryConversionDropped, index, MessageContentTypeImage, "image has neither data nor URL")
+		return nil, nil
+	}
+
+	if img.Detail != "" && c.to != LLMTypeOpenAI {
+		c.issue(HistoryConversionDropped, index, MessageContentTypeImage, "detail of image is supported only by OpenAI")
+		img.Detail = ""
+	}
+
+	if len(img.Data) == 0 {
+		switch c.to {
+		case LLMTypeBedrock:
+			c.issue(HistoryConversionApproximated, index, MessageContentTypeImage, "image URL is kept as a text reference")
+			return textContent(fmt.Sprintf("[Image: %s]", img.URL))
+		case LLMTypeClaude, LLMTypeOpenAI:
+			if img.MediaType != "" {
+				c.issue(HistoryConversionDropped, index, MessageContentTypeImage, "media type of image URL is not kept")
+				img.MediaType = ""
+			}
+		}
+	} else {
+		img.URL = ""
+		if c.to == LLMTypeBedrock && !slices.Contains(bedrockImageTypes, img.MediaType) {
+			c.issue(HistoryConversionDropped, index, MessageContentTypeImage, "image type is not supported: "+img.MediaType)
+			return nil, nil
+		}
+	}
+
+	converted, err := NewImageContent(img.MediaType, img.Data, img.URL, img.Detail)
+	if err != nil {
+		return nil, err
+	}
+	return &converted, nil
+}
+
+// mergeSystemMessages merges texts of system messages into the first user message, as the
+// providers except OpenAI take the system prompt separately from the history.
+func (c *historyConverter) mergeSystemMessages(messages []sourceMessage) ([]sourceMessage, error) {
+	var texts []string
+	var systems []int
+	result := make([]sourceMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role != RoleSystem {
+			result = append(result, msg)
+			continue
+		}
+		for _, content := range msg.Contents {
+			if content.Type != MessageContentTypeText {
+				c.issue(HistoryConversionDropped, msg.index, content.Type, "system message can have only texts")
+				continue
+			}
+			text, err := content.GetTextContent()
+			if err != nil {
+				return nil, err
+			}
+			texts = append(texts, text.Text)
+		}
+		systems = append(systems, msg.index)
+	}
+	if len(systems) == 0 {
+		return result, nil
+	}
+
+	for i, msg := range result {
+		if msg.Role != RoleUser {
+			continue
+		}
+		if len(texts) > 0 {
+			system, err := NewTextContent(strings.Join(texts, "\n") + "\n\n")
+			if err != nil {
+				return nil, err
+			}
+			result[i].Contents = append([]MessageContent{system}, msg.Contents...)
+		}
+		for _, index := range systems {
+			c.issue(HistoryConversionApproximated, index, "", "system message is merged into the first user message")
+		}
+		return result, nil
+	}
+
+	for _, index := range systems {
+		c.issue(HistoryConversionDropped, index, "", "system message requires a user message to be merged into")
+	}
+	return result, nil
+}
+
+// fixToolCallIDs makes tool call IDs fit the provider and pairs tool responses with them in
+// order of the calls. Gemini does not keep IDs and restores them from tool names, and other
+// providers require unique IDs. Names of tool responses are resolved from their calls for
+// providers requiring them.
+func (c *historyConverter) fixToolCallIDs(messages []sourceMessage) error {
+	used := make(map[string]bool)
+	renamed := make(map[string][]string) // source ID -> new IDs of calls not responded yet
+	names := make(map[string]string)     // new ID -> tool name
+
+	for i := range messages {
+		msg := &messages[i]
+		for j, content := range msg.Contents {
+			switch content.Type {
+			case MessageContentTypeToolCall:
+				call, err := content.GetToolCallContent()
+				if err != nil {
+					return err
+				}
+				id := call.ID
+				switch {
+				case c.to == LLMTypeGemini:
+					id = geminiToolCallID(call.Name)
+					if id != call.ID {
+						c.issue(HistoryConversionApproximated, msg.index, content.Type, "Gemini does not keep tool call IDs")
+					}
+				case id == "" || used[id]:
+					for n := 0; id == "" || used[id]; n++ {
+						id = fmt.Sprintf("call_%s_%d", call.Name, n)
+					}
+					c.issue(HistoryConversionApproximated, msg.index, content.Type, "tool call ID is missing or duplicated and renamed")
+				}
+				used[id] = true
+				renamed[call.ID] = append(renamed[call.ID], id)
+				names[id] = call.Name
+
+				if id != call.ID {
+					if msg.Contents[j], err = NewToolCallContent(id, call.Name, call.Arguments); err != nil {
+						return err
+					}
+				}
+
+			case MessageContentTypeToolResponse:
+				resp, err := content.GetToolResponseContent()
+				if err != nil {
+					return err
+				}
+				id := resp.ToolCallID
+				if ids := renamed[resp.ToolCallID]; len(ids) > 0 {
+					id = ids[0]
+					renamed[resp.ToolCallID] = ids[1:]
+				}
+				name := resp.Name
+				if name == "" && (c.to == LLMTypeGemini || c.to == LLMTypeOpenAI) {
+					name = names[id]
+				}
+				if id != resp.ToolCallID || name != resp.Name {
+					if msg.Contents[j], err = NewToolResponseContent(id, name, resp.Response, resp.IsError); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// geminiToolCallID returns the ID of a tool call restored from Gemini contents.
+func geminiToolCallID(name string) string {
+	return "call_" + name + "_0"
+}
+
+// splitToolResponses moves tool responses into messages of their own, and puts thinking at the
+// beginning and tool calls at the end of messages, as OpenAI keeps them.
+func splitToolResponses(messages []sourceMessage) ([]sourceMessage, error) {
+	result := make([]sourceMessage, 0, len(messages))
+	for _, msg := range messages {
+		var thinking []string
+		var contents, calls []MessageContent
+		var responses []sourceMessage
+		for _, content := range msg.Contents {
+			switch content.Type {
+			case MessageContentTypeThinking:
+				t, err := content.GetThinkingContent()
+				if err != nil {
+					return nil, err
+				}
+				thinking = append(thinking, t.Text)
+			case MessageContentTypeToolCall:
+				calls = append(calls, content)
+			case MessageContentTypeToolResponse:
+				resp, err := content.GetToolResponseContent()
+				if err != nil {
+					return nil, err
+				}
+				// OpenAI keeps the tool name as the name of the tool message
+				responses = append(responses, sourceMessage{
+					Message: Message{Role: RoleTool, Contents: []MessageContent{content}, Name: resp.Name},
+					index:   msg.index,
+				})
+			default:
+				contents = append(contents, content)
+			}
+		}
+
+		if len(thinking) > 0 {
+			t, err := NewThinkingContent(strings.Join(thinking, ""))
+			if err != nil {
+				return nil, err
+			}
+			contents = append([]MessageContent{t}, contents...)
+		}
+		msg.Contents = append(contents, calls...)
+		if len(responses) > 0 && msg.Role == RoleTool {
+			msg.Role = RoleUser
+		}
+		result = append(result, msg)
+		result = append(result, responses...)
+	}
+	return result, nil
+}
+
+func textContent(text string) (*MessageContent, error) {
+	content, err := NewTextContent(text)
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
@@ -0,0 +1,207 @@
+package gollem_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/bedrock"
+	"github.com/m-mizutani/gollem/llm/claude"
+	"github.com/m-mizutani/gollem/llm/gemini"
+	"github.com/m-mizutani/gollem/llm/openai"
+	"github.com/m-mizutani/gt"
+)
+
+// roundTripHistory converts h to messages of the provider of h and back
+func roundTripHistory(t *testing.T, h *gollem.History) *gollem.History {
+	t.Helper()
+	var restored *gollem.History
+	switch h.LLType {
+	case gollem.LLMTypeClaude:
+		msgs, err := claude.ToMessages(h)
+		gt.NoError(t, err)
+		restored, err = claude.NewHistory(msgs)
+		gt.NoError(t, err)
+	case gollem.LLMTypeGemini:
+		contents, err := gemini.ToContents(h)
+		gt.NoError(t, err)
+		restored, err = gemini.NewHistory(contents)
+		gt.NoError(t, err)
+	case gollem.LLMTypeOpenAI:
+		msgs, err := openai.ToMessages(h)
+		gt.NoError(t, err)
+		restored, err = openai.NewHistory(msgs)
+		gt.NoError(t, err)
+	case gollem.LLMTypeBedrock:
+		msgs, err := bedrock.ToMessages(h)
+		gt.NoError(t, err)
+		restored, err = bedrock.NewHistory(msgs)
+		gt.NoError(t, err)
+	}
+	return restored
+}
+
+// withoutMeta returns messages without provider-specific metadata of contents
+func withoutMeta(messages []gollem.Message) []gollem.Message {
+	result := make([]gollem.Message, len(messages))
+	for i, msg := range messages {
+		result[i] = gollem.Message{Role: msg.Role, Name: msg.Name}
+		for _, c := range msg.Contents {
+			result[i].Contents = append(result[i].Contents, gollem.MessageContent{Type: c.Type, Data: c.Data})
+		}
+	}
+	return result
+}
+
+func issueKinds(report *gollem.HistoryConversionReport) map[gollem.MessageContentType][]gollem.HistoryConversionKind {
+	kinds := make(map[gollem.MessageContentType][]gollem.HistoryConversionKind)
+	for _, issue := range report.Issues {
+		kinds[issue.Content] = append(kinds[issue.Content], issue.Kind)
+	}
+	return kinds
+}
+
+func TestHistoryConvertTo(t *testing.T) {
+	png, err := os.ReadFile("testdata/test_image.png")
+	gt.NoError(t, err)
+
+	content := func(c gollem.MessageContent, err error) gollem.MessageContent {
+		gt.NoError(t, err)
+		return c
+	}
+	source := &gollem.History{
+		LLType:  gollem.LLMTypeClaude,
+		Version: gollem.HistoryVersion,
+		Messages: []gollem.Message{
+			{Role: gollem.RoleSystem, Contents: []gollem.MessageContent{
+				content(gollem.NewTextContent("You are a weather assistant.")),
+			}},
+			{Role: gollem.RoleUser, Contents: []gollem.MessageContent{
+				content(gollem.NewTextContent("Where is this?")),
+				content(gollem.NewImageContent("image/png", png, "", "")),
+				content(gollem.NewPDFContent([]byte("%PDF-1.4 test"), "")),
+			}},
+			{Role: gollem.RoleAssistant, Contents: []gollem.MessageContent{
+				{
+					Type: gollem.MessageContentTypeThinking,
+					Data: json.RawMessage(`{"text":"It looks like Tokyo."}`),
+					Meta: json.RawMessage(`{"signature":"sig"}`),
+				},
+				content(gollem.NewTextContent("Let me check the weather.")),
+				content(gollem.NewToolCallContent("toolu_1", "get_weather", map[string]any{"city": "Tokyo"})),
+				content(gollem.NewToolCallContent("toolu_2", "get_weather", map[string]any{"city": "Osaka"})),
+			}},
+			{Role: gollem.RoleUser, Contents: []gollem.MessageContent{
+				content(gollem.NewToolResponseContent("toolu_1", "", map[string]any{"temperature": 25}, false)),
+				content(gollem.NewToolResponseContent("toolu_2", "", map[string]any{"error": "timeout"}, true)),
+			}},
+			{Role: gollem.RoleAssistant, Contents: []gollem.MessageContent{
+				content(gollem.NewTextContent("It's 25°C in Tokyo.")),
+			}},
+		},
+	}
+	original := source.Clone()
+
+	for _, llmType := range []gollem.LLMType{gollem.LLMTypeGemini, gollem.LLMTypeOpenAI, gollem.LLMTypeBedrock} {
+		t.Run(string(llmType), func(t *testing.T) {
+			converted, report, err := source.ConvertTo(llmType)
+			gt.NoError(t, err)
+			gt.Equal(t, llmType, converted.LLType)
+			gt.Equal(t, gollem.LLMTypeClaude, report.From)
+			gt.False(t, report.Lossless())
+
+			// the converted history is kept as it is by the provider
+			gt.Equal(t, withoutMeta(converted.Messages), withoutMeta(roundTripHistory(t, converted).Messages))
+
+			// and it can be converted back with tool calls paired
+			back, _, err := converted.ConvertTo(gollem.LLMTypeClaude)
+			gt.NoError(t, err)
+			gt.Equal(t, withoutMeta(back.Messages), withoutMeta(roundTripHistory(t, back).Messages))
+			var calls, responses []string
+			for _, msg := range back.Messages {
+				for _, c := range msg.Contents {
+					if call, err := c.GetToolCallContent(); err == nil {
+						calls = append(calls, call.ID)
+					}
+					if resp, err := c.GetToolResponseContent(); err == nil {
+						responses = append(responses, resp.ToolCallID)
+					}
+				}
+			}
+			gt.A(t, calls).Length(2)
+			gt.NotEqual(t, calls[0], calls[1])
+			gt.Equal(t, calls, responses)
+		})
+	}
+
+	// source is not modified
+	gt.Equal(t, original, source)
+
+	t.Run("report of Gemini", func(t *testing.T) {
+		converted, report, err := source.ConvertTo(gollem.LLMTypeGemini)
+		gt.NoError(t, err)
+		kinds := issueKinds(report)
+		gt.Equal(t, []gollem.HistoryConversionKind{gollem.HistoryConversionApproximated}, kinds[""])
+		gt.Equal(t, []gollem.HistoryConversionKind{gollem.HistoryConversionDropped}, kinds[gollem.MessageContentTypeThinking])
+		gt.A(t, kinds[gollem.MessageContentTypeToolCall]).Length(2)
+		gt.Equal(t, []gollem.HistoryConversionKind{gollem.HistoryConversionApproximated}, kinds[gollem.MessageContentTypeToolResponse])
+
+		// system message is merged into the first user message
+		gt.A(t, converted.Messages).Length(4)
+		text, err := converted.Messages[0].Contents[0].GetTextContent()
+		gt.NoError(t, err)
+		gt.Equal(t, "You are a weather assistant.\n\n", text.Text)
+
+		// names of tool responses are resolved from the tool calls
+		resp, err := converted.Messages[2].Contents[0].GetToolResponseContent()
+		gt.NoError(t, err)
+		gt.Equal(t, "get_weather", resp.Name)
+	})
+
+	t.Run("report of OpenAI", func(t *testing.T) {
+		converted, report, err := source.ConvertTo(gollem.LLMTypeOpenAI)
+		gt.NoError(t, err)
+		kinds := issueKinds(report)
+		gt.Equal(t, []gollem.HistoryConversionKind{gollem.HistoryConversionUnsupported}, kinds[gollem.MessageContentTypePDF])
+		gt.Equal(t, gollem.RoleSystem, converted.Messages[0].Role)
+		// tool responses are split into tool messages
+		gt.A(t, converted.Messages).Length(6)
+		gt.Equal(t, gollem.RoleTool, converted.Messages[3].Role)
+		gt.Equal(t, "get_weather", converted.Messages[3].Name)
+	})
+
+	t.Run("thinking to Claude is dropped", func(t *testing.T) {
+		h := &gollem.History{
+			LLType: gollem.LLMTypeOpenAI,
+			Messages: []gollem.Message{
+				{Role: gollem.RoleUser, Contents: []gollem.MessageContent{content(gollem.NewTextContent("hi"))}},
+				{Role: gollem.RoleAssistant, Contents: []gollem.MessageContent{
+					content(gollem.NewThinkingContent("greeting")),
+					content(gollem.NewImageContent("image/png", nil, "https://example.com/a.png", "high")),
+				}},
+			},
+		}
+		converted, report, err := h.ConvertTo(gollem.LLMTypeClaude)
+		gt.NoError(t, err)
+		gt.A(t, converted.Messages[1].Contents).Length(1)
+		img, err := converted.Messages[1].Contents[0].GetImageContent()
+		gt.NoError(t, err)
+		gt.Equal(t, "https://example.com/a.png", img.URL)
+		gt.Equal(t, "", img.MediaType)
+		gt.Equal(t, "", img.Detail)
+		gt.A(t, report.Issues).Length(3)
+	})
+
+	t.Run("same type is cloned", func(t *testing.T) {
+		converted, report, err := source.ConvertTo(gollem.LLMTypeClaude)
+		gt.NoError(t, err)
+		gt.True(t, report.Lossless())
+		gt.Equal(t, source, converted)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, _, err := source.ConvertTo("unknown")
+		gt.Error(t, err).Is(gollem.ErrLLMTypeMismatch)
+	})
+}
@@ -0,0 +1,191 @@
+package gollem
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// HistoryFlushPolicy is a set of events on which the agent saves the session history to the
+// HistoryRepository of WithHistoryRepository. Combine events with "|".
+type HistoryFlushPolicy uint
+
+const (
+	// HistoryFlushOnContentBlock saves the history after every LLM round-trip and after the
+	// strategy appends its response. Progress is preserved even if the process crashes in the
+	// middle of Execute, at the cost of a Save per LLM call.
+	HistoryFlushOnContentBlock HistoryFlushPolicy = 1 << iota
+
+	// HistoryFlushOnExecute saves the history at the end of every Execute, including a failed
+	// or canceled one.
+	HistoryFlushOnExecute
+
+	// HistoryFlushOnCompaction saves the history after an LLM round-trip that made it shorter,
+	// e.g. by the compacter middleware, so the repository does not keep growing the history.
+	HistoryFlushOnCompaction
+
+	// HistoryFlushOnSignal saves the history of the last LLM round-trip not saved yet when the
+	// process receives SIGINT or SIGTERM during Execute. The signal is delivered again after the
+	// history is saved, so that its default action still applies. Handlers registered by
+	// signal.Notify then receive the signal twice; disable the redelivery by
+	// WithHistorySignalRedelivery if the application handles the signal itself.
+	HistoryFlushOnSignal
+
+	// DefaultHistoryFlushPolicy is the policy without WithHistoryFlushPolicy.
+	DefaultHistoryFlushPolicy = HistoryFlushOnContentBlock
+)
+
+// flushSignals are the signals of HistoryFlushOnSignal
+var flushSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// WithHistoryFlushPolicy sets when the history is saved to the HistoryRepository of
+// WithHistoryRepository. The default is DefaultHistoryFlushPolicy. With a policy without
+// HistoryFlushOnContentBlock, call Agent.FlushHistory to save the history at any other time.
+func WithHistoryFlushPolicy(policy HistoryFlushPolicy) Option {
+	return func(s *gollemConfig) {
+		s.historyFlushPolicy = policy
+	}
+}
+
+// WithHistorySignalRedelivery sets whether the signal of HistoryFlushOnSignal is delivered
+// again after the history is saved. The default is true, so that the default action of the
+// signal, exiting the process, still applies. Set false if the application handles SIGINT and
+// SIGTERM by signal.Notify or signal.NotifyContext, because the redelivered signal reaches its
+// handlers a second time.
+func WithHistorySignalRedelivery(redeliver bool) Option {
+	return func(s *gollemConfig) {
+		s.historySignalRedelivery = redeliver
+	}
+}
+
+// historyFlusher serializes saves of the history and keeps the latest history not saved yet,
+// to save it on signals without reading the session during Execute.
+type historyFlusher struct {
+	mu      sync.Mutex
+	pending *History
+}
+
+func (f *historyFlusher) save(ctx context.Context, cfg *gollemConfig, history *History) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := cfg.historyRepo.Save(ctx, cfg.historySessionID, history); err != nil {
+		return goerr.Wrap(err, "failed to save history to repository",
+			goerr.V("session_id", cfg.historySessionID))
+	}
+	f.pending = nil
+	return nil
+}
+
+func (f *historyFlusher) setPending(history *History) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = history
+}
+
+// savePending saves the pending history if any.
+func (f *historyFlusher) savePending(ctx context.Context, cfg *gollemConfig) error {
+	f.mu.Lock()
+	pending := f.pending
+	f.mu.Unlock()
+
+	if pending == nil {
+		return nil
+	}
+	return f.save(ctx, cfg, pending)
+}
+
+// FlushHistory saves the history of the current session to the HistoryRepository now, e.g.
+// before the process exits with a flush policy without HistoryFlushOnContentBlock. It does
+// nothing if WithHistoryRepository is not set or the agent has no session yet. It must not be
+// called while Execute runs; use HistoryFlushOnSignal to save the history on shutdown during
+// Execute.
+func (g *Agent) FlushHistory(ctx context.Context) error {
+	if g.historyRepo == nil || g.currentSession == nil {
+		return nil
+	}
+	return g.flushSessionHistory(ctx, &g.gollemConfig)
+}
+
+// flushSessionHistory saves the history of the current session to the repository.
+func (g *Agent) flushSessionHistory(ctx context.Context, cfg *gollemConfig) error {
+	history, err := g.currentSession.History()
+	if err != nil {
+		return goerr.Wrap(err, "failed to get session history for save")
+	}
+	return g.historyFlusher.save(ctx, cfg, history)
+}
+
+// historyLength returns the number of messages of the session history before an LLM call if
+// HistoryFlushOnCompaction needs it to detect compaction, or -1 otherwise.
+func (g *Agent) historyLength(cfg *gollemConfig) int {
+	if cfg.historyRepo == nil || cfg.historyFlushPolicy&HistoryFlushOnCompaction == 0 {
+		return -1
+	}
+	n, err := sessionHistoryLength(g.currentSession)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// historyUpdated saves the session history updated by an LLM round-trip or the strategy by the
+// flush policy. before is the number of messages before the update, or -1 if unknown.
+func (g *Agent) historyUpdated(ctx context.Context, cfg *gollemConfig, before int) error {
+	policy := cfg.historyFlushPolicy
+	if cfg.historyRepo == nil || policy&(HistoryFlushOnContentBlock|HistoryFlushOnCompaction|HistoryFlushOnSignal) == 0 {
+		return nil
+	}
+
+	history, err := g.currentSession.History()
+	if err != nil {
+		return goerr.Wrap(err, "failed to get session history for save")
+	}
+
+	compacted := before >= 0 && history != nil && len(history.Messages) < before
+	if policy&HistoryFlushOnContentBlock != 0 || (policy&HistoryFlushOnCompaction != 0 && compacted) {
+		return g.historyFlusher.save(ctx, cfg, history)
+	}
+	g.historyFlusher.setPending(history)
+	return nil
+}
+
+// flushHistoryOnSignal saves the pending history when the process receives a signal of
+// flushSignals until the returned function is called.
+func (g *Agent) flushHistoryOnSignal(ctx context.Context, cfg *gollemConfig) func() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, flushSignals...)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case sig := <-sigCh:
+			signal.Stop(sigCh)
+			if err := g.historyFlusher.savePending(context.WithoutCancel(ctx), cfg); err != nil {
+				cfg.logger.Error("failed to save history on signal", "error", err, "signal", sig.String())
+			}
+
+			// Deliver the signal again for its default action. Other handlers receive it twice.
+			if !cfg.historySignalRedelivery {
+				return
+			}
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				_ = p.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+		wg.Wait()
+	}
+}
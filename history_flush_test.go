@@ -0,0 +1,227 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// syncHistoryRepository is a HistoryRepository safe for saves from other goroutines.
+type syncHistoryRepository struct {
+	mu    sync.Mutex
+	saved []*gollem.History
+}
+
+func (r *syncHistoryRepository) Load(ctx context.Context, sessionID string) (*gollem.History, error) {
+	return nil, nil
+}
+
+func (r *syncHistoryRepository) Save(ctx context.Context, sessionID string, history *gollem.History) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = append(r.saved, history)
+	return nil
+}
+
+func (r *syncHistoryRepository) saves() []*gollem.History {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*gollem.History(nil), r.saved...)
+}
+
+// newFlushTestAgent returns an agent calling the "echo" tool twice before the final answer.
+// The session history has as many messages as LLM calls so far, or lengths[call] if set.
+// generate is called before each LLM call if not nil.
+func newFlushTestAgent(repo gollem.HistoryRepository, lengths map[int]int, generate func(call int) error, options ...gollem.Option) *gollem.Agent {
+	var calls int
+	session := &mock.SessionMock{
+		GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+			calls++
+			if generate != nil {
+				if err := generate(calls); err != nil {
+					return nil, err
+				}
+			}
+			if calls <= 2 {
+				return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{{ID: "call", Name: "echo", Arguments: map[string]any{}}}}, nil
+			}
+			return &gollem.Response{Texts: []string{"done"}}, nil
+		},
+		HistoryFunc: func() (*gollem.History, error) {
+			n := calls
+			if length, ok := lengths[calls]; ok {
+				n = length
+			}
+			return &gollem.History{Version: gollem.HistoryVersion, Messages: make([]gollem.Message, n)}, nil
+		},
+	}
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return session, nil
+		},
+	}
+	tool := &mockTool{
+		spec: gollem.ToolSpec{Name: "echo", Description: "echo"},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{"ok": true}, nil
+		},
+	}
+
+	options = append([]gollem.Option{gollem.WithHistoryRepository(repo, "sess1"), gollem.WithTools(tool)}, options...)
+	return gollem.New(client, options...)
+}
+
+func TestHistoryFlushPolicy(t *testing.T) {
+	t.Run("default saves after every round-trip", func(t *testing.T) {
+		repo := &syncHistoryRepository{}
+		agent := newFlushTestAgent(repo, nil, nil)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		// 3 LLM calls and the final response appended by the strategy
+		gt.A(t, repo.saves()).Length(4)
+	})
+
+	t.Run("on execute saves once at the end", func(t *testing.T) {
+		repo := &syncHistoryRepository{}
+		agent := newFlushTestAgent(repo, nil, nil, gollem.WithHistoryFlushPolicy(gollem.HistoryFlushOnExecute))
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, repo.saves()).Length(1).At(0, func(t testing.TB, v *gollem.History) {
+			gt.A(t, v.Messages).Length(3)
+		})
+	})
+
+	t.Run("on execute saves failed execution", func(t *testing.T) {
+		repo := &syncHistoryRepository{}
+		errLLM := errors.New("llm failed")
+		agent := newFlushTestAgent(repo, nil, func(call int) error {
+			if call == 2 {
+				return errLLM
+			}
+			return nil
+		}, gollem.WithHistoryFlushPolicy(gollem.HistoryFlushOnExecute))
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(errLLM)
+		gt.A(t, repo.saves()).Length(1)
+	})
+
+	t.Run("on compaction saves when history gets shorter", func(t *testing.T) {
+		repo := &syncHistoryRepository{}
+		// The history of 5 messages after the first call is compacted to 2 by the second call
+		agent := newFlushTestAgent(repo, map[int]int{1: 5}, nil, gollem.WithHistoryFlushPolicy(gollem.HistoryFlushOnCompaction))
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, repo.saves()).Length(1).At(0, func(t testing.TB, v *gollem.History) {
+			gt.A(t, v.Messages).Length(2)
+		})
+	})
+
+	t.Run("FlushHistory saves on demand", func(t *testing.T) {
+		repo := &syncHistoryRepository{}
+		agent := newFlushTestAgent(repo, nil, nil, gollem.WithHistoryFlushPolicy(0))
+
+		// No session yet
+		gt.NoError(t, agent.FlushHistory(t.Context()))
+		gt.A(t, repo.saves()).Length(0)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, repo.saves()).Length(0)
+
+		gt.NoError(t, agent.FlushHistory(t.Context()))
+		gt.A(t, repo.saves()).Length(1)
+	})
+
+	t.Run("FlushHistory without repository", func(t *testing.T) {
+		agent := gollem.New(&mock.LLMClientMock{})
+		gt.NoError(t, agent.FlushHistory(t.Context()))
+	})
+
+	t.Run("on signal saves the pending history", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("sending signals to the process is not supported on windows")
+		}
+
+		// The test receives SIGTERM, so the signal delivered again does not kill the process
+		sigCh := make(chan os.Signal, 4)
+		signal.Notify(sigCh, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+
+		repo := &syncHistoryRepository{}
+		agent := newFlushTestAgent(repo, nil, func(call int) error {
+			if call != 3 {
+				return nil
+			}
+			p, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				return err
+			}
+			if err := p.Signal(syscall.SIGTERM); err != nil {
+				return err
+			}
+			for range 100 {
+				if len(repo.saves()) > 0 {
+					return nil
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			return errors.New("history is not saved on signal")
+		}, gollem.WithHistoryFlushPolicy(gollem.HistoryFlushOnSignal))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, repo.saves()).Length(1).At(0, func(t testing.TB, v *gollem.History) {
+			// The history of the second round-trip
+			gt.A(t, v.Messages).Length(2)
+		})
+	})
+
+	t.Run("on signal without redelivery", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("sending signals to the process is not supported on windows")
+		}
+
+		sigCh := make(chan os.Signal, 4)
+		signal.Notify(sigCh, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+
+		repo := &syncHistoryRepository{}
+		agent := newFlushTestAgent(repo, nil, func(call int) error {
+			if call != 2 {
+				return nil
+			}
+			p, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				return err
+			}
+			if err := p.Signal(syscall.SIGTERM); err != nil {
+				return err
+			}
+			for range 100 {
+				if len(repo.saves()) > 0 {
+					return nil
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			return errors.New("history is not saved on signal")
+		}, gollem.WithHistoryFlushPolicy(gollem.HistoryFlushOnSignal), gollem.WithHistorySignalRedelivery(false))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, repo.saves()).Length(1)
+
+		// The handler of the application receives the signal only once
+		time.Sleep(100 * time.Millisecond)
+		gt.Equal(t, 1, len(sigCh))
+	})
+}
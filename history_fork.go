@@ -0,0 +1,119 @@
+package gollem
+
+import (
+	"context"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// MetadataCompactionSummary is the key of Message.Metadata marking a message that has the summary
+// of messages removed by compaction, e.g. by middleware/compacter.
+const MetadataCompactionSummary = "compaction_summary"
+
+// IsCompactionSummary returns true if the message has the summary of compacted messages.
+func (m Message) IsCompactionSummary() bool {
+	v, _ := m.Metadata[MetadataCompactionSummary].(bool)
+	return v
+}
+
+// Fork returns a copy of the history with the first at messages, e.g. to regenerate the
+// response to a message or to explore alternatives from the same point. The history itself is
+// not modified. Tool calls whose results are not in the fork are removed with the messages
+// after them, so the fork can be continued by any provider. A compaction summary at the start
+// of the history is always kept, because the messages it stands for are no longer available.
+// It fails with ErrInvalidParameter if at is out of range.
+func (x *History) Fork(at int) (*History, error) {
+	if x == nil {
+		if at != 0 {
+			return nil, goerr.Wrap(ErrInvalidParameter, "fork point is out of range of empty history", goerr.V("at", at))
+		}
+		return &History{Version: HistoryVersion}, nil
+	}
+	if at < 0 || at > len(x.Messages) {
+		return nil, goerr.Wrap(ErrInvalidParameter, "fork point is out of range of history",
+			goerr.V("at", at), goerr.V("messages", len(x.Messages)))
+	}
+
+	at = pairedToolCallsEnd(x.Messages[:at])
+	if at == 0 && len(x.Messages) > 0 && x.Messages[0].IsCompactionSummary() {
+		at = 1
+	}
+
+	fork := &History{
+		LLType:   x.LLType,
+		Version:  x.Version,
+		Messages: make([]Message, at),
+	}
+	for i, msg := range x.Messages[:at] {
+		fork.Messages[i] = cloneMessage(msg)
+	}
+	return fork, nil
+}
+
+// pairedToolCallsEnd returns the length of the longest prefix of messages in which every tool
+// call has its response.
+func pairedToolCallsEnd(messages []Message) int {
+	end := len(messages)
+	for {
+		responded := make(map[string]bool)
+		for _, msg := range messages[:end] {
+			for _, c := range msg.Contents {
+				if c.Type != MessageContentTypeToolResponse {
+					continue
+				}
+				if resp, err := c.GetToolResponseContent(); err == nil {
+					responded[resp.ToolCallID] = true
+				}
+			}
+		}
+
+		unpaired := -1
+		for i, msg := range messages[:end] {
+			if hasUnrespondedToolCall(msg, responded) {
+				unpaired = i
+				break
+			}
+		}
+		if unpaired < 0 {
+			return end
+		}
+		end = unpaired
+	}
+}
+
+func hasUnrespondedToolCall(msg Message, responded map[string]bool) bool {
+	for _, c := range msg.Contents {
+		if c.Type != MessageContentTypeToolCall {
+			continue
+		}
+		if call, err := c.GetToolCallContent(); err == nil && !responded[call.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecuteFrom runs Execute with input on a branch of the conversation starting from history,
+// e.g. a Fork of the history of the session. history is not modified, and the session of the
+// agent is replaced by a new one with the branch, so following Execute calls continue the
+// branch. Tool calls without results at the end of history are removed as by Fork. With
+// WithHistoryRepository, the branch is saved as the history of the session ID of the agent;
+// use an agent of another session ID to keep the original one.
+func (g *Agent) ExecuteFrom(ctx context.Context, history *History, input ...Input) (*ExecuteResponse, error) {
+	branch, err := history.Fork(history.ToCount())
+	if err != nil {
+		return nil, err
+	}
+	return g.Execute(context.WithValue(ctx, branchCtxKey{}, branch), input...)
+}
+
+type branchCtxKey struct{}
+
+// branchFromContext returns the branch set by ExecuteFrom and a context without it.
+func branchFromContext(ctx context.Context) (*History, context.Context) {
+	branch, ok := ctx.Value(branchCtxKey{}).(*History)
+	if !ok || branch == nil {
+		return nil, ctx
+	}
+	return branch, context.WithValue(ctx, branchCtxKey{}, (*History)(nil))
+}
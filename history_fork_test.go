@@ -0,0 +1,128 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestHistoryFork(t *testing.T) {
+	history, err := gollem.NewHistoryBuilder().
+		User("What is the refund policy?").
+		Assistant("Let me check the FAQ.").
+		ToolCall("search_faq", map[string]any{"query": "refund"}, map[string]any{"answer": "Within 30 days"}).
+		Assistant("Refunds are accepted within 30 days.").
+		User("Can I get a refund for order 123?").
+		Build()
+	gt.NoError(t, err)
+
+	testCases := map[string]struct {
+		at   int
+		want int
+	}{
+		"start":               {at: 0, want: 0},
+		"before the response": {at: 4, want: 4},
+		"whole history":       {at: 5, want: 5},
+		"tool call without its result is removed": {at: 2, want: 1},
+		"tool call with its result":               {at: 3, want: 3},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fork, err := history.Fork(tc.at)
+			gt.NoError(t, err)
+			gt.A(t, fork.Messages).Length(tc.want)
+			gt.Equal(t, history.Messages[:tc.want], fork.Messages)
+		})
+	}
+
+	t.Run("original history is not modified", func(t *testing.T) {
+		fork, err := history.Fork(4)
+		gt.NoError(t, err)
+		fork.Messages[0].Contents[0].Data[0] = 'X'
+		fork.Messages = append(fork.Messages, fork.Messages[0])
+
+		gt.A(t, history.Messages).Length(5)
+		text, err := history.Messages[0].Contents[0].GetTextContent()
+		gt.NoError(t, err)
+		gt.Equal(t, "What is the refund policy?", text.Text)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, err := history.Fork(6)
+		gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+		_, err = history.Fork(-1)
+		gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+	})
+
+	t.Run("compaction summary is kept", func(t *testing.T) {
+		summary, err := gollem.NewTextContent("The user asked about refunds.")
+		gt.NoError(t, err)
+		compacted := history.Clone()
+		compacted.Messages = append([]gollem.Message{{
+			Role:     gollem.RoleAssistant,
+			Contents: []gollem.MessageContent{summary},
+			Metadata: map[string]any{gollem.MetadataCompactionSummary: true},
+		}}, compacted.Messages[2:]...)
+
+		fork, err := compacted.Fork(0)
+		gt.NoError(t, err)
+		gt.A(t, fork.Messages).Length(1)
+		gt.True(t, fork.Messages[0].IsCompactionSummary())
+
+		// The result without its call in the compacted history stays as it is
+		fork, err = compacted.Fork(2)
+		gt.NoError(t, err)
+		gt.A(t, fork.Messages).Length(2)
+	})
+}
+
+func TestExecuteFrom(t *testing.T) {
+	var histories []*gollem.History
+	var inputs [][]gollem.Input
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			histories = append(histories, cfg.History())
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					inputs = append(inputs, input)
+					return &gollem.Response{Texts: []string{"answer"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) { return cfg.History(), nil },
+			}, nil
+		},
+	}
+
+	history, err := gollem.NewHistoryBuilder().
+		User("Tell me a joke").
+		Assistant("Why did the gopher cross the road?").
+		Build()
+	gt.NoError(t, err)
+
+	agent := gollem.New(client)
+	_, err = agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+	session := agent.Session()
+
+	// Regenerate the response to the first message
+	fork, err := history.Fork(1)
+	gt.NoError(t, err)
+	_, err = agent.ExecuteFrom(t.Context(), fork, gollem.Text("Another one, please"))
+	gt.NoError(t, err)
+
+	gt.A(t, histories).Length(2)
+	gt.Nil(t, histories[0])
+	gt.Equal(t, fork.Messages, histories[1].Messages)
+	gt.True(t, agent.Session() != session)
+	gt.A(t, history.Messages).Length(2)
+	gt.A(t, fork.Messages).Length(1)
+
+	// Following Execute continues the branch
+	_, err = agent.Execute(t.Context(), gollem.Text("more"))
+	gt.NoError(t, err)
+	gt.A(t, histories).Length(2)
+	gt.A(t, inputs).Length(3)
+}
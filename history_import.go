@@ -0,0 +1,137 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// transcriptPrompt is the prompt for ImportTranscript. %s are additional instructions and the
+// transcript.
+const transcriptPrompt = `Split the following transcript into turns of a conversation between a user and an AI assistant, and attribute each turn to a role.
+
+- "assistant" is the party answering, helping or acting on requests. "user" is the party asking or requesting. If several people talk, all people other than the assistant are "user".
+- Keep the wording of each turn as is. Do not summarize, translate or add anything.
+- "speaker" is the name or label of the speaker as written in the transcript, or empty if there is none.
+- Keep the original order.
+%s
+Transcript:
+"""
+%s
+"""`
+
+// TranscriptOption is an option of ImportTranscript.
+type TranscriptOption func(*transcriptConfig)
+
+type transcriptConfig struct {
+	assistants  []string
+	instruction string
+	maxRetry    int
+}
+
+// WithTranscriptAssistant sets the names of speakers in the transcript that are the assistant,
+// e.g. the support agent of an exported chat.
+func WithTranscriptAssistant(names ...string) TranscriptOption {
+	return func(cfg *transcriptConfig) {
+		cfg.assistants = append(cfg.assistants, names...)
+	}
+}
+
+// WithTranscriptInstruction adds an instruction for role attribution, e.g. about the format of
+// the transcript.
+func WithTranscriptInstruction(instruction string) TranscriptOption {
+	return func(cfg *transcriptConfig) {
+		cfg.instruction = instruction
+	}
+}
+
+// WithTranscriptMaxRetry sets the maximum number of retries when the LLM response is invalid.
+// Default is 3.
+func WithTranscriptMaxRetry(n int) TranscriptOption {
+	return func(cfg *transcriptConfig) {
+		cfg.maxRetry = n
+	}
+}
+
+// transcriptTurn is a turn of a transcript attributed by LLM.
+type transcriptTurn struct {
+	Role    string `json:"role" enum:"user,assistant" required:"true" description:"Role of the turn"`
+	Speaker string `json:"speaker" description:"Name or label of the speaker in the transcript, or empty"`
+	Text    string `json:"text" required:"true" description:"Text of the turn as written in the transcript"`
+}
+
+type transcriptAttribution struct {
+	Turns []transcriptTurn `json:"turns" required:"true" description:"Turns in the original order"`
+}
+
+// ImportTranscript reconstructs a History from a plain-text transcript, e.g. meeting notes or a
+// chat exported without structure, so that a conversation started outside gollem can be resumed
+// with WithHistory. client splits the transcript into turns and attributes each turn to the user
+// or the assistant. Speaker names found in the transcript are kept as a prefix of the text, and
+// consecutive turns of the same role are merged into one message. If the transcript starts with
+// the assistant, a user message noting the import is added first because some providers require
+// it.
+//
+// The whole transcript is sent in one request, so it must fit in the context window of the model.
+func ImportTranscript(ctx context.Context, client LLMClient, transcript string, opts ...TranscriptOption) (*History, error) {
+	cfg := &transcriptConfig{maxRetry: defaultMaxRetry}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if client == nil {
+		return nil, goerr.New("client is required")
+	}
+	if strings.TrimSpace(transcript) == "" {
+		return nil, goerr.New("transcript is empty")
+	}
+
+	var instructions string
+	if len(cfg.assistants) > 0 {
+		instructions += fmt.Sprintf("- These speakers are the assistant: %s\n", strings.Join(cfg.assistants, ", "))
+	}
+	if cfg.instruction != "" {
+		instructions += "- " + cfg.instruction + "\n"
+	}
+
+	resp, err := Query[transcriptAttribution](ctx, client,
+		fmt.Sprintf(transcriptPrompt, instructions, transcript),
+		WithQueryMaxRetry(cfg.maxRetry),
+	)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to attribute roles of transcript")
+	}
+
+	builder := NewHistoryBuilder()
+	var added int
+	for _, turn := range resp.Data.Turns {
+		text := strings.TrimSpace(turn.Text)
+		if text == "" {
+			continue
+		}
+		if speaker := strings.TrimSpace(turn.Speaker); speaker != "" {
+			text = speaker + ": " + text
+		}
+
+		switch MessageRole(turn.Role) {
+		case RoleUser:
+			builder.User(text)
+		case RoleAssistant:
+			if added == 0 {
+				builder.User("(The following conversation was imported from a transcript.)")
+			}
+			builder.Assistant(text)
+		default:
+			return nil, goerr.Wrap(ErrInvalidHistoryData, "unknown role in attributed transcript", goerr.V("role", turn.Role))
+		}
+		added++
+	}
+
+	if added == 0 {
+		return nil, goerr.Wrap(ErrInvalidHistoryData, "no turn found in transcript")
+	}
+
+	return builder.Build()
+}
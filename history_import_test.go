@@ -0,0 +1,88 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestImportTranscript(t *testing.T) {
+	newClient := func(response string, prompt *string) *mock.LLMClientMock {
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						if prompt != nil {
+							*prompt = string(input[0].(gollem.Text))
+						}
+						return &gollem.Response{Texts: []string{response}}, nil
+					},
+				}, nil
+			},
+		}
+	}
+
+	textOf := func(t *testing.T, msg gollem.Message, i int) string {
+		c, err := msg.Contents[i].GetTextContent()
+		gt.NoError(t, err)
+		return c.Text
+	}
+
+	t.Run("attribute roles", func(t *testing.T) {
+		var prompt string
+		client := newClient(`{"turns": [
+			{"role": "user", "speaker": "Alex", "text": "The login page is broken"},
+			{"role": "user", "speaker": "Kim", "text": "Since this morning"},
+			{"role": "assistant", "speaker": "Support", "text": "Which browser do you use?"},
+			{"role": "user", "speaker": "", "text": "Firefox"}
+		]}`, &prompt)
+
+		transcript := "Alex: The login page is broken\nKim: Since this morning\nSupport: Which browser do you use?\nFirefox"
+		history, err := gollem.ImportTranscript(context.Background(), client, transcript,
+			gollem.WithTranscriptAssistant("Support"),
+		)
+		gt.NoError(t, err)
+
+		gt.S(t, prompt).Contains(transcript)
+		gt.S(t, prompt).Contains("These speakers are the assistant: Support")
+
+		gt.A(t, history.Messages).Length(3)
+		gt.Equal(t, gollem.RoleUser, history.Messages[0].Role)
+		gt.Equal(t, "Alex: The login page is broken", textOf(t, history.Messages[0], 0))
+		gt.Equal(t, "Kim: Since this morning", textOf(t, history.Messages[0], 1))
+		gt.Equal(t, gollem.RoleAssistant, history.Messages[1].Role)
+		gt.Equal(t, "Support: Which browser do you use?", textOf(t, history.Messages[1], 0))
+		gt.Equal(t, "Firefox", textOf(t, history.Messages[2], 0))
+	})
+
+	t.Run("transcript starting with assistant", func(t *testing.T) {
+		client := newClient(`{"turns": [
+			{"role": "assistant", "speaker": "", "text": "How can I help you?"},
+			{"role": "user", "speaker": "", "text": "Reset my password"}
+		]}`, nil)
+
+		history, err := gollem.ImportTranscript(context.Background(), client, "How can I help you?\nReset my password")
+		gt.NoError(t, err)
+
+		gt.A(t, history.Messages).Length(3)
+		gt.Equal(t, gollem.RoleUser, history.Messages[0].Role)
+		gt.True(t, strings.Contains(textOf(t, history.Messages[0], 0), "imported"))
+		gt.Equal(t, gollem.RoleAssistant, history.Messages[1].Role)
+	})
+
+	t.Run("no turns", func(t *testing.T) {
+		client := newClient(`{"turns": []}`, nil)
+		_, err := gollem.ImportTranscript(context.Background(), client, "...")
+		gt.True(t, errors.Is(err, gollem.ErrInvalidHistoryData))
+	})
+
+	t.Run("empty transcript", func(t *testing.T) {
+		_, err := gollem.ImportTranscript(context.Background(), newClient(`{}`, nil), " ")
+		gt.Error(t, err)
+	})
+}
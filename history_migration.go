@@ -0,0 +1,154 @@
+package gollem
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/internal/migrate"
+)
+
+// historyMigrator upgrades serialized History of older versions on load. v1 stored messages in
+// provider-specific dialects and cannot be upgraded.
+var historyMigrator = migrate.New("version", HistoryVersion, map[int]migrate.Step{
+	2: migrateHistoryV2,
+})
+
+// historyV2Message is a message of History v2. Contents are decoded by Type.
+type historyV2Message struct {
+	Role     string                 `json:"role"`
+	Contents []historyV2Content     `json:"contents"`
+	Name     string                 `json:"name,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type historyV2Content struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	Meta json.RawMessage `json:"meta,omitempty"`
+}
+
+// historyV2FunctionCall is the legacy function call content of v2. Arguments is a JSON string
+// (OpenAI) or an object (Gemini).
+type historyV2FunctionCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// historyV2FunctionResponse is the legacy function response content of v2. Response is any
+// JSON value.
+type historyV2FunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// migrateHistoryV2 upgrades History v2 to v3. v3 removed the provider roles ("model" of Gemini
+// and "function" of OpenAI) and the legacy "function_call" and "function_response" contents,
+// which become tool calls and tool responses. Calls without ID get an ID like the LLM clients
+// generate for legacy function calls, and responses without ID are paired with the earliest
+// unanswered call of the same name.
+func migrateHistoryV2(doc migrate.Document) error {
+	var messages []historyV2Message
+	if raw, ok := doc["messages"]; ok {
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return goerr.Wrap(err, "failed to decode v2 messages")
+		}
+	}
+
+	// pending holds IDs of unanswered calls by tool name
+	pending := map[string][]string{}
+	generated := map[string]int{}
+
+	for i := range messages {
+		msg := &messages[i]
+		switch msg.Role {
+		case "model":
+			msg.Role = string(RoleAssistant)
+		case "function":
+			msg.Role = string(RoleTool)
+		}
+
+		for j := range msg.Contents {
+			content := &msg.Contents[j]
+			switch content.Type {
+			case "function_call":
+				var call historyV2FunctionCall
+				if err := json.Unmarshal(content.Data, &call); err != nil {
+					return goerr.Wrap(err, "failed to decode v2 function call", goerr.V("message", i))
+				}
+				if call.ID == "" {
+					call.ID = "call_" + call.Name + "_" + strconv.Itoa(generated[call.Name])
+					generated[call.Name]++
+				}
+				pending[call.Name] = append(pending[call.Name], call.ID)
+
+				data, err := json.Marshal(ToolCallContent{
+					ID:        call.ID,
+					Name:      call.Name,
+					Arguments: legacyObject(call.Arguments, "arguments"),
+				})
+				if err != nil {
+					return goerr.Wrap(err, "failed to encode tool call")
+				}
+				content.Type = string(MessageContentTypeToolCall)
+				content.Data = data
+
+			case "function_response":
+				var resp historyV2FunctionResponse
+				if err := json.Unmarshal(content.Data, &resp); err != nil {
+					return goerr.Wrap(err, "failed to decode v2 function response", goerr.V("message", i))
+				}
+				if resp.ID == "" && len(pending[resp.Name]) > 0 {
+					resp.ID = pending[resp.Name][0]
+				}
+				if ids := pending[resp.Name]; len(ids) > 0 && ids[0] == resp.ID {
+					pending[resp.Name] = ids[1:]
+				}
+
+				data, err := json.Marshal(ToolResponseContent{
+					ToolCallID: resp.ID,
+					Name:       resp.Name,
+					Response:   legacyObject(resp.Response, "content"),
+				})
+				if err != nil {
+					return goerr.Wrap(err, "failed to encode tool response")
+				}
+				content.Type = string(MessageContentTypeToolResponse)
+				content.Data = data
+			}
+		}
+	}
+
+	raw, err := json.Marshal(messages)
+	if err != nil {
+		return goerr.Wrap(err, "failed to encode v3 messages")
+	}
+	doc["messages"] = raw
+	return nil
+}
+
+// legacyObject decodes raw into an object. A JSON string of an object is decoded as the object,
+// and any other value is wrapped by key, as the LLM clients do for raw arguments and responses.
+func legacyObject(raw json.RawMessage, key string) map[string]interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return map[string]interface{}{}
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err == nil {
+		return obj
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return map[string]interface{}{key: string(raw)}
+	}
+	if s, ok := value.(string); ok {
+		if err := json.Unmarshal([]byte(s), &obj); err == nil {
+			return obj
+		}
+	}
+	return map[string]interface{}{key: value}
+}
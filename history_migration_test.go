@@ -0,0 +1,80 @@
+package gollem_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func loadHistoryFixture(t *testing.T, name string) ([]byte, *gollem.History, error) {
+	t.Helper()
+	data, err := os.ReadFile("testdata/compat/" + name)
+	gt.NoError(t, err)
+	var history gollem.History
+	err = json.Unmarshal(data, &history)
+	return data, &history, err
+}
+
+func TestHistoryMigrationV2(t *testing.T) {
+	_, history, err := loadHistoryFixture(t, "history_v2.json")
+	gt.NoError(t, err)
+	gt.Equal(t, gollem.HistoryVersion, history.Version)
+	gt.Equal(t, gollem.LLMTypeGemini, history.LLType)
+	gt.A(t, history.Messages).Length(4)
+
+	gt.Equal(t, gollem.RoleAssistant, history.Messages[1].Role)
+	gt.Equal(t, gollem.RoleTool, history.Messages[2].Role)
+	gt.Equal(t, "v2", history.Messages[3].Metadata["source"])
+
+	// Legacy function calls become tool calls with generated IDs
+	call0, err := history.Messages[1].Contents[0].GetToolCallContent()
+	gt.NoError(t, err)
+	call1, err := history.Messages[1].Contents[1].GetToolCallContent()
+	gt.NoError(t, err)
+	gt.Equal(t, "call_get_weather_0", call0.ID)
+	gt.Equal(t, "call_get_weather_1", call1.ID)
+	gt.Equal(t, map[string]any{"city": "Tokyo"}, call0.Arguments)
+	gt.Equal(t, map[string]any{"city": "Osaka"}, call1.Arguments)
+
+	// Legacy function responses are paired with the calls in order
+	resp0, err := history.Messages[2].Contents[0].GetToolResponseContent()
+	gt.NoError(t, err)
+	resp1, err := history.Messages[2].Contents[1].GetToolResponseContent()
+	gt.NoError(t, err)
+	gt.Equal(t, call0.ID, resp0.ToolCallID)
+	gt.Equal(t, call1.ID, resp1.ToolCallID)
+	gt.Equal(t, map[string]any{"weather": "sunny"}, resp0.Response)
+	gt.Equal(t, map[string]any{"content": "rainy"}, resp1.Response)
+
+	// The migrated history is usable as v3, e.g. saved and loaded again
+	data, err := json.Marshal(history)
+	gt.NoError(t, err)
+	var reloaded gollem.History
+	gt.NoError(t, json.Unmarshal(data, &reloaded))
+	gt.Equal(t, history.Messages, reloaded.Messages)
+}
+
+func TestHistoryMigrationV1(t *testing.T) {
+	_, _, err := loadHistoryFixture(t, "history_v1.json")
+	gt.Error(t, err).Is(gollem.ErrHistoryVersionMismatch)
+}
+
+// TestHistoryFormatCompatibility is a gate for changes of the History format: the fixture of
+// the current version must be decoded and encoded as is. If it fails, bump HistoryVersion and
+// add a migration of the previous version.
+func TestHistoryFormatCompatibility(t *testing.T) {
+	data, history, err := loadHistoryFixture(t, "history_v3.json")
+	gt.NoError(t, err)
+	gt.Equal(t, gollem.HistoryVersion, history.Version)
+
+	encoded, err := json.Marshal(history)
+	gt.NoError(t, err)
+
+	var expected, actual any
+	gt.NoError(t, json.Unmarshal(data, &expected))
+	gt.NoError(t, json.Unmarshal(encoded, &actual))
+	gt.Equal(t, expected, actual)
+}
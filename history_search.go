@@ -0,0 +1,349 @@
+package gollem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+const (
+	// HistorySearchToolName is the name of the tool of NewHistorySearchTool.
+	HistorySearchToolName = "search_history"
+
+	// DefaultHistorySearchLimit is the default maximum number of snippets returned by a search.
+	DefaultHistorySearchLimit = 5
+
+	// DefaultHistorySnippetLength is the default maximum length of a snippet in characters.
+	DefaultHistorySnippetLength = 300
+)
+
+// HistoryLister is implemented by a HistoryRepository able to list the session IDs of its
+// histories, e.g. to search past conversations with NewHistorySearchTool.
+type HistoryLister interface {
+	// ListSessions returns the session IDs of the stored histories.
+	ListSessions(ctx context.Context) ([]string, error)
+}
+
+// HistorySearchTool is a Tool searching past conversations stored in a HistoryRepository, so the
+// agent can recall what was discussed in other sessions. It matches user and assistant messages
+// by keywords, or by embedding similarity with WithHistorySearchEmbedding, and returns snippets
+// of the best matches with their session IDs. Histories are loaded at every search, so it suits
+// repositories of a moderate number of conversations.
+type HistorySearchTool struct {
+	repo          HistoryRepository
+	listSessions  func(ctx context.Context) ([]string, error)
+	embedder      LLMClient
+	dimension     int
+	limit         int
+	snippetLength int
+	exclude       []string
+
+	// vectors caches embeddings of message texts by their hash
+	mu      sync.Mutex
+	vectors map[string][]float64
+}
+
+// HistorySearchOption is an option of NewHistorySearchTool.
+type HistorySearchOption func(*HistorySearchTool)
+
+// WithHistorySearchSessions sets the function returning the session IDs to search, e.g. the
+// sessions of the current user. It's required if the repository does not implement
+// HistoryLister, and restricts the search otherwise.
+func WithHistorySearchSessions(list func(ctx context.Context) ([]string, error)) HistorySearchOption {
+	return func(x *HistorySearchTool) {
+		x.listSessions = list
+	}
+}
+
+// WithHistorySearchEmbedding searches by embedding similarity of messages to the query instead
+// of keywords. embedder generates embeddings by GenerateEmbedding of the dimension, 0 for the
+// default of the model. Embeddings of messages are cached in the tool.
+func WithHistorySearchEmbedding(embedder LLMClient, dimension int) HistorySearchOption {
+	return func(x *HistorySearchTool) {
+		x.embedder = embedder
+		x.dimension = dimension
+	}
+}
+
+// WithHistorySearchLimit sets the maximum number of snippets returned by a search. Default is
+// DefaultHistorySearchLimit.
+func WithHistorySearchLimit(n int) HistorySearchOption {
+	return func(x *HistorySearchTool) {
+		x.limit = n
+	}
+}
+
+// WithHistorySearchSnippetLength sets the maximum length of a snippet in characters. Default is
+// DefaultHistorySnippetLength.
+func WithHistorySearchSnippetLength(n int) HistorySearchOption {
+	return func(x *HistorySearchTool) {
+		x.snippetLength = n
+	}
+}
+
+// WithHistorySearchExcludeSessions excludes sessions from the search, e.g. the current session
+// whose messages are already in the context.
+func WithHistorySearchExcludeSessions(sessionIDs ...string) HistorySearchOption {
+	return func(x *HistorySearchTool) {
+		x.exclude = append(x.exclude, sessionIDs...)
+	}
+}
+
+// NewHistorySearchTool creates a HistorySearchTool over repo. The sessions to search are listed
+// by WithHistorySearchSessions, or by repo if it implements HistoryLister.
+func NewHistorySearchTool(repo HistoryRepository, opts ...HistorySearchOption) (*HistorySearchTool, error) {
+	if repo == nil {
+		return nil, goerr.New("history repository is required")
+	}
+	x := &HistorySearchTool{
+		repo:          repo,
+		limit:         DefaultHistorySearchLimit,
+		snippetLength: DefaultHistorySnippetLength,
+		vectors:       make(map[string][]float64),
+	}
+	if lister, ok := repo.(HistoryLister); ok {
+		x.listSessions = lister.ListSessions
+	}
+	for _, opt := range opts {
+		opt(x)
+	}
+
+	if x.listSessions == nil {
+		return nil, goerr.New("repository does not list sessions, set WithHistorySearchSessions")
+	}
+	return x, nil
+}
+
+// Spec implements Tool.
+func (x *HistorySearchTool) Spec() ToolSpec {
+	return ToolSpec{
+		Name: HistorySearchToolName,
+		Description: "Search past conversations with the user and return snippets of matching messages " +
+			"with their session IDs. Use it to recall what was discussed or decided in earlier conversations.",
+		Parameters: map[string]*Parameter{
+			"query": {
+				Type:        TypeString,
+				Description: "Keywords or a topic to search for in past conversations",
+				Required:    true,
+			},
+		},
+		Idempotent: true,
+	}
+}
+
+// historyDocument is a message of a past conversation to search.
+type historyDocument struct {
+	sessionID string
+	index     int
+	role      MessageRole
+	text      string
+}
+
+// Run implements Tool. It returns "results" of snippets in order of relevance.
+func (x *HistorySearchTool) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return nil, goerr.New("query is required")
+	}
+
+	docs, err := x.loadDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		doc     *historyDocument
+		score   float64
+		snippet string
+	}
+	var ranked []scored
+
+	if x.embedder != nil {
+		scores, err := x.embeddingScores(ctx, query, docs)
+		if err != nil {
+			return nil, err
+		}
+		for i, doc := range docs {
+			ranked = append(ranked, scored{doc: doc, score: scores[i], snippet: truncateSnippet(doc.text, 0, x.snippetLength)})
+		}
+	} else {
+		terms := searchTerms(query)
+		for _, doc := range docs {
+			score, pos := keywordScore(doc.text, terms)
+			if score > 0 {
+				ranked = append(ranked, scored{doc: doc, score: score, snippet: truncateSnippet(doc.text, pos, x.snippetLength)})
+			}
+		}
+	}
+
+	slices.SortStableFunc(ranked, func(a, b scored) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+	if len(ranked) > x.limit {
+		ranked = ranked[:x.limit]
+	}
+
+	results := make([]any, len(ranked))
+	for i, r := range ranked {
+		results[i] = map[string]any{
+			"session_id":    r.doc.sessionID,
+			"message_index": r.doc.index,
+			"role":          string(r.doc.role),
+			"snippet":       r.snippet,
+			"score":         r.score,
+		}
+	}
+	return map[string]any{"results": results}, nil
+}
+
+// loadDocuments returns the user and assistant messages with text of the sessions to search.
+func (x *HistorySearchTool) loadDocuments(ctx context.Context) ([]*historyDocument, error) {
+	sessionIDs, err := x.listSessions(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to list sessions of history")
+	}
+
+	var docs []*historyDocument
+	for _, sessionID := range sessionIDs {
+		if slices.Contains(x.exclude, sessionID) {
+			continue
+		}
+		history, err := x.repo.Load(ctx, sessionID)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to load history", goerr.V("session_id", sessionID))
+		}
+		if history == nil {
+			continue
+		}
+
+		for i, msg := range history.Messages {
+			if msg.Role != RoleUser && msg.Role != RoleAssistant {
+				continue
+			}
+			var texts []string
+			for _, content := range msg.Contents {
+				if content.Type != MessageContentTypeText {
+					continue
+				}
+				if text, err := content.GetTextContent(); err == nil && strings.TrimSpace(text.Text) != "" {
+					texts = append(texts, text.Text)
+				}
+			}
+			if len(texts) > 0 {
+				docs = append(docs, &historyDocument{sessionID: sessionID, index: i, role: msg.Role, text: strings.Join(texts, "\n")})
+			}
+		}
+	}
+	return docs, nil
+}
+
+// embeddingScores returns the cosine similarity of each document to query, generating
+// embeddings of documents not cached yet.
+func (x *HistorySearchTool) embeddingScores(ctx context.Context, query string, docs []*historyDocument) ([]float64, error) {
+	keys := make([]string, len(docs))
+	var missing []string
+	missingKeys := make(map[string]bool)
+
+	x.mu.Lock()
+	for i, doc := range docs {
+		sum := sha256.Sum256([]byte(doc.text))
+		keys[i] = hex.EncodeToString(sum[:])
+		if _, ok := x.vectors[keys[i]]; !ok && !missingKeys[keys[i]] {
+			missingKeys[keys[i]] = true
+			missing = append(missing, doc.text)
+		}
+	}
+	x.mu.Unlock()
+
+	vectors, err := x.embedder.GenerateEmbedding(ctx, x.dimension, append([]string{query}, missing...))
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to generate embeddings for history search")
+	}
+	if len(vectors) != len(missing)+1 {
+		return nil, goerr.New("number of embeddings does not match the texts",
+			goerr.V("embeddings", len(vectors)), goerr.V("texts", len(missing)+1))
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i, text := range missing {
+		sum := sha256.Sum256([]byte(text))
+		x.vectors[hex.EncodeToString(sum[:])] = vectors[i+1]
+	}
+
+	scores := make([]float64, len(docs))
+	for i := range docs {
+		scores[i] = CosineSimilarity(vectors[0], x.vectors[keys[i]])
+	}
+	return scores, nil
+}
+
+// searchTerms returns the distinct lowercase words of query.
+func searchTerms(query string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if !slices.Contains(terms, word) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// keywordScore returns the ratio of terms found in text, and the byte position of the first
+// term found, or -1.
+func keywordScore(text string, terms []string) (float64, int) {
+	if len(terms) == 0 {
+		return 0, -1
+	}
+	lower := strings.ToLower(text)
+	found, pos := 0, -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 {
+			found++
+			if pos < 0 || i < pos {
+				pos = i
+			}
+		}
+	}
+	return float64(found) / float64(len(terms)), pos
+}
+
+// truncateSnippet returns at most length characters of text around the byte position pos,
+// marking omitted parts with "...".
+func truncateSnippet(text string, pos, length int) string {
+	runes := []rune(text)
+	if length <= 0 || len(runes) <= length {
+		return text
+	}
+
+	// Start a little before the match for its context
+	start := 0
+	if pos > 0 && pos <= len(text) {
+		start = max(len([]rune(text[:pos]))-length/4, 0)
+	}
+	end := min(start+length, len(runes))
+	start = max(end-length, 0)
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet
+}
@@ -0,0 +1,150 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+// listingHistoryRepository is a mapHistoryRepository implementing HistoryLister.
+type listingHistoryRepository struct {
+	mapHistoryRepository
+}
+
+func (r *listingHistoryRepository) ListSessions(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sessionIDs []string
+	for sessionID := range r.histories {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	return sessionIDs, nil
+}
+
+func newSearchTestRepository(t *testing.T) *listingHistoryRepository {
+	repo := &listingHistoryRepository{}
+	save := func(sessionID string, b *gollem.HistoryBuilder) {
+		history, err := b.Build()
+		gt.NoError(t, err)
+		gt.NoError(t, repo.Save(t.Context(), sessionID, history))
+	}
+
+	save("week1", gollem.NewHistoryBuilder().
+		User("Let's plan the database migration to PostgreSQL").
+		Assistant("We agreed to migrate the billing database first, during the maintenance window on Sunday.").
+		ToolCall("lookup", map[string]any{"query": "database"}, map[string]any{"result": "database found"}))
+	save("week2", gollem.NewHistoryBuilder().
+		User("How should we name the new service?").
+		Assistant("The service will be called Atlas."))
+	save("current", gollem.NewHistoryBuilder().
+		User("What did we decide about the database migration?"))
+	return repo
+}
+
+type historySearchResult struct {
+	SessionID string
+	Role      string
+	Snippet   string
+}
+
+func runHistorySearch(t *testing.T, tool gollem.Tool, query string) []historySearchResult {
+	resp, err := tool.Run(t.Context(), map[string]any{"query": query})
+	gt.NoError(t, err)
+
+	var results []historySearchResult
+	for _, r := range resp["results"].([]any) {
+		m := r.(map[string]any)
+		results = append(results, historySearchResult{
+			SessionID: m["session_id"].(string),
+			Role:      m["role"].(string),
+			Snippet:   m["snippet"].(string),
+		})
+	}
+	return results
+}
+
+func TestHistorySearchTool(t *testing.T) {
+	t.Run("keyword search", func(t *testing.T) {
+		tool, err := gollem.NewHistorySearchTool(newSearchTestRepository(t),
+			gollem.WithHistorySearchExcludeSessions("current"))
+		gt.NoError(t, err)
+		gt.Equal(t, gollem.HistorySearchToolName, tool.Spec().Name)
+
+		results := runHistorySearch(t, tool, "billing database Sunday")
+		// Tool calls and responses are not searched
+		gt.A(t, results).Length(2).At(0, func(t testing.TB, v historySearchResult) {
+			gt.Equal(t, "week1", v.SessionID)
+			gt.Equal(t, "assistant", v.Role)
+			gt.True(t, strings.Contains(v.Snippet, "maintenance window on Sunday"))
+		})
+
+		gt.A(t, runHistorySearch(t, tool, "kubernetes")).Length(0)
+	})
+
+	t.Run("embedding search", func(t *testing.T) {
+		embedder := keywordEmbedder("database", "service", "name")
+		tool, err := gollem.NewHistorySearchTool(newSearchTestRepository(t),
+			gollem.WithHistorySearchEmbedding(embedder, 0),
+			gollem.WithHistorySearchExcludeSessions("current"),
+			gollem.WithHistorySearchLimit(1))
+		gt.NoError(t, err)
+
+		results := runHistorySearch(t, tool, "name of the service")
+		gt.A(t, results).Length(1).At(0, func(t testing.TB, v historySearchResult) {
+			gt.Equal(t, "week2", v.SessionID)
+			gt.Equal(t, "How should we name the new service?", v.Snippet)
+		})
+
+		// Embeddings of messages are cached
+		calls := len(embedder.GenerateEmbeddingCalls())
+		runHistorySearch(t, tool, "database")
+		gt.A(t, embedder.GenerateEmbeddingCalls()).Length(calls+1).At(calls, func(t testing.TB, v struct {
+			Ctx       context.Context
+			Dimension int
+			Input     []string
+		}) {
+			gt.A(t, v.Input).Length(1)
+		})
+	})
+
+	t.Run("snippets are truncated around the match", func(t *testing.T) {
+		repo := &listingHistoryRepository{}
+		history, err := gollem.NewHistoryBuilder().
+			User(strings.Repeat("a ", 100) + "the deadline is Friday " + strings.Repeat("b ", 100)).Build()
+		gt.NoError(t, err)
+		gt.NoError(t, repo.Save(t.Context(), "sess", history))
+
+		tool, err := gollem.NewHistorySearchTool(repo, gollem.WithHistorySearchSnippetLength(40))
+		gt.NoError(t, err)
+		gt.A(t, runHistorySearch(t, tool, "deadline")).Length(1).At(0, func(t testing.TB, v historySearchResult) {
+			gt.True(t, strings.HasPrefix(v.Snippet, "..."))
+			gt.True(t, strings.HasSuffix(v.Snippet, "..."))
+			gt.True(t, strings.Contains(v.Snippet, "the deadline is Friday"))
+		})
+	})
+
+	t.Run("sessions of repository without lister", func(t *testing.T) {
+		repo := &mapHistoryRepository{}
+		_, err := gollem.NewHistorySearchTool(repo)
+		gt.Error(t, err)
+
+		listed := newSearchTestRepository(t)
+		tool, err := gollem.NewHistorySearchTool(&listed.mapHistoryRepository,
+			gollem.WithHistorySearchSessions(func(ctx context.Context) ([]string, error) {
+				return []string{"week2", "unknown"}, nil
+			}))
+		gt.NoError(t, err)
+		gt.A(t, runHistorySearch(t, tool, "database")).Length(0)
+		gt.A(t, runHistorySearch(t, tool, "Atlas")).Length(1)
+	})
+
+	t.Run("query is required", func(t *testing.T) {
+		tool, err := gollem.NewHistorySearchTool(newSearchTestRepository(t))
+		gt.NoError(t, err)
+		_, err = tool.Run(t.Context(), map[string]any{"query": " "})
+		gt.Error(t, err)
+	})
+}
@@ -747,7 +747,7 @@ func TestHistoryUnmarshalVersionValidation(t *testing.T) {
 				gt.True(t, errors.Is(err, gollem.ErrHistoryVersionMismatch))
 			} else {
 				gt.NoError(t, err)
-				gt.Equal(t, tc.version, h.Version)
+				gt.Equal(t, gollem.HistoryVersion, h.Version)
 			}
 		}
 	}
@@ -762,9 +762,10 @@ func TestHistoryUnmarshalVersionValidation(t *testing.T) {
 		expectErr: true,
 	}))
 
+	// v2 is upgraded by migration
 	t.Run("old version 2", runTest(testCase{
 		version:   2,
-		expectErr: true,
+		expectErr: false,
 	}))
 
 	t.Run("future version", runTest(testCase{
@@ -0,0 +1,135 @@
+package gollem
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// TokenCounter returns the number of tokens of text.
+type TokenCounter func(text string) int
+
+const (
+	// imageTokenEstimate and pdfTokenEstimate are rough token counts of an image and a PDF
+	// document, because their actual cost depends on the provider and the resolution or pages.
+	imageTokenEstimate = 1000
+	pdfTokenEstimate   = 3000
+)
+
+// EstimateTokens is a provider-independent TokenCounter. It assumes about 4 ASCII characters
+// per token and 1 token per non-ASCII character, which is close enough to see what occupies the
+// context window but not to enforce exact limits.
+func EstimateTokens(text string) int {
+	var ascii, others int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			others++
+		}
+	}
+	return (ascii+3)/4 + others
+}
+
+// HistoryTokenBreakdown is the estimated token usage of a History, returned by
+// History.TokenBreakdown.
+type HistoryTokenBreakdown struct {
+	Total    int                 `json:"total"`
+	Messages []MessageTokenUsage `json:"messages"`
+	ByRole   map[MessageRole]int `json:"by_role"`
+	// ByTool is the tokens of tool calls and tool responses by tool name
+	ByTool map[string]int `json:"by_tool"`
+}
+
+// MessageTokenUsage is the estimated token usage of a message in a History.
+type MessageTokenUsage struct {
+	Index  int         `json:"index"`
+	Role   MessageRole `json:"role"`
+	Tokens int         `json:"tokens"`
+	// Tools is the names of tools called or responded in the message
+	Tools []string `json:"tools,omitempty"`
+}
+
+// TokenBreakdown estimates tokens per message, per role and per tool, to see what occupies
+// the context window before tuning compaction. counter counts tokens of texts, tool arguments
+// and tool responses (JSON-encoded); if nil, EstimateTokens is used. Images and PDFs are
+// counted as fixed rough estimates.
+func (x *History) TokenBreakdown(counter TokenCounter) *HistoryTokenBreakdown {
+	if counter == nil {
+		counter = EstimateTokens
+	}
+
+	breakdown := &HistoryTokenBreakdown{
+		Messages: []MessageTokenUsage{},
+		ByRole:   map[MessageRole]int{},
+		ByTool:   map[string]int{},
+	}
+	if x == nil {
+		return breakdown
+	}
+
+	// Tool responses of some providers have no name, so resolve it from the call
+	toolNames := map[string]string{}
+
+	for i := range x.Messages {
+		msg := &x.Messages[i]
+		usage := MessageTokenUsage{Index: i, Role: msg.Role}
+
+		for j := range msg.Contents {
+			tokens, tool := contentTokens(&msg.Contents[j], counter, toolNames)
+			usage.Tokens += tokens
+			if tool != "" {
+				breakdown.ByTool[tool] += tokens
+				usage.Tools = append(usage.Tools, tool)
+			}
+		}
+
+		breakdown.Messages = append(breakdown.Messages, usage)
+		breakdown.ByRole[msg.Role] += usage.Tokens
+		breakdown.Total += usage.Tokens
+	}
+
+	return breakdown
+}
+
+// contentTokens returns the tokens of mc and the tool name if mc is a tool call or response.
+func contentTokens(mc *MessageContent, counter TokenCounter, toolNames map[string]string) (int, string) {
+	switch mc.Type {
+	case MessageContentTypeText:
+		if c, err := mc.GetTextContent(); err == nil {
+			return counter(c.Text), ""
+		}
+	case MessageContentTypeThinking:
+		if c, err := mc.GetThinkingContent(); err == nil {
+			return counter(c.Text), ""
+		}
+	case MessageContentTypeToolCall:
+		if c, err := mc.GetToolCallContent(); err == nil {
+			toolNames[c.ID] = c.Name
+			args, _ := json.Marshal(c.Arguments)
+			return counter(c.Name) + counter(string(args)), c.Name
+		}
+	case MessageContentTypeToolResponse:
+		if c, err := mc.GetToolResponseContent(); err == nil {
+			name := c.Name
+			if name == "" {
+				name = toolNames[c.ToolCallID]
+			}
+			resp, _ := json.Marshal(c.Response)
+			return counter(string(resp)), name
+		}
+	case MessageContentTypeImage:
+		return imageTokenEstimate, ""
+	case MessageContentTypePDF:
+		return pdfTokenEstimate, ""
+	case MessageContentTypeFile:
+		if c, err := mc.GetFileContent(); err == nil {
+			if IsTextMimeType(c.MediaType) {
+				return counter(string(c.Data)), ""
+			}
+			return pdfTokenEstimate, ""
+		}
+	}
+
+	// Unknown or broken content is counted by its raw data
+	return counter(string(mc.Data)), ""
+}
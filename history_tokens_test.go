@@ -0,0 +1,63 @@
+package gollem_test
+
+import (
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	gt.Equal(t, 0, gollem.EstimateTokens(""))
+	gt.Equal(t, 1, gollem.EstimateTokens("abc"))
+	gt.Equal(t, 3, gollem.EstimateTokens("hello world"))
+	gt.Equal(t, 2, gollem.EstimateTokens("日本"))
+}
+
+func TestHistoryTokenBreakdown(t *testing.T) {
+	content := func(mc gollem.MessageContent, err error) gollem.MessageContent {
+		gt.NoError(t, err)
+		return mc
+	}
+	history := &gollem.History{
+		Version: gollem.HistoryVersion,
+		Messages: []gollem.Message{
+			{Role: gollem.RoleUser, Contents: []gollem.MessageContent{
+				content(gollem.NewTextContent("search logs")),
+			}},
+			{Role: gollem.RoleAssistant, Contents: []gollem.MessageContent{
+				content(gollem.NewToolCallContent("call_1", "search", map[string]any{"q": "x"})),
+			}},
+			{Role: gollem.RoleTool, Contents: []gollem.MessageContent{
+				// name is resolved from the tool call
+				content(gollem.NewToolResponseContent("call_1", "", map[string]any{"hits": 3}, false)),
+			}},
+			{Role: gollem.RoleUser, Contents: []gollem.MessageContent{
+				content(gollem.NewTextContent("and this")),
+				content(gollem.NewImageContent("image/png", []byte("png"), "", "")),
+			}},
+		},
+	}
+
+	// count bytes to make expectations obvious
+	counter := func(text string) int { return len(text) }
+	breakdown := history.TokenBreakdown(counter)
+
+	// "search logs" = 11, "search" + `{"q":"x"}` = 6 + 9, `{"hits":3}` = 10, "and this" + image = 8 + 1000
+	gt.Equal(t, []gollem.MessageTokenUsage{
+		{Index: 0, Role: gollem.RoleUser, Tokens: 11},
+		{Index: 1, Role: gollem.RoleAssistant, Tokens: 15, Tools: []string{"search"}},
+		{Index: 2, Role: gollem.RoleTool, Tokens: 10, Tools: []string{"search"}},
+		{Index: 3, Role: gollem.RoleUser, Tokens: 1008},
+	}, breakdown.Messages)
+	gt.Equal(t, 1044, breakdown.Total)
+	gt.Equal(t, map[gollem.MessageRole]int{gollem.RoleUser: 1019, gollem.RoleAssistant: 15, gollem.RoleTool: 10}, breakdown.ByRole)
+	gt.Equal(t, map[string]int{"search": 25}, breakdown.ByTool)
+
+	t.Run("nil history", func(t *testing.T) {
+		var h *gollem.History
+		breakdown := h.TokenBreakdown(nil)
+		gt.Equal(t, 0, breakdown.Total)
+		gt.A(t, breakdown.Messages).Length(0)
+	})
+}
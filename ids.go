@@ -0,0 +1,92 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator returns a new unique identifier. It must be safe for concurrent use.
+type IDGenerator func() string
+
+// Clock returns the current time. It must be safe for concurrent use.
+type Clock func() time.Time
+
+type idGeneratorCtxKey struct{}
+type clockCtxKey struct{}
+
+// ContextWithIDGenerator returns a context that makes NewID use gen, e.g. to get deterministic
+// execution, plan and task IDs in golden tests and replays.
+func ContextWithIDGenerator(ctx context.Context, gen IDGenerator) context.Context {
+	return context.WithValue(ctx, idGeneratorCtxKey{}, gen)
+}
+
+// ContextWithClock returns a context that makes Now use clock.
+func ContextWithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockCtxKey{}, clock)
+}
+
+// NewID returns a new identifier from the IDGenerator of ctx, or a random UUID if none is set.
+// Agents, strategies and tools should use it instead of generating IDs directly.
+func NewID(ctx context.Context) string {
+	if gen, ok := ctx.Value(idGeneratorCtxKey{}).(IDGenerator); ok && gen != nil {
+		return gen()
+	}
+	return uuid.New().String()
+}
+
+// Now returns the current time from the Clock of ctx, or time.Now if none is set.
+func Now(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(clockCtxKey{}).(Clock); ok && clock != nil {
+		return clock()
+	}
+	return time.Now()
+}
+
+// NewSequentialIDGenerator returns an IDGenerator that returns prefix followed by a sequence
+// number starting from 1, e.g. "id-1", "id-2".
+func NewSequentialIDGenerator(prefix string) IDGenerator {
+	var seq atomic.Int64
+	return func() string {
+		return fmt.Sprintf("%s%d", prefix, seq.Add(1))
+	}
+}
+
+// NewStepClock returns a Clock that returns start at the first call and advances by step at
+// each call.
+func NewStepClock(start time.Time, step time.Duration) Clock {
+	var mu sync.Mutex
+	next := start
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now := next
+		next = next.Add(step)
+		return now
+	}
+}
+
+// contextWithDeterminism sets the IDGenerator, Clock and Tokenizer of the agent to ctx unless
+// ctx already has them.
+func (c *gollemConfig) contextWithDeterminism(ctx context.Context) context.Context {
+	if c.idGenerator != nil {
+		if _, ok := ctx.Value(idGeneratorCtxKey{}).(IDGenerator); !ok {
+			ctx = ContextWithIDGenerator(ctx, c.idGenerator)
+		}
+	}
+	if c.clock != nil {
+		if _, ok := ctx.Value(clockCtxKey{}).(Clock); !ok {
+			ctx = ContextWithClock(ctx, c.clock)
+		}
+	}
+	if c.tokenizer != nil {
+		if _, ok := ctx.Value(tokenizerCtxKey{}).(Tokenizer); !ok {
+			ctx = ContextWithTokenizer(ctx, c.tokenizer)
+		}
+	}
+	return ctx
+}
@@ -0,0 +1,112 @@
+package gollem_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestNewID(t *testing.T) {
+	t.Run("random UUID by default", func(t *testing.T) {
+		id := gollem.NewID(context.Background())
+		_, err := uuid.Parse(id)
+		gt.NoError(t, err)
+		gt.NotEqual(t, id, gollem.NewID(context.Background()))
+	})
+
+	t.Run("sequential IDs from context", func(t *testing.T) {
+		ctx := gollem.ContextWithIDGenerator(context.Background(), gollem.NewSequentialIDGenerator("id-"))
+		gt.Equal(t, "id-1", gollem.NewID(ctx))
+		gt.Equal(t, "id-2", gollem.NewID(ctx))
+	})
+
+	t.Run("sequential IDs are unique under concurrency", func(t *testing.T) {
+		gen := gollem.NewSequentialIDGenerator("")
+		var mu sync.Mutex
+		seen := map[string]bool{}
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Go(func() {
+				id := gen()
+				mu.Lock()
+				defer mu.Unlock()
+				seen[id] = true
+			})
+		}
+		wg.Wait()
+		gt.Equal(t, 10, len(seen))
+	})
+}
+
+func TestNow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := gollem.ContextWithClock(context.Background(), gollem.NewStepClock(start, time.Second))
+	gt.Equal(t, start, gollem.Now(ctx))
+	gt.Equal(t, start.Add(time.Second), gollem.Now(ctx))
+
+	gt.False(t, gollem.Now(context.Background()).IsZero())
+}
+
+func TestAgentIDGeneratorAndClock(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	var started *gollem.ConversationStartEvent
+	var ended *gollem.ConversationEndEvent
+	agent := gollem.New(client,
+		gollem.WithIDGenerator(gollem.NewSequentialIDGenerator("exec-")),
+		gollem.WithClock(gollem.NewStepClock(start, time.Minute)),
+		gollem.WithConversationStartHook(func(ctx context.Context, event *gollem.ConversationStartEvent) error {
+			started = event
+			return nil
+		}),
+		gollem.WithConversationEndHook(func(ctx context.Context, event *gollem.ConversationEndEvent) {
+			ended = event
+		}),
+	)
+
+	_, err := agent.Execute(context.Background(), gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.Equal(t, "exec-1", started.ExecID)
+	gt.Equal(t, start, started.StartedAt)
+	gt.Equal(t, time.Minute, ended.Duration)
+
+	// ID generator of context takes precedence
+	ctx := gollem.ContextWithIDGenerator(context.Background(), gollem.NewSequentialIDGenerator("ctx-"))
+	_, err = agent.Execute(ctx, gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.Equal(t, "ctx-1", started.ExecID)
+}
+
+func TestHistoryBuilderIDGenerator(t *testing.T) {
+	history, err := gollem.NewHistoryBuilder().
+		IDGenerator(gollem.NewSequentialIDGenerator("call_")).
+		User("What is the weather?").
+		ToolCall("get_weather", map[string]any{"city": "Tokyo"}, map[string]any{"weather": "sunny"}).
+		Build()
+	gt.NoError(t, err)
+
+	call, err := history.Messages[1].Contents[0].GetToolCallContent()
+	gt.NoError(t, err)
+	gt.Equal(t, "call_1", call.ID)
+	resp, err := history.Messages[2].Contents[0].GetToolResponseContent()
+	gt.NoError(t, err)
+	gt.Equal(t, "call_1", resp.ToolCallID)
+}
@@ -0,0 +1,107 @@
+// Package migrate upgrades serialized JSON documents of older format versions to the current
+// version on load, so that persisted data stays readable across releases.
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// ErrUnsupportedVersion is returned when a document has a version that cannot be upgraded to
+// the current version, i.e. a newer version or an older version without a migration path.
+var ErrUnsupportedVersion = errors.New("unsupported document version")
+
+// Document is a JSON object decoded by its top-level fields.
+type Document map[string]json.RawMessage
+
+// Step upgrades a document from a version to the next version in place. It does not need to
+// update the version field.
+type Step func(doc Document) error
+
+// Migrator upgrades documents with a version field to the current version.
+type Migrator struct {
+	field   string
+	current int
+	steps   map[int]Step
+}
+
+// New creates a Migrator of documents whose version is in field. steps[v] upgrades a document
+// of version v to v+1. A document without field is version 0.
+func New(field string, current int, steps map[int]Step) *Migrator {
+	return &Migrator{field: field, current: current, steps: steps}
+}
+
+// Supports reports whether a document of version can be loaded, i.e. it is the current version
+// or there are steps from it to the current version.
+func (m *Migrator) Supports(version int) bool {
+	if version > m.current {
+		return false
+	}
+	for v := version; v < m.current; v++ {
+		if _, ok := m.steps[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Version returns the version of the document in data.
+func (m *Migrator) Version(data []byte) (int, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return 0, goerr.Wrap(err, "failed to decode document")
+	}
+	return m.version(doc)
+}
+
+func (m *Migrator) version(doc Document) (int, error) {
+	raw, ok := doc[m.field]
+	if !ok || string(raw) == "null" {
+		return 0, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 0, goerr.Wrap(err, "failed to decode document version", goerr.V("field", m.field))
+	}
+	return version, nil
+}
+
+// Upgrade returns data upgraded to the current version. data of the current version is
+// returned as is.
+func (m *Migrator) Upgrade(data []byte) ([]byte, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, goerr.Wrap(err, "failed to decode document")
+	}
+	version, err := m.version(doc)
+	if err != nil {
+		return nil, err
+	}
+	if version == m.current {
+		return data, nil
+	}
+	if !m.Supports(version) {
+		return nil, goerr.Wrap(ErrUnsupportedVersion, "no migration path to the current version",
+			goerr.V("version", version), goerr.V("current", m.current))
+	}
+
+	for v := version; v < m.current; v++ {
+		if err := m.steps[v](doc); err != nil {
+			return nil, goerr.Wrap(err, "failed to migrate document", goerr.V("from", v), goerr.V("to", v+1))
+		}
+	}
+
+	raw, err := json.Marshal(m.current)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to encode document version")
+	}
+	doc[m.field] = raw
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to encode migrated document")
+	}
+	return upgraded, nil
+}
@@ -0,0 +1,47 @@
+package migrate_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/m-mizutani/gollem/internal/migrate"
+	"github.com/m-mizutani/gt"
+)
+
+func TestMigrator(t *testing.T) {
+	// v1 renamed "name" to "title", and v2 added "tags"
+	m := migrate.New("version", 3, map[int]migrate.Step{
+		1: func(doc migrate.Document) error {
+			doc["title"] = doc["name"]
+			delete(doc, "name")
+			return nil
+		},
+		2: func(doc migrate.Document) error {
+			doc["tags"] = json.RawMessage(`[]`)
+			return nil
+		},
+	})
+
+	gt.False(t, m.Supports(0))
+	gt.True(t, m.Supports(1))
+	gt.True(t, m.Supports(3))
+	gt.False(t, m.Supports(4))
+
+	data, err := m.Upgrade([]byte(`{"version":1,"name":"report"}`))
+	gt.NoError(t, err)
+	var doc map[string]any
+	gt.NoError(t, json.Unmarshal(data, &doc))
+	gt.Equal(t, map[string]any{"version": 3.0, "title": "report", "tags": []any{}}, doc)
+
+	current := []byte(`{"version":3,"title":"report","tags":["a"]}`)
+	data, err = m.Upgrade(current)
+	gt.NoError(t, err)
+	gt.Equal(t, current, data)
+
+	_, err = m.Upgrade([]byte(`{"title":"no version"}`))
+	gt.Error(t, err).Is(migrate.ErrUnsupportedVersion)
+
+	version, err := m.Version([]byte(`{"version":2}`))
+	gt.NoError(t, err)
+	gt.Equal(t, 2, version)
+}
@@ -2,12 +2,13 @@ package schema
 
 import (
 	"encoding/json"
+	"slices"
 
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 )
 
-// CollectRequiredFields returns a list of required property names
+// CollectRequiredFields returns a list of required property names in ascending order
 func CollectRequiredFields(properties map[string]*gollem.Parameter) []string {
 	var required []string
 	for name, prop := range properties {
@@ -15,6 +16,7 @@ func CollectRequiredFields(properties map[string]*gollem.Parameter) []string {
 			required = append(required, name)
 		}
 	}
+	slices.Sort(required)
 	return required
 }
 
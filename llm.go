@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
 
 	"github.com/m-mizutani/goerr/v2"
 )
@@ -14,6 +19,9 @@ import (
 // LLMClient is a client for each LLM service.
 type LLMClient interface {
 	NewSession(ctx context.Context, options ...SessionOption) (Session, error)
+
+	// GenerateEmbedding returns embeddings of input. Embeddings of the clients of gollem are
+	// unit vectors normalized by NormalizeEmbeddings.
 	GenerateEmbedding(ctx context.Context, dimension int, input []string) ([][]float64, error)
 }
 
@@ -23,20 +31,80 @@ type FunctionCall struct {
 	Arguments map[string]any
 }
 
+// FunctionCallDelta is a fragment of a function call streamed by Session.Stream before the
+// call is complete, e.g. to show "calling search(query=..." while the LLM generates it. The
+// first delta of a call has its ID and Name, and the following deltas have fragments of the
+// arguments in JSON. Concatenating Arguments of the deltas of a call gives its arguments. The
+// complete call is delivered in Response.FunctionCalls with or after its last delta.
+type FunctionCallDelta struct {
+	// Index is the position of the call among the calls of the response, starting from 0.
+	// Deltas of multiple calls may be interleaved.
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// FunctionCallDeltas returns the deltas of the name and the arguments of call at index. It is
+// intended for LLMClient implementations whose provider streams calls at once.
+func FunctionCallDeltas(index int, call *FunctionCall) []*FunctionCallDelta {
+	deltas := []*FunctionCallDelta{{Index: index, ID: call.ID, Name: call.Name}}
+	if args, err := json.Marshal(call.Arguments); err == nil && len(call.Arguments) > 0 {
+		deltas = append(deltas, &FunctionCallDelta{Index: index, Arguments: string(args)})
+	}
+	return deltas
+}
+
 // Response is a general response type for each gollem.
 type Response struct {
 	Texts         []string
 	Thoughts      []string
 	FunctionCalls []*FunctionCall
-	InputToken    int
-	OutputToken   int
+	// FunctionCallDeltas are fragments of function calls in progress. They are set only in
+	// responses of Stream.
+	FunctionCallDeltas []*FunctionCallDelta
+	InputToken         int
+	OutputToken        int
+
+	// Model is the name of the model that generated the response. It may be empty if the
+	// provider does not report it.
+	Model string
+
+	// Logprobs is the log probabilities of the output tokens of Texts. It's set only by
+	// providers configured to report them, e.g. openai.WithLogprobs.
+	Logprobs []float64
 
 	// Error is an error that occurred during the generation for streaming response.
 	Error error
+
+	raw any
+}
+
+// Raw returns the provider-specific response from which r was produced, or nil if the
+// LLMClient does not provide it. It gives access to fields that gollem does not abstract,
+// such as safety ratings or system fingerprints. The concrete type depends on the provider:
+//
+//   - OpenAI: openai.ChatCompletionResponse for Generate, openai.ChatCompletionStreamResponse for Stream
+//   - Claude: *anthropic.Message, or anthropic.MessageStreamEventUnion for Stream of Vertex AI client
+//   - Gemini: *genai.GenerateContentResponse
+//
+// For Stream, it is the chunk from which the response was produced; responses aggregated
+// from multiple chunks, such as streamed tool calls, have the last chunk.
+//
+// This is an unstable API. The types follow the provider SDKs and may change when the SDKs
+// are upgraded.
+func (r *Response) Raw() any {
+	return r.raw
+}
+
+// SetRaw sets the provider-specific response returned by Raw. It is intended for LLMClient
+// implementations.
+func (r *Response) SetRaw(raw any) {
+	r.raw = raw
 }
 
 func (r *Response) HasData() bool {
-	return len(r.Texts) > 0 || len(r.Thoughts) > 0 || len(r.FunctionCalls) > 0 || r.Error != nil
+	return len(r.Texts) > 0 || len(r.Thoughts) > 0 || len(r.FunctionCalls) > 0 || len(r.FunctionCallDeltas) > 0 || r.Error != nil
 }
 
 type Input interface {
@@ -76,6 +144,15 @@ type FunctionResponse struct {
 	Name  string
 	Data  map[string]any
 	Error error
+
+	// Encoding is the representation of Data sent to the LLM, set by WithToolResultEncoding.
+	// Empty means ToolResultEncodingJSON.
+	Encoding ToolResultEncoding
+}
+
+// EncodeData returns Data encoded by Encoding.
+func (f FunctionResponse) EncodeData() (string, error) {
+	return EncodeToolResult(f.Data, f.Encoding)
 }
 
 func (f FunctionResponse) isInput() restrictedValue {
@@ -310,6 +387,69 @@ func NewImageFromReader(r io.Reader, opts ...ImageOption) (Image, error) {
 	return NewImage(data, opts...)
 }
 
+// ImageURL represents an image input referenced by URL. The provider fetches the image, so it's
+// not stored in the history as data. Bedrock does not support it.
+type ImageURL struct {
+	url      string
+	mimeType ImageMimeType
+}
+
+// isInput implements Input interface
+func (i ImageURL) isInput() restrictedValue {
+	return restrictedValue{}
+}
+
+func (i ImageURL) LogValue() slog.Value {
+	return slog.StringValue(i.String())
+}
+
+func (i ImageURL) String() string {
+	if i.mimeType == "" {
+		return fmt.Sprintf("image (%s)", i.url)
+	}
+	return fmt.Sprintf("image (%s, %s)", i.url, i.mimeType)
+}
+
+// URL returns the URL of the image
+func (i ImageURL) URL() string {
+	return i.url
+}
+
+// MimeType returns the MIME type of the image. Returns empty if it's not known.
+func (i ImageURL) MimeType() string {
+	return string(i.mimeType)
+}
+
+// NewImageURL creates a new ImageURL of an http or https URL. The MIME type is detected from the
+// extension of the URL path unless WithMimeType is given; Gemini requires it.
+func NewImageURL(rawURL string, opts ...ImageOption) (ImageURL, error) {
+	cfg := &imageConfig{}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return ImageURL{}, err
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ImageURL{}, goerr.Wrap(err, "failed to parse image URL", goerr.V("url", rawURL))
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ImageURL{}, goerr.New("image URL must be http or https", goerr.V("url", rawURL))
+	}
+
+	if cfg.mimeType == "" {
+		if detected := ImageMimeType(mime.TypeByExtension(strings.ToLower(path.Ext(u.Path)))); IsValidImageMimeType(detected) {
+			cfg.mimeType = detected
+		}
+	}
+
+	return ImageURL{
+		url:      rawURL,
+		mimeType: cfg.mimeType,
+	}, nil
+}
+
 // PDF represents a PDF document input for LLM
 type PDF struct {
 	data []byte
@@ -404,3 +544,136 @@ func NewPDFFromReader(r io.Reader, opts ...PDFOption) (PDF, error) {
 	}
 	return NewPDF(data, opts...)
 }
+
+// File represents a document input for LLM other than images, e.g. a text, CSV, HTML or PDF
+// file. Providers accepting the MIME type natively read it as a document; for the others, the
+// agent extracts text of the file locally by WithFileFallbackExtractor.
+type File struct {
+	data     []byte
+	mimeType string
+	name     string
+}
+
+// isInput implements Input interface
+func (f File) isInput() restrictedValue {
+	return restrictedValue{}
+}
+
+// LogValue returns a slog.Value for the File
+func (f File) LogValue() slog.Value {
+	return slog.StringValue(f.String())
+}
+
+// String returns a string representation of the File
+func (f File) String() string {
+	if f.name == "" {
+		return fmt.Sprintf("file (%d bytes, %s)", len(f.data), f.mimeType)
+	}
+	return fmt.Sprintf("file %s (%d bytes, %s)", f.name, len(f.data), f.mimeType)
+}
+
+// Data returns the file data as bytes
+func (f File) Data() []byte {
+	return f.data
+}
+
+// MimeType returns the MIME type of the file without parameters, e.g. "text/csv"
+func (f File) MimeType() string {
+	return f.mimeType
+}
+
+// Name returns the file name. Returns empty if it's not set.
+func (f File) Name() string {
+	return f.name
+}
+
+// Base64 returns the base64 encoded string of the file data
+func (f File) Base64() string {
+	return base64.StdEncoding.EncodeToString(f.data)
+}
+
+// IsText returns true if the file is a text file by its MIME type.
+func (f File) IsText() bool {
+	return IsTextMimeType(f.mimeType)
+}
+
+// IsTextMimeType returns true if mimeType is of text, e.g. text/* or application/json.
+func IsTextMimeType(mimeType string) bool {
+	switch mimeType {
+	case "application/json", "application/xml", "application/yaml", "application/x-yaml",
+		"application/javascript", "application/x-javascript", "application/x-python", "application/sql":
+		return true
+	}
+	return strings.HasPrefix(mimeType, "text/")
+}
+
+// DefaultMaxFileSize is the default maximum size for File data (32MB)
+const DefaultMaxFileSize = 32 * 1024 * 1024
+
+type fileOption struct {
+	name    string
+	maxSize int
+}
+
+// FileOption is a functional option for File creation
+type FileOption func(*fileOption)
+
+// WithFileName sets the name of the file, e.g. told to the LLM as the title of the document
+func WithFileName(name string) FileOption {
+	return func(o *fileOption) {
+		o.name = name
+	}
+}
+
+// WithMaxFileSize sets the maximum allowed size for File data
+func WithMaxFileSize(size int) FileOption {
+	return func(o *fileOption) {
+		o.maxSize = size
+	}
+}
+
+func buildFileOption(opts []FileOption) fileOption {
+	o := fileOption{maxSize: DefaultMaxFileSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewFile creates a new File from byte data of the MIME type, e.g. "text/csv". Parameters of the
+// MIME type such as charset are removed; text files must be UTF-8. Use NewImage for images.
+func NewFile(data []byte, mimeType string, opts ...FileOption) (File, error) {
+	o := buildFileOption(opts)
+
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return File{}, goerr.Wrap(err, "invalid MIME type of file", goerr.V("mime_type", mimeType))
+	}
+	if strings.HasPrefix(mediaType, "image/") {
+		return File{}, goerr.New("image is not a file, use NewImage", goerr.V("mime_type", mediaType))
+	}
+
+	if len(data) == 0 {
+		return File{}, goerr.New("file data is empty")
+	}
+	if len(data) > o.maxSize {
+		return File{}, goerr.New("file size exceeds maximum limit", goerr.V("size", len(data)), goerr.V("max_size", o.maxSize))
+	}
+	if mediaType == "application/pdf" && !bytes.HasPrefix(data, pdfMagicBytes) {
+		return File{}, goerr.New("invalid PDF format")
+	}
+
+	return File{data: data, mimeType: mediaType, name: o.name}, nil
+}
+
+// NewFileFromReader creates a new File from io.Reader
+func NewFileFromReader(r io.Reader, mimeType string, opts ...FileOption) (File, error) {
+	o := buildFileOption(opts)
+
+	// Use LimitReader to prevent memory exhaustion from untrusted readers
+	data, err := io.ReadAll(io.LimitReader(r, int64(o.maxSize)+1))
+	if err != nil {
+		return File{}, goerr.Wrap(err, "failed to read file data")
+	}
+	return NewFile(data, mimeType, opts...)
+}
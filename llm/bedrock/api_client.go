@@ -0,0 +1,48 @@
+package bedrock
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// apiClient is the interface for Bedrock Runtime API calls (unexported for encapsulation)
+type apiClient interface {
+	Converse(ctx context.Context, params *bedrockruntime.ConverseInput) (*bedrockruntime.ConverseOutput, error)
+	ConverseStream(ctx context.Context, params *bedrockruntime.ConverseStreamInput) (eventStream, error)
+	CountTokens(ctx context.Context, params *bedrockruntime.CountTokensInput) (*bedrockruntime.CountTokensOutput, error)
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput) (*bedrockruntime.InvokeModelOutput, error)
+}
+
+// eventStream is the event stream of ConverseStream.
+type eventStream interface {
+	Events() <-chan types.ConverseStreamOutput
+	Close() error
+	Err() error
+}
+
+// realAPIClient wraps the actual Bedrock Runtime client
+type realAPIClient struct {
+	client *bedrockruntime.Client
+}
+
+func (r *realAPIClient) Converse(ctx context.Context, params *bedrockruntime.ConverseInput) (*bedrockruntime.ConverseOutput, error) {
+	return r.client.Converse(ctx, params)
+}
+
+func (r *realAPIClient) ConverseStream(ctx context.Context, params *bedrockruntime.ConverseStreamInput) (eventStream, error) {
+	out, err := r.client.ConverseStream(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return out.GetStream(), nil
+}
+
+func (r *realAPIClient) CountTokens(ctx context.Context, params *bedrockruntime.CountTokensInput) (*bedrockruntime.CountTokensOutput, error) {
+	return r.client.CountTokens(ctx, params)
+}
+
+func (r *realAPIClient) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput) (*bedrockruntime.InvokeModelOutput, error) {
+	return r.client.InvokeModel(ctx, params)
+}
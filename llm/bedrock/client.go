@@ -0,0 +1,1047 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/internal/schema"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/jsonex"
+)
+
+// generationParameters represents the parameters for text generation.
+type generationParameters struct {
+	// Temperature controls randomness in the output. -1 means not set.
+	Temperature float64
+
+	// TopP controls diversity via nucleus sampling. -1 means not set.
+	TopP float64
+
+	// MaxTokens limits the number of tokens to generate.
+	MaxTokens int32
+}
+
+// Client is a client for Amazon Bedrock. It uses the Converse API, which provides a common
+// interface for models on Bedrock such as Claude, Llama, Mistral and Nova.
+type Client struct {
+	// client is the underlying Bedrock Runtime client.
+	client *bedrockruntime.Client
+
+	// defaultModel is the model ID or inference profile ID to use.
+	defaultModel string
+
+	// embeddingModel is the model ID to generate embeddings.
+	embeddingModel string
+
+	// generation parameters
+	params generationParameters
+
+	// region overrides the region of the AWS config.
+	region string
+
+	// awsConfig is the AWS config to use instead of the default config.
+	awsConfig *aws.Config
+
+	logger *slog.Logger
+
+	// httpMiddlewares wrap the HTTP round trip of API calls.
+	httpMiddlewares []gollem.HTTPMiddleware
+
+	// rateLimiters are waited for before each API call.
+	rateLimiters []gollem.RateLimiter
+}
+
+// Option is a function that configures a Client.
+type Option func(*Client)
+
+// WithModel sets the model ID or the inference profile ID, e.g.
+// "us.anthropic.claude-sonnet-4-5-20250929-v1:0" or "amazon.nova-pro-v1:0".
+// Default: "us.anthropic.claude-sonnet-4-5-20250929-v1:0"
+func WithModel(modelID string) Option {
+	return func(c *Client) {
+		c.defaultModel = modelID
+	}
+}
+
+// WithEmbeddingModel sets the model ID to generate embeddings. Amazon Titan Text Embeddings
+// models are supported.
+// Default: "amazon.titan-embed-text-v2:0"
+func WithEmbeddingModel(modelID string) Option {
+	return func(c *Client) {
+		c.embeddingModel = modelID
+	}
+}
+
+// WithTemperature sets the temperature parameter for text generation.
+// Default: the default of the model
+func WithTemperature(temp float64) Option {
+	return func(c *Client) {
+		c.params.Temperature = temp
+	}
+}
+
+// WithTopP sets the top_p parameter for text generation. Some models such as Claude don't
+// allow both temperature and top_p.
+// Default: the default of the model
+func WithTopP(topP float64) Option {
+	return func(c *Client) {
+		c.params.TopP = topP
+	}
+}
+
+// WithMaxTokens sets the maximum number of tokens to generate.
+// Default: 8192
+func WithMaxTokens(maxTokens int32) Option {
+	return func(c *Client) {
+		c.params.MaxTokens = maxTokens
+	}
+}
+
+// WithRegion sets the AWS region of Bedrock, overriding the region of the AWS config.
+func WithRegion(region string) Option {
+	return func(c *Client) {
+		c.region = region
+	}
+}
+
+// WithAWSConfig sets the AWS config, e.g. to use credentials of an assumed role. By default,
+// the config is loaded by config.LoadDefaultConfig, which resolves credentials from the
+// environment variables, the shared config files, and the IAM role of ECS tasks or EC2
+// instances.
+func WithAWSConfig(cfg aws.Config) Option {
+	return func(c *Client) {
+		c.awsConfig = &cfg
+	}
+}
+
+// WithLogger sets the logger for the client. Repairs of the request messages are logged at
+// debug level. Default is discard logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithHTTPMiddleware adds middlewares around the HTTP round trip of API calls. The requests
+// passed to the middlewares are already signed by SigV4, so the middlewares must not modify
+// signed headers or the body. The middlewares are applied in the order they are provided.
+func WithHTTPMiddleware(middlewares ...gollem.HTTPMiddleware) Option {
+	return func(c *Client) {
+		c.httpMiddlewares = append(c.httpMiddlewares, middlewares...)
+	}
+}
+
+// WithRateLimiter adds rate limiters waited for before each API call of the client's sessions,
+// e.g. *rate.Limiter of golang.org/x/time/rate. A limiter consumes 1 per call for a request
+// limit, or the estimated input tokens if wrapped by gollem.TokenRateLimiter for a token limit.
+// Share the limiters among clients of the same account to respect its limits.
+func WithRateLimiter(limiters ...gollem.RateLimiter) Option {
+	return func(c *Client) {
+		c.rateLimiters = append(c.rateLimiters, limiters...)
+	}
+}
+
+// httpClientFunc adapts a function to the HTTP client interface of the AWS SDK.
+type httpClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// New creates a new client for Amazon Bedrock. It authenticates by IAM credentials of the AWS
+// config instead of API keys.
+func New(ctx context.Context, options ...Option) (*Client, error) {
+	client := &Client{
+		defaultModel:   "us.anthropic.claude-sonnet-4-5-20250929-v1:0",
+		embeddingModel: "amazon.titan-embed-text-v2:0",
+		params: generationParameters{
+			Temperature: -1.0, // -1 indicates not set (0.0 is valid)
+			TopP:        -1.0, // -1 indicates not set (0.0 is valid)
+			MaxTokens:   8192,
+		},
+		logger: slog.New(slog.DiscardHandler),
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	var awsCfg aws.Config
+	if client.awsConfig != nil {
+		awsCfg = client.awsConfig.Copy()
+	} else {
+		var err error
+		awsCfg, err = config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to load AWS config")
+		}
+	}
+	if client.region != "" {
+		awsCfg.Region = client.region
+	}
+	if awsCfg.Region == "" {
+		return nil, goerr.Wrap(gollem.ErrInvalidParameter, "AWS region is required for Bedrock; set it by WithRegion or AWS_REGION")
+	}
+
+	client.client = bedrockruntime.NewFromConfig(awsCfg, func(o *bedrockruntime.Options) {
+		if len(client.httpMiddlewares) > 0 {
+			base := o.HTTPClient
+			o.HTTPClient = httpClientFunc(gollem.BuildHTTPChain(client.httpMiddlewares, base.Do))
+		}
+	})
+
+	return client, nil
+}
+
+// Session is a session for the Bedrock Converse API.
+// It maintains the conversation state and handles message generation.
+type Session struct {
+	// apiClient is the API client interface for dependency injection.
+	apiClient apiClient
+
+	// defaultModel is the model to use.
+	defaultModel string
+
+	// tools are the available tools for the session.
+	tools []types.Tool
+
+	// historyMessages maintains history in Bedrock native format for efficiency
+	historyMessages []types.Message
+
+	// generation parameters
+	params generationParameters
+
+	cfg gollem.SessionConfig
+
+	logger *slog.Logger
+
+	rateLimiters []gollem.RateLimiter
+}
+
+// Model returns the default model of the client.
+func (c *Client) Model() string {
+	return c.defaultModel
+}
+
+// NewSession creates a new session for the Bedrock Converse API.
+func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+	session, err := newSession(&realAPIClient{client: c.client}, c.defaultModel, c.params, c.logger, gollem.NewSessionConfig(options...))
+	if err != nil {
+		return nil, err
+	}
+	session.rateLimiters = c.rateLimiters
+	return session, nil
+}
+
+func newSession(client apiClient, model string, params generationParameters, logger *slog.Logger, cfg gollem.SessionConfig) (*Session, error) {
+	tools := make([]types.Tool, len(cfg.Tools()))
+	for i, tool := range cfg.Tools() {
+		tools[i] = convertTool(tool)
+	}
+
+	var historyMessages []types.Message
+	if cfg.History() != nil {
+		var err error
+		historyMessages, err = ToMessages(cfg.History())
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to convert history to Bedrock format")
+		}
+	}
+
+	return &Session{
+		apiClient:       client,
+		defaultModel:    model,
+		tools:           tools,
+		historyMessages: historyMessages,
+		params:          params,
+		cfg:             cfg,
+		logger:          logger,
+	}, nil
+}
+
+func (s *Session) History() (*gollem.History, error) {
+	return NewHistory(s.historyMessages)
+}
+
+func (s *Session) AppendHistory(h *gollem.History) error {
+	if h == nil {
+		return nil
+	}
+	messages, err := ToMessages(h)
+	if err != nil {
+		return goerr.Wrap(err, "failed to convert history to Bedrock format")
+	}
+	s.historyMessages = append(s.historyMessages, messages...)
+	return nil
+}
+
+// convertInputs converts gollem.Input to a Bedrock user message. All inputs are put in one
+// message with tool results first, because Bedrock requires alternating roles.
+func convertInputs(input ...gollem.Input) ([]types.Message, error) {
+	var toolResults, blocks []types.ContentBlock
+	documents := 0
+
+	for _, in := range input {
+		switch v := in.(type) {
+		case gollem.Text:
+			if v == "" {
+				continue
+			}
+			blocks = append(blocks, &types.ContentBlockMemberText{Value: string(v)})
+
+		case gollem.Image:
+			block, err := newImageBlock(v.MimeType(), v.Data())
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+
+		case gollem.ImageURL:
+			return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "image URL is not supported by Bedrock", goerr.V("url", v.URL()))
+
+		case gollem.PDF:
+			blocks = append(blocks, newDocumentBlock(types.DocumentFormatPdf, v.Data(), documents))
+			documents++
+
+		case gollem.File:
+			block, err := newFileBlock(v.MimeType(), v.Data(), documents)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+			documents++
+
+		case gollem.FunctionResponse:
+			if v.Error != nil {
+				toolResults = append(toolResults, newToolResultBlock(v.ID, v.EncodeError(), true))
+				continue
+			}
+			data, err := v.EncodeData()
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to marshal function response")
+			}
+			toolResults = append(toolResults, newToolResultBlock(v.ID, data, false))
+
+		default:
+			return nil, goerr.Wrap(gollem.ErrInvalidParameter, "invalid input")
+		}
+	}
+
+	content := append(toolResults, blocks...)
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return []types.Message{{Role: types.ConversationRoleUser, Content: content}}, nil
+}
+
+// converseParams is the common parameters of Converse and ConverseStream.
+type converseParams struct {
+	messages        []types.Message
+	system          []types.SystemContentBlock
+	systemPrompt    string
+	inferenceConfig *types.InferenceConfiguration
+	toolConfig      *types.ToolConfiguration
+	contentType     gollem.ContentType
+}
+
+// jsonInstruction returns the instruction to respond in JSON conforming to responseSchema.
+func jsonInstruction(responseSchema *gollem.Parameter) (string, error) {
+	instruction := "Please format your response as valid JSON."
+	if responseSchema != nil {
+		schemaText, err := schema.ConvertParameterToJSONString(responseSchema)
+		if err != nil {
+			return "", goerr.Wrap(err, "failed to convert response schema to JSON string")
+		}
+		if schemaText != "" {
+			instruction += "\n\nYour response must conform to this JSON Schema:\n" + schemaText
+		}
+	}
+	return instruction, nil
+}
+
+// buildParams builds the request parameters from the history, new messages, session config
+// and per-call overrides.
+func (s *Session) buildParams(messages []types.Message, opts ...gollem.GenerateOption) (*converseParams, error) {
+	genCfg := gollem.NewGenerateConfig(append(s.cfg.GenerateOptions(), opts...)...)
+
+	apiMessages := make([]types.Message, 0, len(s.historyMessages)+len(messages))
+	apiMessages = append(apiMessages, s.historyMessages...)
+	apiMessages = append(apiMessages, messages...)
+	merged := mergeConsecutiveMessages(apiMessages)
+	if len(merged) != len(apiMessages) {
+		s.logger.Debug("merged consecutive messages of the same role for Bedrock",
+			"before", len(apiMessages), "after", len(merged))
+	}
+
+	params := &converseParams{
+		messages:    merged,
+		contentType: s.cfg.ContentType(),
+	}
+
+	var prompts []string
+	if s.cfg.SystemPrompt() != "" {
+		prompts = append(prompts, s.cfg.SystemPrompt())
+	}
+	responseSchema := s.cfg.ResponseSchema()
+	if perCall := genCfg.ResponseSchema(); perCall != nil {
+		responseSchema = perCall
+		params.contentType = gollem.ContentTypeJSON
+	}
+	if params.contentType == gollem.ContentTypeJSON {
+		instruction, err := jsonInstruction(responseSchema)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, instruction)
+	}
+
+	if len(s.tools) > 0 {
+		params.toolConfig = &types.ToolConfiguration{Tools: s.tools}
+		if choice := genCfg.ToolChoice(); choice != nil {
+			params.toolConfig.ToolChoice = convertToolChoice(*choice)
+			if choice.Mode == gollem.ToolChoiceModeNone {
+				// Tools can't be removed if the history has tool uses, so instruct it instead
+				prompts = append(prompts, "Do not call any tools in this response.")
+			}
+		}
+	}
+
+	params.systemPrompt = strings.Join(prompts, "\n\n")
+	if params.systemPrompt != "" {
+		params.system = []types.SystemContentBlock{&types.SystemContentBlockMemberText{Value: params.systemPrompt}}
+	}
+
+	inference := &types.InferenceConfiguration{MaxTokens: aws.Int32(s.params.MaxTokens)}
+	if s.params.Temperature >= 0 {
+		inference.Temperature = aws.Float32(float32(s.params.Temperature))
+	}
+	if s.params.TopP >= 0 {
+		inference.TopP = aws.Float32(float32(s.params.TopP))
+	}
+	if t := genCfg.Temperature(); t != nil {
+		inference.Temperature = aws.Float32(float32(*t))
+	}
+	if p := genCfg.TopP(); p != nil {
+		inference.TopP = aws.Float32(float32(*p))
+	}
+	if m := genCfg.MaxTokens(); m != nil {
+		inference.MaxTokens = aws.Int32(int32(*m))
+	}
+	if stop := genCfg.StopSequences(); stop != nil {
+		inference.StopSequences = stop
+	}
+	params.inferenceConfig = inference
+
+	return params, nil
+}
+
+// extractJSON extracts JSON from noisy text such as markdown code blocks
+func extractJSON(text string) string {
+	var jsonResult any
+	if err := jsonex.Unmarshal([]byte(text), &jsonResult); err != nil {
+		return text
+	}
+	jsonBytes, err := json.Marshal(jsonResult)
+	if err != nil {
+		return text
+	}
+	return string(jsonBytes)
+}
+
+// historyCopy returns the current history for middlewares
+func (s *Session) historyCopy() (*gollem.History, error) {
+	if len(s.historyMessages) == 0 {
+		return nil, nil
+	}
+	h, err := NewHistory(s.historyMessages)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to convert history from Bedrock format")
+	}
+	return h, nil
+}
+
+// isFiltered returns true if the response is stopped by guardrails or content filters
+func isFiltered(reason types.StopReason) bool {
+	return reason == types.StopReasonGuardrailIntervened || reason == types.StopReasonContentFiltered
+}
+
+// Generate processes the input and generates a response with optional per-call overrides.
+// It handles both text messages and function responses.
+func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+	historyCopy, err := s.historyCopy()
+	if err != nil {
+		return nil, err
+	}
+
+	contentReq := &gollem.ContentRequest{
+		Inputs:       input,
+		History:      historyCopy,
+		SystemPrompt: s.cfg.SystemPrompt(),
+	}
+
+	baseHandler := func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		// Always update history from middleware (even if same address, content may have changed)
+		if req.History != nil {
+			s.historyMessages, err = ToMessages(req.History)
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to convert history from middleware")
+			}
+		}
+
+		messages, err := convertInputs(req.Inputs...)
+		if err != nil {
+			return nil, err
+		}
+
+		params, err := s.buildParams(messages, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
+		// Start LLM call trace span
+		var traceData *trace.LLMCallData
+		var llmErr error
+		if h := trace.HandlerFrom(ctx); h != nil {
+			ctx = h.StartLLMCall(ctx)
+			defer func() { h.EndLLMCall(ctx, traceData, llmErr) }()
+		}
+
+		resp, err := s.apiClient.Converse(ctx, &bedrockruntime.ConverseInput{
+			ModelId:         aws.String(s.defaultModel),
+			Messages:        params.messages,
+			System:          params.system,
+			InferenceConfig: params.inferenceConfig,
+			ToolConfig:      params.toolConfig,
+		})
+		if err != nil {
+			llmErr = err
+			return nil, goerr.Wrap(err, "failed to converse", apiErrorOptions(err)...)
+		}
+		if isFiltered(resp.StopReason) {
+			llmErr = goerr.Wrap(gollem.ErrProhibitedContent, "response blocked by Bedrock", goerr.V("stop_reason", resp.StopReason))
+			return nil, llmErr
+		}
+
+		var output types.Message
+		if msg, ok := resp.Output.(*types.ConverseOutputMemberMessage); ok {
+			output = msg.Value
+		}
+
+		contentResp := &gollem.ContentResponse{Raw: resp}
+		if resp.Usage != nil {
+			contentResp.InputToken = int(aws.ToInt32(resp.Usage.InputTokens))
+			contentResp.OutputToken = int(aws.ToInt32(resp.Usage.OutputTokens))
+		}
+		if err := appendOutputContent(contentResp, output.Content, params.contentType); err != nil {
+			llmErr = err
+			return nil, err
+		}
+
+		// Record only messages added in this turn; previous turns are already captured in
+		// earlier trace spans.
+		traceData = buildTraceData(s.defaultModel, params.systemPrompt, messages, contentResp)
+
+		s.historyMessages = append(s.historyMessages, messages...)
+		if len(output.Content) > 0 {
+			s.historyMessages = append(s.historyMessages, output)
+		}
+
+		return contentResp, nil
+	}
+
+	// Build middleware chain
+	handler := s.cfg.ContentBlockChain(baseHandler)
+
+	contentResp, err := handler(ctx, contentReq)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &gollem.Response{
+		Texts:         contentResp.Texts,
+		Thoughts:      contentResp.Thoughts,
+		FunctionCalls: contentResp.FunctionCalls,
+		InputToken:    contentResp.InputToken,
+		OutputToken:   contentResp.OutputToken,
+		Model:         s.defaultModel,
+	}
+	response.SetRaw(contentResp.Raw)
+	return response, nil
+}
+
+// appendOutputContent appends texts, reasoning and tool uses of output content blocks to resp
+func appendOutputContent(resp *gollem.ContentResponse, blocks []types.ContentBlock, contentType gollem.ContentType) error {
+	for _, block := range blocks {
+		switch v := block.(type) {
+		case *types.ContentBlockMemberText:
+			text := v.Value
+			// Models may wrap JSON in markdown code blocks even if instructed
+			if contentType == gollem.ContentTypeJSON {
+				text = extractJSON(text)
+			}
+			resp.Texts = append(resp.Texts, text)
+
+		case *types.ContentBlockMemberReasoningContent:
+			if r, ok := v.Value.(*types.ReasoningContentBlockMemberReasoningText); ok && aws.ToString(r.Value.Text) != "" {
+				resp.Thoughts = append(resp.Thoughts, aws.ToString(r.Value.Text))
+			}
+
+		case *types.ContentBlockMemberToolUse:
+			args, err := decodeToolInput(v.Value.Input)
+			if err != nil {
+				return goerr.Wrap(err, "failed to unmarshal function arguments")
+			}
+			resp.FunctionCalls = append(resp.FunctionCalls, &gollem.FunctionCall{
+				ID:        aws.ToString(v.Value.ToolUseId),
+				Name:      aws.ToString(v.Value.Name),
+				Arguments: args,
+			})
+		}
+	}
+	return nil
+}
+
+// Deprecated: GenerateContent is deprecated. Use Generate instead.
+func (s *Session) GenerateContent(ctx context.Context, input ...gollem.Input) (*gollem.Response, error) {
+	return s.Generate(ctx, input)
+}
+
+// Deprecated: GenerateStream is deprecated. Use Stream instead.
+func (s *Session) GenerateStream(ctx context.Context, input ...gollem.Input) (<-chan *gollem.Response, error) {
+	return s.Stream(ctx, input)
+}
+
+// StreamContent generates a response stream iterated by gollem.Stream.
+func (s *Session) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return s.Stream(ctx, input, opts...)
+	})
+}
+
+// streamBlock accumulates a content block of the stream
+type streamBlock struct {
+	text      strings.Builder
+	reasoning strings.Builder
+	signature string
+	redacted  []byte
+
+	toolUseID string
+	toolName  string
+	toolInput strings.Builder
+}
+
+// toolCall returns the function call of a tool use block
+func (b *streamBlock) toolCall() (*gollem.FunctionCall, error) {
+	args := map[string]any{}
+	if b.toolInput.Len() > 0 {
+		if err := json.Unmarshal([]byte(b.toolInput.String()), &args); err != nil {
+			return nil, goerr.Wrap(err, "failed to unmarshal function call arguments",
+				goerr.V("tool", b.toolName), goerr.V("input", b.toolInput.String()))
+		}
+	}
+	return &gollem.FunctionCall{ID: b.toolUseID, Name: b.toolName, Arguments: args}, nil
+}
+
+// contentBlocks converts accumulated blocks to content blocks of the assistant message in the
+// order of the block index.
+func contentBlocks(blocks map[int32]*streamBlock, contentType gollem.ContentType) []types.ContentBlock {
+	indexes := make([]int32, 0, len(blocks))
+	for i := range blocks {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var content []types.ContentBlock
+	for _, i := range indexes {
+		b := blocks[i]
+		switch {
+		case b.toolUseID != "":
+			args := map[string]any{}
+			_ = json.Unmarshal([]byte(b.toolInput.String()), &args)
+			content = append(content, newToolUseBlock(b.toolUseID, b.toolName, args))
+		case len(b.redacted) > 0:
+			content = append(content, &types.ContentBlockMemberReasoningContent{
+				Value: &types.ReasoningContentBlockMemberRedactedContent{Value: b.redacted},
+			})
+		case b.signature != "":
+			content = append(content, &types.ContentBlockMemberReasoningContent{
+				Value: &types.ReasoningContentBlockMemberReasoningText{
+					Value: types.ReasoningTextBlock{Text: aws.String(b.reasoning.String()), Signature: aws.String(b.signature)},
+				},
+			})
+		case b.text.Len() > 0:
+			text := b.text.String()
+			if contentType == gollem.ContentTypeJSON {
+				text = extractJSON(text)
+			}
+			content = append(content, &types.ContentBlockMemberText{Value: text})
+		}
+	}
+	return content
+}
+
+// Stream processes the input and generates a response stream with optional per-call overrides.
+// Texts and reasoning are sent as they arrive, and a function call is sent when its block is
+// complete. Token usage is sent in the last response.
+func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+	historyCopy, err := s.historyCopy()
+	if err != nil {
+		return nil, err
+	}
+
+	contentReq := &gollem.ContentRequest{
+		Inputs:       input,
+		History:      historyCopy,
+		SystemPrompt: s.cfg.SystemPrompt(),
+	}
+
+	baseHandler := func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+		if req.History != nil {
+			s.historyMessages, err = ToMessages(req.History)
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to convert history from middleware")
+			}
+		}
+
+		messages, err := convertInputs(req.Inputs...)
+		if err != nil {
+			return nil, err
+		}
+
+		params, err := s.buildParams(messages, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
+		// The trace span ends when the stream is closed
+		h := trace.HandlerFrom(ctx)
+		if h != nil {
+			ctx = h.StartLLMCall(ctx)
+		}
+
+		stream, err := s.apiClient.ConverseStream(ctx, &bedrockruntime.ConverseStreamInput{
+			ModelId:         aws.String(s.defaultModel),
+			Messages:        params.messages,
+			System:          params.system,
+			InferenceConfig: params.inferenceConfig,
+			ToolConfig:      params.toolConfig,
+		})
+		if err != nil {
+			if h != nil {
+				h.EndLLMCall(ctx, nil, err)
+			}
+			return nil, goerr.Wrap(err, "failed to start converse stream", apiErrorOptions(err)...)
+		}
+
+		responseChan := make(chan *gollem.ContentResponse)
+		go func() {
+			defer close(responseChan)
+			defer func() { _ = stream.Close() }()
+
+			blocks := map[int32]*streamBlock{}
+			block := func(index *int32) *streamBlock {
+				i := aws.ToInt32(index)
+				if blocks[i] == nil {
+					blocks[i] = &streamBlock{}
+				}
+				return blocks[i]
+			}
+
+			summary := &gollem.ContentResponse{}
+			var streamErr error
+			send := func(resp *gollem.ContentResponse) {
+				summary.Texts = append(summary.Texts, resp.Texts...)
+				summary.FunctionCalls = append(summary.FunctionCalls, resp.FunctionCalls...)
+				responseChan <- resp
+			}
+
+		loop:
+			for event := range stream.Events() {
+				switch v := event.(type) {
+				case *types.ConverseStreamOutputMemberContentBlockStart:
+					if start, ok := v.Value.Start.(*types.ContentBlockStartMemberToolUse); ok {
+						b := block(v.Value.ContentBlockIndex)
+						b.toolUseID = aws.ToString(start.Value.ToolUseId)
+						b.toolName = aws.ToString(start.Value.Name)
+					}
+
+				case *types.ConverseStreamOutputMemberContentBlockDelta:
+					b := block(v.Value.ContentBlockIndex)
+					switch d := v.Value.Delta.(type) {
+					case *types.ContentBlockDeltaMemberText:
+						b.text.WriteString(d.Value)
+						if params.contentType != gollem.ContentTypeJSON && d.Value != "" {
+							send(&gollem.ContentResponse{Texts: []string{d.Value}, Raw: event})
+						}
+					case *types.ContentBlockDeltaMemberToolUse:
+						b.toolInput.WriteString(aws.ToString(d.Value.Input))
+					case *types.ContentBlockDeltaMemberReasoningContent:
+						switch r := d.Value.(type) {
+						case *types.ReasoningContentBlockDeltaMemberText:
+							b.reasoning.WriteString(r.Value)
+							send(&gollem.ContentResponse{Thoughts: []string{r.Value}, Raw: event})
+						case *types.ReasoningContentBlockDeltaMemberSignature:
+							b.signature += r.Value
+						case *types.ReasoningContentBlockDeltaMemberRedactedContent:
+							b.redacted = append(b.redacted, r.Value...)
+						}
+					}
+
+				case *types.ConverseStreamOutputMemberContentBlockStop:
+					b := block(v.Value.ContentBlockIndex)
+					switch {
+					case b.toolUseID != "":
+						call, err := b.toolCall()
+						if err != nil {
+							streamErr = err
+							break loop
+						}
+						send(&gollem.ContentResponse{FunctionCalls: []*gollem.FunctionCall{call}, Raw: event})
+					case params.contentType == gollem.ContentTypeJSON && b.text.Len() > 0:
+						// JSON is sent at once after extraction from the whole text
+						send(&gollem.ContentResponse{Texts: []string{extractJSON(b.text.String())}, Raw: event})
+					}
+
+				case *types.ConverseStreamOutputMemberMessageStop:
+					if isFiltered(v.Value.StopReason) {
+						streamErr = goerr.Wrap(gollem.ErrProhibitedContent, "response blocked by Bedrock", goerr.V("stop_reason", v.Value.StopReason))
+					}
+
+				case *types.ConverseStreamOutputMemberMetadata:
+					if v.Value.Usage != nil {
+						summary.InputToken = int(aws.ToInt32(v.Value.Usage.InputTokens))
+						summary.OutputToken = int(aws.ToInt32(v.Value.Usage.OutputTokens))
+						responseChan <- &gollem.ContentResponse{
+							InputToken:  summary.InputToken,
+							OutputToken: summary.OutputToken,
+							Raw:         event,
+						}
+					}
+				}
+			}
+
+			if streamErr == nil {
+				if err := stream.Err(); err != nil {
+					streamErr = goerr.Wrap(err, "failed to receive converse stream", apiErrorOptions(err)...)
+				}
+			}
+			if h != nil {
+				var traceData *trace.LLMCallData
+				if streamErr == nil {
+					traceData = buildTraceData(s.defaultModel, params.systemPrompt, messages, summary)
+				}
+				h.EndLLMCall(ctx, traceData, streamErr)
+			}
+			if streamErr != nil {
+				responseChan <- &gollem.ContentResponse{Error: streamErr}
+				return
+			}
+
+			// Update history after successful streaming
+			s.historyMessages = append(s.historyMessages, messages...)
+			if content := contentBlocks(blocks, params.contentType); len(content) > 0 {
+				s.historyMessages = append(s.historyMessages, types.Message{
+					Role:    types.ConversationRoleAssistant,
+					Content: content,
+				})
+			}
+		}()
+
+		return responseChan, nil
+	}
+
+	// Build middleware chain
+	handler := s.cfg.ContentStreamChain(baseHandler)
+
+	streamChan, err := handler(ctx, contentReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert ContentResponse channel to Response channel
+	responseChan := make(chan *gollem.Response)
+	go func() {
+		defer close(responseChan)
+		for streamResp := range streamChan {
+			if streamResp.Error != nil {
+				responseChan <- &gollem.Response{Error: streamResp.Error}
+				continue
+			}
+			response := &gollem.Response{
+				Texts:              streamResp.Texts,
+				Thoughts:           streamResp.Thoughts,
+				FunctionCalls:      streamResp.FunctionCalls,
+				FunctionCallDeltas: streamResp.FunctionCallDeltas,
+				InputToken:         streamResp.InputToken,
+				OutputToken:        streamResp.OutputToken,
+				Model:              s.defaultModel,
+			}
+			response.SetRaw(streamResp.Raw)
+			responseChan <- response
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// CountToken calculates the total number of tokens for the given inputs, including system
+// prompt, history messages, and new inputs. It uses the CountTokens API of Bedrock, which is
+// available for some models only.
+func (s *Session) CountToken(ctx context.Context, input ...gollem.Input) (int, error) {
+	messages, err := convertInputs(input...)
+	if err != nil {
+		return 0, goerr.Wrap(err, "failed to convert inputs for token counting")
+	}
+
+	params, err := s.buildParams(messages)
+	if err != nil {
+		return 0, err
+	}
+
+	// Start LLM call trace span
+	var traceData *trace.LLMCallData
+	var llmErr error
+	if h := trace.HandlerFrom(ctx); h != nil {
+		ctx = h.StartLLMCall(ctx)
+		defer func() { h.EndLLMCall(ctx, traceData, llmErr) }()
+	}
+
+	result, err := s.apiClient.CountTokens(ctx, &bedrockruntime.CountTokensInput{
+		ModelId: aws.String(s.defaultModel),
+		Input: &types.CountTokensInputMemberConverse{
+			Value: types.ConverseTokensRequest{
+				Messages: params.messages,
+				System:   params.system,
+			},
+		},
+	})
+	if err != nil {
+		llmErr = err
+		return 0, goerr.Wrap(err, "failed to count tokens")
+	}
+
+	tokens := int(aws.ToInt32(result.InputTokens))
+	traceData = &trace.LLMCallData{
+		InputTokens: tokens,
+		Model:       s.defaultModel,
+		Request: &trace.LLMRequest{
+			SystemPrompt: params.systemPrompt,
+		},
+		Response: &trace.LLMResponse{},
+	}
+
+	return tokens, nil
+}
+
+// tokenLimitErrorOptions returns goerr.Option to tag the error with ErrTagTokenExceeded if the
+// error is a validation error for too long input. Returns nil otherwise.
+func tokenLimitErrorOptions(err error) []goerr.Option {
+	var validationErr *types.ValidationException
+	if !errors.As(err, &validationErr) {
+		return nil
+	}
+
+	msg := strings.ToLower(validationErr.ErrorMessage())
+	for _, pattern := range []string{"too long", "too many tokens", "context length", "context window"} {
+		if strings.Contains(msg, pattern) {
+			return []goerr.Option{goerr.Tag(gollem.ErrTagTokenExceeded)}
+		}
+	}
+	return nil
+}
+
+// apiErrorOptions returns goerr.Option to tag an error of the API call by
+// tokenLimitErrorOptions and transientErrorOptions.
+func apiErrorOptions(err error) []goerr.Option {
+	return append(tokenLimitErrorOptions(err), transientErrorOptions(err)...)
+}
+
+// transientErrorOptions returns goerr.Option to tag the error with ErrTagTransient if the
+// HTTP status code of the error is transient, e.g. 429 of ThrottlingException or 503 of
+// ServiceUnavailableException.
+func transientErrorOptions(err error) []goerr.Option {
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) && gollem.IsTransientStatus(respErr.HTTPStatusCode()) {
+		return []goerr.Option{goerr.Tag(gollem.ErrTagTransient)}
+	}
+	return nil
+}
+
+// bedrockMessagesToTraceMessages converts Bedrock messages to trace messages.
+func bedrockMessagesToTraceMessages(messages []types.Message) []trace.Message {
+	var result []trace.Message
+	for _, msg := range messages {
+		var contents []trace.MessageContent
+		for _, block := range msg.Content {
+			switch v := block.(type) {
+			case *types.ContentBlockMemberText:
+				contents = append(contents, trace.NewTextContent(v.Value))
+			case *types.ContentBlockMemberToolUse:
+				args, _ := decodeToolInput(v.Value.Input)
+				contents = append(contents, trace.NewToolCallContent(aws.ToString(v.Value.ToolUseId), aws.ToString(v.Value.Name), args))
+			case *types.ContentBlockMemberToolResult:
+				contents = append(contents, trace.NewToolResponseContent(aws.ToString(v.Value.ToolUseId), "", nil))
+				for _, c := range v.Value.Content {
+					if text, ok := c.(*types.ToolResultContentBlockMemberText); ok {
+						contents = append(contents, trace.NewTextContent(text.Value))
+					}
+				}
+			case *types.ContentBlockMemberImage:
+				contents = append(contents, trace.NewMediaContent("image", "image/"+string(v.Value.Format)))
+			case *types.ContentBlockMemberDocument:
+				mc := trace.NewMediaContent("document", "application/"+string(v.Value.Format))
+				mc.Title = aws.ToString(v.Value.Name)
+				contents = append(contents, mc)
+			}
+		}
+		if len(contents) > 0 {
+			result = append(result, trace.Message{Role: string(msg.Role), Contents: contents})
+		}
+	}
+	return result
+}
+
+// buildTraceData builds trace.LLMCallData from a response.
+func buildTraceData(model, systemPrompt string, messages []types.Message, resp *gollem.ContentResponse) *trace.LLMCallData {
+	data := &trace.LLMCallData{
+		InputTokens:  resp.InputToken,
+		OutputTokens: resp.OutputToken,
+		Model:        model,
+		Request: &trace.LLMRequest{
+			SystemPrompt: systemPrompt,
+			Messages:     bedrockMessagesToTraceMessages(messages),
+		},
+		Response: &trace.LLMResponse{
+			Texts: resp.Texts,
+		},
+	}
+	for _, fc := range resp.FunctionCalls {
+		data.Response.FunctionCalls = append(data.Response.FunctionCalls, &trace.FunctionCall{
+			ID:        fc.ID,
+			Name:      fc.Name,
+			Arguments: fc.Arguments,
+		})
+	}
+	return data
+}
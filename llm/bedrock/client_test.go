@@ -0,0 +1,422 @@
+package bedrock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/bedrock"
+	"github.com/m-mizutani/gt"
+)
+
+type mockAPIClient struct {
+	converse       func(ctx context.Context, params *bedrockruntime.ConverseInput) (*bedrockruntime.ConverseOutput, error)
+	converseStream func(ctx context.Context, params *bedrockruntime.ConverseStreamInput) (bedrock.EventStream, error)
+	countTokens    func(ctx context.Context, params *bedrockruntime.CountTokensInput) (*bedrockruntime.CountTokensOutput, error)
+	invokeModel    func(ctx context.Context, params *bedrockruntime.InvokeModelInput) (*bedrockruntime.InvokeModelOutput, error)
+}
+
+func (m *mockAPIClient) Converse(ctx context.Context, params *bedrockruntime.ConverseInput) (*bedrockruntime.ConverseOutput, error) {
+	return m.converse(ctx, params)
+}
+
+func (m *mockAPIClient) ConverseStream(ctx context.Context, params *bedrockruntime.ConverseStreamInput) (bedrock.EventStream, error) {
+	return m.converseStream(ctx, params)
+}
+
+func (m *mockAPIClient) CountTokens(ctx context.Context, params *bedrockruntime.CountTokensInput) (*bedrockruntime.CountTokensOutput, error) {
+	return m.countTokens(ctx, params)
+}
+
+func (m *mockAPIClient) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput) (*bedrockruntime.InvokeModelOutput, error) {
+	return m.invokeModel(ctx, params)
+}
+
+type mockEventStream struct {
+	events chan types.ConverseStreamOutput
+	err    error
+}
+
+func newMockEventStream(events ...types.ConverseStreamOutput) *mockEventStream {
+	ch := make(chan types.ConverseStreamOutput, len(events))
+	for _, e := range events {
+		ch <- e
+	}
+	close(ch)
+	return &mockEventStream{events: ch}
+}
+
+func (s *mockEventStream) Events() <-chan types.ConverseStreamOutput { return s.events }
+func (s *mockEventStream) Close() error                              { return nil }
+func (s *mockEventStream) Err() error                                { return s.err }
+
+type weatherTool struct{}
+
+func (t *weatherTool) Spec() gollem.ToolSpec {
+	return gollem.ToolSpec{
+		Name:        "get_weather",
+		Description: "Get the weather of a city",
+		Parameters: map[string]*gollem.Parameter{
+			"city": {Type: gollem.TypeString, Description: "City name", Required: true},
+		},
+	}
+}
+
+func (t *weatherTool) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	return map[string]any{"weather": "sunny"}, nil
+}
+
+// documentJSON returns the JSON representation of a smithy document
+func documentJSON(t *testing.T, doc document.Interface) string {
+	t.Helper()
+	raw, err := doc.MarshalSmithyDocument()
+	gt.NoError(t, err)
+	return string(raw)
+}
+
+func TestGenerate(t *testing.T) {
+	var requests []*bedrockruntime.ConverseInput
+	client := &mockAPIClient{
+		converse: func(ctx context.Context, params *bedrockruntime.ConverseInput) (*bedrockruntime.ConverseOutput, error) {
+			requests = append(requests, params)
+			if len(requests) == 1 {
+				return &bedrockruntime.ConverseOutput{
+					Output: &types.ConverseOutputMemberMessage{Value: types.Message{
+						Role: types.ConversationRoleAssistant,
+						Content: []types.ContentBlock{
+							&types.ContentBlockMemberText{Value: "Let me check."},
+							&types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+								ToolUseId: aws.String("tool-1"),
+								Name:      aws.String("get_weather"),
+								Input:     document.NewLazyDocument(map[string]any{"city": "Tokyo"}),
+							}},
+						},
+					}},
+					StopReason: types.StopReasonToolUse,
+					Usage:      &types.TokenUsage{InputTokens: aws.Int32(100), OutputTokens: aws.Int32(20)},
+				}, nil
+			}
+			return &bedrockruntime.ConverseOutput{
+				Output: &types.ConverseOutputMemberMessage{Value: types.Message{
+					Role:    types.ConversationRoleAssistant,
+					Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: "It's sunny."}},
+				}},
+				StopReason: types.StopReasonEndTurn,
+				Usage:      &types.TokenUsage{InputTokens: aws.Int32(150), OutputTokens: aws.Int32(5)},
+			}, nil
+		},
+	}
+
+	cfg := gollem.NewSessionConfig(
+		gollem.WithSessionSystemPrompt("You are a weather bot."),
+		gollem.WithSessionTools(&weatherTool{}),
+	)
+	session, err := bedrock.NewSessionWithAPIClient(client, cfg, "test-model")
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("Weather in Tokyo?")})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"Let me check."}, resp.Texts)
+	gt.A(t, resp.FunctionCalls).Length(1)
+	gt.Equal(t, "tool-1", resp.FunctionCalls[0].ID)
+	gt.Equal(t, "get_weather", resp.FunctionCalls[0].Name)
+	gt.Equal(t, map[string]any{"city": "Tokyo"}, resp.FunctionCalls[0].Arguments)
+	gt.Equal(t, 100, resp.InputToken)
+	gt.Equal(t, 20, resp.OutputToken)
+	gt.Equal(t, "test-model", resp.Model)
+
+	req := requests[0]
+	gt.Equal(t, "test-model", aws.ToString(req.ModelId))
+	gt.Equal(t, "You are a weather bot.", req.System[0].(*types.SystemContentBlockMemberText).Value)
+	gt.A(t, req.ToolConfig.Tools).Length(1)
+	gt.Equal(t, int32(8192), aws.ToInt32(req.InferenceConfig.MaxTokens))
+	gt.Nil(t, req.InferenceConfig.Temperature)
+
+	resp, err = session.Generate(t.Context(), []gollem.Input{
+		gollem.FunctionResponse{ID: "tool-1", Name: "get_weather", Data: map[string]any{"weather": "sunny"}},
+	})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"It's sunny."}, resp.Texts)
+
+	// The tool result follows the assistant message with the tool use
+	messages := requests[1].Messages
+	gt.A(t, messages).Length(3)
+	gt.Equal(t, types.ConversationRoleAssistant, messages[1].Role)
+	result := messages[2].Content[0].(*types.ContentBlockMemberToolResult).Value
+	gt.Equal(t, "tool-1", aws.ToString(result.ToolUseId))
+	gt.Equal(t, types.ToolResultStatusSuccess, result.Status)
+	gt.Equal(t, `{"weather":"sunny"}`, result.Content[0].(*types.ToolResultContentBlockMemberText).Value)
+
+	history, err := session.History()
+	gt.NoError(t, err)
+	gt.Equal(t, gollem.LLMTypeBedrock, history.LLType)
+	gt.A(t, history.Messages).Length(4)
+}
+
+func TestGenerateOptions(t *testing.T) {
+	var req *bedrockruntime.ConverseInput
+	client := &mockAPIClient{
+		converse: func(ctx context.Context, params *bedrockruntime.ConverseInput) (*bedrockruntime.ConverseOutput, error) {
+			req = params
+			return &bedrockruntime.ConverseOutput{
+				Output: &types.ConverseOutputMemberMessage{Value: types.Message{
+					Role:    types.ConversationRoleAssistant,
+					Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: "```json\n{\"answer\": 42}\n```"}},
+				}},
+				StopReason: types.StopReasonEndTurn,
+			}, nil
+		},
+	}
+	session, err := bedrock.NewSessionWithAPIClient(client, gollem.NewSessionConfig(gollem.WithSessionTools(&weatherTool{})), "test-model")
+	gt.NoError(t, err)
+
+	t.Run("per-call parameters and response schema", func(t *testing.T) {
+		resp, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("answer")},
+			gollem.WithTemperature(0.2),
+			gollem.WithMaxTokens(100),
+			gollem.WithToolChoice(gollem.ToolChoiceRequired()),
+			gollem.WithGenerateResponseSchema(&gollem.Parameter{
+				Type:       gollem.TypeObject,
+				Properties: map[string]*gollem.Parameter{"answer": {Type: gollem.TypeInteger}},
+			}),
+		)
+		gt.NoError(t, err)
+		gt.Equal(t, []string{`{"answer":42}`}, resp.Texts)
+
+		gt.Equal(t, float32(0.2), aws.ToFloat32(req.InferenceConfig.Temperature))
+		gt.Equal(t, int32(100), aws.ToInt32(req.InferenceConfig.MaxTokens))
+		gt.True(t, req.ToolConfig.ToolChoice != nil)
+		_, ok := req.ToolConfig.ToolChoice.(*types.ToolChoiceMemberAny)
+		gt.True(t, ok)
+		gt.S(t, req.System[0].(*types.SystemContentBlockMemberText).Value).Contains("JSON Schema")
+	})
+
+	t.Run("tool choice none is instructed", func(t *testing.T) {
+		_, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("answer")},
+			gollem.WithToolChoice(gollem.ToolChoiceNone()))
+		gt.NoError(t, err)
+		gt.Nil(t, req.ToolConfig.ToolChoice)
+		gt.S(t, req.System[0].(*types.SystemContentBlockMemberText).Value).Contains("Do not call any tools")
+	})
+
+	t.Run("session defaults are overridden per call", func(t *testing.T) {
+		session, err := bedrock.NewSessionWithAPIClient(client, gollem.NewSessionConfig(
+			gollem.WithSessionTemperature(0.7),
+			gollem.WithSessionMaxTokens(200),
+			gollem.WithSessionStopSequences("END"),
+		), "test-model")
+		gt.NoError(t, err)
+
+		_, err = session.Generate(t.Context(), []gollem.Input{gollem.Text("answer")})
+		gt.NoError(t, err)
+		gt.Equal(t, float32(0.7), aws.ToFloat32(req.InferenceConfig.Temperature))
+		gt.Equal(t, int32(200), aws.ToInt32(req.InferenceConfig.MaxTokens))
+		gt.Equal(t, []string{"END"}, req.InferenceConfig.StopSequences)
+
+		_, err = session.Generate(t.Context(), []gollem.Input{gollem.Text("answer")},
+			gollem.WithTemperature(0.1), gollem.WithStopSequences("STOP", "DONE"))
+		gt.NoError(t, err)
+		gt.Equal(t, float32(0.1), aws.ToFloat32(req.InferenceConfig.Temperature))
+		gt.Equal(t, int32(200), aws.ToInt32(req.InferenceConfig.MaxTokens))
+		gt.Equal(t, []string{"STOP", "DONE"}, req.InferenceConfig.StopSequences)
+	})
+}
+
+func TestGenerateBlocked(t *testing.T) {
+	client := &mockAPIClient{
+		converse: func(ctx context.Context, params *bedrockruntime.ConverseInput) (*bedrockruntime.ConverseOutput, error) {
+			return &bedrockruntime.ConverseOutput{
+				Output:     &types.ConverseOutputMemberMessage{Value: types.Message{Role: types.ConversationRoleAssistant}},
+				StopReason: types.StopReasonGuardrailIntervened,
+			}, nil
+		},
+	}
+	session, err := bedrock.NewSessionWithAPIClient(client, gollem.NewSessionConfig(), "test-model")
+	gt.NoError(t, err)
+
+	_, err = session.Generate(t.Context(), []gollem.Input{gollem.Text("hello")})
+	gt.Error(t, err).Is(gollem.ErrProhibitedContent)
+}
+
+func TestStream(t *testing.T) {
+	var req *bedrockruntime.ConverseStreamInput
+	client := &mockAPIClient{
+		converseStream: func(ctx context.Context, params *bedrockruntime.ConverseStreamInput) (bedrock.EventStream, error) {
+			req = params
+			return newMockEventStream(
+				&types.ConverseStreamOutputMemberMessageStart{Value: types.MessageStartEvent{Role: types.ConversationRoleAssistant}},
+				&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+					ContentBlockIndex: aws.Int32(0),
+					Delta:             &types.ContentBlockDeltaMemberText{Value: "Let me "},
+				}},
+				&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+					ContentBlockIndex: aws.Int32(0),
+					Delta:             &types.ContentBlockDeltaMemberText{Value: "check."},
+				}},
+				&types.ConverseStreamOutputMemberContentBlockStop{Value: types.ContentBlockStopEvent{ContentBlockIndex: aws.Int32(0)}},
+				&types.ConverseStreamOutputMemberContentBlockStart{Value: types.ContentBlockStartEvent{
+					ContentBlockIndex: aws.Int32(1),
+					Start: &types.ContentBlockStartMemberToolUse{Value: types.ToolUseBlockStart{
+						ToolUseId: aws.String("tool-1"),
+						Name:      aws.String("get_weather"),
+					}},
+				}},
+				&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+					ContentBlockIndex: aws.Int32(1),
+					Delta:             &types.ContentBlockDeltaMemberToolUse{Value: types.ToolUseBlockDelta{Input: aws.String(`{"city":`)}},
+				}},
+				&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+					ContentBlockIndex: aws.Int32(1),
+					Delta:             &types.ContentBlockDeltaMemberToolUse{Value: types.ToolUseBlockDelta{Input: aws.String(`"Tokyo"}`)}},
+				}},
+				&types.ConverseStreamOutputMemberContentBlockStop{Value: types.ContentBlockStopEvent{ContentBlockIndex: aws.Int32(1)}},
+				&types.ConverseStreamOutputMemberMessageStop{Value: types.MessageStopEvent{StopReason: types.StopReasonToolUse}},
+				&types.ConverseStreamOutputMemberMetadata{Value: types.ConverseStreamMetadataEvent{
+					Usage: &types.TokenUsage{InputTokens: aws.Int32(100), OutputTokens: aws.Int32(20)},
+				}},
+			), nil
+		},
+	}
+
+	session, err := bedrock.NewSessionWithAPIClient(client, gollem.NewSessionConfig(
+		gollem.WithSessionSystemPrompt("You are a weather bot."),
+		gollem.WithSessionTools(&weatherTool{}),
+	), "test-model")
+	gt.NoError(t, err)
+
+	ch, err := session.Stream(t.Context(), []gollem.Input{gollem.Text("Weather in Tokyo?")})
+	gt.NoError(t, err)
+
+	var texts []string
+	var calls []*gollem.FunctionCall
+	var inputTokens, outputTokens int
+	for resp := range ch {
+		gt.NoError(t, resp.Error)
+		texts = append(texts, resp.Texts...)
+		calls = append(calls, resp.FunctionCalls...)
+		inputTokens += resp.InputToken
+		outputTokens += resp.OutputToken
+	}
+
+	gt.Equal(t, []string{"Let me ", "check."}, texts)
+	gt.A(t, calls).Length(1)
+	gt.Equal(t, map[string]any{"city": "Tokyo"}, calls[0].Arguments)
+	gt.Equal(t, 100, inputTokens)
+	gt.Equal(t, 20, outputTokens)
+	gt.Equal(t, "You are a weather bot.", req.System[0].(*types.SystemContentBlockMemberText).Value)
+
+	history, err := session.History()
+	gt.NoError(t, err)
+	gt.A(t, history.Messages).Length(2)
+	assistant := history.Messages[1]
+	gt.Equal(t, gollem.RoleAssistant, assistant.Role)
+	gt.A(t, assistant.Contents).Length(2)
+	toolCall, err := assistant.Contents[1].GetToolCallContent()
+	gt.NoError(t, err)
+	gt.Equal(t, "tool-1", toolCall.ID)
+	gt.Equal(t, map[string]any{"city": "Tokyo"}, toolCall.Arguments)
+}
+
+func TestStreamError(t *testing.T) {
+	streamErr := errors.New("connection reset")
+	client := &mockAPIClient{
+		converseStream: func(ctx context.Context, params *bedrockruntime.ConverseStreamInput) (bedrock.EventStream, error) {
+			stream := newMockEventStream(&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+				ContentBlockIndex: aws.Int32(0),
+				Delta:             &types.ContentBlockDeltaMemberText{Value: "partial"},
+			}})
+			stream.err = streamErr
+			return stream, nil
+		},
+	}
+	session, err := bedrock.NewSessionWithAPIClient(client, gollem.NewSessionConfig(), "test-model")
+	gt.NoError(t, err)
+
+	ch, err := session.Stream(t.Context(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+
+	var lastErr error
+	for resp := range ch {
+		if resp.Error != nil {
+			lastErr = resp.Error
+		}
+	}
+	gt.Error(t, lastErr).Is(streamErr)
+
+	// Failed turn is not recorded in history
+	history, err := session.History()
+	gt.NoError(t, err)
+	gt.A(t, history.Messages).Length(0)
+}
+
+func TestConvertInputs(t *testing.T) {
+	messages, err := bedrock.ConvertInputs(
+		gollem.Text("see the result"),
+		gollem.FunctionResponse{ID: "tool-1", Error: errors.New("not found")},
+		gollem.FunctionResponse{ID: "tool-2", Data: map[string]any{"ok": true}},
+	)
+	gt.NoError(t, err)
+	gt.A(t, messages).Length(1)
+
+	content := messages[0].Content
+	gt.A(t, content).Length(3)
+	// Tool results come before other contents
+	failed := content[0].(*types.ContentBlockMemberToolResult).Value
+	gt.Equal(t, types.ToolResultStatusError, failed.Status)
+	gt.Equal(t, `{"error":{"category":"fatal","message":"not found","retryable":false}}`, failed.Content[0].(*types.ToolResultContentBlockMemberText).Value)
+	gt.Equal(t, "tool-2", aws.ToString(content[1].(*types.ContentBlockMemberToolResult).Value.ToolUseId))
+	gt.Equal(t, "see the result", content[2].(*types.ContentBlockMemberText).Value)
+
+	t.Run("unsupported image type", func(t *testing.T) {
+		_, err := bedrock.ConvertInputs(gollem.Image{})
+		gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+	})
+
+	t.Run("image URL", func(t *testing.T) {
+		img, err := gollem.NewImageURL("https://example.com/a.png")
+		gt.NoError(t, err)
+		_, err = bedrock.ConvertInputs(img)
+		gt.Error(t, err).Is(gollem.ErrUnsupportedInput)
+	})
+}
+
+func TestConvertTool(t *testing.T) {
+	spec := bedrock.ConvertTool(&weatherTool{}).(*types.ToolMemberToolSpec).Value
+	gt.Equal(t, "get_weather", aws.ToString(spec.Name))
+
+	schema := documentJSON(t, spec.InputSchema.(*types.ToolInputSchemaMemberJson).Value)
+	gt.Equal(t, `{"properties":{"city":{"description":"City name","type":"string"}},"required":["city"],"type":"object"}`, schema)
+}
+
+func TestTokenLimitErrorOptions(t *testing.T) {
+	err := goerr.Wrap(&types.ValidationException{Message: aws.String("Input is too long for requested model.")}, "failed")
+	opts := bedrock.TokenLimitErrorOptions(err)
+	gt.A(t, opts).Length(1)
+	gt.True(t, goerr.HasTag(goerr.Wrap(err, "x", opts...), gollem.ErrTagTokenExceeded))
+
+	gt.A(t, bedrock.TokenLimitErrorOptions(&types.ValidationException{Message: aws.String("invalid model")})).Length(0)
+	gt.A(t, bedrock.TokenLimitErrorOptions(errors.New("too long"))).Length(0)
+}
+
+func TestGenerateEmbedding(t *testing.T) {
+	var bodies []string
+	client := &mockAPIClient{
+		invokeModel: func(ctx context.Context, params *bedrockruntime.InvokeModelInput) (*bedrockruntime.InvokeModelOutput, error) {
+			gt.Equal(t, "amazon.titan-embed-text-v2:0", aws.ToString(params.ModelId))
+			bodies = append(bodies, string(params.Body))
+			return &bedrockruntime.InvokeModelOutput{Body: []byte(`{"embedding":[3,4],"inputTextTokenCount":2}`)}, nil
+		},
+	}
+
+	embeddings, err := bedrock.GenerateEmbedding(t.Context(), client, "amazon.titan-embed-text-v2:0", 256, []string{"a", "b"})
+	gt.NoError(t, err)
+	// Embeddings are normalized to unit vectors
+	gt.Equal(t, [][]float64{{0.6, 0.8}, {0.6, 0.8}}, embeddings)
+	gt.Equal(t, []string{`{"inputText":"a","dimensions":256}`, `{"inputText":"b","dimensions":256}`}, bodies)
+}
@@ -0,0 +1,475 @@
+package bedrock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/internal/convert"
+)
+
+// bedrockPartMeta is the metadata stored in MessageContent.Meta for Bedrock content blocks.
+// It preserves reasoning signatures and redacted reasoning across serialization.
+type bedrockPartMeta struct {
+	Signature string `json:"signature,omitempty"` // Signature for reasoning blocks
+	Redacted  string `json:"redacted,omitempty"`  // Base64 encoded redacted reasoning content
+}
+
+// marshalBedrockPartMeta marshals bedrockPartMeta to JSON for MessageContent.Meta.
+// Returns nil if no metadata needs to be stored.
+func marshalBedrockPartMeta(m bedrockPartMeta) (json.RawMessage, error) {
+	if m.Signature == "" && m.Redacted == "" {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal bedrock part meta")
+	}
+	return data, nil
+}
+
+// unmarshalBedrockPartMeta unmarshals bedrockPartMeta from MessageContent.Meta.
+func unmarshalBedrockPartMeta(meta json.RawMessage) (bedrockPartMeta, error) {
+	if len(meta) == 0 {
+		return bedrockPartMeta{}, nil
+	}
+	var m bedrockPartMeta
+	if err := json.Unmarshal(meta, &m); err != nil {
+		return bedrockPartMeta{}, goerr.Wrap(err, "failed to unmarshal bedrock part meta")
+	}
+	return m, nil
+}
+
+// imageFormats maps MIME types of images to Bedrock image formats
+var imageFormats = map[string]types.ImageFormat{
+	"image/png":  types.ImageFormatPng,
+	"image/jpeg": types.ImageFormatJpeg,
+	"image/gif":  types.ImageFormatGif,
+	"image/webp": types.ImageFormatWebp,
+}
+
+// newImageBlock creates an image content block from raw image data
+func newImageBlock(mimeType string, data []byte) (types.ContentBlock, error) {
+	format, ok := imageFormats[mimeType]
+	if !ok {
+		return nil, goerr.Wrap(gollem.ErrInvalidParameter, "unsupported image type for Bedrock", goerr.V("mime_type", mimeType))
+	}
+	return &types.ContentBlockMemberImage{
+		Value: types.ImageBlock{
+			Format: format,
+			Source: &types.ImageSourceMemberBytes{Value: data},
+		},
+	}, nil
+}
+
+// documentFormats maps MIME types of files to Bedrock document formats
+var documentFormats = map[string]types.DocumentFormat{
+	"application/pdf":    types.DocumentFormatPdf,
+	"text/csv":           types.DocumentFormatCsv,
+	"text/html":          types.DocumentFormatHtml,
+	"text/markdown":      types.DocumentFormatMd,
+	"text/plain":         types.DocumentFormatTxt,
+	"application/msword": types.DocumentFormatDoc,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": types.DocumentFormatDocx,
+	"application/vnd.ms-excel": types.DocumentFormatXls,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": types.DocumentFormatXlsx,
+}
+
+// newFileBlock creates a document block of a file. Text files of other MIME types are sent as
+// plain text.
+func newFileBlock(mimeType string, data []byte, n int) (types.ContentBlock, error) {
+	format, ok := documentFormats[mimeType]
+	if !ok {
+		if !gollem.IsTextMimeType(mimeType) {
+			return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "file type is not supported by Bedrock", goerr.V("mime_type", mimeType))
+		}
+		format = types.DocumentFormatTxt
+	}
+	return newDocumentBlock(format, data, n), nil
+}
+
+// newDocumentBlock creates a document block. Bedrock requires a name for each document that is
+// unique in a message, so n is the position of the document in the message.
+func newDocumentBlock(format types.DocumentFormat, data []byte, n int) types.ContentBlock {
+	return &types.ContentBlockMemberDocument{
+		Value: types.DocumentBlock{
+			Format: format,
+			Name:   aws.String(fmt.Sprintf("document-%d", n+1)),
+			Source: &types.DocumentSourceMemberBytes{Value: data},
+		},
+	}
+}
+
+// newToolUseBlock creates a tool use block. Arguments must be an object even if empty.
+func newToolUseBlock(id, name string, args map[string]any) types.ContentBlock {
+	if args == nil {
+		args = map[string]any{}
+	}
+	return &types.ContentBlockMemberToolUse{
+		Value: types.ToolUseBlock{
+			ToolUseId: aws.String(id),
+			Name:      aws.String(name),
+			Input:     document.NewLazyDocument(args),
+		},
+	}
+}
+
+// newToolResultBlock creates a tool result block with a text content
+func newToolResultBlock(id, text string, isError bool) types.ContentBlock {
+	status := types.ToolResultStatusSuccess
+	if isError {
+		status = types.ToolResultStatusError
+	}
+	return &types.ContentBlockMemberToolResult{
+		Value: types.ToolResultBlock{
+			ToolUseId: aws.String(id),
+			Content:   []types.ToolResultContentBlock{&types.ToolResultContentBlockMemberText{Value: text}},
+			Status:    status,
+		},
+	}
+}
+
+// decodeToolInput decodes the input of a tool use block to arguments
+func decodeToolInput(input document.Interface) (map[string]any, error) {
+	args := map[string]any{}
+	if input == nil {
+		return args, nil
+	}
+	// Round trip through JSON, because documents created by NewLazyDocument can't be
+	// unmarshaled directly into maps
+	raw, err := input.MarshalSmithyDocument()
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to encode tool input")
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, goerr.Wrap(err, "failed to decode tool input", goerr.V("input", string(raw)))
+	}
+	return args, nil
+}
+
+// convertBedrockToMessages converts Bedrock messages to common Message format
+func convertBedrockToMessages(messages []types.Message) ([]gollem.Message, error) {
+	result := make([]gollem.Message, 0, len(messages))
+
+	for _, msg := range messages {
+		contents := make([]gollem.MessageContent, 0, len(msg.Content))
+		for _, block := range msg.Content {
+			content, err := convertBedrockContentBlock(block)
+			if err != nil {
+				if errors.Is(err, convert.ErrUnsupportedContentType) {
+					continue
+				}
+				return nil, goerr.Wrap(err, "failed to convert Bedrock content block")
+			}
+			contents = append(contents, content)
+		}
+
+		if len(contents) == 0 {
+			continue
+		}
+
+		result = append(result, gollem.Message{
+			Role:     convert.ConvertRoleToCommon(string(msg.Role)),
+			Contents: contents,
+		})
+	}
+
+	return result, nil
+}
+
+// convertBedrockContentBlock converts a single Bedrock content block to MessageContent
+func convertBedrockContentBlock(block types.ContentBlock) (gollem.MessageContent, error) {
+	switch v := block.(type) {
+	case *types.ContentBlockMemberText:
+		if v.Value == "" {
+			return gollem.MessageContent{}, convert.ErrUnsupportedContentType
+		}
+		return gollem.NewTextContent(v.Value)
+
+	case *types.ContentBlockMemberReasoningContent:
+		var text string
+		var meta bedrockPartMeta
+		switch r := v.Value.(type) {
+		case *types.ReasoningContentBlockMemberReasoningText:
+			text = aws.ToString(r.Value.Text)
+			meta.Signature = aws.ToString(r.Value.Signature)
+		case *types.ReasoningContentBlockMemberRedactedContent:
+			meta.Redacted = base64.StdEncoding.EncodeToString(r.Value)
+		default:
+			return gollem.MessageContent{}, convert.ErrUnsupportedContentType
+		}
+		mc, err := gollem.NewThinkingContent(text)
+		if err != nil {
+			return gollem.MessageContent{}, err
+		}
+		if mc.Meta, err = marshalBedrockPartMeta(meta); err != nil {
+			return gollem.MessageContent{}, err
+		}
+		return mc, nil
+
+	case *types.ContentBlockMemberImage:
+		src, ok := v.Value.Source.(*types.ImageSourceMemberBytes)
+		if !ok {
+			return gollem.MessageContent{}, convert.ErrUnsupportedContentType
+		}
+		return gollem.NewImageContent("image/"+string(v.Value.Format), src.Value, "", "")
+
+	case *types.ContentBlockMemberDocument:
+		src, ok := v.Value.Source.(*types.DocumentSourceMemberBytes)
+		if !ok {
+			return gollem.MessageContent{}, convert.ErrUnsupportedContentType
+		}
+		if v.Value.Format == types.DocumentFormatPdf {
+			return gollem.NewPDFContent(src.Value, "")
+		}
+		for mimeType, format := range documentFormats {
+			if format == v.Value.Format {
+				return gollem.NewFileContent(mimeType, "", src.Value)
+			}
+		}
+		return gollem.MessageContent{}, convert.ErrUnsupportedContentType
+
+	case *types.ContentBlockMemberToolUse:
+		args, err := decodeToolInput(v.Value.Input)
+		if err != nil {
+			return gollem.MessageContent{}, err
+		}
+		return gollem.NewToolCallContent(aws.ToString(v.Value.ToolUseId), aws.ToString(v.Value.Name), args)
+
+	case *types.ContentBlockMemberToolResult:
+		var response map[string]any
+		for _, c := range v.Value.Content {
+			switch c := c.(type) {
+			case *types.ToolResultContentBlockMemberText:
+				// Try to parse the text as JSON to preserve structure
+				if err := json.Unmarshal([]byte(c.Value), &response); err != nil {
+					response = map[string]any{"content": c.Value}
+				}
+			case *types.ToolResultContentBlockMemberJson:
+				decoded, err := decodeToolInput(c.Value)
+				if err != nil {
+					return gollem.MessageContent{}, goerr.Wrap(err, "failed to decode tool result")
+				}
+				response = decoded
+			}
+			if response != nil {
+				break
+			}
+		}
+		return gollem.NewToolResponseContent(
+			aws.ToString(v.Value.ToolUseId),
+			"", // Bedrock doesn't include tool name in result
+			response,
+			v.Value.Status == types.ToolResultStatusError,
+		)
+	}
+
+	return gollem.MessageContent{}, goerr.Wrap(convert.ErrUnsupportedContentType, "unknown Bedrock content block type", goerr.V("type", fmt.Sprintf("%T", block)))
+}
+
+// convertMessagesToBedrock converts common Messages to Bedrock format
+func convertMessagesToBedrock(messages []gollem.Message) ([]types.Message, error) {
+	// Bedrock takes system prompts separately, so merge system messages into the first user message
+	messages = convert.MergeSystemIntoFirstUser(messages)
+
+	result := make([]types.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == gollem.RoleSystem || len(msg.Contents) == 0 {
+			continue
+		}
+
+		role := types.ConversationRoleUser
+		if msg.Role == gollem.RoleAssistant {
+			role = types.ConversationRoleAssistant
+		}
+
+		content := make([]types.ContentBlock, 0, len(msg.Contents))
+		documents := 0
+		for _, c := range msg.Contents {
+			block, err := convertContentToBedrock(c, documents)
+			if err != nil {
+				if errors.Is(err, convert.ErrUnsupportedContentType) {
+					continue
+				}
+				return nil, goerr.Wrap(err, "failed to convert content to Bedrock format")
+			}
+			if _, ok := block.(*types.ContentBlockMemberDocument); ok {
+				documents++
+			}
+			content = append(content, block)
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		result = append(result, types.Message{Role: role, Content: content})
+	}
+
+	return result, nil
+}
+
+// convertContentToBedrock converts MessageContent to a Bedrock content block. documents is the
+// number of documents converted before in the same message.
+func convertContentToBedrock(content gollem.MessageContent, documents int) (types.ContentBlock, error) {
+	switch content.Type {
+	case gollem.MessageContentTypeText:
+		text, err := content.GetTextContent()
+		if err != nil {
+			return nil, err
+		}
+		if text.Text == "" {
+			return nil, convert.ErrUnsupportedContentType
+		}
+		return &types.ContentBlockMemberText{Value: text.Text}, nil
+
+	case gollem.MessageContentTypeThinking:
+		thinking, err := content.GetThinkingContent()
+		if err != nil {
+			return nil, err
+		}
+		meta, err := unmarshalBedrockPartMeta(content.Meta)
+		if err != nil {
+			return nil, err
+		}
+		if meta.Redacted != "" {
+			data, err := base64.StdEncoding.DecodeString(meta.Redacted)
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to decode redacted reasoning content")
+			}
+			return &types.ContentBlockMemberReasoningContent{
+				Value: &types.ReasoningContentBlockMemberRedactedContent{Value: data},
+			}, nil
+		}
+		// Reasoning without signature can't be sent back to the model
+		if meta.Signature == "" {
+			return nil, convert.ErrUnsupportedContentType
+		}
+		return &types.ContentBlockMemberReasoningContent{
+			Value: &types.ReasoningContentBlockMemberReasoningText{
+				Value: types.ReasoningTextBlock{
+					Text:      aws.String(thinking.Text),
+					Signature: aws.String(meta.Signature),
+				},
+			},
+		}, nil
+
+	case gollem.MessageContentTypeImage:
+		img, err := content.GetImageContent()
+		if err != nil {
+			return nil, err
+		}
+		if len(img.Data) > 0 {
+			return newImageBlock(img.MediaType, img.Data)
+		}
+		// Bedrock can't fetch images by URL, so keep the reference as text
+		if img.URL != "" {
+			return &types.ContentBlockMemberText{Value: fmt.Sprintf("[Image: %s]", img.URL)}, nil
+		}
+		return nil, convert.ErrUnsupportedContentType
+
+	case gollem.MessageContentTypePDF:
+		pdf, err := content.GetPDFContent()
+		if err != nil {
+			return nil, err
+		}
+		if len(pdf.Data) > 0 {
+			return newDocumentBlock(types.DocumentFormatPdf, pdf.Data, documents), nil
+		}
+		if pdf.URL != "" {
+			return &types.ContentBlockMemberText{Value: fmt.Sprintf("[PDF: %s]", pdf.URL)}, nil
+		}
+		return nil, convert.ErrUnsupportedContentType
+
+	case gollem.MessageContentTypeFile:
+		file, err := content.GetFileContent()
+		if err != nil {
+			return nil, err
+		}
+		return newFileBlock(file.MediaType, file.Data, documents)
+
+	case gollem.MessageContentTypeToolCall:
+		toolCall, err := content.GetToolCallContent()
+		if err != nil {
+			return nil, err
+		}
+		return newToolUseBlock(toolCall.ID, toolCall.Name, toolCall.Arguments), nil
+
+	case gollem.MessageContentTypeToolResponse:
+		toolResp, err := content.GetToolResponseContent()
+		if err != nil {
+			return nil, err
+		}
+		text, ok := toolResp.Response["content"].(string)
+		if !ok || len(toolResp.Response) != 1 {
+			data, err := json.Marshal(toolResp.Response)
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to marshal tool response")
+			}
+			text = string(data)
+		}
+		return newToolResultBlock(toolResp.ToolCallID, text, toolResp.IsError), nil
+
+	default:
+		return nil, goerr.Wrap(convert.ErrUnsupportedContentType, "unsupported content type for Bedrock", goerr.V("type", content.Type))
+	}
+}
+
+// mergeConsecutiveMessages merges consecutive messages of the same role, because Bedrock
+// requires that user and assistant messages alternate. Tool results are moved to the beginning
+// of merged user messages as models expect them right after the tool use.
+func mergeConsecutiveMessages(messages []types.Message) []types.Message {
+	result := make([]types.Message, 0, len(messages))
+	for _, msg := range messages {
+		if n := len(result); n > 0 && result[n-1].Role == msg.Role {
+			prev := result[n-1].Content
+			merged := make([]types.ContentBlock, 0, len(prev)+len(msg.Content))
+			merged = append(merged, filterToolResults(prev, true)...)
+			merged = append(merged, filterToolResults(msg.Content, true)...)
+			merged = append(merged, filterToolResults(prev, false)...)
+			merged = append(merged, filterToolResults(msg.Content, false)...)
+			result[n-1] = types.Message{Role: msg.Role, Content: merged}
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// filterToolResults returns tool result blocks if toolResults is true, or other blocks
+func filterToolResults(blocks []types.ContentBlock, toolResults bool) []types.ContentBlock {
+	var result []types.ContentBlock
+	for _, block := range blocks {
+		if _, ok := block.(*types.ContentBlockMemberToolResult); ok == toolResults {
+			result = append(result, block)
+		}
+	}
+	return result
+}
+
+// ToMessages converts gollem.History to Bedrock messages
+func ToMessages(h *gollem.History) ([]types.Message, error) {
+	if h == nil || len(h.Messages) == 0 {
+		return []types.Message{}, nil
+	}
+	return convertMessagesToBedrock(h.Messages)
+}
+
+// NewHistory creates gollem.History from Bedrock messages
+func NewHistory(messages []types.Message) (*gollem.History, error) {
+	commonMessages, err := convertBedrockToMessages(messages)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to convert Bedrock messages to common format")
+	}
+
+	return &gollem.History{
+		LLType:   gollem.LLMTypeBedrock,
+		Version:  gollem.HistoryVersion,
+		Messages: commonMessages,
+	}, nil
+}
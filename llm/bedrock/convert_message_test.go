@@ -0,0 +1,139 @@
+package bedrock_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/bedrock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	pdf := []byte("%PDF-1.4")
+	png := []byte{0x89, 'P', 'N', 'G'}
+	messages := []types.Message{
+		{
+			Role: types.ConversationRoleUser,
+			Content: []types.ContentBlock{
+				&types.ContentBlockMemberText{Value: "Summarize these"},
+				&types.ContentBlockMemberImage{Value: types.ImageBlock{
+					Format: types.ImageFormatPng,
+					Source: &types.ImageSourceMemberBytes{Value: png},
+				}},
+				&types.ContentBlockMemberDocument{Value: types.DocumentBlock{
+					Format: types.DocumentFormatPdf,
+					Name:   aws.String("document-1"),
+					Source: &types.DocumentSourceMemberBytes{Value: pdf},
+				}},
+			},
+		},
+		{
+			Role: types.ConversationRoleAssistant,
+			Content: []types.ContentBlock{
+				&types.ContentBlockMemberReasoningContent{Value: &types.ReasoningContentBlockMemberReasoningText{
+					Value: types.ReasoningTextBlock{Text: aws.String("I should search."), Signature: aws.String("sig-1")},
+				}},
+				&types.ContentBlockMemberReasoningContent{Value: &types.ReasoningContentBlockMemberRedactedContent{
+					Value: []byte("redacted"),
+				}},
+				&types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+					ToolUseId: aws.String("tool-1"),
+					Name:      aws.String("search"),
+				}},
+			},
+		},
+		{
+			Role: types.ConversationRoleUser,
+			Content: []types.ContentBlock{
+				&types.ContentBlockMemberToolResult{Value: types.ToolResultBlock{
+					ToolUseId: aws.String("tool-1"),
+					Content:   []types.ToolResultContentBlock{&types.ToolResultContentBlockMemberText{Value: `{"hits":3}`}},
+					Status:    types.ToolResultStatusSuccess,
+				}},
+			},
+		},
+	}
+
+	history, err := bedrock.NewHistory(messages)
+	gt.NoError(t, err)
+	gt.Equal(t, gollem.LLMTypeBedrock, history.LLType)
+	gt.A(t, history.Messages).Length(3)
+
+	// The history survives serialization
+	raw, err := json.Marshal(history)
+	gt.NoError(t, err)
+	var restored gollem.History
+	gt.NoError(t, json.Unmarshal(raw, &restored))
+
+	converted, err := bedrock.ToMessages(&restored)
+	gt.NoError(t, err)
+	gt.A(t, converted).Length(3)
+
+	user := converted[0].Content
+	gt.Equal(t, "Summarize these", user[0].(*types.ContentBlockMemberText).Value)
+	gt.Equal(t, png, user[1].(*types.ContentBlockMemberImage).Value.Source.(*types.ImageSourceMemberBytes).Value)
+	gt.Equal(t, types.ImageFormatPng, user[1].(*types.ContentBlockMemberImage).Value.Format)
+	gt.Equal(t, pdf, user[2].(*types.ContentBlockMemberDocument).Value.Source.(*types.DocumentSourceMemberBytes).Value)
+
+	assistant := converted[1].Content
+	gt.A(t, assistant).Length(3)
+	reasoning := assistant[0].(*types.ContentBlockMemberReasoningContent).Value.(*types.ReasoningContentBlockMemberReasoningText).Value
+	gt.Equal(t, "I should search.", aws.ToString(reasoning.Text))
+	gt.Equal(t, "sig-1", aws.ToString(reasoning.Signature))
+	redacted := assistant[1].(*types.ContentBlockMemberReasoningContent).Value.(*types.ReasoningContentBlockMemberRedactedContent).Value
+	gt.Equal(t, []byte("redacted"), redacted)
+	toolUse := assistant[2].(*types.ContentBlockMemberToolUse).Value
+	gt.Equal(t, "search", aws.ToString(toolUse.Name))
+	gt.Equal(t, "{}", documentJSON(t, toolUse.Input))
+
+	result := converted[2].Content[0].(*types.ContentBlockMemberToolResult).Value
+	gt.Equal(t, "tool-1", aws.ToString(result.ToolUseId))
+	gt.Equal(t, `{"hits":3}`, result.Content[0].(*types.ToolResultContentBlockMemberText).Value)
+}
+
+func TestToMessagesFromOtherProvider(t *testing.T) {
+	textContent := func(s string) gollem.MessageContent {
+		c, err := gollem.NewTextContent(s)
+		gt.NoError(t, err)
+		return c
+	}
+	history := &gollem.History{
+		LLType:  gollem.LLMTypeOpenAI,
+		Version: gollem.HistoryVersion,
+		Messages: []gollem.Message{
+			{Role: gollem.RoleSystem, Contents: []gollem.MessageContent{textContent("Be concise.")}},
+			{Role: gollem.RoleUser, Contents: []gollem.MessageContent{textContent("What's 1+1?")}},
+			{Role: gollem.RoleAssistant, Contents: []gollem.MessageContent{textContent("2")}},
+		},
+	}
+
+	messages, err := bedrock.ToMessages(history)
+	gt.NoError(t, err)
+	gt.A(t, messages).Length(2)
+	// The system message is merged into the first user message
+	gt.Equal(t, types.ConversationRoleUser, messages[0].Role)
+	gt.Equal(t, "Be concise.\n\n", messages[0].Content[0].(*types.ContentBlockMemberText).Value)
+	gt.Equal(t, types.ConversationRoleAssistant, messages[1].Role)
+}
+
+func TestMergeConsecutiveMessages(t *testing.T) {
+	text := func(s string) types.ContentBlock { return &types.ContentBlockMemberText{Value: s} }
+	toolResult := func(id string) types.ContentBlock {
+		return &types.ContentBlockMemberToolResult{Value: types.ToolResultBlock{ToolUseId: aws.String(id)}}
+	}
+
+	merged := bedrock.MergeConsecutiveMessages([]types.Message{
+		{Role: types.ConversationRoleAssistant, Content: []types.ContentBlock{text("calling")}},
+		{Role: types.ConversationRoleUser, Content: []types.ContentBlock{text("also")}},
+		{Role: types.ConversationRoleUser, Content: []types.ContentBlock{toolResult("tool-1")}},
+		{Role: types.ConversationRoleAssistant, Content: []types.ContentBlock{text("done")}},
+	})
+	gt.A(t, merged).Length(3)
+	gt.A(t, merged[1].Content).Length(2)
+	// Tool results are moved to the beginning
+	gt.Equal(t, "tool-1", aws.ToString(merged[1].Content[0].(*types.ContentBlockMemberToolResult).Value.ToolUseId))
+	gt.Equal(t, "also", merged[1].Content[1].(*types.ContentBlockMemberText).Value)
+}
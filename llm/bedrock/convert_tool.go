@@ -0,0 +1,56 @@
+package bedrock
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/m-mizutani/gollem"
+	gollemschema "github.com/m-mizutani/gollem/internal/schema"
+)
+
+// convertTool converts gollem.Tool to a Bedrock tool specification
+func convertTool(tool gollem.Tool) types.Tool {
+	spec := tool.Spec()
+
+	return &types.ToolMemberToolSpec{
+		Value: types.ToolSpecification{
+			Name:        aws.String(spec.Name),
+			Description: aws.String(spec.Description),
+			InputSchema: &types.ToolInputSchemaMemberJson{
+				Value: document.NewLazyDocument(convertParametersToJSONSchema(spec.Parameters)),
+			},
+		},
+	}
+}
+
+// convertParametersToJSONSchema converts tool parameters to the JSON Schema of an object
+func convertParametersToJSONSchema(params map[string]*gollem.Parameter) map[string]any {
+	properties := make(map[string]any, len(params))
+	for name, param := range params {
+		properties[name] = gollemschema.ConvertParameterToJSONSchema(param)
+	}
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if required := gollemschema.CollectRequiredFields(params); len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// convertToolChoice converts gollem.ToolChoice to Bedrock tool choice. Bedrock has no choice to
+// forbid tool calls, so it returns nil for ToolChoiceModeNone and the caller must handle it.
+func convertToolChoice(choice gollem.ToolChoice) types.ToolChoice {
+	switch choice.Mode {
+	case gollem.ToolChoiceModeRequired:
+		return &types.ToolChoiceMemberAny{Value: types.AnyToolChoice{}}
+	case gollem.ToolChoiceModeTool:
+		return &types.ToolChoiceMemberTool{Value: types.SpecificToolChoice{Name: aws.String(choice.Name)}}
+	case gollem.ToolChoiceModeNone:
+		return nil
+	default:
+		return &types.ToolChoiceMemberAuto{Value: types.AutoToolChoice{}}
+	}
+}
@@ -0,0 +1,57 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// titanEmbeddingRequest is the request body of Amazon Titan Text Embeddings models
+type titanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+// titanEmbeddingResponse is the response body of Amazon Titan Text Embeddings models
+type titanEmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+// GenerateEmbedding generates embeddings for the given input texts with the embedding model.
+// Titan models embed one text per request, so the texts are embedded one by one. dimension is
+// not sent to the model if it is 0. Embeddings are normalized to unit vectors by
+// gollem.NormalizeEmbeddings.
+func (c *Client) GenerateEmbedding(ctx context.Context, dimension int, input []string) ([][]float64, error) {
+	return generateEmbedding(ctx, &realAPIClient{client: c.client}, c.embeddingModel, dimension, input)
+}
+
+func generateEmbedding(ctx context.Context, client apiClient, model string, dimension int, input []string) ([][]float64, error) {
+	embeddings := make([][]float64, 0, len(input))
+	for _, text := range input {
+		body, err := json.Marshal(titanEmbeddingRequest{InputText: text, Dimensions: dimension})
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to marshal embedding request")
+		}
+
+		out, err := client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(model),
+			Body:        body,
+			ContentType: aws.String("application/json"),
+			Accept:      aws.String("application/json"),
+		})
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to generate embedding", goerr.V("model", model))
+		}
+
+		var resp titanEmbeddingResponse
+		if err := json.Unmarshal(out.Body, &resp); err != nil {
+			return nil, goerr.Wrap(err, "failed to unmarshal embedding response", goerr.V("model", model))
+		}
+		embeddings = append(embeddings, resp.Embedding)
+	}
+	return gollem.NormalizeEmbeddings(embeddings), nil
+}
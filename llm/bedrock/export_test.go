@@ -0,0 +1,31 @@
+package bedrock
+
+import (
+	"log/slog"
+
+	"github.com/m-mizutani/gollem"
+)
+
+// Export functions for testing
+var (
+	ConvertInputs            = convertInputs
+	ConvertTool              = convertTool
+	MergeConsecutiveMessages = mergeConsecutiveMessages
+	TokenLimitErrorOptions   = tokenLimitErrorOptions
+	GenerateEmbedding        = generateEmbedding
+)
+
+// Export for testing
+type (
+	APIClient   = apiClient
+	EventStream = eventStream
+)
+
+// NewSessionWithAPIClient creates a new session with a custom API client for testing
+func NewSessionWithAPIClient(client apiClient, cfg gollem.SessionConfig, model string) (*Session, error) {
+	return newSession(client, model, generationParameters{
+		Temperature: -1.0,
+		TopP:        -1.0,
+		MaxTokens:   8192,
+	}, slog.New(slog.DiscardHandler), cfg)
+}
@@ -4,13 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/internal/schema"
@@ -30,6 +32,9 @@ type generationParameters struct {
 
 	// MaxTokens limits the number of tokens to generate.
 	MaxTokens int64
+
+	// StopSequences stop the generation when generated.
+	StopSequences []string
 }
 
 // setTemperatureAndTopP sets temperature and/or top_p on the request params.
@@ -72,6 +77,17 @@ type Client struct {
 
 	// timeout for API requests
 	timeout time.Duration
+
+	logger *slog.Logger
+
+	// httpMiddlewares wrap the HTTP round trip of API calls.
+	httpMiddlewares []gollem.HTTPMiddleware
+
+	// rateLimiters are waited for before each API call.
+	rateLimiters []gollem.RateLimiter
+
+	// quota tracks the rate limit headers of responses and holds calls back near exhaustion.
+	quota *gollem.QuotaTracker
 }
 
 // Option is a function that configures a Client.
@@ -138,6 +154,65 @@ func WithBaseURL(url string) Option {
 	}
 }
 
+// WithLogger sets the logger for the client. Repairs of the request history are logged at
+// debug level. Default is discard logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithHTTPMiddleware adds middlewares around the HTTP round trip of API calls, e.g. to inject
+// headers or sign requests for an API gateway. The middlewares are applied in the order they
+// are provided.
+func WithHTTPMiddleware(middlewares ...gollem.HTTPMiddleware) Option {
+	return func(c *Client) {
+		c.httpMiddlewares = append(c.httpMiddlewares, middlewares...)
+	}
+}
+
+// WithRateLimiter adds rate limiters waited for before each API call of the client's sessions,
+// e.g. *rate.Limiter of golang.org/x/time/rate. A limiter consumes 1 per call for a request
+// limit, or the estimated input tokens if wrapped by gollem.TokenRateLimiter for a token limit.
+// Share the limiters among clients of the same account to respect its limits.
+func WithRateLimiter(limiters ...gollem.RateLimiter) Option {
+	return func(c *Client) {
+		c.rateLimiters = append(c.rateLimiters, limiters...)
+	}
+}
+
+// httpMiddlewareOption converts middlewares to a middleware option of the Anthropic SDK.
+func httpMiddlewareOption(middlewares []gollem.HTTPMiddleware) option.RequestOption {
+	return option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		return gollem.BuildHTTPChain(middlewares, next)(req)
+	})
+}
+
+// WithQuotaTracker sets the QuotaTracker of the client, e.g. to share the quota of an account
+// among clients or to change its reserve. By default, each client has its own tracker.
+func WithQuotaTracker(tracker *gollem.QuotaTracker) Option {
+	return func(c *Client) {
+		c.quota = tracker
+	}
+}
+
+// QuotaStatus returns the quota of the account reported by the rate limit headers of the latest
+// API responses, e.g. for dashboards.
+func (c *Client) QuotaStatus() gollem.QuotaStatus {
+	if c.quota == nil {
+		return gollem.QuotaStatus{}
+	}
+	return c.quota.Status()
+}
+
+// sessionRateLimiters returns the rate limiters of sessions, including the quota tracker.
+func (c *Client) sessionRateLimiters() []gollem.RateLimiter {
+	if c.quota == nil {
+		return c.rateLimiters
+	}
+	return append(slices.Clip(c.rateLimiters), c.quota)
+}
+
 // New creates a new client for the Claude API.
 // It requires an API key and can be configured with additional options.
 func New(ctx context.Context, apiKey string, options ...Option) (*Client, error) {
@@ -151,6 +226,7 @@ func New(ctx context.Context, apiKey string, options ...Option) (*Client, error)
 			MaxTokens:   8192,
 		},
 		timeout: 30 * time.Second, // Default timeout
+		logger:  slog.New(slog.DiscardHandler),
 	}
 
 	for _, option := range options {
@@ -174,6 +250,13 @@ func New(ctx context.Context, apiKey string, options ...Option) (*Client, error)
 		clientOptions = append(clientOptions, option.WithHTTPClient(httpClient))
 	}
 
+	if client.quota == nil {
+		client.quota = gollem.NewQuotaTracker()
+	}
+	// The tracker sees responses as they are received
+	middlewares := append(slices.Clip(client.httpMiddlewares), client.quota.HTTPMiddleware())
+	clientOptions = append(clientOptions, httpMiddlewareOption(middlewares))
+
 	newClient := anthropic.NewClient(clientOptions...)
 	client.client = &newClient
 
@@ -199,6 +282,15 @@ type Session struct {
 	params generationParameters
 
 	cfg gollem.SessionConfig
+
+	logger *slog.Logger
+
+	rateLimiters []gollem.RateLimiter
+}
+
+// Model returns the default model of the client.
+func (c *Client) Model() string {
+	return c.defaultModel
 }
 
 // NewSession creates a new session for the Claude API.
@@ -229,6 +321,8 @@ func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption
 		params:          c.params,
 		historyMessages: historyMessages,
 		cfg:             cfg,
+		logger:          c.logger,
+		rateLimiters:    c.sessionRateLimiters(),
 	}
 
 	return session, nil
@@ -284,6 +378,12 @@ func convertGollemInputsToClaude(ctx context.Context, input ...gollem.Input) ([]
 			})
 			userContentBlocks = append(userContentBlocks, imageBlock)
 
+		case gollem.ImageURL:
+			// Claude fetches the image from the URL
+			userContentBlocks = append(userContentBlocks, anthropic.NewImageBlock(anthropic.URLImageSourceParam{
+				URL: v.URL(),
+			}))
+
 		case gollem.PDF:
 			// Create document block for Claude using Base64PDFSource
 			docBlock := anthropic.NewDocumentBlock(anthropic.Base64PDFSourceParam{
@@ -291,6 +391,13 @@ func convertGollemInputsToClaude(ctx context.Context, input ...gollem.Input) ([]
 			})
 			userContentBlocks = append(userContentBlocks, docBlock)
 
+		case gollem.File:
+			fileBlock, err := newFileBlock(v.MimeType(), v.Name(), v.Data())
+			if err != nil {
+				return nil, nil, err
+			}
+			userContentBlocks = append(userContentBlocks, fileBlock)
+
 		case gollem.FunctionResponse:
 			// If we have accumulated user content, create a message for it
 			if len(userContentBlocks) > 0 {
@@ -302,13 +409,13 @@ func convertGollemInputsToClaude(ctx context.Context, input ...gollem.Input) ([]
 			var response string
 
 			if isError {
-				response = fmt.Sprintf("Error: %v", v.Error)
+				response = v.EncodeError()
 			} else {
-				data, err := json.Marshal(v.Data)
+				data, err := v.EncodeData()
 				if err != nil {
 					return nil, nil, goerr.Wrap(err, "failed to marshal function response")
 				}
-				response = string(data)
+				response = data
 			}
 
 			// Create tool result block with new API
@@ -415,6 +522,7 @@ func generateClaudeStream(
 	cfg gollem.SessionConfig,
 	messageHistory *[]anthropic.MessageParam,
 	systemPromptOverride []anthropic.TextBlockParam,
+	toolChoice *gollem.ToolChoice,
 ) (<-chan *gollem.Response, error) {
 	// Prepare message parameters
 	msgParams := anthropic.MessageNewParams{
@@ -427,10 +535,16 @@ func generateClaudeStream(
 	if err := setTemperatureAndTopP(&msgParams, params.Temperature, params.TopP); err != nil {
 		return nil, goerr.Wrap(err, "failed to set generation parameters")
 	}
+	if len(params.StopSequences) > 0 {
+		msgParams.StopSequences = params.StopSequences
+	}
 
 	if len(tools) > 0 {
 		msgParams.Tools = tools
 	}
+	if toolChoice != nil {
+		msgParams.ToolChoice = convertToolChoice(*toolChoice)
+	}
 
 	// Add system prompt (use override if provided, otherwise derive from cfg)
 	var systemPrompt []anthropic.TextBlockParam
@@ -458,6 +572,7 @@ func generateClaudeStream(
 	var textContent strings.Builder
 	var toolCalls []anthropic.ContentBlockParamUnion
 	acc := newFunctionCallAccumulator()
+	var callIndex int
 	var totalInputTokens int
 	var totalOutputTokens int
 
@@ -487,7 +602,9 @@ func generateClaudeStream(
 			response := &gollem.Response{
 				Texts:         make([]string, 0),
 				FunctionCalls: make([]*gollem.FunctionCall, 0),
+				Model:         model,
 			}
+			response.SetRaw(event)
 
 			switch event.Type {
 			case "message_delta":
@@ -516,6 +633,10 @@ func generateClaudeStream(
 					jsonDelta := deltaEvent.Delta.AsInputJSONDelta()
 					if jsonDelta.PartialJSON != "" {
 						acc.Arguments += jsonDelta.PartialJSON
+						response.FunctionCallDeltas = append(response.FunctionCallDeltas, &gollem.FunctionCallDelta{
+							Index:     callIndex,
+							Arguments: jsonDelta.PartialJSON,
+						})
 					}
 				}
 			case "content_block_start":
@@ -524,6 +645,11 @@ func generateClaudeStream(
 					toolUseBlock := startEvent.ContentBlock.AsToolUse()
 					acc.ID = toolUseBlock.ID
 					acc.Name = toolUseBlock.Name
+					response.FunctionCallDeltas = append(response.FunctionCallDeltas, &gollem.FunctionCallDelta{
+						Index: callIndex,
+						ID:    toolUseBlock.ID,
+						Name:  toolUseBlock.Name,
+					})
 				}
 			case "content_block_stop":
 				if acc.ID != "" && acc.Name != "" {
@@ -538,6 +664,7 @@ func generateClaudeStream(
 					response.OutputToken = totalOutputTokens
 					toolCalls = append(toolCalls, anthropic.NewToolUseBlock(funcCall.ID, funcCall.Arguments, funcCall.Name))
 					acc = newFunctionCallAccumulator()
+					callIndex++
 				}
 			}
 
@@ -553,7 +680,9 @@ func generateClaudeStream(
 // processResponseWithContentType converts Claude response to gollem.Response with content type handling
 func processResponseWithContentType(ctx context.Context, resp *anthropic.Message, contentType gollem.ContentType, hasResponseSchema bool) *gollem.Response {
 	if len(resp.Content) == 0 {
-		return &gollem.Response{}
+		response := &gollem.Response{}
+		response.SetRaw(resp)
+		return response
 	}
 
 	response := &gollem.Response{
@@ -562,6 +691,7 @@ func processResponseWithContentType(ctx context.Context, resp *anthropic.Message
 		InputToken:    int(resp.Usage.InputTokens),
 		OutputToken:   int(resp.Usage.OutputTokens),
 	}
+	response.SetRaw(resp)
 
 	for _, content := range resp.Content {
 		switch content.Type {
@@ -598,6 +728,9 @@ func processResponseWithContentType(ctx context.Context, resp *anthropic.Message
 // Generate processes the input and generates a response with optional per-call overrides.
 // It handles both text messages and function responses.
 func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+	// Generation defaults of the session are overridden by per-call options
+	opts = append(s.cfg.GenerateOptions(), opts...)
+
 	// Build the content request for middleware
 	// Create a copy of the current history to avoid middleware side effects
 	var historyCopy *gollem.History
@@ -635,6 +768,7 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 		apiMessages := make([]anthropic.MessageParam, 0, len(s.historyMessages)+len(messages))
 		apiMessages = append(apiMessages, s.historyMessages...)
 		apiMessages = append(apiMessages, messages...)
+		apiMessages = repairToolPairs(s.logger, apiMessages)
 
 		// Create the request and call the API
 		systemPrompt, err := createSystemPrompt(ctx, s.cfg)
@@ -665,6 +799,11 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 			return nil, err
 		}
 
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
 		// Start LLM call trace span
 		var traceData *trace.LLMCallData
 		var llmErr error
@@ -676,9 +815,13 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 		resp, err := s.apiClient.MessagesNew(ctx, request)
 		if err != nil {
 			llmErr = err
-			opts := tokenLimitErrorOptions(err)
+			opts := apiErrorOptions(err)
 			return nil, goerr.Wrap(err, "failed to create message", opts...)
 		}
+		if resp.StopReason == anthropic.StopReasonRefusal {
+			llmErr = goerr.Wrap(gollem.ErrProhibitedContent, "response refused by safety filter")
+			return nil, llmErr
+		}
 
 		// Process response and extract content
 		effectiveCT, hasSchema := effectiveContentType(s.cfg.ContentType(), s.cfg.ResponseSchema(), opts...)
@@ -703,14 +846,12 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 			FunctionCalls: processedResp.FunctionCalls,
 			InputToken:    processedResp.InputToken,
 			OutputToken:   processedResp.OutputToken,
+			Raw:           resp,
 		}, nil
 	}
 
 	// Build middleware chain
-	handler := gollem.ContentBlockHandler(baseHandler)
-	for i := len(s.cfg.ContentBlockMiddlewares()) - 1; i >= 0; i-- {
-		handler = s.cfg.ContentBlockMiddlewares()[i](handler)
-	}
+	handler := s.cfg.ContentBlockChain(baseHandler)
 
 	// Execute middleware chain
 	contentResp, err := handler(ctx, contentReq)
@@ -719,26 +860,43 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 	}
 
 	// Convert ContentResponse back to gollem.Response
-	return &gollem.Response{
+	response := &gollem.Response{
 		Texts:         contentResp.Texts,
 		FunctionCalls: contentResp.FunctionCalls,
 		InputToken:    contentResp.InputToken,
 		OutputToken:   contentResp.OutputToken,
-	}, nil
+		Model:         s.defaultModel,
+	}
+	response.SetRaw(contentResp.Raw)
+	return response, nil
 }
 
 // applyPerCallOverrides applies per-call GenerateOption overrides to Claude request params.
 func applyPerCallOverrides(request *anthropic.MessageNewParams, opts ...gollem.GenerateOption) error {
 	genCfg := gollem.NewGenerateConfig(opts...)
-	if t := genCfg.Temperature(); t != nil {
+	// Claude does not allow both, so an override of one replaces the other set by the client
+	t, p := genCfg.Temperature(), genCfg.TopP()
+	if t != nil {
 		request.Temperature = anthropic.Float(*t)
+		if p == nil {
+			request.TopP = param.Opt[float64]{}
+		}
 	}
-	if p := genCfg.TopP(); p != nil {
+	if p != nil {
 		request.TopP = anthropic.Float(*p)
+		if t == nil {
+			request.Temperature = param.Opt[float64]{}
+		}
 	}
 	if m := genCfg.MaxTokens(); m != nil {
 		request.MaxTokens = int64(*m)
 	}
+	if stop := genCfg.StopSequences(); stop != nil {
+		request.StopSequences = stop
+	}
+	if choice := genCfg.ToolChoice(); choice != nil {
+		request.ToolChoice = convertToolChoice(*choice)
+	}
 	if perCallSchema := genCfg.ResponseSchema(); perCallSchema != nil {
 		jsonInstruction := "\nPlease format your response as valid JSON."
 		schemaText, err := schema.ConvertParameterToJSONString(perCallSchema)
@@ -776,6 +934,13 @@ func (s *Session) GenerateStream(ctx context.Context, input ...gollem.Input) (<-
 	return s.Stream(ctx, input)
 }
 
+// StreamContent generates a response stream iterated by gollem.Stream.
+func (s *Session) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return s.Stream(ctx, input, opts...)
+	})
+}
+
 // FunctionCallAccumulator accumulates function call information from stream
 type FunctionCallAccumulator struct {
 	ID        string
@@ -811,6 +976,9 @@ func (a *FunctionCallAccumulator) accumulate() (*gollem.FunctionCall, error) {
 // Stream processes the input and generates a response stream with optional per-call overrides.
 // It handles both text messages and function responses, and returns a channel for streaming responses.
 func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+	// Generation defaults of the session are overridden by per-call options
+	opts = append(s.cfg.GenerateOptions(), opts...)
+
 	// Build the content request for middleware
 	// Create a copy of the current history to avoid middleware side effects
 	var historyCopy *gollem.History
@@ -848,6 +1016,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 		allMessages := make([]anthropic.MessageParam, 0, len(s.historyMessages)+len(messages))
 		allMessages = append(allMessages, s.historyMessages...)
 		allMessages = append(allMessages, messages...)
+		allMessages = repairToolPairs(s.logger, allMessages)
 
 		// Create request params
 		systemPrompt, err := createSystemPrompt(ctx, s.cfg)
@@ -878,6 +1047,11 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 			return nil, err
 		}
 
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
 		// Start LLM call trace span
 		var streamTraceData *trace.LLMCallData
 		var streamErr error
@@ -891,7 +1065,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 		resp, err := s.apiClient.MessagesNew(ctx, request)
 		if err != nil {
 			streamErr = err
-			opts := tokenLimitErrorOptions(err)
+			opts := apiErrorOptions(err)
 			return nil, goerr.Wrap(err, "failed to create message stream", opts...)
 		}
 
@@ -905,15 +1079,41 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 		go func() {
 			defer close(responseChan)
 
-			// Process response and send chunks
+			// Process response and send chunks. Tool calls are sent with their deltas as
+			// the response is not streamed.
+			var callIndex int
 			for _, content := range resp.Content {
-				if content.Type == "text" {
+				switch content.Type {
+				case "text":
 					textBlock := content.AsText()
 					responseChan <- &gollem.ContentResponse{
 						Texts:       []string{textBlock.Text},
 						InputToken:  int(resp.Usage.InputTokens),
 						OutputToken: int(resp.Usage.OutputTokens),
+						Raw:         resp,
+					}
+				case "tool_use":
+					toolUseBlock := content.AsToolUse()
+					var args map[string]any
+					if err := json.Unmarshal(toolUseBlock.Input, &args); err != nil {
+						responseChan <- &gollem.ContentResponse{
+							Error: goerr.Wrap(err, "failed to unmarshal function arguments"),
+						}
+						return
+					}
+					call := &gollem.FunctionCall{
+						ID:        toolUseBlock.ID,
+						Name:      toolUseBlock.Name,
+						Arguments: args,
 					}
+					responseChan <- &gollem.ContentResponse{
+						FunctionCalls:      []*gollem.FunctionCall{call},
+						FunctionCallDeltas: gollem.FunctionCallDeltas(callIndex, call),
+						InputToken:         int(resp.Usage.InputTokens),
+						OutputToken:        int(resp.Usage.OutputTokens),
+						Raw:                resp,
+					}
+					callIndex++
 				}
 			}
 
@@ -931,10 +1131,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 	}
 
 	// Build middleware chain
-	handler := gollem.ContentStreamHandler(baseHandler)
-	for i := len(s.cfg.ContentStreamMiddlewares()) - 1; i >= 0; i-- {
-		handler = s.cfg.ContentStreamMiddlewares()[i](handler)
-	}
+	handler := s.cfg.ContentStreamChain(baseHandler)
 
 	// Execute middleware chain
 	streamChan, err := handler(ctx, contentReq)
@@ -952,12 +1149,16 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 					Error: streamResp.Error,
 				}
 			} else {
-				responseChan <- &gollem.Response{
-					Texts:         streamResp.Texts,
-					FunctionCalls: streamResp.FunctionCalls,
-					InputToken:    streamResp.InputToken,
-					OutputToken:   streamResp.OutputToken,
+				response := &gollem.Response{
+					Texts:              streamResp.Texts,
+					FunctionCalls:      streamResp.FunctionCalls,
+					FunctionCallDeltas: streamResp.FunctionCallDeltas,
+					InputToken:         streamResp.InputToken,
+					OutputToken:        streamResp.OutputToken,
+					Model:              s.defaultModel,
 				}
+				response.SetRaw(streamResp.Raw)
+				responseChan <- response
 			}
 		}
 	}()
@@ -1111,6 +1312,22 @@ func tokenLimitErrorOptions(err error) []goerr.Option {
 	return nil
 }
 
+// apiErrorOptions returns goerr.Option to tag an error of the API call by
+// tokenLimitErrorOptions and transientErrorOptions.
+func apiErrorOptions(err error) []goerr.Option {
+	return append(tokenLimitErrorOptions(err), transientErrorOptions(err)...)
+}
+
+// transientErrorOptions returns goerr.Option to tag the error with ErrTagTransient if the
+// status code of the API error is transient, e.g. 429 (rate limit) or 529 (overloaded).
+func transientErrorOptions(err error) []goerr.Option {
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) && gollem.IsTransientStatus(apiErr.StatusCode) {
+		return []goerr.Option{goerr.Tag(gollem.ErrTagTransient)}
+	}
+	return nil
+}
+
 // claudeMessagesToTraceMessages converts Claude message params to trace messages.
 func claudeMessagesToTraceMessages(messages []anthropic.MessageParam) []trace.Message {
 	var result []trace.Message
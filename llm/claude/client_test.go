@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -15,6 +17,7 @@ import (
 	"github.com/m-mizutani/gollem/llm/claude"
 	"github.com/m-mizutani/gollem/trace"
 	"github.com/m-mizutani/gt"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -625,3 +628,302 @@ func TestClaudeTraceRequestMessagesNewTurnOnly(t *testing.T) {
 		}
 	}
 }
+
+func TestToolArgsNormalization(t *testing.T) {
+	var msg anthropic.Message
+	gt.NoError(t, json.Unmarshal([]byte(`{
+		"id": "msg_1",
+		"type": "message",
+		"role": "assistant",
+		"model": "claude-3-opus-20240229",
+		"content": [{"type": "tool_use", "id": "toolu_1", "name": "counter", "input": {"count": "3", "verbose": "false", "tags": "[\"a\"]"}}],
+		"stop_reason": "tool_use"
+	}`), &msg))
+
+	mockClient := &apiClientMock{
+		MessagesNewFunc: func(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+			return &msg, nil
+		},
+	}
+	session, err := claude.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "claude-3-opus-20240229")
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("count")})
+	gt.NoError(t, err)
+	gt.A(t, resp.FunctionCalls).Length(1)
+
+	spec := gollem.ToolSpec{
+		Name: "counter",
+		Parameters: map[string]*gollem.Parameter{
+			"count":   {Type: gollem.TypeInteger, Required: true},
+			"verbose": {Type: gollem.TypeBoolean},
+			"tags":    {Type: gollem.TypeArray, Items: &gollem.Parameter{Type: gollem.TypeString}},
+		},
+	}
+	args := spec.NormalizeArgs(resp.FunctionCalls[0].Arguments)
+	gt.Equal(t, map[string]any{"count": 3.0, "verbose": false, "tags": []any{"a"}}, args)
+	gt.NoError(t, spec.ValidateArgs(args))
+}
+
+func TestResponseRaw(t *testing.T) {
+	raw := &anthropic.Message{
+		ID:         "msg_1",
+		Content:    []anthropic.ContentBlockUnion{{Type: "text", Text: "ok"}},
+		Role:       "assistant",
+		Model:      "claude-3-opus-20240229",
+		StopReason: anthropic.StopReasonEndTurn,
+	}
+	mockClient := &apiClientMock{
+		MessagesNewFunc: func(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+			return raw, nil
+		},
+	}
+
+	t.Run("generate", func(t *testing.T) {
+		session, err := claude.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "claude-3-opus-20240229")
+		gt.NoError(t, err)
+
+		resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+		gt.NoError(t, err)
+		got, ok := resp.Raw().(*anthropic.Message)
+		gt.True(t, ok)
+		gt.Equal(t, anthropic.StopReasonEndTurn, got.StopReason)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		session, err := claude.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "claude-3-opus-20240229")
+		gt.NoError(t, err)
+
+		stream, err := session.Stream(context.Background(), []gollem.Input{gollem.Text("hello")})
+		gt.NoError(t, err)
+		var responses []*gollem.Response
+		for resp := range stream {
+			responses = append(responses, resp)
+		}
+		gt.A(t, responses).Length(1)
+		gt.Equal(t, any(raw), responses[0].Raw())
+	})
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	var gatewayHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gatewayHeader = r.Header.Get("X-Gateway-Signature")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-opus-20240229","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	var status int
+	sign := func(next gollem.HTTPHandler) gollem.HTTPHandler {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Gateway-Signature", "signed")
+			resp, err := next(req)
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			return resp, err
+		}
+	}
+
+	client, err := claude.New(context.Background(), "test-key",
+		claude.WithBaseURL(srv.URL),
+		claude.WithHTTPMiddleware(sign),
+	)
+	gt.NoError(t, err)
+	session, err := client.NewSession(context.Background())
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"ok"}, resp.Texts)
+	gt.Equal(t, "signed", gatewayHeader)
+	gt.Equal(t, http.StatusOK, status)
+}
+
+func TestQuotaStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("anthropic-ratelimit-requests-limit", "50")
+		w.Header().Set("anthropic-ratelimit-requests-remaining", "49")
+		w.Header().Set("anthropic-ratelimit-requests-reset", "2026-01-02T03:05:05Z")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-opus-20240229","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	client, err := claude.New(context.Background(), "test-key", claude.WithBaseURL(srv.URL))
+	gt.NoError(t, err)
+	gt.Nil(t, client.QuotaStatus().Requests)
+
+	session, err := client.NewSession(context.Background())
+	gt.NoError(t, err)
+	_, err = session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+
+	status := client.QuotaStatus()
+	gt.Equal(t, &gollem.QuotaLimit{
+		Limit:     50,
+		Remaining: 49,
+		Reset:     time.Date(2026, 1, 2, 3, 5, 5, 0, time.UTC),
+	}, status.Requests)
+	gt.Nil(t, status.Tokens)
+}
+
+type countLimiter struct {
+	waits []int
+}
+
+func (x *countLimiter) WaitN(ctx context.Context, n int) error {
+	x.waits = append(x.waits, n)
+	return nil
+}
+
+func TestWithRateLimiter(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-opus-20240229","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	requests := &countLimiter{}
+	tokens := &countLimiter{}
+	client, err := claude.New(context.Background(), "test-key",
+		claude.WithBaseURL(srv.URL),
+		claude.WithRateLimiter(requests, gollem.TokenRateLimiter(tokens)),
+	)
+	gt.NoError(t, err)
+	session, err := client.NewSession(context.Background())
+	gt.NoError(t, err)
+
+	for range 2 {
+		_, err = session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+		gt.NoError(t, err)
+	}
+	gt.Equal(t, 2, calls)
+	gt.Equal(t, []int{1, 1}, requests.waits)
+	gt.A(t, tokens.waits).Length(2)
+	// The second call includes the history of the first one
+	gt.True(t, tokens.waits[1] > tokens.waits[0])
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		limited, err := claude.New(context.Background(), "test-key",
+			claude.WithBaseURL(srv.URL),
+			claude.WithRateLimiter(rate.NewLimiter(rate.Every(time.Hour), 1)),
+		)
+		gt.NoError(t, err)
+		session, err := limited.NewSession(context.Background())
+		gt.NoError(t, err)
+		calls = 0
+		_, err = session.Generate(ctx, []gollem.Input{gollem.Text("hello")})
+		gt.Error(t, err).Is(context.Canceled)
+		gt.Equal(t, 0, calls)
+	})
+}
+
+func TestRefusal(t *testing.T) {
+	mockClient := &apiClientMock{
+		MessagesNewFunc: func(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+			return &anthropic.Message{
+				ID:         "msg_1",
+				Content:    []anthropic.ContentBlockUnion{},
+				Role:       "assistant",
+				Model:      "claude-3-opus-20240229",
+				StopReason: anthropic.StopReasonRefusal,
+			}, nil
+		},
+	}
+	session, err := claude.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "claude-3-opus-20240229")
+	gt.NoError(t, err)
+
+	_, err = session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+	gt.Error(t, err).Is(gollem.ErrProhibitedContent)
+
+	// the blocked turn is not added to the history
+	history, err := session.History()
+	gt.NoError(t, err)
+	if history != nil {
+		gt.A(t, history.Messages).Length(0)
+	}
+}
+
+func TestFunctionResponseEncoding(t *testing.T) {
+	messages, _, err := claude.ConvertGollemInputsToClaude(t.Context(), gollem.FunctionResponse{
+		ID:       "toolu_1",
+		Name:     "search",
+		Data:     map[string]any{"hits": []any{map[string]any{"title": "Go", "score": 0.9}}},
+		Encoding: gollem.ToolResultEncodingYAML,
+	})
+	gt.NoError(t, err)
+	gt.A(t, messages).Length(1)
+
+	result := messages[0].Content[0].OfToolResult
+	gt.NotNil(t, result)
+	gt.Equal(t, "hits:\n- score: 0.9\n  title: Go", result.Content[0].OfText.Text)
+}
+
+func TestStreamFunctionCallDeltas(t *testing.T) {
+	var msg anthropic.Message
+	gt.NoError(t, json.Unmarshal([]byte(`{
+		"id": "msg_1",
+		"type": "message",
+		"role": "assistant",
+		"model": "claude-3-opus-20240229",
+		"content": [
+			{"type": "text", "text": "Searching."},
+			{"type": "tool_use", "id": "toolu_1", "name": "search", "input": {"query": "gollem"}}
+		],
+		"stop_reason": "tool_use"
+	}`), &msg))
+
+	mockClient := &apiClientMock{
+		MessagesNewFunc: func(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+			return &msg, nil
+		},
+	}
+	session, err := claude.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "claude-3-opus-20240229")
+	gt.NoError(t, err)
+
+	stream, err := session.Stream(context.Background(), []gollem.Input{gollem.Text("search gollem")})
+	gt.NoError(t, err)
+
+	var texts []string
+	var deltas []*gollem.FunctionCallDelta
+	var calls []*gollem.FunctionCall
+	for resp := range stream {
+		gt.NoError(t, resp.Error)
+		texts = append(texts, resp.Texts...)
+		deltas = append(deltas, resp.FunctionCallDeltas...)
+		calls = append(calls, resp.FunctionCalls...)
+	}
+
+	gt.Equal(t, []string{"Searching."}, texts)
+	gt.Equal(t, []*gollem.FunctionCallDelta{
+		{Index: 0, ID: "toolu_1", Name: "search"},
+		{Index: 0, Arguments: `{"query":"gollem"}`},
+	}, deltas)
+	gt.Equal(t, []*gollem.FunctionCall{
+		{ID: "toolu_1", Name: "search", Arguments: map[string]any{"query": "gollem"}},
+	}, calls)
+}
+
+func TestApplyPerCallOverrides(t *testing.T) {
+	t.Run("temperature override clears top_p", func(t *testing.T) {
+		req := &anthropic.MessageNewParams{TopP: anthropic.Float(0.9)}
+		gt.NoError(t, claude.ApplyPerCallOverrides(req, gollem.WithTemperature(0.2), gollem.WithStopSequences("END")))
+		gt.Equal(t, 0.2, req.Temperature.Value)
+		gt.False(t, req.TopP.Valid())
+		gt.Equal(t, []string{"END"}, req.StopSequences)
+	})
+
+	t.Run("top_p override clears temperature", func(t *testing.T) {
+		req := &anthropic.MessageNewParams{Temperature: anthropic.Float(0.7)}
+		gt.NoError(t, claude.ApplyPerCallOverrides(req, gollem.WithTopP(0.5), gollem.WithMaxTokens(100)))
+		gt.Equal(t, 0.5, req.TopP.Value)
+		gt.False(t, req.Temperature.Valid())
+		gt.Equal(t, int64(100), req.MaxTokens)
+	})
+}
@@ -3,7 +3,6 @@ package claude
 import (
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/m-mizutani/goerr/v2"
@@ -147,8 +146,9 @@ func convertClaudeContentBlock(block anthropic.ContentBlockParamUnion) (gollem.M
 				"",
 			)
 		}
-		// Handle URL images if supported
-		// Note: Claude API primarily uses base64 images
+		if block.OfImage.Source.OfURL != nil {
+			return gollem.NewImageContent("", nil, block.OfImage.Source.OfURL.URL, "")
+		}
 	}
 
 	// Handle document blocks (PDF)
@@ -163,6 +163,9 @@ func convertClaudeContentBlock(block anthropic.ContentBlockParamUnion) (gollem.M
 		if block.OfDocument.Source.OfURL != nil {
 			return gollem.NewPDFContent(nil, block.OfDocument.Source.OfURL.URL)
 		}
+		if block.OfDocument.Source.OfText != nil {
+			return gollem.NewFileContent("text/plain", block.OfDocument.Title.Value, []byte(block.OfDocument.Source.OfText.Data))
+		}
 	}
 
 	// Handle tool use blocks
@@ -336,14 +339,8 @@ func convertContentToClaude(content gollem.MessageContent, messageRole gollem.Me
 		if len(imgContent.Data) > 0 {
 			return anthropic.NewImageBlockBase64(imgContent.MediaType, base64.StdEncoding.EncodeToString(imgContent.Data)), nil
 		}
-		// For URL images, create a text block with the URL reference
-		// This maintains the information even though Claude can't directly display the image
 		if imgContent.URL != "" {
-			imageRef := fmt.Sprintf("[Image: %s]", imgContent.URL)
-			if imgContent.Detail != "" {
-				imageRef = fmt.Sprintf("[Image (%s): %s]", imgContent.Detail, imgContent.URL)
-			}
-			return anthropic.NewTextBlock(imageRef), nil
+			return anthropic.NewImageBlock(anthropic.URLImageSourceParam{URL: imgContent.URL}), nil
 		}
 		return anthropic.ContentBlockParamUnion{}, convert.ErrUnsupportedContentType
 
@@ -364,6 +361,13 @@ func convertContentToClaude(content gollem.MessageContent, messageRole gollem.Me
 		}
 		return anthropic.ContentBlockParamUnion{}, convert.ErrUnsupportedContentType
 
+	case gollem.MessageContentTypeFile:
+		file, err := content.GetFileContent()
+		if err != nil {
+			return anthropic.ContentBlockParamUnion{}, err
+		}
+		return newFileBlock(file.MediaType, file.Name, file.Data)
+
 	case gollem.MessageContentTypeToolCall:
 		toolCall, err := content.GetToolCallContent()
 		if err != nil {
@@ -414,3 +418,23 @@ func NewHistory(messages []anthropic.MessageParam) (*gollem.History, error) {
 		Messages: commonMessages,
 	}, nil
 }
+
+// newFileBlock creates a document block of a file. Claude reads PDFs and text files; text files
+// of any MIME type are sent as plain text with the name as the title.
+func newFileBlock(mediaType, name string, data []byte) (anthropic.ContentBlockParamUnion, error) {
+	var block anthropic.ContentBlockParamUnion
+	switch {
+	case mediaType == "application/pdf":
+		block = anthropic.NewDocumentBlock(anthropic.Base64PDFSourceParam{
+			Data: base64.StdEncoding.EncodeToString(data),
+		})
+	case gollem.IsTextMimeType(mediaType):
+		block = anthropic.NewDocumentBlock(anthropic.PlainTextSourceParam{Data: string(data)})
+	default:
+		return anthropic.ContentBlockParamUnion{}, goerr.Wrap(gollem.ErrUnsupportedInput, "file type is not supported by Claude", goerr.V("mime_type", mediaType))
+	}
+	if name != "" {
+		block.OfDocument.Title = anthropic.String(name)
+	}
+	return block, nil
+}
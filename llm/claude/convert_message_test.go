@@ -98,6 +98,17 @@ func TestClaudeMessageRoundTrip(t *testing.T) {
 		},
 	}))
 
+	t.Run("text document block", func(t *testing.T) {
+		doc := anthropic.NewDocumentBlock(anthropic.PlainTextSourceParam{Data: "name,age\nalice,30"})
+		doc.OfDocument.Title = anthropic.String("users.csv")
+		runTest(testCase{
+			name: "text document block",
+			messages: []anthropic.MessageParam{
+				anthropic.NewUserMessage(anthropic.NewTextBlock("Summarize this"), doc),
+			},
+		})(t)
+	})
+
 	t.Run("thinking block", func(t *testing.T) {
 		// Test thinking content conversion (Claude → gollem)
 		block := anthropic.NewThinkingBlock("sig-123", "Let me think...")
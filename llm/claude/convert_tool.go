@@ -146,3 +146,17 @@ func getClaudeType(paramType gollem.ParameterType) string {
 		return "string"
 	}
 }
+
+// convertToolChoice converts gollem.ToolChoice to the tool_choice parameter of the Messages API.
+func convertToolChoice(choice gollem.ToolChoice) anthropic.ToolChoiceUnionParam {
+	switch choice.Mode {
+	case gollem.ToolChoiceModeRequired:
+		return anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}
+	case gollem.ToolChoiceModeNone:
+		return anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+	case gollem.ToolChoiceModeTool:
+		return anthropic.ToolChoiceParamOfTool(choice.Name)
+	default:
+		return anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{}}
+	}
+}
@@ -202,3 +202,13 @@ func TestConvertSchema(t *testing.T) {
 		},
 	}))
 }
+
+func TestConvertToolChoice(t *testing.T) {
+	gt.NotNil(t, claude.ConvertToolChoice(gollem.ToolChoiceAuto()).OfAuto)
+	gt.NotNil(t, claude.ConvertToolChoice(gollem.ToolChoiceRequired()).OfAny)
+	gt.NotNil(t, claude.ConvertToolChoice(gollem.ToolChoiceNone()).OfNone)
+
+	choice := claude.ConvertToolChoice(gollem.ToolChoiceTool("search"))
+	gt.NotNil(t, choice.OfTool)
+	gt.Equal(t, "search", choice.OfTool.Name)
+}
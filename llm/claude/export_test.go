@@ -1,6 +1,8 @@
 package claude
 
 import (
+	"log/slog"
+
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/m-mizutani/gollem"
 )
@@ -9,10 +11,13 @@ import (
 var (
 	ConvertTool                   = convertTool
 	ConvertParameterToSchema      = convertParameterToSchema
+	ConvertToolChoice             = convertToolChoice
 	ConvertGollemInputsToClaude   = convertGollemInputsToClaude
 	CreateSystemPrompt            = createSystemPrompt
 	TokenLimitErrorOptions        = tokenLimitErrorOptions
 	ClaudeMessagesToTraceMessages = claudeMessagesToTraceMessages
+	RepairToolPairs               = repairToolPairs
+	ApplyPerCallOverrides         = applyPerCallOverrides
 )
 
 type JsonSchema = jsonSchema
@@ -47,7 +52,8 @@ func NewSessionWithAPIClient(client apiClient, cfg gollem.SessionConfig, model s
 			TopP:        -1.0,
 			MaxTokens:   8192,
 		},
-		cfg: cfg,
+		cfg:    cfg,
+		logger: slog.New(slog.DiscardHandler),
 	}, nil
 }
 
@@ -0,0 +1,150 @@
+package claude
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// missingToolResultMessage is the content of tool_result blocks inserted for orphaned tool_use blocks.
+const missingToolResultMessage = "tool result is not available"
+
+// repairToolPairs returns messages in which every tool_use block of an assistant message is
+// answered by a tool_result block in the next user message, and every tool_result block answers
+// a tool_use block of the previous assistant message. Claude rejects requests that violate
+// this ("tool_use ids were found without tool_result blocks"), and such messages can appear
+// when history is truncated, compacted or partially serialized.
+//
+// Consecutive user messages are one turn for Claude, and are merged into one user message
+// before the check. convertGollemInputsToClaude emits text and tool_result blocks of the same
+// input as separate user messages, and checking them one by one would drop the real
+// tool_result blocks.
+//
+// An orphaned tool_use block is answered by an inserted error tool_result block, so that the
+// assistant's turn is preserved. An orphaned tool_result block is dropped, and so is a user
+// message that becomes empty. messages is not modified, and each repair is logged at debug
+// level.
+func repairToolPairs(logger *slog.Logger, messages []anthropic.MessageParam) []anthropic.MessageParam {
+	result := make([]anthropic.MessageParam, 0, len(messages))
+	// pending holds the tool_use IDs of the previous assistant message in order.
+	var pending []string
+
+	for i := 0; i < len(messages); i++ {
+		msg := messages[i]
+		switch msg.Role {
+		case anthropic.MessageParamRoleAssistant:
+			if len(pending) > 0 {
+				result = append(result, missingToolResults(logger, i, pending, nil))
+			}
+			pending = toolUseIDs(msg)
+
+		default:
+			// Repairs of the merged turn are logged with the index of its first message.
+			start := i
+			for i+1 < len(messages) && messages[i+1].Role != anthropic.MessageParamRoleAssistant {
+				i++
+			}
+			if i > start {
+				msg = mergeUserMessages(logger, start, messages[start:i+1])
+			}
+
+			msg = dropOrphanedToolResults(logger, start, msg, pending)
+			if len(pending) > 0 {
+				answered := toolResultIDs(msg)
+				var missing []string
+				for _, id := range pending {
+					if _, ok := answered[id]; !ok {
+						missing = append(missing, id)
+					}
+				}
+				if len(missing) > 0 {
+					msg = missingToolResults(logger, start, missing, msg.Content)
+				}
+				pending = nil
+			}
+			if len(msg.Content) == 0 {
+				logger.Debug("drop empty user message after repairing tool_result blocks", "index", start)
+				continue
+			}
+		}
+		result = append(result, msg)
+	}
+
+	if len(pending) > 0 {
+		result = append(result, missingToolResults(logger, len(messages), pending, nil))
+	}
+
+	return result
+}
+
+// mergeUserMessages returns one user message that has the blocks of messages, with
+// tool_result blocks first because they must precede other blocks in a user message.
+func mergeUserMessages(logger *slog.Logger, index int, messages []anthropic.MessageParam) anthropic.MessageParam {
+	var results, others []anthropic.ContentBlockParamUnion
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			if block.OfToolResult != nil {
+				results = append(results, block)
+			} else {
+				others = append(others, block)
+			}
+		}
+	}
+	logger.Debug("merge consecutive user messages", "index", index, "count", len(messages))
+	return anthropic.NewUserMessage(append(results, others...)...)
+}
+
+func toolUseIDs(msg anthropic.MessageParam) []string {
+	var ids []string
+	for _, block := range msg.Content {
+		if block.OfToolUse != nil {
+			ids = append(ids, block.OfToolUse.ID)
+		}
+	}
+	return ids
+}
+
+func toolResultIDs(msg anthropic.MessageParam) map[string]struct{} {
+	ids := make(map[string]struct{})
+	for _, block := range msg.Content {
+		if block.OfToolResult != nil {
+			ids[block.OfToolResult.ToolUseID] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// dropOrphanedToolResults returns msg without tool_result blocks whose ID is not in toolUseIDs.
+func dropOrphanedToolResults(logger *slog.Logger, index int, msg anthropic.MessageParam, toolUseIDs []string) anthropic.MessageParam {
+	var content []anthropic.ContentBlockParamUnion
+	for j, block := range msg.Content {
+		if block.OfToolResult != nil && !slices.Contains(toolUseIDs, block.OfToolResult.ToolUseID) {
+			if content == nil {
+				content = append(make([]anthropic.ContentBlockParamUnion, 0, len(msg.Content)), msg.Content[:j]...)
+			}
+			logger.Debug("drop orphaned tool_result block", "index", index, "tool_use_id", block.OfToolResult.ToolUseID)
+			continue
+		}
+		if content != nil {
+			content = append(content, block)
+		}
+	}
+	if content == nil {
+		return msg
+	}
+	msg.Content = content
+	return msg
+}
+
+// missingToolResults returns a user message that has error tool_result blocks for ids
+// followed by content. tool_result blocks must precede other blocks in a user message.
+func missingToolResults(logger *slog.Logger, index int, ids []string, content []anthropic.ContentBlockParamUnion) anthropic.MessageParam {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(ids)+len(content))
+	for _, id := range ids {
+		logger.Debug("insert tool_result block for orphaned tool_use block", "index", index, "tool_use_id", id)
+		blocks = append(blocks, anthropic.NewToolResultBlock(id, missingToolResultMessage, true))
+	}
+	blocks = append(blocks, content...)
+	return anthropic.NewUserMessage(blocks...)
+}
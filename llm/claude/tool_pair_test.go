@@ -0,0 +1,194 @@
+package claude_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/claude"
+	"github.com/m-mizutani/gt"
+)
+
+// summarizeMessages converts messages to "role:block,block" strings for comparison.
+func summarizeMessages(messages []anthropic.MessageParam) []string {
+	var result []string
+	for _, msg := range messages {
+		s := string(msg.Role) + ":"
+		for i, block := range msg.Content {
+			if i > 0 {
+				s += ","
+			}
+			switch {
+			case block.OfText != nil:
+				s += "text"
+			case block.OfToolUse != nil:
+				s += "use(" + block.OfToolUse.ID + ")"
+			case block.OfToolResult != nil:
+				s += "result(" + block.OfToolResult.ToolUseID + ")"
+				if block.OfToolResult.IsError.Value {
+					s += "!"
+				}
+			}
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestRepairToolPairs(t *testing.T) {
+	text := anthropic.NewTextBlock
+	use := func(id string) anthropic.ContentBlockParamUnion {
+		return anthropic.NewToolUseBlock(id, map[string]any{}, "search")
+	}
+	result := func(id string) anthropic.ContentBlockParamUnion {
+		return anthropic.NewToolResultBlock(id, "ok", false)
+	}
+	user := anthropic.NewUserMessage
+	assistant := anthropic.NewAssistantMessage
+
+	type testCase struct {
+		messages []anthropic.MessageParam
+		expected []string
+	}
+
+	runTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			before := summarizeMessages(tc.messages)
+
+			got := claude.RepairToolPairs(logger, tc.messages)
+			gt.Equal(t, tc.expected, summarizeMessages(got))
+			// input must not be modified
+			gt.Equal(t, before, summarizeMessages(tc.messages))
+			// repairs are logged
+			gt.Equal(t, buf.Len() > 0, !slices.Equal(before, tc.expected))
+		}
+	}
+
+	t.Run("paired messages are kept", runTest(testCase{
+		messages: []anthropic.MessageParam{
+			user(text("hi")),
+			assistant(text("call"), use("a"), use("b")),
+			user(result("b"), result("a")),
+			assistant(text("done")),
+		},
+		expected: []string{"user:text", "assistant:text,use(a),use(b)", "user:result(b),result(a)", "assistant:text"},
+	}))
+
+	t.Run("missing tool_result is inserted before other blocks", runTest(testCase{
+		messages: []anthropic.MessageParam{
+			assistant(use("a"), use("b")),
+			user(result("a"), text("next")),
+		},
+		expected: []string{"assistant:use(a),use(b)", "user:result(b)!,result(a),text"},
+	}))
+
+	t.Run("user message is inserted between assistant messages", runTest(testCase{
+		messages: []anthropic.MessageParam{
+			user(text("hi")),
+			assistant(use("a")),
+			assistant(text("summary")),
+			user(text("next")),
+		},
+		expected: []string{"user:text", "assistant:use(a)", "user:result(a)!", "assistant:text", "user:text"},
+	}))
+
+	t.Run("trailing tool_use is answered", runTest(testCase{
+		messages: []anthropic.MessageParam{
+			user(text("hi")),
+			assistant(use("a")),
+		},
+		expected: []string{"user:text", "assistant:use(a)", "user:result(a)!"},
+	}))
+
+	t.Run("orphaned tool_result is dropped", runTest(testCase{
+		messages: []anthropic.MessageParam{
+			user(result("x"), text("hi")),
+			assistant(use("a")),
+			user(result("a"), result("y")),
+		},
+		expected: []string{"user:text", "assistant:use(a)", "user:result(a)"},
+	}))
+
+	t.Run("empty user message is dropped", runTest(testCase{
+		messages: []anthropic.MessageParam{
+			user(text("hi")),
+			assistant(text("answer")),
+			user(result("x")),
+			user(text("next")),
+		},
+		expected: []string{"user:text", "assistant:text", "user:text"},
+	}))
+
+	t.Run("consecutive user messages are one turn", runTest(testCase{
+		messages: []anthropic.MessageParam{
+			assistant(use("a"), use("b")),
+			user(text("note")),
+			user(result("a"), result("b")),
+			assistant(text("done")),
+		},
+		expected: []string{"assistant:use(a),use(b)", "user:result(a),result(b),text", "assistant:text"},
+	}))
+}
+
+func TestGenerateRepairsToolPairs(t *testing.T) {
+	var sent []anthropic.MessageParam
+	mockClient := &apiClientMock{
+		MessagesNewFunc: func(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+			sent = params.Messages
+			return &anthropic.Message{
+				Content: []anthropic.ContentBlockUnion{{Type: "text", Text: "ok"}},
+				Role:    "assistant",
+			}, nil
+		},
+	}
+
+	// History truncated right after a tool call, e.g. by compaction
+	history, err := claude.NewHistory([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("search it")),
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("toolu_1", map[string]any{"q": "x"}, "search")),
+	})
+	gt.NoError(t, err)
+
+	session, err := claude.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(gollem.WithSessionHistory(history)), "claude-3-opus-20240229")
+	gt.NoError(t, err)
+
+	_, err = session.Generate(context.Background(), []gollem.Input{gollem.Text("continue")})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"user:text", "assistant:use(toolu_1)", "user:result(toolu_1)!,text"}, summarizeMessages(sent))
+}
+
+func TestGenerateKeepsToolResultsWithText(t *testing.T) {
+	var sent []anthropic.MessageParam
+	mockClient := &apiClientMock{
+		MessagesNewFunc: func(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+			sent = params.Messages
+			return &anthropic.Message{
+				Content: []anthropic.ContentBlockUnion{{Type: "text", Text: "ok"}},
+				Role:    "assistant",
+			}, nil
+		},
+	}
+
+	history, err := claude.NewHistory([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("search it")),
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("toolu_1", map[string]any{"q": "x"}, "search")),
+	})
+	gt.NoError(t, err)
+
+	session, err := claude.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(gollem.WithSessionHistory(history)), "claude-3-opus-20240229")
+	gt.NoError(t, err)
+
+	// Text is sent along with tool results, e.g. by a content filter rephrase retry
+	_, err = session.Generate(context.Background(), []gollem.Input{
+		gollem.Text("please rephrase"),
+		gollem.FunctionResponse{ID: "toolu_1", Name: "search", Data: map[string]any{"result": "found"}},
+	})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"user:text", "assistant:use(toolu_1)", "user:result(toolu_1),text"}, summarizeMessages(sent))
+}
@@ -2,6 +2,7 @@ package claude
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
@@ -32,6 +33,14 @@ type VertexClient struct {
 
 	// systemPrompt is the system prompt to use for chat completions.
 	systemPrompt string
+
+	logger *slog.Logger
+
+	// httpMiddlewares wrap the HTTP round trip of API calls.
+	httpMiddlewares []gollem.HTTPMiddleware
+
+	// rateLimiters are waited for before each API call.
+	rateLimiters []gollem.RateLimiter
 }
 
 // VertexOption is a function that configures a VertexClient.
@@ -79,6 +88,31 @@ func WithVertexSystemPrompt(prompt string) VertexOption {
 	}
 }
 
+// WithVertexLogger sets the logger for the client. Repairs of the request history are logged
+// at debug level. Default is discard logger.
+func WithVertexLogger(logger *slog.Logger) VertexOption {
+	return func(c *VertexClient) {
+		c.logger = logger
+	}
+}
+
+// WithVertexHTTPMiddleware adds middlewares around the HTTP round trip of API calls, e.g. to
+// inject headers or sign requests for an API gateway. The middlewares are applied in the order
+// they are provided.
+func WithVertexHTTPMiddleware(middlewares ...gollem.HTTPMiddleware) VertexOption {
+	return func(c *VertexClient) {
+		c.httpMiddlewares = append(c.httpMiddlewares, middlewares...)
+	}
+}
+
+// WithVertexRateLimiter adds rate limiters waited for before each API call of the client's
+// sessions. See WithRateLimiter.
+func WithVertexRateLimiter(limiters ...gollem.RateLimiter) VertexOption {
+	return func(c *VertexClient) {
+		c.rateLimiters = append(c.rateLimiters, limiters...)
+	}
+}
+
 // NewWithVertex creates a new client for Claude models via Vertex AI using Anthropic's official SDK.
 // This is the recommended approach as it uses Anthropic's native Vertex AI integration.
 func NewWithVertex(ctx context.Context, region, projectID string, options ...VertexOption) (*VertexClient, error) {
@@ -97,6 +131,7 @@ func NewWithVertex(ctx context.Context, region, projectID string, options ...Ver
 			TopP:        -1.0, // -1 indicates not set (0.0 is valid)
 			MaxTokens:   8192,
 		},
+		logger: slog.New(slog.DiscardHandler),
 	}
 
 	for _, opt := range options {
@@ -104,10 +139,14 @@ func NewWithVertex(ctx context.Context, region, projectID string, options ...Ver
 	}
 
 	// Create Anthropic client with Vertex AI integration
-	anthropicClient := anthropic.NewClient(
+	clientOptions := []option.RequestOption{
 		option.WithAPIKey("dummy"), // Not used for Vertex AI
 		vertex.WithGoogleAuth(ctx, region, projectID),
-	)
+	}
+	if len(client.httpMiddlewares) > 0 {
+		clientOptions = append(clientOptions, httpMiddlewareOption(client.httpMiddlewares))
+	}
+	anthropicClient := anthropic.NewClient(clientOptions...)
 
 	client.client = &anthropicClient
 
@@ -121,6 +160,13 @@ type VertexAnthropicSession struct {
 	params       generationParameters
 	cfg          gollem.SessionConfig
 	messages     []anthropic.MessageParam
+	logger       *slog.Logger
+	rateLimiters []gollem.RateLimiter
+}
+
+// Model returns the default model of the client.
+func (c *VertexClient) Model() string {
+	return c.defaultModel
 }
 
 // NewSession creates a new session for Claude via Vertex AI using Anthropic SDK.
@@ -142,6 +188,8 @@ func (c *VertexClient) NewSession(ctx context.Context, options ...gollem.Session
 		params:       c.params,
 		cfg:          cfg,
 		messages:     messages,
+		logger:       c.logger,
+		rateLimiters: c.rateLimiters,
 	}
 
 	return session, nil
@@ -169,8 +217,28 @@ func (s *VertexAnthropicSession) convertInputs(ctx context.Context, input ...gol
 	return convertGollemInputsToClaude(ctx, input...)
 }
 
+// waitRateLimits waits for the rate limiters of the client before the API call with the
+// history of the session and input.
+func (s *VertexAnthropicSession) waitRateLimits(ctx context.Context, input []gollem.Input) error {
+	if len(s.rateLimiters) == 0 {
+		return nil
+	}
+	history, err := NewHistory(s.messages)
+	if err != nil {
+		return goerr.Wrap(err, "failed to convert messages to history")
+	}
+	return gollem.WaitRateLimits(ctx, s.rateLimiters, &gollem.ContentRequest{
+		Inputs:       input,
+		History:      history,
+		SystemPrompt: s.cfg.SystemPrompt(),
+	})
+}
+
 // Generate processes the input and generates a response with optional per-call overrides.
 func (s *VertexAnthropicSession) Generate(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+	// Generation defaults of the session are overridden by per-call options
+	opts = append(s.cfg.GenerateOptions(), opts...)
+
 	messages, _, err := s.convertInputs(ctx, input...)
 	if err != nil {
 		return nil, err
@@ -179,6 +247,7 @@ func (s *VertexAnthropicSession) Generate(ctx context.Context, input []gollem.In
 	// Create a copy of messages for the API call, but don't update session history yet
 	apiMessages := append([]anthropic.MessageParam{}, s.messages...)
 	apiMessages = append(apiMessages, messages...)
+	apiMessages = repairToolPairs(s.logger, apiMessages)
 
 	// Convert gollem tools to anthropic tools
 	var tools []anthropic.ToolUnionParam
@@ -195,6 +264,10 @@ func (s *VertexAnthropicSession) Generate(ctx context.Context, input []gollem.In
 		return nil, goerr.Wrap(err, "failed to create system prompt")
 	}
 
+	if err := s.waitRateLimits(ctx, input); err != nil {
+		return nil, err
+	}
+
 	// Start LLM call trace span
 	var traceData *trace.LLMCallData
 	var llmErr error
@@ -227,7 +300,7 @@ func (s *VertexAnthropicSession) Generate(ctx context.Context, input []gollem.In
 	resp, err := s.client.Messages.New(ctx, msgParams)
 	if err != nil {
 		llmErr = err
-		opts := tokenLimitErrorOptions(err)
+		opts := apiErrorOptions(err)
 		return nil, goerr.Wrap(err, "failed to create message via Claude Vertex", opts...)
 	}
 	if err != nil {
@@ -251,11 +324,16 @@ func (s *VertexAnthropicSession) Generate(ctx context.Context, input []gollem.In
 
 	// Use JSON content type if per-call schema is set
 	effectiveCT, hasSchema := effectiveContentType(s.cfg.ContentType(), s.cfg.ResponseSchema(), opts...)
-	return processResponseWithContentType(ctx, resp, effectiveCT, hasSchema), nil
+	response := processResponseWithContentType(ctx, resp, effectiveCT, hasSchema)
+	response.Model = s.defaultModel
+	return response, nil
 }
 
 // Stream processes the input and generates a response stream with optional per-call overrides.
 func (s *VertexAnthropicSession) Stream(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+	// Generation defaults of the session are overridden by per-call options
+	opts = append(s.cfg.GenerateOptions(), opts...)
+
 	messages, _, err := s.convertInputs(ctx, input...)
 	if err != nil {
 		return nil, err
@@ -290,17 +368,33 @@ func (s *VertexAnthropicSession) Stream(ctx context.Context, input []gollem.Inpu
 		systemPromptOverride = tmpRequest.System
 	}
 
-	// Apply per-call overrides to a copy of params for Temperature/TopP/MaxTokens
+	// Apply per-call overrides to a copy of params. Claude does not allow both temperature
+	// and top_p, so an override of one replaces the other set by the client.
 	params := s.params
-	if t := genCfg.Temperature(); t != nil {
+	t, p := genCfg.Temperature(), genCfg.TopP()
+	if t != nil {
 		params.Temperature = *t
+		if p == nil {
+			params.TopP = -1
+		}
 	}
-	if p := genCfg.TopP(); p != nil {
+	if p != nil {
 		params.TopP = *p
+		if t == nil {
+			params.Temperature = -1
+		}
 	}
 	if m := genCfg.MaxTokens(); m != nil {
 		params.MaxTokens = int64(*m)
 	}
+	if stop := genCfg.StopSequences(); stop != nil {
+		params.StopSequences = stop
+	}
+
+	// The inputs are already in the history of the session
+	if err := s.waitRateLimits(ctx, nil); err != nil {
+		return nil, err
+	}
 
 	// Start LLM call trace span
 	traceHandler := trace.HandlerFrom(ctx)
@@ -311,13 +405,14 @@ func (s *VertexAnthropicSession) Stream(ctx context.Context, input []gollem.Inpu
 	ch, err := generateClaudeStream(
 		ctx,
 		s.client,
-		s.messages,
+		repairToolPairs(s.logger, s.messages),
 		s.defaultModel,
 		params,
 		tools,
 		s.cfg,
 		&s.messages,
 		systemPromptOverride,
+		genCfg.ToolChoice(),
 	)
 	if err != nil {
 		if traceHandler != nil {
@@ -394,6 +489,13 @@ func (s *VertexAnthropicSession) GenerateStream(ctx context.Context, input ...go
 	return s.Stream(ctx, input)
 }
 
+// StreamContent generates a response stream iterated by gollem.Stream.
+func (s *VertexAnthropicSession) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return s.Stream(ctx, input, opts...)
+	})
+}
+
 // CountToken calculates the total number of tokens for the given inputs,
 // including system prompt, history messages, and new inputs.
 // This uses Anthropic's Messages Count Tokens API via Vertex AI.
@@ -15,6 +15,10 @@ type apiClient interface {
 	GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) <-chan StreamResponse
 	// CountTokens counts the number of tokens in the given contents
 	CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error)
+	// CreateCachedContent creates cached content used by later calls
+	CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error)
+	// DeleteCachedContent deletes cached content
+	DeleteCachedContent(ctx context.Context, name string) error
 }
 
 // StreamResponse wraps the response and error from streaming
@@ -46,3 +50,12 @@ func (r *realAPIClient) GenerateContentStream(ctx context.Context, model string,
 func (r *realAPIClient) CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
 	return r.client.Models.CountTokens(ctx, model, contents, config)
 }
+
+func (r *realAPIClient) CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	return r.client.Caches.Create(ctx, model, config)
+}
+
+func (r *realAPIClient) DeleteCachedContent(ctx context.Context, name string) error {
+	_, err := r.client.Caches.Delete(ctx, name, nil)
+	return err
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math"
+	"net/http"
 	"strings"
 	"time"
 
+	"cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/httptransport"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 	gollemschema "github.com/m-mizutani/gollem/internal/schema"
@@ -50,6 +54,20 @@ type Client struct {
 
 	// contentType is the type of content to be generated.
 	contentType gollem.ContentType
+
+	logger *slog.Logger
+
+	// httpMiddlewares wrap the HTTP round trip of API calls.
+	httpMiddlewares []gollem.HTTPMiddleware
+
+	// credentials are used instead of Application Default Credentials if set.
+	credentials *auth.Credentials
+
+	// rateLimiters are waited for before each API call.
+	rateLimiters []gollem.RateLimiter
+
+	// contextCacheTTL is the TTL of cached content of sessions, or 0 to disable the cache.
+	contextCacheTTL time.Duration
 }
 
 // Option is a configuration option for the Gemini client.
@@ -167,6 +185,41 @@ func WithContentType(contentType gollem.ContentType) Option {
 	}
 }
 
+// WithLogger sets the logger for the client. Tool schemas downgraded for Gemini compatibility
+// are logged at warn level. Default is discard logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithHTTPMiddleware adds middlewares around the HTTP round trip of API calls, e.g. to inject
+// headers or sign requests for an API gateway. The middlewares are applied in the order they
+// are provided. The requests passed to the middlewares already have the authorization header.
+func WithHTTPMiddleware(middlewares ...gollem.HTTPMiddleware) Option {
+	return func(c *Client) {
+		c.httpMiddlewares = append(c.httpMiddlewares, middlewares...)
+	}
+}
+
+// WithRateLimiter adds rate limiters waited for before each API call of the client's sessions,
+// e.g. *rate.Limiter of golang.org/x/time/rate. A limiter consumes 1 per call for a request
+// limit, or the estimated input tokens if wrapped by gollem.TokenRateLimiter for a token limit.
+// Share the limiters among clients of the same account to respect its limits.
+func WithRateLimiter(limiters ...gollem.RateLimiter) Option {
+	return func(c *Client) {
+		c.rateLimiters = append(c.rateLimiters, limiters...)
+	}
+}
+
+// WithCredentials sets the credentials to call the API instead of Application Default
+// Credentials, e.g. credentials with a static token to replay recorded API calls in tests.
+func WithCredentials(credentials *auth.Credentials) Option {
+	return func(c *Client) {
+		c.credentials = credentials
+	}
+}
+
 // New creates a new client for the Gemini API.
 // It requires a project ID and location, and can be configured with additional options.
 func New(ctx context.Context, projectID, location string, options ...Option) (*Client, error) {
@@ -190,6 +243,7 @@ func New(ctx context.Context, projectID, location string, options ...Option) (*C
 				ThinkingBudget: &budget,
 			},
 		},
+		logger: slog.New(slog.DiscardHandler),
 	}
 
 	for _, option := range options {
@@ -203,6 +257,23 @@ func New(ctx context.Context, projectID, location string, options ...Option) (*C
 		Backend:  genai.BackendVertexAI,
 	}
 
+	if len(client.httpMiddlewares) > 0 {
+		config.HTTPClient = &http.Client{
+			Transport: gollem.NewHTTPTransport(nil, client.httpMiddlewares...),
+		}
+		// A custom HTTP client does not handle credentials by itself
+		if client.credentials != nil {
+			config.Credentials = client.credentials
+			if err := httptransport.AddAuthorizationMiddleware(config.HTTPClient, client.credentials); err != nil {
+				return nil, goerr.Wrap(err, "failed to set credentials")
+			}
+		} else if err := config.UseDefaultCredentials(); err != nil {
+			return nil, goerr.Wrap(err, "failed to set default credentials")
+		}
+	} else if client.credentials != nil {
+		config.Credentials = client.credentials
+	}
+
 	newClient, err := genai.NewClient(ctx, config)
 	if err != nil {
 		return nil, err
@@ -212,6 +283,11 @@ func New(ctx context.Context, projectID, location string, options ...Option) (*C
 	return client, nil
 }
 
+// Model returns the default model of the client.
+func (c *Client) Model() string {
+	return c.defaultModel
+}
+
 // NewSession creates a new session for the Gemini API.
 // It converts the provided tools to Gemini's tool format and initializes a new chat session.
 func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
@@ -263,7 +339,11 @@ func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption
 			FunctionDeclarations: make([]*genai.FunctionDeclaration, len(cfg.Tools())),
 		}
 		for i, tool := range cfg.Tools() {
-			tools[0].FunctionDeclarations[i] = convertToolToNewSDK(tool)
+			decl := convertToolToNewSDK(tool)
+			for _, d := range downgradeFunctionDeclaration(decl) {
+				c.logger.Warn("tool schema is downgraded for Gemini", "tool", decl.Name, "path", d.Path, "reason", d.Reason)
+			}
+			tools[0].FunctionDeclarations[i] = decl
 		}
 		config.Tools = tools
 	}
@@ -284,6 +364,9 @@ func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption
 		config:          config,
 		historyContents: historyContents,
 		cfg:             cfg,
+		rateLimiters:    c.rateLimiters,
+		cache:           newContextCache(c.contextCacheTTL),
+		logger:          c.logger,
 	}
 
 	return session, nil
@@ -306,6 +389,14 @@ type Session struct {
 
 	// cfg is the session configuration
 	cfg gollem.SessionConfig
+
+	// rateLimiters are waited for before each API call
+	rateLimiters []gollem.RateLimiter
+
+	// cache is the cached content of the history, or nil if it's disabled
+	cache *contextCache
+
+	logger *slog.Logger
 }
 
 func (s *Session) History() (*gollem.History, error) {
@@ -335,7 +426,7 @@ func (s *Session) convertInputs(input ...gollem.Input) ([]*genai.Part, error) {
 		case gollem.Image:
 			// Check if format is supported by Gemini (no GIF support)
 			if v.MimeType() == string(gollem.ImageMimeTypeGIF) {
-				return nil, goerr.New("GIF format is not supported by Gemini", goerr.V("mime_type", v.MimeType()))
+				return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "GIF format is not supported by Gemini", goerr.V("mime_type", v.MimeType()))
 			}
 
 			parts = append(parts, &genai.Part{
@@ -344,6 +435,20 @@ func (s *Session) convertInputs(input ...gollem.Input) ([]*genai.Part, error) {
 					Data:     v.Data(),
 				},
 			})
+		case gollem.ImageURL:
+			if v.MimeType() == "" {
+				return nil, goerr.New("MIME type of image URL is required by Gemini", goerr.V("url", v.URL()))
+			}
+			if v.MimeType() == string(gollem.ImageMimeTypeGIF) {
+				return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "GIF format is not supported by Gemini", goerr.V("mime_type", v.MimeType()))
+			}
+
+			parts = append(parts, &genai.Part{
+				FileData: &genai.FileData{
+					MIMEType: v.MimeType(),
+					FileURI:  v.URL(),
+				},
+			})
 		case gollem.PDF:
 			parts = append(parts, &genai.Part{
 				InlineData: &genai.Blob{
@@ -351,21 +456,29 @@ func (s *Session) convertInputs(input ...gollem.Input) ([]*genai.Part, error) {
 					Data:     v.Data(),
 				},
 			})
+		case gollem.File:
+			part, err := newFilePart(v.MimeType(), v.Data())
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
 		case gollem.FunctionResponse:
 			if v.Error != nil {
 				parts = append(parts, &genai.Part{
 					FunctionResponse: &genai.FunctionResponse{
-						Name: v.Name,
-						Response: map[string]any{
-							"error_message": fmt.Sprintf("%+v", v.Error),
-						},
+						Name:     v.Name,
+						Response: v.ErrorData(),
 					},
 				})
 			} else {
+				response, err := convertFunctionResponseData(v)
+				if err != nil {
+					return nil, err
+				}
 				parts = append(parts, &genai.Part{
 					FunctionResponse: &genai.FunctionResponse{
 						Name:     v.Name,
-						Response: v.Data,
+						Response: response,
 					},
 				})
 			}
@@ -376,10 +489,30 @@ func (s *Session) convertInputs(input ...gollem.Input) ([]*genai.Part, error) {
 	return parts, nil
 }
 
+// convertFunctionResponseData returns the data of v for genai.FunctionResponse. Gemini takes it
+// as a structured object, so compact JSON is sent as the trimmed object, and other encodings as
+// text in the "output" field.
+func convertFunctionResponseData(v gollem.FunctionResponse) (map[string]any, error) {
+	switch v.Encoding {
+	case "", gollem.ToolResultEncodingJSON:
+		return v.Data, nil
+	case gollem.ToolResultEncodingCompactJSON:
+		return gollem.TrimToolResult(v.Data), nil
+	default:
+		output, err := v.EncodeData()
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to encode function response")
+		}
+		return map[string]any{"output": output}, nil
+	}
+}
+
 // processResponse converts Gemini response to gollem.Response
 func processResponse(resp *genai.GenerateContentResponse) (*gollem.Response, error) {
 	if len(resp.Candidates) == 0 {
-		return &gollem.Response{}, nil
+		response := &gollem.Response{}
+		response.SetRaw(resp)
+		return response, nil
 	}
 
 	response := &gollem.Response{
@@ -387,6 +520,7 @@ func processResponse(resp *genai.GenerateContentResponse) (*gollem.Response, err
 		FunctionCalls: make([]*gollem.FunctionCall, 0),
 		Thoughts:      make([]string, 0),
 	}
+	response.SetRaw(resp)
 
 	// Extract token counts from UsageMetadata if available
 	if resp.UsageMetadata != nil {
@@ -399,8 +533,9 @@ func processResponse(resp *genai.GenerateContentResponse) (*gollem.Response, err
 			if strings.Contains(string(candidate.FinishReason), "MALFORMED_FUNCTION_CALL") {
 				return nil, goerr.Wrap(gollem.ErrFunctionCallFormat, "malformed function call")
 			}
-			if strings.Contains(string(candidate.FinishReason), "PROHIBITED_CONTENT") {
-				return nil, goerr.Wrap(gollem.ErrProhibitedContent, "prohibited content")
+			switch candidate.FinishReason {
+			case genai.FinishReasonProhibitedContent, genai.FinishReasonSafety, genai.FinishReasonBlocklist, genai.FinishReasonSPII:
+				return nil, goerr.Wrap(gollem.ErrProhibitedContent, "prohibited content", goerr.V("finish_reason", candidate.FinishReason))
 			}
 		}
 
@@ -462,13 +597,8 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 			}
 		}
 
-		// Build complete content list from history and inputs
-		var contents []*genai.Content
-
-		// Add history to contents if available
-		if len(s.historyContents) > 0 {
-			contents = append(contents, s.historyContents...)
-		}
+		// History of the call; the contents of this turn are sent after it
+		history := s.historyContents
 
 		// Convert current inputs to parts
 		parts, err := s.convertInputs(req.Inputs...)
@@ -485,10 +615,14 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 				Role:  "user",
 				Parts: parts,
 			}
-			contents = append(contents, userContent)
 			newTurnContents = append(newTurnContents, userContent)
 		}
 
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
 		// Start LLM call trace span
 		var geminiTraceData *trace.LLMCallData
 		var llmErr error
@@ -504,10 +638,10 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 		}
 
 		// Call the API
-		result, err := s.apiClient.GenerateContent(ctx, s.model, contents, effectiveConfig)
+		result, err := s.generateContent(ctx, history, newTurnContents, effectiveConfig)
 		if err != nil {
 			llmErr = err
-			opts := tokenLimitErrorOptions(err)
+			opts := apiErrorOptions(err)
 			return nil, goerr.Wrap(err, "failed to generate content", opts...)
 		}
 
@@ -551,14 +685,12 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 			FunctionCalls: response.FunctionCalls,
 			InputToken:    response.InputToken,
 			OutputToken:   response.OutputToken,
+			Raw:           result,
 		}, nil
 	}
 
 	// Build middleware chain
-	handler := gollem.ContentBlockHandler(baseHandler)
-	for i := len(s.cfg.ContentBlockMiddlewares()) - 1; i >= 0; i-- {
-		handler = s.cfg.ContentBlockMiddlewares()[i](handler)
-	}
+	handler := s.cfg.ContentBlockChain(baseHandler)
 
 	// Execute middleware chain
 	contentResp, err := handler(ctx, contentReq)
@@ -567,12 +699,15 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 	}
 
 	// Convert ContentResponse back to gollem.Response
-	return &gollem.Response{
+	response := &gollem.Response{
 		Texts:         contentResp.Texts,
 		FunctionCalls: contentResp.FunctionCalls,
 		InputToken:    contentResp.InputToken,
 		OutputToken:   contentResp.OutputToken,
-	}, nil
+		Model:         s.model,
+	}
+	response.SetRaw(contentResp.Raw)
+	return response, nil
 }
 
 // Stream generates content based on the input and returns a stream of responses with optional per-call overrides.
@@ -602,13 +737,8 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 			}
 		}
 
-		// Build complete content list from history and inputs
-		var contents []*genai.Content
-
-		// Add history to contents if available
-		if len(s.historyContents) > 0 {
-			contents = append(contents, s.historyContents...)
-		}
+		// History of the call; the contents of this turn are sent after it
+		history := s.historyContents
 
 		// Convert current inputs to parts
 		parts, err := s.convertInputs(req.Inputs...)
@@ -625,10 +755,14 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 				Role:  "user",
 				Parts: parts,
 			}
-			contents = append(contents, userContent)
 			newTurnContents = append(newTurnContents, userContent)
 		}
 
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
 		// Start LLM call trace span
 		traceHandler := trace.HandlerFrom(ctx)
 		if traceHandler != nil {
@@ -656,7 +790,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 			}
 
 			// Get the streaming response from API
-			apiStreamChan := s.apiClient.GenerateContentStream(ctx, s.model, contents, effectiveConfig)
+			apiStreamChan := s.generateContentStream(ctx, history, newTurnContents, effectiveConfig)
 
 			// Accumulate response data for history
 			var accumulatedTexts []string
@@ -666,7 +800,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 			for streamResp := range apiStreamChan {
 				if streamResp.Err != nil {
 					streamErr = streamResp.Err
-					opts := tokenLimitErrorOptions(streamResp.Err)
+					opts := apiErrorOptions(streamResp.Err)
 					streamChan <- &gollem.ContentResponse{
 						Error: goerr.Wrap(streamResp.Err, "failed to generate content stream", opts...),
 					}
@@ -683,18 +817,27 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 					return
 				}
 
+				// Gemini streams function calls at once, so the deltas of the
+				// calls are sent with them
+				var callDeltas []*gollem.FunctionCallDelta
+				for _, fc := range response.FunctionCalls {
+					callDeltas = append(callDeltas, gollem.FunctionCallDeltas(len(accumulatedFunctionCalls), fc)...)
+					accumulatedFunctionCalls = append(accumulatedFunctionCalls, fc)
+				}
+
 				// Accumulate data
 				accumulatedTexts = append(accumulatedTexts, response.Texts...)
-				accumulatedFunctionCalls = append(accumulatedFunctionCalls, response.FunctionCalls...)
 				totalInputTokens += response.InputToken
 				totalOutputTokens += response.OutputToken
 
 				// Send streaming response with delta
 				streamChan <- &gollem.ContentResponse{
-					Texts:         response.Texts,
-					FunctionCalls: response.FunctionCalls,
-					InputToken:    totalInputTokens,
-					OutputToken:   totalOutputTokens,
+					Texts:              response.Texts,
+					FunctionCalls:      response.FunctionCalls,
+					FunctionCallDeltas: callDeltas,
+					InputToken:         totalInputTokens,
+					OutputToken:        totalOutputTokens,
+					Raw:                streamResp.Resp,
 				}
 			}
 
@@ -771,10 +914,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 	}
 
 	// Build middleware chain for streaming
-	handler := gollem.ContentStreamHandler(baseHandler)
-	for i := len(s.cfg.ContentStreamMiddlewares()) - 1; i >= 0; i-- {
-		handler = s.cfg.ContentStreamMiddlewares()[i](handler)
-	}
+	handler := s.cfg.ContentStreamChain(baseHandler)
 
 	// Execute middleware chain
 	streamChan, err := handler(ctx, contentReq)
@@ -795,11 +935,14 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 
 			// Convert ContentResponse to Response
 			resp := &gollem.Response{
-				Texts:         contentResp.Texts,
-				FunctionCalls: contentResp.FunctionCalls,
-				InputToken:    contentResp.InputToken,
-				OutputToken:   contentResp.OutputToken,
+				Texts:              contentResp.Texts,
+				FunctionCalls:      contentResp.FunctionCalls,
+				FunctionCallDeltas: contentResp.FunctionCallDeltas,
+				InputToken:         contentResp.InputToken,
+				OutputToken:        contentResp.OutputToken,
+				Model:              s.model,
 			}
+			resp.SetRaw(contentResp.Raw)
 
 			respChan <- resp
 		}
@@ -808,7 +951,9 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 	return respChan, nil
 }
 
-// GenerateEmbedding generates embeddings for the given input texts.
+// GenerateEmbedding generates embeddings for the given input texts. Embeddings are normalized
+// to unit vectors by gollem.NormalizeEmbeddings, as Gemini does not normalize them for a
+// reduced dimension.
 func (c *Client) GenerateEmbedding(ctx context.Context, dimension int, input []string) ([][]float64, error) {
 	// Create content for embedding
 	contents := make([]*genai.Content, len(input))
@@ -860,7 +1005,7 @@ func (c *Client) GenerateEmbedding(ctx context.Context, dimension int, input []s
 		}
 	}
 
-	return embeddings, nil
+	return gollem.NormalizeEmbeddings(embeddings), nil
 }
 
 // Helper function to convert new SDK history to gollem.History
@@ -998,9 +1143,10 @@ func convertResponseSchemaToGenai(param *gollem.Parameter) (*genai.Schema, error
 	return schema, nil
 }
 
-// buildEffectiveConfig creates a copy of the session config with per-call overrides applied.
+// buildEffectiveConfig creates a copy of the session config with the generation defaults of
+// the session and per-call overrides applied.
 func (s *Session) buildEffectiveConfig(opts ...gollem.GenerateOption) (*genai.GenerateContentConfig, error) {
-	genCfg := gollem.NewGenerateConfig(opts...)
+	genCfg := gollem.NewGenerateConfig(append(s.cfg.GenerateOptions(), opts...)...)
 	effectiveConfig := *s.config
 	if t := genCfg.Temperature(); t != nil {
 		temp := float32(*t)
@@ -1016,6 +1162,17 @@ func (s *Session) buildEffectiveConfig(opts ...gollem.GenerateOption) (*genai.Ge
 		}
 		effectiveConfig.MaxOutputTokens = int32(*m)
 	}
+	if stop := genCfg.StopSequences(); stop != nil {
+		effectiveConfig.StopSequences = stop
+	}
+	if choice := genCfg.ToolChoice(); choice != nil {
+		toolConfig := &genai.ToolConfig{}
+		if effectiveConfig.ToolConfig != nil {
+			*toolConfig = *effectiveConfig.ToolConfig
+		}
+		toolConfig.FunctionCallingConfig = convertToolChoice(*choice)
+		effectiveConfig.ToolConfig = toolConfig
+	}
 	if perCallSchema := genCfg.ResponseSchema(); perCallSchema != nil {
 		effectiveConfig.ResponseMIMEType = "application/json"
 		genaiSchema, err := convertResponseSchemaToGenai(perCallSchema)
@@ -1037,6 +1194,13 @@ func (s *Session) GenerateStream(ctx context.Context, input ...gollem.Input) (<-
 	return s.Stream(ctx, input)
 }
 
+// StreamContent generates a response stream iterated by gollem.Stream.
+func (s *Session) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return s.Stream(ctx, input, opts...)
+	})
+}
+
 // CountToken calculates the total number of tokens for the given inputs,
 // including system prompt, history messages, and new inputs.
 // This is useful for estimating API costs and checking token limits before making actual API calls.
@@ -1127,6 +1291,22 @@ func tokenLimitErrorOptions(err error) []goerr.Option {
 	return nil
 }
 
+// apiErrorOptions returns goerr.Option to tag an error of the API call by
+// tokenLimitErrorOptions and transientErrorOptions.
+func apiErrorOptions(err error) []goerr.Option {
+	return append(tokenLimitErrorOptions(err), transientErrorOptions(err)...)
+}
+
+// transientErrorOptions returns goerr.Option to tag the error with ErrTagTransient if the
+// status code of the API error is transient, e.g. 429 (resource exhausted) or 503.
+func transientErrorOptions(err error) []goerr.Option {
+	var apiErr *genai.APIError
+	if errors.As(err, &apiErr) && gollem.IsTransientStatus(apiErr.Code) {
+		return []goerr.Option{goerr.Tag(gollem.ErrTagTransient)}
+	}
+	return nil
+}
+
 // contentsToTraceMessages converts Gemini contents to trace messages.
 func contentsToTraceMessages(contents []*genai.Content) []trace.Message {
 	var messages []trace.Message
@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"math"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/auth"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/gemini"
@@ -47,35 +49,30 @@ func TestClientMalformedFunctionCallErrorHandling(t *testing.T) {
 
 func TestClientRetryLogic(t *testing.T) {
 	t.Run("retry with exponential backoff", func(t *testing.T) {
-		start := time.Now()
-
-		// Simulate what the retry logic would do
-		maxRetries := 3
-		baseDelay := 100 * time.Millisecond
-
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			// Simulate a malformed function call error
-			simulatedError := "malformed function call detected"
-
-			if strings.Contains(simulatedError, "malformed function call") {
-				// Always sleep before the next attempt (except we'll break before the last one)
-				if attempt < maxRetries-1 {
-					// Calculate delay (exponential backoff) using math.Pow like the real implementation
-					delay := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt)))
-					time.Sleep(delay)
-					continue
+		calls := 0
+		mockClient := &apiClientMock{
+			GenerateContentFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+				calls++
+				if calls < 3 {
+					return nil, &genai.APIError{Code: 503, Status: "UNAVAILABLE", Message: "The model is overloaded"}
 				}
-			}
-			break
+				return &genai.GenerateContentResponse{
+					Candidates: []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: "ok"}}}}},
+				}, nil
+			},
 		}
+		session, err := gemini.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "gemini-2.5-flash")
+		gt.NoError(t, err)
 
-		elapsed := time.Since(start)
+		policy := &gollem.RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond}
+		start := time.Now()
+		resp, err := session.Generate(gollem.ContextWithRetryPolicy(context.Background(), policy), []gollem.Input{gollem.Text("hello")})
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"ok"}, resp.Texts)
+		gt.Equal(t, 3, calls)
 
 		// Should have taken at least the sum of delays: 100ms + 200ms = 300ms
-		// (We only sleep on attempt 0 and 1, not on the final attempt)
-		expectedMinDelay := 300 * time.Millisecond
-		gt.Value(t, elapsed >= expectedMinDelay).Equal(true)
-
+		gt.Value(t, time.Since(start) >= 300*time.Millisecond).Equal(true)
 	})
 }
 
@@ -1198,3 +1195,191 @@ func TestGeminiTraceRequestMessagesNewTurnOnly(t *testing.T) {
 		}
 	}
 }
+
+func TestToolArgsNormalization(t *testing.T) {
+	mock := &apiClientMock{
+		GenerateContentFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+			return &genai.GenerateContentResponse{
+				Candidates: []*genai.Candidate{
+					{
+						Content: &genai.Content{
+							Role: "model",
+							Parts: []*genai.Part{
+								{FunctionCall: &genai.FunctionCall{
+									ID:   "call_1",
+									Name: "counter",
+									Args: map[string]any{"count": "3", "verbose": "false", "note": nil},
+								}},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+	session, err := gemini.NewSessionWithAPIClient(mock, gollem.NewSessionConfig(), "gemini-2.5-flash")
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("count")})
+	gt.NoError(t, err)
+	gt.A(t, resp.FunctionCalls).Length(1)
+
+	spec := gollem.ToolSpec{
+		Name: "counter",
+		Parameters: map[string]*gollem.Parameter{
+			"count":   {Type: gollem.TypeInteger, Required: true},
+			"verbose": {Type: gollem.TypeBoolean},
+			"note":    {Type: gollem.TypeString},
+		},
+	}
+	args := spec.NormalizeArgs(resp.FunctionCalls[0].Arguments)
+	gt.Equal(t, map[string]any{"count": 3.0, "verbose": false}, args)
+	gt.NoError(t, spec.ValidateArgs(args))
+}
+
+func TestResponseRaw(t *testing.T) {
+	raw := &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{
+			{
+				Content: &genai.Content{
+					Role:  "model",
+					Parts: []*genai.Part{{Text: "ok"}},
+				},
+				SafetyRatings: []*genai.SafetyRating{
+					{Category: genai.HarmCategoryHarassment, Probability: genai.HarmProbabilityNegligible},
+				},
+			},
+		},
+	}
+	mockClient := &apiClientMock{
+		GenerateContentFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+			return raw, nil
+		},
+		GenerateContentStreamFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) <-chan gemini.StreamResponse {
+			ch := make(chan gemini.StreamResponse, 1)
+			ch <- gemini.StreamResponse{Resp: raw}
+			close(ch)
+			return ch
+		},
+	}
+
+	t.Run("generate", func(t *testing.T) {
+		session, err := gemini.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "gemini-2.5-flash")
+		gt.NoError(t, err)
+
+		resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+		gt.NoError(t, err)
+		got, ok := resp.Raw().(*genai.GenerateContentResponse)
+		gt.True(t, ok)
+		gt.Equal(t, genai.HarmCategoryHarassment, got.Candidates[0].SafetyRatings[0].Category)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		session, err := gemini.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "gemini-2.5-flash")
+		gt.NoError(t, err)
+
+		stream, err := session.Stream(context.Background(), []gollem.Input{gollem.Text("hello")})
+		gt.NoError(t, err)
+		var responses []*gollem.Response
+		for resp := range stream {
+			responses = append(responses, resp)
+		}
+		gt.A(t, responses).Length(1)
+		gt.Equal(t, any(raw), responses[0].Raw())
+	})
+}
+
+func TestConvertFunctionResponseData(t *testing.T) {
+	data := map[string]any{"name": "alice", "email": nil}
+
+	t.Run("json is sent as is", func(t *testing.T) {
+		resp, err := gemini.ConvertFunctionResponseData(gollem.FunctionResponse{Data: data})
+		gt.NoError(t, err)
+		gt.Equal(t, data, resp)
+	})
+
+	t.Run("compact json is sent as trimmed object", func(t *testing.T) {
+		resp, err := gemini.ConvertFunctionResponseData(gollem.FunctionResponse{Data: data, Encoding: gollem.ToolResultEncodingCompactJSON})
+		gt.NoError(t, err)
+		gt.Equal(t, map[string]any{"name": "alice"}, resp)
+	})
+
+	t.Run("yaml is sent as output text", func(t *testing.T) {
+		resp, err := gemini.ConvertFunctionResponseData(gollem.FunctionResponse{Data: data, Encoding: gollem.ToolResultEncodingYAML})
+		gt.NoError(t, err)
+		gt.Equal(t, map[string]any{"output": "email: null\nname: alice"}, resp)
+	})
+}
+
+type staticTokenProvider string
+
+func (p staticTokenProvider) Token(ctx context.Context) (*auth.Token, error) {
+	return &auth.Token{Value: string(p), Type: "Bearer"}, nil
+}
+
+func TestWithCredentials(t *testing.T) {
+	// HTTP middlewares work without Application Default Credentials if credentials are given
+	var authorization string
+	fake := func(next gollem.HTTPHandler) gollem.HTTPHandler {
+		return func(req *http.Request) (*http.Response, error) {
+			authorization = req.Header.Get("Authorization")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}]}`)),
+				Request:    req,
+			}, nil
+		}
+	}
+
+	client, err := gemini.New(t.Context(), "test-project", "us-central1",
+		gemini.WithCredentials(auth.NewCredentials(&auth.CredentialsOptions{TokenProvider: staticTokenProvider("test-token")})),
+		gemini.WithHTTPMiddleware(fake),
+	)
+	gt.NoError(t, err)
+	session, err := client.NewSession(t.Context())
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"ok"}, resp.Texts)
+	gt.Equal(t, "Bearer test-token", authorization)
+}
+
+func TestStreamFunctionCallDeltas(t *testing.T) {
+	mockClient := &apiClientMock{
+		GenerateContentStreamFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) <-chan gemini.StreamResponse {
+			ch := make(chan gemini.StreamResponse, 2)
+			ch <- gemini.StreamResponse{Resp: &genai.GenerateContentResponse{
+				Candidates: []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: "Searching."}}}}},
+			}}
+			ch <- gemini.StreamResponse{Resp: &genai.GenerateContentResponse{
+				Candidates: []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []*genai.Part{
+					{FunctionCall: &genai.FunctionCall{Name: "search", Args: map[string]any{"query": "gollem"}}},
+					{FunctionCall: &genai.FunctionCall{Name: "now"}},
+				}}}},
+			}}
+			close(ch)
+			return ch
+		},
+	}
+	session, err := gemini.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "gemini-2.5-flash")
+	gt.NoError(t, err)
+
+	stream, err := session.Stream(context.Background(), []gollem.Input{gollem.Text("search gollem")})
+	gt.NoError(t, err)
+
+	var deltas []*gollem.FunctionCallDelta
+	var calls []*gollem.FunctionCall
+	for resp := range stream {
+		deltas = append(deltas, resp.FunctionCallDeltas...)
+		calls = append(calls, resp.FunctionCalls...)
+	}
+
+	gt.A(t, calls).Length(2)
+	gt.Equal(t, []*gollem.FunctionCallDelta{
+		{Index: 0, ID: calls[0].ID, Name: "search"},
+		{Index: 0, Arguments: `{"query":"gollem"}`},
+		{Index: 1, ID: calls[1].ID, Name: "now"},
+	}, deltas)
+}
@@ -0,0 +1,228 @@
+package gemini
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+	"google.golang.org/genai"
+)
+
+// contextCacheExpiryMargin is the time before expiry of the cached content when it's considered
+// expired, so that it does not expire during a call.
+const contextCacheExpiryMargin = 10 * time.Second
+
+// WithContextCache lets sessions keep their history in cached content of Gemini that lives for
+// ttl, so that each call sends only the contents after the cached history. The cache is created
+// at the first call with a history, and recreated when the history grows twice as long as the
+// cached part. It's re-synced from the local history when it expires, when Gemini does not find
+// it, e.g. deleted by another process, and when the history diverges from it, e.g. compacted by
+// a middleware; the re-sync is recorded as a gollem.SessionResyncEvent to the trace. If the
+// cache can not be created, e.g. the history is shorter than the minimum tokens of the model,
+// calls send the whole history as without the cache. Calls with a per-call tool choice do not
+// use the cache.
+func WithContextCache(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.contextCacheTTL = ttl
+	}
+}
+
+// contextCache is the cached content of a session keeping the first contents of the history.
+type contextCache struct {
+	ttl time.Duration
+
+	// name is the resource name of the cached content, or empty if nothing is cached
+	name string
+	// size is the number of the contents in the cached content
+	size int
+	// digest is the digest of the contents in the cached content
+	digest string
+	// expireTime is the expiry of the cached content
+	expireTime time.Time
+	// retryAt is the history size to try creating the cache again after a failure
+	retryAt int
+}
+
+func newContextCache(ttl time.Duration) *contextCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &contextCache{ttl: ttl}
+}
+
+// stale returns true if the cache must be (re)created for history, with the reason to record
+// as a re-sync. The reason is empty for a new or extended cache.
+func (c *contextCache) stale(history []*genai.Content) (gollem.SessionResyncReason, bool) {
+	if c.name == "" {
+		return "", len(history) > 0 && len(history) >= c.retryAt
+	}
+	if len(history) < c.size || digestContents(history[:c.size]) != c.digest {
+		return gollem.SessionResyncDiverged, true
+	}
+	if time.Now().Add(contextCacheExpiryMargin).After(c.expireTime) {
+		return gollem.SessionResyncExpired, true
+	}
+	return "", len(history)-c.size > c.size
+}
+
+// digestContents returns the digest of contents to detect changes of the history.
+func digestContents(contents []*genai.Content) string {
+	raw, err := json.Marshal(contents)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheMissing returns true with the reason if err means the cached content of the call does
+// not exist on Gemini anymore.
+func cacheMissing(err error) (gollem.SessionResyncReason, bool) {
+	var apiErr genai.APIError
+	if ptr := (*genai.APIError)(nil); errors.As(err, &ptr) {
+		apiErr = *ptr
+	} else if !errors.As(err, &apiErr) {
+		return "", false
+	}
+
+	msg := strings.ToLower(apiErr.Message)
+	switch {
+	case apiErr.Code == 404:
+		return gollem.SessionResyncNotFound, true
+	case (apiErr.Code == 400 || apiErr.Code == 403) && strings.Contains(msg, "cache"):
+		if strings.Contains(msg, "expire") {
+			return gollem.SessionResyncExpired, true
+		}
+		return gollem.SessionResyncNotFound, true
+	}
+	return "", false
+}
+
+// syncContextCache creates the cached content of history, replacing the current one.
+func (s *Session) syncContextCache(ctx context.Context, history []*genai.Content, reason gollem.SessionResyncReason) {
+	c := s.cache
+	old := c.name
+	*c = contextCache{ttl: c.ttl}
+
+	cached, err := s.apiClient.CreateCachedContent(ctx, s.model, &genai.CreateCachedContentConfig{
+		TTL:               c.ttl,
+		Contents:          history,
+		SystemInstruction: s.config.SystemInstruction,
+		Tools:             s.config.Tools,
+		ToolConfig:        s.config.ToolConfig,
+	})
+	if err != nil {
+		// e.g. the history is too short to be cached; try again when it has doubled
+		c.retryAt = len(history) * 2
+		s.logger.Warn("failed to create context cache of Gemini", "error", err, "contents", len(history))
+	} else {
+		c.name = cached.Name
+		c.size = len(history)
+		c.digest = digestContents(history)
+		c.expireTime = cached.ExpireTime
+		if c.expireTime.IsZero() {
+			c.expireTime = time.Now().Add(c.ttl)
+		}
+	}
+
+	if old != "" && reason != gollem.SessionResyncNotFound && reason != gollem.SessionResyncExpired {
+		// The replaced cache is no longer used; it expires by itself if the deletion fails
+		_ = s.apiClient.DeleteCachedContent(ctx, old)
+	}
+
+	if reason != "" {
+		if h := trace.HandlerFrom(ctx); h != nil {
+			h.AddEvent(ctx, "session_resync", &gollem.SessionResyncEvent{
+				Provider: "gemini",
+				Reason:   reason,
+				Messages: len(history),
+			})
+		}
+	}
+}
+
+// cachedCall returns the contents and the config of a call of history and the contents of the
+// turn, using the cached content of the history if possible. resync forces re-creating the cache
+// for the reason.
+func (s *Session) cachedCall(ctx context.Context, history, turn []*genai.Content, config *genai.GenerateContentConfig, resync gollem.SessionResyncReason) ([]*genai.Content, *genai.GenerateContentConfig) {
+	all := append(slices.Clip(history), turn...)
+	// Cached content fixes the tool config; a per-call tool choice can not be applied with it
+	if s.cache == nil || config.ToolConfig != s.config.ToolConfig {
+		return all, config
+	}
+
+	if resync != "" {
+		s.syncContextCache(ctx, history, resync)
+	} else if reason, stale := s.cache.stale(history); stale {
+		s.syncContextCache(ctx, history, reason)
+	}
+	if s.cache.name == "" {
+		return all, config
+	}
+
+	cachedConfig := *config
+	cachedConfig.CachedContent = s.cache.name
+	cachedConfig.SystemInstruction = nil
+	cachedConfig.Tools = nil
+	cachedConfig.ToolConfig = nil
+	return append(slices.Clone(history[s.cache.size:]), turn...), &cachedConfig
+}
+
+// generateContent calls the API with the context cache, and calls it again after re-syncing the
+// cache if Gemini does not find it.
+func (s *Session) generateContent(ctx context.Context, history, turn []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	contents, callConfig := s.cachedCall(ctx, history, turn, config, "")
+	result, err := s.apiClient.GenerateContent(ctx, s.model, contents, callConfig)
+	if err == nil || callConfig.CachedContent == "" {
+		return result, err
+	}
+	reason, missing := cacheMissing(err)
+	if !missing {
+		return nil, err
+	}
+
+	contents, callConfig = s.cachedCall(ctx, history, turn, config, reason)
+	return s.apiClient.GenerateContent(ctx, s.model, contents, callConfig)
+}
+
+// generateContentStream starts the stream with the context cache, and starts it again after
+// re-syncing the cache if Gemini does not find it.
+func (s *Session) generateContentStream(ctx context.Context, history, turn []*genai.Content, config *genai.GenerateContentConfig) <-chan StreamResponse {
+	contents, callConfig := s.cachedCall(ctx, history, turn, config, "")
+	ch := s.apiClient.GenerateContentStream(ctx, s.model, contents, callConfig)
+	if callConfig.CachedContent == "" {
+		return ch
+	}
+
+	first, ok := <-ch
+	if ok && first.Err != nil {
+		if reason, missing := cacheMissing(first.Err); missing {
+			go func() {
+				for range ch {
+				}
+			}()
+			contents, callConfig = s.cachedCall(ctx, history, turn, config, reason)
+			return s.apiClient.GenerateContentStream(ctx, s.model, contents, callConfig)
+		}
+	}
+
+	out := make(chan StreamResponse)
+	go func() {
+		defer close(out)
+		if !ok {
+			return
+		}
+		out <- first
+		for resp := range ch {
+			out <- resp
+		}
+	}()
+	return out
+}
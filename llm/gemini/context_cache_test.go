@@ -0,0 +1,212 @@
+package gemini_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/gemini"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+	"google.golang.org/genai"
+)
+
+// resyncEvents returns the session_resync events recorded under span
+func resyncEvents(span *trace.Span) []*gollem.SessionResyncEvent {
+	var events []*gollem.SessionResyncEvent
+	for _, child := range span.Children {
+		if child.Event != nil && child.Event.Kind == "session_resync" {
+			events = append(events, child.Event.Data.(*gollem.SessionResyncEvent))
+		}
+		events = append(events, resyncEvents(child)...)
+	}
+	return events
+}
+
+func TestContextCache(t *testing.T) {
+	history, err := gollem.NewHistoryBuilder().
+		User("Read this long document").
+		Assistant("I have read it").
+		Build()
+	gt.NoError(t, err)
+
+	// newAPIClient returns a client whose GenerateContent fails with missing for calls with
+	// the first cache
+	newAPIClient := func(missing error) *apiClientMock {
+		client := &apiClientMock{
+			DeleteCachedContentFunc: func(ctx context.Context, name string) error {
+				return nil
+			},
+			GenerateContentFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+				if missing != nil && config.CachedContent == "cachedContents/1" {
+					return nil, missing
+				}
+				return &genai.GenerateContentResponse{
+					Candidates: []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: "ok"}}}}},
+				}, nil
+			},
+		}
+		client.CreateCachedContentFunc = func(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+			return &genai.CachedContent{Name: fmt.Sprintf("cachedContents/%d", len(client.CreateCachedContentCalls()))}, nil
+		}
+		return client
+	}
+	newSession := func(t *testing.T, client *apiClientMock, options ...gollem.SessionOption) *gemini.Session {
+		options = append(options, gollem.WithSessionHistory(history), gollem.WithSessionSystemPrompt("You are a reviewer"))
+		session, err := gemini.NewSessionWithAPIClient(client, gollem.NewSessionConfig(options...), "gemini-2.5-flash")
+		gt.NoError(t, err)
+		gemini.SetSessionConfig(session, &genai.GenerateContentConfig{
+			SystemInstruction: &genai.Content{Parts: []*genai.Part{{Text: "You are a reviewer"}}},
+		})
+		gemini.SetSessionContextCache(session, time.Hour)
+		return session
+	}
+	newContext := func() (context.Context, *trace.Recorder) {
+		rec := trace.New()
+		return rec.StartAgentExecute(trace.WithHandler(context.Background(), rec)), rec
+	}
+
+	t.Run("calls send contents after the cache", func(t *testing.T) {
+		client := newAPIClient(nil)
+		session := newSession(t, client)
+
+		_, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("Summarize it")})
+		gt.NoError(t, err)
+		_, err = session.Generate(t.Context(), []gollem.Input{gollem.Text("Shorter")})
+		gt.NoError(t, err)
+
+		creates := client.CreateCachedContentCalls()
+		gt.A(t, creates).Length(1)
+		gt.A(t, creates[0].Config.Contents).Length(2)
+		gt.Equal(t, "You are a reviewer", creates[0].Config.SystemInstruction.Parts[0].Text)
+
+		calls := client.GenerateContentCalls()
+		gt.A(t, calls).Length(2)
+		gt.Equal(t, "cachedContents/1", calls[0].Config.CachedContent)
+		gt.Nil(t, calls[0].Config.SystemInstruction)
+		gt.A(t, calls[0].Contents).Length(1)
+		gt.A(t, calls[1].Contents).Length(3)
+	})
+
+	t.Run("cache not found is re-synced", func(t *testing.T) {
+		client := newAPIClient(genai.APIError{Code: 404, Status: "NOT_FOUND", Message: "CachedContent not found"})
+		session := newSession(t, client)
+
+		ctx, rec := newContext()
+		resp, err := session.Generate(ctx, []gollem.Input{gollem.Text("Summarize it")})
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"ok"}, resp.Texts)
+
+		gt.A(t, client.CreateCachedContentCalls()).Length(2)
+		gt.A(t, client.DeleteCachedContentCalls()).Length(0)
+		calls := client.GenerateContentCalls()
+		gt.A(t, calls).Length(2)
+		gt.Equal(t, "cachedContents/2", calls[1].Config.CachedContent)
+
+		events := resyncEvents(rec.Trace().RootSpan)
+		gt.A(t, events).Length(1)
+		gt.Equal(t, gollem.SessionResyncNotFound, events[0].Reason)
+		gt.Equal(t, 2, events[0].Messages)
+	})
+
+	t.Run("stream re-syncs cache not found", func(t *testing.T) {
+		client := newAPIClient(nil)
+		client.GenerateContentStreamFunc = func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) <-chan gemini.StreamResponse {
+			ch := make(chan gemini.StreamResponse, 1)
+			if config.CachedContent == "cachedContents/1" {
+				ch <- gemini.StreamResponse{Err: genai.APIError{Code: 400, Status: "INVALID_ARGUMENT", Message: "Cache content 1 is expired"}}
+			} else {
+				ch <- gemini.StreamResponse{Resp: &genai.GenerateContentResponse{
+					Candidates: []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: "ok"}}}}},
+				}}
+			}
+			close(ch)
+			return ch
+		}
+		session := newSession(t, client)
+
+		ctx, rec := newContext()
+		stream, err := session.Stream(ctx, []gollem.Input{gollem.Text("Summarize it")})
+		gt.NoError(t, err)
+		var texts []string
+		for resp := range stream {
+			texts = append(texts, resp.Texts...)
+		}
+		gt.Equal(t, []string{"ok"}, texts)
+
+		calls := client.GenerateContentStreamCalls()
+		gt.A(t, calls).Length(2)
+		gt.Equal(t, "cachedContents/2", calls[1].Config.CachedContent)
+		events := resyncEvents(rec.Trace().RootSpan)
+		gt.A(t, events).Length(1)
+		gt.Equal(t, gollem.SessionResyncExpired, events[0].Reason)
+	})
+
+	t.Run("other errors are returned", func(t *testing.T) {
+		client := newAPIClient(&genai.APIError{Code: 500, Status: "INTERNAL", Message: "internal error"})
+		session := newSession(t, client)
+
+		_, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("Summarize it")})
+		gt.Error(t, err)
+		gt.A(t, client.CreateCachedContentCalls()).Length(1)
+	})
+
+	t.Run("diverged history is re-synced", func(t *testing.T) {
+		client := newAPIClient(nil)
+		compacted := false
+		session := newSession(t, client, gollem.WithSessionContentBlockMiddleware(func(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
+			return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+				if compacted {
+					summary, err := gollem.NewHistoryBuilder().User("Summary of the conversation").Build()
+					if err != nil {
+						return nil, err
+					}
+					req.History = summary
+				}
+				return next(ctx, req)
+			}
+		}))
+
+		_, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("Summarize it")})
+		gt.NoError(t, err)
+
+		compacted = true
+		ctx, rec := newContext()
+		_, err = session.Generate(ctx, []gollem.Input{gollem.Text("Continue")})
+		gt.NoError(t, err)
+
+		gt.A(t, client.CreateCachedContentCalls()).Length(2)
+		deletes := client.DeleteCachedContentCalls()
+		gt.A(t, deletes).Length(1)
+		gt.Equal(t, "cachedContents/1", deletes[0].Name)
+		calls := client.GenerateContentCalls()
+		gt.Equal(t, "cachedContents/2", calls[1].Config.CachedContent)
+		gt.A(t, client.CreateCachedContentCalls()[1].Config.Contents).Length(1)
+
+		events := resyncEvents(rec.Trace().RootSpan)
+		gt.A(t, events).Length(1)
+		gt.Equal(t, gollem.SessionResyncDiverged, events[0].Reason)
+	})
+
+	t.Run("failure of creation falls back to the whole history", func(t *testing.T) {
+		client := newAPIClient(nil)
+		client.CreateCachedContentFunc = func(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+			return nil, &genai.APIError{Code: 400, Status: "INVALID_ARGUMENT", Message: "The minimum token count to start caching is 1024"}
+		}
+		session := newSession(t, client)
+
+		_, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("Summarize it")})
+		gt.NoError(t, err)
+		_, err = session.Generate(t.Context(), []gollem.Input{gollem.Text("Shorter")})
+		gt.NoError(t, err)
+
+		// Creation is tried again when the history doubled
+		gt.A(t, client.CreateCachedContentCalls()).Length(2)
+		calls := client.GenerateContentCalls()
+		gt.Equal(t, "", calls[0].Config.CachedContent)
+		gt.A(t, calls[0].Contents).Length(3)
+		gt.Equal(t, "You are a reviewer", calls[0].Config.SystemInstruction.Parts[0].Text)
+	})
+}
@@ -2,6 +2,7 @@ package gemini
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
@@ -157,6 +158,9 @@ func convertGeminiPart(part *genai.Part) (gollem.MessageContent, error) {
 		if part.InlineData.MIMEType == "application/pdf" {
 			return gollem.NewPDFContent(part.InlineData.Data, "")
 		}
+		if !strings.HasPrefix(part.InlineData.MIMEType, "image/") {
+			return gollem.NewFileContent(part.InlineData.MIMEType, "", part.InlineData.Data)
+		}
 		return gollem.NewImageContent(
 			part.InlineData.MIMEType,
 			part.InlineData.Data,
@@ -167,6 +171,9 @@ func convertGeminiPart(part *genai.Part) (gollem.MessageContent, error) {
 
 	// File data
 	if part.FileData != nil {
+		if part.FileData.MIMEType == "application/pdf" {
+			return gollem.NewPDFContent(nil, part.FileData.FileURI)
+		}
 		// Gemini uses file URIs, store as URL
 		return gollem.NewImageContent(
 			part.FileData.MIMEType,
@@ -352,6 +359,13 @@ func convertContentToGemini(content gollem.MessageContent) (*genai.Part, error)
 		}
 		return nil, goerr.Wrap(convert.ErrInvalidMessageFormat, "PDF has neither data nor URL")
 
+	case gollem.MessageContentTypeFile:
+		file, err := content.GetFileContent()
+		if err != nil {
+			return nil, err
+		}
+		return newFilePart(file.MediaType, file.Data)
+
 	case gollem.MessageContentTypeToolCall:
 		toolCall, err := content.GetToolCallContent()
 		if err != nil {
@@ -403,3 +417,21 @@ func NewHistory(contents []*genai.Content) (*gollem.History, error) {
 		Messages: commonMessages,
 	}, nil
 }
+
+// newFilePart creates an inline data part of a file. Gemini reads PDFs and text files; text
+// files of a MIME type other than text/* are sent as text/plain.
+func newFilePart(mediaType string, data []byte) (*genai.Part, error) {
+	switch {
+	case mediaType == "application/pdf", strings.HasPrefix(mediaType, "text/"):
+	case gollem.IsTextMimeType(mediaType):
+		mediaType = "text/plain"
+	default:
+		return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "file type is not supported by Gemini", goerr.V("mime_type", mediaType))
+	}
+	return &genai.Part{
+		InlineData: &genai.Blob{
+			MIMEType: mediaType,
+			Data:     data,
+		},
+	}, nil
+}
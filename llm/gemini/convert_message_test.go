@@ -156,6 +156,19 @@ func TestGeminiMessageRoundTrip(t *testing.T) {
 		},
 	}))
 
+	t.Run("text file inline data", runTest(testCase{
+		name: "text file inline data",
+		contents: []*genai.Content{
+			{
+				Role: "user",
+				Parts: []*genai.Part{
+					{Text: "Summarize this"},
+					{InlineData: &genai.Blob{MIMEType: "text/csv", Data: []byte("name,age\nalice,30")}},
+				},
+			},
+		},
+	}))
+
 	t.Run("thought signature on function call", runTest(testCase{
 		name: "thought signature on function call",
 		contents: []*genai.Content{
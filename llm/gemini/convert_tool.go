@@ -123,3 +123,20 @@ func getGeminiType(paramType gollem.ParameterType) genai.Type {
 		return genai.TypeString
 	}
 }
+
+// convertToolChoice converts gollem.ToolChoice to Gemini function calling config.
+func convertToolChoice(choice gollem.ToolChoice) *genai.FunctionCallingConfig {
+	switch choice.Mode {
+	case gollem.ToolChoiceModeRequired:
+		return &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeAny}
+	case gollem.ToolChoiceModeNone:
+		return &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeNone}
+	case gollem.ToolChoiceModeTool:
+		return &genai.FunctionCallingConfig{
+			Mode:                 genai.FunctionCallingConfigModeAny,
+			AllowedFunctionNames: []string{choice.Name},
+		}
+	default:
+		return &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeAuto}
+	}
+}
@@ -494,3 +494,13 @@ func TestNestedObjectRequiredField(t *testing.T) {
 
 	gt.Value(t, userParam.Required).Equal([]string{})
 }
+
+func TestConvertToolChoice(t *testing.T) {
+	gt.Equal(t, genai.FunctionCallingConfigModeAuto, gemini.ConvertToolChoice(gollem.ToolChoiceAuto()).Mode)
+	gt.Equal(t, genai.FunctionCallingConfigModeAny, gemini.ConvertToolChoice(gollem.ToolChoiceRequired()).Mode)
+	gt.Equal(t, genai.FunctionCallingConfigModeNone, gemini.ConvertToolChoice(gollem.ToolChoiceNone()).Mode)
+
+	cfg := gemini.ConvertToolChoice(gollem.ToolChoiceTool("search"))
+	gt.Equal(t, genai.FunctionCallingConfigModeAny, cfg.Mode)
+	gt.Equal(t, []string{"search"}, cfg.AllowedFunctionNames)
+}
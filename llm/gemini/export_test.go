@@ -1,6 +1,9 @@
 package gemini
 
 import (
+	"log/slog"
+	"time"
+
 	"github.com/m-mizutani/gollem"
 	"google.golang.org/genai"
 )
@@ -9,8 +12,12 @@ import (
 var (
 	ConvertTool              = convertTool
 	ConvertParameterToSchema = convertParameterToSchema
+	ConvertToolChoice        = convertToolChoice
 	TokenLimitErrorOptions   = tokenLimitErrorOptions
 	ContentsToTraceMessages  = contentsToTraceMessages
+
+	DowngradeFunctionDeclaration = downgradeFunctionDeclaration
+	ConvertFunctionResponseData  = convertFunctionResponseData
 )
 
 // GetGenerationConfig returns the generationConfig for testing
@@ -21,6 +28,8 @@ func (c *Client) GetGenerationConfig() *genai.GenerateContentConfig {
 // Export for testing
 type APIClient = apiClient
 
+type SchemaDowngrade = schemaDowngrade
+
 // NewSessionWithAPIClient creates a new session with a custom API client for testing
 func NewSessionWithAPIClient(client apiClient, cfg gollem.SessionConfig, model string) (*Session, error) {
 	// Initialize historyContents from config
@@ -42,6 +51,7 @@ func NewSessionWithAPIClient(client apiClient, cfg gollem.SessionConfig, model s
 		config:          config,
 		historyContents: historyContents,
 		cfg:             cfg,
+		logger:          slog.New(slog.DiscardHandler),
 	}, nil
 }
 
@@ -64,3 +74,8 @@ func SetSessionConfig(s *Session, config *genai.GenerateContentConfig) {
 func SetSessionCfg(s *Session, cfg gollem.SessionConfig) {
 	s.cfg = cfg
 }
+
+// SetSessionContextCache enables the context cache of the session for testing
+func SetSessionContextCache(s *Session, ttl time.Duration) {
+	s.cache = newContextCache(ttl)
+}
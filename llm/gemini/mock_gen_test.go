@@ -19,6 +19,12 @@ import (
 //			CountTokensFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
 //				panic("mock out the CountTokens method")
 //			},
+//			CreateCachedContentFunc: func(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+//				panic("mock out the CreateCachedContent method")
+//			},
+//			DeleteCachedContentFunc: func(ctx context.Context, name string) error {
+//				panic("mock out the DeleteCachedContent method")
+//			},
 //			GenerateContentFunc: func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
 //				panic("mock out the GenerateContent method")
 //			},
@@ -35,6 +41,12 @@ type apiClientMock struct {
 	// CountTokensFunc mocks the CountTokens method.
 	CountTokensFunc func(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error)
 
+	// CreateCachedContentFunc mocks the CreateCachedContent method.
+	CreateCachedContentFunc func(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error)
+
+	// DeleteCachedContentFunc mocks the DeleteCachedContent method.
+	DeleteCachedContentFunc func(ctx context.Context, name string) error
+
 	// GenerateContentFunc mocks the GenerateContent method.
 	GenerateContentFunc func(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error)
 
@@ -54,6 +66,22 @@ type apiClientMock struct {
 			// Config is the config argument value.
 			Config *genai.CountTokensConfig
 		}
+		// CreateCachedContent holds details about calls to the CreateCachedContent method.
+		CreateCachedContent []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Model is the model argument value.
+			Model string
+			// Config is the config argument value.
+			Config *genai.CreateCachedContentConfig
+		}
+		// DeleteCachedContent holds details about calls to the DeleteCachedContent method.
+		DeleteCachedContent []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Name is the name argument value.
+			Name string
+		}
 		// GenerateContent holds details about calls to the GenerateContent method.
 		GenerateContent []struct {
 			// Ctx is the ctx argument value.
@@ -78,6 +106,8 @@ type apiClientMock struct {
 		}
 	}
 	lockCountTokens           sync.RWMutex
+	lockCreateCachedContent   sync.RWMutex
+	lockDeleteCachedContent   sync.RWMutex
 	lockGenerateContent       sync.RWMutex
 	lockGenerateContentStream sync.RWMutex
 }
@@ -126,6 +156,82 @@ func (mock *apiClientMock) CountTokensCalls() []struct {
 	return calls
 }
 
+// CreateCachedContent calls CreateCachedContentFunc.
+func (mock *apiClientMock) CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	if mock.CreateCachedContentFunc == nil {
+		panic("apiClientMock.CreateCachedContentFunc: method is nil but apiClient.CreateCachedContent was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Model  string
+		Config *genai.CreateCachedContentConfig
+	}{
+		Ctx:    ctx,
+		Model:  model,
+		Config: config,
+	}
+	mock.lockCreateCachedContent.Lock()
+	mock.calls.CreateCachedContent = append(mock.calls.CreateCachedContent, callInfo)
+	mock.lockCreateCachedContent.Unlock()
+	return mock.CreateCachedContentFunc(ctx, model, config)
+}
+
+// CreateCachedContentCalls gets all the calls that were made to CreateCachedContent.
+// Check the length with:
+//
+//	len(mockedapiClient.CreateCachedContentCalls())
+func (mock *apiClientMock) CreateCachedContentCalls() []struct {
+	Ctx    context.Context
+	Model  string
+	Config *genai.CreateCachedContentConfig
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Model  string
+		Config *genai.CreateCachedContentConfig
+	}
+	mock.lockCreateCachedContent.RLock()
+	calls = mock.calls.CreateCachedContent
+	mock.lockCreateCachedContent.RUnlock()
+	return calls
+}
+
+// DeleteCachedContent calls DeleteCachedContentFunc.
+func (mock *apiClientMock) DeleteCachedContent(ctx context.Context, name string) error {
+	if mock.DeleteCachedContentFunc == nil {
+		panic("apiClientMock.DeleteCachedContentFunc: method is nil but apiClient.DeleteCachedContent was just called")
+	}
+	callInfo := struct {
+		Ctx  context.Context
+		Name string
+	}{
+		Ctx:  ctx,
+		Name: name,
+	}
+	mock.lockDeleteCachedContent.Lock()
+	mock.calls.DeleteCachedContent = append(mock.calls.DeleteCachedContent, callInfo)
+	mock.lockDeleteCachedContent.Unlock()
+	return mock.DeleteCachedContentFunc(ctx, name)
+}
+
+// DeleteCachedContentCalls gets all the calls that were made to DeleteCachedContent.
+// Check the length with:
+//
+//	len(mockedapiClient.DeleteCachedContentCalls())
+func (mock *apiClientMock) DeleteCachedContentCalls() []struct {
+	Ctx  context.Context
+	Name string
+} {
+	var calls []struct {
+		Ctx  context.Context
+		Name string
+	}
+	mock.lockDeleteCachedContent.RLock()
+	calls = mock.calls.DeleteCachedContent
+	mock.lockDeleteCachedContent.RUnlock()
+	return calls
+}
+
 // GenerateContent calls GenerateContentFunc.
 func (mock *apiClientMock) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
 	if mock.GenerateContentFunc == nil {
@@ -0,0 +1,132 @@
+package gemini
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// schemaDowngrade is a change made to a function declaration schema so that Gemini accepts it.
+type schemaDowngrade struct {
+	// Path is the location of the changed schema, e.g. "option.tags[]".
+	Path   string
+	Reason string
+}
+
+// downgradeFunctionDeclaration rewrites schema constructs of decl that Gemini rejects into
+// supported equivalents, and returns the changes made. The rewrites keep the arguments
+// compatible with the original ToolSpec:
+//
+//   - enum on a non-string type is moved to the description, because Gemini allows enum only
+//     for strings.
+//   - format that Gemini does not support for the type, e.g. "email", is moved to the
+//     description.
+//   - a nested object without properties and an array without items are replaced by a string
+//     of JSON. gollem decodes such strings back by ToolSpec.NormalizeArgs before Tool.Run.
+//   - required names that are not defined in properties are removed.
+//
+// The top-level parameters of a tool without parameters are kept as an empty object, which
+// Gemini accepts.
+func downgradeFunctionDeclaration(decl *genai.FunctionDeclaration) []schemaDowngrade {
+	if decl.Parameters == nil {
+		return nil
+	}
+
+	var downgrades []schemaDowngrade
+	for _, name := range slices.Sorted(maps.Keys(decl.Parameters.Properties)) {
+		downgrades = append(downgrades, downgradeSchema(decl.Parameters.Properties[name], name)...)
+	}
+	downgrades = append(downgrades, removeUndefinedRequired(decl.Parameters, "")...)
+	return downgrades
+}
+
+// supportedFormats are the formats Gemini accepts for each type.
+var supportedFormats = map[genai.Type][]string{
+	genai.TypeString:  {"enum", "date-time"},
+	genai.TypeNumber:  {"float", "double"},
+	genai.TypeInteger: {"int32", "int64"},
+}
+
+func downgradeSchema(schema *genai.Schema, path string) []schemaDowngrade {
+	if schema == nil {
+		return nil
+	}
+
+	var downgrades []schemaDowngrade
+	add := func(format string, args ...any) {
+		downgrades = append(downgrades, schemaDowngrade{Path: path, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if len(schema.Enum) > 0 && schema.Type != genai.TypeString {
+		schema.Description = appendSentence(schema.Description, "Allowed values: "+strings.Join(schema.Enum, ", ")+".")
+		schema.Enum = nil
+		add("enum is not supported for %s type, moved to description", schema.Type)
+	}
+
+	if schema.Format != "" && !slices.Contains(supportedFormats[schema.Type], schema.Format) {
+		schema.Description = appendSentence(schema.Description, "Format: "+schema.Format+".")
+		add("format %q is not supported for %s type, moved to description", schema.Format, schema.Type)
+		schema.Format = ""
+	}
+
+	switch schema.Type {
+	case genai.TypeObject:
+		if len(schema.Properties) == 0 {
+			toJSONString(schema, "object")
+			add("object without properties is not supported, replaced by JSON string")
+			return downgrades
+		}
+		for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+			downgrades = append(downgrades, downgradeSchema(schema.Properties[name], path+"."+name)...)
+		}
+		downgrades = append(downgrades, removeUndefinedRequired(schema, path)...)
+
+	case genai.TypeArray:
+		if schema.Items == nil {
+			toJSONString(schema, "array")
+			add("array without items is not supported, replaced by JSON string")
+			return downgrades
+		}
+		downgrades = append(downgrades, downgradeSchema(schema.Items, path+"[]")...)
+	}
+
+	return downgrades
+}
+
+// toJSONString replaces schema by a string schema that holds a JSON-encoded value of kind.
+func toJSONString(schema *genai.Schema, kind string) {
+	*schema = genai.Schema{
+		Type:        genai.TypeString,
+		Title:       schema.Title,
+		Description: appendSentence(schema.Description, "JSON-encoded "+kind+"."),
+	}
+}
+
+func removeUndefinedRequired(schema *genai.Schema, path string) []schemaDowngrade {
+	var downgrades []schemaDowngrade
+	required := schema.Required[:0:0]
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			downgrades = append(downgrades, schemaDowngrade{
+				Path:   path,
+				Reason: fmt.Sprintf("required property %q is not defined, removed", name),
+			})
+			continue
+		}
+		required = append(required, name)
+	}
+	if len(downgrades) > 0 {
+		schema.Required = required
+	}
+	return downgrades
+}
+
+func appendSentence(text, sentence string) string {
+	if text == "" {
+		return sentence
+	}
+	return strings.TrimRight(text, " ") + " " + sentence
+}
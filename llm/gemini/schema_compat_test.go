@@ -0,0 +1,128 @@
+package gemini_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/gemini"
+	"github.com/m-mizutani/gt"
+	"google.golang.org/genai"
+)
+
+func TestDowngradeFunctionDeclaration(t *testing.T) {
+	t.Run("supported schema is not changed", func(t *testing.T) {
+		decl := gemini.ConvertTool(&complexTool{})
+		before, err := json.Marshal(decl)
+		gt.NoError(t, err)
+		gt.A(t, gemini.DowngradeFunctionDeclaration(decl)).Length(0)
+		after, err := json.Marshal(decl)
+		gt.NoError(t, err)
+		gt.Equal(t, string(before), string(after))
+	})
+
+	t.Run("parameterless tool is not changed", func(t *testing.T) {
+		decl := gemini.ConvertTool(&parameterlessTool{})
+		gt.A(t, gemini.DowngradeFunctionDeclaration(decl)).Length(0)
+		gt.Equal(t, genai.TypeObject, decl.Parameters.Type)
+	})
+
+	t.Run("enum on non-string type is moved to description", func(t *testing.T) {
+		decl := &genai.FunctionDeclaration{
+			Name: "test",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"level": {Type: genai.TypeInteger, Description: "Log level", Enum: []string{"1", "2"}},
+					"mode":  {Type: genai.TypeString, Enum: []string{"a", "b"}},
+				},
+			},
+		}
+		downgrades := gemini.DowngradeFunctionDeclaration(decl)
+		gt.A(t, downgrades).Length(1).At(0, func(t testing.TB, v gemini.SchemaDowngrade) {
+			gt.Equal(t, "level", v.Path)
+		})
+		gt.Nil(t, decl.Parameters.Properties["level"].Enum)
+		gt.Equal(t, "Log level Allowed values: 1, 2.", decl.Parameters.Properties["level"].Description)
+		gt.Equal(t, []string{"a", "b"}, decl.Parameters.Properties["mode"].Enum)
+	})
+
+	t.Run("unsupported format is moved to description", func(t *testing.T) {
+		decl := &genai.FunctionDeclaration{
+			Name: "test",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"email": {Type: genai.TypeString, Description: "Address", Format: "email"},
+					"since": {Type: genai.TypeString, Format: "date-time"},
+					"count": {Type: genai.TypeInteger, Format: "int64"},
+				},
+			},
+		}
+		downgrades := gemini.DowngradeFunctionDeclaration(decl)
+		gt.A(t, downgrades).Length(1).At(0, func(t testing.TB, v gemini.SchemaDowngrade) {
+			gt.Equal(t, "email", v.Path)
+			gt.S(t, v.Reason).Contains(`"email"`)
+		})
+		gt.Equal(t, &genai.Schema{Type: genai.TypeString, Description: "Address Format: email."}, decl.Parameters.Properties["email"])
+		gt.Equal(t, "date-time", decl.Parameters.Properties["since"].Format)
+		gt.Equal(t, "int64", decl.Parameters.Properties["count"].Format)
+	})
+
+	t.Run("nested object without properties and array without items become JSON string", func(t *testing.T) {
+		decl := &genai.FunctionDeclaration{
+			Name: "test",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"option": {
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							"meta": {Type: genai.TypeObject, Description: "Metadata", Required: []string{}},
+							"tags": {Type: genai.TypeArray, MinItems: new(int64(1))},
+						},
+						Required: []string{"meta", "missing"},
+					},
+				},
+				Required: []string{"option"},
+			},
+		}
+		downgrades := gemini.DowngradeFunctionDeclaration(decl)
+
+		paths := make([]string, len(downgrades))
+		for i, d := range downgrades {
+			paths[i] = d.Path
+		}
+		gt.Equal(t, []string{"option.meta", "option.tags", "option"}, paths)
+
+		option := decl.Parameters.Properties["option"]
+		gt.Equal(t, &genai.Schema{Type: genai.TypeString, Description: "Metadata JSON-encoded object."}, option.Properties["meta"])
+		gt.Equal(t, &genai.Schema{Type: genai.TypeString, Description: "JSON-encoded array."}, option.Properties["tags"])
+		gt.Equal(t, []string{"meta"}, option.Required)
+	})
+
+	t.Run("downgraded arguments are restored by NormalizeArgs", func(t *testing.T) {
+		spec := gollem.ToolSpec{
+			Name: "test",
+			Parameters: map[string]*gollem.Parameter{
+				"meta": {Type: gollem.TypeObject, Properties: map[string]*gollem.Parameter{}},
+				"tags": {Type: gollem.TypeArray},
+			},
+		}
+		decl := &genai.FunctionDeclaration{
+			Name: "test",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"meta": gemini.ConvertParameterToSchema(spec.Parameters["meta"]),
+					"tags": gemini.ConvertParameterToSchema(spec.Parameters["tags"]),
+				},
+			},
+		}
+		gt.A(t, gemini.DowngradeFunctionDeclaration(decl)).Length(2)
+
+		// Gemini returns string values for the downgraded parameters
+		args := spec.NormalizeArgs(map[string]any{"meta": `{"k":"v"}`, "tags": `["x"]`})
+		gt.Equal(t, map[string]any{"meta": map[string]any{"k": "v"}, "tags": []any{"x"}}, args)
+	})
+}
@@ -6,12 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"slices"
 
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/internal/schema"
 	"github.com/m-mizutani/gollem/trace"
-	"github.com/pkoukk/tiktoken-go"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -69,6 +70,27 @@ type Client struct {
 
 	// contentType is the type of content to be generated.
 	contentType gollem.ContentType
+
+	// parallelToolCalls sets parallel_tool_calls of requests with tools if not nil.
+	parallelToolCalls *bool
+
+	// strictTools enables strict mode of function definitions.
+	strictTools bool
+
+	// logprobs requests log probabilities of the output tokens.
+	logprobs bool
+
+	// httpMiddlewares wrap the HTTP round trip of API calls.
+	httpMiddlewares []gollem.HTTPMiddleware
+
+	// rateLimiters are waited for before each API call.
+	rateLimiters []gollem.RateLimiter
+
+	// quota tracks the rate limit headers of responses and holds calls back near exhaustion.
+	quota *gollem.QuotaTracker
+
+	// tokenizer counts tokens of CountToken. If nil, the Tokenizer of the model is used.
+	tokenizer gollem.Tokenizer
 }
 
 const (
@@ -180,6 +202,87 @@ func WithBaseURL(url string) Option {
 	}
 }
 
+// WithParallelToolCalls sets whether the model may call multiple tools in one response
+// (parallel_tool_calls). It is sent only for requests with tools. If not set, the OpenAI
+// default (enabled) is used.
+func WithParallelToolCalls(enabled bool) Option {
+	return func(c *Client) {
+		c.parallelToolCalls = &enabled
+	}
+}
+
+// WithStrictTools enables strict mode (strict: true) of function definitions, so that OpenAI
+// guarantees tool call arguments match the schema. The schema is still derived from
+// gollem.ToolSpec; optional parameters are declared as nullable because strict mode requires
+// all properties, and a tool whose parameters cannot be expressed in strict mode is sent in
+// non-strict mode.
+func WithStrictTools() Option {
+	return func(c *Client) {
+		c.strictTools = true
+	}
+}
+
+// WithLogprobs requests log probabilities of the output tokens (logprobs), so that responses of
+// Generate have gollem.Response.Logprobs, e.g. for gollem.LogprobConfidence. Responses of
+// Stream don't have them.
+func WithLogprobs() Option {
+	return func(c *Client) {
+		c.logprobs = true
+	}
+}
+
+// WithHTTPMiddleware adds middlewares around the HTTP round trip of API calls, e.g. to inject
+// headers or sign requests for an API gateway. The middlewares are applied in the order they
+// are provided.
+func WithHTTPMiddleware(middlewares ...gollem.HTTPMiddleware) Option {
+	return func(c *Client) {
+		c.httpMiddlewares = append(c.httpMiddlewares, middlewares...)
+	}
+}
+
+// WithRateLimiter adds rate limiters waited for before each API call of the client's sessions,
+// e.g. *rate.Limiter of golang.org/x/time/rate. A limiter consumes 1 per call for a request
+// limit, or the estimated input tokens if wrapped by gollem.TokenRateLimiter for a token limit.
+// Share the limiters among clients of the same account to respect its limits.
+func WithRateLimiter(limiters ...gollem.RateLimiter) Option {
+	return func(c *Client) {
+		c.rateLimiters = append(c.rateLimiters, limiters...)
+	}
+}
+
+// WithQuotaTracker sets the QuotaTracker of the client, e.g. to share the quota of an account
+// among clients or to change its reserve. By default, each client has its own tracker.
+func WithQuotaTracker(tracker *gollem.QuotaTracker) Option {
+	return func(c *Client) {
+		c.quota = tracker
+	}
+}
+
+// WithTokenizer sets the tokenizer of CountToken of the client's sessions, e.g. to count tokens
+// offline. By default, the tiktoken Tokenizer of the model by NewTokenizer is used.
+func WithTokenizer(tokenizer gollem.Tokenizer) Option {
+	return func(c *Client) {
+		c.tokenizer = tokenizer
+	}
+}
+
+// QuotaStatus returns the quota of the account reported by the rate limit headers of the latest
+// API responses, e.g. for dashboards.
+func (c *Client) QuotaStatus() gollem.QuotaStatus {
+	if c.quota == nil {
+		return gollem.QuotaStatus{}
+	}
+	return c.quota.Status()
+}
+
+// sessionRateLimiters returns the rate limiters of sessions, including the quota tracker.
+func (c *Client) sessionRateLimiters() []gollem.RateLimiter {
+	if c.quota == nil {
+		return c.rateLimiters
+	}
+	return append(slices.Clip(c.rateLimiters), c.quota)
+}
+
 // New creates a new client for the OpenAI API.
 // It requires an API key and can be configured with additional options.
 func New(ctx context.Context, apiKey string, options ...Option) (*Client, error) {
@@ -205,6 +308,15 @@ func New(ctx context.Context, apiKey string, options ...Option) (*Client, error)
 		config.BaseURL = client.baseURL
 	}
 
+	if client.quota == nil {
+		client.quota = gollem.NewQuotaTracker()
+	}
+	// The tracker sees responses as they are received
+	middlewares := append(slices.Clip(client.httpMiddlewares), client.quota.HTTPMiddleware())
+	config.HTTPClient = &http.Client{
+		Transport: gollem.NewHTTPTransport(nil, middlewares...),
+	}
+
 	openaiClient := openai.NewClientWithConfig(config)
 	client.client = openaiClient
 
@@ -233,6 +345,21 @@ type Session struct {
 
 	// strictMode enables OpenAI's strict schema adherence (default: false)
 	strictMode bool
+
+	// parallelToolCalls sets parallel_tool_calls of requests with tools if not nil.
+	parallelToolCalls *bool
+
+	// logprobs requests log probabilities of the output tokens of Generate.
+	logprobs bool
+
+	rateLimiters []gollem.RateLimiter
+
+	tokenizer gollem.Tokenizer
+}
+
+// Model returns the default model of the client.
+func (c *Client) Model() string {
+	return c.defaultModel
 }
 
 // NewSession creates a new session for the OpenAI API.
@@ -243,7 +370,11 @@ func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption
 	// Convert gollem.Tool to openai.Tool
 	openaiTools := make([]openai.Tool, len(cfg.Tools()))
 	for i, tool := range cfg.Tools() {
-		openaiTools[i] = convertTool(tool)
+		if c.strictTools {
+			openaiTools[i] = convertStrictTool(tool)
+		} else {
+			openaiTools[i] = convertTool(tool)
+		}
 	}
 
 	// Initialize history from config (convert to OpenAI native format)
@@ -257,12 +388,16 @@ func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption
 	}
 
 	session := &Session{
-		apiClient:       &realAPIClient{client: c.client},
-		defaultModel:    c.defaultModel,
-		tools:           openaiTools,
-		params:          c.params,
-		historyMessages: historyMessages,
-		cfg:             cfg,
+		apiClient:         &realAPIClient{client: c.client},
+		defaultModel:      c.defaultModel,
+		tools:             openaiTools,
+		params:            c.params,
+		historyMessages:   historyMessages,
+		cfg:               cfg,
+		parallelToolCalls: c.parallelToolCalls,
+		logprobs:          c.logprobs,
+		rateLimiters:      c.sessionRateLimiters(),
+		tokenizer:         c.tokenizer,
 	}
 
 	return session, nil
@@ -336,6 +471,17 @@ func (s *Session) convertInputsToMessages(input ...gollem.Input) ([]openai.ChatC
 				},
 			})
 
+		case gollem.ImageURL:
+			userContentParts = append(userContentParts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{
+					URL: v.URL(),
+				},
+			})
+
+		case gollem.File:
+			return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "file input is not supported by OpenAI", goerr.V("mime_type", v.MimeType()))
+
 		case gollem.PDF:
 			// OpenAI SDK doesn't have native PDF support; use data URL in image_url field
 			pdfURL := fmt.Sprintf("data:application/pdf;base64,%s", v.Base64())
@@ -355,13 +501,12 @@ func (s *Session) convertInputsToMessages(input ...gollem.Input) ([]openai.ChatC
 				})
 				userContentParts = nil
 			}
-			data, err := json.Marshal(v.Data)
+			response, err := v.EncodeData()
 			if err != nil {
 				return nil, goerr.Wrap(err, "failed to marshal function response")
 			}
-			response := string(data)
 			if v.Error != nil {
-				response = fmt.Sprintf(`Error message: %+v`, v.Error)
+				response = v.EncodeError()
 			}
 
 			newMessages = append(newMessages, openai.ChatCompletionMessage{
@@ -430,6 +575,11 @@ func (s *Session) createRequest(stream bool) (openai.ChatCompletionRequest, erro
 		req.Verbosity = s.params.Verbosity
 	}
 
+	// parallel_tool_calls is rejected for requests without tools
+	if s.parallelToolCalls != nil && len(req.Tools) > 0 {
+		req.ParallelToolCalls = *s.parallelToolCalls
+	}
+
 	// Add content type and response schema to the request
 	if s.cfg.ContentType() == gollem.ContentTypeJSON {
 		if s.cfg.ResponseSchema() != nil {
@@ -494,11 +644,17 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 		if err != nil {
 			return nil, err
 		}
+		openaiReq.LogProbs = s.logprobs
 
 		if err := s.applyPerCallOverrides(&openaiReq, opts...); err != nil {
 			return nil, err
 		}
 
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
 		// Start LLM call trace span
 		var openaiTraceData *trace.LLMCallData
 		var llmErr error
@@ -510,7 +666,7 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 		resp, err := s.apiClient.CreateChatCompletion(ctx, openaiReq)
 		if err != nil {
 			llmErr = err
-			opts := tokenLimitErrorOptions(err)
+			opts := apiErrorOptions(err)
 			return nil, goerr.Wrap(err, "failed to create chat completion", opts...)
 		}
 
@@ -524,9 +680,15 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 				FunctionCalls: []*gollem.FunctionCall{},
 				InputToken:    0,
 				OutputToken:   0,
+				Raw:           resp,
 			}, nil
 		}
 
+		if resp.Choices[0].FinishReason == openai.FinishReasonContentFilter {
+			llmErr = goerr.Wrap(gollem.ErrProhibitedContent, "response blocked by content filter")
+			return nil, llmErr
+		}
+
 		response := &gollem.Response{
 			Texts:         make([]string, 0),
 			Thoughts:      make([]string, 0),
@@ -540,6 +702,12 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 			response.Texts = append(response.Texts, message.Content)
 		}
 
+		if logprobs := resp.Choices[0].LogProbs; logprobs != nil {
+			for _, token := range logprobs.Content {
+				response.Logprobs = append(response.Logprobs, token.LogProb)
+			}
+		}
+
 		if message.ReasoningContent != "" {
 			response.Thoughts = append(response.Thoughts, message.ReasoningContent)
 		}
@@ -595,14 +763,13 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 			FunctionCalls: response.FunctionCalls,
 			InputToken:    response.InputToken,
 			OutputToken:   response.OutputToken,
+			Logprobs:      response.Logprobs,
+			Raw:           resp,
 		}, nil
 	}
 
 	// Build middleware chain
-	handler := gollem.ContentBlockHandler(baseHandler)
-	for i := len(s.cfg.ContentBlockMiddlewares()) - 1; i >= 0; i-- {
-		handler = s.cfg.ContentBlockMiddlewares()[i](handler)
-	}
+	handler := s.cfg.ContentBlockChain(baseHandler)
 
 	// Execute middleware chain
 	contentResp, err := handler(ctx, contentReq)
@@ -612,13 +779,17 @@ func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...go
 
 	// Update history after middleware execution (history was already updated in baseHandler)
 	// Convert ContentResponse back to gollem.Response
-	return &gollem.Response{
+	response := &gollem.Response{
 		Texts:         contentResp.Texts,
 		Thoughts:      contentResp.Thoughts,
 		FunctionCalls: contentResp.FunctionCalls,
 		InputToken:    contentResp.InputToken,
 		OutputToken:   contentResp.OutputToken,
-	}, nil
+		Model:         s.defaultModel,
+		Logprobs:      contentResp.Logprobs,
+	}
+	response.SetRaw(contentResp.Raw)
+	return response, nil
 }
 
 // Stream processes the input and generates a response stream with optional per-call overrides.
@@ -666,6 +837,11 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 			return nil, err
 		}
 
+		// Wait for the rate limits of the client before the API call
+		if err := gollem.WaitRateLimits(ctx, s.rateLimiters, req); err != nil {
+			return nil, err
+		}
+
 		// Start LLM call trace span
 		traceHandler := trace.HandlerFrom(ctx)
 		if traceHandler != nil {
@@ -681,7 +857,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 			if traceHandler != nil {
 				traceHandler.EndLLMCall(ctx, nil, err)
 			}
-			opts := tokenLimitErrorOptions(err)
+			opts := apiErrorOptions(err)
 			return nil, goerr.Wrap(err, "failed to create chat completion stream", opts...)
 		}
 
@@ -702,6 +878,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 			var toolCalls []openai.ToolCall
 			var totalInputTokens int
 			var totalOutputTokens int
+			var lastChunk openai.ChatCompletionStreamResponse
 
 			// Process streaming chunks
 			for {
@@ -719,12 +896,13 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 					if err == io.EOF {
 						break
 					}
-					opts := tokenLimitErrorOptions(err)
+					opts := apiErrorOptions(err)
 					responseChan <- &gollem.ContentResponse{
 						Error: goerr.Wrap(err, "failed to receive chat completion stream", opts...),
 					}
 					return
 				}
+				lastChunk = resp
 
 				// Handle token usage if available (comes in final chunk)
 				if resp.Usage != nil {
@@ -746,6 +924,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 						Texts:       []string{delta.Content},
 						InputToken:  totalInputTokens,
 						OutputToken: totalOutputTokens,
+						Raw:         resp,
 					}
 				}
 
@@ -756,11 +935,14 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 						Thoughts:    []string{delta.ReasoningContent},
 						InputToken:  totalInputTokens,
 						OutputToken: totalOutputTokens,
+						Raw:         resp,
 					}
 				}
 
-				// Handle tool calls - accumulate them
+				// Handle tool calls - accumulate them, and send their name and
+				// argument fragments as deltas
 				if delta.ToolCalls != nil {
+					var callDeltas []*gollem.FunctionCallDelta
 					for _, toolCall := range delta.ToolCalls {
 						// Get the index, defaulting to 0 if nil
 						index := 0
@@ -776,6 +958,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 						}
 
 						tc := &toolCalls[index]
+						callDelta := &gollem.FunctionCallDelta{Index: index}
 
 						if toolCall.ID != "" {
 							tc.ID = toolCall.ID
@@ -784,10 +967,26 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 							tc.Type = toolCall.Type
 						}
 						if toolCall.Function.Name != "" {
+							if tc.Function.Name == "" {
+								callDelta.ID = tc.ID
+								callDelta.Name = toolCall.Function.Name
+							}
 							tc.Function.Name = toolCall.Function.Name
 						}
 						if toolCall.Function.Arguments != "" {
 							tc.Function.Arguments += toolCall.Function.Arguments
+							callDelta.Arguments = toolCall.Function.Arguments
+						}
+						if callDelta.Name != "" || callDelta.Arguments != "" {
+							callDeltas = append(callDeltas, callDelta)
+						}
+					}
+					if len(callDeltas) > 0 {
+						responseChan <- &gollem.ContentResponse{
+							FunctionCallDeltas: callDeltas,
+							InputToken:         totalInputTokens,
+							OutputToken:        totalOutputTokens,
+							Raw:                resp,
 						}
 					}
 				}
@@ -827,6 +1026,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 						FunctionCalls: functionCalls,
 						InputToken:    totalInputTokens,
 						OutputToken:   totalOutputTokens,
+						Raw:           lastChunk,
 					}
 				}
 
@@ -893,6 +1093,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 				responseChan <- &gollem.ContentResponse{
 					InputToken:  totalInputTokens,
 					OutputToken: totalOutputTokens,
+					Raw:         lastChunk,
 				}
 			}
 
@@ -903,10 +1104,7 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 	}
 
 	// Build middleware chain
-	handler := gollem.ContentStreamHandler(baseHandler)
-	for i := len(s.cfg.ContentStreamMiddlewares()) - 1; i >= 0; i-- {
-		handler = s.cfg.ContentStreamMiddlewares()[i](handler)
-	}
+	handler := s.cfg.ContentStreamChain(baseHandler)
 
 	// Execute middleware chain
 	streamChan, err := handler(ctx, contentReq)
@@ -929,13 +1127,17 @@ func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...goll
 					Error: streamResp.Error,
 				}
 			} else {
-				responseChan <- &gollem.Response{
-					Texts:         streamResp.Texts,
-					Thoughts:      streamResp.Thoughts,
-					FunctionCalls: streamResp.FunctionCalls,
-					InputToken:    streamResp.InputToken,
-					OutputToken:   streamResp.OutputToken,
+				response := &gollem.Response{
+					Texts:              streamResp.Texts,
+					Thoughts:           streamResp.Thoughts,
+					FunctionCalls:      streamResp.FunctionCalls,
+					FunctionCallDeltas: streamResp.FunctionCallDeltas,
+					InputToken:         streamResp.InputToken,
+					OutputToken:        streamResp.OutputToken,
+					Model:              s.defaultModel,
 				}
+				response.SetRaw(streamResp.Raw)
+				responseChan <- response
 			}
 		}
 	}()
@@ -1049,9 +1251,10 @@ func convertParameterToJSONSchemaWithStrict(param *gollem.Parameter, strict bool
 	return result
 }
 
-// applyPerCallOverrides applies per-call GenerateOption overrides to an API request.
+// applyPerCallOverrides applies the generation defaults of the session and per-call
+// GenerateOption overrides to an API request.
 func (s *Session) applyPerCallOverrides(req *openai.ChatCompletionRequest, opts ...gollem.GenerateOption) error {
-	genCfg := gollem.NewGenerateConfig(opts...)
+	genCfg := gollem.NewGenerateConfig(append(s.cfg.GenerateOptions(), opts...)...)
 	if t := genCfg.Temperature(); t != nil {
 		req.Temperature = float32(*t)
 	}
@@ -1061,6 +1264,12 @@ func (s *Session) applyPerCallOverrides(req *openai.ChatCompletionRequest, opts
 	if m := genCfg.MaxTokens(); m != nil {
 		req.MaxCompletionTokens = *m
 	}
+	if stop := genCfg.StopSequences(); stop != nil {
+		req.Stop = stop
+	}
+	if choice := genCfg.ToolChoice(); choice != nil {
+		req.ToolChoice = convertToolChoice(*choice)
+	}
 	if schema := genCfg.ResponseSchema(); schema != nil {
 		jsonSchema, err := convertResponseSchemaToOpenAI(schema, s.strictMode)
 		if err != nil {
@@ -1084,19 +1293,24 @@ func (s *Session) GenerateStream(ctx context.Context, input ...gollem.Input) (<-
 	return s.Stream(ctx, input)
 }
 
+// StreamContent generates a response stream iterated by gollem.Stream.
+func (s *Session) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return s.Stream(ctx, input, opts...)
+	})
+}
+
 // CountToken calculates the total number of tokens for the given inputs,
 // including system prompt, history messages, and new inputs.
 // This uses tiktoken library for local token counting without API calls.
 func (s *Session) CountToken(ctx context.Context, input ...gollem.Input) (int, error) {
-	// Get tiktoken encoding for the model
-	// If model is not found, try to use a compatible encoding
-	encoding, err := tiktoken.EncodingForModel(s.defaultModel)
-	if err != nil {
-		// Fallback to cl100k_base encoding (used by gpt-4, gpt-3.5-turbo, gpt-4o, gpt-5, etc.)
-		encoding, err = tiktoken.GetEncoding("cl100k_base")
+	tokenizer := s.tokenizer
+	if tokenizer == nil {
+		t, err := NewTokenizer(s.defaultModel)
 		if err != nil {
-			return 0, goerr.Wrap(err, "failed to get encoding")
+			return 0, err
 		}
+		tokenizer = t
 	}
 
 	// Convert inputs to messages without modifying session state
@@ -1118,7 +1332,7 @@ func (s *Session) CountToken(ctx context.Context, input ...gollem.Input) (int, e
 
 	// Add tokens for system prompt if present
 	if s.cfg.SystemPrompt() != "" {
-		totalTokens += len(encoding.Encode(s.cfg.SystemPrompt(), nil, nil))
+		totalTokens += tokenizer.CountTokens(s.cfg.SystemPrompt())
 		totalTokens += 3 // System message formatting tokens
 	}
 
@@ -1137,25 +1351,25 @@ func (s *Session) CountToken(ctx context.Context, input ...gollem.Input) (int, e
 	for _, message := range messages {
 		totalTokens += tokensPerMessage
 		if message.Content != "" {
-			totalTokens += len(encoding.Encode(message.Content, nil, nil))
+			totalTokens += tokenizer.CountTokens(message.Content)
 		}
-		totalTokens += len(encoding.Encode(message.Role, nil, nil))
+		totalTokens += tokenizer.CountTokens(message.Role)
 		if message.Name != "" {
-			totalTokens += len(encoding.Encode(message.Name, nil, nil))
+			totalTokens += tokenizer.CountTokens(message.Name)
 			totalTokens += tokensPerName
 		}
 		// Count tool calls
 		if message.ToolCalls != nil {
 			for _, toolCall := range message.ToolCalls {
-				totalTokens += len(encoding.Encode(toolCall.Function.Name, nil, nil))
-				totalTokens += len(encoding.Encode(toolCall.Function.Arguments, nil, nil))
+				totalTokens += tokenizer.CountTokens(toolCall.Function.Name)
+				totalTokens += tokenizer.CountTokens(toolCall.Function.Arguments)
 			}
 		}
 		// Count multi-content parts
 		if message.MultiContent != nil {
 			for _, part := range message.MultiContent {
 				if part.Type == openai.ChatMessagePartTypeText {
-					totalTokens += len(encoding.Encode(part.Text, nil, nil))
+					totalTokens += tokenizer.CountTokens(part.Text)
 				}
 			}
 		}
@@ -1172,7 +1386,7 @@ func (s *Session) CountToken(ctx context.Context, input ...gollem.Input) (int, e
 			if err != nil {
 				return 0, goerr.Wrap(err, "failed to marshal tool for token counting")
 			}
-			totalTokens += len(encoding.Encode(string(toolJSON), nil, nil))
+			totalTokens += tokenizer.CountTokens(string(toolJSON))
 		}
 	}
 
@@ -1212,6 +1426,26 @@ func tokenLimitErrorOptions(err error) []goerr.Option {
 	return nil
 }
 
+// apiErrorOptions returns goerr.Option to tag an error of the API call by
+// tokenLimitErrorOptions and transientErrorOptions.
+func apiErrorOptions(err error) []goerr.Option {
+	return append(tokenLimitErrorOptions(err), transientErrorOptions(err)...)
+}
+
+// transientErrorOptions returns goerr.Option to tag the error with ErrTagTransient if the
+// status code of the API error is transient, e.g. 429 (rate limit) or 503.
+func transientErrorOptions(err error) []goerr.Option {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && gollem.IsTransientStatus(apiErr.HTTPStatusCode) {
+		return []goerr.Option{goerr.Tag(gollem.ErrTagTransient)}
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) && gollem.IsTransientStatus(reqErr.HTTPStatusCode) {
+		return []goerr.Option{goerr.Tag(gollem.ErrTagTransient)}
+	}
+	return nil
+}
+
 // openaiMessagesToTraceMessages converts OpenAI messages to trace messages.
 func openaiMessagesToTraceMessages(messages []openai.ChatCompletionMessage) []trace.Message {
 	var result []trace.Message
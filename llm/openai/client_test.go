@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -12,6 +14,7 @@ import (
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/openai"
+	"github.com/m-mizutani/gollem/mock"
 	"github.com/m-mizutani/gollem/trace"
 	"github.com/m-mizutani/gt"
 	openaiapi "github.com/sashabaranov/go-openai"
@@ -525,3 +528,313 @@ func TestOpenAITraceRequestMessagesNewTurnOnly(t *testing.T) {
 	// site as Generate, so the Generate test above is structurally
 	// equivalent for the trace-delta invariant.
 }
+
+func TestToolArgsNormalization(t *testing.T) {
+	mockClient := &apiClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openaiapi.ChatCompletionRequest) (openaiapi.ChatCompletionResponse, error) {
+			return openaiapi.ChatCompletionResponse{
+				Choices: []openaiapi.ChatCompletionChoice{
+					{
+						Message: openaiapi.ChatCompletionMessage{
+							Role: openaiapi.ChatMessageRoleAssistant,
+							ToolCalls: []openaiapi.ToolCall{
+								{
+									ID:   "call-1",
+									Type: openaiapi.ToolTypeFunction,
+									Function: openaiapi.FunctionCall{
+										Name:      "counter",
+										Arguments: `{"count":"3","verbose":"false","option":"{\"depth\":\"2\"}"}`,
+									},
+								},
+							},
+						},
+						FinishReason: openaiapi.FinishReasonToolCalls,
+					},
+				},
+			}, nil
+		},
+	}
+	session, err := openai.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "gpt-4o")
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("count")})
+	gt.NoError(t, err)
+	gt.A(t, resp.FunctionCalls).Length(1)
+
+	spec := gollem.ToolSpec{
+		Name: "counter",
+		Parameters: map[string]*gollem.Parameter{
+			"count":   {Type: gollem.TypeInteger, Required: true},
+			"verbose": {Type: gollem.TypeBoolean},
+			"option": {
+				Type:       gollem.TypeObject,
+				Properties: map[string]*gollem.Parameter{"depth": {Type: gollem.TypeInteger}},
+			},
+		},
+	}
+	args := spec.NormalizeArgs(resp.FunctionCalls[0].Arguments)
+	gt.Equal(t, map[string]any{"count": 3.0, "verbose": false, "option": map[string]any{"depth": 2.0}}, args)
+	gt.NoError(t, spec.ValidateArgs(args))
+}
+
+func TestResponseRaw(t *testing.T) {
+	mockClient := &apiClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openaiapi.ChatCompletionRequest) (openaiapi.ChatCompletionResponse, error) {
+			return openaiapi.ChatCompletionResponse{
+				ID:                "chatcmpl-1",
+				Model:             "gpt-4o",
+				SystemFingerprint: "fp_123",
+				Choices: []openaiapi.ChatCompletionChoice{
+					{
+						Message: openaiapi.ChatCompletionMessage{
+							Role:    openaiapi.ChatMessageRoleAssistant,
+							Content: "ok",
+						},
+						FinishReason: openaiapi.FinishReasonStop,
+					},
+				},
+			}, nil
+		},
+	}
+	session, err := openai.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "gpt-4o")
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+	raw, ok := resp.Raw().(openaiapi.ChatCompletionResponse)
+	gt.True(t, ok)
+	gt.Equal(t, "fp_123", raw.SystemFingerprint)
+}
+
+func TestToolRequestOptions(t *testing.T) {
+	tool := &mock.ToolMock{
+		SpecFunc: func() gollem.ToolSpec {
+			return gollem.ToolSpec{
+				Name:       "search",
+				Parameters: map[string]*gollem.Parameter{"query": {Type: gollem.TypeString}},
+			}
+		},
+	}
+
+	type testCase struct {
+		options  []openai.Option
+		tools    []gollem.Tool
+		parallel any
+		strict   bool
+	}
+
+	runTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			client, err := openai.New(context.Background(), "test-key", tc.options...)
+			gt.NoError(t, err)
+			ssn, err := client.NewSession(context.Background(), gollem.WithSessionTools(tc.tools...))
+			gt.NoError(t, err)
+
+			var req openaiapi.ChatCompletionRequest
+			session := ssn.(*openai.Session)
+			openai.SetSessionAPIClient(session, &apiClientMock{
+				CreateChatCompletionFunc: func(ctx context.Context, r openaiapi.ChatCompletionRequest) (openaiapi.ChatCompletionResponse, error) {
+					req = r
+					return openaiapi.ChatCompletionResponse{}, nil
+				},
+			})
+
+			_, err = session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+			gt.NoError(t, err)
+			gt.Equal(t, tc.parallel, req.ParallelToolCalls)
+			for _, tool := range req.Tools {
+				gt.Equal(t, tc.strict, tool.Function.Strict)
+			}
+		}
+	}
+
+	t.Run("default", runTest(testCase{
+		tools: []gollem.Tool{tool},
+	}))
+
+	t.Run("parallel tool calls disabled", runTest(testCase{
+		options:  []openai.Option{openai.WithParallelToolCalls(false)},
+		tools:    []gollem.Tool{tool},
+		parallel: false,
+	}))
+
+	t.Run("parallel tool calls is not sent without tools", runTest(testCase{
+		options: []openai.Option{openai.WithParallelToolCalls(false)},
+	}))
+
+	t.Run("strict tools", runTest(testCase{
+		options: []openai.Option{openai.WithStrictTools()},
+		tools:   []gollem.Tool{tool},
+		strict:  true,
+	}))
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	var gatewayHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gatewayHeader = r.Header.Get("X-Gateway-Signature")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	var status int
+	sign := func(next gollem.HTTPHandler) gollem.HTTPHandler {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Gateway-Signature", "signed")
+			resp, err := next(req)
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			return resp, err
+		}
+	}
+
+	client, err := openai.New(context.Background(), "test-key",
+		openai.WithBaseURL(srv.URL),
+		openai.WithHTTPMiddleware(sign),
+	)
+	gt.NoError(t, err)
+	session, err := client.NewSession(context.Background())
+	gt.NoError(t, err)
+
+	resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"ok"}, resp.Texts)
+	gt.Equal(t, "signed", gatewayHeader)
+	gt.Equal(t, http.StatusOK, status)
+}
+
+func TestQuotaStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-ratelimit-limit-tokens", "30000")
+		w.Header().Set("x-ratelimit-remaining-tokens", "29990")
+		w.Header().Set("x-ratelimit-reset-tokens", "6m0s")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	tracker := gollem.NewQuotaTracker()
+	client, err := openai.New(context.Background(), "test-key",
+		openai.WithBaseURL(srv.URL),
+		openai.WithQuotaTracker(tracker),
+	)
+	gt.NoError(t, err)
+	session, err := client.NewSession(context.Background())
+	gt.NoError(t, err)
+
+	before := time.Now()
+	_, err = session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+
+	status := client.QuotaStatus()
+	gt.Equal(t, status, tracker.Status())
+	gt.Nil(t, status.Requests)
+	gt.Equal(t, 30000, status.Tokens.Limit)
+	gt.Equal(t, 29990, status.Tokens.Remaining)
+	gt.True(t, !status.Tokens.Reset.Before(before.Add(6*time.Minute)))
+}
+
+func TestContentFilterFinishReason(t *testing.T) {
+	mockClient := &apiClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openaiapi.ChatCompletionRequest) (openaiapi.ChatCompletionResponse, error) {
+			return openaiapi.ChatCompletionResponse{
+				Model: "gpt-5",
+				Choices: []openaiapi.ChatCompletionChoice{
+					{
+						Message:      openaiapi.ChatCompletionMessage{Role: openaiapi.ChatMessageRoleAssistant},
+						FinishReason: openaiapi.FinishReasonContentFilter,
+					},
+				},
+			}, nil
+		},
+	}
+	session, err := openai.NewSessionWithAPIClient(mockClient, gollem.NewSessionConfig(), "gpt-5")
+	gt.NoError(t, err)
+
+	_, err = session.Generate(context.Background(), []gollem.Input{gollem.Text("Test input")})
+	gt.Error(t, err).Is(gollem.ErrProhibitedContent)
+}
+
+func TestStreamFunctionCallDeltas(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"search","arguments":""}}]}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"query\":"}}]}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"gollem\"}"}}]}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			_, _ = w.Write([]byte("data: " + chunk + "\n\n"))
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer srv.Close()
+
+	client, err := openai.New(context.Background(), "test-key", openai.WithBaseURL(srv.URL))
+	gt.NoError(t, err)
+	session, err := client.NewSession(context.Background())
+	gt.NoError(t, err)
+
+	stream, err := session.Stream(context.Background(), []gollem.Input{gollem.Text("search gollem")})
+	gt.NoError(t, err)
+
+	var deltas []*gollem.FunctionCallDelta
+	var calls []*gollem.FunctionCall
+	for resp := range stream {
+		gt.NoError(t, resp.Error)
+		if len(resp.FunctionCalls) > 0 {
+			gt.A(t, deltas).Length(3) // deltas come before the complete call
+		}
+		deltas = append(deltas, resp.FunctionCallDeltas...)
+		calls = append(calls, resp.FunctionCalls...)
+	}
+
+	gt.Equal(t, []*gollem.FunctionCallDelta{
+		{Index: 0, ID: "call_1", Name: "search"},
+		{Index: 0, Arguments: `{"query":`},
+		{Index: 0, Arguments: `"gollem"}`},
+	}, deltas)
+	gt.Equal(t, []*gollem.FunctionCall{
+		{ID: "call_1", Name: "search", Arguments: map[string]any{"query": "gollem"}},
+	}, calls)
+}
+
+func TestLogprobs(t *testing.T) {
+	client, err := openai.New(context.Background(), "test-key", openai.WithLogprobs())
+	gt.NoError(t, err)
+	ssn, err := client.NewSession(context.Background())
+	gt.NoError(t, err)
+
+	var req openaiapi.ChatCompletionRequest
+	session := ssn.(*openai.Session)
+	openai.SetSessionAPIClient(session, &apiClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, r openaiapi.ChatCompletionRequest) (openaiapi.ChatCompletionResponse, error) {
+			req = r
+			return openaiapi.ChatCompletionResponse{
+				Choices: []openaiapi.ChatCompletionChoice{
+					{
+						Message: openaiapi.ChatCompletionMessage{
+							Role:    openaiapi.ChatMessageRoleAssistant,
+							Content: "ok",
+						},
+						LogProbs: &openaiapi.LogProbs{
+							Content: []openaiapi.LogProb{
+								{Token: "o", LogProb: -0.1},
+								{Token: "k", LogProb: -0.2},
+							},
+						},
+						FinishReason: openaiapi.FinishReasonStop,
+					},
+				},
+			}, nil
+		},
+	})
+
+	resp, err := session.Generate(context.Background(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+	gt.True(t, req.LogProbs)
+	gt.Equal(t, []float64{-0.1, -0.2}, resp.Logprobs)
+}
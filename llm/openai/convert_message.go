@@ -3,6 +3,7 @@ package openai
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/m-mizutani/goerr/v2"
@@ -306,6 +307,24 @@ func convertMessageToOpenAI(msg gollem.Message) ([]openai.ChatCompletionMessage,
 				})
 			}
 
+		case gollem.MessageContentTypeFile:
+			file, err := content.GetFileContent()
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to get file content")
+			}
+			// OpenAI does not read files, so text files are kept as text
+			if !gollem.IsTextMimeType(file.MediaType) {
+				return nil, goerr.Wrap(convert.ErrUnsupportedContentType, "file type is not supported by OpenAI", goerr.V("mime_type", file.MediaType))
+			}
+			header := fmt.Sprintf("[File (%s)]", file.MediaType)
+			if file.Name != "" {
+				header = fmt.Sprintf("[File: %s (%s)]", file.Name, file.MediaType)
+			}
+			textParts = append(textParts, openai.ChatMessagePart{
+				Type: "text",
+				Text: header + "\n" + string(file.Data),
+			})
+
 		case gollem.MessageContentTypeToolCall:
 			toolCall, err := content.GetToolCallContent()
 			if err != nil {
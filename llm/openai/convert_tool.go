@@ -1,6 +1,9 @@
 package openai
 
 import (
+	"maps"
+	"slices"
+
 	"github.com/m-mizutani/gollem"
 	gollemschema "github.com/m-mizutani/gollem/internal/schema"
 	"github.com/sashabaranov/go-openai"
@@ -102,6 +105,121 @@ func convertParameterToSchema(param *gollem.Parameter) map[string]interface{} {
 	return schema
 }
 
+// convertStrictTool converts gollem.Tool to openai.Tool in strict mode. Strict mode requires
+// every property to be required and objects to forbid additional properties, so optional
+// parameters are declared as nullable; null values are removed again by
+// gollem.ToolSpec.NormalizeArgs before the tool runs. Keywords unsupported in strict mode
+// (title, default, minLength and maxLength) are omitted. If a parameter cannot be expressed in
+// strict mode, the tool is converted by convertTool.
+func convertStrictTool(tool gollem.Tool) openai.Tool {
+	spec := tool.Spec()
+
+	parameters, ok := convertPropertiesToStrictSchema(spec.Parameters)
+	if !ok {
+		return convertTool(tool)
+	}
+
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        spec.Name,
+			Description: spec.Description,
+			Strict:      true,
+			Parameters:  parameters,
+		},
+	}
+}
+
+// convertPropertiesToStrictSchema converts properties to a strict object schema. It returns
+// false if a property cannot be expressed in strict mode.
+func convertPropertiesToStrictSchema(params map[string]*gollem.Parameter) (map[string]any, bool) {
+	properties := make(map[string]any, len(params))
+	for name, param := range params {
+		schema, ok := convertParameterToStrictSchema(param, param.Required)
+		if !ok {
+			return nil, false
+		}
+		properties[name] = schema
+	}
+
+	// required must be an empty array rather than null for a tool without parameters
+	required := append([]string{}, slices.Sorted(maps.Keys(params))...)
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}, true
+}
+
+// convertParameterToStrictSchema converts gollem.Parameter to a strict mode schema. The schema
+// is nullable unless required. It returns false for an object without properties and an array
+// without items, which strict mode cannot express.
+func convertParameterToStrictSchema(param *gollem.Parameter, required bool) (map[string]any, bool) {
+	var schema map[string]any
+
+	switch param.Type {
+	case gollem.TypeObject:
+		if len(param.Properties) == 0 {
+			return nil, false
+		}
+		var ok bool
+		if schema, ok = convertPropertiesToStrictSchema(param.Properties); !ok {
+			return nil, false
+		}
+
+	case gollem.TypeArray:
+		if param.Items == nil {
+			return nil, false
+		}
+		items, ok := convertParameterToStrictSchema(param.Items, true)
+		if !ok {
+			return nil, false
+		}
+		schema = map[string]any{"type": "array", "items": items}
+		if param.MinItems != nil {
+			schema["minItems"] = *param.MinItems
+		}
+		if param.MaxItems != nil {
+			schema["maxItems"] = *param.MaxItems
+		}
+
+	default:
+		schema = map[string]any{"type": getOpenAIType(param.Type)}
+		if param.Minimum != nil {
+			schema["minimum"] = *param.Minimum
+		}
+		if param.Maximum != nil {
+			schema["maximum"] = *param.Maximum
+		}
+		if param.Type == gollem.TypeString && param.Pattern != "" {
+			schema["pattern"] = param.Pattern
+		}
+	}
+
+	if param.Description != "" {
+		schema["description"] = param.Description
+	}
+
+	if len(param.Enum) > 0 {
+		enum := make([]any, 0, len(param.Enum)+1)
+		for _, v := range param.Enum {
+			enum = append(enum, v)
+		}
+		if !required {
+			enum = append(enum, nil)
+		}
+		schema["enum"] = enum
+	}
+
+	if !required {
+		schema["type"] = []any{schema["type"], "null"}
+	}
+
+	return schema, true
+}
+
 func getOpenAIType(paramType gollem.ParameterType) string {
 	switch paramType {
 	case gollem.TypeString:
@@ -120,3 +238,20 @@ func getOpenAIType(paramType gollem.ParameterType) string {
 		return "string"
 	}
 }
+
+// convertToolChoice converts gollem.ToolChoice to the tool_choice value of the Chat Completions API.
+func convertToolChoice(choice gollem.ToolChoice) any {
+	switch choice.Mode {
+	case gollem.ToolChoiceModeRequired:
+		return "required"
+	case gollem.ToolChoiceModeNone:
+		return "none"
+	case gollem.ToolChoiceModeTool:
+		return openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: choice.Name},
+		}
+	default:
+		return "auto"
+	}
+}
@@ -6,7 +6,9 @@ import (
 
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/openai"
+	"github.com/m-mizutani/gollem/mock"
 	"github.com/m-mizutani/gt"
+	openaiapi "github.com/sashabaranov/go-openai"
 )
 
 type complexTool struct{}
@@ -148,3 +150,80 @@ func TestConvertParameterToSchema(t *testing.T) {
 func ptr[T any](v T) *T {
 	return &v
 }
+
+func TestConvertToolChoice(t *testing.T) {
+	gt.Equal(t, any("auto"), openai.ConvertToolChoice(gollem.ToolChoiceAuto()))
+	gt.Equal(t, any("required"), openai.ConvertToolChoice(gollem.ToolChoiceRequired()))
+	gt.Equal(t, any("none"), openai.ConvertToolChoice(gollem.ToolChoiceNone()))
+
+	choice, ok := openai.ConvertToolChoice(gollem.ToolChoiceTool("search")).(openaiapi.ToolChoice)
+	gt.True(t, ok)
+	gt.Equal(t, openaiapi.ToolTypeFunction, choice.Type)
+	gt.Equal(t, "search", choice.Function.Name)
+}
+
+func TestConvertStrictTool(t *testing.T) {
+	newTool := func(params map[string]*gollem.Parameter) *mock.ToolMock {
+		return &mock.ToolMock{
+			SpecFunc: func() gollem.ToolSpec {
+				return gollem.ToolSpec{Name: "search", Description: "Search items", Parameters: params}
+			},
+		}
+	}
+
+	t.Run("optional parameters are nullable and all are required", func(t *testing.T) {
+		converted := openai.ConvertStrictTool(newTool(map[string]*gollem.Parameter{
+			"query": {Type: gollem.TypeString, Required: true, Description: "Query", MinLength: new(1)},
+			"limit": {Type: gollem.TypeInteger, Minimum: new(1.0), Default: 10},
+			"sort":  {Type: gollem.TypeString, Enum: []string{"asc", "desc"}},
+			"filter": {
+				Type:     gollem.TypeObject,
+				Required: true,
+				Properties: map[string]*gollem.Parameter{
+					"tags": {Type: gollem.TypeArray, Items: &gollem.Parameter{Type: gollem.TypeString}},
+				},
+			},
+		}))
+
+		gt.True(t, converted.Function.Strict)
+		gt.Equal[any](t, map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "string", "description": "Query"},
+				"limit": map[string]any{"type": []any{"integer", "null"}, "minimum": 1.0},
+				"sort":  map[string]any{"type": []any{"string", "null"}, "enum": []any{"asc", "desc", nil}},
+				"filter": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"tags": map[string]any{
+							"type":  []any{"array", "null"},
+							"items": map[string]any{"type": "string"},
+						},
+					},
+					"required":             []string{"tags"},
+					"additionalProperties": false,
+				},
+			},
+			"required":             []string{"filter", "limit", "query", "sort"},
+			"additionalProperties": false,
+		}, converted.Function.Parameters)
+	})
+
+	t.Run("parameterless tool", func(t *testing.T) {
+		converted := openai.ConvertStrictTool(newTool(nil))
+		gt.True(t, converted.Function.Strict)
+		gt.Equal[any](t, map[string]any{
+			"type":                 "object",
+			"properties":           map[string]any{},
+			"required":             []string{},
+			"additionalProperties": false,
+		}, converted.Function.Parameters)
+	})
+
+	t.Run("falls back to non-strict mode", func(t *testing.T) {
+		tool := newTool(map[string]*gollem.Parameter{
+			"meta": {Type: gollem.TypeObject, Properties: map[string]*gollem.Parameter{}},
+		})
+		gt.Equal(t, openai.ConvertTool(tool), openai.ConvertStrictTool(tool))
+	})
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 
 	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/trace"
 	"github.com/sashabaranov/go-openai"
 )
 
-// GenerateEmbedding generates embeddings for the given input text.
+// GenerateEmbedding generates embeddings for the given input text. Embeddings are normalized
+// to unit vectors by gollem.NormalizeEmbeddings.
 func (c *Client) GenerateEmbedding(ctx context.Context, dimension int, input []string) ([][]float64, error) {
 	/*
 			AdaEmbeddingV2  EmbeddingModel = "text-embedding-ada-002"
@@ -65,5 +67,5 @@ func (c *Client) GenerateEmbedding(ctx context.Context, dimension int, input []s
 		}
 	}
 
-	return embeddings, nil
+	return gollem.NormalizeEmbeddings(embeddings), nil
 }
@@ -9,6 +9,8 @@ import (
 var (
 	ConvertTool                   = convertTool
 	ConvertParameterToSchema      = convertParameterToSchema
+	ConvertToolChoice             = convertToolChoice
+	ConvertStrictTool             = convertStrictTool
 	TokenLimitErrorOptions        = tokenLimitErrorOptions
 	OpenaiMessagesToTraceMessages = openaiMessagesToTraceMessages
 )
@@ -43,6 +45,11 @@ func NewSessionWithAPIClient(client apiClient, cfg gollem.SessionConfig, model s
 	}, nil
 }
 
+// SetSessionAPIClient sets the API client of a session created by Client.NewSession for testing
+func SetSessionAPIClient(s *Session, client apiClient) {
+	s.apiClient = client
+}
+
 // GetBaseURL returns the base URL from an OpenAI client for testing
 func GetBaseURL(client *Client) string {
 	return client.baseURL
@@ -0,0 +1,39 @@
+package openai
+
+import (
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Tokenizer is a gollem.Tokenizer counting tokens by the tiktoken BPE of an OpenAI model.
+type Tokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+var _ gollem.Tokenizer = (*Tokenizer)(nil)
+
+// NewTokenizer returns the Tokenizer of model, or of o200k_base if the encoding of model is
+// unknown. The BPE file is downloaded on first use and cached in TIKTOKEN_CACHE_DIR if set. For
+// offline use, set TIKTOKEN_CACHE_DIR to a directory with the cached file, or load the file by
+// tiktoken.SetBpeLoader, e.g. with the embedded files of github.com/pkoukk/tiktoken-go-loader.
+func NewTokenizer(model string) (*Tokenizer, error) {
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		// Fallback to o200k_base encoding, which is used by models since gpt-4o, e.g. gpt-4.1,
+		// gpt-5 and the o-series, because models unknown to tiktoken are likely newer ones
+		encoding, err = tiktoken.GetEncoding(tiktoken.MODEL_O200K_BASE)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to get encoding", goerr.V("model", model))
+		}
+	}
+	return &Tokenizer{encoding: encoding}, nil
+}
+
+// CountTokens implements gollem.Tokenizer.
+func (t *Tokenizer) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return len(t.encoding.Encode(text, nil, nil))
+}
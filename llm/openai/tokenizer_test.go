@@ -0,0 +1,71 @@
+package openai_test
+
+import (
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/openai"
+	"github.com/m-mizutani/gt"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// byteLoader is a BPE loader of single bytes and the given merged tokens, so that tests run
+// offline without downloading the BPE files.
+type byteLoader struct {
+	merged []string
+}
+
+func (l *byteLoader) LoadTiktokenBpe(string) (map[string]int, error) {
+	ranks := make(map[string]int, 256+len(l.merged))
+	for i := range 256 {
+		ranks[string([]byte{byte(i)})] = i
+	}
+	for i, token := range l.merged {
+		ranks[token] = 256 + i
+	}
+	return ranks, nil
+}
+
+func TestTokenizer(t *testing.T) {
+	tiktoken.SetBpeLoader(&byteLoader{merged: []string{"hello", " world", "World"}})
+	t.Cleanup(func() { tiktoken.SetBpeLoader(tiktoken.NewDefaultBpeLoader()) })
+
+	t.Run("count by BPE of the model", func(t *testing.T) {
+		tokenizer, err := openai.NewTokenizer("gpt-4")
+		gt.NoError(t, err)
+		gt.Equal(t, 2, tokenizer.CountTokens("hello world"))
+		// " there" is not merged, so counted by bytes
+		gt.Equal(t, 7, tokenizer.CountTokens("hello there"))
+		gt.Equal(t, 0, tokenizer.CountTokens(""))
+	})
+
+	t.Run("unknown model falls back to o200k_base", func(t *testing.T) {
+		// o200k_base splits words at upper case letters, while cl100k_base does not
+		tokenizer, err := openai.NewTokenizer("gpt-4")
+		gt.NoError(t, err)
+		gt.Equal(t, 10, tokenizer.CountTokens("helloWorld"))
+
+		for _, model := range []string{openai.DefaultModel, "o3-mini", "o4-mini", "unknown-model"} {
+			tokenizer, err := openai.NewTokenizer(model)
+			gt.NoError(t, err)
+			gt.Equal(t, 2, tokenizer.CountTokens("helloWorld"))
+		}
+	})
+
+	t.Run("CountToken of session by the tokenizer", func(t *testing.T) {
+		var counted []string
+		client, err := openai.New(t.Context(), "test-key", openai.WithTokenizer(gollem.TokenCounter(func(text string) int {
+			counted = append(counted, text)
+			return 10
+		})))
+		gt.NoError(t, err)
+		session, err := client.NewSession(t.Context(), gollem.WithSessionSystemPrompt("system"))
+		gt.NoError(t, err)
+
+		tokens, err := session.CountToken(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		// system prompt, and content and role of the message, plus per-message and priming overheads
+		gt.Equal(t, 39, tokens)
+		gt.Equal(t, []string{"system", "user", "hello"}, counted)
+	})
+}
@@ -0,0 +1,373 @@
+// Package pool provides a gollem.LLMClient that load-balances LLM calls across multiple clients
+// of the same provider, e.g. clients with different API keys or endpoints, for services whose
+// throughput exceeds the limits of one of them. The pool tracks the error rate and latency of
+// each backend, removes a backend from the rotation for a while when its error rate gets high,
+// and reports calls and health changes to metrics hooks.
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// Balance is how a Client picks a backend for a call.
+type Balance string
+
+const (
+	// BalanceRoundRobin picks healthy backends in turn. It's the default.
+	BalanceRoundRobin Balance = "round_robin"
+
+	// BalanceLeastLoaded picks the healthy backend with the fewest calls in flight, and the
+	// lowest average latency among them.
+	BalanceLeastLoaded Balance = "least_loaded"
+)
+
+// HealthPolicy is when a backend is removed from the rotation.
+type HealthPolicy struct {
+	// Window is the number of recent calls of a backend to compute its error rate and latency.
+	Window int
+
+	// MinCalls is the number of calls in the window required to judge the health of a
+	// backend, so that a backend is not removed by a few failures after it started.
+	MinCalls int
+
+	// MaxErrorRate is the error rate (0.0 to 1.0) in the window at which a backend is removed.
+	MaxErrorRate float64
+
+	// Cooldown is how long a removed backend stays out of the rotation. After that, it returns
+	// with an empty window.
+	Cooldown time.Duration
+}
+
+// DefaultHealthPolicy returns a HealthPolicy that removes a backend for 30 seconds when half of
+// at least 5 of its last 20 calls failed.
+func DefaultHealthPolicy() *HealthPolicy {
+	return &HealthPolicy{
+		Window:       20,
+		MinCalls:     5,
+		MaxErrorRate: 0.5,
+		Cooldown:     30 * time.Second,
+	}
+}
+
+// CallEvent describes a call to a backend. It's passed to the function set by WithOnCall.
+type CallEvent struct {
+	// Backend is the index of the backend in the clients given to New
+	Backend int
+	// Method is the name of the method called, e.g. "Generate"
+	Method string
+	// Latency is the duration of the call. It's until the end of the stream for a stream.
+	Latency time.Duration
+	// Error is the error of the call, or nil if succeeded
+	Error error
+}
+
+// HealthEvent describes a backend removed from or returned to the rotation. It's passed to the
+// function set by WithOnHealthChange and added to the trace as a "llm_pool_health" event.
+type HealthEvent struct {
+	Backend int  `json:"backend"`
+	Healthy bool `json:"healthy"`
+	// ErrorRate is the error rate in the window when the backend is removed
+	ErrorRate float64 `json:"error_rate"`
+	// Until is when the removed backend returns to the rotation
+	Until time.Time `json:"until,omitzero"`
+}
+
+// BackendStats is the current state of a backend, returned by Client.Stats.
+type BackendStats struct {
+	Backend  int
+	Healthy  bool
+	InFlight int
+	// Calls and Errors are the total numbers of calls and failed calls
+	Calls  int
+	Errors int
+	// ErrorRate and AvgLatency are of the calls in the window of the HealthPolicy
+	ErrorRate  float64
+	AvgLatency time.Duration
+	// UnhealthyUntil is when the backend returns to the rotation if it's removed
+	UnhealthyUntil time.Time
+}
+
+// Client is a gollem.LLMClient load-balancing calls across backends. Create it by New.
+type Client struct {
+	balance        Balance
+	health         *HealthPolicy
+	sticky         bool
+	onCall         func(ctx context.Context, event *CallEvent)
+	onHealthChange func(ctx context.Context, event *HealthEvent)
+
+	mu       sync.Mutex
+	backends []*backend
+	next     int
+}
+
+// backend is a client of the pool and its state.
+type backend struct {
+	index  int
+	client gollem.LLMClient
+
+	inFlight       int
+	calls          int
+	errors         int
+	window         []callResult
+	unhealthyUntil time.Time
+}
+
+// callResult is a call in the window of a backend.
+type callResult struct {
+	latency time.Duration
+	failed  bool
+}
+
+// Option is an option of New.
+type Option func(*Client)
+
+// WithBalance sets how a backend is picked for a call. Default is BalanceRoundRobin.
+func WithBalance(balance Balance) Option {
+	return func(c *Client) {
+		c.balance = balance
+	}
+}
+
+// WithHealthPolicy sets when a backend is removed from the rotation. Default is
+// DefaultHealthPolicy().
+func WithHealthPolicy(policy *HealthPolicy) Option {
+	return func(c *Client) {
+		c.health = policy
+	}
+}
+
+// WithStickySessions keeps each session on the backend it started on while the backend is
+// healthy, instead of picking a backend for each call. Use it with providers whose sessions
+// benefit from staying on the same endpoint, e.g. by prompt caching.
+func WithStickySessions() Option {
+	return func(c *Client) {
+		c.sticky = true
+	}
+}
+
+// WithOnCall sets a function called after each call to a backend, e.g. to export latency and
+// errors as metrics.
+func WithOnCall(onCall func(ctx context.Context, event *CallEvent)) Option {
+	return func(c *Client) {
+		c.onCall = onCall
+	}
+}
+
+// WithOnHealthChange sets a function called when a backend is removed from or returned to the
+// rotation.
+func WithOnHealthChange(onHealthChange func(ctx context.Context, event *HealthEvent)) Option {
+	return func(c *Client) {
+		c.onHealthChange = onHealthChange
+	}
+}
+
+// New creates a Client load-balancing calls across clients. The clients should be of the same
+// provider and model, because a session may move between them with its history.
+func New(clients []gollem.LLMClient, options ...Option) (*Client, error) {
+	if len(clients) == 0 {
+		return nil, goerr.Wrap(gollem.ErrInvalidParameter, "no client")
+	}
+
+	c := &Client{
+		balance: BalanceRoundRobin,
+		health:  DefaultHealthPolicy(),
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	switch c.balance {
+	case BalanceRoundRobin, BalanceLeastLoaded:
+	default:
+		return nil, goerr.Wrap(gollem.ErrInvalidParameter, "unknown balance", goerr.V("balance", c.balance))
+	}
+	if c.health == nil || c.health.Window < 1 || c.health.MinCalls < 1 || c.health.MinCalls > c.health.Window {
+		return nil, goerr.Wrap(gollem.ErrInvalidParameter, "invalid health policy", goerr.V("policy", c.health))
+	}
+
+	for i, client := range clients {
+		if client == nil {
+			return nil, goerr.Wrap(gollem.ErrInvalidParameter, "client is nil", goerr.V("index", i))
+		}
+		c.backends = append(c.backends, &backend{index: i, client: client})
+	}
+
+	return c, nil
+}
+
+// NewSession creates a session whose calls are load-balanced. Underlying sessions are created
+// on demand with options, and the history is carried over when the session moves to another
+// backend.
+func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+	cfg := gollem.NewSessionConfig(options...)
+	return &Session{
+		pool:    c,
+		options: options,
+		history: cfg.History().Clone(),
+	}, nil
+}
+
+// GenerateEmbedding generates embeddings by a backend picked for the call.
+func (c *Client) GenerateEmbedding(ctx context.Context, dimension int, input []string) ([][]float64, error) {
+	b := c.pick(ctx, nil)
+	done := c.start(ctx, b, "GenerateEmbedding")
+	embeddings, err := b.client.GenerateEmbedding(ctx, dimension, input)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// Stats returns the current state of the backends in the order of the clients given to New.
+func (c *Client) Stats() []BackendStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]BackendStats, len(c.backends))
+	for i, b := range c.backends {
+		errorRate, latency := b.windowStats()
+		stats[i] = BackendStats{
+			Backend:        b.index,
+			Healthy:        b.unhealthyUntil.IsZero(),
+			InFlight:       b.inFlight,
+			Calls:          b.calls,
+			Errors:         b.errors,
+			ErrorRate:      errorRate,
+			AvgLatency:     latency,
+			UnhealthyUntil: b.unhealthyUntil,
+		}
+	}
+	return stats
+}
+
+// pick returns the backend for a call. A session on current keeps it if sticky sessions are
+// enabled and it's healthy. If all backends are removed, the one returning first is picked, so
+// that calls do not fail only because of the health of the pool.
+func (c *Client) pick(ctx context.Context, current *backend) *backend {
+	now := gollem.Now(ctx)
+
+	c.mu.Lock()
+	var recovered []*backend
+	var healthy []*backend
+	for _, b := range c.backends {
+		if !b.unhealthyUntil.IsZero() && !now.Before(b.unhealthyUntil) {
+			b.unhealthyUntil = time.Time{}
+			b.window = nil
+			recovered = append(recovered, b)
+		}
+		if b.unhealthyUntil.IsZero() {
+			healthy = append(healthy, b)
+		}
+	}
+
+	var picked *backend
+	switch {
+	case c.sticky && current != nil && current.unhealthyUntil.IsZero():
+		picked = current
+	case len(healthy) == 0:
+		picked = c.backends[0]
+		for _, b := range c.backends[1:] {
+			if b.unhealthyUntil.Before(picked.unhealthyUntil) {
+				picked = b
+			}
+		}
+	case c.balance == BalanceLeastLoaded:
+		picked = healthy[0]
+		_, pickedLatency := picked.windowStats()
+		for _, b := range healthy[1:] {
+			_, latency := b.windowStats()
+			if b.inFlight < picked.inFlight || (b.inFlight == picked.inFlight && latency < pickedLatency) {
+				picked, pickedLatency = b, latency
+			}
+		}
+	default:
+		// Take the first healthy backend from the next position in turn
+		picked = healthy[0]
+		for _, b := range healthy {
+			if b.index >= c.next {
+				picked = b
+				break
+			}
+		}
+		c.next = picked.index + 1
+	}
+	c.mu.Unlock()
+
+	for _, b := range recovered {
+		c.notifyHealth(ctx, &HealthEvent{Backend: b.index, Healthy: true})
+	}
+	return picked
+}
+
+// start counts a call to b in flight, and returns the function to record its result.
+func (c *Client) start(ctx context.Context, b *backend, method string) func(err error) {
+	started := gollem.Now(ctx)
+	c.mu.Lock()
+	b.inFlight++
+	c.mu.Unlock()
+
+	return func(err error) {
+		latency := gollem.Now(ctx).Sub(started)
+		failed := err != nil && !errors.Is(err, context.Canceled)
+
+		c.mu.Lock()
+		b.inFlight--
+		b.calls++
+		if failed {
+			b.errors++
+		}
+		b.window = append(b.window, callResult{latency: latency, failed: failed})
+		if len(b.window) > c.health.Window {
+			b.window = b.window[len(b.window)-c.health.Window:]
+		}
+
+		var removed *HealthEvent
+		if errorRate, _ := b.windowStats(); b.unhealthyUntil.IsZero() &&
+			len(b.window) >= c.health.MinCalls && errorRate >= c.health.MaxErrorRate {
+			b.unhealthyUntil = gollem.Now(ctx).Add(c.health.Cooldown)
+			removed = &HealthEvent{Backend: b.index, ErrorRate: errorRate, Until: b.unhealthyUntil}
+		}
+		c.mu.Unlock()
+
+		if c.onCall != nil {
+			c.onCall(ctx, &CallEvent{Backend: b.index, Method: method, Latency: latency, Error: err})
+		}
+		if removed != nil {
+			c.notifyHealth(ctx, removed)
+		}
+	}
+}
+
+// notifyHealth reports event to the hook and the trace.
+func (c *Client) notifyHealth(ctx context.Context, event *HealthEvent) {
+	if c.onHealthChange != nil {
+		c.onHealthChange(ctx, event)
+	}
+	if h := trace.HandlerFrom(ctx); h != nil {
+		h.AddEvent(ctx, "llm_pool_health", event)
+	}
+}
+
+// windowStats returns the error rate and the average latency of the calls in the window.
+func (b *backend) windowStats() (float64, time.Duration) {
+	if len(b.window) == 0 {
+		return 0, 0
+	}
+	var failed int
+	var total time.Duration
+	for _, r := range b.window {
+		if r.failed {
+			failed++
+		}
+		total += r.latency
+	}
+	return float64(failed) / float64(len(b.window)), total / time.Duration(len(b.window))
+}
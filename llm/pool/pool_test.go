@@ -0,0 +1,396 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/pool"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// clock is a manually advanced gollem.Clock.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// backend is a fake client whose sessions keep the history of their calls. A call takes
+// latency on clk and fails with err if set.
+type backend struct {
+	name    string
+	clk     *clock
+	latency time.Duration
+	err     error
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (b *backend) client() *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			history := &gollem.History{LLType: gollem.LLMTypeOpenAI, Version: gollem.HistoryVersion}
+			if h := cfg.History(); h != nil {
+				history = h.Clone()
+			}
+
+			call := func() error {
+				b.mu.Lock()
+				b.calls++
+				b.mu.Unlock()
+				if b.clk != nil {
+					b.clk.Advance(b.latency)
+				}
+				return b.err
+			}
+
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					if err := call(); err != nil {
+						return nil, err
+					}
+					history.Messages = append(history.Messages, textMessage(gollem.RoleUser, input[0].String()), textMessage(gollem.RoleAssistant, b.name))
+					return &gollem.Response{Texts: []string{b.name}}, nil
+				},
+				StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+					ch := make(chan *gollem.Response, 1)
+					if err := call(); err != nil {
+						ch <- &gollem.Response{Error: err}
+					} else {
+						ch <- &gollem.Response{Texts: []string{b.name}}
+					}
+					close(ch)
+					return ch, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return history.Clone(), nil
+				},
+			}, nil
+		},
+	}
+}
+
+func (b *backend) callCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+func textMessage(role gollem.MessageRole, text string) gollem.Message {
+	content, err := gollem.NewTextContent(text)
+	if err != nil {
+		panic(err)
+	}
+	return gollem.Message{Role: role, Contents: []gollem.MessageContent{content}}
+}
+
+func newPool(t *testing.T, backends []*backend, options ...pool.Option) *pool.Client {
+	t.Helper()
+	clients := make([]gollem.LLMClient, len(backends))
+	for i, b := range backends {
+		clients[i] = b.client()
+	}
+	p, err := pool.New(clients, options...)
+	gt.NoError(t, err)
+	return p
+}
+
+func generate(t *testing.T, ctx context.Context, session gollem.Session) (string, error) {
+	t.Helper()
+	resp, err := session.Generate(ctx, []gollem.Input{gollem.Text("hello")})
+	if err != nil {
+		return "", err
+	}
+	return resp.Texts[0], nil
+}
+
+func TestRoundRobin(t *testing.T) {
+	backends := []*backend{{name: "a"}, {name: "b"}, {name: "c"}}
+	p := newPool(t, backends)
+
+	session, err := p.NewSession(t.Context())
+	gt.NoError(t, err)
+
+	var answers []string
+	for range 4 {
+		answer, err := generate(t, t.Context(), session)
+		gt.NoError(t, err)
+		answers = append(answers, answer)
+	}
+	gt.Equal(t, []string{"a", "b", "c", "a"}, answers)
+
+	// The history is carried over across backends
+	history, err := session.History()
+	gt.NoError(t, err)
+	gt.A(t, history.Messages).Length(8)
+
+	stats := p.Stats()
+	gt.A(t, stats).Length(3)
+	gt.Equal(t, 2, stats[0].Calls)
+	gt.Equal(t, 1, stats[1].Calls)
+	gt.True(t, stats[2].Healthy)
+}
+
+func TestStickySessions(t *testing.T) {
+	backends := []*backend{{name: "a"}, {name: "b"}}
+	p := newPool(t, backends, pool.WithStickySessions())
+
+	s1, err := p.NewSession(t.Context())
+	gt.NoError(t, err)
+	s2, err := p.NewSession(t.Context())
+	gt.NoError(t, err)
+
+	for range 3 {
+		answer, err := generate(t, t.Context(), s1)
+		gt.NoError(t, err)
+		gt.Equal(t, "a", answer)
+		answer, err = generate(t, t.Context(), s2)
+		gt.NoError(t, err)
+		gt.Equal(t, "b", answer)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	clk := newClock()
+	ctx := gollem.ContextWithClock(t.Context(), clk.Now)
+	errDown := errors.New("backend down")
+	backends := []*backend{{name: "a", err: errDown}, {name: "b"}}
+
+	var events []*pool.HealthEvent
+	var calls []*pool.CallEvent
+	p := newPool(t, backends,
+		pool.WithHealthPolicy(&pool.HealthPolicy{Window: 4, MinCalls: 2, MaxErrorRate: 0.5, Cooldown: time.Minute}),
+		pool.WithOnHealthChange(func(ctx context.Context, event *pool.HealthEvent) {
+			events = append(events, event)
+		}),
+		pool.WithOnCall(func(ctx context.Context, event *pool.CallEvent) {
+			calls = append(calls, event)
+		}),
+	)
+	session, err := p.NewSession(ctx)
+	gt.NoError(t, err)
+
+	// a fails twice in the rotation and is removed
+	for i := range 4 {
+		answer, err := generate(t, ctx, session)
+		if i%2 == 0 {
+			gt.Error(t, err).Is(errDown)
+		} else {
+			gt.NoError(t, err)
+			gt.Equal(t, "b", answer)
+		}
+	}
+	gt.A(t, events).Length(1)
+	gt.Equal(t, 0, events[0].Backend)
+	gt.False(t, events[0].Healthy)
+	gt.Equal(t, 1.0, events[0].ErrorRate)
+	gt.Equal(t, clk.Now().Add(time.Minute), events[0].Until)
+
+	gt.A(t, calls).Length(4)
+	gt.Equal(t, "Generate", calls[0].Method)
+	gt.True(t, errors.Is(calls[0].Error, errDown))
+
+	stats := p.Stats()
+	gt.False(t, stats[0].Healthy)
+	gt.Equal(t, 2, stats[0].Errors)
+
+	// Only b takes calls while a is removed
+	for range 3 {
+		answer, err := generate(t, ctx, session)
+		gt.NoError(t, err)
+		gt.Equal(t, "b", answer)
+	}
+	gt.Equal(t, 2, backends[0].callCount())
+
+	// a returns after the cooldown
+	clk.Advance(time.Minute)
+	backends[0].err = nil
+	answer, err := generate(t, ctx, session)
+	gt.NoError(t, err)
+	gt.Equal(t, "a", answer)
+	gt.A(t, events).Length(2)
+	gt.True(t, events[1].Healthy)
+	gt.True(t, p.Stats()[0].Healthy)
+}
+
+func TestAllUnhealthy(t *testing.T) {
+	clk := newClock()
+	ctx := gollem.ContextWithClock(t.Context(), clk.Now)
+	errDown := errors.New("backend down")
+	backends := []*backend{{name: "a", err: errDown}, {name: "b", err: errDown}}
+	p := newPool(t, backends, pool.WithHealthPolicy(&pool.HealthPolicy{Window: 1, MinCalls: 1, MaxErrorRate: 0.5, Cooldown: time.Minute}))
+
+	session, err := p.NewSession(ctx)
+	gt.NoError(t, err)
+	_, err = generate(t, ctx, session)
+	gt.Error(t, err).Is(errDown)
+	clk.Advance(time.Second)
+	_, err = generate(t, ctx, session)
+	gt.Error(t, err).Is(errDown)
+
+	// Both are removed, and the one returning first still takes calls
+	backends[0].err = nil
+	answer, err := generate(t, ctx, session)
+	gt.NoError(t, err)
+	gt.Equal(t, "a", answer)
+}
+
+func TestLeastLoaded(t *testing.T) {
+	clk := newClock()
+	ctx := gollem.ContextWithClock(t.Context(), clk.Now)
+	backends := []*backend{
+		{name: "slow", clk: clk, latency: 2 * time.Second},
+		{name: "fast", clk: clk, latency: 100 * time.Millisecond},
+	}
+	p := newPool(t, backends, pool.WithBalance(pool.BalanceLeastLoaded))
+	session, err := p.NewSession(ctx)
+	gt.NoError(t, err)
+
+	// The first call goes to slow because no latency is known yet
+	answer, err := generate(t, ctx, session)
+	gt.NoError(t, err)
+	gt.Equal(t, "slow", answer)
+	gt.Equal(t, 2*time.Second, p.Stats()[0].AvgLatency)
+
+	answer, err = generate(t, ctx, session)
+	gt.NoError(t, err)
+	gt.Equal(t, "fast", answer)
+
+	for range 3 {
+		answer, err = generate(t, ctx, session)
+		gt.NoError(t, err)
+		gt.Equal(t, "fast", answer)
+	}
+}
+
+func TestStream(t *testing.T) {
+	errDown := errors.New("backend down")
+	backends := []*backend{{name: "a", err: errDown}}
+	p := newPool(t, backends)
+	session, err := p.NewSession(t.Context())
+	gt.NoError(t, err)
+
+	ch, err := session.Stream(t.Context(), []gollem.Input{gollem.Text("hello")})
+	gt.NoError(t, err)
+	for resp := range ch {
+		gt.Error(t, resp.Error).Is(errDown)
+	}
+
+	stats := p.Stats()
+	gt.Equal(t, 1, stats[0].Calls)
+	gt.Equal(t, 1, stats[0].Errors)
+	gt.Equal(t, 0, stats[0].InFlight)
+}
+
+func TestNew(t *testing.T) {
+	_, err := pool.New(nil)
+	gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+
+	_, err = pool.New([]gollem.LLMClient{nil})
+	gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+
+	client := (&backend{name: "a"}).client()
+	_, err = pool.New([]gollem.LLMClient{client}, pool.WithBalance("random"))
+	gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+
+	_, err = pool.New([]gollem.LLMClient{client}, pool.WithHealthPolicy(&pool.HealthPolicy{Window: 2, MinCalls: 3}))
+	gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+}
+
+func TestStreamHoldsSession(t *testing.T) {
+	// Backend a streams a response after release is closed, and backend b generates one
+	release := make(chan struct{})
+	newClient := func(name string) *mock.LLMClientMock {
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				cfg := gollem.NewSessionConfig(options...)
+				history := &gollem.History{LLType: gollem.LLMTypeOpenAI, Version: gollem.HistoryVersion}
+				if h := cfg.History(); h != nil {
+					history = h.Clone()
+				}
+				var mu sync.Mutex
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						mu.Lock()
+						defer mu.Unlock()
+						history.Messages = append(history.Messages, textMessage(gollem.RoleUser, input[0].String()), textMessage(gollem.RoleAssistant, name))
+						return &gollem.Response{Texts: []string{name}}, nil
+					},
+					StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+						ch := make(chan *gollem.Response)
+						go func() {
+							defer close(ch)
+							<-release
+							mu.Lock()
+							history.Messages = append(history.Messages, textMessage(gollem.RoleUser, input[0].String()), textMessage(gollem.RoleAssistant, name))
+							mu.Unlock()
+							ch <- &gollem.Response{Texts: []string{name}}
+						}()
+						return ch, nil
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						mu.Lock()
+						defer mu.Unlock()
+						return history.Clone(), nil
+					},
+				}, nil
+			},
+		}
+	}
+
+	p, err := pool.New([]gollem.LLMClient{newClient("a"), newClient("b")})
+	gt.NoError(t, err)
+	session, err := p.NewSession(t.Context())
+	gt.NoError(t, err)
+
+	ch, err := session.Stream(t.Context(), []gollem.Input{gollem.Text("first")})
+	gt.NoError(t, err)
+
+	// Generate moves the session to backend b, so it must wait for the turn in the stream
+	generated := make(chan error, 1)
+	go func() {
+		_, err := session.Generate(t.Context(), []gollem.Input{gollem.Text("second")})
+		generated <- err
+	}()
+
+	select {
+	case <-generated:
+		t.Fatal("Generate must wait until the stream ends")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	for resp := range ch {
+		gt.Equal(t, []string{"a"}, resp.Texts)
+	}
+	gt.NoError(t, <-generated)
+
+	history, err := session.History()
+	gt.NoError(t, err)
+	gt.Equal(t, 4, len(history.Messages))
+	first, err := history.Messages[0].Contents[0].GetTextContent()
+	gt.NoError(t, err)
+	gt.Equal(t, "first", first.Text)
+}
@@ -0,0 +1,181 @@
+package pool
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// Session is a gollem.Session of a Client. Each call goes to a backend picked by the pool, and
+// the session moves to the backend with its history if it differs from the previous one.
+type Session struct {
+	pool    *Client
+	options []gollem.SessionOption
+
+	mu sync.Mutex
+	// history is the history before the first call
+	history *gollem.History
+	backend *backend
+	session gollem.Session
+}
+
+// Generate generates a response by a backend picked for the call.
+func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, session, err := s.sessionFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := s.pool.start(ctx, b, "Generate")
+	resp, err := session.Generate(ctx, input, opts...)
+	done(err)
+	if err != nil {
+		return nil, goerr.Wrap(err, "backend failed", goerr.V("backend", b.index))
+	}
+	return resp, nil
+}
+
+// Stream generates a response stream by a backend picked for the call. The call is recorded
+// when the stream ends, as failed if a response has an error. Other calls of the session wait
+// until the stream ends, so that the session does not move to another backend without the turn
+// in the stream. Do not call them while receiving the stream in the same goroutine.
+func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+	s.mu.Lock()
+
+	b, session, err := s.sessionFor(ctx)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	done := s.pool.start(ctx, b, "Stream")
+	ch, err := session.Stream(ctx, input, opts...)
+	if err != nil {
+		done(err)
+		s.mu.Unlock()
+		return nil, goerr.Wrap(err, "backend failed", goerr.V("backend", b.index))
+	}
+
+	out := make(chan *gollem.Response)
+	go func() {
+		// The lock is released before closing out, so that the session is available when the
+		// receiver sees the end of the stream
+		defer close(out)
+		defer s.mu.Unlock()
+		var streamErr error
+		defer func() { done(streamErr) }()
+
+		for resp := range ch {
+			if resp != nil && resp.Error != nil {
+				streamErr = resp.Error
+			}
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				streamErr = ctx.Err()
+				// Drain the stream so that the provider can finish
+				for range ch {
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// StreamContent generates a response stream iterated by gollem.Stream.
+func (s *Session) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return s.Stream(ctx, input, opts...)
+	})
+}
+
+// Deprecated: GenerateContent is deprecated. Use Generate instead.
+func (s *Session) GenerateContent(ctx context.Context, input ...gollem.Input) (*gollem.Response, error) {
+	return s.Generate(ctx, input)
+}
+
+// Deprecated: GenerateStream is deprecated. Use Stream instead.
+func (s *Session) GenerateStream(ctx context.Context, input ...gollem.Input) (<-chan *gollem.Response, error) {
+	return s.Stream(ctx, input)
+}
+
+// History returns the history of the session.
+func (s *Session) History() (*gollem.History, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.currentHistory()
+}
+
+// AppendHistory appends h to the history of the session.
+func (s *Session) AppendHistory(h *gollem.History) error {
+	if h == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != nil {
+		return s.session.AppendHistory(h)
+	}
+	if s.history == nil {
+		s.history = h.Clone()
+		return nil
+	}
+	s.history.Messages = append(s.history.Messages, h.Clone().Messages...)
+	return nil
+}
+
+// CountToken counts tokens by the current backend, or a backend picked for it before the first
+// call.
+func (s *Session) CountToken(ctx context.Context, input ...gollem.Input) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, session, err := s.sessionFor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return session.CountToken(ctx, input...)
+}
+
+// sessionFor picks a backend for a call, and returns its session. The session moves to the
+// backend with the current history if it differs from the previous one.
+func (s *Session) sessionFor(ctx context.Context) (*backend, gollem.Session, error) {
+	b := s.pool.pick(ctx, s.backend)
+	if b == s.backend {
+		return b, s.session, nil
+	}
+
+	history, err := s.currentHistory()
+	if err != nil {
+		return nil, nil, err
+	}
+	options := append(slices.Clone(s.options), gollem.WithSessionHistory(history))
+	session, err := b.client.NewSession(ctx, options...)
+	if err != nil {
+		return nil, nil, goerr.Wrap(err, "failed to create session of backend", goerr.V("backend", b.index))
+	}
+
+	s.backend, s.session, s.history = b, session, nil
+	return b, session, nil
+}
+
+// currentHistory returns the history of the current session, or the initial history.
+func (s *Session) currentHistory() (*gollem.History, error) {
+	if s.session == nil {
+		return s.history.Clone(), nil
+	}
+	history, err := s.session.History()
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to get history of backend", goerr.V("backend", s.backend.index))
+	}
+	return history, nil
+}
@@ -0,0 +1,206 @@
+// Package router provides a gollem.LLMClient that routes LLM calls to multiple underlying
+// clients, possibly of different providers. A call goes to the first route selected by the
+// routing rules, and falls back to the next one when it fails, e.g. by a rate limit or an
+// outage of the provider. Routes can be limited by the estimated size of the prompt, so that
+// small prompts go to a small model and large ones to a model with a large context window, or
+// ordered by cost to use the cheapest capable model. A session keeps its conversation across
+// routes by converting the history to the provider of the route by History.ConvertTo.
+package router
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// ErrNoRoute is returned when no route can take the prompt because it exceeds MaxInputTokens
+// of all routes.
+var ErrNoRoute = errors.New("no route can take the prompt")
+
+// expectedOutputTokens is the output tokens assumed to compare costs of routes by
+// SelectCheapest, because the actual output is unknown before the call.
+const expectedOutputTokens = 1024
+
+// Route is an underlying client of a Client.
+type Route struct {
+	// Name identifies the route in events. Default is the index of the route.
+	Name string
+
+	// Client is the LLM client of the route. It's required.
+	Client gollem.LLMClient
+
+	// LLMType is the provider of Client. The history of a session is converted to it when the
+	// session moves to this route from a route of another provider. If empty, the history is
+	// passed as it is.
+	LLMType gollem.LLMType
+
+	// MaxInputTokens is the context window of the model. The route is skipped for prompts whose
+	// tokens by gollem.TokenizerFromContext exceed it. Zero means no limit.
+	MaxInputTokens int
+
+	// Pricing is the price of the model, used by SelectCheapest. Routes without pricing are
+	// ranked after those with pricing.
+	Pricing *gollem.Pricing
+}
+
+// Selection is how a Client orders the routes that can take a prompt.
+type Selection string
+
+const (
+	// SelectPriority tries routes in the given order. It's the default.
+	SelectPriority Selection = "priority"
+
+	// SelectCheapest tries routes from the cheapest one for the estimated prompt tokens, and in
+	// the given order among routes of the same cost.
+	SelectCheapest Selection = "cheapest"
+)
+
+// FallbackEvent describes a fallback from a failed route to the next one. It's passed to the
+// function set by WithOnFallback and added to the trace as a "llm_fallback" event.
+type FallbackEvent struct {
+	// From is the name of the failed route
+	From string `json:"from"`
+	// To is the name of the route tried next
+	To string `json:"to"`
+	// Error is the error of the failed route
+	Error error `json:"-"`
+	// ErrorMessage is the message of Error
+	ErrorMessage string `json:"error"`
+}
+
+// RouteEvent describes a session moving its conversation to another route. It's added to the
+// trace as a "llm_route" event.
+type RouteEvent struct {
+	// From is the name of the previous route, or empty for the first call of the session
+	From string `json:"from,omitempty"`
+	// To is the name of the new route
+	To string `json:"to"`
+	// Conversion tells what was changed in the history converted for the new route. It's nil
+	// if the history was not converted.
+	Conversion *gollem.HistoryConversionReport `json:"conversion,omitempty"`
+}
+
+// Client is a gollem.LLMClient routing calls to multiple clients. Create it by New.
+type Client struct {
+	routes     []*Route
+	selection  Selection
+	fallbackOn func(err error) bool
+	onFallback func(ctx context.Context, event *FallbackEvent)
+}
+
+// Option is an option of New.
+type Option func(*Client)
+
+// WithSelection sets how routes are ordered. Default is SelectPriority.
+func WithSelection(selection Selection) Option {
+	return func(c *Client) {
+		c.selection = selection
+	}
+}
+
+// WithFallbackOn sets the condition to fall back to the next route when a route fails. Default
+// is any error except cancellation of the context. Use gollem.IsTransientError to fall back
+// only on rate limits, overload and server errors.
+func WithFallbackOn(fallbackOn func(err error) bool) Option {
+	return func(c *Client) {
+		c.fallbackOn = fallbackOn
+	}
+}
+
+// WithOnFallback sets a function called when a route fails and the next one is tried.
+func WithOnFallback(onFallback func(ctx context.Context, event *FallbackEvent)) Option {
+	return func(c *Client) {
+		c.onFallback = onFallback
+	}
+}
+
+// New creates a Client routing calls to routes. The routes are copied, so changing them after
+// New does not affect the client.
+func New(routes []*Route, options ...Option) (*Client, error) {
+	if len(routes) == 0 {
+		return nil, goerr.Wrap(gollem.ErrInvalidParameter, "no route")
+	}
+
+	c := &Client{
+		selection:  SelectPriority,
+		fallbackOn: defaultFallbackOn,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	switch c.selection {
+	case SelectPriority, SelectCheapest:
+	default:
+		return nil, goerr.Wrap(gollem.ErrInvalidParameter, "unknown selection", goerr.V("selection", c.selection))
+	}
+
+	for i, route := range routes {
+		if route == nil || route.Client == nil {
+			return nil, goerr.Wrap(gollem.ErrInvalidParameter, "route has no client", goerr.V("index", i))
+		}
+		copied := *route
+		if copied.Name == "" {
+			copied.Name = strconv.Itoa(i)
+		}
+		c.routes = append(c.routes, &copied)
+	}
+
+	return c, nil
+}
+
+// defaultFallbackOn falls back on any error except cancellation of the context.
+func defaultFallbackOn(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// NewSession creates a session routing each call. Underlying sessions are created on demand
+// with options, and the history is carried over when the session moves to another route.
+func (c *Client) NewSession(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+	cfg := gollem.NewSessionConfig(options...)
+	return &Session{
+		client:       c,
+		options:      slices.Clone(options),
+		systemPrompt: cfg.SystemPrompt(),
+		history:      cfg.History().Clone(),
+	}, nil
+}
+
+// GenerateEmbedding generates embeddings by the client of the first route. It does not fall
+// back because embeddings of different models are not comparable.
+func (c *Client) GenerateEmbedding(ctx context.Context, dimension int, input []string) ([][]float64, error) {
+	return c.routes[0].Client.GenerateEmbedding(ctx, dimension, input)
+}
+
+// candidates returns the routes that can take a prompt of tokens in the order to try.
+func (c *Client) candidates(tokens int) ([]*Route, error) {
+	var routes []*Route
+	for _, route := range c.routes {
+		if route.MaxInputTokens == 0 || tokens <= route.MaxInputTokens {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 {
+		return nil, goerr.Wrap(ErrNoRoute, "prompt is too large for all routes", goerr.V("tokens", tokens))
+	}
+
+	if c.selection == SelectCheapest {
+		slices.SortStableFunc(routes, func(a, b *Route) int {
+			switch {
+			case a.Pricing == nil && b.Pricing == nil:
+				return 0
+			case a.Pricing == nil:
+				return 1
+			case b.Pricing == nil:
+				return -1
+			}
+			return cmp.Compare(a.Pricing.Cost(tokens, expectedOutputTokens), b.Pricing.Cost(tokens, expectedOutputTokens))
+		})
+	}
+	return routes, nil
+}
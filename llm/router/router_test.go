@@ -0,0 +1,280 @@
+package router_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/router"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// provider is a fake LLM provider whose sessions keep the history of their calls. fail is
+// called with the number of the call of the provider and fails the call if it returns an error.
+type provider struct {
+	name    string
+	llmType gollem.LLMType
+	fail    func(n int) error
+
+	mu    sync.Mutex
+	calls int
+	// histories is the history given to each new session
+	histories []*gollem.History
+}
+
+func (p *provider) route(maxInputTokens int, pricing *gollem.Pricing) *router.Route {
+	return &router.Route{
+		Name:           p.name,
+		Client:         p.client(),
+		LLMType:        p.llmType,
+		MaxInputTokens: maxInputTokens,
+		Pricing:        pricing,
+	}
+}
+
+func (p *provider) client() *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			history := &gollem.History{LLType: p.llmType, Version: gollem.HistoryVersion}
+			if h := cfg.History(); h != nil {
+				history = h.Clone()
+			}
+			p.mu.Lock()
+			p.histories = append(p.histories, history.Clone())
+			p.mu.Unlock()
+
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					p.mu.Lock()
+					n := p.calls
+					p.calls++
+					p.mu.Unlock()
+					if p.fail != nil {
+						if err := p.fail(n); err != nil {
+							return nil, err
+						}
+					}
+
+					var texts []string
+					for _, in := range input {
+						texts = append(texts, in.String())
+					}
+					answer := p.name + ": " + strings.Join(texts, " ")
+					history.Messages = append(history.Messages,
+						textMessage(gollem.RoleUser, strings.Join(texts, " ")),
+						textMessage(gollem.RoleAssistant, answer),
+					)
+					return &gollem.Response{Texts: []string{answer}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return history.Clone(), nil
+				},
+				AppendHistoryFunc: func(h *gollem.History) error {
+					history.Messages = append(history.Messages, h.Messages...)
+					return nil
+				},
+				CountTokenFunc: func(ctx context.Context, input ...gollem.Input) (int, error) {
+					return len(history.Messages), nil
+				},
+			}, nil
+		},
+	}
+}
+
+func (p *provider) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func textMessage(role gollem.MessageRole, text string) gollem.Message {
+	content, err := gollem.NewTextContent(text)
+	if err != nil {
+		panic(err)
+	}
+	return gollem.Message{Role: role, Contents: []gollem.MessageContent{content}}
+}
+
+func generate(t *testing.T, session gollem.Session, text string) (*gollem.Response, error) {
+	t.Helper()
+	return session.Generate(t.Context(), []gollem.Input{gollem.Text(text)})
+}
+
+var errRateLimited = goerr.New("rate limited", goerr.T(gollem.ErrTagTransient))
+
+func TestFallback(t *testing.T) {
+	t.Run("falls back on error and returns to the primary route", func(t *testing.T) {
+		primary := &provider{name: "primary", llmType: gollem.LLMTypeOpenAI, fail: func(n int) error {
+			if n == 0 {
+				return errRateLimited
+			}
+			return nil
+		}}
+		secondary := &provider{name: "secondary", llmType: gollem.LLMTypeClaude}
+
+		var events []*router.FallbackEvent
+		client, err := router.New([]*router.Route{primary.route(0, nil), secondary.route(0, nil)},
+			router.WithOnFallback(func(ctx context.Context, event *router.FallbackEvent) {
+				events = append(events, event)
+			}))
+		gt.NoError(t, err)
+		session, err := client.NewSession(t.Context())
+		gt.NoError(t, err)
+
+		resp, err := generate(t, session, "hello")
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"secondary: hello"}, resp.Texts)
+		gt.A(t, events).Length(1)
+		gt.Equal(t, "primary", events[0].From)
+		gt.Equal(t, "secondary", events[0].To)
+		gt.True(t, errors.Is(events[0].Error, errRateLimited))
+
+		history, err := session.History()
+		gt.NoError(t, err)
+		gt.Equal(t, gollem.LLMTypeClaude, history.LLType)
+		gt.A(t, history.Messages).Length(2)
+
+		// The primary route recovers and takes over the conversation converted for it
+		resp, err = generate(t, session, "again")
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"primary: again"}, resp.Texts)
+		gt.A(t, primary.histories).Length(2)
+		gt.Equal(t, gollem.LLMTypeOpenAI, primary.histories[1].LLType)
+		gt.A(t, primary.histories[1].Messages).Length(2)
+
+		history, err = session.History()
+		gt.NoError(t, err)
+		gt.Equal(t, gollem.LLMTypeOpenAI, history.LLType)
+		gt.A(t, history.Messages).Length(4)
+	})
+
+	t.Run("fallback condition", func(t *testing.T) {
+		errInvalid := errors.New("invalid request")
+		primary := &provider{name: "primary", fail: func(n int) error { return errInvalid }}
+		secondary := &provider{name: "secondary"}
+
+		client, err := router.New([]*router.Route{primary.route(0, nil), secondary.route(0, nil)},
+			router.WithFallbackOn(gollem.IsTransientError))
+		gt.NoError(t, err)
+		session, err := client.NewSession(t.Context())
+		gt.NoError(t, err)
+
+		_, err = generate(t, session, "hello")
+		gt.Error(t, err).Is(errInvalid)
+		gt.Equal(t, 0, secondary.callCount())
+	})
+
+	t.Run("error of the last route", func(t *testing.T) {
+		primary := &provider{name: "primary", fail: func(n int) error { return errRateLimited }}
+		secondary := &provider{name: "secondary", fail: func(n int) error { return errRateLimited }}
+
+		client, err := router.New([]*router.Route{primary.route(0, nil), secondary.route(0, nil)})
+		gt.NoError(t, err)
+		session, err := client.NewSession(t.Context())
+		gt.NoError(t, err)
+
+		_, err = generate(t, session, "hello")
+		gt.Error(t, err).Is(errRateLimited)
+		gt.Equal(t, 1, primary.callCount())
+		gt.Equal(t, 1, secondary.callCount())
+	})
+
+	t.Run("no fallback after cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		primary := &provider{name: "primary", fail: func(n int) error {
+			cancel()
+			return context.Canceled
+		}}
+		secondary := &provider{name: "secondary"}
+
+		client, err := router.New([]*router.Route{primary.route(0, nil), secondary.route(0, nil)})
+		gt.NoError(t, err)
+		session, err := client.NewSession(ctx)
+		gt.NoError(t, err)
+
+		_, err = session.Generate(ctx, []gollem.Input{gollem.Text("hello")})
+		gt.Error(t, err).Is(context.Canceled)
+		gt.Equal(t, 0, secondary.callCount())
+	})
+
+	t.Run("initial history is carried to the route", func(t *testing.T) {
+		primary := &provider{name: "primary", llmType: gollem.LLMTypeGemini}
+		client, err := router.New([]*router.Route{primary.route(0, nil)})
+		gt.NoError(t, err)
+
+		initial, err := gollem.NewHistoryBuilder().User("hi").Assistant("hello").Build()
+		gt.NoError(t, err)
+		initial.LLType = gollem.LLMTypeOpenAI
+		session, err := client.NewSession(t.Context(), gollem.WithSessionHistory(initial))
+		gt.NoError(t, err)
+		gt.NoError(t, session.AppendHistory(&gollem.History{
+			LLType:   gollem.LLMTypeOpenAI,
+			Version:  gollem.HistoryVersion,
+			Messages: []gollem.Message{textMessage(gollem.RoleUser, "more")},
+		}))
+
+		_, err = generate(t, session, "question")
+		gt.NoError(t, err)
+		gt.Equal(t, gollem.LLMTypeGemini, primary.histories[0].LLType)
+		gt.A(t, primary.histories[0].Messages).Length(3)
+	})
+}
+
+func TestRouteByPromptSize(t *testing.T) {
+	small := &provider{name: "small"}
+	large := &provider{name: "large"}
+	client, err := router.New([]*router.Route{small.route(20, nil), large.route(200, nil)})
+	gt.NoError(t, err)
+	session, err := client.NewSession(t.Context())
+	gt.NoError(t, err)
+
+	resp, err := generate(t, session, "short prompt")
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"small: short prompt"}, resp.Texts)
+
+	resp, err = generate(t, session, strings.Repeat("long prompt ", 20))
+	gt.NoError(t, err)
+	gt.S(t, resp.Texts[0]).HasPrefix("large: ")
+
+	_, err = generate(t, session, strings.Repeat("too long prompt ", 100))
+	gt.Error(t, err).Is(router.ErrNoRoute)
+}
+
+func TestSelectCheapest(t *testing.T) {
+	expensive := &provider{name: "expensive"}
+	unpriced := &provider{name: "unpriced"}
+	cheap := &provider{name: "cheap", fail: func(n int) error { return errRateLimited }}
+	client, err := router.New([]*router.Route{
+		unpriced.route(0, nil),
+		expensive.route(0, &gollem.Pricing{InputPerMillion: 3, OutputPerMillion: 15}),
+		cheap.route(0, &gollem.Pricing{InputPerMillion: 0.1, OutputPerMillion: 0.4}),
+	}, router.WithSelection(router.SelectCheapest))
+	gt.NoError(t, err)
+	session, err := client.NewSession(t.Context())
+	gt.NoError(t, err)
+
+	// The cheapest route fails, so the next cheapest one takes the call
+	resp, err := generate(t, session, "hello")
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"expensive: hello"}, resp.Texts)
+	gt.Equal(t, 1, cheap.callCount())
+	gt.Equal(t, 0, unpriced.callCount())
+}
+
+func TestNew(t *testing.T) {
+	_, err := router.New(nil)
+	gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+
+	_, err = router.New([]*router.Route{{Name: "empty"}})
+	gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+
+	p := &provider{name: "p"}
+	_, err = router.New([]*router.Route{p.route(0, nil)}, router.WithSelection("random"))
+	gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+}
@@ -0,0 +1,258 @@
+package router
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// Session is a gollem.Session of a Client. Each call goes to the routes selected for the
+// prompt, and the session of the route succeeded becomes the current one that holds the
+// conversation. The next call tries the routes again from the first, so the conversation
+// returns to the primary route when it recovers.
+type Session struct {
+	client       *Client
+	options      []gollem.SessionOption
+	systemPrompt string
+
+	mu sync.Mutex
+	// history is the history before the first successful call
+	history *gollem.History
+	current *Route
+	session gollem.Session
+}
+
+// Generate generates a response by the first route that succeeds.
+func (s *Session) Generate(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+	var resp *gollem.Response
+	err := s.call(ctx, input, func(ctx context.Context, session gollem.Session) error {
+		var err error
+		resp, err = session.Generate(ctx, input, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Stream generates a response stream by the first route that starts the stream. It does not
+// fall back once the stream has started.
+func (s *Session) Stream(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+	var ch <-chan *gollem.Response
+	err := s.call(ctx, input, func(ctx context.Context, session gollem.Session) error {
+		var err error
+		ch, err = session.Stream(ctx, input, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// StreamContent generates a response stream iterated by gollem.Stream.
+func (s *Session) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return s.Stream(ctx, input, opts...)
+	})
+}
+
+// Deprecated: GenerateContent is deprecated. Use Generate instead.
+func (s *Session) GenerateContent(ctx context.Context, input ...gollem.Input) (*gollem.Response, error) {
+	return s.Generate(ctx, input)
+}
+
+// Deprecated: GenerateStream is deprecated. Use Stream instead.
+func (s *Session) GenerateStream(ctx context.Context, input ...gollem.Input) (<-chan *gollem.Response, error) {
+	return s.Stream(ctx, input)
+}
+
+// History returns the history of the current route, or the initial history before the first
+// successful call.
+func (s *Session) History() (*gollem.History, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.currentHistory()
+}
+
+// AppendHistory appends h to the history of the current route, converted to its provider.
+func (s *Session) AppendHistory(h *gollem.History) error {
+	if h == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != nil {
+		converted, _, err := convertHistory(h, s.current.LLMType)
+		if err != nil {
+			return err
+		}
+		return s.session.AppendHistory(converted)
+	}
+
+	if s.history == nil {
+		s.history = h.Clone()
+		return nil
+	}
+	converted, _, err := convertHistory(h, s.history.LLType)
+	if err != nil {
+		return err
+	}
+	s.history.Messages = append(s.history.Messages, converted.Messages...)
+	return nil
+}
+
+// CountToken counts tokens by the current route, or the first route that can take the prompt
+// before the first successful call.
+func (s *Session) CountToken(ctx context.Context, input ...gollem.Input) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != nil {
+		return s.session.CountToken(ctx, input...)
+	}
+
+	routes, err := s.candidates(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+	session, _, err := s.newSession(ctx, routes[0])
+	if err != nil {
+		return 0, err
+	}
+	return session.CountToken(ctx, input...)
+}
+
+// call calls fn with the session of each route selected for input until it succeeds, and makes
+// the route the current one.
+func (s *Session) call(ctx context.Context, input []gollem.Input, fn func(ctx context.Context, session gollem.Session) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes, err := s.candidates(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	for i, route := range routes {
+		session, conversion, err := s.sessionOf(ctx, route)
+		if err == nil {
+			err = fn(ctx, session)
+		}
+		if err == nil {
+			if route != s.current {
+				s.switchTo(ctx, route, session, conversion)
+			}
+			return nil
+		}
+
+		if i == len(routes)-1 || ctx.Err() != nil || !s.client.fallbackOn(err) {
+			return goerr.Wrap(err, "route failed", goerr.V("route", route.Name))
+		}
+
+		event := &FallbackEvent{
+			From:         route.Name,
+			To:           routes[i+1].Name,
+			Error:        err,
+			ErrorMessage: err.Error(),
+		}
+		if s.client.onFallback != nil {
+			s.client.onFallback(ctx, event)
+		}
+		if h := trace.HandlerFrom(ctx); h != nil {
+			h.AddEvent(ctx, "llm_fallback", event)
+		}
+	}
+
+	// unreachable because candidates returns at least one route
+	return nil
+}
+
+// switchTo makes session of route the current one.
+func (s *Session) switchTo(ctx context.Context, route *Route, session gollem.Session, conversion *gollem.HistoryConversionReport) {
+	event := &RouteEvent{To: route.Name, Conversion: conversion}
+	if s.current != nil {
+		event.From = s.current.Name
+	}
+	if h := trace.HandlerFrom(ctx); h != nil {
+		h.AddEvent(ctx, "llm_route", event)
+	}
+
+	s.current, s.session = route, session
+	s.history = nil
+}
+
+// sessionOf returns the current session if route is the current one, or a new session of route
+// with the history carried over.
+func (s *Session) sessionOf(ctx context.Context, route *Route) (gollem.Session, *gollem.HistoryConversionReport, error) {
+	if route == s.current {
+		return s.session, nil, nil
+	}
+	return s.newSession(ctx, route)
+}
+
+// newSession creates a session of route with the current history converted to its provider.
+func (s *Session) newSession(ctx context.Context, route *Route) (gollem.Session, *gollem.HistoryConversionReport, error) {
+	history, err := s.currentHistory()
+	if err != nil {
+		return nil, nil, err
+	}
+	history, report, err := convertHistory(history, route.LLMType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := append(slices.Clone(s.options), gollem.WithSessionHistory(history))
+	session, err := route.Client.NewSession(ctx, options...)
+	if err != nil {
+		return nil, nil, goerr.Wrap(err, "failed to create session of route", goerr.V("route", route.Name))
+	}
+	return session, report, nil
+}
+
+// currentHistory returns the history of the current session, or the initial history.
+func (s *Session) currentHistory() (*gollem.History, error) {
+	if s.session == nil {
+		return s.history.Clone(), nil
+	}
+	history, err := s.session.History()
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to get history of route", goerr.V("route", s.current.Name))
+	}
+	return history, nil
+}
+
+// candidates returns the routes that can take input with the current history. Tokens are
+// counted by the Tokenizer of ctx.
+func (s *Session) candidates(ctx context.Context, input []gollem.Input) ([]*Route, error) {
+	history, err := s.currentHistory()
+	if err != nil {
+		return nil, err
+	}
+	tokens := gollem.CountRequestTokens(gollem.TokenizerFromContext(ctx), &gollem.ContentRequest{
+		Inputs:       input,
+		History:      history,
+		SystemPrompt: s.systemPrompt,
+	})
+	return s.client.candidates(tokens)
+}
+
+// convertHistory converts history to llmType. The report is nil if history is not converted
+// because it's nil, of the same type, or either type is unknown.
+func convertHistory(history *gollem.History, llmType gollem.LLMType) (*gollem.History, *gollem.HistoryConversionReport, error) {
+	if history == nil || llmType == "" || history.LLType == "" || history.LLType == llmType {
+		return history, nil, nil
+	}
+	converted, report, err := history.ConvertTo(llmType)
+	if err != nil {
+		return nil, nil, goerr.Wrap(err, "failed to convert history", goerr.V("from", history.LLType), goerr.V("to", llmType))
+	}
+	return converted, report, nil
+}
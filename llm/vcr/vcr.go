@@ -0,0 +1,411 @@
+// Package vcr records HTTP interactions of LLM provider clients to a cassette file and replays
+// them, so that tests depending on a provider API run deterministically without API keys. A
+// Recorder works as a gollem.HTTPMiddleware and is set by WithHTTPMiddleware option of each
+// provider client. Record a cassette once with a real API key, commit it, and replay it in CI.
+package vcr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// CassetteVersion is the version of the cassette file format.
+const CassetteVersion = 1
+
+// Mode is the mode of a Recorder.
+type Mode string
+
+const (
+	// ModeReplay returns recorded responses and never sends requests to the provider. A request
+	// without a matching interaction fails with ErrInteractionNotFound.
+	ModeReplay Mode = "replay"
+
+	// ModeRecord sends requests to the provider and records the interactions. An existing
+	// cassette is overwritten by the first recorded interaction.
+	ModeRecord Mode = "record"
+
+	// ModeAuto replays the cassette if it exists, and records a new one otherwise.
+	ModeAuto Mode = "auto"
+)
+
+// ErrInteractionNotFound is returned in ModeReplay when no recorded interaction matches the request.
+var ErrInteractionNotFound = errors.New("no recorded interaction matches the request")
+
+// RedactedValue replaces values of redacted query parameters in recorded URLs.
+const RedactedValue = "REDACTED"
+
+// defaultRedactHeaders are request headers that carry credentials of provider APIs. They are
+// not recorded.
+var defaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"Api-Key",
+	"X-Goog-Api-Key",
+	"X-Amz-Security-Token",
+}
+
+// defaultRedactQueries are query parameters that carry credentials of provider APIs.
+var defaultRedactQueries = []string{"key"}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a pair of a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request. Credentials are removed from Header and URL.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+// Response is a recorded HTTP response. A streaming response is recorded as its whole body.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body"`
+}
+
+// Body is a recorded HTTP body. It's encoded in a cassette as a string if it's valid UTF-8,
+// e.g. JSON or server-sent events, and as base64 otherwise, e.g. AWS event streams.
+type Body []byte
+
+// MarshalJSON implements json.Marshaler.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(map[string]string{"text": string(b)})
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Text   string `json:"text"`
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return goerr.Wrap(err, "failed to unmarshal body")
+	}
+	if v.Base64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(v.Base64)
+		if err != nil {
+			return goerr.Wrap(err, "failed to decode base64 body")
+		}
+		*b = decoded
+		return nil
+	}
+	*b = []byte(v.Text)
+	return nil
+}
+
+// Matcher reports whether req with body matches a recorded request. The URL of req is already
+// redacted in the same way as recorded ones.
+type Matcher func(req *http.Request, body []byte, recorded *Request) bool
+
+// DefaultMatcher matches requests by method, URL and body. JSON bodies are compared
+// semantically, so that the order of object keys does not matter.
+func DefaultMatcher(req *http.Request, body []byte, recorded *Request) bool {
+	return req.URL.String() == recorded.URL && BodyMatcher(req, body, recorded)
+}
+
+// BodyMatcher matches requests by method and body, ignoring the URL. Use it for Vertex AI of
+// the Gemini client, whose URLs contain the project ID, to replay with another project ID.
+func BodyMatcher(req *http.Request, body []byte, recorded *Request) bool {
+	return req.Method == recorded.Method && bytes.Equal(normalizeJSON(body), normalizeJSON(recorded.Body))
+}
+
+// normalizeJSON returns data re-encoded with sorted object keys, or data as it is if it's not JSON.
+func normalizeJSON(data []byte) []byte {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return normalized
+}
+
+// Recorder records and replays HTTP interactions with a cassette file.
+type Recorder struct {
+	path          string
+	mode          Mode
+	matcher       Matcher
+	redactHeaders []string
+	redactQueries []string
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// Option is the type for the options of Recorder.
+type Option func(*Recorder)
+
+// WithMode sets the mode of the recorder. Default is ModeReplay.
+func WithMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.mode = mode
+	}
+}
+
+// WithMatcher sets the function to find the recorded interaction of a request. Default is
+// DefaultMatcher. Use it if requests contain values that change on every run, e.g. timestamps.
+func WithMatcher(matcher Matcher) Option {
+	return func(r *Recorder) {
+		r.matcher = matcher
+	}
+}
+
+// WithRedactHeaders adds request headers not to be recorded, in addition to the headers of
+// API keys and authorization of the provider clients.
+func WithRedactHeaders(names ...string) Option {
+	return func(r *Recorder) {
+		r.redactHeaders = append(r.redactHeaders, names...)
+	}
+}
+
+// WithRedactQueries adds query parameters to be redacted in recorded URLs, in addition to "key".
+func WithRedactQueries(names ...string) Option {
+	return func(r *Recorder) {
+		r.redactQueries = append(r.redactQueries, names...)
+	}
+}
+
+// New creates a Recorder with the cassette file at path. In ModeReplay, the cassette must
+// exist. ModeAuto is resolved to ModeReplay or ModeRecord here.
+func New(path string, options ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:          path,
+		mode:          ModeReplay,
+		matcher:       DefaultMatcher,
+		redactHeaders: append([]string{}, defaultRedactHeaders...),
+		redactQueries: append([]string{}, defaultRedactQueries...),
+		cassette:      &Cassette{Version: CassetteVersion},
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+
+	switch r.mode {
+	case ModeAuto:
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		} else if errors.Is(err, os.ErrNotExist) {
+			r.mode = ModeRecord
+		} else {
+			return nil, goerr.Wrap(err, "failed to check cassette", goerr.V("path", path))
+		}
+	case ModeReplay, ModeRecord:
+	default:
+		return nil, goerr.New("invalid mode", goerr.V("mode", r.mode))
+	}
+
+	if r.mode == ModeReplay {
+		cassette, err := loadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = cassette
+		r.used = make([]bool, len(cassette.Interactions))
+	}
+
+	return r, nil
+}
+
+func loadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to read cassette", goerr.V("path", path))
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal cassette", goerr.V("path", path))
+	}
+	if cassette.Version != CassetteVersion {
+		return nil, goerr.New("unsupported cassette version",
+			goerr.V("path", path),
+			goerr.V("version", cassette.Version))
+	}
+	return &cassette, nil
+}
+
+// Mode returns the mode of the recorder, which is ModeReplay or ModeRecord. Tests can skip
+// when it's ModeRecord and no API key is available.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Middleware returns the HTTP middleware to pass to WithHTTPMiddleware option of a provider
+// client. Set it as the last middleware so that the recorded requests are the ones sent.
+func (r *Recorder) Middleware() gollem.HTTPMiddleware {
+	return func(next gollem.HTTPHandler) gollem.HTTPHandler {
+		return func(req *http.Request) (*http.Response, error) {
+			body, err := readRequestBody(req)
+			if err != nil {
+				return nil, err
+			}
+			if r.mode == ModeReplay {
+				return r.replay(req, body)
+			}
+			return r.record(req, body, next)
+		}
+	}
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	redacted := req.Clone(req.Context())
+	redacted.URL = r.redactURL(req.URL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.matcher(redacted, body, &interaction.Request) {
+			continue
+		}
+		r.used[i] = true
+
+		resp := interaction.Response
+		header := resp.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+		return &http.Response{
+			Status:        strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode),
+			StatusCode:    resp.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+			ContentLength: int64(len(resp.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, goerr.Wrap(ErrInteractionNotFound, "failed to replay request",
+		goerr.V("method", req.Method),
+		goerr.V("url", redacted.URL.String()),
+		goerr.V("path", r.path))
+}
+
+func (r *Recorder) record(req *http.Request, body []byte, next gollem.HTTPHandler) (*http.Response, error) {
+	resp, err := next(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to read response body")
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	header := req.Header.Clone()
+	for _, name := range r.redactHeaders {
+		header.Del(name)
+	}
+	respHeader := resp.Header.Clone()
+	respHeader.Del("Set-Cookie")
+
+	interaction := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.redactURL(req.URL).String(),
+			Header: header,
+			Body:   body,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     respHeader,
+			Body:       respBody,
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// save writes the cassette to the file. The cassette is saved on every recorded interaction,
+// so that no close is required.
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal cassette")
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return goerr.Wrap(err, "failed to create cassette directory", goerr.V("path", r.path))
+	}
+	if err := os.WriteFile(r.path, data, 0o644); err != nil {
+		return goerr.Wrap(err, "failed to write cassette", goerr.V("path", r.path))
+	}
+	return nil
+}
+
+// redactURL returns a copy of u whose credential query parameters are replaced.
+func (r *Recorder) redactURL(u *url.URL) *url.URL {
+	redacted := *u
+	query := redacted.Query()
+	changed := false
+	for _, name := range r.redactQueries {
+		if query.Has(name) {
+			query.Set(name, RedactedValue)
+			changed = true
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return &redacted
+}
+
+// readRequestBody reads the body of req and replaces it with an unread copy.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to read request body")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
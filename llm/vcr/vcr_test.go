@@ -0,0 +1,132 @@
+package vcr_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/claude"
+	"github.com/m-mizutani/gollem/llm/vcr"
+	"github.com/m-mizutani/gt"
+)
+
+const claudeResponse = `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`
+
+func generate(t *testing.T, baseURL, apiKey string, rec *vcr.Recorder, prompt string) (*gollem.Response, error) {
+	t.Helper()
+	client, err := claude.New(t.Context(), apiKey,
+		claude.WithBaseURL(baseURL),
+		claude.WithHTTPMiddleware(rec.Middleware()),
+	)
+	gt.NoError(t, err)
+	session, err := client.NewSession(t.Context())
+	gt.NoError(t, err)
+	return session.Generate(t.Context(), []gollem.Input{gollem.Text(prompt)})
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(claudeResponse))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "testdata", "claude.json")
+
+	rec, err := vcr.New(path, vcr.WithMode(vcr.ModeRecord))
+	gt.NoError(t, err)
+	gt.Equal(t, vcr.ModeRecord, rec.Mode())
+	resp, err := generate(t, srv.URL, "secret-api-key", rec, "hello")
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"ok"}, resp.Texts)
+	gt.Equal(t, 1, calls)
+
+	data, err := os.ReadFile(path)
+	gt.NoError(t, err)
+	gt.S(t, string(data)).Contains("hello")
+	gt.S(t, string(data)).NotContains("secret-api-key")
+
+	t.Run("replay without calling the provider", func(t *testing.T) {
+		rec, err := vcr.New(path)
+		gt.NoError(t, err)
+		gt.Equal(t, vcr.ModeReplay, rec.Mode())
+		resp, err := generate(t, srv.URL, "dummy", rec, "hello")
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"ok"}, resp.Texts)
+		gt.Equal(t, 1, calls)
+
+		// Each interaction is replayed once
+		_, err = generate(t, srv.URL, "dummy", rec, "hello")
+		gt.Error(t, err).Is(vcr.ErrInteractionNotFound)
+	})
+
+	t.Run("request not recorded", func(t *testing.T) {
+		rec, err := vcr.New(path)
+		gt.NoError(t, err)
+		_, err = generate(t, srv.URL, "dummy", rec, "goodbye")
+		gt.Error(t, err).Is(vcr.ErrInteractionNotFound)
+		gt.Equal(t, 1, calls)
+	})
+
+	t.Run("auto mode replays existing cassette", func(t *testing.T) {
+		rec, err := vcr.New(path, vcr.WithMode(vcr.ModeAuto))
+		gt.NoError(t, err)
+		gt.Equal(t, vcr.ModeReplay, rec.Mode())
+
+		rec, err = vcr.New(filepath.Join(t.TempDir(), "new.json"), vcr.WithMode(vcr.ModeAuto))
+		gt.NoError(t, err)
+		gt.Equal(t, vcr.ModeRecord, rec.Mode())
+	})
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := vcr.New(filepath.Join(t.TempDir(), "missing.json"))
+	gt.Error(t, err).Is(os.ErrNotExist)
+}
+
+func TestBinaryBodyAndQueryRedaction(t *testing.T) {
+	binary := []byte{0x00, 0x00, 0x00, 0x10, 0xff, 0xfe, 'o', 'k'}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		w.Header().Set("Set-Cookie", "session=secret-cookie")
+		_, _ = w.Write(binary)
+	}))
+	defer srv.Close()
+
+	send := func(rec *vcr.Recorder) []byte {
+		client := &http.Client{Transport: gollem.NewHTTPTransport(nil, rec.Middleware())}
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			srv.URL+"/v1/stream?alt=sse&key=secret-query-key", bytes.NewReader([]byte(`{"b":1,"a":2}`)))
+		gt.NoError(t, err)
+		resp, err := client.Do(req)
+		gt.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		gt.NoError(t, err)
+		return body
+	}
+
+	path := filepath.Join(t.TempDir(), "stream.json")
+	rec, err := vcr.New(path, vcr.WithMode(vcr.ModeRecord))
+	gt.NoError(t, err)
+	gt.Equal(t, binary, send(rec))
+
+	data, err := os.ReadFile(path)
+	gt.NoError(t, err)
+	gt.S(t, string(data)).NotContains("secret-query-key")
+	gt.S(t, string(data)).NotContains("secret-cookie")
+	gt.S(t, string(data)).Contains("base64")
+
+	srv.Close()
+	rec, err = vcr.New(path)
+	gt.NoError(t, err)
+	gt.Equal(t, binary, send(rec))
+}
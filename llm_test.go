@@ -5,12 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/llm/bedrock"
 	"github.com/m-mizutani/gollem/llm/claude"
 	"github.com/m-mizutani/gollem/llm/gemini"
 	"github.com/m-mizutani/gollem/llm/openai"
@@ -106,6 +109,21 @@ func TestToolExecution(t *testing.T) {
 			return gemini.New(context.Background(), projectID, location, opts...)
 		})
 	})
+
+	t.Run("Bedrock", func(t *testing.T) {
+		t.Parallel()
+		region, ok := os.LookupEnv("TEST_BEDROCK_REGION")
+		if !ok {
+			t.Skip("TEST_BEDROCK_REGION is not set")
+		}
+		opts := []bedrock.Option{bedrock.WithRegion(region)}
+		if model := os.Getenv("TEST_BEDROCK_MODEL"); model != "" {
+			opts = append(opts, bedrock.WithModel(model))
+		}
+		testFn(t, func(t *testing.T) (gollem.LLMClient, error) {
+			return bedrock.New(context.Background(), opts...)
+		})
+	})
 }
 
 // TestContentMiddleware tests content middleware functionality with real LLM clients
@@ -446,6 +464,75 @@ func TestNewPDF(t *testing.T) {
 	})
 }
 
+func TestNewImageURL(t *testing.T) {
+	t.Run("MIME type is detected from extension", func(t *testing.T) {
+		img, err := gollem.NewImageURL("https://example.com/photos/cat.JPG?size=large")
+		gt.NoError(t, err)
+		gt.Equal(t, "https://example.com/photos/cat.JPG?size=large", img.URL())
+		gt.Equal(t, "image/jpeg", img.MimeType())
+	})
+
+	t.Run("unknown extension", func(t *testing.T) {
+		img, err := gollem.NewImageURL("https://example.com/image")
+		gt.NoError(t, err)
+		gt.Equal(t, "", img.MimeType())
+	})
+
+	t.Run("explicit MIME type", func(t *testing.T) {
+		img, err := gollem.NewImageURL("https://example.com/image", gollem.WithMimeType(gollem.ImageMimeTypeWebP))
+		gt.NoError(t, err)
+		gt.Equal(t, "image/webp", img.MimeType())
+	})
+
+	t.Run("not http", func(t *testing.T) {
+		_, err := gollem.NewImageURL("file:///tmp/a.png")
+		gt.Error(t, err)
+		_, err = gollem.NewImageURL("a.png")
+		gt.Error(t, err)
+	})
+}
+
+func TestNewFile(t *testing.T) {
+	t.Run("text file", func(t *testing.T) {
+		f, err := gollem.NewFile([]byte("a,b\n1,2\n"), "text/csv; charset=utf-8", gollem.WithFileName("data.csv"))
+		gt.NoError(t, err)
+		gt.Equal(t, "text/csv", f.MimeType())
+		gt.Equal(t, "data.csv", f.Name())
+		gt.True(t, f.IsText())
+	})
+
+	t.Run("binary file", func(t *testing.T) {
+		f, err := gollem.NewFile([]byte{0x50, 0x4b, 0x03, 0x04}, "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+		gt.NoError(t, err)
+		gt.False(t, f.IsText())
+		gt.Equal(t, "", f.Name())
+	})
+
+	t.Run("application/json is text", func(t *testing.T) {
+		f, err := gollem.NewFile([]byte(`{}`), "application/json")
+		gt.NoError(t, err)
+		gt.True(t, f.IsText())
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := gollem.NewFile(nil, "text/plain")
+		gt.Error(t, err)
+		_, err = gollem.NewFile([]byte("x"), "")
+		gt.Error(t, err)
+		_, err = gollem.NewFile([]byte("x"), "image/png")
+		gt.Error(t, err)
+		_, err = gollem.NewFile([]byte("not a pdf"), "application/pdf")
+		gt.Error(t, err)
+		_, err = gollem.NewFile([]byte("12345"), "text/plain", gollem.WithMaxFileSize(4))
+		gt.Error(t, err)
+	})
+
+	t.Run("reader exceeding the limit", func(t *testing.T) {
+		_, err := gollem.NewFileFromReader(strings.NewReader("12345"), "text/plain", gollem.WithMaxFileSize(4))
+		gt.Error(t, err)
+	})
+}
+
 // TestPDFContent tests PDFContent serialization/deserialization
 func TestPDFContent(t *testing.T) {
 	pdfData := []byte("%PDF-1.4 test content")
@@ -646,3 +733,36 @@ func countSpansByKind(span *trace.Span, kind trace.SpanKind) int {
 	}
 	return count
 }
+
+func TestHTTPMiddleware(t *testing.T) {
+	var order []string
+	newMiddleware := func(name string) gollem.HTTPMiddleware {
+		return func(next gollem.HTTPHandler) gollem.HTTPHandler {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+":req")
+				req.Header.Set("X-"+name, "1")
+				resp, err := next(req)
+				order = append(order, name+":resp")
+				return resp, err
+			}
+		}
+	}
+
+	var received http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: gollem.NewHTTPTransport(nil, newMiddleware("A"), newMiddleware("B")),
+	}
+	resp, err := client.Get(srv.URL)
+	gt.NoError(t, err)
+	gt.NoError(t, resp.Body.Close())
+
+	gt.Equal(t, []string{"A:req", "B:req", "B:resp", "A:resp"}, order)
+	gt.Equal(t, "1", received.Get("X-A"))
+	gt.Equal(t, "1", received.Get("X-B"))
+}
@@ -0,0 +1,206 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnitSystem is the system of units of measurement.
+type UnitSystem string
+
+const (
+	// UnitSystemMetric is the International System of Units, e.g. km, kg and °C.
+	UnitSystemMetric UnitSystem = "metric"
+
+	// UnitSystemImperial is the US customary units, e.g. miles, pounds and °F.
+	UnitSystemImperial UnitSystem = "imperial"
+)
+
+// Locale is the formatting convention of output for the user. Empty fields are not instructed
+// to the LLM and fall back to the defaults of the formatting methods.
+type Locale struct {
+	// Tag is the BCP 47 language tag such as "ja-JP".
+	Tag string
+
+	// TimeZone is the IANA time zone name such as "Asia/Tokyo" in which dates and times are
+	// shown.
+	TimeZone string
+
+	// DateFormat and TimeFormat are Go time layouts such as "2006/01/02" and "15:04".
+	DateFormat string
+	TimeFormat string
+
+	// DecimalSeparator and GroupSeparator are the separators of numbers such as "." and ",".
+	DecimalSeparator string
+	GroupSeparator   string
+
+	UnitSystem UnitSystem
+
+	// Currency is the ISO 4217 currency code such as "JPY".
+	Currency string
+}
+
+// Preset locales. Copy and modify them to set TimeZone or other conventions.
+var (
+	LocaleEnUS = Locale{
+		Tag: "en-US", DateFormat: "01/02/2006", TimeFormat: "3:04 PM",
+		DecimalSeparator: ".", GroupSeparator: ",", UnitSystem: UnitSystemImperial, Currency: "USD",
+	}
+	LocaleEnGB = Locale{
+		Tag: "en-GB", DateFormat: "02/01/2006", TimeFormat: "15:04",
+		DecimalSeparator: ".", GroupSeparator: ",", UnitSystem: UnitSystemMetric, Currency: "GBP",
+	}
+	LocaleDeDE = Locale{
+		Tag: "de-DE", DateFormat: "02.01.2006", TimeFormat: "15:04",
+		DecimalSeparator: ",", GroupSeparator: ".", UnitSystem: UnitSystemMetric, Currency: "EUR",
+	}
+	LocaleFrFR = Locale{
+		Tag: "fr-FR", DateFormat: "02/01/2006", TimeFormat: "15:04",
+		DecimalSeparator: ",", GroupSeparator: "\u202f", UnitSystem: UnitSystemMetric, Currency: "EUR",
+	}
+	LocaleJaJP = Locale{
+		Tag: "ja-JP", DateFormat: "2006/01/02", TimeFormat: "15:04",
+		DecimalSeparator: ".", GroupSeparator: ",", UnitSystem: UnitSystemMetric, Currency: "JPY",
+	}
+)
+
+// WithLocale sets the locale of the agent. Formatting instructions of the locale are appended to
+// the system prompt, and the locale is set to ctx of Execute so that built-in helpers such as
+// reasoning summaries and history compaction, and tools by LocaleFromContext, format output
+// consistently.
+func WithLocale(locale Locale) Option {
+	return func(s *gollemConfig) {
+		s.locale = &locale
+	}
+}
+
+type localeCtxKey struct{}
+
+// ContextWithLocale returns a context with locale.
+func ContextWithLocale(ctx context.Context, locale Locale) context.Context {
+	return context.WithValue(ctx, localeCtxKey{}, &locale)
+}
+
+// LocaleFromContext returns the locale set by ContextWithLocale or WithLocale, or nil.
+func LocaleFromContext(ctx context.Context) *Locale {
+	locale, _ := ctx.Value(localeCtxKey{}).(*Locale)
+	return locale
+}
+
+// localeSampleTime is the time used to show the date and time formats by example.
+var localeSampleTime = time.Date(2026, time.March, 14, 15, 4, 0, 0, time.UTC)
+
+// Prompt returns the formatting instructions of the locale for the LLM.
+func (l Locale) Prompt() string {
+	var lines []string
+	if l.Tag != "" {
+		lines = append(lines, "- Locale: "+l.Tag)
+	}
+	if l.TimeZone != "" {
+		lines = append(lines, "- Time zone: show dates and times in "+l.TimeZone)
+	}
+	if l.DateFormat != "" {
+		lines = append(lines, fmt.Sprintf("- Dates: e.g. %s for March 14, 2026", localeSampleTime.Format(l.DateFormat)))
+	}
+	if l.TimeFormat != "" {
+		lines = append(lines, fmt.Sprintf("- Times: e.g. %s for 15:04", localeSampleTime.Format(l.TimeFormat)))
+	}
+	if l.DecimalSeparator != "" || l.GroupSeparator != "" {
+		lines = append(lines, fmt.Sprintf("- Numbers: e.g. %s for 1234567.89", l.FormatNumber(1234567.89, 2)))
+	}
+	switch l.UnitSystem {
+	case UnitSystemMetric:
+		lines = append(lines, "- Units: metric (km, kg, °C), converting other units")
+	case UnitSystemImperial:
+		lines = append(lines, "- Units: US customary (miles, pounds, °F), converting other units")
+	}
+	if l.Currency != "" {
+		lines = append(lines, "- Currency: "+l.Currency)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "# Output Format\n\nFormat dates, times, numbers and units in your output for the user's locale:\n" +
+		strings.Join(lines, "\n")
+}
+
+// appendLocalePrompt returns prompt followed by the instructions of locale, if any.
+func appendLocalePrompt(prompt string, locale *Locale) string {
+	if locale == nil {
+		return prompt
+	}
+	instructions := locale.Prompt()
+	switch {
+	case instructions == "":
+		return prompt
+	case prompt == "":
+		return instructions
+	default:
+		return prompt + "\n\n" + instructions
+	}
+}
+
+// Location returns the location of TimeZone, or UTC if TimeZone is empty or unknown.
+func (l Locale) Location() *time.Location {
+	if l.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(l.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// FormatDate formats the date of t in TimeZone by DateFormat, or "2006-01-02" if it's empty.
+func (l Locale) FormatDate(t time.Time) string {
+	layout := l.DateFormat
+	if layout == "" {
+		layout = time.DateOnly
+	}
+	return t.In(l.Location()).Format(layout)
+}
+
+// FormatDateTime formats t in TimeZone by DateFormat and TimeFormat, or "15:04" if TimeFormat
+// is empty.
+func (l Locale) FormatDateTime(t time.Time) string {
+	layout := l.TimeFormat
+	if layout == "" {
+		layout = "15:04"
+	}
+	return l.FormatDate(t) + " " + t.In(l.Location()).Format(layout)
+}
+
+// FormatNumber formats v with decimals digits after the decimal point, using DecimalSeparator
+// ("." if empty) and GroupSeparator (no grouping if empty).
+func (l Locale) FormatNumber(v float64, decimals int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	intPart, fracPart, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, r := range intPart {
+		if i > 0 && l.GroupSeparator != "" && (len(intPart)-i)%3 == 0 {
+			b.WriteString(l.GroupSeparator)
+		}
+		b.WriteRune(r)
+	}
+	if fracPart != "" {
+		sep := l.DecimalSeparator
+		if sep == "" {
+			sep = "."
+		}
+		b.WriteString(sep + fracPart)
+	}
+	return b.String()
+}
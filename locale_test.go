@@ -0,0 +1,89 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestLocaleFormat(t *testing.T) {
+	ts := time.Date(2026, time.March, 14, 20, 30, 0, 0, time.UTC)
+
+	t.Run("presets", func(t *testing.T) {
+		testCases := map[string]struct {
+			locale   gollem.Locale
+			date     string
+			number   string
+			dateTime string
+		}{
+			"en-US": {locale: gollem.LocaleEnUS, date: "03/14/2026", number: "1,234,567.89", dateTime: "03/14/2026 8:30 PM"},
+			"de-DE": {locale: gollem.LocaleDeDE, date: "14.03.2026", number: "1.234.567,89", dateTime: "14.03.2026 20:30"},
+			"fr-FR": {locale: gollem.LocaleFrFR, date: "14/03/2026", number: "1\u202f234\u202f567,89", dateTime: "14/03/2026 20:30"},
+			"ja-JP": {locale: gollem.LocaleJaJP, date: "2026/03/14", number: "1,234,567.89", dateTime: "2026/03/14 20:30"},
+		}
+		for name, tc := range testCases {
+			t.Run(name, func(t *testing.T) {
+				gt.Equal(t, tc.date, tc.locale.FormatDate(ts))
+				gt.Equal(t, tc.dateTime, tc.locale.FormatDateTime(ts))
+				gt.Equal(t, tc.number, tc.locale.FormatNumber(1234567.891, 2))
+			})
+		}
+	})
+
+	t.Run("time zone", func(t *testing.T) {
+		locale := gollem.LocaleJaJP
+		locale.TimeZone = "Asia/Tokyo"
+		gt.Equal(t, "2026/03/15 05:30", locale.FormatDateTime(ts))
+	})
+
+	t.Run("numbers", func(t *testing.T) {
+		gt.Equal(t, "-1,000", gollem.LocaleEnUS.FormatNumber(-999.6, 0))
+		gt.Equal(t, "0.00", gollem.LocaleEnUS.FormatNumber(-0.001, 2))
+		gt.Equal(t, "123", gollem.LocaleEnUS.FormatNumber(123, 0))
+		gt.Equal(t, "1234.5", gollem.Locale{}.FormatNumber(1234.5, 1))
+	})
+
+	t.Run("empty locale", func(t *testing.T) {
+		gt.Equal(t, "", gollem.Locale{}.Prompt())
+		gt.Equal(t, "2026-03-14 20:30", gollem.Locale{}.FormatDateTime(ts))
+	})
+}
+
+func TestWithLocale(t *testing.T) {
+	var systemPrompt string
+	var localeInCtx *gollem.Locale
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			systemPrompt = cfg.SystemPrompt()
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					localeInCtx = gollem.LocaleFromContext(ctx)
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+			}, nil
+		},
+	}
+
+	locale := gollem.LocaleDeDE
+	locale.TimeZone = "Europe/Berlin"
+	agent := gollem.New(client, gollem.WithSystemPrompt("You are helpful."), gollem.WithLocale(locale))
+	_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+
+	gt.True(t, strings.HasPrefix(systemPrompt, "You are helpful.\n\n# Output Format"))
+	gt.S(t, systemPrompt).Contains("- Locale: de-DE")
+	gt.S(t, systemPrompt).Contains("- Time zone: show dates and times in Europe/Berlin")
+	gt.S(t, systemPrompt).Contains("- Dates: e.g. 14.03.2026")
+	gt.S(t, systemPrompt).Contains("- Numbers: e.g. 1.234.567,89")
+	gt.S(t, systemPrompt).Contains("- Units: metric")
+	gt.S(t, systemPrompt).Contains("- Currency: EUR")
+
+	gt.NotNil(t, localeInCtx)
+	gt.Equal(t, locale, *localeInCtx)
+}
@@ -0,0 +1,244 @@
+package mcp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// HealthPolicy is the policy to decide whether the MCP server is healthy by the recent calls.
+type HealthPolicy struct {
+	// Window is the number of the recent calls for ErrorRate and Latency of Health.
+	Window int
+	// MinCalls is the number of calls in the window needed to judge by the error rate. The
+	// server is healthy while it's connected and has fewer calls.
+	MinCalls int
+	// MaxErrorRate is the error rate in the window above which the server is unhealthy.
+	MaxErrorRate float64
+}
+
+// DefaultHealthPolicy returns the policy judging by the last 20 calls, and considering the
+// server unhealthy if more than half of at least 5 calls failed.
+func DefaultHealthPolicy() *HealthPolicy {
+	return &HealthPolicy{
+		Window:       20,
+		MinCalls:     5,
+		MaxErrorRate: 0.5,
+	}
+}
+
+// WithMCPHealthPolicy sets the policy of Health. DefaultHealthPolicy is used by default.
+func WithMCPHealthPolicy(policy *HealthPolicy) Option {
+	return func(c *Client) {
+		c.health.policy = policy
+	}
+}
+
+// Health is the health of the MCP server seen by the client. Calls are requests of tool lists
+// and tool calls; a call fails if the request fails, not if the tool returns an error result.
+type Health struct {
+	// Server is the name of the server in its initialize result, or the URL or the command of
+	// the server if it has no name
+	Server string `json:"server"`
+	// Connected is true if the client has a session with the server
+	Connected bool `json:"connected"`
+	// Healthy is true if the server is connected and the error rate is not above the policy
+	Healthy bool `json:"healthy"`
+
+	// LastSuccess is when the last successful call finished, zero if none
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	// LastError is the error of the last failed call, and LastErrorAt is when it failed
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+
+	// Calls and Errors are the numbers of all calls and failed calls
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+	// ErrorRate is the ratio of failed calls in the window of HealthPolicy
+	ErrorRate float64 `json:"error_rate"`
+	// Latency is the average latency of calls in the window of HealthPolicy
+	Latency time.Duration `json:"latency"`
+}
+
+// callResult is a call in the window of health.
+type callResult struct {
+	failed  bool
+	latency time.Duration
+}
+
+// healthTracker records calls of the client.
+type healthTracker struct {
+	policy *HealthPolicy
+
+	mu          sync.Mutex
+	window      []callResult
+	next        int
+	calls       int64
+	errors      int64
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// record records a call finished at with err after latency.
+func (h *healthTracker) record(err error, latency time.Duration, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	size := h.policyOrDefault().Window
+	result := callResult{failed: err != nil, latency: latency}
+	if len(h.window) < size {
+		h.window = append(h.window, result)
+	} else if size > 0 {
+		h.window[h.next%size] = result
+		h.next = (h.next + 1) % size
+	}
+
+	h.calls++
+	if err != nil {
+		h.errors++
+		h.lastError = err.Error()
+		h.lastErrorAt = at
+	} else {
+		h.lastSuccess = at
+	}
+}
+
+func (h *healthTracker) policyOrDefault() *HealthPolicy {
+	if h.policy == nil {
+		h.policy = DefaultHealthPolicy()
+	}
+	return h.policy
+}
+
+// Health returns the health of the MCP server by the recent calls of the client.
+func (c *Client) Health() Health {
+	conn := c.currentConnection()
+	connected := conn != nil
+	if connected {
+		select {
+		case <-conn.done:
+			connected = false
+		default:
+		}
+	}
+
+	h := &c.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	health := Health{
+		Server:      c.serverName(conn),
+		Connected:   connected,
+		LastSuccess: h.lastSuccess,
+		LastError:   h.lastError,
+		LastErrorAt: h.lastErrorAt,
+		Calls:       h.calls,
+		Errors:      h.errors,
+	}
+
+	var failed int
+	var latency time.Duration
+	for _, result := range h.window {
+		if result.failed {
+			failed++
+		}
+		latency += result.latency
+	}
+	if n := len(h.window); n > 0 {
+		health.ErrorRate = float64(failed) / float64(n)
+		health.Latency = latency / time.Duration(n)
+	}
+
+	policy := h.policyOrDefault()
+	health.Healthy = connected && (len(h.window) < policy.MinCalls || health.ErrorRate <= policy.MaxErrorRate)
+	return health
+}
+
+// serverName returns the name of the server for Health.
+func (c *Client) serverName(conn *connection) string {
+	if conn != nil {
+		if init := conn.session.InitializeResult(); init != nil && init.ServerInfo != nil && init.ServerInfo.Name != "" {
+			return init.ServerInfo.Name
+		}
+	}
+	return c.endpoint
+}
+
+// ToolSetHealth implements gollem.ToolSetHealthReporter, so that gollem.WithUnhealthyToolSets
+// deprioritizes or hides tools of the server while it's unhealthy.
+func (c *Client) ToolSetHealth() gollem.ToolSetHealth {
+	health := c.Health()
+	switch {
+	case health.Healthy:
+		return gollem.ToolSetHealth{Healthy: true}
+	case !health.Connected:
+		return gollem.ToolSetHealth{Reason: "disconnected"}
+	default:
+		return gollem.ToolSetHealth{Reason: fmt.Sprintf("error rate %.2f", health.ErrorRate)}
+	}
+}
+
+// WriteMetrics writes the health of clients to w in the Prometheus text exposition format.
+// Metrics have the label "server" of Health.Server.
+func WriteMetrics(w io.Writer, clients ...*Client) error {
+	healths := make([]Health, len(clients))
+	for i, client := range clients {
+		healths[i] = client.Health()
+	}
+
+	metrics := []struct {
+		name, kind, help string
+		value            func(h Health) float64
+	}{
+		{"gollem_mcp_connected", "gauge", "1 if the client is connected to the MCP server", func(h Health) float64 { return boolMetric(h.Connected) }},
+		{"gollem_mcp_healthy", "gauge", "1 if the MCP server is healthy", func(h Health) float64 { return boolMetric(h.Healthy) }},
+		{"gollem_mcp_calls_total", "counter", "Number of calls to the MCP server", func(h Health) float64 { return float64(h.Calls) }},
+		{"gollem_mcp_errors_total", "counter", "Number of failed calls to the MCP server", func(h Health) float64 { return float64(h.Errors) }},
+		{"gollem_mcp_error_rate", "gauge", "Ratio of failed calls in the recent calls", func(h Health) float64 { return h.ErrorRate }},
+		{"gollem_mcp_latency_seconds", "gauge", "Average latency of the recent calls", func(h Health) float64 { return h.Latency.Seconds() }},
+		{"gollem_mcp_last_success_timestamp_seconds", "gauge", "Unix time of the last successful call, 0 if none", func(h Health) float64 {
+			if h.LastSuccess.IsZero() {
+				return 0
+			}
+			return float64(h.LastSuccess.UnixMilli()) / 1000
+		}},
+	}
+
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, h := range healths {
+			fmt.Fprintf(&b, "%s{server=\"%s\"} %g\n", m.name, labelEscaper.Replace(h.Server), m.value(h))
+		}
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return goerr.Wrap(err, "failed to write MCP metrics")
+	}
+	return nil
+}
+
+// MetricsHandler returns the HTTP handler serving WriteMetrics of clients, e.g. for /metrics
+// scraped by Prometheus.
+func MetricsHandler(clients ...*Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WriteMetrics(w, clients...)
+	})
+}
+
+func boolMetric(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// labelEscaper escapes a label value of the Prometheus text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
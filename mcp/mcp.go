@@ -3,11 +3,16 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
@@ -26,24 +31,116 @@ const (
 type Client struct {
 	// Official SDK client
 	mcpClient *mcp.Client
-	session   *mcp.ClientSession
 
 	// Configuration
 	name    string
 	version string
 
 	// Transport related
-	transport mcp.Transport
-	cmd       *exec.Cmd // For stdio transport
-	baseURL   string    // For StreamableHTTP transport
+	newTransport func() (mcp.Transport, *exec.Cmd)
+	baseURL      string // For StreamableHTTP and SSE transport
+	endpoint     string // URL or command of the server for Health
 
 	// Options
-	envVars    []string
-	headers    map[string]string
-	httpClient *http.Client // For StreamableHTTP transport
+	envVars      []string
+	headers      map[string]string
+	httpClient   *http.Client // For StreamableHTTP transport
+	reconnect    *ReconnectPolicy
+	toolsRefresh time.Duration
+
+	// Request metadata and notifications
+	noRequestMetadata   bool
+	notificationHandler NotificationHandler
+	progressCalls       sync.Map // progress token -> gollem.RequestMetadata of the call
+	progressSeq         atomic.Int64
 
 	// Connection management
 	initMutex sync.Mutex
+	conn      *connection
+	closed    bool
+
+	// Cache of the tool list, enabled by WithMCPToolRefresh
+	toolsMutex     sync.Mutex
+	tools          []*mcp.Tool
+	toolsFetchedAt time.Time
+
+	// Health of the server by the calls
+	health healthTracker
+}
+
+// connection is a session with the MCP server over a transport.
+type connection struct {
+	session *mcp.ClientSession
+	cmd     *exec.Cmd     // For stdio transport
+	done    chan struct{} // Closed when the connection is closed
+}
+
+// Option is the option for the MCP client of any transport.
+type Option func(*Client)
+
+// ReconnectPolicy is the policy to reconnect to the MCP server when the connection is lost.
+type ReconnectPolicy struct {
+	// MaxAttempts is the number of connection attempts before giving up.
+	MaxAttempts int
+	// BaseDelay is the delay after the first failed attempt. It's doubled for each attempt.
+	BaseDelay time.Duration
+	// MaxDelay is the upper limit of the delay between attempts.
+	MaxDelay time.Duration
+	// OnReconnect is called after each attempt if set.
+	OnReconnect func(ctx context.Context, event *ReconnectEvent)
+}
+
+// ReconnectEvent is the result of a reconnection attempt.
+type ReconnectEvent struct {
+	// Attempt is the number of the attempt, starting from 1.
+	Attempt int
+	// Cause is the error of the call that lost the connection.
+	Cause error
+	// Error is the error of the attempt, nil if reconnected.
+	Error error
+}
+
+// DefaultReconnectPolicy returns the policy trying 5 times with exponential backoff from 500ms
+// up to 10s.
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+// Delay returns the delay after the failed attempt.
+func (p *ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// WithMCPReconnect reconnects to the MCP server by policy when the connection is lost, e.g. the
+// server process exits or the server restarts. A call of Specs or Run failed by the lost
+// connection is retried once after reconnecting, so a tool call may run twice if the connection
+// is lost after the server received it. Without this option, the client fails permanently once
+// the connection is lost.
+func WithMCPReconnect(policy *ReconnectPolicy) Option {
+	return func(c *Client) {
+		c.reconnect = policy
+	}
+}
+
+// WithMCPToolRefresh caches the tool list of the server and refreshes it after interval, so
+// that Specs called by every Execute of agents does not request the server each time. The cache
+// is also refreshed when the server notifies that the tool list has changed, and after
+// reconnecting. Without this option, Specs requests the tool list every time.
+func WithMCPToolRefresh(interval time.Duration) Option {
+	return func(c *Client) {
+		c.toolsRefresh = interval
+	}
 }
 
 // Specs implements gollem.ToolSet interface
@@ -80,7 +177,7 @@ func (c *Client) Run(ctx context.Context, name string, args map[string]any) (map
 }
 
 // StdioOption is the option for the MCP client for local MCP server via Stdio.
-type StdioOption func(*Client)
+type StdioOption = Option
 
 // WithEnvVars sets the environment variables for the MCP client.
 func WithEnvVars(envVars []string) StdioOption {
@@ -97,25 +194,26 @@ func WithStdioClientInfo(name, version string) StdioOption {
 	}
 }
 
-// NewStdio creates a new MCP client for local MCP executable server via stdio.
+// NewStdio creates a new MCP client for local MCP executable server via stdio. With
+// WithMCPReconnect, the server process is started again when it exits.
 func NewStdio(ctx context.Context, path string, args []string, options ...StdioOption) (*Client, error) {
 	client := &Client{
-		name:    DefaultClientName,
-		version: DefaultClientVersion,
+		name:     DefaultClientName,
+		version:  DefaultClientVersion,
+		endpoint: path,
 	}
 	for _, option := range options {
 		option(client)
 	}
 
-	// Create command with environment variables inheriting from the current process
-	cmd := exec.Command(path, args...)
-	cmd.Env = append(os.Environ(), client.envVars...)
-
-	// Create transport
-	transport := &mcp.StdioTransport{}
-	client.transport = transport
+	client.newTransport = func() (mcp.Transport, *exec.Cmd) {
+		// Create command with environment variables inheriting from the current process
+		cmd := exec.Command(path, args...)
+		cmd.Env = append(os.Environ(), client.envVars...)
+		return &mcp.CommandTransport{Command: cmd}, cmd
+	}
 
-	if err := client.init(ctx, cmd); err != nil {
+	if err := client.init(ctx); err != nil {
 		return nil, goerr.Wrap(err, "failed to initialize MCP client")
 	}
 
@@ -129,14 +227,22 @@ func NewSSE(ctx context.Context, baseURL string, options ...SSEOption) (*Client,
 		version:    DefaultClientVersion,
 		headers:    make(map[string]string),
 		baseURL:    baseURL,
+		endpoint:   baseURL,
 		httpClient: http.DefaultClient,
 	}
 	for _, option := range options {
 		option(client)
 	}
 
+	client.newTransport = func() (mcp.Transport, *exec.Cmd) {
+		return &mcp.SSEClientTransport{
+			Endpoint:   client.baseURL,
+			HTTPClient: client.httpClient,
+		}, nil
+	}
+
 	// Initialize the client and connect
-	if err := client.initSSE(ctx); err != nil {
+	if err := client.init(ctx); err != nil {
 		return nil, goerr.Wrap(err, "failed to initialize SSE client")
 	}
 
@@ -144,7 +250,7 @@ func NewSSE(ctx context.Context, baseURL string, options ...SSEOption) (*Client,
 }
 
 // SSEOption is the option for the MCP client for remote MCP server via SSE.
-type SSEOption func(*Client)
+type SSEOption = Option
 
 // WithSSEHeaders sets the headers for the MCP client. It replaces the existing headers setting.
 func WithSSEHeaders(headers map[string]string) SSEOption {
@@ -169,7 +275,7 @@ func WithSSEClientInfo(name, version string) SSEOption {
 }
 
 // StreamableHTTPOption is the option for the MCP client for remote MCP server via Streamable HTTP.
-type StreamableHTTPOption func(*Client)
+type StreamableHTTPOption = Option
 
 // WithStreamableHTTPHeaders sets the headers for the MCP client. It replaces the existing headers setting.
 func WithStreamableHTTPHeaders(headers map[string]string) StreamableHTTPOption {
@@ -200,25 +306,33 @@ func NewStreamableHTTP(ctx context.Context, baseURL string, options ...Streamabl
 		version:    DefaultClientVersion,
 		headers:    make(map[string]string),
 		baseURL:    baseURL,
+		endpoint:   baseURL,
 		httpClient: http.DefaultClient,
 	}
 	for _, option := range options {
 		option(client)
 	}
 
+	client.newTransport = func() (mcp.Transport, *exec.Cmd) {
+		return &mcp.StreamableClientTransport{
+			Endpoint:   client.baseURL,
+			HTTPClient: client.httpClient,
+		}, nil
+	}
+
 	// Initialize the client and connect
-	if err := client.initStreamableHTTP(ctx); err != nil {
+	if err := client.init(ctx); err != nil {
 		return nil, goerr.Wrap(err, "failed to initialize StreamableHTTP client")
 	}
 
 	return client, nil
 }
 
-func (c *Client) init(ctx context.Context, cmd *exec.Cmd) error {
+func (c *Client) init(ctx context.Context) error {
 	c.initMutex.Lock()
 	defer c.initMutex.Unlock()
 
-	if c.session != nil {
+	if c.conn != nil {
 		return nil
 	}
 
@@ -227,129 +341,243 @@ func (c *Client) init(ctx context.Context, cmd *exec.Cmd) error {
 		Name:    c.name,
 		Version: c.version,
 	}
-	c.mcpClient = mcp.NewClient(impl, nil)
+	opts := &mcp.ClientOptions{
+		ToolListChangedHandler: func(ctx context.Context, req *mcp.ToolListChangedRequest) {
+			c.invalidateTools()
+		},
+	}
+	if c.notificationHandler != nil {
+		opts.LoggingMessageHandler = c.handleLoggingMessage
+		opts.ProgressNotificationHandler = c.handleProgress
+	}
+	c.mcpClient = mcp.NewClient(impl, opts)
 
-	// Connect using stdio transport with command
-	if cmd != nil {
-		transport := &mcp.CommandTransport{
-			Command: cmd,
-		}
-		session, err := c.mcpClient.Connect(ctx, transport, nil)
-		if err != nil {
-			return goerr.Wrap(err, "failed to connect to MCP server")
+	return c.connect(ctx)
+}
+
+// connect starts a new session with the MCP server over a new transport. initMutex must be held.
+func (c *Client) connect(ctx context.Context) error {
+	transport, cmd := c.newTransport()
+	session, err := c.mcpClient.Connect(ctx, transport, nil)
+	if err != nil {
+		return goerr.Wrap(err, "failed to connect to MCP server")
+	}
+
+	if c.notificationHandler != nil {
+		if init := session.InitializeResult(); init != nil && init.Capabilities != nil && init.Capabilities.Logging != nil {
+			if err := session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: notificationLoggingLevel}); err != nil {
+				_ = session.Close()
+				return goerr.Wrap(err, "failed to set logging level of MCP server")
+			}
 		}
-		c.session = session
-		c.cmd = cmd
 	}
 
+	conn := &connection{session: session, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		_ = session.Wait()
+		close(conn.done)
+	}()
+	c.conn = conn
+	c.invalidateTools()
 	return nil
 }
 
-func (c *Client) initStreamableHTTP(ctx context.Context) error {
+// currentConnection returns the current connection, or nil if the client is not connected.
+func (c *Client) currentConnection() *connection {
 	c.initMutex.Lock()
 	defer c.initMutex.Unlock()
+	return c.conn
+}
 
-	if c.session != nil {
-		return nil
+// do calls fn with the session of the current connection. If fn fails by a lost connection and
+// WithMCPReconnect is set, it reconnects and calls fn again.
+func (c *Client) do(ctx context.Context, fn func(session *mcp.ClientSession) error) error {
+	conn := c.currentConnection()
+	if conn == nil {
+		return goerr.New("session not initialized")
 	}
 
-	// Create client with official SDK using Implementation struct
-	impl := &mcp.Implementation{
-		Name:    c.name,
-		Version: c.version,
+	err := c.call(ctx, conn, fn)
+	if err == nil || c.reconnect == nil || ctx.Err() != nil || !conn.lost(err) {
+		return err
 	}
-	c.mcpClient = mcp.NewClient(impl, nil)
 
-	// Create StreamableHTTP transport
-	transport := &mcp.StreamableClientTransport{
-		Endpoint:   c.baseURL,
-		HTTPClient: c.httpClient,
+	conn, reconnectErr := c.reconnectFrom(ctx, conn, err)
+	if reconnectErr != nil {
+		return goerr.Wrap(reconnectErr, "failed to reconnect to MCP server", goerr.V("cause", err))
 	}
+	return c.call(ctx, conn, fn)
+}
 
-	// Connect using StreamableHTTP transport
-	session, err := c.mcpClient.Connect(ctx, transport, nil)
-	if err != nil {
-		return goerr.Wrap(err, "failed to connect to StreamableHTTP MCP server")
+// call calls fn with the session of conn and records the result to the health. Calls canceled
+// by ctx are not recorded, as they tell nothing about the server.
+func (c *Client) call(ctx context.Context, conn *connection, fn func(session *mcp.ClientSession) error) error {
+	startedAt := time.Now()
+	err := fn(conn.session)
+	if ctx.Err() == nil {
+		c.health.record(err, time.Since(startedAt), gollem.Now(ctx))
 	}
-	c.session = session
-	c.transport = transport
+	return err
+}
 
-	return nil
+// lost reports whether err of a call is caused by the lost connection.
+func (conn *connection) lost(err error) bool {
+	select {
+	case <-conn.done:
+		return true
+	default:
+	}
+
+	var opErr *net.OpError
+	return errors.Is(err, mcp.ErrConnectionClosed) ||
+		errors.Is(err, mcp.ErrSessionMissing) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &opErr)
 }
 
-func (c *Client) initSSE(ctx context.Context) error {
+// reconnectFrom replaces the lost connection with a new one by the reconnect policy. If another
+// call has already reconnected, it returns the new connection.
+func (c *Client) reconnectFrom(ctx context.Context, lost *connection, cause error) (*connection, error) {
 	c.initMutex.Lock()
 	defer c.initMutex.Unlock()
 
-	if c.session != nil {
-		return nil
+	if c.closed {
+		return nil, goerr.New("client is closed")
 	}
-
-	// Create client with official SDK using Implementation struct
-	impl := &mcp.Implementation{
-		Name:    c.name,
-		Version: c.version,
+	if c.conn != lost {
+		return c.conn, nil
 	}
-	c.mcpClient = mcp.NewClient(impl, nil)
+	c.conn = nil
+	_ = lost.close()
 
-	// Create SSE transport
-	transport := &mcp.SSEClientTransport{
-		Endpoint:   c.baseURL,
-		HTTPClient: c.httpClient,
-	}
+	policy := c.reconnect
+	for attempt := 1; ; attempt++ {
+		err := c.connect(ctx)
+		if policy.OnReconnect != nil {
+			policy.OnReconnect(ctx, &ReconnectEvent{Attempt: attempt, Cause: cause, Error: err})
+		}
+		if err == nil {
+			return c.conn, nil
+		}
+		if attempt >= policy.MaxAttempts {
+			return nil, goerr.Wrap(err, "reconnection attempts exhausted", goerr.V("attempts", attempt))
+		}
 
-	// Connect using SSE transport
-	session, err := c.mcpClient.Connect(ctx, transport, nil)
-	if err != nil {
-		return goerr.Wrap(err, "failed to connect to SSE MCP server")
+		timer := time.NewTimer(policy.Delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, goerr.Wrap(ctx.Err(), "reconnection canceled", goerr.V("error", err))
+		}
 	}
-	c.session = session
-	c.transport = transport
-
-	return nil
 }
 
 func (c *Client) listTools(ctx context.Context) ([]*mcp.Tool, error) {
-	if c.session == nil {
-		return nil, goerr.New("session not initialized")
+	if c.toolsRefresh > 0 {
+		c.toolsMutex.Lock()
+		if c.tools != nil && time.Since(c.toolsFetchedAt) < c.toolsRefresh {
+			tools := c.tools
+			c.toolsMutex.Unlock()
+			return tools, nil
+		}
+		c.toolsMutex.Unlock()
 	}
 
-	resp, err := c.session.ListTools(ctx, &mcp.ListToolsParams{})
+	var tools []*mcp.Tool
+	fetchedAt := time.Now()
+	err := c.do(ctx, func(session *mcp.ClientSession) error {
+		resp, err := session.ListTools(ctx, &mcp.ListToolsParams{})
+		if err != nil {
+			return goerr.Wrap(err, "failed to list tools")
+		}
+		tools = resp.Tools
+		return nil
+	})
 	if err != nil {
-		return nil, goerr.Wrap(err, "failed to list tools")
+		return nil, err
 	}
 
-	return resp.Tools, nil
+	if c.toolsRefresh > 0 {
+		c.toolsMutex.Lock()
+		// The list may be changed by a notification while it's fetched
+		if c.toolsFetchedAt.Before(fetchedAt) {
+			c.tools, c.toolsFetchedAt = tools, fetchedAt
+		}
+		c.toolsMutex.Unlock()
+	}
+	return tools, nil
 }
 
-func (c *Client) callTool(ctx context.Context, name string, args map[string]any) (*mcp.CallToolResult, error) {
-	if c.session == nil {
-		return nil, goerr.New("session not initialized")
-	}
+// invalidateTools drops the cached tool list so that it's fetched again.
+func (c *Client) invalidateTools() {
+	c.toolsMutex.Lock()
+	defer c.toolsMutex.Unlock()
+	c.tools = nil
+	c.toolsFetchedAt = time.Now()
+}
 
+func (c *Client) callTool(ctx context.Context, name string, args map[string]any) (*mcp.CallToolResult, error) {
 	params := &mcp.CallToolParams{
 		Name:      name,
 		Arguments: args,
 	}
 
-	resp, err := c.session.CallTool(ctx, params)
+	metadata := gollem.RequestMetadataFromContext(ctx)
+	meta := mcp.Meta{}
+	if !c.noRequestMetadata {
+		meta = encodeRequestMetadata(metadata)
+	}
+	if c.notificationHandler != nil {
+		token := fmt.Sprintf("gollem-%d", c.progressSeq.Add(1))
+		meta["progressToken"] = token
+		c.progressCalls.Store(token, metadata)
+		// Notifications may be handled after the response, so the call is kept for a while
+		defer time.AfterFunc(progressRetention, func() { c.progressCalls.Delete(token) })
+	}
+	if len(meta) > 0 {
+		params.Meta = meta
+	}
+
+	var resp *mcp.CallToolResult
+	err := c.do(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		resp, err = session.CallTool(ctx, params)
+		if err != nil {
+			return goerr.Wrap(err, "failed to call tool")
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, goerr.Wrap(err, "failed to call tool")
+		return nil, err
 	}
 
 	return resp, nil
 }
 
 func (c *Client) Close() error {
-	if c.session != nil {
-		if err := c.session.Close(); err != nil {
-			return goerr.Wrap(err, "failed to close MCP session")
-		}
+	c.initMutex.Lock()
+	defer c.initMutex.Unlock()
+
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	conn := c.conn
+	c.conn = nil
+	return conn.close()
+}
+
+// close closes the session and stops the server process of stdio transport.
+func (conn *connection) close() error {
+	if err := conn.session.Close(); err != nil {
+		return goerr.Wrap(err, "failed to close MCP session")
 	}
 
 	// Clean up stdio command process if it exists
-	if c.cmd != nil && c.cmd.Process != nil {
-		if err := c.cmd.Process.Kill(); err != nil {
+	if conn.cmd != nil && conn.cmd.Process != nil {
+		if err := conn.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
 			return goerr.Wrap(err, "failed to kill MCP server process")
 		}
 	}
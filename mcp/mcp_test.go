@@ -1,13 +1,17 @@
 package mcp_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/mcp"
@@ -863,3 +867,363 @@ func TestRecursiveSchemaConversion(t *testing.T) {
 		},
 	}))
 }
+
+// swappableHandler serves HTTP requests by the current handler, to simulate a server restart.
+type swappableHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (h *swappableHandler) set(handler http.Handler) {
+	h.handler.Store(&handler)
+}
+
+func (h *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.handler.Load()).ServeHTTP(w, r)
+}
+
+func newEchoServer() *officialmcp.Server {
+	server := officialmcp.NewServer(&officialmcp.Implementation{Name: "test-server", Version: "1.0.0"}, nil)
+	addEchoTool(server, "echo")
+	return server
+}
+
+func addEchoTool(server *officialmcp.Server, name string) {
+	server.AddTool(&officialmcp.Tool{
+		Name:        name,
+		Description: "echo the message",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{"msg": map[string]any{"type": "string"}}},
+	}, func(ctx context.Context, req *officialmcp.CallToolRequest) (*officialmcp.CallToolResult, error) {
+		var input struct {
+			Msg string `json:"msg"`
+		}
+		if err := json.Unmarshal(req.Params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return &officialmcp.CallToolResult{
+			Content: []officialmcp.Content{&officialmcp.TextContent{Text: input.Msg}},
+		}, nil
+	})
+}
+
+func newStreamableHandler(server *officialmcp.Server) http.Handler {
+	return officialmcp.NewStreamableHTTPHandler(func(r *http.Request) *officialmcp.Server {
+		return server
+	}, nil)
+}
+
+func TestReconnect(t *testing.T) {
+	t.Run("reconnect after server restart", func(t *testing.T) {
+		var handler swappableHandler
+		handler.set(newStreamableHandler(newEchoServer()))
+		httpServer := httptest.NewServer(&handler)
+		defer httpServer.Close()
+
+		var events []*mcp.ReconnectEvent
+		policy := &mcp.ReconnectPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   10 * time.Millisecond,
+			OnReconnect: func(ctx context.Context, event *mcp.ReconnectEvent) {
+				events = append(events, event)
+			},
+		}
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL, mcp.WithMCPReconnect(policy))
+		gt.NoError(t, err)
+		defer client.Close()
+
+		result, err := client.Run(t.Context(), "echo", map[string]any{"msg": "before"})
+		gt.NoError(t, err)
+		gt.Equal(t, result["result"], any("before"))
+
+		// The restarted server does not know the session
+		handler.set(newStreamableHandler(newEchoServer()))
+
+		result, err = client.Run(t.Context(), "echo", map[string]any{"msg": "after"})
+		gt.NoError(t, err)
+		gt.Equal(t, result["result"], any("after"))
+		gt.A(t, events).Length(1)
+		gt.Equal(t, events[0].Attempt, 1)
+		gt.NoError(t, events[0].Error)
+		gt.Error(t, events[0].Cause)
+	})
+
+	t.Run("no reconnect without policy", func(t *testing.T) {
+		var handler swappableHandler
+		handler.set(newStreamableHandler(newEchoServer()))
+		httpServer := httptest.NewServer(&handler)
+		defer httpServer.Close()
+
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL)
+		gt.NoError(t, err)
+		defer client.Close()
+
+		handler.set(newStreamableHandler(newEchoServer()))
+
+		_, err = client.Run(t.Context(), "echo", map[string]any{"msg": "after"})
+		gt.Error(t, err)
+	})
+
+	t.Run("give up after max attempts", func(t *testing.T) {
+		var handler swappableHandler
+		handler.set(newStreamableHandler(newEchoServer()))
+		httpServer := httptest.NewServer(&handler)
+		defer httpServer.Close()
+
+		var attempts int
+		policy := &mcp.ReconnectPolicy{
+			MaxAttempts: 2,
+			BaseDelay:   time.Millisecond,
+			OnReconnect: func(ctx context.Context, event *mcp.ReconnectEvent) {
+				attempts = event.Attempt
+			},
+		}
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL, mcp.WithMCPReconnect(policy))
+		gt.NoError(t, err)
+		defer client.Close()
+
+		// The server is gone from the URL
+		handler.set(http.NotFoundHandler())
+
+		_, err = client.Run(t.Context(), "echo", map[string]any{"msg": "after"})
+		gt.Error(t, err)
+		gt.Equal(t, attempts, 2)
+	})
+}
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := &mcp.ReconnectPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	gt.Equal(t, policy.Delay(1), 100*time.Millisecond)
+	gt.Equal(t, policy.Delay(2), 200*time.Millisecond)
+	gt.Equal(t, policy.Delay(4), 800*time.Millisecond)
+	gt.Equal(t, policy.Delay(5), time.Second)
+	gt.Equal(t, policy.Delay(100), time.Second)
+}
+
+func TestToolRefresh(t *testing.T) {
+	toolNames := func(specs []gollem.ToolSpec) []string {
+		names := make([]string, len(specs))
+		for i, spec := range specs {
+			names[i] = spec.Name
+		}
+		return names
+	}
+
+	t.Run("refresh by notification", func(t *testing.T) {
+		server := newEchoServer()
+		httpServer := httptest.NewServer(newStreamableHandler(server))
+		defer httpServer.Close()
+
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL, mcp.WithMCPToolRefresh(time.Hour))
+		gt.NoError(t, err)
+		defer client.Close()
+
+		specs, err := client.Specs(t.Context())
+		gt.NoError(t, err)
+		gt.A(t, toolNames(specs)).Length(1).Has("echo")
+
+		addEchoTool(server, "echo2")
+
+		var names []string
+		for range 100 {
+			specs, err = client.Specs(t.Context())
+			gt.NoError(t, err)
+			if names = toolNames(specs); len(names) == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		gt.A(t, names).Length(2).Has("echo2")
+	})
+
+	t.Run("cached until interval", func(t *testing.T) {
+		var lists atomic.Int32
+		server := newEchoServer()
+		server.AddReceivingMiddleware(func(next officialmcp.MethodHandler) officialmcp.MethodHandler {
+			return func(ctx context.Context, method string, req officialmcp.Request) (officialmcp.Result, error) {
+				if method == "tools/list" {
+					lists.Add(1)
+				}
+				return next(ctx, method, req)
+			}
+		})
+		httpServer := httptest.NewServer(newStreamableHandler(server))
+		defer httpServer.Close()
+
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL, mcp.WithMCPToolRefresh(50*time.Millisecond))
+		gt.NoError(t, err)
+		defer client.Close()
+
+		for range 3 {
+			_, err := client.Specs(t.Context())
+			gt.NoError(t, err)
+		}
+		gt.Equal(t, lists.Load(), int32(1))
+
+		time.Sleep(60 * time.Millisecond)
+		_, err = client.Specs(t.Context())
+		gt.NoError(t, err)
+		gt.Equal(t, lists.Load(), int32(2))
+	})
+}
+
+func TestRequestMetadata(t *testing.T) {
+	server := officialmcp.NewServer(&officialmcp.Implementation{Name: "test-server", Version: "1.0.0"}, nil)
+	server.AddTool(&officialmcp.Tool{
+		Name:        "meta",
+		Description: "return _meta of the call",
+		InputSchema: map[string]any{"type": "object"},
+	}, func(ctx context.Context, req *officialmcp.CallToolRequest) (*officialmcp.CallToolResult, error) {
+		if token := req.Params.GetProgressToken(); token != nil {
+			if err := req.Session.NotifyProgress(ctx, &officialmcp.ProgressNotificationParams{
+				ProgressToken: token,
+				Message:       "half",
+				Progress:      1,
+				Total:         2,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if err := req.Session.Log(ctx, &officialmcp.LoggingMessageParams{
+			Meta:  officialmcp.Meta{mcp.MetaKeyRequestID: "req-2"},
+			Level: "info",
+			Data:  "done",
+		}); err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(req.Params.Meta)
+		if err != nil {
+			return nil, err
+		}
+		return &officialmcp.CallToolResult{
+			Content: []officialmcp.Content{&officialmcp.TextContent{Text: string(raw)}},
+		}, nil
+	})
+	httpServer := httptest.NewServer(newStreamableHandler(server))
+	defer httpServer.Close()
+
+	ctx := gollem.ContextWithRequestMetadata(t.Context(), gollem.RequestMetadata{
+		RequestID: "req-1",
+		User:      "alice",
+		TraceID:   "trace-1",
+		Values:    map[string]string{"tenant": "acme"},
+	})
+
+	t.Run("metadata is sent in _meta", func(t *testing.T) {
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL)
+		gt.NoError(t, err)
+		defer client.Close()
+
+		resp, err := client.Run(ctx, "meta", map[string]any{})
+		gt.NoError(t, err)
+		gt.Equal[any](t, "req-1", resp[mcp.MetaKeyRequestID])
+		gt.Equal[any](t, "alice", resp[mcp.MetaKeyUser])
+		gt.Equal[any](t, "trace-1", resp[mcp.MetaKeyTraceID])
+		gt.Equal[any](t, map[string]any{"tenant": "acme"}, resp[mcp.MetaKeyValues])
+		gt.Nil(t, resp["progressToken"])
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL, mcp.WithMCPRequestMetadata(false))
+		gt.NoError(t, err)
+		defer client.Close()
+
+		resp, err := client.Run(ctx, "meta", map[string]any{})
+		gt.NoError(t, err)
+		gt.Nil(t, resp[mcp.MetaKeyUser])
+	})
+
+	t.Run("notifications have metadata", func(t *testing.T) {
+		var mu sync.Mutex
+		received := map[string]gollem.RequestMetadata{}
+		var notifications []*mcp.Notification
+		client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL,
+			mcp.WithMCPNotificationHandler(func(ctx context.Context, n *mcp.Notification) {
+				mu.Lock()
+				defer mu.Unlock()
+				received[n.Method] = gollem.RequestMetadataFromContext(ctx)
+				notifications = append(notifications, n)
+			}),
+		)
+		gt.NoError(t, err)
+		defer client.Close()
+
+		resp, err := client.Run(ctx, "meta", map[string]any{})
+		gt.NoError(t, err)
+		gt.NotNil(t, resp["progressToken"])
+
+		for range 100 {
+			mu.Lock()
+			n := len(notifications)
+			mu.Unlock()
+			if n == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		gt.A(t, notifications).Length(2)
+
+		progress := received["notifications/progress"]
+		gt.Equal(t, "req-1", progress.RequestID)
+		gt.Equal(t, "alice", progress.User)
+		gt.Equal(t, map[string]string{"tenant": "acme"}, progress.Values)
+
+		logging := received["notifications/message"]
+		gt.Equal(t, "req-2", logging.RequestID)
+		gt.Equal(t, "", logging.User)
+	})
+}
+
+func TestHealth(t *testing.T) {
+	var handler swappableHandler
+	handler.set(newStreamableHandler(newEchoServer()))
+	httpServer := httptest.NewServer(&handler)
+	defer httpServer.Close()
+
+	client, err := mcp.NewStreamableHTTP(t.Context(), httpServer.URL,
+		mcp.WithMCPHealthPolicy(&mcp.HealthPolicy{Window: 4, MinCalls: 2, MaxErrorRate: 0.5}),
+	)
+	gt.NoError(t, err)
+	defer client.Close()
+
+	health := client.Health()
+	gt.Equal(t, "test-server", health.Server)
+	gt.True(t, health.Connected)
+	gt.True(t, health.Healthy)
+	gt.Equal(t, int64(0), health.Calls)
+
+	_, err = client.Run(t.Context(), "echo", map[string]any{"msg": "hello"})
+	gt.NoError(t, err)
+	health = client.Health()
+	gt.Equal(t, int64(1), health.Calls)
+	gt.False(t, health.LastSuccess.IsZero())
+	gt.True(t, client.ToolSetHealth().Healthy)
+
+	// The server is gone from the URL
+	handler.set(http.NotFoundHandler())
+	for range 2 {
+		_, err = client.Run(t.Context(), "echo", map[string]any{"msg": "hello"})
+		gt.Error(t, err)
+	}
+
+	health = client.Health()
+	gt.Equal(t, int64(3), health.Calls)
+	gt.Equal(t, int64(2), health.Errors)
+	gt.False(t, health.Healthy)
+	gt.S(t, health.LastError).NotEqual("")
+	gt.False(t, client.ToolSetHealth().Healthy)
+
+	var buf bytes.Buffer
+	gt.NoError(t, mcp.WriteMetrics(&buf, client))
+	gt.S(t, buf.String()).
+		Contains("# TYPE gollem_mcp_calls_total counter\n").
+		Contains(`gollem_mcp_calls_total{server="test-server"} 3`).
+		Contains(`gollem_mcp_errors_total{server="test-server"} 2`).
+		Contains(`gollem_mcp_healthy{server="test-server"} 0`)
+
+	gt.NoError(t, client.Close())
+	gt.False(t, client.Health().Connected)
+	gt.Equal(t, gollem.ToolSetHealth{Reason: "disconnected"}, client.ToolSetHealth())
+	// The name of the server is not known without the session
+	gt.Equal(t, httpServer.URL, client.Health().Server)
+}
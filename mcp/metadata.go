@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Keys of _meta of MCP messages for gollem.RequestMetadata. Tool calls have them to tell the
+// request of the agent to the server, and notifications from the server may have them to tell
+// the request they belong to.
+const (
+	MetaKeyRequestID = "gollem/request_id"
+	MetaKeyUser      = "gollem/user"
+	MetaKeyTraceID   = "gollem/trace_id"
+	// MetaKeyValues is the key of an object of gollem.RequestMetadata.Values
+	MetaKeyValues = "gollem/values"
+)
+
+// notificationLoggingLevel is the level of logging messages requested to servers when
+// WithMCPNotificationHandler is set.
+const notificationLoggingLevel = "info"
+
+// progressRetention is how long metadata of a tool call is kept after the response for progress
+// notifications of the call.
+const progressRetention = 30 * time.Second
+
+// Notification is a logging message or a progress notification from the MCP server.
+type Notification struct {
+	// Method is "notifications/message" for logging messages and "notifications/progress" for
+	// progress notifications
+	Method string
+
+	// Level, Logger and Data are of logging messages
+	Level  string
+	Logger string
+	Data   any
+
+	// Message, Progress and Total are of progress notifications of tool calls
+	Message  string
+	Progress float64
+	Total    float64
+
+	// Meta is _meta of the notification
+	Meta map[string]any
+}
+
+// NotificationHandler handles notifications from the MCP server. ctx has the
+// gollem.RequestMetadata of the tool call that a progress notification is for, overwritten by
+// the metadata in _meta of the notification.
+type NotificationHandler func(ctx context.Context, notification *Notification)
+
+// WithMCPNotificationHandler calls handler with logging messages and progress notifications of
+// tool calls from the MCP server. Logging messages of level info and above are requested to
+// servers supporting logging.
+func WithMCPNotificationHandler(handler NotificationHandler) Option {
+	return func(c *Client) {
+		c.notificationHandler = handler
+	}
+}
+
+// WithMCPRequestMetadata sets whether gollem.RequestMetadata of the context of tool calls is
+// sent to the server in _meta of the calls. It's enabled by default; disable it for servers
+// that must not receive user IDs.
+func WithMCPRequestMetadata(enabled bool) Option {
+	return func(c *Client) {
+		c.noRequestMetadata = !enabled
+	}
+}
+
+// encodeRequestMetadata converts metadata into entries of _meta.
+func encodeRequestMetadata(metadata gollem.RequestMetadata) mcp.Meta {
+	meta := mcp.Meta{}
+	for key, value := range map[string]string{
+		MetaKeyRequestID: metadata.RequestID,
+		MetaKeyUser:      metadata.User,
+		MetaKeyTraceID:   metadata.TraceID,
+	} {
+		if value != "" {
+			meta[key] = value
+		}
+	}
+	if len(metadata.Values) > 0 {
+		meta[MetaKeyValues] = metadata.Values
+	}
+	return meta
+}
+
+// decodeRequestMetadata returns the metadata in entries of _meta.
+func decodeRequestMetadata(meta map[string]any) gollem.RequestMetadata {
+	var metadata gollem.RequestMetadata
+	metadata.RequestID, _ = meta[MetaKeyRequestID].(string)
+	metadata.User, _ = meta[MetaKeyUser].(string)
+	metadata.TraceID, _ = meta[MetaKeyTraceID].(string)
+	if values, ok := meta[MetaKeyValues].(map[string]any); ok {
+		metadata.Values = make(map[string]string, len(values))
+		for key, value := range values {
+			metadata.Values[key] = fmt.Sprint(value)
+		}
+	}
+	return metadata
+}
+
+// notify calls the notification handler with ctx having metadata of the call and of meta.
+func (c *Client) notify(ctx context.Context, call gollem.RequestMetadata, notification *Notification) {
+	ctx = gollem.ContextWithRequestMetadata(ctx, call)
+	ctx = gollem.ContextWithRequestMetadata(ctx, decodeRequestMetadata(notification.Meta))
+	c.notificationHandler(ctx, notification)
+}
+
+func (c *Client) handleLoggingMessage(ctx context.Context, req *mcp.LoggingMessageRequest) {
+	c.notify(ctx, gollem.RequestMetadata{}, &Notification{
+		Method: "notifications/message",
+		Level:  string(req.Params.Level),
+		Logger: req.Params.Logger,
+		Data:   req.Params.Data,
+		Meta:   req.Params.Meta,
+	})
+}
+
+func (c *Client) handleProgress(ctx context.Context, req *mcp.ProgressNotificationClientRequest) {
+	var call gollem.RequestMetadata
+	if v, ok := c.progressCalls.Load(fmt.Sprint(req.Params.ProgressToken)); ok {
+		call = v.(gollem.RequestMetadata)
+	}
+	c.notify(ctx, call, &Notification{
+		Method:   "notifications/progress",
+		Message:  req.Params.Message,
+		Progress: req.Params.Progress,
+		Total:    req.Params.Total,
+		Meta:     req.Params.Meta,
+	})
+}
@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+const (
+	// DefaultRecallLimit is the default maximum number of memories added to a prompt.
+	DefaultRecallLimit = 5
+
+	// DefaultMinScore is the default minimum similarity of memories added to a prompt.
+	DefaultMinScore = 0.5
+
+	// DefaultDuplicateScore is the default similarity above which an extracted fact is regarded
+	// as already remembered.
+	DefaultDuplicateScore = 0.95
+)
+
+// extractionPrompt instructs the LLM to extract facts of a conversation worth remembering
+const extractionPrompt = `You extract facts worth remembering for future conversations from a conversation between a user and an assistant.
+
+Extract durable facts such as preferences, decisions, goals, constraints and background of the user or the project. Do not extract greetings, transient details, questions without answers, or facts only useful in this conversation. Write each fact as a self-contained sentence. Return an empty list if there is nothing worth remembering.`
+
+type extraction struct {
+	Facts []string `json:"facts" description:"Facts worth remembering, each a self-contained sentence" required:"true"`
+}
+
+type config struct {
+	store          MemoryStore
+	llm            gollem.LLMClient
+	embedder       gollem.LLMClient
+	dimension      int
+	namespace      func(ctx context.Context) string
+	limit          int
+	minScore       float64
+	duplicateScore float64
+	logger         *slog.Logger
+}
+
+// Option is an option of WithLongTermMemory.
+type Option func(*config)
+
+// WithEmbedder sets the client generating embeddings of dimension, 0 for the default of the
+// model. The default is the client of WithLongTermMemory with the default dimension; set it if
+// the client does not support embeddings, e.g. Claude.
+func WithEmbedder(embedder gollem.LLMClient, dimension int) Option {
+	return func(c *config) {
+		c.embedder = embedder
+		c.dimension = dimension
+	}
+}
+
+// WithNamespace sets the function returning the namespace of memories of an Execute, e.g. the
+// ID of the user in ctx, so users don't recall memories of others. The default namespace is
+// empty.
+func WithNamespace(namespace func(ctx context.Context) string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithRecallLimit sets the maximum number of memories added to a prompt. The default is
+// DefaultRecallLimit.
+func WithRecallLimit(n int) Option {
+	return func(c *config) {
+		c.limit = n
+	}
+}
+
+// WithMinScore sets the minimum similarity of memories to the request to add them to a prompt.
+// The default is DefaultMinScore.
+func WithMinScore(score float64) Option {
+	return func(c *config) {
+		c.minScore = score
+	}
+}
+
+// WithDuplicateScore sets the similarity to a stored memory above which an extracted fact is
+// not stored again. The default is DefaultDuplicateScore.
+func WithDuplicateScore(score float64) Option {
+	return func(c *config) {
+		c.duplicateScore = score
+	}
+}
+
+// WithLogger sets the logger. Errors of recall and extraction are logged instead of failing
+// Execute.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithLongTermMemory gives an agent long-term memory in store. At the beginning of each Execute,
+// memories relevant to the text input are added to the system prompt by a
+// gollem.PromptProvider. After each successful Execute, llm extracts facts worth remembering
+// from the transcript, and new ones are stored with their embeddings. The extraction is an
+// extra LLM call at the end of Execute.
+func WithLongTermMemory(store MemoryStore, llm gollem.LLMClient, options ...Option) gollem.Option {
+	cfg := &config{
+		store:          store,
+		llm:            llm,
+		embedder:       llm,
+		namespace:      func(ctx context.Context) string { return "" },
+		limit:          DefaultRecallLimit,
+		minScore:       DefaultMinScore,
+		duplicateScore: DefaultDuplicateScore,
+		logger:         slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	return gollem.WithOptions(
+		gollem.WithPromptProvider(cfg.recall),
+		gollem.WithConversationEndHook(cfg.remember),
+	)
+}
+
+// recall returns the prompt of memories relevant to the text input.
+func (c *config) recall(ctx context.Context, input []gollem.Input) (string, error) {
+	var texts []string
+	for _, in := range input {
+		if text, ok := in.(gollem.Text); ok && strings.TrimSpace(string(text)) != "" {
+			texts = append(texts, string(text))
+		}
+	}
+	if len(texts) == 0 || c.limit <= 0 {
+		return "", nil
+	}
+
+	vectors, err := c.embed(ctx, []string{strings.Join(texts, "\n")})
+	if err != nil {
+		c.logger.Warn("failed to embed input to recall memories", "error", err)
+		return "", nil
+	}
+	matches, err := c.store.Search(ctx, c.namespace(ctx), vectors[0], c.limit)
+	if err != nil {
+		c.logger.Warn("failed to search memories", "error", err)
+		return "", nil
+	}
+
+	var b strings.Builder
+	for _, match := range matches {
+		if match.Score < c.minScore {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# Memories\n\nFacts remembered from earlier conversations. Use them if they are relevant to the request.\n")
+		}
+		b.WriteString("\n- " + match.Memory.Content)
+	}
+	return b.String(), nil
+}
+
+// remember extracts facts from the transcript of a successful Execute and stores new ones.
+func (c *config) remember(ctx context.Context, event *gollem.ConversationEndEvent) {
+	if event.Error != nil || event.Response == nil || event.Response.Transcript == nil {
+		return
+	}
+	conversation := transcriptText(event.Response.Transcript)
+	if conversation == "" {
+		return
+	}
+
+	if err := c.extract(ctx, conversation); err != nil {
+		c.logger.Warn("failed to remember facts of conversation", "error", err, "exec_id", event.ExecID)
+	}
+}
+
+func (c *config) extract(ctx context.Context, conversation string) error {
+	resp, err := gollem.Query[extraction](ctx, c.llm, "# Conversation\n\n"+conversation,
+		gollem.WithQuerySystemPrompt(extractionPrompt))
+	if err != nil {
+		return goerr.Wrap(err, "failed to extract facts")
+	}
+
+	var facts []string
+	for _, fact := range resp.Data.Facts {
+		if fact = strings.TrimSpace(fact); fact != "" {
+			facts = append(facts, fact)
+		}
+	}
+	if len(facts) == 0 {
+		return nil
+	}
+
+	vectors, err := c.embed(ctx, facts)
+	if err != nil {
+		return err
+	}
+
+	namespace := c.namespace(ctx)
+	var memories []*Memory
+	for i, fact := range facts {
+		matches, err := c.store.Search(ctx, namespace, vectors[i], 1)
+		if err != nil {
+			return goerr.Wrap(err, "failed to search memories")
+		}
+		if len(matches) > 0 && matches[0].Score >= c.duplicateScore {
+			continue
+		}
+		memories = append(memories, &Memory{Namespace: namespace, Content: fact, Vector: vectors[i]})
+	}
+	if len(memories) == 0 {
+		return nil
+	}
+
+	if err := c.store.Add(ctx, memories...); err != nil {
+		return goerr.Wrap(err, "failed to store memories")
+	}
+	return nil
+}
+
+func (c *config) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors, err := c.embedder.GenerateEmbedding(ctx, c.dimension, texts)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to generate embeddings")
+	}
+	if len(vectors) != len(texts) {
+		return nil, goerr.New("number of embeddings does not match the texts",
+			goerr.V("embeddings", len(vectors)), goerr.V("texts", len(texts)))
+	}
+	return vectors, nil
+}
+
+// transcriptText returns the texts of user and assistant messages of history, one per line
+// with the role.
+func transcriptText(history *gollem.History) string {
+	var lines []string
+	for _, msg := range history.Messages {
+		if msg.Role != gollem.RoleUser && msg.Role != gollem.RoleAssistant {
+			continue
+		}
+		for _, content := range msg.Contents {
+			if content.Type != gollem.MessageContentTypeText {
+				continue
+			}
+			if text, err := content.GetTextContent(); err == nil && strings.TrimSpace(text.Text) != "" {
+				lines = append(lines, string(msg.Role)+": "+text.Text)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,130 @@
+package memory_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/memory"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+type userKey struct{}
+
+// newMemoryTestClient returns a client answering "ok" to the agent and facts to extraction
+// queries, embedding texts by counts of keywords. systemPrompts receives the system prompts of
+// agent sessions.
+func newMemoryTestClient(t *testing.T, facts string, systemPrompts *[]string) *mock.LLMClientMock {
+	keywords := []string{"go", "tokyo", "coffee"}
+	textMessage := func(role gollem.MessageRole, text string) gollem.Message {
+		content, err := gollem.NewTextContent(text)
+		gt.NoError(t, err)
+		return gollem.Message{Role: role, Contents: []gollem.MessageContent{content}}
+	}
+
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			if cfg.ContentType() == gollem.ContentTypeJSON {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+						if text := string(input[0].(gollem.Text)); strings.HasPrefix(text, "# Conversation") {
+							gt.True(t, strings.Contains(text, "\nassistant: ok"))
+						}
+						return &gollem.Response{Texts: []string{facts}}, nil
+					},
+					HistoryFunc: func() (*gollem.History, error) { return &gollem.History{}, nil },
+				}, nil
+			}
+
+			*systemPrompts = append(*systemPrompts, cfg.SystemPrompt())
+			var messages []gollem.Message
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					messages = append(messages,
+						textMessage(gollem.RoleUser, string(input[len(input)-1].(gollem.Text))),
+						textMessage(gollem.RoleAssistant, "ok"))
+					return &gollem.Response{Texts: []string{"ok"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{Version: gollem.HistoryVersion, Messages: messages}, nil
+				},
+				AppendHistoryFunc: func(h *gollem.History) error {
+					messages = append(messages, h.Messages...)
+					return nil
+				},
+			}, nil
+		},
+		GenerateEmbeddingFunc: func(ctx context.Context, dimension int, input []string) ([][]float64, error) {
+			vectors := make([][]float64, len(input))
+			for i, text := range input {
+				vectors[i] = make([]float64, len(keywords))
+				for j, keyword := range keywords {
+					vectors[i][j] = float64(strings.Count(strings.ToLower(text), keyword))
+				}
+			}
+			return gollem.NormalizeEmbeddings(vectors), nil
+		},
+	}
+}
+
+func TestWithLongTermMemory(t *testing.T) {
+	namespace := memory.WithNamespace(func(ctx context.Context) string {
+		user, _ := ctx.Value(userKey{}).(string)
+		return user
+	})
+	alice := context.WithValue(t.Context(), userKey{}, "alice")
+	bob := context.WithValue(t.Context(), userKey{}, "bob")
+
+	t.Run("facts are remembered and recalled in another session", func(t *testing.T) {
+		var prompts []string
+		store := memory.NewInMemoryStore()
+		client := newMemoryTestClient(t, `{"facts":["The user writes Go every day.","The user lives in Tokyo."]}`, &prompts)
+
+		agent := gollem.New(client, memory.WithLongTermMemory(store, client, namespace))
+		_, err := agent.Execute(alice, gollem.Text("I use Go at work in Tokyo"))
+		gt.NoError(t, err)
+		gt.Equal(t, 2, store.Len())
+		gt.Equal(t, "", prompts[0])
+
+		// Facts already remembered are not stored again
+		_, err = agent.Execute(alice, gollem.Text("I use Go at work in Tokyo"))
+		gt.NoError(t, err)
+		gt.Equal(t, 2, store.Len())
+
+		// A new agent recalls the relevant memory of the user
+		next := gollem.New(client,
+			gollem.WithSystemPrompt("You are an assistant."),
+			memory.WithLongTermMemory(store, client, namespace, memory.WithRecallLimit(1)))
+		_, err = next.Execute(alice, gollem.Text("Recommend a Go library"))
+		gt.NoError(t, err)
+		gt.Equal(t, "You are an assistant.\n\n# Memories\n\n"+
+			"Facts remembered from earlier conversations. Use them if they are relevant to the request.\n\n"+
+			"- The user writes Go every day.", prompts[1])
+
+		// Memories of other users and irrelevant memories are not recalled
+		other := gollem.New(client, memory.WithLongTermMemory(store, client, namespace))
+		_, err = other.Execute(bob, gollem.Text("Recommend a Go library"))
+		gt.NoError(t, err)
+		gt.Equal(t, "", prompts[2])
+
+		unrelated := gollem.New(client, memory.WithLongTermMemory(store, client, namespace))
+		_, err = unrelated.Execute(alice, gollem.Text("Recommend coffee"))
+		gt.NoError(t, err)
+		gt.Equal(t, "", prompts[3])
+	})
+
+	t.Run("extraction failure does not fail Execute", func(t *testing.T) {
+		var prompts []string
+		store := memory.NewInMemoryStore()
+		client := newMemoryTestClient(t, `not json`, &prompts)
+
+		agent := gollem.New(client, memory.WithLongTermMemory(store, client))
+		resp, err := agent.Execute(t.Context(), gollem.Text("I use Go at work in Tokyo"))
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Has("ok")
+		gt.Equal(t, 0, store.Len())
+	})
+}
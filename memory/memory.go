@@ -0,0 +1,140 @@
+// Package memory provides long-term memory of agents: facts extracted from conversations are
+// stored with their embeddings in a MemoryStore, and the ones relevant to a request are added
+// to the system prompt of later Execute calls, also across sessions. InMemoryStore is an
+// in-process MemoryStore; implement MemoryStore to keep memories in a vector database.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// Memory is a fact remembered by an agent.
+type Memory struct {
+	// ID identifies the memory. It's generated by gollem.NewID if empty when added.
+	ID string `json:"id"`
+
+	// Namespace separates memories, e.g. of each user. Search returns only memories of the
+	// namespace of the query.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Content is the fact in natural language
+	Content string `json:"content"`
+
+	// Vector is the embedding of Content
+	Vector []float64 `json:"vector"`
+
+	// CreatedAt is set by gollem.Now if zero when added
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Match is a memory found by Search with its similarity to the query.
+type Match struct {
+	Memory *Memory
+	Score  float64
+}
+
+// MemoryStore stores memories and searches them by embedding similarity. It must be safe for
+// concurrent use.
+type MemoryStore interface {
+	// Add stores memories. A memory of an existing ID replaces it.
+	Add(ctx context.Context, memories ...*Memory) error
+
+	// Search returns at most limit memories of namespace in order of similarity of their
+	// vectors to vector, highest first.
+	Search(ctx context.Context, namespace string, vector []float64, limit int) ([]*Match, error)
+}
+
+// InMemoryStore is a MemoryStore keeping memories in process and searching them by cosine
+// similarity over all memories of the namespace. Memories are lost when the process exits.
+type InMemoryStore struct {
+	mu       sync.RWMutex
+	memories []*Memory
+}
+
+var _ MemoryStore = (*InMemoryStore)(nil)
+
+// NewInMemoryStore creates an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{}
+}
+
+// Add implements MemoryStore.
+func (x *InMemoryStore) Add(ctx context.Context, memories ...*Memory) error {
+	for _, m := range memories {
+		if m == nil || len(m.Vector) == 0 {
+			return goerr.New("memory must have a vector")
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, m := range memories {
+		stored := *m
+		stored.Vector = slices.Clone(m.Vector)
+		if stored.ID == "" {
+			stored.ID = gollem.NewID(ctx)
+		}
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = gollem.Now(ctx)
+		}
+
+		idx := slices.IndexFunc(x.memories, func(e *Memory) bool { return e.ID == stored.ID })
+		if idx >= 0 {
+			x.memories[idx] = &stored
+		} else {
+			x.memories = append(x.memories, &stored)
+		}
+	}
+	return nil
+}
+
+// Search implements MemoryStore.
+func (x *InMemoryStore) Search(ctx context.Context, namespace string, vector []float64, limit int) ([]*Match, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	x.mu.RLock()
+	var matches []*Match
+	for _, m := range x.memories {
+		if m.Namespace != namespace {
+			continue
+		}
+		matches = append(matches, &Match{Memory: m, Score: gollem.CosineSimilarity(vector, m.Vector)})
+	}
+	x.mu.RUnlock()
+
+	slices.SortStableFunc(matches, func(a, b *Match) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	// Return copies so callers can't modify stored memories
+	for _, match := range matches {
+		found := *match.Memory
+		found.Vector = slices.Clone(match.Memory.Vector)
+		match.Memory = &found
+	}
+	return matches, nil
+}
+
+// Len returns the number of stored memories of all namespaces.
+func (x *InMemoryStore) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.memories)
+}
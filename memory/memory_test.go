@@ -0,0 +1,60 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/memory"
+	"github.com/m-mizutani/gt"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	ctx := gollem.ContextWithIDGenerator(t.Context(), gollem.NewSequentialIDGenerator("mem-"))
+	ctx = gollem.ContextWithClock(ctx, func() time.Time { return time.Unix(100, 0) })
+	store := memory.NewInMemoryStore()
+
+	gt.NoError(t, store.Add(ctx,
+		&memory.Memory{Namespace: "alice", Content: "likes Go", Vector: []float64{1, 0}},
+		&memory.Memory{Namespace: "alice", Content: "lives in Tokyo", Vector: []float64{0, 1}},
+		&memory.Memory{Namespace: "bob", Content: "likes Rust", Vector: []float64{1, 0}},
+	))
+	gt.Equal(t, 3, store.Len())
+	gt.Error(t, store.Add(ctx, &memory.Memory{Content: "no vector"}))
+
+	t.Run("search in namespace by similarity", func(t *testing.T) {
+		matches, err := store.Search(ctx, "alice", []float64{1, 0.1}, 10)
+		gt.NoError(t, err)
+		gt.A(t, matches).Length(2).At(0, func(t testing.TB, v *memory.Match) {
+			gt.Equal(t, "likes Go", v.Memory.Content)
+			gt.Equal(t, "mem-1", v.Memory.ID)
+			gt.Equal(t, time.Unix(100, 0), v.Memory.CreatedAt)
+			gt.True(t, v.Score > 0.99)
+		})
+
+		matches, err = store.Search(ctx, "alice", []float64{1, 0}, 1)
+		gt.NoError(t, err)
+		gt.A(t, matches).Length(1)
+	})
+
+	t.Run("same ID replaces the memory", func(t *testing.T) {
+		gt.NoError(t, store.Add(ctx, &memory.Memory{ID: "mem-2", Namespace: "alice", Content: "lives in Osaka", Vector: []float64{0, 1}}))
+		gt.Equal(t, 3, store.Len())
+
+		matches, err := store.Search(ctx, "alice", []float64{0, 1}, 1)
+		gt.NoError(t, err)
+		gt.A(t, matches).Length(1).At(0, func(t testing.TB, v *memory.Match) {
+			gt.Equal(t, "lives in Osaka", v.Memory.Content)
+		})
+	})
+
+	t.Run("results are copies", func(t *testing.T) {
+		matches, err := store.Search(ctx, "bob", []float64{1, 0}, 1)
+		gt.NoError(t, err)
+		matches[0].Memory.Vector[0] = -1
+
+		matches, err = store.Search(ctx, "bob", []float64{1, 0}, 1)
+		gt.NoError(t, err)
+		gt.Equal(t, []float64{1, 0}, matches[0].Memory.Vector)
+	})
+}
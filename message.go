@@ -41,6 +41,7 @@ const (
 	MessageContentTypeText         MessageContentType = "text"
 	MessageContentTypeImage        MessageContentType = "image"
 	MessageContentTypePDF          MessageContentType = "pdf"
+	MessageContentTypeFile         MessageContentType = "file"
 	MessageContentTypeToolCall     MessageContentType = "tool_call"
 	MessageContentTypeToolResponse MessageContentType = "tool_response"
 	MessageContentTypeThinking     MessageContentType = "thinking"
@@ -70,6 +71,13 @@ type PDFContent struct {
 	URL  string `json:"url,omitempty"`  // PDF URL (for future URL source support)
 }
 
+// FileContent represents document content other than images and PDFs in a message
+type FileContent struct {
+	MediaType string `json:"media_type"`     // e.g., "text/plain", "text/csv"
+	Name      string `json:"name,omitempty"` // File name or title of the document
+	Data      []byte `json:"data"`           // File data (base64 encoded in JSON)
+}
+
 // ToolCallContent represents a tool/function call request
 type ToolCallContent struct {
 	ID        string                 `json:"id"`        // Call ID for matching with response
@@ -133,6 +141,11 @@ func NewPDFContent(pdfData []byte, url string) (MessageContent, error) {
 	return makeContent(MessageContentTypePDF, PDFContent{Data: pdfData, URL: url})
 }
 
+// NewFileContent creates a new file message content
+func NewFileContent(mediaType, name string, data []byte) (MessageContent, error) {
+	return makeContent(MessageContentTypeFile, FileContent{MediaType: mediaType, Name: name, Data: data})
+}
+
 // NewToolCallContent creates a new tool call message content
 func NewToolCallContent(id, name string, args map[string]interface{}) (MessageContent, error) {
 	return makeContent(MessageContentTypeToolCall, ToolCallContent{
@@ -169,6 +182,11 @@ func (mc *MessageContent) GetPDFContent() (*PDFContent, error) {
 	return decodeContent[PDFContent](MessageContentTypePDF, mc)
 }
 
+// GetFileContent extracts file content from a MessageContent
+func (mc *MessageContent) GetFileContent() (*FileContent, error) {
+	return decodeContent[FileContent](MessageContentTypeFile, mc)
+}
+
 // GetToolCallContent extracts tool call content from a MessageContent
 func (mc *MessageContent) GetToolCallContent() (*ToolCallContent, error) {
 	return decodeContent[ToolCallContent](MessageContentTypeToolCall, mc)
@@ -1,6 +1,9 @@
 package gollem
 
-import "context"
+import (
+	"context"
+	"net/http"
+)
 
 // ContentBlockMiddleware is a function that wraps a ContentBlockHandler to add behavior.
 // Used for synchronous content generation.
@@ -16,6 +19,16 @@ type ContentStreamMiddleware func(next ContentStreamHandler) ContentStreamHandle
 // ContentStreamHandler handles content generation requests with streaming.
 type ContentStreamHandler func(ctx context.Context, req *ContentRequest) (<-chan *ContentResponse, error)
 
+// HTTPMiddleware is a function that wraps an HTTPHandler to add behavior.
+// Used at LLM client layer around the raw provider API call, e.g. for header injection,
+// request signing required by enterprise gateways, or response inspection. Set it with
+// WithHTTPMiddleware option of each provider client.
+type HTTPMiddleware func(next HTTPHandler) HTTPHandler
+
+// HTTPHandler sends an HTTP request to the provider API. A middleware that reads the response
+// body must replace it with an unread copy.
+type HTTPHandler func(req *http.Request) (*http.Response, error)
+
 // ContentRequest represents a request for content generation with modifiable history.
 type ContentRequest struct {
 	Inputs       []Input  // Current user inputs
@@ -25,12 +38,15 @@ type ContentRequest struct {
 
 // ContentResponse represents a response from content generation.
 type ContentResponse struct {
-	Texts         []string        // Generated text content
-	Thoughts      []string        // Thinking/reasoning content
-	FunctionCalls []*FunctionCall // Function/tool call requests
-	InputToken    int             // Number of input tokens used
-	OutputToken   int             // Number of output tokens used
-	Error         error           // Error if any occurred
+	Texts              []string             // Generated text content
+	Thoughts           []string             // Thinking/reasoning content
+	FunctionCalls      []*FunctionCall      // Function/tool call requests
+	FunctionCallDeltas []*FunctionCallDelta // Fragments of function calls in progress, only in streaming responses
+	InputToken         int                  // Number of input tokens used
+	OutputToken        int                  // Number of output tokens used
+	Logprobs           []float64            // Log probabilities of the output tokens of Texts, if reported
+	Error              error                // Error if any occurred
+	Raw                any                  // Provider-specific response (unstable API, see Response.Raw)
 }
 
 // ToolMiddleware is a function that wraps a ToolHandler to add behavior.
@@ -44,6 +60,11 @@ type ToolHandler func(ctx context.Context, req *ToolExecRequest) (*ToolExecRespo
 type ToolExecRequest struct {
 	Tool     *FunctionCall // Tool call details
 	ToolSpec *ToolSpec     // Tool specification
+	Priority int           // Priority of the call waiting for WithToolLimiter, ToolSpec.Priority by default
+
+	// ValidateOnly is true for a call of WithToolDryRun validating the arguments without
+	// running the tool
+	ValidateOnly bool
 }
 
 // ToolExecResponse represents a tool execution response.
@@ -82,3 +103,29 @@ func buildToolChain(middlewares []ToolMiddleware, handler ToolHandler) ToolHandl
 	}
 	return handler
 }
+
+// BuildHTTPChain builds a chain of HTTPMiddleware functions.
+// The middlewares are applied in the order they are provided.
+func BuildHTTPChain(middlewares []HTTPMiddleware, handler HTTPHandler) HTTPHandler {
+	// Apply middlewares in reverse order to maintain intuitive execution order
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// NewHTTPTransport returns an http.RoundTripper that sends requests through middlewares and
+// then base. If base is nil, http.DefaultTransport is used. It is used by provider clients
+// whose SDK accepts an HTTP client.
+func NewHTTPTransport(base http.RoundTripper, middlewares ...HTTPMiddleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return httpTransport(BuildHTTPChain(middlewares, base.RoundTrip))
+}
+
+type httpTransport HTTPHandler
+
+func (t httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t(req)
+}
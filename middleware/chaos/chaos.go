@@ -0,0 +1,286 @@
+// Package chaos provides middleware that injects faults into LLM calls and tool executions, so
+// that retry, fallback and error handling configurations can be validated in tests against
+// realistic failure modes: failed or slow LLM calls, corrupted JSON responses, and failed or
+// slow tools. Faults are injected at random by the configured rates. Do not use it in
+// production.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// ErrInjected is the default error of injected LLM call and tool failures.
+var ErrInjected = errors.New("fault injected by chaos middleware")
+
+// FaultKind is the kind of an injected fault.
+type FaultKind string
+
+const (
+	// FaultLLMError fails an LLM call before it's sent.
+	FaultLLMError FaultKind = "llm_error"
+	// FaultLLMDelay delays an LLM call before it's sent.
+	FaultLLMDelay FaultKind = "llm_delay"
+	// FaultCorruptJSON truncates the text of a JSON response of an LLM call.
+	FaultCorruptJSON FaultKind = "corrupt_json"
+	// FaultToolError fails a tool execution without running the tool.
+	FaultToolError FaultKind = "tool_error"
+	// FaultToolDelay delays a tool execution before running the tool.
+	FaultToolDelay FaultKind = "tool_delay"
+)
+
+// Fault describes an injected fault.
+type Fault struct {
+	Kind FaultKind `json:"kind"`
+	// Tool is the name of the tool for FaultToolError and FaultToolDelay
+	Tool string `json:"tool,omitempty"`
+	// Delay is the injected delay for FaultLLMDelay and FaultToolDelay
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+// FaultHook is a function called when a fault is injected.
+type FaultHook func(ctx context.Context, fault *Fault)
+
+// Option is a configuration option for Injector.
+type Option func(*Injector)
+
+// WithLLMErrorRate sets the ratio (0.0 to 1.0) of LLM calls that fail with the error set by
+// WithLLMError.
+func WithLLMErrorRate(rate float64) Option {
+	return func(x *Injector) {
+		x.llmErrorRate = rate
+	}
+}
+
+// WithLLMError sets the error of failed LLM calls (default: ErrInjected). Set an error that
+// the provider client returns, e.g. of a rate limit, to validate its handling.
+func WithLLMError(err error) Option {
+	return func(x *Injector) {
+		x.llmError = err
+	}
+}
+
+// WithLLMDelay delays the ratio (0.0 to 1.0) of LLM calls by delay.
+func WithLLMDelay(rate float64, delay time.Duration) Option {
+	return func(x *Injector) {
+		x.llmDelayRate = rate
+		x.llmDelay = delay
+	}
+}
+
+// WithCorruptJSONRate sets the ratio (0.0 to 1.0) of LLM responses whose text is valid JSON to
+// be truncated in the middle. It applies to the content block middleware only.
+func WithCorruptJSONRate(rate float64) Option {
+	return func(x *Injector) {
+		x.corruptJSONRate = rate
+	}
+}
+
+// WithToolErrorRate sets the ratio (0.0 to 1.0) of tool executions that fail with the error
+// set by WithToolError, without running the tool.
+func WithToolErrorRate(rate float64) Option {
+	return func(x *Injector) {
+		x.toolErrorRate = rate
+	}
+}
+
+// WithToolError sets the error of failed tool executions (default: ErrInjected).
+func WithToolError(err error) Option {
+	return func(x *Injector) {
+		x.toolError = err
+	}
+}
+
+// WithToolDelay delays the ratio (0.0 to 1.0) of tool executions by delay.
+func WithToolDelay(rate float64, delay time.Duration) Option {
+	return func(x *Injector) {
+		x.toolDelayRate = rate
+		x.toolDelay = delay
+	}
+}
+
+// WithTools restricts tool faults to the named tools (default: all tools).
+func WithTools(names ...string) Option {
+	return func(x *Injector) {
+		x.tools = names
+	}
+}
+
+// WithSeed sets the seed of the random number generator to reproduce the faults. Faults are
+// reproducible only when the calls are made in the same order.
+func WithSeed(seed uint64) Option {
+	return func(x *Injector) {
+		x.rng = rand.New(rand.NewPCG(seed, seed))
+	}
+}
+
+// WithFaultHook sets a callback function called whenever a fault is injected.
+func WithFaultHook(hook FaultHook) Option {
+	return func(x *Injector) {
+		x.onFault = hook
+	}
+}
+
+// Injector injects faults into LLM calls and tool executions through middlewares. Middlewares
+// created by the same Injector share the random number generator.
+type Injector struct {
+	llmErrorRate    float64
+	llmError        error
+	llmDelayRate    float64
+	llmDelay        time.Duration
+	corruptJSONRate float64
+	toolErrorRate   float64
+	toolError       error
+	toolDelayRate   float64
+	toolDelay       time.Duration
+	tools           []string
+	onFault         FaultHook
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// New creates an Injector. No fault is injected without options.
+func New(options ...Option) *Injector {
+	x := &Injector{
+		llmError:  ErrInjected,
+		toolError: ErrInjected,
+		rng:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+	for _, opt := range options {
+		opt(x)
+	}
+	return x
+}
+
+// hit returns true at the ratio of rate.
+func (x *Injector) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.rng.Float64() < rate
+}
+
+// inject reports fault to the hook and the trace.
+func (x *Injector) inject(ctx context.Context, fault *Fault) {
+	if x.onFault != nil {
+		x.onFault(ctx, fault)
+	}
+	if h := trace.HandlerFrom(ctx); h != nil {
+		h.AddEvent(ctx, "chaos_fault", fault)
+	}
+}
+
+// sleep waits for d, or returns the error of ctx if it's canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beforeLLMCall injects the faults of an LLM call before it's sent.
+func (x *Injector) beforeLLMCall(ctx context.Context) error {
+	if x.hit(x.llmDelayRate) {
+		x.inject(ctx, &Fault{Kind: FaultLLMDelay, Delay: x.llmDelay})
+		if err := sleep(ctx, x.llmDelay); err != nil {
+			return err
+		}
+	}
+	if x.hit(x.llmErrorRate) {
+		x.inject(ctx, &Fault{Kind: FaultLLMError})
+		// Tagged as a transient error of the provider to be retried by gollem.RetryPolicy
+		return goerr.Wrap(x.llmError, "LLM call failed by chaos middleware", goerr.Tag(gollem.ErrTagTransient))
+	}
+	return nil
+}
+
+// ContentBlockMiddleware returns a middleware that injects faults into LLM calls.
+func (x *Injector) ContentBlockMiddleware() gollem.ContentBlockMiddleware {
+	return func(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
+		return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			if err := x.beforeLLMCall(ctx); err != nil {
+				return nil, err
+			}
+
+			resp, err := next(ctx, req)
+			if err != nil || resp == nil {
+				return resp, err
+			}
+
+			text := strings.Join(resp.Texts, "")
+			if text != "" && json.Valid([]byte(text)) && x.hit(x.corruptJSONRate) {
+				x.inject(ctx, &Fault{Kind: FaultCorruptJSON})
+				corrupted := *resp
+				corrupted.Texts = []string{text[:len(text)/2]}
+				return &corrupted, nil
+			}
+			return resp, nil
+		}
+	}
+}
+
+// ContentStreamMiddleware returns a streaming middleware that injects faults into LLM calls.
+func (x *Injector) ContentStreamMiddleware() gollem.ContentStreamMiddleware {
+	return func(next gollem.ContentStreamHandler) gollem.ContentStreamHandler {
+		return func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+			if err := x.beforeLLMCall(ctx); err != nil {
+				return nil, err
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// ToolMiddleware returns a middleware that injects faults into tool executions.
+func (x *Injector) ToolMiddleware() gollem.ToolMiddleware {
+	return func(next gollem.ToolHandler) gollem.ToolHandler {
+		return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+			name := req.Tool.Name
+			if len(x.tools) > 0 && !slices.Contains(x.tools, name) {
+				return next(ctx, req)
+			}
+
+			if x.hit(x.toolDelayRate) {
+				x.inject(ctx, &Fault{Kind: FaultToolDelay, Tool: name, Delay: x.toolDelay})
+				if err := sleep(ctx, x.toolDelay); err != nil {
+					return &gollem.ToolExecResponse{Error: goerr.Wrap(err, "tool execution canceled", goerr.V("tool", name))}, nil
+				}
+			}
+			if x.hit(x.toolErrorRate) {
+				x.inject(ctx, &Fault{Kind: FaultToolError, Tool: name})
+				return &gollem.ToolExecResponse{
+					Error: goerr.Wrap(x.toolError, "tool failed by chaos middleware", goerr.V("tool", name)),
+				}, nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// AgentOption returns an agent option that sets the content block, content stream and tool
+// middlewares of the Injector. Sessions not created by the agent, e.g. of planner strategies,
+// need the middlewares by their own options.
+func (x *Injector) AgentOption() gollem.Option {
+	return gollem.WithOptions(
+		gollem.WithContentBlockMiddleware(x.ContentBlockMiddleware()),
+		gollem.WithContentStreamMiddleware(x.ContentStreamMiddleware()),
+		gollem.WithToolMiddleware(x.ToolMiddleware()),
+	)
+}
@@ -0,0 +1,145 @@
+package chaos_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/chaos"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func okHandler(text string) gollem.ContentBlockHandler {
+	return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		return &gollem.ContentResponse{Texts: []string{text}}, nil
+	}
+}
+
+func TestLLMError(t *testing.T) {
+	var faults []*chaos.Fault
+	x := chaos.New(
+		chaos.WithLLMErrorRate(1.0),
+		chaos.WithFaultHook(func(ctx context.Context, fault *chaos.Fault) {
+			faults = append(faults, fault)
+		}),
+	)
+
+	_, err := x.ContentBlockMiddleware()(okHandler("ok"))(t.Context(), &gollem.ContentRequest{})
+	gt.Error(t, err).Is(chaos.ErrInjected)
+
+	_, err = x.ContentStreamMiddleware()(func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+		t.Fatal("stream must not be called")
+		return nil, nil
+	})(t.Context(), &gollem.ContentRequest{})
+	gt.Error(t, err).Is(chaos.ErrInjected)
+
+	gt.A(t, faults).Length(2)
+	gt.Equal(t, chaos.FaultLLMError, faults[0].Kind)
+
+	t.Run("no fault by default", func(t *testing.T) {
+		resp, err := chaos.New().ContentBlockMiddleware()(okHandler("ok"))(t.Context(), &gollem.ContentRequest{})
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"ok"}, resp.Texts)
+	})
+}
+
+func TestLLMDelay(t *testing.T) {
+	x := chaos.New(chaos.WithLLMDelay(1.0, time.Hour))
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := x.ContentBlockMiddleware()(okHandler("ok"))(ctx, &gollem.ContentRequest{})
+	gt.Error(t, err).Is(context.DeadlineExceeded)
+}
+
+func TestCorruptJSON(t *testing.T) {
+	x := chaos.New(chaos.WithCorruptJSONRate(1.0))
+	middleware := x.ContentBlockMiddleware()
+
+	resp, err := middleware(okHandler(`{"answer": "yes", "confidence": 0.9}`))(t.Context(), &gollem.ContentRequest{})
+	gt.NoError(t, err)
+	gt.False(t, json.Valid([]byte(resp.Texts[0])))
+
+	// Texts that are not JSON are kept
+	resp, err = middleware(okHandler("plain text"))(t.Context(), &gollem.ContentRequest{})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"plain text"}, resp.Texts)
+}
+
+func TestSeed(t *testing.T) {
+	pattern := func() []bool {
+		x := chaos.New(chaos.WithLLMErrorRate(0.5), chaos.WithSeed(42))
+		handler := x.ContentBlockMiddleware()(okHandler("ok"))
+		var results []bool
+		for range 20 {
+			_, err := handler(t.Context(), &gollem.ContentRequest{})
+			results = append(results, err == nil)
+		}
+		return results
+	}
+
+	first := pattern()
+	gt.Equal(t, first, pattern())
+	gt.A(t, first).Has(true)
+	gt.A(t, first).Has(false)
+}
+
+func TestToolFaultsInAgent(t *testing.T) {
+	calls := 0
+	var responses []gollem.FunctionResponse
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					if calls > 1 {
+						for _, in := range input {
+							if resp, ok := in.(gollem.FunctionResponse); ok {
+								responses = append(responses, resp)
+							}
+						}
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+					return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+						{ID: "1", Name: "flaky", Arguments: map[string]any{}},
+						{ID: "2", Name: "stable", Arguments: map[string]any{}},
+					}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	var ran []string
+	newTool := func(name string) gollem.Tool {
+		return &mock.ToolMock{
+			SpecFunc: func() gollem.ToolSpec {
+				return gollem.ToolSpec{Name: name}
+			},
+			RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				ran = append(ran, name)
+				return map[string]any{"ok": true}, nil
+			},
+		}
+	}
+
+	x := chaos.New(chaos.WithToolErrorRate(1.0), chaos.WithTools("flaky"))
+	agent := gollem.New(client, gollem.WithTools(newTool("flaky"), newTool("stable")), x.AgentOption())
+	_, err := agent.Execute(t.Context(), gollem.Text("run tools"))
+	gt.NoError(t, err)
+
+	gt.Equal(t, []string{"stable"}, ran)
+	gt.A(t, responses).Length(2)
+	for _, resp := range responses {
+		if resp.Name == "flaky" {
+			gt.Error(t, resp.Error).Is(chaos.ErrInjected)
+		} else {
+			gt.NoError(t, resp.Error)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 // Package compacter provides middleware for automatic conversation history compaction
-// when token limit errors are detected. It uses LLM to summarize old messages.
+// when token limit errors are detected, or proactively with WithRollingContext. It uses LLM to
+// summarize old messages by default, and other strategies are selectable by
+// WithCompactionStrategy.
 package compacter
 
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 
 	"github.com/m-mizutani/goerr/v2"
@@ -24,8 +27,9 @@ const (
 // CompactionEvent contains information about a compaction event.
 //
 // The compaction process selects messages from the beginning of the conversation history
-// based on the configured compact ratio (default 70%). These messages are summarized using
-// an LLM and replaced with a single summary message.
+// based on the configured compact ratio (default 70%). By default, these messages are summarized
+// using an LLM and replaced with a single summary message. See WithCompactionStrategy for other
+// strategies.
 //
 // Data sizes represent character counts:
 //   - OriginalDataSize: Total character count of all original messages
@@ -43,8 +47,11 @@ type CompactionEvent struct {
 	CompactedDataSize int    // Total character count after compaction (summary + remaining)
 	InputTokens       int    // LLM input tokens used for summarization
 	OutputTokens      int    // LLM output tokens generated for summary
-	Summary           string // The generated summary text
-	Attempt           int    // Retry attempt number (1-based)
+	Summary           string // The generated summary text, or empty if messages are dropped without a summary
+	Attempt           int    // Retry attempt number (1-based), or 0 for compaction by WithRollingContext or NewHistoryCompactor
+
+	// Decision is why the compaction ran
+	Decision *CompactionDecision
 }
 
 // CompactionHook is a function called when compaction occurs
@@ -57,6 +64,9 @@ type config struct {
 	maxRetries    int
 	logger        *slog.Logger
 	onCompaction  CompactionHook
+	onDecision    DecisionHook
+	rollingTurns  int
+	strategy      CompactionStrategy
 }
 
 // Option is a configuration option for the compacter middleware
@@ -112,6 +122,9 @@ func newConfig(llmClient gollem.LLMClient, options ...Option) *config {
 	for _, opt := range options {
 		opt(cfg)
 	}
+	if cfg.strategy == nil {
+		cfg.strategy = &SummaryStrategy{}
+	}
 
 	return cfg
 }
@@ -134,6 +147,11 @@ func retryWithCompaction(
 		// Compact the history
 		if req.History == nil || len(req.History.Messages) == 0 {
 			cfg.logger.Warn("no history to compact")
+			decision := newDecision(ctx, TriggerTokenLimit, req.History)
+			decision.Attempt = attempt
+			decision.LimitError = lastErr.Error()
+			decision.Reason = "history is empty"
+			recordDecision(ctx, cfg, decision)
 			return lastErr
 		}
 
@@ -141,7 +159,10 @@ func retryWithCompaction(
 			ctx,
 			req.History,
 			cfg,
+			TriggerTokenLimit,
 			attempt,
+			0,
+			lastErr,
 		)
 		if compactErr != nil {
 			cfg.logger.Error("compaction failed", "error", compactErr)
@@ -174,6 +195,7 @@ func NewContentBlockMiddleware(llmClient gollem.LLMClient, options ...Option) go
 
 	return func(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
 		return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			applyRollingContext(ctx, req, cfg)
 			resp, err := next(ctx, req)
 
 			// Check if error has ErrTagTokenExceeded tag
@@ -199,6 +221,7 @@ func NewContentStreamMiddleware(llmClient gollem.LLMClient, options ...Option) g
 
 	return func(next gollem.ContentStreamHandler) gollem.ContentStreamHandler {
 		return func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+			applyRollingContext(ctx, req, cfg)
 			respChan, err := next(ctx, req)
 
 			// Check if error has ErrTagTokenExceeded tag
@@ -217,84 +240,161 @@ func NewContentStreamMiddleware(llmClient gollem.LLMClient, options ...Option) g
 	}
 }
 
-// compactHistory compresses the history using LLM summarization
+// compactHistory compresses the history by the strategy of cfg
 func compactHistory(
 	ctx context.Context,
 	history *gollem.History,
 	cfg *config,
+	trigger CompactionTrigger,
 	attempt int,
+	maxTokens int,
+	limitErr error,
 ) (*gollem.History, error) {
 	if history == nil || len(history.Messages) == 0 {
 		return nil, goerr.New("history is empty")
 	}
 
-	// Calculate total character count
-	totalChars := countMessageChars(history.Messages)
-	compactChars := int(float64(totalChars) * cfg.compactRatio)
+	decision := newDecision(ctx, trigger, history)
+	decision.Attempt = attempt
+	decision.CompactRatio = cfg.compactRatio
+	if limitErr != nil {
+		decision.LimitError = limitErr.Error()
+	}
 
-	cfg.logger.Info("compacting history with LLM",
+	totalChars := countMessageChars(history.Messages)
+	cfg.logger.Info("compacting history",
 		"messages_before", len(history.Messages),
 		"total_chars", totalChars,
-		"compact_chars", compactChars,
 		"compact_ratio", cfg.compactRatio,
 	)
 
-	// Extract messages to compact
-	messagesToCompact, remainingMessages := extractMessagesToCompact(history.Messages, compactChars)
-
-	if len(messagesToCompact) == 0 {
-		cfg.logger.Warn("no messages to compact")
-		return history, nil
-	}
-
-	cfg.logger.Info("generating summary", "messages_to_summarize", len(messagesToCompact))
-
-	// Create history with messages to compact
-	compactHistory := &gollem.History{
-		LLType:   history.LLType,
-		Version:  history.Version,
-		Messages: messagesToCompact,
-	}
-
-	// Generate summary using LLM with history
-	session, err := cfg.llmClient.NewSession(ctx,
-		gollem.WithSessionHistory(compactHistory),
-	)
-	if err != nil {
-		return nil, goerr.Wrap(err, "failed to create LLM session for summarization")
+	req := &CompactionRequest{
+		History:      history,
+		CompactRatio: cfg.compactRatio,
+		MaxTokens:    maxTokens,
+		cfg:          cfg,
 	}
-
-	resp, err := session.Generate(ctx, []gollem.Input{gollem.Text(cfg.summaryPrompt)})
+	result, err := cfg.strategy.Compact(ctx, req)
 	if err != nil {
-		return nil, goerr.Wrap(err, "failed to generate summary")
+		decision.Reason = "failed to compact: " + err.Error()
+		recordDecision(ctx, cfg, decision)
+		return nil, err
 	}
 
-	if len(resp.Texts) == 0 {
-		return nil, goerr.New("summary generation returned no text")
+	if len(result.CompactedIndices) == 0 {
+		cfg.logger.Warn("no messages to compact")
+		decision.Reason = result.Reason
+		recordDecision(ctx, cfg, decision)
+		return history, nil
 	}
 
-	summary := resp.Texts[0]
+	decision.Compacted = true
+	decision.CompactedMessages = len(result.CompactedIndices)
+	decision.Reason = fmt.Sprintf("%s exceeded; %s", triggerLimit(trigger), result.Reason)
+	recordDecision(ctx, cfg, decision)
 
 	cfg.logger.Info("compaction completed",
-		"messages_after", len(remainingMessages)+1,
-		"summary_length", len(summary),
+		"messages_after", len(result.History.Messages),
+		"summary_length", len(result.Summary),
 	)
 
 	// Call hook if configured
 	if cfg.onCompaction != nil {
-		remainingChars := countMessageChars(remainingMessages)
 		event := &CompactionEvent{
 			OriginalDataSize:  totalChars,
-			CompactedDataSize: len(summary) + remainingChars,
-			InputTokens:       resp.InputToken,
-			OutputTokens:      resp.OutputToken,
-			Summary:           summary,
+			CompactedDataSize: countMessageChars(result.History.Messages),
+			InputTokens:       req.inputTokens,
+			OutputTokens:      req.outputTokens,
+			Summary:           result.Summary,
 			Attempt:           attempt,
+			Decision:          decision,
 		}
 		cfg.onCompaction(ctx, event)
 	}
 
-	// Create new history with summary as first message
+	return result.History, nil
+}
+
+// triggerLimit returns the limit exceeded for trigger in reasons of decisions.
+func triggerLimit(trigger CompactionTrigger) string {
+	if trigger == TriggerContextWindow {
+		return "context window"
+	}
+	return "token limit"
+}
+
+// NewHistoryCompactor returns a gollem.HistoryCompactor summarizing old messages by llmClient in
+// the same way as the middleware, for gollem.ContextOverflowAutoCompact of
+// gollem.WithContextWindowGuard. Each call compacts the messages of the compact ratio of the
+// history by the strategy of WithCompactionStrategy, and the guard calls it again while the
+// request exceeds the context window. Options other than WithMaxRetries and WithRollingContext
+// apply.
+func NewHistoryCompactor(llmClient gollem.LLMClient, options ...Option) gollem.HistoryCompactor {
+	cfg := newConfig(llmClient, options...)
+	return func(ctx context.Context, history *gollem.History, maxTokens int) (*gollem.History, error) {
+		return compactHistory(ctx, history, cfg, TriggerContextWindow, 0, maxTokens, nil)
+	}
+}
+
+// summarizeMessages generates a summary of messagesToCompact using LLM
+func summarizeMessages(
+	ctx context.Context,
+	history *gollem.History,
+	messagesToCompact []gollem.Message,
+	cfg *config,
+) (*gollem.Response, string, error) {
+	cfg.logger.Info("generating summary", "messages_to_summarize", len(messagesToCompact))
+
+	// The summary is shown to the LLM in later turns, so it follows the locale of the agent
+	return generateText(ctx, history, messagesToCompact, cfg, withLocale(ctx, cfg.summaryPrompt))
+}
+
+// generateText generates a text for prompt using LLM with messages as the history
+func generateText(
+	ctx context.Context,
+	history *gollem.History,
+	messages []gollem.Message,
+	cfg *config,
+	prompt string,
+	options ...gollem.SessionOption,
+) (*gollem.Response, string, error) {
+	// Create history with the messages
+	if len(messages) > 0 {
+		options = append(options, gollem.WithSessionHistory(&gollem.History{
+			LLType:   history.LLType,
+			Version:  history.Version,
+			Messages: messages,
+		}))
+	}
+
+	session, err := cfg.llmClient.NewSession(ctx, options...)
+	if err != nil {
+		return nil, "", goerr.Wrap(err, "failed to create LLM session for summarization")
+	}
+
+	gollem.TracePrompt(ctx, &gollem.PromptEvent{
+		Phase:    gollem.UsagePhaseSummarize,
+		Template: "compaction",
+		Data:     map[string]any{"Messages": len(messages)},
+		Prompt:   prompt,
+	})
+
+	resp, err := session.Generate(ctx, []gollem.Input{gollem.Text(prompt)})
+	if err != nil {
+		return nil, "", goerr.Wrap(err, "failed to generate summary")
+	}
+	gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseSummarize), resp)
+
+	if len(resp.Texts) == 0 {
+		return nil, "", goerr.New("summary generation returned no text")
+	}
+
+	return resp, resp.Texts[0], nil
+}
+
+// buildCompactedHistory creates a new history with the summary as the first message
+// followed by remainingMessages
+func buildCompactedHistory(history *gollem.History, summary string, remainingMessages []gollem.Message) (*gollem.History, error) {
 	summaryContent, err := gollem.NewTextContent(summary)
 	if err != nil {
 		return nil, goerr.Wrap(err, "failed to create summary content")
@@ -311,6 +411,7 @@ func compactHistory(
 	summaryMessage := gollem.Message{
 		Role:     summaryRole,
 		Contents: []gollem.MessageContent{summaryContent},
+		Metadata: map[string]any{gollem.MetadataCompactionSummary: true},
 	}
 
 	// Build new history
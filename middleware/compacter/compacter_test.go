@@ -522,6 +522,7 @@ func TestContentBlockMiddleware_SummaryRoleAlternation(t *testing.T) {
 			// Verify summary role maintains alternation
 			summaryMessage := compactedHistory.Messages[0]
 			gt.Equal(t, tc.expectedSummaryRole, summaryMessage.Role)
+			gt.True(t, summaryMessage.IsCompactionSummary())
 
 			// Verify alternation pattern
 			nextMessage := compactedHistory.Messages[1]
@@ -687,3 +688,88 @@ func TestCompactionWithRealLLM(t *testing.T) {
 func containsIgnoreCase(s, substr string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
+
+func TestContentBlockMiddleware_Locale(t *testing.T) {
+	var summaryPrompt string
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					summaryPrompt = string(input[0].(gollem.Text))
+					return &gollem.Response{Texts: []string{"summary"}}, nil
+				},
+			}, nil
+		},
+	}
+
+	middleware := compacter.NewContentBlockMiddleware(mockClient, compacter.WithSummaryPrompt("Summarize."))
+	callCount := 0
+	handler := middleware(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		callCount++
+		if callCount == 1 {
+			return nil, goerr.Wrap(gollem.ErrTokenSizeExceeded, "token limit exceeded", goerr.Tag(gollem.ErrTagTokenExceeded))
+		}
+		return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+	})
+
+	ctx := gollem.ContextWithLocale(t.Context(), gollem.LocaleJaJP)
+	_, err := handler(ctx, &gollem.ContentRequest{
+		Inputs: []gollem.Input{gollem.Text("New input")},
+		History: &gollem.History{
+			LLType:  gollem.LLMTypeClaude,
+			Version: gollem.HistoryVersion,
+			Messages: []gollem.Message{
+				createMessage(gollem.RoleUser, "First message"),
+				createMessage(gollem.RoleAssistant, "First response"),
+				createMessage(gollem.RoleUser, "Second message"),
+				createMessage(gollem.RoleAssistant, "Second response"),
+			},
+		},
+	})
+	gt.NoError(t, err)
+	gt.True(t, strings.HasPrefix(summaryPrompt, "Summarize.\n\n# Output Format"))
+	gt.S(t, summaryPrompt).Contains("- Dates: e.g. 2026/03/14")
+}
+
+func TestNewHistoryCompactor(t *testing.T) {
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"Summary"}}, nil
+				},
+			}, nil
+		},
+	}
+
+	var decisions []*compacter.CompactionDecision
+	compactor := compacter.NewHistoryCompactor(mockClient,
+		compacter.WithCompactRatio(0.5),
+		compacter.WithDecisionHook(func(ctx context.Context, d *compacter.CompactionDecision) {
+			decisions = append(decisions, d)
+		}),
+	)
+
+	history := &gollem.History{
+		LLType:  gollem.LLMTypeClaude,
+		Version: gollem.HistoryVersion,
+		Messages: []gollem.Message{
+			createMessage(gollem.RoleUser, strings.Repeat("first message ", 20)),
+			createMessage(gollem.RoleAssistant, strings.Repeat("first response ", 20)),
+			createMessage(gollem.RoleUser, "Second message"),
+			createMessage(gollem.RoleAssistant, "Second response"),
+		},
+	}
+
+	compacted, err := compactor(context.Background(), history, 100)
+	gt.NoError(t, err)
+	gt.A(t, compacted.Messages).Length(3)
+	gt.True(t, compacted.Messages[0].IsCompactionSummary())
+	gt.A(t, history.Messages).Length(4)
+
+	gt.A(t, decisions).Length(1)
+	gt.Equal(t, compacter.TriggerContextWindow, decisions[0].Trigger)
+	gt.False(t, decisions[0].Emergency)
+	gt.True(t, decisions[0].Compacted)
+	gt.S(t, decisions[0].Reason).Contains("context window exceeded")
+}
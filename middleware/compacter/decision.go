@@ -0,0 +1,107 @@
+package compacter
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// CompactionTrigger is what made the middleware consider compaction.
+type CompactionTrigger string
+
+const (
+	// TriggerTokenLimit is a token limit error of an LLM call. The call is retried after
+	// compaction.
+	TriggerTokenLimit CompactionTrigger = "token_limit"
+
+	// TriggerRolling is the turn threshold of WithRollingContext checked before each LLM call.
+	TriggerRolling CompactionTrigger = "rolling"
+
+	// TriggerContextWindow is a request exceeding the context window of
+	// gollem.WithContextWindowGuard, compacted by NewHistoryCompactor before the LLM call.
+	TriggerContextWindow CompactionTrigger = "context_window"
+)
+
+// CompactionDecision records why compaction ran or was skipped, so that thresholds can be
+// tuned from production data. It's passed to the hook by WithDecisionHook, attached to
+// CompactionEvent, and added to the trace as a "compaction_decision" event.
+type CompactionDecision struct {
+	Trigger CompactionTrigger `json:"trigger"`
+	// Emergency is true if the decision is made after an LLM call failed by a token limit
+	Emergency bool `json:"emergency"`
+	// Compacted is true if the history was compacted
+	Compacted bool `json:"compacted"`
+	// Reason describes why compaction ran or was skipped
+	Reason string `json:"reason"`
+	// Attempt is the retry attempt number (1-based) for TriggerTokenLimit, or 0
+	Attempt int `json:"attempt,omitempty"`
+
+	// Messages and Tokens are the number of messages and the tokens by History.TokenBreakdown
+	// with gollem.TokenizerFromContext of the history before compaction
+	Messages int `json:"messages"`
+	Tokens   int `json:"tokens"`
+
+	// Turns is the number of turns of the history, and TurnThreshold the number of turns over
+	// which WithRollingContext compacts. They are set for TriggerRolling.
+	Turns         int `json:"turns,omitempty"`
+	TurnThreshold int `json:"turn_threshold,omitempty"`
+
+	// CompactRatio is the ratio of characters to compact, and LimitError the message of the
+	// token limit error, which usually has the token count and the limit of the provider. They
+	// are set for TriggerTokenLimit, and CompactRatio also for TriggerContextWindow.
+	CompactRatio float64 `json:"compact_ratio,omitempty"`
+	LimitError   string  `json:"limit_error,omitempty"`
+
+	// CompactedMessages is the number of messages replaced with the summary
+	CompactedMessages int `json:"compacted_messages"`
+}
+
+// DecisionHook is a function called for each compaction decision.
+type DecisionHook func(ctx context.Context, decision *CompactionDecision)
+
+// WithDecisionHook sets a callback function called whenever the middleware decides to compact
+// the history or not, including skips. With WithRollingContext, it's called before each LLM
+// call.
+func WithDecisionHook(hook DecisionHook) Option {
+	return func(c *config) {
+		c.onDecision = hook
+	}
+}
+
+// newDecision returns a decision of history with measurements before compaction. Tokens are
+// counted by the Tokenizer of ctx.
+func newDecision(ctx context.Context, trigger CompactionTrigger, history *gollem.History) *CompactionDecision {
+	d := &CompactionDecision{
+		Trigger:   trigger,
+		Emergency: trigger == TriggerTokenLimit,
+	}
+	if history != nil {
+		d.Messages = len(history.Messages)
+		d.Tokens = history.TokenBreakdown(gollem.TokenizerFromContext(ctx).CountTokens).Total
+	}
+	return d
+}
+
+// recordDecision reports d to the logger, the decision hook and the trace.
+func recordDecision(ctx context.Context, cfg *config, d *CompactionDecision) {
+	// Skips by WithRollingContext happen on every LLM call
+	level := slog.LevelInfo
+	if !d.Compacted && !d.Emergency {
+		level = slog.LevelDebug
+	}
+	cfg.logger.Log(ctx, level, "compaction decision",
+		"trigger", d.Trigger,
+		"compacted", d.Compacted,
+		"reason", d.Reason,
+		"messages", d.Messages,
+		"tokens", d.Tokens,
+	)
+	if cfg.onDecision != nil {
+		cfg.onDecision(ctx, d)
+	}
+	if h := trace.HandlerFrom(ctx); h != nil {
+		h.AddEvent(ctx, "compaction_decision", d)
+	}
+}
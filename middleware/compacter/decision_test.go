@@ -0,0 +1,134 @@
+package compacter_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func newSummaryClient() *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"summary"}}, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func TestDecisionTokenLimit(t *testing.T) {
+	rec := trace.New()
+	ctx := rec.StartAgentExecute(trace.WithHandler(t.Context(), rec))
+
+	var decisions []*compacter.CompactionDecision
+	var events []*compacter.CompactionEvent
+	middleware := compacter.NewContentBlockMiddleware(newSummaryClient(),
+		compacter.WithCompactRatio(0.5),
+		compacter.WithDecisionHook(func(ctx context.Context, decision *compacter.CompactionDecision) {
+			decisions = append(decisions, decision)
+		}),
+		compacter.WithCompactionHook(func(ctx context.Context, event *compacter.CompactionEvent) {
+			events = append(events, event)
+		}),
+	)
+
+	calls := 0
+	handler := middleware(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		calls++
+		if calls == 1 {
+			return nil, goerr.New("prompt is too long: 210000 tokens > 200000 maximum", goerr.Tag(gollem.ErrTagTokenExceeded))
+		}
+		return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+	})
+
+	_, err := handler(ctx, &gollem.ContentRequest{
+		Inputs: []gollem.Input{gollem.Text("next")},
+		History: &gollem.History{Version: gollem.HistoryVersion, Messages: []gollem.Message{
+			createMessage(gollem.RoleUser, "First message"),
+			createMessage(gollem.RoleAssistant, "First response"),
+			createMessage(gollem.RoleUser, "Second message"),
+			createMessage(gollem.RoleAssistant, "Second response"),
+		}},
+	})
+	gt.NoError(t, err)
+
+	gt.A(t, decisions).Length(1)
+	d := decisions[0]
+	gt.Equal(t, compacter.TriggerTokenLimit, d.Trigger)
+	gt.True(t, d.Emergency)
+	gt.True(t, d.Compacted)
+	gt.Equal(t, 1, d.Attempt)
+	gt.Equal(t, 4, d.Messages)
+	gt.N(t, d.Tokens).Greater(0)
+	gt.Equal(t, 0.5, d.CompactRatio)
+	gt.S(t, d.LimitError).Contains("210000 tokens")
+	gt.N(t, d.CompactedMessages).Greater(0)
+
+	gt.A(t, events).Length(1)
+	gt.Equal(t, d, events[0].Decision)
+
+	var traced *compacter.CompactionDecision
+	for _, span := range rec.Trace().RootSpan.Children {
+		if span.Event != nil && span.Event.Kind == "compaction_decision" {
+			traced = span.Event.Data.(*compacter.CompactionDecision)
+		}
+	}
+	gt.Equal(t, d, traced)
+}
+
+func TestDecisionRolling(t *testing.T) {
+	var decisions []*compacter.CompactionDecision
+	middleware := compacter.NewContentBlockMiddleware(newSummaryClient(),
+		compacter.WithRollingContext(1),
+		compacter.WithDecisionHook(func(ctx context.Context, decision *compacter.CompactionDecision) {
+			decisions = append(decisions, decision)
+		}),
+	)
+	handler := middleware(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+	})
+
+	call := func(messages ...gollem.Message) {
+		_, err := handler(t.Context(), &gollem.ContentRequest{
+			Inputs:  []gollem.Input{gollem.Text("next")},
+			History: &gollem.History{Version: gollem.HistoryVersion, Messages: messages},
+		})
+		gt.NoError(t, err)
+	}
+
+	call(
+		createMessage(gollem.RoleUser, "Q1"),
+		createMessage(gollem.RoleAssistant, "A1"),
+	)
+	call(
+		createMessage(gollem.RoleUser, "Q1"),
+		createMessage(gollem.RoleAssistant, "A1"),
+		createMessage(gollem.RoleUser, "Q2"),
+		createMessage(gollem.RoleAssistant, "A2"),
+		createMessage(gollem.RoleUser, "Q3"),
+		createMessage(gollem.RoleAssistant, "A3"),
+	)
+
+	gt.A(t, decisions).Length(2)
+
+	skipped := decisions[0]
+	gt.Equal(t, compacter.TriggerRolling, skipped.Trigger)
+	gt.False(t, skipped.Emergency)
+	gt.False(t, skipped.Compacted)
+	gt.Equal(t, 1, skipped.Turns)
+	gt.Equal(t, 2, skipped.TurnThreshold)
+
+	compacted := decisions[1]
+	gt.True(t, compacted.Compacted)
+	gt.Equal(t, 3, compacted.Turns)
+	gt.Equal(t, 6, compacted.Messages)
+	gt.Equal(t, 4, compacted.CompactedMessages)
+}
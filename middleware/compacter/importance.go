@@ -0,0 +1,166 @@
+package compacter
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// DefaultImportancePrompt is the default prompt used for scoring turns by ImportanceStrategy.
+// The numbered turns follow it.
+var DefaultImportancePrompt = `Rate how important each turn of the conversation below is for continuing the conversation, from 0 (not needed anymore) to 10 (essential, such as requirements of the user, decisions, and facts or results that later turns rely on).
+
+Respond with a JSON object {"scores": [...]} that has an integer score for each turn in order.`
+
+const defaultMinImportance = 7
+
+// ImportanceStrategy scores the oldest turns of the compact ratio of characters by the LLM, keeps
+// the turns of high scores verbatim, and summarizes the others into a single message. The kept
+// turns are at most half of the characters to compact, so that compaction always reduces the
+// history. A turn starts at a user message other than tool results.
+type ImportanceStrategy struct {
+	// MinScore is the minimum score from 0 to 10 for a turn to be kept verbatim. Default is 7.
+	MinScore int
+	// Prompt is the prompt to score turns. Default is DefaultImportancePrompt.
+	Prompt string
+}
+
+// Compact implements CompactionStrategy.
+func (s *ImportanceStrategy) Compact(ctx context.Context, req *CompactionRequest) (*CompactionResult, error) {
+	messages := req.History.Messages
+	totalChars := countMessageChars(messages)
+	compactChars := int(float64(totalChars) * req.CompactRatio)
+
+	turns := selectOldTurns(messages, compactChars)
+	if len(turns) == 0 {
+		return &CompactionResult{
+			History: req.History,
+			Reason:  fmt.Sprintf("no turns to compact within %d of %d characters", compactChars, totalChars),
+		}, nil
+	}
+
+	scores, err := s.score(ctx, req, turns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the turns of the highest scores within half of the characters to compact
+	minScore := s.MinScore
+	if minScore <= 0 {
+		minScore = defaultMinImportance
+	}
+	order := indexRange(0, len(turns))
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(scores[b], scores[a])
+	})
+	keep := make([]bool, len(turns))
+	var keptChars, kept int
+	for _, i := range order {
+		chars := countMessageChars(messages[turns[i].start:turns[i].end])
+		if scores[i] < minScore || keptChars+chars > compactChars/2 {
+			continue
+		}
+		keep[i] = true
+		keptChars += chars
+		kept++
+	}
+	if kept == len(turns) {
+		return &CompactionResult{
+			History: req.History,
+			Reason:  fmt.Sprintf("all %d turns to compact are scored %d or higher", len(turns), minScore),
+		}, nil
+	}
+
+	var summarized, keptMessages []gollem.Message
+	var indices []int
+	for i, t := range turns {
+		if keep[i] {
+			keptMessages = append(keptMessages, messages[t.start:t.end]...)
+			continue
+		}
+		summarized = append(summarized, messages[t.start:t.end]...)
+		indices = append(indices, indexRange(t.start, t.end)...)
+	}
+
+	summary, err := req.Summarize(ctx, summarized)
+	if err != nil {
+		return nil, err
+	}
+	remaining := append(keptMessages, messages[turns[len(turns)-1].end:]...)
+	compacted, err := buildCompactedHistory(req.History, summary, remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompactionResult{
+		History:          compacted,
+		CompactedIndices: indices,
+		Summary:          summary,
+		Reason:           fmt.Sprintf("summarizing %d of %d turns and keeping %d turns scored %d or higher", len(turns)-kept, len(turns), kept, minScore),
+	}, nil
+}
+
+// score returns the importance scores of turns by the LLM. Turns without a score are scored 0.
+func (s *ImportanceStrategy) score(ctx context.Context, req *CompactionRequest, turns []turn) ([]int, error) {
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = DefaultImportancePrompt
+	}
+
+	var b strings.Builder
+	b.WriteString(prompt)
+	for i, t := range turns {
+		fmt.Fprintf(&b, "\n\n# Turn %d\n", i+1)
+		for _, msg := range req.History.Messages[t.start:t.end] {
+			fmt.Fprintf(&b, "%s: %s\n", msg.Role, messageText(msg))
+		}
+	}
+
+	text, err := req.Generate(ctx, nil, b.String(),
+		gollem.WithSessionContentType(gollem.ContentTypeJSON),
+		gollem.WithSessionResponseSchema(&gollem.Parameter{
+			Type: gollem.TypeObject,
+			Properties: map[string]*gollem.Parameter{
+				"scores": {
+					Type:        gollem.TypeArray,
+					Description: "Importance score from 0 to 10 of each turn in order",
+					Items:       &gollem.Parameter{Type: gollem.TypeInteger},
+					Required:    true,
+				},
+			},
+		}),
+	)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to score turns")
+	}
+
+	var resp struct {
+		Scores []int `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(text), &resp); err != nil {
+		return nil, goerr.Wrap(err, "failed to parse scores of turns", goerr.V("response", text))
+	}
+
+	scores := make([]int, len(turns))
+	copy(scores, resp.Scores)
+	return scores, nil
+}
+
+// messageText returns the texts of msg, and the types of other contents such as tool calls.
+func messageText(msg gollem.Message) string {
+	var parts []string
+	for _, content := range msg.Contents {
+		if text, err := content.GetTextContent(); err == nil {
+			parts = append(parts, text.Text)
+			continue
+		}
+		parts = append(parts, "["+string(content.Type)+"]")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,160 @@
+package compacter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// DefaultReducePrompt is the default prompt used for combining summaries by MapReduceStrategy.
+// The numbered summaries follow it.
+var DefaultReducePrompt = `The following are summaries of consecutive parts of a conversation history. Combine them into a single concise summary that preserves all important information, context, and key details in order. The summary will be used to continue the conversation.`
+
+const (
+	defaultChunkChars           = 20000
+	defaultMapReduceConcurrency = 4
+	minReduceGroup              = 2
+)
+
+// MapReduceStrategy summarizes the oldest messages of the compact ratio of characters in chunks,
+// and combines the summaries into a single message, for histories too long to summarize at once.
+// Chunks are summarized concurrently. Summaries are combined in groups of ChunkChars until one
+// remains. Chunks are split at turns, so a turn longer than ChunkChars is a chunk by itself.
+type MapReduceStrategy struct {
+	// ChunkChars is the characters of a chunk of messages summarized at once, and of summaries
+	// combined at once. Default is 20000.
+	ChunkChars int
+	// Concurrency is the maximum number of concurrent LLM calls. Default is 4.
+	Concurrency int
+	// ReducePrompt is the prompt to combine summaries. Default is DefaultReducePrompt.
+	ReducePrompt string
+}
+
+// Compact implements CompactionStrategy.
+func (s *MapReduceStrategy) Compact(ctx context.Context, req *CompactionRequest) (*CompactionResult, error) {
+	totalChars := countMessageChars(req.History.Messages)
+	compactChars := int(float64(totalChars) * req.CompactRatio)
+
+	messagesToCompact, remainingMessages := extractMessagesToCompact(req.History.Messages, compactChars)
+	if len(messagesToCompact) == 0 {
+		return &CompactionResult{
+			History: req.History,
+			Reason:  fmt.Sprintf("no messages to compact within %d of %d characters", compactChars, totalChars),
+		}, nil
+	}
+
+	// Map: summarize each chunk
+	chunks := chunkMessages(messagesToCompact, s.chunkChars())
+	summaries := make([]string, len(chunks))
+	err := runConcurrently(ctx, len(chunks), s.concurrency(), func(ctx context.Context, i int) error {
+		summary, err := req.Summarize(ctx, chunks[i])
+		if err != nil {
+			return goerr.Wrap(err, "failed to summarize chunk", goerr.V("chunk", i))
+		}
+		summaries[i] = summary
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Reduce: combine the summaries until one remains
+	for len(summaries) > 1 {
+		if summaries, err = s.reduce(ctx, req, summaries); err != nil {
+			return nil, err
+		}
+	}
+
+	compacted, err := buildCompactedHistory(req.History, summaries[0], remainingMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompactionResult{
+		History:          compacted,
+		CompactedIndices: indexRange(0, len(messagesToCompact)),
+		Summary:          summaries[0],
+		Reason:           fmt.Sprintf("compacting %d of %d characters in %d chunks", compactChars, totalChars, len(chunks)),
+	}, nil
+}
+
+// reduce combines summaries in groups of ChunkChars, and returns the combined summaries.
+func (s *MapReduceStrategy) reduce(ctx context.Context, req *CompactionRequest, summaries []string) ([]string, error) {
+	prompt := s.ReducePrompt
+	if prompt == "" {
+		prompt = DefaultReducePrompt
+	}
+
+	var groups [][]string
+	var chars int
+	for _, summary := range summaries {
+		if n := len(groups); n > 0 && (len(groups[n-1]) < minReduceGroup || chars+len(summary) <= s.chunkChars()) {
+			groups[n-1] = append(groups[n-1], summary)
+			chars += len(summary)
+			continue
+		}
+		groups = append(groups, []string{summary})
+		chars = len(summary)
+	}
+
+	combined := make([]string, len(groups))
+	err := runConcurrently(ctx, len(groups), s.concurrency(), func(ctx context.Context, i int) error {
+		if len(groups[i]) == 1 {
+			combined[i] = groups[i][0]
+			return nil
+		}
+
+		var b strings.Builder
+		b.WriteString(prompt)
+		for j, summary := range groups[i] {
+			fmt.Fprintf(&b, "\n\n# Summary %d\n%s", j+1, summary)
+		}
+
+		// The summary is shown to the LLM in later turns, so it follows the locale of the agent
+		summary, err := req.Generate(ctx, nil, withLocale(ctx, b.String()))
+		if err != nil {
+			return goerr.Wrap(err, "failed to combine summaries", goerr.V("summaries", len(groups[i])))
+		}
+		combined[i] = summary
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return combined, nil
+}
+
+func (s *MapReduceStrategy) chunkChars() int {
+	if s.ChunkChars <= 0 {
+		return defaultChunkChars
+	}
+	return s.ChunkChars
+}
+
+func (s *MapReduceStrategy) concurrency() int {
+	if s.Concurrency <= 0 {
+		return defaultMapReduceConcurrency
+	}
+	return s.Concurrency
+}
+
+// chunkMessages splits messages into chunks of about chunkChars at turns.
+func chunkMessages(messages []gollem.Message, chunkChars int) [][]gollem.Message {
+	var chunks [][]gollem.Message
+	var chars int
+	for _, t := range splitTurns(messages) {
+		turnMessages := messages[t.start:t.end]
+		turnChars := countMessageChars(turnMessages)
+		if n := len(chunks); n > 0 && chars+turnChars <= chunkChars {
+			chunks[n-1] = append(chunks[n-1], turnMessages...)
+			chars += turnChars
+			continue
+		}
+		chunks = append(chunks, append([]gollem.Message(nil), turnMessages...))
+		chars = turnChars
+	}
+	return chunks
+}
@@ -0,0 +1,90 @@
+package compacter
+
+import (
+	"context"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// CompactionPreview is the result of Preview: what compaction would do to a history.
+type CompactionPreview struct {
+	// Summary is the summary that would replace the dropped messages, or empty if the strategy
+	// drops them without a summary
+	Summary string
+	// DroppedIndices is the indices of messages in the original history that would be
+	// summarized or dropped, in ascending order
+	DroppedIndices []int
+	// History is the history that compaction would produce. It shares no messages slice with
+	// the original history.
+	History *gollem.History
+
+	// TokensBefore and TokensAfter are the tokens of the history before and after compaction,
+	// counted by History.TokenBreakdown with gollem.TokenizerFromContext
+	TokensBefore int
+	TokensAfter  int
+	// TokensSaved is TokensBefore - TokensAfter
+	TokensSaved int
+
+	InputTokens  int // LLM input tokens used for summarization
+	OutputTokens int // LLM output tokens generated for summary
+}
+
+// Preview runs the same compaction strategy as the compacter middleware on history without
+// modifying it, so that applications can show users what compaction will do or compare
+// options before applying them. It takes the same options as NewContentBlockMiddleware, but
+// CompactionHook is not called. Preview calls llmClient as the strategy does, so it costs as much
+// as an actual compaction.
+//
+// If no message would be compacted, Preview returns a preview with no dropped messages and an
+// empty summary, and TokensAfter is equal to TokensBefore.
+func Preview(ctx context.Context, llmClient gollem.LLMClient, history *gollem.History, options ...Option) (*CompactionPreview, error) {
+	if history == nil || len(history.Messages) == 0 {
+		return nil, goerr.New("history is empty")
+	}
+
+	cfg := newConfig(llmClient, options...)
+
+	// Copy the messages slice so that nothing done for the preview reaches the caller's history
+	messages := make([]gollem.Message, len(history.Messages))
+	copy(messages, history.Messages)
+	source := &gollem.History{
+		LLType:   history.LLType,
+		Version:  history.Version,
+		Messages: messages,
+	}
+
+	counter := gollem.TokenizerFromContext(ctx).CountTokens
+	tokensBefore := source.TokenBreakdown(counter).Total
+
+	req := &CompactionRequest{
+		History:      source,
+		CompactRatio: cfg.compactRatio,
+		cfg:          cfg,
+	}
+	result, err := cfg.strategy.Compact(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &CompactionPreview{
+		DroppedIndices: []int{},
+		TokensBefore:   tokensBefore,
+	}
+
+	if len(result.CompactedIndices) == 0 {
+		preview.History = source
+		preview.TokensAfter = tokensBefore
+		return preview, nil
+	}
+
+	preview.DroppedIndices = append(preview.DroppedIndices, result.CompactedIndices...)
+	preview.Summary = result.Summary
+	preview.History = result.History
+	preview.TokensAfter = result.History.TokenBreakdown(counter).Total
+	preview.TokensSaved = preview.TokensBefore - preview.TokensAfter
+	preview.InputTokens = req.inputTokens
+	preview.OutputTokens = req.outputTokens
+
+	return preview, nil
+}
@@ -0,0 +1,92 @@
+package compacter_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPreview(t *testing.T) {
+	ctx := context.Background()
+
+	newClient := func() *mock.LLMClientMock {
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						return &gollem.Response{
+							Texts:       []string{"summary"},
+							InputToken:  120,
+							OutputToken: 8,
+						}, nil
+					},
+				}, nil
+			},
+		}
+	}
+
+	newHistory := func() *gollem.History {
+		return &gollem.History{
+			LLType:  gollem.LLMTypeClaude,
+			Version: gollem.HistoryVersion,
+			Messages: []gollem.Message{
+				createMessage(gollem.RoleUser, strings.Repeat("a", 400)),
+				createMessage(gollem.RoleAssistant, strings.Repeat("b", 400)),
+				createMessage(gollem.RoleUser, strings.Repeat("c", 100)),
+				createMessage(gollem.RoleAssistant, strings.Repeat("d", 100)),
+			},
+		}
+	}
+
+	t.Run("previews compaction without modifying history", func(t *testing.T) {
+		history := newHistory()
+		var hookCalled bool
+
+		preview, err := compacter.Preview(ctx, newClient(), history,
+			compacter.WithCompactRatio(0.7),
+			compacter.WithCompactionHook(func(ctx context.Context, event *compacter.CompactionEvent) {
+				hookCalled = true
+			}),
+		)
+		gt.NoError(t, err)
+
+		gt.Equal(t, "summary", preview.Summary)
+		gt.A(t, preview.DroppedIndices).Equal([]int{0, 1})
+		gt.Equal(t, 3, len(preview.History.Messages))
+		gt.Equal(t, gollem.RoleAssistant, preview.History.Messages[0].Role)
+		gt.Equal(t, 250, preview.TokensBefore)
+		gt.Equal(t, 52, preview.TokensAfter)
+		gt.Equal(t, 198, preview.TokensSaved)
+		gt.Equal(t, 120, preview.InputTokens)
+		gt.Equal(t, 8, preview.OutputTokens)
+		gt.False(t, hookCalled)
+
+		// Original history is untouched
+		gt.Equal(t, newHistory(), history)
+	})
+
+	t.Run("nothing to compact", func(t *testing.T) {
+		history := newHistory()
+		client := newClient()
+
+		preview, err := compacter.Preview(ctx, client, history, compacter.WithCompactRatio(2.0))
+		gt.NoError(t, err)
+
+		gt.Equal(t, "", preview.Summary)
+		gt.Equal(t, 0, len(preview.DroppedIndices))
+		gt.Equal(t, preview.TokensBefore, preview.TokensAfter)
+		gt.Equal(t, 0, preview.TokensSaved)
+		gt.Equal(t, 4, len(preview.History.Messages))
+		gt.Equal(t, 0, len(client.NewSessionCalls()))
+	})
+
+	t.Run("empty history", func(t *testing.T) {
+		_, err := compacter.Preview(ctx, newClient(), &gollem.History{})
+		gt.Error(t, err)
+	})
+}
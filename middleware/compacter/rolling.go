@@ -0,0 +1,118 @@
+package compacter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// rollingSummaryPrefix introduces the rolling summary in the first kept user message
+const rollingSummaryPrefix = "Summary of the earlier conversation:\n"
+
+// WithRollingContext makes the middleware compact the history before LLM calls, without waiting
+// for a token limit error. When the history has more than 2*keepTurns turns, turns older than the
+// last keepTurns are replaced with a summary. The previous summary is part of the replaced turns,
+// so each compaction only summarizes the summary and the turns added since then. Follow-up
+// requests of a chat then send the recent turns and a short rolling context instead of the full
+// history. The compaction is done on the client side, and the whole reduced history is sent on
+// each call, because the providers of gollem do not keep conversation state on the server side.
+// A turn starts at a user message other than tool results, so that tool calls of a kept turn are
+// never split. Compaction errors are logged and the full history is sent.
+func WithRollingContext(keepTurns int) Option {
+	return func(c *config) {
+		c.rollingTurns = keepTurns
+	}
+}
+
+// rollHistory replaces turns older than the last cfg.rollingTurns with a summary if the history
+// has more than twice as many turns. It returns history as is if no compaction is needed.
+func rollHistory(ctx context.Context, history *gollem.History, cfg *config) (*gollem.History, error) {
+	if cfg.rollingTurns <= 0 || history == nil {
+		return history, nil
+	}
+
+	var turnStarts []int
+	for i, msg := range history.Messages {
+		if isTurnStart(msg) {
+			turnStarts = append(turnStarts, i)
+		}
+	}
+	decision := newDecision(ctx, TriggerRolling, history)
+	decision.Turns = len(turnStarts)
+	decision.TurnThreshold = cfg.rollingTurns * 2
+	if decision.Turns <= decision.TurnThreshold {
+		decision.Reason = fmt.Sprintf("%d turns do not exceed the threshold of %d turns", decision.Turns, decision.TurnThreshold)
+		recordDecision(ctx, cfg, decision)
+		return history, nil
+	}
+
+	split := turnStarts[len(turnStarts)-cfg.rollingTurns]
+	messagesToCompact := history.Messages[:split]
+	remainingMessages := history.Messages[split:]
+
+	cfg.logger.Info("rolling history context",
+		"messages_before", len(history.Messages),
+		"messages_to_summarize", len(messagesToCompact),
+		"keep_turns", cfg.rollingTurns,
+	)
+
+	resp, summary, err := summarizeMessages(ctx, history, messagesToCompact, cfg)
+	if err != nil {
+		decision.Reason = "failed to summarize: " + err.Error()
+		recordDecision(ctx, cfg, decision)
+		return nil, err
+	}
+
+	decision.Compacted = true
+	decision.CompactedMessages = len(messagesToCompact)
+	decision.Reason = fmt.Sprintf("%d turns exceed the threshold of %d turns", decision.Turns, decision.TurnThreshold)
+	recordDecision(ctx, cfg, decision)
+
+	summaryContent, err := gollem.NewTextContent(rollingSummaryPrefix + summary)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to create summary content")
+	}
+
+	// Put the summary in the first kept user message to keep the history starting with a user
+	// message and alternating roles
+	rolled := &gollem.History{
+		LLType:   history.LLType,
+		Version:  history.Version,
+		Messages: slices.Clone(remainingMessages),
+	}
+	first := rolled.Messages[0]
+	first.Contents = append([]gollem.MessageContent{summaryContent}, first.Contents...)
+	first.Metadata = maps.Clone(first.Metadata)
+	if first.Metadata == nil {
+		first.Metadata = make(map[string]any)
+	}
+	first.Metadata[gollem.MetadataCompactionSummary] = true
+	rolled.Messages[0] = first
+
+	if cfg.onCompaction != nil {
+		cfg.onCompaction(ctx, &CompactionEvent{
+			OriginalDataSize:  countMessageChars(history.Messages),
+			CompactedDataSize: countMessageChars(rolled.Messages),
+			InputTokens:       resp.InputToken,
+			OutputTokens:      resp.OutputToken,
+			Summary:           summary,
+			Decision:          decision,
+		})
+	}
+
+	return rolled, nil
+}
+
+// applyRollingContext rolls the history of req, keeping the history as is on failure.
+func applyRollingContext(ctx context.Context, req *gollem.ContentRequest, cfg *config) {
+	rolled, err := rollHistory(ctx, req.History, cfg)
+	if err != nil {
+		cfg.logger.Warn("failed to roll history context", "error", err)
+		return
+	}
+	req.History = rolled
+}
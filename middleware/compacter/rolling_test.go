@@ -0,0 +1,177 @@
+package compacter_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestRollingContext(t *testing.T) {
+	ctx := context.Background()
+
+	var summarized [][]gollem.Message
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					summarized = append(summarized, cfg.History().Messages)
+					return &gollem.Response{Texts: []string{"summary"}, InputToken: 10, OutputToken: 2}, nil
+				},
+			}, nil
+		},
+	}
+
+	var events []*compacter.CompactionEvent
+	middleware := compacter.NewContentBlockMiddleware(mockClient,
+		compacter.WithRollingContext(1),
+		compacter.WithCompactionHook(func(ctx context.Context, event *compacter.CompactionEvent) {
+			events = append(events, event)
+		}),
+	)
+
+	var sent *gollem.History
+	handler := middleware(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		sent = req.History
+		return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+	})
+
+	call := func(messages ...gollem.Message) {
+		_, err := handler(ctx, &gollem.ContentRequest{
+			Inputs:  []gollem.Input{gollem.Text("next")},
+			History: &gollem.History{Version: gollem.HistoryVersion, Messages: messages},
+		})
+		gt.NoError(t, err)
+	}
+
+	t.Run("history within the limit is sent as is", func(t *testing.T) {
+		call(
+			createMessage(gollem.RoleUser, "Q1"),
+			createMessage(gollem.RoleAssistant, "A1"),
+			createMessage(gollem.RoleUser, "Q2"),
+			createMessage(gollem.RoleAssistant, "A2"),
+		)
+		gt.A(t, sent.Messages).Length(4)
+		gt.A(t, summarized).Length(0)
+	})
+
+	t.Run("old turns are replaced with a summary", func(t *testing.T) {
+		call(
+			createMessage(gollem.RoleUser, "Q1"),
+			createMessage(gollem.RoleAssistant, "A1"),
+			createMessage(gollem.RoleUser, "Q2"),
+			createMessage(gollem.RoleAssistant, "A2"),
+			createMessage(gollem.RoleUser, "Q3"),
+			createMessage(gollem.RoleAssistant, "A3"),
+		)
+		gt.A(t, summarized).Length(1)
+		gt.A(t, summarized[0]).Length(4)
+
+		gt.A(t, sent.Messages).Length(2)
+		gt.Equal(t, gollem.RoleUser, sent.Messages[0].Role)
+		gt.True(t, sent.Messages[0].IsCompactionSummary())
+		summary, err := sent.Messages[0].Contents[0].GetTextContent()
+		gt.NoError(t, err)
+		gt.True(t, strings.HasSuffix(summary.Text, "summary"))
+		question, err := sent.Messages[0].Contents[1].GetTextContent()
+		gt.NoError(t, err)
+		gt.Equal(t, "Q3", question.Text)
+
+		gt.A(t, events).Length(1)
+		gt.Equal(t, 0, events[0].Attempt)
+		gt.Equal(t, "summary", events[0].Summary)
+	})
+
+	t.Run("next compaction summarizes only the previous summary and new turns", func(t *testing.T) {
+		rolled := sent.Messages
+		call(append(rolled,
+			createMessage(gollem.RoleUser, "Q4"),
+			createMessage(gollem.RoleAssistant, "A4"),
+			createMessage(gollem.RoleUser, "Q5"),
+			createMessage(gollem.RoleAssistant, "A5"),
+		)...)
+		gt.A(t, summarized).Length(2)
+		// summary with Q3, A3, Q4 and A4
+		gt.A(t, summarized[1]).Length(4)
+		gt.A(t, sent.Messages).Length(2)
+	})
+}
+
+func TestRollingContextToolCalls(t *testing.T) {
+	var summarized [][]gollem.Message
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					summarized = append(summarized, cfg.History().Messages)
+					return &gollem.Response{Texts: []string{"summary"}}, nil
+				},
+			}, nil
+		},
+	}
+
+	var sent *gollem.History
+	handler := compacter.NewContentBlockMiddleware(mockClient, compacter.WithRollingContext(1))(
+		func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			sent = req.History
+			return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+		})
+
+	// toolLoop returns a tool call and its result n times. Tool results are user messages as in
+	// histories of Claude and Gemini.
+	toolLoop := func(n int) []gollem.Message {
+		var messages []gollem.Message
+		for i := range n {
+			id := fmt.Sprintf("call_%d", i)
+			call, err := gollem.NewToolCallContent(id, "search", map[string]any{"q": "x"})
+			gt.NoError(t, err)
+			result, err := gollem.NewToolResponseContent(id, "search", map[string]any{"r": "y"}, false)
+			gt.NoError(t, err)
+			messages = append(messages,
+				gollem.Message{Role: gollem.RoleAssistant, Contents: []gollem.MessageContent{call}},
+				gollem.Message{Role: gollem.RoleUser, Contents: []gollem.MessageContent{result}},
+			)
+		}
+		return messages
+	}
+	call := func(messages []gollem.Message) {
+		_, err := handler(t.Context(), &gollem.ContentRequest{
+			Inputs:  []gollem.Input{gollem.Text("next")},
+			History: &gollem.History{LLType: gollem.LLMTypeClaude, Version: gollem.HistoryVersion, Messages: messages},
+		})
+		gt.NoError(t, err)
+	}
+
+	t.Run("tool loop of a turn is not split", func(t *testing.T) {
+		messages := append([]gollem.Message{createMessage(gollem.RoleUser, "Q1")}, toolLoop(3)...)
+		call(append(messages, createMessage(gollem.RoleAssistant, "A1")))
+		gt.A(t, summarized).Length(0)
+		gt.A(t, sent.Messages).Length(8)
+	})
+
+	t.Run("turns with tool loops are rolled at user messages", func(t *testing.T) {
+		var messages []gollem.Message
+		for _, q := range []string{"Q1", "Q2", "Q3"} {
+			messages = append(messages, createMessage(gollem.RoleUser, q))
+			messages = append(messages, toolLoop(2)...)
+			messages = append(messages, createMessage(gollem.RoleAssistant, "A"))
+		}
+		call(messages)
+
+		gt.A(t, summarized).Length(1)
+		gt.A(t, summarized[0]).Length(12)
+		gt.A(t, sent.Messages).Length(6)
+		gt.True(t, sent.Messages[0].IsCompactionSummary())
+		question, err := sent.Messages[0].Contents[1].GetTextContent()
+		gt.NoError(t, err)
+		gt.Equal(t, "Q3", question.Text)
+		gt.Equal(t, gollem.MessageContentTypeToolCall, sent.Messages[1].Contents[0].Type)
+	})
+}
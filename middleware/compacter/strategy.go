@@ -0,0 +1,273 @@
+package compacter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// CompactionStrategy decides which messages of a history to compact and how, e.g. by
+// summarizing or dropping them. It's used for compaction on token limit errors, by
+// NewHistoryCompactor and by Preview, while WithRollingContext always summarizes old turns.
+// Default is SummaryStrategy.
+type CompactionStrategy interface {
+	Compact(ctx context.Context, req *CompactionRequest) (*CompactionResult, error)
+}
+
+// CompactionRequest is a history to compact by a CompactionStrategy. Its Summarize and Generate
+// call the LLM client of the middleware and count the tokens for CompactionEvent.
+type CompactionRequest struct {
+	// History is the history to compact. Strategies must not modify it.
+	History *gollem.History
+	// CompactRatio is the ratio of the characters of the history to compact by WithCompactRatio
+	CompactRatio float64
+	// MaxTokens is the tokens that the whole request should fit in for NewHistoryCompactor, or 0
+	// if unknown
+	MaxTokens int
+
+	cfg          *config
+	mu           sync.Mutex
+	inputTokens  int
+	outputTokens int
+}
+
+// CompactionResult is the result of a CompactionStrategy.
+type CompactionResult struct {
+	// History is the compacted history, or the original history if nothing is compacted
+	History *gollem.History
+	// CompactedIndices is the indices of messages in the original history that are summarized
+	// or dropped, in ascending order. It's empty if nothing is compacted.
+	CompactedIndices []int
+	// Summary is the summary replacing the compacted messages, or empty if they are dropped
+	// without a summary
+	Summary string
+	// Reason describes what is compacted, or why nothing is compacted, for CompactionDecision
+	Reason string
+}
+
+// WithCompactionStrategy sets the strategy of compaction (default: SummaryStrategy)
+func WithCompactionStrategy(strategy CompactionStrategy) Option {
+	return func(c *config) {
+		c.strategy = strategy
+	}
+}
+
+// Summarize summarizes messages by the summary prompt of WithSummaryPrompt, following the locale
+// of the agent. It's safe for concurrent use.
+func (r *CompactionRequest) Summarize(ctx context.Context, messages []gollem.Message) (string, error) {
+	resp, summary, err := summarizeMessages(ctx, r.History, messages, r.cfg)
+	if err != nil {
+		return "", err
+	}
+	r.addUsage(resp)
+	return summary, nil
+}
+
+// Generate generates a text for prompt with messages as the history. options are added to the
+// session, e.g. gollem.WithSessionContentType for a JSON response. It's safe for concurrent use.
+func (r *CompactionRequest) Generate(ctx context.Context, messages []gollem.Message, prompt string, options ...gollem.SessionOption) (string, error) {
+	resp, text, err := generateText(ctx, r.History, messages, r.cfg, prompt, options...)
+	if err != nil {
+		return "", err
+	}
+	r.addUsage(resp)
+	return text, nil
+}
+
+// addUsage adds the tokens of resp to the request.
+func (r *CompactionRequest) addUsage(resp *gollem.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inputTokens += resp.InputToken
+	r.outputTokens += resp.OutputToken
+}
+
+// SummaryStrategy summarizes the oldest messages of the compact ratio of characters into a
+// single message by the LLM. It's the default strategy.
+type SummaryStrategy struct{}
+
+// Compact implements CompactionStrategy.
+func (s *SummaryStrategy) Compact(ctx context.Context, req *CompactionRequest) (*CompactionResult, error) {
+	totalChars := countMessageChars(req.History.Messages)
+	compactChars := int(float64(totalChars) * req.CompactRatio)
+
+	messagesToCompact, remainingMessages := extractMessagesToCompact(req.History.Messages, compactChars)
+	if len(messagesToCompact) == 0 {
+		return &CompactionResult{
+			History: req.History,
+			Reason:  fmt.Sprintf("no messages to compact within %d of %d characters", compactChars, totalChars),
+		}, nil
+	}
+
+	summary, err := req.Summarize(ctx, messagesToCompact)
+	if err != nil {
+		return nil, err
+	}
+	compacted, err := buildCompactedHistory(req.History, summary, remainingMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompactionResult{
+		History:          compacted,
+		CompactedIndices: indexRange(0, len(messagesToCompact)),
+		Summary:          summary,
+		Reason:           fmt.Sprintf("compacting %d of %d characters", compactChars, totalChars),
+	}, nil
+}
+
+// SlidingWindowStrategy drops the oldest turns of the history without summarizing them, so that
+// it compacts without an LLM call at the cost of losing their context. Turns are dropped until
+// the characters of the compact ratio are dropped, and the last turn is always kept. A turn
+// starts at a user message other than tool results, so that tool calls keep their results.
+type SlidingWindowStrategy struct{}
+
+// Compact implements CompactionStrategy.
+func (s *SlidingWindowStrategy) Compact(ctx context.Context, req *CompactionRequest) (*CompactionResult, error) {
+	messages := req.History.Messages
+	totalChars := countMessageChars(messages)
+	compactChars := int(float64(totalChars) * req.CompactRatio)
+
+	turns := selectOldTurns(messages, compactChars)
+	if len(turns) == 0 {
+		return &CompactionResult{
+			History: req.History,
+			Reason:  fmt.Sprintf("no turns to drop within %d of %d characters", compactChars, totalChars),
+		}, nil
+	}
+
+	split := turns[len(turns)-1].end
+	remaining := make([]gollem.Message, len(messages)-split)
+	copy(remaining, messages[split:])
+
+	return &CompactionResult{
+		History: &gollem.History{
+			LLType:   req.History.LLType,
+			Version:  req.History.Version,
+			Messages: remaining,
+		},
+		CompactedIndices: indexRange(0, split),
+		Reason:           fmt.Sprintf("dropping %d turns of %d of %d characters", len(turns), countMessageChars(messages[:split]), totalChars),
+	}, nil
+}
+
+// turn is the range of messages of a turn in a history.
+type turn struct {
+	start, end int
+}
+
+// splitTurns splits messages into turns. The first turn starts at the first message even if it's
+// not a user message, e.g. a summary of a previous compaction.
+func splitTurns(messages []gollem.Message) []turn {
+	var turns []turn
+	for i, msg := range messages {
+		if i == 0 || isTurnStart(msg) {
+			if len(turns) > 0 {
+				turns[len(turns)-1].end = i
+			}
+			turns = append(turns, turn{start: i})
+		}
+	}
+	if len(turns) > 0 {
+		turns[len(turns)-1].end = len(messages)
+	}
+	return turns
+}
+
+// selectOldTurns returns the oldest turns of messages until their characters reach targetChars,
+// excluding the last turn.
+func selectOldTurns(messages []gollem.Message, targetChars int) []turn {
+	turns := splitTurns(messages)
+	if len(turns) < 2 || targetChars <= 0 {
+		return nil
+	}
+
+	var chars int
+	for i, t := range turns[:len(turns)-1] {
+		chars += countMessageChars(messages[t.start:t.end])
+		if chars >= targetChars {
+			return turns[:i+1]
+		}
+	}
+	return turns[:len(turns)-1]
+}
+
+// isTurnStart returns true if msg is a user message other than tool results.
+func isTurnStart(msg gollem.Message) bool {
+	if msg.Role != gollem.RoleUser {
+		return false
+	}
+	for _, content := range msg.Contents {
+		if content.Type == gollem.MessageContentTypeToolResponse {
+			return false
+		}
+	}
+	return true
+}
+
+// indexRange returns the indices from start to end (exclusive).
+func indexRange(start, end int) []int {
+	indices := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// withLocale appends the prompt of the locale of the agent to prompt, for texts shown to the
+// LLM in later turns such as summaries.
+func withLocale(ctx context.Context, prompt string) string {
+	if locale := gollem.LocaleFromContext(ctx); locale != nil && locale.Prompt() != "" {
+		return prompt + "\n\n" + locale.Prompt()
+	}
+	return prompt
+}
+
+// runConcurrently calls fn for 0 to n-1 with at most concurrency calls at a time, and returns
+// the first error.
+func runConcurrently(ctx context.Context, n, concurrency int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, max(concurrency, 1))
+	for i := range n {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return goerr.Wrap(err, "compaction canceled")
+	}
+	return nil
+}
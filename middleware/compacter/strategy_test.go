@@ -0,0 +1,263 @@
+package compacter_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/compacter"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// strategyClient is a client for strategies. It summarizes a history into "summary of " and the
+// first letter of its first message, or a long summary if longSummary is set, scores turns by
+// scores for JSON sessions, and combines summaries into "combined".
+type strategyClient struct {
+	scores      string
+	longSummary bool
+
+	mu sync.Mutex
+	// summarized is the texts of each history summarized
+	summarized [][]string
+	// prompts is the prompts of calls without a history
+	prompts []string
+}
+
+func (c *strategyClient) client() *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					c.mu.Lock()
+					defer c.mu.Unlock()
+
+					resp := &gollem.Response{InputToken: 10, OutputToken: 1}
+					switch {
+					case cfg.ContentType() == gollem.ContentTypeJSON:
+						c.prompts = append(c.prompts, input[0].String())
+						resp.Texts = []string{c.scores}
+					case cfg.History() == nil:
+						c.prompts = append(c.prompts, input[0].String())
+						resp.Texts = []string{"combined"}
+					default:
+						var texts []string
+						for _, msg := range cfg.History().Messages {
+							texts = append(texts, messageText(msg))
+						}
+						c.summarized = append(c.summarized, texts)
+						letter := texts[0][:1]
+						if c.longSummary {
+							resp.Texts = []string{strings.Repeat(letter, 150)}
+						} else {
+							resp.Texts = []string{"summary of " + letter}
+						}
+					}
+					return resp, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func messageText(msg gollem.Message) string {
+	for _, content := range msg.Contents {
+		if text, err := content.GetTextContent(); err == nil {
+			return text.Text
+		}
+	}
+	return ""
+}
+
+// turnsHistory returns a history of a turn of a user message and an assistant message for each
+// letter, each of which has n characters of the letter.
+func turnsHistory(letters string, n int) *gollem.History {
+	history := &gollem.History{LLType: gollem.LLMTypeClaude, Version: gollem.HistoryVersion}
+	for _, letter := range letters {
+		history.Messages = append(history.Messages,
+			createMessage(gollem.RoleUser, strings.Repeat(string(letter), n)),
+			createMessage(gollem.RoleAssistant, strings.Repeat(string(letter), n)),
+		)
+	}
+	return history
+}
+
+func TestSlidingWindowStrategy(t *testing.T) {
+	toolCall, err := gollem.NewToolCallContent("call_1", "search", map[string]any{"q": "x"})
+	gt.NoError(t, err)
+	toolResponse, err := gollem.NewToolResponseContent("call_1", "search", map[string]any{"result": "y"}, false)
+	gt.NoError(t, err)
+
+	history := turnsHistory("abc", 100)
+	// The first turn has a tool call, and its result is not a turn start
+	history.Messages = append(history.Messages[:1], append([]gollem.Message{
+		{Role: gollem.RoleAssistant, Contents: []gollem.MessageContent{toolCall}},
+		{Role: gollem.RoleUser, Contents: []gollem.MessageContent{toolResponse}},
+	}, history.Messages[1:]...)...)
+
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return nil, errors.New("LLM must not be called")
+		},
+	}
+
+	t.Run("drops the oldest turns", func(t *testing.T) {
+		preview, err := compacter.Preview(t.Context(), client, history,
+			compacter.WithCompactionStrategy(&compacter.SlidingWindowStrategy{}),
+			compacter.WithCompactRatio(0.3),
+		)
+		gt.NoError(t, err)
+		gt.A(t, preview.DroppedIndices).Equal([]int{0, 1, 2, 3})
+		gt.Equal(t, "", preview.Summary)
+		gt.A(t, preview.History.Messages).Length(4)
+		gt.Equal(t, strings.Repeat("b", 100), messageText(preview.History.Messages[0]))
+	})
+
+	t.Run("keeps the last turn", func(t *testing.T) {
+		compactor := compacter.NewHistoryCompactor(client,
+			compacter.WithCompactionStrategy(&compacter.SlidingWindowStrategy{}),
+			compacter.WithCompactRatio(1.0),
+		)
+		compacted, err := compactor(t.Context(), history, 100)
+		gt.NoError(t, err)
+		gt.A(t, compacted.Messages).Length(2)
+		gt.Equal(t, strings.Repeat("c", 100), messageText(compacted.Messages[0]))
+		gt.A(t, history.Messages).Length(8)
+	})
+}
+
+func TestImportanceStrategy(t *testing.T) {
+	t.Run("keeps turns of high scores", func(t *testing.T) {
+		c := &strategyClient{scores: `{"scores": [2, 9, 8, 1]}`}
+		preview, err := compacter.Preview(t.Context(), c.client(), turnsHistory("abcde", 100),
+			compacter.WithCompactionStrategy(&compacter.ImportanceStrategy{}),
+			compacter.WithCompactRatio(0.8),
+		)
+		gt.NoError(t, err)
+
+		gt.A(t, c.prompts).Length(1)
+		gt.S(t, c.prompts[0]).Contains("# Turn 4\n")
+		gt.S(t, c.prompts[0]).NotContains("# Turn 5\n")
+
+		// Turns a and d are summarized, and b and c are kept
+		gt.A(t, c.summarized).Length(1)
+		gt.A(t, c.summarized[0]).Length(4)
+		gt.Equal(t, strings.Repeat("d", 100), c.summarized[0][2])
+		gt.A(t, preview.DroppedIndices).Equal([]int{0, 1, 6, 7})
+
+		gt.Equal(t, "summary of a", preview.Summary)
+		gt.A(t, preview.History.Messages).Length(7)
+		gt.True(t, preview.History.Messages[0].IsCompactionSummary())
+		gt.Equal(t, strings.Repeat("b", 100), messageText(preview.History.Messages[1]))
+		gt.Equal(t, strings.Repeat("c", 100), messageText(preview.History.Messages[3]))
+		gt.Equal(t, strings.Repeat("e", 100), messageText(preview.History.Messages[5]))
+		gt.Equal(t, 20, preview.InputTokens)
+	})
+
+	t.Run("min score", func(t *testing.T) {
+		c := &strategyClient{scores: `{"scores": [2, 9, 8, 1]}`}
+		preview, err := compacter.Preview(t.Context(), c.client(), turnsHistory("abcde", 100),
+			compacter.WithCompactionStrategy(&compacter.ImportanceStrategy{MinScore: 9}),
+			compacter.WithCompactRatio(0.8),
+		)
+		gt.NoError(t, err)
+		gt.A(t, preview.DroppedIndices).Equal([]int{0, 1, 4, 5, 6, 7})
+	})
+
+	t.Run("invalid scores", func(t *testing.T) {
+		c := &strategyClient{scores: "not json"}
+		_, err := compacter.Preview(t.Context(), c.client(), turnsHistory("abcde", 100),
+			compacter.WithCompactionStrategy(&compacter.ImportanceStrategy{}),
+		)
+		gt.Error(t, err)
+		gt.A(t, c.summarized).Length(0)
+	})
+}
+
+func TestMapReduceStrategy(t *testing.T) {
+	c := &strategyClient{longSummary: true}
+	preview, err := compacter.Preview(t.Context(), c.client(), turnsHistory("abcde", 100),
+		compacter.WithCompactionStrategy(&compacter.MapReduceStrategy{ChunkChars: 200}),
+		compacter.WithCompactRatio(0.8),
+	)
+	gt.NoError(t, err)
+
+	// Each of 4 turns is a chunk
+	gt.A(t, c.summarized).Length(4)
+	for _, texts := range c.summarized {
+		gt.A(t, texts).Length(2)
+	}
+
+	// Summaries of 150 characters are combined in pairs, and the 2 results are combined at last
+	gt.A(t, c.prompts).Length(3)
+	for _, prompt := range c.prompts {
+		gt.S(t, prompt).Contains("# Summary 2\n")
+		gt.S(t, prompt).NotContains("# Summary 3\n")
+	}
+
+	gt.Equal(t, "combined", preview.Summary)
+	gt.A(t, preview.DroppedIndices).Equal([]int{0, 1, 2, 3, 4, 5, 6, 7})
+	gt.A(t, preview.History.Messages).Length(3)
+	gt.Equal(t, 70, preview.InputTokens)
+}
+
+// customStrategy drops the first message after asking the LLM.
+type customStrategy struct{}
+
+func (s *customStrategy) Compact(ctx context.Context, req *compacter.CompactionRequest) (*compacter.CompactionResult, error) {
+	summary, err := req.Generate(ctx, req.History.Messages[:1], "describe")
+	if err != nil {
+		return nil, err
+	}
+	return &compacter.CompactionResult{
+		History: &gollem.History{
+			LLType:   req.History.LLType,
+			Version:  req.History.Version,
+			Messages: req.History.Messages[1:],
+		},
+		CompactedIndices: []int{0},
+		Summary:          summary,
+		Reason:           "custom",
+	}, nil
+}
+
+func TestWithCompactionStrategy(t *testing.T) {
+	c := &strategyClient{}
+	var events []*compacter.CompactionEvent
+	middleware := compacter.NewContentBlockMiddleware(c.client(),
+		compacter.WithCompactionStrategy(&customStrategy{}),
+		compacter.WithCompactionHook(func(ctx context.Context, event *compacter.CompactionEvent) {
+			events = append(events, event)
+		}),
+	)
+
+	var sent []*gollem.History
+	handler := middleware(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		sent = append(sent, req.History)
+		if len(sent) == 1 {
+			return nil, goerr.Wrap(gollem.ErrTokenSizeExceeded, "token limit exceeded", goerr.Tag(gollem.ErrTagTokenExceeded))
+		}
+		return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+	})
+
+	_, err := handler(t.Context(), &gollem.ContentRequest{
+		Inputs:  []gollem.Input{gollem.Text("hello")},
+		History: turnsHistory("ab", 10),
+	})
+	gt.NoError(t, err)
+	gt.A(t, sent).Length(2)
+	gt.A(t, sent[1].Messages).Length(3)
+
+	gt.A(t, events).Length(1)
+	gt.Equal(t, "summary of a", events[0].Summary)
+	gt.Equal(t, 10, events[0].InputTokens)
+	gt.Equal(t, 40, events[0].OriginalDataSize)
+	gt.Equal(t, 30, events[0].CompactedDataSize)
+	gt.Equal(t, "token limit exceeded; custom", events[0].Decision.Reason)
+	gt.Equal(t, 1, events[0].Decision.CompactedMessages)
+}
@@ -0,0 +1,223 @@
+package governor
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// DelayEvent contains information about an LLM call that has to wait for the token bucket.
+type DelayEvent struct {
+	Key      string  // Key of the delayed call
+	Estimate float64 // Estimated cost of the delayed call
+	Queued   int     // Number of calls waiting, including the delayed call
+	Tokens   float64 // Tokens in the bucket; negative while actual costs exceeded estimates
+}
+
+// DelayHook is a function called when an LLM call is delayed by the token bucket.
+type DelayHook func(ctx context.Context, event *DelayEvent)
+
+// BucketOption is a configuration option for TokenBucket
+type BucketOption func(*TokenBucket)
+
+// WithDelayHook sets a callback function that is called when a call starts waiting.
+func WithDelayHook(hook DelayHook) BucketOption {
+	return func(b *TokenBucket) {
+		b.onDelay = hook
+	}
+}
+
+// WithClock sets the clock to refill the bucket, e.g. gollem.NewStepClock for deterministic
+// tests. Default is time.Now. Waiting calls are still dispatched by timers of the real time.
+func WithClock(clock gollem.Clock) BucketOption {
+	return func(b *TokenBucket) {
+		b.now = clock
+	}
+}
+
+// TokenBucket is an in-process Governor based on the token bucket algorithm. The bucket holds
+// up to burst tokens and is refilled by rate tokens per second. A call is admitted when the
+// bucket has its estimate (capped to burst) and the estimate is taken from the bucket; the
+// difference from the actual cost is taken or returned on Settle, so the bucket can go into
+// debt and delay later calls.
+//
+// Waiting calls are served by round robin over keys, and in FIFO order within a key, so an
+// agent issuing many calls does not starve others. A waiting call at the head of the queue is
+// not overtaken by cheaper calls.
+type TokenBucket struct {
+	rate    float64
+	burst   float64
+	onDelay DelayHook
+	now     gollem.Clock
+
+	mu      sync.Mutex
+	tokens  float64
+	updated time.Time
+	queues  map[string][]*waiter
+	keys    []string // keys with waiting calls, in round robin order
+	timer   *time.Timer
+}
+
+type waiter struct {
+	estimate float64
+	admitted bool
+	ready    chan struct{}
+}
+
+// NewTokenBucket creates a TokenBucket refilled by rate tokens per second and holding up to
+// burst tokens. The bucket starts full.
+func NewTokenBucket(rate, burst float64, options ...BucketOption) (*TokenBucket, error) {
+	if rate <= 0 {
+		return nil, goerr.New("rate must be positive", goerr.V("rate", rate))
+	}
+	if burst <= 0 {
+		return nil, goerr.New("burst must be positive", goerr.V("burst", burst))
+	}
+
+	b := &TokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		queues: make(map[string][]*waiter),
+		now:    time.Now,
+	}
+
+	for _, opt := range options {
+		opt(b)
+	}
+	b.updated = b.now()
+
+	return b, nil
+}
+
+var _ Governor = (*TokenBucket)(nil)
+
+// Acquire implements Governor.
+func (b *TokenBucket) Acquire(ctx context.Context, key string, estimate float64) error {
+	w := &waiter{estimate: estimate, ready: make(chan struct{})}
+
+	b.mu.Lock()
+	if _, ok := b.queues[key]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.queues[key] = append(b.queues[key], w)
+	b.dispatch()
+	admitted, queued, tokens := w.admitted, b.queued(), b.tokens
+	b.mu.Unlock()
+
+	if admitted {
+		return nil
+	}
+
+	if b.onDelay != nil {
+		b.onDelay(ctx, &DelayEvent{Key: key, Estimate: estimate, Queued: queued, Tokens: tokens})
+	}
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if w.admitted {
+			// admitted concurrently, return the estimate so that others can use it
+			b.tokens = min(b.tokens+w.estimate, b.burst)
+		} else {
+			b.remove(key, w)
+		}
+		b.dispatch()
+		return goerr.Wrap(ctx.Err(), "canceled while waiting for token bucket", goerr.V("key", key))
+	}
+}
+
+// Settle implements Governor.
+func (b *TokenBucket) Settle(ctx context.Context, key string, estimate, actual float64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens = min(b.tokens-(actual-estimate), b.burst)
+	b.dispatch()
+	return nil
+}
+
+// Tokens returns the current number of tokens in the bucket.
+func (b *TokenBucket) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	return b.tokens
+}
+
+func (b *TokenBucket) refill() {
+	now := b.now()
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed*b.rate, b.burst)
+	}
+	b.updated = now
+}
+
+// dispatch admits waiting calls in round robin order while the bucket has enough tokens, and
+// schedules the next dispatch if calls are still waiting. It must be called with mu held.
+func (b *TokenBucket) dispatch() {
+	b.refill()
+
+	for len(b.keys) > 0 {
+		key := b.keys[0]
+		w := b.queues[key][0]
+		if b.tokens < min(max(w.estimate, 0), b.burst) {
+			break
+		}
+
+		b.tokens -= w.estimate
+		w.admitted = true
+		close(w.ready)
+
+		// move key to the tail so that other keys are served next
+		b.keys = b.keys[1:]
+		if b.queues[key] = b.queues[key][1:]; len(b.queues[key]) > 0 {
+			b.keys = append(b.keys, key)
+		} else {
+			delete(b.queues, key)
+		}
+	}
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.keys) > 0 {
+		head := b.queues[b.keys[0]][0]
+		lack := min(max(head.estimate, 0), b.burst) - b.tokens
+		wait := time.Duration(math.Ceil(lack / b.rate * float64(time.Second)))
+		b.timer = time.AfterFunc(wait, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.dispatch()
+		})
+	}
+}
+
+func (b *TokenBucket) remove(key string, w *waiter) {
+	queue := slices.DeleteFunc(b.queues[key], func(v *waiter) bool { return v == w })
+	if len(queue) > 0 {
+		b.queues[key] = queue
+		return
+	}
+	delete(b.queues, key)
+	b.keys = slices.DeleteFunc(b.keys, func(k string) bool { return k == key })
+}
+
+func (b *TokenBucket) queued() int {
+	var n int
+	for _, queue := range b.queues {
+		n += len(queue)
+	}
+	return n
+}
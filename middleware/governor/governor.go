@@ -0,0 +1,163 @@
+// Package governor provides middleware that controls the LLM spend rate shared by multiple
+// agents. Every agent configured with the same Governor consults it before each LLM call, so
+// an organization-level rate limit of tokens (or any other cost unit) is enforced across
+// agents. TokenBucket is an in-process Governor; implement Governor to share the limit
+// across processes, e.g. with Redis.
+package governor
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/m-mizutani/gollem"
+)
+
+// Governor decides when an LLM call may be sent.
+type Governor interface {
+	// Acquire blocks until a call of key with the estimated cost is allowed, or ctx is done.
+	// Calls of different keys are expected to be served fairly.
+	Acquire(ctx context.Context, key string, estimate float64) error
+
+	// Settle records the actual cost of a call admitted by Acquire with estimate.
+	Settle(ctx context.Context, key string, estimate, actual float64) error
+}
+
+// CostFunc returns the cost of a finished LLM call.
+type CostFunc func(resp *gollem.ContentResponse) float64
+
+// EstimateFunc returns the estimated cost of an LLM call before it is sent.
+type EstimateFunc func(req *gollem.ContentRequest) float64
+
+type config struct {
+	key      string
+	cost     CostFunc
+	estimate EstimateFunc
+	logger   *slog.Logger
+}
+
+// Option is a configuration option for the governor middleware
+type Option func(*config)
+
+// WithKey sets the key that identifies the caller for fair queuing, e.g. an agent or tenant
+// name (default: empty string). Agents sharing a key share a single queue.
+func WithKey(key string) Option {
+	return func(c *config) {
+		c.key = key
+	}
+}
+
+// WithCostFunc sets the function to compute the cost of a call (default: the sum of input and
+// output tokens).
+func WithCostFunc(fn CostFunc) Option {
+	return func(c *config) {
+		c.cost = fn
+	}
+}
+
+// WithEstimateFunc sets the function to estimate the cost of a call before it is sent
+// (default: 0, i.e. the call waits only while earlier calls are in debt and the cost is
+// charged when the call finishes).
+func WithEstimateFunc(fn EstimateFunc) Option {
+	return func(c *config) {
+		c.estimate = fn
+	}
+}
+
+// WithLogger sets the logger. Errors of Governor.Settle are logged instead of failing the call.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+func newConfig(options ...Option) *config {
+	cfg := &config{
+		cost: func(resp *gollem.ContentResponse) float64 {
+			return float64(resp.InputToken + resp.OutputToken)
+		},
+		estimate: func(req *gollem.ContentRequest) float64 {
+			return 0
+		},
+		logger: slog.New(slog.DiscardHandler),
+	}
+
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func (c *config) settle(ctx context.Context, gov Governor, estimate, actual float64) {
+	if err := gov.Settle(ctx, c.key, estimate, actual); err != nil {
+		c.logger.Warn("failed to settle LLM call cost", "key", c.key, "estimate", estimate, "actual", actual, "error", err)
+	}
+}
+
+// NewContentBlockMiddleware creates a middleware that acquires gov before each LLM call and
+// settles the actual cost after the call.
+func NewContentBlockMiddleware(gov Governor, options ...Option) gollem.ContentBlockMiddleware {
+	cfg := newConfig(options...)
+
+	return func(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
+		return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			estimate := cfg.estimate(req)
+			if err := gov.Acquire(ctx, cfg.key, estimate); err != nil {
+				return nil, err
+			}
+
+			resp, err := next(ctx, req)
+
+			var actual float64
+			if resp != nil {
+				actual = cfg.cost(resp)
+			}
+			cfg.settle(ctx, gov, estimate, actual)
+
+			return resp, err
+		}
+	}
+}
+
+// NewContentStreamMiddleware creates a streaming middleware that acquires gov before each LLM
+// call and settles the actual cost when the stream is closed.
+func NewContentStreamMiddleware(gov Governor, options ...Option) gollem.ContentStreamMiddleware {
+	cfg := newConfig(options...)
+
+	return func(next gollem.ContentStreamHandler) gollem.ContentStreamHandler {
+		return func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+			estimate := cfg.estimate(req)
+			if err := gov.Acquire(ctx, cfg.key, estimate); err != nil {
+				return nil, err
+			}
+
+			stream, err := next(ctx, req)
+			if err != nil {
+				cfg.settle(ctx, gov, estimate, 0)
+				return nil, err
+			}
+
+			out := make(chan *gollem.ContentResponse)
+			go func() {
+				defer close(out)
+				var actual float64
+				for resp := range stream {
+					actual += cfg.cost(resp)
+					out <- resp
+				}
+				cfg.settle(ctx, gov, estimate, actual)
+			}()
+
+			return out, nil
+		}
+	}
+}
+
+// AgentOption returns an agent option that sets both the content block and the content stream
+// middlewares governed by gov.
+func AgentOption(gov Governor, options ...Option) gollem.Option {
+	return gollem.WithOptions(
+		gollem.WithContentBlockMiddleware(NewContentBlockMiddleware(gov, options...)),
+		gollem.WithContentStreamMiddleware(NewContentStreamMiddleware(gov, options...)),
+	)
+}
@@ -0,0 +1,165 @@
+package governor_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/middleware/governor"
+	"github.com/m-mizutani/gt"
+)
+
+func TestNewTokenBucket(t *testing.T) {
+	_, err := governor.NewTokenBucket(0, 10)
+	gt.Error(t, err)
+	_, err = governor.NewTokenBucket(10, 0)
+	gt.Error(t, err)
+
+	bucket, err := governor.NewTokenBucket(10, 100)
+	gt.NoError(t, err)
+	gt.Equal(t, 100.0, bucket.Tokens())
+}
+
+func TestTokenBucketClock(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	bucket, err := governor.NewTokenBucket(10, 100, governor.WithClock(clock))
+	gt.NoError(t, err)
+	gt.NoError(t, bucket.Acquire(t.Context(), "a", 80))
+	gt.Equal(t, 20.0, bucket.Tokens())
+
+	advance(3 * time.Second)
+	gt.Equal(t, 50.0, bucket.Tokens())
+	advance(time.Minute)
+	gt.Equal(t, 100.0, bucket.Tokens())
+}
+
+func TestTokenBucketDelay(t *testing.T) {
+	ctx := context.Background()
+	var events []*governor.DelayEvent
+	bucket, err := governor.NewTokenBucket(100, 10, governor.WithDelayHook(func(ctx context.Context, event *governor.DelayEvent) {
+		events = append(events, event)
+	}))
+	gt.NoError(t, err)
+
+	// the first call is admitted immediately and its actual cost puts the bucket in debt
+	gt.NoError(t, bucket.Acquire(ctx, "a", 0))
+	gt.A(t, events).Length(0)
+	gt.NoError(t, bucket.Settle(ctx, "a", 0, 15))
+	gt.True(t, bucket.Tokens() < 0)
+
+	start := time.Now()
+	gt.NoError(t, bucket.Acquire(ctx, "a", 0))
+	gt.True(t, time.Since(start) >= 30*time.Millisecond)
+	gt.A(t, events).Length(1).At(0, func(t testing.TB, v *governor.DelayEvent) {
+		gt.Equal(t, "a", v.Key)
+		gt.Equal(t, 1, v.Queued)
+		gt.True(t, v.Tokens < 0)
+	})
+}
+
+func TestTokenBucketFairQueuing(t *testing.T) {
+	ctx := context.Background()
+	queued := make(chan struct{})
+	bucket, err := governor.NewTokenBucket(50, 1, governor.WithDelayHook(func(ctx context.Context, event *governor.DelayEvent) {
+		queued <- struct{}{}
+	}))
+	gt.NoError(t, err)
+	gt.NoError(t, bucket.Acquire(ctx, "a", 1))
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	for _, name := range []string{"a1", "a2", "a3", "b1"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gt.NoError(t, bucket.Acquire(ctx, name[:1], 1))
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}()
+		<-queued
+	}
+	wg.Wait()
+
+	// b1 is not queued behind all calls of a
+	gt.Equal(t, []string{"a1", "b1", "a2", "a3"}, order)
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	bucket, err := governor.NewTokenBucket(1, 1)
+	gt.NoError(t, err)
+	gt.NoError(t, bucket.Acquire(context.Background(), "a", 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	gt.Error(t, bucket.Acquire(ctx, "a", 1))
+
+	// canceled call does not hold the queue
+	gt.NoError(t, bucket.Settle(context.Background(), "a", 1, 0))
+	gt.NoError(t, bucket.Acquire(context.Background(), "b", 1))
+}
+
+func TestContentBlockMiddleware(t *testing.T) {
+	bucket, err := governor.NewTokenBucket(0.001, 1000)
+	gt.NoError(t, err)
+
+	mw := governor.NewContentBlockMiddleware(bucket,
+		governor.WithKey("agent"),
+		governor.WithEstimateFunc(func(req *gollem.ContentRequest) float64 { return 100 }),
+	)
+	handler := gollem.BuildContentBlockChain([]gollem.ContentBlockMiddleware{mw}, func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		gt.True(t, bucket.Tokens() < 901)
+		return &gollem.ContentResponse{Texts: []string{"ok"}, InputToken: 200, OutputToken: 50}, nil
+	})
+
+	resp, err := handler(context.Background(), &gollem.ContentRequest{})
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"ok"}, resp.Texts)
+	gt.True(t, bucket.Tokens() < 751)
+	gt.True(t, bucket.Tokens() >= 750)
+}
+
+func TestContentStreamMiddleware(t *testing.T) {
+	bucket, err := governor.NewTokenBucket(0.001, 1000)
+	gt.NoError(t, err)
+
+	mw := governor.NewContentStreamMiddleware(bucket, governor.WithCostFunc(func(resp *gollem.ContentResponse) float64 {
+		return float64(resp.OutputToken)
+	}))
+	handler := gollem.BuildContentStreamChain([]gollem.ContentStreamMiddleware{mw}, func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+		ch := make(chan *gollem.ContentResponse, 2)
+		ch <- &gollem.ContentResponse{Texts: []string{"a"}, InputToken: 100, OutputToken: 10}
+		ch <- &gollem.ContentResponse{Texts: []string{"b"}, OutputToken: 20}
+		close(ch)
+		return ch, nil
+	})
+
+	stream, err := handler(context.Background(), &gollem.ContentRequest{})
+	gt.NoError(t, err)
+	var texts []string
+	for resp := range stream {
+		texts = append(texts, resp.Texts...)
+	}
+	gt.Equal(t, []string{"a", "b"}, texts)
+
+	// cost is settled before the stream is closed
+	gt.True(t, bucket.Tokens() < 971)
+	gt.True(t, bucket.Tokens() >= 970)
+}
@@ -400,6 +400,13 @@ func (mock *SessionMock) GenerateStream(ctx context.Context, input ...gollem.Inp
 	return mock.Stream(ctx, input)
 }
 
+// StreamContent iterates the responses of Stream.
+func (mock *SessionMock) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return mock.Stream(ctx, input, opts...)
+	})
+}
+
 // History calls HistoryFunc.
 func (mock *SessionMock) History() (*gollem.History, error) {
 	callInfo := struct {
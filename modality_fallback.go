@@ -0,0 +1,215 @@
+package gollem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// Modality is a kind of non-text input.
+type Modality string
+
+const (
+	// ModalityImage is the modality of Image and ImageURL
+	ModalityImage Modality = "image"
+	// ModalityPDF is the modality of PDF
+	ModalityPDF Modality = "pdf"
+)
+
+// modalityOf returns the modality of a non-text input.
+func modalityOf(input Input) (Modality, bool) {
+	switch input.(type) {
+	case Image, ImageURL:
+		return ModalityImage, true
+	case PDF:
+		return ModalityPDF, true
+	}
+	return "", false
+}
+
+// defaultModalityPrompts are the prompts of the fallback client to convert inputs to text.
+var defaultModalityPrompts = map[Modality]string{
+	ModalityImage: "Describe this image in detail for a reader who cannot see it. Transcribe all text in it exactly as written.",
+	ModalityPDF:   "Extract the full text of this document in reading order. Describe figures and tables in text.",
+}
+
+// ModalityConverter converts an input of a modality to inputs that the model supports, e.g. by
+// OCR or transcription.
+type ModalityConverter func(ctx context.Context, input Input) ([]Input, error)
+
+// ModalityFallbackOption is an option of WithModalityFallback.
+type ModalityFallbackOption func(*modalityFallback)
+
+// WithUnsupportedModalities declares the modalities that the model of the agent does not
+// support. Inputs of them are always converted before they are sent. Without it, inputs are
+// converted only when the provider rejects them with ErrUnsupportedInput.
+func WithUnsupportedModalities(modalities ...Modality) ModalityFallbackOption {
+	return func(f *modalityFallback) {
+		f.unsupported = append(f.unsupported, modalities...)
+	}
+}
+
+// WithModalityPrompt sets the prompt asking the fallback client to convert inputs of modality
+// to text.
+func WithModalityPrompt(modality Modality, prompt string) ModalityFallbackOption {
+	return func(f *modalityFallback) {
+		f.prompts[modality] = prompt
+	}
+}
+
+// WithModalityConverter sets the converter of inputs of modality used instead of the fallback
+// client, e.g. a dedicated OCR service.
+func WithModalityConverter(modality Modality, converter ModalityConverter) ModalityFallbackOption {
+	return func(f *modalityFallback) {
+		f.converters[modality] = converter
+	}
+}
+
+// ModalityFallbackEvent is recorded to the trace when an input is converted.
+type ModalityFallbackEvent struct {
+	Modality Modality `json:"modality"`
+	// Rejected is true if the input is converted because the provider rejected it, and false if
+	// the modality is declared unsupported
+	Rejected bool `json:"rejected"`
+}
+
+// WithModalityFallback converts images and PDFs that the model of the agent can not read into
+// text with client, a model supporting them, instead of failing. The fallback client describes
+// images, transcribing text in them, and extracts text of PDFs; the result is sent to the model
+// in place of the input and kept in the history. Usage of the conversions is recorded as
+// UsagePhaseConvert. Inputs are converted if their modality is declared by
+// WithUnsupportedModalities, or if the provider rejects an input with ErrUnsupportedInput; then
+// all images and PDFs of the request are converted and the request is sent again.
+func WithModalityFallback(client LLMClient, options ...ModalityFallbackOption) Option {
+	f := &modalityFallback{
+		client:     client,
+		prompts:    maps.Clone(defaultModalityPrompts),
+		converters: make(map[Modality]ModalityConverter),
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	return func(s *gollemConfig) {
+		s.modalityFallback = f
+	}
+}
+
+// modalityFallback converts inputs of unsupported modalities through content middlewares.
+type modalityFallback struct {
+	client      LLMClient
+	unsupported []Modality
+	prompts     map[Modality]string
+	converters  map[Modality]ModalityConverter
+}
+
+// convert replaces inputs of req matching the modalities, or of any modality if all is true,
+// with their conversions. It returns false if no input is converted.
+func (f *modalityFallback) convert(ctx context.Context, req *ContentRequest, all bool) (bool, error) {
+	var inputs []Input
+	converted := false
+	for i, input := range req.Inputs {
+		modality, ok := modalityOf(input)
+		if !ok || (!all && !slices.Contains(f.unsupported, modality)) {
+			if inputs != nil {
+				inputs = append(inputs, input)
+			}
+			continue
+		}
+
+		if inputs == nil {
+			// req.Inputs may be shared with the caller, so it's not modified
+			inputs = slices.Clone(req.Inputs[:i])
+		}
+		replaced, err := f.convertInput(ctx, modality, input)
+		if err != nil {
+			return false, err
+		}
+		inputs = append(inputs, replaced...)
+		converted = true
+
+		if h := trace.HandlerFrom(ctx); h != nil {
+			h.AddEvent(ctx, "modality_fallback", &ModalityFallbackEvent{Modality: modality, Rejected: all})
+		}
+	}
+	if converted {
+		req.Inputs = inputs
+	}
+	return converted, nil
+}
+
+func (f *modalityFallback) convertInput(ctx context.Context, modality Modality, input Input) ([]Input, error) {
+	if converter, ok := f.converters[modality]; ok {
+		inputs, err := converter(ctx, input)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to convert input", goerr.V("modality", modality))
+		}
+		return inputs, nil
+	}
+
+	if err := CheckBudget(ctx); err != nil {
+		return nil, err
+	}
+	ctx = ContextWithUsagePhase(ctx, UsagePhaseConvert)
+
+	session, err := f.client.NewSession(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to create session for modality fallback")
+	}
+	if session == nil {
+		return nil, goerr.New("LLMClient.NewSession returned nil session")
+	}
+	resp, err := session.Generate(ctx, []Input{Text(f.prompts[modality]), input})
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to convert input by fallback client", goerr.V("modality", modality))
+	}
+	RecordUsage(ctx, resp)
+
+	text := fmt.Sprintf("[The %s was converted to text because the model can not read it]\n%s", modality, strings.Join(resp.Texts, ""))
+	return []Input{Text(text)}, nil
+}
+
+func (f *modalityFallback) blockMiddleware(next ContentBlockHandler) ContentBlockHandler {
+	return func(ctx context.Context, req *ContentRequest) (*ContentResponse, error) {
+		if _, err := f.convert(ctx, req, false); err != nil {
+			return nil, err
+		}
+		resp, err := next(ctx, req)
+		if !errors.Is(err, ErrUnsupportedInput) {
+			return resp, err
+		}
+		converted, convErr := f.convert(ctx, req, true)
+		if convErr != nil {
+			return nil, convErr
+		}
+		if !converted {
+			return resp, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (f *modalityFallback) streamMiddleware(next ContentStreamHandler) ContentStreamHandler {
+	return func(ctx context.Context, req *ContentRequest) (<-chan *ContentResponse, error) {
+		if _, err := f.convert(ctx, req, false); err != nil {
+			return nil, err
+		}
+		ch, err := next(ctx, req)
+		if !errors.Is(err, ErrUnsupportedInput) {
+			return ch, err
+		}
+		converted, convErr := f.convert(ctx, req, true)
+		if convErr != nil {
+			return nil, convErr
+		}
+		if !converted {
+			return ch, err
+		}
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,138 @@
+package gollem_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// newMiddlewareClient returns a client whose sessions run the content middlewares and generate
+// by generate
+func newMiddlewareClient(generate func(inputs []gollem.Input) (*gollem.Response, error)) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					handler := cfg.ContentBlockChain(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+						resp, err := generate(req.Inputs)
+						if err != nil {
+							return nil, err
+						}
+						return &gollem.ContentResponse{Texts: resp.Texts, InputToken: resp.InputToken, OutputToken: resp.OutputToken}, nil
+					})
+					resp, err := handler(ctx, &gollem.ContentRequest{Inputs: input})
+					if err != nil {
+						return nil, err
+					}
+					return &gollem.Response{Texts: resp.Texts, InputToken: resp.InputToken, OutputToken: resp.OutputToken}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) { return &gollem.History{}, nil },
+			}, nil
+		},
+	}
+}
+
+func TestModalityFallback(t *testing.T) {
+	loadImage := func(t *testing.T, path string) gollem.Image {
+		data, err := os.ReadFile(path)
+		gt.NoError(t, err)
+		img, err := gollem.NewImage(data)
+		gt.NoError(t, err)
+		return img
+	}
+	png := loadImage(t, "testdata/test_image.png")
+	gif := loadImage(t, "testdata/test_image.gif")
+
+	// fallback describes images
+	var described []gollem.Input
+	fallback := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					described = append(described, input[1])
+					return &gollem.Response{Texts: []string{"a red square"}, InputToken: 100, OutputToken: 10}, nil
+				},
+			}, nil
+		},
+	}
+
+	t.Run("declared modality is converted", func(t *testing.T) {
+		described = nil
+		var sent [][]gollem.Input
+		primary := newMiddlewareClient(func(inputs []gollem.Input) (*gollem.Response, error) {
+			sent = append(sent, inputs)
+			return &gollem.Response{Texts: []string{"it is red"}}, nil
+		})
+		agent := gollem.New(primary, gollem.WithModalityFallback(fallback,
+			gollem.WithUnsupportedModalities(gollem.ModalityImage),
+		))
+		_, err := agent.Execute(t.Context(), gollem.Text("What color?"), png)
+		gt.NoError(t, err)
+
+		gt.A(t, sent).Length(1)
+		gt.A(t, sent[0]).Length(2)
+		gt.Equal[gollem.Input](t, gollem.Text("What color?"), sent[0][0])
+		text, ok := sent[0][1].(gollem.Text)
+		gt.True(t, ok)
+		gt.S(t, string(text)).Contains("a red square")
+		gt.Equal[gollem.Input](t, png, described[0])
+		gt.Equal(t, 100, agent.Usage().Phases[gollem.UsagePhaseConvert].InputTokens)
+	})
+
+	t.Run("rejected input is converted and sent again", func(t *testing.T) {
+		described = nil
+		var sent [][]gollem.Input
+		primary := newMiddlewareClient(func(inputs []gollem.Input) (*gollem.Response, error) {
+			sent = append(sent, inputs)
+			for _, input := range inputs {
+				if img, ok := input.(gollem.Image); ok && img.MimeType() == string(gollem.ImageMimeTypeGIF) {
+					return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "GIF is not supported")
+				}
+			}
+			return &gollem.Response{Texts: []string{"ok"}}, nil
+		})
+		agent := gollem.New(primary, gollem.WithModalityFallback(fallback))
+
+		_, err := agent.Execute(t.Context(), png)
+		gt.NoError(t, err)
+		gt.A(t, described).Length(0)
+
+		_, err = agent.Execute(t.Context(), gif)
+		gt.NoError(t, err)
+		gt.A(t, sent).Length(3)
+		gt.Equal[gollem.Input](t, gif, described[0])
+		_, ok := sent[2][0].(gollem.Text)
+		gt.True(t, ok)
+	})
+
+	t.Run("custom converter", func(t *testing.T) {
+		var sent [][]gollem.Input
+		primary := newMiddlewareClient(func(inputs []gollem.Input) (*gollem.Response, error) {
+			sent = append(sent, inputs)
+			return &gollem.Response{Texts: []string{"ok"}}, nil
+		})
+		agent := gollem.New(primary, gollem.WithModalityFallback(fallback,
+			gollem.WithUnsupportedModalities(gollem.ModalityImage),
+			gollem.WithModalityConverter(gollem.ModalityImage, func(ctx context.Context, input gollem.Input) ([]gollem.Input, error) {
+				return []gollem.Input{gollem.Text("OCR: hello")}, nil
+			}),
+		))
+		_, err := agent.Execute(t.Context(), png)
+		gt.NoError(t, err)
+		gt.Equal(t, []gollem.Input{gollem.Text("OCR: hello")}, sent[0])
+	})
+
+	t.Run("without fallback the error is returned", func(t *testing.T) {
+		primary := newMiddlewareClient(func(inputs []gollem.Input) (*gollem.Response, error) {
+			return nil, goerr.Wrap(gollem.ErrUnsupportedInput, "GIF is not supported")
+		})
+		_, err := gollem.New(primary).Execute(t.Context(), gif)
+		gt.Error(t, err).Is(gollem.ErrUnsupportedInput)
+	})
+}
@@ -0,0 +1,527 @@
+package gollem
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// ProfileFormatVersion is the version of the archive format written by AgentProfile.Save.
+// LoadProfile rejects archives of newer versions.
+const ProfileFormatVersion = 1
+
+// MaxProfileSize is the maximum total size of files in a profile archive accepted by
+// LoadProfile.
+const MaxProfileSize = 32 << 20
+
+// AgentProfile is a bundle of the behavior of an agent: the declarative config, prompt
+// templates, few-shot examples and skills. It's saved to and loaded from a single archive by
+// Save and LoadProfile, so that teams can version, review and share agent behaviors across
+// services. Tools are referred by names and bound by Options when the profile is loaded.
+type AgentProfile struct {
+	// Name identifies the profile, and Version is the version of the behavior set by its
+	// authors, e.g. "1.2.0".
+	Name        string
+	Version     string
+	Description string
+
+	Config ProfileConfig
+	// Templates are named text/template prompts for the application, rendered by
+	// RenderTemplate.
+	Templates map[string]string
+	// Examples are few-shot examples injected by WithExamples.
+	Examples []Example
+	// Skills are attached by WithSkills.
+	Skills []ProfileSkill
+}
+
+// ProfileConfig is the declarative config of an AgentProfile. Zero values keep the defaults of
+// the agent.
+type ProfileConfig struct {
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// SystemPromptTemplate is set by WithSystemPromptTemplate, and takes precedence over
+	// SystemPrompt.
+	SystemPromptTemplate string       `json:"system_prompt_template,omitempty"`
+	LoopLimit            int          `json:"loop_limit,omitempty"`
+	ResponseMode         ResponseMode `json:"response_mode,omitempty"`
+	ContentType          ContentType  `json:"content_type,omitempty"`
+
+	// Tools are names of tools registered by WithTools. They must be given by
+	// ProfileBindings.
+	Tools []string `json:"tools,omitempty"`
+
+	// ExampleLabels are labels of WithExamples, and ExampleMaxCount and ExampleTokenBudget
+	// are options of NewExamples.
+	ExampleLabels      []string `json:"example_labels,omitempty"`
+	ExampleMaxCount    int      `json:"example_max_count,omitempty"`
+	ExampleTokenBudget int      `json:"example_token_budget,omitempty"`
+}
+
+// ProfileSkill is a Skill of an AgentProfile, referring its tools by names.
+type ProfileSkill struct {
+	Name        string
+	Description string
+	Prompt      string
+	// Tools are names of tools registered with the skill. They must be given by
+	// ProfileBindings.
+	Tools         []string
+	RequiredTools []string
+	Examples      []SkillExample
+}
+
+// ProfileBindings are runtime dependencies of an AgentProfile that can't be archived.
+type ProfileBindings struct {
+	// Tools are the tools referred by names in ProfileConfig.Tools and ProfileSkill.Tools.
+	Tools []Tool
+	// ToolSets are registered by WithToolSets as they are.
+	ToolSets []ToolSet
+	// Embedder generates embeddings of examples. It's required if the profile has examples.
+	Embedder LLMClient
+}
+
+// profileNamePattern is the pattern of names of templates and skills, used as file names in
+// the archive.
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Files of the archive
+const (
+	profileManifestFile = "profile.json"
+	profileExamplesFile = "examples.jsonl"
+	profilePromptsDir   = "prompts/"
+	profileSkillsDir    = "skills/"
+)
+
+type profileManifest struct {
+	FormatVersion int                   `json:"format_version"`
+	Name          string                `json:"name"`
+	Version       string                `json:"version,omitempty"`
+	Description   string                `json:"description,omitempty"`
+	Config        ProfileConfig         `json:"config"`
+	Skills        []profileSkillSummary `json:"skills,omitempty"`
+}
+
+// profileSkillSummary is a skill in profile.json. Its prompt is in skills/<name>.md.
+type profileSkillSummary struct {
+	Name          string                `json:"name"`
+	Description   string                `json:"description,omitempty"`
+	Tools         []string              `json:"tools,omitempty"`
+	RequiredTools []string              `json:"required_tools,omitempty"`
+	Examples      []profileSkillExample `json:"examples,omitempty"`
+}
+
+type profileSkillExample struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+type profileExample struct {
+	ID     string   `json:"id,omitempty"`
+	Input  string   `json:"input"`
+	Output string   `json:"output"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Validate checks that the profile can be saved and loaded: it has a name, names of templates
+// and skills are unique and usable as file names, and the templates are valid.
+func (p *AgentProfile) Validate() error {
+	if p.Name == "" {
+		return goerr.Wrap(ErrInvalidProfile, "profile name is empty")
+	}
+	for name, text := range p.Templates {
+		if !profileNamePattern.MatchString(name) {
+			return goerr.Wrap(ErrInvalidProfile, "invalid template name", goerr.V("template", name))
+		}
+		if _, err := template.New(name).Parse(text); err != nil {
+			return goerr.Wrap(ErrInvalidProfile, "failed to parse template", goerr.V("template", name), goerr.V("error", err.Error()))
+		}
+	}
+	if p.Config.SystemPromptTemplate != "" {
+		if _, err := template.New("system_prompt").Parse(p.Config.SystemPromptTemplate); err != nil {
+			return goerr.Wrap(ErrInvalidProfile, "failed to parse system prompt template", goerr.V("error", err.Error()))
+		}
+	}
+
+	seen := make(map[string]bool, len(p.Skills))
+	for _, skill := range p.Skills {
+		if !profileNamePattern.MatchString(skill.Name) {
+			return goerr.Wrap(ErrInvalidProfile, "invalid skill name", goerr.V("skill", skill.Name))
+		}
+		if seen[skill.Name] {
+			return goerr.Wrap(ErrInvalidProfile, "duplicate skill name", goerr.V("skill", skill.Name))
+		}
+		seen[skill.Name] = true
+	}
+	return nil
+}
+
+// Save writes the profile to w as a gzip-compressed tar archive of profile.json (the name and
+// the config), prompts/<name>.tmpl, skills/<name>.md (prompts of skills) and examples.jsonl.
+// Files are written in a fixed order with a fixed time, so that the same profile produces the
+// same archive.
+func (p *AgentProfile) Save(w io.Writer) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	manifest := profileManifest{
+		FormatVersion: ProfileFormatVersion,
+		Name:          p.Name,
+		Version:       p.Version,
+		Description:   p.Description,
+		Config:        p.Config,
+	}
+	for _, skill := range p.Skills {
+		summary := profileSkillSummary{
+			Name:          skill.Name,
+			Description:   skill.Description,
+			Tools:         skill.Tools,
+			RequiredTools: skill.RequiredTools,
+		}
+		for _, ex := range skill.Examples {
+			summary.Examples = append(summary.Examples, profileSkillExample(ex))
+		}
+		manifest.Skills = append(manifest.Skills, summary)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal profile manifest")
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeFile := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: time.Unix(0, 0),
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return goerr.Wrap(err, "failed to write profile archive header", goerr.V("file", name))
+		}
+		if _, err := tw.Write(data); err != nil {
+			return goerr.Wrap(err, "failed to write profile archive file", goerr.V("file", name))
+		}
+		return nil
+	}
+
+	if err := writeFile(profileManifestFile, append(manifestData, '\n')); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(p.Templates))
+	for name := range p.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeFile(profilePromptsDir+name+".tmpl", []byte(p.Templates[name])); err != nil {
+			return err
+		}
+	}
+
+	for _, skill := range p.Skills {
+		if skill.Prompt == "" {
+			continue
+		}
+		if err := writeFile(profileSkillsDir+skill.Name+".md", []byte(skill.Prompt)); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Examples) > 0 {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, ex := range p.Examples {
+			if err := enc.Encode(profileExample(ex)); err != nil {
+				return goerr.Wrap(err, "failed to marshal profile example", goerr.V("id", ex.ID))
+			}
+		}
+		if err := writeFile(profileExamplesFile, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return goerr.Wrap(err, "failed to close profile archive")
+	}
+	if err := gz.Close(); err != nil {
+		return goerr.Wrap(err, "failed to close profile archive")
+	}
+	return nil
+}
+
+// LoadProfile reads a profile archive written by AgentProfile.Save. It returns an error
+// wrapping ErrInvalidProfile if the archive is broken, of a newer format version, larger than
+// MaxProfileSize or fails Validate.
+func LoadProfile(r io.Reader) (*AgentProfile, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, goerr.Wrap(ErrInvalidProfile, "failed to read profile archive", goerr.V("error", err.Error()))
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, goerr.Wrap(ErrInvalidProfile, "failed to read profile archive", goerr.V("error", err.Error()))
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, MaxProfileSize-total+1))
+		if err != nil {
+			return nil, goerr.Wrap(ErrInvalidProfile, "failed to read profile archive", goerr.V("file", hdr.Name), goerr.V("error", err.Error()))
+		}
+		total += int64(len(data))
+		if total > MaxProfileSize {
+			return nil, goerr.Wrap(ErrInvalidProfile, "profile archive is too large", goerr.V("max", MaxProfileSize))
+		}
+		files[path.Clean(hdr.Name)] = data
+	}
+
+	manifestData, ok := files[profileManifestFile]
+	if !ok {
+		return nil, goerr.Wrap(ErrInvalidProfile, "profile archive has no "+profileManifestFile)
+	}
+	var manifest profileManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, goerr.Wrap(ErrInvalidProfile, "failed to parse "+profileManifestFile, goerr.V("error", err.Error()))
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > ProfileFormatVersion {
+		return nil, goerr.Wrap(ErrInvalidProfile, "unsupported profile format version",
+			goerr.V("version", manifest.FormatVersion), goerr.V("supported", ProfileFormatVersion))
+	}
+
+	p := &AgentProfile{
+		Name:        manifest.Name,
+		Version:     manifest.Version,
+		Description: manifest.Description,
+		Config:      manifest.Config,
+	}
+
+	for name, data := range files {
+		if !strings.HasPrefix(name, profilePromptsDir) || !strings.HasSuffix(name, ".tmpl") {
+			continue
+		}
+		if p.Templates == nil {
+			p.Templates = map[string]string{}
+		}
+		p.Templates[strings.TrimSuffix(strings.TrimPrefix(name, profilePromptsDir), ".tmpl")] = string(data)
+	}
+
+	for _, summary := range manifest.Skills {
+		skill := ProfileSkill{
+			Name:          summary.Name,
+			Description:   summary.Description,
+			Tools:         summary.Tools,
+			RequiredTools: summary.RequiredTools,
+		}
+		if profileNamePattern.MatchString(summary.Name) {
+			skill.Prompt = string(files[profileSkillsDir+summary.Name+".md"])
+		}
+		for _, ex := range summary.Examples {
+			skill.Examples = append(skill.Examples, SkillExample(ex))
+		}
+		p.Skills = append(p.Skills, skill)
+	}
+
+	if data, ok := files[profileExamplesFile]; ok {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var ex profileExample
+			if err := json.Unmarshal(scanner.Bytes(), &ex); err != nil {
+				return nil, goerr.Wrap(ErrInvalidProfile, "failed to parse "+profileExamplesFile, goerr.V("line", line), goerr.V("error", err.Error()))
+			}
+			p.Examples = append(p.Examples, Example(ex))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, goerr.Wrap(ErrInvalidProfile, "failed to read "+profileExamplesFile, goerr.V("error", err.Error()))
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// RenderTemplate renders the template of name in Templates with data.
+func (p *AgentProfile) RenderTemplate(name string, data any) (string, error) {
+	text, ok := p.Templates[name]
+	if !ok {
+		return "", goerr.Wrap(ErrInvalidProfile, "template not found", goerr.V("template", name))
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", goerr.Wrap(ErrInvalidProfile, "failed to parse template", goerr.V("template", name), goerr.V("error", err.Error()))
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", goerr.Wrap(err, "failed to render template", goerr.V("template", name))
+	}
+	return buf.String(), nil
+}
+
+// Options returns the options of New applying the profile with bindings. Examples are embedded
+// by bindings.Embedder here. It returns an error wrapping ErrInvalidProfile if a tool of the
+// profile is not bound, or the profile has examples and no embedder.
+func (p *AgentProfile) Options(ctx context.Context, bindings ProfileBindings) ([]Option, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	toolsByName := make(map[string]Tool, len(bindings.Tools))
+	for _, tool := range bindings.Tools {
+		toolsByName[tool.Spec().Name] = tool
+	}
+	resolve := func(names []string) ([]Tool, error) {
+		tools := make([]Tool, 0, len(names))
+		for _, name := range names {
+			tool, ok := toolsByName[name]
+			if !ok {
+				return nil, goerr.Wrap(ErrInvalidProfile, "tool of profile is not bound", goerr.V("tool", name), goerr.V("profile", p.Name))
+			}
+			tools = append(tools, tool)
+		}
+		return tools, nil
+	}
+
+	cfg := p.Config
+	var opts []Option
+	if cfg.SystemPrompt != "" {
+		opts = append(opts, WithSystemPrompt(cfg.SystemPrompt))
+	}
+	if cfg.SystemPromptTemplate != "" {
+		opts = append(opts, WithSystemPromptTemplate(cfg.SystemPromptTemplate))
+	}
+	if cfg.LoopLimit > 0 {
+		opts = append(opts, WithLoopLimit(cfg.LoopLimit))
+	}
+	if cfg.ResponseMode != "" {
+		opts = append(opts, WithResponseMode(cfg.ResponseMode))
+	}
+	if cfg.ContentType != "" {
+		opts = append(opts, WithContentType(cfg.ContentType))
+	}
+
+	tools, err := resolve(cfg.Tools)
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 {
+		opts = append(opts, WithTools(tools...))
+	}
+	if len(bindings.ToolSets) > 0 {
+		opts = append(opts, WithToolSets(bindings.ToolSets...))
+	}
+
+	if len(p.Skills) > 0 {
+		skills := make([]*Skill, len(p.Skills))
+		for i, s := range p.Skills {
+			skillTools, err := resolve(s.Tools)
+			if err != nil {
+				return nil, goerr.With(err, goerr.V("skill", s.Name))
+			}
+			skills[i] = &Skill{
+				Name:          s.Name,
+				Description:   s.Description,
+				Prompt:        s.Prompt,
+				Tools:         skillTools,
+				RequiredTools: slices.Clone(s.RequiredTools),
+				Examples:      slices.Clone(s.Examples),
+			}
+		}
+		opts = append(opts, WithSkills(skills...))
+	}
+
+	if len(p.Examples) > 0 {
+		if bindings.Embedder == nil {
+			return nil, goerr.Wrap(ErrInvalidProfile, "embedder is required for examples of profile", goerr.V("profile", p.Name))
+		}
+		var exampleOpts []ExamplesOption
+		if cfg.ExampleMaxCount > 0 {
+			exampleOpts = append(exampleOpts, WithExamplesMaxCount(cfg.ExampleMaxCount))
+		}
+		if cfg.ExampleTokenBudget > 0 {
+			exampleOpts = append(exampleOpts, WithExamplesTokenBudget(cfg.ExampleTokenBudget))
+		}
+		examples := NewExamples(bindings.Embedder, exampleOpts...)
+		if err := examples.Add(ctx, p.Examples...); err != nil {
+			return nil, goerr.Wrap(err, "failed to add examples of profile", goerr.V("profile", p.Name))
+		}
+		opts = append(opts, WithExamples(examples, cfg.ExampleLabels...))
+	}
+
+	return opts, nil
+}
+
+// Profile exports the config, tools, skills and examples of the agent as an AgentProfile of
+// name. Tools are exported by names, and ToolSets, middlewares and other options that can't
+// be declared are not exported.
+func (g *Agent) Profile(name string) *AgentProfile {
+	cfg := g.gollemConfig
+	p := &AgentProfile{
+		Name: name,
+		Config: ProfileConfig{
+			SystemPrompt:         cfg.systemPrompt,
+			SystemPromptTemplate: cfg.systemPromptTemplate,
+			LoopLimit:            cfg.loopLimit,
+			ResponseMode:         cfg.responseMode,
+			ContentType:          cfg.contentType,
+		},
+	}
+	for _, tool := range cfg.tools {
+		p.Config.Tools = append(p.Config.Tools, tool.Spec().Name)
+	}
+
+	for _, skill := range cfg.skills {
+		s := ProfileSkill{
+			Name:          skill.Name,
+			Description:   skill.Description,
+			Prompt:        skill.Prompt,
+			RequiredTools: slices.Clone(skill.RequiredTools),
+			Examples:      slices.Clone(skill.Examples),
+		}
+		for _, tool := range skill.Tools {
+			s.Tools = append(s.Tools, tool.Spec().Name)
+		}
+		p.Skills = append(p.Skills, s)
+	}
+
+	if cfg.examples != nil && cfg.examples.examples != nil {
+		x := cfg.examples.examples
+		p.Examples = x.List()
+		p.Config.ExampleLabels = slices.Clone(cfg.examples.labels)
+		if x.maxExamples != DefaultMaxExamples {
+			p.Config.ExampleMaxCount = x.maxExamples
+		}
+		p.Config.ExampleTokenBudget = x.maxTokens
+	}
+	return p
+}
@@ -0,0 +1,216 @@
+package gollem_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func newProfileTool(name string) gollem.Tool {
+	return &mockTool{
+		spec: gollem.ToolSpec{Name: name, Description: name},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{}, nil
+		},
+	}
+}
+
+func newTestProfile() *gollem.AgentProfile {
+	return &gollem.AgentProfile{
+		Name:        "triage",
+		Version:     "1.0.0",
+		Description: "Triage security alerts",
+		Config: gollem.ProfileConfig{
+			SystemPrompt:    "You are a security analyst.",
+			LoopLimit:       8,
+			ContentType:     gollem.ContentTypeText,
+			Tools:           []string{"whois"},
+			ExampleLabels:   []string{"triage"},
+			ExampleMaxCount: 1,
+		},
+		Templates: map[string]string{
+			"report": "Report of {{.Alert}}",
+		},
+		Examples: []gollem.Example{
+			{ID: "domain", Input: "Is the domain evil.example malicious?", Output: "The domain is newly registered.", Labels: []string{"triage"}},
+			{ID: "hash", Input: "Is the hash abc malicious?", Output: "The hash is a known malware.", Labels: []string{"triage"}},
+		},
+		Skills: []gollem.ProfileSkill{
+			{
+				Name:          "dns_investigation",
+				Description:   "Investigate a suspicious domain",
+				Prompt:        "Resolve the domain and check its WHOIS record before judging it.",
+				Tools:         []string{"dns_lookup"},
+				RequiredTools: []string{"whois"},
+				Examples:      []gollem.SkillExample{{Input: "Is example.com malicious?", Output: "It's reserved."}},
+			},
+		},
+	}
+}
+
+// writeArchive writes files to a gzip-compressed tar archive.
+func writeArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		gt.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))}))
+		_, err := tw.Write([]byte(data))
+		gt.NoError(t, err)
+	}
+	gt.NoError(t, tw.Close())
+	gt.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestAgentProfile(t *testing.T) {
+	t.Run("save and load", func(t *testing.T) {
+		profile := newTestProfile()
+		var buf bytes.Buffer
+		gt.NoError(t, profile.Save(&buf))
+
+		loaded, err := gollem.LoadProfile(bytes.NewReader(buf.Bytes()))
+		gt.NoError(t, err)
+		gt.Equal(t, loaded, profile)
+
+		var again bytes.Buffer
+		gt.NoError(t, loaded.Save(&again))
+		gt.Equal(t, again.Bytes(), buf.Bytes())
+
+		rendered, err := loaded.RenderTemplate("report", map[string]string{"Alert": "alert-1"})
+		gt.NoError(t, err)
+		gt.Equal(t, rendered, "Report of alert-1")
+	})
+
+	t.Run("options", func(t *testing.T) {
+		var sessionCfg gollem.SessionConfig
+		client := keywordEmbedder("domain", "hash")
+		client.NewSessionFunc = func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			sessionCfg = gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+			}, nil
+		}
+
+		opts, err := newTestProfile().Options(t.Context(), gollem.ProfileBindings{
+			Tools:    []gollem.Tool{newProfileTool("whois"), newProfileTool("dns_lookup"), newProfileTool("unused")},
+			Embedder: client,
+		})
+		gt.NoError(t, err)
+		agent := gollem.New(client, opts...)
+		_, err = agent.Execute(t.Context(), gollem.Text("check the domain evil.example"))
+		gt.NoError(t, err)
+
+		prompt := sessionCfg.SystemPrompt()
+		gt.True(t, strings.HasPrefix(prompt, "You are a security analyst."))
+		gt.S(t, prompt).Contains("Resolve the domain and check its WHOIS record")
+		gt.S(t, prompt).Contains("The domain is newly registered.")
+		gt.S(t, prompt).NotContains("The hash is a known malware.")
+
+		var names []string
+		for _, tool := range sessionCfg.Tools() {
+			names = append(names, tool.Spec().Name)
+		}
+		gt.A(t, names).Has("whois").Has("dns_lookup").NotHas("unused")
+	})
+
+	t.Run("unbound tool", func(t *testing.T) {
+		_, err := newTestProfile().Options(t.Context(), gollem.ProfileBindings{
+			Tools:    []gollem.Tool{newProfileTool("whois")},
+			Embedder: keywordEmbedder("domain"),
+		})
+		gt.Error(t, err).Is(gollem.ErrInvalidProfile)
+	})
+
+	t.Run("examples without embedder", func(t *testing.T) {
+		_, err := newTestProfile().Options(t.Context(), gollem.ProfileBindings{
+			Tools: []gollem.Tool{newProfileTool("whois"), newProfileTool("dns_lookup")},
+		})
+		gt.Error(t, err).Is(gollem.ErrInvalidProfile)
+	})
+
+	t.Run("export agent", func(t *testing.T) {
+		embedder := keywordEmbedder("domain", "hash")
+		examples := gollem.NewExamples(embedder, gollem.WithExamplesMaxCount(1))
+		gt.NoError(t, examples.Add(t.Context(), newTestProfile().Examples...))
+		agent := gollem.New(embedder,
+			gollem.WithSystemPrompt("You are a security analyst."),
+			gollem.WithLoopLimit(8),
+			gollem.WithContentType(gollem.ContentTypeText),
+			gollem.WithTools(newProfileTool("whois")),
+			gollem.WithSkills(&gollem.Skill{
+				Name:          "dns_investigation",
+				Description:   "Investigate a suspicious domain",
+				Prompt:        "Resolve the domain and check its WHOIS record before judging it.",
+				Tools:         []gollem.Tool{newProfileTool("dns_lookup")},
+				RequiredTools: []string{"whois"},
+				Examples:      []gollem.SkillExample{{Input: "Is example.com malicious?", Output: "It's reserved."}},
+			}),
+			gollem.WithExamples(examples, "triage"),
+		)
+
+		profile := agent.Profile("triage")
+		expected := newTestProfile()
+		expected.Version = ""
+		expected.Description = ""
+		expected.Templates = nil
+		expected.Config.ResponseMode = gollem.ResponseModeBlocking
+		gt.Equal(t, profile, expected)
+	})
+
+	t.Run("invalid archives", func(t *testing.T) {
+		testCases := map[string]struct {
+			data *bytes.Buffer
+		}{
+			"not gzip": {
+				data: bytes.NewBufferString("profile"),
+			},
+			"no manifest": {
+				data: writeArchive(t, map[string]string{"prompts/report.tmpl": "report"}),
+			},
+			"newer format": {
+				data: writeArchive(t, map[string]string{"profile.json": `{"format_version": 2, "name": "triage"}`}),
+			},
+			"no name": {
+				data: writeArchive(t, map[string]string{"profile.json": `{"format_version": 1}`}),
+			},
+			"broken template": {
+				data: writeArchive(t, map[string]string{
+					"profile.json":        `{"format_version": 1, "name": "triage"}`,
+					"prompts/report.tmpl": "{{.Alert",
+				}),
+			},
+			"duplicate skill": {
+				data: writeArchive(t, map[string]string{
+					"profile.json": `{"format_version": 1, "name": "triage", "skills": [{"name": "dns"}, {"name": "dns"}]}`,
+				}),
+			},
+			"unsafe skill name": {
+				data: writeArchive(t, map[string]string{
+					"profile.json": `{"format_version": 1, "name": "triage", "skills": [{"name": "../dns"}]}`,
+				}),
+			},
+			"broken examples": {
+				data: writeArchive(t, map[string]string{
+					"profile.json":   `{"format_version": 1, "name": "triage"}`,
+					"examples.jsonl": "{\"input\": \"a\"}\n{broken\n",
+				}),
+			},
+		}
+		for name, tc := range testCases {
+			t.Run(name, func(t *testing.T) {
+				_, err := gollem.LoadProfile(tc.data)
+				gt.Error(t, err).Is(gollem.ErrInvalidProfile)
+			})
+		}
+	})
+}
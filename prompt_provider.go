@@ -0,0 +1,33 @@
+package gollem
+
+import "context"
+
+// PromptProvider returns guidance for the input of an Execute, e.g. memories or documents
+// relevant to the request. It's added to the system prompt of a new session, or sent before the
+// input if the session already exists. An empty string adds nothing, and an error aborts
+// Execute.
+type PromptProvider func(ctx context.Context, input []Input) (string, error)
+
+// WithPromptProvider adds a PromptProvider called at the beginning of each Execute. Prompts of
+// multiple providers are added in the order the providers are added, after few-shot examples of
+// WithExamples.
+func WithPromptProvider(provider PromptProvider) Option {
+	return func(s *gollemConfig) {
+		s.promptProviders = append(s.promptProviders, provider)
+	}
+}
+
+// joinPrompts joins non-empty prompts with a blank line.
+func joinPrompts(prompts ...string) string {
+	var joined string
+	for _, prompt := range prompts {
+		switch {
+		case prompt == "":
+		case joined == "":
+			joined = prompt
+		default:
+			joined += "\n\n" + prompt
+		}
+	}
+	return joined
+}
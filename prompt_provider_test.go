@@ -0,0 +1,61 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestWithPromptProvider(t *testing.T) {
+	var sessionCfg gollem.SessionConfig
+	var inputs [][]gollem.Input
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			sessionCfg = gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					inputs = append(inputs, input)
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	t.Run("prompts are added to the system prompt, then before the input", func(t *testing.T) {
+		inputs = nil
+		agent := gollem.New(client,
+			gollem.WithSystemPrompt("You are an assistant."),
+			gollem.WithPromptProvider(func(ctx context.Context, input []gollem.Input) (string, error) {
+				return "# Memories\n- " + string(input[0].(gollem.Text)), nil
+			}),
+			gollem.WithPromptProvider(func(ctx context.Context, input []gollem.Input) (string, error) {
+				return "", nil
+			}),
+		)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("first"))
+		gt.NoError(t, err)
+		gt.Equal(t, "You are an assistant.\n\n# Memories\n- first", sessionCfg.SystemPrompt())
+		gt.Equal(t, []gollem.Input{gollem.Text("first")}, inputs[0])
+
+		_, err = agent.Execute(t.Context(), gollem.Text("second"))
+		gt.NoError(t, err)
+		gt.Equal(t, []gollem.Input{gollem.Text("# Memories\n- second"), gollem.Text("second")}, inputs[1])
+	})
+
+	t.Run("error aborts Execute", func(t *testing.T) {
+		errProvider := errors.New("provider failed")
+		agent := gollem.New(client, gollem.WithPromptProvider(func(ctx context.Context, input []gollem.Input) (string, error) {
+			return "", errProvider
+		}))
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(errProvider)
+	})
+}
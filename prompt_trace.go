@@ -0,0 +1,213 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// PromptEventKind is the kind of trace events of PromptEvent.
+const PromptEventKind = "prompt"
+
+// PromptEvent is recorded to the trace when a prompt is rendered from a template, e.g. by the
+// planner, executor, reflector and conclusion of planexec, so that the exact prompt the model
+// saw and the data it was rendered from can be inspected in each phase without debug logs.
+// Texts are redacted by the TextRedactor of WithPromptTraceRedactor.
+type PromptEvent struct {
+	// Phase is the usage phase of the prompt, e.g. UsagePhasePlan
+	Phase string `json:"phase"`
+
+	// Template is the name of the template, e.g. "reflect"
+	Template string `json:"template"`
+
+	// Data is the data the template was rendered with
+	Data map[string]any `json:"data,omitempty"`
+
+	// Prompt is the rendered prompt
+	Prompt string `json:"prompt"`
+}
+
+// TextRedactor returns text with secrets replaced, e.g. by RedactedValue.
+type TextRedactor func(text string) string
+
+// RedactPatterns returns a TextRedactor replacing matches of the patterns by RedactedValue,
+// e.g. of API keys or email addresses.
+func RedactPatterns(patterns ...*regexp.Regexp) TextRedactor {
+	return func(text string) string {
+		for _, pattern := range patterns {
+			text = pattern.ReplaceAllString(text, RedactedValue)
+		}
+		return text
+	}
+}
+
+// WithPromptTraceRedactor sets the TextRedactor applied to prompts and their data recorded as
+// PromptEvent in the trace of Execute. Values of sensitive parameters of subagents are redacted
+// regardless of it.
+func WithPromptTraceRedactor(redactor TextRedactor) Option {
+	return func(s *gollemConfig) {
+		s.promptTraceRedactor = redactor
+	}
+}
+
+type promptTraceRedactorCtxKey struct{}
+
+// ContextWithPromptTraceRedactor returns a context applying redactor to PromptEvents recorded
+// with it, e.g. of planexec.GeneratePlan called out of Execute.
+func ContextWithPromptTraceRedactor(ctx context.Context, redactor TextRedactor) context.Context {
+	return context.WithValue(ctx, promptTraceRedactorCtxKey{}, redactor)
+}
+
+// TracePrompt records event to the trace handler of ctx, if any, with its texts redacted.
+// Strategies and middlewares rendering their own prompts should call it with each prompt.
+func TracePrompt(ctx context.Context, event *PromptEvent) {
+	h := trace.HandlerFrom(ctx)
+	if h == nil || event == nil {
+		return
+	}
+
+	recorded := *event
+	if redactor, _ := ctx.Value(promptTraceRedactorCtxKey{}).(TextRedactor); redactor != nil {
+		recorded.Prompt = redactor(event.Prompt)
+		if event.Data != nil {
+			recorded.Data = redactText(event.Data, redactor).(map[string]any)
+		}
+	}
+	h.AddEvent(ctx, PromptEventKind, &recorded)
+}
+
+// PromptEvents returns the PromptEvents recorded in t, in the order of execution. t is usually
+// loaded from a trace file, where event data is decoded as generic JSON.
+func PromptEvents(t *trace.Trace) ([]*PromptEvent, error) {
+	if t == nil || t.RootSpan == nil {
+		return nil, nil
+	}
+
+	var events []*PromptEvent
+	var walk func(span *trace.Span) error
+	walk = func(span *trace.Span) error {
+		if span.Event != nil && span.Event.Kind == PromptEventKind {
+			event, err := decodePromptEvent(span.Event.Data)
+			if err != nil {
+				return goerr.Wrap(err, "failed to decode prompt event", goerr.V("span_id", span.SpanID))
+			}
+			events = append(events, event)
+		}
+		for _, child := range span.Children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(t.RootSpan); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// decodePromptEvent converts event data recorded in memory or decoded from JSON.
+func decodePromptEvent(data any) (*PromptEvent, error) {
+	if event, ok := data.(*PromptEvent); ok {
+		return event, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal event data")
+	}
+	var event PromptEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal prompt event")
+	}
+	return &event, nil
+}
+
+// redactText returns value with strings redacted by redactor, including elements of maps and
+// slices.
+func redactText(value any, redactor TextRedactor) any {
+	switch v := value.(type) {
+	case string:
+		return redactor(v)
+	case []string:
+		result := make([]string, len(v))
+		for i, s := range v {
+			result[i] = redactor(s)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = redactText(item, redactor)
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = redactText(item, redactor)
+		}
+		return result
+	}
+	return value
+}
+
+// sensitiveTexts returns the strings in values of sensitive parameters in args.
+func sensitiveTexts(params map[string]*Parameter, args map[string]any) []string {
+	var texts []string
+	var collect func(value any)
+	collect = func(value any) {
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				texts = append(texts, v)
+			}
+		case map[string]any:
+			for _, item := range v {
+				collect(item)
+			}
+		case []any:
+			for _, item := range v {
+				collect(item)
+			}
+		}
+	}
+
+	var walk func(param *Parameter, value any)
+	walk = func(param *Parameter, value any) {
+		if !param.hasSensitive() {
+			return
+		}
+		if param.Sensitive {
+			collect(value)
+			return
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			for name, item := range v {
+				walk(param.Properties[name], item)
+			}
+		case []any:
+			for _, item := range v {
+				walk(param.Items, item)
+			}
+		}
+	}
+
+	for name, value := range args {
+		walk(params[name], value)
+	}
+	return texts
+}
+
+// redactTexts returns text with each of secrets replaced by RedactedValue.
+func redactTexts(text string, secrets []string) string {
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, RedactedValue)
+	}
+	return text
+}
@@ -0,0 +1,80 @@
+package gollem_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func TestTracePrompt(t *testing.T) {
+	t.Run("recorded with redaction of the context", func(t *testing.T) {
+		rec := trace.New()
+		ctx := trace.WithHandler(t.Context(), rec)
+		ctx = rec.StartAgentExecute(ctx)
+		ctx = gollem.ContextWithPromptTraceRedactor(ctx, gollem.RedactPatterns(regexp.MustCompile(`\d{3}-\d{4}`)))
+
+		data := map[string]any{
+			"Phone":  "call 555-1234",
+			"Nested": map[string]any{"List": []any{"555-9876", 1}},
+			"Count":  2,
+		}
+		gollem.TracePrompt(ctx, &gollem.PromptEvent{
+			Phase:    gollem.UsagePhaseExecute,
+			Template: "custom",
+			Data:     data,
+			Prompt:   "Call 555-1234",
+		})
+		rec.EndAgentExecute(ctx, nil)
+
+		events, err := gollem.PromptEvents(rec.Trace())
+		gt.NoError(t, err)
+		gt.A(t, events).Length(1)
+		gt.Equal(t, &gollem.PromptEvent{
+			Phase:    gollem.UsagePhaseExecute,
+			Template: "custom",
+			Data: map[string]any{
+				"Phone":  "call [REDACTED]",
+				"Nested": map[string]any{"List": []any{"[REDACTED]", 1}},
+				"Count":  2,
+			},
+			Prompt: "Call [REDACTED]",
+		}, events[0])
+		// The data is not modified
+		gt.Equal(t, "call 555-1234", data["Phone"])
+	})
+
+	t.Run("nothing is recorded without trace", func(t *testing.T) {
+		gollem.TracePrompt(t.Context(), &gollem.PromptEvent{Prompt: "hello"})
+	})
+}
+
+func TestSubAgentPromptTrace(t *testing.T) {
+	tmpl, err := gollem.NewPromptTemplate("Check {{.host}} with token {{.token}}", map[string]*gollem.Parameter{
+		"host":  {Type: gollem.TypeString, Required: true},
+		"token": {Type: gollem.TypeString, Required: true, Sensitive: true},
+	})
+	gt.NoError(t, err)
+
+	var childPrompts []string
+	child := gollem.NewSubAgent("checker", "Check a host", func() (*gollem.Agent, error) {
+		return gollem.New(newPromptRecordingClient(&childPrompts, "")), nil
+	}, gollem.WithPromptTemplate(tmpl))
+
+	rec := trace.New()
+	ctx := trace.WithHandler(t.Context(), rec)
+	ctx = rec.StartAgentExecute(ctx)
+	_, err = child.Run(ctx, map[string]any{"host": "example.com", "token": "s3cret"})
+	gt.NoError(t, err)
+	rec.EndAgentExecute(ctx, nil)
+
+	events, err := gollem.PromptEvents(rec.Trace())
+	gt.NoError(t, err)
+	gt.A(t, events).Length(1)
+	gt.Equal(t, gollem.UsagePhaseSubAgent("checker"), events[0].Phase)
+	gt.Equal(t, "checker", events[0].Template)
+	gt.Equal(t, "Check example.com with token [REDACTED]", events[0].Prompt)
+	gt.Equal(t, map[string]any{"host": "example.com", "token": "[REDACTED]"}, events[0].Data)
+}
@@ -3,8 +3,6 @@ package gollem
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"strings"
 
 	"github.com/m-mizutani/goerr/v2"
 )
@@ -52,7 +50,8 @@ func WithQueryMaxRetry(n int) QueryOption {
 // It generates a JSON schema from T, creates a session with JSON content type,
 // calls the LLM, and unmarshals the response into T.
 // If JSON unmarshalling fails, it retries up to maxRetry times (default 3),
-// feeding back the error to the LLM for correction.
+// feeding back the error to the LLM for correction, and returns an error
+// wrapping ErrResponseSchemaViolation if it still fails.
 func Query[T any](ctx context.Context, client LLMClient, prompt string, opts ...QueryOption) (*QueryResponse[T], error) {
 	cfg := &queryConfig{
 		maxRetry: defaultMaxRetry,
@@ -103,74 +102,20 @@ func queryWithRetry[T any](ctx context.Context, session Session, input []Input,
 		return nil, goerr.Wrap(err, "failed to generate schema from type parameter")
 	}
 
-	var totalInputToken, totalOutputToken int
-
-	for attempt := range maxRetry + 1 {
-		resp, err := session.Generate(ctx, input, genOpts...)
-		if err != nil {
-			return nil, goerr.Wrap(err, "failed to generate content",
-				goerr.V("attempt", attempt+1),
-			)
-		}
-
-		totalInputToken += resp.InputToken
-		totalOutputToken += resp.OutputToken
-
-		if len(resp.Texts) == 0 {
-			return nil, goerr.New("no text in response",
-				goerr.V("attempt", attempt+1),
-			)
-		}
-
-		jsonText := strings.Join(resp.Texts, "")
-
-		var result T
-		if unmarshalErr := json.Unmarshal([]byte(jsonText), &result); unmarshalErr != nil {
-			if attempt < maxRetry {
-				input = []Input{
-					Text(fmt.Sprintf(
-						"Your previous response was not valid JSON that matches the schema. Error: %s\nYour response was: %s\nPlease respond with valid JSON matching the schema.",
-						unmarshalErr.Error(), jsonText,
-					)),
-				}
-				continue
-			}
-			return nil, goerr.Wrap(unmarshalErr, "failed to unmarshal response JSON after retries",
-				goerr.V("attempts", maxRetry+1),
-				goerr.V("response", jsonText),
-			)
-		}
-
-		// Validate the response against the schema
-		var raw any
-		if unmarshalErr := json.Unmarshal([]byte(jsonText), &raw); unmarshalErr != nil {
-			return nil, goerr.Wrap(unmarshalErr, "failed to unmarshal response for validation",
-				goerr.V("response", jsonText),
-			)
-		}
-		if validateErr := schema.ValidateValue("root", raw); validateErr != nil {
-			if attempt < maxRetry {
-				input = []Input{
-					Text(fmt.Sprintf(
-						"Your previous response was valid JSON but did not match the schema constraints. Error: %s\nYour response was: %s\nPlease respond with valid JSON matching the schema.",
-						validateErr.Error(), jsonText,
-					)),
-				}
-				continue
-			}
-			return nil, goerr.Wrap(validateErr, "response JSON failed schema validation after retries",
-				goerr.V("attempts", maxRetry+1),
-				goerr.V("response", jsonText),
-			)
-		}
-
-		return &QueryResponse[T]{
-			Data:        &result,
-			InputToken:  totalInputToken,
-			OutputToken: totalOutputToken,
-		}, nil
+	var result T
+	decode := func(text string) error {
+		// Fields of a violating response must not remain in the result
+		result = *new(T)
+		return json.Unmarshal([]byte(text), &result)
+	}
+	resp, err := generateRepaired(ctx, session, schema, input, maxRetry, decode, genOpts...)
+	if err != nil {
+		return nil, err
 	}
 
-	// unreachable, but satisfy the compiler
-	return nil, goerr.New("unexpected: retry loop completed without result")
+	return &QueryResponse[T]{
+		Data:        &result,
+		InputToken:  resp.InputToken,
+		OutputToken: resp.OutputToken,
+	}, nil
 }
@@ -317,7 +317,7 @@ func TestQuerySchemaValidationExhausted(t *testing.T) {
 	_, err := gollem.Query[testQueryResultWithConstraints](context.Background(), client, "test",
 		gollem.WithQueryMaxRetry(2),
 	)
-	gt.Error(t, err)
+	gt.Error(t, err).Is(gollem.ErrResponseSchemaViolation)
 	// 1 initial + 2 retries = 3 calls
 	gt.Value(t, callCount).Equal(3)
 }
@@ -0,0 +1,240 @@
+package gollem
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// DefaultQuotaReserve is the default fraction of a quota from which QuotaTracker paces calls.
+const DefaultQuotaReserve = 0.1
+
+// QuotaLimit is the state of a rate limit of the provider.
+type QuotaLimit struct {
+	// Limit is the maximum of the window
+	Limit int `json:"limit"`
+
+	// Remaining is what is left in the window. Calls admitted by the tracker since the last
+	// response are subtracted.
+	Remaining int `json:"remaining"`
+
+	// Reset is when the quota is restored. Zero if unknown.
+	Reset time.Time `json:"reset"`
+}
+
+// QuotaStatus is the quota of the provider account reported by the rate limit headers of API
+// responses. A limit is nil if the provider has not reported it.
+type QuotaStatus struct {
+	Requests     *QuotaLimit `json:"requests,omitempty"`
+	Tokens       *QuotaLimit `json:"tokens,omitempty"`
+	InputTokens  *QuotaLimit `json:"input_tokens,omitempty"`
+	OutputTokens *QuotaLimit `json:"output_tokens,omitempty"`
+
+	// UpdatedAt is when the last response with the headers was received. Zero if none.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QuotaTracker tracks the rate limit headers of API responses and holds LLM calls back before
+// the quota is exhausted, instead of failing them by rate limit errors. It paces calls when a
+// limit is below the reserve, and queues them until the reset when a limit is exhausted. It reads
+// the headers of Anthropic (anthropic-ratelimit-*) and OpenAI (x-ratelimit-*), and Retry-After of
+// 429 responses. The OpenAI and Claude clients have a QuotaTracker by default. A QuotaTracker is
+// safe for concurrent use and can be shared by clients of the same account.
+type QuotaTracker struct {
+	reserve float64
+
+	mu     sync.Mutex
+	status QuotaStatus
+}
+
+// QuotaOption is an option of NewQuotaTracker.
+type QuotaOption func(*QuotaTracker)
+
+// WithQuotaReserve sets the fraction of each limit from which calls are paced to spread the rest
+// of the quota until the reset. 0 disables pacing, and calls wait only when a limit is
+// exhausted. The default is DefaultQuotaReserve.
+func WithQuotaReserve(ratio float64) QuotaOption {
+	return func(q *QuotaTracker) {
+		q.reserve = ratio
+	}
+}
+
+// NewQuotaTracker creates a QuotaTracker.
+func NewQuotaTracker(options ...QuotaOption) *QuotaTracker {
+	q := &QuotaTracker{
+		reserve: DefaultQuotaReserve,
+	}
+	for _, opt := range options {
+		opt(q)
+	}
+	return q
+}
+
+// Status returns the current quota, e.g. for dashboards.
+func (q *QuotaTracker) Status() QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := q.status
+	for _, limit := range []**QuotaLimit{&status.Requests, &status.Tokens, &status.InputTokens, &status.OutputTokens} {
+		if *limit != nil {
+			copied := **limit
+			*limit = &copied
+		}
+	}
+	return status
+}
+
+// HTTPMiddleware returns the middleware updating the tracker by API responses. Set it to the
+// WithHTTPMiddleware option of a provider without built-in tracking.
+func (q *QuotaTracker) HTTPMiddleware() HTTPMiddleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			if resp != nil {
+				q.Update(req.Context(), resp.StatusCode, resp.Header)
+			}
+			return resp, err
+		}
+	}
+}
+
+// Update updates the tracker by the status code and headers of an API response.
+func (q *QuotaTracker) Update(ctx context.Context, statusCode int, header http.Header) {
+	now := Now(ctx)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	updated := false
+	for _, l := range []struct {
+		target                  **QuotaLimit
+		limit, remaining, reset string
+	}{
+		{&q.status.Requests, "anthropic-ratelimit-requests-limit", "anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset"},
+		{&q.status.Tokens, "anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"},
+		{&q.status.InputTokens, "anthropic-ratelimit-input-tokens-limit", "anthropic-ratelimit-input-tokens-remaining", "anthropic-ratelimit-input-tokens-reset"},
+		{&q.status.OutputTokens, "anthropic-ratelimit-output-tokens-limit", "anthropic-ratelimit-output-tokens-remaining", "anthropic-ratelimit-output-tokens-reset"},
+		{&q.status.Requests, "x-ratelimit-limit-requests", "x-ratelimit-remaining-requests", "x-ratelimit-reset-requests"},
+		{&q.status.Tokens, "x-ratelimit-limit-tokens", "x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"},
+	} {
+		remaining, err := strconv.Atoi(header.Get(l.remaining))
+		if err != nil {
+			continue
+		}
+		limit, _ := strconv.Atoi(header.Get(l.limit))
+		*l.target = &QuotaLimit{
+			Limit:     limit,
+			Remaining: remaining,
+			Reset:     parseQuotaReset(header.Get(l.reset), now),
+		}
+		updated = true
+	}
+
+	// A rate limited response without the headers tells when to retry
+	if statusCode == http.StatusTooManyRequests {
+		if retryAfter := parseRetryAfter(header.Get("Retry-After"), now); !retryAfter.IsZero() {
+			if q.status.Requests == nil {
+				q.status.Requests = &QuotaLimit{}
+			}
+			q.status.Requests.Remaining = 0
+			q.status.Requests.Reset = retryAfter
+			updated = true
+		}
+	}
+
+	if updated {
+		q.status.UpdatedAt = now
+	}
+}
+
+// parseQuotaReset parses a reset time of RFC 3339 (Anthropic) or a duration from now (OpenAI,
+// e.g. "6m0s").
+func parseQuotaReset(value string, now time.Time) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d)
+	}
+	return time.Time{}
+}
+
+// parseRetryAfter parses Retry-After of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds * float64(time.Second)))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// WaitN implements RateLimiter, waiting for n requests. WaitRateLimits also waits for the
+// estimated tokens of the call.
+func (q *QuotaTracker) WaitN(ctx context.Context, n int) error {
+	return q.wait(ctx, n, 0)
+}
+
+// wait blocks until the quota allows a call of requests and tokens, and subtracts them from the
+// quota until the next response updates it.
+func (q *QuotaTracker) wait(ctx context.Context, requests, tokens int) error {
+	now := Now(ctx)
+
+	q.mu.Lock()
+	var delay time.Duration
+	for _, l := range []struct {
+		limit *QuotaLimit
+		need  int
+	}{
+		{q.status.Requests, requests},
+		{q.status.Tokens, tokens},
+		{q.status.InputTokens, tokens},
+		// Output tokens are unknown before the call, so it waits only for exhaustion
+		{q.status.OutputTokens, min(requests, 1)},
+	} {
+		if l.limit == nil || l.need <= 0 || !l.limit.Reset.After(now) {
+			continue
+		}
+		need := l.need
+		if l.limit.Limit > 0 {
+			need = min(need, l.limit.Limit)
+		}
+
+		untilReset := l.limit.Reset.Sub(now)
+		switch {
+		case l.limit.Remaining < need:
+			delay = max(delay, untilReset)
+		case q.reserve > 0 && float64(l.limit.Remaining) < q.reserve*float64(l.limit.Limit):
+			// Spread the rest of the quota over the time until the reset
+			delay = max(delay, time.Duration(float64(untilReset)*float64(need)/float64(l.limit.Remaining)))
+		}
+		l.limit.Remaining -= need
+	}
+	q.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return goerr.Wrap(ctx.Err(), "canceled while waiting for quota", goerr.V("delay", delay))
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+package gollem_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestQuotaTrackerUpdate(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := gollem.ContextWithClock(context.Background(), func() time.Time { return now })
+
+	t.Run("anthropic headers", func(t *testing.T) {
+		q := gollem.NewQuotaTracker()
+		header := http.Header{}
+		header.Set("anthropic-ratelimit-requests-limit", "50")
+		header.Set("anthropic-ratelimit-requests-remaining", "49")
+		header.Set("anthropic-ratelimit-requests-reset", "2026-01-02T03:05:05Z")
+		header.Set("anthropic-ratelimit-input-tokens-limit", "30000")
+		header.Set("anthropic-ratelimit-input-tokens-remaining", "29000")
+		header.Set("anthropic-ratelimit-input-tokens-reset", "2026-01-02T03:04:07Z")
+		q.Update(ctx, http.StatusOK, header)
+
+		gt.Equal(t, gollem.QuotaStatus{
+			Requests:    &gollem.QuotaLimit{Limit: 50, Remaining: 49, Reset: now.Add(time.Minute)},
+			InputTokens: &gollem.QuotaLimit{Limit: 30000, Remaining: 29000, Reset: now.Add(2 * time.Second)},
+			UpdatedAt:   now,
+		}, q.Status())
+	})
+
+	t.Run("openai headers", func(t *testing.T) {
+		q := gollem.NewQuotaTracker()
+		header := http.Header{}
+		header.Set("x-ratelimit-limit-requests", "500")
+		header.Set("x-ratelimit-remaining-requests", "499")
+		header.Set("x-ratelimit-reset-requests", "120ms")
+		header.Set("x-ratelimit-limit-tokens", "30000")
+		header.Set("x-ratelimit-remaining-tokens", "29900")
+		header.Set("x-ratelimit-reset-tokens", "6m0s")
+		q.Update(ctx, http.StatusOK, header)
+
+		gt.Equal(t, gollem.QuotaStatus{
+			Requests:  &gollem.QuotaLimit{Limit: 500, Remaining: 499, Reset: now.Add(120 * time.Millisecond)},
+			Tokens:    &gollem.QuotaLimit{Limit: 30000, Remaining: 29900, Reset: now.Add(6 * time.Minute)},
+			UpdatedAt: now,
+		}, q.Status())
+	})
+
+	t.Run("retry after of rate limited response", func(t *testing.T) {
+		q := gollem.NewQuotaTracker()
+		header := http.Header{}
+		header.Set("Retry-After", "30")
+		q.Update(ctx, http.StatusTooManyRequests, header)
+
+		gt.Equal(t, gollem.QuotaStatus{
+			Requests:  &gollem.QuotaLimit{Remaining: 0, Reset: now.Add(30 * time.Second)},
+			UpdatedAt: now,
+		}, q.Status())
+	})
+
+	t.Run("responses without headers are ignored", func(t *testing.T) {
+		q := gollem.NewQuotaTracker()
+		q.Update(ctx, http.StatusOK, http.Header{})
+		gt.Equal(t, gollem.QuotaStatus{}, q.Status())
+	})
+}
+
+func TestQuotaTrackerWait(t *testing.T) {
+	headers := func(remaining string, reset time.Duration) http.Header {
+		header := http.Header{}
+		header.Set("x-ratelimit-limit-requests", "100")
+		header.Set("x-ratelimit-remaining-requests", remaining)
+		header.Set("x-ratelimit-reset-requests", reset.String())
+		return header
+	}
+	req := &gollem.ContentRequest{Inputs: []gollem.Input{gollem.Text("hello")}}
+
+	t.Run("calls are not held back with enough quota", func(t *testing.T) {
+		q := gollem.NewQuotaTracker()
+		q.Update(context.Background(), http.StatusOK, headers("50", time.Hour))
+
+		start := time.Now()
+		gt.NoError(t, gollem.WaitRateLimits(context.Background(), []gollem.RateLimiter{q}, req))
+		gt.True(t, time.Since(start) < 100*time.Millisecond)
+		// The admitted call is subtracted until the next response
+		gt.Equal(t, 49, q.Status().Requests.Remaining)
+	})
+
+	t.Run("exhausted quota waits for the reset", func(t *testing.T) {
+		q := gollem.NewQuotaTracker()
+		q.Update(context.Background(), http.StatusOK, headers("0", 100*time.Millisecond))
+
+		start := time.Now()
+		gt.NoError(t, gollem.WaitRateLimits(context.Background(), []gollem.RateLimiter{q}, req))
+		gt.True(t, time.Since(start) >= 80*time.Millisecond)
+	})
+
+	t.Run("quota below reserve is paced", func(t *testing.T) {
+		q := gollem.NewQuotaTracker(gollem.WithQuotaReserve(0.1))
+		q.Update(context.Background(), http.StatusOK, headers("5", 250*time.Millisecond))
+
+		// 5 requests are spread over 250ms
+		start := time.Now()
+		gt.NoError(t, q.WaitN(context.Background(), 1))
+		elapsed := time.Since(start)
+		gt.True(t, elapsed >= 30*time.Millisecond && elapsed < 200*time.Millisecond)
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		q := gollem.NewQuotaTracker()
+		q.Update(context.Background(), http.StatusOK, headers("0", time.Hour))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		gt.Error(t, q.WaitN(ctx, 1)).Is(context.Canceled)
+	})
+}
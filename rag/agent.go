@@ -0,0 +1,95 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/m-mizutani/gollem"
+)
+
+type config struct {
+	index    *Index
+	limit    int
+	minScore float64
+	logger   *slog.Logger
+}
+
+// Option is an option of WithRAG.
+type Option func(*config)
+
+// WithLimit sets the maximum number of chunks added to a prompt. The default is
+// DefaultRetrieveLimit.
+func WithLimit(n int) Option {
+	return func(c *config) {
+		c.limit = n
+	}
+}
+
+// WithMinScore sets the minimum similarity of chunks to the request to add them to a prompt.
+// The default is 0, adding the best chunks regardless of their similarity.
+func WithMinScore(score float64) Option {
+	return func(c *config) {
+		c.minScore = score
+	}
+}
+
+// WithLogger sets the logger. Errors of retrieval are logged instead of failing Execute.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithRAG adds the chunks of index relevant to the text input to the system prompt at the
+// beginning of each Execute by a gollem.PromptProvider, so the agent answers with the documents
+// without calling a tool. Add index.Tool() with gollem.WithTools to let the agent also search
+// by its own queries.
+func WithRAG(index *Index, options ...Option) gollem.Option {
+	cfg := &config{
+		index:  index,
+		limit:  DefaultRetrieveLimit,
+		logger: slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range options {
+		opt(cfg)
+	}
+
+	return gollem.WithPromptProvider(cfg.retrieve)
+}
+
+// retrieve returns the prompt of chunks relevant to the text input.
+func (c *config) retrieve(ctx context.Context, input []gollem.Input) (string, error) {
+	var texts []string
+	for _, in := range input {
+		if text, ok := in.(gollem.Text); ok && strings.TrimSpace(string(text)) != "" {
+			texts = append(texts, string(text))
+		}
+	}
+	if len(texts) == 0 || c.limit <= 0 {
+		return "", nil
+	}
+
+	matches, err := c.index.Search(ctx, strings.Join(texts, "\n"), c.limit)
+	if err != nil {
+		c.logger.Warn("failed to retrieve documents", "error", err)
+		return "", nil
+	}
+
+	var b strings.Builder
+	for _, match := range matches {
+		if match.Score < c.minScore {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# Retrieved Documents\n\nPassages of documents relevant to the request. Use them to answer, and cite their sources.\n")
+		}
+		source := match.Chunk.Source
+		if source == "" {
+			source = match.Chunk.DocumentID
+		}
+		fmt.Fprintf(&b, "\n## %s (part %d)\n\n%s\n", source, match.Chunk.Index+1, match.Chunk.Content)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,54 @@
+package rag_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/rag"
+	"github.com/m-mizutani/gt"
+)
+
+func TestWithRAG(t *testing.T) {
+	ctx := t.Context()
+	client := keywordEmbedder("deploy", "billing")
+	var systemPrompts []string
+	client.NewSessionFunc = func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+		cfg := gollem.NewSessionConfig(options...)
+		systemPrompts = append(systemPrompts, cfg.SystemPrompt())
+		return &mock.SessionMock{
+			GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+				return &gollem.Response{Texts: []string{"ok"}}, nil
+			},
+			HistoryFunc: func() (*gollem.History, error) { return &gollem.History{}, nil },
+		}, nil
+	}
+
+	index, err := rag.NewIndex(rag.NewInMemoryVectorStore(), client)
+	gt.NoError(t, err)
+	gt.NoError(t, index.AddDocuments(ctx,
+		&rag.Document{Source: "ops.md", Content: "Deploy with the pipeline."},
+		&rag.Document{Source: "finance.md", Content: "Billing runs monthly."},
+	))
+
+	t.Run("relevant chunks are added to the system prompt", func(t *testing.T) {
+		systemPrompts = nil
+		agent := gollem.New(client, rag.WithRAG(index, rag.WithLimit(2), rag.WithMinScore(0.5)))
+		_, err := agent.Execute(ctx, gollem.Text("When is billing?"))
+		gt.NoError(t, err)
+		gt.A(t, systemPrompts).Length(1)
+		gt.True(t, strings.Contains(systemPrompts[0], "# Retrieved Documents"))
+		gt.True(t, strings.Contains(systemPrompts[0], "## finance.md (part 1)\n\nBilling runs monthly."))
+		gt.False(t, strings.Contains(systemPrompts[0], "ops.md"))
+	})
+
+	t.Run("nothing is added without relevant chunks", func(t *testing.T) {
+		systemPrompts = nil
+		agent := gollem.New(client, rag.WithRAG(index, rag.WithMinScore(0.5)))
+		_, err := agent.Execute(ctx, gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.Equal(t, "", systemPrompts[0])
+	})
+}
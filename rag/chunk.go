@@ -0,0 +1,124 @@
+package rag
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+const (
+	// DefaultChunkSize is the default maximum length of a chunk in characters.
+	DefaultChunkSize = 1000
+
+	// DefaultChunkOverlap is the default number of characters shared by consecutive windows of
+	// a paragraph longer than the chunk size.
+	DefaultChunkOverlap = 100
+)
+
+// Chunker splits the text of a document into chunks to embed.
+type Chunker func(text string) []string
+
+// NewTextChunker returns a Chunker packing consecutive paragraphs, separated by blank lines,
+// into chunks of at most size characters. A paragraph longer than size is split into windows
+// of size characters, each starting overlap characters before the end of the previous one, so
+// a sentence across the boundary is found in one of them.
+func NewTextChunker(size, overlap int) Chunker {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	return func(text string) []string {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+
+		var chunks []string
+		var current strings.Builder
+		currentLen := 0
+		flush := func() {
+			if currentLen > 0 {
+				chunks = append(chunks, current.String())
+				current.Reset()
+				currentLen = 0
+			}
+		}
+
+		for _, paragraph := range strings.Split(text, "\n\n") {
+			paragraph = strings.TrimSpace(paragraph)
+			n := utf8.RuneCountInString(paragraph)
+			if n == 0 {
+				continue
+			}
+
+			if n > size {
+				flush()
+				runes := []rune(paragraph)
+				for start := 0; ; start += size - overlap {
+					end := min(start+size, len(runes))
+					chunks = append(chunks, string(runes[start:end]))
+					if end == len(runes) {
+						break
+					}
+				}
+				continue
+			}
+
+			if currentLen > 0 && currentLen+2+n > size {
+				flush()
+			}
+			if currentLen > 0 {
+				current.WriteString("\n\n")
+				currentLen += 2
+			}
+			current.WriteString(paragraph)
+			currentLen += n
+		}
+		flush()
+
+		return chunks
+	}
+}
+
+// Extractor extracts the text of a document from its data, e.g. of a PDF file.
+type Extractor func(ctx context.Context, data []byte) (string, error)
+
+// ExtractText is an Extractor of plain text. It fails if data is not valid UTF-8.
+func ExtractText(ctx context.Context, data []byte) (string, error) {
+	if !utf8.Valid(data) {
+		return "", goerr.New("document is not valid UTF-8 text")
+	}
+	return string(data), nil
+}
+
+// ExtractMarkdown is an Extractor of Markdown. It removes the front matter and HTML comments,
+// which are not part of the content, and keeps the rest as is.
+func ExtractMarkdown(ctx context.Context, data []byte) (string, error) {
+	text, err := ExtractText(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		if _, body, found := strings.Cut(rest, "\n---\n"); found {
+			text = body
+		}
+	}
+
+	for {
+		start := strings.Index(text, "<!--")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start:], "-->")
+		if end < 0 {
+			break
+		}
+		text = text[:start] + text[start+end+len("-->"):]
+	}
+
+	return text, nil
+}
@@ -0,0 +1,44 @@
+package rag_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem/rag"
+	"github.com/m-mizutani/gt"
+)
+
+func TestTextChunker(t *testing.T) {
+	t.Run("paragraphs are packed into chunks", func(t *testing.T) {
+		chunker := rag.NewTextChunker(20, 0)
+		chunks := chunker("aaaa bbbb\n\ncccc\r\n\r\n\n\ndddd eeee ffff gggg")
+		gt.Equal(t, []string{"aaaa bbbb\n\ncccc", "dddd eeee ffff gggg"}, chunks)
+	})
+
+	t.Run("long paragraph is split into overlapping windows", func(t *testing.T) {
+		chunker := rag.NewTextChunker(10, 3)
+		chunks := chunker("short\n\n" + strings.Repeat("あいうえおかきくけこ", 2))
+		gt.Equal(t, []string{"short", "あいうえおかきくけこ", "くけこあいうえおかき", "おかきくけこ"}, chunks)
+	})
+
+	t.Run("empty text has no chunks", func(t *testing.T) {
+		gt.A(t, rag.NewTextChunker(0, 0)(" \n\n ")).Length(0)
+	})
+}
+
+func TestExtractors(t *testing.T) {
+	t.Run("text must be UTF-8", func(t *testing.T) {
+		text, err := rag.ExtractText(t.Context(), []byte("hello"))
+		gt.NoError(t, err)
+		gt.Equal(t, "hello", text)
+
+		_, err = rag.ExtractText(t.Context(), []byte{0xff, 0xfe})
+		gt.Error(t, err)
+	})
+
+	t.Run("markdown without front matter and comments", func(t *testing.T) {
+		text, err := rag.ExtractMarkdown(t.Context(), []byte("---\ntitle: x\n---\n# Title\n<!-- draft -->\nBody"))
+		gt.NoError(t, err)
+		gt.Equal(t, "# Title\n\nBody", text)
+	})
+}
@@ -0,0 +1,199 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// DefaultEmbeddingBatchSize is the default number of chunks embedded by a GenerateEmbedding call.
+const DefaultEmbeddingBatchSize = 32
+
+// Index adds documents to a VectorStore and searches them by a query. Documents are split by a
+// Chunker and embedded by the GenerateEmbedding of the embedder.
+type Index struct {
+	store      VectorStore
+	embedder   gollem.LLMClient
+	dimension  int
+	chunker    Chunker
+	extractors map[string]Extractor
+	batchSize  int
+}
+
+// IndexOption is an option of NewIndex.
+type IndexOption func(*Index)
+
+// WithDimension sets the dimension of embeddings. The default is 0, the default of the model.
+func WithDimension(dimension int) IndexOption {
+	return func(x *Index) {
+		x.dimension = dimension
+	}
+}
+
+// WithChunker sets the Chunker of documents. The default is NewTextChunker with
+// DefaultChunkSize and DefaultChunkOverlap.
+func WithChunker(chunker Chunker) IndexOption {
+	return func(x *Index) {
+		x.chunker = chunker
+	}
+}
+
+// WithExtractor sets the Extractor of files of the extension, e.g. ".pdf", used by AddFile.
+// ExtractText is set for ".txt" and ExtractMarkdown for ".md" and ".markdown" by default.
+func WithExtractor(ext string, extractor Extractor) IndexOption {
+	return func(x *Index) {
+		x.extractors[strings.ToLower(ext)] = extractor
+	}
+}
+
+// WithEmbeddingBatchSize sets the maximum number of chunks embedded by a GenerateEmbedding call,
+// e.g. to stay within the limit of the provider. The default is DefaultEmbeddingBatchSize.
+func WithEmbeddingBatchSize(n int) IndexOption {
+	return func(x *Index) {
+		x.batchSize = n
+	}
+}
+
+// NewIndex creates an Index of documents in store, embedded by embedder.
+func NewIndex(store VectorStore, embedder gollem.LLMClient, options ...IndexOption) (*Index, error) {
+	if store == nil {
+		return nil, goerr.New("vector store is required")
+	}
+	if embedder == nil {
+		return nil, goerr.New("embedder is required")
+	}
+
+	x := &Index{
+		store:    store,
+		embedder: embedder,
+		chunker:  NewTextChunker(DefaultChunkSize, DefaultChunkOverlap),
+		extractors: map[string]Extractor{
+			".txt":      ExtractText,
+			".md":       ExtractMarkdown,
+			".markdown": ExtractMarkdown,
+		},
+		batchSize: DefaultEmbeddingBatchSize,
+	}
+	for _, opt := range options {
+		opt(x)
+	}
+	if x.batchSize <= 0 {
+		x.batchSize = DefaultEmbeddingBatchSize
+	}
+	return x, nil
+}
+
+// AddDocuments chunks and embeds the documents and stores them, replacing the chunks of
+// documents of the same IDs.
+func (x *Index) AddDocuments(ctx context.Context, docs ...*Document) error {
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		id := doc.ID
+		if id == "" {
+			id = doc.Source
+		}
+		if id == "" {
+			id = gollem.NewID(ctx)
+		}
+
+		texts := x.chunker(doc.Content)
+		chunks := make([]*Chunk, len(texts))
+		for i, text := range texts {
+			chunks[i] = &Chunk{
+				ID:         fmt.Sprintf("%s#%d", id, i),
+				DocumentID: id,
+				Source:     doc.Source,
+				Index:      i,
+				Content:    text,
+			}
+		}
+
+		for start := 0; start < len(texts); start += x.batchSize {
+			end := min(start+x.batchSize, len(texts))
+			vectors, err := x.embed(ctx, texts[start:end])
+			if err != nil {
+				return goerr.Wrap(err, "failed to embed document", goerr.V("document_id", id))
+			}
+			for i, vector := range vectors {
+				chunks[start+i].Vector = vector
+			}
+		}
+
+		if err := x.store.Delete(ctx, id); err != nil {
+			return goerr.Wrap(err, "failed to delete chunks of document", goerr.V("document_id", id))
+		}
+		if len(chunks) == 0 {
+			continue
+		}
+		if err := x.store.Add(ctx, chunks...); err != nil {
+			return goerr.Wrap(err, "failed to store chunks of document", goerr.V("document_id", id))
+		}
+	}
+	return nil
+}
+
+// AddFile reads the file at path, extracts its text by the Extractor of the extension and adds
+// it as a document of the path.
+func (x *Index) AddFile(ctx context.Context, path string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	extractor, ok := x.extractors[ext]
+	if !ok {
+		return goerr.New("no extractor for the file extension, set WithExtractor",
+			goerr.V("path", path), goerr.V("extension", ext))
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return goerr.Wrap(err, "failed to read document file", goerr.V("path", path))
+	}
+	text, err := extractor(ctx, data)
+	if err != nil {
+		return goerr.Wrap(err, "failed to extract text of document", goerr.V("path", path))
+	}
+
+	return x.AddDocuments(ctx, &Document{Source: path, Content: text})
+}
+
+// Delete removes the chunks of the document.
+func (x *Index) Delete(ctx context.Context, documentID string) error {
+	if err := x.store.Delete(ctx, documentID); err != nil {
+		return goerr.Wrap(err, "failed to delete chunks of document", goerr.V("document_id", documentID))
+	}
+	return nil
+}
+
+// Search returns at most limit chunks in order of similarity to query, highest first.
+func (x *Index) Search(ctx context.Context, query string, limit int) ([]*Match, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, goerr.New("query is required")
+	}
+
+	vectors, err := x.embed(ctx, []string{query})
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to embed query")
+	}
+	matches, err := x.store.Search(ctx, vectors[0], limit)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to search chunks")
+	}
+	return matches, nil
+}
+
+func (x *Index) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors, err := x.embedder.GenerateEmbedding(ctx, x.dimension, texts)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to generate embeddings")
+	}
+	if len(vectors) != len(texts) {
+		return nil, goerr.New("number of embeddings does not match the texts",
+			goerr.V("embeddings", len(vectors)), goerr.V("texts", len(texts)))
+	}
+	return vectors, nil
+}
@@ -0,0 +1,124 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gollem/rag"
+	"github.com/m-mizutani/gt"
+)
+
+func TestIndex(t *testing.T) {
+	ctx := t.Context()
+	store := rag.NewInMemoryVectorStore()
+	embedder := keywordEmbedder("deploy", "billing", "vacation")
+	index, err := rag.NewIndex(store, embedder,
+		rag.WithChunker(rag.NewTextChunker(60, 0)),
+		rag.WithEmbeddingBatchSize(1),
+	)
+	gt.NoError(t, err)
+
+	gt.NoError(t, index.AddDocuments(ctx,
+		&rag.Document{Source: "ops.md", Content: "Deploy with the release pipeline.\n\nRollback a deploy from the console."},
+		&rag.Document{ID: "hr", Source: "hr.md", Content: "Request vacation two weeks ahead."},
+	))
+	gt.Equal(t, 3, store.Len())
+	gt.Equal(t, 3, len(embedder.GenerateEmbeddingCalls()))
+
+	t.Run("search chunks by query", func(t *testing.T) {
+		matches, err := index.Search(ctx, "how to take vacation", 1)
+		gt.NoError(t, err)
+		gt.A(t, matches).Length(1).At(0, func(t testing.TB, v *rag.Match) {
+			gt.Equal(t, "hr", v.Chunk.DocumentID)
+			gt.Equal(t, "hr#0", v.Chunk.ID)
+			gt.Equal(t, "hr.md", v.Chunk.Source)
+		})
+
+		_, err = index.Search(ctx, " ", 1)
+		gt.Error(t, err)
+	})
+
+	t.Run("adding a document again replaces its chunks", func(t *testing.T) {
+		gt.NoError(t, index.AddDocuments(ctx, &rag.Document{Source: "ops.md", Content: "Deploy on Mondays."}))
+		gt.Equal(t, 2, store.Len())
+
+		gt.NoError(t, index.Delete(ctx, "ops.md"))
+		gt.Equal(t, 1, store.Len())
+	})
+
+	t.Run("add files by extractors", func(t *testing.T) {
+		dir := t.TempDir()
+		md := filepath.Join(dir, "billing.md")
+		gt.NoError(t, os.WriteFile(md, []byte("---\nowner: finance\n---\nBilling runs monthly."), 0600))
+		pdf := filepath.Join(dir, "deploy.PDF")
+		gt.NoError(t, os.WriteFile(pdf, []byte("%PDF"), 0600))
+
+		gt.NoError(t, index.AddFile(ctx, md))
+		matches, err := index.Search(ctx, "billing", 1)
+		gt.NoError(t, err)
+		gt.Equal(t, md, matches[0].Chunk.DocumentID)
+		gt.Equal(t, "Billing runs monthly.", matches[0].Chunk.Content)
+
+		gt.Error(t, index.AddFile(ctx, pdf))
+
+		pdfIndex, err := rag.NewIndex(store, embedder, rag.WithExtractor(".pdf", func(ctx context.Context, data []byte) (string, error) {
+			return "Deploy guide", nil
+		}))
+		gt.NoError(t, err)
+		gt.NoError(t, pdfIndex.AddFile(ctx, pdf))
+		matches, err = index.Search(ctx, "deploy", 1)
+		gt.NoError(t, err)
+		gt.Equal(t, "Deploy guide", matches[0].Chunk.Content)
+	})
+
+	t.Run("required arguments", func(t *testing.T) {
+		_, err := rag.NewIndex(nil, embedder)
+		gt.Error(t, err)
+		_, err = rag.NewIndex(store, nil)
+		gt.Error(t, err)
+	})
+}
+
+func TestRetrieveTool(t *testing.T) {
+	ctx := t.Context()
+	index, err := rag.NewIndex(rag.NewInMemoryVectorStore(), keywordEmbedder("deploy", "billing"))
+	gt.NoError(t, err)
+	gt.NoError(t, index.AddDocuments(ctx,
+		&rag.Document{Source: "ops.md", Content: "Deploy with the pipeline."},
+		&rag.Document{Source: "finance.md", Content: "Billing runs monthly."},
+	))
+
+	tool := index.Tool()
+	spec := tool.Spec()
+	gt.Equal(t, rag.RetrieveToolName, spec.Name)
+	gt.NoError(t, spec.Validate())
+
+	resp, err := tool.Run(ctx, map[string]any{"query": "billing cycle", "limit": float64(1)})
+	gt.NoError(t, err)
+	results := resp["results"].([]any)
+	gt.A(t, results).Length(1)
+	result := results[0].(map[string]any)
+	gt.Equal(t, "finance.md", result["source"])
+	gt.Equal(t, "Billing runs monthly.", result["content"])
+	gt.Equal(t, 0, result["chunk_index"])
+
+	_, err = tool.Run(ctx, map[string]any{})
+	gt.Error(t, err)
+}
+
+func TestIndexEmbeddingError(t *testing.T) {
+	errEmbed := errors.New("embedding failed")
+	embedder := keywordEmbedder("x")
+	embedder.GenerateEmbeddingFunc = func(ctx context.Context, dimension int, input []string) ([][]float64, error) {
+		return nil, errEmbed
+	}
+	store := rag.NewInMemoryVectorStore()
+	index, err := rag.NewIndex(store, embedder)
+	gt.NoError(t, err)
+
+	gt.Error(t, index.AddDocuments(t.Context(), &rag.Document{Content: "x"})).Is(errEmbed)
+	gt.Equal(t, 0, store.Len())
+}
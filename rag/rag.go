@@ -0,0 +1,158 @@
+// Package rag provides retrieval-augmented generation for agents: documents are extracted,
+// chunked and embedded into a VectorStore by an Index, and the chunks relevant to a request are
+// retrieved by the retrieve_documents tool of Index.Tool, or added to the system prompt of each
+// Execute by WithRAG. InMemoryVectorStore is an in-process VectorStore; implement VectorStore to
+// keep chunks in a vector database.
+package rag
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// Document is a source of knowledge to index.
+type Document struct {
+	// ID identifies the document. Adding a document of an existing ID replaces its chunks. It's
+	// Source if empty, or generated by gollem.NewID if both are empty.
+	ID string `json:"id"`
+
+	// Source is where the document comes from, e.g. a file path or URL. It's shown to the LLM
+	// with retrieved chunks.
+	Source string `json:"source,omitempty"`
+
+	// Content is the text of the document
+	Content string `json:"content"`
+}
+
+// Chunk is a part of a document stored with its embedding.
+type Chunk struct {
+	// ID identifies the chunk by the document ID and Index
+	ID string `json:"id"`
+
+	// DocumentID is the ID of the document of the chunk
+	DocumentID string `json:"document_id"`
+
+	// Source is the source of the document
+	Source string `json:"source,omitempty"`
+
+	// Index is the position of the chunk in the document, from 0
+	Index int `json:"index"`
+
+	// Content is the text of the chunk
+	Content string `json:"content"`
+
+	// Vector is the embedding of Content
+	Vector []float64 `json:"vector"`
+}
+
+// Match is a chunk found by Search with its similarity to the query.
+type Match struct {
+	Chunk *Chunk
+	Score float64
+}
+
+// VectorStore stores chunks and searches them by embedding similarity. It must be safe for
+// concurrent use.
+type VectorStore interface {
+	// Add stores chunks. A chunk of an existing ID replaces it.
+	Add(ctx context.Context, chunks ...*Chunk) error
+
+	// Delete removes all chunks of the document.
+	Delete(ctx context.Context, documentID string) error
+
+	// Search returns at most limit chunks in order of similarity of their vectors to vector,
+	// highest first.
+	Search(ctx context.Context, vector []float64, limit int) ([]*Match, error)
+}
+
+// InMemoryVectorStore is a VectorStore keeping chunks in process and searching them by cosine
+// similarity over all chunks. Chunks are lost when the process exits.
+type InMemoryVectorStore struct {
+	mu     sync.RWMutex
+	chunks []*Chunk
+}
+
+var _ VectorStore = (*InMemoryVectorStore)(nil)
+
+// NewInMemoryVectorStore creates an empty InMemoryVectorStore.
+func NewInMemoryVectorStore() *InMemoryVectorStore {
+	return &InMemoryVectorStore{}
+}
+
+// Add implements VectorStore.
+func (x *InMemoryVectorStore) Add(ctx context.Context, chunks ...*Chunk) error {
+	for _, c := range chunks {
+		if c == nil || c.ID == "" || len(c.Vector) == 0 {
+			return goerr.New("chunk must have an ID and a vector")
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, c := range chunks {
+		stored := *c
+		stored.Vector = slices.Clone(c.Vector)
+
+		idx := slices.IndexFunc(x.chunks, func(e *Chunk) bool { return e.ID == stored.ID })
+		if idx >= 0 {
+			x.chunks[idx] = &stored
+		} else {
+			x.chunks = append(x.chunks, &stored)
+		}
+	}
+	return nil
+}
+
+// Delete implements VectorStore.
+func (x *InMemoryVectorStore) Delete(ctx context.Context, documentID string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.chunks = slices.DeleteFunc(x.chunks, func(c *Chunk) bool { return c.DocumentID == documentID })
+	return nil
+}
+
+// Search implements VectorStore.
+func (x *InMemoryVectorStore) Search(ctx context.Context, vector []float64, limit int) ([]*Match, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	x.mu.RLock()
+	matches := make([]*Match, 0, len(x.chunks))
+	for _, c := range x.chunks {
+		matches = append(matches, &Match{Chunk: c, Score: gollem.CosineSimilarity(vector, c.Vector)})
+	}
+	x.mu.RUnlock()
+
+	slices.SortStableFunc(matches, func(a, b *Match) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	// Return copies so callers can't modify stored chunks
+	for _, match := range matches {
+		found := *match.Chunk
+		found.Vector = slices.Clone(match.Chunk.Vector)
+		match.Chunk = &found
+	}
+	return matches, nil
+}
+
+// Len returns the number of stored chunks of all documents.
+func (x *InMemoryVectorStore) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.chunks)
+}
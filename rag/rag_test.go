@@ -0,0 +1,74 @@
+package rag_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/rag"
+	"github.com/m-mizutani/gt"
+)
+
+// keywordEmbedder returns a client embedding texts by counts of the keywords.
+func keywordEmbedder(keywords ...string) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		GenerateEmbeddingFunc: func(ctx context.Context, dimension int, input []string) ([][]float64, error) {
+			vectors := make([][]float64, len(input))
+			for i, text := range input {
+				vectors[i] = make([]float64, len(keywords))
+				for j, keyword := range keywords {
+					vectors[i][j] = float64(strings.Count(strings.ToLower(text), keyword))
+				}
+			}
+			return gollem.NormalizeEmbeddings(vectors), nil
+		},
+	}
+}
+
+func TestInMemoryVectorStore(t *testing.T) {
+	ctx := t.Context()
+	store := rag.NewInMemoryVectorStore()
+
+	gt.NoError(t, store.Add(ctx,
+		&rag.Chunk{ID: "a#0", DocumentID: "a", Content: "go", Vector: []float64{1, 0}},
+		&rag.Chunk{ID: "a#1", DocumentID: "a", Content: "rust", Vector: []float64{0, 1}},
+		&rag.Chunk{ID: "b#0", DocumentID: "b", Content: "go and rust", Vector: []float64{1, 1}},
+	))
+	gt.Equal(t, 3, store.Len())
+	gt.Error(t, store.Add(ctx, &rag.Chunk{ID: "c#0", Content: "no vector"}))
+	gt.Error(t, store.Add(ctx, &rag.Chunk{Content: "no ID", Vector: []float64{1, 0}}))
+
+	t.Run("search by similarity", func(t *testing.T) {
+		matches, err := store.Search(ctx, []float64{1, 0.1}, 2)
+		gt.NoError(t, err)
+		gt.A(t, matches).Length(2).
+			At(0, func(t testing.TB, v *rag.Match) {
+				gt.Equal(t, "a#0", v.Chunk.ID)
+				gt.True(t, v.Score > 0.99)
+			}).
+			At(1, func(t testing.TB, v *rag.Match) {
+				gt.Equal(t, "b#0", v.Chunk.ID)
+			})
+
+		// Returned chunks are copies
+		matches[0].Chunk.Vector[0] = 0
+		matches, err = store.Search(ctx, []float64{1, 0}, 1)
+		gt.NoError(t, err)
+		gt.Equal(t, []float64{1, 0}, matches[0].Chunk.Vector)
+	})
+
+	t.Run("same ID replaces the chunk", func(t *testing.T) {
+		gt.NoError(t, store.Add(ctx, &rag.Chunk{ID: "a#1", DocumentID: "a", Content: "zig", Vector: []float64{0, 1}}))
+		gt.Equal(t, 3, store.Len())
+		matches, err := store.Search(ctx, []float64{0, 1}, 1)
+		gt.NoError(t, err)
+		gt.Equal(t, "zig", matches[0].Chunk.Content)
+	})
+
+	t.Run("delete chunks of a document", func(t *testing.T) {
+		gt.NoError(t, store.Delete(ctx, "a"))
+		gt.Equal(t, 1, store.Len())
+	})
+}
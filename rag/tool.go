@@ -0,0 +1,85 @@
+package rag
+
+import (
+	"context"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+const (
+	// RetrieveToolName is the name of the tool of Index.Tool.
+	RetrieveToolName = "retrieve_documents"
+
+	// DefaultRetrieveLimit is the default maximum number of chunks retrieved by the tool and
+	// WithRAG.
+	DefaultRetrieveLimit = 5
+
+	// maxRetrieveLimit bounds the limit requested by the LLM
+	maxRetrieveLimit = 20
+)
+
+// Tool returns the retrieve_documents tool searching the index, so the agent retrieves
+// documents when it needs them.
+func (x *Index) Tool() gollem.Tool {
+	return &retrieveTool{index: x}
+}
+
+type retrieveTool struct {
+	index *Index
+}
+
+// Spec implements gollem.Tool.
+func (x *retrieveTool) Spec() gollem.ToolSpec {
+	minLimit, maxLimit := 1.0, float64(maxRetrieveLimit)
+	return gollem.ToolSpec{
+		Name: RetrieveToolName,
+		Description: "Search the indexed documents and return the passages most relevant to the query " +
+			"with their sources. Use it to find facts in the documents before answering.",
+		Parameters: map[string]*gollem.Parameter{
+			"query": {
+				Type:        gollem.TypeString,
+				Description: "What to look for, as a question or keywords",
+				Required:    true,
+			},
+			"limit": {
+				Type:        gollem.TypeInteger,
+				Description: "Maximum number of passages to return",
+				Minimum:     &minLimit,
+				Maximum:     &maxLimit,
+				Default:     DefaultRetrieveLimit,
+			},
+		},
+		Idempotent: true,
+	}
+}
+
+// Run implements gollem.Tool. It returns "results" of passages in order of relevance.
+func (x *retrieveTool) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	query, _ := args["query"].(string)
+	if query == "" {
+		return nil, goerr.New("query is required")
+	}
+
+	limit := DefaultRetrieveLimit
+	if v, ok := args["limit"].(float64); ok && v >= 1 {
+		limit = min(int(v), maxRetrieveLimit)
+	}
+
+	matches, err := x.index.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]any, len(matches))
+	for i, match := range matches {
+		results[i] = map[string]any{
+			"document_id": match.Chunk.DocumentID,
+			"source":      match.Chunk.Source,
+			"chunk_index": match.Chunk.Index,
+			"content":     match.Chunk.Content,
+			"score":       match.Score,
+		}
+	}
+	return map[string]any{"results": results}, nil
+}
@@ -0,0 +1,60 @@
+package gollem
+
+import (
+	"context"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// RateLimiter blocks until n units of a rate limit are available, or ctx is done. *rate.Limiter
+// of golang.org/x/time/rate satisfies it. Set it to an LLM client by the WithRateLimiter option
+// of the provider package, and share the RateLimiter among clients calling the same provider
+// account so that concurrent agents respect its limits.
+type RateLimiter interface {
+	WaitN(ctx context.Context, n int) error
+}
+
+// tokenRateLimiter is a RateLimiter consumed by tokens instead of requests.
+type tokenRateLimiter struct {
+	RateLimiter
+}
+
+// TokenRateLimiter returns a RateLimiter that consumes the estimated input tokens of each LLM
+// call, for a limit of tokens per minute (TPM), while a RateLimiter not wrapped consumes 1 per
+// call, for a limit of requests per minute (RPM). Tokens are counted by TokenizerFromContext and
+// capped by the burst of limiter if it has Burst() like *rate.Limiter, so that a large call
+// does not fail.
+func TokenRateLimiter(limiter RateLimiter) RateLimiter {
+	return &tokenRateLimiter{RateLimiter: limiter}
+}
+
+// WaitRateLimits blocks until all limiters allow the LLM call of req. It's called by the LLM
+// clients right before sending a request.
+func WaitRateLimits(ctx context.Context, limiters []RateLimiter, req *ContentRequest) error {
+	for _, limiter := range limiters {
+		if q, ok := limiter.(*QuotaTracker); ok {
+			if err := q.wait(ctx, 1, CountRequestTokens(TokenizerFromContext(ctx), req)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		n := 1
+		if tl, ok := limiter.(*tokenRateLimiter); ok {
+			n = CountRequestTokens(TokenizerFromContext(ctx), req)
+			if b, ok := tl.RateLimiter.(interface{ Burst() int }); ok {
+				n = min(n, b.Burst())
+			}
+		}
+		if err := limiter.WaitN(ctx, n); err != nil {
+			return goerr.Wrap(err, "failed to wait for rate limit", goerr.V("n", n))
+		}
+	}
+	return nil
+}
+
+// EstimateRequestTokens estimates the input tokens of req by EstimateTokens, counting images
+// and PDFs as fixed rough estimates.
+func EstimateRequestTokens(req *ContentRequest) int {
+	return CountRequestTokens(TokenCounter(EstimateTokens), req)
+}
@@ -0,0 +1,50 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+	"golang.org/x/time/rate"
+)
+
+type recordLimiter struct {
+	waits []int
+	err   error
+}
+
+func (x *recordLimiter) WaitN(ctx context.Context, n int) error {
+	x.waits = append(x.waits, n)
+	return x.err
+}
+
+func TestWaitRateLimits(t *testing.T) {
+	requests := &recordLimiter{}
+	tokens := &recordLimiter{}
+	req := &gollem.ContentRequest{
+		SystemPrompt: strings.Repeat("a", 40),
+		Inputs:       []gollem.Input{gollem.Text(strings.Repeat("b", 80))},
+	}
+
+	gt.NoError(t, gollem.WaitRateLimits(t.Context(), []gollem.RateLimiter{requests, gollem.TokenRateLimiter(tokens)}, req))
+	gt.Equal(t, []int{1}, requests.waits)
+	gt.Equal(t, []int{30}, tokens.waits)
+
+	t.Run("tokens are capped by burst", func(t *testing.T) {
+		// A token limit of 10 tokens per second with burst 10 would fail WaitN of 30 tokens
+		limiter := rate.NewLimiter(10, 10)
+		gt.NoError(t, gollem.WaitRateLimits(t.Context(), []gollem.RateLimiter{gollem.TokenRateLimiter(limiter)}, req))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+		gt.True(t, limiter.Allow())
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		err := gollem.WaitRateLimits(ctx, []gollem.RateLimiter{limiter}, req)
+		gt.Error(t, err).Is(context.Canceled)
+	})
+}
@@ -0,0 +1,154 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ReasoningSummary is a short machine-readable rationale of the final answer, intended for UIs
+// that must explain agent answers. It is generated by WithReasoningSummary.
+type ReasoningSummary struct {
+	Rationale   string   `json:"rationale" description:"One or two sentences explaining why the answer is correct"`
+	KeyEvidence []string `json:"key_evidence" description:"Facts from the conversation or tool results that support the answer, most important first"`
+	ToolsUsed   []string `json:"tools_used" description:"Names of the tools whose results were used"`
+	Confidence  float64  `json:"confidence" description:"Confidence that the answer is correct and complete" min:"0" max:"1"`
+}
+
+// maxObservationLength is the maximum number of characters of a tool result passed to the
+// summary prompt.
+const maxObservationLength = 1000
+
+const reasoningSummaryPrompt = `You are given a user request, the tool calls an assistant made and the assistant's final answer.
+Summarize why the answer was given. Only use evidence that appears below; do not add new facts.
+If the answer is not supported by the evidence, lower the confidence accordingly.
+
+## User request
+%s
+
+## Tool calls
+%s
+
+## Final answer
+%s`
+
+type reasoningSummaryConfig struct {
+	client LLMClient
+}
+
+// WithReasoningSummary enables a final pass that attaches a ReasoningSummary to
+// ExecuteResponse.Reasoning. client is used to generate the summary and should usually be a
+// cheap model; if nil, the agent's client is used. Failure of the summary pass does not fail
+// Execute; the error is logged and Reasoning is left nil.
+func WithReasoningSummary(client LLMClient) Option {
+	return func(s *gollemConfig) {
+		s.reasoningSummary = &reasoningSummaryConfig{client: client}
+	}
+}
+
+// toolObservation is a tool call seen during Execute, used as evidence for the summary.
+type toolObservation struct {
+	name   string
+	args   map[string]any
+	result map[string]any
+	err    error
+}
+
+// toolObserver records tool calls through a ToolMiddleware.
+type toolObserver struct {
+	mu           sync.Mutex
+	observations []toolObservation
+}
+
+func (x *toolObserver) middleware(next ToolHandler) ToolHandler {
+	return func(ctx context.Context, req *ToolExecRequest) (*ToolExecResponse, error) {
+		resp, err := next(ctx, req)
+
+		// Observations are recorded in snapshots, so sensitive arguments are masked
+		args := req.Tool.Arguments
+		if req.ToolSpec != nil {
+			args = req.ToolSpec.RedactArgs(args)
+		}
+		obs := toolObservation{name: req.Tool.Name, args: args, err: err}
+		if resp != nil {
+			obs.result = resp.Result
+			if obs.err == nil {
+				obs.err = resp.Error
+			}
+		}
+
+		x.mu.Lock()
+		x.observations = append(x.observations, obs)
+		x.mu.Unlock()
+
+		return resp, err
+	}
+}
+
+// toolNames returns the names of the called tools in call order without duplicates.
+func (x *toolObserver) toolNames() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	names := []string{}
+	for _, obs := range x.observations {
+		if !slices.Contains(names, obs.name) {
+			names = append(names, obs.name)
+		}
+	}
+	return names
+}
+
+func (x *toolObserver) String() string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if len(x.observations) == 0 {
+		return "(none)"
+	}
+
+	var b strings.Builder
+	for i, obs := range x.observations {
+		args, _ := json.Marshal(obs.args)
+		fmt.Fprintf(&b, "%d. %s(%s)\n", i+1, obs.name, args)
+		if obs.err != nil {
+			fmt.Fprintf(&b, "   error: %s\n", obs.err.Error())
+			continue
+		}
+		result, _ := json.Marshal(obs.result)
+		text := string(result)
+		// Truncated by runes not to send invalid UTF-8
+		if runes := []rune(text); len(runes) > maxObservationLength {
+			text = string(runes[:maxObservationLength]) + "...(truncated)"
+		}
+		fmt.Fprintf(&b, "   result: %s\n", text)
+	}
+	return b.String()
+}
+
+// summarizeReasoning generates the ReasoningSummary of resp. It returns nil if the summary
+// could not be generated.
+func summarizeReasoning(ctx context.Context, cfg *gollemConfig, client LLMClient, input []Input, resp *ExecuteResponse, observer *toolObserver) *ReasoningSummary {
+	if resp.IsEmpty() {
+		return nil
+	}
+
+	prompt := fmt.Sprintf(reasoningSummaryPrompt, inputsToString(input), observer.String(), resp.String())
+	prompt = appendLocalePrompt(prompt, LocaleFromContext(ctx))
+
+	result, err := Query[ReasoningSummary](ContextWithUsagePhase(ctx, UsagePhaseSummarize), client, prompt)
+	if err != nil {
+		cfg.logger.Warn("failed to generate reasoning summary", "error", err)
+		return nil
+	}
+
+	summary := result.Data
+	summary.ToolsUsed = observer.toolNames()
+	if summary.KeyEvidence == nil {
+		summary.KeyEvidence = []string{}
+	}
+	return summary
+}
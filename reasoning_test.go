@@ -0,0 +1,124 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestReasoningSummary(t *testing.T) {
+	newAgentClient := func() *mock.LLMClientMock {
+		calls := 0
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						calls++
+						if calls == 1 {
+							return &gollem.Response{
+								FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "random_number", Arguments: map[string]any{"min": 1.0, "max": 10.0}}},
+							}, nil
+						}
+						return &gollem.Response{Texts: []string{"the number is 5"}, InputToken: 10, OutputToken: 5}, nil
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return &gollem.History{}, nil
+					},
+					AppendHistoryFunc: func(*gollem.History) error { return nil },
+				}, nil
+			},
+		}
+	}
+
+	newSummaryClient := func(text string, genErr error) (*mock.LLMClientMock, *string) {
+		var prompt string
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						if genErr != nil {
+							return nil, genErr
+						}
+						prompt = input[0].String()
+						return &gollem.Response{Texts: []string{text}, InputToken: 7, OutputToken: 3}, nil
+					},
+				}, nil
+			},
+		}, &prompt
+	}
+
+	t.Run("summary is attached to the response", func(t *testing.T) {
+		summaryClient, prompt := newSummaryClient(`{"rationale":"tool returned 5","key_evidence":["random_number returned 5"],"tools_used":["made_up"],"confidence":0.8}`, nil)
+
+		var endEvent *gollem.ConversationEndEvent
+		agent := gollem.New(newAgentClient(),
+			gollem.WithTools(&RandomNumberTool{}),
+			gollem.WithReasoningSummary(summaryClient),
+			gollem.WithConversationEndHook(func(ctx context.Context, event *gollem.ConversationEndEvent) {
+				endEvent = event
+			}),
+		)
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("pick a number"))
+		gt.NoError(t, err)
+		gt.NotNil(t, resp.Reasoning)
+		gt.Equal(t, "tool returned 5", resp.Reasoning.Rationale)
+		gt.Equal(t, []string{"random_number returned 5"}, resp.Reasoning.KeyEvidence)
+		// Tools used are taken from the execution, not from the summary model.
+		gt.Equal(t, []string{"random_number"}, resp.Reasoning.ToolsUsed)
+		gt.Equal(t, 0.8, resp.Reasoning.Confidence)
+
+		gt.True(t, strings.Contains(*prompt, "pick a number"))
+		gt.True(t, strings.Contains(*prompt, "random_number("))
+		gt.True(t, strings.Contains(*prompt, "the number is 5"))
+
+		gt.Equal(t, 17, endEvent.InputToken)
+		gt.Equal(t, 8, endEvent.OutputToken)
+	})
+
+	t.Run("long tool result is truncated by characters", func(t *testing.T) {
+		summaryClient, prompt := newSummaryClient(`{"rationale":"ok","confidence":0.5}`, nil)
+		tool := &mockTool{
+			spec: gollem.ToolSpec{Name: "random_number"},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				return map[string]any{"text": strings.Repeat("あ", 2000)}, nil
+			},
+		}
+		agent := gollem.New(newAgentClient(),
+			gollem.WithTools(tool),
+			gollem.WithReasoningSummary(summaryClient),
+		)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("pick a number"))
+		gt.NoError(t, err)
+		gt.True(t, strings.Contains(*prompt, "あ...(truncated)"))
+		gt.True(t, utf8.ValidString(*prompt))
+	})
+
+	t.Run("summary failure does not fail execution", func(t *testing.T) {
+		summaryClient, _ := newSummaryClient("", errors.New("unavailable"))
+		agent := gollem.New(newAgentClient(),
+			gollem.WithTools(&RandomNumberTool{}),
+			gollem.WithReasoningSummary(summaryClient),
+		)
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("pick a number"))
+		gt.NoError(t, err)
+		gt.Equal(t, "the number is 5", resp.String())
+		gt.Nil(t, resp.Reasoning)
+	})
+
+	t.Run("no summary without option", func(t *testing.T) {
+		agent := gollem.New(newAgentClient(), gollem.WithTools(&RandomNumberTool{}))
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("pick a number"))
+		gt.NoError(t, err)
+		gt.Nil(t, resp.Reasoning)
+	})
+}
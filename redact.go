@@ -0,0 +1,220 @@
+package gollem
+
+import (
+	"context"
+
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// RedactedValue replaces values of sensitive parameters in logs, traces, events and errors.
+const RedactedValue = "[REDACTED]"
+
+// RedactArgs returns args with values of sensitive parameters replaced by RedactedValue,
+// including properties of objects and items of arrays. args is not modified; if the tool has
+// no sensitive parameters, args itself is returned.
+func (s *ToolSpec) RedactArgs(args map[string]any) map[string]any {
+	if args == nil || !hasSensitiveParams(s.Parameters) {
+		return args
+	}
+	return redactProperties(s.Parameters, args)
+}
+
+func redactProperties(params map[string]*Parameter, args map[string]any) map[string]any {
+	result := make(map[string]any, len(args))
+	for name, value := range args {
+		if param := params[name]; param != nil {
+			value = param.redactValue(value)
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// redactValue returns value with sensitive parts replaced by RedactedValue.
+func (p *Parameter) redactValue(value any) any {
+	if value == nil {
+		return nil
+	}
+	if p.Sensitive {
+		return RedactedValue
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if hasSensitiveParams(p.Properties) {
+			return redactProperties(p.Properties, v)
+		}
+	case []any:
+		if p.Items != nil && p.Items.hasSensitive() {
+			items := make([]any, len(v))
+			for i, item := range v {
+				items[i] = p.Items.redactValue(item)
+			}
+			return items
+		}
+	}
+	return value
+}
+
+// child returns param of a property or items of p, which is sensitive if p is.
+func (p *Parameter) child(param *Parameter) *Parameter {
+	if !p.Sensitive || param == nil || param.Sensitive {
+		return param
+	}
+	c := *param
+	c.Sensitive = true
+	return &c
+}
+
+func (p *Parameter) hasSensitive() bool {
+	if p == nil {
+		return false
+	}
+	if p.Sensitive || hasSensitiveParams(p.Properties) {
+		return true
+	}
+	return p.Items.hasSensitive()
+}
+
+func hasSensitiveParams(params map[string]*Parameter) bool {
+	for _, param := range params {
+		if param.hasSensitive() {
+			return true
+		}
+	}
+	return false
+}
+
+// argsRedactor redacts arguments of tool calls by tool specs.
+type argsRedactor map[string]*ToolSpec
+
+// newArgsRedactor returns a redactor of tools having sensitive parameters, or nil if none.
+func newArgsRedactor(tools map[string]Tool) argsRedactor {
+	var r argsRedactor
+	for name, tool := range tools {
+		spec := tool.Spec()
+		if !hasSensitiveParams(spec.Parameters) {
+			continue
+		}
+		if r == nil {
+			r = argsRedactor{}
+		}
+		r[name] = &spec
+	}
+	return r
+}
+
+func (r argsRedactor) args(name string, args map[string]any) map[string]any {
+	if spec, ok := r[name]; ok {
+		return spec.RedactArgs(args)
+	}
+	return args
+}
+
+// call returns a copy of call with redacted arguments, or call itself if not needed.
+func (r argsRedactor) call(call *FunctionCall) *FunctionCall {
+	if call == nil {
+		return nil
+	}
+	if _, ok := r[call.Name]; !ok {
+		return call
+	}
+	c := *call
+	c.Arguments = r.args(call.Name, call.Arguments)
+	return &c
+}
+
+func (r argsRedactor) calls(calls []*FunctionCall) []*FunctionCall {
+	if len(r) == 0 {
+		return calls
+	}
+	result := make([]*FunctionCall, len(calls))
+	for i, call := range calls {
+		result[i] = r.call(call)
+	}
+	return result
+}
+
+// response returns a copy of resp with redacted arguments of function calls for logging.
+func (r argsRedactor) response(resp *Response) *Response {
+	if len(r) == 0 || resp == nil || (len(resp.FunctionCalls) == 0 && len(resp.FunctionCallDeltas) == 0) {
+		return resp
+	}
+	c := *resp
+	c.FunctionCalls = r.calls(resp.FunctionCalls)
+	c.FunctionCallDeltas = r.deltas(resp.FunctionCallDeltas)
+	return &c
+}
+
+// deltas returns copies of deltas whose arguments may have sensitive values, with the
+// arguments replaced by RedactedValue. A fragment of JSON can't be redacted by parameters, and
+// a delta of arguments usually has no name, so only deltas named with a tool without sensitive
+// parameters are kept as they are.
+func (r argsRedactor) deltas(deltas []*FunctionCallDelta) []*FunctionCallDelta {
+	if len(deltas) == 0 {
+		return deltas
+	}
+	result := make([]*FunctionCallDelta, len(deltas))
+	for i, delta := range deltas {
+		if delta != nil && delta.Arguments != "" {
+			if _, ok := r[delta.Name]; ok || delta.Name == "" {
+				d := *delta
+				d.Arguments = RedactedValue
+				delta = &d
+			}
+		}
+		result[i] = delta
+	}
+	return result
+}
+
+// redactTraceHandler redacts arguments of tool calls in LLM call and tool execution spans.
+type redactTraceHandler struct {
+	trace.Handler
+	redactor argsRedactor
+}
+
+func (h *redactTraceHandler) StartToolExec(ctx context.Context, toolName string, args map[string]any) context.Context {
+	return h.Handler.StartToolExec(ctx, toolName, h.redactor.args(toolName, args))
+}
+
+func (h *redactTraceHandler) EndLLMCall(ctx context.Context, data *trace.LLMCallData, err error) {
+	if data != nil {
+		c := *data
+		if data.Request != nil {
+			req := *data.Request
+			req.Messages = make([]trace.Message, len(data.Request.Messages))
+			for i, msg := range data.Request.Messages {
+				msg.Contents = h.contents(msg.Contents)
+				req.Messages[i] = msg
+			}
+			c.Request = &req
+		}
+		if data.Response != nil {
+			resp := *data.Response
+			resp.FunctionCalls = make([]*trace.FunctionCall, len(data.Response.FunctionCalls))
+			for i, call := range data.Response.FunctionCalls {
+				if call != nil {
+					redacted := *call
+					redacted.Arguments = h.redactor.args(call.Name, call.Arguments)
+					call = &redacted
+				}
+				resp.FunctionCalls[i] = call
+			}
+			c.Response = &resp
+		}
+		data = &c
+	}
+	h.Handler.EndLLMCall(ctx, data, err)
+}
+
+func (h *redactTraceHandler) contents(contents []trace.MessageContent) []trace.MessageContent {
+	result := make([]trace.MessageContent, len(contents))
+	for i, content := range contents {
+		if content.Type == "tool_call" {
+			content.Arguments = h.redactor.args(content.Name, content.Arguments)
+		}
+		result[i] = content
+	}
+	return result
+}
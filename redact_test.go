@@ -0,0 +1,221 @@
+package gollem_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func loginSpec() gollem.ToolSpec {
+	return gollem.ToolSpec{
+		Name: "login",
+		Parameters: map[string]*gollem.Parameter{
+			"user":     {Type: gollem.TypeString, Required: true},
+			"password": {Type: gollem.TypeString, Required: true, Sensitive: true},
+			"headers": {
+				Type: gollem.TypeArray,
+				Items: &gollem.Parameter{
+					Type: gollem.TypeObject,
+					Properties: map[string]*gollem.Parameter{
+						"name":  {Type: gollem.TypeString},
+						"value": {Type: gollem.TypeString, Sensitive: true},
+					},
+				},
+			},
+			"credential": {Type: gollem.TypeObject, Sensitive: true, Properties: map[string]*gollem.Parameter{
+				"token": {Type: gollem.TypeString, Pattern: "^tok-"},
+			}},
+		},
+	}
+}
+
+func TestToolSpecRedactArgs(t *testing.T) {
+	spec := loginSpec()
+	args := map[string]any{
+		"user":     "alice",
+		"password": "hunter2",
+		"headers": []any{
+			map[string]any{"name": "X-Api-Key", "value": "secret-key"},
+		},
+		"credential": map[string]any{"token": "tok-123"},
+	}
+
+	redacted := spec.RedactArgs(args)
+	gt.Equal(t, map[string]any{
+		"user":     "alice",
+		"password": gollem.RedactedValue,
+		"headers": []any{
+			map[string]any{"name": "X-Api-Key", "value": gollem.RedactedValue},
+		},
+		"credential": gollem.RedactedValue,
+	}, redacted)
+
+	// args is not modified
+	gt.Equal(t, "hunter2", args["password"])
+
+	t.Run("no sensitive parameters", func(t *testing.T) {
+		spec := gollem.ToolSpec{Name: "search", Parameters: map[string]*gollem.Parameter{
+			"query": {Type: gollem.TypeString},
+		}}
+		args := map[string]any{"query": "hello"}
+		gt.Equal(t, args, spec.RedactArgs(args))
+	})
+}
+
+func TestSensitiveValidationError(t *testing.T) {
+	spec := loginSpec()
+
+	t.Run("sensitive parameter", func(t *testing.T) {
+		err := spec.Parameters["password"].ValidateValue("password", 987654)
+		gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+		gt.Equal(t, gollem.RedactedValue, goerr.Values(err)["actual"])
+	})
+
+	t.Run("property of sensitive parameter", func(t *testing.T) {
+		err := spec.Parameters["credential"].ValidateValue("credential", map[string]any{"token": 987654})
+		gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+		gt.Equal(t, "credential.token", goerr.Values(err)["parameter"])
+		gt.Equal(t, gollem.RedactedValue, goerr.Values(err)["actual"])
+	})
+}
+
+func TestSensitiveArgsInExecute(t *testing.T) {
+	rec := trace.New()
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	args := map[string]any{"user": "alice", "password": "hunter2"}
+	calls := 0
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					if calls > 1 {
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+
+					// LLM clients trace the calls including tool calls of the response
+					h := trace.HandlerFrom(ctx)
+					ctx = h.StartLLMCall(ctx)
+					h.EndLLMCall(ctx, &trace.LLMCallData{
+						Request: &trace.LLMRequest{Messages: []trace.Message{{
+							Role:     "assistant",
+							Contents: []trace.MessageContent{trace.NewToolCallContent("0", "login", args)},
+						}}},
+						Response: &trace.LLMResponse{FunctionCalls: []*trace.FunctionCall{{ID: "1", Name: "login", Arguments: args}}},
+					}, nil)
+
+					return &gollem.Response{
+						FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "login", Arguments: args}},
+					}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	var received map[string]any
+	tool := &mock.ToolMock{
+		SpecFunc: loginSpec,
+		RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			received = args
+			return nil, errors.New("login failed")
+		},
+	}
+
+	agent := gollem.New(client,
+		gollem.WithTools(tool),
+		gollem.WithTrace(rec),
+		gollem.WithLogger(logger),
+	)
+	_, err := agent.Execute(t.Context(), gollem.Text("log in"))
+	gt.NoError(t, err)
+
+	// The tool receives the raw value
+	gt.Equal(t, "hunter2", received["password"])
+
+	traceJSON, err := json.Marshal(rec.Trace())
+	gt.NoError(t, err)
+	gt.S(t, string(traceJSON)).Contains("alice")
+	gt.S(t, string(traceJSON)).NotContains("hunter2")
+	gt.S(t, string(traceJSON)).Contains(gollem.RedactedValue)
+
+	gt.S(t, logs.String()).Contains("login failed")
+	gt.S(t, logs.String()).NotContains("hunter2")
+}
+
+func TestToSchemaSensitive(t *testing.T) {
+	type Login struct {
+		User     string `json:"user"`
+		Password string `json:"password" sensitive:"true"`
+	}
+	schema, err := gollem.ToSchema(Login{})
+	gt.NoError(t, err)
+	gt.False(t, schema.Properties["user"].Sensitive)
+	gt.True(t, schema.Properties["password"].Sensitive)
+}
+
+func TestSensitiveArgDeltasInStreamingLogs(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	args := map[string]any{"user": "alice", "password": "hunter2"}
+	calls := 0
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+					calls++
+					ch := make(chan *gollem.Response, 3)
+					if calls > 1 {
+						ch <- &gollem.Response{Texts: []string{"done"}}
+						close(ch)
+						return ch, nil
+					}
+
+					// Deltas of arguments come without the tool name, before the complete call
+					call := &gollem.FunctionCall{ID: "1", Name: "login", Arguments: args}
+					for _, delta := range gollem.FunctionCallDeltas(0, call) {
+						ch <- &gollem.Response{FunctionCallDeltas: []*gollem.FunctionCallDelta{delta}}
+					}
+					ch <- &gollem.Response{FunctionCalls: []*gollem.FunctionCall{call}}
+					close(ch)
+					return ch, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	tool := &mock.ToolMock{
+		SpecFunc: loginSpec,
+		RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{"ok": true}, nil
+		},
+	}
+
+	agent := gollem.New(client,
+		gollem.WithTools(tool),
+		gollem.WithResponseMode(gollem.ResponseModeStreaming),
+		gollem.WithLogger(logger),
+	)
+	_, err := agent.Execute(t.Context(), gollem.Text("log in"))
+	gt.NoError(t, err)
+
+	gt.S(t, logs.String()).Contains("recv response")
+	gt.S(t, logs.String()).NotContains("hunter2")
+}
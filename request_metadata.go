@@ -0,0 +1,60 @@
+package gollem
+
+import (
+	"context"
+	"maps"
+
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// RequestMetadata is metadata of the request that an Execute serves. It's propagated to
+// external services called in the Execute, e.g. in _meta of MCP tool calls, so that their logs
+// and traces can be connected to the request.
+type RequestMetadata struct {
+	RequestID string `json:"request_id,omitempty"`
+	User      string `json:"user,omitempty"`
+	// TraceID is the ID of the distributed trace. If it's empty, RequestMetadataFromContext
+	// returns the ID of the trace recorded by trace.Recorder of the context.
+	TraceID string `json:"trace_id,omitempty"`
+	// Values are other metadata, e.g. a tenant ID
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// IsZero returns true if no metadata is set.
+func (m RequestMetadata) IsZero() bool {
+	return m.RequestID == "" && m.User == "" && m.TraceID == "" && len(m.Values) == 0
+}
+
+type requestMetadataCtxKey struct{}
+
+// ContextWithRequestMetadata returns a context with metadata merged into the metadata of ctx.
+// Empty fields of metadata do not overwrite the fields of ctx.
+func ContextWithRequestMetadata(ctx context.Context, metadata RequestMetadata) context.Context {
+	merged, _ := ctx.Value(requestMetadataCtxKey{}).(RequestMetadata)
+	if metadata.RequestID != "" {
+		merged.RequestID = metadata.RequestID
+	}
+	if metadata.User != "" {
+		merged.User = metadata.User
+	}
+	if metadata.TraceID != "" {
+		merged.TraceID = metadata.TraceID
+	}
+	if len(metadata.Values) > 0 {
+		values := make(map[string]string, len(merged.Values)+len(metadata.Values))
+		maps.Copy(values, merged.Values)
+		maps.Copy(values, metadata.Values)
+		merged.Values = values
+	}
+	return context.WithValue(ctx, requestMetadataCtxKey{}, merged)
+}
+
+// RequestMetadataFromContext returns a copy of the metadata of ctx.
+func RequestMetadataFromContext(ctx context.Context) RequestMetadata {
+	metadata, _ := ctx.Value(requestMetadataCtxKey{}).(RequestMetadata)
+	metadata.Values = maps.Clone(metadata.Values)
+	if metadata.TraceID == "" {
+		metadata.TraceID = trace.TraceIDFrom(ctx)
+	}
+	return metadata
+}
@@ -0,0 +1,46 @@
+package gollem_test
+
+import (
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func TestRequestMetadata(t *testing.T) {
+	gt.True(t, gollem.RequestMetadataFromContext(t.Context()).IsZero())
+
+	ctx := gollem.ContextWithRequestMetadata(t.Context(), gollem.RequestMetadata{
+		RequestID: "req-1",
+		User:      "alice",
+		Values:    map[string]string{"tenant": "acme"},
+	})
+	ctx = gollem.ContextWithRequestMetadata(ctx, gollem.RequestMetadata{
+		RequestID: "req-2",
+		Values:    map[string]string{"region": "jp"},
+	})
+
+	metadata := gollem.RequestMetadataFromContext(ctx)
+	gt.Equal(t, gollem.RequestMetadata{
+		RequestID: "req-2",
+		User:      "alice",
+		Values:    map[string]string{"tenant": "acme", "region": "jp"},
+	}, metadata)
+
+	// the returned metadata is a copy
+	metadata.Values["tenant"] = "other"
+	gt.Equal(t, "acme", gollem.RequestMetadataFromContext(ctx).Values["tenant"])
+
+	t.Run("trace ID of recorder", func(t *testing.T) {
+		rec := trace.New(trace.WithTraceID("trace-1"))
+		ctx := trace.WithHandler(ctx, trace.Multi(rec))
+		gt.Equal(t, "", gollem.RequestMetadataFromContext(ctx).TraceID)
+
+		ctx = rec.StartAgentExecute(ctx)
+		gt.Equal(t, "trace-1", gollem.RequestMetadataFromContext(ctx).TraceID)
+
+		ctx = gollem.ContextWithRequestMetadata(ctx, gollem.RequestMetadata{TraceID: "external"})
+		gt.Equal(t, "external", gollem.RequestMetadataFromContext(ctx).TraceID)
+	})
+}
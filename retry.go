@@ -0,0 +1,200 @@
+package gollem
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// RetryPolicy is how LLM calls failed by transient errors are retried with exponential
+// backoff. Set it to an agent by WithRetryPolicy, or to a context by ContextWithRetryPolicy.
+// It applies to Generate and Stream of every session called with the context, including
+// sessions of strategies, subagents and middlewares such as summarization of the compacter.
+// A stream is retried only when it fails to start.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of calls including the first one. 1 or less disables
+	// retry.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It doubles on each retry.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay before a retry. Zero means no cap.
+	MaxDelay time.Duration
+
+	// Jitter is the ratio (0.0 to 1.0) of the delay to be randomly reduced, so that concurrent
+	// calls failed at once are not retried at once.
+	Jitter float64
+
+	// Retriable reports whether a failed call is worth retrying. Default is IsTransientError.
+	Retriable func(err error) bool
+
+	// OnRetry is called before waiting for a retry. It's optional.
+	OnRetry func(ctx context.Context, event *RetryEvent)
+}
+
+// RetryEvent describes a retry of an LLM call. It's passed to RetryPolicy.OnRetry and added to
+// the trace as a "llm_retry" event. Retries of idempotent tools are also added to the trace as
+// "tool_retry" events.
+type RetryEvent struct {
+	// Attempt is the number of the failed call, 1 for the first call
+	Attempt int `json:"attempt"`
+	// Delay is the duration to wait before the next call
+	Delay time.Duration `json:"delay"`
+	// Error is the error of the failed call
+	Error error `json:"-"`
+	// ErrorMessage is the message of Error
+	ErrorMessage string `json:"error"`
+}
+
+// DefaultRetryPolicy returns a RetryPolicy that makes up to 4 calls with 1s, 2s and 4s delays
+// (up to 20% shorter by jitter) on transient errors.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// IsTransientError reports whether err is a transient error of an LLM API that may succeed on
+// retry, i.e. tagged with ErrTagTransient by the LLM clients: rate limits (429), overload
+// (529) and server errors (5xx). Cancellation of the context is not transient.
+func IsTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return goerr.HasTag(err, ErrTagTransient)
+}
+
+// IsTransientStatus reports whether an HTTP status code of an LLM API is transient. It's used
+// by the LLM clients to tag errors with ErrTagTransient.
+func IsTransientStatus(code int) bool {
+	return code == 408 || code == 429 || code >= 500
+}
+
+// Delay returns the delay before the retry after the attempt-th call, without jitter.
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	if p.BaseDelay <= 0 || attempt < 1 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxDelay > 0 {
+		return min(delay, p.MaxDelay)
+	}
+	return delay
+}
+
+func (p *RetryPolicy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	ratio := min(p.Jitter, 1.0)
+	return delay - time.Duration(rand.Float64()*ratio*float64(delay))
+}
+
+func (p *RetryPolicy) retriable(err error) bool {
+	if p.Retriable != nil {
+		return p.Retriable(err)
+	}
+	return IsTransientError(err)
+}
+
+// do calls call until it succeeds, fails by an error not retriable, or reaches MaxAttempts.
+// Each retry is added to the trace as an event of name.
+func (p *RetryPolicy) do(ctx context.Context, name string, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retriable(err) {
+			return err
+		}
+
+		event := &RetryEvent{
+			Attempt:      attempt,
+			Delay:        p.jitter(p.Delay(attempt)),
+			Error:        err,
+			ErrorMessage: err.Error(),
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(ctx, event)
+		}
+		if h := trace.HandlerFrom(ctx); h != nil {
+			h.AddEvent(ctx, name, event)
+		}
+
+		timer := time.NewTimer(event.Delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return goerr.Wrap(ctx.Err(), "call canceled while waiting for retry", goerr.V("error", err))
+		}
+	}
+}
+
+// WithRetryPolicy sets the policy to retry LLM calls failed by transient errors during Execute,
+// including calls of strategies, subagents and middlewares. Default is no retry. Note that
+// some provider SDKs also retry by themselves.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(s *gollemConfig) {
+		s.retryPolicy = policy
+	}
+}
+
+type retryPolicyCtxKey struct{}
+
+// ContextWithRetryPolicy returns a context that makes sessions retry LLM calls by policy, e.g.
+// to retry calls out of Agent.Execute such as Query. A nil policy disables retry.
+func ContextWithRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyCtxKey{}, policy)
+}
+
+func retryPolicyFrom(ctx context.Context) *RetryPolicy {
+	policy, _ := ctx.Value(retryPolicyCtxKey{}).(*RetryPolicy)
+	return policy
+}
+
+// retryContentBlockMiddleware retries the LLM call by the RetryPolicy of the context.
+func retryContentBlockMiddleware(next ContentBlockHandler) ContentBlockHandler {
+	return func(ctx context.Context, req *ContentRequest) (*ContentResponse, error) {
+		policy := retryPolicyFrom(ctx)
+		if policy == nil {
+			return next(ctx, req)
+		}
+		var resp *ContentResponse
+		err := policy.do(ctx, "llm_retry", func() error {
+			var err error
+			resp, err = next(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// retryContentStreamMiddleware retries starting the stream by the RetryPolicy of the context.
+func retryContentStreamMiddleware(next ContentStreamHandler) ContentStreamHandler {
+	return func(ctx context.Context, req *ContentRequest) (<-chan *ContentResponse, error) {
+		policy := retryPolicyFrom(ctx)
+		if policy == nil {
+			return next(ctx, req)
+		}
+		var stream <-chan *ContentResponse
+		err := policy.do(ctx, "llm_retry", func() error {
+			var err error
+			stream, err = next(ctx, req)
+			return err
+		})
+		return stream, err
+	}
+}
@@ -0,0 +1,167 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+var errOverloaded = goerr.New("overloaded", goerr.Tag(gollem.ErrTagTransient))
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &gollem.RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	gt.Equal(t, time.Second, policy.Delay(1))
+	gt.Equal(t, 2*time.Second, policy.Delay(2))
+	gt.Equal(t, 4*time.Second, policy.Delay(3))
+	gt.Equal(t, 5*time.Second, policy.Delay(4))
+	gt.Equal(t, 5*time.Second, policy.Delay(100))
+}
+
+func TestIsTransientError(t *testing.T) {
+	gt.True(t, gollem.IsTransientError(goerr.Wrap(errOverloaded, "failed to generate")))
+	gt.False(t, gollem.IsTransientError(errors.New("invalid request")))
+	gt.False(t, gollem.IsTransientError(goerr.Wrap(context.Canceled, "canceled", goerr.Tag(gollem.ErrTagTransient))))
+}
+
+func TestRetryPolicyInSession(t *testing.T) {
+	run := func(ctx context.Context, errs ...error) (int, error) {
+		calls := 0
+		cfg := gollem.NewSessionConfig()
+		handler := cfg.ContentBlockChain(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			calls++
+			if calls <= len(errs) {
+				return nil, errs[calls-1]
+			}
+			return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+		})
+		_, err := handler(ctx, &gollem.ContentRequest{})
+		return calls, err
+	}
+
+	var events []*gollem.RetryEvent
+	policy := &gollem.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		OnRetry: func(ctx context.Context, event *gollem.RetryEvent) {
+			events = append(events, event)
+		},
+	}
+	ctx := gollem.ContextWithRetryPolicy(t.Context(), policy)
+
+	t.Run("retried until success", func(t *testing.T) {
+		events = nil
+		calls, err := run(ctx, errOverloaded, errOverloaded)
+		gt.NoError(t, err)
+		gt.Equal(t, 3, calls)
+		gt.A(t, events).Length(2)
+		gt.Equal(t, 2, events[1].Attempt)
+		gt.Equal(t, 2*time.Millisecond, events[1].Delay)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		calls, err := run(ctx, errOverloaded, errOverloaded, errOverloaded)
+		gt.Error(t, err).Is(errOverloaded)
+		gt.Equal(t, 3, calls)
+	})
+
+	t.Run("not retriable", func(t *testing.T) {
+		invalid := errors.New("invalid request")
+		calls, err := run(ctx, invalid)
+		gt.Error(t, err).Is(invalid)
+		gt.Equal(t, 1, calls)
+	})
+
+	t.Run("no policy", func(t *testing.T) {
+		calls, err := run(t.Context(), errOverloaded)
+		gt.Error(t, err).Is(errOverloaded)
+		gt.Equal(t, 1, calls)
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		var cancel context.CancelFunc
+		ctx, cancel := context.WithCancel(gollem.ContextWithRetryPolicy(t.Context(), &gollem.RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Hour,
+			OnRetry: func(ctx context.Context, event *gollem.RetryEvent) {
+				cancel()
+			},
+		}))
+		defer cancel()
+		calls, err := run(ctx, errOverloaded)
+		gt.Error(t, err).Is(context.Canceled)
+		gt.Equal(t, 1, calls)
+	})
+
+	t.Run("middlewares of the session are retried and not changed", func(t *testing.T) {
+		var seen int
+		mw := func(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
+			return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+				seen++
+				return next(ctx, req)
+			}
+		}
+		cfg := gollem.NewSessionConfig(gollem.WithSessionContentBlockMiddleware(mw))
+		gt.A(t, cfg.ContentBlockMiddlewares()).Length(1)
+		gt.A(t, cfg.ContentStreamMiddlewares()).Length(0)
+
+		calls := 0
+		handler := cfg.ContentBlockChain(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+			calls++
+			if calls == 1 {
+				return nil, errOverloaded
+			}
+			return &gollem.ContentResponse{Texts: []string{"ok"}}, nil
+		})
+		_, err := handler(ctx, &gollem.ContentRequest{})
+		gt.NoError(t, err)
+		gt.Equal(t, 2, calls)
+		gt.Equal(t, 2, seen)
+	})
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	// Sessions of LLM clients apply the middlewares of the session config
+	calls := 0
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			handler := cfg.ContentBlockChain(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+				calls++
+				if calls == 1 {
+					return nil, errOverloaded
+				}
+				return &gollem.ContentResponse{Texts: []string{"done"}}, nil
+			})
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					resp, err := handler(ctx, &gollem.ContentRequest{Inputs: input})
+					if err != nil {
+						return nil, err
+					}
+					return &gollem.Response{Texts: resp.Texts}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	agent := gollem.New(client, gollem.WithRetryPolicy(&gollem.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+	resp, err := agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"done"}, resp.Texts)
+	gt.Equal(t, 2, calls)
+
+	t.Run("no retry by default", func(t *testing.T) {
+		calls = 0
+		_, err := gollem.New(client).Execute(t.Context(), gollem.Text("hello"))
+		gt.Error(t, err).Is(errOverloaded)
+	})
+}
@@ -27,6 +27,7 @@ type tagInfo struct {
 	minItems    *int
 	maxItems    *int
 	required    bool
+	sensitive   bool
 	ignore      bool
 }
 
@@ -45,6 +46,7 @@ type tagInfo struct {
 //   - minItems:"1" - Minimum array length
 //   - maxItems:"10" - Maximum array length
 //   - required:"true" - Mark field as required
+//   - sensitive:"true" - Mark field as sensitive to mask its value in logs and traces
 //
 // Example:
 //
@@ -214,6 +216,9 @@ func convertStruct(t reflect.Type, seen map[reflect.Type]bool) (*Parameter, erro
 		if tags.required {
 			fieldParam.Required = true
 		}
+		if tags.sensitive {
+			fieldParam.Sensitive = true
+		}
 
 		param.Properties[fieldName] = fieldParam
 	}
@@ -319,5 +324,14 @@ func parseTag(field reflect.StructField) (tagInfo, error) {
 		info.required = required
 	}
 
+	// Parse sensitive tag
+	if sensitiveTag := field.Tag.Get("sensitive"); sensitiveTag != "" {
+		sensitive, err := strconv.ParseBool(sensitiveTag)
+		if err != nil {
+			return info, goerr.Wrap(ErrInvalidTag, "invalid sensitive value", goerr.V("field", field.Name), goerr.V("value", sensitiveTag))
+		}
+		info.sensitive = sensitive
+	}
+
 	return info, nil
 }
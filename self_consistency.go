@@ -0,0 +1,249 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// SelfConsistencyAggregator chooses the response of an LLM call from the samples of
+// WithSelfConsistency. It may return one of the responses or a new response merging them.
+type SelfConsistencyAggregator func(responses []*Response) *Response
+
+type selfConsistencyConfig struct {
+	n           int
+	aggregator  SelfConsistencyAggregator
+	temperature *float64
+}
+
+// WithSelfConsistency generates n responses independently from the same history for each LLM
+// call of Execute, and continues with the response chosen by aggregator. Only the chosen
+// response is added to the session history; the samples are generated in temporary sessions.
+// If aggregator is nil, MajorityVote is used for JSON content type or a response schema, and
+// LongestResponse otherwise. Failed samples are ignored unless all of them fail. A value of n
+// less than 2 disables it. It cannot be used with ResponseModeStreaming.
+func WithSelfConsistency(n int, aggregator SelfConsistencyAggregator) Option {
+	return func(s *gollemConfig) {
+		cfg := selfConsistencyConfig{}
+		if s.selfConsistency != nil {
+			cfg = *s.selfConsistency
+		}
+		cfg.n = n
+		cfg.aggregator = aggregator
+		s.selfConsistency = &cfg
+	}
+}
+
+// WithSelfConsistencyTemperature sets the temperature of the samples of WithSelfConsistency,
+// e.g. a higher one to diversify the reasoning paths. Default is the temperature of the call.
+func WithSelfConsistencyTemperature(t float64) Option {
+	return func(s *gollemConfig) {
+		cfg := selfConsistencyConfig{}
+		if s.selfConsistency != nil {
+			cfg = *s.selfConsistency
+		}
+		cfg.temperature = &t
+		s.selfConsistency = &cfg
+	}
+}
+
+// enabled returns true if the samples are generated.
+func (x *selfConsistencyConfig) enabled() bool {
+	return x != nil && x.n >= 2
+}
+
+// MajorityVote is a SelfConsistencyAggregator choosing the most common answer, e.g. of
+// structured output. Answers are compared by the texts, with JSON canonicalized and spaces
+// around them trimmed, and by the names and arguments of the function calls. The earliest
+// response of the answer is returned, and ties go to the answer given earliest.
+func MajorityVote(responses []*Response) *Response {
+	keys := make([]string, len(responses))
+	counts := make(map[string]int)
+	for i, resp := range responses {
+		keys[i] = answerKey(resp)
+		counts[keys[i]]++
+	}
+
+	var best *Response
+	var bestCount int
+	for i, resp := range responses {
+		if counts[keys[i]] > bestCount {
+			best, bestCount = resp, counts[keys[i]]
+		}
+	}
+	return best
+}
+
+// LongestResponse is a SelfConsistencyAggregator choosing the response with the longest texts,
+// e.g. the most detailed one of free text answers. Ties go to the earliest response.
+func LongestResponse(responses []*Response) *Response {
+	var best *Response
+	bestLen := -1
+	for _, resp := range responses {
+		n := 0
+		for _, text := range resp.Texts {
+			n += len(text)
+		}
+		if n > bestLen {
+			best, bestLen = resp, n
+		}
+	}
+	return best
+}
+
+// answerKey returns the key of the answer of resp compared by MajorityVote.
+func answerKey(resp *Response) string {
+	text := strings.TrimSpace(strings.Join(resp.Texts, ""))
+	var v any
+	if err := json.Unmarshal([]byte(text), &v); err == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			text = string(canonical)
+		}
+	}
+
+	parts := []string{text}
+	for _, call := range resp.FunctionCalls {
+		args, _ := json.Marshal(call.Arguments)
+		parts = append(parts, call.Name+string(args))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// selfConsistencySample is a response generated in a temporary session.
+type selfConsistencySample struct {
+	session Session
+	resp    *Response
+	err     error
+}
+
+// generateSelfConsistent generates the samples of input from the history of the current
+// session, and adds the chosen one to the session.
+func (g *Agent) generateSelfConsistent(ctx context.Context, cfg *gollemConfig, logger *slog.Logger, toolList []Tool, input []Input, genOpts []GenerateOption) (*Response, error) {
+	sc := cfg.selfConsistency
+	history, err := g.currentSession.History()
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to get session history for self-consistency")
+	}
+	var base int
+	if history != nil {
+		base = len(history.Messages)
+	}
+	if sc.temperature != nil {
+		genOpts = append(slices.Clone(genOpts), WithTemperature(*sc.temperature))
+	}
+
+	samples := make([]*selfConsistencySample, sc.n)
+	var wg sync.WaitGroup
+	for i := range samples {
+		wg.Go(func() {
+			sessionOptions := cfg.sessionOptions(toolList)
+			if base > 0 {
+				sessionOptions = append(sessionOptions, WithSessionHistory(history.Clone()))
+			}
+			sample := &selfConsistencySample{}
+			samples[i] = sample
+
+			sample.session, sample.err = g.llm.NewSession(ctx, sessionOptions...)
+			if sample.err != nil {
+				return
+			}
+			sample.resp, sample.err = sample.session.Generate(ctx, input, genOpts...)
+		})
+	}
+	wg.Wait()
+
+	var responses []*Response
+	var firstErr error
+	for i, sample := range samples {
+		if sample.err != nil {
+			logger.Warn("self-consistency sample failed", "sample", i, "error", sample.err)
+			if firstErr == nil {
+				firstErr = sample.err
+			}
+			continue
+		}
+		RecordUsage(ctx, sample.resp)
+		responses = append(responses, sample.resp)
+	}
+	if len(responses) == 0 {
+		return nil, goerr.Wrap(firstErr, "all self-consistency samples failed", goerr.V("samples", sc.n))
+	}
+
+	aggregator := sc.aggregator
+	if aggregator == nil {
+		aggregator = LongestResponse
+		if cfg.contentType == ContentTypeJSON || cfg.responseSchema != nil {
+			aggregator = MajorityVote
+		}
+	}
+	chosen := aggregator(responses)
+	if chosen == nil {
+		return nil, goerr.New("self-consistency aggregator returned no response", goerr.V("samples", len(responses)))
+	}
+
+	added, err := selfConsistencyHistory(samples, chosen, base)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.currentSession.AppendHistory(added); err != nil {
+		return nil, goerr.Wrap(err, "failed to append chosen response to session history")
+	}
+	return chosen, nil
+}
+
+// selfConsistencyHistory returns the messages added by the sample of chosen after base. If
+// chosen is a merged response, the assistant message of a sample is replaced by chosen.
+func selfConsistencyHistory(samples []*selfConsistencySample, chosen *Response, base int) (*History, error) {
+	var source *selfConsistencySample
+	for _, sample := range samples {
+		if sample.err != nil {
+			continue
+		}
+		if source == nil || sample.resp == chosen {
+			source = sample
+		}
+	}
+
+	history, err := source.session.History()
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to get history of self-consistency sample")
+	}
+	if history == nil || len(history.Messages) < base {
+		return nil, goerr.New("history of self-consistency sample is shorter than the session")
+	}
+	added := &History{
+		LLType:   history.LLType,
+		Version:  history.Version,
+		Messages: slices.Clone(history.Messages[base:]),
+	}
+	if source.resp == chosen {
+		return added, nil
+	}
+
+	// The inputs are the same in all samples, only the response is replaced
+	for len(added.Messages) > 0 && added.Messages[len(added.Messages)-1].Role == RoleAssistant {
+		added.Messages = added.Messages[:len(added.Messages)-1]
+	}
+	var contents []MessageContent
+	if len(chosen.Texts) > 0 {
+		c, err := NewTextContent(strings.Join(chosen.Texts, "\n"))
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to marshal merged text content")
+		}
+		contents = append(contents, c)
+	}
+	for _, call := range chosen.FunctionCalls {
+		c, err := NewToolCallContent(call.ID, call.Name, call.Arguments)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to marshal merged tool call content", goerr.V("name", call.Name))
+		}
+		contents = append(contents, c)
+	}
+	added.Messages = append(added.Messages, Message{Role: RoleAssistant, Contents: contents})
+	return added, nil
+}
@@ -0,0 +1,243 @@
+package gollem_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// historyClient is a client whose sessions keep the history of their calls. answer is called
+// with the number of the call across all sessions.
+type historyClient struct {
+	answer func(n int) (*gollem.Response, error)
+
+	mu           sync.Mutex
+	calls        int
+	startLengths []int
+	temperatures []*float64
+}
+
+func (c *historyClient) client(t *testing.T) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			history := &gollem.History{Version: gollem.HistoryVersion}
+			if h := cfg.History(); h != nil {
+				history = h.Clone()
+			}
+			c.mu.Lock()
+			c.startLengths = append(c.startLengths, len(history.Messages))
+			c.mu.Unlock()
+
+			var mu sync.Mutex
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					genCfg := gollem.NewGenerateConfig(opts...)
+					c.mu.Lock()
+					n := c.calls
+					c.calls++
+					c.temperatures = append(c.temperatures, genCfg.Temperature())
+					c.mu.Unlock()
+
+					resp, err := c.answer(n)
+					if err != nil {
+						return nil, err
+					}
+
+					var texts []string
+					for _, in := range input {
+						texts = append(texts, in.String())
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					history.Messages = append(history.Messages,
+						textMessage(t, gollem.RoleUser, strings.Join(texts, "\n")),
+						textMessage(t, gollem.RoleAssistant, strings.Join(resp.Texts, "\n")),
+					)
+					return resp, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					return history.Clone(), nil
+				},
+				AppendHistoryFunc: func(h *gollem.History) error {
+					mu.Lock()
+					defer mu.Unlock()
+					history.Messages = append(history.Messages, h.Messages...)
+					return nil
+				},
+			}, nil
+		},
+	}
+}
+
+func textMessage(t *testing.T, role gollem.MessageRole, text string) gollem.Message {
+	content, err := gollem.NewTextContent(text)
+	gt.NoError(t, err)
+	return gollem.Message{Role: role, Contents: []gollem.MessageContent{content}}
+}
+
+func messageText(t *testing.T, msg gollem.Message) string {
+	var texts []string
+	for _, c := range msg.Contents {
+		text, err := c.GetTextContent()
+		gt.NoError(t, err)
+		texts = append(texts, text.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+func TestSelfConsistency(t *testing.T) {
+	texts := []string{"short", "the longest answer", "medium one"}
+	answerTexts := func(n int) (*gollem.Response, error) {
+		return &gollem.Response{Texts: []string{texts[n%3]}}, nil
+	}
+
+	t.Run("only the chosen response is added to the history", func(t *testing.T) {
+		hc := &historyClient{answer: answerTexts}
+		history, err := gollem.NewHistoryBuilder().User("hello").Assistant("hi").Build()
+		gt.NoError(t, err)
+		agent := gollem.New(hc.client(t),
+			gollem.WithHistory(history),
+			gollem.WithSelfConsistency(3, nil),
+		)
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("explain"))
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"the longest answer"}, resp.Texts)
+
+		// The main session and a session of each sample starting from the same history
+		gt.Equal(t, []int{2, 2, 2, 2}, hc.startLengths)
+
+		got, err := agent.Session().History()
+		gt.NoError(t, err)
+		gt.N(t, len(got.Messages)).GreaterOrEqual(4)
+		gt.Equal(t, "explain", messageText(t, got.Messages[2]))
+		gt.Equal(t, "the longest answer", messageText(t, got.Messages[3]))
+		for _, msg := range got.Messages {
+			text := messageText(t, msg)
+			gt.NotEqual(t, "short", text)
+			gt.NotEqual(t, "medium one", text)
+		}
+	})
+
+	t.Run("majority of structured output", func(t *testing.T) {
+		answers := []string{`{"a": 1, "b": 2}`, `{"a": 3}`, `{"b":2,"a":1}`}
+		hc := &historyClient{answer: func(n int) (*gollem.Response, error) {
+			return &gollem.Response{Texts: []string{answers[n%3]}}, nil
+		}}
+		agent := gollem.New(hc.client(t),
+			gollem.WithContentType(gollem.ContentTypeJSON),
+			gollem.WithSelfConsistency(3, nil),
+		)
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("extract"))
+		gt.NoError(t, err)
+		var v map[string]any
+		gt.NoError(t, json.Unmarshal([]byte(resp.Texts[0]), &v))
+		gt.Equal(t, map[string]any{"a": 1.0, "b": 2.0}, v)
+	})
+
+	t.Run("temperature override", func(t *testing.T) {
+		hc := &historyClient{answer: answerTexts}
+		agent := gollem.New(hc.client(t),
+			gollem.WithSelfConsistencyTemperature(0.9),
+			gollem.WithSelfConsistency(2, gollem.LongestResponse),
+		)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("explain"))
+		gt.NoError(t, err)
+		gt.A(t, hc.temperatures).Length(2)
+		for _, temp := range hc.temperatures {
+			gt.Equal(t, 0.9, *temp)
+		}
+	})
+
+	t.Run("merged response", func(t *testing.T) {
+		hc := &historyClient{answer: answerTexts}
+		merge := func(responses []*gollem.Response) *gollem.Response {
+			var all []string
+			for _, resp := range responses {
+				all = append(all, resp.Texts...)
+			}
+			return &gollem.Response{Texts: []string{"merged " + strings.Join(all, ",")}}
+		}
+		agent := gollem.New(hc.client(t), gollem.WithSelfConsistency(2, merge))
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("explain"))
+		gt.NoError(t, err)
+		gt.S(t, resp.Texts[0]).HasPrefix("merged ")
+
+		got, err := agent.Session().History()
+		gt.NoError(t, err)
+		gt.Equal(t, "explain", messageText(t, got.Messages[0]))
+		gt.Equal(t, resp.Texts[0], messageText(t, got.Messages[1]))
+	})
+
+	t.Run("failed samples are ignored", func(t *testing.T) {
+		hc := &historyClient{answer: func(n int) (*gollem.Response, error) {
+			if n == 0 {
+				return nil, errors.New("overloaded")
+			}
+			return &gollem.Response{Texts: []string{"ok"}}, nil
+		}}
+		agent := gollem.New(hc.client(t), gollem.WithSelfConsistency(3, nil))
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("explain"))
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"ok"}, resp.Texts)
+	})
+
+	t.Run("all samples failed", func(t *testing.T) {
+		hc := &historyClient{answer: func(n int) (*gollem.Response, error) {
+			return nil, errors.New("overloaded")
+		}}
+		agent := gollem.New(hc.client(t), gollem.WithSelfConsistency(3, nil))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("explain"))
+		gt.Error(t, err).Contains("overloaded")
+	})
+
+	t.Run("streaming is not supported", func(t *testing.T) {
+		hc := &historyClient{answer: answerTexts}
+		agent := gollem.New(hc.client(t),
+			gollem.WithResponseMode(gollem.ResponseModeStreaming),
+			gollem.WithSelfConsistency(3, nil),
+		)
+
+		_, err := agent.Execute(t.Context(), gollem.Text("explain"))
+		gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+	})
+}
+
+func TestMajorityVote(t *testing.T) {
+	a1 := &gollem.Response{Texts: []string{" yes "}}
+	b := &gollem.Response{Texts: []string{"no"}}
+	a2 := &gollem.Response{Texts: []string{"yes"}}
+	gt.Equal(t, a1, gollem.MajorityVote([]*gollem.Response{b, a1, a2}))
+
+	// Ties go to the earliest response
+	gt.Equal(t, b, gollem.MajorityVote([]*gollem.Response{b, a1}))
+
+	// Function calls are compared by name and arguments
+	call := func(args map[string]any) *gollem.Response {
+		return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{{Name: "search", Arguments: args}}}
+	}
+	c1, c2, c3 := call(map[string]any{"q": "go"}), call(map[string]any{"q": "rust"}), call(map[string]any{"q": "rust"})
+	gt.Equal(t, c2, gollem.MajorityVote([]*gollem.Response{c1, c2, c3}))
+}
+
+func TestLongestResponse(t *testing.T) {
+	short := &gollem.Response{Texts: []string{"a", "b"}}
+	long := &gollem.Response{Texts: []string{"abc"}}
+	gt.Equal(t, long, gollem.LongestResponse([]*gollem.Response{short, long}))
+	gt.Equal(t, short, gollem.LongestResponse([]*gollem.Response{short, {Texts: []string{"xy"}}}))
+}
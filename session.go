@@ -1,6 +1,9 @@
 package gollem
 
-import "context"
+import (
+	"context"
+	"slices"
+)
 
 // Session is a session for the LLM. It maintains conversation state across
 // multiple calls and can be used with the Agent (via Execute) or standalone
@@ -17,6 +20,11 @@ type Session interface {
 	// The channel is closed when the response is complete.
 	Stream(ctx context.Context, input []Input, opts ...GenerateOption) (<-chan *Response, error)
 
+	// StreamContent is Stream returning the response chunks as a Stream
+	// iterator, which can stop the generation with the consumer's error by
+	// closing the Stream.
+	StreamContent(ctx context.Context, input []Input, opts ...GenerateOption) (*Stream, error)
+
 	// Deprecated: Use Generate instead.
 	GenerateContent(ctx context.Context, input ...Input) (*Response, error)
 	// Deprecated: Use Stream instead.
@@ -38,6 +46,9 @@ type SessionConfig struct {
 	// Middleware fields (ToolMiddleware excluded - managed at Agent layer)
 	contentBlockMiddlewares  []ContentBlockMiddleware
 	contentStreamMiddlewares []ContentStreamMiddleware
+
+	// Defaults of generation parameters overriding those of the client
+	generateOptions []GenerateOption
 }
 
 // History returns the history of the session.
@@ -70,11 +81,32 @@ func (c *SessionConfig) ContentStreamMiddlewares() []ContentStreamMiddleware {
 	return c.contentStreamMiddlewares
 }
 
+// ContentBlockChain returns handler wrapped by the content block middlewares of the session and
+// by the retry of calls by the RetryPolicy of the context, which does nothing without it. LLM
+// client implementations build the chain of a call by it.
+func (c *SessionConfig) ContentBlockChain(handler ContentBlockHandler) ContentBlockHandler {
+	return retryContentBlockMiddleware(BuildContentBlockChain(c.contentBlockMiddlewares, handler))
+}
+
+// ContentStreamChain returns handler wrapped by the content stream middlewares of the session
+// and by the retry of starting streams by the RetryPolicy of the context, which does nothing
+// without it. LLM client implementations build the chain of a call by it.
+func (c *SessionConfig) ContentStreamChain(handler ContentStreamHandler) ContentStreamHandler {
+	return retryContentStreamMiddleware(BuildContentStreamChain(c.contentStreamMiddlewares, handler))
+}
+
 // ResponseSchema returns the response schema of the session.
 func (c *SessionConfig) ResponseSchema() *Parameter {
 	return c.responseSchema
 }
 
+// GenerateOptions returns the defaults of generation parameters of the session, such as
+// WithSessionTemperature. LLM client implementations apply them before the GenerateOption of
+// each call, so that per-call options take precedence.
+func (c *SessionConfig) GenerateOptions() []GenerateOption {
+	return slices.Clone(c.generateOptions)
+}
+
 // NewSessionConfig creates a new session configuration. This is required for only LLM client implementations.
 func NewSessionConfig(options ...SessionOption) SessionConfig {
 	cfg := SessionConfig{}
@@ -174,3 +206,65 @@ const (
 	// ContentTypeJSON represents JSON content.
 	ContentTypeJSON ContentType = "json"
 )
+
+// SessionResyncReason is the reason why a session rebuilt its state on the provider.
+type SessionResyncReason string
+
+const (
+	// SessionResyncExpired means the state on the provider expired.
+	SessionResyncExpired SessionResyncReason = "expired"
+	// SessionResyncNotFound means the provider did not find the state, e.g. it was deleted.
+	SessionResyncNotFound SessionResyncReason = "not_found"
+	// SessionResyncDiverged means the local history was changed, e.g. compacted by a middleware,
+	// and no longer matches the state on the provider.
+	SessionResyncDiverged SessionResyncReason = "diverged"
+)
+
+// SessionResyncEvent is recorded to the trace as a "session_resync" event when a session of a
+// provider keeping conversation state on its server rebuilds the state from the local history.
+type SessionResyncEvent struct {
+	Provider string              `json:"provider"`
+	Reason   SessionResyncReason `json:"reason"`
+	// Messages is the number of messages of the history in the rebuilt state
+	Messages int `json:"messages"`
+}
+
+// WithSessionTemperature sets the temperature of the LLM calls of the session, overriding the
+// temperature of the client.
+// Usage:
+// session, err := llmClient.NewSession(ctx, gollem.WithSessionTemperature(0.2))
+func WithSessionTemperature(t float64) SessionOption {
+	return func(cfg *SessionConfig) {
+		cfg.generateOptions = append(cfg.generateOptions, WithTemperature(t))
+	}
+}
+
+// WithSessionTopP sets the top-p of the LLM calls of the session, overriding the top-p of the
+// client.
+// Usage:
+// session, err := llmClient.NewSession(ctx, gollem.WithSessionTopP(0.9))
+func WithSessionTopP(p float64) SessionOption {
+	return func(cfg *SessionConfig) {
+		cfg.generateOptions = append(cfg.generateOptions, WithTopP(p))
+	}
+}
+
+// WithSessionMaxTokens sets the max tokens of the responses of the session, overriding the max
+// tokens of the client.
+// Usage:
+// session, err := llmClient.NewSession(ctx, gollem.WithSessionMaxTokens(1024))
+func WithSessionMaxTokens(n int) SessionOption {
+	return func(cfg *SessionConfig) {
+		cfg.generateOptions = append(cfg.generateOptions, WithMaxTokens(n))
+	}
+}
+
+// WithSessionStopSequences sets the sequences stopping the generation of the LLM calls of the
+// session.
+// Usage:
+// session, err := llmClient.NewSession(ctx, gollem.WithSessionStopSequences("\n\nObservation:"))
+func WithSessionStopSequences(sequences ...string) SessionOption {
+	return func(cfg *SessionConfig) {
+		cfg.generateOptions = append(cfg.generateOptions, WithStopSequences(sequences...))
+	}
+}
@@ -0,0 +1,248 @@
+package gollem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// DefaultSessionIdleTTL is the idle TTL of conversations without WithSessionManagerIdleTTL.
+const DefaultSessionIdleTTL = 30 * time.Minute
+
+// SessionManager serves many conversations concurrently, e.g. in a chatbot backend, with an
+// Agent per conversation keyed by a conversation ID. Agents are created on demand, load and
+// save their history with the HistoryRepository of WithSessionManagerRepository, and are
+// evicted after the idle TTL. Execute is safe for concurrent use; calls for the same
+// conversation run one at a time and calls for different conversations run in parallel.
+type SessionManager struct {
+	llm          LLMClient
+	agentOptions []Option
+	repo         HistoryRepository
+	idleTTL      time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*managedSession
+	nextSweep time.Time
+	sweeping  bool
+	sweeps    sync.WaitGroup
+}
+
+// managedSession is the agent of a conversation. mu serializes Execute of the conversation, and
+// active counts Execute calls running or waiting for mu to protect them from idle eviction.
+type managedSession struct {
+	mu       sync.Mutex
+	agent    *Agent
+	evicted  bool
+	active   int
+	lastUsed time.Time
+}
+
+// SessionManagerOption is an option of NewSessionManager.
+type SessionManagerOption func(*SessionManager)
+
+// WithSessionManagerAgentOptions sets the options of agents created for conversations, e.g.
+// tools and the system prompt. WithHistoryRepository is set by the manager and must not be
+// included.
+func WithSessionManagerAgentOptions(options ...Option) SessionManagerOption {
+	return func(m *SessionManager) {
+		m.agentOptions = append(m.agentOptions, options...)
+	}
+}
+
+// WithSessionManagerRepository sets the HistoryRepository of conversations. The conversation ID
+// is used as the session ID of the repository, so a conversation evicted or served by another
+// process continues from the saved history. Without it, the history of a conversation is lost
+// when it's evicted.
+func WithSessionManagerRepository(repo HistoryRepository) SessionManagerOption {
+	return func(m *SessionManager) {
+		m.repo = repo
+	}
+}
+
+// WithSessionManagerIdleTTL sets how long a conversation is kept in memory after its last
+// Execute. Zero keeps conversations until Evict or Close. The default is DefaultSessionIdleTTL.
+func WithSessionManagerIdleTTL(ttl time.Duration) SessionManagerOption {
+	return func(m *SessionManager) {
+		m.idleTTL = ttl
+	}
+}
+
+// NewSessionManager creates a SessionManager creating agents of conversations with llmClient.
+func NewSessionManager(llmClient LLMClient, options ...SessionManagerOption) *SessionManager {
+	m := &SessionManager{
+		llm:      llmClient,
+		idleTTL:  DefaultSessionIdleTTL,
+		sessions: make(map[string]*managedSession),
+	}
+	for _, opt := range options {
+		opt(m)
+	}
+	return m
+}
+
+// Execute runs Agent.Execute of the conversation identified by convID, creating the agent if
+// the conversation is not in memory. Idle conversations are evicted in background.
+func (m *SessionManager) Execute(ctx context.Context, convID string, input ...Input) (*ExecuteResponse, error) {
+	if convID == "" {
+		return nil, goerr.New("conversation ID is required")
+	}
+	m.sweepIdle(ctx)
+
+	for {
+		session := m.acquire(convID)
+		session.mu.Lock()
+		if session.evicted {
+			// Evicted while waiting; the next agent loads the history flushed by the eviction
+			session.mu.Unlock()
+			m.release(ctx, session)
+			continue
+		}
+
+		resp, err := session.agent.Execute(ctx, input...)
+		session.mu.Unlock()
+		m.release(ctx, session)
+		return resp, err
+	}
+}
+
+// acquire returns the session of convID, creating it if needed, and marks it active.
+func (m *SessionManager) acquire(convID string) *managedSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[convID]
+	if !ok {
+		options := append([]Option{}, m.agentOptions...)
+		if m.repo != nil {
+			options = append(options, WithHistoryRepository(m.repo, convID))
+		}
+		session = &managedSession{agent: New(m.llm, options...)}
+		m.sessions[convID] = session
+	}
+	session.active++
+	return session
+}
+
+func (m *SessionManager) release(ctx context.Context, session *managedSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.active--
+	session.lastUsed = Now(ctx)
+}
+
+// Evict flushes the history of the conversation to the repository and removes it from memory.
+// It waits for a running Execute of the conversation. It does nothing if the conversation is
+// not in memory.
+func (m *SessionManager) Evict(ctx context.Context, convID string) error {
+	m.mu.Lock()
+	session, ok := m.sessions[convID]
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return m.evict(ctx, convID, session, time.Time{})
+}
+
+// evict flushes and removes the session. With non-zero idleSince, the session is kept if it has
+// been used after idleSince or an Execute is waiting for it.
+func (m *SessionManager) evict(ctx context.Context, convID string, session *managedSession, idleSince time.Time) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	m.mu.Lock()
+	skip := session.evicted || (!idleSince.IsZero() && (session.active > 0 || session.lastUsed.After(idleSince)))
+	m.mu.Unlock()
+	if skip {
+		return nil
+	}
+
+	// The conversation is removed even if the flush fails, so a broken agent does not stay
+	err := session.agent.FlushHistory(ctx)
+
+	m.mu.Lock()
+	if m.sessions[convID] == session {
+		delete(m.sessions, convID)
+	}
+	session.evicted = true
+	m.mu.Unlock()
+
+	if err != nil {
+		return goerr.Wrap(err, "failed to flush history of evicted conversation", goerr.V("conversation_id", convID))
+	}
+	return nil
+}
+
+// sweepIdle starts evictIdle in a goroutine, at most once per half of the idle TTL and one at a
+// time, so that Execute does not wait for flushing histories of other conversations.
+func (m *SessionManager) sweepIdle(ctx context.Context) {
+	if m.idleTTL <= 0 {
+		return
+	}
+	now := Now(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sweeping || now.Before(m.nextSweep) {
+		return
+	}
+	m.sweeping = true
+	m.nextSweep = now.Add(m.idleTTL / 2)
+
+	m.sweeps.Add(1)
+	go func() {
+		defer m.sweeps.Done()
+		// The sweep is not a part of the Execute, so it's not canceled with it
+		m.evictIdle(context.WithoutCancel(ctx), now.Add(-m.idleTTL))
+
+		m.mu.Lock()
+		m.sweeping = false
+		m.mu.Unlock()
+	}()
+}
+
+// evictIdle evicts conversations not used after idleSince.
+func (m *SessionManager) evictIdle(ctx context.Context, idleSince time.Time) {
+	m.mu.Lock()
+	idle := make(map[string]*managedSession)
+	for convID, session := range m.sessions {
+		if session.active == 0 && !session.lastUsed.After(idleSince) {
+			idle[convID] = session
+		}
+	}
+	m.mu.Unlock()
+
+	for convID, session := range idle {
+		if err := m.evict(ctx, convID, session, idleSince); err != nil {
+			session.agent.logger.Error("failed to evict idle conversation", "error", err, "conversation_id", convID)
+		}
+	}
+}
+
+// Len returns the number of conversations in memory.
+func (m *SessionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Close evicts all conversations, e.g. on shutdown, and returns the first flush error. It waits
+// for evictions of idle conversations running in background.
+func (m *SessionManager) Close(ctx context.Context) error {
+	m.mu.Lock()
+	sessions := make(map[string]*managedSession, len(m.sessions))
+	for convID, session := range m.sessions {
+		sessions[convID] = session
+	}
+	m.mu.Unlock()
+
+	var firstErr error
+	for convID, session := range sessions {
+		if err := m.evict(ctx, convID, session, time.Time{}); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	m.sweeps.Wait()
+	return firstErr
+}
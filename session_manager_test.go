@@ -0,0 +1,240 @@
+package gollem_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// mapHistoryRepository is a HistoryRepository keeping histories by session ID, safe for
+// concurrent use.
+type mapHistoryRepository struct {
+	mu        sync.Mutex
+	histories map[string]*gollem.History
+}
+
+func (r *mapHistoryRepository) Load(ctx context.Context, sessionID string) (*gollem.History, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.histories[sessionID], nil
+}
+
+func (r *mapHistoryRepository) Save(ctx context.Context, sessionID string, history *gollem.History) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.histories == nil {
+		r.histories = make(map[string]*gollem.History)
+	}
+	r.histories[sessionID] = history
+	return nil
+}
+
+// blockingHistoryRepository is a mapHistoryRepository whose Save blocks until release is closed.
+type blockingHistoryRepository struct {
+	mapHistoryRepository
+	release chan struct{}
+}
+
+func (r *blockingHistoryRepository) Save(ctx context.Context, sessionID string, history *gollem.History) error {
+	<-r.release
+	return r.mapHistoryRepository.Save(ctx, sessionID, history)
+}
+
+// waitForLen waits until the manager has n conversations, because idle conversations are
+// evicted in background.
+func waitForLen(t *testing.T, manager *gollem.SessionManager, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for manager.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d conversations, but %d", n, manager.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newManagerTestClient returns a client of sessions answering the number of messages in the
+// history so far, which grows by one per Generate. It counts sessions created and fails if
+// Generate of a session runs concurrently.
+func newManagerTestClient(t *testing.T, created *atomic.Int32) *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			created.Add(1)
+			cfg := gollem.NewSessionConfig(options...)
+			var n int
+			if h := cfg.History(); h != nil {
+				n = len(h.Messages)
+			}
+			var running atomic.Int32
+
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					if running.Add(1) != 1 {
+						t.Error("Generate of a session runs concurrently")
+					}
+					defer running.Add(-1)
+					time.Sleep(time.Millisecond)
+					n++
+					return &gollem.Response{Texts: []string{fmt.Sprint(n)}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{Version: gollem.HistoryVersion, Messages: make([]gollem.Message, n)}, nil
+				},
+				AppendHistoryFunc: func(history *gollem.History) error { return nil },
+			}, nil
+		},
+	}
+}
+
+func TestSessionManager(t *testing.T) {
+	t.Run("conversations run concurrently with an agent each", func(t *testing.T) {
+		var created atomic.Int32
+		manager := gollem.NewSessionManager(newManagerTestClient(t, &created))
+
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Go(func() {
+				_, err := manager.Execute(t.Context(), fmt.Sprintf("conv-%d", i%4), gollem.Text("hello"))
+				gt.NoError(t, err)
+			})
+		}
+		wg.Wait()
+
+		gt.Equal(t, int32(4), created.Load())
+		gt.Equal(t, 4, manager.Len())
+
+		// Each conversation has received 5 messages
+		resp, err := manager.Execute(t.Context(), "conv-0", gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Has("6")
+	})
+
+	t.Run("evicted conversation continues from the repository", func(t *testing.T) {
+		var created atomic.Int32
+		repo := &mapHistoryRepository{}
+		manager := gollem.NewSessionManager(newManagerTestClient(t, &created),
+			gollem.WithSessionManagerRepository(repo),
+			gollem.WithSessionManagerAgentOptions(gollem.WithHistoryFlushPolicy(gollem.HistoryFlushOnExecute)),
+		)
+
+		for range 2 {
+			_, err := manager.Execute(t.Context(), "conv", gollem.Text("hello"))
+			gt.NoError(t, err)
+		}
+		gt.NoError(t, manager.Evict(t.Context(), "conv"))
+		gt.Equal(t, 0, manager.Len())
+		gt.NoError(t, manager.Evict(t.Context(), "conv"))
+
+		resp, err := manager.Execute(t.Context(), "conv", gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Has("3")
+		gt.Equal(t, int32(2), created.Load())
+	})
+
+	t.Run("idle conversations are evicted after TTL", func(t *testing.T) {
+		var created atomic.Int32
+		repo := &mapHistoryRepository{}
+		manager := gollem.NewSessionManager(newManagerTestClient(t, &created),
+			gollem.WithSessionManagerRepository(repo),
+			gollem.WithSessionManagerIdleTTL(time.Minute),
+		)
+
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		at := func(d time.Duration) context.Context {
+			return gollem.ContextWithClock(t.Context(), func() time.Time { return now.Add(d) })
+		}
+
+		_, err := manager.Execute(at(0), "idle", gollem.Text("hello"))
+		gt.NoError(t, err)
+		_, err = manager.Execute(at(50*time.Second), "active", gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.Equal(t, 2, manager.Len())
+
+		// Idle conversations are swept at most once per half of the TTL
+		_, err = manager.Execute(at(70*time.Second), "active", gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.Equal(t, 2, manager.Len())
+
+		// "idle" has been idle for the TTL, "active" has not
+		_, err = manager.Execute(at(110*time.Second), "active", gollem.Text("hello"))
+		gt.NoError(t, err)
+		waitForLen(t, manager, 1)
+
+		resp, err := manager.Execute(at(120*time.Second), "idle", gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Has("2")
+		gt.Equal(t, int32(3), created.Load())
+	})
+
+	t.Run("Execute does not wait for flushing idle conversations", func(t *testing.T) {
+		var created atomic.Int32
+		release := make(chan struct{})
+		repo := &blockingHistoryRepository{release: release}
+		manager := gollem.NewSessionManager(newManagerTestClient(t, &created),
+			gollem.WithSessionManagerRepository(repo),
+			gollem.WithSessionManagerIdleTTL(time.Minute),
+			gollem.WithSessionManagerAgentOptions(gollem.WithHistoryFlushPolicy(0)),
+		)
+
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		at := func(d time.Duration) context.Context {
+			return gollem.ContextWithClock(t.Context(), func() time.Time { return now.Add(d) })
+		}
+
+		_, err := manager.Execute(at(0), "idle", gollem.Text("hello"))
+		gt.NoError(t, err)
+
+		// The flush of "idle" is blocked until release is closed
+		done := make(chan error, 1)
+		go func() {
+			_, err := manager.Execute(at(2*time.Minute), "other", gollem.Text("hello"))
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			gt.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Execute waits for flushing the idle conversation")
+		}
+
+		close(release)
+		waitForLen(t, manager, 1)
+		gt.NoError(t, manager.Close(t.Context()))
+		gt.Equal(t, 0, manager.Len())
+	})
+
+	t.Run("zero TTL keeps conversations until Close", func(t *testing.T) {
+		var created atomic.Int32
+		repo := &mapHistoryRepository{}
+		manager := gollem.NewSessionManager(newManagerTestClient(t, &created),
+			gollem.WithSessionManagerRepository(repo),
+			gollem.WithSessionManagerIdleTTL(0),
+			gollem.WithSessionManagerAgentOptions(gollem.WithHistoryFlushPolicy(0)),
+		)
+
+		for _, d := range []time.Duration{0, 24 * time.Hour} {
+			ctx := gollem.ContextWithClock(t.Context(), func() time.Time { return time.Unix(0, 0).Add(d) })
+			_, err := manager.Execute(ctx, fmt.Sprintf("conv-%d", d), gollem.Text("hello"))
+			gt.NoError(t, err)
+		}
+		gt.Equal(t, 2, manager.Len())
+		gt.Equal(t, 0, len(repo.histories))
+
+		gt.NoError(t, manager.Close(t.Context()))
+		gt.Equal(t, 0, manager.Len())
+		gt.Equal(t, 2, len(repo.histories))
+	})
+
+	t.Run("conversation ID is required", func(t *testing.T) {
+		manager := gollem.NewSessionManager(&mock.LLMClientMock{})
+		_, err := manager.Execute(t.Context(), "", gollem.Text("hello"))
+		gt.Error(t, err)
+	})
+}
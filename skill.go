@@ -0,0 +1,106 @@
+package gollem
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// Skill is a reusable named capability combining prompt guidance and tools, e.g. "DNS
+// investigation" with guidance on how to investigate domains and DNS lookup tools. Packages can
+// provide skills to be attached to agents by WithSkills.
+type Skill struct {
+	// Name is the unique name of the skill.
+	Name string
+	// Description tells the LLM when the skill applies.
+	Description string
+	// Prompt is the guidance merged into the system prompt, e.g. steps and rules to follow.
+	Prompt string
+
+	// Tools and ToolSets are registered to the agent with the skill.
+	Tools    []Tool
+	ToolSets []ToolSet
+	// RequiredTools are names of tools the skill uses but does not provide. Execute fails with
+	// ErrInvalidSkill if the agent does not have them, by WithTools or another skill.
+	RequiredTools []string
+
+	// Examples are few-shot examples of the skill shown in the system prompt.
+	Examples []SkillExample
+}
+
+// SkillExample is a few-shot example of a Skill.
+type SkillExample struct {
+	Input  string
+	Output string
+}
+
+// WithSkills attaches skills to the agent. The tools of the skills are registered, and the name,
+// description, prompt and examples of the skills are appended to the system prompt in a
+// "Skills" section.
+func WithSkills(skills ...*Skill) Option {
+	return func(s *gollemConfig) {
+		s.skills = append(s.skills, skills...)
+	}
+}
+
+// applySkills registers tools of the skills and appends their guidance to the system prompt. It
+// must be called on a cloned config.
+func (c *gollemConfig) applySkills() error {
+	var names []string
+	for _, skill := range c.skills {
+		if skill.Name == "" {
+			return goerr.Wrap(ErrInvalidSkill, "skill name is empty")
+		}
+		if slices.Contains(names, skill.Name) {
+			return goerr.Wrap(ErrInvalidSkill, "skill name is duplicated", goerr.V("skill", skill.Name))
+		}
+		names = append(names, skill.Name)
+
+		c.tools = append(slices.Clip(c.tools), skill.Tools...)
+		c.toolSets = append(slices.Clip(c.toolSets), skill.ToolSets...)
+	}
+
+	if c.systemPrompt == "" {
+		c.systemPrompt = skillsPrompt(c.skills)
+	} else {
+		c.systemPrompt += "\n\n" + skillsPrompt(c.skills)
+	}
+	return nil
+}
+
+// checkSkillTools returns ErrInvalidSkill if a tool required by a skill is not in toolMap.
+func checkSkillTools(skills []*Skill, toolMap map[string]Tool) error {
+	for _, skill := range skills {
+		for _, name := range skill.RequiredTools {
+			if _, ok := toolMap[name]; !ok {
+				return goerr.Wrap(ErrInvalidSkill, "tool required by skill is not found",
+					goerr.V("skill", skill.Name),
+					goerr.V("tool", name))
+			}
+		}
+	}
+	return nil
+}
+
+// skillsPrompt builds the section of the system prompt describing the skills.
+func skillsPrompt(skills []*Skill) string {
+	var b strings.Builder
+	b.WriteString("# Skills\n\nYou have the following skills. When a request matches the description of a skill, follow its guidance.")
+	for _, skill := range skills {
+		b.WriteString("\n\n## " + skill.Name)
+		if skill.Description != "" {
+			b.WriteString("\n\n" + skill.Description)
+		}
+		if skill.Prompt != "" {
+			b.WriteString("\n\n" + strings.TrimSpace(skill.Prompt))
+		}
+		for i, example := range skill.Examples {
+			if i == 0 {
+				b.WriteString("\n\n### Examples")
+			}
+			b.WriteString("\n\nInput: " + example.Input + "\nOutput: " + example.Output)
+		}
+	}
+	return b.String()
+}
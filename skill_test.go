@@ -0,0 +1,77 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestWithSkills(t *testing.T) {
+	var sessionCfg gollem.SessionConfig
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			sessionCfg = gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+			}, nil
+		},
+	}
+
+	newTool := func(name string) gollem.Tool {
+		return &mockTool{
+			spec: gollem.ToolSpec{Name: name, Description: name},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				return map[string]any{}, nil
+			},
+		}
+	}
+	dns := &gollem.Skill{
+		Name:          "dns_investigation",
+		Description:   "Investigate a suspicious domain",
+		Prompt:        "Resolve the domain and check its WHOIS record before judging it.",
+		Tools:         []gollem.Tool{newTool("dns_lookup")},
+		RequiredTools: []string{"whois"},
+		Examples: []gollem.SkillExample{
+			{Input: "Is example.com malicious?", Output: "example.com is a reserved domain and not malicious."},
+		},
+	}
+
+	t.Run("tools and guidance are merged", func(t *testing.T) {
+		agent := gollem.New(client,
+			gollem.WithSystemPrompt("You are a security analyst."),
+			gollem.WithTools(newTool("whois")),
+			gollem.WithSkills(dns),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("check evil.example"))
+		gt.NoError(t, err)
+
+		prompt := sessionCfg.SystemPrompt()
+		gt.True(t, strings.HasPrefix(prompt, "You are a security analyst.\n\n# Skills"))
+		gt.True(t, strings.Contains(prompt, "## dns_investigation\n\nInvestigate a suspicious domain\n\nResolve the domain"))
+		gt.True(t, strings.Contains(prompt, "Input: Is example.com malicious?\nOutput: example.com is a reserved domain"))
+
+		var names []string
+		for _, tool := range sessionCfg.Tools() {
+			names = append(names, tool.Spec().Name)
+		}
+		gt.A(t, names).Has("dns_lookup").Has("whois")
+	})
+
+	t.Run("required tool is missing", func(t *testing.T) {
+		agent := gollem.New(client, gollem.WithSkills(dns))
+		_, err := agent.Execute(t.Context(), gollem.Text("check evil.example"))
+		gt.Error(t, err).Is(gollem.ErrInvalidSkill)
+	})
+
+	t.Run("duplicated skill name", func(t *testing.T) {
+		agent := gollem.New(client, gollem.WithTools(newTool("whois")), gollem.WithSkills(dns, &gollem.Skill{Name: "dns_investigation"}))
+		_, err := agent.Execute(t.Context(), gollem.Text("check evil.example"))
+		gt.Error(t, err).Is(gollem.ErrInvalidSkill)
+	})
+}
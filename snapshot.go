@@ -0,0 +1,202 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// Snapshot is a single bundle of agent state for debugging, like a core dump. It is created by
+// Agent.Snapshot on demand or automatically when Execute fails with WithSnapshot, and can be
+// pretty-printed by `gollem inspect`. Snapshots may contain prompts and tool results as is;
+// handle them as sensitive data.
+type Snapshot struct {
+	ID        string    `json:"id"`
+	ExecID    string    `json:"exec_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Error     string    `json:"error,omitempty"`
+
+	Versions SnapshotVersions `json:"versions"`
+	Config   SnapshotConfig   `json:"config"`
+
+	// Inputs of the Execute call and of the last LLM call in the Execute
+	Inputs     []string `json:"inputs,omitempty"`
+	LastInputs []string `json:"last_inputs,omitempty"`
+
+	History *History `json:"history,omitempty"`
+
+	// StrategyState is the state of a strategy implementing StrategySnapshotter, e.g. a plan
+	StrategyState any `json:"strategy_state,omitempty"`
+
+	// ToolCalls is the tool transcript of the Execute, recorded only with WithSnapshot
+	ToolCalls []SnapshotToolCall `json:"tool_calls,omitempty"`
+}
+
+// SnapshotVersions holds versions of the components that produced a Snapshot.
+type SnapshotVersions struct {
+	Go        string `json:"go"`
+	Gollem    string `json:"gollem,omitempty"`
+	LLMClient string `json:"llm_client"`
+}
+
+// SnapshotConfig is the agent configuration in a Snapshot.
+type SnapshotConfig struct {
+	SystemPrompt string          `json:"system_prompt,omitempty"`
+	LoopLimit    int             `json:"loop_limit"`
+	ResponseMode string          `json:"response_mode"`
+	ContentType  string          `json:"content_type,omitempty"`
+	Strategy     string          `json:"strategy,omitempty"`
+	ToolNames    []string        `json:"tool_names"`
+	Flags        map[string]bool `json:"flags,omitempty"`
+}
+
+// SnapshotToolCall is a tool call in a Snapshot.
+type SnapshotToolCall struct {
+	Name   string         `json:"name"`
+	Args   map[string]any `json:"args,omitempty"`
+	Result map[string]any `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// StrategySnapshotter is implemented by strategies that include their state in a Snapshot. The
+// returned value must be JSON-serializable and must not be modified after it is returned.
+type StrategySnapshotter interface {
+	SnapshotState() any
+}
+
+// WithSnapshot records the tool transcript of each Execute for snapshots, and saves a Snapshot
+// to repo when Execute fails. repo may be nil to only record for Agent.Snapshot. A failure to
+// save the snapshot is logged and does not change the error of Execute.
+func WithSnapshot(repo trace.SnapshotRepository) Option {
+	return func(s *gollemConfig) {
+		s.snapshot = &snapshotConfig{repo: repo}
+	}
+}
+
+type snapshotConfig struct {
+	repo trace.SnapshotRepository
+}
+
+// execRecord holds the state of the latest Execute for snapshots.
+type execRecord struct {
+	execID     string
+	inputs     []Input
+	lastInputs []Input
+	config     ConversationConfig
+	observer   *toolObserver
+	err        error
+}
+
+// Snapshot returns a Snapshot of the agent state at the end of the latest Execute, or of the
+// current state while Execute is running. Save it with trace.SnapshotRepository to share it.
+func (g *Agent) Snapshot(ctx context.Context) (*Snapshot, error) {
+	record := g.lastExec
+	if record == nil {
+		record = &execRecord{config: g.conversationConfig(g.tools)}
+	}
+
+	ctx = g.contextWithDeterminism(ctx)
+	snapshot := &Snapshot{
+		ID:        NewID(ctx),
+		ExecID:    record.execID,
+		CreatedAt: Now(ctx),
+		Versions: SnapshotVersions{
+			Go:        runtime.Version(),
+			Gollem:    gollemVersion(),
+			LLMClient: fmt.Sprintf("%T", g.llm),
+		},
+		Config: SnapshotConfig{
+			SystemPrompt: record.config.SystemPrompt,
+			LoopLimit:    record.config.LoopLimit,
+			ResponseMode: string(record.config.ResponseMode),
+			ContentType:  string(record.config.ContentType),
+			Strategy:     record.config.Strategy,
+			ToolNames:    record.config.ToolNames,
+			Flags:        record.config.Flags,
+		},
+		Inputs:     inputStrings(record.inputs),
+		LastInputs: inputStrings(record.lastInputs),
+	}
+	if record.err != nil {
+		snapshot.Error = record.err.Error()
+	}
+
+	if g.currentSession != nil {
+		history, err := g.currentSession.History()
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to get session history for snapshot")
+		}
+		snapshot.History = history
+	}
+
+	if s, ok := g.strategy.(StrategySnapshotter); ok {
+		snapshot.StrategyState = s.SnapshotState()
+	}
+
+	if record.observer != nil {
+		record.observer.mu.Lock()
+		for _, obs := range record.observer.observations {
+			call := SnapshotToolCall{Name: obs.name, Args: obs.args, Result: obs.result}
+			if obs.err != nil {
+				call.Error = obs.err.Error()
+			}
+			snapshot.ToolCalls = append(snapshot.ToolCalls, call)
+		}
+		record.observer.mu.Unlock()
+	}
+
+	return snapshot, nil
+}
+
+// saveErrorSnapshot saves a Snapshot of the failed Execute to the configured repository.
+func (g *Agent) saveErrorSnapshot(ctx context.Context, cfg *gollemConfig) {
+	snapshot, err := g.Snapshot(ctx)
+	if err != nil {
+		cfg.logger.Warn("failed to create snapshot", "error", err)
+		return
+	}
+	if err := cfg.snapshot.repo.SaveSnapshot(ctx, snapshot.ID, snapshot); err != nil {
+		cfg.logger.Warn("failed to save snapshot", "error", err, "snapshot_id", snapshot.ID)
+		return
+	}
+	cfg.logger.Info("snapshot saved", "snapshot_id", snapshot.ID)
+
+	if th := trace.HandlerFrom(ctx); th != nil {
+		th.AddEvent(ctx, "snapshot", map[string]string{"snapshot_id": snapshot.ID})
+	}
+}
+
+func inputStrings(inputs []Input) []string {
+	if len(inputs) == 0 {
+		return nil
+	}
+	result := make([]string, len(inputs))
+	for i, input := range inputs {
+		result[i] = input.String()
+	}
+	return result
+}
+
+// gollemVersion returns the module version of gollem in the running binary.
+func gollemVersion() string {
+	const modulePath = "github.com/m-mizutani/gollem"
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return ""
+}
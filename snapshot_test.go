@@ -0,0 +1,121 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+type snapshotRepoMock struct {
+	snapshots map[string]any
+}
+
+func (r *snapshotRepoMock) SaveSnapshot(ctx context.Context, id string, snapshot any) error {
+	r.snapshots[id] = snapshot
+	return nil
+}
+
+var _ trace.SnapshotRepository = (*snapshotRepoMock)(nil)
+
+func TestSnapshot(t *testing.T) {
+	newClient := func(genErr error) *mock.LLMClientMock {
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				var calls int
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						calls++
+						if calls == 1 {
+							return &gollem.Response{
+								FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "random_number", Arguments: map[string]any{"min": 1.0, "max": 10.0}}},
+							}, nil
+						}
+						if genErr != nil {
+							return nil, genErr
+						}
+						return &gollem.Response{Texts: []string{"the number is 5"}}, nil
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return &gollem.History{Version: gollem.HistoryVersion}, nil
+					},
+					AppendHistoryFunc: func(*gollem.History) error { return nil },
+				}, nil
+			},
+		}
+	}
+
+	t.Run("snapshot is saved when Execute fails", func(t *testing.T) {
+		repo := &snapshotRepoMock{snapshots: map[string]any{}}
+		agent := gollem.New(newClient(errors.New("service unavailable")),
+			gollem.WithTools(&RandomNumberTool{}),
+			gollem.WithSystemPrompt("be helpful"),
+			gollem.WithSnapshot(repo),
+		)
+
+		_, err := agent.Execute(context.Background(), gollem.Text("pick a number"))
+		gt.Error(t, err)
+		gt.Equal(t, 1, len(repo.snapshots))
+
+		for id, v := range repo.snapshots {
+			snapshot, ok := v.(*gollem.Snapshot)
+			gt.True(t, ok)
+			gt.Equal(t, id, snapshot.ID)
+			gt.True(t, snapshot.ExecID != "")
+			gt.S(t, snapshot.Error).Contains("service unavailable")
+			gt.Equal(t, "be helpful", snapshot.Config.SystemPrompt)
+			gt.Equal(t, []string{"random_number"}, snapshot.Config.ToolNames)
+			gt.Equal(t, []string{"pick a number"}, snapshot.Inputs)
+			gt.A(t, snapshot.LastInputs).Length(1)
+			gt.NotNil(t, snapshot.History)
+			gt.Equal(t, "*mock.LLMClientMock", snapshot.Versions.LLMClient)
+			gt.A(t, snapshot.ToolCalls).Length(1).At(0, func(t testing.TB, v gollem.SnapshotToolCall) {
+				gt.Equal(t, "random_number", v.Name)
+				gt.Equal(t, "", v.Error)
+			})
+		}
+	})
+
+	t.Run("snapshot is not saved when Execute succeeds", func(t *testing.T) {
+		repo := &snapshotRepoMock{snapshots: map[string]any{}}
+		agent := gollem.New(newClient(nil),
+			gollem.WithTools(&RandomNumberTool{}),
+			gollem.WithSnapshot(repo),
+		)
+
+		_, err := agent.Execute(context.Background(), gollem.Text("pick a number"))
+		gt.NoError(t, err)
+		gt.Equal(t, 0, len(repo.snapshots))
+
+		// on demand
+		snapshot, err := agent.Snapshot(context.Background())
+		gt.NoError(t, err)
+		gt.Equal(t, "", snapshot.Error)
+		gt.A(t, snapshot.ToolCalls).Length(1)
+	})
+
+	t.Run("tool calls are not recorded without WithSnapshot", func(t *testing.T) {
+		agent := gollem.New(newClient(nil), gollem.WithTools(&RandomNumberTool{}))
+
+		_, err := agent.Execute(context.Background(), gollem.Text("pick a number"))
+		gt.NoError(t, err)
+
+		snapshot, err := agent.Snapshot(context.Background())
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"pick a number"}, snapshot.Inputs)
+		gt.A(t, snapshot.ToolCalls).Length(0)
+	})
+
+	t.Run("snapshot before Execute", func(t *testing.T) {
+		agent := gollem.New(newClient(nil), gollem.WithTools(&RandomNumberTool{}))
+		snapshot, err := agent.Snapshot(context.Background())
+		gt.NoError(t, err)
+		gt.Equal(t, "", snapshot.ExecID)
+		gt.Nil(t, snapshot.History)
+		gt.Equal(t, []string{"random_number"}, snapshot.Config.ToolNames)
+	})
+}
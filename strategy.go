@@ -35,6 +35,14 @@ type StrategyState struct {
 	// These are available for strategies that need context-aware planning
 	SystemPrompt string   // User's system prompt from gollem.WithSystemPrompt
 	History      *History // Conversation history from gollem.WithHistory
+
+	// Usage tracks the token usage of the current Execute, including the LLM calls the
+	// strategy makes with the ctx of Handle, by phase.
+	Usage *UsageTracker
+
+	// GenerateOptions may be set by Strategy.Handle to configure the LLM call for the
+	// returned inputs, e.g. WithToolChoice for a specific step.
+	GenerateOptions []GenerateOption
 }
 
 // defaultStrategy implements the default simple loop strategy
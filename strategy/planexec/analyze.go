@@ -5,8 +5,6 @@ import (
 	"encoding/json"
 	"strings"
 
-	"github.com/google/uuid"
-
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 )
@@ -65,10 +63,14 @@ func generatePlanInternal(ctx context.Context, client gollem.LLMClient, inputs [
 	planPrompt := buildPlanPrompt(ctx, inputs, tools)
 
 	// Generate plan using LLM
+	if err := gollem.CheckBudget(ctx); err != nil {
+		return nil, err
+	}
 	response, err := session.Generate(ctx, planPrompt)
 	if err != nil {
 		return nil, goerr.Wrap(err, "failed to generate plan")
 	}
+	gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhasePlan), response)
 
 	// Parse the response to extract plan
 	plan, err := parsePlanFromResponse(ctx, response)
@@ -111,6 +113,8 @@ func parsePlanFromResponse(ctx context.Context, response *gollem.Response) (*Pla
 		Constraints    string `json:"constraints"`
 		Tasks          []struct {
 			Description string `json:"description"`
+			Priority    int    `json:"priority"`
+			Effort      int    `json:"effort"`
 		} `json:"tasks"`
 	}
 
@@ -137,9 +141,11 @@ func parsePlanFromResponse(ctx context.Context, response *gollem.Response) (*Pla
 
 	for i, t := range planResponse.Tasks {
 		plan.Tasks[i] = Task{
-			ID:          uuid.New().String(),
+			ID:          gollem.NewID(ctx),
 			Description: t.Description,
 			State:       TaskStatePending,
+			Priority:    max(t.Priority, 0),
+			Effort:      max(t.Effort, 0),
 		}
 	}
 
@@ -0,0 +1,148 @@
+package planexec
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// ApprovalAction is the action of an ApprovalDecision.
+type ApprovalAction string
+
+const (
+	// ApprovalApprove executes the task as is
+	ApprovalApprove ApprovalAction = "approve"
+	// ApprovalDeny skips the task without executing it
+	ApprovalDeny ApprovalAction = "deny"
+	// ApprovalModify executes the task with a new description
+	ApprovalModify ApprovalAction = "modify"
+)
+
+// ApprovalDecision is the decision of a TaskApprovalHook.
+type ApprovalDecision struct {
+	Action ApprovalAction
+	// Description is the new task description for ApprovalModify
+	Description string
+	// Reason is why the task is denied or modified. It is given to reflection in the result of
+	// the task: of the skipped task for ApprovalDeny, and with the original description of the
+	// executed task for ApprovalModify.
+	Reason string
+}
+
+// Approve returns a decision to execute the task as is.
+func Approve() ApprovalDecision {
+	return ApprovalDecision{Action: ApprovalApprove}
+}
+
+// Deny returns a decision to skip the task for reason.
+func Deny(reason string) ApprovalDecision {
+	return ApprovalDecision{Action: ApprovalDeny, Reason: reason}
+}
+
+// Modify returns a decision to execute the task with description instead.
+func Modify(description, reason string) ApprovalDecision {
+	return ApprovalDecision{Action: ApprovalModify, Description: description, Reason: reason}
+}
+
+// TaskApprovalHook is called before each task is executed to approve, deny or modify it. plan
+// and task must not be modified by the hook; return ApprovalModify to change the task.
+type TaskApprovalHook func(ctx context.Context, plan *Plan, task *Task) (ApprovalDecision, error)
+
+// TaskApprovalEvent is recorded when a task is denied or modified by the approval hook.
+type TaskApprovalEvent struct {
+	TaskID      string `json:"task_id"`
+	Action      string `json:"action"`
+	Description string `json:"description"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// WithPlanTaskApprovalHook sets a hook that approves each task before any tool of the task runs,
+// for human-in-the-loop workflows. A denied task is skipped and a modified task is executed with
+// the new description. After a denial, reflection updates the remaining plan with the reason, so
+// that tasks depending on the denied one are skipped or replaced. Denied tasks count toward
+// WithMaxIterations. The hook is not called in dry-run mode.
+func WithPlanTaskApprovalHook(hook TaskApprovalHook) Option {
+	return func(s *Strategy) {
+		s.approvalHook = hook
+	}
+}
+
+// approveTask asks the approval hook whether the current task can be executed. It returns
+// false if the task is denied, after skipping it and reflecting on the denial.
+func (s *Strategy) approveTask(ctx context.Context, state *gollem.StrategyState) (bool, error) {
+	if s.approvalHook == nil {
+		return true, nil
+	}
+
+	task := s.currentTask
+	decision, err := s.approvalHook(ctx, clonePlan(s.plan), new(*task))
+	if err != nil {
+		return false, goerr.Wrap(err, "task approval hook failed", goerr.V("task_id", task.ID))
+	}
+
+	switch decision.Action {
+	case ApprovalApprove:
+		return true, nil
+
+	case ApprovalModify:
+		if decision.Description == "" {
+			return false, goerr.New("description is required to modify task", goerr.V("task_id", task.ID))
+		}
+		s.approvalNote = fmt.Sprintf("This task was modified by the user before execution. Original description: %s", task.Description)
+		if decision.Reason != "" {
+			s.approvalNote += "\nReason: " + decision.Reason
+		}
+		task.Description = decision.Description
+		s.recordApproval(ctx, task, decision)
+		if s.hooks != nil {
+			if err := s.hooks.OnPlanUpdated(ctx, s.plan); err != nil {
+				return false, goerr.Wrap(err, "hook OnPlanUpdated failed")
+			}
+		}
+		s.notifyProgress()
+		return true, nil
+
+	case ApprovalDeny:
+		task.State = TaskStateSkipped
+		task.SkipReason = "Denied by user"
+		if decision.Reason != "" {
+			task.SkipReason += ": " + decision.Reason
+		}
+		task.Result = "This task was denied by the user and was not executed. " + task.SkipReason
+		s.taskIterationCount++
+		s.recordApproval(ctx, task, decision)
+		s.notifyProgress()
+
+		if s.taskIterationCount >= s.maxIterations {
+			return false, nil
+		}
+
+		// Let reflection keep the remaining plan consistent with the denial
+		reflectionResult, err := reflect(ctx, s.client, s.plan, task, state.Tools, s.middleware, s.taskIterationCount, s.maxIterations, s.contextHistory(state), state.SystemPrompt)
+		if err != nil {
+			return false, goerr.Wrap(err, "reflection failed")
+		}
+		if err := s.applyReflection(ctx, reflectionResult); err != nil {
+			return false, err
+		}
+		return false, nil
+
+	default:
+		return false, goerr.New("unknown approval action", goerr.V("action", decision.Action), goerr.V("task_id", task.ID))
+	}
+}
+
+// recordApproval records a TaskApprovalEvent to the trace.
+func (s *Strategy) recordApproval(ctx context.Context, task *Task, decision ApprovalDecision) {
+	if rec := trace.HandlerFrom(ctx); rec != nil {
+		rec.AddEvent(ctx, "task_approval", &TaskApprovalEvent{
+			TaskID:      task.ID,
+			Action:      string(decision.Action),
+			Description: task.Description,
+			Reason:      decision.Reason,
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package planexec_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPlanTaskApprovalHook(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Clean up the server",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "List old log files", State: planexec.TaskStatePending},
+			{ID: "task-2", Description: "Delete all log files", State: planexec.TaskStatePending},
+			{ID: "task-3", Description: "Restart the server", State: planexec.TaskStatePending},
+		},
+	}
+
+	var executed []string
+	var reflectionPrompts []string
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					text := string(input[0].(gollem.Text))
+					switch {
+					case strings.Contains(text, "# Task Execution"):
+						executed = append(executed, text)
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					case strings.Contains(text, "# Task Reflection"):
+						reflectionPrompts = append(reflectionPrompts, text)
+						if strings.Contains(text, "denied by the user") {
+							return &gollem.Response{Texts: []string{`{"new_tasks": ["Reload the server config"], "updated_tasks": [], "reason": "restart was denied"}`}}, nil
+						}
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "on track"}`}}, nil
+					default:
+						return &gollem.Response{Texts: []string{"conclusion"}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	var asked []string
+	strategy := planexec.New(mockClient,
+		planexec.WithPlan(plan),
+		planexec.WithPlanTaskApprovalHook(func(ctx context.Context, plan *planexec.Plan, task *planexec.Task) (planexec.ApprovalDecision, error) {
+			asked = append(asked, task.Description)
+			switch task.ID {
+			case "task-2":
+				return planexec.Modify("Delete log files older than 30 days", "keep recent logs"), nil
+			case "task-3":
+				return planexec.Deny("not in maintenance window"), nil
+			default:
+				return planexec.Approve(), nil
+			}
+		}),
+	)
+	agent := gollem.New(mockClient, gollem.WithStrategy(strategy))
+	_, err := agent.Execute(context.Background(), gollem.Text("Clean up the server"))
+	gt.NoError(t, err)
+
+	gt.Equal(t, []string{
+		"List old log files",
+		"Delete all log files",
+		"Restart the server",
+		"Reload the server config",
+	}, asked)
+
+	// the denied task is not executed and the modified task is executed with the new description
+	gt.A(t, executed).Length(3)
+	gt.True(t, strings.Contains(executed[1], "Delete log files older than 30 days"))
+
+	result := strategy.Plan()
+	gt.Equal(t, "Delete log files older than 30 days", result.Tasks[1].Description)
+	gt.Equal(t, planexec.TaskStateSkipped, result.Tasks[2].State)
+	gt.Equal(t, "Denied by user: not in maintenance window", result.Tasks[2].SkipReason)
+	gt.Equal(t, planexec.TaskStateCompleted, result.Tasks[3].State)
+
+	// the modification and the denial are reflected
+	gt.A(t, reflectionPrompts).Length(4)
+	gt.True(t, strings.Contains(reflectionPrompts[1], "Original description: Delete all log files"))
+	gt.True(t, strings.Contains(reflectionPrompts[1], "keep recent logs"))
+	gt.True(t, strings.Contains(reflectionPrompts[2], "not in maintenance window"))
+}
@@ -0,0 +1,331 @@
+package planexec
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// DefaultMaxActiveTasks is the default number of tasks a Coordinator runs at the same time
+const DefaultMaxActiveTasks = 4
+
+// ErrToolBudgetExhausted is returned to the LLM as a tool error when the tool budget shared by
+// the plans of a Coordinator is used up.
+var ErrToolBudgetExhausted = errors.New("tool budget exhausted")
+
+// PlanStatus is the status of a plan run by a Coordinator
+type PlanStatus string
+
+const (
+	PlanStatusPlanning PlanStatus = "planning"
+	PlanStatusRunning  PlanStatus = "running"
+)
+
+// Coordinator runs several plan-and-execute executions at the same time, e.g. research tasks
+// of many users in a service. The plans share a limit of concurrently running tasks, scheduled
+// first-come first-served so that a plan with many tasks does not starve the others, and a budget
+// of tool calls. To share an LLM rate limit, pass a middleware such as governor's with
+// WithCoordinatorMiddleware.
+type Coordinator struct {
+	client          gollem.LLMClient
+	maxActiveTasks  int
+	toolBudget      int
+	middleware      []gollem.ContentBlockMiddleware
+	agentOptions    []gollem.Option
+	strategyOptions []Option
+
+	mu       sync.Mutex
+	runs     map[string]*coordinatedPlan
+	order    []string
+	active   int
+	waiters  []chan struct{}
+	toolUsed int
+	finished int
+	failed   int
+}
+
+// coordinatedPlan is the state of a plan being run by a Coordinator
+type coordinatedPlan struct {
+	status PlanStatus
+	plan   *Plan // copy updated by the strategy
+}
+
+// CoordinatorOption is a functional option for configuring Coordinator
+type CoordinatorOption func(*Coordinator)
+
+// WithCoordinatorMaxActiveTasks sets the number of tasks run at the same time across all plans
+// (default: DefaultMaxActiveTasks). 0 or less means unlimited.
+func WithCoordinatorMaxActiveTasks(n int) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.maxActiveTasks = n
+	}
+}
+
+// WithCoordinatorToolBudget sets the number of tool calls allowed across all plans. After the
+// budget is used up, tool calls fail with ErrToolBudgetExhausted. 0 or less means unlimited
+// (default).
+func WithCoordinatorToolBudget(n int) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.toolBudget = n
+	}
+}
+
+// WithCoordinatorMiddleware adds content block middleware to all LLM calls of the plans,
+// including planning, reflection and conclusion.
+func WithCoordinatorMiddleware(middleware ...gollem.ContentBlockMiddleware) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// WithCoordinatorAgentOptions sets options of the agent created for each plan, e.g. tools and
+// system prompt.
+func WithCoordinatorAgentOptions(options ...gollem.Option) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.agentOptions = append(c.agentOptions, options...)
+	}
+}
+
+// WithCoordinatorStrategyOptions sets options of the strategy created for each plan.
+func WithCoordinatorStrategyOptions(options ...Option) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.strategyOptions = append(c.strategyOptions, options...)
+	}
+}
+
+// NewCoordinator creates a new Coordinator
+func NewCoordinator(client gollem.LLMClient, opts ...CoordinatorOption) *Coordinator {
+	c := &Coordinator{
+		client:         client,
+		maxActiveTasks: DefaultMaxActiveTasks,
+		runs:           map[string]*coordinatedPlan{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Run plans and executes inputs as the plan identified by id, and blocks until it finishes.
+// Call it from a goroutine per plan to run plans concurrently. id must be unique among running
+// plans.
+func (c *Coordinator) Run(ctx context.Context, id string, inputs ...gollem.Input) (*gollem.ExecuteResponse, error) {
+	c.mu.Lock()
+	if _, exists := c.runs[id]; exists {
+		c.mu.Unlock()
+		return nil, goerr.New("plan is already running", goerr.V("id", id))
+	}
+	run := &coordinatedPlan{status: PlanStatusPlanning}
+	c.runs[id] = run
+	c.order = append(c.order, id)
+	c.mu.Unlock()
+
+	strategyOptions := append(slices.Clip(c.strategyOptions), WithMiddleware(c.middleware...))
+	strategy := New(c.client, strategyOptions...)
+	strategy.coordinator = c
+	strategy.observer = func(plan *Plan) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		run.status = PlanStatusRunning
+		run.plan = plan
+	}
+	defer strategy.releaseTaskSlot()
+
+	agentOptions := append(slices.Clip(c.agentOptions),
+		gollem.WithStrategy(strategy),
+		gollem.WithToolMiddleware(c.toolBudgetMiddleware()),
+	)
+	for _, mw := range c.middleware {
+		agentOptions = append(agentOptions, gollem.WithContentBlockMiddleware(mw))
+	}
+
+	resp, err := gollem.New(c.client, agentOptions...).Execute(ctx, inputs...)
+
+	c.mu.Lock()
+	delete(c.runs, id)
+	c.order = slices.DeleteFunc(c.order, func(v string) bool { return v == id })
+	if err != nil {
+		c.failed++
+	} else {
+		c.finished++
+	}
+	c.mu.Unlock()
+
+	return resp, err
+}
+
+// CoordinatorProgress is the aggregate progress of a Coordinator, returned by Progress.
+type CoordinatorProgress struct {
+	// Plans is the progress of running plans in the order they started
+	Plans []PlanProgress
+
+	// TotalTasks, CompletedTasks and SkippedTasks are the sums over running plans
+	TotalTasks     int
+	CompletedTasks int
+	SkippedTasks   int
+	// ActiveTasks is the number of tasks being executed, and WaitingPlans is the number of plans
+	// waiting for a task slot
+	ActiveTasks  int
+	WaitingPlans int
+
+	// ToolCalls is the number of tool calls made, and ToolBudget is the limit (0 means unlimited)
+	ToolCalls  int
+	ToolBudget int
+
+	// FinishedPlans and FailedPlans are the number of plans that have finished with and without
+	// error
+	FinishedPlans int
+	FailedPlans   int
+}
+
+// PlanProgress is the progress of a plan run by a Coordinator.
+type PlanProgress struct {
+	ID     string
+	Status PlanStatus
+	// Plan is a copy of the current plan, or nil while planning
+	Plan *Plan
+
+	TotalTasks     int
+	CompletedTasks int
+	SkippedTasks   int
+}
+
+// Progress returns the current progress of all plans. It is safe to call concurrently with Run.
+func (c *Coordinator) Progress() *CoordinatorProgress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	progress := &CoordinatorProgress{
+		ActiveTasks:   c.active,
+		WaitingPlans:  len(c.waiters),
+		ToolCalls:     c.toolUsed,
+		ToolBudget:    max(c.toolBudget, 0),
+		FinishedPlans: c.finished,
+		FailedPlans:   c.failed,
+	}
+
+	for _, id := range c.order {
+		run := c.runs[id]
+		p := PlanProgress{ID: id, Status: run.status}
+		if run.plan != nil {
+			p.Plan = clonePlan(run.plan)
+			p.TotalTasks = len(run.plan.Tasks)
+			for _, task := range run.plan.Tasks {
+				switch task.State {
+				case TaskStateCompleted:
+					p.CompletedTasks++
+				case TaskStateSkipped:
+					p.SkippedTasks++
+				}
+			}
+		}
+
+		progress.Plans = append(progress.Plans, p)
+		progress.TotalTasks += p.TotalTasks
+		progress.CompletedTasks += p.CompletedTasks
+		progress.SkippedTasks += p.SkippedTasks
+	}
+
+	return progress
+}
+
+// acquire waits for a task slot. Waiting plans get slots in arrival order; since a plan waits
+// for one task at a time, plans take turns.
+func (c *Coordinator) acquire(ctx context.Context) error {
+	c.mu.Lock()
+	if c.maxActiveTasks <= 0 || (c.active < c.maxActiveTasks && len(c.waiters) == 0) {
+		c.active++
+		c.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	c.waiters = append(c.waiters, ch)
+	c.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		if i := slices.Index(c.waiters, ch); i >= 0 {
+			c.waiters = slices.Delete(c.waiters, i, i+1)
+			c.mu.Unlock()
+			return goerr.Wrap(ctx.Err(), "canceled while waiting for task slot")
+		}
+		c.mu.Unlock()
+		// The slot was handed over while canceling, so give it back
+		c.release()
+		return goerr.Wrap(ctx.Err(), "canceled while waiting for task slot")
+	}
+}
+
+// release returns a task slot, handing it over to the first waiting plan if any.
+func (c *Coordinator) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.waiters) > 0 {
+		ch := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		close(ch)
+		return
+	}
+	c.active--
+}
+
+// toolBudgetMiddleware counts tool calls of all plans against the tool budget.
+func (c *Coordinator) toolBudgetMiddleware() gollem.ToolMiddleware {
+	return func(next gollem.ToolHandler) gollem.ToolHandler {
+		return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+			c.mu.Lock()
+			if c.toolBudget > 0 && c.toolUsed >= c.toolBudget {
+				c.mu.Unlock()
+				return &gollem.ToolExecResponse{
+					Error: goerr.Wrap(ErrToolBudgetExhausted, "tool call rejected",
+						goerr.V("tool", req.Tool.Name),
+						goerr.V("budget", c.toolBudget)),
+				}, nil
+			}
+			c.toolUsed++
+			c.mu.Unlock()
+
+			return next(ctx, req)
+		}
+	}
+}
+
+// acquireTaskSlot waits for a task slot of the coordinator, if any.
+func (s *Strategy) acquireTaskSlot(ctx context.Context) error {
+	if s.coordinator == nil || s.holdingSlot {
+		return nil
+	}
+	if err := s.coordinator.acquire(ctx); err != nil {
+		return err
+	}
+	s.holdingSlot = true
+	return nil
+}
+
+// releaseTaskSlot returns the task slot to the coordinator, if held.
+func (s *Strategy) releaseTaskSlot() {
+	if !s.holdingSlot {
+		return
+	}
+	s.holdingSlot = false
+	s.coordinator.release()
+}
+
+// notifyProgress publishes the plan for Plan and passes a copy of it to the observer, if any.
+func (s *Strategy) notifyProgress() {
+	s.publishPlan()
+	if s.observer == nil || s.plan == nil {
+		return
+	}
+	s.observer(clonePlan(s.plan))
+}
@@ -0,0 +1,185 @@
+package planexec_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+// newCoordinatorMockClient returns a client that plans two tasks, calls the "work" tool once per
+// task and reflects without changes.
+func newCoordinatorMockClient() *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					if fr, ok := input[0].(gollem.FunctionResponse); ok {
+						if fr.Error != nil {
+							return &gollem.Response{Texts: []string{"failed: " + fr.Error.Error()}}, nil
+						}
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+
+					text := string(input[0].(gollem.Text))
+					switch {
+					case strings.Contains(text, "# Task Analysis and Planning"):
+						return &gollem.Response{Texts: []string{`{"needs_plan": true, "goal": "research", "tasks": [{"description": "step 1"}, {"description": "step 2"}]}`}}, nil
+					case strings.Contains(text, "# Task Execution"):
+						return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{{ID: "call", Name: "work", Arguments: map[string]any{}}}}, nil
+					case strings.Contains(text, "# Task Reflection"):
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": []}`}}, nil
+					default:
+						return &gollem.Response{Texts: []string{"conclusion"}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func TestCoordinator(t *testing.T) {
+	t.Run("limits active tasks across plans", func(t *testing.T) {
+		var active, maxActive, runs int32
+		var coord *planexec.Coordinator
+		work := &testTool{
+			name:        "work",
+			description: "Do work",
+			runFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				n := atomic.AddInt32(&active, 1)
+				defer atomic.AddInt32(&active, -1)
+				for {
+					m := atomic.LoadInt32(&maxActive)
+					if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+						break
+					}
+				}
+				atomic.AddInt32(&runs, 1)
+
+				progress := coord.Progress()
+				if progress.ActiveTasks != 1 {
+					t.Errorf("active tasks: %d", progress.ActiveTasks)
+				}
+				return map[string]any{"ok": true}, nil
+			},
+		}
+
+		client := newCoordinatorMockClient()
+		coord = planexec.NewCoordinator(client,
+			planexec.WithCoordinatorMaxActiveTasks(1),
+			planexec.WithCoordinatorAgentOptions(gollem.WithTools(work)),
+		)
+
+		var wg sync.WaitGroup
+		for i := range 3 {
+			wg.Go(func() {
+				_, err := coord.Run(t.Context(), fmt.Sprintf("plan-%d", i), gollem.Text("research"))
+				gt.NoError(t, err)
+			})
+		}
+		wg.Wait()
+
+		gt.Equal(t, int32(1), maxActive)
+		gt.Equal(t, int32(6), runs)
+
+		progress := coord.Progress()
+		gt.Equal(t, 0, len(progress.Plans))
+		gt.Equal(t, 0, progress.ActiveTasks)
+		gt.Equal(t, 3, progress.FinishedPlans)
+		gt.Equal(t, 6, progress.ToolCalls)
+	})
+
+	t.Run("shares tool budget and reports progress", func(t *testing.T) {
+		var runs int32
+		var coord *planexec.Coordinator
+		var progress *planexec.CoordinatorProgress
+		work := &testTool{
+			name:        "work",
+			description: "Do work",
+			runFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				atomic.AddInt32(&runs, 1)
+				progress = coord.Progress()
+				return map[string]any{"ok": true}, nil
+			},
+		}
+
+		var toolErrs []error
+		budgetObserver := func(next gollem.ToolHandler) gollem.ToolHandler {
+			return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+				resp, err := next(ctx, req)
+				if resp != nil && resp.Error != nil {
+					toolErrs = append(toolErrs, resp.Error)
+				}
+				return resp, err
+			}
+		}
+
+		coord = planexec.NewCoordinator(newCoordinatorMockClient(),
+			planexec.WithCoordinatorToolBudget(1),
+			planexec.WithCoordinatorAgentOptions(gollem.WithTools(work), gollem.WithToolMiddleware(budgetObserver)),
+		)
+		_, err := coord.Run(t.Context(), "plan", gollem.Text("research"))
+		gt.NoError(t, err)
+
+		gt.Equal(t, int32(1), runs)
+		gt.A(t, toolErrs).Length(1)
+		gt.True(t, errors.Is(toolErrs[0], planexec.ErrToolBudgetExhausted))
+
+		// progress seen while the first task was running
+		gt.A(t, progress.Plans).Length(1)
+		gt.Equal(t, "plan", progress.Plans[0].ID)
+		gt.Equal(t, planexec.PlanStatusRunning, progress.Plans[0].Status)
+		gt.Equal(t, "research", progress.Plans[0].Plan.Goal)
+		gt.Equal(t, 2, progress.TotalTasks)
+		gt.Equal(t, 0, progress.CompletedTasks)
+		gt.Equal(t, 1, progress.ActiveTasks)
+		gt.Equal(t, 1, progress.ToolCalls)
+		gt.Equal(t, 1, progress.ToolBudget)
+	})
+
+	t.Run("rejects duplicated plan ID", func(t *testing.T) {
+		started := make(chan struct{})
+		proceed := make(chan struct{})
+		work := &testTool{
+			name:        "work",
+			description: "Do work",
+			runFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				select {
+				case <-started:
+				default:
+					close(started)
+				}
+				<-proceed
+				return map[string]any{"ok": true}, nil
+			},
+		}
+
+		coord := planexec.NewCoordinator(newCoordinatorMockClient(),
+			planexec.WithCoordinatorAgentOptions(gollem.WithTools(work)),
+		)
+
+		done := make(chan error)
+		go func() {
+			_, err := coord.Run(t.Context(), "plan", gollem.Text("research"))
+			done <- err
+		}()
+
+		<-started
+		_, err := coord.Run(t.Context(), "plan", gollem.Text("research"))
+		gt.Error(t, err)
+
+		close(proceed)
+		gt.NoError(t, <-done)
+	})
+}
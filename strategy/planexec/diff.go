@@ -0,0 +1,184 @@
+package planexec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PlanDiff is the difference between two states of a plan, e.g. of snapshots taken at
+// checkpoints of a long execution. Tasks are matched by ID.
+type PlanDiff struct {
+	// Fields are the changed fields of the plan other than tasks, e.g. "Goal"
+	Fields []FieldChange `json:"fields,omitempty"`
+
+	// Added are tasks only in the new plan, in order of the new plan
+	Added []Task `json:"added,omitempty"`
+	// Removed are tasks only in the old plan, in order of the old plan
+	Removed []Task `json:"removed,omitempty"`
+	// Updated are tasks changed between the plans, in order of the new plan
+	Updated []TaskChange `json:"updated,omitempty"`
+}
+
+// FieldChange is a changed field of a plan or a task.
+type FieldChange struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// TaskChange is a task changed between two plans.
+type TaskChange struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+
+	// From and To are the states of the task before and after, set only if the state changed
+	From TaskState `json:"from,omitempty"`
+	To   TaskState `json:"to,omitempty"`
+
+	// Fields are the changed fields of the task other than the state
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// StateChanged returns true if the state of the task changed.
+func (c *TaskChange) StateChanged() bool {
+	return c.From != c.To
+}
+
+// DiffPlans compares two states of a plan. before or after may be nil, e.g. before the first
+// checkpoint, and is treated as a plan without tasks.
+func DiffPlans(before, after *Plan) *PlanDiff {
+	if before == nil {
+		before = &Plan{}
+	}
+	if after == nil {
+		after = &Plan{}
+	}
+
+	diff := &PlanDiff{
+		Fields: diffFields([][3]string{
+			{"UserQuestion", before.UserQuestion, after.UserQuestion},
+			{"UserIntent", before.UserIntent, after.UserIntent},
+			{"Goal", before.Goal, after.Goal},
+			{"DirectResponse", before.DirectResponse, after.DirectResponse},
+			{"ContextSummary", before.ContextSummary, after.ContextSummary},
+			{"Constraints", before.Constraints, after.Constraints},
+		}),
+	}
+
+	oldTasks := make(map[string]*Task, len(before.Tasks))
+	for i := range before.Tasks {
+		oldTasks[before.Tasks[i].ID] = &before.Tasks[i]
+	}
+	newTasks := make(map[string]struct{}, len(after.Tasks))
+
+	for _, task := range after.Tasks {
+		newTasks[task.ID] = struct{}{}
+		old, ok := oldTasks[task.ID]
+		if !ok {
+			diff.Added = append(diff.Added, task)
+			continue
+		}
+		if change := diffTask(old, &task); change != nil {
+			diff.Updated = append(diff.Updated, *change)
+		}
+	}
+
+	for _, task := range before.Tasks {
+		if _, ok := newTasks[task.ID]; !ok {
+			diff.Removed = append(diff.Removed, task)
+		}
+	}
+
+	return diff
+}
+
+// diffTask returns the change of the task, or nil if it's not changed.
+func diffTask(before, after *Task) *TaskChange {
+	change := &TaskChange{
+		ID:          after.ID,
+		Description: after.Description,
+		Fields: diffFields([][3]string{
+			{"Description", before.Description, after.Description},
+			{"Result", before.Result, after.Result},
+			{"SkipReason", before.SkipReason, after.SkipReason},
+			{"Priority", strconv.Itoa(before.Priority), strconv.Itoa(after.Priority)},
+			{"Effort", strconv.Itoa(before.Effort), strconv.Itoa(after.Effort)},
+			{"ToolChoice", formatToolChoice(before), formatToolChoice(after)},
+		}),
+	}
+	if before.State != after.State {
+		change.From, change.To = before.State, after.State
+	}
+
+	if !change.StateChanged() && len(change.Fields) == 0 {
+		return nil
+	}
+	return change
+}
+
+// diffFields returns changes of fields given as {name, before, after}.
+func diffFields(fields [][3]string) []FieldChange {
+	var changes []FieldChange
+	for _, f := range fields {
+		if f[1] != f[2] {
+			changes = append(changes, FieldChange{Name: f[0], Before: f[1], After: f[2]})
+		}
+	}
+	return changes
+}
+
+func formatToolChoice(task *Task) string {
+	if task.ToolChoice == nil {
+		return ""
+	}
+	if task.ToolChoice.Name != "" {
+		return string(task.ToolChoice.Mode) + ":" + task.ToolChoice.Name
+	}
+	return string(task.ToolChoice.Mode)
+}
+
+// IsEmpty returns true if the plans have no difference.
+func (d *PlanDiff) IsEmpty() bool {
+	return len(d.Fields) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Updated) == 0
+}
+
+// String renders the diff as lines for terminals and logs: "+" for added tasks, "-" for removed
+// tasks and "~" for updated tasks. Long values are truncated.
+func (d *PlanDiff) String() string {
+	if d.IsEmpty() {
+		return "No changes\n"
+	}
+
+	var b strings.Builder
+	for _, f := range d.Fields {
+		fmt.Fprintf(&b, "%s: %s -> %s\n", f.Name, quoteDiffValue(f.Before), quoteDiffValue(f.After))
+	}
+	for _, task := range d.Added {
+		fmt.Fprintf(&b, "+ [%s] %s (%s)\n", task.ID, task.Description, task.State)
+	}
+	for _, task := range d.Removed {
+		fmt.Fprintf(&b, "- [%s] %s (%s)\n", task.ID, task.Description, task.State)
+	}
+	for _, change := range d.Updated {
+		fmt.Fprintf(&b, "~ [%s] %s", change.ID, change.Description)
+		if change.StateChanged() {
+			fmt.Fprintf(&b, ": %s -> %s", change.From, change.To)
+		}
+		b.WriteString("\n")
+		for _, f := range change.Fields {
+			fmt.Fprintf(&b, "    %s: %s -> %s\n", f.Name, quoteDiffValue(f.Before), quoteDiffValue(f.After))
+		}
+	}
+	return b.String()
+}
+
+// maxDiffValueLength is the maximum number of runes of a field value in PlanDiff.String
+const maxDiffValueLength = 80
+
+func quoteDiffValue(s string) string {
+	if runes := []rune(s); len(runes) > maxDiffValueLength {
+		s = string(runes[:maxDiffValueLength-1]) + "…"
+	}
+	return fmt.Sprintf("%q", s)
+}
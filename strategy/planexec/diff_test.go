@@ -0,0 +1,83 @@
+package planexec_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestDiffPlans(t *testing.T) {
+	before := &planexec.Plan{
+		Goal: "Judge evil.example",
+		Tasks: []planexec.Task{
+			{ID: "1", Description: "Resolve the domain", State: planexec.TaskStateInProgress},
+			{ID: "2", Description: "Check WHOIS", State: planexec.TaskStatePending},
+			{ID: "3", Description: "Check TLS certificate", State: planexec.TaskStatePending},
+		},
+	}
+	after := &planexec.Plan{
+		Goal: "Judge whether evil.example is malicious",
+		Tasks: []planexec.Task{
+			{ID: "1", Description: "Resolve the domain", State: planexec.TaskStateCompleted, Result: "192.0.2.1"},
+			{ID: "2", Description: "Check WHOIS", State: planexec.TaskStatePending},
+			{ID: "4", Description: "Write a verdict", State: planexec.TaskStatePending},
+		},
+	}
+
+	diff := planexec.DiffPlans(before, after)
+	gt.False(t, diff.IsEmpty())
+
+	gt.A(t, diff.Fields).Length(1).At(0, func(t testing.TB, v planexec.FieldChange) {
+		gt.Equal(t, "Goal", v.Name)
+		gt.Equal(t, "Judge evil.example", v.Before)
+	})
+	gt.A(t, diff.Added).Length(1).At(0, func(t testing.TB, v planexec.Task) {
+		gt.Equal(t, "4", v.ID)
+	})
+	gt.A(t, diff.Removed).Length(1).At(0, func(t testing.TB, v planexec.Task) {
+		gt.Equal(t, "3", v.ID)
+	})
+	gt.A(t, diff.Updated).Length(1).At(0, func(t testing.TB, v planexec.TaskChange) {
+		gt.Equal(t, "1", v.ID)
+		gt.True(t, v.StateChanged())
+		gt.Equal(t, planexec.TaskStateInProgress, v.From)
+		gt.Equal(t, planexec.TaskStateCompleted, v.To)
+		gt.A(t, v.Fields).Length(1).At(0, func(t testing.TB, f planexec.FieldChange) {
+			gt.Equal(t, "Result", f.Name)
+			gt.Equal(t, "192.0.2.1", f.After)
+		})
+	})
+
+	out := diff.String()
+	gt.True(t, strings.Contains(out, "+ [4] Write a verdict (pending)"))
+	gt.True(t, strings.Contains(out, "- [3] Check TLS certificate (pending)"))
+	gt.True(t, strings.Contains(out, "~ [1] Resolve the domain: in_progress -> completed"))
+	gt.False(t, strings.Contains(out, "[2]"))
+
+	t.Run("no changes", func(t *testing.T) {
+		diff := planexec.DiffPlans(after, after)
+		gt.True(t, diff.IsEmpty())
+		gt.Equal(t, "No changes\n", diff.String())
+	})
+
+	t.Run("tool choice and skip", func(t *testing.T) {
+		choice := gollem.ToolChoiceNone()
+		updated := &planexec.Plan{Tasks: []planexec.Task{
+			{ID: "1", Description: "Resolve the domain", State: planexec.TaskStateSkipped, SkipReason: "not needed", ToolChoice: &choice},
+		}}
+		diff := planexec.DiffPlans(&planexec.Plan{Tasks: before.Tasks[:1]}, updated)
+		gt.A(t, diff.Updated).Length(1).At(0, func(t testing.TB, v planexec.TaskChange) {
+			gt.Equal(t, planexec.TaskStateSkipped, v.To)
+			gt.A(t, v.Fields).Length(2)
+		})
+	})
+
+	t.Run("nil before", func(t *testing.T) {
+		diff := planexec.DiffPlans(nil, after)
+		gt.A(t, diff.Added).Length(3)
+		gt.A(t, diff.Fields).Length(1)
+	})
+}
@@ -0,0 +1,320 @@
+package planexec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// maxDryRunToolRounds is the maximum number of stubbed tool call rounds in a simulated task
+const maxDryRunToolRounds = 4
+
+// ExecutionPreview is the result of a dry run with WithPlanDryRun.
+type ExecutionPreview struct {
+	// Plan is the plan before simulation, with all tasks pending. Pass it to WithPlan to
+	// execute the approved plan without planning again.
+	Plan *Plan
+
+	// Tasks is the simulated tasks in plan order, including tasks added or skipped by reflection
+	Tasks []SimulatedTask
+
+	// LLMCalls, InputTokens and OutputTokens are the LLM usage of the dry run, including
+	// planning and reflection. The actual execution makes about the same calls plus a final
+	// conclusion, and real tool results make its input larger, so they are a lower-bound
+	// estimate of the execution cost.
+	LLMCalls     int
+	InputTokens  int
+	OutputTokens int
+}
+
+// SimulatedTask is a task of the plan after simulation.
+type SimulatedTask struct {
+	ID          string
+	Description string
+	State       TaskState
+	SkipReason  string
+
+	// ToolCalls is the tool calls the model would make for the task
+	ToolCalls []SimulatedToolCall
+	// Outcome is what the model describes it would do and expects as the result
+	Outcome string
+}
+
+// SimulatedToolCall is a tool call made by the model in a dry run, which was not executed.
+type SimulatedToolCall struct {
+	Name      string
+	Arguments map[string]any
+}
+
+// ExecutionPreview returns the preview of the last dry run, or nil if the strategy is not in
+// dry-run mode or has not planned yet.
+func (s *Strategy) ExecutionPreview() *ExecutionPreview {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.preview
+}
+
+func (s *Strategy) setPreview(preview *ExecutionPreview) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preview = preview
+}
+
+// String renders the preview as readable text for approval.
+func (p *ExecutionPreview) String() string {
+	var b strings.Builder
+	b.WriteString("Dry run: no tools were executed.\n")
+	if p.Plan != nil && p.Plan.Goal != "" {
+		fmt.Fprintf(&b, "Goal: %s\n", p.Plan.Goal)
+	}
+
+	for i, task := range p.Tasks {
+		state := string(task.State)
+		if task.State == TaskStateSkipped && task.SkipReason != "" {
+			state += ": " + task.SkipReason
+		}
+		fmt.Fprintf(&b, "\n%d. %s [%s]\n", i+1, task.Description, state)
+		for _, call := range task.ToolCalls {
+			args, _ := json.Marshal(call.Arguments)
+			fmt.Fprintf(&b, "   - %s %s\n", call.Name, args)
+		}
+		if task.Outcome != "" {
+			fmt.Fprintf(&b, "   Expected: %s\n", task.Outcome)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nEstimated cost: %d LLM calls, %d input tokens, %d output tokens (usage of the dry run)\n",
+		p.LLMCalls, p.InputTokens, p.OutputTokens)
+	return b.String()
+}
+
+// dryRunPlan simulates all tasks of the plan with reflection and returns the preview as the
+// final response.
+func (s *Strategy) dryRunPlan(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+	if s.client == nil {
+		return nil, nil, goerr.New("LLM client is not set")
+	}
+
+	// Simulate on a copy so that the plan given by WithPlan stays pending
+	preview := &ExecutionPreview{Plan: clonePlan(s.plan)}
+	s.plan = clonePlan(s.plan)
+
+	specs := make(map[string]gollem.ToolSpec, len(state.Tools))
+	for _, tool := range state.Tools {
+		spec := tool.Spec()
+		specs[spec.Name] = spec
+	}
+
+	toolCalls := map[string][]SimulatedToolCall{}
+	outcomes := map[string]string{}
+
+	for s.taskIterationCount < s.maxIterations {
+		s.currentTask = getNextPendingTask(ctx, s.plan, s.taskOrder)
+		if s.currentTask == nil {
+			break
+		}
+		s.currentTask.State = TaskStateInProgress
+		s.notifyProgress()
+
+		calls, outcome, err := s.simulateTask(ctx, s.currentTask, state, specs)
+		if err != nil {
+			return nil, nil, goerr.Wrap(err, "failed to simulate task", goerr.V("task_id", s.currentTask.ID))
+		}
+		toolCalls[s.currentTask.ID] = calls
+		outcomes[s.currentTask.ID] = outcome
+
+		s.currentTask.Result = simulatedResult(calls, outcome)
+		s.currentTask.State = TaskStateCompleted
+		s.taskIterationCount++
+		s.notifyProgress()
+
+		if s.hooks != nil {
+			if err := s.hooks.OnTaskDone(ctx, s.plan, s.currentTask); err != nil {
+				return nil, nil, goerr.Wrap(err, "hook OnTaskDone failed")
+			}
+		}
+
+		if s.taskIterationCount >= s.maxIterations {
+			break
+		}
+
+		reflectionResult, err := reflect(ctx, s.client, s.plan, s.currentTask, state.Tools, s.middleware, s.taskIterationCount, s.maxIterations, s.contextHistory(state), state.SystemPrompt)
+		if err != nil {
+			return nil, nil, goerr.Wrap(err, "reflection failed")
+		}
+		if err := s.applyReflection(ctx, reflectionResult); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, task := range s.plan.Tasks {
+		preview.Tasks = append(preview.Tasks, SimulatedTask{
+			ID:          task.ID,
+			Description: task.Description,
+			State:       task.State,
+			SkipReason:  task.SkipReason,
+			ToolCalls:   toolCalls[task.ID],
+			Outcome:     outcomes[task.ID],
+		})
+	}
+	preview.LLMCalls, preview.InputTokens, preview.OutputTokens = s.dryRunUsage.get()
+	s.setPreview(preview)
+
+	return nil, &gollem.ExecuteResponse{
+		UserInputs: state.InitInput,
+		Texts:      []string{preview.String()},
+	}, nil
+}
+
+// simulateTask runs the execute prompt of task in a separate session and answers tool calls with
+// stub responses. It returns the tool calls and the texts of the model.
+func (s *Strategy) simulateTask(ctx context.Context, task *Task, state *gollem.StrategyState, specs map[string]gollem.ToolSpec) ([]SimulatedToolCall, string, error) {
+	sessionOpts := []gollem.SessionOption{
+		gollem.WithSessionTools(state.Tools...),
+	}
+	if state.SystemPrompt != "" {
+		sessionOpts = append(sessionOpts, gollem.WithSessionSystemPrompt(state.SystemPrompt))
+	}
+	// Task execution runs in the agent session, so simulation sees its history if inherited
+	if s.inheritedHistory != nil {
+		sessionOpts = append(sessionOpts, gollem.WithSessionHistory(s.inheritedHistory))
+	}
+	for _, mw := range s.middleware {
+		sessionOpts = append(sessionOpts, gollem.WithSessionContentBlockMiddleware(mw))
+	}
+
+	session, err := s.client.NewSession(ctx, sessionOpts...)
+	if err != nil {
+		return nil, "", goerr.Wrap(err, "failed to create session for simulation")
+	}
+
+	var genOpts []gollem.GenerateOption
+	if task.ToolChoice != nil {
+		genOpts = append(genOpts, gollem.WithToolChoice(*task.ToolChoice))
+	}
+
+	input := buildExecutePrompt(ctx, task, s.plan, s.taskIterationCount, s.maxIterations)
+	var calls []SimulatedToolCall
+	var texts []string
+
+	for round := 1; ; round++ {
+		if err := gollem.CheckBudget(ctx); err != nil {
+			return nil, "", err
+		}
+		resp, err := session.Generate(ctx, input, genOpts...)
+		if err != nil {
+			return nil, "", goerr.Wrap(err, "failed to generate simulation")
+		}
+		gollem.RecordUsage(ctx, resp)
+		texts = append(texts, resp.Texts...)
+
+		input = nil
+		for _, fc := range resp.FunctionCalls {
+			calls = append(calls, SimulatedToolCall{Name: fc.Name, Arguments: fc.Arguments})
+			input = append(input, stubToolResponse(fc, specs))
+		}
+		if len(input) == 0 || round >= maxDryRunToolRounds {
+			break
+		}
+		// Tool choice is applied only to the first call of the task as in normal execution
+		genOpts = nil
+	}
+
+	return calls, strings.Join(texts, "\n"), nil
+}
+
+// stubToolResponse answers a tool call in a dry run without running the tool.
+func stubToolResponse(fc *gollem.FunctionCall, specs map[string]gollem.ToolSpec) gollem.FunctionResponse {
+	data := map[string]any{
+		"dry_run": true,
+		"message": "This tool was not executed because this is a dry run. Assume it works as described and explain what you would do and what result you expect.",
+	}
+	if spec, ok := specs[fc.Name]; ok {
+		data["tool_description"] = spec.Description
+	}
+	return gollem.FunctionResponse{ID: fc.ID, Name: fc.Name, Data: data}
+}
+
+// simulatedResult is the task result of a simulated task given to reflection.
+func simulatedResult(calls []SimulatedToolCall, outcome string) string {
+	lines := []string{"(dry run: tools were not executed)"}
+	for _, call := range calls {
+		args, _ := json.Marshal(call.Arguments)
+		lines = append(lines, fmt.Sprintf("Planned tool call: %s %s", call.Name, args))
+	}
+	if outcome != "" {
+		lines = append(lines, "Expected outcome: "+outcome)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// clonePlan returns a copy of plan that does not share tasks.
+func clonePlan(plan *Plan) *Plan {
+	cloned := *plan
+	cloned.Tasks = make([]Task, len(plan.Tasks))
+	copy(cloned.Tasks, plan.Tasks)
+	return &cloned
+}
+
+// llmUsage is the LLM usage counted by usageClient.
+type llmUsage struct {
+	mu           sync.Mutex
+	calls        int
+	inputTokens  int
+	outputTokens int
+}
+
+func (u *llmUsage) add(resp *gollem.Response) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls++
+	u.inputTokens += resp.InputToken
+	u.outputTokens += resp.OutputToken
+}
+
+func (u *llmUsage) get() (int, int, int) {
+	if u == nil {
+		return 0, 0, 0
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.calls, u.inputTokens, u.outputTokens
+}
+
+func (u *llmUsage) reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls, u.inputTokens, u.outputTokens = 0, 0, 0
+}
+
+// usageClient counts the LLM usage of all sessions created by the strategy in dry-run mode.
+type usageClient struct {
+	gollem.LLMClient
+	usage *llmUsage
+}
+
+func (c *usageClient) NewSession(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+	session, err := c.LLMClient.NewSession(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &usageSession{Session: session, usage: c.usage}, nil
+}
+
+type usageSession struct {
+	gollem.Session
+	usage *llmUsage
+}
+
+func (s *usageSession) Generate(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+	resp, err := s.Session.Generate(ctx, input, opts...)
+	if resp != nil {
+		s.usage.add(resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,156 @@
+package planexec_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPlanDryRun(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Restart the web server",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "Restart the server", State: planexec.TaskStatePending},
+			{ID: "task-2", Description: "Check the server status", State: planexec.TaskStatePending},
+		},
+	}
+
+	restart := &testTool{
+		name:        "restart_server",
+		description: "Restart the web server",
+		runFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			t.Error("tool must not be executed in dry run")
+			return nil, nil
+		},
+	}
+
+	var stubs []gollem.FunctionResponse
+	var reflections int
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					if fr, ok := input[0].(gollem.FunctionResponse); ok {
+						stubs = append(stubs, fr)
+						return &gollem.Response{Texts: []string{"The server restarts"}, InputToken: 10, OutputToken: 5}, nil
+					}
+
+					text := string(input[0].(gollem.Text))
+					switch {
+					case strings.Contains(text, "# Task Execution"):
+						return &gollem.Response{
+							FunctionCalls: []*gollem.FunctionCall{{ID: "call-1", Name: "restart_server", Arguments: map[string]any{"force": true}}},
+							InputToken:    100,
+							OutputToken:   10,
+						}, nil
+					case strings.Contains(text, "# Task Reflection"):
+						reflections++
+						return &gollem.Response{
+							Texts:       []string{`{"new_tasks": [], "updated_tasks": [{"id": "task-2", "description": "Check the server status", "state": "skipped"}], "reason": "restart reports the status"}`},
+							InputToken:  50,
+							OutputToken: 20,
+						}, nil
+					default:
+						t.Errorf("unexpected prompt: %s", text)
+						return &gollem.Response{}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	strategy := planexec.New(mockClient, planexec.WithPlan(plan), planexec.WithPlanDryRun())
+	agent := gollem.New(mockClient, gollem.WithStrategy(strategy), gollem.WithTools(restart))
+	resp, err := agent.Execute(context.Background(), gollem.Text("Restart the web server"))
+	gt.NoError(t, err)
+
+	preview := strategy.ExecutionPreview()
+	gt.NotNil(t, preview)
+	gt.Equal(t, 1, reflections)
+
+	// the given plan is not changed and can be executed after approval
+	gt.Equal(t, planexec.TaskStatePending, plan.Tasks[0].State)
+	gt.Equal(t, planexec.TaskStatePending, preview.Plan.Tasks[0].State)
+	gt.Equal(t, planexec.TaskStatePending, preview.Plan.Tasks[1].State)
+
+	gt.A(t, preview.Tasks).Length(2)
+	gt.Equal(t, planexec.TaskStateCompleted, preview.Tasks[0].State)
+	gt.A(t, preview.Tasks[0].ToolCalls).Length(1)
+	gt.Equal(t, "restart_server", preview.Tasks[0].ToolCalls[0].Name)
+	gt.Equal(t, true, preview.Tasks[0].ToolCalls[0].Arguments["force"])
+	gt.Equal(t, "The server restarts", preview.Tasks[0].Outcome)
+	gt.Equal(t, planexec.TaskStateSkipped, preview.Tasks[1].State)
+	gt.Equal(t, "restart reports the status", preview.Tasks[1].SkipReason)
+
+	// tool calls are answered with stubs built from the spec
+	gt.A(t, stubs).Length(1)
+	gt.Equal(t, "call-1", stubs[0].ID)
+	gt.Equal(t, true, stubs[0].Data["dry_run"])
+	gt.Equal(t, "Restart the web server", stubs[0].Data["tool_description"])
+
+	gt.Equal(t, 3, preview.LLMCalls)
+	gt.Equal(t, 160, preview.InputTokens)
+	gt.Equal(t, 35, preview.OutputTokens)
+
+	gt.A(t, resp.Texts).Length(1)
+	gt.S(t, resp.Texts[0]).Contains("restart_server {\"force\":true}")
+	gt.S(t, resp.Texts[0]).Contains("skipped: restart reports the status")
+}
+
+func TestPlanDeterministicTaskIDs(t *testing.T) {
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					text := string(input[0].(gollem.Text))
+					switch {
+					case strings.Contains(text, "# Task Analysis and Planning"):
+						return &gollem.Response{Texts: []string{`{"needs_plan": true, "goal": "Check servers", "tasks": [{"description": "Check server A"}, {"description": "Check server B"}]}`}}, nil
+					case strings.Contains(text, "# Task Execution"):
+						return &gollem.Response{Texts: []string{"Server is healthy"}}, nil
+					case strings.Contains(text, "# Task Reflection"):
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "on track"}`}}, nil
+					default:
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	run := func() []string {
+		strategy := planexec.New(mockClient, planexec.WithPlanDryRun())
+		agent := gollem.New(mockClient,
+			gollem.WithStrategy(strategy),
+			gollem.WithIDGenerator(gollem.NewSequentialIDGenerator("id-")),
+		)
+		_, err := agent.Execute(context.Background(), gollem.Text("Check servers"))
+		gt.NoError(t, err)
+
+		preview := strategy.ExecutionPreview()
+		gt.NotNil(t, preview)
+		var ids []string
+		for _, task := range preview.Plan.Tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+
+	first := run()
+	gt.A(t, first).Length(2)
+	gt.Equal(t, first, run())
+	for _, id := range first {
+		gt.True(t, strings.HasPrefix(id, "id-"))
+	}
+}
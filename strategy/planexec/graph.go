@@ -0,0 +1,160 @@
+package planexec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// GraphFormat is an output format of Plan.ExportGraph
+type GraphFormat string
+
+const (
+	// GraphFormatMermaid is a Mermaid flowchart, rendered by GitHub and many documentation tools
+	GraphFormatMermaid GraphFormat = "mermaid"
+	// GraphFormatDOT is a Graphviz DOT graph
+	GraphFormatDOT GraphFormat = "dot"
+)
+
+// graphStyle is the fill and stroke colors of a task node by state
+type graphStyle struct {
+	fill   string
+	stroke string
+}
+
+var graphStyles = map[TaskState]graphStyle{
+	TaskStatePending:    {fill: "#f8f9fa", stroke: "#6c757d"},
+	TaskStateInProgress: {fill: "#fff3cd", stroke: "#ffc107"},
+	TaskStateCompleted:  {fill: "#d4edda", stroke: "#28a745"},
+	TaskStateSkipped:    {fill: "#e2e3e5", stroke: "#6c757d"},
+}
+
+// graphStates is the order of class definitions in Mermaid output
+var graphStates = []TaskState{TaskStatePending, TaskStateInProgress, TaskStateCompleted, TaskStateSkipped}
+
+// ExportGraph renders the plan as a graph for documents and progress dashboards. The goal is
+// the root node and tasks are connected in execution order, colored by state. Skipped tasks are
+// reached by a dashed edge and labeled with the skip reason.
+func (p *Plan) ExportGraph(format GraphFormat) (string, error) {
+	switch format {
+	case GraphFormatMermaid:
+		return p.exportMermaid(), nil
+	case GraphFormatDOT:
+		return p.exportDOT(), nil
+	default:
+		return "", goerr.New("unsupported graph format", goerr.V("format", format))
+	}
+}
+
+// graphState returns state if it has a style, or pending otherwise.
+func graphState(state TaskState) TaskState {
+	if _, ok := graphStyles[state]; ok {
+		return state
+	}
+	return TaskStatePending
+}
+
+// graphGoal returns the label of the root node, or empty if the plan has neither goal nor question.
+func (p *Plan) graphGoal() string {
+	if p.Goal != "" {
+		return "Goal: " + p.Goal
+	}
+	if p.UserQuestion != "" {
+		return "Question: " + p.UserQuestion
+	}
+	return ""
+}
+
+// graphTaskLines returns the label lines of the i-th task.
+func graphTaskLines(i int, task *Task) []string {
+	lines := []string{fmt.Sprintf("%d. %s", i+1, task.Description)}
+	state := string(task.State)
+	if task.State == TaskStateSkipped && task.SkipReason != "" {
+		state += ": " + task.SkipReason
+	}
+	return append(lines, state)
+}
+
+func (p *Plan) exportMermaid() string {
+	escape := func(s string) string {
+		s = strings.ReplaceAll(s, "\n", " ")
+		return strings.ReplaceAll(s, `"`, "#quot;")
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	prev := ""
+	if goal := p.graphGoal(); goal != "" {
+		fmt.Fprintf(&b, "    goal([\"%s\"])\n", escape(goal))
+		prev = "goal"
+	}
+
+	for i := range p.Tasks {
+		task := &p.Tasks[i]
+		id := fmt.Sprintf("t%d", i+1)
+		lines := graphTaskLines(i, task)
+		for j := range lines {
+			lines[j] = escape(lines[j])
+		}
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", id, strings.Join(lines, "<br/>"))
+		if prev != "" {
+			arrow := "-->"
+			if task.State == TaskStateSkipped {
+				arrow = "-.->"
+			}
+			fmt.Fprintf(&b, "    %s %s %s\n", prev, arrow, id)
+		}
+		fmt.Fprintf(&b, "    class %s %s\n", id, graphState(task.State))
+		prev = id
+	}
+
+	for _, state := range graphStates {
+		style := graphStyles[state]
+		fmt.Fprintf(&b, "    classDef %s fill:%s,stroke:%s\n", state, style.fill, style.stroke)
+	}
+
+	return b.String()
+}
+
+func (p *Plan) exportDOT() string {
+	escape := func(s string) string {
+		s = strings.ReplaceAll(s, "\n", " ")
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		return strings.ReplaceAll(s, `"`, `\"`)
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph plan {\n")
+	b.WriteString("    rankdir=TB;\n")
+	b.WriteString("    node [shape=box, style=\"rounded,filled\"];\n")
+
+	prev := ""
+	if goal := p.graphGoal(); goal != "" {
+		fmt.Fprintf(&b, "    goal [label=\"%s\", shape=ellipse, fillcolor=\"#ffffff\"];\n", escape(goal))
+		prev = "goal"
+	}
+
+	for i := range p.Tasks {
+		task := &p.Tasks[i]
+		id := fmt.Sprintf("t%d", i+1)
+		lines := graphTaskLines(i, task)
+		for j := range lines {
+			lines[j] = escape(lines[j])
+		}
+		style := graphStyles[graphState(task.State)]
+		fmt.Fprintf(&b, "    %s [label=\"%s\", fillcolor=\"%s\", color=\"%s\"];\n", id, strings.Join(lines, `\n`), style.fill, style.stroke)
+		if prev != "" {
+			if task.State == TaskStateSkipped {
+				fmt.Fprintf(&b, "    %s -> %s [style=dashed];\n", prev, id)
+			} else {
+				fmt.Fprintf(&b, "    %s -> %s;\n", prev, id)
+			}
+		}
+		prev = id
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package planexec_test
+
+import (
+	"testing"
+
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestExportGraph(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: `Find the "root" cause`,
+		Tasks: []planexec.Task{
+			{ID: "a", Description: "Check logs", State: planexec.TaskStateCompleted},
+			{ID: "b", Description: "Query metrics", State: planexec.TaskStateSkipped, SkipReason: "logs were enough"},
+			{ID: "c", Description: "Write report", State: planexec.TaskStateInProgress},
+		},
+	}
+
+	t.Run("mermaid", func(t *testing.T) {
+		out, err := plan.ExportGraph(planexec.GraphFormatMermaid)
+		gt.NoError(t, err)
+		gt.Equal(t, `flowchart TD
+    goal(["Goal: Find the #quot;root#quot; cause"])
+    t1["1. Check logs<br/>completed"]
+    goal --> t1
+    class t1 completed
+    t2["2. Query metrics<br/>skipped: logs were enough"]
+    t1 -.-> t2
+    class t2 skipped
+    t3["3. Write report<br/>in_progress"]
+    t2 --> t3
+    class t3 in_progress
+    classDef pending fill:#f8f9fa,stroke:#6c757d
+    classDef in_progress fill:#fff3cd,stroke:#ffc107
+    classDef completed fill:#d4edda,stroke:#28a745
+    classDef skipped fill:#e2e3e5,stroke:#6c757d
+`, out)
+	})
+
+	t.Run("dot", func(t *testing.T) {
+		out, err := plan.ExportGraph(planexec.GraphFormatDOT)
+		gt.NoError(t, err)
+		gt.Equal(t, `digraph plan {
+    rankdir=TB;
+    node [shape=box, style="rounded,filled"];
+    goal [label="Goal: Find the \"root\" cause", shape=ellipse, fillcolor="#ffffff"];
+    t1 [label="1. Check logs\ncompleted", fillcolor="#d4edda", color="#28a745"];
+    goal -> t1;
+    t2 [label="2. Query metrics\nskipped: logs were enough", fillcolor="#e2e3e5", color="#6c757d"];
+    t1 -> t2 [style=dashed];
+    t3 [label="3. Write report\nin_progress", fillcolor="#fff3cd", color="#ffc107"];
+    t2 -> t3;
+}
+`, out)
+	})
+
+	t.Run("plan without goal starts from the first task", func(t *testing.T) {
+		out, err := (&planexec.Plan{Tasks: []planexec.Task{{Description: "only"}}}).ExportGraph(planexec.GraphFormatDOT)
+		gt.NoError(t, err)
+		gt.S(t, out).NotContains("goal")
+		gt.S(t, out).Contains(`t1 [label="1. only\n", fillcolor="#f8f9fa"`)
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, err := plan.ExportGraph("svg")
+		gt.Error(t, err)
+	})
+}
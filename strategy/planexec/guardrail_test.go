@@ -0,0 +1,57 @@
+package planexec_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestGuardrails(t *testing.T) {
+	var prompts []string
+	var calls int
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					for _, in := range input {
+						if text, ok := in.(gollem.Text); ok {
+							prompts = append(prompts, string(text))
+						}
+					}
+					switch calls {
+					case 1:
+						return &gollem.Response{Texts: []string{`{"needs_plan": true, "user_intent": "Notify", "goal": "Notify", "tasks": [{"description": "Send a mail"}]}`}}, nil
+					case 2:
+						return &gollem.Response{Texts: []string{"Sent to alice@example.com"}}, nil
+					case 3:
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "done"}`}}, nil
+					default:
+						return &gollem.Response{Texts: []string{"Notified alice@example.com."}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	agent := gollem.New(mockClient,
+		gollem.WithStrategy(planexec.New(mockClient)),
+		gollem.WithGuardrails(gollem.NewPIIGuardrail(gollem.GuardrailRedact)),
+	)
+	resp, err := agent.Execute(context.Background(), gollem.Text("Notify alice@example.com"))
+	gt.NoError(t, err)
+
+	// The planner sees the checked input, and the conclusion is checked as the output
+	gt.S(t, prompts[0]).Contains("Notify [REDACTED]")
+	for _, prompt := range prompts {
+		gt.S(t, prompt).NotContains("Notify alice@example.com")
+	}
+	gt.Equal(t, []string{"Notified [REDACTED]."}, resp.Texts)
+}
@@ -19,6 +19,12 @@ func New(client gollem.LLMClient, opts ...Option) *Strategy {
 		opt(s)
 	}
 
+	if s.dryRun && s.client != nil {
+		s.dryRunUsage = &llmUsage{}
+		s.client = &usageClient{LLMClient: s.client, usage: s.dryRunUsage}
+	}
+	s.publishPlan()
+
 	return s
 }
 
@@ -33,11 +39,43 @@ func (s *Strategy) Init(ctx context.Context, inputs []gollem.Input) error {
 	s.currentTask = nil
 	s.waitingForTask = false
 	s.taskIterationCount = 0
+	s.approvalNote = ""
+	s.setPreview(nil)
+	s.inheritedHistory = nil
+	if s.dryRunUsage != nil {
+		s.dryRunUsage.reset()
+	}
+	s.setUsage(nil)
+	s.budget = nil
+	s.publishPlan()
 	return nil
 }
 
 // Handle determines the next input for the LLM based on the current state
 func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+	if state.Iteration == 0 {
+		s.setUsage(state.Usage)
+		if (s.budgetMaxUSD > 0 || s.budgetMaxTokens > 0) && state.Usage != nil {
+			s.budget = gollem.NewBudget(state.Usage, s.budgetMaxUSD, s.budgetMaxTokens, s.budgetOptions...)
+		}
+	}
+	if s.budget == nil {
+		return s.handle(ctx, state)
+	}
+
+	// LLM calls of planning, reflection and the conclusion check the budget by ctx, and the
+	// next input for the agent loop is checked here
+	ctx = gollem.ContextWithBudget(ctx, s.budget)
+	inputs, resp, err := s.handle(ctx, state)
+	if err == nil && len(inputs) > 0 {
+		if err := s.budget.Check(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	return inputs, resp, err
+}
+
+func (s *Strategy) handle(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
 	// ========== Phase 0: Pass through NextInput (e.g., tool responses) ==========
 	// If there's pending input (like tool responses), we must send it to the LLM
 	// before proceeding with strategy logic.
@@ -50,6 +88,15 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 
 	// ========== Phase 1: Initialization and Planning ==========
 	if state.Iteration == 0 {
+		// Take over the conversation of the agent session before this Execute
+		if s.inheritSession && state.Session != nil {
+			history, err := state.Session.History()
+			if err != nil {
+				return nil, nil, goerr.Wrap(err, "failed to get history of agent session")
+			}
+			s.inheritedHistory = history
+		}
+
 		// Check if plan was already provided via WithPlan option
 		if s.plan == nil {
 			// No plan provided - generate one using LLM
@@ -59,7 +106,7 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 
 			// Analyze and create plan using LLM
 			// Pass system prompt and history so they can be embedded into the Plan structure
-			plan, err := generatePlanInternal(ctx, s.client, state.InitInput, state.Tools, s.middleware, state.SystemPrompt, state.History)
+			plan, err := generatePlanInternal(ctx, s.client, state.InitInput, state.Tools, s.middleware, state.SystemPrompt, s.contextHistory(state))
 			if err != nil {
 				return nil, nil, goerr.Wrap(err, "failed to analyze and plan")
 			}
@@ -85,15 +132,21 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 				Tasks: tasks,
 			})
 		}
+		s.notifyProgress()
 
 		// No plan needed - return direct response
 		// Planning phase is internal analysis - no history preservation needed
-		if len(s.plan.Tasks) == 0 {
+		if len(s.plan.Tasks) == 0 && s.resultSchema == nil {
 			return nil, &gollem.ExecuteResponse{
 				UserInputs: state.InitInput,
 				Texts:      []string{s.plan.DirectResponse},
 			}, nil
 		}
+
+		// Simulate all tasks without running tools in dry-run mode
+		if s.dryRun && len(s.plan.Tasks) > 0 {
+			return s.dryRunPlan(ctx, state)
+		}
 		// Proceed to phase 3 to select first task
 	}
 
@@ -105,11 +158,18 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 		}
 		// Use pendingToolResults which were saved in Phase 0
 		s.currentTask.Result = parseTaskResult(state.LastResponse, s.pendingToolResults)
+		if s.approvalNote != "" {
+			s.currentTask.Result = s.approvalNote + "\n\n" + s.currentTask.Result
+			s.approvalNote = ""
+		}
 		s.currentTask.State = TaskStateCompleted
 		s.waitingForTask = false
+		gollem.SetUsageLabel(ctx, gollem.UsageLabelPlanTask, "")
 		s.taskIterationCount++
 		// Clear pending tool results after use
 		s.pendingToolResults = nil
+		s.releaseTaskSlot()
+		s.notifyProgress()
 
 		// Hook: task done
 		if s.hooks != nil {
@@ -129,63 +189,16 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 
 		// Check max iteration limit (safety net against infinite loops)
 		if s.taskIterationCount >= s.maxIterations {
-			finalResponse, err := getFinalConclusion(ctx, s.client, s.plan, s.middleware, state.SystemPrompt)
-			if err != nil {
-				return nil, generateFinalResponse(ctx, s.plan), nil
-			}
-			return nil, finalResponse, nil
+			return s.conclude(ctx, state)
 		}
 
 		// Perform reflection only if enabled
-		reflectionResult, err := reflect(ctx, s.client, s.plan, s.currentTask, state.Tools, s.middleware, s.taskIterationCount, s.maxIterations, state.History, state.SystemPrompt)
+		reflectionResult, err := reflect(ctx, s.client, s.plan, s.currentTask, state.Tools, s.middleware, s.taskIterationCount, s.maxIterations, s.contextHistory(state), state.SystemPrompt)
 		if err != nil {
 			return nil, nil, goerr.Wrap(err, "reflection failed")
 		}
-		// Apply task updates from reflection
-		hasChanges := false
-		if len(reflectionResult.UpdatedTasks) > 0 {
-			taskMap := make(map[string]*Task)
-			for i := range s.plan.Tasks {
-				taskMap[s.plan.Tasks[i].ID] = &s.plan.Tasks[i]
-			}
-			for _, updatedTask := range reflectionResult.UpdatedTasks {
-				if task, exists := taskMap[updatedTask.ID]; exists {
-					task.Description = updatedTask.Description
-					task.State = updatedTask.State
-				}
-			}
-			hasChanges = true
-		}
-
-		// Add new tasks from reflection
-		if len(reflectionResult.NewTasks) > 0 {
-			s.plan.Tasks = append(s.plan.Tasks, reflectionResult.NewTasks...)
-			hasChanges = true
-		}
-
-		// Hook: plan updated (tasks added or modified)
-		if hasChanges && s.hooks != nil {
-			if err := s.hooks.OnPlanUpdated(ctx, s.plan); err != nil {
-				return nil, nil, goerr.Wrap(err, "hook OnPlanUpdated failed")
-			}
-		}
-
-		// Trace event: plan updated
-		if hasChanges {
-			if rec := trace.HandlerFrom(ctx); rec != nil {
-				var updated []PlanTaskInfo
-				for _, t := range reflectionResult.UpdatedTasks {
-					updated = append(updated, PlanTaskInfo{ID: t.ID, Description: t.Description, State: string(t.State)})
-				}
-				var newTasks []PlanTaskInfo
-				for _, t := range reflectionResult.NewTasks {
-					newTasks = append(newTasks, PlanTaskInfo{ID: t.ID, Description: t.Description, State: string(t.State)})
-				}
-				rec.AddEvent(ctx, "plan_updated", &PlanUpdatedEvent{
-					UpdatedTasks: updated,
-					NewTasks:     newTasks,
-				})
-			}
+		if err := s.applyReflection(ctx, reflectionResult); err != nil {
+			return nil, nil, err
 		}
 
 		// Proceed to phase 3 to select next task
@@ -193,21 +206,39 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 
 	// ========== Phase 3: Next Task Selection and Execution ==========
 	if !s.waitingForTask {
-		s.currentTask = getNextPendingTask(ctx, s.plan)
+		for {
+			s.currentTask = getNextPendingTask(ctx, s.plan, s.taskOrder)
 
-		// All tasks completed - get final conclusion from LLM
-		if s.currentTask == nil {
-			finalResponse, err := getFinalConclusion(ctx, s.client, s.plan, s.middleware, state.SystemPrompt)
+			// All tasks completed - get final conclusion from LLM
+			if s.currentTask == nil {
+				return s.conclude(ctx, state)
+			}
+
+			// Ask for approval before any tool of the task runs; select again if denied
+			approved, err := s.approveTask(ctx, state)
 			if err != nil {
-				// If conclusion generation fails, fall back to simple summary
-				return nil, generateFinalResponse(ctx, s.plan), nil
+				return nil, nil, err
+			}
+			if approved {
+				break
 			}
-			return nil, finalResponse, nil
+			if s.taskIterationCount >= s.maxIterations {
+				return s.conclude(ctx, state)
+			}
+		}
+
+		// Wait for a task slot shared with other plans of the coordinator
+		if err := s.acquireTaskSlot(ctx); err != nil {
+			return nil, nil, err
 		}
 
 		// Start task execution
 		s.currentTask.State = TaskStateInProgress
 		s.waitingForTask = true
+		// Usage of the LLM calls executing the task is reported with the task ID
+		gollem.SetUsageLabel(ctx, gollem.UsageLabelPlanTask, s.currentTask.ID)
+
+		s.notifyProgress()
 
 		// Trace event: task started
 		if rec := trace.HandlerFrom(ctx); rec != nil {
@@ -217,6 +248,10 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 			})
 		}
 
+		if s.currentTask.ToolChoice != nil {
+			state.GenerateOptions = append(state.GenerateOptions, gollem.WithToolChoice(*s.currentTask.ToolChoice))
+		}
+
 		// Return task execution prompt
 		return buildExecutePrompt(ctx, s.currentTask, s.plan, s.taskIterationCount, s.maxIterations), nil, nil
 	}
@@ -225,12 +260,164 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 	return nil, nil, goerr.New("unexpected state in Handle")
 }
 
+// conclude generates the final response from the plan, falling back to a simple summary if the
+// LLM fails. With WithPlanResultSchema, the conclusion is JSON matching the schema and fails
+// without fallback. With WithPlanInheritSession, the user inputs are recorded so that the request
+// and the conclusion are kept in the agent session for later turns.
+func (s *Strategy) conclude(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+	var resp *gollem.ExecuteResponse
+	if s.resultSchema != nil {
+		var err error
+		resp, err = getStructuredConclusion(ctx, s.client, s.plan, s.resultSchema, s.middleware, state.SystemPrompt, s.inheritedHistory)
+		if err != nil {
+			return nil, nil, goerr.Wrap(err, "failed to conclude plan by result schema")
+		}
+		// It replaces the direct response of a plan without tasks, which records the inputs
+		if len(s.plan.Tasks) == 0 {
+			resp.UserInputs = state.InitInput
+		}
+	} else {
+		var err error
+		resp, err = getFinalConclusion(ctx, s.client, s.plan, s.middleware, s.streamMW, state.SystemPrompt, s.inheritedHistory, s.streamHandler)
+		if err != nil {
+			resp = generateFinalResponse(ctx, s.plan)
+		}
+	}
+	if s.inheritSession {
+		resp.UserInputs = state.InitInput
+	}
+	return nil, resp, nil
+}
+
+// contextHistory returns the conversation history given to planning, reflection and simulation
+// sessions: the agent session history with WithPlanInheritSession, or the agent's initial history
+// otherwise.
+func (s *Strategy) contextHistory(state *gollem.StrategyState) *gollem.History {
+	if s.inheritedHistory != nil {
+		return s.inheritedHistory
+	}
+	return state.History
+}
+
+// applyReflection applies task updates and new tasks from reflection to the plan
+func (s *Strategy) applyReflection(ctx context.Context, reflectionResult *reflectionResult) error {
+	// Apply task updates from reflection
+	hasChanges := false
+	if len(reflectionResult.UpdatedTasks) > 0 {
+		taskMap := make(map[string]*Task)
+		for i := range s.plan.Tasks {
+			taskMap[s.plan.Tasks[i].ID] = &s.plan.Tasks[i]
+		}
+		for _, updatedTask := range reflectionResult.UpdatedTasks {
+			if task, exists := taskMap[updatedTask.ID]; exists {
+				task.Description = updatedTask.Description
+				task.State = updatedTask.State
+				if task.State == TaskStateSkipped {
+					task.SkipReason = reflectionResult.Reason
+				}
+			}
+		}
+		hasChanges = true
+	}
+
+	// Add new tasks from reflection
+	if len(reflectionResult.NewTasks) > 0 {
+		s.plan.Tasks = append(s.plan.Tasks, reflectionResult.NewTasks...)
+		hasChanges = true
+	}
+
+	// Hook: plan updated (tasks added or modified)
+	if hasChanges && s.hooks != nil {
+		if err := s.hooks.OnPlanUpdated(ctx, s.plan); err != nil {
+			return goerr.Wrap(err, "hook OnPlanUpdated failed")
+		}
+	}
+
+	if hasChanges {
+		s.notifyProgress()
+	}
+
+	// Trace event: plan updated
+	if hasChanges {
+		if rec := trace.HandlerFrom(ctx); rec != nil {
+			var updated []PlanTaskInfo
+			for _, t := range reflectionResult.UpdatedTasks {
+				updated = append(updated, PlanTaskInfo{ID: t.ID, Description: t.Description, State: string(t.State)})
+			}
+			var newTasks []PlanTaskInfo
+			for _, t := range reflectionResult.NewTasks {
+				newTasks = append(newTasks, PlanTaskInfo{ID: t.ID, Description: t.Description, State: string(t.State)})
+			}
+			rec.AddEvent(ctx, "plan_updated", &PlanUpdatedEvent{
+				UpdatedTasks: updated,
+				NewTasks:     newTasks,
+			})
+		}
+	}
+
+	return nil
+}
+
 // Tools returns the tools that this strategy provides
 func (s *Strategy) Tools(ctx context.Context) ([]gollem.Tool, error) {
 	// Plan & Execute strategy does not provide additional tools
 	return []gollem.Tool{}, nil
 }
 
+// Plan returns a copy of the current plan, or nil before planning. It is safe to call from
+// other goroutines while Execute runs, e.g. to show progress in a UI. The copy reflects the plan
+// as of the last state change: plan creation, task start, task completion or reflection.
+func (s *Strategy) Plan() *Plan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.published == nil {
+		return nil
+	}
+	return clonePlan(s.published)
+}
+
+// Usage returns the token usage of the latest Execute with the strategy, broken down by phase:
+// gollem.UsagePhasePlan, gollem.UsagePhaseExecute for tasks, gollem.UsagePhaseReflect,
+// gollem.UsagePhaseSummarize for the conclusion and compaction, and a phase of each subagent.
+// It is safe to call while Execute runs, and returns an empty Usage before Execute.
+func (s *Strategy) Usage() *gollem.Usage {
+	s.mu.RLock()
+	usage := s.usage
+	s.mu.RUnlock()
+	if usage == nil {
+		return &gollem.Usage{}
+	}
+	return usage.Usage()
+}
+
+func (s *Strategy) setUsage(usage *gollem.UsageTracker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = usage
+}
+
+// SnapshotState returns a copy of the current plan for gollem.Snapshot, or nil before planning.
+func (s *Strategy) SnapshotState() any {
+	if plan := s.Plan(); plan != nil {
+		return plan
+	}
+	return nil
+}
+
+// publishPlan stores a copy of the working plan for concurrent readers. The working plan is only
+// accessed by Execute, so hooks can modify it without locking.
+func (s *Strategy) publishPlan() {
+	var published *Plan
+	if s.plan != nil {
+		published = clonePlan(s.plan)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = published
+}
+
+var _ gollem.StrategySnapshotter = (*Strategy)(nil)
+
 // Option functions
 
 // WithMiddleware sets the content block middleware
@@ -240,6 +427,15 @@ func WithMiddleware(middleware ...gollem.ContentBlockMiddleware) Option {
 	}
 }
 
+// WithStreamMiddleware sets the content stream middleware of the conclusion streamed to the
+// handler of WithPlanStreamHandler. Content block middlewares of WithMiddleware are not applied
+// to the streamed conclusion, so set their stream variants here, e.g. of a shared rate limit.
+func WithStreamMiddleware(middleware ...gollem.ContentStreamMiddleware) Option {
+	return func(s *Strategy) {
+		s.streamMW = append(s.streamMW, middleware...)
+	}
+}
+
 // WithHooks sets the lifecycle hooks
 func WithHooks(hooks PlanExecuteHooks) Option {
 	return func(s *Strategy) {
@@ -254,6 +450,16 @@ func WithMaxIterations(max int) Option {
 	}
 }
 
+// WithTaskOrder sets the policy choosing the next pending task, e.g. TaskOrderPriority to run
+// important tasks first within a tight iteration limit. The default is TaskOrderAsPlanned.
+// Priority and Effort are estimated by the planner, and can be set with WithPlan or in
+// PlanExecuteHooks.OnPlanCreated.
+func WithTaskOrder(order TaskOrder) Option {
+	return func(s *Strategy) {
+		s.taskOrder = order
+	}
+}
+
 // WithPlan sets a pre-generated plan to use (skips planning phase)
 func WithPlan(plan *Plan) Option {
 	return func(s *Strategy) {
@@ -261,3 +467,44 @@ func WithPlan(plan *Plan) Option {
 		s.planProvidedByUser = true
 	}
 }
+
+// WithPlanDryRun makes the strategy generate and reflect on the plan without running any tool.
+// Each task is simulated: the model is given the tools as specs and its tool calls are answered
+// with stub responses, so it describes what it would do and what it expects. Execute returns a
+// readable preview, and ExecutionPreview returns it with the estimated cost for approval
+// workflows.
+func WithPlanDryRun() Option {
+	return func(s *Strategy) {
+		s.dryRun = true
+	}
+}
+
+// WithPlanBudget limits the estimated cost in USD of each Execute with the strategy, including
+// planning, tasks, reflection and the conclusion. When the cost reaches maxUSD, Execute fails
+// with gollem.ErrBudgetExceeded before the next LLM call, unless gollem.WithBudgetExceededHook
+// is given.
+func WithPlanBudget(maxUSD float64, opts ...gollem.BudgetOption) Option {
+	return func(s *Strategy) {
+		s.budgetMaxUSD = maxUSD
+		s.budgetOptions = append(s.budgetOptions, opts...)
+	}
+}
+
+// WithPlanTokenBudget limits the total input and output tokens of each Execute with the
+// strategy in the same way as WithPlanBudget.
+func WithPlanTokenBudget(maxTokens int, opts ...gollem.BudgetOption) Option {
+	return func(s *Strategy) {
+		s.budgetMaxTokens = maxTokens
+		s.budgetOptions = append(s.budgetOptions, opts...)
+	}
+}
+
+// WithPlanInheritSession makes planning, reflection and conclusion sessions start from the
+// current history of the agent session, so that they use the context of previous Execute calls
+// without passing it manually. The user inputs are also added to the agent session with the
+// conclusion, so that later turns can refer to the request and its outcome.
+func WithPlanInheritSession() Option {
+	return func(s *Strategy) {
+		s.inheritSession = true
+	}
+}
@@ -3,15 +3,18 @@ package planexec_test
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"testing"
 
+	"cloud.google.com/go/auth"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
 	"github.com/m-mizutani/gollem/llm/claude"
 	"github.com/m-mizutani/gollem/llm/gemini"
 	"github.com/m-mizutani/gollem/llm/openai"
+	"github.com/m-mizutani/gollem/llm/vcr"
 	"github.com/m-mizutani/gollem/mock"
 	"github.com/m-mizutani/gollem/strategy/planexec"
 	"github.com/m-mizutani/gt"
@@ -461,7 +464,8 @@ func TestPlanExecuteWithLLMs(t *testing.T) {
 	// Helper function for testing with Agent.Execute
 	testWithAgent := func(client gollem.LLMClient, _ string) func(t *testing.T) {
 		return func(t *testing.T) {
-			ctx := context.Background()
+			// Task IDs are in prompts, so they must be the same as recorded in cassettes
+			ctx := gollem.ContextWithIDGenerator(context.Background(), gollem.NewSequentialIDGenerator("task-"))
 
 			// Test with multiple tool calls
 			var toolCallCount int32
@@ -553,11 +557,15 @@ func TestPlanExecuteWithLLMs(t *testing.T) {
 	t.Run("OpenAI", func(t *testing.T) {
 		t.Parallel()
 		apiKey := os.Getenv("TEST_OPENAI_API_KEY")
-		if apiKey == "" {
-			t.Skip("TEST_OPENAI_API_KEY or OPENAI_API_KEY is not set")
+		var options []openai.Option
+		if rec := newCassette(t, apiKey); rec != nil {
+			options = append(options, openai.WithHTTPMiddleware(rec.Middleware()))
+			if rec.Mode() == vcr.ModeReplay {
+				apiKey = "dummy"
+			}
 		}
 
-		client, err := openai.New(context.Background(), apiKey)
+		client, err := openai.New(context.Background(), apiKey, options...)
 		gt.NoError(t, err)
 
 		testWithAgent(client, "OpenAI")(t)
@@ -567,11 +575,16 @@ func TestPlanExecuteWithLLMs(t *testing.T) {
 	t.Run("Claude", func(t *testing.T) {
 		t.Parallel()
 		apiKey := os.Getenv("TEST_CLAUDE_API_KEY")
-		if apiKey == "" {
-			t.Skip("TEST_CLAUDE_API_KEY or ANTHROPIC_API_KEY is not set")
+		var options []claude.Option
+		// The base URL may be overridden by ANTHROPIC_BASE_URL, so that requests are matched by body
+		if rec := newCassette(t, apiKey, vcr.WithMatcher(vcr.BodyMatcher)); rec != nil {
+			options = append(options, claude.WithHTTPMiddleware(rec.Middleware()))
+			if rec.Mode() == vcr.ModeReplay {
+				apiKey = "dummy"
+			}
 		}
 
-		client, err := claude.New(context.Background(), apiKey)
+		client, err := claude.New(context.Background(), apiKey, options...)
 		gt.NoError(t, err)
 
 		testWithAgent(client, "Claude")(t)
@@ -582,18 +595,65 @@ func TestPlanExecuteWithLLMs(t *testing.T) {
 		t.Parallel()
 		projectID := os.Getenv("TEST_GCP_PROJECT_ID")
 		location := os.Getenv("TEST_GCP_LOCATION")
+		var key string
+		if projectID != "" && location != "" {
+			key = projectID
+		}
 
-		if projectID == "" || location == "" {
-			t.Skip("Required Gemini env vars not set")
+		// URLs of Vertex AI contain the project ID, so that requests are matched by body
+		var options []gemini.Option
+		if rec := newCassette(t, key, vcr.WithMatcher(vcr.BodyMatcher)); rec != nil {
+			options = append(options, gemini.WithHTTPMiddleware(rec.Middleware()))
+			if rec.Mode() == vcr.ModeReplay {
+				projectID, location = "test-project", "us-central1"
+				options = append(options, gemini.WithCredentials(auth.NewCredentials(&auth.CredentialsOptions{
+					TokenProvider: staticTokenProvider("dummy"),
+				})))
+			}
 		}
 
-		client, err := gemini.New(context.Background(), projectID, location)
+		client, err := gemini.New(context.Background(), projectID, location, options...)
 		gt.NoError(t, err)
 
 		testWithAgent(client, "Gemini")(t)
 	})
 }
 
+// newCassette returns a recorder of the provider API calls of the test. The cassette at
+// testdata/cassettes/<test name>.json is replayed if it exists, and recorded with the real API
+// key if TEST_VCR_RECORD is set. It returns nil to call the API without recording if only the
+// API key is available, and skips the test if neither is available.
+func newCassette(t *testing.T, apiKey string, options ...vcr.Option) *vcr.Recorder {
+	t.Helper()
+	path := filepath.Join("testdata", "cassettes", strings.ReplaceAll(t.Name(), "/", "_")+".json")
+
+	if os.Getenv("TEST_VCR_RECORD") != "" {
+		if apiKey == "" {
+			t.Skip("API key is required to record " + path)
+		}
+		rec, err := vcr.New(path, append(options, vcr.WithMode(vcr.ModeRecord))...)
+		gt.NoError(t, err)
+		return rec
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		rec, err := vcr.New(path, options...)
+		gt.NoError(t, err)
+		return rec
+	}
+
+	if apiKey == "" {
+		t.Skip("neither API key nor cassette is available: " + path)
+	}
+	return nil
+}
+
+type staticTokenProvider string
+
+func (p staticTokenProvider) Token(ctx context.Context) (*auth.Token, error) {
+	return &auth.Token{Value: string(p), Type: "Bearer"}, nil
+}
+
 func TestExternalPlanGeneration(t *testing.T) {
 	ctx := context.Background()
 
@@ -773,6 +833,55 @@ func TestWithPlanOption(t *testing.T) {
 		gt.V(t, callCount).Equal(3)
 	})
 
+	t.Run("Task tool choice is applied to task execution", func(t *testing.T) {
+		noTools := gollem.ToolChoiceNone()
+		prePlan := &planexec.Plan{
+			Goal: "Calculate 2 + 2",
+			Tasks: []planexec.Task{
+				{
+					ID:          "task-1",
+					Description: "Add 2 and 2 without tools",
+					State:       planexec.TaskStatePending,
+					ToolChoice:  &noTools,
+				},
+			},
+		}
+
+		var choices []*gollem.ToolChoice
+		mockClient := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						cfg := gollem.NewGenerateConfig(opts...)
+						choices = append(choices, cfg.ToolChoice())
+						switch len(choices) {
+						case 1:
+							return &gollem.Response{Texts: []string{"The result is 4"}}, nil
+						case 2:
+							return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "done"}`}}, nil
+						default:
+							return &gollem.Response{Texts: []string{"The answer is 4."}}, nil
+						}
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return &gollem.History{}, nil
+					},
+				}, nil
+			},
+		}
+
+		strategy := planexec.New(mockClient, planexec.WithPlan(prePlan))
+		agent := gollem.New(mockClient, gollem.WithStrategy(strategy))
+		_, err := agent.Execute(ctx, gollem.Text("Calculate 2 + 2"))
+		gt.NoError(t, err)
+
+		// Only the task execution call gets the tool choice, not reflection or conclusion
+		gt.A(t, choices).Length(3)
+		gt.V(t, choices[0]).Equal(&noTools)
+		gt.V(t, choices[1]).Nil()
+		gt.V(t, choices[2]).Nil()
+	})
+
 	t.Run("Strategy with pre-generated plan - direct response", func(t *testing.T) {
 		// Create a plan with no tasks (direct response)
 		prePlan := &planexec.Plan{
@@ -1318,3 +1427,214 @@ func TestSystemPromptInReflectionAndConclusion(t *testing.T) {
 		gt.Equal(t, systemPrompt, conclusionSystemPrompt)
 	})
 }
+
+func TestSnapshotState(t *testing.T) {
+	gt.Nil(t, planexec.New(&mock.LLMClientMock{}).SnapshotState())
+
+	plan := &planexec.Plan{
+		Goal:  "Find the root cause",
+		Tasks: []planexec.Task{{ID: "t1", Description: "Check logs", State: planexec.TaskStatePending}},
+	}
+	state := planexec.New(&mock.LLMClientMock{}, planexec.WithPlan(plan)).SnapshotState()
+	snapshot, ok := state.(*planexec.Plan)
+	gt.True(t, ok)
+	gt.Equal(t, "Find the root cause", snapshot.Goal)
+
+	// the snapshot is not affected by later plan updates
+	plan.Tasks[0].State = planexec.TaskStateCompleted
+	gt.Equal(t, planexec.TaskStatePending, snapshot.Tasks[0].State)
+}
+
+func TestPlanConcurrentRead(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Check servers",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "Check server A", State: planexec.TaskStatePending},
+			{ID: "task-2", Description: "Check server B", State: planexec.TaskStatePending},
+		},
+	}
+
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					text, _ := input[0].(gollem.Text)
+					if strings.Contains(string(text), "# Task Reflection") {
+						return &gollem.Response{Texts: []string{`{"new_tasks": ["Report the result"], "updated_tasks": [], "reason": "report is needed"}`}}, nil
+					}
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	strategy := planexec.New(mockClient, planexec.WithPlan(plan), planexec.WithMaxIterations(4))
+	agent := gollem.New(mockClient, gollem.WithStrategy(strategy))
+
+	// poll the plan like a progress UI while Execute updates it; run with -race to detect races
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if p := strategy.Plan(); p != nil {
+				for _, task := range p.Tasks {
+					_ = task.State
+				}
+			}
+		}
+	}()
+
+	_, err := agent.Execute(context.Background(), gollem.Text("Check servers"))
+	close(done)
+	<-polled
+	gt.NoError(t, err)
+
+	result := strategy.Plan()
+	gt.NotNil(t, result)
+	gt.A(t, result.Tasks).Longer(2)
+	gt.Equal(t, planexec.TaskStateCompleted, result.Tasks[0].State)
+
+	// the returned plan is a copy
+	result.Tasks[0].State = planexec.TaskStatePending
+	gt.Equal(t, planexec.TaskStateCompleted, strategy.Plan().Tasks[0].State)
+}
+
+func TestSkipReason(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Calculate 2 + 2",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "Calculate", State: planexec.TaskStatePending},
+			{ID: "task-2", Description: "Verify", State: planexec.TaskStatePending},
+		},
+	}
+
+	var calls int
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					switch calls {
+					case 1:
+						return &gollem.Response{Texts: []string{"The result is 4"}}, nil
+					case 2:
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [{"id": "task-2", "description": "Verify", "state": "skipped"}], "reason": "the result is obvious"}`}}, nil
+					default:
+						return &gollem.Response{Texts: []string{"The answer is 4."}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	agent := gollem.New(mockClient, gollem.WithStrategy(planexec.New(mockClient, planexec.WithPlan(plan))))
+	_, err := agent.Execute(context.Background(), gollem.Text("Calculate 2 + 2"))
+	gt.NoError(t, err)
+
+	gt.Equal(t, planexec.TaskStateCompleted, plan.Tasks[0].State)
+	gt.Equal(t, "", plan.Tasks[0].SkipReason)
+	gt.Equal(t, planexec.TaskStateSkipped, plan.Tasks[1].State)
+	gt.Equal(t, "the result is obvious", plan.Tasks[1].SkipReason)
+}
+
+func TestPlanInheritSession(t *testing.T) {
+	textMessage := func(role gollem.MessageRole, text string) gollem.Message {
+		content, err := gollem.NewTextContent(text)
+		gt.NoError(t, err)
+		return gollem.Message{Role: role, Contents: []gollem.MessageContent{content}}
+	}
+	previous := &gollem.History{
+		Version: gollem.HistoryVersion,
+		Messages: []gollem.Message{
+			textMessage(gollem.RoleUser, "The project code is X-42"),
+			textMessage(gollem.RoleAssistant, "Noted"),
+		},
+	}
+
+	run := func(t *testing.T, opts ...planexec.Option) (map[string]*gollem.History, []*gollem.History) {
+		// history given to each internal session by the header of its prompt
+		histories := map[string]*gollem.History{}
+		var appended []*gollem.History
+
+		var sessions int
+		mockClient := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				sessions++
+				if sessions == 1 {
+					// agent session with a previous turn
+					return &mock.SessionMock{
+						GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+							return &gollem.Response{Texts: []string{"X-42 is active"}}, nil
+						},
+						HistoryFunc: func() (*gollem.History, error) {
+							return previous, nil
+						},
+						AppendHistoryFunc: func(h *gollem.History) error {
+							appended = append(appended, h)
+							return nil
+						},
+					}, nil
+				}
+
+				cfg := gollem.NewSessionConfig(options...)
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						text := string(input[0].(gollem.Text))
+						header, _, _ := strings.Cut(text, "\n")
+						histories[header] = cfg.History()
+						switch header {
+						case "# Task Analysis and Planning":
+							return &gollem.Response{Texts: []string{`{"needs_plan": true, "goal": "check the project", "tasks": [{"description": "check status"}]}`}}, nil
+						case "# Final Conclusion":
+							return &gollem.Response{Texts: []string{"X-42 is active."}}, nil
+						default:
+							return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": []}`}}, nil
+						}
+					},
+				}, nil
+			},
+		}
+
+		agent := gollem.New(mockClient, gollem.WithStrategy(planexec.New(mockClient, opts...)))
+		_, err := agent.Execute(context.Background(), gollem.Text("Check the status of the project"))
+		gt.NoError(t, err)
+		return histories, appended
+	}
+
+	t.Run("inherit agent session", func(t *testing.T) {
+		histories, appended := run(t, planexec.WithPlanInheritSession())
+
+		for _, header := range []string{"# Task Analysis and Planning", "# Task Reflection", "# Final Conclusion"} {
+			gt.NotNil(t, histories[header])
+			gt.Equal(t, 2, len(histories[header].Messages))
+		}
+
+		// user request and conclusion are merged into the agent session
+		gt.A(t, appended).Length(2)
+		gt.Equal(t, gollem.RoleUser, appended[0].Messages[0].Role)
+		text, err := appended[0].Messages[0].Contents[0].GetTextContent()
+		gt.NoError(t, err)
+		gt.Equal(t, "Check the status of the project", text.Text)
+		gt.Equal(t, gollem.RoleAssistant, appended[1].Messages[0].Role)
+	})
+
+	t.Run("without inheritance", func(t *testing.T) {
+		histories, appended := run(t)
+
+		gt.Nil(t, histories["# Task Analysis and Planning"])
+		gt.Nil(t, histories["# Final Conclusion"])
+		gt.A(t, appended).Length(1)
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -33,7 +35,7 @@ var (
 )
 
 // buildPlanPrompt creates a prompt for analyzing and planning
-func buildPlanPrompt(_ context.Context, inputs []gollem.Input, tools []gollem.Tool) []gollem.Input {
+func buildPlanPrompt(ctx context.Context, inputs []gollem.Input, tools []gollem.Tool) []gollem.Input {
 	// Combine all input texts
 	var inputTexts []string
 	for _, input := range inputs {
@@ -47,13 +49,15 @@ func buildPlanPrompt(_ context.Context, inputs []gollem.Input, tools []gollem.To
 	// Build tool list
 	toolList := buildToolList(tools)
 
-	var buf bytes.Buffer
-	if err := planTemplate.Execute(&buf, map[string]interface{}{
+	data := map[string]any{
 		"UserRequest": userRequest,
 		"ToolList":    toolList,
-	}); err != nil {
+	}
+	var buf bytes.Buffer
+	if err := planTemplate.Execute(&buf, data); err != nil {
 		panic(goerr.Wrap(err, "failed to execute plan template"))
 	}
+	tracePrompt(ctx, gollem.UsagePhasePlan, "plan", data, buf.String())
 
 	return []gollem.Input{gollem.Text(buf.String())}
 }
@@ -80,8 +84,7 @@ func buildExecutePrompt(ctx context.Context, task *Task, plan *Plan, currentIter
 
 	remainingIterations := maxIterations - currentIteration
 
-	var buf bytes.Buffer
-	if err := executeTemplate.Execute(&buf, map[string]interface{}{
+	data := map[string]any{
 		"Goal":                plan.Goal,
 		"ContextSummary":      plan.ContextSummary,
 		"Constraints":         plan.Constraints,
@@ -91,9 +94,12 @@ func buildExecutePrompt(ctx context.Context, task *Task, plan *Plan, currentIter
 		"MaxIterations":       maxIterations,
 		"CompletedTaskCount":  completedTaskCount,
 		"RemainingIterations": remainingIterations,
-	}); err != nil {
+	}
+	var buf bytes.Buffer
+	if err := executeTemplate.Execute(&buf, data); err != nil {
 		panic(goerr.Wrap(err, "failed to execute execute template"))
 	}
+	tracePrompt(ctx, gollem.UsagePhaseExecute, "execute", data, buf.String())
 
 	return []gollem.Input{gollem.Text(buf.String())}
 }
@@ -132,8 +138,7 @@ func buildReflectPrompt(ctx context.Context, plan *Plan, latestResult string, to
 	// Build tool list
 	toolList := buildToolList(tools)
 
-	var buf bytes.Buffer
-	if err := reflectTemplate.Execute(&buf, map[string]interface{}{
+	data := map[string]any{
 		"UserIntent":          plan.UserIntent,
 		"Goal":                plan.Goal,
 		"ContextSummary":      plan.ContextSummary, // Embedded context from planning phase
@@ -146,9 +151,12 @@ func buildReflectPrompt(ctx context.Context, plan *Plan, latestResult string, to
 		"MaxIterations":       maxIterations,
 		"CompletedTaskCount":  completedTaskCount,
 		"RemainingIterations": remainingIterations,
-	}); err != nil {
+	}
+	var buf bytes.Buffer
+	if err := reflectTemplate.Execute(&buf, data); err != nil {
 		panic(goerr.Wrap(err, "failed to execute reflect template"))
 	}
+	tracePrompt(ctx, gollem.UsagePhaseReflect, "reflect", data, buf.String())
 
 	return []gollem.Input{gollem.Text(buf.String())}
 }
@@ -166,13 +174,9 @@ func buildToolList(tools []gollem.Tool) string {
 
 		// Add parameter information if available
 		if len(spec.Parameters) > 0 {
-			var params []string
-			for paramName := range spec.Parameters {
-				params = append(params, paramName)
-			}
-			if len(params) > 0 {
-				toolDesc += fmt.Sprintf("\n  Parameters: %s", strings.Join(params, ", "))
-			}
+			// Sorted so that the prompt is the same for the same tools
+			params := slices.Sorted(maps.Keys(spec.Parameters))
+			toolDesc += fmt.Sprintf("\n  Parameters: %s", strings.Join(params, ", "))
 		}
 
 		toolDescriptions = append(toolDescriptions, toolDesc)
@@ -182,16 +186,28 @@ func buildToolList(tools []gollem.Tool) string {
 }
 
 // buildConclusionPrompt creates a prompt for generating the final conclusion
-func buildConclusionPrompt(plan *Plan, taskSummaries []string) string {
-	var buf bytes.Buffer
-	if err := conclusionTemplate.Execute(&buf, map[string]interface{}{
+func buildConclusionPrompt(ctx context.Context, plan *Plan, taskSummaries []string) string {
+	data := map[string]any{
 		"UserQuestion":   plan.UserQuestion,
 		"UserIntent":     plan.UserIntent,
 		"Goal":           plan.Goal,
 		"CompletedTasks": strings.Join(taskSummaries, "\n"),
-	}); err != nil {
+	}
+	var buf bytes.Buffer
+	if err := conclusionTemplate.Execute(&buf, data); err != nil {
 		panic(goerr.Wrap(err, "failed to execute conclusion template"))
 	}
+	tracePrompt(ctx, gollem.UsagePhaseSummarize, "conclusion", data, buf.String())
 
 	return buf.String()
 }
+
+// tracePrompt records the prompt rendered from the template to the trace of ctx.
+func tracePrompt(ctx context.Context, phase, template string, data map[string]any, prompt string) {
+	gollem.TracePrompt(ctx, &gollem.PromptEvent{
+		Phase:    phase,
+		Template: template,
+		Data:     data,
+		Prompt:   prompt,
+	})
+}
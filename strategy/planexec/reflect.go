@@ -3,23 +3,52 @@ package planexec
 import (
 	"context"
 	"encoding/json"
-
-	"github.com/google/uuid"
+	"strings"
 
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
 )
 
 // reflectionResult holds the result of reflection
 type reflectionResult struct {
 	UpdatedTasks []Task // Modified tasks
 	NewTasks     []Task // New tasks to add
+	Reason       string // Explanation of the changes
 }
 
 // reflect performs reflection after task completion to update or add tasks
 // It evaluates task results against the Plan, which contains all necessary context and constraints.
 // This is an internal analysis process - the conversation history is not preserved
 func reflect(ctx context.Context, client gollem.LLMClient, plan *Plan, completedTask *Task, tools []gollem.Tool, middleware []gollem.ContentBlockMiddleware, currentIteration, maxIterations int, history *gollem.History, systemPrompt string) (*reflectionResult, error) {
+	// Build reflection prompt
+	reflectPrompt := buildReflectPrompt(ctx, plan, completedTask.Result, tools, currentIteration, maxIterations)
+
+	result, response, err := runReflection(ctx, client, plan, reflectPrompt, middleware, history, systemPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trace event: reflection with all inputs to replay it by ReplayReflection
+	if rec := trace.HandlerFrom(ctx); rec != nil {
+		event := &ReflectionEvent{
+			TaskID:       completedTask.ID,
+			Iteration:    currentIteration,
+			Plan:         clonePlan(plan),
+			SystemPrompt: systemPrompt,
+			History:      history.Clone(),
+			Prompt:       inputText(reflectPrompt),
+		}
+		event.setResult(result, response)
+		rec.AddEvent(ctx, "reflection", event)
+	}
+
+	return result, nil
+}
+
+// runReflection generates a reflection for prompt and parses it against plan. It also returns
+// the raw response text.
+func runReflection(ctx context.Context, client gollem.LLMClient, plan *Plan, prompt []gollem.Input, middleware []gollem.ContentBlockMiddleware, history *gollem.History, systemPrompt string) (*reflectionResult, string, error) {
 	// Create a new session for reflection with JSON content type
 	// NOTE: Do NOT pass tools to reflection session.
 	// - Tools: When provided, some LLM providers (like Gemini) prioritize function calls
@@ -41,25 +70,26 @@ func reflect(ctx context.Context, client gollem.LLMClient, plan *Plan, completed
 
 	session, err := client.NewSession(ctx, sessionOpts...)
 	if err != nil {
-		return nil, goerr.Wrap(err, "failed to create session for reflection")
+		return nil, "", goerr.Wrap(err, "failed to create session for reflection")
 	}
 
-	// Build reflection prompt
-	reflectPrompt := buildReflectPrompt(ctx, plan, completedTask.Result, tools, currentIteration, maxIterations)
-
 	// Generate reflection using LLM
-	response, err := session.Generate(ctx, reflectPrompt)
+	if err := gollem.CheckBudget(ctx); err != nil {
+		return nil, "", err
+	}
+	response, err := session.Generate(ctx, prompt)
 	if err != nil {
-		return nil, goerr.Wrap(err, "failed to generate reflection")
+		return nil, "", goerr.Wrap(err, "failed to generate reflection")
 	}
+	gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseReflect), response)
 
 	// Parse the reflection response
 	result, err := parseReflectionFromResponse(ctx, response, plan)
 	if err != nil {
-		return nil, goerr.Wrap(err, "failed to parse reflection response")
+		return nil, "", goerr.Wrap(err, "failed to parse reflection response")
 	}
 
-	return result, nil
+	return result, strings.Join(response.Texts, ""), nil
 }
 
 // parseReflectionFromResponse extracts reflection results from LLM response
@@ -95,10 +125,12 @@ func parseReflectionFromResponse(ctx context.Context, response *gollem.Response,
 		return result, nil
 	}
 
+	result.Reason = reflectionResponse.Reason
+
 	// Process new tasks
 	for _, taskDesc := range reflectionResponse.NewTasks {
 		result.NewTasks = append(result.NewTasks, Task{
-			ID:          uuid.New().String(),
+			ID:          gollem.NewID(ctx),
 			Description: taskDesc,
 			State:       TaskStatePending,
 		})
@@ -0,0 +1,156 @@
+package planexec
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// ReplayOption is an option of ReplayReflection
+type ReplayOption func(*replayConfig)
+
+type replayConfig struct {
+	prompt       *string
+	systemPrompt *string
+	middleware   []gollem.ContentBlockMiddleware
+}
+
+// WithReplayPrompt replaces the recorded reflection prompt, e.g. with an edited copy of
+// event.Prompt.
+func WithReplayPrompt(prompt string) ReplayOption {
+	return func(c *replayConfig) {
+		c.prompt = &prompt
+	}
+}
+
+// WithReplaySystemPrompt replaces the recorded system prompt.
+func WithReplaySystemPrompt(systemPrompt string) ReplayOption {
+	return func(c *replayConfig) {
+		c.systemPrompt = &systemPrompt
+	}
+}
+
+// WithReplayMiddleware sets content block middleware of the replayed reflection.
+func WithReplayMiddleware(middleware ...gollem.ContentBlockMiddleware) ReplayOption {
+	return func(c *replayConfig) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// ReplayReflection runs a recorded reflection again with client, without running the plan, to
+// debug why the plan skipped or added tasks. Pass a client of another model, or change the prompt
+// with options, and compare the returned event with the recorded one. The returned event has the
+// inputs used for the replay and its new output.
+func ReplayReflection(ctx context.Context, client gollem.LLMClient, event *ReflectionEvent, opts ...ReplayOption) (*ReflectionEvent, error) {
+	if client == nil {
+		return nil, goerr.New("client is required")
+	}
+	if event == nil || event.Plan == nil {
+		return nil, goerr.New("reflection event with plan is required")
+	}
+
+	cfg := &replayConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	replay := &ReflectionEvent{
+		TaskID:       event.TaskID,
+		Iteration:    event.Iteration,
+		Plan:         clonePlan(event.Plan),
+		SystemPrompt: event.SystemPrompt,
+		History:      event.History.Clone(),
+		Prompt:       event.Prompt,
+	}
+	if cfg.prompt != nil {
+		replay.Prompt = *cfg.prompt
+	}
+	if cfg.systemPrompt != nil {
+		replay.SystemPrompt = *cfg.systemPrompt
+	}
+
+	result, response, err := runReflection(ctx, client, replay.Plan, []gollem.Input{gollem.Text(replay.Prompt)}, cfg.middleware, replay.History, replay.SystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	replay.setResult(result, response)
+
+	return replay, nil
+}
+
+// ReflectionEvents returns reflection events recorded in t, in the order of execution. t is
+// usually loaded from a trace file, where event data is decoded as generic JSON.
+func ReflectionEvents(t *trace.Trace) ([]*ReflectionEvent, error) {
+	if t == nil || t.RootSpan == nil {
+		return nil, nil
+	}
+
+	var events []*ReflectionEvent
+	var walk func(span *trace.Span) error
+	walk = func(span *trace.Span) error {
+		if span.Event != nil && span.Event.Kind == "reflection" {
+			event, err := decodeReflectionEvent(span.Event.Data)
+			if err != nil {
+				return goerr.Wrap(err, "failed to decode reflection event", goerr.V("span_id", span.SpanID))
+			}
+			events = append(events, event)
+		}
+		for _, child := range span.Children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(t.RootSpan); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// decodeReflectionEvent converts event data recorded in memory or decoded from JSON.
+func decodeReflectionEvent(data any) (*ReflectionEvent, error) {
+	if event, ok := data.(*ReflectionEvent); ok {
+		return event, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal event data")
+	}
+	var event ReflectionEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal reflection event")
+	}
+	return &event, nil
+}
+
+// setResult sets the output of reflection to the event.
+func (e *ReflectionEvent) setResult(result *reflectionResult, response string) {
+	e.Response = response
+	e.Reason = result.Reason
+	e.UpdatedTasks = nil
+	for _, t := range result.UpdatedTasks {
+		e.UpdatedTasks = append(e.UpdatedTasks, PlanTaskInfo{ID: t.ID, Description: t.Description, State: string(t.State)})
+	}
+	e.NewTasks = nil
+	for _, t := range result.NewTasks {
+		e.NewTasks = append(e.NewTasks, PlanTaskInfo{ID: t.ID, Description: t.Description, State: string(t.State)})
+	}
+}
+
+// inputText returns the texts of inputs joined.
+func inputText(inputs []gollem.Input) string {
+	var texts []string
+	for _, input := range inputs {
+		if text, ok := input.(gollem.Text); ok {
+			texts = append(texts, string(text))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
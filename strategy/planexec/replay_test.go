@@ -0,0 +1,104 @@
+package planexec_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func TestReplayReflection(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Calculate 2 + 2",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "Calculate", State: planexec.TaskStatePending},
+			{ID: "task-2", Description: "Verify", State: planexec.TaskStatePending},
+		},
+	}
+
+	var calls int
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					switch calls {
+					case 1:
+						return &gollem.Response{Texts: []string{"The result is 4"}}, nil
+					case 2:
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [{"id": "task-2", "description": "Verify", "state": "skipped"}], "reason": "the result is obvious"}`}}, nil
+					default:
+						return &gollem.Response{Texts: []string{"The answer is 4."}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	rec := trace.New()
+	agent := gollem.New(mockClient,
+		gollem.WithStrategy(planexec.New(mockClient, planexec.WithPlan(plan))),
+		gollem.WithSystemPrompt("You are a calculator"),
+		gollem.WithTrace(rec),
+	)
+	_, err := agent.Execute(context.Background(), gollem.Text("Calculate 2 + 2"))
+	gt.NoError(t, err)
+
+	// load events as from a trace file
+	data, err := json.Marshal(rec.Trace())
+	gt.NoError(t, err)
+	var loaded trace.Trace
+	gt.NoError(t, json.Unmarshal(data, &loaded))
+
+	events, err := planexec.ReflectionEvents(&loaded)
+	gt.NoError(t, err)
+	gt.A(t, events).Length(1)
+
+	event := events[0]
+	gt.Equal(t, "task-1", event.TaskID)
+	gt.Equal(t, "You are a calculator", event.SystemPrompt)
+	gt.S(t, event.Prompt).Contains("# Task Reflection")
+	gt.S(t, event.Prompt).Contains("The result is 4")
+	gt.Equal(t, planexec.TaskStateCompleted, event.Plan.Tasks[0].State)
+	gt.Equal(t, "the result is obvious", event.Reason)
+	gt.A(t, event.UpdatedTasks).Length(1)
+	gt.Equal(t, "skipped", event.UpdatedTasks[0].State)
+
+	// replay with a modified prompt and another model
+	var replayedPrompt, replayedSystemPrompt string
+	otherModel := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			replayedSystemPrompt = cfg.SystemPrompt()
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					replayedPrompt = string(input[0].(gollem.Text))
+					return &gollem.Response{Texts: []string{`{"new_tasks": ["Double-check with another method"], "updated_tasks": [], "reason": "verification is required"}`}}, nil
+				},
+			}, nil
+		},
+	}
+
+	replay, err := planexec.ReplayReflection(context.Background(), otherModel, event,
+		planexec.WithReplayPrompt(event.Prompt+"\nAlways verify results."),
+	)
+	gt.NoError(t, err)
+
+	gt.S(t, replayedPrompt).Contains("Always verify results.")
+	gt.Equal(t, "You are a calculator", replayedSystemPrompt)
+	gt.Equal(t, "verification is required", replay.Reason)
+	gt.A(t, replay.UpdatedTasks).Length(0)
+	gt.A(t, replay.NewTasks).Length(1)
+	gt.Equal(t, "Double-check with another method", replay.NewTasks[0].Description)
+
+	// the recorded event is not changed
+	gt.Equal(t, "the result is obvious", event.Reason)
+}
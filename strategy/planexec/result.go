@@ -0,0 +1,113 @@
+package planexec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// DefaultResultMaxRetry is the default number of retries of the conclusion when it does not
+// match the schema of WithPlanResultSchema.
+const DefaultResultMaxRetry = 3
+
+// ResultSchemaOption is an option of WithPlanResultSchema.
+type ResultSchemaOption func(*resultSchemaConfig)
+
+type resultSchemaConfig struct {
+	schema   *gollem.Parameter
+	maxRetry int
+}
+
+// WithResultMaxRetry sets the number of retries of the conclusion when it's not valid JSON
+// matching the schema. Default is DefaultResultMaxRetry.
+func WithResultMaxRetry(n int) ResultSchemaOption {
+	return func(cfg *resultSchemaConfig) {
+		cfg.maxRetry = max(n, 0)
+	}
+}
+
+// WithPlanResultSchema makes the final conclusion of the plan a JSON object matching schema,
+// e.g. a list of findings and a risk score, instead of prose. Execute returns the JSON in
+// ExecuteResponse.Texts. The conclusion is validated against schema and retried with the error
+// fed back to the LLM, and Execute fails if it does not match after the retries. A plan without
+// tasks is also concluded by schema instead of returning its direct response. The conclusion is
+// not streamed to WithPlanStreamHandler.
+func WithPlanResultSchema(schema *gollem.Parameter, opts ...ResultSchemaOption) Option {
+	cfg := &resultSchemaConfig{
+		schema:   schema,
+		maxRetry: DefaultResultMaxRetry,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(s *Strategy) {
+		s.resultSchema = cfg
+	}
+}
+
+// getStructuredConclusion generates the conclusion of the plan as JSON matching the schema.
+func getStructuredConclusion(ctx context.Context, client gollem.LLMClient, plan *Plan, cfg *resultSchemaConfig, middleware []gollem.ContentBlockMiddleware, systemPrompt string, history *gollem.History) (*gollem.ExecuteResponse, error) {
+	taskSummaries := completedTaskSummaries(plan)
+	if len(plan.Tasks) == 0 && plan.DirectResponse != "" {
+		taskSummaries = append(taskSummaries, fmt.Sprintf("- No task was needed. Answer: %s", plan.DirectResponse))
+	}
+	prompt := buildConclusionPrompt(ctx, plan, taskSummaries) +
+		"\n\nRespond with only a JSON object matching the response schema. Put the findings and results into its fields."
+
+	sessionOpts := []gollem.SessionOption{
+		gollem.WithSessionContentType(gollem.ContentTypeJSON),
+		gollem.WithSessionResponseSchema(cfg.schema),
+	}
+	if systemPrompt != "" {
+		sessionOpts = append(sessionOpts, gollem.WithSessionSystemPrompt(systemPrompt))
+	}
+	if history != nil {
+		sessionOpts = append(sessionOpts, gollem.WithSessionHistory(history))
+	}
+	for _, mw := range middleware {
+		sessionOpts = append(sessionOpts, gollem.WithSessionContentBlockMiddleware(mw))
+	}
+
+	session, err := client.NewSession(ctx, sessionOpts...)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to create session for conclusion")
+	}
+
+	ctx = gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseSummarize)
+	input := []gollem.Input{gollem.Text(prompt)}
+	for attempt := 0; ; attempt++ {
+		if err := gollem.CheckBudget(ctx); err != nil {
+			return nil, err
+		}
+
+		response, err := session.Generate(ctx, input)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to generate conclusion")
+		}
+		gollem.RecordUsage(ctx, response)
+
+		jsonText := strings.Join(response.Texts, "")
+		var raw any
+		validateErr := json.Unmarshal([]byte(jsonText), &raw)
+		if validateErr == nil {
+			validateErr = cfg.schema.ValidateValue("root", raw)
+		}
+		if validateErr == nil {
+			return &gollem.ExecuteResponse{Texts: []string{jsonText}}, nil
+		}
+
+		if attempt >= cfg.maxRetry {
+			return nil, goerr.Wrap(validateErr, "conclusion does not match the result schema after retries",
+				goerr.V("attempts", attempt+1),
+				goerr.V("response", jsonText))
+		}
+		input = []gollem.Input{gollem.Text(fmt.Sprintf(
+			"Your previous response was not valid JSON matching the schema. Error: %s\nYour response was: %s\nPlease respond with valid JSON matching the schema.",
+			validateErr.Error(), jsonText,
+		))}
+	}
+}
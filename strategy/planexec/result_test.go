@@ -0,0 +1,94 @@
+package planexec_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPlanResultSchema(t *testing.T) {
+	schema := &gollem.Parameter{
+		Type: gollem.TypeObject,
+		Properties: map[string]*gollem.Parameter{
+			"findings":   {Type: gollem.TypeArray, Items: &gollem.Parameter{Type: gollem.TypeString}, Required: true},
+			"risk_score": {Type: gollem.TypeInteger, Required: true},
+		},
+	}
+
+	// newClient returns a client whose conclusions are the given texts in order
+	newClient := func(planJSON string, conclusions ...string) (*mock.LLMClientMock, *[]gollem.SessionConfig) {
+		var conclusionSessions []gollem.SessionConfig
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				cfg := gollem.NewSessionConfig(options...)
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						text := string(input[0].(gollem.Text))
+						switch {
+						case strings.Contains(text, "# Task Analysis and Planning"):
+							return &gollem.Response{Texts: []string{planJSON}}, nil
+						case strings.Contains(text, "# Task Execution"):
+							return &gollem.Response{Texts: []string{"Port 22 is open"}}, nil
+						case strings.Contains(text, "# Task Reflection"):
+							return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "on track"}`}}, nil
+						default:
+							if strings.Contains(text, "# Final Conclusion") {
+								conclusionSessions = append(conclusionSessions, cfg)
+							}
+							resp := conclusions[0]
+							conclusions = conclusions[1:]
+							return &gollem.Response{Texts: []string{resp}}, nil
+						}
+					},
+				}, nil
+			},
+		}, &conclusionSessions
+	}
+	withTasks := `{"needs_plan": true, "goal": "Audit the host", "tasks": [{"description": "Scan ports"}]}`
+
+	t.Run("conclusion is retried until it matches the schema", func(t *testing.T) {
+		client, sessions := newClient(withTasks,
+			`{"findings": ["port 22 is open"]}`,
+			`{"findings": ["port 22 is open"], "risk_score": 3}`,
+		)
+		strategy := planexec.New(client, planexec.WithPlanResultSchema(schema))
+		resp, err := gollem.New(client, gollem.WithStrategy(strategy)).Execute(t.Context(), gollem.Text("Audit the host"))
+		gt.NoError(t, err)
+
+		var result struct {
+			Findings  []string `json:"findings"`
+			RiskScore int      `json:"risk_score"`
+		}
+		gt.NoError(t, json.Unmarshal([]byte(resp.String()), &result))
+		gt.Equal(t, []string{"port 22 is open"}, result.Findings)
+		gt.Equal(t, 3, result.RiskScore)
+
+		gt.A(t, *sessions).Length(1)
+		gt.Equal(t, gollem.ContentTypeJSON, (*sessions)[0].ContentType())
+		gt.Equal(t, schema, (*sessions)[0].ResponseSchema())
+	})
+
+	t.Run("fails after retries", func(t *testing.T) {
+		client, _ := newClient(withTasks, `not json`, `{"findings": []}`)
+		strategy := planexec.New(client, planexec.WithPlanResultSchema(schema, planexec.WithResultMaxRetry(1)))
+		_, err := gollem.New(client, gollem.WithStrategy(strategy)).Execute(t.Context(), gollem.Text("Audit the host"))
+		gt.Error(t, err)
+	})
+
+	t.Run("plan without tasks is concluded by schema", func(t *testing.T) {
+		client, sessions := newClient(`{"needs_plan": false, "direct_response": "Nothing to audit"}`,
+			`{"findings": [], "risk_score": 0}`,
+		)
+		strategy := planexec.New(client, planexec.WithPlanResultSchema(schema))
+		resp, err := gollem.New(client, gollem.WithStrategy(strategy)).Execute(t.Context(), gollem.Text("Hello"))
+		gt.NoError(t, err)
+		gt.Equal(t, `{"findings": [], "risk_score": 0}`, resp.String())
+		gt.A(t, *sessions).Length(1)
+	})
+}
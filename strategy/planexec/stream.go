@@ -0,0 +1,119 @@
+package planexec
+
+import (
+	"context"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+// StreamPhase is the phase of a plan that produced a StreamChunk.
+type StreamPhase string
+
+const (
+	// StreamPhaseTask is output of the LLM executing a task
+	StreamPhaseTask StreamPhase = "task"
+	// StreamPhaseConclusion is output of the LLM writing the final conclusion
+	StreamPhaseConclusion StreamPhase = "conclusion"
+)
+
+// StreamChunk is a piece of LLM output streamed while a plan runs.
+type StreamChunk struct {
+	Phase StreamPhase
+	// TaskID is the ID of the running task. It is empty in the conclusion phase.
+	TaskID  string
+	Text    string
+	Thought string
+}
+
+// StreamHandler receives LLM output of a plan as it is generated. Chunks of a call are passed in
+// order; the handler must return quickly not to block the stream.
+type StreamHandler func(ctx context.Context, chunk *StreamChunk)
+
+// WithPlanStreamHandler sets the handler of streamed LLM output, so that UIs can render live
+// output while a task or the final conclusion is generated. Task output is streamed only when the
+// agent is configured with Strategy.StreamOption. The conclusion is generated with
+// Session.Stream, which applies middlewares of WithStreamMiddleware instead of WithMiddleware.
+func WithPlanStreamHandler(handler StreamHandler) Option {
+	return func(s *Strategy) {
+		s.streamHandler = handler
+	}
+}
+
+// StreamOption returns an agent option that streams the output of task execution to the handler
+// set by WithPlanStreamHandler. It sets ResponseModeStreaming and a content stream middleware to
+// the agent.
+func (s *Strategy) StreamOption() gollem.Option {
+	return gollem.WithOptions(
+		gollem.WithResponseMode(gollem.ResponseModeStreaming),
+		gollem.WithContentStreamMiddleware(s.streamMiddleware()),
+	)
+}
+
+// streamMiddleware passes text of LLM calls of the running task to the stream handler. The task
+// is determined when the call starts, in the goroutine of Execute.
+func (s *Strategy) streamMiddleware() gollem.ContentStreamMiddleware {
+	return func(next gollem.ContentStreamHandler) gollem.ContentStreamHandler {
+		return func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+			stream, err := next(ctx, req)
+			if err != nil || s.streamHandler == nil || !s.waitingForTask || s.currentTask == nil {
+				return stream, err
+			}
+
+			taskID := s.currentTask.ID
+			handler := s.streamHandler
+			out := make(chan *gollem.ContentResponse)
+			go func() {
+				defer close(out)
+				for resp := range stream {
+					emitChunk(ctx, handler, StreamPhaseTask, taskID, resp.Texts, resp.Thoughts)
+					out <- resp
+				}
+			}()
+			return out, nil
+		}
+	}
+}
+
+// emitChunk passes texts and thoughts of a streamed response to handler, if any.
+func emitChunk(ctx context.Context, handler StreamHandler, phase StreamPhase, taskID string, texts, thoughts []string) {
+	chunk := &StreamChunk{
+		Phase:   phase,
+		TaskID:  taskID,
+		Text:    strings.Join(texts, ""),
+		Thought: strings.Join(thoughts, ""),
+	}
+	if chunk.Text == "" && chunk.Thought == "" {
+		return
+	}
+	handler(ctx, chunk)
+}
+
+// streamConclusion generates the conclusion with session.Stream, passing its output to handler.
+// Content stream middlewares of the session apply, but content block middlewares don't.
+func streamConclusion(ctx context.Context, session gollem.Session, input []gollem.Input, handler StreamHandler) ([]string, error) {
+	stream, err := session.Stream(ctx, input)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to stream conclusion")
+	}
+
+	usageCtx := gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseSummarize)
+	var text strings.Builder
+	for resp := range stream {
+		if resp.Error != nil {
+			// Let the session finish sending responses, which may follow the error
+			go func() {
+				for range stream {
+				}
+			}()
+			return nil, goerr.Wrap(resp.Error, "failed to stream conclusion")
+		}
+		gollem.RecordUsage(usageCtx, resp)
+		emitChunk(ctx, handler, StreamPhaseConclusion, "", resp.Texts, nil)
+		for _, t := range resp.Texts {
+			text.WriteString(t)
+		}
+	}
+	return []string{text.String()}, nil
+}
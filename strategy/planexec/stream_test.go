@@ -0,0 +1,189 @@
+package planexec_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPlanStreamHandler(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Check servers",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "Check server A", State: planexec.TaskStatePending},
+			{ID: "task-2", Description: "Check server B", State: planexec.TaskStatePending},
+		},
+	}
+
+	// streamChunks returns a stream of chunks through the stream middlewares of the session
+	streamChunks := func(ctx context.Context, cfg gollem.SessionConfig, chunks []string) (<-chan *gollem.Response, error) {
+		base := func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+			ch := make(chan *gollem.ContentResponse, len(chunks))
+			for _, c := range chunks {
+				ch <- &gollem.ContentResponse{Texts: []string{c}}
+			}
+			close(ch)
+			return ch, nil
+		}
+		stream, err := cfg.ContentStreamChain(base)(ctx, &gollem.ContentRequest{})
+		if err != nil {
+			return nil, err
+		}
+		out := make(chan *gollem.Response)
+		go func() {
+			defer close(out)
+			for resp := range stream {
+				out <- &gollem.Response{Texts: resp.Texts}
+			}
+		}()
+		return out, nil
+	}
+
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "on track"}`}}, nil
+				},
+				StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+					text := string(input[0].(gollem.Text))
+					if strings.Contains(text, "# Final Conclusion") {
+						return streamChunks(ctx, cfg, []string{"All ", "servers ", "are healthy"})
+					}
+					return streamChunks(ctx, cfg, []string{"Server ", "is healthy"})
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	var chunks []planexec.StreamChunk
+	strategy := planexec.New(mockClient,
+		planexec.WithPlan(plan),
+		planexec.WithPlanStreamHandler(func(ctx context.Context, chunk *planexec.StreamChunk) {
+			chunks = append(chunks, *chunk)
+		}),
+	)
+	agent := gollem.New(mockClient, gollem.WithStrategy(strategy), strategy.StreamOption())
+
+	resp, err := agent.Execute(context.Background(), gollem.Text("Check servers"))
+	gt.NoError(t, err)
+	gt.Equal(t, []string{"All servers are healthy"}, resp.Texts)
+
+	gt.Equal(t, []planexec.StreamChunk{
+		{Phase: planexec.StreamPhaseTask, TaskID: "task-1", Text: "Server "},
+		{Phase: planexec.StreamPhaseTask, TaskID: "task-1", Text: "is healthy"},
+		{Phase: planexec.StreamPhaseTask, TaskID: "task-2", Text: "Server "},
+		{Phase: planexec.StreamPhaseTask, TaskID: "task-2", Text: "is healthy"},
+		{Phase: planexec.StreamPhaseConclusion, Text: "All "},
+		{Phase: planexec.StreamPhaseConclusion, Text: "servers "},
+		{Phase: planexec.StreamPhaseConclusion, Text: "are healthy"},
+	}, chunks)
+}
+
+func TestPlanStreamConclusion(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Check servers",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "Check server A", State: planexec.TaskStatePending},
+		},
+	}
+
+	// newClient returns a client whose sessions stream the conclusion by streamFunc
+	newClient := func(streamFunc func(ctx context.Context, cfg gollem.SessionConfig) (<-chan *gollem.Response, error)) *mock.LLMClientMock {
+		calls := 0
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				cfg := gollem.NewSessionConfig(options...)
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						calls++
+						if calls == 1 {
+							return &gollem.Response{Texts: []string{"Server is healthy"}}, nil
+						}
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "on track"}`}}, nil
+					},
+					StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+						return streamFunc(ctx, cfg)
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return &gollem.History{}, nil
+					},
+				}, nil
+			},
+		}
+	}
+	handler := planexec.WithPlanStreamHandler(func(ctx context.Context, chunk *planexec.StreamChunk) {})
+
+	t.Run("stream middlewares are applied", func(t *testing.T) {
+		client := newClient(func(ctx context.Context, cfg gollem.SessionConfig) (<-chan *gollem.Response, error) {
+			base := func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+				ch := make(chan *gollem.ContentResponse, 1)
+				ch <- &gollem.ContentResponse{Texts: []string{"All servers are healthy"}}
+				close(ch)
+				return ch, nil
+			}
+			stream, err := cfg.ContentStreamChain(base)(ctx, &gollem.ContentRequest{})
+			if err != nil {
+				return nil, err
+			}
+			out := make(chan *gollem.Response)
+			go func() {
+				defer close(out)
+				for resp := range stream {
+					out <- &gollem.Response{Texts: resp.Texts}
+				}
+			}()
+			return out, nil
+		})
+
+		applied := 0
+		mw := func(next gollem.ContentStreamHandler) gollem.ContentStreamHandler {
+			return func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+				applied++
+				return next(ctx, req)
+			}
+		}
+		strategy := planexec.New(client, planexec.WithPlan(plan), handler, planexec.WithStreamMiddleware(mw))
+		resp, err := gollem.New(client, gollem.WithStrategy(strategy)).Execute(context.Background(), gollem.Text("Check servers"))
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"All servers are healthy"}, resp.Texts)
+		gt.Equal(t, 1, applied)
+	})
+
+	t.Run("stream is drained after an error", func(t *testing.T) {
+		drained := make(chan struct{})
+		client := newClient(func(ctx context.Context, cfg gollem.SessionConfig) (<-chan *gollem.Response, error) {
+			out := make(chan *gollem.Response)
+			go func() {
+				defer close(drained)
+				defer close(out)
+				out <- &gollem.Response{Error: errors.New("overloaded")}
+				out <- &gollem.Response{Texts: []string{"late"}}
+			}()
+			return out, nil
+		})
+
+		strategy := planexec.New(client, planexec.WithPlan(plan), handler)
+		// The conclusion falls back to the summary of the plan
+		resp, err := gollem.New(client, gollem.WithStrategy(strategy)).Execute(context.Background(), gollem.Text("Check servers"))
+		gt.NoError(t, err)
+		gt.A(t, resp.Texts).Length(1)
+
+		select {
+		case <-drained:
+		case <-time.After(time.Second):
+			t.Fatal("stream is not drained")
+		}
+	})
+}
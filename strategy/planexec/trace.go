@@ -1,5 +1,7 @@
 package planexec
 
+import "github.com/m-mizutani/gollem"
+
 // PlanCreatedEvent is recorded when a plan is created.
 type PlanCreatedEvent struct {
 	Goal  string         `json:"goal"`
@@ -36,3 +38,22 @@ type PlanUpdatedEvent struct {
 type AllTasksCompletedEvent struct {
 	TotalTasks int `json:"total_tasks"`
 }
+
+// ReflectionEvent is recorded for each reflection with its inputs and output, so that a decision
+// to skip or add tasks can be replayed later with ReplayReflection.
+type ReflectionEvent struct {
+	TaskID    string `json:"task_id"`
+	Iteration int    `json:"iteration"`
+
+	// Inputs of the reflection
+	Plan         *Plan           `json:"plan"`
+	SystemPrompt string          `json:"system_prompt,omitempty"`
+	History      *gollem.History `json:"history,omitempty"`
+	Prompt       string          `json:"prompt"`
+
+	// Output of the reflection
+	Response     string         `json:"response"`
+	UpdatedTasks []PlanTaskInfo `json:"updated_tasks,omitempty"`
+	NewTasks     []PlanTaskInfo `json:"new_tasks,omitempty"`
+	Reason       string         `json:"reason,omitempty"`
+}
@@ -0,0 +1,75 @@
+package planexec_test
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPromptTrace(t *testing.T) {
+	var calls int
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					switch calls {
+					case 1:
+						return &gollem.Response{Texts: []string{`{"needs_plan": true, "user_intent": "Check the key", "goal": "Check the key", "tasks": [{"description": "Look up the key"}]}`}}, nil
+					case 2:
+						return &gollem.Response{Texts: []string{"The key is valid"}}, nil
+					case 3:
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "done"}`}}, nil
+					default:
+						return &gollem.Response{Texts: []string{"The key is valid."}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	rec := trace.New()
+	agent := gollem.New(mockClient,
+		gollem.WithStrategy(planexec.New(mockClient)),
+		gollem.WithTrace(rec),
+		gollem.WithPromptTraceRedactor(gollem.RedactPatterns(regexp.MustCompile(`sk-[0-9a-z]+`))),
+	)
+	_, err := agent.Execute(context.Background(), gollem.Text("Is sk-abc123 valid?"))
+	gt.NoError(t, err)
+
+	data, err := json.Marshal(rec.Trace())
+	gt.NoError(t, err)
+	var loaded trace.Trace
+	gt.NoError(t, json.Unmarshal(data, &loaded))
+
+	events, err := gollem.PromptEvents(&loaded)
+	gt.NoError(t, err)
+	gt.A(t, events).Length(4)
+
+	phases := map[string]string{}
+	for _, event := range events {
+		phases[event.Template] = event.Phase
+		gt.S(t, event.Prompt).NotContains("sk-abc123")
+	}
+	gt.Equal(t, map[string]string{
+		"plan":       gollem.UsagePhasePlan,
+		"execute":    gollem.UsagePhaseExecute,
+		"reflect":    gollem.UsagePhaseReflect,
+		"conclusion": gollem.UsagePhaseSummarize,
+	}, phases)
+
+	gt.Equal(t, "plan", events[0].Template)
+	gt.Equal(t, "Is [REDACTED] valid?", events[0].Data["UserRequest"])
+	gt.S(t, events[0].Prompt).Contains("Is [REDACTED] valid?")
+	gt.Equal(t, "Look up the key", events[1].Data["TaskDescription"])
+}
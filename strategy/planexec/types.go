@@ -2,8 +2,12 @@ package planexec
 
 import (
 	"context"
+	"encoding/json"
+	"sync"
 
+	"github.com/m-mizutani/goerr/v2"
 	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/internal/migrate"
 )
 
 // TaskState represents the current state of a task
@@ -19,12 +23,44 @@ const (
 	DefaultMaxIterations = 32
 )
 
+// TaskOrder is the policy choosing the next pending task to execute.
+type TaskOrder string
+
+const (
+	// TaskOrderAsPlanned executes tasks in the order of the plan. It's the default.
+	TaskOrderAsPlanned TaskOrder = "as_planned"
+
+	// TaskOrderPriority executes tasks of higher Priority first. Tasks without priority run
+	// after the prioritized ones.
+	TaskOrderPriority TaskOrder = "priority"
+
+	// TaskOrderCheapest executes tasks of lower Effort first. Tasks without effort run after
+	// the estimated ones.
+	TaskOrderCheapest TaskOrder = "cheapest"
+)
+
 // Task represents an executable task in the plan
 type Task struct {
 	ID          string // Unique identifier for the task
 	Description string
 	State       TaskState
 	Result      string
+
+	// SkipReason is the reason given by reflection when the task was skipped
+	SkipReason string
+
+	// Priority is the importance of the task estimated by the planner, higher first. 0 means
+	// not estimated. It orders execution with TaskOrderPriority.
+	Priority int
+
+	// Effort is the relative cost of the task estimated by the planner, e.g. the number of tool
+	// calls. 0 means not estimated. It orders execution with TaskOrderCheapest.
+	Effort int
+
+	// ToolChoice controls tool calling of the first LLM call of the task, e.g. to force a
+	// search tool or forbid tools for a pure-reasoning task. It is not generated by the
+	// planner; set it with WithPlan or in PlanExecuteHooks.OnPlanCreated. nil means auto.
+	ToolChoice *gollem.ToolChoice
 }
 
 // Plan represents the execution plan with tasks
@@ -49,6 +85,45 @@ type Plan struct {
 	Constraints    string // Key constraints and requirements (e.g., "HIPAA compliance required")
 }
 
+// PlanVersion is the version of the JSON format of Plan, written in the "Version" field.
+const PlanVersion = 1
+
+// ErrUnsupportedPlanVersion is returned when a serialized plan has a version that cannot be
+// upgraded to PlanVersion, e.g. of a newer library.
+var ErrUnsupportedPlanVersion = migrate.ErrUnsupportedVersion
+
+// planMigrator upgrades serialized plans of older versions on load. Plans written before the
+// version field was added are version 0 and have the same format as v1.
+var planMigrator = migrate.New("Version", PlanVersion, map[int]migrate.Step{
+	0: func(doc migrate.Document) error { return nil },
+})
+
+// MarshalJSON implements json.Marshaler to write PlanVersion with the plan.
+func (p Plan) MarshalJSON() ([]byte, error) {
+	type planAlias Plan
+	return json.Marshal(struct {
+		Version int
+		planAlias
+	}{Version: PlanVersion, planAlias: planAlias(p)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. A plan of an older version is upgraded to
+// PlanVersion. Returns ErrUnsupportedPlanVersion if the version cannot be upgraded.
+func (p *Plan) UnmarshalJSON(data []byte) error {
+	data, err := planMigrator.Upgrade(data)
+	if err != nil {
+		return goerr.Wrap(err, "failed to migrate plan")
+	}
+
+	type planAlias Plan
+	var plan planAlias
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return err
+	}
+	*p = Plan(plan)
+	return nil
+}
+
 // PlanExecuteHooks provides hook points for plan lifecycle events
 type PlanExecuteHooks interface {
 	OnPlanCreated(ctx context.Context, plan *Plan) error
@@ -58,10 +133,22 @@ type PlanExecuteHooks interface {
 
 // Strategy implements the gollem.Strategy interface for plan-and-execute approach
 type Strategy struct {
-	client        gollem.LLMClient
-	middleware    []gollem.ContentBlockMiddleware
-	hooks         PlanExecuteHooks
-	maxIterations int
+	client         gollem.LLMClient
+	middleware     []gollem.ContentBlockMiddleware
+	streamMW       []gollem.ContentStreamMiddleware
+	hooks          PlanExecuteHooks
+	maxIterations  int
+	dryRun         bool
+	inheritSession bool
+	streamHandler  StreamHandler
+	approvalHook   TaskApprovalHook
+	resultSchema   *resultSchemaConfig
+	taskOrder      TaskOrder
+
+	// Budget of each Execute set by WithPlanBudget and WithPlanTokenBudget
+	budgetMaxUSD    float64
+	budgetMaxTokens int
+	budgetOptions   []gollem.BudgetOption
 
 	// Runtime state
 	plan               *Plan
@@ -71,9 +158,33 @@ type Strategy struct {
 	waitingForTask     bool
 	taskIterationCount int // Counts completed tasks
 
+	// Note of the approval hook's modification of the current task, prepended to its result
+	approvalNote string
+
 	// Temporary storage for tool execution results
 	// When NextInput contains tool results, save them here before passing to LLM
 	pendingToolResults []gollem.Input
+
+	// History of the agent session at the start of Execute, with WithPlanInheritSession
+	inheritedHistory *gollem.History
+
+	// Set by Coordinator to schedule tasks and observe progress
+	coordinator *Coordinator
+	observer    func(plan *Plan)
+	holdingSlot bool
+
+	// Dry-run state: LLM usage counted by the wrapped client and the resulting preview
+	dryRunUsage *llmUsage
+	preview     *ExecutionPreview
+
+	// Token usage of the latest Execute, given by the agent, and the budget checked against it
+	usage  *gollem.UsageTracker
+	budget *gollem.Budget
+
+	// mu guards published, preview and usage, which are read by Plan, SnapshotState,
+	// ExecutionPreview and Usage from other goroutines while Execute updates the plan
+	mu        sync.RWMutex
+	published *Plan
 }
 
 // Option is a functional option for configuring Strategy
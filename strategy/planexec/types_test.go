@@ -0,0 +1,41 @@
+package planexec_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPlanJSON(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Find the root cause",
+		Tasks: []planexec.Task{
+			{ID: "a", Description: "Check logs", State: planexec.TaskStateCompleted, Result: "found errors"},
+		},
+	}
+	data, err := json.Marshal(plan)
+	gt.NoError(t, err)
+
+	var doc struct{ Version int }
+	gt.NoError(t, json.Unmarshal(data, &doc))
+	gt.Equal(t, planexec.PlanVersion, doc.Version)
+
+	var loaded planexec.Plan
+	gt.NoError(t, json.Unmarshal(data, &loaded))
+	gt.Equal(t, *plan, loaded)
+
+	t.Run("plan without version", func(t *testing.T) {
+		var old planexec.Plan
+		gt.NoError(t, json.Unmarshal([]byte(`{"Goal":"old goal","Tasks":[{"ID":"a","Description":"Check","State":"pending"}]}`), &old))
+		gt.Equal(t, "old goal", old.Goal)
+		gt.Equal(t, planexec.TaskStatePending, old.Tasks[0].State)
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		var plan planexec.Plan
+		err := json.Unmarshal([]byte(`{"Version":99,"Goal":"future"}`), &plan)
+		gt.Error(t, err).Is(planexec.ErrUnsupportedPlanVersion)
+	})
+}
@@ -0,0 +1,130 @@
+package planexec_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPlanUsage(t *testing.T) {
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					text := string(input[0].(gollem.Text))
+					switch {
+					case strings.Contains(text, "# Task Analysis and Planning"):
+						return &gollem.Response{
+							Texts:       []string{`{"needs_plan": true, "goal": "Check servers", "tasks": [{"description": "Check server A"}, {"description": "Check server B"}]}`},
+							InputToken:  100,
+							OutputToken: 10,
+						}, nil
+					case strings.Contains(text, "# Task Execution"):
+						return &gollem.Response{Texts: []string{"Server is healthy"}, InputToken: 20, OutputToken: 2}, nil
+					case strings.Contains(text, "# Task Reflection"):
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "on track"}`}, InputToken: 5, OutputToken: 1}, nil
+					default:
+						return &gollem.Response{Texts: []string{"All servers are healthy"}, InputToken: 7, OutputToken: 3}, nil
+					}
+				},
+			}, nil
+		},
+	}
+
+	strategy := planexec.New(mockClient)
+	gt.Equal(t, &gollem.Usage{}, strategy.Usage())
+
+	var reports []*gollem.UsageReport
+	agent := gollem.New(mockClient, gollem.WithStrategy(strategy),
+		gollem.WithUsageReporter(func(ctx context.Context, sessionID string, report *gollem.UsageReport) {
+			reports = append(reports, report)
+		}),
+	)
+	resp, err := agent.Execute(t.Context(), gollem.Text("Check the servers"))
+	gt.NoError(t, err)
+
+	// Calls executing tasks are reported with the task ID
+	var taskIDs []string
+	for _, report := range reports {
+		if report.Phase == gollem.UsagePhaseExecute {
+			taskIDs = append(taskIDs, report.Labels[gollem.UsageLabelPlanTask])
+		} else {
+			gt.Equal(t, "", report.Labels[gollem.UsageLabelPlanTask])
+		}
+	}
+	gt.A(t, reports).Length(6)
+	gt.Equal(t, []string{strategy.Plan().Tasks[0].ID, strategy.Plan().Tasks[1].ID}, taskIDs)
+
+	expected := &gollem.Usage{
+		InputTokens:  100 + 2*20 + 2*5 + 7,
+		OutputTokens: 10 + 2*2 + 2*1 + 3,
+		Phases: map[string]gollem.Usage{
+			gollem.UsagePhasePlan:      {InputTokens: 100, OutputTokens: 10},
+			gollem.UsagePhaseExecute:   {InputTokens: 40, OutputTokens: 4},
+			gollem.UsagePhaseReflect:   {InputTokens: 10, OutputTokens: 2},
+			gollem.UsagePhaseSummarize: {InputTokens: 7, OutputTokens: 3},
+		},
+	}
+	gt.Equal(t, expected, strategy.Usage())
+	gt.Equal(t, expected, resp.Usage)
+	gt.Equal(t, expected, agent.Usage())
+}
+
+func TestPlanBudget(t *testing.T) {
+	var executed int
+	mockClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					text := string(input[0].(gollem.Text))
+					switch {
+					case strings.Contains(text, "# Task Analysis and Planning"):
+						return &gollem.Response{
+							Texts:       []string{`{"needs_plan": true, "goal": "Check servers", "tasks": [{"description": "Check server A"}, {"description": "Check server B"}]}`},
+							InputToken:  100,
+							OutputToken: 10,
+						}, nil
+					case strings.Contains(text, "# Task Execution"):
+						executed++
+						return &gollem.Response{Texts: []string{"Server is healthy"}, InputToken: 100, OutputToken: 10}, nil
+					default:
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "on track"}`}, InputToken: 100, OutputToken: 10}, nil
+					}
+				},
+			}, nil
+		},
+	}
+
+	t.Run("aborts when the plan exceeds the budget", func(t *testing.T) {
+		executed = 0
+		// planning, the first task and its reflection consume 330 tokens, so the second task is
+		// not executed
+		strategy := planexec.New(mockClient, planexec.WithPlanTokenBudget(300))
+		agent := gollem.New(mockClient, gollem.WithStrategy(strategy))
+		_, err := agent.Execute(t.Context(), gollem.Text("Check the servers"))
+		gt.Error(t, err).Is(gollem.ErrBudgetExceeded)
+		gt.Equal(t, 1, executed)
+	})
+
+	t.Run("hook is notified", func(t *testing.T) {
+		executed = 0
+		var notified int
+		strategy := planexec.New(mockClient, planexec.WithPlanBudget(0.001,
+			gollem.WithModelPricing("", gollem.Pricing{InputPerMillion: 5, OutputPerMillion: 25}),
+			gollem.WithBudgetExceededHook(func(ctx context.Context, event *gollem.BudgetExceededEvent) error {
+				notified++
+				return nil
+			}),
+		))
+		agent := gollem.New(mockClient, gollem.WithStrategy(strategy))
+		_, err := agent.Execute(t.Context(), gollem.Text("Check the servers"))
+		gt.NoError(t, err)
+		gt.Equal(t, 2, executed)
+		gt.Equal(t, 1, notified)
+	})
+}
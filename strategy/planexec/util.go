@@ -9,19 +9,40 @@ import (
 	"github.com/m-mizutani/gollem"
 )
 
-// getNextPendingTask returns the next task that needs to be executed
-func getNextPendingTask(_ context.Context, plan *Plan) *Task {
+// getNextPendingTask returns the next task that needs to be executed in order. Tasks ranked
+// equally by order are executed in the order of the plan.
+func getNextPendingTask(_ context.Context, plan *Plan, order TaskOrder) *Task {
 	if plan == nil {
 		return nil
 	}
 
+	var next *Task
 	for i := range plan.Tasks {
-		if plan.Tasks[i].State == TaskStatePending {
-			return &plan.Tasks[i]
+		task := &plan.Tasks[i]
+		if task.State != TaskStatePending {
+			continue
+		}
+		if next == nil || runsBefore(task, next, order) {
+			next = task
 		}
 	}
 
-	return nil
+	return next
+}
+
+// runsBefore reports whether a should run before b by order. Unestimated values of 0 rank last.
+func runsBefore(a, b *Task, order TaskOrder) bool {
+	switch order {
+	case TaskOrderPriority:
+		return a.Priority > b.Priority
+	case TaskOrderCheapest:
+		if a.Effort == 0 || b.Effort == 0 {
+			return a.Effort != 0 && b.Effort == 0
+		}
+		return a.Effort < b.Effort
+	default:
+		return false
+	}
 }
 
 // allTasksCompleted checks if all tasks in the plan are completed or skipped
@@ -42,7 +63,9 @@ func allTasksCompleted(ctx context.Context, plan *Plan) bool {
 
 // getFinalConclusion asks LLM to generate final conclusion based on completed tasks
 // Returns ExecuteResponse with texts and session history
-func getFinalConclusion(ctx context.Context, client gollem.LLMClient, plan *Plan, middleware []gollem.ContentBlockMiddleware, systemPrompt string) (*gollem.ExecuteResponse, error) {
+// history is the conversation before the plan, given with WithPlanInheritSession, or nil
+// stream receives the conclusion as it is generated if not nil
+func getFinalConclusion(ctx context.Context, client gollem.LLMClient, plan *Plan, middleware []gollem.ContentBlockMiddleware, streamMW []gollem.ContentStreamMiddleware, systemPrompt string, history *gollem.History, stream StreamHandler) (*gollem.ExecuteResponse, error) {
 	if plan == nil {
 		return &gollem.ExecuteResponse{
 			Texts: []string{"No plan was executed."},
@@ -56,40 +79,49 @@ func getFinalConclusion(ctx context.Context, client gollem.LLMClient, plan *Plan
 		}, nil
 	}
 
-	// Build summary of completed tasks
-	var taskSummaries []string
-	for _, task := range plan.Tasks {
-		if task.State == TaskStateCompleted {
-			summary := fmt.Sprintf("- %s", task.Description)
-			if task.Result != "" {
-				summary += fmt.Sprintf("\n  Result: %s", task.Result)
-			}
-			taskSummaries = append(taskSummaries, summary)
-		}
-	}
-
 	// Create conclusion prompt using template
-	conclusionPrompt := buildConclusionPrompt(plan, taskSummaries)
+	conclusionPrompt := buildConclusionPrompt(ctx, plan, completedTaskSummaries(plan))
 
 	// Create new session for conclusion
 	sessionOpts := []gollem.SessionOption{}
 	if systemPrompt != "" {
 		sessionOpts = append(sessionOpts, gollem.WithSessionSystemPrompt(systemPrompt))
 	}
+	if history != nil {
+		sessionOpts = append(sessionOpts, gollem.WithSessionHistory(history))
+	}
 	for _, mw := range middleware {
 		sessionOpts = append(sessionOpts, gollem.WithSessionContentBlockMiddleware(mw))
 	}
+	// The streamed conclusion goes through the stream middlewares instead of the block ones
+	if stream != nil {
+		sessionOpts = append(sessionOpts, gollem.WithSessionContentStreamMiddleware(streamMW...))
+	}
 
 	session, err := client.NewSession(ctx, sessionOpts...)
 	if err != nil {
 		return nil, goerr.Wrap(err, "failed to create session for conclusion")
 	}
 
+	if err := gollem.CheckBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	input := []gollem.Input{gollem.Text(conclusionPrompt)}
+	if stream != nil {
+		texts, err := streamConclusion(ctx, session, input, stream)
+		if err != nil {
+			return nil, err
+		}
+		return &gollem.ExecuteResponse{Texts: texts}, nil
+	}
+
 	// Generate conclusion
-	response, err := session.Generate(ctx, []gollem.Input{gollem.Text(conclusionPrompt)})
+	response, err := session.Generate(ctx, input)
 	if err != nil {
 		return nil, goerr.Wrap(err, "failed to generate conclusion")
 	}
+	gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseSummarize), response)
 
 	// Return only the texts - the main session will automatically add them to history
 	// No need to include AdditionalHistory as this is the final response, not an internal analysis
@@ -98,6 +130,22 @@ func getFinalConclusion(ctx context.Context, client gollem.LLMClient, plan *Plan
 	}, nil
 }
 
+// completedTaskSummaries returns a summary line of each completed task with its result for the
+// conclusion prompt.
+func completedTaskSummaries(plan *Plan) []string {
+	var taskSummaries []string
+	for _, task := range plan.Tasks {
+		if task.State == TaskStateCompleted {
+			summary := fmt.Sprintf("- %s", task.Description)
+			if task.Result != "" {
+				summary += fmt.Sprintf("\n  Result: %s", task.Result)
+			}
+			taskSummaries = append(taskSummaries, summary)
+		}
+	}
+	return taskSummaries
+}
+
 // generateFinalResponse creates the final response from the completed plan (without LLM call)
 func generateFinalResponse(ctx context.Context, plan *Plan) *gollem.ExecuteResponse {
 	if plan == nil {
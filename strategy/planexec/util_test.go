@@ -0,0 +1,74 @@
+package planexec_test
+
+import (
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gt"
+)
+
+func TestGetNextPendingTask(t *testing.T) {
+	plan := &planexec.Plan{
+		Tasks: []planexec.Task{
+			{ID: "done", State: planexec.TaskStateCompleted, Priority: 5, Effort: 1},
+			{ID: "a", State: planexec.TaskStatePending},
+			{ID: "b", State: planexec.TaskStatePending, Priority: 2, Effort: 3},
+			{ID: "c", State: planexec.TaskStatePending, Priority: 4, Effort: 2},
+			{ID: "d", State: planexec.TaskStatePending, Priority: 4, Effort: 2},
+		},
+	}
+
+	next := func(order planexec.TaskOrder) string {
+		task := planexec.GetNextPendingTask(t.Context(), plan, order)
+		if task == nil {
+			return ""
+		}
+		return task.ID
+	}
+
+	t.Run("as planned", func(t *testing.T) {
+		gt.Equal(t, "a", next(planexec.TaskOrderAsPlanned))
+		gt.Equal(t, "a", next(""))
+	})
+
+	t.Run("priority first, ties in plan order", func(t *testing.T) {
+		gt.Equal(t, "c", next(planexec.TaskOrderPriority))
+	})
+
+	t.Run("cheapest first, unknown effort last", func(t *testing.T) {
+		gt.Equal(t, "c", next(planexec.TaskOrderCheapest))
+
+		plan.Tasks[3].State = planexec.TaskStateCompleted
+		plan.Tasks[4].State = planexec.TaskStateCompleted
+		gt.Equal(t, "b", next(planexec.TaskOrderCheapest))
+
+		plan.Tasks[2].State = planexec.TaskStateSkipped
+		gt.Equal(t, "a", next(planexec.TaskOrderCheapest))
+
+		plan.Tasks[1].State = planexec.TaskStateCompleted
+		gt.Equal(t, "", next(planexec.TaskOrderCheapest))
+	})
+
+	t.Run("nil plan", func(t *testing.T) {
+		gt.Nil(t, planexec.GetNextPendingTask(t.Context(), nil, planexec.TaskOrderPriority))
+	})
+}
+
+func TestParsePlanEstimates(t *testing.T) {
+	plan, err := planexec.ParsePlanFromResponse(t.Context(), &gollem.Response{
+		Texts: []string{`{"needs_plan": true, "goal": "g", "tasks": [
+			{"description": "search", "priority": 5, "effort": 1},
+			{"description": "read"},
+			{"description": "invalid", "priority": -1, "effort": -2}
+		]}`},
+	})
+	gt.NoError(t, err)
+	gt.A(t, plan.Tasks).Length(3)
+	gt.Equal(t, 5, plan.Tasks[0].Priority)
+	gt.Equal(t, 1, plan.Tasks[0].Effort)
+	gt.Equal(t, 0, plan.Tasks[1].Priority)
+	gt.Equal(t, 0, plan.Tasks[1].Effort)
+	gt.Equal(t, 0, plan.Tasks[2].Priority)
+	gt.Equal(t, 0, plan.Tasks[2].Effort)
+}
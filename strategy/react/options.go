@@ -1,9 +1,11 @@
 package react
 
+import "github.com/m-mizutani/gollem"
+
 // Option is a function that configures the Strategy
 type Option func(*Strategy)
 
-// WithMaxIterations sets the maximum number of iterations
+// WithMaxIterations sets the maximum number of iterations, i.e. the steps of the ReAct loop
 // Default is 20 if not specified
 func WithMaxIterations(max int) Option {
 	return func(s *Strategy) {
@@ -51,3 +53,19 @@ func WithFewShotExamples(examples []FewShotExample) Option {
 		s.fewShotExamples = examples
 	}
 }
+
+// WithHooks sets the hooks receiving the thought, action and observation of each step
+func WithHooks(hooks Hooks) Option {
+	return func(s *Strategy) {
+		s.hooks = hooks
+	}
+}
+
+// WithInnerStrategy runs strategy, e.g. planexec, instead of the ReAct loop. The TAO cycles of
+// its iterations are still recorded in the trace and sent to the hooks, and the maximum
+// iterations are still applied, but the ReAct prompts and loop detection are not used.
+func WithInnerStrategy(strategy gollem.Strategy) Option {
+	return func(s *Strategy) {
+		s.inner = strategy
+	}
+}
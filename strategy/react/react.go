@@ -61,30 +61,37 @@ func (s *Strategy) Init(ctx context.Context, inputs []gollem.Input) error {
 	s.actionHistory = make([]string, 0)
 	s.repeatedCount = make(map[string]int)
 	s.consecutiveErrors = 0
-	s.startTime = time.Now()
+	s.startTime = gollem.Now(ctx)
 	s.endTime = time.Time{}
 
+	if s.inner != nil {
+		return s.inner.Init(ctx, inputs)
+	}
 	return nil
 }
 
-// Tools returns the tools provided by this strategy (none for ReAct)
+// Tools returns the tools provided by this strategy (none for ReAct, or those of the inner strategy)
 func (s *Strategy) Tools(ctx context.Context) ([]gollem.Tool, error) {
+	if s.inner != nil {
+		return s.inner.Tools(ctx)
+	}
 	return []gollem.Tool{}, nil
 }
 
 // Handle implements the ReAct loop logic
 func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+	if s.inner != nil {
+		return s.handleInner(ctx, state)
+	}
+
 	// Phase 0: Initialize on first iteration
 	if state.Iteration == 0 {
-		return s.handleInitialization(state)
+		return s.handleInitialization(ctx, state)
 	}
 
 	// Safety check: max iterations
 	if state.Iteration >= s.maxIterations {
-		s.endTime = time.Now()
-		return nil, &gollem.ExecuteResponse{
-			Texts: []string{fmt.Sprintf("Maximum iterations (%d) reached without completion", s.maxIterations)},
-		}, nil
+		return nil, s.maxIterationsResponse(ctx), nil
 	}
 
 	// Phase 1-2: Process LLM response (Thought + Action)
@@ -102,9 +109,9 @@ func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]g
 }
 
 // handleInitialization handles the first iteration (Phase 0)
-func (s *Strategy) handleInitialization(state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+func (s *Strategy) handleInitialization(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
 	// Create initial TAO entry
-	s.addTAOEntry(0)
+	s.addTAOEntry(ctx, 0)
 
 	// Build inputs with system prompt and thought prompt
 	systemPrompt := s.systemPrompt
@@ -120,62 +127,57 @@ func (s *Strategy) handleInitialization(state *gollem.StrategyState) ([]gollem.I
 	return inputs, nil, nil
 }
 
-// handleThoughtAndAction handles Thought and Action phases
+// handleThoughtAndAction handles Thought and Action phases. The agent executes the tool calls
+// of the last response before Handle, so their results in NextInput are observed here as well.
 func (s *Strategy) handleThoughtAndAction(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
 	resp := state.LastResponse
 
-	// Record thought
-	if len(resp.Texts) > 0 {
-		s.recordThought(strings.Join(resp.Texts, " "))
-
-		// Trace event: thought
-		if rec := trace.HandlerFrom(ctx); rec != nil {
-			rec.AddEvent(ctx, "thought", &ThoughtEvent{
-				Iteration: state.Iteration,
-				Content:   strings.Join(resp.Texts, " "),
-			})
-		}
+	if err := s.think(ctx, state.Iteration, resp); err != nil {
+		return nil, nil, err
 	}
 
 	// Check if this is a final response (no tool calls)
 	if len(resp.FunctionCalls) == 0 {
-		// Record action as respond
-		s.recordAction(ActionTypeRespond, nil, strings.Join(resp.Texts, " "))
+		if err := s.act(ctx, state.Iteration, ActionTypeRespond, nil, strings.Join(resp.Texts, " ")); err != nil {
+			return nil, nil, err
+		}
 		// Mark observation as complete (no tools executed)
 		s.recordObservation(nil, true, nil)
 
-		s.endTime = time.Now()
+		s.endTime = gollem.Now(ctx)
 		return nil, &gollem.ExecuteResponse{
 			Texts: resp.Texts,
 		}, nil
 	}
 
-	// Record action as tool calls
-	s.recordAction(ActionTypeToolCall, resp.FunctionCalls, "")
-
-	// Trace event: action
-	if rec := trace.HandlerFrom(ctx); rec != nil {
-		var toolNames []string
-		for _, fc := range resp.FunctionCalls {
-			toolNames = append(toolNames, fc.Name)
-		}
-		rec.AddEvent(ctx, "action", &ActionEvent{
-			Iteration:  state.Iteration,
-			ActionType: string(ActionTypeToolCall),
-			ToolNames:  toolNames,
-		})
+	if err := s.act(ctx, state.Iteration, ActionTypeToolCall, resp.FunctionCalls, ""); err != nil {
+		return nil, nil, err
 	}
 
 	// Check for loops
 	actionKey := s.generateActionKey(resp.FunctionCalls)
 	if s.detectLoop(actionKey) {
-		s.endTime = time.Now()
+		s.endTime = gollem.Now(ctx)
 		return nil, &gollem.ExecuteResponse{
 			Texts: []string{fmt.Sprintf("Loop detected: same action repeated %d times", s.maxRepeatedActions)},
 		}, nil
 	}
 
-	// Continue to observation phase (tool execution handled by gollem core)
+	// Tool results are not available yet, continue to observation phase
+	toolResults := convertFunctionResponsesToToolResults(state.NextInput)
+	if len(toolResults) == 0 {
+		return state.NextInput, nil, nil
+	}
+
+	success, err := s.observe(ctx, state.Iteration, toolResults)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exitResp := s.checkConsecutiveErrors(ctx, success); exitResp != nil {
+		return nil, exitResp, nil
+	}
+
+	// The function responses must be sent back to the LLM as they are
 	return state.NextInput, nil, nil
 }
 
@@ -184,50 +186,186 @@ func (s *Strategy) handleObservation(ctx context.Context, state *gollem.Strategy
 	// Convert function responses to tool results
 	toolResults := convertFunctionResponsesToToolResults(state.NextInput)
 
+	success, err := s.observe(ctx, state.Iteration, toolResults)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exitResp := s.checkConsecutiveErrors(ctx, success); exitResp != nil {
+		return nil, exitResp, nil
+	}
+
+	// Build observation prompt
+	observationPrompt := gollem.Text(s.buildObservationPrompt(toolResults))
+
+	// Return only observation prompt (state.NextInput contains raw FunctionResponse objects
+	// which would duplicate the information already formatted in observationPrompt)
+	return []gollem.Input{observationPrompt}, nil, nil
+}
+
+// handleInner records the TAO cycle of the iteration and lets the inner strategy decide the
+// next inputs
+func (s *Strategy) handleInner(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+	if state.Iteration >= s.maxIterations {
+		return nil, s.maxIterationsResponse(ctx), nil
+	}
+
+	if resp := state.LastResponse; resp != nil {
+		if s.currentEntry == nil {
+			s.addTAOEntry(ctx, state.Iteration)
+		}
+		if err := s.think(ctx, state.Iteration, resp); err != nil {
+			return nil, nil, err
+		}
+
+		if len(resp.FunctionCalls) == 0 {
+			if err := s.act(ctx, state.Iteration, ActionTypeRespond, nil, strings.Join(resp.Texts, " ")); err != nil {
+				return nil, nil, err
+			}
+			s.recordObservation(nil, true, nil)
+		} else {
+			if err := s.act(ctx, state.Iteration, ActionTypeToolCall, resp.FunctionCalls, ""); err != nil {
+				return nil, nil, err
+			}
+			if _, err := s.observe(ctx, state.Iteration, convertFunctionResponsesToToolResults(state.NextInput)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	inputs, exitResp, err := s.inner.Handle(ctx, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exitResp != nil {
+		s.endTime = gollem.Now(ctx)
+	}
+	return inputs, exitResp, nil
+}
+
+// think records the thought of resp. The reasoning is the thinking output of the LLM if it
+// has one, and the texts of resp otherwise.
+func (s *Strategy) think(ctx context.Context, iteration int, resp *gollem.Response) error {
+	if len(resp.Texts) == 0 && len(resp.Thoughts) == 0 {
+		return nil
+	}
+
+	thought := &ThoughtData{
+		Content:   strings.Join(resp.Texts, " "),
+		Reasoning: strings.Join(resp.Thoughts, "\n"),
+	}
+	if thought.Reasoning == "" {
+		thought.Reasoning = thought.Content
+	}
+	s.recordThought(thought)
+
+	// Trace event: thought
+	if rec := trace.HandlerFrom(ctx); rec != nil {
+		rec.AddEvent(ctx, "thought", &ThoughtEvent{
+			Iteration: iteration,
+			Content:   thought.Content,
+		})
+	}
+
+	if s.hooks != nil {
+		if err := s.hooks.OnThought(ctx, iteration, thought); err != nil {
+			return goerr.Wrap(err, "hook OnThought failed", goerr.V("iteration", iteration))
+		}
+	}
+	return nil
+}
+
+// act records the action of the iteration
+func (s *Strategy) act(ctx context.Context, iteration int, actionType ActionType, toolCalls []*gollem.FunctionCall, response string) error {
+	action := &ActionData{
+		Type:      actionType,
+		ToolCalls: toolCalls,
+		Response:  response,
+	}
+	s.recordAction(action)
+
+	// Trace event: action
+	if actionType == ActionTypeToolCall {
+		if rec := trace.HandlerFrom(ctx); rec != nil {
+			var toolNames []string
+			for _, fc := range toolCalls {
+				toolNames = append(toolNames, fc.Name)
+			}
+			rec.AddEvent(ctx, "action", &ActionEvent{
+				Iteration:  iteration,
+				ActionType: string(actionType),
+				ToolNames:  toolNames,
+			})
+		}
+	}
+
+	if s.hooks != nil {
+		if err := s.hooks.OnAction(ctx, iteration, action); err != nil {
+			return goerr.Wrap(err, "hook OnAction failed", goerr.V("iteration", iteration))
+		}
+	}
+	return nil
+}
+
+// observe records the observation of the tool results, starts the TAO entry of the next
+// iteration and reports whether all the tools succeeded.
+func (s *Strategy) observe(ctx context.Context, iteration int, toolResults []ToolResult) (bool, error) {
 	// Check for errors
-	hasError := false
-	var err error
+	success := true
+	var toolErr error
 	for _, result := range toolResults {
 		if !result.Success {
-			hasError = true
-			err = goerr.Wrap(fmt.Errorf("tool execution failed: %s", result.Error), fmt.Sprintf("tool %s error", result.ToolName))
+			success = false
+			toolErr = goerr.Wrap(fmt.Errorf("tool execution failed: %s", result.Error), fmt.Sprintf("tool %s error", result.ToolName))
 			break
 		}
 	}
 
 	// Record observation
-	s.recordObservation(toolResults, !hasError, err)
+	observation := s.recordObservation(toolResults, success, toolErr)
 
 	// Trace event: observation
 	if rec := trace.HandlerFrom(ctx); rec != nil {
 		rec.AddEvent(ctx, "observation", &ObservationEvent{
-			Iteration: state.Iteration,
-			Success:   !hasError,
+			Iteration: iteration,
+			Success:   success,
 		})
 	}
 
-	// Track consecutive errors
-	if hasError {
-		s.consecutiveErrors++
-		if s.consecutiveErrors >= MaxConsecutiveErrors {
-			s.endTime = time.Now()
-			return nil, &gollem.ExecuteResponse{
-				Texts: []string{fmt.Sprintf("Maximum consecutive errors (%d) reached", MaxConsecutiveErrors)},
-			}, nil
+	// Create new TAO entry for next iteration
+	s.addTAOEntry(ctx, iteration+1)
+
+	if s.hooks != nil {
+		if err := s.hooks.OnObservation(ctx, iteration, observation); err != nil {
+			return false, goerr.Wrap(err, "hook OnObservation failed", goerr.V("iteration", iteration))
 		}
-	} else {
-		s.consecutiveErrors = 0
 	}
+	return success, nil
+}
 
-	// Build observation prompt
-	observationPrompt := gollem.Text(s.buildObservationPrompt(toolResults))
+// checkConsecutiveErrors tracks consecutive tool errors and returns the response ending the
+// execution when there are too many
+func (s *Strategy) checkConsecutiveErrors(ctx context.Context, success bool) *gollem.ExecuteResponse {
+	if success {
+		s.consecutiveErrors = 0
+		return nil
+	}
 
-	// Create new TAO entry for next iteration
-	s.addTAOEntry(state.Iteration + 1)
+	s.consecutiveErrors++
+	if s.consecutiveErrors < MaxConsecutiveErrors {
+		return nil
+	}
+	s.endTime = gollem.Now(ctx)
+	return &gollem.ExecuteResponse{
+		Texts: []string{fmt.Sprintf("Maximum consecutive errors (%d) reached", MaxConsecutiveErrors)},
+	}
+}
 
-	// Return only observation prompt (state.NextInput contains raw FunctionResponse objects
-	// which would duplicate the information already formatted in observationPrompt)
-	return []gollem.Input{observationPrompt}, nil, nil
+// maxIterationsResponse returns the response ending the execution at the maximum iterations
+func (s *Strategy) maxIterationsResponse(ctx context.Context) *gollem.ExecuteResponse {
+	s.endTime = gollem.Now(ctx)
+	return &gollem.ExecuteResponse{
+		Texts: []string{fmt.Sprintf("Maximum iterations (%d) reached without completion", s.maxIterations)},
+	}
 }
 
 // generateActionKey generates a unique key for an action (for loop detection)
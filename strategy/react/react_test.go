@@ -14,6 +14,7 @@ import (
 	"github.com/m-mizutani/gollem/llm/gemini"
 	"github.com/m-mizutani/gollem/llm/openai"
 	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
 	"github.com/m-mizutani/gollem/strategy/react"
 	"github.com/m-mizutani/gt"
 )
@@ -448,6 +449,163 @@ func TestCompleteScenario(t *testing.T) {
 	})
 }
 
+// hookRecorder records the phases sent to the hooks
+type hookRecorder struct {
+	phases       []string
+	thoughts     []*react.ThoughtData
+	observations []*react.ObservationData
+	actionErr    error
+}
+
+func (h *hookRecorder) OnThought(ctx context.Context, iteration int, thought *react.ThoughtData) error {
+	h.phases = append(h.phases, fmt.Sprintf("thought:%d", iteration))
+	h.thoughts = append(h.thoughts, thought)
+	return nil
+}
+
+func (h *hookRecorder) OnAction(ctx context.Context, iteration int, action *react.ActionData) error {
+	h.phases = append(h.phases, fmt.Sprintf("action:%d:%s", iteration, action.Type))
+	return h.actionErr
+}
+
+func (h *hookRecorder) OnObservation(ctx context.Context, iteration int, observation *react.ObservationData) error {
+	h.phases = append(h.phases, fmt.Sprintf("observation:%d", iteration))
+	h.observations = append(h.observations, observation)
+	return nil
+}
+
+// newScriptedClient returns a client whose sessions return responses in order
+func newScriptedClient(responses ...*gollem.Response) *mock.LLMClientMock {
+	var calls int
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					if calls >= len(responses) {
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+					calls++
+					return responses[calls-1], nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	calc := &gollem.FunctionCall{
+		ID:        "calc-1",
+		Name:      "calculator",
+		Arguments: map[string]any{"operation": "add", "a": 2.0, "b": 2.0},
+	}
+
+	t.Run("thought, action and observation of agent execution", func(t *testing.T) {
+		client := newScriptedClient(
+			&gollem.Response{
+				Texts:         []string{"Let me calculate that"},
+				Thoughts:      []string{"The user asks 2+2, the calculator can answer it"},
+				FunctionCalls: []*gollem.FunctionCall{calc},
+			},
+			&gollem.Response{Texts: []string{"The answer is 4"}},
+		)
+		hooks := &hookRecorder{}
+		strategy := react.New(client, react.WithHooks(hooks))
+		agent := gollem.New(client, gollem.WithStrategy(strategy), gollem.WithTools(&CalculatorTool{}))
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("What is 2+2?"))
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"The answer is 4"}, resp.Texts)
+
+		gt.Equal(t, []string{
+			"thought:1", "action:1:tool_call", "observation:1",
+			"thought:2", "action:2:respond",
+		}, hooks.phases)
+		gt.Equal(t, "Let me calculate that", hooks.thoughts[0].Content)
+		gt.Equal(t, "The user asks 2+2, the calculator can answer it", hooks.thoughts[0].Reasoning)
+		gt.Equal(t, "The answer is 4", hooks.thoughts[1].Reasoning)
+		gt.True(t, hooks.observations[0].Success)
+		gt.Equal(t, `{"result":4}`, hooks.observations[0].ToolResults[0].Output)
+
+		// Every TAO cycle is in the trace, with the observation of the tool call
+		trace := strategy.ExportTrace()
+		gt.A(t, trace.Entries).Length(2)
+		gt.NotNil(t, trace.Entries[0].Observation)
+		gt.A(t, trace.Entries[0].Observation.ToolResults).Length(1)
+	})
+
+	t.Run("hook error aborts execution", func(t *testing.T) {
+		client := newScriptedClient(&gollem.Response{
+			Texts:         []string{"Let me calculate that"},
+			FunctionCalls: []*gollem.FunctionCall{calc},
+		})
+		hooks := &hookRecorder{actionErr: fmt.Errorf("action not allowed")}
+		strategy := react.New(client, react.WithHooks(hooks))
+		agent := gollem.New(client, gollem.WithStrategy(strategy), gollem.WithTools(&CalculatorTool{}))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("What is 2+2?"))
+		gt.Error(t, err).Contains("action not allowed")
+	})
+}
+
+func TestInnerStrategy(t *testing.T) {
+	plan := &planexec.Plan{
+		Goal: "Answer 2+2",
+		Tasks: []planexec.Task{
+			{ID: "task-1", Description: "Calculate 2+2", State: planexec.TaskStatePending},
+		},
+	}
+
+	var calls int
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					if _, ok := input[0].(gollem.FunctionResponse); ok {
+						return &gollem.Response{Texts: []string{"2+2 is 4"}}, nil
+					}
+					text := string(input[0].(gollem.Text))
+					switch {
+					case strings.Contains(text, "# Task Execution"):
+						calls++
+						return &gollem.Response{
+							Texts: []string{"I use the calculator"},
+							FunctionCalls: []*gollem.FunctionCall{
+								{ID: "calc-1", Name: "calculator", Arguments: map[string]any{"operation": "add", "a": 2.0, "b": 2.0}},
+							},
+						}, nil
+					case strings.Contains(text, "# Task Reflection"):
+						return &gollem.Response{Texts: []string{`{"new_tasks": [], "updated_tasks": [], "reason": "done"}`}}, nil
+					}
+					return &gollem.Response{Texts: []string{"The answer is 4"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	hooks := &hookRecorder{}
+	strategy := react.New(client,
+		react.WithHooks(hooks),
+		react.WithInnerStrategy(planexec.New(client, planexec.WithPlan(plan))),
+	)
+	agent := gollem.New(client, gollem.WithStrategy(strategy), gollem.WithTools(&CalculatorTool{}))
+
+	_, err := agent.Execute(t.Context(), gollem.Text("What is 2+2?"))
+	gt.NoError(t, err)
+	gt.Equal(t, 1, calls)
+
+	// The tool call of the plan task is captured as a TAO cycle
+	gt.A(t, hooks.phases).Has("action:1:tool_call")
+	gt.A(t, hooks.phases).Has("observation:1")
+	gt.A(t, hooks.observations).Length(1)
+	gt.True(t, hooks.observations[0].Success)
+}
+
 // CalculatorTool is a simple calculator tool for testing
 type CalculatorTool struct{}
 
@@ -1,6 +1,7 @@
 package react
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
@@ -8,57 +9,51 @@ import (
 )
 
 // addTAOEntry adds a new TAO entry to the trace
-func (s *Strategy) addTAOEntry(iteration int) {
+func (s *Strategy) addTAOEntry(ctx context.Context, iteration int) {
 	entry := &TAOEntry{
 		Iteration: iteration,
-		Timestamp: time.Now(),
+		Timestamp: gollem.Now(ctx),
 	}
 	s.currentEntry = entry
 }
 
 // recordThought records the thought phase data
-func (s *Strategy) recordThought(content string) {
+func (s *Strategy) recordThought(thought *ThoughtData) {
 	if s.currentEntry == nil {
 		return
 	}
-	s.currentEntry.Thought = &ThoughtData{
-		Content:   content,
-		Reasoning: content,
-	}
+	s.currentEntry.Thought = thought
 }
 
 // recordAction records the action phase data
-func (s *Strategy) recordAction(actionType ActionType, toolCalls []*gollem.FunctionCall, response string) {
+func (s *Strategy) recordAction(action *ActionData) {
 	if s.currentEntry == nil {
 		return
 	}
-	s.currentEntry.Action = &ActionData{
-		Type:      actionType,
-		ToolCalls: toolCalls,
-		Response:  response,
-	}
+	s.currentEntry.Action = action
 }
 
-// recordObservation records the observation phase data
-func (s *Strategy) recordObservation(toolResults []ToolResult, success bool, err error) {
-	if s.currentEntry == nil {
-		return
-	}
-
+// recordObservation records the observation phase data and returns it
+func (s *Strategy) recordObservation(toolResults []ToolResult, success bool, err error) *ObservationData {
 	var errStr string
 	if err != nil {
 		errStr = err.Error()
 	}
 
-	s.currentEntry.Observation = &ObservationData{
+	observation := &ObservationData{
 		ToolResults: toolResults,
 		Success:     success,
 		Error:       errStr,
 	}
+	if s.currentEntry == nil {
+		return observation
+	}
+	s.currentEntry.Observation = observation
 
 	// Finalize this entry and add to trace
 	s.trace = append(s.trace, *s.currentEntry)
 	s.currentEntry = nil
+	return observation
 }
 
 // convertFunctionResponsesToToolResults converts gollem.FunctionResponse to ToolResult
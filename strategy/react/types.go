@@ -1,6 +1,7 @@
 package react
 
 import (
+	"context"
 	"time"
 
 	"github.com/m-mizutani/gollem"
@@ -85,11 +86,28 @@ type FewShotExample struct {
 	Answer      string `json:"answer"`
 }
 
+// Hooks receives each phase of the TAO cycles as they are recorded. An error returned by a
+// hook aborts the execution.
+type Hooks interface {
+	// OnThought is called with the reasoning of the LLM response of the iteration
+	OnThought(ctx context.Context, iteration int, thought *ThoughtData) error
+	// OnAction is called with the tool calls or the answer of the LLM response
+	OnAction(ctx context.Context, iteration int, action *ActionData) error
+	// OnObservation is called with the results of the tools called by the action
+	OnObservation(ctx context.Context, iteration int, observation *ObservationData) error
+}
+
 // Strategy implements the ReAct (Reasoning and Acting) pattern
 type Strategy struct {
 	// LLM client
 	llm gollem.LLMClient
 
+	// Lifecycle hooks
+	hooks Hooks
+
+	// Strategy deciding the next inputs instead of the ReAct loop, e.g. plan mode
+	inner gollem.Strategy
+
 	// Configuration
 	maxIterations      int
 	maxRepeatedActions int
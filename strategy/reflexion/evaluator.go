@@ -25,6 +25,7 @@ func NewLLMEvaluator(client gollem.LLMClient) Evaluator {
 		if err != nil {
 			return nil, goerr.Wrap(err, "failed to generate evaluation")
 		}
+		gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseEvaluate), resp)
 
 		// Parse response for SUCCESS/FAILURE
 		result := parseEvaluationResponse(resp)
@@ -23,6 +23,7 @@ func generateReflection(ctx context.Context, client gollem.LLMClient, trajectory
 	if err != nil {
 		return "", goerr.Wrap(err, "failed to generate reflection")
 	}
+	gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseReflect), resp)
 
 	return strings.Join(resp.Texts, "\n"), nil
 }
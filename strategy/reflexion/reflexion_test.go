@@ -58,6 +58,12 @@ func (m *mockSession) GenerateStream(ctx context.Context, input ...gollem.Input)
 	return m.Stream(ctx, input)
 }
 
+func (m *mockSession) StreamContent(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Stream, error) {
+	return gollem.NewStream(ctx, func(ctx context.Context) (<-chan *gollem.Response, error) {
+		return m.Stream(ctx, input, opts...)
+	})
+}
+
 func (m *mockSession) History() (*gollem.History, error) {
 	return &gollem.History{}, nil
 }
@@ -0,0 +1,49 @@
+package tot
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+)
+
+var scorePattern = regexp.MustCompile(`[0-9]*\.?[0-9]+`)
+
+// NewLLMEvaluator creates a new LLM-based evaluator.
+// It asks the LLM to score how likely the trajectory of a node leads to a correct solution.
+func NewLLMEvaluator(client gollem.LLMClient) Evaluator {
+	return func(ctx context.Context, task string, node *Node) (*Evaluation, error) {
+		session, err := client.NewSession(ctx)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to create session for evaluation")
+		}
+
+		resp, err := session.Generate(ctx, []gollem.Input{gollem.Text(buildEvaluationPrompt(task, node))})
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to generate evaluation", goerr.V("node", node.ID))
+		}
+		gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseEvaluate), resp)
+
+		eval := parseEvaluationResponse(resp)
+		eval.InputTokens = resp.InputToken
+		eval.OutputTokens = resp.OutputToken
+		return eval, nil
+	}
+}
+
+// parseEvaluationResponse parses the LLM's evaluation response.
+// The first number in the response is the score, clamped to 0.0-1.0.
+func parseEvaluationResponse(resp *gollem.Response) *Evaluation {
+	text := strings.Join(resp.Texts, "\n")
+	eval := &Evaluation{Feedback: text}
+
+	if match := scorePattern.FindString(text); match != "" {
+		if score, err := strconv.ParseFloat(match, 64); err == nil {
+			eval.Score = min(max(score, 0), 1)
+		}
+	}
+	return eval
+}
@@ -0,0 +1,68 @@
+package tot
+
+// Option is a function that configures a Strategy.
+type Option func(*Strategy)
+
+// WithBranches sets the number of candidate steps generated from each node.
+// Default is 3.
+func WithBranches(n int) Option {
+	return func(s *Strategy) {
+		s.branches = n
+	}
+}
+
+// WithBeamWidth sets the number of best nodes kept at each depth to expand further.
+// Default is 2.
+func WithBeamWidth(n int) Option {
+	return func(s *Strategy) {
+		s.beamWidth = n
+	}
+}
+
+// WithMaxDepth sets the maximum number of reasoning steps of a branch.
+// Default is 3.
+func WithMaxDepth(n int) Option {
+	return func(s *Strategy) {
+		s.maxDepth = n
+	}
+}
+
+// WithMaxConcurrency sets the maximum number of branches generated and evaluated at a time.
+// Default is 4. A value less than 2 runs branches one by one.
+func WithMaxConcurrency(n int) Option {
+	return func(s *Strategy) {
+		s.maxConcurrency = n
+	}
+}
+
+// WithMinScore prunes nodes scored below score.
+// Default is 0, which prunes nothing by score.
+func WithMinScore(score float64) Option {
+	return func(s *Strategy) {
+		s.minScore = score
+	}
+}
+
+// WithBranchTokenBudget sets the maximum tokens of a branch, including generation and
+// evaluation of all its steps. A node exceeding the budget is pruned.
+// Default is 0, which means unlimited.
+func WithBranchTokenBudget(tokens int) Option {
+	return func(s *Strategy) {
+		s.branchTokenBudget = tokens
+	}
+}
+
+// WithEvaluator sets a custom evaluator.
+// If not set, LLMEvaluator is used by default.
+func WithEvaluator(evaluator Evaluator) Option {
+	return func(s *Strategy) {
+		s.evaluator = evaluator
+	}
+}
+
+// WithHooks sets lifecycle hooks.
+func WithHooks(hooks Hooks) Option {
+	return func(s *Strategy) {
+		s.hooks = hooks
+	}
+}
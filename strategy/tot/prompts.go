@@ -0,0 +1,75 @@
+package tot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/gollem"
+)
+
+// finalAnswerPrefix marks a thought as a final answer.
+const finalAnswerPrefix = "FINAL ANSWER:"
+
+// buildThoughtPrompt creates a prompt for generating the next reasoning step of parent.
+func buildThoughtPrompt(task string, parent *Node, depth, maxDepth int) string {
+	var instruction string
+	if depth >= maxDepth {
+		instruction = fmt.Sprintf(`This is the last step. Give the final answer, starting with "%s".`, finalAnswerPrefix)
+	} else {
+		instruction = fmt.Sprintf(`Propose the next single reasoning step toward solving the task. Respond with the step only.
+If the steps so far are enough to solve the task, give the final answer instead, starting with "%s".`, finalAnswerPrefix)
+	}
+
+	return fmt.Sprintf(`Solve the task step by step.
+
+Task:
+%s
+
+Reasoning steps so far:
+%s
+
+%s`, task, formatTrajectory(parent), instruction)
+}
+
+// buildEvaluationPrompt creates a prompt for scoring a node.
+func buildEvaluationPrompt(task string, node *Node) string {
+	return fmt.Sprintf(`Evaluate how likely the reasoning steps lead to a correct solution of the task.
+
+Task:
+%s
+
+Reasoning steps:
+%s
+
+Respond with a score between 0.0 (wrong or a dead end) and 1.0 (certainly correct) on the first line, followed by a brief explanation.`,
+		task, formatTrajectory(node))
+}
+
+// buildAnswerPrompt creates a prompt for the agent to answer with the best trajectory.
+func buildAnswerPrompt(best *Node) string {
+	return fmt.Sprintf(`The following reasoning was selected as the most promising approach to the task. Follow it to answer, using tools if needed.
+
+%s`, formatTrajectory(best))
+}
+
+// formatTrajectory formats the steps of the branch of node.
+func formatTrajectory(node *Node) string {
+	if node == nil {
+		return "(none)"
+	}
+
+	var lines []string
+	for _, n := range node.Trajectory() {
+		lines = append(lines, fmt.Sprintf("Step %d: %s", n.Depth, n.Thought))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatInputs formats the task given by inputs.
+func formatInputs(inputs []gollem.Input) string {
+	var parts []string
+	for _, input := range inputs {
+		parts = append(parts, input.String())
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,226 @@
+package tot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// search explores the tree of thoughts of task by beam search and returns the best node, or nil
+// if no branch survived. Final answers are preferred over unfinished branches.
+func (s *Strategy) search(ctx context.Context, task string) (*Node, error) {
+	frontier := []*Node{nil} // nil is the root of the first steps
+	var finals, kept []*Node
+
+	for depth := 1; depth <= s.maxDepth && len(frontier) > 0; depth++ {
+		candidates, err := s.expand(ctx, task, frontier, depth)
+		if err != nil {
+			return nil, err
+		}
+		s.nodes = append(s.nodes, candidates...)
+
+		if s.hooks != nil {
+			for _, node := range candidates {
+				if err := s.hooks.OnNodeEvaluated(ctx, node); err != nil {
+					return nil, goerr.Wrap(err, "hook OnNodeEvaluated failed")
+				}
+			}
+		}
+
+		// Keep the best candidates in the beam. Final answers end their branch.
+		var alive []*Node
+		for _, node := range candidates {
+			if !node.Pruned {
+				alive = append(alive, node)
+			}
+		}
+		slices.SortStableFunc(alive, func(a, b *Node) int {
+			return compareScore(b, a)
+		})
+		if len(alive) > s.beamWidth {
+			for _, node := range alive[s.beamWidth:] {
+				node.Pruned = true
+				node.PruneReason = "outside the beam"
+			}
+			alive = alive[:s.beamWidth]
+		}
+
+		frontier = nil
+		for _, node := range alive {
+			switch {
+			case node.Final:
+				finals = append(finals, node)
+			case s.branchTokenBudget > 0 && node.Tokens() >= s.branchTokenBudget:
+				// No budget left to expand, but the branch is still a candidate
+				kept = append(kept, node)
+			default:
+				frontier = append(frontier, node)
+			}
+		}
+		if len(frontier) > 0 {
+			kept = frontier
+		}
+
+		// Trace event: step
+		if rec := trace.HandlerFrom(ctx); rec != nil {
+			var ids []string
+			for _, node := range alive {
+				ids = append(ids, node.ID)
+			}
+			rec.AddEvent(ctx, "tot_step", &StepEvent{
+				Depth:      depth,
+				Candidates: len(candidates),
+				Kept:       ids,
+			})
+		}
+
+		if s.hooks != nil {
+			if err := s.hooks.OnStepDone(ctx, depth, alive); err != nil {
+				return nil, goerr.Wrap(err, "hook OnStepDone failed")
+			}
+		}
+	}
+
+	if best := bestNode(finals); best != nil {
+		return best, nil
+	}
+	return bestNode(kept), nil
+}
+
+// expand generates and evaluates the candidate steps of the frontier, at most maxConcurrency at
+// a time.
+func (s *Strategy) expand(ctx context.Context, task string, frontier []*Node, depth int) ([]*Node, error) {
+	var candidates []*Node
+	for _, parent := range frontier {
+		for j := range s.branches {
+			node := &Node{
+				ID:     strconv.Itoa(j + 1),
+				Depth:  depth,
+				Parent: parent,
+			}
+			if parent != nil {
+				node.ID = fmt.Sprintf("%s.%d", parent.ID, j+1)
+				node.InputTokens = parent.InputTokens
+				node.OutputTokens = parent.OutputTokens
+			}
+			candidates = append(candidates, node)
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, max(s.maxConcurrency, 1))
+	for _, node := range candidates {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			if err := s.grow(ctx, task, node); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return candidates, nil
+}
+
+// grow generates the thought of node and evaluates it. The tokens of both are added to the
+// branch, and the node is pruned if it exceeds the budget or scores below the minimum.
+func (s *Strategy) grow(ctx context.Context, task string, node *Node) error {
+	session, err := s.client.NewSession(ctx)
+	if err != nil {
+		return goerr.Wrap(err, "failed to create session for thought", goerr.V("node", node.ID))
+	}
+
+	prompt := buildThoughtPrompt(task, node.Parent, node.Depth, s.maxDepth)
+	resp, err := session.Generate(ctx, []gollem.Input{gollem.Text(prompt)})
+	if err != nil {
+		return goerr.Wrap(err, "failed to generate thought", goerr.V("node", node.ID))
+	}
+	gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhasePlan), resp)
+	node.InputTokens += resp.InputToken
+	node.OutputTokens += resp.OutputToken
+
+	thought := strings.TrimSpace(strings.Join(resp.Texts, "\n"))
+	if idx := strings.Index(thought, finalAnswerPrefix); idx >= 0 {
+		node.Final = true
+		thought = strings.TrimSpace(thought[idx+len(finalAnswerPrefix):])
+	}
+	node.Thought = thought
+
+	switch {
+	case thought == "":
+		prune(node, "empty thought")
+		return nil
+	case s.exceedsBudget(node):
+		prune(node, "token budget exceeded")
+		return nil
+	}
+
+	eval, err := s.evaluator(ctx, task, node)
+	if err != nil {
+		return goerr.Wrap(err, "failed to evaluate thought", goerr.V("node", node.ID))
+	}
+	node.Score = eval.Score
+	node.Feedback = eval.Feedback
+	node.InputTokens += eval.InputTokens
+	node.OutputTokens += eval.OutputTokens
+
+	switch {
+	case s.exceedsBudget(node):
+		prune(node, "token budget exceeded")
+	case node.Score < s.minScore:
+		prune(node, "score below minimum")
+	}
+	return nil
+}
+
+func (s *Strategy) exceedsBudget(node *Node) bool {
+	return s.branchTokenBudget > 0 && node.Tokens() > s.branchTokenBudget
+}
+
+func prune(node *Node, reason string) {
+	node.Pruned = true
+	node.PruneReason = reason
+}
+
+// bestNode returns the node with the highest score, preferring the deeper one on ties.
+func bestNode(nodes []*Node) *Node {
+	var best *Node
+	for _, node := range nodes {
+		if best == nil || compareScore(node, best) > 0 {
+			best = node
+		}
+	}
+	return best
+}
+
+// compareScore compares nodes by score and then by depth.
+func compareScore(a, b *Node) int {
+	switch {
+	case a.Score != b.Score:
+		if a.Score > b.Score {
+			return 1
+		}
+		return -1
+	default:
+		return a.Depth - b.Depth
+	}
+}
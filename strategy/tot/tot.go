@@ -0,0 +1,164 @@
+// Package tot implements the Tree-of-Thoughts strategy for gollem.
+//
+// Tree of Thoughts explores multiple candidate reasoning steps at each depth, scores every
+// branch with an evaluator and keeps only the most promising ones (beam search). The best
+// trajectory found by the search is then given to the agent, which answers the task following
+// it, with tools if needed.
+//
+// Basic usage:
+//
+//	strategy := tot.New(llmClient,
+//	    tot.WithBranches(3),
+//	    tot.WithBeamWidth(2),
+//	    tot.WithMaxDepth(3),
+//	)
+//
+//	agent := gollem.New(llmClient, gollem.WithStrategy(strategy))
+//	response, err := agent.Execute(ctx, gollem.Text("Solve this puzzle..."))
+//
+// The strategy will:
+//  1. Generate candidate steps from each kept node concurrently
+//  2. Score each candidate with the configured evaluator and prune weak or over-budget branches
+//  3. Keep the best candidates and repeat until the branches give final answers or max depth
+//  4. Let the agent answer with the best trajectory
+package tot
+
+import (
+	"context"
+	"slices"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+const (
+	// DefaultBranches is the default number of candidate steps generated from each node
+	DefaultBranches = 3
+	// DefaultBeamWidth is the default number of nodes kept at each depth
+	DefaultBeamWidth = 2
+	// DefaultMaxDepth is the default maximum number of reasoning steps of a branch
+	DefaultMaxDepth = 3
+	// DefaultMaxConcurrency is the default maximum number of branches generated at a time
+	DefaultMaxConcurrency = 4
+)
+
+// Strategy is the main Tree-of-Thoughts strategy implementation.
+// It searches the reasoning tree of the task on the first iteration, and lets the agent
+// answer with the best trajectory in the following iterations.
+type Strategy struct {
+	client    gollem.LLMClient
+	evaluator Evaluator
+	hooks     Hooks
+
+	// Configuration
+	branches          int
+	beamWidth         int
+	maxDepth          int
+	maxConcurrency    int
+	minScore          float64
+	branchTokenBudget int
+
+	// Internal state (reset on Init)
+	nodes []*Node
+	best  *Node
+}
+
+// New creates a new Tree-of-Thoughts strategy with the given LLM client and options.
+// By default, it uses LLMEvaluator for evaluation, 3 branches, beam width of 2 and max depth of 3.
+func New(client gollem.LLMClient, options ...Option) *Strategy {
+	s := &Strategy{
+		client:         client,
+		branches:       DefaultBranches,
+		beamWidth:      DefaultBeamWidth,
+		maxDepth:       DefaultMaxDepth,
+		maxConcurrency: DefaultMaxConcurrency,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	// Set default evaluator if not provided
+	if s.evaluator == nil {
+		s.evaluator = NewLLMEvaluator(client)
+	}
+
+	return s
+}
+
+// Init initializes the strategy with initial inputs.
+// This is called once when Agent.Execute is invoked.
+func (s *Strategy) Init(ctx context.Context, inputs []gollem.Input) error {
+	s.nodes = nil
+	s.best = nil
+	return nil
+}
+
+// Tools returns additional tools provided by this strategy.
+// Tree-of-Thoughts strategy does not provide additional tools.
+func (s *Strategy) Tools(ctx context.Context) ([]gollem.Tool, error) {
+	return []gollem.Tool{}, nil
+}
+
+// Handle determines the next input for the LLM based on the current state.
+// The first iteration runs the search, and the following ones run the agent until it answers.
+func (s *Strategy) Handle(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+	if state.Iteration == 0 {
+		return s.startAnswer(ctx, state)
+	}
+
+	// No tool calls = final response
+	if state.LastResponse != nil && len(state.LastResponse.FunctionCalls) == 0 {
+		return nil, &gollem.ExecuteResponse{
+			Texts: state.LastResponse.Texts,
+		}, nil
+	}
+
+	return state.NextInput, nil, nil
+}
+
+// Best returns the best trajectory of the last search, or nil if no branch survived.
+func (s *Strategy) Best() []*Node {
+	if s.best == nil {
+		return nil
+	}
+	return s.best.Trajectory()
+}
+
+// Nodes returns all nodes generated by the last search, including pruned ones.
+func (s *Strategy) Nodes() []*Node {
+	return s.nodes
+}
+
+// startAnswer searches the tree and builds the inputs of the agent with the best trajectory.
+// If no branch survived, the agent answers the task without guidance.
+func (s *Strategy) startAnswer(ctx context.Context, state *gollem.StrategyState) ([]gollem.Input, *gollem.ExecuteResponse, error) {
+	best, err := s.search(ctx, formatInputs(state.InitInput))
+	if err != nil {
+		return nil, nil, err
+	}
+	s.best = best
+
+	// Trace event: search done
+	if rec := trace.HandlerFrom(ctx); rec != nil {
+		event := &SearchDoneEvent{Nodes: len(s.nodes)}
+		if best != nil {
+			event.Best = best.ID
+			event.Score = best.Score
+		}
+		rec.AddEvent(ctx, "tot_search_done", event)
+	}
+
+	if s.hooks != nil {
+		if err := s.hooks.OnSearchDone(ctx, s.Best()); err != nil {
+			return nil, nil, goerr.Wrap(err, "hook OnSearchDone failed")
+		}
+	}
+
+	if best == nil {
+		return state.InitInput, nil, nil
+	}
+	inputs := append(slices.Clone(state.InitInput), gollem.Text(buildAnswerPrompt(best)))
+	return inputs, nil, nil
+}
@@ -0,0 +1,297 @@
+package tot_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/tot"
+	"github.com/m-mizutani/gt"
+)
+
+// treeClient is a mock client answering thought prompts with thought, evaluation prompts with
+// evaluate and other prompts as the agent.
+type treeClient struct {
+	thought  func(prompt string) *gollem.Response
+	evaluate func(prompt string) *gollem.Response
+
+	mu           sync.Mutex
+	agentInputs  []gollem.Input
+	running      atomic.Int32
+	maxRunning   atomic.Int32
+	thoughtDelay time.Duration
+}
+
+func (c *treeClient) client() *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					prompt := input[len(input)-1].String()
+					switch {
+					case strings.HasPrefix(prompt, "Solve the task step by step."):
+						n := c.running.Add(1)
+						defer c.running.Add(-1)
+						for {
+							m := c.maxRunning.Load()
+							if n <= m || c.maxRunning.CompareAndSwap(m, n) {
+								break
+							}
+						}
+						time.Sleep(c.thoughtDelay)
+						return c.thought(prompt), nil
+					case strings.HasPrefix(prompt, "Evaluate how likely"):
+						return c.evaluate(prompt), nil
+					default:
+						c.mu.Lock()
+						c.agentInputs = append(c.agentInputs, input...)
+						c.mu.Unlock()
+						return &gollem.Response{Texts: []string{"answer"}}, nil
+					}
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+}
+
+// numberedThoughts returns thoughts "idea 1", "idea 2", ... in the order of generation.
+func numberedThoughts() func(prompt string) *gollem.Response {
+	var n atomic.Int32
+	return func(prompt string) *gollem.Response {
+		return &gollem.Response{
+			Texts:       []string{fmt.Sprintf("idea %d", n.Add(1))},
+			InputToken:  10,
+			OutputToken: 5,
+		}
+	}
+}
+
+// scoreByKeyword scores a node 0.9 if its last step contains keyword and 0.1 otherwise.
+func scoreByKeyword(keyword string) tot.Evaluator {
+	return func(ctx context.Context, task string, node *tot.Node) (*tot.Evaluation, error) {
+		if strings.Contains(node.Thought, keyword) {
+			return &tot.Evaluation{Score: 0.9, Feedback: "promising"}, nil
+		}
+		return &tot.Evaluation{Score: 0.1}, nil
+	}
+}
+
+// hookRecorder records the calls of the hooks
+type hookRecorder struct {
+	evaluated []string
+	steps     [][]string
+	best      []*tot.Node
+}
+
+func (h *hookRecorder) OnNodeEvaluated(ctx context.Context, node *tot.Node) error {
+	h.evaluated = append(h.evaluated, node.ID)
+	return nil
+}
+
+func (h *hookRecorder) OnStepDone(ctx context.Context, depth int, kept []*tot.Node) error {
+	var ids []string
+	for _, node := range kept {
+		ids = append(ids, node.ID)
+	}
+	h.steps = append(h.steps, ids)
+	return nil
+}
+
+func (h *hookRecorder) OnSearchDone(ctx context.Context, best []*tot.Node) error {
+	h.best = best
+	return nil
+}
+
+func TestSearch(t *testing.T) {
+	t.Run("best trajectory is given to the agent", func(t *testing.T) {
+		tc := &treeClient{thought: numberedThoughts()}
+		hooks := &hookRecorder{}
+		strategy := tot.New(tc.client(),
+			tot.WithBranches(3),
+			tot.WithBeamWidth(1),
+			tot.WithMaxDepth(2),
+			tot.WithMaxConcurrency(1),
+			tot.WithEvaluator(func(ctx context.Context, task string, node *tot.Node) (*tot.Evaluation, error) {
+				// "idea 2" is the best first step, and "idea 6" the best second one
+				switch node.Thought {
+				case "idea 2", "idea 6":
+					return &tot.Evaluation{Score: 0.9}, nil
+				}
+				return &tot.Evaluation{Score: 0.2}, nil
+			}),
+			tot.WithHooks(hooks),
+		)
+		agent := gollem.New(tc.client(), gollem.WithStrategy(strategy))
+
+		resp, err := agent.Execute(t.Context(), gollem.Text("make 24 from 4 9 10 13"))
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"answer"}, resp.Texts)
+
+		best := strategy.Best()
+		gt.A(t, best).Length(2)
+		gt.Equal(t, "idea 2", best[0].Thought)
+		gt.Equal(t, "idea 6", best[1].Thought)
+		gt.Equal(t, "2.3", best[1].ID)
+		gt.Equal(t, 20, best[1].InputTokens) // two thoughts of the branch
+		gt.A(t, strategy.Nodes()).Length(6)
+
+		gt.Equal(t, []string{"1", "2", "3", "2.1", "2.2", "2.3"}, hooks.evaluated)
+		gt.Equal(t, [][]string{{"2"}, {"2.3"}}, hooks.steps)
+		gt.Equal(t, best, hooks.best)
+
+		// The agent is asked with the task and the trajectory
+		gt.Equal(t, "make 24 from 4 9 10 13", tc.agentInputs[0].String())
+		guide := tc.agentInputs[1].String()
+		gt.S(t, guide).Contains("Step 1: idea 2")
+		gt.S(t, guide).Contains("Step 2: idea 6")
+	})
+
+	t.Run("final answer ends the branch", func(t *testing.T) {
+		var n atomic.Int32
+		tc := &treeClient{thought: func(prompt string) *gollem.Response {
+			if n.Add(1) == 1 {
+				return &gollem.Response{Texts: []string{"FINAL ANSWER: 42"}}
+			}
+			return &gollem.Response{Texts: []string{"keep thinking"}}
+		}}
+		strategy := tot.New(tc.client(),
+			tot.WithBranches(2),
+			tot.WithMaxDepth(3),
+			tot.WithMaxConcurrency(1),
+			tot.WithEvaluator(scoreByKeyword("42")),
+		)
+		agent := gollem.New(tc.client(), gollem.WithStrategy(strategy))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("the answer"))
+		gt.NoError(t, err)
+
+		best := strategy.Best()
+		gt.A(t, best).Length(1)
+		gt.True(t, best[0].Final)
+		gt.Equal(t, "42", best[0].Thought)
+		// The final answer is not expanded, only the unfinished branches are
+		gt.A(t, strategy.Nodes()).Length(2 + 2 + 4)
+	})
+
+	t.Run("branches run concurrently up to the limit", func(t *testing.T) {
+		tc := &treeClient{thought: numberedThoughts(), thoughtDelay: 20 * time.Millisecond}
+		strategy := tot.New(tc.client(),
+			tot.WithBranches(6),
+			tot.WithMaxDepth(1),
+			tot.WithMaxConcurrency(3),
+			tot.WithEvaluator(scoreByKeyword("idea")),
+		)
+		agent := gollem.New(tc.client(), gollem.WithStrategy(strategy))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("task"))
+		gt.NoError(t, err)
+		gt.A(t, strategy.Nodes()).Length(6)
+		gt.N(t, tc.maxRunning.Load()).LessOrEqual(3)
+		gt.N(t, tc.maxRunning.Load()).Greater(1)
+	})
+
+	t.Run("branch over the token budget is pruned", func(t *testing.T) {
+		tc := &treeClient{thought: numberedThoughts()}
+		strategy := tot.New(tc.client(),
+			tot.WithBranches(2),
+			tot.WithBeamWidth(2),
+			tot.WithMaxDepth(3),
+			tot.WithMaxConcurrency(1),
+			tot.WithBranchTokenBudget(30), // 15 tokens per thought and 5 per evaluation
+			tot.WithEvaluator(func(ctx context.Context, task string, node *tot.Node) (*tot.Evaluation, error) {
+				return &tot.Evaluation{Score: 0.5, InputTokens: 5}, nil
+			}),
+		)
+		agent := gollem.New(tc.client(), gollem.WithStrategy(strategy))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("task"))
+		gt.NoError(t, err)
+
+		// Depth 1 uses 20 tokens, and depth 2 exceeds the budget by the thought
+		nodes := strategy.Nodes()
+		gt.A(t, nodes).Length(2 + 4)
+		for _, node := range nodes[2:] {
+			gt.True(t, node.Pruned)
+			gt.Equal(t, "token budget exceeded", node.PruneReason)
+			gt.Equal(t, 35, node.Tokens())
+		}
+		gt.A(t, strategy.Best()).Length(1)
+	})
+
+	t.Run("low scores are pruned", func(t *testing.T) {
+		tc := &treeClient{thought: numberedThoughts()}
+		strategy := tot.New(tc.client(),
+			tot.WithBranches(2),
+			tot.WithMaxDepth(2),
+			tot.WithMinScore(0.5),
+			tot.WithEvaluator(scoreByKeyword("never")),
+		)
+		agent := gollem.New(tc.client(), gollem.WithStrategy(strategy))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("task"))
+		gt.NoError(t, err)
+
+		// No branch survived, so the agent answers without guidance
+		gt.Nil(t, strategy.Best())
+		gt.A(t, strategy.Nodes()).Length(2)
+		gt.A(t, tc.agentInputs).Length(1)
+	})
+
+	t.Run("generation error aborts", func(t *testing.T) {
+		client := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						return nil, errors.New("overloaded")
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return &gollem.History{}, nil
+					},
+				}, nil
+			},
+		}
+		agent := gollem.New(client, gollem.WithStrategy(tot.New(client)))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("task"))
+		gt.Error(t, err).Contains("overloaded")
+	})
+}
+
+func TestLLMEvaluator(t *testing.T) {
+	tc := &treeClient{
+		thought: numberedThoughts(),
+		evaluate: func(prompt string) *gollem.Response {
+			if strings.Contains(prompt, "idea 1") {
+				return &gollem.Response{Texts: []string{"0.8\nLooks right"}, InputToken: 7, OutputToken: 3}
+			}
+			return &gollem.Response{Texts: []string{"Score: 1.7 (clamped)"}}
+		},
+	}
+	strategy := tot.New(tc.client(),
+		tot.WithBranches(2),
+		tot.WithMaxDepth(1),
+		tot.WithMaxConcurrency(1),
+	)
+	agent := gollem.New(tc.client(), gollem.WithStrategy(strategy))
+
+	_, err := agent.Execute(t.Context(), gollem.Text("task"))
+	gt.NoError(t, err)
+
+	nodes := strategy.Nodes()
+	gt.A(t, nodes).Length(2)
+	gt.Equal(t, 0.8, nodes[0].Score)
+	gt.Equal(t, "0.8\nLooks right", nodes[0].Feedback)
+	gt.Equal(t, 17, nodes[0].InputTokens)
+	gt.Equal(t, 1.0, nodes[1].Score)
+	gt.Equal(t, "2", strategy.Best()[0].ID)
+}
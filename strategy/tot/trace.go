@@ -0,0 +1,15 @@
+package tot
+
+// StepEvent is recorded when a depth of the search is done.
+type StepEvent struct {
+	Depth      int      `json:"depth"`
+	Candidates int      `json:"candidates"`
+	Kept       []string `json:"kept"`
+}
+
+// SearchDoneEvent is recorded when the search is done.
+type SearchDoneEvent struct {
+	Nodes int     `json:"nodes"`
+	Best  string  `json:"best,omitempty"`
+	Score float64 `json:"score"`
+}
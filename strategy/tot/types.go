@@ -0,0 +1,75 @@
+package tot
+
+import (
+	"context"
+)
+
+// Node is a reasoning step of a branch of the search tree. The branch of a node is the path from
+// the root to the node.
+type Node struct {
+	ID       string  // Position in the tree, e.g. "2.1" is the first child of the second root step
+	Depth    int     // Depth of the step (1-indexed)
+	Thought  string  // Reasoning step generated by the LLM
+	Final    bool    // Whether the thought is a final answer
+	Score    float64 // Score by the Evaluator (0.0-1.0)
+	Feedback string  // Feedback by the Evaluator
+
+	// Tokens used by the branch up to and including this node, for generation and evaluation
+	InputTokens  int
+	OutputTokens int
+
+	Pruned      bool   // Whether the node was dropped from the search
+	PruneReason string // Why the node was pruned
+
+	Parent *Node // nil for the first step
+}
+
+// Tokens returns the total tokens used by the branch of the node.
+func (x *Node) Tokens() int {
+	return x.InputTokens + x.OutputTokens
+}
+
+// Trajectory returns the steps of the branch from the first step to the node.
+func (x *Node) Trajectory() []*Node {
+	var nodes []*Node
+	for n := x; n != nil; n = n.Parent {
+		nodes = append([]*Node{n}, nodes...)
+	}
+	return nodes
+}
+
+// Evaluation is the result of evaluating a node.
+type Evaluation struct {
+	Score    float64 // How promising the branch is (0.0-1.0)
+	Feedback string  // Optional explanation
+
+	// Tokens used by the evaluation, counted in the budget of the branch
+	InputTokens  int
+	OutputTokens int
+}
+
+// Evaluator scores a node with its trajectory toward solving task. Users can provide custom
+// evaluation logic as a function.
+//
+// Example:
+//
+//	evaluator := tot.Evaluator(func(ctx context.Context, task string, node *tot.Node) (*tot.Evaluation, error) {
+//	    if node.Final && verify(node.Thought) {
+//	        return &tot.Evaluation{Score: 1.0}, nil
+//	    }
+//	    return &tot.Evaluation{Score: 0.5}, nil
+//	})
+type Evaluator func(ctx context.Context, task string, node *Node) (*Evaluation, error)
+
+// Hooks provides lifecycle hooks for observing the search. Hooks are called from the goroutine
+// of Handle, not from the branch goroutines.
+type Hooks interface {
+	// OnNodeEvaluated is called for every generated node after its evaluation, including pruned ones.
+	OnNodeEvaluated(ctx context.Context, node *Node) error
+
+	// OnStepDone is called when a depth of the search is done with the nodes kept for the next step.
+	OnStepDone(ctx context.Context, depth int, kept []*Node) error
+
+	// OnSearchDone is called with the best trajectory before the agent answers with it.
+	OnSearchDone(ctx context.Context, best []*Node) error
+}
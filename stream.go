@@ -0,0 +1,170 @@
+package gollem
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// Stream is an iterator of the responses of Session.StreamContent. It wraps the channel of
+// Session.Stream, and adds what the channel can't do: Close and CloseWithError stop the
+// generation by canceling its context with the consumer's error as the cause. The built-in
+// sessions send responses on unbuffered channels, so a consumer not calling Next holds back
+// the responses after the ones in flight, but the provider's HTTP stream is still read by its
+// SDK. The zero value is not usable.
+//
+//	stream, err := session.StreamContent(ctx, []gollem.Input{gollem.Text("hello")})
+//	if err != nil {
+//		return err
+//	}
+//	defer stream.Close()
+//	for stream.Next() {
+//		fmt.Print(strings.Join(stream.Response().Texts, ""))
+//	}
+//	if err := stream.Err(); err != nil {
+//		return err
+//	}
+//
+// Next, Response and Err must be called from one goroutine. Close and CloseWithError can be
+// called from any goroutine.
+type Stream struct {
+	ch     <-chan *Response
+	cancel context.CancelCauseFunc
+	resp   *Response
+
+	mu   sync.Mutex
+	done bool
+	err  error
+}
+
+// NewStream returns a Stream of the responses of the channel returned by start. start is
+// called with a context canceled when the stream is closed, with ErrStreamClosed or the error
+// of CloseWithError as its cause. A response having Error ends the stream with the error. It's
+// intended for Session implementations building StreamContent on their channel API.
+func NewStream(ctx context.Context, start func(ctx context.Context) (<-chan *Response, error)) (*Stream, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	ch, err := start(ctx)
+	if err != nil {
+		cancel(err)
+		return nil, err
+	}
+	return &Stream{ch: ch, cancel: cancel}, nil
+}
+
+// Next waits for the next response and reports whether there is one. It returns false at the
+// end of the stream, when a response has an error, and after the stream is closed.
+func (s *Stream) Next() bool {
+	if s.closed() {
+		return false
+	}
+
+	resp, ok := <-s.ch
+	switch {
+	case !ok:
+		s.finish(nil)
+		return false
+	case resp.Error != nil:
+		s.finish(resp.Error)
+		return false
+	}
+
+	// The stream may be closed while waiting for the response
+	if s.closed() {
+		return false
+	}
+	s.resp = resp
+	return true
+}
+
+// Response returns the response of the last Next.
+func (s *Stream) Response() *Response {
+	return s.resp
+}
+
+// Err returns the error of the response that ended the stream, or nil if the stream ended
+// normally or was closed.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the stream. The context of the LLMClient is canceled with ErrStreamClosed, and
+// the rest of the responses are discarded. Closing an ended stream releases its context and
+// does nothing else.
+func (s *Stream) Close() error {
+	return s.CloseWithError(nil)
+}
+
+// CloseWithError stops the stream as Close, with err of the consumer, e.g. a lost connection
+// of the client the responses are sent to, as the cause of the canceled context. A nil err is
+// ErrStreamClosed.
+func (s *Stream) CloseWithError(err error) error {
+	if err == nil {
+		err = ErrStreamClosed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return nil
+	}
+	s.done = true
+	s.cancel(err)
+
+	// Let the LLMClient finish sending responses after cancellation
+	go func() {
+		for range s.ch {
+		}
+	}()
+	return nil
+}
+
+// All returns the iterator of the responses and the error ending the stream for range-over-func.
+// The stream is closed when the loop ends, including by break.
+//
+//	for resp, err := range stream.All() {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Print(strings.Join(resp.Texts, ""))
+//	}
+func (s *Stream) All() iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		defer s.Close()
+		for s.Next() {
+			if !yield(s.resp, nil) {
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func (s *Stream) closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// finish ends the stream by the end of the channel or err of a response.
+func (s *Stream) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	s.err = err
+	s.cancel(ErrStreamClosed)
+
+	// The channel may not be closed after an error
+	if err != nil {
+		go func() {
+			for range s.ch {
+			}
+		}()
+	}
+}
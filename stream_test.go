@@ -0,0 +1,144 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// newStreamSession returns a session streaming texts, setting the context of the stream to
+// streamCtx.
+func newStreamSession(texts []string, streamErr error, streamCtx *context.Context) *mock.SessionMock {
+	return &mock.SessionMock{
+		StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+			*streamCtx = ctx
+			ch := make(chan *gollem.Response)
+			go func() {
+				defer close(ch)
+				for _, text := range texts {
+					select {
+					case ch <- &gollem.Response{Texts: []string{text}}:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if streamErr != nil {
+					ch <- &gollem.Response{Error: streamErr}
+				}
+			}()
+			return ch, nil
+		},
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Run("next until the end", func(t *testing.T) {
+		var streamCtx context.Context
+		stream, err := newStreamSession([]string{"a", "b", "c"}, nil, &streamCtx).StreamContent(t.Context(), []gollem.Input{gollem.Text("hello")})
+		gt.NoError(t, err)
+		defer stream.Close()
+
+		var texts []string
+		for stream.Next() {
+			texts = append(texts, stream.Response().Texts...)
+		}
+		gt.NoError(t, stream.Err())
+		gt.Equal(t, []string{"a", "b", "c"}, texts)
+		gt.Error(t, context.Cause(streamCtx)).Is(gollem.ErrStreamClosed) // released at the end
+		gt.False(t, stream.Next())
+	})
+
+	t.Run("error ends the stream", func(t *testing.T) {
+		var streamCtx context.Context
+		stream, err := newStreamSession([]string{"a"}, errors.New("overloaded"), &streamCtx).StreamContent(t.Context(), nil)
+		gt.NoError(t, err)
+		defer stream.Close()
+
+		gt.True(t, stream.Next())
+		gt.False(t, stream.Next())
+		gt.Error(t, stream.Err()).Contains("overloaded")
+	})
+
+	t.Run("close stops the producer", func(t *testing.T) {
+		var streamCtx context.Context
+		stream, err := newStreamSession([]string{"a", "b", "c"}, nil, &streamCtx).StreamContent(t.Context(), nil)
+		gt.NoError(t, err)
+
+		gt.True(t, stream.Next())
+		gt.NoError(t, stream.Close())
+		gt.Error(t, context.Cause(streamCtx)).Is(gollem.ErrStreamClosed)
+		gt.False(t, stream.Next())
+		gt.NoError(t, stream.Err())
+	})
+
+	t.Run("close with consumer error", func(t *testing.T) {
+		var streamCtx context.Context
+		stream, err := newStreamSession([]string{"a", "b"}, nil, &streamCtx).StreamContent(t.Context(), nil)
+		gt.NoError(t, err)
+
+		clientGone := errors.New("client gone")
+		gt.True(t, stream.Next())
+		gt.NoError(t, stream.CloseWithError(clientGone))
+		gt.Error(t, context.Cause(streamCtx)).Is(clientGone)
+	})
+
+	t.Run("range over func", func(t *testing.T) {
+		var streamCtx context.Context
+		stream, err := newStreamSession([]string{"a", "b", "c"}, nil, &streamCtx).StreamContent(t.Context(), nil)
+		gt.NoError(t, err)
+
+		var texts []string
+		for resp, err := range stream.All() {
+			gt.NoError(t, err)
+			texts = append(texts, resp.Texts...)
+			if len(texts) == 2 {
+				break
+			}
+		}
+		gt.Equal(t, []string{"a", "b"}, texts)
+		gt.Error(t, context.Cause(streamCtx)).Is(gollem.ErrStreamClosed)
+	})
+
+	t.Run("range over func with error", func(t *testing.T) {
+		var streamCtx context.Context
+		stream, err := newStreamSession(nil, errors.New("overloaded"), &streamCtx).StreamContent(t.Context(), nil)
+		gt.NoError(t, err)
+
+		var errs []error
+		for resp, err := range stream.All() {
+			gt.Nil(t, resp)
+			errs = append(errs, err)
+		}
+		gt.A(t, errs).Length(1)
+	})
+
+	t.Run("start error", func(t *testing.T) {
+		session := &mock.SessionMock{
+			StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+				return nil, errors.New("unauthorized")
+			},
+		}
+		_, err := session.StreamContent(t.Context(), nil)
+		gt.Error(t, err).Contains("unauthorized")
+	})
+
+	t.Run("generate options are passed to Stream", func(t *testing.T) {
+		var got []gollem.GenerateOption
+		session := &mock.SessionMock{
+			StreamFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (<-chan *gollem.Response, error) {
+				got = opts
+				ch := make(chan *gollem.Response)
+				close(ch)
+				return ch, nil
+			},
+		}
+		stream, err := session.StreamContent(t.Context(), []gollem.Input{gollem.Text("hello")}, gollem.WithTemperature(0.5))
+		gt.NoError(t, err)
+		defer stream.Close()
+		gt.A(t, got).Length(1)
+	})
+}
@@ -283,6 +283,13 @@ func (s *SubAgent) Run(ctx context.Context, args map[string]any) (_ map[string]a
 		if err != nil {
 			return SubAgentResult{}, err
 		}
+		spec := s.Spec()
+		TracePrompt(ctx, &PromptEvent{
+			Phase:    UsagePhaseSubAgent(s.name),
+			Template: s.name,
+			Data:     spec.RedactArgs(args),
+			Prompt:   redactTexts(prompt, sensitiveTexts(spec.Parameters, args)),
+		})
 
 		// Create a new agent instance for this execution
 		agent, err := s.agentFactory()
@@ -299,7 +306,7 @@ func (s *SubAgent) Run(ctx context.Context, args map[string]any) (_ map[string]a
 		}
 
 		// Execute the child agent
-		resp, err := agent.Execute(ctx, Text(prompt))
+		resp, err := agent.Execute(ContextWithUsagePhase(ctx, UsagePhaseSubAgent(s.name)), Text(prompt))
 		if err != nil {
 			return SubAgentResult{}, goerr.Wrap(err, "subagent execution failed")
 		}
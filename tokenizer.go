@@ -0,0 +1,77 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Tokenizer counts tokens of text, e.g. by the BPE of a model for exact counts without calling
+// the API of the provider. It must be safe for concurrent use. See openai.NewTokenizer for the
+// tokenizer of OpenAI models.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// CountTokens implements Tokenizer, so that a TokenCounter such as EstimateTokens can be used as
+// a Tokenizer.
+func (f TokenCounter) CountTokens(text string) int {
+	return f(text)
+}
+
+type tokenizerCtxKey struct{}
+
+// ContextWithTokenizer returns a context that makes TokenizerFromContext return tokenizer.
+func ContextWithTokenizer(ctx context.Context, tokenizer Tokenizer) context.Context {
+	return context.WithValue(ctx, tokenizerCtxKey{}, tokenizer)
+}
+
+// TokenizerFromContext returns the Tokenizer of ctx, or EstimateTokens if none is set. Token
+// counts before LLM calls, such as those of TokenRateLimiter, WithContextWindowGuard and
+// compaction decisions of the compacter, use it.
+func TokenizerFromContext(ctx context.Context) Tokenizer {
+	if tokenizer, ok := ctx.Value(tokenizerCtxKey{}).(Tokenizer); ok && tokenizer != nil {
+		return tokenizer
+	}
+	return TokenCounter(EstimateTokens)
+}
+
+// WithTokenizer sets the Tokenizer of Execute in the same way as WithClock, so that token
+// counts before LLM calls of the agent match the model instead of EstimateTokens.
+func WithTokenizer(tokenizer Tokenizer) Option {
+	return func(s *gollemConfig) {
+		s.tokenizer = tokenizer
+	}
+}
+
+// CountRequestTokens counts the input tokens of req by tokenizer, counting images and PDFs as
+// fixed rough estimates. Per-message overheads of the providers are not counted.
+func CountRequestTokens(tokenizer Tokenizer, req *ContentRequest) int {
+	if req == nil {
+		return 0
+	}
+	tokens := tokenizer.CountTokens(req.SystemPrompt)
+	if req.History != nil {
+		tokens += req.History.TokenBreakdown(tokenizer.CountTokens).Total
+	}
+	for _, input := range req.Inputs {
+		switch v := input.(type) {
+		case Text:
+			tokens += tokenizer.CountTokens(string(v))
+		case Image, ImageURL:
+			tokens += imageTokenEstimate
+		case PDF:
+			tokens += pdfTokenEstimate
+		case File:
+			if v.IsText() {
+				tokens += tokenizer.CountTokens(string(v.Data()))
+			} else {
+				tokens += pdfTokenEstimate
+			}
+		default:
+			if raw, err := json.Marshal(v); err == nil {
+				tokens += tokenizer.CountTokens(string(raw))
+			}
+		}
+	}
+	return tokens
+}
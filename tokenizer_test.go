@@ -0,0 +1,63 @@
+package gollem_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+// wordTokenizer counts a token per word.
+var wordTokenizer = gollem.TokenCounter(func(text string) int {
+	return len(strings.Fields(text))
+})
+
+func TestCountRequestTokens(t *testing.T) {
+	history, err := gollem.NewHistoryBuilder().User("one two three").Assistant("four five").Build()
+	gt.NoError(t, err)
+	req := &gollem.ContentRequest{
+		SystemPrompt: "be brief",
+		History:      history,
+		Inputs:       []gollem.Input{gollem.Text("six seven")},
+	}
+
+	gt.Equal(t, 2+5+2, gollem.CountRequestTokens(wordTokenizer, req))
+	gt.Equal(t, 0, gollem.CountRequestTokens(wordTokenizer, nil))
+	gt.Equal(t, gollem.EstimateRequestTokens(req), gollem.CountRequestTokens(gollem.TokenCounter(gollem.EstimateTokens), req))
+}
+
+func TestTokenizerFromContext(t *testing.T) {
+	text := strings.Repeat("word ", 40)
+	gt.Equal(t, gollem.EstimateTokens(text), gollem.TokenizerFromContext(t.Context()).CountTokens(text))
+
+	ctx := gollem.ContextWithTokenizer(t.Context(), wordTokenizer)
+	gt.Equal(t, 40, gollem.TokenizerFromContext(ctx).CountTokens(text))
+
+	t.Run("rate limiter counts by the tokenizer", func(t *testing.T) {
+		tokens := &recordLimiter{}
+		req := &gollem.ContentRequest{Inputs: []gollem.Input{gollem.Text(text)}}
+		gt.NoError(t, gollem.WaitRateLimits(ctx, []gollem.RateLimiter{gollem.TokenRateLimiter(tokens)}, req))
+		gt.Equal(t, []int{40}, tokens.waits)
+	})
+}
+
+func TestWithTokenizer(t *testing.T) {
+	// The history has about 200 tokens by EstimateTokens, but 160 words
+	policy := &gollem.ContextWindowPolicy{MaxTokens: 180}
+
+	c := &windowClient{}
+	agent := gollem.New(c.client(t), gollem.WithHistory(longHistory(t, 2)), gollem.WithContextWindowGuard(policy))
+	_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.Error(t, err).Is(gollem.ErrContextWindowExceeded)
+
+	c = &windowClient{}
+	agent = gollem.New(c.client(t),
+		gollem.WithHistory(longHistory(t, 2)),
+		gollem.WithContextWindowGuard(policy),
+		gollem.WithTokenizer(wordTokenizer),
+	)
+	_, err = agent.Execute(t.Context(), gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.A(t, c.sent).Length(1)
+}
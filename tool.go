@@ -2,11 +2,13 @@ package gollem
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/m-mizutani/goerr/v2"
 )
@@ -16,6 +18,32 @@ type ToolSpec struct {
 	Name        string
 	Description string
 	Parameters  map[string]*Parameter
+
+	// Timeout is the maximum duration of one execution of the tool. The context passed to Run is
+	// canceled when it's exceeded, and the call fails with ErrToolTimeout even if Run does not
+	// return. Zero means the default timeout of WithToolTimeout, or no timeout if it's not set.
+	Timeout time.Duration
+
+	// MaxRetries is the number of retries when Run returns an error. It's honored only if
+	// Idempotent is true because retrying a tool with side effects may repeat them.
+	MaxRetries int
+
+	// RetryDelay is the delay before the first retry. It doubles on each retry, up to 30 seconds
+	// and up to 20% shorter by jitter. Zero means 1 second.
+	RetryDelay time.Duration
+
+	// Idempotent indicates that calling the tool multiple times with the same arguments has the
+	// same effect as calling it once.
+	Idempotent bool
+
+	// Cacheable indicates that a result of the tool can be reused for later calls with the same
+	// arguments, i.e. the tool has no side effects and its result does not change over time.
+	// Only calls of cacheable tools are memoized by WithToolCache.
+	Cacheable bool
+
+	// Priority is the priority of calls of the tool waiting for WithToolLimiter. Calls of a
+	// higher priority run first. Zero is the default priority.
+	Priority int
 }
 
 // ValidateArgs validates the given arguments against the tool's parameter specifications.
@@ -73,6 +101,16 @@ func (s *ToolSpec) Validate() error {
 		return eb.Wrap(ErrInvalidTool, "name is required")
 	}
 
+	if s.Timeout < 0 {
+		return eb.Wrap(ErrInvalidTool, "timeout must be non-negative")
+	}
+	if s.MaxRetries < 0 {
+		return eb.Wrap(ErrInvalidTool, "max retries must be non-negative")
+	}
+	if s.RetryDelay < 0 {
+		return eb.Wrap(ErrInvalidTool, "retry delay must be non-negative")
+	}
+
 	paramNames := make(map[string]struct{})
 	for name, param := range s.Parameters {
 		if _, ok := paramNames[name]; ok {
@@ -138,6 +176,11 @@ type Parameter struct {
 
 	// Default value
 	Default any
+
+	// Sensitive indicates that the value is a secret such as a password or a token. The value
+	// is masked in logs, traces, events and error messages, including properties and items of
+	// the parameter, but passed to the tool as it is.
+	Sensitive bool
 }
 
 // Validate validates the parameter.
@@ -239,11 +282,11 @@ func (p *Parameter) ValidateValue(name string, value any) error {
 	case TypeString:
 		s, ok := value.(string)
 		if !ok {
-			return eb.Wrap(ErrInvalidParameter, "expected string type", goerr.V("actual", value))
+			return eb.Wrap(ErrInvalidParameter, "expected string type", goerr.V("actual", p.redactValue(value)))
 		}
 		// Enum validation
 		if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
-			return eb.Wrap(ErrInvalidParameter, "value not in enum", goerr.V("value", s), goerr.V("enum", p.Enum))
+			return eb.Wrap(ErrInvalidParameter, "value not in enum", goerr.V("value", p.redactValue(s)), goerr.V("enum", p.Enum))
 		}
 		// String length validation
 		if p.MinLength != nil && len(s) < *p.MinLength {
@@ -275,7 +318,7 @@ func (p *Parameter) ValidateValue(name string, value any) error {
 		case int64:
 			n = float64(v)
 		default:
-			return eb.Wrap(ErrInvalidParameter, "expected number type", goerr.V("actual", value))
+			return eb.Wrap(ErrInvalidParameter, "expected number type", goerr.V("actual", p.redactValue(value)))
 		}
 		if p.Minimum != nil && n < *p.Minimum {
 			return eb.Wrap(ErrInvalidParameter, "number too small", goerr.V("minimum", *p.Minimum), goerr.V("actual", n))
@@ -297,7 +340,7 @@ func (p *Parameter) ValidateValue(name string, value any) error {
 			}
 			n = int64(v)
 		default:
-			return eb.Wrap(ErrInvalidParameter, "expected integer type", goerr.V("actual", value))
+			return eb.Wrap(ErrInvalidParameter, "expected integer type", goerr.V("actual", p.redactValue(value)))
 		}
 		if p.Minimum != nil && float64(n) < *p.Minimum {
 			return eb.Wrap(ErrInvalidParameter, "integer too small", goerr.V("minimum", *p.Minimum), goerr.V("actual", n))
@@ -308,13 +351,13 @@ func (p *Parameter) ValidateValue(name string, value any) error {
 
 	case TypeBoolean:
 		if _, ok := value.(bool); !ok {
-			return eb.Wrap(ErrInvalidParameter, "expected boolean type", goerr.V("actual", value))
+			return eb.Wrap(ErrInvalidParameter, "expected boolean type", goerr.V("actual", p.redactValue(value)))
 		}
 
 	case TypeArray:
 		arr, ok := value.([]any)
 		if !ok {
-			return eb.Wrap(ErrInvalidParameter, "expected array type", goerr.V("actual", value))
+			return eb.Wrap(ErrInvalidParameter, "expected array type", goerr.V("actual", p.redactValue(value)))
 		}
 		if p.MinItems != nil && len(arr) < *p.MinItems {
 			return eb.Wrap(ErrInvalidParameter, "array too short", goerr.V("minItems", *p.MinItems), goerr.V("actual", len(arr)))
@@ -325,7 +368,7 @@ func (p *Parameter) ValidateValue(name string, value any) error {
 		// Validate each item if Items schema is defined
 		if p.Items != nil {
 			for i, item := range arr {
-				if err := p.Items.ValidateValue(name+"["+strconv.Itoa(i)+"]", item); err != nil {
+				if err := p.child(p.Items).ValidateValue(name+"["+strconv.Itoa(i)+"]", item); err != nil {
 					return err
 				}
 			}
@@ -334,13 +377,13 @@ func (p *Parameter) ValidateValue(name string, value any) error {
 	case TypeObject:
 		obj, ok := value.(map[string]any)
 		if !ok {
-			return eb.Wrap(ErrInvalidParameter, "expected object type", goerr.V("actual", value))
+			return eb.Wrap(ErrInvalidParameter, "expected object type", goerr.V("actual", p.redactValue(value)))
 		}
 		// Validate each property if Properties schema is defined
 		if p.Properties != nil {
 			for propName, propParam := range p.Properties {
 				propValue := obj[propName]
-				if err := propParam.ValidateValue(name+"."+propName, propValue); err != nil {
+				if err := p.child(propParam).ValidateValue(name+"."+propName, propValue); err != nil {
 					return err
 				}
 			}
@@ -356,7 +399,7 @@ type Tool interface {
 	Spec() ToolSpec
 
 	// Run is the execution of the tool.
-	// It's called when receiving a tool call from the LLM. Even if the method returns an error, the tool execution is not aborted. Error will be passed to LLM as a response. If you want to abort the tool execution, you need to return an error from the callback function of WithToolErrorHook().
+	// It's called when receiving a tool call from the LLM. Even if the method returns an error, the execution is not aborted. Error will be passed to LLM as a response. Return a ToolError to classify the error, and use WithToolErrorPolicy to abort the execution on errors.
 	// Special case: If the tool returns ErrExitConversation, the conversation loop will be terminated normally and the session will be completed successfully.
 	Run(ctx context.Context, args map[string]any) (map[string]any, error)
 }
@@ -371,3 +414,74 @@ type ToolSet interface {
 	// It's called when receiving a tool call from the LLM.
 	Run(ctx context.Context, name string, args map[string]any) (map[string]any, error)
 }
+
+const (
+	defaultToolRetryDelay    = time.Second
+	defaultToolRetryMaxDelay = 30 * time.Second
+)
+
+// toolRunFunc is the signature of Tool.Run.
+type toolRunFunc func(ctx context.Context, args map[string]any) (map[string]any, error)
+
+// runToolWithSpec runs the tool honoring the execution hints of spec: Timeout for each attempt
+// and MaxRetries with backoff by RetryDelay for idempotent tools.
+func runToolWithSpec(ctx context.Context, spec *ToolSpec, run toolRunFunc, args map[string]any) (map[string]any, error) {
+	if !spec.Idempotent || spec.MaxRetries <= 0 {
+		return runToolWithTimeout(ctx, spec, run, args)
+	}
+
+	delay := spec.RetryDelay
+	if delay == 0 {
+		delay = defaultToolRetryDelay
+	}
+	policy := &RetryPolicy{
+		MaxAttempts: spec.MaxRetries + 1,
+		BaseDelay:   delay,
+		MaxDelay:    defaultToolRetryMaxDelay,
+		Jitter:      0.2,
+		Retriable: func(err error) bool {
+			return !errors.Is(err, ErrExitConversation) && !errors.Is(err, ErrToolCallDeferred)
+		},
+	}
+
+	var result map[string]any
+	err := policy.do(ctx, "tool_retry", func() error {
+		var err error
+		result, err = runToolWithTimeout(ctx, spec, run, args)
+		return err
+	})
+	return result, err
+}
+
+func runToolWithTimeout(ctx context.Context, spec *ToolSpec, run toolRunFunc, args map[string]any) (map[string]any, error) {
+	if spec.Timeout <= 0 {
+		return run(ctx, args)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, spec.Timeout)
+	defer cancel()
+
+	type runResult struct {
+		result map[string]any
+		err    error
+	}
+	ch := make(chan runResult, 1)
+	go func() {
+		result, err := run(ctx, args)
+		ch <- runResult{result: result, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, goerr.Wrap(ErrToolTimeout, "tool failed by timeout", goerr.V("tool", spec.Name), goerr.V("timeout", spec.Timeout), goerr.V("error", r.err))
+		}
+		return r.result, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// Run that ignores ctx keeps running in background and its result is discarded
+			return nil, goerr.Wrap(ErrToolTimeout, "tool did not return in time", goerr.V("tool", spec.Name), goerr.V("timeout", spec.Timeout))
+		}
+		return nil, goerr.Wrap(ctx.Err(), "tool execution canceled", goerr.V("tool", spec.Name))
+	}
+}
@@ -0,0 +1,123 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// toolArgRepairMaxAttempts is the number of LLM calls to repair arguments of one tool call.
+const toolArgRepairMaxAttempts = 2
+
+const toolArgRepairPrompt = `A call of the tool below has invalid arguments. Return the corrected arguments as a JSON object.
+Keep the intent and values of the original arguments; only fix what the validation errors report.
+
+## Tool
+%s: %s
+
+## Arguments
+%s
+
+## Validation errors
+%s`
+
+// WithToolArgAutoRepair makes the agent ask the LLM to repair arguments of a tool call that
+// fail validation against the ToolSpec, before calling Tool.Run. The repair is a separate LLM
+// call with the tool's parameters as the response schema, and its usage is recorded as
+// UsagePhaseRepair. If the repair fails, the validation error is returned to the LLM as the
+// tool result as without this option. It has no effect with WithDisableArgsValidation.
+func WithToolArgAutoRepair(enabled bool) Option {
+	return func(s *gollemConfig) {
+		s.toolArgAutoRepair = enabled
+	}
+}
+
+// toolArgRepairer repairs invalid tool arguments through a ToolMiddleware.
+type toolArgRepairer struct {
+	client    LLMClient
+	logger    *slog.Logger
+	normalize bool
+}
+
+func (x *toolArgRepairer) middleware(next ToolHandler) ToolHandler {
+	return func(ctx context.Context, req *ToolExecRequest) (*ToolExecResponse, error) {
+		if req.ToolSpec == nil {
+			return next(ctx, req)
+		}
+		validationErr := req.ToolSpec.ValidateArgs(req.Tool.Arguments)
+		if validationErr == nil {
+			return next(ctx, req)
+		}
+
+		args, err := x.repair(ctx, req.ToolSpec, req.Tool.Arguments, validationErr)
+		if err != nil {
+			x.logger.Warn("failed to repair tool arguments", "tool", req.Tool.Name, "error", err)
+			return next(ctx, req)
+		}
+		x.logger.Debug("tool arguments repaired", "tool", req.Tool.Name, "args", req.ToolSpec.RedactArgs(args))
+
+		call := *req.Tool
+		call.Arguments = args
+		repaired := *req
+		repaired.Tool = &call
+		return next(ctx, &repaired)
+	}
+}
+
+// repair asks the LLM to correct args of spec, and returns them if they are valid.
+func (x *toolArgRepairer) repair(ctx context.Context, spec *ToolSpec, args map[string]any, validationErr error) (map[string]any, error) {
+	if err := CheckBudget(ctx); err != nil {
+		return nil, err
+	}
+	ctx = ContextWithUsagePhase(ctx, UsagePhaseRepair)
+
+	session, err := x.client.NewSession(ctx,
+		WithSessionContentType(ContentTypeJSON),
+		WithSessionResponseSchema(&Parameter{Type: TypeObject, Properties: spec.Parameters}),
+	)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to create session for tool argument repair")
+	}
+	if session == nil {
+		return nil, goerr.New("LLMClient.NewSession returned nil session")
+	}
+
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal tool arguments")
+	}
+	input := []Input{Text(fmt.Sprintf(toolArgRepairPrompt, spec.Name, spec.Description, raw, validationErr.Error()))}
+
+	for attempt := range toolArgRepairMaxAttempts {
+		resp, err := session.Generate(ctx, input)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to generate repaired tool arguments", goerr.V("attempt", attempt+1))
+		}
+		RecordUsage(ctx, resp)
+
+		text := strings.Join(resp.Texts, "")
+		var repaired map[string]any
+		if err := json.Unmarshal([]byte(text), &repaired); err != nil {
+			validationErr = goerr.Wrap(err, "response is not a JSON object")
+			input = []Input{Text(fmt.Sprintf("Your response was not a valid JSON object: %s\nPlease respond with the corrected arguments as a JSON object.", err.Error()))}
+			continue
+		}
+		if x.normalize {
+			repaired = spec.NormalizeArgs(repaired)
+		}
+		if err := spec.ValidateArgs(repaired); err != nil {
+			validationErr = err
+			input = []Input{Text(fmt.Sprintf("The corrected arguments are still invalid.\n%s", err.Error()))}
+			continue
+		}
+		return repaired, nil
+	}
+
+	return nil, goerr.Wrap(validationErr, "tool arguments are still invalid after repair",
+		goerr.V("tool", spec.Name),
+		goerr.V("attempts", toolArgRepairMaxAttempts))
+}
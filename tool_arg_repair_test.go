@@ -0,0 +1,114 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// newRepairTestClient returns a client whose agent session calls the "order" tool with an
+// invalid count, and whose JSON sessions for repair reply repairs in order.
+func newRepairTestClient(repairs []string, toolResponses *[]gollem.FunctionResponse) *mock.LLMClientMock {
+	agentCalls, repairCalls := 0, 0
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			if cfg.ContentType() == gollem.ContentTypeJSON {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						text := repairs[repairCalls]
+						repairCalls++
+						return &gollem.Response{Texts: []string{text}, InputToken: 10, OutputToken: 5}, nil
+					},
+				}, nil
+			}
+
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					agentCalls++
+					if agentCalls > 1 {
+						for _, in := range input {
+							if resp, ok := in.(gollem.FunctionResponse); ok {
+								*toolResponses = append(*toolResponses, resp)
+							}
+						}
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+					return &gollem.Response{
+						FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "order", Arguments: map[string]any{"item": "apple", "count": "a dozen"}}},
+					}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func newOrderTool(received *[]map[string]any) *mock.ToolMock {
+	return &mock.ToolMock{
+		SpecFunc: func() gollem.ToolSpec {
+			return gollem.ToolSpec{
+				Name: "order",
+				Parameters: map[string]*gollem.Parameter{
+					"item":  {Type: gollem.TypeString, Required: true},
+					"count": {Type: gollem.TypeInteger, Required: true},
+				},
+			}
+		},
+		RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			*received = append(*received, args)
+			return map[string]any{"ok": true}, nil
+		},
+	}
+}
+
+func TestWithToolArgAutoRepair(t *testing.T) {
+	t.Run("repaired arguments are passed to the tool", func(t *testing.T) {
+		var received []map[string]any
+		var responses []gollem.FunctionResponse
+		client := newRepairTestClient([]string{`{"item":"apple","count":"12"}`}, &responses)
+		agent := gollem.New(client, gollem.WithTools(newOrderTool(&received)), gollem.WithToolArgAutoRepair(true))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("buy a dozen apples"))
+		gt.NoError(t, err)
+		gt.A(t, received).Length(1)
+		// The repaired value is normalized by the ToolSpec
+		gt.Equal(t, map[string]any{"item": "apple", "count": 12.0}, received[0])
+		gt.A(t, responses).Length(1)
+		gt.NoError(t, responses[0].Error)
+
+		usage := agent.Usage()
+		gt.Equal(t, 15, usage.Phases[gollem.UsagePhaseRepair].InputTokens+usage.Phases[gollem.UsagePhaseRepair].OutputTokens)
+	})
+
+	t.Run("validation error is returned when repair fails", func(t *testing.T) {
+		var received []map[string]any
+		var responses []gollem.FunctionResponse
+		client := newRepairTestClient([]string{`not json`, `{"item":"apple"}`}, &responses)
+		agent := gollem.New(client, gollem.WithTools(newOrderTool(&received)), gollem.WithToolArgAutoRepair(true))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("buy a dozen apples"))
+		gt.NoError(t, err)
+		gt.A(t, received).Length(0)
+		gt.A(t, responses).Length(1)
+		gt.Error(t, responses[0].Error).Is(gollem.ErrToolArgsValidation)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		var received []map[string]any
+		var responses []gollem.FunctionResponse
+		client := newRepairTestClient(nil, &responses)
+		agent := gollem.New(client, gollem.WithTools(newOrderTool(&received)))
+
+		_, err := agent.Execute(t.Context(), gollem.Text("buy a dozen apples"))
+		gt.NoError(t, err)
+		gt.A(t, received).Length(0)
+		gt.A(t, client.NewSessionCalls()).Length(1)
+		gt.Error(t, responses[0].Error).Is(gollem.ErrToolArgsValidation)
+	})
+}
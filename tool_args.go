@@ -0,0 +1,139 @@
+package gollem
+
+import (
+	"encoding/json"
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NormalizeArgs canonicalizes arguments from LLM according to the tool's parameter
+// specifications. Providers differ in how they type arguments, so that a tool receives the
+// same Go types regardless of the provider:
+//
+//   - number and integer: float64 (numeric strings such as "3" are parsed, but not "NaN" and "Inf")
+//   - boolean: bool ("true" and "false" strings are parsed)
+//   - array: []any (a JSON-encoded string is decoded), items are normalized recursively
+//   - object: map[string]any (a JSON-encoded string is decoded), properties are normalized recursively
+//
+// Optional parameters with null value are removed, and missing parameters with a Default are
+// filled. Values that cannot be converted, non-string values for string parameters and
+// unknown keys are kept as they are so that ValidateArgs can report them. args is not
+// modified; a new map is returned.
+func (s *ToolSpec) NormalizeArgs(args map[string]any) map[string]any {
+	return normalizeProperties(s.Parameters, args)
+}
+
+func normalizeProperties(params map[string]*Parameter, args map[string]any) map[string]any {
+	if args == nil && !hasDefault(params) {
+		return args
+	}
+
+	result := make(map[string]any, len(args))
+	maps.Copy(result, args)
+
+	for name, param := range params {
+		if param == nil {
+			continue
+		}
+		value, ok := result[name]
+		if !ok || value == nil {
+			if param.Default != nil {
+				result[name] = param.Default
+			} else if ok && !param.Required {
+				delete(result, name)
+			}
+			continue
+		}
+		result[name] = param.normalizeValue(value)
+	}
+	return result
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func hasDefault(params map[string]*Parameter) bool {
+	for _, param := range params {
+		if param != nil && param.Default != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeValue converts value to the canonical Go type of the parameter type. It returns
+// value unchanged if it cannot be converted.
+func (p *Parameter) normalizeValue(value any) any {
+	switch p.Type {
+	case TypeNumber, TypeInteger:
+		switch v := value.(type) {
+		case float64:
+			return v
+		case float32:
+			return float64(v)
+		case int:
+			return float64(v)
+		case int32:
+			return float64(v)
+		case int64:
+			return float64(v)
+		case json.Number:
+			if f, err := v.Float64(); err == nil && isFinite(f) {
+				return f
+			}
+		case string:
+			// ParseFloat also accepts "NaN" and "Inf", which are not numbers of JSON
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && isFinite(f) {
+				return f
+			}
+		}
+
+	case TypeBoolean:
+		if v, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
+		}
+
+	case TypeArray:
+		if v, ok := value.(string); ok {
+			var decoded []any
+			if err := json.Unmarshal([]byte(v), &decoded); err != nil {
+				return value
+			}
+			value = decoded
+		}
+		items, ok := value.([]any)
+		if !ok || p.Items == nil {
+			return value
+		}
+		result := make([]any, len(items))
+		for i, item := range items {
+			if item == nil {
+				result[i] = item
+				continue
+			}
+			result[i] = p.Items.normalizeValue(item)
+		}
+		return result
+
+	case TypeObject:
+		if v, ok := value.(string); ok {
+			var decoded map[string]any
+			if err := json.Unmarshal([]byte(v), &decoded); err != nil {
+				return value
+			}
+			value = decoded
+		}
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+		return normalizeProperties(p.Properties, obj)
+	}
+
+	return value
+}
@@ -0,0 +1,179 @@
+package gollem_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestNormalizeArgs(t *testing.T) {
+	spec := gollem.ToolSpec{
+		Name: "test",
+		Parameters: map[string]*gollem.Parameter{
+			"count":   {Type: gollem.TypeInteger, Required: true},
+			"ratio":   {Type: gollem.TypeNumber},
+			"enabled": {Type: gollem.TypeBoolean},
+			"name":    {Type: gollem.TypeString},
+			"tags": {
+				Type:  gollem.TypeArray,
+				Items: &gollem.Parameter{Type: gollem.TypeNumber},
+			},
+			"option": {
+				Type: gollem.TypeObject,
+				Properties: map[string]*gollem.Parameter{
+					"depth": {Type: gollem.TypeInteger},
+					"mode":  {Type: gollem.TypeString, Default: "fast"},
+				},
+			},
+			"limit": {Type: gollem.TypeInteger, Default: 10},
+		},
+	}
+
+	type testCase struct {
+		args   map[string]any
+		expect map[string]any
+	}
+
+	runTest := func(tc testCase) func(t *testing.T) {
+		return func(t *testing.T) {
+			gt.Equal(t, tc.expect, spec.NormalizeArgs(tc.args))
+		}
+	}
+
+	t.Run("canonical args are kept", runTest(testCase{
+		args:   map[string]any{"count": 3.0, "enabled": true, "limit": 5.0},
+		expect: map[string]any{"count": 3.0, "enabled": true, "limit": 5.0},
+	}))
+
+	t.Run("stringified numbers and booleans", runTest(testCase{
+		args:   map[string]any{"count": "3", "ratio": " 0.5 ", "enabled": "true"},
+		expect: map[string]any{"count": 3.0, "ratio": 0.5, "enabled": true, "limit": 10},
+	}))
+
+	t.Run("Go and JSON numeric types", runTest(testCase{
+		args:   map[string]any{"count": int64(3), "ratio": json.Number("1.5"), "limit": 7},
+		expect: map[string]any{"count": 3.0, "ratio": 1.5, "limit": 7.0},
+	}))
+
+	t.Run("JSON-encoded array and object", runTest(testCase{
+		args: map[string]any{
+			"count":  3.0,
+			"tags":   `["1", 2]`,
+			"option": `{"depth": "2"}`,
+		},
+		expect: map[string]any{
+			"count":  3.0,
+			"tags":   []any{1.0, 2.0},
+			"option": map[string]any{"depth": 2.0, "mode": "fast"},
+			"limit":  10,
+		},
+	}))
+
+	t.Run("NaN and infinity strings are not converted", runTest(testCase{
+		args:   map[string]any{"count": "nan", "ratio": "Inf", "limit": "-infinity", "tags": []any{"NaN"}},
+		expect: map[string]any{"count": "nan", "ratio": "Inf", "limit": "-infinity", "tags": []any{"NaN"}},
+	}))
+
+	t.Run("NaN JSON number is not converted", runTest(testCase{
+		args:   map[string]any{"count": 3.0, "ratio": json.Number("NaN")},
+		expect: map[string]any{"count": 3.0, "ratio": json.Number("NaN"), "limit": 10},
+	}))
+
+	t.Run("null optional parameter is removed", runTest(testCase{
+		args:   map[string]any{"count": 3.0, "name": nil, "ratio": nil},
+		expect: map[string]any{"count": 3.0, "limit": 10},
+	}))
+
+	t.Run("null required parameter is kept", runTest(testCase{
+		args:   map[string]any{"count": nil},
+		expect: map[string]any{"count": nil, "limit": 10},
+	}))
+
+	t.Run("null parameter with default is filled", runTest(testCase{
+		args:   map[string]any{"count": 3.0, "limit": nil},
+		expect: map[string]any{"count": 3.0, "limit": 10},
+	}))
+
+	t.Run("invalid values and unknown keys are kept", runTest(testCase{
+		args:   map[string]any{"count": "three", "enabled": "yes", "name": 1.0, "tags": "[", "extra": "x"},
+		expect: map[string]any{"count": "three", "enabled": "yes", "name": 1.0, "tags": "[", "extra": "x", "limit": 10},
+	}))
+
+	t.Run("input is not modified", func(t *testing.T) {
+		args := map[string]any{"count": "3"}
+		spec.NormalizeArgs(args)
+		gt.Equal(t, map[string]any{"count": "3"}, args)
+	})
+}
+
+func TestExecuteArgsNormalization(t *testing.T) {
+	newClient := func() gollem.LLMClient {
+		return &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				calls := 0
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+						calls++
+						if calls == 1 {
+							return &gollem.Response{
+								FunctionCalls: []*gollem.FunctionCall{{
+									ID:        "1",
+									Name:      "counter",
+									Arguments: map[string]any{"count": "3", "verbose": "false"},
+								}},
+							}, nil
+						}
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					},
+					HistoryFunc: func() (*gollem.History, error) {
+						return &gollem.History{}, nil
+					},
+					AppendHistoryFunc: func(*gollem.History) error { return nil },
+				}, nil
+			},
+		}
+	}
+
+	newTool := func(received *map[string]any) *mock.ToolMock {
+		return &mock.ToolMock{
+			SpecFunc: func() gollem.ToolSpec {
+				return gollem.ToolSpec{
+					Name:        "counter",
+					Description: "count",
+					Parameters: map[string]*gollem.Parameter{
+						"count":   {Type: gollem.TypeInteger, Required: true},
+						"verbose": {Type: gollem.TypeBoolean},
+					},
+				}
+			},
+			RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				*received = args
+				return map[string]any{}, nil
+			},
+		}
+	}
+
+	t.Run("arguments are normalized before tool run", func(t *testing.T) {
+		var received map[string]any
+		agent := gollem.New(newClient(), gollem.WithTools(newTool(&received)))
+		_, err := agent.Execute(t.Context(), gollem.Text("count"))
+		gt.NoError(t, err)
+		gt.Equal(t, map[string]any{"count": 3.0, "verbose": false}, received)
+	})
+
+	t.Run("normalization can be disabled", func(t *testing.T) {
+		var received map[string]any
+		agent := gollem.New(newClient(),
+			gollem.WithTools(newTool(&received)),
+			gollem.WithDisableArgsNormalization(),
+			gollem.WithDisableArgsValidation(),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("count"))
+		gt.NoError(t, err)
+		gt.Equal(t, map[string]any{"count": "3", "verbose": "false"}, received)
+	})
+}
@@ -0,0 +1,154 @@
+package gollem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// BatchTool is an optional interface of Tool. When the LLM calls a BatchTool more than once in one response, the calls are coalesced into a single RunBatch execution instead of calling Run for each of them. It's useful for tools backed by rate-limited APIs that accept multiple queries in one request (e.g. DNS lookups).
+//
+// Each call still goes through argument normalization, validation, tool middlewares and trace spans individually. To make that possible, the calls of a batch are processed concurrently, so tool middlewares must be safe for concurrent use when BatchTool is used. Calls rejected by validation or short-circuited by a middleware are not included in the batch.
+type BatchTool interface {
+	Tool
+
+	// RunBatch executes multiple calls of the tool at once. The returned slice must have the same length and order as args. If RunBatch returns an error, all calls in the batch fail with the error.
+	RunBatch(ctx context.Context, args []map[string]any) ([]BatchResult, error)
+}
+
+// BatchResult is a result of one call executed by BatchTool.RunBatch.
+type BatchResult struct {
+	Result map[string]any
+	Error  error
+}
+
+// toolBatch collects calls of the same BatchTool in one response and runs them by RunBatch once all members have submitted their arguments or left without submitting.
+type toolBatch struct {
+	ctx     context.Context
+	tool    BatchTool
+	limiter *ToolLimiter
+
+	mu      sync.Mutex
+	waiting int
+	args    []map[string]any
+	replies []chan BatchResult
+}
+
+func newToolBatch(ctx context.Context, tool BatchTool, size int, limiter *ToolLimiter) *toolBatch {
+	return &toolBatch{
+		ctx:     ctx,
+		tool:    tool,
+		limiter: limiter,
+		waiting: size,
+	}
+}
+
+// member returns a Tool bound to one call of the batch. Its done must be called after the call has been processed.
+func (x *toolBatch) member() *batchMember {
+	return &batchMember{batch: x}
+}
+
+// arrive decrements the waiting counter and runs the batch if this was the last member. It must be called with x.mu held and releases it.
+func (x *toolBatch) arrive() {
+	x.waiting--
+	if x.waiting > 0 || len(x.args) == 0 {
+		x.mu.Unlock()
+		return
+	}
+	args, replies := x.args, x.replies
+	x.mu.Unlock()
+
+	x.run(args, replies)
+}
+
+func (x *toolBatch) run(args []map[string]any, replies []chan BatchResult) {
+	results, err := x.runBatch(args)
+	if err == nil && len(results) != len(args) {
+		err = goerr.New("number of batch results does not match number of calls",
+			goerr.V("tool", x.tool.Spec().Name),
+			goerr.V("calls", len(args)),
+			goerr.V("results", len(results)))
+	}
+
+	for i, reply := range replies {
+		if err != nil {
+			reply <- BatchResult{Error: err}
+			continue
+		}
+		reply <- results[i]
+	}
+}
+
+// runBatch runs RunBatch under the limiter if any.
+func (x *toolBatch) runBatch(args []map[string]any) ([]BatchResult, error) {
+	if x.limiter != nil {
+		release, err := x.limiter.acquire(x.ctx, x.tool.Spec().Priority)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	return x.tool.RunBatch(x.ctx, args)
+}
+
+// batchMember is a Tool bound to one call of toolBatch.
+type batchMember struct {
+	batch     *toolBatch
+	submitted bool
+}
+
+func (x *batchMember) Spec() ToolSpec {
+	return x.batch.tool.Spec()
+}
+
+func (x *batchMember) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	// A middleware may call the handler again (e.g. retry). The batch has already been
+	// dispatched at that time, so the call is executed alone.
+	if x.submitted {
+		return x.batch.tool.Run(ctx, args)
+	}
+	x.submitted = true
+
+	reply := make(chan BatchResult, 1)
+	x.batch.mu.Lock()
+	x.batch.args = append(x.batch.args, args)
+	x.batch.replies = append(x.batch.replies, reply)
+	x.batch.arrive()
+
+	select {
+	case result := <-reply:
+		return result.Result, result.Error
+	case <-ctx.Done():
+		return nil, goerr.Wrap(ctx.Err(), "batch tool call is canceled")
+	}
+}
+
+// done releases the member. If the call was not submitted (e.g. rejected by validation), the batch stops waiting for it.
+func (x *batchMember) done() {
+	if x.submitted {
+		return
+	}
+	x.submitted = true
+	x.batch.mu.Lock()
+	x.batch.arrive()
+}
+
+// planToolBatches returns batches for BatchTools called more than once in the given calls.
+func planToolBatches(ctx context.Context, calls []*FunctionCall, toolMap map[string]Tool, limiter *ToolLimiter) map[string]*toolBatch {
+	counts := make(map[string]int)
+	for _, call := range calls {
+		if _, ok := toolMap[call.Name].(BatchTool); ok {
+			counts[call.Name]++
+		}
+	}
+
+	batches := make(map[string]*toolBatch)
+	for name, count := range counts {
+		if count < 2 {
+			continue
+		}
+		batches[name] = newToolBatch(ctx, toolMap[name].(BatchTool), count, limiter)
+	}
+	return batches
+}
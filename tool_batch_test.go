@@ -0,0 +1,163 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+type lookupBatchTool struct {
+	mu       sync.Mutex
+	runCalls int
+	batches  [][]map[string]any
+	batchErr error
+}
+
+func (x *lookupBatchTool) Spec() gollem.ToolSpec {
+	return gollem.ToolSpec{
+		Name:        "lookup",
+		Description: "Look up the address of a host",
+		Parameters: map[string]*gollem.Parameter{
+			"host": {Type: gollem.TypeString, Required: true},
+		},
+	}
+}
+
+func (x *lookupBatchTool) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.runCalls++
+	return map[string]any{"address": "addr-of-" + args["host"].(string)}, nil
+}
+
+func (x *lookupBatchTool) RunBatch(ctx context.Context, args []map[string]any) ([]gollem.BatchResult, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.batches = append(x.batches, args)
+	if x.batchErr != nil {
+		return nil, x.batchErr
+	}
+
+	results := make([]gollem.BatchResult, len(args))
+	for i, arg := range args {
+		if arg["host"] == "unknown" {
+			results[i].Error = errors.New("no such host")
+			continue
+		}
+		results[i].Result = map[string]any{"address": "addr-of-" + arg["host"].(string)}
+	}
+	return results, nil
+}
+
+func runToolCallsAgent(t *testing.T, tool gollem.Tool, calls []*gollem.FunctionCall, opts ...gollem.Option) []gollem.Input {
+	t.Helper()
+
+	var responses []gollem.Input
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					if len(responses) == 0 && len(input) == 1 {
+						if _, ok := input[0].(gollem.Text); ok {
+							return &gollem.Response{FunctionCalls: calls}, nil
+						}
+					}
+					responses = input
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+			}, nil
+		},
+	}
+
+	opts = append([]gollem.Option{gollem.WithTools(tool), gollem.WithLoopLimit(5)}, opts...)
+	agent := gollem.New(client, opts...)
+	_, err := agent.Execute(t.Context(), gollem.Text("resolve hosts"))
+	gt.NoError(t, err)
+	return responses
+}
+
+func TestBatchTool(t *testing.T) {
+	t.Run("calls of the same tool are coalesced", func(t *testing.T) {
+		tool := &lookupBatchTool{}
+		other := &mockTool{
+			spec: gollem.ToolSpec{Name: "other"},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				return map[string]any{"ok": true}, nil
+			},
+		}
+
+		var mu sync.Mutex
+		var seen []string
+		mw := func(next gollem.ToolHandler) gollem.ToolHandler {
+			return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+				mu.Lock()
+				seen = append(seen, req.Tool.ID)
+				mu.Unlock()
+				return next(ctx, req)
+			}
+		}
+
+		responses := runToolCallsAgent(t, tool, []*gollem.FunctionCall{
+			{ID: "1", Name: "lookup", Arguments: map[string]any{"host": "a.example"}},
+			{ID: "2", Name: "other", Arguments: map[string]any{}},
+			{ID: "3", Name: "lookup", Arguments: map[string]any{"host": "b.example"}},
+			{ID: "4", Name: "lookup", Arguments: map[string]any{"host": "unknown"}},
+		}, gollem.WithTools(other), gollem.WithToolMiddleware(mw))
+
+		gt.Equal(t, 0, tool.runCalls)
+		gt.A(t, tool.batches).Length(1)
+		gt.A(t, tool.batches[0]).Length(3)
+		gt.A(t, seen).Length(4)
+
+		// responses keep the order of the calls
+		gt.A(t, responses).Length(4)
+		ids := make([]string, len(responses))
+		for i, input := range responses {
+			ids[i] = input.(gollem.FunctionResponse).ID
+		}
+		gt.Equal(t, []string{"1", "2", "3", "4"}, ids)
+
+		gt.Equal(t, "addr-of-a.example", responses[0].(gollem.FunctionResponse).Data["address"])
+		gt.Equal(t, "addr-of-b.example", responses[2].(gollem.FunctionResponse).Data["address"])
+		gt.Error(t, responses[3].(gollem.FunctionResponse).Error)
+	})
+
+	t.Run("single call uses Run", func(t *testing.T) {
+		tool := &lookupBatchTool{}
+		responses := runToolCallsAgent(t, tool, []*gollem.FunctionCall{
+			{ID: "1", Name: "lookup", Arguments: map[string]any{"host": "a.example"}},
+		})
+		gt.Equal(t, 1, tool.runCalls)
+		gt.A(t, tool.batches).Length(0)
+		gt.Equal(t, "addr-of-a.example", responses[0].(gollem.FunctionResponse).Data["address"])
+	})
+
+	t.Run("invalid calls are excluded from the batch", func(t *testing.T) {
+		tool := &lookupBatchTool{}
+		responses := runToolCallsAgent(t, tool, []*gollem.FunctionCall{
+			{ID: "1", Name: "lookup", Arguments: map[string]any{"host": "a.example"}},
+			{ID: "2", Name: "lookup", Arguments: map[string]any{}},
+		})
+		gt.A(t, tool.batches).Length(1)
+		gt.A(t, tool.batches[0]).Length(1)
+		gt.NoError(t, responses[0].(gollem.FunctionResponse).Error)
+		gt.True(t, errors.Is(responses[1].(gollem.FunctionResponse).Error, gollem.ErrToolArgsValidation))
+	})
+
+	t.Run("batch error fails all calls", func(t *testing.T) {
+		tool := &lookupBatchTool{batchErr: errors.New("rate limited")}
+		responses := runToolCallsAgent(t, tool, []*gollem.FunctionCall{
+			{ID: "1", Name: "lookup", Arguments: map[string]any{"host": "a.example"}},
+			{ID: "2", Name: "lookup", Arguments: map[string]any{"host": "b.example"}},
+		})
+		gt.A(t, responses).Length(2)
+		for _, input := range responses {
+			gt.Error(t, input.(gollem.FunctionResponse).Error)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package gollem
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// ToolCache stores results of tool calls keyed by ToolCacheKey. Implementations must be safe for
+// concurrent use.
+type ToolCache interface {
+	// Get returns the result stored with key. found is false if key is not stored or has expired.
+	Get(ctx context.Context, key string) (result map[string]any, found bool, err error)
+
+	// Set stores result with key. The entry expires after ttl; zero ttl means no expiration.
+	Set(ctx context.Context, key string, result map[string]any, ttl time.Duration) error
+}
+
+// DefaultToolCacheSize is the default maximum number of entries of MemoryToolCache.
+const DefaultToolCacheSize = 1024
+
+type toolCacheConfig struct {
+	cache ToolCache
+	ttl   time.Duration
+}
+
+// WithToolCache memoizes calls of tools whose ToolSpec.Cacheable is true with cache. A call with
+// the same tool name and the same arguments (after normalization) as a previous successful call
+// returns the cached result without running the tool. Calls of other tools always run. Failed calls are not cached. Cache errors are logged and the tool is run as
+// if the cache missed. Tool middlewares are still called for cached calls.
+func WithToolCache(cache ToolCache, ttl time.Duration) Option {
+	return func(s *gollemConfig) {
+		s.toolCache = &toolCacheConfig{cache: cache, ttl: ttl}
+	}
+}
+
+// ToolCacheKey returns the cache key of a tool call. It's the SHA-256 hash of the tool name and
+// the JSON encoding of args, whose object keys are sorted.
+func ToolCacheKey(name string, args map[string]any) (string, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return "", goerr.Wrap(err, "failed to marshal tool arguments", goerr.V("tool", name))
+	}
+
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// run returns the cached result of the call if any, or runs the tool and caches the result.
+func (x *toolCacheConfig) run(ctx context.Context, logger *slog.Logger, run toolRunFunc, name string, args map[string]any) (map[string]any, error) {
+	key, err := ToolCacheKey(name, args)
+	if err != nil {
+		logger.Warn("failed to build tool cache key", "tool", name, "error", err)
+		return run(ctx, args)
+	}
+
+	cached, found, err := x.cache.Get(ctx, key)
+	if err != nil {
+		logger.Warn("failed to get tool result from cache", "tool", name, "error", err)
+	} else if found {
+		logger.Debug("tool cache hit", "tool", name)
+		return copyToolResult(cached)
+	}
+
+	result, err := run(ctx, args)
+	if err != nil {
+		return result, err
+	}
+
+	// Store a copy so that later modification of the result by middlewares does not affect the cache
+	stored, cpErr := copyToolResult(result)
+	if cpErr != nil {
+		logger.Warn("failed to copy tool result for cache", "tool", name, "error", cpErr)
+		return result, nil
+	}
+	if err := x.cache.Set(ctx, key, stored, x.ttl); err != nil {
+		logger.Warn("failed to set tool result to cache", "tool", name, "error", err)
+	}
+	return result, nil
+}
+
+// copyToolResult returns a deep copy of result as a generic JSON-compatible structure.
+func copyToolResult(result map[string]any) (map[string]any, error) {
+	if result == nil {
+		return nil, nil
+	}
+	marshaled, err := json.Marshal(result)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal result", goerr.V("result", result))
+	}
+	var unmarshaled map[string]any
+	if err := json.Unmarshal(marshaled, &unmarshaled); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal result", goerr.V("marshaled", string(marshaled)))
+	}
+	return unmarshaled, nil
+}
+
+// MemoryToolCache is an in-memory ToolCache that evicts the least recently used entry when the
+// number of entries exceeds its size. Expiration is based on Now of ctx.
+type MemoryToolCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryToolCacheEntry struct {
+	key       string
+	result    map[string]any
+	expiresAt time.Time
+}
+
+// NewMemoryToolCache creates a MemoryToolCache holding at most size entries. If size is not
+// positive, DefaultToolCacheSize is used.
+func NewMemoryToolCache(size int) *MemoryToolCache {
+	if size <= 0 {
+		size = DefaultToolCacheSize
+	}
+	return &MemoryToolCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get implements ToolCache.
+func (c *MemoryToolCache) Get(ctx context.Context, key string) (map[string]any, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryToolCacheEntry)
+	if !entry.expiresAt.IsZero() && !Now(ctx).Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.result, true, nil
+}
+
+// Set implements ToolCache.
+func (c *MemoryToolCache) Set(ctx context.Context, key string, result map[string]any, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryToolCacheEntry{key: key, result: result}
+	if ttl > 0 {
+		entry.expiresAt = Now(ctx).Add(ttl)
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryToolCacheEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache, including expired ones not yet evicted.
+func (c *MemoryToolCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,152 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestToolCacheKey(t *testing.T) {
+	k1, err := gollem.ToolCacheKey("search", map[string]any{"query": "go", "limit": 10})
+	gt.NoError(t, err)
+	k2, err := gollem.ToolCacheKey("search", map[string]any{"limit": 10, "query": "go"})
+	gt.NoError(t, err)
+	gt.Equal(t, k1, k2)
+
+	k3, err := gollem.ToolCacheKey("lookup", map[string]any{"query": "go", "limit": 10})
+	gt.NoError(t, err)
+	gt.NotEqual(t, k1, k3)
+
+	k4, err := gollem.ToolCacheKey("search", map[string]any{"query": "rust", "limit": 10})
+	gt.NoError(t, err)
+	gt.NotEqual(t, k1, k4)
+}
+
+func TestMemoryToolCache(t *testing.T) {
+	t.Run("evicts least recently used entry", func(t *testing.T) {
+		ctx := t.Context()
+		cache := gollem.NewMemoryToolCache(2)
+		gt.NoError(t, cache.Set(ctx, "a", map[string]any{"v": "a"}, 0))
+		gt.NoError(t, cache.Set(ctx, "b", map[string]any{"v": "b"}, 0))
+
+		// touch a so that b becomes the oldest
+		_, found, err := cache.Get(ctx, "a")
+		gt.NoError(t, err)
+		gt.True(t, found)
+
+		gt.NoError(t, cache.Set(ctx, "c", map[string]any{"v": "c"}, 0))
+		gt.Equal(t, 2, cache.Len())
+
+		_, found, _ = cache.Get(ctx, "b")
+		gt.False(t, found)
+		result, found, _ := cache.Get(ctx, "a")
+		gt.True(t, found)
+		gt.Equal(t, "a", result["v"])
+	})
+
+	t.Run("expires entries by ttl", func(t *testing.T) {
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		ctx := gollem.ContextWithClock(t.Context(), func() time.Time { return now })
+
+		cache := gollem.NewMemoryToolCache(0)
+		gt.NoError(t, cache.Set(ctx, "a", map[string]any{"v": "a"}, time.Minute))
+
+		_, found, _ := cache.Get(ctx, "a")
+		gt.True(t, found)
+
+		now = now.Add(time.Minute)
+		_, found, _ = cache.Get(ctx, "a")
+		gt.False(t, found)
+		gt.Equal(t, 0, cache.Len())
+	})
+}
+
+func TestWithToolCache(t *testing.T) {
+	runCount := 0
+	tool := &mockTool{
+		spec: gollem.ToolSpec{
+			Name: "search",
+			Parameters: map[string]*gollem.Parameter{
+				"query": {Type: gollem.TypeString},
+			},
+			Cacheable: true,
+		},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			runCount++
+			if args["query"] == "fail" {
+				return nil, errors.New("search failed")
+			}
+			return map[string]any{"hits": []any{args["query"]}}, nil
+		},
+	}
+
+	// the middleware modifies results, which must not affect cached results
+	mw := func(next gollem.ToolHandler) gollem.ToolHandler {
+		return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+			resp, err := next(ctx, req)
+			if resp != nil && resp.Result != nil {
+				resp.Result["modified"] = true
+			}
+			return resp, err
+		}
+	}
+
+	cache := gollem.NewMemoryToolCache(10)
+	responses := runToolCallsAgent(t, tool, []*gollem.FunctionCall{
+		{ID: "1", Name: "search", Arguments: map[string]any{"query": "go"}},
+		{ID: "2", Name: "search", Arguments: map[string]any{"query": "go"}},
+		{ID: "3", Name: "search", Arguments: map[string]any{"query": "rust"}},
+		{ID: "4", Name: "search", Arguments: map[string]any{"query": "fail"}},
+		{ID: "5", Name: "search", Arguments: map[string]any{"query": "fail"}},
+	}, gollem.WithToolCache(cache, time.Hour), gollem.WithToolMiddleware(mw))
+
+	// "go" is run once, "rust" once and the failed call twice
+	gt.Equal(t, 4, runCount)
+	gt.Equal(t, 2, cache.Len())
+
+	gt.A(t, responses).Length(5)
+	first := responses[0].(gollem.FunctionResponse)
+	second := responses[1].(gollem.FunctionResponse)
+	gt.Equal(t, first.Data, second.Data)
+	gt.Equal(t, true, second.Data["modified"])
+	gt.Error(t, responses[4].(gollem.FunctionResponse).Error)
+
+	key, err := gollem.ToolCacheKey("search", map[string]any{"query": "go"})
+	gt.NoError(t, err)
+	cached, found, err := cache.Get(t.Context(), key)
+	gt.NoError(t, err)
+	gt.True(t, found)
+	_, modified := cached["modified"]
+	gt.False(t, modified)
+}
+
+func TestWithToolCacheNotCacheable(t *testing.T) {
+	runCount := 0
+	tool := &mockTool{
+		spec: gollem.ToolSpec{
+			Name: "send_mail",
+			Parameters: map[string]*gollem.Parameter{
+				"to": {Type: gollem.TypeString},
+			},
+			Idempotent: true,
+		},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			runCount++
+			return map[string]any{"sent": runCount}, nil
+		},
+	}
+
+	cache := gollem.NewMemoryToolCache(10)
+	responses := runToolCallsAgent(t, tool, []*gollem.FunctionCall{
+		{ID: "1", Name: "send_mail", Arguments: map[string]any{"to": "alice"}},
+		{ID: "2", Name: "send_mail", Arguments: map[string]any{"to": "alice"}},
+	}, gollem.WithToolCache(cache, time.Hour))
+
+	gt.Equal(t, 2, runCount)
+	gt.Equal(t, 0, cache.Len())
+	gt.A(t, responses).Length(2)
+}
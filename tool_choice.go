@@ -0,0 +1,81 @@
+package gollem
+
+import "context"
+
+// ToolChoiceMode controls whether and which tool the LLM must call.
+type ToolChoiceMode string
+
+const (
+	// ToolChoiceModeAuto lets the LLM decide whether to call tools. This is the provider default.
+	ToolChoiceModeAuto ToolChoiceMode = "auto"
+
+	// ToolChoiceModeRequired forces the LLM to call at least one tool.
+	ToolChoiceModeRequired ToolChoiceMode = "required"
+
+	// ToolChoiceModeNone forbids the LLM to call tools.
+	ToolChoiceModeNone ToolChoiceMode = "none"
+
+	// ToolChoiceModeTool forces the LLM to call the tool specified by ToolChoice.Name.
+	ToolChoiceModeTool ToolChoiceMode = "tool"
+)
+
+// ToolChoice is the tool choice control of an LLM call. Each provider maps it to its own
+// representation (tool_choice for OpenAI and Claude, FunctionCallingConfig for Gemini).
+type ToolChoice struct {
+	Mode ToolChoiceMode
+	// Name is the tool name for ToolChoiceModeTool.
+	Name string
+}
+
+// ToolChoiceAuto returns a ToolChoice that lets the LLM decide whether to call tools.
+func ToolChoiceAuto() ToolChoice {
+	return ToolChoice{Mode: ToolChoiceModeAuto}
+}
+
+// ToolChoiceRequired returns a ToolChoice that forces the LLM to call at least one tool.
+func ToolChoiceRequired() ToolChoice {
+	return ToolChoice{Mode: ToolChoiceModeRequired}
+}
+
+// ToolChoiceNone returns a ToolChoice that forbids the LLM to call tools.
+func ToolChoiceNone() ToolChoice {
+	return ToolChoice{Mode: ToolChoiceModeNone}
+}
+
+// ToolChoiceTool returns a ToolChoice that forces the LLM to call the named tool.
+func ToolChoiceTool(name string) ToolChoice {
+	return ToolChoice{Mode: ToolChoiceModeTool, Name: name}
+}
+
+// WithToolChoice sets the tool choice for a single Generate/Stream call.
+func WithToolChoice(choice ToolChoice) GenerateOption {
+	return func(cfg *generateConfig) {
+		cfg.toolChoice = &choice
+	}
+}
+
+// ToolChoice returns the per-call tool choice override, or nil if not set.
+func (c *generateConfig) ToolChoice() *ToolChoice {
+	return c.toolChoice
+}
+
+type toolChoiceCtxKey struct{}
+
+// ContextWithToolChoice returns a context that sets the tool choice of Agent.Execute. The
+// choice applies only to the first LLM call of the execution, e.g. to force a search before
+// answering or to forbid tools for a pure-reasoning turn; later calls use the provider
+// default so that the agent can finish. Tools and sub-agents run by the execution do not
+// inherit it.
+func ContextWithToolChoice(ctx context.Context, choice ToolChoice) context.Context {
+	return context.WithValue(ctx, toolChoiceCtxKey{}, &choice)
+}
+
+// toolChoiceFromContext returns the tool choice set by ContextWithToolChoice and a context
+// without it.
+func toolChoiceFromContext(ctx context.Context) (*ToolChoice, context.Context) {
+	choice, ok := ctx.Value(toolChoiceCtxKey{}).(*ToolChoice)
+	if !ok || choice == nil {
+		return nil, ctx
+	}
+	return choice, context.WithValue(ctx, toolChoiceCtxKey{}, (*ToolChoice)(nil))
+}
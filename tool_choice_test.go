@@ -0,0 +1,69 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestWithToolChoice(t *testing.T) {
+	cfg := gollem.NewGenerateConfig()
+	gt.Nil(t, cfg.ToolChoice())
+
+	cfg = gollem.NewGenerateConfig(gollem.WithToolChoice(gollem.ToolChoiceTool("search")))
+	gt.Equal(t, &gollem.ToolChoice{Mode: gollem.ToolChoiceModeTool, Name: "search"}, cfg.ToolChoice())
+}
+
+func TestExecuteToolChoice(t *testing.T) {
+	var choices []*gollem.ToolChoice
+
+	calls := 0
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					cfg := gollem.NewGenerateConfig(opts...)
+					choices = append(choices, cfg.ToolChoice())
+					calls++
+					if calls == 1 {
+						return &gollem.Response{
+							FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "search"}},
+						}, nil
+					}
+					return &gollem.Response{Texts: []string{"done"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+				AppendHistoryFunc: func(*gollem.History) error { return nil },
+			}, nil
+		},
+	}
+
+	tool := &mock.ToolMock{
+		SpecFunc: func() gollem.ToolSpec {
+			return gollem.ToolSpec{Name: "search", Description: "search"}
+		},
+		RunFunc: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			// A nested Execute with this context must not be forced to call tools.
+			inner := gollem.New(client)
+			_, err := inner.Execute(ctx, gollem.Text("nested"))
+			gt.NoError(t, err)
+			return map[string]any{}, nil
+		},
+	}
+
+	agent := gollem.New(client, gollem.WithTools(tool))
+	ctx := gollem.ContextWithToolChoice(t.Context(), gollem.ToolChoiceTool("search"))
+	_, err := agent.Execute(ctx, gollem.Text("find it"))
+	gt.NoError(t, err)
+
+	// outer first call, nested call, outer second call
+	gt.A(t, choices).Length(3)
+	gt.Equal(t, &gollem.ToolChoice{Mode: gollem.ToolChoiceModeTool, Name: "search"}, choices[0])
+	gt.Nil(t, choices[1])
+	gt.Nil(t, choices[2])
+}
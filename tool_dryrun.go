@@ -0,0 +1,137 @@
+package gollem
+
+import (
+	"context"
+	"maps"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// ToolValidateOnlyParam is the name of the parameter added to tools by WithToolDryRun. A call
+// with it set to true is validated without running the tool.
+const ToolValidateOnlyParam = "validate_only"
+
+// toolValidateOnlyDescription is added to the description of tools of WithToolDryRun.
+const toolValidateOnlyDescription = "Set validate_only to true to check the arguments without running the tool, e.g. before an operation that can not be undone."
+
+// ToolValidator is an optional interface of Tool validating arguments beyond the parameters of
+// ToolSpec, e.g. that a target resource exists or that the caller may modify it. It's called
+// after the arguments pass validation of ToolSpec, both for validate-only calls of
+// WithToolDryRun and before Run of every call. The error is returned to the LLM as the result of
+// the call. It must not have side effects.
+type ToolValidator interface {
+	ValidateCall(ctx context.Context, args map[string]any) error
+}
+
+// ToolDryRunEvent is recorded to the trace when a validate-only call is processed.
+type ToolDryRunEvent struct {
+	Tool  string `json:"tool"`
+	Valid bool   `json:"valid"`
+}
+
+// WithToolDryRun lets the LLM validate a call of the tools matching the patterns of path.Match,
+// or of all tools if no pattern is given, before running it. The tools get a boolean parameter
+// ToolValidateOnlyParam; a call with it set to true goes through tool middlewares and is
+// validated by ToolSpec and ToolValidator of the tool, but the tool does not run, and the LLM
+// gets {"valid": true} or the validation error. Tool middlewares see the call with
+// ToolExecRequest.ValidateOnly set, and ToolPolicy does not ask for confirmation of it. The
+// parameter is removed from the arguments before middlewares see them. Tools of ToolSets are
+// validated only by their ToolSpec.
+func WithToolDryRun(patterns ...string) Option {
+	return func(s *gollemConfig) {
+		s.toolDryRun = &toolDryRunConfig{patterns: patterns}
+	}
+}
+
+// toolDryRunConfig is the tools of WithToolDryRun.
+type toolDryRunConfig struct {
+	patterns []string
+}
+
+// match returns true if the tool accepts validate-only calls.
+func (c *toolDryRunConfig) match(name string) bool {
+	return c != nil && (len(c.patterns) == 0 || matchToolName(c.patterns, name))
+}
+
+// wrap returns tool declaring ToolValidateOnlyParam to the LLM if it matches.
+func (c *toolDryRunConfig) wrap(tool Tool) (Tool, error) {
+	spec := tool.Spec()
+	if !c.match(spec.Name) {
+		return tool, nil
+	}
+	if _, ok := spec.Parameters[ToolValidateOnlyParam]; ok {
+		return nil, goerr.Wrap(ErrInvalidTool, "tool already has the parameter of dry run",
+			goerr.V("tool", spec.Name), goerr.V("parameter", ToolValidateOnlyParam))
+	}
+	return &dryRunTool{Tool: tool}, nil
+}
+
+// takeValidateOnly removes ToolValidateOnlyParam from the arguments of call and returns true if
+// it asks to validate only. The arguments are copied not to modify the ones of the response.
+func (c *toolDryRunConfig) takeValidateOnly(call *FunctionCall) bool {
+	if !c.match(call.Name) {
+		return false
+	}
+	value, ok := call.Arguments[ToolValidateOnlyParam]
+	if !ok {
+		return false
+	}
+	args := maps.Clone(call.Arguments)
+	delete(args, ToolValidateOnlyParam)
+	call.Arguments = args
+
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// dryRunTool is a Tool whose spec declares ToolValidateOnlyParam. It's given only to the
+// session; calls are dispatched to the original tool.
+type dryRunTool struct {
+	Tool
+}
+
+func (x *dryRunTool) Spec() ToolSpec {
+	spec := x.Tool.Spec()
+	params := make(map[string]*Parameter, len(spec.Parameters)+1)
+	maps.Copy(params, spec.Parameters)
+	params[ToolValidateOnlyParam] = &Parameter{
+		Type:        TypeBoolean,
+		Description: "If true, the arguments are validated and the tool does not run",
+	}
+	spec.Parameters = params
+	if spec.Description != "" {
+		spec.Description += "\n\n"
+	}
+	spec.Description += toolValidateOnlyDescription
+	return spec
+}
+
+// toolValidatorOf returns the ToolValidator of tool, including the tool of a batch member.
+func toolValidatorOf(tool Tool) (ToolValidator, bool) {
+	if member, ok := tool.(*batchMember); ok {
+		tool = member.batch.tool
+	}
+	v, ok := tool.(ToolValidator)
+	return v, ok
+}
+
+// recordToolDryRun records the result of a validate-only call to the trace.
+func recordToolDryRun(ctx context.Context, name string, valid bool) {
+	if h := trace.HandlerFrom(ctx); h != nil {
+		h.AddEvent(ctx, "tool_dry_run", &ToolDryRunEvent{Tool: name, Valid: valid})
+	}
+}
+
+// dryRunResult is the result of a validate-only call that passed validation.
+func dryRunResult() map[string]any {
+	return map[string]any{
+		"valid":   true,
+		"message": "The arguments are valid. Call the tool again without " + ToolValidateOnlyParam + " to run it.",
+	}
+}
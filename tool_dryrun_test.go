@@ -0,0 +1,158 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+// validatedTool is a tool with ToolValidator rejecting unknown files.
+type validatedTool struct {
+	mockTool
+}
+
+func (x *validatedTool) ValidateCall(ctx context.Context, args map[string]any) error {
+	if args["path"] != "a.txt" {
+		return errors.New("file not found")
+	}
+	return nil
+}
+
+func TestToolDryRun(t *testing.T) {
+	var runs []map[string]any
+	deleteFile := &validatedTool{mockTool{
+		spec: gollem.ToolSpec{
+			Name:        "delete_file",
+			Description: "Delete a file",
+			Parameters: map[string]*gollem.Parameter{
+				"path": {Type: gollem.TypeString, Required: true},
+			},
+		},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			runs = append(runs, args)
+			return map[string]any{"deleted": true}, nil
+		},
+	}}
+	readFile := &mockTool{
+		spec: gollem.ToolSpec{Name: "read_file", Description: "Read a file"},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{}, nil
+		},
+	}
+	callOf := func(args map[string]any) *gollem.Response {
+		return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+			{ID: "call_1", Name: "delete_file", Arguments: args},
+		}}
+	}
+
+	t.Run("spec declares the parameter for matching tools", func(t *testing.T) {
+		agent := gollem.New(newScriptedClient(&[][]gollem.Input{}),
+			gollem.WithTools(deleteFile, readFile),
+			gollem.WithToolDryRun("delete_*"),
+		)
+		desc, err := agent.Describe(t.Context())
+		gt.NoError(t, err)
+		gt.A(t, desc.Tools).Length(2)
+		gt.Equal(t, "delete_file", desc.Tools[0].Name)
+		gt.Equal(t, gollem.TypeBoolean, desc.Tools[0].Parameters[gollem.ToolValidateOnlyParam].Type)
+		gt.S(t, desc.Tools[0].Description).Contains("validate_only")
+		gt.Nil(t, desc.Tools[1].Parameters[gollem.ToolValidateOnlyParam])
+	})
+
+	testCases := map[string]struct {
+		args  map[string]any
+		valid bool
+		runs  int
+	}{
+		"valid call is not run": {
+			args:  map[string]any{"path": "a.txt", gollem.ToolValidateOnlyParam: true},
+			valid: true,
+		},
+		"schema error": {
+			args: map[string]any{gollem.ToolValidateOnlyParam: true},
+		},
+		"validator error": {
+			args: map[string]any{"path": "b.txt", gollem.ToolValidateOnlyParam: true},
+		},
+		"false runs the tool": {
+			args:  map[string]any{"path": "a.txt", gollem.ToolValidateOnlyParam: false},
+			valid: true,
+			runs:  1,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			runs = nil
+			var inputs [][]gollem.Input
+			var requests []*gollem.ToolExecRequest
+			agent := gollem.New(newScriptedClient(&inputs, callOf(tc.args)),
+				gollem.WithTools(deleteFile),
+				gollem.WithToolDryRun(),
+				gollem.WithToolMiddleware(func(next gollem.ToolHandler) gollem.ToolHandler {
+					return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+						requests = append(requests, req)
+						return next(ctx, req)
+					}
+				}),
+			)
+			_, err := agent.Execute(t.Context(), gollem.Text("delete it"))
+			gt.NoError(t, err)
+
+			gt.A(t, runs).Length(tc.runs)
+			for _, args := range runs {
+				gt.Equal(t, map[string]any{"path": "a.txt"}, args)
+			}
+			gt.A(t, requests).Length(1)
+			gt.Nil(t, requests[0].Tool.Arguments[gollem.ToolValidateOnlyParam])
+
+			resp := inputs[1][0].(gollem.FunctionResponse)
+			if !tc.valid {
+				gt.Error(t, resp.Error)
+				return
+			}
+			gt.NoError(t, resp.Error)
+			if tc.runs == 0 {
+				gt.True(t, requests[0].ValidateOnly)
+				gt.Equal[any](t, true, resp.Data["valid"])
+			}
+		})
+	}
+
+	t.Run("validator runs before every call", func(t *testing.T) {
+		runs = nil
+		var inputs [][]gollem.Input
+		agent := gollem.New(newScriptedClient(&inputs, callOf(map[string]any{"path": "b.txt"})),
+			gollem.WithTools(deleteFile),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("delete it"))
+		gt.NoError(t, err)
+		gt.A(t, runs).Length(0)
+		gt.Error(t, inputs[1][0].(gollem.FunctionResponse).Error)
+	})
+
+	t.Run("validate-only call is not confirmed", func(t *testing.T) {
+		runs = nil
+		var inputs [][]gollem.Input
+		agent := gollem.New(newScriptedClient(&inputs, callOf(map[string]any{"path": "a.txt", gollem.ToolValidateOnlyParam: true})),
+			gollem.WithTools(deleteFile),
+			gollem.WithToolDryRun(),
+			gollem.WithToolPolicy(gollem.AskTools("delete_file")),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("delete it"))
+		gt.NoError(t, err)
+		gt.NoError(t, inputs[1][0].(gollem.FunctionResponse).Error)
+		gt.A(t, runs).Length(0)
+	})
+
+	t.Run("conflicting parameter", func(t *testing.T) {
+		tool := &mockTool{spec: gollem.ToolSpec{Name: "conflict", Parameters: map[string]*gollem.Parameter{
+			gollem.ToolValidateOnlyParam: {Type: gollem.TypeBoolean},
+		}}}
+		agent := gollem.New(newScriptedClient(&[][]gollem.Input{}), gollem.WithTools(tool), gollem.WithToolDryRun())
+		_, err := agent.Execute(t.Context(), gollem.Text("hi"))
+		gt.Error(t, err).Is(gollem.ErrInvalidTool)
+	})
+}
@@ -0,0 +1,216 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// ToolErrorCategory is the category of a ToolError.
+type ToolErrorCategory string
+
+const (
+	// ToolErrorUser is an error caused by the call itself, e.g. invalid arguments, a denied
+	// tool or a missing resource. The LLM may fix the call.
+	ToolErrorUser ToolErrorCategory = "user_error"
+	// ToolErrorTransient is an error that may not occur on retry, e.g. a timeout or a rate limit.
+	ToolErrorTransient ToolErrorCategory = "transient"
+	// ToolErrorFatal is an error that the LLM can not recover from by retry. Errors that are not
+	// classified are fatal.
+	ToolErrorFatal ToolErrorCategory = "fatal"
+)
+
+// ToolError is a classified error of a tool call. A tool can return it from Run to classify its
+// error; other errors are classified by the agent, e.g. ErrToolArgsValidation and ErrToolDenied
+// as ToolErrorUser, and ErrToolTimeout and errors tagged by ErrTagTransient as
+// ToolErrorTransient. The error of FunctionResponse from the agent is a *ToolError, which is
+// sent to the LLM in the same form by every provider. See FunctionResponse.ErrorData.
+type ToolError struct {
+	Category ToolErrorCategory
+	// Retryable is true if the same call may succeed on retry
+	Retryable bool
+	// Message is the message sent to the LLM. The agent replaces values of sensitive parameters
+	// of the call in it by RedactedValue.
+	Message string
+	// Err is the cause of the error, which is not sent to the LLM
+	Err error
+}
+
+// NewToolError creates a ToolError of category with message for the LLM and the cause err, which
+// may be nil. It's retryable if category is ToolErrorTransient.
+func NewToolError(category ToolErrorCategory, message string, err error) *ToolError {
+	return &ToolError{
+		Category:  category,
+		Retryable: category == ToolErrorTransient,
+		Message:   message,
+		Err:       err,
+	}
+}
+
+// Error returns Message, or the message of Err if Message is empty.
+func (e *ToolError) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns Err.
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// Data returns the error in the form sent to the LLM as the result of the call.
+func (e *ToolError) Data() map[string]any {
+	return map[string]any{
+		"error": map[string]any{
+			"category":  string(e.Category),
+			"retryable": e.Retryable,
+			"message":   e.Error(),
+		},
+	}
+}
+
+// classifyToolError returns err as a ToolError. A ToolError in the chain of err is returned as
+// it is; otherwise the category is decided by the sentinel errors and tags of err.
+func classifyToolError(err error) *ToolError {
+	if err == nil {
+		return nil
+	}
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) {
+		return toolErr
+	}
+
+	category := ToolErrorFatal
+	switch {
+	case errors.Is(err, ErrToolArgsValidation), errors.Is(err, ErrToolDenied), errors.Is(err, ErrToolNotFound):
+		category = ToolErrorUser
+	case errors.Is(err, ErrToolTimeout), errors.Is(err, context.DeadlineExceeded), goerr.HasTag(err, ErrTagTransient):
+		category = ToolErrorTransient
+	}
+	return NewToolError(category, err.Error(), err)
+}
+
+// ErrorData returns Error classified as a ToolError in the form sent to the LLM, or nil if Error
+// is nil. Providers use it to format failed calls consistently.
+func (f FunctionResponse) ErrorData() map[string]any {
+	toolErr := classifyToolError(f.Error)
+	if toolErr == nil {
+		return nil
+	}
+	return toolErr.Data()
+}
+
+// EncodeError returns ErrorData encoded in JSON, or an empty string if Error is nil.
+func (f FunctionResponse) EncodeError() string {
+	data := f.ErrorData()
+	if data == nil {
+		return ""
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		// Unreachable as ErrorData consists of strings and a bool
+		return f.Error.Error()
+	}
+	return string(raw)
+}
+
+// ToolErrorAction is the action of a ToolErrorPolicy.
+type ToolErrorAction string
+
+const (
+	// ToolErrorFeedback returns the error to the LLM as the result of the call, which is the
+	// default
+	ToolErrorFeedback ToolErrorAction = "feedback"
+	// ToolErrorAbort aborts the execution, and Execute returns the error
+	ToolErrorAbort ToolErrorAction = "abort"
+)
+
+// ToolErrorPolicy decides the action on a failed tool call. It may be called concurrently with
+// WithParallelToolCalls.
+type ToolErrorPolicy func(ctx context.Context, call *FunctionCall, err *ToolError) ToolErrorAction
+
+// WithToolErrorPolicy sets the policy deciding whether a failed tool call aborts the execution
+// or is returned to the LLM. By default, all errors are returned to the LLM. Calls of
+// DeferredTool waiting for their results are not failures and never passed to the policy.
+func WithToolErrorPolicy(policy ToolErrorPolicy) Option {
+	return func(s *gollemConfig) {
+		s.toolErrorPolicy = policy
+	}
+}
+
+// AbortOnToolError returns a ToolErrorPolicy aborting the execution on errors of the categories
+// and returning the others to the LLM, e.g. AbortOnToolError(ToolErrorFatal).
+func AbortOnToolError(categories ...ToolErrorCategory) ToolErrorPolicy {
+	return func(ctx context.Context, call *FunctionCall, err *ToolError) ToolErrorAction {
+		if slices.Contains(categories, err.Category) {
+			return ToolErrorAbort
+		}
+		return ToolErrorFeedback
+	}
+}
+
+// newCallToolError classifies err of call and redacts values of sensitive parameters of the call
+// in the message. The cause is annotated with errCall, the call with redacted arguments.
+func newCallToolError(err error, call, errCall *FunctionCall) *ToolError {
+	classified := classifyToolError(err)
+	toolErr := *classified
+	toolErr.Message = redactSensitiveText(classified.Error(), call.Arguments, errCall.Arguments)
+	toolErr.Err = goerr.With(err, goerr.V("call", errCall))
+	return &toolErr
+}
+
+// redactSensitiveText replaces string values in args that are redacted in redacted by
+// RedactedValue in text.
+func redactSensitiveText(text string, args, redacted map[string]any) string {
+	var secrets []string
+	collectRedactedStrings(args, redacted, &secrets)
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, RedactedValue)
+	}
+	return text
+}
+
+func collectRedactedStrings(value, redacted any, secrets *[]string) {
+	switch v := value.(type) {
+	case string:
+		if s, ok := redacted.(string); ok && s == RedactedValue && v != "" && v != RedactedValue {
+			*secrets = append(*secrets, v)
+		}
+	case map[string]any:
+		r, _ := redacted.(map[string]any)
+		for key, item := range v {
+			collectRedactedStrings(item, r[key], secrets)
+		}
+	case []any:
+		r, _ := redacted.([]any)
+		for i, item := range v {
+			if i < len(r) {
+				collectRedactedStrings(item, r[i], secrets)
+			}
+		}
+	}
+}
+
+// failToolCall returns the response of call failed by err, or an error to abort the execution if
+// the ToolErrorPolicy decides so.
+func failToolCall(ctx context.Context, cfg *gollemConfig, call, errCall *FunctionCall, err error) (FunctionResponse, error) {
+	toolErr := newCallToolError(err, call, errCall)
+	resp := FunctionResponse{
+		ID:    call.ID,
+		Name:  call.Name,
+		Error: toolErr,
+	}
+	if cfg.toolErrorPolicy == nil || errors.Is(err, ErrToolCallDeferred) {
+		return resp, nil
+	}
+	if cfg.toolErrorPolicy(ctx, call, toolErr) == ToolErrorAbort {
+		return resp, goerr.Wrap(toolErr, "tool call aborted the execution", goerr.V("tool", call.Name), goerr.V("category", toolErr.Category))
+	}
+	return resp, nil
+}
@@ -0,0 +1,141 @@
+package gollem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestToolError(t *testing.T) {
+	// runTool executes a call of a tool returning err and returns the result given to the LLM
+	runTool := func(t *testing.T, args map[string]any, err error, opts ...gollem.Option) (gollem.FunctionResponse, error) {
+		var inputs [][]gollem.Input
+		tool := &mockTool{
+			spec: gollem.ToolSpec{
+				Name:        "lookup",
+				Description: "Look up a record",
+				Parameters: map[string]*gollem.Parameter{
+					"id":    {Type: gollem.TypeString},
+					"token": {Type: gollem.TypeString, Sensitive: true},
+				},
+			},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				return nil, err
+			},
+		}
+		agent := gollem.New(newScriptedClient(&inputs, &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+			{ID: "call_1", Name: "lookup", Arguments: args},
+		}}), append([]gollem.Option{gollem.WithTools(tool)}, opts...)...)
+		_, execErr := agent.Execute(t.Context(), gollem.Text("look up"))
+		if len(inputs) < 2 {
+			return gollem.FunctionResponse{}, execErr
+		}
+		return inputs[1][0].(gollem.FunctionResponse), execErr
+	}
+
+	testCases := map[string]struct {
+		err       error
+		category  gollem.ToolErrorCategory
+		retryable bool
+		message   string
+	}{
+		"unclassified error is fatal": {
+			err:      errors.New("disk broken"),
+			category: gollem.ToolErrorFatal,
+			message:  "disk broken",
+		},
+		"transient tag": {
+			err:       goerr.New("service unavailable", goerr.T(gollem.ErrTagTransient)),
+			category:  gollem.ToolErrorTransient,
+			retryable: true,
+			message:   "service unavailable",
+		},
+		"timeout": {
+			err:       goerr.Wrap(gollem.ErrToolTimeout, "too slow"),
+			category:  gollem.ToolErrorTransient,
+			retryable: true,
+			message:   "too slow: tool execution timed out",
+		},
+		"ToolError of the tool": {
+			err:      gollem.NewToolError(gollem.ToolErrorUser, "record 42 does not exist", errors.New("sql: no rows")),
+			category: gollem.ToolErrorUser,
+			message:  "record 42 does not exist",
+		},
+		"sensitive arguments are redacted": {
+			err:      errors.New("token sk-secret is expired"),
+			category: gollem.ToolErrorFatal,
+			message:  "token [REDACTED] is expired",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := runTool(t, map[string]any{"id": "42", "token": "sk-secret"}, tc.err)
+			gt.NoError(t, err)
+
+			var toolErr *gollem.ToolError
+			gt.True(t, errors.As(resp.Error, &toolErr))
+			gt.Equal(t, tc.category, toolErr.Category)
+			gt.Equal(t, tc.retryable, toolErr.Retryable)
+			gt.Equal(t, tc.message, toolErr.Message)
+			gt.NotNil(t, errors.Unwrap(resp.Error))
+			gt.Equal(t, map[string]any{
+				"error": map[string]any{
+					"category":  string(tc.category),
+					"retryable": tc.retryable,
+					"message":   tc.message,
+				},
+			}, resp.ErrorData())
+		})
+	}
+
+	t.Run("invalid arguments are user errors", func(t *testing.T) {
+		resp, err := runTool(t, map[string]any{"id": 42}, nil)
+		gt.NoError(t, err)
+		gt.True(t, errors.Is(resp.Error, gollem.ErrToolArgsValidation))
+		gt.Equal[any](t, string(gollem.ToolErrorUser), resp.ErrorData()["error"].(map[string]any)["category"])
+	})
+
+	t.Run("unknown tools are user errors", func(t *testing.T) {
+		var inputs [][]gollem.Input
+		agent := gollem.New(newScriptedClient(&inputs, &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+			{ID: "call_1", Name: "missing", Arguments: map[string]any{}},
+		}}))
+		_, err := agent.Execute(t.Context(), gollem.Text("call"))
+		gt.NoError(t, err)
+
+		resp := inputs[1][0].(gollem.FunctionResponse)
+		gt.True(t, errors.Is(resp.Error, gollem.ErrToolNotFound))
+		gt.Equal(t, `{"error":{"category":"user_error","message":"missing is not found: tool not found","retryable":false}}`, resp.EncodeError())
+	})
+
+	t.Run("policy aborts the execution", func(t *testing.T) {
+		cause := errors.New("disk broken")
+		resp, err := runTool(t, map[string]any{"id": "42"}, cause,
+			gollem.WithToolErrorPolicy(gollem.AbortOnToolError(gollem.ToolErrorFatal)),
+		)
+		gt.Error(t, err).Is(cause)
+		var toolErr *gollem.ToolError
+		gt.True(t, errors.As(err, &toolErr))
+		gt.Equal(t, gollem.ToolErrorFatal, toolErr.Category)
+		// The LLM is not called with the result
+		gt.Nil(t, resp.Error)
+	})
+
+	t.Run("policy feeds back other categories", func(t *testing.T) {
+		var got []*gollem.ToolError
+		resp, err := runTool(t, map[string]any{"id": "42"}, goerr.Wrap(gollem.ErrToolTimeout, "too slow"),
+			gollem.WithToolErrorPolicy(func(ctx context.Context, call *gollem.FunctionCall, err *gollem.ToolError) gollem.ToolErrorAction {
+				got = append(got, err)
+				return gollem.AbortOnToolError(gollem.ToolErrorFatal)(ctx, call, err)
+			}),
+		)
+		gt.NoError(t, err)
+		gt.A(t, got).Length(1)
+		gt.Equal(t, gollem.ToolErrorTransient, got[0].Category)
+		gt.Error(t, resp.Error).Is(gollem.ErrToolTimeout)
+	})
+}
@@ -0,0 +1,103 @@
+package gollem
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// funcTool is a Tool built from a Go function by NewTool.
+type funcTool[TArgs, TResult any] struct {
+	spec ToolSpec
+	fn   func(ctx context.Context, args TArgs) (TResult, error)
+}
+
+// NewTool builds a Tool from a Go function. The parameters of the ToolSpec are generated from
+// TArgs, which must be a struct or a pointer to a struct, by ToSchema with its struct tags.
+// Arguments of a tool call are decoded into TArgs through JSON, and the result is encoded into
+// map[string]any through JSON. A result that is not encoded as a JSON object, e.g. a string or
+// a slice, is returned as {"result": value}.
+//
+// Example:
+//
+//	type WeatherArgs struct {
+//	    City string `json:"city" description:"City name" required:"true"`
+//	}
+//
+//	tool, err := gollem.NewTool("get_weather", "Get current weather of a city",
+//	    func(ctx context.Context, args WeatherArgs) (*Weather, error) {
+//	        return fetchWeather(ctx, args.City)
+//	    })
+func NewTool[TArgs, TResult any](name, description string, fn func(ctx context.Context, args TArgs) (TResult, error)) (Tool, error) {
+	schema, err := ToSchema(*new(TArgs))
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to generate schema of tool arguments", goerr.V("tool", name))
+	}
+	if schema.Type != TypeObject {
+		return nil, goerr.Wrap(ErrInvalidTool, "tool arguments must be a struct",
+			goerr.V("tool", name),
+			goerr.V("type", schema.Type))
+	}
+
+	t := &funcTool[TArgs, TResult]{
+		spec: ToolSpec{
+			Name:        name,
+			Description: description,
+			Parameters:  schema.Properties,
+		},
+		fn: fn,
+	}
+	if err := t.spec.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// MustNewTool is like NewTool but panics on error.
+func MustNewTool[TArgs, TResult any](name, description string, fn func(ctx context.Context, args TArgs) (TResult, error)) Tool {
+	t, err := NewTool(name, description, fn)
+	if err != nil {
+		panic(goerr.Wrap(err, "MustNewTool failed"))
+	}
+	return t
+}
+
+func (t *funcTool[TArgs, TResult]) Spec() ToolSpec {
+	return t.spec
+}
+
+func (t *funcTool[TArgs, TResult]) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal tool arguments", goerr.V("tool", t.spec.Name))
+	}
+	var typedArgs TArgs
+	if err := json.Unmarshal(raw, &typedArgs); err != nil {
+		return nil, goerr.Wrap(err, "failed to decode tool arguments", goerr.V("tool", t.spec.Name))
+	}
+
+	result, err := t.fn(ctx, typedArgs)
+	if err != nil {
+		// Returned as it is to keep sentinel errors such as ErrExitConversation
+		return nil, err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal tool result", goerr.V("tool", t.spec.Name))
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err == nil {
+		return out, nil
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, goerr.Wrap(err, "failed to decode tool result", goerr.V("tool", t.spec.Name))
+	}
+	return map[string]any{"result": value}, nil
+}
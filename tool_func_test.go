@@ -0,0 +1,103 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+type weatherArgs struct {
+	City  string `json:"city" description:"City name" required:"true"`
+	Days  int    `json:"days" min:"1" max:"7"`
+	Units string `json:"units" enum:"celsius,fahrenheit"`
+}
+
+type weatherResult struct {
+	City        string   `json:"city"`
+	Temperature float64  `json:"temperature"`
+	Forecast    []string `json:"forecast"`
+}
+
+func TestNewTool(t *testing.T) {
+	tool, err := gollem.NewTool("get_weather", "Get weather of a city",
+		func(ctx context.Context, args weatherArgs) (*weatherResult, error) {
+			forecast := make([]string, args.Days)
+			for i := range forecast {
+				forecast[i] = "sunny"
+			}
+			return &weatherResult{City: args.City, Temperature: 22.5, Forecast: forecast}, nil
+		})
+	gt.NoError(t, err)
+
+	spec := tool.Spec()
+	gt.Equal(t, "get_weather", spec.Name)
+	gt.Equal(t, "Get weather of a city", spec.Description)
+	gt.Equal(t, gollem.TypeString, spec.Parameters["city"].Type)
+	gt.True(t, spec.Parameters["city"].Required)
+	gt.Equal(t, gollem.TypeInteger, spec.Parameters["days"].Type)
+	gt.Equal(t, []string{"celsius", "fahrenheit"}, spec.Parameters["units"].Enum)
+
+	// Arguments from the LLM have JSON types, e.g. float64 for integers
+	result, err := tool.Run(t.Context(), map[string]any{"city": "Tokyo", "days": 2.0})
+	gt.NoError(t, err)
+	gt.Equal(t, map[string]any{
+		"city":        "Tokyo",
+		"temperature": 22.5,
+		"forecast":    []any{"sunny", "sunny"},
+	}, result)
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := tool.Run(t.Context(), map[string]any{"city": 123})
+		gt.Error(t, err)
+	})
+}
+
+func TestNewToolResult(t *testing.T) {
+	t.Run("non-object result", func(t *testing.T) {
+		tool := gollem.MustNewTool("echo", "Echo the text",
+			func(ctx context.Context, args struct {
+				Text string `json:"text"`
+			}) (string, error) {
+				return args.Text, nil
+			})
+		result, err := tool.Run(t.Context(), map[string]any{"text": "hello"})
+		gt.NoError(t, err)
+		gt.Equal(t, map[string]any{"result": "hello"}, result)
+	})
+
+	t.Run("nil result", func(t *testing.T) {
+		tool := gollem.MustNewTool("noop", "Do nothing",
+			func(ctx context.Context, args *weatherArgs) (map[string]any, error) {
+				gt.Equal(t, "Osaka", args.City)
+				return nil, nil
+			})
+		result, err := tool.Run(t.Context(), map[string]any{"city": "Osaka"})
+		gt.NoError(t, err)
+		gt.Nil(t, result)
+	})
+
+	t.Run("error is returned as it is", func(t *testing.T) {
+		tool := gollem.MustNewTool("exit", "Exit",
+			func(ctx context.Context, args weatherArgs) (map[string]any, error) {
+				return nil, gollem.ErrExitConversation
+			})
+		_, err := tool.Run(t.Context(), map[string]any{"city": "Osaka"})
+		gt.Error(t, err).Is(gollem.ErrExitConversation)
+	})
+}
+
+func TestNewToolInvalidArgsType(t *testing.T) {
+	_, err := gollem.NewTool("bad", "Non-struct arguments",
+		func(ctx context.Context, args string) (string, error) {
+			return args, nil
+		})
+	gt.Error(t, err).Is(gollem.ErrInvalidTool)
+
+	_, err = gollem.NewTool("", "No name",
+		func(ctx context.Context, args weatherArgs) (string, error) {
+			return "", nil
+		})
+	gt.Error(t, err).Is(gollem.ErrInvalidTool)
+}
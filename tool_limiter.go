@@ -0,0 +1,157 @@
+package gollem
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// ToolLimiter limits tool executions under constrained concurrency. It runs at most
+// maxConcurrency tools at a time, and waiting calls are served in order of priority, then in
+// FIFO order, so critical calls (e.g. a final verification) are not starved behind bulk
+// lookups. Priority of a call is ToolSpec.Priority, which a tool middleware can override per
+// call by ToolExecRequest.Priority. Share a ToolLimiter among agents calling the same backends
+// by WithToolLimiter. It's safe for concurrent use.
+type ToolLimiter struct {
+	maxConcurrency int
+	rateLimiter    RateLimiter
+
+	mu      sync.Mutex
+	running int
+	waiting toolWaitQueue
+	seq     uint64
+}
+
+// ToolLimiterOption is an option of NewToolLimiter.
+type ToolLimiterOption func(*ToolLimiter)
+
+// WithToolRateLimit sets a RateLimiter consumed by 1 per tool execution, e.g. *rate.Limiter of
+// golang.org/x/time/rate for a limit of tool calls per second. A call waits for the rate limit
+// after it's admitted by priority, so the rate limit does not reorder calls.
+func WithToolRateLimit(limiter RateLimiter) ToolLimiterOption {
+	return func(x *ToolLimiter) {
+		x.rateLimiter = limiter
+	}
+}
+
+// NewToolLimiter creates a ToolLimiter running at most maxConcurrency tools at a time. A value
+// less than 1 is treated as 1.
+func NewToolLimiter(maxConcurrency int, opts ...ToolLimiterOption) *ToolLimiter {
+	x := &ToolLimiter{maxConcurrency: max(maxConcurrency, 1)}
+	for _, opt := range opts {
+		opt(x)
+	}
+	return x
+}
+
+// WithToolLimiter runs tools of the agent under limiter. Cached results of WithToolCache do not
+// consume the limiter, and calls of a BatchTool coalesced into one RunBatch consume it once with
+// the priority of the tool.
+func WithToolLimiter(limiter *ToolLimiter) Option {
+	return func(s *gollemConfig) {
+		s.toolLimiter = limiter
+	}
+}
+
+type toolWaiter struct {
+	priority int
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+// toolWaitQueue is a heap of waiting calls ordered by priority, then by arrival.
+type toolWaitQueue []*toolWaiter
+
+func (q toolWaitQueue) Len() int { return len(q) }
+
+func (q toolWaitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q toolWaitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *toolWaitQueue) Push(v any) {
+	w := v.(*toolWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *toolWaitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	w.index = -1
+	return w
+}
+
+// acquire blocks until a tool execution of priority is admitted, or ctx is done. The returned
+// release must be called after the execution.
+func (x *ToolLimiter) acquire(ctx context.Context, priority int) (func(), error) {
+	x.mu.Lock()
+	if x.running < x.maxConcurrency && x.waiting.Len() == 0 {
+		x.running++
+		x.mu.Unlock()
+	} else {
+		w := &toolWaiter{priority: priority, seq: x.seq, ready: make(chan struct{})}
+		x.seq++
+		heap.Push(&x.waiting, w)
+		x.mu.Unlock()
+
+		select {
+		case <-w.ready:
+		case <-ctx.Done():
+			x.mu.Lock()
+			if w.index < 0 {
+				// Admitted while canceled; hand the slot over to the next call
+				x.mu.Unlock()
+				x.release()
+			} else {
+				heap.Remove(&x.waiting, w.index)
+				x.mu.Unlock()
+			}
+			return nil, goerr.Wrap(ctx.Err(), "tool execution is canceled while waiting for the limit")
+		}
+	}
+
+	if x.rateLimiter != nil {
+		if err := x.rateLimiter.WaitN(ctx, 1); err != nil {
+			x.release()
+			return nil, goerr.Wrap(err, "failed to wait for tool rate limit")
+		}
+	}
+	return x.release, nil
+}
+
+// release frees the slot of a finished execution and admits the next waiting call.
+func (x *ToolLimiter) release() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.waiting.Len() > 0 {
+		// The slot is passed to the next call without decrementing running
+		w := heap.Pop(&x.waiting).(*toolWaiter)
+		close(w.ready)
+		return
+	}
+	x.running--
+}
+
+// run executes run under the limiter.
+func (x *ToolLimiter) run(ctx context.Context, priority int, run toolRunFunc, args map[string]any) (map[string]any, error) {
+	release, err := x.acquire(ctx, priority)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return run(ctx, args)
+}
@@ -0,0 +1,151 @@
+package gollem_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+// executeToolCall runs an agent calling the tool once and returns the tool response.
+func executeToolCall(ctx context.Context, tool gollem.Tool, call *gollem.FunctionCall, opts ...gollem.Option) (gollem.FunctionResponse, error) {
+	var resp gollem.FunctionResponse
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					if r, ok := input[0].(gollem.FunctionResponse); ok {
+						resp = r
+						return &gollem.Response{Texts: []string{"done"}}, nil
+					}
+					return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{call}}, nil
+				},
+			}, nil
+		},
+	}
+
+	opts = append([]gollem.Option{gollem.WithTools(tool), gollem.WithLoopLimit(5)}, opts...)
+	_, err := gollem.New(client, opts...).Execute(ctx, gollem.Text("run"))
+	return resp, err
+}
+
+func waitToolLimiter(t *testing.T, limiter *gollem.ToolLimiter, waiting int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for gollem.ToolLimiterWaiting(limiter) != waiting {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiting calls did not become %d", waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestToolLimiter(t *testing.T) {
+	t.Run("waiting calls run by priority", func(t *testing.T) {
+		limiter := gollem.NewToolLimiter(1)
+
+		started := make(chan struct{})
+		unblock := make(chan struct{})
+		hold := &mockTool{
+			spec: gollem.ToolSpec{Name: "hold"},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				close(started)
+				<-unblock
+				return map[string]any{}, nil
+			},
+		}
+
+		var mu sync.Mutex
+		var order []string
+		record := func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, args["label"].(string))
+			return map[string]any{}, nil
+		}
+		lookup := &mockTool{spec: gollem.ToolSpec{Name: "lookup"}, run: record}
+		verify := &mockTool{spec: gollem.ToolSpec{Name: "verify", Priority: 10}, run: record}
+
+		// a middleware raises the priority of a single call
+		urgent := func(next gollem.ToolHandler) gollem.ToolHandler {
+			return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+				if req.Tool.Arguments["label"] == "urgent" {
+					req.Priority = 20
+				}
+				return next(ctx, req)
+			}
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		run := func(tool gollem.Tool, label string) {
+			wg.Go(func() {
+				call := &gollem.FunctionCall{ID: label, Name: tool.Spec().Name, Arguments: map[string]any{"label": label}}
+				_, err := executeToolCall(t.Context(), tool, call, gollem.WithToolLimiter(limiter), gollem.WithToolMiddleware(urgent))
+				errs <- err
+			})
+		}
+
+		run(hold, "hold")
+		<-started
+		run(lookup, "bulk")
+		waitToolLimiter(t, limiter, 1)
+		run(verify, "verify")
+		waitToolLimiter(t, limiter, 2)
+		run(lookup, "urgent")
+		waitToolLimiter(t, limiter, 3)
+
+		close(unblock)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			gt.NoError(t, err)
+		}
+		gt.Equal(t, order, []string{"urgent", "verify", "bulk"})
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		limiter := gollem.NewToolLimiter(1)
+
+		started := make(chan struct{})
+		unblock := make(chan struct{})
+		hold := &mockTool{
+			spec: gollem.ToolSpec{Name: "hold"},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				close(started)
+				<-unblock
+				return map[string]any{}, nil
+			},
+		}
+		go func() {
+			_, _ = executeToolCall(t.Context(), hold, &gollem.FunctionCall{ID: "1", Name: "hold"}, gollem.WithToolLimiter(limiter))
+		}()
+		<-started
+		defer close(unblock)
+
+		ran := false
+		lookup := &mockTool{
+			spec: gollem.ToolSpec{Name: "lookup"},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				ran = true
+				return map[string]any{}, nil
+			},
+		}
+
+		// the call is canceled while waiting for the limiter
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		go func() {
+			waitToolLimiter(t, limiter, 1)
+			cancel()
+		}()
+		resp, _ := executeToolCall(ctx, lookup, &gollem.FunctionCall{ID: "2", Name: "lookup"}, gollem.WithToolLimiter(limiter))
+		gt.Error(t, resp.Error)
+		gt.False(t, ran)
+		gt.Equal(t, gollem.ToolLimiterWaiting(limiter), 0)
+	})
+}
@@ -0,0 +1,59 @@
+package gollem
+
+import (
+	"sync"
+)
+
+// WithParallelToolCalls runs tool calls of one LLM response concurrently, at most
+// maxConcurrency at a time, instead of one by one. Results are returned to the LLM in the order
+// of the calls with their call IDs, so the history stays valid for every provider. Calls of a
+// BatchTool coalesced into one RunBatch take one slot. Tools and tool middlewares must be safe for
+// concurrent use. A value less than 2 runs calls sequentially, which is the default.
+func WithParallelToolCalls(maxConcurrency int) Option {
+	return func(s *gollemConfig) {
+		s.parallelToolCalls = maxConcurrency
+	}
+}
+
+// toolCallPool runs tool calls of a response, concurrently if WithParallelToolCalls is set.
+type toolCallPool struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+func newToolCallPool(maxConcurrency int) *toolCallPool {
+	if maxConcurrency < 2 {
+		return &toolCallPool{}
+	}
+	return &toolCallPool{sem: make(chan struct{}, maxConcurrency)}
+}
+
+// run runs fn. Sequentially, fn runs in place and its error is returned. Concurrently, fn runs in
+// a goroutine once a slot is available and its error is returned by wait.
+func (x *toolCallPool) run(fn func() error) error {
+	if x.sem == nil {
+		return fn()
+	}
+
+	x.sem <- struct{}{}
+	x.wg.Go(func() {
+		defer func() { <-x.sem }()
+		if err := fn(); err != nil {
+			x.mu.Lock()
+			if x.err == nil {
+				x.err = err
+			}
+			x.mu.Unlock()
+		}
+	})
+	return nil
+}
+
+// wait waits for all calls and returns the first error of them.
+func (x *toolCallPool) wait() error {
+	x.wg.Wait()
+	return x.err
+}
@@ -0,0 +1,72 @@
+package gollem_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestWithParallelToolCalls(t *testing.T) {
+	calls := []*gollem.FunctionCall{
+		{ID: "call_1", Name: "lookup", Arguments: map[string]any{"n": 1}},
+		{ID: "call_2", Name: "lookup", Arguments: map[string]any{"n": 2}},
+		{ID: "call_3", Name: "lookup", Arguments: map[string]any{"n": 3}},
+		{ID: "call_4", Name: "lookup", Arguments: map[string]any{"n": 4}},
+	}
+
+	// newTool returns a tool recording the max number of concurrent runs. Later calls finish
+	// earlier, so results must be ordered by the calls and not by completion.
+	newTool := func() (*mockTool, func() int) {
+		var mu sync.Mutex
+		var running, maxRunning int
+		return &mockTool{
+			spec: gollem.ToolSpec{
+				Name:       "lookup",
+				Parameters: map[string]*gollem.Parameter{"n": {Type: gollem.TypeInteger}},
+			},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				mu.Unlock()
+
+				n := args["n"].(float64)
+				time.Sleep(time.Duration(5-n) * 10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return map[string]any{"n": n}, nil
+			},
+		}, func() int { mu.Lock(); defer mu.Unlock(); return maxRunning }
+	}
+
+	assertResults := func(t *testing.T, responses []gollem.Input) {
+		t.Helper()
+		gt.A(t, responses).Length(len(calls))
+		for i, input := range responses {
+			resp := input.(gollem.FunctionResponse)
+			gt.Equal(t, calls[i].ID, resp.ID)
+			gt.NoError(t, resp.Error)
+			gt.Equal(t, any(float64(i+1)), resp.Data["n"])
+		}
+	}
+
+	t.Run("calls run concurrently up to the limit", func(t *testing.T) {
+		tool, maxRunning := newTool()
+		responses := runToolCallsAgent(t, tool, calls, gollem.WithParallelToolCalls(2))
+		assertResults(t, responses)
+		gt.Equal(t, 2, maxRunning())
+	})
+
+	t.Run("calls run sequentially by default", func(t *testing.T) {
+		tool, maxRunning := newTool()
+		responses := runToolCallsAgent(t, tool, calls)
+		assertResults(t, responses)
+		gt.Equal(t, 1, maxRunning())
+	})
+}
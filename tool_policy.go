@@ -0,0 +1,332 @@
+package gollem
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// ToolPolicyAction is the action of a ToolPolicyDecision.
+type ToolPolicyAction string
+
+const (
+	// ToolPolicyAllow runs the call
+	ToolPolicyAllow ToolPolicyAction = "allow"
+	// ToolPolicyDeny rejects the call. The LLM gets the reason as the error of the call.
+	ToolPolicyDeny ToolPolicyAction = "deny"
+	// ToolPolicyAsk runs the call if the tool is granted or the ToolConfirmHook approves it
+	ToolPolicyAsk ToolPolicyAction = "ask"
+)
+
+// ToolPolicyDecision is the decision of a ToolPolicy on a tool call.
+type ToolPolicyDecision struct {
+	Action ToolPolicyAction
+	// Reason is why the call is denied or needs confirmation
+	Reason string
+}
+
+// AllowTool returns a decision to run the call.
+func AllowTool() ToolPolicyDecision {
+	return ToolPolicyDecision{Action: ToolPolicyAllow}
+}
+
+// DenyTool returns a decision to reject the call for reason.
+func DenyTool(reason string) ToolPolicyDecision {
+	return ToolPolicyDecision{Action: ToolPolicyDeny, Reason: reason}
+}
+
+// AskTool returns a decision to confirm the call for reason before running it.
+func AskTool(reason string) ToolPolicyDecision {
+	return ToolPolicyDecision{Action: ToolPolicyAsk, Reason: reason}
+}
+
+// ToolPolicy decides whether the LLM may call a tool. It's evaluated before each tool call of
+// the agent, including tools of ToolSets, MCP servers and subagents, with the name and arguments
+// of the call. call must not be modified.
+type ToolPolicy interface {
+	Evaluate(ctx context.Context, call *FunctionCall) (ToolPolicyDecision, error)
+}
+
+// ToolPolicyFunc is a function implementing ToolPolicy.
+type ToolPolicyFunc func(ctx context.Context, call *FunctionCall) (ToolPolicyDecision, error)
+
+// Evaluate implements ToolPolicy.
+func (f ToolPolicyFunc) Evaluate(ctx context.Context, call *FunctionCall) (ToolPolicyDecision, error) {
+	return f(ctx, call)
+}
+
+// AllowTools returns a ToolPolicy allowing only the tools matching the patterns of path.Match,
+// e.g. "github_*", and denying the others.
+func AllowTools(patterns ...string) ToolPolicy {
+	return ToolPolicyFunc(func(ctx context.Context, call *FunctionCall) (ToolPolicyDecision, error) {
+		if matchToolName(patterns, call.Name) {
+			return AllowTool(), nil
+		}
+		return DenyTool(call.Name + " is not in the allowed tools"), nil
+	})
+}
+
+// DenyTools returns a ToolPolicy denying the tools matching the patterns of path.Match and
+// allowing the others.
+func DenyTools(patterns ...string) ToolPolicy {
+	return ToolPolicyFunc(func(ctx context.Context, call *FunctionCall) (ToolPolicyDecision, error) {
+		if matchToolName(patterns, call.Name) {
+			return DenyTool(call.Name + " is denied"), nil
+		}
+		return AllowTool(), nil
+	})
+}
+
+// AskTools returns a ToolPolicy asking for confirmation of the tools matching the patterns of
+// path.Match and allowing the others.
+func AskTools(patterns ...string) ToolPolicy {
+	return ToolPolicyFunc(func(ctx context.Context, call *FunctionCall) (ToolPolicyDecision, error) {
+		if matchToolName(patterns, call.Name) {
+			return AskTool(call.Name + " requires confirmation"), nil
+		}
+		return AllowTool(), nil
+	})
+}
+
+func matchToolName(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, err := path.Match(pattern, name)
+		return err == nil && matched
+	})
+}
+
+// ToolConfirmation is the answer of a ToolConfirmHook.
+type ToolConfirmation string
+
+const (
+	// ToolConfirmOnce runs the call
+	ToolConfirmOnce ToolConfirmation = "once"
+	// ToolConfirmSession runs the call and grants the tool for the rest of the session
+	ToolConfirmSession ToolConfirmation = "session"
+	// ToolConfirmReject rejects the call
+	ToolConfirmReject ToolConfirmation = "reject"
+)
+
+// ToolConfirmHook is called for a call that a ToolPolicy asks to confirm, e.g. to ask the user.
+// It may be called concurrently with WithParallelToolCalls.
+type ToolConfirmHook func(ctx context.Context, call *FunctionCall, reason string) (ToolConfirmation, error)
+
+// ToolGrants is the set of tools granted for a session, whose calls run without confirmation
+// even if a ToolPolicy asks for it. Grants do not override denials. It is safe for concurrent
+// use.
+type ToolGrants struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// NewToolGrants creates ToolGrants granting the tools.
+func NewToolGrants(names ...string) *ToolGrants {
+	g := &ToolGrants{names: make(map[string]bool)}
+	g.Grant(names...)
+	return g
+}
+
+// Grant grants the tools.
+func (g *ToolGrants) Grant(names ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, name := range names {
+		g.names[name] = true
+	}
+}
+
+// Revoke revokes the grants of the tools.
+func (g *ToolGrants) Revoke(names ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, name := range names {
+		delete(g.names, name)
+	}
+}
+
+// Granted returns true if the tool is granted.
+func (g *ToolGrants) Granted(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.names[name]
+}
+
+// List returns the granted tools in order of name.
+func (g *ToolGrants) List() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.names))
+	for name := range g.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ToolPolicyEvent is recorded to the trace when a call is denied or confirmed.
+type ToolPolicyEvent struct {
+	Tool         string           `json:"tool"`
+	Action       ToolPolicyAction `json:"action"`
+	Reason       string           `json:"reason,omitempty"`
+	Confirmation ToolConfirmation `json:"confirmation,omitempty"`
+	Allowed      bool             `json:"allowed"`
+}
+
+// WithToolPolicy adds policies evaluated before each tool call. The most restrictive decision of
+// all policies applies: deny over ask over allow. Subagents inherit the policies in addition to
+// their own.
+func WithToolPolicy(policies ...ToolPolicy) Option {
+	return func(s *gollemConfig) {
+		s.toolPolicies = append(s.toolPolicies, policies...)
+	}
+}
+
+// WithToolConfirmHook sets the hook confirming calls that a ToolPolicy asks for. Without it, such
+// calls are denied. Subagents without their own hook inherit it.
+func WithToolConfirmHook(hook ToolConfirmHook) Option {
+	return func(s *gollemConfig) {
+		s.toolConfirmHook = hook
+	}
+}
+
+// WithToolGrants sets the grants of the agent, e.g. to restore the grants of a session. By
+// default, each agent has its own grants, and subagents share the grants of their parent.
+func WithToolGrants(grants *ToolGrants) Option {
+	return func(s *gollemConfig) {
+		s.toolGrants = grants
+	}
+}
+
+// ToolGrants returns the grants of the agent, e.g. to grant or revoke tools between Execute
+// calls.
+func (x *Agent) ToolGrants() *ToolGrants {
+	if x.toolGrants != nil {
+		return x.toolGrants
+	}
+	return x.defaultToolGrants
+}
+
+type toolPolicyCtxKey struct{}
+
+// toolPolicySet is the policies, confirmation hook and grants of an Execute.
+type toolPolicySet struct {
+	policies []ToolPolicy
+	confirm  ToolConfirmHook
+	grants   *ToolGrants
+}
+
+// resolveToolPolicy returns the policies of the config with the ones inherited from ctx, or nil
+// if there are none. Grants are the ones of the config, inherited or defaultGrants in order.
+func resolveToolPolicy(ctx context.Context, cfg *gollemConfig, defaultGrants *ToolGrants) *toolPolicySet {
+	set := &toolPolicySet{
+		policies: slices.Clone(cfg.toolPolicies),
+		confirm:  cfg.toolConfirmHook,
+		grants:   cfg.toolGrants,
+	}
+	if inherited, ok := ctx.Value(toolPolicyCtxKey{}).(*toolPolicySet); ok {
+		set.policies = append(set.policies, inherited.policies...)
+		if set.confirm == nil {
+			set.confirm = inherited.confirm
+		}
+		if set.grants == nil {
+			set.grants = inherited.grants
+		}
+	}
+	if set.grants == nil {
+		set.grants = defaultGrants
+	}
+	if len(set.policies) == 0 {
+		return nil
+	}
+	return set
+}
+
+// evaluate returns the most restrictive decision of the policies on call.
+func (s *toolPolicySet) evaluate(ctx context.Context, call *FunctionCall) (ToolPolicyDecision, error) {
+	decision := AllowTool()
+	for _, policy := range s.policies {
+		d, err := policy.Evaluate(ctx, call)
+		if err != nil {
+			return ToolPolicyDecision{}, goerr.Wrap(err, "tool policy failed", goerr.V("tool", call.Name))
+		}
+		switch d.Action {
+		case ToolPolicyDeny:
+			return d, nil
+		case ToolPolicyAsk:
+			if decision.Action == ToolPolicyAllow {
+				decision = d
+			}
+		case ToolPolicyAllow:
+		default:
+			return ToolPolicyDecision{}, goerr.New("unknown tool policy action",
+				goerr.V("tool", call.Name), goerr.V("action", d.Action))
+		}
+	}
+	return decision, nil
+}
+
+// authorize returns nil if call may run, or the error returned to the LLM. A validate-only call
+// is not confirmed because the tool does not run.
+func (s *toolPolicySet) authorize(ctx context.Context, call *FunctionCall, validateOnly bool) error {
+	decision, err := s.evaluate(ctx, call)
+	if err != nil {
+		return err
+	}
+
+	event := &ToolPolicyEvent{Tool: call.Name, Action: decision.Action, Reason: decision.Reason}
+	switch decision.Action {
+	case ToolPolicyAllow:
+		return nil
+
+	case ToolPolicyAsk:
+		if validateOnly || s.grants.Granted(call.Name) {
+			return nil
+		}
+		if s.confirm != nil {
+			confirmation, err := s.confirm(ctx, call, decision.Reason)
+			if err != nil {
+				return goerr.Wrap(err, "tool confirm hook failed", goerr.V("tool", call.Name))
+			}
+			event.Confirmation = confirmation
+			switch confirmation {
+			case ToolConfirmSession:
+				s.grants.Grant(call.Name)
+				event.Allowed = true
+			case ToolConfirmOnce:
+				event.Allowed = true
+			}
+		}
+	}
+
+	if h := trace.HandlerFrom(ctx); h != nil {
+		h.AddEvent(ctx, "tool_policy", event)
+	}
+	if event.Allowed {
+		return nil
+	}
+
+	reason := decision.Reason
+	switch {
+	case decision.Action == ToolPolicyAsk && s.confirm == nil:
+		reason += ", but no confirmation is available"
+	case decision.Action == ToolPolicyAsk:
+		reason += ", and it was rejected"
+	}
+	return goerr.Wrap(ErrToolDenied, fmt.Sprintf("tool call denied: %s", reason), goerr.V("tool", call.Name))
+}
+
+// middleware authorizes each call before the other tool middlewares and the tool.
+func (s *toolPolicySet) middleware(next ToolHandler) ToolHandler {
+	return func(ctx context.Context, req *ToolExecRequest) (*ToolExecResponse, error) {
+		if err := s.authorize(ctx, req.Tool, req.ValidateOnly); err != nil {
+			return &ToolExecResponse{Error: err}, nil
+		}
+		return next(ctx, req)
+	}
+}
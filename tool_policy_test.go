@@ -0,0 +1,202 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestToolPolicy(t *testing.T) {
+	var runs []string
+	newTool := func(name string) gollem.Tool {
+		return &mockTool{
+			spec: gollem.ToolSpec{Name: name, Description: "Test tool"},
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				runs = append(runs, name)
+				return map[string]any{"ok": true}, nil
+			},
+		}
+	}
+	callOf := func(name string) *gollem.Response {
+		return &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+			{ID: "call_" + name, Name: name, Arguments: map[string]any{}},
+		}}
+	}
+	// toolResult returns the result of the tool call given to the LLM
+	toolResult := func(inputs [][]gollem.Input) gollem.FunctionResponse {
+		return inputs[1][0].(gollem.FunctionResponse)
+	}
+
+	testCases := map[string]struct {
+		policies []gollem.ToolPolicy
+		call     string
+		allowed  bool
+	}{
+		"denied by deny list": {
+			policies: []gollem.ToolPolicy{gollem.DenyTools("delete_*")},
+			call:     "delete_file",
+		},
+		"allowed by deny list": {
+			policies: []gollem.ToolPolicy{gollem.DenyTools("delete_*")},
+			call:     "read_file",
+			allowed:  true,
+		},
+		"allowed by allow list": {
+			policies: []gollem.ToolPolicy{gollem.AllowTools("read_*")},
+			call:     "read_file",
+			allowed:  true,
+		},
+		"not in allow list": {
+			policies: []gollem.ToolPolicy{gollem.AllowTools("read_*")},
+			call:     "delete_file",
+		},
+		"ask without confirm hook": {
+			policies: []gollem.ToolPolicy{gollem.AskTools("delete_file")},
+			call:     "delete_file",
+		},
+		"most restrictive decision applies": {
+			policies: []gollem.ToolPolicy{gollem.AllowTools("*"), gollem.DenyTools("delete_file")},
+			call:     "delete_file",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			runs = nil
+			var inputs [][]gollem.Input
+			agent := gollem.New(newScriptedClient(&inputs, callOf(tc.call)),
+				gollem.WithTools(newTool("read_file"), newTool("delete_file")),
+				gollem.WithToolPolicy(tc.policies...),
+			)
+			_, err := agent.Execute(t.Context(), gollem.Text("do it"))
+			gt.NoError(t, err)
+
+			if tc.allowed {
+				gt.Equal(t, []string{tc.call}, runs)
+				gt.NoError(t, toolResult(inputs).Error)
+			} else {
+				gt.A(t, runs).Length(0)
+				gt.Error(t, toolResult(inputs).Error).Is(gollem.ErrToolDenied)
+			}
+		})
+	}
+
+	t.Run("confirmation grants the tool for the session", func(t *testing.T) {
+		runs = nil
+		var inputs [][]gollem.Input
+		var confirms []string
+		agent := gollem.New(newScriptedClient(&inputs, callOf("delete_file"), &gollem.Response{Texts: []string{"deleted"}}, callOf("delete_file")),
+			gollem.WithTools(newTool("delete_file")),
+			gollem.WithToolPolicy(gollem.AskTools("delete_*")),
+			gollem.WithToolConfirmHook(func(ctx context.Context, call *gollem.FunctionCall, reason string) (gollem.ToolConfirmation, error) {
+				confirms = append(confirms, reason)
+				return gollem.ToolConfirmSession, nil
+			}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("delete a"))
+		gt.NoError(t, err)
+		_, err = agent.Execute(t.Context(), gollem.Text("delete b"))
+		gt.NoError(t, err)
+
+		gt.Equal(t, []string{"delete_file", "delete_file"}, runs)
+		gt.Equal(t, []string{"delete_file requires confirmation"}, confirms)
+		gt.Equal(t, []string{"delete_file"}, agent.ToolGrants().List())
+	})
+
+	t.Run("rejected confirmation", func(t *testing.T) {
+		runs = nil
+		var inputs [][]gollem.Input
+		agent := gollem.New(newScriptedClient(&inputs, callOf("delete_file")),
+			gollem.WithTools(newTool("delete_file")),
+			gollem.WithToolPolicy(gollem.AskTools("delete_*")),
+			gollem.WithToolConfirmHook(func(ctx context.Context, call *gollem.FunctionCall, reason string) (gollem.ToolConfirmation, error) {
+				return gollem.ToolConfirmReject, nil
+			}),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("delete a"))
+		gt.NoError(t, err)
+		gt.A(t, runs).Length(0)
+		gt.Error(t, toolResult(inputs).Error).Is(gollem.ErrToolDenied)
+		gt.A(t, agent.ToolGrants().List()).Length(0)
+	})
+
+	t.Run("grants do not override denials", func(t *testing.T) {
+		runs = nil
+		var inputs [][]gollem.Input
+		agent := gollem.New(newScriptedClient(&inputs, callOf("delete_file")),
+			gollem.WithTools(newTool("delete_file")),
+			gollem.WithToolPolicy(gollem.DenyTools("delete_file")),
+			gollem.WithToolGrants(gollem.NewToolGrants("delete_file")),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("delete a"))
+		gt.NoError(t, err)
+		gt.A(t, runs).Length(0)
+	})
+
+	t.Run("tools of tool sets", func(t *testing.T) {
+		var inputs [][]gollem.Input
+		var setRuns []string
+		toolSet := &mockToolSet{
+			specs: []gollem.ToolSpec{{Name: "mcp_delete", Description: "Delete"}},
+			run: func(ctx context.Context, name string, args map[string]any) (map[string]any, error) {
+				setRuns = append(setRuns, name)
+				return map[string]any{}, nil
+			},
+		}
+		agent := gollem.New(newScriptedClient(&inputs, callOf("mcp_delete")),
+			gollem.WithToolSets(toolSet),
+			gollem.WithToolPolicy(gollem.DenyTools("mcp_*")),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("delete"))
+		gt.NoError(t, err)
+		gt.A(t, setRuns).Length(0)
+		gt.Error(t, toolResult(inputs).Error).Is(gollem.ErrToolDenied)
+	})
+
+	t.Run("subagents inherit policies and grants", func(t *testing.T) {
+		runs = nil
+		var childInputs [][]gollem.Input
+		child := gollem.NewSubAgent("cleaner", "Clean up files", func() (*gollem.Agent, error) {
+			return gollem.New(newScriptedClient(&childInputs, callOf("delete_file")),
+				gollem.WithTools(newTool("delete_file")),
+			), nil
+		})
+
+		var parentInputs [][]gollem.Input
+		parent := gollem.New(newScriptedClient(&parentInputs, &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+			{ID: "call_1", Name: "cleaner", Arguments: map[string]any{"query": "clean"}},
+		}}),
+			gollem.WithSubAgents(child),
+			gollem.WithToolPolicy(gollem.AskTools("delete_file")),
+			gollem.WithToolConfirmHook(func(ctx context.Context, call *gollem.FunctionCall, reason string) (gollem.ToolConfirmation, error) {
+				return gollem.ToolConfirmSession, nil
+			}),
+		)
+		_, err := parent.Execute(t.Context(), gollem.Text("clean up"))
+		gt.NoError(t, err)
+
+		gt.Equal(t, []string{"delete_file"}, runs)
+		// The grant in the subagent is kept in the session of the parent
+		gt.Equal(t, []string{"delete_file"}, parent.ToolGrants().List())
+	})
+
+	t.Run("subagents are tools for policies", func(t *testing.T) {
+		var childInputs [][]gollem.Input
+		child := gollem.NewSubAgent("cleaner", "Clean up files", func() (*gollem.Agent, error) {
+			return gollem.New(newScriptedClient(&childInputs)), nil
+		})
+
+		var parentInputs [][]gollem.Input
+		parent := gollem.New(newScriptedClient(&parentInputs, &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+			{ID: "call_1", Name: "cleaner", Arguments: map[string]any{"query": "clean"}},
+		}}),
+			gollem.WithSubAgents(child),
+			gollem.WithToolPolicy(gollem.DenyTools("cleaner")),
+		)
+		_, err := parent.Execute(t.Context(), gollem.Text("clean up"))
+		gt.NoError(t, err)
+		gt.A(t, childInputs).Length(0)
+		gt.Error(t, toolResult(parentInputs).Error).Is(gollem.ErrToolDenied)
+	})
+}
@@ -0,0 +1,251 @@
+package gollem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// ToolResultEncoding is the representation of tool results sent to the LLM.
+type ToolResultEncoding string
+
+const (
+	// ToolResultEncodingJSON sends tool results as JSON. It's the default.
+	ToolResultEncodingJSON ToolResultEncoding = "json"
+
+	// ToolResultEncodingCompactJSON sends tool results as JSON without null values, empty
+	// objects and empty arrays, and without escaping HTML characters such as "<" and "&".
+	ToolResultEncodingCompactJSON ToolResultEncoding = "compact_json"
+
+	// ToolResultEncodingYAML sends tool results as YAML, which has no braces and quotes for
+	// most keys and strings. It saves tokens especially for nested objects and arrays of
+	// objects.
+	ToolResultEncodingYAML ToolResultEncoding = "yaml"
+)
+
+// WithToolResultEncoding sets the representation of tool results sent to the LLM. The results
+// passed to tool middlewares, hooks and traces are not changed. Providers taking tool results as
+// structured data (Gemini) use the trimmed data for ToolResultEncodingCompactJSON and the YAML
+// text in the "output" field for ToolResultEncodingYAML.
+func WithToolResultEncoding(encoding ToolResultEncoding) Option {
+	return func(s *gollemConfig) {
+		s.toolResultEncoding = encoding
+	}
+}
+
+// EncodeToolResult encodes data by encoding. Empty encoding means ToolResultEncodingJSON.
+// Keys of objects are sorted in all encodings.
+func EncodeToolResult(data map[string]any, encoding ToolResultEncoding) (string, error) {
+	switch encoding {
+	case "", ToolResultEncodingJSON:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return "", goerr.Wrap(err, "failed to marshal tool result")
+		}
+		return string(raw), nil
+
+	case ToolResultEncodingCompactJSON:
+		normalized, err := copyToolResult(data)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(TrimToolResult(normalized)); err != nil {
+			return "", goerr.Wrap(err, "failed to marshal tool result")
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	case ToolResultEncodingYAML:
+		normalized, err := copyToolResult(data)
+		if err != nil {
+			return "", err
+		}
+		if len(normalized) == 0 {
+			return "{}", nil
+		}
+		var b strings.Builder
+		writeYAML(&b, normalized, 0, false)
+		return strings.TrimSuffix(b.String(), "\n"), nil
+
+	default:
+		return "", goerr.Wrap(ErrInvalidParameter, "unknown tool result encoding", goerr.V("encoding", encoding))
+	}
+}
+
+// logToolResultEncoding logs the estimated tokens of result in JSON and encoding, to measure
+// the savings by the encoding.
+func logToolResultEncoding(ctx context.Context, logger *slog.Logger, result map[string]any, encoding ToolResultEncoding) {
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	jsonText, err := EncodeToolResult(result, ToolResultEncodingJSON)
+	if err != nil {
+		return
+	}
+	encoded, err := EncodeToolResult(result, encoding)
+	if err != nil {
+		logger.Warn("gollem failed to encode tool result", "encoding", encoding, "error", err)
+		return
+	}
+	logger.Debug("gollem tool result encoded",
+		"encoding", encoding,
+		"json_tokens", EstimateTokens(jsonText),
+		"encoded_tokens", EstimateTokens(encoded),
+	)
+}
+
+// TrimToolResult returns a copy of data without null values, empty objects and empty arrays in
+// objects, which are removed recursively. Elements of arrays are kept so that their positions
+// are not shifted. data must consist of JSON-compatible values.
+func TrimToolResult(data map[string]any) map[string]any {
+	trimmed, _ := trimToolResultValue(data)
+	m, _ := trimmed.(map[string]any)
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
+
+// trimToolResultValue returns the trimmed v and false if v should be removed.
+func trimToolResultValue(v any) (any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			if trimmed, ok := trimToolResultValue(child); ok {
+				m[k] = trimmed
+			}
+		}
+		return m, len(m) > 0
+	case []any:
+		a := make([]any, len(v))
+		for i, child := range v {
+			trimmed, _ := trimToolResultValue(child)
+			a[i] = trimmed
+		}
+		return a, len(a) > 0
+	default:
+		return v, true
+	}
+}
+
+// writeYAML writes a non-empty object or array v in YAML block style at indent. If inline is
+// true, the first line is written at the current position, i.e. after "- ".
+func writeYAML(b *strings.Builder, v any, indent int, inline bool) {
+	pad := func() {
+		if inline {
+			inline = false
+			return
+		}
+		b.WriteString(strings.Repeat(" ", indent))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			pad()
+			b.WriteString(yamlScalar(k))
+			b.WriteByte(':')
+			switch child := v[k].(type) {
+			case map[string]any:
+				if len(child) > 0 {
+					b.WriteByte('\n')
+					writeYAML(b, child, indent+2, false)
+					continue
+				}
+			case []any:
+				// Items of an array in an object may be at the same indent as the key
+				if len(child) > 0 {
+					b.WriteByte('\n')
+					writeYAML(b, child, indent, false)
+					continue
+				}
+			}
+			b.WriteByte(' ')
+			b.WriteString(yamlScalar(v[k]))
+			b.WriteByte('\n')
+		}
+
+	case []any:
+		for _, item := range v {
+			pad()
+			b.WriteString("- ")
+			if isNonEmptyYAMLCollection(item) {
+				writeYAML(b, item, indent+2, true)
+				continue
+			}
+			b.WriteString(yamlScalar(item))
+			b.WriteByte('\n')
+		}
+	}
+}
+
+func isNonEmptyYAMLCollection(v any) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		return len(v) > 0
+	case []any:
+		return len(v) > 0
+	}
+	return false
+}
+
+// yamlReservedWords are plain scalars that YAML parsers may read as other than strings.
+var yamlReservedWords = []string{"true", "false", "yes", "no", "on", "off", "y", "n", "null", "~"}
+
+// yamlScalar returns v as a YAML scalar. Strings are written as plain scalars if they can't be
+// read as another type or structure, and as JSON strings, which are valid YAML, otherwise.
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		return "{}"
+	case []any:
+		return "[]"
+	case string:
+		if isPlainYAMLString(v) {
+			return v
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(v)
+		return strings.TrimSuffix(buf.String(), "\n")
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+}
+
+func isPlainYAMLString(s string) bool {
+	if s == "" || slices.Contains(yamlReservedWords, strings.ToLower(s)) {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i == 0:
+			// Digits and symbols at the beginning may be read as numbers, dates or indicators
+			return false
+		case unicode.IsDigit(r) || strings.ContainsRune(" .,-/()@+", r):
+		case r == ':':
+			// ": " and a trailing ":" start a mapping value, while URLs like "https://" are plain
+			if i == len(s)-1 || s[i+1] == ' ' {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return !strings.HasSuffix(s, " ")
+}
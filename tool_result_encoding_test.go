@@ -0,0 +1,121 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func TestEncodeToolResult(t *testing.T) {
+	data := map[string]any{
+		"query": "golang",
+		"total": 2,
+		"next":  nil,
+		"items": []any{
+			map[string]any{"title": "The Go Programming Language", "url": "https://go.dev", "tags": []any{}},
+			map[string]any{"title": "Effective Go", "url": "https://go.dev/doc/effective_go", "tags": []any{"doc", "true"}},
+		},
+		"meta": map[string]any{"took_ms": 12.5, "cached": false, "note": "a <b> & c", "label": "key: value"},
+	}
+
+	testCases := map[string]struct {
+		encoding gollem.ToolResultEncoding
+		expected string
+	}{
+		"json": {
+			encoding: gollem.ToolResultEncodingJSON,
+			expected: `{"items":[{"tags":[],"title":"The Go Programming Language","url":"https://go.dev"},{"tags":["doc","true"],"title":"Effective Go","url":"https://go.dev/doc/effective_go"}],"meta":{"cached":false,"label":"key: value","note":"a \u003cb\u003e \u0026 c","took_ms":12.5},"next":null,"query":"golang","total":2}`,
+		},
+		"compact json": {
+			encoding: gollem.ToolResultEncodingCompactJSON,
+			expected: `{"items":[{"title":"The Go Programming Language","url":"https://go.dev"},{"tags":["doc","true"],"title":"Effective Go","url":"https://go.dev/doc/effective_go"}],"meta":{"cached":false,"label":"key: value","note":"a <b> & c","took_ms":12.5},"query":"golang","total":2}`,
+		},
+		"yaml": {
+			encoding: gollem.ToolResultEncodingYAML,
+			expected: `items:
+- tags: []
+  title: The Go Programming Language
+  url: https://go.dev
+- tags:
+  - doc
+  - "true"
+  title: Effective Go
+  url: https://go.dev/doc/effective_go
+meta:
+  cached: false
+  label: "key: value"
+  note: "a <b> & c"
+  took_ms: 12.5
+next: null
+query: golang
+total: 2`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := gollem.EncodeToolResult(data, tc.encoding)
+			gt.NoError(t, err)
+			gt.Equal(t, tc.expected, encoded)
+		})
+	}
+
+	t.Run("encodings save tokens", func(t *testing.T) {
+		jsonText, err := gollem.EncodeToolResult(data, gollem.ToolResultEncodingJSON)
+		gt.NoError(t, err)
+		for _, encoding := range []gollem.ToolResultEncoding{gollem.ToolResultEncodingCompactJSON, gollem.ToolResultEncodingYAML} {
+			encoded, err := gollem.EncodeToolResult(data, encoding)
+			gt.NoError(t, err)
+			gt.N(t, gollem.EstimateTokens(encoded)).Less(gollem.EstimateTokens(jsonText))
+		}
+	})
+
+	t.Run("nested arrays and empty result", func(t *testing.T) {
+		encoded, err := gollem.EncodeToolResult(map[string]any{"m": []any{[]any{1, 2}, []any{}, map[string]any{}}}, gollem.ToolResultEncodingYAML)
+		gt.NoError(t, err)
+		gt.Equal(t, "m:\n- - 1\n  - 2\n- []\n- {}", encoded)
+
+		encoded, err = gollem.EncodeToolResult(nil, gollem.ToolResultEncodingYAML)
+		gt.NoError(t, err)
+		gt.Equal(t, "{}", encoded)
+	})
+
+	t.Run("unknown encoding", func(t *testing.T) {
+		_, err := gollem.EncodeToolResult(data, "xml")
+		gt.Error(t, err).Is(gollem.ErrInvalidParameter)
+	})
+}
+
+func TestWithToolResultEncoding(t *testing.T) {
+	var middlewareResult map[string]any
+	tool := &mockTool{
+		spec: gollem.ToolSpec{Name: "lookup"},
+		run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			return map[string]any{"name": "alice", "email": nil}, nil
+		},
+	}
+	mw := func(next gollem.ToolHandler) gollem.ToolHandler {
+		return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+			resp, err := next(ctx, req)
+			middlewareResult = resp.Result
+			return resp, err
+		}
+	}
+
+	responses := runToolCallsAgent(t, tool, []*gollem.FunctionCall{
+		{ID: "1", Name: "lookup", Arguments: map[string]any{}},
+	}, gollem.WithToolResultEncoding(gollem.ToolResultEncodingCompactJSON), gollem.WithToolMiddleware(mw))
+
+	gt.A(t, responses).Length(1)
+	resp := responses[0].(gollem.FunctionResponse)
+	gt.Equal(t, gollem.ToolResultEncodingCompactJSON, resp.Encoding)
+
+	// Data and the result for middlewares are not trimmed, only the encoded data is
+	gt.Equal(t, map[string]any{"name": "alice", "email": nil}, resp.Data)
+	gt.Equal(t, map[string]any{"name": "alice", "email": nil}, middlewareResult)
+	encoded, err := resp.EncodeData()
+	gt.NoError(t, err)
+	gt.Equal(t, `{"name":"alice"}`, encoded)
+}
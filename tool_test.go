@@ -1,10 +1,14 @@
 package gollem_test
 
 import (
+	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
 	"github.com/m-mizutani/gt"
 )
 
@@ -225,6 +229,149 @@ func TestToolSpecValidation(t *testing.T) {
 		}
 		gt.Error(t, spec.Validate())
 	})
+
+	t.Run("negative execution hints", func(t *testing.T) {
+		gt.Error(t, (&gollem.ToolSpec{Name: "test", Timeout: -time.Second}).Validate())
+		gt.Error(t, (&gollem.ToolSpec{Name: "test", MaxRetries: -1}).Validate())
+		gt.Error(t, (&gollem.ToolSpec{Name: "test", RetryDelay: -time.Second}).Validate())
+		gt.NoError(t, (&gollem.ToolSpec{Name: "test", Timeout: time.Second, MaxRetries: 2, Idempotent: true}).Validate())
+	})
+}
+
+func TestToolSpecExecutionHints(t *testing.T) {
+	newTool := func(spec gollem.ToolSpec, run func(ctx context.Context, attempt int) (map[string]any, error)) (*mockTool, *atomic.Int32) {
+		var attempts atomic.Int32
+		return &mockTool{
+			spec: spec,
+			run: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+				return run(ctx, int(attempts.Add(1)))
+			},
+		}, &attempts
+	}
+	call := []*gollem.FunctionCall{{ID: "1", Name: "flaky", Arguments: map[string]any{}}}
+	failTwice := func(ctx context.Context, attempt int) (map[string]any, error) {
+		if attempt <= 2 {
+			return nil, errors.New("temporary failure")
+		}
+		return map[string]any{"ok": true}, nil
+	}
+
+	t.Run("idempotent tool is retried", func(t *testing.T) {
+		tool, attempts := newTool(gollem.ToolSpec{Name: "flaky", MaxRetries: 2, Idempotent: true, RetryDelay: time.Millisecond}, failTwice)
+		responses := runToolCallsAgent(t, tool, call)
+		gt.Equal(t, int32(3), attempts.Load())
+		gt.NoError(t, responses[0].(gollem.FunctionResponse).Error)
+	})
+
+	t.Run("retries are exhausted", func(t *testing.T) {
+		tool, attempts := newTool(gollem.ToolSpec{Name: "flaky", MaxRetries: 1, Idempotent: true, RetryDelay: time.Millisecond}, failTwice)
+		responses := runToolCallsAgent(t, tool, call)
+		gt.Equal(t, int32(2), attempts.Load())
+		gt.Error(t, responses[0].(gollem.FunctionResponse).Error)
+	})
+
+	t.Run("retries wait for the delay", func(t *testing.T) {
+		var times []time.Time
+		tool, _ := newTool(gollem.ToolSpec{Name: "flaky", MaxRetries: 2, Idempotent: true, RetryDelay: 20 * time.Millisecond}, func(ctx context.Context, attempt int) (map[string]any, error) {
+			times = append(times, time.Now())
+			return failTwice(ctx, attempt)
+		})
+		responses := runToolCallsAgent(t, tool, call)
+		gt.NoError(t, responses[0].(gollem.FunctionResponse).Error)
+		gt.A(t, times).Length(3)
+		// 20ms and 40ms, up to 20% shorter by jitter
+		gt.True(t, times[1].Sub(times[0]) >= 16*time.Millisecond)
+		gt.True(t, times[2].Sub(times[1]) >= 32*time.Millisecond)
+	})
+
+	t.Run("retry is canceled by ctx", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tool, attempts := newTool(gollem.ToolSpec{Name: "flaky", MaxRetries: 2, Idempotent: true, RetryDelay: time.Hour}, func(ctx context.Context, attempt int) (map[string]any, error) {
+			// canceled while waiting for the retry
+			time.AfterFunc(10*time.Millisecond, cancel)
+			return nil, errors.New("temporary failure")
+		})
+		var toolErr error
+		client := &mock.LLMClientMock{
+			NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+				return &mock.SessionMock{
+					GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+						if resp, ok := input[0].(gollem.FunctionResponse); ok {
+							toolErr = resp.Error
+							return &gollem.Response{Texts: []string{"done"}}, nil
+						}
+						return &gollem.Response{FunctionCalls: call}, nil
+					},
+				}, nil
+			},
+		}
+		_, _ = gollem.New(client, gollem.WithTools(tool)).Execute(ctx, gollem.Text("run"))
+		gt.Error(t, toolErr).Is(context.Canceled)
+		gt.Equal(t, int32(1), attempts.Load())
+	})
+
+	t.Run("non-idempotent tool is not retried", func(t *testing.T) {
+		tool, attempts := newTool(gollem.ToolSpec{Name: "flaky", MaxRetries: 2}, failTwice)
+		responses := runToolCallsAgent(t, tool, call)
+		gt.Equal(t, int32(1), attempts.Load())
+		gt.Error(t, responses[0].(gollem.FunctionResponse).Error)
+	})
+
+	t.Run("timeout cancels the execution", func(t *testing.T) {
+		tool, _ := newTool(gollem.ToolSpec{Name: "flaky", Timeout: 10 * time.Millisecond}, func(ctx context.Context, attempt int) (map[string]any, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		responses := runToolCallsAgent(t, tool, call)
+		gt.True(t, errors.Is(responses[0].(gollem.FunctionResponse).Error, gollem.ErrToolTimeout))
+	})
+
+	t.Run("timeout does not wait for a tool ignoring ctx", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		tool, _ := newTool(gollem.ToolSpec{Name: "flaky", Timeout: 10 * time.Millisecond}, func(ctx context.Context, attempt int) (map[string]any, error) {
+			<-release
+			return map[string]any{"ok": true}, nil
+		})
+		responses := runToolCallsAgent(t, tool, call)
+		gt.True(t, errors.Is(responses[0].(gollem.FunctionResponse).Error, gollem.ErrToolTimeout))
+	})
+
+	t.Run("timed out idempotent tool is retried", func(t *testing.T) {
+		tool, attempts := newTool(gollem.ToolSpec{Name: "flaky", Timeout: 10 * time.Millisecond, MaxRetries: 1, Idempotent: true, RetryDelay: time.Millisecond}, func(ctx context.Context, attempt int) (map[string]any, error) {
+			if attempt == 1 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return map[string]any{"ok": true}, nil
+		})
+		responses := runToolCallsAgent(t, tool, call)
+		gt.Equal(t, int32(2), attempts.Load())
+		gt.Equal(t, true, responses[0].(gollem.FunctionResponse).Data["ok"])
+	})
+
+	waitCtx := func(ctx context.Context, attempt int) (map[string]any, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+			return map[string]any{"ok": true}, nil
+		}
+	}
+
+	t.Run("default timeout of WithToolTimeout", func(t *testing.T) {
+		tool, _ := newTool(gollem.ToolSpec{Name: "flaky"}, waitCtx)
+		responses := runToolCallsAgent(t, tool, call, gollem.WithToolTimeout(10*time.Millisecond))
+		gt.True(t, errors.Is(responses[0].(gollem.FunctionResponse).Error, gollem.ErrToolTimeout))
+	})
+
+	t.Run("timeout of ToolSpec overrides WithToolTimeout", func(t *testing.T) {
+		tool, _ := newTool(gollem.ToolSpec{Name: "flaky", Timeout: 5 * time.Second}, waitCtx)
+		responses := runToolCallsAgent(t, tool, call, gollem.WithToolTimeout(10*time.Millisecond))
+		gt.NoError(t, responses[0].(gollem.FunctionResponse).Error)
+		gt.Equal(t, true, responses[0].(gollem.FunctionResponse).Data["ok"])
+	})
 }
 
 func TestToolSpecValidateArgs(t *testing.T) {
@@ -0,0 +1,98 @@
+package gollem
+
+import (
+	"context"
+
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// ToolSetHealth is the health of the backend of a ToolSet, e.g. an MCP server.
+type ToolSetHealth struct {
+	// Healthy is false if calls of the tools are likely to fail
+	Healthy bool
+	// Reason tells why the backend is unhealthy, e.g. "disconnected"
+	Reason string
+}
+
+// ToolSetHealthReporter is an optional interface of ToolSet reporting the health of its
+// backend, e.g. mcp.Client. It must return without calling the backend, as it's called for
+// every Execute.
+type ToolSetHealthReporter interface {
+	ToolSetHealth() ToolSetHealth
+}
+
+// UnhealthyToolSetAction is how the agent treats tools of an unhealthy ToolSet.
+type UnhealthyToolSetAction int
+
+const (
+	// UnhealthyToolSetKeep declares the tools as they are. It's the default.
+	UnhealthyToolSetKeep UnhealthyToolSetAction = iota
+	// UnhealthyToolSetDeprioritize declares the tools with a note in their description telling
+	// the LLM to prefer other tools.
+	UnhealthyToolSetDeprioritize
+	// UnhealthyToolSetHide does not declare the tools, and does not request their specs from
+	// the backend. Calls of the tools fail as calls of unknown tools.
+	UnhealthyToolSetHide
+)
+
+// UnhealthyToolSetEvent is recorded to the trace as an "unhealthy_tool_set" event when tools of
+// an unhealthy ToolSet are deprioritized or hidden.
+type UnhealthyToolSetEvent struct {
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	// Tools are the names of the deprioritized tools. They are empty for hidden tools, as their
+	// specs are not requested.
+	Tools []string `json:"tools,omitempty"`
+}
+
+// WithUnhealthyToolSets sets how tools of ToolSets implementing ToolSetHealthReporter are
+// treated while the backend is unhealthy, e.g. an MCP server that is disconnected or failing.
+// The health is checked when the tools are set up for each Execute.
+func WithUnhealthyToolSets(action UnhealthyToolSetAction) Option {
+	return func(s *gollemConfig) {
+		s.unhealthyToolSets = action
+	}
+}
+
+// unhealthyToolNote is added to the description of tools of an unhealthy ToolSet.
+const unhealthyToolNote = "[Unavailable: the server of this tool is unhealthy and calls are likely to fail. Prefer other tools if possible.]"
+
+// toolSetHealthOf returns the health of toolSet, or nil if it does not report its health or
+// action ignores it.
+func toolSetHealthOf(toolSet ToolSet, action UnhealthyToolSetAction) *ToolSetHealth {
+	if action == UnhealthyToolSetKeep {
+		return nil
+	}
+	reporter, ok := toolSet.(ToolSetHealthReporter)
+	if !ok {
+		return nil
+	}
+	health := reporter.ToolSetHealth()
+	if health.Healthy {
+		return nil
+	}
+	return &health
+}
+
+// deprioritizeSpec returns spec of a tool of an unhealthy ToolSet.
+func deprioritizeSpec(spec ToolSpec) ToolSpec {
+	if spec.Description == "" {
+		spec.Description = unhealthyToolNote
+	} else {
+		spec.Description = unhealthyToolNote + "\n\n" + spec.Description
+	}
+	return spec
+}
+
+// recordUnhealthyToolSet records the tools of an unhealthy ToolSet to the trace.
+func recordUnhealthyToolSet(ctx context.Context, action UnhealthyToolSetAction, health *ToolSetHealth, tools []string) {
+	h := trace.HandlerFrom(ctx)
+	if h == nil {
+		return
+	}
+	name := "deprioritize"
+	if action == UnhealthyToolSetHide {
+		name = "hide"
+	}
+	h.AddEvent(ctx, "unhealthy_tool_set", &UnhealthyToolSetEvent{Action: name, Reason: health.Reason, Tools: tools})
+}
@@ -0,0 +1,104 @@
+package gollem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+// healthToolSet is a ToolSet reporting its health
+type healthToolSet struct {
+	mockToolSet
+	health gollem.ToolSetHealth
+	specs  int
+}
+
+func (x *healthToolSet) Specs(ctx context.Context) ([]gollem.ToolSpec, error) {
+	x.specs++
+	return x.mockToolSet.Specs(ctx)
+}
+
+func (x *healthToolSet) ToolSetHealth() gollem.ToolSetHealth {
+	return x.health
+}
+
+func TestUnhealthyToolSets(t *testing.T) {
+	newToolSet := func(health gollem.ToolSetHealth) *healthToolSet {
+		return &healthToolSet{
+			mockToolSet: mockToolSet{specs: []gollem.ToolSpec{{Name: "search", Description: "Search documents"}}},
+			health:      health,
+		}
+	}
+	unhealthy := gollem.ToolSetHealth{Reason: "disconnected"}
+
+	testCases := map[string]struct {
+		health        gollem.ToolSetHealth
+		action        gollem.UnhealthyToolSetAction
+		tools         int
+		specCalls     int
+		deprioritized bool
+	}{
+		"healthy": {
+			health:    gollem.ToolSetHealth{Healthy: true},
+			action:    gollem.UnhealthyToolSetHide,
+			tools:     1,
+			specCalls: 1,
+		},
+		"kept by default": {
+			health:    unhealthy,
+			action:    gollem.UnhealthyToolSetKeep,
+			tools:     1,
+			specCalls: 1,
+		},
+		"deprioritized": {
+			health:        unhealthy,
+			action:        gollem.UnhealthyToolSetDeprioritize,
+			tools:         1,
+			specCalls:     1,
+			deprioritized: true,
+		},
+		"hidden": {
+			health: unhealthy,
+			action: gollem.UnhealthyToolSetHide,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			toolSet := newToolSet(tc.health)
+			agent := gollem.New(newScriptedClient(&[][]gollem.Input{}),
+				gollem.WithToolSets(toolSet),
+				gollem.WithUnhealthyToolSets(tc.action),
+			)
+			desc, err := agent.Describe(t.Context())
+			gt.NoError(t, err)
+			gt.A(t, desc.Tools).Length(tc.tools)
+			gt.Equal(t, tc.specCalls, toolSet.specs)
+			if tc.tools > 0 {
+				gt.Equal(t, tc.deprioritized, strings.HasPrefix(desc.Tools[0].Description, "[Unavailable:"))
+				gt.S(t, desc.Tools[0].Description).Contains("Search documents")
+			}
+		})
+	}
+
+	t.Run("deprioritized tool runs", func(t *testing.T) {
+		var ran []string
+		toolSet := newToolSet(unhealthy)
+		toolSet.run = func(ctx context.Context, name string, args map[string]any) (map[string]any, error) {
+			ran = append(ran, name)
+			return map[string]any{}, nil
+		}
+		var inputs [][]gollem.Input
+		agent := gollem.New(newScriptedClient(&inputs, &gollem.Response{FunctionCalls: []*gollem.FunctionCall{
+			{ID: "call_1", Name: "search", Arguments: map[string]any{}},
+		}}),
+			gollem.WithToolSets(toolSet),
+			gollem.WithUnhealthyToolSets(gollem.UnhealthyToolSetDeprioritize),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("search it"))
+		gt.NoError(t, err)
+		gt.Equal(t, []string{"search"}, ran)
+	})
+}
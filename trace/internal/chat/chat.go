@@ -0,0 +1,145 @@
+// Package chat converts the LLM requests and responses of traces into the chat message format
+// of OpenAI, which LLM observability services such as Langfuse and LangSmith render as
+// conversations.
+package chat
+
+import (
+	"encoding/json"
+
+	"github.com/m-mizutani/gollem/trace"
+)
+
+// Message is a chat message in the OpenAI format.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    any        `json:"content,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a tool call of an assistant message.
+type ToolCall struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+// Function is the function of a ToolCall. Arguments is a JSON string.
+type Function struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Part is a content part of a message that has other contents than text.
+type Part struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// Input converts req into messages, with the system prompt as the first message. It returns
+// nil if req is nil.
+func Input(req *trace.LLMRequest) []Message {
+	if req == nil {
+		return nil
+	}
+
+	var messages []Message
+	if req.SystemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: req.SystemPrompt})
+	}
+	for _, msg := range req.Messages {
+		messages = append(messages, convert(msg)...)
+	}
+	return messages
+}
+
+// Output converts resp into an assistant message. It returns nil if resp is nil.
+func Output(resp *trace.LLMResponse) *Message {
+	if resp == nil {
+		return nil
+	}
+
+	msg := &Message{Role: "assistant"}
+	switch len(resp.Texts) {
+	case 0:
+	case 1:
+		msg.Content = resp.Texts[0]
+	default:
+		parts := make([]Part, len(resp.Texts))
+		for i, text := range resp.Texts {
+			parts[i] = Part{Type: "text", Text: text}
+		}
+		msg.Content = parts
+	}
+	for _, call := range resp.FunctionCalls {
+		msg.ToolCalls = append(msg.ToolCalls, toolCall(call.ID, call.Name, call.Arguments))
+	}
+	return msg
+}
+
+// convert converts msg into messages. Tool calls become ToolCalls of the message and each tool
+// response becomes a tool message, as the OpenAI format has one tool response per message.
+func convert(msg trace.Message) []Message {
+	var messages []Message
+	var parts []Part
+	base := Message{Role: msg.Role}
+
+	for _, content := range msg.Contents {
+		switch content.Type {
+		case "tool_call":
+			base.ToolCalls = append(base.ToolCalls, toolCall(content.ID, content.Name, content.Arguments))
+		case "tool_response":
+			messages = append(messages, Message{
+				Role:       "tool",
+				Name:       content.Name,
+				ToolCallID: content.ToolCallID,
+				Content:    jsonString(content.Result),
+			})
+		default:
+			parts = append(parts, Part{
+				Type:      content.Type,
+				Text:      content.Text,
+				MediaType: content.MediaType,
+				URL:       content.URL,
+				Title:     content.Title,
+			})
+		}
+	}
+
+	if len(parts) == 1 && parts[0].Type == "text" {
+		base.Content = parts[0].Text
+	} else if len(parts) > 0 {
+		base.Content = parts
+	}
+	if base.Content == nil && len(base.ToolCalls) == 0 {
+		return messages
+	}
+	return append([]Message{base}, messages...)
+}
+
+func toolCall(id, name string, args map[string]any) ToolCall {
+	return ToolCall{
+		ID:   id,
+		Type: "function",
+		Function: Function{
+			Name:      name,
+			Arguments: jsonString(args),
+		},
+	}
+}
+
+// jsonString encodes v as a JSON string, or returns "{}" if v is nil.
+func jsonString(v map[string]any) string {
+	if v == nil {
+		return "{}"
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	return string(raw)
+}
@@ -0,0 +1,350 @@
+// Package langfuse provides a trace.Repository that exports traces recorded by gollem to
+// Langfuse (https://langfuse.com) through its ingestion API.
+//
+// Spans of a trace are mapped to Langfuse observations: LLM calls to generations with the model,
+// token usage and chat messages, tool executions, sub-agents and the agent execution to spans,
+// and strategy events such as plan phases of planexec to events.
+//
+//	repo := langfuse.New(publicKey, secretKey, langfuse.WithHost("https://us.cloud.langfuse.com"))
+//	agent := gollem.New(client, gollem.WithTrace(trace.New(trace.WithRepository(repo))))
+package langfuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gollem/trace/internal/chat"
+)
+
+const (
+	// DefaultHost is the host of Langfuse Cloud (EU region).
+	DefaultHost = "https://cloud.langfuse.com"
+
+	// LabelSessionID is the label of trace.TraceMetadata set as the session ID of the trace.
+	LabelSessionID = "session_id"
+	// LabelUserID is the label of trace.TraceMetadata set as the user ID of the trace.
+	LabelUserID = "user_id"
+
+	// maxBatchSize is the max number of events sent by one ingestion request
+	maxBatchSize = 100
+)
+
+// Repository is a trace.Repository that sends traces to Langfuse.
+type Repository struct {
+	publicKey string
+	secretKey string
+	host      string
+	client    *http.Client
+}
+
+var _ trace.Repository = (*Repository)(nil)
+
+// Option is a functional option for Repository.
+type Option func(*Repository)
+
+// WithHost sets the host of Langfuse, e.g. "https://us.cloud.langfuse.com" or the URL of a
+// self-hosted server. Default is DefaultHost.
+func WithHost(host string) Option {
+	return func(r *Repository) {
+		r.host = strings.TrimRight(host, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client to send requests. Default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Repository) {
+		r.client = client
+	}
+}
+
+// New creates a Repository with the public key and the secret key of a Langfuse project.
+func New(publicKey, secretKey string, opts ...Option) *Repository {
+	r := &Repository{
+		publicKey: publicKey,
+		secretKey: secretKey,
+		host:      DefaultHost,
+		client:    http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Save sends the trace to Langfuse. It returns an error if Langfuse rejects any event of the
+// trace.
+func (r *Repository) Save(ctx context.Context, t *trace.Trace) error {
+	events := convertTrace(ctx, t)
+	for start := 0; start < len(events); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(events))
+		if err := r.ingest(ctx, events[start:end]); err != nil {
+			return goerr.Wrap(err, "failed to send trace to Langfuse", goerr.V("trace_id", t.TraceID))
+		}
+	}
+	return nil
+}
+
+type ingestionRequest struct {
+	Batch []*event `json:"batch"`
+}
+
+type ingestionResponse struct {
+	Errors []struct {
+		ID      string `json:"id"`
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (r *Repository) ingest(ctx context.Context, events []*event) error {
+	body, err := json.Marshal(ingestionRequest{Batch: events})
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal ingestion request")
+	}
+
+	url := r.host + "/api/public/ingestion"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return goerr.Wrap(err, "failed to create ingestion request", goerr.V("url", url))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(r.publicKey, r.secretKey)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return goerr.Wrap(err, "failed to send ingestion request", goerr.V("url", url))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return goerr.Wrap(err, "failed to read ingestion response")
+	}
+	if resp.StatusCode >= 300 {
+		return goerr.New("ingestion request failed",
+			goerr.V("status", resp.StatusCode),
+			goerr.V("body", string(respBody)))
+	}
+
+	// Langfuse responds 207 with errors of each event
+	var result ingestionResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return goerr.Wrap(err, "failed to decode ingestion response", goerr.V("body", string(respBody)))
+	}
+	if len(result.Errors) > 0 {
+		e := result.Errors[0]
+		return goerr.New("Langfuse rejected events",
+			goerr.V("errors", len(result.Errors)),
+			goerr.V("id", e.ID),
+			goerr.V("status", e.Status),
+			goerr.V("message", e.Message))
+	}
+	return nil
+}
+
+// event is an event of the ingestion API.
+type event struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	Body      any    `json:"body"`
+}
+
+type traceBody struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name,omitempty"`
+	Timestamp string         `json:"timestamp"`
+	SessionID string         `json:"sessionId,omitempty"`
+	UserID    string         `json:"userId,omitempty"`
+	Input     any            `json:"input,omitempty"`
+	Output    any            `json:"output,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+}
+
+type observationBody struct {
+	ID                  string         `json:"id"`
+	TraceID             string         `json:"traceId"`
+	ParentObservationID string         `json:"parentObservationId,omitempty"`
+	Name                string         `json:"name"`
+	StartTime           string         `json:"startTime"`
+	EndTime             string         `json:"endTime,omitempty"`
+	Input               any            `json:"input,omitempty"`
+	Output              any            `json:"output,omitempty"`
+	Metadata            map[string]any `json:"metadata,omitempty"`
+	Level               string         `json:"level,omitempty"`
+	StatusMessage       string         `json:"statusMessage,omitempty"`
+
+	// Fields of generations
+	Model string `json:"model,omitempty"`
+	Usage *usage `json:"usage,omitempty"`
+}
+
+type usage struct {
+	Input  int    `json:"input"`
+	Output int    `json:"output"`
+	Total  int    `json:"total"`
+	Unit   string `json:"unit"`
+}
+
+// convertTrace converts t into ingestion events: a trace-create event followed by events of
+// its spans in depth-first order.
+func convertTrace(ctx context.Context, t *trace.Trace) []*event {
+	body := &traceBody{
+		ID:        t.TraceID,
+		Name:      "gollem",
+		Timestamp: timestamp(t.StartedAt),
+		Metadata:  map[string]any{},
+	}
+	if t.Metadata.Model != "" {
+		body.Metadata["model"] = t.Metadata.Model
+	}
+	if t.Metadata.Strategy != "" {
+		body.Metadata["strategy"] = t.Metadata.Strategy
+		body.Tags = append(body.Tags, t.Metadata.Strategy)
+	}
+	for k, v := range t.Metadata.Labels {
+		switch k {
+		case LabelSessionID:
+			body.SessionID = v
+		case LabelUserID:
+			body.UserID = v
+		default:
+			body.Metadata[k] = v
+		}
+	}
+
+	events := []*event{newEvent(ctx, "trace-create", t.StartedAt, body)}
+	if t.RootSpan != nil {
+		if t.RootSpan.Name != "" {
+			body.Name = t.RootSpan.Name
+		}
+		body.Input, body.Output = traceIO(t.RootSpan)
+		events = appendSpan(ctx, events, t.TraceID, "", t.RootSpan)
+	}
+	return events
+}
+
+// traceIO returns the input of the first LLM call and the output of the last LLM call under
+// span as the input and output of the trace.
+func traceIO(span *trace.Span) (input, output any) {
+	var first, last *trace.LLMCallData
+	var walk func(s *trace.Span)
+	walk = func(s *trace.Span) {
+		if s.Kind == trace.SpanKindLLMCall && s.LLMCall != nil {
+			if first == nil {
+				first = s.LLMCall
+			}
+			last = s.LLMCall
+		}
+		for _, child := range s.Children {
+			walk(child)
+		}
+	}
+	walk(span)
+
+	if first != nil {
+		if msgs := chat.Input(first.Request); len(msgs) > 0 {
+			input = msgs
+		}
+	}
+	if last != nil {
+		if msg := chat.Output(last.Response); msg != nil {
+			output = msg
+		}
+	}
+	return input, output
+}
+
+func appendSpan(ctx context.Context, events []*event, traceID, parentID string, span *trace.Span) []*event {
+	obs := &observationBody{
+		ID:                  span.SpanID,
+		TraceID:             traceID,
+		ParentObservationID: parentID,
+		Name:                span.Name,
+		StartTime:           timestamp(span.StartedAt),
+		EndTime:             timestamp(span.EndedAt),
+		Metadata:            map[string]any{"kind": string(span.Kind)},
+	}
+	if span.Status == trace.SpanStatusError {
+		obs.Level = "ERROR"
+		obs.StatusMessage = span.Error
+	}
+
+	eventType := "span-create"
+	switch span.Kind {
+	case trace.SpanKindLLMCall:
+		eventType = "generation-create"
+		if data := span.LLMCall; data != nil {
+			obs.Model = data.Model
+			obs.Usage = &usage{
+				Input:  data.InputTokens,
+				Output: data.OutputTokens,
+				Total:  data.InputTokens + data.OutputTokens,
+				Unit:   "TOKENS",
+			}
+			if msgs := chat.Input(data.Request); len(msgs) > 0 {
+				obs.Input = msgs
+			}
+			if msg := chat.Output(data.Response); msg != nil {
+				obs.Output = msg
+			}
+			if data.Request != nil && len(data.Request.Tools) > 0 {
+				obs.Metadata["tools"] = data.Request.Tools
+			}
+		}
+
+	case trace.SpanKindToolExec:
+		if data := span.ToolExec; data != nil {
+			obs.Name = data.ToolName
+			obs.Input = data.Args
+			obs.Output = data.Result
+			if data.Error != "" {
+				obs.Level = "ERROR"
+				obs.StatusMessage = data.Error
+			}
+		}
+
+	case trace.SpanKindEvent:
+		// Events are points in time and have no end time
+		eventType = "event-create"
+		obs.EndTime = ""
+		if data := span.Event; data != nil {
+			obs.Name = data.Kind
+			obs.Input = data.Data
+		}
+	}
+
+	events = append(events, newEvent(ctx, eventType, span.StartedAt, obs))
+	for _, child := range span.Children {
+		events = appendSpan(ctx, events, traceID, span.SpanID, child)
+	}
+	return events
+}
+
+func newEvent(ctx context.Context, eventType string, ts time.Time, body any) *event {
+	if ts.IsZero() {
+		ts = gollem.Now(ctx)
+	}
+	return &event{
+		ID:        gollem.NewID(ctx),
+		Type:      eventType,
+		Timestamp: timestamp(ts),
+		Body:      body,
+	}
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
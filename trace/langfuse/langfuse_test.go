@@ -0,0 +1,154 @@
+package langfuse_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gollem/trace/langfuse"
+	"github.com/m-mizutani/gt"
+)
+
+type ingestionEvent struct {
+	Type string         `json:"type"`
+	Body map[string]any `json:"body"`
+}
+
+func newTestTrace() *trace.Trace {
+	now := time.Now()
+	return &trace.Trace{
+		TraceID: "trace-1",
+		RootSpan: &trace.Span{
+			SpanID:    "root",
+			Kind:      trace.SpanKindAgentExecute,
+			Name:      "agent_execute",
+			StartedAt: now,
+			EndedAt:   now.Add(3 * time.Second),
+			Status:    trace.SpanStatusOK,
+			Children: []*trace.Span{
+				{
+					SpanID:    "event-1",
+					ParentID:  "root",
+					Kind:      trace.SpanKindEvent,
+					Name:      "plan_created",
+					StartedAt: now,
+					Status:    trace.SpanStatusOK,
+					Event:     &trace.EventData{Kind: "plan_created", Data: map[string]any{"tasks": 2}},
+				},
+				{
+					SpanID:    "llm-1",
+					ParentID:  "root",
+					Kind:      trace.SpanKindLLMCall,
+					Name:      "llm_call",
+					StartedAt: now,
+					EndedAt:   now.Add(time.Second),
+					Status:    trace.SpanStatusOK,
+					LLMCall: &trace.LLMCallData{
+						InputTokens:  10,
+						OutputTokens: 5,
+						Model:        "gpt-test",
+						Request: &trace.LLMRequest{
+							SystemPrompt: "be helpful",
+							Messages: []trace.Message{
+								{Role: "user", Contents: []trace.MessageContent{trace.NewTextContent("hello")}},
+							},
+						},
+						Response: &trace.LLMResponse{
+							FunctionCalls: []*trace.FunctionCall{
+								{ID: "call_1", Name: "search", Arguments: map[string]any{"q": "go"}},
+							},
+						},
+					},
+				},
+				{
+					SpanID:    "tool-1",
+					ParentID:  "root",
+					Kind:      trace.SpanKindToolExec,
+					Name:      "search",
+					StartedAt: now.Add(time.Second),
+					EndedAt:   now.Add(2 * time.Second),
+					Status:    trace.SpanStatusError,
+					Error:     "timeout",
+					ToolExec:  &trace.ToolExecData{ToolName: "search", Args: map[string]any{"q": "go"}, Error: "timeout"},
+				},
+			},
+		},
+		Metadata: trace.TraceMetadata{
+			Model:    "gpt-test",
+			Strategy: "planexec",
+			Labels:   map[string]string{langfuse.LabelSessionID: "session-1", "tenant": "acme"},
+		},
+		StartedAt: now,
+		EndedAt:   now.Add(3 * time.Second),
+	}
+}
+
+func TestRepositorySave(t *testing.T) {
+	var events []ingestionEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gt.Equal(t, r.URL.Path, "/api/public/ingestion")
+		user, pass, ok := r.BasicAuth()
+		gt.True(t, ok)
+		gt.Equal(t, user, "pk-test")
+		gt.Equal(t, pass, "sk-test")
+
+		var req struct {
+			Batch []ingestionEvent `json:"batch"`
+		}
+		gt.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		events = append(events, req.Batch...)
+
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(`{"successes":[],"errors":[]}`))
+	}))
+	defer srv.Close()
+
+	repo := langfuse.New("pk-test", "sk-test", langfuse.WithHost(srv.URL+"/"))
+	gt.NoError(t, repo.Save(context.Background(), newTestTrace()))
+
+	gt.A(t, events).Length(5)
+	types := make([]string, len(events))
+	for i, ev := range events {
+		types[i] = ev.Type
+	}
+	gt.Equal(t, types, []string{"trace-create", "span-create", "event-create", "generation-create", "span-create"})
+
+	traceBody := events[0].Body
+	gt.Equal(t, traceBody["id"], any("trace-1"))
+	gt.Equal(t, traceBody["sessionId"], any("session-1"))
+	gt.Equal(t, traceBody["metadata"].(map[string]any)["tenant"], any("acme"))
+
+	event := events[2].Body
+	gt.Equal(t, event["name"], any("plan_created"))
+	gt.Equal(t, event["parentObservationId"], any("root"))
+
+	gen := events[3].Body
+	gt.Equal(t, gen["model"], any("gpt-test"))
+	gt.Equal(t, gen["usage"].(map[string]any)["total"], any(float64(15)))
+	input := gen["input"].([]any)
+	gt.A(t, input).Length(2)
+	gt.Equal(t, input[0].(map[string]any)["role"], any("system"))
+	gt.Equal(t, input[1].(map[string]any)["content"], any("hello"))
+	call := gen["output"].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	gt.Equal(t, call["function"].(map[string]any)["arguments"], any(`{"q":"go"}`))
+
+	tool := events[4].Body
+	gt.Equal(t, tool["name"], any("search"))
+	gt.Equal(t, tool["level"], any("ERROR"))
+	gt.Equal(t, tool["statusMessage"], any("timeout"))
+}
+
+func TestRepositorySaveRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(`{"successes":[],"errors":[{"id":"x","status":400,"message":"invalid"}]}`))
+	}))
+	defer srv.Close()
+
+	repo := langfuse.New("pk-test", "sk-test", langfuse.WithHost(srv.URL))
+	gt.Error(t, repo.Save(context.Background(), newTestTrace()))
+}
@@ -0,0 +1,278 @@
+// Package langsmith provides a trace.Repository that exports traces recorded by gollem to
+// LangSmith (https://smith.langchain.com) through its run API.
+//
+// Spans of a trace are mapped to LangSmith runs: LLM calls to "llm" runs with the model, token
+// usage and chat messages, tool executions to "tool" runs, and the agent execution, sub-agents
+// and strategy events such as plan phases of planexec to "chain" runs.
+//
+//	repo := langsmith.New(apiKey, langsmith.WithProject("my-agent"))
+//	agent := gollem.New(client, gollem.WithTrace(trace.New(trace.WithRepository(repo))))
+package langsmith
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gollem/trace/internal/chat"
+)
+
+const (
+	// DefaultEndpoint is the endpoint of LangSmith (US region).
+	DefaultEndpoint = "https://api.smith.langchain.com"
+	// DefaultProject is the project of runs if WithProject is not set.
+	DefaultProject = "default"
+
+	// maxBatchSize is the max number of runs sent by one batch request
+	maxBatchSize = 100
+)
+
+// Repository is a trace.Repository that sends traces to LangSmith.
+type Repository struct {
+	apiKey   string
+	endpoint string
+	project  string
+	client   *http.Client
+}
+
+var _ trace.Repository = (*Repository)(nil)
+
+// Option is a functional option for Repository.
+type Option func(*Repository)
+
+// WithEndpoint sets the API endpoint of LangSmith, e.g. "https://eu.api.smith.langchain.com" or
+// the URL of a self-hosted server. Default is DefaultEndpoint.
+func WithEndpoint(endpoint string) Option {
+	return func(r *Repository) {
+		r.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithProject sets the project (session) name of runs. Default is DefaultProject.
+func WithProject(project string) Option {
+	return func(r *Repository) {
+		r.project = project
+	}
+}
+
+// WithHTTPClient sets the HTTP client to send requests. Default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Repository) {
+		r.client = client
+	}
+}
+
+// New creates a Repository with the API key of LangSmith.
+func New(apiKey string, opts ...Option) *Repository {
+	r := &Repository{
+		apiKey:   apiKey,
+		endpoint: DefaultEndpoint,
+		project:  DefaultProject,
+		client:   http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Save sends the runs of the trace to LangSmith.
+func (r *Repository) Save(ctx context.Context, t *trace.Trace) error {
+	runs := convertTrace(t, r.project)
+	for start := 0; start < len(runs); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(runs))
+		if err := r.post(ctx, runs[start:end]); err != nil {
+			return goerr.Wrap(err, "failed to send trace to LangSmith", goerr.V("trace_id", t.TraceID))
+		}
+	}
+	return nil
+}
+
+type batchRequest struct {
+	Post []*run `json:"post"`
+}
+
+func (r *Repository) post(ctx context.Context, runs []*run) error {
+	body, err := json.Marshal(batchRequest{Post: runs})
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal batch request")
+	}
+
+	url := r.endpoint + "/runs/batch"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return goerr.Wrap(err, "failed to create batch request", goerr.V("url", url))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", r.apiKey)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return goerr.Wrap(err, "failed to send batch request", goerr.V("url", url))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return goerr.New("batch request failed",
+			goerr.V("status", resp.StatusCode),
+			goerr.V("body", string(respBody)))
+	}
+	return nil
+}
+
+// run is a run of the LangSmith API.
+type run struct {
+	ID          string         `json:"id"`
+	TraceID     string         `json:"trace_id"`
+	ParentRunID string         `json:"parent_run_id,omitempty"`
+	DottedOrder string         `json:"dotted_order"`
+	Name        string         `json:"name"`
+	RunType     string         `json:"run_type"`
+	StartTime   string         `json:"start_time"`
+	EndTime     string         `json:"end_time,omitempty"`
+	Inputs      map[string]any `json:"inputs"`
+	Outputs     map[string]any `json:"outputs,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Extra       map[string]any `json:"extra,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	SessionName string         `json:"session_name"`
+}
+
+// convertTrace converts t into runs in depth-first order. The root span becomes the root run,
+// whose ID is the trace ID of LangSmith.
+func convertTrace(t *trace.Trace, project string) []*run {
+	if t.RootSpan == nil {
+		return nil
+	}
+
+	metadata := map[string]any{"gollem_trace_id": t.TraceID}
+	if t.Metadata.Model != "" {
+		metadata["model"] = t.Metadata.Model
+	}
+	if t.Metadata.Strategy != "" {
+		metadata["strategy"] = t.Metadata.Strategy
+	}
+	for k, v := range t.Metadata.Labels {
+		metadata[k] = v
+	}
+
+	traceID := runID(t.RootSpan.SpanID)
+	var runs []*run
+	var walk func(span *trace.Span, parent *run)
+	walk = func(span *trace.Span, parent *run) {
+		r := convertSpan(span, traceID, parent, project)
+		if parent == nil {
+			r.Extra["metadata"] = metadata
+			if t.Metadata.Strategy != "" {
+				r.Tags = []string{t.Metadata.Strategy}
+			}
+		}
+		runs = append(runs, r)
+		for _, child := range span.Children {
+			walk(child, r)
+		}
+	}
+	walk(t.RootSpan, nil)
+	return runs
+}
+
+func convertSpan(span *trace.Span, traceID string, parent *run, project string) *run {
+	r := &run{
+		ID:          runID(span.SpanID),
+		TraceID:     traceID,
+		Name:        span.Name,
+		RunType:     "chain",
+		StartTime:   timestamp(span.StartedAt),
+		EndTime:     timestamp(span.EndedAt),
+		Inputs:      map[string]any{},
+		Error:       span.Error,
+		Extra:       map[string]any{"metadata": map[string]any{"kind": string(span.Kind)}},
+		SessionName: project,
+	}
+	r.DottedOrder = dottedOrder(span.StartedAt, r.ID)
+	if parent != nil {
+		r.ParentRunID = parent.ID
+		r.DottedOrder = parent.DottedOrder + "." + r.DottedOrder
+	}
+
+	switch span.Kind {
+	case trace.SpanKindLLMCall:
+		r.RunType = "llm"
+		if data := span.LLMCall; data != nil {
+			r.Extra["metadata"] = map[string]any{
+				"kind":          string(span.Kind),
+				"ls_model_name": data.Model,
+			}
+			if msgs := chat.Input(data.Request); len(msgs) > 0 {
+				r.Inputs["messages"] = msgs
+			}
+			if data.Request != nil && len(data.Request.Tools) > 0 {
+				r.Inputs["tools"] = data.Request.Tools
+			}
+			r.Outputs = map[string]any{
+				"usage_metadata": map[string]int{
+					"input_tokens":  data.InputTokens,
+					"output_tokens": data.OutputTokens,
+					"total_tokens":  data.InputTokens + data.OutputTokens,
+				},
+			}
+			if msg := chat.Output(data.Response); msg != nil {
+				r.Outputs["choices"] = []map[string]any{{"message": msg}}
+			}
+		}
+
+	case trace.SpanKindToolExec:
+		r.RunType = "tool"
+		if data := span.ToolExec; data != nil {
+			r.Name = data.ToolName
+			if data.Args != nil {
+				r.Inputs = data.Args
+			}
+			r.Outputs = data.Result
+			if data.Error != "" {
+				r.Error = data.Error
+			}
+		}
+
+	case trace.SpanKindEvent:
+		// Events are points in time, so the run ends when it starts
+		r.EndTime = r.StartTime
+		if data := span.Event; data != nil {
+			r.Name = data.Kind
+			r.Inputs["data"] = data.Data
+		}
+	}
+
+	return r
+}
+
+// runID returns id if it's a UUID, as LangSmith requires, or a UUID derived from id.
+func runID(id string) string {
+	if u, err := uuid.Parse(id); err == nil {
+		return u.String()
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(id)).String()
+}
+
+// dottedOrder returns the element of the dotted order of a run, which orders runs of a trace by
+// their start time.
+func dottedOrder(t time.Time, id string) string {
+	t = t.UTC()
+	return t.Format("20060102T150405") + fmt.Sprintf("%06dZ", t.Nanosecond()/1000) + id
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,123 @@
+package langsmith_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-mizutani/gollem/trace"
+	"github.com/m-mizutani/gollem/trace/langsmith"
+	"github.com/m-mizutani/gt"
+)
+
+func TestRepositorySave(t *testing.T) {
+	var runs []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gt.Equal(t, r.URL.Path, "/runs/batch")
+		gt.Equal(t, r.Header.Get("x-api-key"), "ls-test")
+
+		var req struct {
+			Post []map[string]any `json:"post"`
+		}
+		gt.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		runs = append(runs, req.Post...)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	rootID := uuid.NewString()
+	now := time.Now()
+	tr := &trace.Trace{
+		TraceID: "trace-1",
+		RootSpan: &trace.Span{
+			SpanID:    rootID,
+			Kind:      trace.SpanKindAgentExecute,
+			Name:      "agent_execute",
+			StartedAt: now,
+			EndedAt:   now.Add(2 * time.Second),
+			Status:    trace.SpanStatusOK,
+			Children: []*trace.Span{
+				{
+					SpanID:    "llm-1",
+					Kind:      trace.SpanKindLLMCall,
+					Name:      "llm_call",
+					StartedAt: now,
+					EndedAt:   now.Add(time.Second),
+					Status:    trace.SpanStatusOK,
+					LLMCall: &trace.LLMCallData{
+						InputTokens:  10,
+						OutputTokens: 5,
+						Model:        "claude-test",
+						Request: &trace.LLMRequest{
+							Messages: []trace.Message{
+								{Role: "tool", Contents: []trace.MessageContent{
+									trace.NewToolResponseContent("call_1", "search", map[string]any{"hits": 1}),
+								}},
+							},
+						},
+						Response: &trace.LLMResponse{Texts: []string{"done"}},
+					},
+				},
+				{
+					SpanID:    "tool-1",
+					Kind:      trace.SpanKindToolExec,
+					Name:      "search",
+					StartedAt: now.Add(time.Second),
+					EndedAt:   now.Add(2 * time.Second),
+					Status:    trace.SpanStatusOK,
+					ToolExec:  &trace.ToolExecData{ToolName: "search", Args: map[string]any{"q": "go"}},
+				},
+			},
+		},
+		Metadata:  trace.TraceMetadata{Strategy: "react"},
+		StartedAt: now,
+		EndedAt:   now.Add(2 * time.Second),
+	}
+
+	repo := langsmith.New("ls-test", langsmith.WithEndpoint(srv.URL), langsmith.WithProject("my-agent"))
+	gt.NoError(t, repo.Save(context.Background(), tr))
+
+	gt.A(t, runs).Length(3)
+	root, llm, tool := runs[0], runs[1], runs[2]
+
+	gt.Equal(t, root["id"], any(rootID))
+	gt.Equal(t, root["trace_id"], any(rootID))
+	gt.Equal(t, root["session_name"], any("my-agent"))
+	gt.Equal(t, root["extra"].(map[string]any)["metadata"].(map[string]any)["gollem_trace_id"], any("trace-1"))
+
+	gt.Equal(t, llm["run_type"], any("llm"))
+	gt.Equal(t, llm["parent_run_id"], any(rootID))
+	gt.Equal(t, llm["trace_id"], any(rootID))
+	_, err := uuid.Parse(llm["id"].(string))
+	gt.NoError(t, err)
+	gt.True(t, strings.HasPrefix(llm["dotted_order"].(string), root["dotted_order"].(string)+"."))
+	msg := llm["inputs"].(map[string]any)["messages"].([]any)[0].(map[string]any)
+	gt.Equal(t, msg["role"], any("tool"))
+	gt.Equal(t, msg["tool_call_id"], any("call_1"))
+	gt.Equal(t, msg["content"], any(`{"hits":1}`))
+	usage := llm["outputs"].(map[string]any)["usage_metadata"].(map[string]any)
+	gt.Equal(t, usage["total_tokens"], any(float64(15)))
+
+	gt.Equal(t, tool["run_type"], any("tool"))
+	gt.Equal(t, tool["inputs"].(map[string]any)["q"], any("go"))
+}
+
+func TestRepositorySaveFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	repo := langsmith.New("ls-test", langsmith.WithEndpoint(srv.URL))
+	err := repo.Save(context.Background(), &trace.Trace{
+		TraceID:  "trace-1",
+		RootSpan: &trace.Span{SpanID: "root", Kind: trace.SpanKindAgentExecute, StartedAt: now, EndedAt: now},
+	})
+	gt.Error(t, err)
+}
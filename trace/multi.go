@@ -40,6 +40,18 @@ func (m *multiHandler) wrapContexts(base context.Context, handlerCtxs []context.
 	return context.WithValue(base, multiCtxKey{}, handlerCtxs)
 }
 
+// TraceID returns the first trace ID told by the handlers.
+func (m *multiHandler) TraceID() string {
+	for _, h := range m.handlers {
+		if t, ok := h.(interface{ TraceID() string }); ok {
+			if id := t.TraceID(); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
 func (m *multiHandler) StartAgentExecute(ctx context.Context) context.Context {
 	handlerCtxs := make([]context.Context, len(m.handlers))
 	for i, h := range m.handlers {
@@ -77,6 +77,15 @@ func HandlerFrom(ctx context.Context) Handler {
 	return h
 }
 
+// TraceIDFrom returns the ID of the trace recorded by the Handler of ctx, e.g. to propagate it
+// to external services. Returns empty if the Handler does not tell it.
+func TraceIDFrom(ctx context.Context) string {
+	if h, ok := HandlerFrom(ctx).(interface{ TraceID() string }); ok {
+		return h.TraceID()
+	}
+	return ""
+}
+
 // withCurrentSpan stores the current span in the context.
 func withCurrentSpan(ctx context.Context, span *Span) context.Context {
 	return context.WithValue(ctx, currentSpanKey{}, span)
@@ -146,6 +155,7 @@ func (r *Recorder) StartAgentExecute(ctx context.Context) context.Context {
 	}
 
 	r.trace = &Trace{
+		Version:   TraceVersion,
 		TraceID:   traceID,
 		RootSpan:  span,
 		Metadata:  r.metadata,
@@ -366,6 +376,16 @@ func (r *Recorder) Trace() *Trace {
 	return r.trace
 }
 
+// TraceID returns the ID of the current trace. Returns empty if no trace is active.
+func (r *Recorder) TraceID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.trace == nil {
+		return ""
+	}
+	return r.trace.TraceID
+}
+
 // startChildSpan is a helper to start a child span of the current span.
 func (r *Recorder) startChildSpan(ctx context.Context, kind SpanKind, name string) context.Context {
 	r.mu.Lock()
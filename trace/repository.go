@@ -14,6 +14,12 @@ type Repository interface {
 	Save(ctx context.Context, trace *Trace) error
 }
 
+// SnapshotRepository is the interface for persisting execution snapshots (see gollem.Snapshot).
+// A snapshot is any JSON-serializable value identified by id.
+type SnapshotRepository interface {
+	SaveSnapshot(ctx context.Context, id string, snapshot any) error
+}
+
 // FileRepository persists trace data as JSON files.
 type FileRepository struct {
 	dir string
@@ -42,3 +48,26 @@ func (r *FileRepository) Save(_ context.Context, trace *Trace) error {
 
 	return nil
 }
+
+// SaveSnapshot writes the snapshot as JSON to {dir}/{id}.snapshot.json.
+func (r *FileRepository) SaveSnapshot(_ context.Context, id string, snapshot any) error {
+	if err := os.MkdirAll(r.dir, 0750); err != nil {
+		return goerr.Wrap(err, "failed to create trace directory", goerr.V("dir", r.dir))
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal snapshot")
+	}
+
+	filePath := filepath.Join(r.dir, id+SnapshotFileSuffix)
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		return goerr.Wrap(err, "failed to write snapshot file", goerr.V("path", filePath))
+	}
+
+	return nil
+}
+
+// SnapshotFileSuffix is the file name suffix of snapshots written by FileRepository. Trace
+// viewers skip files with this suffix.
+const SnapshotFileSuffix = ".snapshot.json"
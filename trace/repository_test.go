@@ -160,3 +160,18 @@ func TestFileRepositoryWithChildren(t *testing.T) {
 	gt.Equal(t, loaded.RootSpan.Children[0].LLMCall.Request.SystemPrompt, "You are helpful.")
 	gt.Equal(t, loaded.RootSpan.Children[1].ToolExec.ToolName, "search")
 }
+
+func TestFileRepositorySaveSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	repo := trace.NewFileRepository(dir)
+
+	err := repo.SaveSnapshot(context.Background(), "snap-1", map[string]string{"id": "snap-1"})
+	gt.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, "snap-1"+trace.SnapshotFileSuffix))
+	gt.NoError(t, err)
+
+	var loaded map[string]string
+	gt.NoError(t, json.Unmarshal(data, &loaded))
+	gt.Equal(t, "snap-1", loaded["id"])
+}
@@ -1,8 +1,12 @@
 package trace
 
 import (
+	"encoding/json"
 	"runtime"
 	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem/internal/migrate"
 )
 
 // SpanKind represents the type of a span.
@@ -24,8 +28,22 @@ const (
 	SpanStatusError SpanStatus = "error"
 )
 
+// TraceVersion is the version of the JSON format of Trace.
+const TraceVersion = 1
+
+// ErrUnsupportedVersion is returned when a serialized trace has a version that cannot be
+// upgraded to TraceVersion, e.g. of a newer library.
+var ErrUnsupportedVersion = migrate.ErrUnsupportedVersion
+
+// traceMigrator upgrades serialized traces of older versions on load. Traces written before
+// the version field was added are version 0 and have the same format as v1.
+var traceMigrator = migrate.New("version", TraceVersion, map[int]migrate.Step{
+	0: func(doc migrate.Document) error { return nil },
+})
+
 // Trace represents the root tracing data for an agent execution.
 type Trace struct {
+	Version   int           `json:"version"`
 	TraceID   string        `json:"trace_id"`
 	RootSpan  *Span         `json:"root_span"`
 	Metadata  TraceMetadata `json:"metadata"`
@@ -33,6 +51,23 @@ type Trace struct {
 	EndedAt   time.Time     `json:"ended_at"`
 }
 
+// UnmarshalJSON implements json.Unmarshaler. A trace of an older version is upgraded to
+// TraceVersion. Returns ErrUnsupportedVersion if the version cannot be upgraded.
+func (x *Trace) UnmarshalJSON(data []byte) error {
+	data, err := traceMigrator.Upgrade(data)
+	if err != nil {
+		return goerr.Wrap(err, "failed to migrate trace")
+	}
+
+	type traceAlias Trace
+	var t traceAlias
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	*x = Trace(t)
+	return nil
+}
+
 // TraceMetadata holds metadata for a trace.
 type TraceMetadata struct {
 	Model    string            `json:"model,omitempty"`
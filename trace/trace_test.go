@@ -1,6 +1,7 @@
 package trace_test
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -104,3 +105,16 @@ func TestEventData(t *testing.T) {
 	gt.B(t, ok).True()
 	gt.Equal(t, data.Goal, "implement feature")
 }
+
+func TestTraceVersion(t *testing.T) {
+	// Traces written before the version field was added are upgraded
+	var tr trace.Trace
+	gt.NoError(t, json.Unmarshal([]byte(`{"trace_id":"old","root_span":{"span_id":"root","kind":"agent_execute"},"metadata":{"model":"test-model"}}`), &tr))
+	gt.Equal(t, trace.TraceVersion, tr.Version)
+	gt.Equal(t, "old", tr.TraceID)
+	gt.Equal(t, trace.SpanKindAgentExecute, tr.RootSpan.Kind)
+	gt.Equal(t, "test-model", tr.Metadata.Model)
+
+	err := json.Unmarshal([]byte(`{"version":99,"trace_id":"new"}`), &tr)
+	gt.Error(t, err).Is(trace.ErrUnsupportedVersion)
+}
@@ -0,0 +1,318 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+)
+
+const (
+	spinnerInterval = 100 * time.Millisecond
+	maxArgsLength   = 60
+	// maxTextBytes bounds the LLM output kept for rendering its last lines
+	maxTextBytes = 64 * 1024
+)
+
+var (
+	spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+	headerStyle  = lipgloss.NewStyle().Bold(true)
+	faintStyle   = lipgloss.NewStyle().Faint(true)
+	successStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	activeStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+)
+
+// Messages sent to the model from hooks and middleware
+type (
+	startMsg struct{}
+	endMsg   struct {
+		inputTokens  int
+		outputTokens int
+		duration     time.Duration
+		err          error
+	}
+	textMsg struct {
+		// source identifies the LLM call of the text. Text of another source starts a new block.
+		source string
+		text   string
+	}
+	toolStartMsg struct {
+		id   string
+		name string
+		args map[string]any
+	}
+	toolEndMsg struct {
+		id       string
+		duration time.Duration
+		err      error
+	}
+	planMsg struct {
+		goal  string
+		tasks []planexec.Task
+	}
+	doneMsg struct {
+		err error
+	}
+	tickMsg struct{}
+)
+
+func newPlanMsg(plan *planexec.Plan) planMsg {
+	return planMsg{goal: plan.Goal, tasks: slices.Clone(plan.Tasks)}
+}
+
+type toolActivity struct {
+	id       string
+	name     string
+	args     string
+	running  bool
+	duration time.Duration
+	err      error
+}
+
+// model is the Bubble Tea model rendering progress of agent runs.
+type model struct {
+	maxTextLines int
+	maxTools     int
+
+	goal  string
+	tasks []planexec.Task
+	tools []*toolActivity
+
+	text       string
+	textSource string
+
+	inputTokens  int
+	outputTokens int
+	startedAt    time.Time
+
+	frame       int
+	width       int
+	done        bool
+	interrupted bool
+	err         error
+}
+
+func newModel(maxTextLines, maxTools int) *model {
+	return &model{
+		maxTextLines: maxTextLines,
+		maxTools:     maxTools,
+		startedAt:    time.Now(),
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(spinnerInterval, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+func (m *model) Init() tea.Cmd {
+	return tick()
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			m.interrupted = true
+			return m, tea.Quit
+		}
+
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+
+	case tickMsg:
+		if m.done {
+			return m, nil
+		}
+		m.frame = (m.frame + 1) % len(spinnerFrames)
+		return m, tick()
+
+	case startMsg:
+		// The next text is a new block even if it comes from the same source, e.g. a conclusion
+		m.textSource = ""
+
+	case endMsg:
+		m.inputTokens += msg.inputTokens
+		m.outputTokens += msg.outputTokens
+
+	case textMsg:
+		if msg.source != m.textSource && m.text != "" {
+			m.text += "\n\n"
+		}
+		m.textSource = msg.source
+		m.text += msg.text
+		if len(m.text) > maxTextBytes {
+			m.text = m.text[len(m.text)-maxTextBytes:]
+		}
+
+	case toolStartMsg:
+		m.tools = append(m.tools, &toolActivity{
+			id:      msg.id,
+			name:    msg.name,
+			args:    formatArgs(msg.args),
+			running: true,
+		})
+
+	case toolEndMsg:
+		for _, tool := range m.tools {
+			if tool.running && tool.id == msg.id {
+				tool.running = false
+				tool.duration = msg.duration
+				tool.err = msg.err
+				break
+			}
+		}
+
+	case planMsg:
+		m.goal = msg.goal
+		m.tasks = msg.tasks
+
+	case doneMsg:
+		m.done = true
+		m.err = msg.err
+		return m, tea.Quit
+	}
+
+	return m, nil
+}
+
+func (m *model) View() string {
+	var sections []string
+	if len(m.tasks) > 0 {
+		sections = append(sections, m.planView())
+	}
+	if len(m.tools) > 0 {
+		sections = append(sections, m.toolsView())
+	}
+	if text := m.textView(); text != "" {
+		sections = append(sections, text)
+	}
+	sections = append(sections, m.statusView())
+	return strings.Join(sections, "\n\n") + "\n"
+}
+
+func (m *model) planView() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render("Plan"))
+	if m.goal != "" {
+		b.WriteString(": " + m.goal)
+	}
+
+	// Without a hook of task start, the first unfinished task is the running one
+	active := slices.IndexFunc(m.tasks, func(t planexec.Task) bool {
+		return t.State == planexec.TaskStateInProgress
+	})
+	if active < 0 && !m.done {
+		active = slices.IndexFunc(m.tasks, func(t planexec.Task) bool {
+			return t.State == planexec.TaskStatePending
+		})
+	}
+
+	for i, task := range m.tasks {
+		b.WriteString("\n  ")
+		switch {
+		case task.State == planexec.TaskStateCompleted:
+			b.WriteString(successStyle.Render("✓") + " " + task.Description)
+		case task.State == planexec.TaskStateSkipped:
+			b.WriteString(faintStyle.Render("- " + task.Description + " (skipped)"))
+		case i == active:
+			b.WriteString(activeStyle.Render(m.spinner()) + " " + task.Description)
+		default:
+			b.WriteString(faintStyle.Render("○ " + task.Description))
+		}
+	}
+	return b.String()
+}
+
+func (m *model) toolsView() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render("Tools"))
+
+	tools := m.tools
+	if hidden := len(tools) - m.maxTools; hidden > 0 {
+		tools = tools[hidden:]
+		b.WriteString(faintStyle.Render(fmt.Sprintf(" (%d earlier)", hidden)))
+	}
+	for _, tool := range tools {
+		b.WriteString("\n  ")
+		call := tool.name
+		if tool.args != "" {
+			call += " " + faintStyle.Render(tool.args)
+		}
+		switch {
+		case tool.running:
+			b.WriteString(activeStyle.Render(m.spinner()) + " " + call)
+		case tool.err != nil:
+			b.WriteString(errorStyle.Render("✗") + " " + call + " " + faintStyle.Render(formatDuration(tool.duration)) +
+				"\n    " + errorStyle.Render(tool.err.Error()))
+		default:
+			b.WriteString(successStyle.Render("✓") + " " + call + " " + faintStyle.Render(formatDuration(tool.duration)))
+		}
+	}
+	return b.String()
+}
+
+func (m *model) textView() string {
+	text := strings.TrimSpace(m.text)
+	if text == "" || m.maxTextLines <= 0 {
+		return ""
+	}
+	if m.width > 0 {
+		text = lipgloss.NewStyle().Width(m.width).Render(text)
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > m.maxTextLines {
+		lines = lines[len(lines)-m.maxTextLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) statusView() string {
+	usage := fmt.Sprintf("%s · %d input / %d output tokens", formatDuration(time.Since(m.startedAt)), m.inputTokens, m.outputTokens)
+	switch {
+	case m.err != nil:
+		return errorStyle.Render("✗ Failed: "+m.err.Error()) + " " + faintStyle.Render(usage)
+	case m.done:
+		return successStyle.Render("✓ Done") + " " + faintStyle.Render(usage)
+	case m.interrupted:
+		return errorStyle.Render("Interrupted") + " " + faintStyle.Render(usage)
+	}
+	return activeStyle.Render(m.spinner()+" Running") + " " + faintStyle.Render(usage+" · q to quit")
+}
+
+func (m *model) spinner() string {
+	return spinnerFrames[m.frame]
+}
+
+// formatArgs formats tool arguments as "key=value" pairs in order of keys, truncated to
+// maxArgsLength runes.
+func formatArgs(args map[string]any) string {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", key, args[key])
+	}
+	s := strings.Join(pairs, " ")
+	if runes := []rune(s); len(runes) > maxArgsLength {
+		s = string(runes[:maxArgsLength-1]) + "…"
+	}
+	return s
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,261 @@
+// Package tui renders progress of gollem agents in the terminal with Bubble Tea: todos of a plan
+// of planexec, streaming LLM output, tool activity and token usage. It's wired only through
+// public hooks and middleware of gollem and planexec, so it can be added to any agent.
+//
+//	ui := tui.New()
+//	strategy := planexec.New(client, ui.PlanOptions())
+//	agent := gollem.New(client, gollem.WithStrategy(strategy), ui.AgentOptions())
+//	err := ui.Run(ctx, func(ctx context.Context) error {
+//		_, err := agent.Execute(ctx, gollem.Text("Investigate the alert"))
+//		return err
+//	})
+package tui
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+)
+
+const (
+	// DefaultMaxTextLines is the default number of last lines of LLM output rendered.
+	DefaultMaxTextLines = 12
+	// DefaultMaxTools is the default number of last tool executions rendered.
+	DefaultMaxTools = 6
+)
+
+// Renderer renders progress of agent runs in the terminal while Run is running. Events from
+// agents and strategies outside Run are ignored. It's safe for concurrent use, e.g. by tools
+// executed in parallel.
+type Renderer struct {
+	programOptions []tea.ProgramOption
+	maxTextLines   int
+	maxTools       int
+
+	mu      sync.Mutex
+	program *tea.Program
+	calls   atomic.Int64
+}
+
+// Option is an option of New.
+type Option func(*Renderer)
+
+// WithOutput sets the writer of the rendered output. Default is os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(r *Renderer) {
+		r.programOptions = append(r.programOptions, tea.WithOutput(w))
+	}
+}
+
+// WithInput sets the reader of key input, e.g. to quit by q or ctrl+c. nil disables key input.
+// Default is os.Stdin.
+func WithInput(reader io.Reader) Option {
+	return func(r *Renderer) {
+		r.programOptions = append(r.programOptions, tea.WithInput(reader))
+	}
+}
+
+// WithMaxTextLines sets the number of last lines of LLM output rendered. Default is
+// DefaultMaxTextLines.
+func WithMaxTextLines(n int) Option {
+	return func(r *Renderer) {
+		r.maxTextLines = n
+	}
+}
+
+// WithMaxTools sets the number of last tool executions rendered. Default is DefaultMaxTools.
+func WithMaxTools(n int) Option {
+	return func(r *Renderer) {
+		r.maxTools = n
+	}
+}
+
+// New creates a Renderer.
+func New(opts ...Option) *Renderer {
+	r := &Renderer{
+		maxTextLines: DefaultMaxTextLines,
+		maxTools:     DefaultMaxTools,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run renders progress while fn runs, and returns the error of fn. Run agents within fn with the
+// ctx passed to it. The ctx is canceled when the user quits by q or ctrl+c, and Run waits for fn
+// to return. The final state is left in the terminal.
+func (r *Renderer) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	options := append([]tea.ProgramOption{tea.WithContext(ctx)}, r.programOptions...)
+	program := tea.NewProgram(newModel(r.maxTextLines, r.maxTools), options...)
+	r.mu.Lock()
+	if r.program != nil {
+		r.mu.Unlock()
+		return goerr.New("Run of the renderer is already running")
+	}
+	r.program = program
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.program = nil
+		r.mu.Unlock()
+	}()
+
+	fnErr := make(chan error, 1)
+	go func() {
+		err := fn(ctx)
+		program.Send(doneMsg{err: err})
+		fnErr <- err
+	}()
+
+	_, runErr := program.Run()
+	// Stop fn if the user quit or the program failed
+	cancel()
+	if err := <-fnErr; err != nil {
+		return err
+	}
+	if runErr != nil && ctx.Err() == nil {
+		return goerr.Wrap(runErr, "failed to render progress")
+	}
+	return nil
+}
+
+// send passes msg to the running program, if any.
+func (r *Renderer) send(msg tea.Msg) {
+	r.mu.Lock()
+	program := r.program
+	r.mu.Unlock()
+	if program != nil {
+		program.Send(msg)
+	}
+}
+
+// newSource returns a source of text unique to an LLM call.
+func (r *Renderer) newSource() string {
+	return "call-" + strconv.FormatInt(r.calls.Add(1), 10)
+}
+
+// AgentOptions returns options of an agent to render its LLM output, tool executions and token
+// usage. LLM output is streamed with gollem.ResponseModeStreaming and rendered per response
+// otherwise.
+func (r *Renderer) AgentOptions() gollem.Option {
+	return gollem.WithOptions(
+		gollem.WithConversationStartHook(func(ctx context.Context, event *gollem.ConversationStartEvent) error {
+			r.send(startMsg{})
+			return nil
+		}),
+		gollem.WithConversationEndHook(func(ctx context.Context, event *gollem.ConversationEndEvent) {
+			r.send(endMsg{inputTokens: event.InputToken, outputTokens: event.OutputToken, duration: event.Duration, err: event.Error})
+		}),
+		gollem.WithContentBlockMiddleware(r.contentBlockMiddleware),
+		gollem.WithContentStreamMiddleware(r.contentStreamMiddleware),
+		gollem.WithToolMiddleware(r.toolMiddleware),
+	)
+}
+
+func (r *Renderer) contentBlockMiddleware(next gollem.ContentBlockHandler) gollem.ContentBlockHandler {
+	return func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+		resp, err := next(ctx, req)
+		if err == nil && resp != nil && len(resp.Texts) > 0 {
+			r.send(textMsg{source: r.newSource(), text: strings.Join(resp.Texts, "\n")})
+		}
+		return resp, err
+	}
+}
+
+func (r *Renderer) contentStreamMiddleware(next gollem.ContentStreamHandler) gollem.ContentStreamHandler {
+	return func(ctx context.Context, req *gollem.ContentRequest) (<-chan *gollem.ContentResponse, error) {
+		stream, err := next(ctx, req)
+		if err != nil {
+			return stream, err
+		}
+
+		source := r.newSource()
+		out := make(chan *gollem.ContentResponse)
+		go func() {
+			defer close(out)
+			for resp := range stream {
+				if text := strings.Join(resp.Texts, ""); text != "" {
+					r.send(textMsg{source: source, text: text})
+				}
+				out <- resp
+			}
+		}()
+		return out, nil
+	}
+}
+
+func (r *Renderer) toolMiddleware(next gollem.ToolHandler) gollem.ToolHandler {
+	return func(ctx context.Context, req *gollem.ToolExecRequest) (*gollem.ToolExecResponse, error) {
+		id := req.Tool.ID
+		r.send(toolStartMsg{id: id, name: req.Tool.Name, args: req.Tool.Arguments})
+
+		startedAt := time.Now()
+		resp, err := next(ctx, req)
+
+		toolErr := err
+		if toolErr == nil && resp != nil {
+			toolErr = resp.Error
+		}
+		r.send(toolEndMsg{id: id, duration: time.Since(startedAt), err: toolErr})
+		return resp, err
+	}
+}
+
+// PlanOptions returns options of planexec to render todos of the plan and the streamed final
+// conclusion. Output of tasks is rendered by AgentOptions.
+func (r *Renderer) PlanOptions() planexec.Option {
+	hooks := r.PlanHooks()
+	handler := r.StreamHandler()
+	return func(s *planexec.Strategy) {
+		planexec.WithHooks(hooks)(s)
+		planexec.WithPlanStreamHandler(handler)(s)
+	}
+}
+
+// PlanHooks returns planexec hooks rendering todos of the plan, to be combined with other hooks.
+func (r *Renderer) PlanHooks() planexec.PlanExecuteHooks {
+	return &planHooks{renderer: r}
+}
+
+// StreamHandler returns a planexec stream handler rendering the final conclusion. Chunks of tasks
+// are ignored as AgentOptions renders them.
+func (r *Renderer) StreamHandler() planexec.StreamHandler {
+	return func(ctx context.Context, chunk *planexec.StreamChunk) {
+		if chunk.Phase != planexec.StreamPhaseConclusion || chunk.Text == "" {
+			return
+		}
+		r.send(textMsg{source: string(planexec.StreamPhaseConclusion), text: chunk.Text})
+	}
+}
+
+type planHooks struct {
+	renderer *Renderer
+}
+
+func (h *planHooks) OnPlanCreated(ctx context.Context, plan *planexec.Plan) error {
+	h.renderer.send(newPlanMsg(plan))
+	return nil
+}
+
+func (h *planHooks) OnPlanUpdated(ctx context.Context, plan *planexec.Plan) error {
+	h.renderer.send(newPlanMsg(plan))
+	return nil
+}
+
+func (h *planHooks) OnTaskDone(ctx context.Context, plan *planexec.Plan, task *planexec.Task) error {
+	h.renderer.send(newPlanMsg(plan))
+	return nil
+}
@@ -0,0 +1,147 @@
+package tui_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gollem/strategy/planexec"
+	"github.com/m-mizutani/gollem/tui"
+	"github.com/m-mizutani/gt"
+)
+
+type lookupTool struct{}
+
+func (t *lookupTool) Spec() gollem.ToolSpec {
+	return gollem.ToolSpec{
+		Name:        "lookup",
+		Description: "Look up a domain",
+		Parameters: map[string]*gollem.Parameter{
+			"domain": {Type: gollem.TypeString, Description: "domain name"},
+		},
+	}
+}
+
+func (t *lookupTool) Run(ctx context.Context, args map[string]any) (map[string]any, error) {
+	if args["domain"] == "broken.example" {
+		return nil, errors.New("lookup timed out")
+	}
+	return map[string]any{"ip": "192.0.2.1"}, nil
+}
+
+// newClient returns a client calling the lookup tool and answering with its result. Responses
+// pass through content block middleware of the session like an LLM client.
+func newClient() *mock.LLMClientMock {
+	return &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			cfg := gollem.NewSessionConfig(options...)
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, _ ...gollem.GenerateOption) (*gollem.Response, error) {
+					handler := cfg.ContentBlockChain(func(ctx context.Context, req *gollem.ContentRequest) (*gollem.ContentResponse, error) {
+						if _, ok := input[0].(gollem.FunctionResponse); ok {
+							return &gollem.ContentResponse{Texts: []string{"evil.example resolves to 192.0.2.1"}, InputToken: 20, OutputToken: 8}, nil
+						}
+						return &gollem.ContentResponse{
+							FunctionCalls: []*gollem.FunctionCall{
+								{ID: "call_1", Name: "lookup", Arguments: map[string]any{"domain": "evil.example"}},
+								{ID: "call_2", Name: "lookup", Arguments: map[string]any{"domain": "broken.example"}},
+							},
+							InputToken:  10,
+							OutputToken: 5,
+						}, nil
+					})
+					resp, err := handler(ctx, &gollem.ContentRequest{Inputs: input})
+					if err != nil {
+						return nil, err
+					}
+					return &gollem.Response{Texts: resp.Texts, FunctionCalls: resp.FunctionCalls, InputToken: resp.InputToken, OutputToken: resp.OutputToken}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	t.Run("agent run", func(t *testing.T) {
+		var buf bytes.Buffer
+		ui := tui.New(tui.WithOutput(&buf), tui.WithInput(nil))
+		agent := gollem.New(newClient(), gollem.WithTools(&lookupTool{}), ui.AgentOptions())
+
+		err := ui.Run(t.Context(), func(ctx context.Context) error {
+			_, err := agent.Execute(ctx, gollem.Text("check evil.example"))
+			return err
+		})
+		gt.NoError(t, err)
+
+		out := buf.String()
+		gt.True(t, strings.Contains(out, "lookup domain=evil.example"))
+		gt.True(t, strings.Contains(out, "lookup timed out"))
+		gt.True(t, strings.Contains(out, "evil.example resolves to 192.0.2.1"))
+		gt.True(t, strings.Contains(out, "Done"))
+		gt.True(t, strings.Contains(out, "30 input / 13 output tokens"))
+	})
+
+	t.Run("plan todos", func(t *testing.T) {
+		var buf bytes.Buffer
+		ui := tui.New(tui.WithOutput(&buf), tui.WithInput(nil))
+		hooks := ui.PlanHooks()
+		stream := ui.StreamHandler()
+
+		err := ui.Run(t.Context(), func(ctx context.Context) error {
+			plan := &planexec.Plan{
+				Goal: "Judge evil.example",
+				Tasks: []planexec.Task{
+					{ID: "1", Description: "Resolve the domain", State: planexec.TaskStateCompleted},
+					{ID: "2", Description: "Check WHOIS", State: planexec.TaskStateSkipped},
+					{ID: "3", Description: "Write a verdict", State: planexec.TaskStatePending},
+				},
+			}
+			gt.NoError(t, hooks.OnPlanCreated(ctx, plan))
+			stream(ctx, &planexec.StreamChunk{Phase: planexec.StreamPhaseTask, TaskID: "1", Text: "task output"})
+			stream(ctx, &planexec.StreamChunk{Phase: planexec.StreamPhaseConclusion, Text: "The domain is "})
+			stream(ctx, &planexec.StreamChunk{Phase: planexec.StreamPhaseConclusion, Text: "malicious."})
+			return nil
+		})
+		gt.NoError(t, err)
+
+		out := buf.String()
+		gt.True(t, strings.Contains(out, "Plan: Judge evil.example"))
+		gt.True(t, strings.Contains(out, "✓ Resolve the domain"))
+		gt.True(t, strings.Contains(out, "Check WHOIS (skipped)"))
+		gt.True(t, strings.Contains(out, "Write a verdict"))
+		gt.True(t, strings.Contains(out, "The domain is malicious."))
+		gt.False(t, strings.Contains(out, "task output"))
+	})
+
+	t.Run("error of fn", func(t *testing.T) {
+		var buf bytes.Buffer
+		ui := tui.New(tui.WithOutput(&buf), tui.WithInput(nil))
+		errFailed := errors.New("investigation failed")
+
+		err := ui.Run(t.Context(), func(ctx context.Context) error {
+			return errFailed
+		})
+		gt.Error(t, err).Is(errFailed)
+		gt.True(t, strings.Contains(buf.String(), "Failed: investigation failed"))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		var buf bytes.Buffer
+		ui := tui.New(tui.WithOutput(&buf), tui.WithInput(nil))
+		ctx, cancel := context.WithCancel(t.Context())
+
+		err := ui.Run(ctx, func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		gt.Error(t, err).Is(context.Canceled)
+	})
+}
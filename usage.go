@@ -0,0 +1,160 @@
+package gollem
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// Phases of LLM calls used to break down Usage.
+const (
+	// UsagePhaseExecute is the phase of LLM calls in the agent loop. In plan strategies, it's
+	// the execution of tasks.
+	UsagePhaseExecute = "execute"
+
+	// UsagePhasePlan is the phase of LLM calls creating a plan.
+	UsagePhasePlan = "plan"
+
+	// UsagePhaseReflect is the phase of LLM calls reflecting on results.
+	UsagePhaseReflect = "reflect"
+
+	// UsagePhaseSummarize is the phase of LLM calls summarizing, such as conclusions, history
+	// compaction and reasoning summaries.
+	UsagePhaseSummarize = "summarize"
+
+	// UsagePhaseEvaluate is the phase of LLM calls evaluating responses, such as confidence
+	// signals.
+	UsagePhaseEvaluate = "evaluate"
+
+	// UsagePhaseRepair is the phase of LLM calls repairing invalid tool arguments.
+	UsagePhaseRepair = "repair"
+
+	// UsagePhaseConvert is the phase of LLM calls converting inputs that the model can not read
+	// into text, by WithModalityFallback.
+	UsagePhaseConvert = "convert"
+)
+
+// UsagePhaseSubAgent returns the phase of LLM calls made by the subagent name.
+func UsagePhaseSubAgent(name string) string {
+	return "subagent:" + name
+}
+
+// Usage is the token usage of LLM calls.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+
+	// Phases is the breakdown of the usage by phase such as UsagePhasePlan. Usage of each
+	// phase does not have Phases and Models.
+	Phases map[string]Usage `json:"phases,omitempty"`
+
+	// Models is the breakdown of the usage by model name. Calls whose model is unknown are
+	// not included.
+	Models map[string]Usage `json:"models,omitempty"`
+}
+
+// UsageTracker accumulates token usage by phase. It is safe for concurrent use.
+type UsageTracker struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+// Add adds tokens of phase and model to the tracker. model may be empty if it's unknown.
+func (t *UsageTracker) Add(phase, model string, inputTokens, outputTokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.usage.InputTokens += inputTokens
+	t.usage.OutputTokens += outputTokens
+	t.usage.Phases = addUsage(t.usage.Phases, phase, inputTokens, outputTokens)
+	if model != "" {
+		t.usage.Models = addUsage(t.usage.Models, model, inputTokens, outputTokens)
+	}
+}
+
+func addUsage(m map[string]Usage, key string, inputTokens, outputTokens int) map[string]Usage {
+	if m == nil {
+		m = make(map[string]Usage)
+	}
+	u := m[key]
+	u.InputTokens += inputTokens
+	u.OutputTokens += outputTokens
+	m[key] = u
+	return m
+}
+
+// Usage returns a copy of the accumulated usage.
+func (t *UsageTracker) Usage() *Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage := t.usage
+	usage.Phases = maps.Clone(t.usage.Phases)
+	usage.Models = maps.Clone(t.usage.Models)
+	return &usage
+}
+
+// Reset clears the accumulated usage.
+func (t *UsageTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage = Usage{}
+}
+
+type usageScopeCtxKey struct{}
+type usagePhaseCtxKey struct{}
+
+// usageScope is a UsageTracker attached to a context. Usage recorded in the scope is also added
+// to the parent scope, with parentPhase if it's set.
+type usageScope struct {
+	tracker     *UsageTracker
+	parent      *usageScope
+	parentPhase string
+}
+
+// ContextWithUsageTracker returns a context that makes RecordUsage add usage to tracker in
+// addition to the trackers already attached to ctx. If ctx has a phase, usage recorded with the
+// returned context is added to the outer trackers as that phase, and the phase of the returned
+// context is reset. It's how usage of a subagent is rolled up into one phase of its parent.
+func ContextWithUsageTracker(ctx context.Context, tracker *UsageTracker) context.Context {
+	parent, _ := ctx.Value(usageScopeCtxKey{}).(*usageScope)
+	parentPhase, _ := ctx.Value(usagePhaseCtxKey{}).(string)
+
+	ctx = context.WithValue(ctx, usageScopeCtxKey{}, &usageScope{
+		tracker:     tracker,
+		parent:      parent,
+		parentPhase: parentPhase,
+	})
+	return context.WithValue(ctx, usagePhaseCtxKey{}, "")
+}
+
+// ContextWithUsagePhase returns a context that makes RecordUsage record usage as phase.
+func ContextWithUsagePhase(ctx context.Context, phase string) context.Context {
+	return context.WithValue(ctx, usagePhaseCtxKey{}, phase)
+}
+
+// RecordUsage adds the tokens of resp to the UsageTrackers attached to ctx as the phase of ctx,
+// or UsagePhaseExecute if no phase is set, and reports them to the UsageReporters of ctx.
+// Strategies and middlewares calling LLM by their own sessions should call it with each
+// response.
+func RecordUsage(ctx context.Context, resp *Response) {
+	if resp == nil {
+		return
+	}
+	scope, _ := ctx.Value(usageScopeCtxKey{}).(*usageScope)
+	if scope == nil {
+		return
+	}
+
+	phase, _ := ctx.Value(usagePhaseCtxKey{}).(string)
+	if phase == "" {
+		phase = UsagePhaseExecute
+	}
+	reportUsage(ctx, phase, resp)
+	for ; scope != nil; scope = scope.parent {
+		scope.tracker.Add(phase, resp.Model, resp.InputToken, resp.OutputToken)
+		if scope.parentPhase != "" {
+			phase = scope.parentPhase
+		}
+	}
+}
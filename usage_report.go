@@ -0,0 +1,166 @@
+package gollem
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// UsageLabelPlanTask is the usage label of the ID of the plan task whose execution made the LLM
+// call. It's set by plan strategies.
+const UsageLabelPlanTask = "plan_task_id"
+
+// UsageReport is the usage of a single LLM call reported to a UsageReporter.
+type UsageReport struct {
+	// ExecID is the ID of the Execute call that made the LLM call
+	ExecID string `json:"exec_id"`
+	// Phase is the phase of the LLM call such as UsagePhasePlan
+	Phase string `json:"phase"`
+	// Model is the model name of the LLM call, or empty if it's unknown
+	Model        string `json:"model,omitempty"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	// CostUSD is the cost estimated by the pricing of the model, or zero if it's unknown
+	CostUSD float64 `json:"cost_usd"`
+	// Labels are the logical identifiers of the LLM call set by ContextWithUsageLabels and
+	// SetUsageLabel, e.g. a customer ID or UsageLabelPlanTask
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// UsageReporter is called after each LLM call with its usage. sessionID is the session ID of
+// WithHistoryRepository if it's set, or an ID generated for the agent. It's called
+// synchronously from the agent; hand the report off to a queue if sending it takes time.
+type UsageReporter func(ctx context.Context, sessionID string, report *UsageReport)
+
+// UsageReporterOption is an option of WithUsageReporter.
+type UsageReporterOption func(*usageReporterConfig)
+
+type usageReporterConfig struct {
+	reporter UsageReporter
+	pricing  map[string]Pricing
+}
+
+// WithReportPricing sets the pricing of a model name prefix to estimate CostUSD of reports, in
+// addition to DefaultPricing.
+func WithReportPricing(model string, pricing Pricing) UsageReporterOption {
+	return func(cfg *usageReporterConfig) {
+		cfg.pricing[model] = pricing
+	}
+}
+
+// WithUsageReporter sets a reporter called after each LLM call during Execute, including LLM
+// calls of the strategy, middlewares and subagents, with the tokens, estimated cost and labels
+// of the call. It's for billing pipelines metering usage per session or customer. Usage of a
+// subagent is also reported to the reporter of its parent agent.
+func WithUsageReporter(reporter UsageReporter, opts ...UsageReporterOption) Option {
+	cfg := &usageReporterConfig{
+		reporter: reporter,
+		pricing:  maps.Clone(DefaultPricing),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(s *gollemConfig) {
+		s.usageReporter = cfg
+	}
+}
+
+type usageReporterCtxKey struct{}
+
+// usageReporterScope is a reporter attached to the context of an Execute. Reports are also sent
+// to the reporters of parent agents.
+type usageReporterScope struct {
+	cfg       *usageReporterConfig
+	sessionID string
+	execID    string
+	parent    *usageReporterScope
+}
+
+func contextWithUsageReporter(ctx context.Context, cfg *usageReporterConfig, sessionID, execID string) context.Context {
+	parent, _ := ctx.Value(usageReporterCtxKey{}).(*usageReporterScope)
+	return context.WithValue(ctx, usageReporterCtxKey{}, &usageReporterScope{
+		cfg:       cfg,
+		sessionID: sessionID,
+		execID:    execID,
+		parent:    parent,
+	})
+}
+
+// reportUsage sends the usage of resp to the reporters attached to ctx.
+func reportUsage(ctx context.Context, phase string, resp *Response) {
+	scope, _ := ctx.Value(usageReporterCtxKey{}).(*usageReporterScope)
+	if scope == nil {
+		return
+	}
+
+	labels := usageLabelsFrom(ctx)
+	for ; scope != nil; scope = scope.parent {
+		report := &UsageReport{
+			ExecID:       scope.execID,
+			Phase:        phase,
+			Model:        resp.Model,
+			InputTokens:  resp.InputToken,
+			OutputTokens: resp.OutputToken,
+			Labels:       maps.Clone(labels),
+		}
+		if pricing, ok := lookupPricing(scope.cfg.pricing, resp.Model); ok {
+			report.CostUSD = pricing.Cost(resp.InputToken, resp.OutputToken)
+		}
+		scope.cfg.reporter(ctx, scope.sessionID, report)
+	}
+}
+
+type usageLabelsCtxKey struct{}
+
+// usageLabels holds the labels of an Execute. SetUsageLabel updates them while the Execute
+// runs.
+type usageLabels struct {
+	mu     sync.Mutex
+	labels map[string]string
+}
+
+// ContextWithUsageLabels returns a context that adds labels to the usage reported to
+// UsageReporter, e.g. a customer or tenant ID, in addition to the labels of ctx.
+func ContextWithUsageLabels(ctx context.Context, labels map[string]string) context.Context {
+	merged := usageLabelsFrom(ctx)
+	if merged == nil {
+		merged = make(map[string]string, len(labels))
+	}
+	maps.Copy(merged, labels)
+	return context.WithValue(ctx, usageLabelsCtxKey{}, &usageLabels{labels: merged})
+}
+
+// SetUsageLabel sets a label of the usage of following LLM calls in the Execute of ctx, e.g.
+// UsageLabelPlanTask while a strategy executes a task. An empty value deletes the label. It
+// does nothing if ctx has no labels, i.e. it's neither of an Execute nor of
+// ContextWithUsageLabels.
+func SetUsageLabel(ctx context.Context, key, value string) {
+	holder, _ := ctx.Value(usageLabelsCtxKey{}).(*usageLabels)
+	if holder == nil {
+		return
+	}
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	if value == "" {
+		delete(holder.labels, key)
+		return
+	}
+	if holder.labels == nil {
+		holder.labels = make(map[string]string)
+	}
+	holder.labels[key] = value
+}
+
+// usageLabelsFrom returns a copy of the labels of ctx.
+func usageLabelsFrom(ctx context.Context) map[string]string {
+	holder, _ := ctx.Value(usageLabelsCtxKey{}).(*usageLabels)
+	if holder == nil {
+		return nil
+	}
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	if len(holder.labels) == 0 {
+		return nil
+	}
+	return maps.Clone(holder.labels)
+}
@@ -0,0 +1,100 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+type reportRecord struct {
+	sessionID string
+	report    *gollem.UsageReport
+}
+
+func TestWithUsageReporter(t *testing.T) {
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"ok"}, InputToken: 1000, OutputToken: 100, Model: "claude-sonnet-4-5"}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}
+
+	var records []reportRecord
+	reporter := func(ctx context.Context, sessionID string, report *gollem.UsageReport) {
+		records = append(records, reportRecord{sessionID: sessionID, report: report})
+	}
+
+	agent := gollem.New(client, gollem.WithUsageReporter(reporter))
+	ctx := gollem.ContextWithUsageLabels(t.Context(), map[string]string{"customer": "acme"})
+	resp1, err := agent.Execute(ctx, gollem.Text("hello"))
+	gt.NoError(t, err)
+	resp2, err := agent.Execute(ctx, gollem.Text("again"))
+	gt.NoError(t, err)
+
+	gt.A(t, records).Length(2)
+	gt.True(t, records[0].sessionID != "")
+	gt.Equal(t, records[0].sessionID, records[1].sessionID)
+	gt.Equal(t, &gollem.UsageReport{
+		ExecID:       resp1.ExecID,
+		Phase:        gollem.UsagePhaseExecute,
+		Model:        "claude-sonnet-4-5",
+		InputTokens:  1000,
+		OutputTokens: 100,
+		CostUSD:      0.0045,
+		Labels:       map[string]string{"customer": "acme"},
+	}, records[0].report)
+	gt.Equal(t, resp2.ExecID, records[1].report.ExecID)
+
+	t.Run("session ID of history repository and custom pricing", func(t *testing.T) {
+		records = nil
+		agent := gollem.New(client,
+			gollem.WithHistoryRepository(&mockHistoryRepository{}, "session-1"),
+			gollem.WithUsageReporter(reporter, gollem.WithReportPricing("claude-sonnet-4-5", gollem.Pricing{InputPerMillion: 1000})),
+		)
+		_, err := agent.Execute(t.Context(), gollem.Text("hello"))
+		gt.NoError(t, err)
+		gt.A(t, records).Length(1)
+		gt.Equal(t, "session-1", records[0].sessionID)
+		gt.Equal(t, 1.0, records[0].report.CostUSD)
+		gt.Nil(t, records[0].report.Labels)
+	})
+}
+
+func TestSetUsageLabel(t *testing.T) {
+	// no panic without labels
+	gollem.SetUsageLabel(t.Context(), "key", "value")
+
+	outer := gollem.ContextWithUsageLabels(t.Context(), map[string]string{"customer": "acme"})
+	inner := gollem.ContextWithUsageLabels(outer, map[string]string{"team": "sec"})
+	gollem.SetUsageLabel(inner, gollem.UsageLabelPlanTask, "task-1")
+
+	var labels map[string]string
+	tracker := &gollem.UsageTracker{}
+	reporter := func(ctx context.Context, sessionID string, report *gollem.UsageReport) {
+		labels = report.Labels
+	}
+	agent := gollem.New(&mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"ok"}}, nil
+				},
+				HistoryFunc: func() (*gollem.History, error) {
+					return &gollem.History{}, nil
+				},
+			}, nil
+		},
+	}, gollem.WithUsageReporter(reporter))
+	_, err := agent.Execute(gollem.ContextWithUsageTracker(inner, tracker), gollem.Text("hello"))
+	gt.NoError(t, err)
+	gt.Equal(t, map[string]string{"customer": "acme", "team": "sec", gollem.UsageLabelPlanTask: "task-1"}, labels)
+}
@@ -0,0 +1,108 @@
+package gollem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gollem/mock"
+	"github.com/m-mizutani/gt"
+)
+
+func TestRecordUsage(t *testing.T) {
+	t.Run("without tracker", func(t *testing.T) {
+		// no panic
+		gollem.RecordUsage(t.Context(), &gollem.Response{InputToken: 1})
+	})
+
+	t.Run("phases and nested trackers", func(t *testing.T) {
+		outer := &gollem.UsageTracker{}
+		inner := &gollem.UsageTracker{}
+
+		ctx := gollem.ContextWithUsageTracker(t.Context(), outer)
+		gollem.RecordUsage(ctx, &gollem.Response{InputToken: 10, OutputToken: 1})
+		gollem.RecordUsage(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhasePlan), &gollem.Response{InputToken: 20, OutputToken: 2})
+
+		// usage of the inner tracker is rolled up into the phase of ctx for the outer one
+		innerCtx := gollem.ContextWithUsageTracker(gollem.ContextWithUsagePhase(ctx, gollem.UsagePhaseSubAgent("child")), inner)
+		gollem.RecordUsage(innerCtx, &gollem.Response{InputToken: 30, OutputToken: 3})
+		gollem.RecordUsage(gollem.ContextWithUsagePhase(innerCtx, gollem.UsagePhaseReflect), &gollem.Response{InputToken: 40, OutputToken: 4})
+		gollem.RecordUsage(innerCtx, nil)
+
+		gt.Equal(t, &gollem.Usage{
+			InputTokens:  70,
+			OutputTokens: 7,
+			Phases: map[string]gollem.Usage{
+				gollem.UsagePhaseExecute: {InputTokens: 30, OutputTokens: 3},
+				gollem.UsagePhaseReflect: {InputTokens: 40, OutputTokens: 4},
+			},
+		}, inner.Usage())
+
+		gt.Equal(t, &gollem.Usage{
+			InputTokens:  100,
+			OutputTokens: 10,
+			Phases: map[string]gollem.Usage{
+				gollem.UsagePhaseExecute:           {InputTokens: 10, OutputTokens: 1},
+				gollem.UsagePhasePlan:              {InputTokens: 20, OutputTokens: 2},
+				gollem.UsagePhaseSubAgent("child"): {InputTokens: 70, OutputTokens: 7},
+			},
+		}, outer.Usage())
+
+		outer.Reset()
+		gt.Equal(t, &gollem.Usage{}, outer.Usage())
+	})
+}
+
+func TestAgentUsage(t *testing.T) {
+	childClient := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					return &gollem.Response{Texts: []string{"child answer"}, InputToken: 7, OutputToken: 3}, nil
+				},
+			}, nil
+		},
+	}
+	child := gollem.NewSubAgent("researcher", "Research a topic", func() (*gollem.Agent, error) {
+		return gollem.New(childClient), nil
+	})
+
+	client := &mock.LLMClientMock{
+		NewSessionFunc: func(ctx context.Context, options ...gollem.SessionOption) (gollem.Session, error) {
+			calls := 0
+			return &mock.SessionMock{
+				GenerateFunc: func(ctx context.Context, input []gollem.Input, opts ...gollem.GenerateOption) (*gollem.Response, error) {
+					calls++
+					if calls == 1 {
+						return &gollem.Response{
+							FunctionCalls: []*gollem.FunctionCall{{ID: "1", Name: "researcher", Arguments: map[string]any{"query": "go"}}},
+							InputToken:    10,
+							OutputToken:   1,
+						}, nil
+					}
+					return &gollem.Response{Texts: []string{"done"}, InputToken: 20, OutputToken: 2}, nil
+				},
+			}, nil
+		},
+	}
+
+	agent := gollem.New(client, gollem.WithSubAgents(child))
+	resp, err := agent.Execute(t.Context(), gollem.Text("research go"))
+	gt.NoError(t, err)
+
+	expected := &gollem.Usage{
+		InputTokens:  37,
+		OutputTokens: 6,
+		Phases: map[string]gollem.Usage{
+			gollem.UsagePhaseExecute:                {InputTokens: 30, OutputTokens: 3},
+			gollem.UsagePhaseSubAgent("researcher"): {InputTokens: 7, OutputTokens: 3},
+		},
+	}
+	gt.Equal(t, expected, resp.Usage)
+	gt.Equal(t, expected, agent.Usage())
+
+	// the agent accumulates usage over Execute calls
+	_, err = agent.Execute(t.Context(), gollem.Text("again"))
+	gt.NoError(t, err)
+	gt.Equal(t, 37+20, agent.Usage().InputTokens)
+}
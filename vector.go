@@ -0,0 +1,61 @@
+package gollem
+
+import "math"
+
+// DotProduct returns the dot product of a and b, or 0 if their lengths differ. For embeddings
+// of GenerateEmbedding, which are unit vectors, it equals CosineSimilarity.
+func DotProduct(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+// VectorNorm returns the Euclidean (L2) norm of v.
+func VectorNorm(v []float64) float64 {
+	return math.Sqrt(DotProduct(v, v))
+}
+
+// CosineSimilarity returns the cosine similarity of a and b, or 0 if their lengths differ or
+// either is a zero vector.
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	normA, normB := VectorNorm(a), VectorNorm(b)
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return DotProduct(a, b) / (normA * normB)
+}
+
+// NormalizeVector returns a copy of v scaled to the unit L2 norm. A zero vector is returned as
+// a copy of itself.
+func NormalizeVector(v []float64) []float64 {
+	normalized := make([]float64, len(v))
+	norm := VectorNorm(v)
+	for i, x := range v {
+		if norm == 0 {
+			normalized[i] = x
+		} else {
+			normalized[i] = x / norm
+		}
+	}
+	return normalized
+}
+
+// NormalizeEmbeddings scales each vector of embeddings to the unit L2 norm in place and returns
+// embeddings. LLM clients of gollem apply it to results of GenerateEmbedding, because providers
+// differ in whether they normalize vectors, e.g. Gemini does not for a reduced dimension.
+// Custom LLMClient implementations should do the same so that similarities and thresholds are
+// comparable across providers.
+func NormalizeEmbeddings(embeddings [][]float64) [][]float64 {
+	for i, v := range embeddings {
+		embeddings[i] = NormalizeVector(v)
+	}
+	return embeddings
+}
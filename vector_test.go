@@ -0,0 +1,43 @@
+package gollem_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/m-mizutani/gollem"
+	"github.com/m-mizutani/gt"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestVectorMath(t *testing.T) {
+	t.Run("dot product and norm", func(t *testing.T) {
+		gt.Equal(t, 11.0, gollem.DotProduct([]float64{1, 2}, []float64{3, 4}))
+		gt.Equal(t, 0.0, gollem.DotProduct([]float64{1, 2}, []float64{3}))
+		gt.Equal(t, 5.0, gollem.VectorNorm([]float64{3, 4}))
+	})
+
+	t.Run("cosine similarity", func(t *testing.T) {
+		gt.True(t, approxEqual(1, gollem.CosineSimilarity([]float64{1, 2}, []float64{2, 4})))
+		gt.True(t, approxEqual(0, gollem.CosineSimilarity([]float64{1, 0}, []float64{0, 3})))
+		gt.True(t, approxEqual(-1, gollem.CosineSimilarity([]float64{1, 1}, []float64{-1, -1})))
+		gt.Equal(t, 0.0, gollem.CosineSimilarity([]float64{0, 0}, []float64{1, 1}))
+		gt.Equal(t, 0.0, gollem.CosineSimilarity([]float64{1}, []float64{1, 1}))
+	})
+
+	t.Run("normalize", func(t *testing.T) {
+		v := []float64{3, 4}
+		gt.Equal(t, []float64{0.6, 0.8}, gollem.NormalizeVector(v))
+		// The input is not modified
+		gt.Equal(t, []float64{3, 4}, v)
+		gt.Equal(t, []float64{0, 0}, gollem.NormalizeVector([]float64{0, 0}))
+
+		embeddings := gollem.NormalizeEmbeddings([][]float64{{0, 2}, {1, 1}})
+		gt.Equal(t, []float64{0, 1}, embeddings[0])
+		gt.True(t, approxEqual(1, gollem.VectorNorm(embeddings[1])))
+		// Dot product of unit vectors is the cosine similarity
+		gt.True(t, approxEqual(gollem.CosineSimilarity(embeddings[0], embeddings[1]), gollem.DotProduct(embeddings[0], embeddings[1])))
+	})
+}